@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"highload-microservice/internal/config"
+	"highload-microservice/internal/database"
+	"highload-microservice/internal/fieldcrypt"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/password"
+	"highload-microservice/internal/repository"
+	"highload-microservice/internal/services"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/term"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		return
+	}
+
+	command := os.Args[1]
+	args := os.Args[2:]
+
+	switch command {
+	case "create-admin":
+		if len(args) < 1 {
+			fmt.Println("Usage: admin create-admin <email> [first_name] [last_name]")
+			os.Exit(1)
+		}
+		createAdmin(args)
+	case "reset-password":
+		if len(args) < 1 {
+			fmt.Println("Usage: admin reset-password <email>")
+			os.Exit(1)
+		}
+		resetPassword(args[0])
+	case "deactivate":
+		if len(args) < 1 {
+			fmt.Println("Usage: admin deactivate <email>")
+			os.Exit(1)
+		}
+		deactivate(args[0])
+	case "list-api-keys":
+		listAPIKeys()
+	case "encrypt-users":
+		encryptUsers()
+	default:
+		printUsage()
+	}
+}
+
+func printUsage() {
+	fmt.Println("Admin User Management Utility")
+	fmt.Println("")
+	fmt.Println("Usage:")
+	fmt.Println("  admin create-admin <email> [first] [last] - Create an admin account")
+	fmt.Println("  admin reset-password <email>              - Set a new password and revoke sessions")
+	fmt.Println("  admin deactivate <email>                  - Disable login and revoke sessions")
+	fmt.Println("  admin list-api-keys                       - List API keys with masked secrets")
+	fmt.Println("  admin encrypt-users                       - Encrypt users stored before USER_ENCRYPTION_ENABLED")
+	fmt.Println("")
+	fmt.Println("Connects with the DB_* settings of the service. Passwords are read from")
+	fmt.Println("the terminal, or from ADMIN_PASSWORD when stdin is not a terminal.")
+	fmt.Println("")
+	fmt.Println("Examples:")
+	fmt.Println("  admin create-admin ops@example.com Ops Team")
+	fmt.Println("  ADMIN_PASSWORD=... admin reset-password ops@example.com < /dev/null")
+}
+
+// connect opens the service database and returns an AuthService on top of it.
+// The schema must already exist: start the service once to run migrations.
+func connect() (*services.AuthService, *sql.DB) {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Passwords set here follow the service's policy
+	passwords, err := password.FromConfig(cfg.Auth)
+	if err != nil {
+		fmt.Printf("Error loading password policy: %v\n", err)
+		os.Exit(1)
+	}
+
+	db, err := database.NewConnection(cfg.Database, nil)
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Service logs would duplicate the CLI output
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	return services.NewAuthService(repository.NewPostgresAuthRepository(db), nil, logger, services.AuthConfig{Passwords: passwords}), db
+}
+
+func createAdmin(args []string) {
+	req := services.CreateAuthUserRequest{
+		Email:     args[0],
+		FirstName: "Admin",
+		LastName:  "User",
+		Role:      models.RoleAdmin,
+	}
+	if len(args) > 1 {
+		req.FirstName = args[1]
+	}
+	if len(args) > 2 {
+		req.LastName = args[2]
+	}
+	req.Password = readNewPassword()
+
+	authService, db := connect()
+	defer func() { _ = db.Close() }()
+
+	user, err := authService.CreateAuthUser(context.Background(), req)
+	if err != nil {
+		fmt.Printf("Error creating admin: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✅ Admin created: %s (id %s)\n", user.Email, user.ID)
+}
+
+func resetPassword(email string) {
+	password := readNewPassword()
+
+	authService, db := connect()
+	defer func() { _ = db.Close() }()
+
+	userID, err := authService.ResetPassword(context.Background(), email, password)
+	if err != nil {
+		fmt.Printf("Error resetting password: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✅ Password reset for %s (id %s); existing sessions were revoked\n", email, userID)
+}
+
+func deactivate(email string) {
+	authService, db := connect()
+	defer func() { _ = db.Close() }()
+
+	userID, err := authService.DeactivateAuthUser(context.Background(), email)
+	if err != nil {
+		fmt.Printf("Error deactivating user: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✅ User deactivated: %s (id %s)\n", email, userID)
+}
+
+func listAPIKeys() {
+	authService, db := connect()
+	defer func() { _ = db.Close() }()
+
+	keys, err := authService.ListAPIKeys(context.Background())
+	if err != nil {
+		fmt.Printf("Error listing API keys: %v\n", err)
+		os.Exit(1)
+	}
+	if len(keys) == 0 {
+		fmt.Println("No API keys")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tKEY\tPERMISSIONS\tACTIVE\tLAST USED\tEXPIRES")
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%s\t%s\n", key.ID, key.Name, key.MaskedKey,
+			strings.Join(key.Permissions, ","), key.IsActive, formatTime(key.LastUsedAt), formatTime(key.ExpiresAt))
+	}
+	_ = w.Flush()
+}
+
+// encryptUsers rewrites plaintext users in batches with the user encryption
+// settings of the service
+func encryptUsers() {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if !cfg.UserEncryption.Enabled || !cfg.EventEncryption.KeyProvided {
+		fmt.Println("Error: USER_ENCRYPTION_ENABLED and ENCRYPTION_KEY must be set")
+		os.Exit(1)
+	}
+	keys, err := cfg.EventEncryption.Keys()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	encryptor, err := fieldcrypt.NewEncryptor(cfg.EventEncryption.KeyID, keys)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	indexKey, err := cfg.UserEncryption.BlindIndexKey()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	db, err := database.NewConnection(cfg.Database, nil)
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	defer func() { _ = db.Close() }()
+
+	repo := repository.NewPostgresUserRepository(db)
+	repo.SetEncryption(&repository.UserEncryption{Encryptor: encryptor, IndexKey: indexKey})
+	total := 0
+	for {
+		n, err := repo.EncryptExisting(context.Background(), 500)
+		total += n
+		if err != nil {
+			fmt.Printf("Error after encrypting %d users: %v\n", total, err)
+			os.Exit(1)
+		}
+		if n == 0 {
+			break
+		}
+	}
+	fmt.Printf("✅ Encrypted %d users\n", total)
+}
+
+// readNewPassword prompts twice on a terminal; otherwise it uses ADMIN_PASSWORD
+func readNewPassword() string {
+	fd := int(syscall.Stdin)
+	if !term.IsTerminal(fd) {
+		password := os.Getenv("ADMIN_PASSWORD")
+		if password == "" {
+			fmt.Println("Error: stdin is not a terminal and ADMIN_PASSWORD is not set")
+			os.Exit(1)
+		}
+		return password
+	}
+
+	fmt.Print("New password: ")
+	first, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		fmt.Printf("Error reading password: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Print("Repeat password: ")
+	second, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		fmt.Printf("Error reading password: %v\n", err)
+		os.Exit(1)
+	}
+	if string(first) != string(second) {
+		fmt.Println("Error: passwords do not match")
+		os.Exit(1)
+	}
+	return string(first)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"highload-microservice/internal/config"
+	"highload-microservice/internal/database"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		return
+	}
+
+	command := os.Args[1]
+	args := os.Args[2:]
+
+	switch command {
+	case "up":
+		up()
+	case "down":
+		steps := 1
+		if len(args) > 0 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 {
+				fmt.Println("Usage: migrate down [N]")
+				os.Exit(1)
+			}
+			steps = n
+		}
+		down(steps)
+	case "status":
+		status()
+	case "force":
+		if len(args) < 1 {
+			fmt.Println("Usage: migrate force <version>")
+			os.Exit(1)
+		}
+		version, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			fmt.Println("Usage: migrate force <version>")
+			os.Exit(1)
+		}
+		force(version)
+	default:
+		printUsage()
+	}
+}
+
+func printUsage() {
+	fmt.Println("Database Migration Utility")
+	fmt.Println("")
+	fmt.Println("Usage:")
+	fmt.Println("  migrate up               - Apply all pending migrations")
+	fmt.Println("  migrate down [N]         - Revert the last N applied migrations (default 1)")
+	fmt.Println("  migrate status           - Show applied and pending migrations")
+	fmt.Println("  migrate force <version>  - Mark a dirty migration as applied after fixing it by hand")
+	fmt.Println("")
+	fmt.Println("Connects with the DB_* settings of the service. Run 'migrate up' before")
+	fmt.Println("starting servers with DB_MIGRATE_ON_START=false.")
+}
+
+// connect opens the service database and loads the migrations of its driver
+func connect() (*database.Migrator, *sql.DB) {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	dialect, err := database.NewDialect(cfg.Database.Driver)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	db, err := database.NewMigrationConnection(cfg.Database)
+	if err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+	migrator, err := database.NewMigrator(db, dialect)
+	if err != nil {
+		_ = db.Close()
+		fmt.Printf("Error loading migrations: %v\n", err)
+		os.Exit(1)
+	}
+	if err := migrator.SetOnDelete(database.EventUser, cfg.EventUsers.OnDelete); err != nil {
+		_ = db.Close()
+		fmt.Printf("Error: EVENT_USER_ON_DELETE: %v\n", err)
+		os.Exit(1)
+	}
+	return migrator, db
+}
+
+func up() {
+	migrator, db := connect()
+	defer func() { _ = db.Close() }()
+
+	applied, err := migrator.Up(context.Background())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if applied == 0 {
+		fmt.Println("No pending migrations")
+		return
+	}
+	fmt.Printf("✅ Applied %d migrations\n", applied)
+}
+
+func down(steps int) {
+	migrator, db := connect()
+	defer func() { _ = db.Close() }()
+
+	reverted, err := migrator.Down(context.Background(), steps)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✅ Reverted %d migrations\n", reverted)
+}
+
+func status() {
+	migrator, db := connect()
+	defer func() { _ = db.Close() }()
+
+	statuses, err := migrator.Status(context.Background())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+	for _, s := range statuses {
+		state := "pending"
+		switch {
+		case s.Dirty:
+			state = "dirty"
+		case s.Applied:
+			state = "applied"
+		}
+		appliedAt := "-"
+		if s.AppliedAt != nil {
+			appliedAt = s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt)
+	}
+	_ = w.Flush()
+}
+
+func force(version int64) {
+	migrator, db := connect()
+	defer func() { _ = db.Close() }()
+
+	if err := migrator.Force(context.Background(), version); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✅ Migration %d marked as applied\n", version)
+}
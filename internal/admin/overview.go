@@ -0,0 +1,124 @@
+package admin
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"highload-microservice/internal/metrics"
+	"highload-microservice/internal/security"
+	"highload-microservice/internal/worker"
+
+	"github.com/gin-gonic/gin"
+)
+
+// criticalAlertLimit is how many recent critical alerts the overview lists
+const criticalAlertLimit = 10
+
+// OverviewSources supplies the sections of the overview. Nil sources are
+// left out, e.g. ConsumerLag when the messaging backend doesn't report it.
+type OverviewSources struct {
+	Traffic     func() metrics.Traffic
+	DDoS        func() map[string]interface{}
+	RateLimits  func() map[string]interface{}
+	Workers     func() worker.Stats
+	ConsumerLag func() int64
+	Databases   map[string]*sql.DB // by role: primary, replica
+	Alerts      func() []security.SecurityAlert
+}
+
+// DBPool is the connection pool usage of one database
+type DBPool struct {
+	Open         int     `json:"open"`
+	InUse        int     `json:"in_use"`
+	Idle         int     `json:"idle"`
+	MaxOpen      int     `json:"max_open"`
+	Utilization  float64 `json:"utilization"` // in use / max open, 0 when unlimited
+	WaitCount    int64   `json:"wait_count"`
+	WaitDuration string  `json:"wait_duration"`
+}
+
+// Overview serves the operational state of the service in one response:
+// traffic over the last minute, protection and worker pool stats, consumer
+// lag, database pool usage and recent critical alerts
+func Overview(sources OverviewSources) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		overview := gin.H{"timestamp": time.Now().Unix()}
+		if sources.Traffic != nil {
+			traffic := sources.Traffic()
+			overview["traffic"] = traffic
+			overview["cache"] = traffic.Cache
+		}
+		if sources.DDoS != nil {
+			overview["ddos_protection"] = sources.DDoS()
+		}
+		if sources.RateLimits != nil {
+			overview["rate_limit_exemptions"] = sources.RateLimits()
+		}
+		if sources.Workers != nil {
+			stats := sources.Workers()
+			queued := 0
+			for _, depth := range stats.QueueDepth {
+				queued += depth
+			}
+			overview["worker_pool"] = gin.H{
+				"workers":           stats.Workers,
+				"busy":              stats.Busy,
+				"queued":            queued,
+				"queue_capacity":    stats.QueueCapacity,
+				"queue_utilization": ratio(queued, stats.QueueCapacity),
+				"pending_retries":   stats.PendingRetry,
+				"types":             stats.Types,
+			}
+		}
+		if sources.ConsumerLag != nil {
+			overview["consumer"] = gin.H{"lag": sources.ConsumerLag()}
+		}
+		if len(sources.Databases) > 0 {
+			pools := make(map[string]DBPool, len(sources.Databases))
+			for role, db := range sources.Databases {
+				pools[role] = dbPool(db.Stats())
+			}
+			overview["database"] = pools
+		}
+		if sources.Alerts != nil {
+			overview["critical_alerts"] = criticalAlerts(sources.Alerts())
+		}
+		c.JSON(http.StatusOK, overview)
+	}
+}
+
+func dbPool(stats sql.DBStats) DBPool {
+	return DBPool{
+		Open:         stats.OpenConnections,
+		InUse:        stats.InUse,
+		Idle:         stats.Idle,
+		MaxOpen:      stats.MaxOpenConnections,
+		Utilization:  ratio(stats.InUse, stats.MaxOpenConnections),
+		WaitCount:    stats.WaitCount,
+		WaitDuration: stats.WaitDuration.String(),
+	}
+}
+
+// criticalAlerts keeps the newest critical alerts of alerts, which are newest
+// first
+func criticalAlerts(alerts []security.SecurityAlert) []security.SecurityAlert {
+	critical := []security.SecurityAlert{}
+	for _, alert := range alerts {
+		if alert.Severity != security.SeverityCritical {
+			continue
+		}
+		critical = append(critical, alert)
+		if len(critical) == criticalAlertLimit {
+			break
+		}
+	}
+	return critical
+}
+
+func ratio(n, total int) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
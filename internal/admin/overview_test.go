@@ -0,0 +1,75 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"highload-microservice/internal/metrics"
+	"highload-microservice/internal/security"
+	"highload-microservice/internal/worker"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOverview(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/admin/overview", Overview(OverviewSources{
+		Traffic: func() metrics.Traffic {
+			return metrics.Traffic{RequestsPerSecond: 12, Cache: map[string]metrics.CacheTraffic{"redis": {HitRate: 0.9}}}
+		},
+		Workers: func() worker.Stats {
+			return worker.Stats{Workers: 4, QueueDepth: map[string]int{"high": 10, "normal": 30}, QueueCapacity: 200}
+		},
+		ConsumerLag: func() int64 { return 7 },
+		Alerts: func() []security.SecurityAlert {
+			alerts := []security.SecurityAlert{{ID: "a1", Severity: security.SeverityHigh}}
+			for i := 0; i < criticalAlertLimit+2; i++ {
+				alerts = append(alerts, security.SecurityAlert{ID: "c", Severity: security.SeverityCritical})
+			}
+			return alerts
+		},
+	}))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/overview", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var body struct {
+		Traffic        metrics.Traffic                 `json:"traffic"`
+		Cache          map[string]metrics.CacheTraffic `json:"cache"`
+		WorkerPool     map[string]any                  `json:"worker_pool"`
+		Consumer       map[string]int64                `json:"consumer"`
+		CriticalAlerts []security.SecurityAlert        `json:"critical_alerts"`
+		Database       map[string]DBPool               `json:"database"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Traffic.RequestsPerSecond != 12 || body.Cache["redis"].HitRate != 0.9 {
+		t.Errorf("traffic = %+v, cache = %+v", body.Traffic, body.Cache)
+	}
+	if body.WorkerPool["queued"] != float64(40) || body.WorkerPool["queue_utilization"] != 0.2 {
+		t.Errorf("worker pool = %v", body.WorkerPool)
+	}
+	if body.Consumer["lag"] != 7 {
+		t.Errorf("consumer = %v", body.Consumer)
+	}
+	if len(body.CriticalAlerts) != criticalAlertLimit || body.CriticalAlerts[0].ID != "c" {
+		t.Errorf("got %d critical alerts, want the newest %d", len(body.CriticalAlerts), criticalAlertLimit)
+	}
+	if body.Database != nil {
+		t.Errorf("database section without databases: %v", body.Database)
+	}
+}
+
+func TestDBPool(t *testing.T) {
+	pool := dbPool(sql.DBStats{MaxOpenConnections: 4, OpenConnections: 4, InUse: 3, Idle: 1})
+	if pool.Open != 4 || pool.InUse != 3 || pool.Utilization != 0.75 {
+		t.Errorf("pool = %+v", pool)
+	}
+}
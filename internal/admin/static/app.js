@@ -0,0 +1,135 @@
+(function () {
+  "use strict";
+
+  var TOKEN_KEY = "admin_access_token";
+  var REFRESH_MS = 5000;
+  var MAX_ALERTS = 100;
+
+  var timer = null;
+  var stream = null;
+
+  function $(id) { return document.getElementById(id); }
+
+  function token() { return sessionStorage.getItem(TOKEN_KEY); }
+
+  function showError(message) {
+    var el = $("error");
+    el.textContent = message || "";
+    el.hidden = !message;
+  }
+
+  function api(path) {
+    return fetch(path, { headers: { "Authorization": "Bearer " + token() } }).then(function (res) {
+      if (res.status === 401 || res.status === 403) {
+        signOut();
+        throw new Error("Session expired or not an admin account");
+      }
+      return res.json().then(function (body) { return { status: res.status, body: body }; });
+    });
+  }
+
+  function renderList(el, data) {
+    el.textContent = "";
+    Object.keys(data || {}).forEach(function (key) {
+      var dt = document.createElement("dt");
+      var dd = document.createElement("dd");
+      var value = data[key];
+      dt.textContent = key.replace(/_/g, " ");
+      dd.textContent = typeof value === "object" ? JSON.stringify(value) : String(value);
+      el.appendChild(dt);
+      el.appendChild(dd);
+    });
+  }
+
+  function addAlert(alert, prepend) {
+    var row = document.createElement("tr");
+    [
+      new Date(alert.timestamp).toLocaleTimeString(),
+      alert.severity,
+      alert.title,
+      alert.risk_score,
+      alert.description
+    ].forEach(function (value, i) {
+      var td = document.createElement("td");
+      td.textContent = value;
+      if (i === 1) { td.className = "sev-" + alert.severity; }
+      row.appendChild(td);
+    });
+
+    var body = $("alerts");
+    if (prepend) { body.insertBefore(row, body.firstChild); } else { body.appendChild(row); }
+    while (body.children.length > MAX_ALERTS) { body.removeChild(body.lastChild); }
+  }
+
+  function refresh() {
+    fetch("/health").then(function (res) { return res.json(); }).then(function (body) {
+      renderList($("health"), { status: body.status, error: body.error || "-" });
+      $("health").querySelector("dd").className = body.status === "healthy" ? "ok" : "bad";
+    }).catch(function () {
+      renderList($("health"), { status: "unreachable" });
+    });
+
+    api("/admin/worker-stats").then(function (r) { renderList($("workers"), r.body.worker_pool); }).catch(fail);
+    api("/admin/ddos-stats").then(function (r) { renderList($("ddos"), r.body.ddos_protection); }).catch(fail);
+    api("/admin/security/stats").then(function (r) { renderList($("security"), r.body.security_stats); }).catch(fail);
+  }
+
+  function loadAlerts() {
+    api("/admin/security/alerts").then(function (r) {
+      $("alerts").textContent = "";
+      (r.body.alerts || []).forEach(function (a) { addAlert(a, false); });
+    }).catch(fail);
+  }
+
+  function openStream() {
+    // EventSource cannot send headers; the auth middleware also accepts ?token=
+    stream = new EventSource("/admin/security/alerts/stream?token=" + encodeURIComponent(token()));
+    stream.addEventListener("alert", function (e) { addAlert(JSON.parse(e.data), true); });
+    stream.onopen = function () { $("stream-state").textContent = "live"; $("stream-state").className = "badge live"; };
+    stream.onerror = function () { $("stream-state").textContent = "reconnecting"; $("stream-state").className = "badge"; };
+  }
+
+  function fail(err) { showError(err.message); }
+
+  function start() {
+    $("login").hidden = true;
+    $("session").hidden = false;
+    $("dashboard").hidden = false;
+    showError("");
+    refresh();
+    loadAlerts();
+    openStream();
+    timer = setInterval(refresh, REFRESH_MS);
+  }
+
+  function signOut() {
+    sessionStorage.removeItem(TOKEN_KEY);
+    if (timer) { clearInterval(timer); timer = null; }
+    if (stream) { stream.close(); stream = null; }
+    $("login").hidden = false;
+    $("session").hidden = true;
+    $("dashboard").hidden = true;
+  }
+
+  $("login").addEventListener("submit", function (e) {
+    e.preventDefault();
+    fetch("/api/v1/auth/login", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ email: $("email").value, password: $("password").value })
+    }).then(function (res) {
+      return res.json().then(function (body) {
+        if (!res.ok) { throw new Error(body.error || "Login failed"); }
+        if (body.user && body.user.role !== "admin") { throw new Error("Admin role required"); }
+        sessionStorage.setItem(TOKEN_KEY, body.access_token);
+        $("who").textContent = body.user ? body.user.email : "";
+        $("password").value = "";
+        start();
+      });
+    }).catch(fail);
+  });
+
+  $("logout").addEventListener("click", signOut);
+
+  if (token()) { start(); }
+})();
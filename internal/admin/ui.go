@@ -0,0 +1,29 @@
+// Package admin serves the embedded admin dashboard and the operational
+// overview endpoint.
+//
+// The dashboard is a static single-page app; it holds no data itself and
+// reads everything from the admin JSON endpoints using the operator's
+// bearer token, so the static files can be served without authentication.
+package admin
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed static
+var staticFiles embed.FS
+
+// RegisterUI serves the dashboard under the given router group (e.g. /admin/ui)
+func RegisterUI(group *gin.RouterGroup) {
+	assets, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		// Only possible if the embed directive above is broken
+		panic(err)
+	}
+
+	group.StaticFS("/", http.FS(assets))
+}
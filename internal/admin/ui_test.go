@@ -0,0 +1,33 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRegisterUI_ServesEmbeddedAssets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterUI(r.Group("/admin/ui"))
+
+	cases := map[string]string{
+		"/admin/ui/":          "<title>",
+		"/admin/ui/app.js":    "EventSource",
+		"/admin/ui/style.css": "body",
+	}
+	for path, want := range cases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", path, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), want) {
+			t.Fatalf("%s: expected body to contain %q", path, want)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+// Package alerting sends security alerts to people: Slack, email, PagerDuty
+// or a generic webhook. Routes pick the channels of an alert by severity and
+// event type; each channel has its own queue, rate limit and retries, and the
+// outcome of every notification is kept for the admin API.
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"highload-microservice/internal/security"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Notifier delivers alerts to one channel
+type Notifier interface {
+	// Name identifies the channel in routes and the delivery log
+	Name() string
+	Notify(ctx context.Context, alert security.SecurityAlert) error
+}
+
+// Delivery statuses
+const (
+	StatusSent        = "sent"
+	StatusFailed      = "failed"
+	StatusRateLimited = "rate_limited"
+)
+
+const (
+	// maxDeliveries bounds the in-memory delivery log
+	maxDeliveries = 200
+	// queueSize bounds the alerts waiting per channel
+	queueSize = 100
+)
+
+// Delivery is the outcome of notifying a channel of an alert
+type Delivery struct {
+	ID         uuid.UUID                 `json:"id"`
+	AlertID    string                    `json:"alert_id"`
+	AlertTitle string                    `json:"alert_title"`
+	Severity   security.SecuritySeverity `json:"severity"`
+	Channel    string                    `json:"channel"`
+	Status     string                    `json:"status"`
+	Attempts   int                       `json:"attempts"`
+	Error      string                    `json:"error,omitempty"`
+	CreatedAt  time.Time                 `json:"created_at"`
+	FinishedAt time.Time                 `json:"finished_at"`
+}
+
+// Route sends alerts of at least MinSeverity to Channel. A non-empty
+// EventTypes restricts it to alerts raised by those event types.
+type Route struct {
+	Channel     string
+	MinSeverity security.SecuritySeverity
+	EventTypes  []security.SecurityEventType
+}
+
+// Matches reports whether alert should be sent through the route
+func (r Route) Matches(alert security.SecurityAlert) bool {
+	if severityRank(alert.Severity) < severityRank(r.MinSeverity) {
+		return false
+	}
+	if len(r.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range r.EventTypes {
+		if t == alert.EventType {
+			return true
+		}
+	}
+	return false
+}
+
+func severityRank(s security.SecuritySeverity) int {
+	switch s {
+	case security.SeverityLow:
+		return 1
+	case security.SeverityMedium:
+		return 2
+	case security.SeverityHigh:
+		return 3
+	case security.SeverityCritical:
+		return 4
+	}
+	return 0
+}
+
+// ParseRoutes parses "channel=severity[:type,type];..." routes, for
+// example "slack=medium;pagerduty=critical;email=high:ddos_detected"
+func ParseRoutes(spec string) ([]Route, error) {
+	var routes []Route
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		channel, rule, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(channel) == "" {
+			return nil, fmt.Errorf("invalid alert route %q, expected channel=severity[:types]", entry)
+		}
+		severity, types, _ := strings.Cut(rule, ":")
+		route := Route{
+			Channel:     strings.TrimSpace(channel),
+			MinSeverity: security.SecuritySeverity(strings.TrimSpace(severity)),
+		}
+		if severityRank(route.MinSeverity) == 0 {
+			return nil, fmt.Errorf("invalid severity %q in alert route %q", severity, entry)
+		}
+		for _, t := range strings.Split(types, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				route.EventTypes = append(route.EventTypes, security.SecurityEventType(t))
+			}
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// Config tunes delivery
+type Config struct {
+	RatePerMinute  int           // notifications per channel and minute; 0 means no limit
+	MaxAttempts    int           // attempts per notification
+	InitialBackoff time.Duration // delay before the first retry, doubled per attempt
+	Timeout        time.Duration // per attempt
+}
+
+func (c Config) withDefaults() Config {
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 3
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = time.Second
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	return c
+}
+
+// channel is a notifier with its queue and rate limit window
+type channel struct {
+	notifier    Notifier
+	queue       chan security.SecurityAlert
+	windowStart time.Time
+	windowSent  int
+}
+
+// Dispatcher routes alerts to notifiers
+type Dispatcher struct {
+	cfg      Config
+	routes   []Route
+	channels map[string]*channel
+	logger   *logrus.Logger
+
+	mu         sync.Mutex
+	deliveries []Delivery
+
+	done    chan struct{}
+	wg      sync.WaitGroup
+	stopped sync.Once
+}
+
+// NewDispatcher validates that every route names one of notifiers
+func NewDispatcher(notifiers []Notifier, routes []Route, cfg Config, logger *logrus.Logger) (*Dispatcher, error) {
+	d := &Dispatcher{
+		cfg:      cfg.withDefaults(),
+		routes:   routes,
+		channels: make(map[string]*channel, len(notifiers)),
+		logger:   logger,
+		done:     make(chan struct{}),
+	}
+	for _, n := range notifiers {
+		d.channels[n.Name()] = &channel{notifier: n, queue: make(chan security.SecurityAlert, queueSize)}
+	}
+	for _, r := range routes {
+		if d.channels[r.Channel] == nil {
+			return nil, fmt.Errorf("alert route uses channel %q, which is not configured", r.Channel)
+		}
+	}
+	return d, nil
+}
+
+// Channels returns the names of the configured channels
+func (d *Dispatcher) Channels() []string {
+	names := make([]string, 0, len(d.channels))
+	for name := range d.channels {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Start delivers the alerts of auditor until Stop is called
+func (d *Dispatcher) Start(auditor *security.SecurityAuditor) {
+	alerts, unsubscribe := auditor.SubscribeAlerts()
+	for _, ch := range d.channels {
+		d.wg.Add(1)
+		go d.run(ch)
+	}
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer unsubscribe()
+		for {
+			select {
+			case <-d.done:
+				return
+			case alert := <-alerts:
+				d.Dispatch(alert)
+			}
+		}
+	}()
+}
+
+// Stop stops delivery; queued alerts are dropped
+func (d *Dispatcher) Stop() {
+	d.stopped.Do(func() { close(d.done) })
+	d.wg.Wait()
+}
+
+// Dispatch queues alert on the channels of the routes it matches, once per
+// channel
+func (d *Dispatcher) Dispatch(alert security.SecurityAlert) {
+	queued := map[string]bool{}
+	for _, r := range d.routes {
+		if queued[r.Channel] || !r.Matches(alert) {
+			continue
+		}
+		queued[r.Channel] = true
+		d.enqueue(d.channels[r.Channel], alert)
+	}
+}
+
+// Test queues alert on a channel regardless of routes
+func (d *Dispatcher) Test(name string, alert security.SecurityAlert) error {
+	ch := d.channels[name]
+	if ch == nil {
+		return fmt.Errorf("alert channel %q is not configured", name)
+	}
+	d.enqueue(ch, alert)
+	return nil
+}
+
+func (d *Dispatcher) enqueue(ch *channel, alert security.SecurityAlert) {
+	select {
+	case ch.queue <- alert:
+	default:
+		d.logger.Warnf("Alert queue of %s is full, dropping alert %s", ch.notifier.Name(), alert.ID)
+		now := time.Now()
+		d.record(Delivery{ID: uuid.New(), AlertID: alert.ID, AlertTitle: alert.Title, Severity: alert.Severity,
+			Channel: ch.notifier.Name(), Status: StatusFailed, Error: "queue full", CreatedAt: now, FinishedAt: now})
+	}
+}
+
+func (d *Dispatcher) run(ch *channel) {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.done:
+			return
+		case alert := <-ch.queue:
+			d.deliver(ch, alert)
+		}
+	}
+}
+
+// deliver notifies one channel of alert, retrying failures
+func (d *Dispatcher) deliver(ch *channel, alert security.SecurityAlert) {
+	delivery := Delivery{
+		ID:         uuid.New(),
+		AlertID:    alert.ID,
+		AlertTitle: alert.Title,
+		Severity:   alert.Severity,
+		Channel:    ch.notifier.Name(),
+		CreatedAt:  time.Now(),
+	}
+	defer func() {
+		delivery.FinishedAt = time.Now()
+		d.record(delivery)
+	}()
+
+	if !d.allow(ch, delivery.CreatedAt) {
+		delivery.Status = StatusRateLimited
+		d.logger.Warnf("Alert %s not sent to %s: rate limit reached", alert.ID, delivery.Channel)
+		return
+	}
+
+	backoff := d.cfg.InitialBackoff
+	for {
+		delivery.Attempts++
+		ctx, cancel := context.WithTimeout(context.Background(), d.cfg.Timeout)
+		err := ch.notifier.Notify(ctx, alert)
+		cancel()
+		if err == nil {
+			delivery.Status, delivery.Error = StatusSent, ""
+			return
+		}
+		delivery.Status, delivery.Error = StatusFailed, err.Error()
+		if delivery.Attempts >= d.cfg.MaxAttempts {
+			d.logger.Errorf("Failed to send alert %s to %s after %d attempts: %v", alert.ID, delivery.Channel, delivery.Attempts, err)
+			return
+		}
+		select {
+		case <-d.done:
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// allow counts a notification against the channel's rate limit. Only the
+// channel's goroutine calls it.
+func (d *Dispatcher) allow(ch *channel, now time.Time) bool {
+	if d.cfg.RatePerMinute <= 0 {
+		return true
+	}
+	if now.Sub(ch.windowStart) >= time.Minute {
+		ch.windowStart, ch.windowSent = now, 0
+	}
+	if ch.windowSent >= d.cfg.RatePerMinute {
+		return false
+	}
+	ch.windowSent++
+	return true
+}
+
+func (d *Dispatcher) record(delivery Delivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.deliveries = append(d.deliveries, delivery)
+	if len(d.deliveries) > maxDeliveries {
+		d.deliveries = d.deliveries[len(d.deliveries)-maxDeliveries:]
+	}
+}
+
+// Deliveries returns the most recent notifications, newest first
+func (d *Dispatcher) Deliveries() []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	deliveries := make([]Delivery, 0, len(d.deliveries))
+	for i := len(d.deliveries) - 1; i >= 0; i-- {
+		deliveries = append(deliveries, d.deliveries[i])
+	}
+	return deliveries
+}
@@ -0,0 +1,212 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/security"
+	"highload-microservice/internal/webhook"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fakeNotifier records alerts and fails the first failures calls
+type fakeNotifier struct {
+	name     string
+	mu       sync.Mutex
+	failures int
+	alerts   []security.SecurityAlert
+}
+
+func (n *fakeNotifier) Name() string { return n.name }
+
+func (n *fakeNotifier) Notify(_ context.Context, alert security.SecurityAlert) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.failures > 0 {
+		n.failures--
+		return errors.New("unavailable")
+	}
+	n.alerts = append(n.alerts, alert)
+	return nil
+}
+
+func (n *fakeNotifier) count() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.alerts)
+}
+
+// waitForDeliveries waits until the dispatcher logged n notifications
+func waitForDeliveries(t *testing.T, d *Dispatcher, n int) []Delivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if deliveries := d.Deliveries(); len(deliveries) >= n {
+			return deliveries
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("want %d deliveries, got %d", n, len(d.Deliveries()))
+	return nil
+}
+
+func TestParseRoutes(t *testing.T) {
+	routes, err := ParseRoutes(" slack=medium ; email=high:ddos_detected, ip_blocked;")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(routes) != 2 || routes[0].Channel != "slack" || len(routes[1].EventTypes) != 2 || routes[1].EventTypes[1] != security.EventTypeIPBlocked {
+		t.Fatalf("unexpected routes: %+v", routes)
+	}
+
+	ddos := security.SecurityAlert{Severity: security.SeverityCritical, EventType: security.EventTypeDDoSDetected}
+	login := security.SecurityAlert{Severity: security.SeverityHigh, EventType: security.EventTypeLoginFailure}
+	low := security.SecurityAlert{Severity: security.SeverityLow, EventType: security.EventTypeDDoSDetected}
+	if !routes[1].Matches(ddos) || routes[1].Matches(login) || routes[1].Matches(low) || !routes[0].Matches(login) {
+		t.Fatal("unexpected route matching")
+	}
+
+	for _, spec := range []string{"slack", "=high", "slack=urgent"} {
+		if _, err := ParseRoutes(spec); err == nil {
+			t.Errorf("ParseRoutes(%q): want error", spec)
+		}
+	}
+}
+
+func TestDispatcher_RoutesRetriesAndLimits(t *testing.T) {
+	slack := &fakeNotifier{name: "slack", failures: 1}
+	pager := &fakeNotifier{name: "pagerduty"}
+	routes, _ := ParseRoutes("slack=medium;pagerduty=critical;slack=low:ip_blocked")
+	d, err := NewDispatcher([]Notifier{slack, pager}, routes, Config{RatePerMinute: 2, InitialBackoff: time.Millisecond}, logrus.New())
+	if err != nil {
+		t.Fatalf("dispatcher: %v", err)
+	}
+	d.Start(security.NewSecurityAuditor(logrus.New()))
+	defer d.Stop()
+
+	// Matches both slack routes but is sent once; the first attempt fails
+	d.Dispatch(security.SecurityAlert{ID: "a1", Severity: security.SeverityCritical, EventType: security.EventTypeIPBlocked})
+	d.Dispatch(security.SecurityAlert{ID: "a2", Severity: security.SeverityLow, EventType: security.EventTypeLoginFailure})
+	d.Dispatch(security.SecurityAlert{ID: "a3", Severity: security.SeverityHigh})
+	d.Dispatch(security.SecurityAlert{ID: "a4", Severity: security.SeverityMedium})
+
+	deliveries := waitForDeliveries(t, d, 4)
+	byAlert := map[string]Delivery{}
+	for _, delivery := range deliveries {
+		if delivery.Channel == "slack" {
+			byAlert[delivery.AlertID] = delivery
+		}
+	}
+	if first := byAlert["a1"]; first.Status != StatusSent || first.Attempts != 2 {
+		t.Fatalf("want a1 sent on the second attempt, got %+v", first)
+	}
+	if _, ok := byAlert["a2"]; ok {
+		t.Fatal("a2 matches no route")
+	}
+	if byAlert["a3"].Status != StatusSent || byAlert["a4"].Status != StatusRateLimited {
+		t.Fatalf("want the third slack alert rate limited, got %+v", deliveries)
+	}
+	if slack.count() != 2 || pager.count() != 1 {
+		t.Fatalf("want 2 slack and 1 pagerduty notifications, got %d and %d", slack.count(), pager.count())
+	}
+
+	if err := d.Test("sms", security.SecurityAlert{}); err == nil {
+		t.Fatal("want an error for an unknown channel")
+	}
+	if _, err := NewDispatcher([]Notifier{slack}, []Route{{Channel: "email", MinSeverity: security.SeverityLow}}, Config{}, logrus.New()); err == nil {
+		t.Fatal("want an error for a route to an unknown channel")
+	}
+}
+
+func TestHTTPNotifiers(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests = map[string][]byte{}
+		headers  = map[string]http.Header{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests[r.URL.Path], headers[r.URL.Path] = body, r.Header
+		mu.Unlock()
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	alert := security.SecurityAlert{
+		ID:          "alert-1",
+		Timestamp:   time.Now(),
+		Severity:    security.SeverityHigh,
+		EventType:   security.EventTypeLoginFailure,
+		Title:       "Brute Force Attack Detected",
+		Description: "IP 10.0.0.1 has made 10 failed login attempts",
+		Metadata:    map[string]interface{}{"ip_address": "10.0.0.1"},
+	}
+	ctx := context.Background()
+
+	if err := (&SlackNotifier{URL: server.URL + "/slack"}).Notify(ctx, alert); err != nil {
+		t.Fatalf("slack: %v", err)
+	}
+	var slack map[string]string
+	_ = json.Unmarshal(requests["/slack"], &slack)
+	if !strings.HasPrefix(slack["text"], "[HIGH] Brute Force Attack Detected") || !strings.Contains(slack["text"], "ip_address: 10.0.0.1") {
+		t.Fatalf("unexpected slack message: %q", slack["text"])
+	}
+
+	if err := (&PagerDutyNotifier{RoutingKey: "key", URL: server.URL + "/pd"}).Notify(ctx, alert); err != nil {
+		t.Fatalf("pagerduty: %v", err)
+	}
+	var pd struct {
+		RoutingKey string `json:"routing_key"`
+		DedupKey   string `json:"dedup_key"`
+		Payload    struct {
+			Severity string `json:"severity"`
+		} `json:"payload"`
+	}
+	_ = json.Unmarshal(requests["/pd"], &pd)
+	if pd.RoutingKey != "key" || pd.DedupKey != "alert-1" || pd.Payload.Severity != "error" {
+		t.Fatalf("unexpected pagerduty event: %s", requests["/pd"])
+	}
+
+	if err := (&WebhookNotifier{URL: server.URL + "/hook", Secret: "s3cret"}).Notify(ctx, alert); err != nil {
+		t.Fatalf("webhook: %v", err)
+	}
+	timestamp, _ := strconv.ParseInt(headers["/hook"].Get(webhook.HeaderTimestamp), 10, 64)
+	if headers["/hook"].Get(webhook.HeaderSignature) != webhook.Sign("s3cret", timestamp, requests["/hook"]) {
+		t.Fatal("webhook alerts must be signed")
+	}
+
+	if err := (&SlackNotifier{URL: server.URL + "/down"}).Notify(ctx, alert); err == nil {
+		t.Fatal("want an error for a non-2xx response")
+	}
+}
+
+func TestEmailNotifier_Message(t *testing.T) {
+	n := &EmailNotifier{From: "alerts@example.com", To: []string{"a@example.com", "b@example.com"}}
+	message := string(n.message(security.SecurityAlert{
+		Severity: security.SeverityCritical,
+		Title:    "DDoS\r\nBcc: victim@example.com",
+		Actions:  []string{"Block the IP"},
+	}))
+	if !strings.Contains(message, "To: a@example.com, b@example.com\r\n") {
+		t.Fatalf("unexpected recipients: %q", message)
+	}
+	if !strings.Contains(message, "Subject: [CRITICAL] DDoS  Bcc: victim@example.com\r\n") {
+		t.Fatalf("the subject must stay on one line: %q", message)
+	}
+	if !strings.Contains(message, "\r\n- Block the IP\r\n") {
+		t.Fatalf("missing actions: %q", message)
+	}
+}
@@ -0,0 +1,180 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"highload-microservice/internal/mail"
+	"highload-microservice/internal/security"
+	"highload-microservice/internal/webhook"
+)
+
+// PagerDutyEventsURL is the PagerDuty Events API v2 endpoint
+const PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// postJSON posts body to url and fails on non-2xx responses
+func postJSON(ctx context.Context, client *http.Client, url string, body interface{}, header http.Header) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(snippet)))
+	}
+	return nil
+}
+
+// summary is the one-line text of an alert
+func summary(alert security.SecurityAlert) string {
+	return fmt.Sprintf("[%s] %s", strings.ToUpper(string(alert.Severity)), alert.Title)
+}
+
+// body is the plain text of an alert, with metadata in a stable order
+func body(alert security.SecurityAlert) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n%s\n\n", summary(alert), alert.Description)
+	fmt.Fprintf(&b, "Alert ID: %s\nTime: %s\nRisk score: %d\n", alert.ID, alert.Timestamp.UTC().Format(time.RFC3339), alert.RiskScore)
+	if alert.EventType != "" {
+		fmt.Fprintf(&b, "Event type: %s\n", alert.EventType)
+	}
+	keys := make([]string, 0, len(alert.Metadata))
+	for key := range alert.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s: %v\n", key, alert.Metadata[key])
+	}
+	if len(alert.Actions) > 0 {
+		b.WriteString("\nSuggested actions:\n")
+		for _, action := range alert.Actions {
+			fmt.Fprintf(&b, "- %s\n", action)
+		}
+	}
+	return b.String()
+}
+
+// SlackNotifier posts alerts to a Slack incoming webhook
+type SlackNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func (n *SlackNotifier) Name() string { return "slack" }
+
+func (n *SlackNotifier) Notify(ctx context.Context, alert security.SecurityAlert) error {
+	return postJSON(ctx, n.Client, n.URL, map[string]string{"text": body(alert)}, nil)
+}
+
+// PagerDutyNotifier triggers PagerDuty incidents through the Events API v2.
+// The alert ID is the dedup key, so retries do not open new incidents.
+type PagerDutyNotifier struct {
+	RoutingKey string
+	URL        string // PagerDutyEventsURL when empty
+	Client     *http.Client
+}
+
+func (n *PagerDutyNotifier) Name() string { return "pagerduty" }
+
+func (n *PagerDutyNotifier) Notify(ctx context.Context, alert security.SecurityAlert) error {
+	url := n.URL
+	if url == "" {
+		url = PagerDutyEventsURL
+	}
+	// PagerDuty severities are critical, error, warning and info
+	severity := map[security.SecuritySeverity]string{
+		security.SeverityCritical: "critical",
+		security.SeverityHigh:     "error",
+		security.SeverityMedium:   "warning",
+	}[alert.Severity]
+	if severity == "" {
+		severity = "info"
+	}
+	return postJSON(ctx, n.Client, url, map[string]interface{}{
+		"routing_key":  n.RoutingKey,
+		"event_action": "trigger",
+		"dedup_key":    alert.ID,
+		"payload": map[string]interface{}{
+			"summary":        summary(alert),
+			"source":         "highload-microservice",
+			"severity":       severity,
+			"timestamp":      alert.Timestamp.UTC().Format(time.RFC3339),
+			"class":          string(alert.EventType),
+			"custom_details": alert,
+		},
+	}, nil)
+}
+
+// WebhookNotifier posts alerts as JSON to any endpoint. With a secret the
+// request is signed like event webhooks (X-Webhook-Signature).
+type WebhookNotifier struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+func (n *WebhookNotifier) Name() string { return "webhook" }
+
+func (n *WebhookNotifier) Notify(ctx context.Context, alert security.SecurityAlert) error {
+	header := http.Header{}
+	if n.Secret != "" {
+		data, err := json.Marshal(alert)
+		if err != nil {
+			return err
+		}
+		timestamp := time.Now().Unix()
+		header.Set(webhook.HeaderTimestamp, fmt.Sprint(timestamp))
+		header.Set(webhook.HeaderSignature, webhook.Sign(n.Secret, timestamp, data))
+	}
+	return postJSON(ctx, n.Client, n.URL, alert, header)
+}
+
+// EmailNotifier sends alerts by SMTP. STARTTLS is used when the server
+// offers it; credentials are only sent over TLS.
+type EmailNotifier struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+func (n *EmailNotifier) Name() string { return "email" }
+
+func (n *EmailNotifier) Notify(ctx context.Context, alert security.SecurityAlert) error {
+	sender := &mail.SMTPSender{Addr: n.Addr, Username: n.Username, Password: n.Password, From: n.From}
+	return sender.Send(ctx, n.mail(alert))
+}
+
+func (n *EmailNotifier) mail(alert security.SecurityAlert) mail.Message {
+	return mail.Message{To: n.To, Subject: summary(alert), Body: body(alert)}
+}
+
+// message builds the RFC 5322 message of alert
+func (n *EmailNotifier) message(alert security.SecurityAlert) []byte {
+	return mail.Format(n.From, n.mail(alert))
+}
@@ -0,0 +1,287 @@
+// Package analytics reports event volume and processing latency. A scheduled
+// job rolls the events table up into hourly counts per type, latency bucket
+// and user, so the stats endpoint reads a few small tables instead of
+// scanning events.
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Bucket sizes of the event count series
+const (
+	BucketHour = "hour"
+	BucketDay  = "day"
+)
+
+// LatencyBounds are the upper bounds, in milliseconds, of the processing
+// latency buckets. Percentiles are interpolated within a bucket.
+var LatencyBounds = []int64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000, 300000}
+
+const (
+	// unprocessed is the latency bucket of events not processed yet
+	unprocessed int64 = 0
+	// overflow is the latency bucket of events slower than every bound
+	overflow int64 = -1
+)
+
+const (
+	maxHourlyRange  = 31 * 24 * time.Hour
+	maxDailyRange   = 366 * 24 * time.Hour
+	defaultTopUsers = 10
+	maxTopUsers     = 100
+	// maxRollupHours bounds the hours rolled up by one run, so a backfill
+	// of old events is spread over several runs
+	maxRollupHours = 7 * 24
+)
+
+// Percentiles reported for processing latency
+var Percentiles = []float64{50, 90, 95, 99}
+
+// Query selects the stats of events created in [From, To)
+type Query struct {
+	From     time.Time
+	To       time.Time
+	Bucket   string // BucketHour or BucketDay
+	TopUsers int    // users to return, by event volume
+}
+
+// TypeCount is the number of events of a type created in a bucket
+type TypeCount struct {
+	Bucket time.Time `json:"bucket"`
+	Type   string    `json:"type"`
+	Events int64     `json:"events"`
+}
+
+// UserCount is the number of events of a user
+type UserCount struct {
+	UserID uuid.UUID `json:"user_id"`
+	Events int64     `json:"events"`
+}
+
+// Latency summarizes the time from creation until the consumer processed
+// events, in milliseconds
+type Latency struct {
+	Processed   int64              `json:"processed"`
+	Unprocessed int64              `json:"unprocessed"`
+	Percentiles map[string]float64 `json:"percentiles_ms"` // "p50", "p90", ...
+}
+
+// Stats are the aggregates of events in a range
+type Stats struct {
+	From       time.Time   `json:"from"`
+	To         time.Time   `json:"to"`
+	Bucket     string      `json:"bucket"`
+	Total      int64       `json:"total"`
+	ByType     []TypeCount `json:"by_type"`
+	TopUsers   []UserCount `json:"top_users"`
+	Latency    Latency     `json:"latency"`
+	RolledUpTo *time.Time  `json:"rolled_up_to,omitempty"` // start of the last hour rolled up
+	RolledUpAt *time.Time  `json:"rolled_up_at,omitempty"` // when the rollup last ran
+}
+
+// Config tunes the rollup
+type Config struct {
+	// Lookback is how many hours before the last one rolled up are rolled
+	// up again, to count events processed late
+	Lookback time.Duration
+}
+
+// Service reports event stats and maintains the rollups
+type Service struct {
+	store  Store
+	cfg    Config
+	logger *logrus.Logger
+}
+
+func NewService(store Store, cfg Config, logger *logrus.Logger) *Service {
+	if cfg.Lookback < 0 {
+		cfg.Lookback = 0
+	}
+	return &Service{store: store, cfg: cfg, logger: logger}
+}
+
+// RecordProcessed records the processing latency of a consumed event
+func (s *Service) RecordProcessed(ctx context.Context, eventID uuid.UUID, createdAt, processedAt time.Time) error {
+	latency := processedAt.Sub(createdAt)
+	if latency < 0 {
+		latency = 0
+	}
+	return s.store.SetProcessingTime(ctx, eventID, latency)
+}
+
+// Rollup rolls up the hours since the last run, including the current one
+// and the lookback before it. It runs as a scheduled job.
+func (s *Service) Rollup(ctx context.Context) error {
+	current := time.Now().Truncate(time.Hour)
+	last, _, ok, err := s.store.RolledUpTo(ctx)
+	if err != nil {
+		return err
+	}
+
+	var from time.Time
+	if ok {
+		from = last.Truncate(time.Hour).Add(-s.cfg.Lookback)
+	} else {
+		// First run: backfill from the oldest event
+		oldest, found, err := s.store.OldestEvent(ctx)
+		if err != nil {
+			return err
+		}
+		from = current
+		if found && oldest.Before(current) {
+			from = oldest.Truncate(time.Hour)
+		}
+	}
+
+	hours := 0
+	for hour := from; !hour.After(current) && hours < maxRollupHours; hour = hour.Add(time.Hour) {
+		if err := s.store.RollupHour(ctx, hour); err != nil {
+			return fmt.Errorf("failed to roll up %s: %w", hour.UTC().Format(time.RFC3339), err)
+		}
+		hours++
+	}
+	s.logger.Debugf("Rolled up %d hours of event stats from %s", hours, from.UTC().Format(time.RFC3339))
+	return nil
+}
+
+// Stats returns the event stats selected by q. Ranges are widened to whole
+// buckets; day buckets are UTC days.
+func (s *Service) Stats(ctx context.Context, q Query) (*Stats, error) {
+	if q.Bucket == "" {
+		q.Bucket = BucketHour
+	}
+	var size, maxRange time.Duration
+	switch q.Bucket {
+	case BucketHour:
+		size, maxRange = time.Hour, maxHourlyRange
+	case BucketDay:
+		size, maxRange = 24*time.Hour, maxDailyRange
+	default:
+		return nil, apperrors.Validation("bucket must be hour or day")
+	}
+	if q.TopUsers == 0 {
+		q.TopUsers = defaultTopUsers
+	}
+	if q.TopUsers < 1 || q.TopUsers > maxTopUsers {
+		return nil, apperrors.Validation(fmt.Sprintf("top_users must be between 1 and %d", maxTopUsers))
+	}
+	if q.To.IsZero() {
+		q.To = time.Now()
+	}
+	if q.From.IsZero() {
+		q.From = q.To.Add(-size * 24)
+	}
+	from, to := q.From.UTC().Truncate(size), q.To.UTC()
+	if !to.Equal(to.Truncate(size)) {
+		to = to.Truncate(size).Add(size)
+	}
+	if !from.Before(to) {
+		return nil, apperrors.Validation("from must be before to")
+	}
+	if to.Sub(from) > maxRange {
+		return nil, apperrors.Validation(fmt.Sprintf("the range of %s buckets is limited to %d days", q.Bucket, int(maxRange.Hours()/24)))
+	}
+
+	stats := &Stats{From: from, To: to, Bucket: q.Bucket}
+	hourly, err := s.store.TypeCounts(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	stats.ByType = regroup(hourly, size)
+	for _, c := range stats.ByType {
+		stats.Total += c.Events
+	}
+
+	histogram, err := s.store.LatencyHistogram(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	stats.Latency = summarize(histogram)
+
+	if stats.TopUsers, err = s.store.TopUsers(ctx, from, to, q.TopUsers); err != nil {
+		return nil, err
+	}
+
+	hour, at, ok, err := s.store.RolledUpTo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		stats.RolledUpTo, stats.RolledUpAt = &hour, &at
+	}
+	return stats, nil
+}
+
+// regroup sums hourly counts into buckets of size, keeping them ordered by
+// bucket and type
+func regroup(hourly []TypeCount, size time.Duration) []TypeCount {
+	if size == time.Hour {
+		return hourly
+	}
+	type key struct {
+		bucket time.Time
+		typ    string
+	}
+	sums := map[key]int64{}
+	for _, c := range hourly {
+		sums[key{c.Bucket.UTC().Truncate(size), c.Type}] += c.Events
+	}
+	counts := make([]TypeCount, 0, len(sums))
+	for k, n := range sums {
+		counts = append(counts, TypeCount{Bucket: k.bucket, Type: k.typ, Events: n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if !counts[i].Bucket.Equal(counts[j].Bucket) {
+			return counts[i].Bucket.Before(counts[j].Bucket)
+		}
+		return counts[i].Type < counts[j].Type
+	})
+	return counts
+}
+
+// summarize estimates latency percentiles from a histogram keyed by bucket
+// upper bound, interpolating linearly within the bucket. Events slower than
+// every bound are reported at the largest bound.
+func summarize(histogram map[int64]int64) Latency {
+	latency := Latency{Unprocessed: histogram[unprocessed], Percentiles: map[string]float64{}}
+	counts := make([]int64, len(LatencyBounds)+1) // the last one is the overflow
+	for i, bound := range LatencyBounds {
+		counts[i] = histogram[bound]
+	}
+	counts[len(LatencyBounds)] = histogram[overflow]
+	for _, n := range counts {
+		latency.Processed += n
+	}
+	if latency.Processed == 0 {
+		return latency
+	}
+
+	largest := float64(LatencyBounds[len(LatencyBounds)-1])
+	for _, p := range Percentiles {
+		rank := p / 100 * float64(latency.Processed)
+		value := largest
+		var seen int64
+		for i, n := range counts[:len(LatencyBounds)] {
+			if n > 0 && float64(seen+n) >= rank {
+				lower := 0.0
+				if i > 0 {
+					lower = float64(LatencyBounds[i-1])
+				}
+				value = lower + (float64(LatencyBounds[i])-lower)*(rank-float64(seen))/float64(n)
+				break
+			}
+			seen += n
+		}
+		latency.Percentiles[fmt.Sprintf("p%g", p)] = value
+	}
+	return latency
+}
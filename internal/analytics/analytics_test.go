@@ -0,0 +1,182 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"math"
+	"regexp"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// memoryStore serves canned rollups and records the hours rolled up
+type memoryStore struct {
+	oldest    time.Time
+	rolledUp  time.Time
+	hours     []time.Time
+	counts    []TypeCount
+	histogram map[int64]int64
+	users     []UserCount
+}
+
+func (m *memoryStore) SetProcessingTime(context.Context, uuid.UUID, time.Duration) error { return nil }
+
+func (m *memoryStore) OldestEvent(context.Context) (time.Time, bool, error) {
+	return m.oldest, !m.oldest.IsZero(), nil
+}
+
+func (m *memoryStore) RolledUpTo(context.Context) (time.Time, time.Time, bool, error) {
+	return m.rolledUp, m.rolledUp, !m.rolledUp.IsZero(), nil
+}
+
+func (m *memoryStore) RollupHour(_ context.Context, hour time.Time) error {
+	m.hours = append(m.hours, hour)
+	m.rolledUp = hour
+	return nil
+}
+
+func (m *memoryStore) TypeCounts(_ context.Context, from, to time.Time) ([]TypeCount, error) {
+	return m.counts, nil
+}
+
+func (m *memoryStore) LatencyHistogram(context.Context, time.Time, time.Time) (map[int64]int64, error) {
+	return m.histogram, nil
+}
+
+func (m *memoryStore) TopUsers(_ context.Context, _, _ time.Time, limit int) ([]UserCount, error) {
+	return m.users[:min(limit, len(m.users))], nil
+}
+
+func TestService_Rollup(t *testing.T) {
+	current := time.Now().Truncate(time.Hour)
+	store := &memoryStore{oldest: current.Add(-150 * time.Minute)}
+	s := NewService(store, Config{Lookback: time.Hour}, logrus.New())
+
+	// The first run backfills from the oldest event
+	if err := s.Rollup(context.Background()); err != nil {
+		t.Fatalf("rollup: %v", err)
+	}
+	if len(store.hours) != 4 || !store.hours[0].Equal(current.Add(-3*time.Hour)) || !store.hours[3].Equal(current) {
+		t.Fatalf("unexpected hours: %v", store.hours)
+	}
+
+	// Later runs redo the lookback before the last hour
+	store.hours = nil
+	if err := s.Rollup(context.Background()); err != nil {
+		t.Fatalf("rollup: %v", err)
+	}
+	if len(store.hours) != 2 || !store.hours[0].Equal(current.Add(-time.Hour)) {
+		t.Fatalf("unexpected hours: %v", store.hours)
+	}
+
+	// A long backfill is spread over runs
+	store.hours, store.rolledUp = nil, current.Add(-30*24*time.Hour)
+	if err := s.Rollup(context.Background()); err != nil {
+		t.Fatalf("rollup: %v", err)
+	}
+	if len(store.hours) != maxRollupHours {
+		t.Fatalf("want %d hours, got %d", maxRollupHours, len(store.hours))
+	}
+}
+
+func TestService_Stats(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	user := uuid.New()
+	store := &memoryStore{
+		counts: []TypeCount{
+			{Bucket: day.Add(time.Hour), Type: "user_created", Events: 2},
+			{Bucket: day.Add(2 * time.Hour), Type: "user_created", Events: 3},
+			{Bucket: day.Add(25 * time.Hour), Type: "order_paid", Events: 4},
+		},
+		histogram: map[int64]int64{unprocessed: 1, 10: 50, 100: 40, 1000: 9, overflow: 1},
+		users:     []UserCount{{UserID: user, Events: 9}},
+	}
+	s := NewService(store, Config{}, logrus.New())
+
+	stats, err := s.Stats(context.Background(), Query{From: day.Add(90 * time.Minute), To: day.Add(36 * time.Hour), Bucket: BucketDay})
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if !stats.From.Equal(day) || !stats.To.Equal(day.Add(48*time.Hour)) {
+		t.Fatalf("want the range widened to whole days, got %s - %s", stats.From, stats.To)
+	}
+	if stats.Total != 9 || len(stats.ByType) != 2 || stats.ByType[0].Events != 5 || !stats.ByType[1].Bucket.Equal(day.Add(24*time.Hour)) {
+		t.Fatalf("unexpected counts: %+v", stats.ByType)
+	}
+	if len(stats.TopUsers) != 1 || stats.TopUsers[0].UserID != user {
+		t.Fatalf("unexpected top users: %+v", stats.TopUsers)
+	}
+
+	latency := stats.Latency
+	if latency.Processed != 100 || latency.Unprocessed != 1 {
+		t.Fatalf("unexpected latency counts: %+v", latency)
+	}
+	// 50 events are within 10ms, the next 40 within 100ms
+	if p50 := latency.Percentiles["p50"]; math.Abs(p50-10) > 1e-9 {
+		t.Errorf("p50 = %v, want 10", p50)
+	}
+	if p90 := latency.Percentiles["p90"]; math.Abs(p90-100) > 1e-9 {
+		t.Errorf("p90 = %v, want 100", p90)
+	}
+	if p95 := latency.Percentiles["p95"]; p95 <= 100 || p95 >= 1000 {
+		t.Errorf("p95 = %v, want within (100, 1000)", p95)
+	}
+
+	for name, q := range map[string]Query{
+		"bucket":      {Bucket: "week"},
+		"top users":   {TopUsers: maxTopUsers + 1},
+		"empty range": {From: day, To: day},
+		"too long":    {From: day, To: day.Add(40 * 24 * time.Hour)},
+	} {
+		if _, err := s.Stats(context.Background(), q); !errors.Is(err, apperrors.ErrValidation) {
+			t.Errorf("%s: want validation error, got %v", name, err)
+		}
+	}
+}
+
+func TestSQLStore_RollupHour(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	hour := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	user := uuid.New()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT type, CASE WHEN processing_ms IS NULL THEN 0 WHEN processing_ms <= 5 THEN 5")).
+		WithArgs(hour, hour.Add(time.Hour)).
+		WillReturnRows(sqlmock.NewRows([]string{"type", "le", "count"}).
+			AddRow("user_created", 10, 3).
+			AddRow("user_created", 0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT user_id, COUNT(*)")).
+		WithArgs(hour, hour.Add(time.Hour)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "count"}).AddRow(user.String(), 4))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM event_stats_hourly WHERE bucket = $1")).WithArgs(hour).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM event_stats_user_hourly WHERE bucket = $1")).WithArgs(hour).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO event_stats_hourly (bucket, type, latency_le_ms, events) VALUES ($1, $2, $3, $4), ($5, $6, $7, $8)")).
+		WithArgs(hour, "user_created", 10, 3, hour, "user_created", 0, 1).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO event_stats_user_hourly (bucket, user_id, events) VALUES ($1, $2, $3)")).
+		WithArgs(hour, user, 4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// The first run has no progress row to update
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE event_stats_rollup SET rolled_up_to = $1")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO event_stats_rollup (name, rolled_up_to, updated_at)")).
+		WithArgs(rollupName, hour, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := NewSQLStore(db).RollupHour(context.Background(), hour); err != nil {
+		t.Fatalf("rollup: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
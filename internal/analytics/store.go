@@ -0,0 +1,264 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// rollupName identifies the hourly rollup in event_stats_rollup
+const rollupName = "event_stats_hourly"
+
+// insertChunk bounds the rows of one multi-row INSERT
+const insertChunk = 500
+
+// Store keeps processing times and the hourly rollups of the events table
+type Store interface {
+	// SetProcessingTime records how long an event took to be processed,
+	// unless it was processed before
+	SetProcessingTime(ctx context.Context, eventID uuid.UUID, latency time.Duration) error
+	// OldestEvent returns the creation time of the oldest event, if any
+	OldestEvent(ctx context.Context) (time.Time, bool, error)
+	// RolledUpTo returns the last hour the rollup covered and when it ran
+	RolledUpTo(ctx context.Context) (hour, at time.Time, ok bool, err error)
+	// RollupHour replaces the rollups of the hour starting at hour and
+	// records it as the progress of the rollup
+	RollupHour(ctx context.Context, hour time.Time) error
+
+	// TypeCounts returns the events per hour and type in [from, to)
+	TypeCounts(ctx context.Context, from, to time.Time) ([]TypeCount, error)
+	// LatencyHistogram returns the events per latency bucket in [from, to)
+	LatencyHistogram(ctx context.Context, from, to time.Time) (map[int64]int64, error)
+	// TopUsers returns the users with the most events in [from, to)
+	TopUsers(ctx context.Context, from, to time.Time, limit int) ([]UserCount, error)
+}
+
+// SQLStore rolls up the events table into event_stats_hourly and
+// event_stats_user_hourly
+type SQLStore struct {
+	db *sql.DB
+}
+
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+func (s *SQLStore) SetProcessingTime(ctx context.Context, eventID uuid.UUID, latency time.Duration) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE events SET processing_ms = $1 WHERE id = $2 AND processing_ms IS NULL`,
+		latency.Milliseconds(), eventID)
+	if err != nil {
+		return fmt.Errorf("failed to record processing time: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) OldestEvent(ctx context.Context) (time.Time, bool, error) {
+	var oldest sql.NullTime
+	if err := s.db.QueryRowContext(ctx, `SELECT MIN(created_at) FROM events`).Scan(&oldest); err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to find the oldest event: %w", err)
+	}
+	return oldest.Time, oldest.Valid, nil
+}
+
+func (s *SQLStore) RolledUpTo(ctx context.Context) (time.Time, time.Time, bool, error) {
+	var hour, at time.Time
+	err := s.db.QueryRowContext(ctx, `SELECT rolled_up_to, updated_at FROM event_stats_rollup WHERE name = $1`, rollupName).
+		Scan(&hour, &at)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, time.Time{}, false, fmt.Errorf("failed to read rollup progress: %w", err)
+	}
+	return hour, at, true, nil
+}
+
+// latencyCase maps processing_ms to its bucket in LatencyBounds. The bounds
+// are constants, so they are inlined rather than bound.
+func latencyCase() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CASE WHEN processing_ms IS NULL THEN %d", unprocessed)
+	for _, bound := range LatencyBounds {
+		fmt.Fprintf(&b, " WHEN processing_ms <= %d THEN %d", bound, bound)
+	}
+	fmt.Fprintf(&b, " ELSE %d END", overflow)
+	return b.String()
+}
+
+func (s *SQLStore) RollupHour(ctx context.Context, hour time.Time) error {
+	end := hour.Add(time.Hour)
+
+	// Aggregate outside the transaction; the scans are the expensive part
+	types, err := s.aggregate(ctx, `
+		SELECT type, `+latencyCase()+`, COUNT(*)
+		FROM events WHERE created_at >= $1 AND created_at < $2
+		GROUP BY 1, 2
+	`, hour, end, func(rows *sql.Rows) ([]interface{}, error) {
+		var eventType string
+		var le, n int64
+		err := rows.Scan(&eventType, &le, &n)
+		return []interface{}{hour, eventType, le, n}, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to aggregate events by type: %w", err)
+	}
+	users, err := s.aggregate(ctx, `
+		SELECT user_id, COUNT(*)
+		FROM events WHERE created_at >= $1 AND created_at < $2
+		GROUP BY user_id
+	`, hour, end, func(rows *sql.Rows) ([]interface{}, error) {
+		var userID uuid.UUID
+		var n int64
+		err := rows.Scan(&userID, &n)
+		return []interface{}{hour, userID, n}, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to aggregate events by user: %w", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, table := range []string{"event_stats_hourly", "event_stats_user_hourly"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE bucket = $1`, hour); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", table, err)
+		}
+	}
+	if err := insertRows(ctx, tx, "event_stats_hourly (bucket, type, latency_le_ms, events)", types); err != nil {
+		return err
+	}
+	if err := insertRows(ctx, tx, "event_stats_user_hourly (bucket, user_id, events)", users); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	res, err := tx.ExecContext(ctx, `UPDATE event_stats_rollup SET rolled_up_to = $1, updated_at = $2 WHERE name = $3`,
+		hour, now, rollupName)
+	if err != nil {
+		return fmt.Errorf("failed to record rollup progress: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO event_stats_rollup (name, rolled_up_to, updated_at) VALUES ($1, $2, $3)`,
+			rollupName, hour, now); err != nil {
+			return fmt.Errorf("failed to record rollup progress: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// aggregate runs an hourly aggregation and returns its rows as insert values
+func (s *SQLStore) aggregate(ctx context.Context, query string, from, to time.Time, scan func(*sql.Rows) ([]interface{}, error)) ([][]interface{}, error) {
+	rows, err := s.db.QueryContext(ctx, query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values [][]interface{}
+	for rows.Next() {
+		row, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, row)
+	}
+	return values, rows.Err()
+}
+
+// insertRows inserts values into target ("table (columns)") in chunks
+func insertRows(ctx context.Context, tx *sql.Tx, target string, values [][]interface{}) error {
+	for start := 0; start < len(values); start += insertChunk {
+		chunk := values[start:min(start+insertChunk, len(values))]
+		tuples := make([]string, len(chunk))
+		var args []interface{}
+		for i, row := range chunk {
+			placeholders := make([]string, len(row))
+			for j, value := range row {
+				args = append(args, value)
+				placeholders[j] = fmt.Sprintf("$%d", len(args))
+			}
+			tuples[i] = "(" + strings.Join(placeholders, ", ") + ")"
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO `+target+` VALUES `+strings.Join(tuples, ", "), args...); err != nil {
+			return fmt.Errorf("failed to insert rollups: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) TypeCounts(ctx context.Context, from, to time.Time) ([]TypeCount, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT bucket, type, SUM(events)
+		FROM event_stats_hourly WHERE bucket >= $1 AND bucket < $2
+		GROUP BY bucket, type
+		ORDER BY bucket, type
+	`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count events by type: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []TypeCount{}
+	for rows.Next() {
+		var c TypeCount
+		if err := rows.Scan(&c.Bucket, &c.Type, &c.Events); err != nil {
+			return nil, fmt.Errorf("failed to scan event count: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+func (s *SQLStore) LatencyHistogram(ctx context.Context, from, to time.Time) (map[int64]int64, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT latency_le_ms, SUM(events)
+		FROM event_stats_hourly WHERE bucket >= $1 AND bucket < $2
+		GROUP BY latency_le_ms
+	`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read latency histogram: %w", err)
+	}
+	defer rows.Close()
+
+	histogram := map[int64]int64{}
+	for rows.Next() {
+		var le, n int64
+		if err := rows.Scan(&le, &n); err != nil {
+			return nil, fmt.Errorf("failed to scan latency bucket: %w", err)
+		}
+		histogram[le] = n
+	}
+	return histogram, rows.Err()
+}
+
+func (s *SQLStore) TopUsers(ctx context.Context, from, to time.Time, limit int) ([]UserCount, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT user_id, SUM(events) AS total
+		FROM event_stats_user_hourly WHERE bucket >= $1 AND bucket < $2
+		GROUP BY user_id
+		ORDER BY total DESC, user_id
+		LIMIT $3
+	`, from, to, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find top users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []UserCount{}
+	for rows.Next() {
+		var u UserCount
+		if err := rows.Scan(&u.UserID, &u.Events); err != nil {
+			return nil, fmt.Errorf("failed to scan user count: %w", err)
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
@@ -0,0 +1,171 @@
+// Package apiversion mounts the public API under several versions
+// (/api/v1, /api/v2, ...) that share handlers. Versions differ only in the
+// shape of their JSON responses, rewritten by a per-version Transform, in
+// extra request checks and in the deprecation headers of retired versions.
+package apiversion
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContextKey holds the version name of the request in the gin context
+const ContextKey = "api_version"
+
+// Transform rewrites the JSON body a handler wrote with status. It returns
+// body unchanged when the response needs no rewrite.
+type Transform func(c *gin.Context, status int, body []byte) []byte
+
+// Version describes one mounted API version
+type Version struct {
+	Name string // path segment, e.g. v2
+	// Deprecation and Sunset are announced on every response once set
+	// (RFC 9745 and RFC 8594); Link points to the successor version
+	Deprecation time.Time
+	Sunset      time.Time
+	Link        string
+	// Transforms rewrite JSON responses in order; none keeps the shapes the
+	// handlers write
+	Transforms []Transform
+	// Handlers run before the routes of this version only
+	Handlers []gin.HandlerFunc
+}
+
+// Deprecated reports whether the version announces its retirement
+func (v Version) Deprecated() bool {
+	return !v.Deprecation.IsZero() || !v.Sunset.IsZero()
+}
+
+// Builder mounts the same routes under every version
+type Builder struct {
+	router   gin.IRouter
+	prefix   string
+	versions []Version
+}
+
+// NewBuilder creates a builder mounting versions under prefix, e.g. /api
+func NewBuilder(router gin.IRouter, prefix string, versions ...Version) *Builder {
+	return &Builder{router: router, prefix: strings.TrimSuffix(prefix, "/"), versions: versions}
+}
+
+// Register mounts routes under every version. routes is called once per
+// version with the version's group, so middleware it adds is per version
+// too; state shared across versions (limiters, pools) must be created
+// outside of it.
+func (b *Builder) Register(routes func(api *gin.RouterGroup)) {
+	for _, version := range b.versions {
+		group := b.router.Group(b.prefix+"/"+version.Name, version.middleware())
+		group.Use(version.Handlers...)
+		routes(group)
+	}
+}
+
+// middleware tags the request with the version, sets the deprecation
+// headers and applies the transforms to the response
+func (v Version) middleware() gin.HandlerFunc {
+	var deprecation, sunset string
+	if !v.Deprecation.IsZero() {
+		deprecation = "@" + strconv.FormatInt(v.Deprecation.Unix(), 10)
+	}
+	if !v.Sunset.IsZero() {
+		sunset = v.Sunset.UTC().Format(http.TimeFormat)
+	}
+
+	return func(c *gin.Context) {
+		c.Set(ContextKey, v.Name)
+		if deprecation != "" {
+			c.Header("Deprecation", deprecation)
+		}
+		if sunset != "" {
+			c.Header("Sunset", sunset)
+		}
+		if v.Link != "" && v.Deprecated() {
+			c.Header("Link", "<"+v.Link+`>; rel="successor-version"`)
+		}
+
+		// WebSocket upgrades hijack the connection, there is nothing to rewrite
+		if len(v.Transforms) == 0 || c.GetHeader("Upgrade") != "" {
+			c.Next()
+			return
+		}
+
+		w := &bufferWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+		w.flush(c, v.Transforms)
+	}
+}
+
+// bufferWriter holds the response back until the handler returns, so the
+// transforms see the whole body
+type bufferWriter struct {
+	gin.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *bufferWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+	}
+}
+
+func (w *bufferWriter) WriteHeaderNow() {
+	w.wroteHeader = true
+}
+
+func (w *bufferWriter) Write(data []byte) (int, error) {
+	w.wroteHeader = true
+	return w.body.Write(data)
+}
+
+func (w *bufferWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *bufferWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferWriter) Size() int {
+	if !w.wroteHeader {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *bufferWriter) Written() bool {
+	return w.wroteHeader
+}
+
+// Flush is a no-op: buffered responses are written once the handler returns
+func (w *bufferWriter) Flush() {}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *bufferWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// flush writes the transformed response to the underlying writer
+func (w *bufferWriter) flush(c *gin.Context, transforms []Transform) {
+	body := w.body.Bytes()
+	if len(body) > 0 && strings.Contains(w.Header().Get("Content-Type"), "application/json") {
+		for _, transform := range transforms {
+			body = transform(c, w.status, body)
+		}
+		w.Header().Del("Content-Length")
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(body) > 0 {
+		_, _ = w.ResponseWriter.Write(body)
+	} else if w.wroteHeader {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
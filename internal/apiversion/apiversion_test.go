@@ -0,0 +1,112 @@
+package apiversion
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func versionedRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("request_id", "req-1")
+		c.Next()
+	})
+	NewBuilder(r, "/api",
+		Version{
+			Name:        "v1",
+			Deprecation: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			Sunset:      time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC),
+			Link:        "/api/v2",
+		},
+		Version{
+			Name:       "v2",
+			Transforms: []Transform{ErrorEnvelope(), CursorPagination("users")},
+			Handlers:   []gin.HandlerFunc{CursorOnly()},
+		},
+	).Register(func(api *gin.RouterGroup) {
+		api.GET("/users", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"users": []string{"a", "b"}, "total": 5, "limit": 2, "next_cursor": "abc"})
+		})
+		api.GET("/users/:id", func(c *gin.Context) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found", "retry_after": 3})
+		})
+		api.GET("/version", func(c *gin.Context) {
+			c.String(http.StatusOK, c.GetString(ContextKey))
+		})
+		api.DELETE("/users/:id", func(c *gin.Context) {
+			c.Status(http.StatusNoContent)
+		})
+	})
+	return r
+}
+
+func TestBuilder_Transforms(t *testing.T) {
+	r := versionedRouter()
+
+	tests := []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{http.MethodGet, "/api/v1/users", http.StatusOK, `{"limit":2,"next_cursor":"abc","total":5,"users":["a","b"]}`},
+		{http.MethodGet, "/api/v1/users/1", http.StatusNotFound, `{"error":"User not found","retry_after":3}`},
+		{http.MethodGet, "/api/v2/users", http.StatusOK, `{"data":["a","b"],"pagination":{"limit":2,"next_cursor":"abc","has_more":true,"total":5}}`},
+		{http.MethodGet, "/api/v2/users/1", http.StatusNotFound, `{"error":{"code":"not_found","message":"User not found","details":{"retry_after":3},"request_id":"req-1"}}`},
+		{http.MethodGet, "/api/v2/users?page=2", http.StatusBadRequest, `{"error":{"code":"bad_request","message":"Offset pagination is not supported, use cursor","request_id":"req-1"}}`},
+		{http.MethodGet, "/api/v2/users?sort=email", http.StatusBadRequest, `{"error":{"code":"bad_request","message":"Only created_at sort supports cursor pagination","request_id":"req-1"}}`},
+		{http.MethodGet, "/api/v2/version", http.StatusOK, `v2`},
+		{http.MethodDelete, "/api/v2/users/1", http.StatusNoContent, ``},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(tt.method, tt.path, nil)
+		r.ServeHTTP(w, req)
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("%s %s: got %d %s, want %d %s", tt.method, tt.path, w.Code, w.Body.String(), tt.code, tt.body)
+		}
+	}
+}
+
+func TestBuilder_DeprecationHeaders(t *testing.T) {
+	r := versionedRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/version", nil)
+	r.ServeHTTP(w, req)
+	if got := w.Header().Get("Deprecation"); got != "@1767225600" {
+		t.Errorf("expected Deprecation @1767225600, got %q", got)
+	}
+	if got := w.Header().Get("Sunset"); got != "Wed, 01 Jul 2026 00:00:00 GMT" {
+		t.Errorf("unexpected Sunset %q", got)
+	}
+	if got := w.Header().Get("Link"); got != `</api/v2>; rel="successor-version"` {
+		t.Errorf("unexpected Link %q", got)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/api/v2/version", nil)
+	r.ServeHTTP(w, req)
+	for _, header := range []string{"Deprecation", "Sunset", "Link"} {
+		if got := w.Header().Get(header); got != "" {
+			t.Errorf("expected no %s on v2, got %q", header, got)
+		}
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	for status, want := range map[int]string{
+		http.StatusTooManyRequests:     "too_many_requests",
+		http.StatusInternalServerError: "internal_server_error",
+		http.StatusMultiStatus:         "multi_status",
+		599:                            "error",
+	} {
+		if got := errorCode(status); got != want {
+			t.Errorf("errorCode(%d) = %q, want %q", status, got, want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package apiversion
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrorBody is the error envelope of ErrorEnvelope
+type ErrorBody struct {
+	Code      string                 `json:"code"` // snake_case status text, e.g. not_found
+	Message   string                 `json:"message"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+}
+
+// ErrorEnvelope rewrites the {"error": "Message", ...} bodies of failed
+// requests into {"error": {"code", "message", "details", "request_id"}}.
+// Fields next to "error" (retry_after, field errors) move into details.
+func ErrorEnvelope() Transform {
+	return func(c *gin.Context, status int, body []byte) []byte {
+		if status < http.StatusBadRequest {
+			return body
+		}
+		fields, ok := jsonObject(body)
+		if !ok {
+			return body
+		}
+		message, ok := fields["error"].(string)
+		if !ok {
+			return body
+		}
+
+		envelope := ErrorBody{
+			Code:      errorCode(status),
+			Message:   message,
+			RequestID: c.GetString("request_id"),
+		}
+		for key, value := range fields {
+			if key == "error" || key == "request_id" {
+				continue
+			}
+			if envelope.Details == nil {
+				envelope.Details = make(map[string]interface{})
+			}
+			envelope.Details[key] = value
+		}
+		return marshalOr(map[string]ErrorBody{"error": envelope}, body)
+	}
+}
+
+// Pagination is the paging part of the responses of CursorPagination
+type Pagination struct {
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+	Total      int    `json:"total"`
+}
+
+// CursorPagination rewrites list responses, {"<key>": [...], "total",
+// "limit", "next_cursor", "page"}, into {"data": [...], "pagination":
+// {"limit", "next_cursor", "has_more", "total"}} for the given list keys
+// (users, events)
+func CursorPagination(keys ...string) Transform {
+	return func(c *gin.Context, status int, body []byte) []byte {
+		if status != http.StatusOK {
+			return body
+		}
+		var fields map[string]json.RawMessage
+		if !bytes.HasPrefix(bytes.TrimSpace(body), []byte("{")) || json.Unmarshal(body, &fields) != nil {
+			return body
+		}
+
+		for _, key := range keys {
+			items, ok := fields[key]
+			if !ok || !bytes.HasPrefix(bytes.TrimSpace(items), []byte("[")) {
+				continue
+			}
+			var page Pagination
+			if err := json.Unmarshal(body, &page); err != nil {
+				return body
+			}
+			page.HasMore = page.NextCursor != ""
+
+			return marshalOr(struct {
+				Data       json.RawMessage `json:"data"`
+				Pagination Pagination      `json:"pagination"`
+			}{items, page}, body)
+		}
+		return body
+	}
+}
+
+// CursorOnly rejects offset paging (page) and sorts that can't be paged by
+// cursor; cursors follow the created_at order
+func CursorOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Query("page") != "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Offset pagination is not supported, use cursor"})
+			return
+		}
+		if sort := c.Query("sort"); sort != "" && sort != "created_at" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Only created_at sort supports cursor pagination"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// errorCode turns the status text into a machine-readable code, e.g.
+// "Too Many Requests" into too_many_requests
+func errorCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ReplaceAll(strings.ToLower(strings.ReplaceAll(text, "-", " ")), " ", "_")
+}
+
+func jsonObject(body []byte) (map[string]interface{}, bool) {
+	if !bytes.HasPrefix(bytes.TrimSpace(body), []byte("{")) {
+		return nil, false
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, false
+	}
+	return fields, true
+}
+
+// marshalOr returns the JSON of v, or fallback if it can't be encoded
+func marshalOr(v interface{}, fallback []byte) []byte {
+	rewritten, err := json.Marshal(v)
+	if err != nil {
+		return fallback
+	}
+	return rewritten
+}
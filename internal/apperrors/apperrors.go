@@ -0,0 +1,186 @@
+// Package apperrors defines the domain error kinds shared by services and
+// handlers. Services return errors that wrap one of the sentinel kinds;
+// handlers map them to HTTP statuses with errors.Is instead of comparing strings.
+package apperrors
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"highload-microservice/internal/resilience"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// Error kinds
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrValidation   = errors.New("validation failed")
+	ErrUnavailable  = errors.New("unavailable")
+	// ErrUnprocessable marks well-formed requests that refer to resources
+	// that do not exist
+	ErrUnprocessable = errors.New("unprocessable")
+)
+
+// Error is a domain error of a given kind. Message is safe to show to clients;
+// Err, if set, is the underlying cause and only ends up in logs.
+type Error struct {
+	Kind    error
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap exposes both the kind and the cause to errors.Is/As
+func (e *Error) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
+
+// New returns an error of the given kind
+func New(kind error, message string) error {
+	return &Error{Kind: kind, Message: message}
+}
+
+// Wrap returns an error of the given kind caused by err
+func Wrap(kind error, message string, err error) error {
+	return &Error{Kind: kind, Message: message, Err: err}
+}
+
+// NotFound returns an ErrNotFound error
+func NotFound(message string) error { return New(ErrNotFound, message) }
+
+// Conflict returns an ErrConflict error
+func Conflict(message string) error { return New(ErrConflict, message) }
+
+// Unauthorized returns an ErrUnauthorized error
+func Unauthorized(message string) error { return New(ErrUnauthorized, message) }
+
+// Validation returns an ErrValidation error
+func Validation(message string) error { return New(ErrValidation, message) }
+
+// Unprocessable returns an ErrUnprocessable error
+func Unprocessable(message string) error { return New(ErrUnprocessable, message) }
+
+// SQLSTATE classes mapped to domain errors (same codes in PostgreSQL and,
+// via MySQL error numbers below, MySQL)
+const (
+	codeUniqueViolation     = "23505"
+	codeForeignKeyViolation = "23503"
+	codeNotNullViolation    = "23502"
+	codeCheckViolation      = "23514"
+	codeInvalidText         = "22P02"
+	codeStringTooLong       = "22001"
+	codeQueryCanceled       = "57014"
+)
+
+var mysqlCodes = map[uint16]string{
+	1062: codeUniqueViolation,
+	1452: codeForeignKeyViolation,
+	1048: codeNotNullViolation,
+	3819: codeCheckViolation,
+	1406: codeStringTooLong,
+	3024: codeQueryCanceled, // max_execution_time exceeded
+}
+
+// Drivers that don't expose a typed error usually include the code in the text
+var sqlstateRe = regexp.MustCompile(`SQLSTATE ([0-9A-Z]{5})`)
+
+// sqlState extracts the SQLSTATE code from a database error, or ""
+func sqlState(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code)
+	}
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return mysqlCodes[myErr.Number]
+	}
+	if m := sqlstateRe.FindStringSubmatch(err.Error()); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// IsUniqueViolation reports whether err is a unique constraint violation
+func IsUniqueViolation(err error) bool {
+	return err != nil && sqlState(err) == codeUniqueViolation
+}
+
+// FromDB classifies a database error. Missing rows, constraint violations and
+// malformed values become domain errors, and statement timeouts and an open
+// circuit breaker become ErrUnavailable; anything else is wrapped as "op: err" and treated as an
+// internal error.
+func FromDB(err error, op string) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return Wrap(ErrNotFound, "not found", err)
+	}
+
+	cause := fmt.Errorf("%s: %w", op, err)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return Wrap(ErrUnavailable, "database timed out", cause)
+	}
+	if errors.Is(err, resilience.ErrOpen) {
+		return Wrap(ErrUnavailable, "database unavailable", cause)
+	}
+	switch sqlState(err) {
+	case codeUniqueViolation:
+		return Wrap(ErrConflict, "already exists", cause)
+	case codeForeignKeyViolation:
+		return Wrap(ErrUnprocessable, "referenced resource does not exist", cause)
+	case codeNotNullViolation, codeCheckViolation, codeInvalidText, codeStringTooLong:
+		return Wrap(ErrValidation, "invalid value", cause)
+	case codeQueryCanceled:
+		return Wrap(ErrUnavailable, "database timed out", cause)
+	}
+	return cause
+}
+
+// Message returns the client-safe message of a domain error, or ""
+func Message(err error) string {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Message
+	}
+	return ""
+}
+
+// HTTPStatus maps an error to an HTTP status code
+func HTTPStatus(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrUnprocessable):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
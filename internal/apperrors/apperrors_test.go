@@ -0,0 +1,67 @@
+package apperrors
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"highload-microservice/internal/resilience"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+func TestFromDB(t *testing.T) {
+	cases := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"no rows", sql.ErrNoRows, http.StatusNotFound},
+		{"pq unique", &pq.Error{Code: "23505"}, http.StatusConflict},
+		{"pq foreign key", &pq.Error{Code: "23503"}, http.StatusUnprocessableEntity},
+		{"mysql foreign key", &mysql.MySQLError{Number: 1452}, http.StatusUnprocessableEntity},
+		{"pq invalid text", &pq.Error{Code: "22P02"}, http.StatusBadRequest},
+		{"mysql duplicate", &mysql.MySQLError{Number: 1062}, http.StatusConflict},
+		{"sqlstate in text", fmt.Errorf("duplicate key (SQLSTATE 23505)"), http.StatusConflict},
+		{"pq statement timeout", &pq.Error{Code: "57014"}, http.StatusServiceUnavailable},
+		{"mysql execution time", &mysql.MySQLError{Number: 3024}, http.StatusServiceUnavailable},
+		{"query deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), http.StatusServiceUnavailable},
+		{"breaker open", fmt.Errorf("query: %w", resilience.ErrOpen), http.StatusServiceUnavailable},
+		{"other", errors.New("connection refused"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		err := FromDB(tc.err, "failed to do thing")
+		if got := HTTPStatus(err); got != tc.status {
+			t.Errorf("%s: status %d, want %d (%v)", tc.name, got, tc.status, err)
+		}
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: cause not preserved", tc.name)
+		}
+	}
+
+	if FromDB(nil, "op") != nil {
+		t.Fatalf("nil error should stay nil")
+	}
+}
+
+func TestError_WrapAndMessage(t *testing.T) {
+	cause := errors.New("pq: duplicate key")
+	err := fmt.Errorf("create: %w", Wrap(ErrConflict, "user already exists", cause))
+
+	if !errors.Is(err, ErrConflict) || !errors.Is(err, cause) {
+		t.Fatalf("expected kind and cause to be matched")
+	}
+	if Message(err) != "user already exists" {
+		t.Fatalf("unexpected message %q", Message(err))
+	}
+	if NotFound("user not found").Error() != "user not found" {
+		t.Fatalf("unexpected error text")
+	}
+	if Message(errors.New("boom")) != "" || HTTPStatus(errors.New("boom")) != http.StatusInternalServerError {
+		t.Fatalf("plain errors must be internal")
+	}
+}
@@ -0,0 +1,199 @@
+// Package auditarchive exports security events, security alerts and the
+// user audit trail to object storage for long-term compliance retention.
+// Each run continues every source from its newest archive: records are read
+// in time order and written as gzip-compressed NDJSON objects of up to
+// BatchSize records, each recorded in the audit_archives manifest once it is
+// stored. Rows are only copied; the tables keep them.
+package auditarchive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/objectstore"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultBatchSize     = 50000
+	defaultArchivesLimit = 20
+	maxArchivesLimit     = 100
+)
+
+// Config sets the size of archives and how recent exported records may be
+type Config struct {
+	BatchSize int // records per archive
+	// Lag keeps the newest records for the next run, so rows written late
+	// by asynchronous writers (the security event batcher) are not skipped
+	Lag time.Duration
+}
+
+// Exporter archives the sources to an object store
+type Exporter struct {
+	store   Store
+	objects objectstore.Store
+	cfg     Config
+	logger  *logrus.Logger
+}
+
+func NewExporter(store Store, objects objectstore.Store, cfg Config, logger *logrus.Logger) *Exporter {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	return &Exporter{store: store, objects: objects, cfg: cfg, logger: logger}
+}
+
+// Run exports the records of every source up to now minus the lag; it is
+// the scheduler job. A failing source doesn't stop the others.
+func (e *Exporter) Run(ctx context.Context) error {
+	before := time.Now().Add(-e.cfg.Lag)
+	var errs []error
+	for _, source := range Sources {
+		archived, err := e.export(ctx, source, before)
+		if archived > 0 {
+			e.logger.Infof("Archived %d %s records", archived, source.Name)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", source.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// export archives the records of source created before before and returns
+// how many were archived
+func (e *Exporter) export(ctx context.Context, source Source, before time.Time) (int, error) {
+	last, err := e.store.LastArchive(ctx, source.Name)
+	if err != nil {
+		return 0, err
+	}
+	var cursor *Cursor
+	if last != nil {
+		cursor = &Cursor{At: last.LastAt, ID: last.LastID}
+	}
+
+	archived := 0
+	for {
+		records, err := e.store.Records(ctx, source, cursor, before, e.cfg.BatchSize)
+		if err != nil {
+			return archived, err
+		}
+		if len(records) == 0 {
+			return archived, nil
+		}
+
+		archive, err := e.write(ctx, source, records)
+		if err != nil {
+			return archived, err
+		}
+		archived += len(records)
+		cursor = &Cursor{At: archive.LastAt, ID: archive.LastID}
+
+		if len(records) < e.cfg.BatchSize {
+			return archived, nil
+		}
+	}
+}
+
+// write stores records as one object and records it in the manifest. When
+// the manifest entry can't be saved the object is left behind, and the next
+// run archives the same records again under a new key.
+func (e *Exporter) write(ctx context.Context, source Source, records []Record) (*Archive, error) {
+	data, err := encodeRecords(records)
+	if err != nil {
+		return nil, err
+	}
+	first, last := records[0], records[len(records)-1]
+	sum := sha256.Sum256(data)
+
+	archive := &Archive{
+		ID:      uuid.New(),
+		Source:  source.Name,
+		Records: len(records),
+		Bytes:   int64(len(data)),
+		SHA256:  hex.EncodeToString(sum[:]),
+		FirstAt: first.At.UTC(),
+		LastAt:  last.At.UTC(),
+		LastID:  last.ID,
+	}
+	archive.Key = fmt.Sprintf("audit/%s/%s/%s-%s.ndjson.gz", source.Name, archive.FirstAt.Format("2006/01/02"),
+		archive.FirstAt.Format("150405"), archive.ID)
+	archive.Location = e.objects.Location(archive.Key)
+
+	if err := e.objects.Put(ctx, archive.Key, data); err != nil {
+		return nil, err
+	}
+	archive.CreatedAt = time.Now().UTC()
+	if err := e.store.SaveArchive(ctx, archive); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+// encodeRecords returns records as gzip-compressed NDJSON, one object of
+// column values per line
+func encodeRecords(records []Record) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+	for _, record := range records {
+		if err := enc.Encode(record.Fields); err != nil {
+			return nil, fmt.Errorf("failed to encode record %s: %w", record.ID, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress archive: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Status reports the archives of every source and the latest archives
+type Status struct {
+	Sources  []Summary `json:"sources"`
+	Archives []Archive `json:"archives"`
+}
+
+// Status summarizes the manifest. With source set, the latest archives are
+// those of that source.
+func (e *Exporter) Status(ctx context.Context, source string, limit int) (*Status, error) {
+	if source != "" {
+		if _, ok := SourceNamed(source); !ok {
+			return nil, apperrors.Validation("unknown archive source: " + source)
+		}
+	}
+	if limit <= 0 {
+		limit = defaultArchivesLimit
+	}
+
+	summaries, err := e.store.Summaries(ctx)
+	if err != nil {
+		return nil, apperrors.FromDB(err, "failed to summarize archives")
+	}
+	archives, err := e.store.ListArchives(ctx, source, min(limit, maxArchivesLimit))
+	if err != nil {
+		return nil, apperrors.FromDB(err, "failed to list archives")
+	}
+
+	// Every source is reported, including those not archived yet
+	status := &Status{Archives: archives}
+	for _, s := range Sources {
+		summary := Summary{Source: s.Name}
+		for _, found := range summaries {
+			if found.Source == s.Name {
+				summary = found
+			}
+		}
+		status.Sources = append(status.Sources, summary)
+	}
+	return status, nil
+}
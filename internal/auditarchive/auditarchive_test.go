@@ -0,0 +1,259 @@
+package auditarchive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/database"
+	"highload-microservice/internal/objectstore"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sirupsen/logrus"
+)
+
+// memoryStore serves records per source and keeps the manifest in memory
+type memoryStore struct {
+	records  map[string][]Record
+	archives []Archive
+	saveErr  error
+}
+
+func (m *memoryStore) Records(_ context.Context, source Source, after *Cursor, before time.Time, limit int) ([]Record, error) {
+	var out []Record
+	for _, record := range m.records[source.Name] {
+		if !record.At.Before(before) {
+			continue
+		}
+		if after != nil && (record.At.Before(after.At) || record.At.Equal(after.At) && record.ID <= after.ID) {
+			continue
+		}
+		out = append(out, record)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].At.Equal(out[j].At) {
+			return out[i].ID < out[j].ID
+		}
+		return out[i].At.Before(out[j].At)
+	})
+	return out[:min(limit, len(out))], nil
+}
+
+func (m *memoryStore) SaveArchive(_ context.Context, archive *Archive) error {
+	if m.saveErr != nil {
+		return m.saveErr
+	}
+	m.archives = append(m.archives, *archive)
+	return nil
+}
+
+func (m *memoryStore) LastArchive(_ context.Context, source string) (*Archive, error) {
+	var last *Archive
+	for i, archive := range m.archives {
+		if archive.Source == source {
+			last = &m.archives[i]
+		}
+	}
+	return last, nil
+}
+
+func (m *memoryStore) ListArchives(_ context.Context, source string, limit int) ([]Archive, error) {
+	archives := []Archive{}
+	for _, archive := range m.archives {
+		if source == "" || archive.Source == source {
+			archives = append(archives, archive)
+		}
+	}
+	return archives[:min(limit, len(archives))], nil
+}
+
+func (m *memoryStore) Summaries(context.Context) ([]Summary, error) {
+	bySource := map[string]*Summary{}
+	var summaries []Summary
+	for _, archive := range m.archives {
+		summary, ok := bySource[archive.Source]
+		if !ok {
+			summaries = append(summaries, Summary{Source: archive.Source})
+			summary = &summaries[len(summaries)-1]
+			bySource[archive.Source] = summary
+		}
+		summary.Archives++
+		summary.Records += int64(archive.Records)
+	}
+	return summaries, nil
+}
+
+func records(start time.Time, n int) []Record {
+	out := make([]Record, n)
+	for i := range out {
+		at := start.Add(time.Duration(i) * time.Minute)
+		id := fmt.Sprintf("%08d-0000-0000-0000-000000000000", i)
+		out[i] = Record{ID: id, At: at, Fields: map[string]interface{}{"id": id, "created_at": at, "action": "update"}}
+	}
+	return out
+}
+
+func readLines(t *testing.T, path string) []map[string]interface{} {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(zr)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("decode line: %v", err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestExporter_RunContinuesFromManifest(t *testing.T) {
+	start := time.Now().Add(-2 * time.Hour).UTC()
+	store := &memoryStore{records: map[string][]Record{"user_audit": records(start, 5)}}
+	dir := t.TempDir()
+	objects, _ := objectstore.NewFileStore(dir)
+	e := NewExporter(store, objects, Config{BatchSize: 2, Lag: 10 * time.Minute}, logrus.New())
+
+	if err := e.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(store.archives) != 3 {
+		t.Fatalf("archives = %d, want 3 (2+2+1 records)", len(store.archives))
+	}
+	first := store.archives[0]
+	if first.Records != 2 || first.LastID != store.records["user_audit"][1].ID || first.SHA256 == "" || first.Bytes == 0 {
+		t.Errorf("first archive = %+v", first)
+	}
+	lines := readLines(t, filepath.Join(dir, filepath.FromSlash(first.Key)))
+	if len(lines) != 2 || lines[0]["action"] != "update" {
+		t.Errorf("first archive holds %v", lines)
+	}
+
+	// Nothing new: no archive; new records continue after the last one
+	if err := e.Run(context.Background()); err != nil || len(store.archives) != 3 {
+		t.Fatalf("second run: %v, %d archives", err, len(store.archives))
+	}
+	late := records(start.Add(time.Hour), 1)
+	late[0].ID = "99999999-0000-0000-0000-000000000000"
+	store.records["user_audit"] = append(store.records["user_audit"], late[0])
+	if err := e.Run(context.Background()); err != nil {
+		t.Fatalf("third run: %v", err)
+	}
+	if len(store.archives) != 4 || store.archives[3].Records != 1 || store.archives[3].LastID != late[0].ID {
+		t.Errorf("archives after new records = %+v", store.archives)
+	}
+}
+
+func TestExporter_LagKeepsRecentRecords(t *testing.T) {
+	store := &memoryStore{records: map[string][]Record{"security_events": records(time.Now().Add(-time.Minute), 3)}}
+	objects, _ := objectstore.NewFileStore(t.TempDir())
+	e := NewExporter(store, objects, Config{Lag: 10 * time.Minute}, logrus.New())
+
+	if err := e.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(store.archives) != 0 {
+		t.Errorf("archives = %d, want records within the lag kept for later", len(store.archives))
+	}
+}
+
+func TestExporter_ManifestFailureIsReported(t *testing.T) {
+	store := &memoryStore{
+		records: map[string][]Record{"user_audit": records(time.Now().Add(-time.Hour), 1)},
+		saveErr: errors.New("connection reset"),
+	}
+	objects, _ := objectstore.NewFileStore(t.TempDir())
+	e := NewExporter(store, objects, Config{}, logrus.New())
+
+	if err := e.Run(context.Background()); err == nil {
+		t.Fatal("expected the manifest error")
+	}
+}
+
+func TestExporter_Status(t *testing.T) {
+	store := &memoryStore{archives: []Archive{{Source: "user_audit", Records: 10}, {Source: "user_audit", Records: 5}}}
+	e := NewExporter(store, nil, Config{}, logrus.New())
+
+	status, err := e.Status(context.Background(), "user_audit", 1)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if len(status.Sources) != len(Sources) {
+		t.Errorf("sources = %d, want every source", len(status.Sources))
+	}
+	for _, summary := range status.Sources {
+		if summary.Source == "user_audit" && (summary.Archives != 2 || summary.Records != 15) {
+			t.Errorf("user_audit summary = %+v", summary)
+		}
+	}
+	if len(status.Archives) != 1 {
+		t.Errorf("archives = %d, want the limit", len(status.Archives))
+	}
+	if _, err := e.Status(context.Background(), "users", 10); !errors.Is(err, apperrors.ErrValidation) {
+		t.Errorf("unknown source: err = %v, want ErrValidation", err)
+	}
+}
+
+func TestSQLStore_Records(t *testing.T) {
+	var query string
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherFunc(func(expected, actual string) error {
+		query = actual
+		return sqlmock.QueryMatcherRegexp.Match(expected, actual)
+	})))
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	source, _ := SourceNamed("user_audit")
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	before := at.Add(time.Hour)
+	cursor := &Cursor{At: at.Add(-time.Minute), ID: "a"}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, created_at, user_id, action, actor_id, request_id, changes FROM user_audit `+
+		`WHERE created_at < $1 AND (created_at > $2 OR (created_at = $3 AND id > $4)) ORDER BY created_at, id LIMIT $5`)).
+		WithArgs(before, cursor.At, cursor.At, cursor.ID, 100).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "user_id", "action", "actor_id", "request_id", "changes"}).
+			AddRow("b", at, []byte("u1"), "update", nil, "req", []byte(`{"name":{"old":"a","new":"b"}}`)))
+
+	got, err := NewSQLStore(db).Records(context.Background(), source, cursor, before, 100)
+	if err != nil {
+		t.Fatalf("Records: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != "b" || !got[0].At.Equal(at) {
+		t.Fatalf("records = %+v", got)
+	}
+	// MySQL binds by position, one argument per placeholder
+	mysql, _ := database.NewDialect(database.DriverMySQL)
+	if n := strings.Count(mysql.Rebind(query), "?"); n != 5 {
+		t.Errorf("%d placeholders after MySQL rebind, 5 args", n)
+	}
+	line, _ := json.Marshal(got[0].Fields)
+	want := `{"action":"update","actor_id":null,"changes":{"name":{"old":"a","new":"b"}},"created_at":"2024-03-01T12:00:00Z","id":"b","request_id":"req","user_id":"u1"}`
+	if string(line) != want {
+		t.Errorf("archived line = %s\nwant %s", line, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,271 @@
+package auditarchive
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Source is a table whose rows are archived in the order of TimeColumn
+type Source struct {
+	Name        string // the table
+	TimeColumn  string
+	Columns     []string        // archived besides id and TimeColumn
+	JSONColumns map[string]bool // archived as JSON rather than as strings
+}
+
+// Sources are the tables the exporter archives
+var Sources = []Source{
+	{
+		Name:       "security_events",
+		TimeColumn: "occurred_at",
+		Columns: []string{"event_type", "severity", "user_id", "ip_address", "user_agent", "request_id", "endpoint",
+			"method", "status", "details", "risk_score", "blocked", "country", "city", "asn", "as_org"},
+		JSONColumns: map[string]bool{"details": true},
+	},
+	{
+		Name:        "security_alerts",
+		TimeColumn:  "created_at",
+		Columns:     []string{"severity", "title", "description", "event_ids", "risk_score", "actions", "metadata"},
+		JSONColumns: map[string]bool{"event_ids": true, "actions": true, "metadata": true},
+	},
+	{
+		Name:        "user_audit",
+		TimeColumn:  "created_at",
+		Columns:     []string{"user_id", "action", "actor_id", "request_id", "changes"},
+		JSONColumns: map[string]bool{"changes": true},
+	},
+}
+
+// SourceNamed returns the source called name
+func SourceNamed(name string) (Source, bool) {
+	for _, source := range Sources {
+		if source.Name == name {
+			return source, true
+		}
+	}
+	return Source{}, false
+}
+
+// Record is a row of a source
+type Record struct {
+	ID     string
+	At     time.Time
+	Fields map[string]interface{} // every column, as archived
+}
+
+// Cursor is the last record archived from a source; the next archive starts
+// after it
+type Cursor struct {
+	At time.Time
+	ID string
+}
+
+// Archive is a manifest entry: one object holding consecutive records of a
+// source
+type Archive struct {
+	ID        uuid.UUID `json:"id"`
+	Source    string    `json:"source"`
+	Key       string    `json:"key"`
+	Location  string    `json:"location"`
+	Records   int       `json:"records"`
+	Bytes     int64     `json:"bytes"`
+	SHA256    string    `json:"sha256"`   // of the object
+	FirstAt   time.Time `json:"first_at"` // time of its oldest record
+	LastAt    time.Time `json:"last_at"`
+	LastID    string    `json:"last_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Summary counts the archives of a source
+type Summary struct {
+	Source        string     `json:"source"`
+	Archives      int        `json:"archives"`
+	Records       int64      `json:"records"`
+	Bytes         int64      `json:"bytes"`
+	ArchivedUntil *time.Time `json:"archived_until,omitempty"` // time of the newest archived record
+	LastArchiveAt *time.Time `json:"last_archive_at,omitempty"`
+}
+
+// Store reads source records and keeps the manifest
+type Store interface {
+	// Records returns up to limit records of source created before before,
+	// oldest first, starting after the cursor when it is set
+	Records(ctx context.Context, source Source, after *Cursor, before time.Time, limit int) ([]Record, error)
+
+	SaveArchive(ctx context.Context, archive *Archive) error
+	// LastArchive returns the newest archive of source, or nil
+	LastArchive(ctx context.Context, source string) (*Archive, error)
+	// ListArchives returns the newest archives, of one source when it is set
+	ListArchives(ctx context.Context, source string, limit int) ([]Archive, error)
+	Summaries(ctx context.Context) ([]Summary, error)
+}
+
+// SQLStore reads the source tables and keeps the manifest in audit_archives
+type SQLStore struct {
+	db *sql.DB
+}
+
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+func (s *SQLStore) Records(ctx context.Context, source Source, after *Cursor, before time.Time, limit int) ([]Record, error) {
+	query := `SELECT id, ` + source.TimeColumn + `, ` + strings.Join(source.Columns, ", ") +
+		` FROM ` + source.Name + ` WHERE ` + source.TimeColumn + ` < $1`
+	args := []interface{}{before}
+	if after != nil {
+		query += fmt.Sprintf(` AND (%[1]s > $2 OR (%[1]s = $3 AND id > $4))`, source.TimeColumn)
+		args = append(args, after.At, after.At, after.ID)
+	}
+	query += fmt.Sprintf(` ORDER BY %s, id LIMIT $%d`, source.TimeColumn, len(args)+1)
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", source.Name, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var records []Record
+	for rows.Next() {
+		var record Record
+		values := make([]interface{}, len(source.Columns))
+		dest := []interface{}{&record.ID, &record.At}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", source.Name, err)
+		}
+
+		record.Fields = map[string]interface{}{"id": record.ID, source.TimeColumn: record.At.UTC()}
+		for i, column := range source.Columns {
+			record.Fields[column] = fieldValue(values[i], source.JSONColumns[column])
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", source.Name, err)
+	}
+	return records, nil
+}
+
+// fieldValue turns a scanned column into its archived form: drivers return
+// text as bytes, and JSON columns are kept as JSON
+func fieldValue(value interface{}, isJSON bool) interface{} {
+	raw, ok := value.([]byte)
+	if !ok {
+		return value
+	}
+	if isJSON && json.Valid(raw) {
+		return json.RawMessage(append([]byte(nil), raw...))
+	}
+	return string(raw)
+}
+
+func (s *SQLStore) SaveArchive(ctx context.Context, archive *Archive) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO audit_archives (id, source, object_key, location, records, bytes, sha256, first_at, last_at, last_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		archive.ID, archive.Source, archive.Key, archive.Location, archive.Records, archive.Bytes, archive.SHA256,
+		archive.FirstAt, archive.LastAt, archive.LastID, archive.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record archive: %w", err)
+	}
+	return nil
+}
+
+const archiveColumns = `id, source, object_key, location, records, bytes, sha256, first_at, last_at, last_id, created_at`
+
+func (s *SQLStore) LastArchive(ctx context.Context, source string) (*Archive, error) {
+	archive, err := scanArchive(s.db.QueryRowContext(ctx, `
+		SELECT `+archiveColumns+` FROM audit_archives
+		WHERE source = $1
+		ORDER BY last_at DESC, last_id DESC
+		LIMIT 1`, source))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the last archive of %s: %w", source, err)
+	}
+	return archive, nil
+}
+
+func (s *SQLStore) ListArchives(ctx context.Context, source string, limit int) ([]Archive, error) {
+	query := `SELECT ` + archiveColumns + ` FROM audit_archives`
+	args := []interface{}{}
+	if source != "" {
+		query += ` WHERE source = $1`
+		args = append(args, source)
+	}
+	query += fmt.Sprintf(` ORDER BY created_at DESC LIMIT $%d`, len(args)+1)
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list archives: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	archives := []Archive{}
+	for rows.Next() {
+		archive, err := scanArchive(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan archive: %w", err)
+		}
+		archives = append(archives, *archive)
+	}
+	return archives, rows.Err()
+}
+
+func (s *SQLStore) Summaries(ctx context.Context) ([]Summary, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT source, COUNT(*), SUM(records), SUM(bytes), MAX(last_at), MAX(created_at)
+		FROM audit_archives
+		GROUP BY source`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize archives: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var summaries []Summary
+	for rows.Next() {
+		var (
+			summary             Summary
+			until, lastArchived sql.NullTime
+		)
+		if err := rows.Scan(&summary.Source, &summary.Archives, &summary.Records, &summary.Bytes, &until, &lastArchived); err != nil {
+			return nil, fmt.Errorf("failed to scan archive summary: %w", err)
+		}
+		if until.Valid {
+			summary.ArchivedUntil = &until.Time
+		}
+		if lastArchived.Valid {
+			summary.LastArchiveAt = &lastArchived.Time
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanArchive(row rowScanner) (*Archive, error) {
+	var archive Archive
+	err := row.Scan(&archive.ID, &archive.Source, &archive.Key, &archive.Location, &archive.Records, &archive.Bytes,
+		&archive.SHA256, &archive.FirstAt, &archive.LastAt, &archive.LastID, &archive.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &archive, nil
+}
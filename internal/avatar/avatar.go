@@ -0,0 +1,302 @@
+// Package avatar stores user avatars in an object store and resizes them to
+// square thumbnails in the background.
+package avatar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/objectstore"
+	"highload-microservice/internal/worker"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// TaskType is the worker pool task type of thumbnail generation
+const TaskType = "avatar_thumbnails"
+
+// Avatar describes the current avatar of a user. Version changes with every
+// upload and is part of the object keys, so cached images of a replaced
+// avatar are never served again.
+type Avatar struct {
+	UserID      uuid.UUID `json:"user_id"`
+	Version     string    `json:"version"`
+	ContentType string    `json:"content_type"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	Bytes       int64     `json:"size"`
+	Thumbnails  []int     `json:"thumbnails"` // sizes resized so far
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Store persists avatar metadata
+type Store interface {
+	// GetAvatar returns the avatar of userID or nil
+	GetAvatar(ctx context.Context, userID uuid.UUID) (*Avatar, error)
+	SaveAvatar(ctx context.Context, avatar *Avatar) error
+	// SetThumbnails records the resized sizes of a version and reports
+	// whether that version is still current
+	SetThumbnails(ctx context.Context, userID uuid.UUID, version string, sizes []int) (bool, error)
+	// DeleteAvatar reports whether userID had an avatar
+	DeleteAvatar(ctx context.Context, userID uuid.UUID) (bool, error)
+}
+
+// Tasks queues background work. Implemented by worker.Pool.
+type Tasks interface {
+	Submit(task worker.Task) error
+}
+
+// Config limits uploads and selects the thumbnail sizes
+type Config struct {
+	MaxBytes       int64 // largest accepted upload
+	MaxPixels      int   // largest accepted width*height, bounds decoding memory
+	ThumbnailSizes []int // side lengths of the square thumbnails
+}
+
+func (c Config) withDefaults() Config {
+	if c.MaxBytes <= 0 {
+		c.MaxBytes = 5 << 20
+	}
+	if c.MaxPixels <= 0 {
+		c.MaxPixels = 25_000_000
+	}
+	if len(c.ThumbnailSizes) == 0 {
+		c.ThumbnailSizes = []int{64, 256}
+	}
+	return c
+}
+
+// Manager uploads, serves and removes avatars
+type Manager struct {
+	store   Store
+	objects objectstore.Bucket
+	tasks   Tasks
+	cfg     Config
+	logger  *logrus.Logger
+}
+
+// NewManager creates a manager; thumbnails are resized on tasks
+func NewManager(store Store, objects objectstore.Bucket, tasks Tasks, cfg Config, logger *logrus.Logger) *Manager {
+	return &Manager{
+		store:   store,
+		objects: objects,
+		tasks:   tasks,
+		cfg:     cfg.withDefaults(),
+		logger:  logger,
+	}
+}
+
+// Config returns the effective configuration
+func (m *Manager) Config() Config {
+	return m.cfg
+}
+
+// Upload replaces the avatar of userID with data and queues its thumbnails.
+// The image format is detected from data; PNG, JPEG and GIF are accepted.
+func (m *Manager) Upload(ctx context.Context, userID uuid.UUID, data []byte) (*Avatar, error) {
+	if int64(len(data)) > m.cfg.MaxBytes {
+		return nil, apperrors.Validation(fmt.Sprintf("avatar exceeds %d bytes", m.cfg.MaxBytes))
+	}
+	format, width, height, err := inspect(data)
+	if err != nil {
+		return nil, apperrors.Validation("avatar must be a PNG, JPEG or GIF image")
+	}
+	if width <= 0 || height <= 0 || width*height > m.cfg.MaxPixels {
+		return nil, apperrors.Validation(fmt.Sprintf("avatar must have at most %d pixels", m.cfg.MaxPixels))
+	}
+
+	previous, err := m.store.GetAvatar(ctx, userID)
+	if err != nil {
+		return nil, apperrors.FromDB(err, "failed to get avatar")
+	}
+
+	avatar := &Avatar{
+		UserID:      userID,
+		Version:     uuid.NewString(),
+		ContentType: formats[format].contentType,
+		Width:       width,
+		Height:      height,
+		Bytes:       int64(len(data)),
+		Thumbnails:  []int{},
+		UpdatedAt:   time.Now().UTC(),
+	}
+	if err := m.objects.Put(ctx, originalKey(avatar), data); err != nil {
+		return nil, apperrors.New(apperrors.ErrUnavailable, "failed to store avatar")
+	}
+	if err := m.store.SaveAvatar(ctx, avatar); err != nil {
+		m.deleteObjects(ctx, avatar)
+		return nil, apperrors.FromDB(err, "failed to save avatar")
+	}
+	if previous != nil {
+		m.deleteObjects(ctx, previous)
+	}
+
+	m.queueThumbnails(avatar)
+	m.logger.Infof("Avatar uploaded: user %s, version %s", userID, avatar.Version)
+	return avatar, nil
+}
+
+// Get returns the avatar of userID
+func (m *Manager) Get(ctx context.Context, userID uuid.UUID) (*Avatar, error) {
+	avatar, err := m.store.GetAvatar(ctx, userID)
+	if err != nil {
+		return nil, apperrors.FromDB(err, "failed to get avatar")
+	}
+	if avatar == nil {
+		return nil, apperrors.NotFound("avatar not found")
+	}
+	return avatar, nil
+}
+
+// Image returns the image of avatar in size, or the original for size 0.
+// Until a thumbnail is resized the original is returned in its place; the
+// returned content type tells which one it is.
+func (m *Manager) Image(ctx context.Context, avatar *Avatar, size int) ([]byte, string, error) {
+	key, contentType := originalKey(avatar), avatar.ContentType
+	if size != 0 {
+		if !slices.Contains(m.cfg.ThumbnailSizes, size) {
+			return nil, "", apperrors.Validation(fmt.Sprintf("size must be one of %v", m.cfg.ThumbnailSizes))
+		}
+		if slices.Contains(avatar.Thumbnails, size) {
+			key, contentType = thumbnailKey(avatar, size)
+		}
+	}
+
+	data, err := m.objects.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, objectstore.ErrNotFound) {
+			return nil, "", apperrors.NotFound("avatar not found")
+		}
+		return nil, "", apperrors.New(apperrors.ErrUnavailable, "failed to read avatar")
+	}
+	return data, contentType, nil
+}
+
+// Remove deletes the avatar of userID and its images. Removing a missing
+// avatar is no error.
+func (m *Manager) Remove(ctx context.Context, userID uuid.UUID) error {
+	avatar, err := m.store.GetAvatar(ctx, userID)
+	if err != nil {
+		return apperrors.FromDB(err, "failed to get avatar")
+	}
+	if avatar == nil {
+		return nil
+	}
+	if _, err := m.store.DeleteAvatar(ctx, userID); err != nil {
+		return apperrors.FromDB(err, "failed to delete avatar")
+	}
+	m.deleteObjects(ctx, avatar)
+	m.logger.Infof("Avatar removed: user %s", userID)
+	return nil
+}
+
+// queueThumbnails submits the resizing of avatar. A full queue only leaves
+// the original served in place of the thumbnails.
+func (m *Manager) queueThumbnails(avatar *Avatar) {
+	snapshot := *avatar
+	err := m.tasks.Submit(worker.Task{
+		Type:       TaskType,
+		Priority:   worker.PriorityLow,
+		MaxRetries: 2,
+		Run: func(ctx context.Context) error {
+			return m.Resize(ctx, &snapshot)
+		},
+	})
+	if err != nil {
+		m.logger.Warnf("Failed to queue avatar thumbnails for user %s: %v", avatar.UserID, err)
+	}
+}
+
+// Resize writes the thumbnails of avatar and records them, unless a newer
+// upload replaced avatar meanwhile
+func (m *Manager) Resize(ctx context.Context, avatar *Avatar) error {
+	current, err := m.store.GetAvatar(ctx, avatar.UserID)
+	if err != nil {
+		return err
+	}
+	if current == nil || current.Version != avatar.Version {
+		return nil
+	}
+
+	data, err := m.objects.Get(ctx, originalKey(avatar))
+	if err != nil {
+		if errors.Is(err, objectstore.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	img, err := decode(data)
+	if err != nil {
+		return fmt.Errorf("failed to decode avatar of user %s: %w", avatar.UserID, err)
+	}
+
+	sizes := make([]int, 0, len(m.cfg.ThumbnailSizes))
+	for _, size := range m.cfg.ThumbnailSizes {
+		key, contentType := thumbnailKey(avatar, size)
+		encoded, err := encode(thumbnail(img, size), formatOf(contentType))
+		if err != nil {
+			return fmt.Errorf("failed to encode %dpx avatar: %w", size, err)
+		}
+		if err := m.objects.Put(ctx, key, encoded); err != nil {
+			return err
+		}
+		sizes = append(sizes, size)
+	}
+
+	stillCurrent, err := m.store.SetThumbnails(ctx, avatar.UserID, avatar.Version, sizes)
+	if err != nil {
+		return err
+	}
+	if !stillCurrent {
+		// Replaced while resizing; the thumbnails written above were not
+		// there yet when the upload cleaned up this version
+		m.deleteObjects(ctx, avatar)
+		return nil
+	}
+	m.logger.Debugf("Avatar thumbnails resized: user %s, sizes %v", avatar.UserID, sizes)
+	return nil
+}
+
+// deleteObjects removes the original and every configured thumbnail of
+// avatar. Failures leave orphaned objects behind and are only logged.
+func (m *Manager) deleteObjects(ctx context.Context, avatar *Avatar) {
+	keys := []string{originalKey(avatar)}
+	for _, size := range m.cfg.ThumbnailSizes {
+		key, _ := thumbnailKey(avatar, size)
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		if err := m.objects.Delete(ctx, key); err != nil {
+			m.logger.Warnf("Failed to delete avatar object %s: %v", key, err)
+		}
+	}
+}
+
+func originalKey(avatar *Avatar) string {
+	return fmt.Sprintf("%s/%s/original%s", avatar.UserID, avatar.Version, extension(avatar.ContentType))
+}
+
+// thumbnailKey returns the key and content type of a thumbnail of avatar
+func thumbnailKey(avatar *Avatar, size int) (string, string) {
+	format := thumbnailFormat(formatOf(avatar.ContentType))
+	return fmt.Sprintf("%s/%s/%d%s", avatar.UserID, avatar.Version, size, formats[format].ext), formats[format].contentType
+}
+
+// formatOf returns the image format of contentType
+func formatOf(contentType string) string {
+	for format, f := range formats {
+		if f.contentType == contentType {
+			return format
+		}
+	}
+	return ""
+}
+
+func extension(contentType string) string {
+	return formats[formatOf(contentType)].ext
+}
@@ -0,0 +1,222 @@
+package avatar
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"regexp"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/database"
+	"highload-microservice/internal/objectstore"
+	"highload-microservice/internal/worker"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type memoryStore struct {
+	avatars map[uuid.UUID]Avatar
+}
+
+func (m *memoryStore) GetAvatar(ctx context.Context, userID uuid.UUID) (*Avatar, error) {
+	avatar, ok := m.avatars[userID]
+	if !ok {
+		return nil, nil
+	}
+	return &avatar, nil
+}
+
+func (m *memoryStore) SaveAvatar(ctx context.Context, avatar *Avatar) error {
+	m.avatars[avatar.UserID] = *avatar
+	return nil
+}
+
+func (m *memoryStore) SetThumbnails(ctx context.Context, userID uuid.UUID, version string, sizes []int) (bool, error) {
+	avatar, ok := m.avatars[userID]
+	if !ok || avatar.Version != version {
+		return false, nil
+	}
+	avatar.Thumbnails = sizes
+	m.avatars[userID] = avatar
+	return true, nil
+}
+
+func (m *memoryStore) DeleteAvatar(ctx context.Context, userID uuid.UUID) (bool, error) {
+	_, ok := m.avatars[userID]
+	delete(m.avatars, userID)
+	return ok, nil
+}
+
+// queue holds submitted tasks until the test runs them
+type queue struct {
+	tasks []worker.Task
+}
+
+func (q *queue) Submit(task worker.Task) error {
+	q.tasks = append(q.tasks, task)
+	return nil
+}
+
+func (q *queue) runAll(t *testing.T) {
+	t.Helper()
+	for _, task := range q.tasks {
+		if err := task.Run(context.Background()); err != nil {
+			t.Fatalf("task %s: %v", task.Type, err)
+		}
+	}
+	q.tasks = nil
+}
+
+func pngImage(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func newTestManager(t *testing.T) (*Manager, *memoryStore, *objectstore.FileStore, *queue) {
+	t.Helper()
+	objects, err := objectstore.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("file store: %v", err)
+	}
+	store := &memoryStore{avatars: map[uuid.UUID]Avatar{}}
+	tasks := &queue{}
+	m := NewManager(store, objects, tasks, Config{MaxBytes: 1 << 20, MaxPixels: 200 * 200, ThumbnailSizes: []int{16, 64}}, logrus.New())
+	return m, store, objects, tasks
+}
+
+func TestUpload_ResizesThumbnailsInTheBackground(t *testing.T) {
+	ctx := context.Background()
+	m, _, objects, tasks := newTestManager(t)
+	userID := uuid.New()
+
+	avatar, err := m.Upload(ctx, userID, pngImage(t, 120, 80))
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if avatar.ContentType != "image/png" || avatar.Width != 120 || avatar.Height != 80 || len(avatar.Thumbnails) != 0 {
+		t.Fatalf("unexpected avatar: %+v", avatar)
+	}
+
+	// The original stands in for thumbnails until they are resized
+	if _, contentType, err := m.Image(ctx, avatar, 16); err != nil || contentType != "image/png" {
+		t.Fatalf("fallback image: %s, %v", contentType, err)
+	}
+	if _, _, err := m.Image(ctx, avatar, 100); !errors.Is(err, apperrors.ErrValidation) {
+		t.Fatalf("unsupported size: want validation error, got %v", err)
+	}
+
+	tasks.runAll(t)
+	avatar, err = m.Get(ctx, userID)
+	if err != nil || len(avatar.Thumbnails) != 2 {
+		t.Fatalf("thumbnails not recorded: %+v, %v", avatar, err)
+	}
+	data, _, err := m.Image(ctx, avatar, 64)
+	if err != nil {
+		t.Fatalf("thumbnail: %v", err)
+	}
+	cfg, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width != 64 || cfg.Height != 64 {
+		t.Fatalf("want a 64x64 thumbnail, got %+v, %v", cfg, err)
+	}
+
+	// A new upload replaces the old version's objects
+	old := *avatar
+	if _, err := m.Upload(ctx, userID, pngImage(t, 40, 40)); err != nil {
+		t.Fatalf("second upload: %v", err)
+	}
+	for _, key := range []string{originalKey(&old), old.UserID.String() + "/" + old.Version + "/64.png"} {
+		if _, err := objects.Get(ctx, key); !errors.Is(err, objectstore.ErrNotFound) {
+			t.Fatalf("object %s of the replaced avatar still stored: %v", key, err)
+		}
+	}
+
+	if err := m.Remove(ctx, userID); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if _, err := m.Get(ctx, userID); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Fatalf("want not found after remove, got %v", err)
+	}
+	// The task of the removed version finds nothing to resize
+	tasks.runAll(t)
+}
+
+func TestUpload_RejectsNonImagesAndHugeDimensions(t *testing.T) {
+	m, store, _, tasks := newTestManager(t)
+	userID := uuid.New()
+
+	for name, data := range map[string][]byte{
+		"text":        []byte("definitely not an image"),
+		"too many px": pngImage(t, 300, 300),
+	} {
+		if _, err := m.Upload(context.Background(), userID, data); !errors.Is(err, apperrors.ErrValidation) {
+			t.Errorf("%s: want validation error, got %v", name, err)
+		}
+	}
+	if len(store.avatars) != 0 || len(tasks.tasks) != 0 {
+		t.Fatalf("rejected uploads must not be stored")
+	}
+}
+
+func TestThumbnail_CropsCenterSquare(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 30, 10))
+	for x := 10; x < 20; x++ {
+		for y := 0; y < 10; y++ {
+			img.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+	thumb := thumbnail(img, 5)
+	if thumb.Bounds().Dx() != 5 || thumb.Bounds().Dy() != 5 {
+		t.Fatalf("unexpected bounds %v", thumb.Bounds())
+	}
+	if c := thumb.RGBAAt(0, 0); c.R != 255 || c.A != 255 {
+		t.Fatalf("want the red center, got %v", c)
+	}
+	if small := thumbnail(img, 64); small.Bounds().Dx() != 10 {
+		t.Fatalf("small images must not be enlarged, got %v", small.Bounds())
+	}
+}
+
+func TestSQLStore_SetThumbnailsOnlyForCurrentVersion(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	dialect, _ := database.NewDialect(database.DriverPostgres)
+	store := NewSQLStore(db, dialect)
+	userID := uuid.New()
+
+	update := regexp.QuoteMeta(`UPDATE user_avatars SET thumbnails = $1 WHERE user_id = $2 AND version = $3`)
+	mock.ExpectExec(update).WithArgs("64,256", userID, "v1").WillReturnResult(sqlmock.NewResult(0, 0))
+	if current, err := store.SetThumbnails(context.Background(), userID, "v1", []int{64, 256}); err != nil || current {
+		t.Fatalf("want a superseded version, got %v, %v", current, err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM user_avatars WHERE user_id = $1`)).WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "version", "content_type", "width", "height", "size_bytes", "thumbnails", "updated_at"}).
+			AddRow(userID, "v2", "image/png", 10, 10, 100, "64", time.Now()))
+	avatar, err := store.GetAvatar(context.Background(), userID)
+	if err != nil || avatar.Version != "v2" || len(avatar.Thumbnails) != 1 || avatar.Thumbnails[0] != 64 {
+		t.Fatalf("unexpected avatar: %+v, %v", avatar, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
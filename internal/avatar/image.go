@@ -0,0 +1,103 @@
+package avatar
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // registers the GIF decoder
+	"image/jpeg"
+	"image/png"
+)
+
+// jpegQuality is the quality of JPEG thumbnails
+const jpegQuality = 85
+
+// formats maps the image formats accepted for avatars to their content type
+// and file extension
+var formats = map[string]struct{ contentType, ext string }{
+	"png":  {"image/png", ".png"},
+	"jpeg": {"image/jpeg", ".jpg"},
+	"gif":  {"image/gif", ".gif"},
+}
+
+// inspect returns the format and dimensions of an image without decoding its
+// pixels. The format comes from the data, not from what the client claims.
+func inspect(data []byte) (format string, width, height int, err error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", 0, 0, err
+	}
+	if _, ok := formats[format]; !ok {
+		return "", 0, 0, fmt.Errorf("unsupported image format %s", format)
+	}
+	return format, cfg.Width, cfg.Height, nil
+}
+
+// thumbnail crops the center square of img and scales it down to size
+// pixels per side, averaging the source pixels each target pixel covers.
+// Images smaller than size are cropped but not enlarged.
+func thumbnail(img image.Image, size int) *image.RGBA {
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	crop := image.NewRGBA(image.Rect(0, 0, side, side))
+	offset := image.Pt(bounds.Min.X+(bounds.Dx()-side)/2, bounds.Min.Y+(bounds.Dy()-side)/2)
+	draw.Draw(crop, crop.Bounds(), img, offset, draw.Src)
+
+	target := min(size, side)
+	if target == side {
+		return crop
+	}
+	out := image.NewRGBA(image.Rect(0, 0, target, target))
+	for y := 0; y < target; y++ {
+		y0, y1 := y*side/target, (y+1)*side/target
+		for x := 0; x < target; x++ {
+			x0, x1 := x*side/target, (x+1)*side/target
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := crop.Pix[sy*crop.Stride+x0*4 : sy*crop.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					r += int(row[i])
+					g += int(row[i+1])
+					b += int(row[i+2])
+					a += int(row[i+3])
+					n++
+				}
+			}
+			i := y*out.Stride + x*4
+			out.Pix[i], out.Pix[i+1], out.Pix[i+2], out.Pix[i+3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return out
+}
+
+// encode writes a thumbnail as JPEG for JPEG originals and as PNG otherwise,
+// keeping transparency
+func encode(img image.Image, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// thumbnailFormat is the format thumbnails of an original in format are
+// encoded in
+func thumbnailFormat(format string) string {
+	if format == "jpeg" {
+		return "jpeg"
+	}
+	return "png"
+}
+
+// decode decodes an image of one of the accepted formats
+func decode(data []byte) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
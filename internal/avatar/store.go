@@ -0,0 +1,95 @@
+package avatar
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"highload-microservice/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// SQLStore keeps avatar metadata in the user_avatars table
+type SQLStore struct {
+	db     *sql.DB
+	upsert string
+}
+
+func NewSQLStore(db *sql.DB, dialect database.Dialect) *SQLStore {
+	columns := []string{"user_id", "version", "content_type", "width", "height", "size_bytes", "thumbnails", "updated_at"}
+	return &SQLStore{
+		db:     db,
+		upsert: dialect.Upsert("user_avatars", columns, []string{"user_id"}, columns[1:]),
+	}
+}
+
+func (s *SQLStore) GetAvatar(ctx context.Context, userID uuid.UUID) (*Avatar, error) {
+	var (
+		avatar     Avatar
+		thumbnails string
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT user_id, version, content_type, width, height, size_bytes, thumbnails, updated_at
+		FROM user_avatars WHERE user_id = $1
+	`, userID).Scan(&avatar.UserID, &avatar.Version, &avatar.ContentType, &avatar.Width, &avatar.Height,
+		&avatar.Bytes, &thumbnails, &avatar.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get avatar: %w", err)
+	}
+	avatar.Thumbnails = parseSizes(thumbnails)
+	return &avatar, nil
+}
+
+func (s *SQLStore) SaveAvatar(ctx context.Context, avatar *Avatar) error {
+	_, err := s.db.ExecContext(ctx, s.upsert, avatar.UserID, avatar.Version, avatar.ContentType, avatar.Width,
+		avatar.Height, avatar.Bytes, formatSizes(avatar.Thumbnails), avatar.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save avatar: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) SetThumbnails(ctx context.Context, userID uuid.UUID, version string, sizes []int) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE user_avatars SET thumbnails = $1 WHERE user_id = $2 AND version = $3
+	`, formatSizes(sizes), userID, version)
+	if err != nil {
+		return false, fmt.Errorf("failed to record avatar thumbnails: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return err != nil || n > 0, nil
+}
+
+func (s *SQLStore) DeleteAvatar(ctx context.Context, userID uuid.UUID) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM user_avatars WHERE user_id = $1`, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete avatar: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return err != nil || n > 0, nil
+}
+
+func formatSizes(sizes []int) string {
+	parts := make([]string, len(sizes))
+	for i, size := range sizes {
+		parts[i] = strconv.Itoa(size)
+	}
+	return strings.Join(parts, ",")
+}
+
+func parseSizes(s string) []int {
+	sizes := []int{}
+	for _, part := range strings.Split(s, ",") {
+		if size, err := strconv.Atoi(strings.TrimSpace(part)); err == nil && size > 0 {
+			sizes = append(sizes, size)
+		}
+	}
+	return sizes
+}
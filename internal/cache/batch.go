@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"context"
+	"errors"
+
+	"highload-microservice/internal/metrics"
+)
+
+// MultiGetter is implemented by caches that read many keys in one round
+// trip (Redis MGET, Memcached get with several keys)
+type MultiGetter interface {
+	// GetMulti returns the values of the cached keys; missing keys are absent
+	// from the result
+	GetMulti(ctx context.Context, keys []string) (map[string]string, error)
+}
+
+// GetMulti reads keys from store in one round trip when it is a
+// MultiGetter, and key by key otherwise
+func GetMulti(ctx context.Context, store Store, keys []string) (map[string]string, error) {
+	if len(keys) == 0 {
+		return map[string]string{}, nil
+	}
+	if multi, ok := store.(MultiGetter); ok {
+		return multi.GetMulti(ctx, keys)
+	}
+	values := make(map[string]string, len(keys))
+	for _, key := range keys {
+		value, err := store.Get(ctx, key)
+		if errors.Is(err, ErrMiss) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+func (i *instrumented) GetMulti(ctx context.Context, keys []string) (map[string]string, error) {
+	values, err := GetMulti(ctx, i.Cache, keys)
+	if err != nil {
+		metrics.CacheLookup(i.backend, metrics.CacheError)
+		return nil, err
+	}
+	for _, key := range keys {
+		if _, ok := values[key]; ok {
+			metrics.CacheLookup(i.backend, metrics.CacheHit)
+		} else {
+			metrics.CacheLookup(i.backend, metrics.CacheMiss)
+		}
+	}
+	return values, nil
+}
+
+func (g *guarded) GetMulti(ctx context.Context, keys []string) (map[string]string, error) {
+	var values map[string]string
+	err := g.breaker.Execute(ctx, func(ctx context.Context) error {
+		var err error
+		values, err = GetMulti(ctx, g.Cache, keys)
+		return err
+	})
+	return values, err
+}
+
+func (r *redisCache) GetMulti(ctx context.Context, keys []string) (map[string]string, error) {
+	results, err := r.Client.MGet(ctx, keys...)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(keys))
+	for i, result := range results {
+		if value, ok := result.(string); ok {
+			values[keys[i]] = value
+		}
+	}
+	return values, nil
+}
+
+func (m *MemcachedCache) GetMulti(ctx context.Context, keys []string) (map[string]string, error) {
+	items, err := m.client.GetMulti(keys)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(items))
+	for key, item := range items {
+		values[key] = string(item.Value)
+	}
+	return values, nil
+}
+
+// GetMulti serves what it can from L1 and reads the rest from L2 in one
+// round trip, copying them into L1
+func (t *Tiered) GetMulti(ctx context.Context, keys []string) (map[string]string, error) {
+	values := make(map[string]string, len(keys))
+	var missing []string
+	for _, key := range keys {
+		if value, err := t.l1.Get(ctx, key); err == nil {
+			metrics.CacheLookup(BackendL1, metrics.CacheHit)
+			values[key] = value
+			continue
+		}
+		metrics.CacheLookup(BackendL1, metrics.CacheMiss)
+		missing = append(missing, key)
+	}
+	if len(missing) == 0 {
+		return values, nil
+	}
+
+	fetched, err := GetMulti(ctx, t.l2, missing)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range fetched {
+		values[key] = value
+		_ = t.l1.Set(ctx, key, value, t.ttl)
+	}
+	return values, nil
+}
@@ -0,0 +1,27 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTiered_GetMultiFillsL1(t *testing.T) {
+	ctx := context.Background()
+	l1, l2 := NewLRUCache(10), NewMemoryCache()
+	tiered := NewTiered(l1, l2, time.Minute)
+
+	_ = l1.Set(ctx, "a", "1", time.Minute)
+	_ = l2.Set(ctx, "b", "2", time.Minute)
+
+	values, err := GetMulti(ctx, tiered, []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatalf("get multi: %v", err)
+	}
+	if len(values) != 2 || values["a"] != "1" || values["b"] != "2" {
+		t.Fatalf("unexpected values %v", values)
+	}
+	if value, err := l1.Get(ctx, "b"); err != nil || value != "2" {
+		t.Fatalf("expected b copied into L1, got %q, %v", value, err)
+	}
+}
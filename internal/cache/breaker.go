@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"highload-microservice/internal/resilience"
+)
+
+// WithBreaker guards the calls of c with breaker. While the breaker is open
+// Get fails at once, which readers treat as a miss and go to the database,
+// and writes are skipped with resilience.ErrOpen. Ping and Close are not
+// guarded, so health checks still reach the backend.
+func WithBreaker(c Cache, breaker *resilience.Breaker) Cache {
+	return &guarded{Cache: c, breaker: breaker}
+}
+
+type guarded struct {
+	Cache
+	breaker *resilience.Breaker
+}
+
+func (g *guarded) Get(ctx context.Context, key string) (string, error) {
+	var value string
+	missed := false
+	err := g.breaker.Execute(ctx, func(ctx context.Context) error {
+		var err error
+		value, err = g.Cache.Get(ctx, key)
+		if errors.Is(err, ErrMiss) {
+			// The backend answered; a miss is not a failure
+			missed = true
+			return nil
+		}
+		return err
+	})
+	if missed {
+		return "", ErrMiss
+	}
+	return value, err
+}
+
+func (g *guarded) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	return g.breaker.Execute(ctx, func(ctx context.Context) error {
+		return g.Cache.Set(ctx, key, value, expiration)
+	})
+}
+
+func (g *guarded) Del(ctx context.Context, keys ...string) error {
+	return g.breaker.Execute(ctx, func(ctx context.Context) error {
+		return g.Cache.Del(ctx, keys...)
+	})
+}
+
+func (g *guarded) Incr(ctx context.Context, key string, expiration time.Duration) (int64, error) {
+	var n int64
+	err := g.breaker.Execute(ctx, func(ctx context.Context) error {
+		var err error
+		n, err = g.Cache.Incr(ctx, key, expiration)
+		return err
+	})
+	return n, err
+}
+
+func (g *guarded) Exists(ctx context.Context, key string) (bool, error) {
+	var exists bool
+	err := g.breaker.Execute(ctx, func(ctx context.Context) error {
+		var err error
+		exists, err = g.Cache.Exists(ctx, key)
+		return err
+	})
+	return exists, err
+}
@@ -0,0 +1,31 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/resilience"
+)
+
+func TestWithBreaker_MissesAreNotFailures(t *testing.T) {
+	breaker := resilience.New("test_cache", resilience.Config{FailureThreshold: 1, OpenTimeout: time.Minute})
+	c := WithBreaker(NewMemoryCache(), breaker)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.Get(ctx, "missing"); !errors.Is(err, ErrMiss) {
+			t.Fatalf("want ErrMiss, got %v", err)
+		}
+	}
+	if breaker.State() != resilience.StateClosed {
+		t.Fatalf("want closed after misses, got %s", breaker.State())
+	}
+	if err := c.Set(ctx, "k", "v", time.Minute); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if v, err := c.Get(ctx, "k"); err != nil || v != "v" {
+		t.Fatalf("get: %q, %v", v, err)
+	}
+}
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"highload-microservice/internal/config"
+	"highload-microservice/internal/metrics"
+	"highload-microservice/internal/redis"
+)
+
+// Supported values for CACHE_BACKEND
+const (
+	BackendRedis     = "redis"
+	BackendMemcached = "memcached"
+	BackendMemory    = "memory"
+)
+
+// ErrMiss is returned by Get when the key is not present in the cache
+var ErrMiss = errors.New("cache miss")
+
+// Cache is a key/value store with per-key TTL used for read-through caching
+type Cache interface {
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+	Del(ctx context.Context, keys ...string) error
+	// Incr atomically increments an integer counter; expiration applies when the key is created
+	Incr(ctx context.Context, key string, expiration time.Duration) (int64, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// New creates a cache for the backend selected by CACHE_BACKEND. Lookups are
+// counted in the cache_requests_total metric.
+func New(cfg *config.Config) (Cache, error) {
+	switch strings.ToLower(cfg.Cache.Backend) {
+	case "", BackendRedis:
+		client, err := redis.NewClient(cfg.Redis)
+		if err != nil {
+			return nil, err
+		}
+		return &instrumented{Cache: &redisCache{Client: client}, backend: BackendRedis}, nil
+	case BackendMemcached:
+		c, err := NewMemcachedCache(cfg.Cache.MemcachedServers)
+		if err != nil {
+			return nil, err
+		}
+		return &instrumented{Cache: c, backend: BackendMemcached}, nil
+	case BackendMemory:
+		return &instrumented{Cache: NewMemoryCache(), backend: BackendMemory}, nil
+	default:
+		return nil, fmt.Errorf("unsupported cache backend: %s", cfg.Cache.Backend)
+	}
+}
+
+// instrumented records hits and misses of the wrapped cache
+type instrumented struct {
+	Cache
+	backend string
+}
+
+func (i *instrumented) Get(ctx context.Context, key string) (string, error) {
+	value, err := i.Cache.Get(ctx, key)
+	switch {
+	case err == nil:
+		metrics.CacheLookup(i.backend, metrics.CacheHit)
+	case errors.Is(err, ErrMiss):
+		metrics.CacheLookup(i.backend, metrics.CacheMiss)
+	default:
+		metrics.CacheLookup(i.backend, metrics.CacheError)
+	}
+	return value, err
+}
+
+// redisCache adapts the Redis client so that misses surface as ErrMiss
+type redisCache struct {
+	*redis.Client
+}
+
+func (r *redisCache) Get(ctx context.Context, key string) (string, error) {
+	value, err := r.Client.Get(ctx, key)
+	if redis.IsNil(err) {
+		return "", ErrMiss
+	}
+	return value, err
+}
+
+// stringify converts a value to the string form stored by the backends,
+// matching how go-redis serializes Set arguments.
+func stringify(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
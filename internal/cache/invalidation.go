@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Invalidation tells the other instances to drop cached keys
+type Invalidation struct {
+	Origin string   `json:"origin"` // instance that changed the data
+	Keys   []string `json:"keys"`
+}
+
+// Broadcaster delivers invalidations to every instance, including the sender
+type Broadcaster interface {
+	Publish(ctx context.Context, inv Invalidation) error
+	// Receive blocks until the next invalidation arrives
+	Receive(ctx context.Context) (Invalidation, error)
+	Close() error
+}
+
+// Deleter is a cache whose keys can be invalidated
+type Deleter interface {
+	Del(ctx context.Context, keys ...string) error
+}
+
+// Invalidator publishes the keys changed on this instance and drops the keys
+// changed on other instances from the caches private to this one. Shared
+// caches (Redis, Memcached) are kept up to date by the writer and need no
+// invalidation.
+type Invalidator struct {
+	bus    Broadcaster
+	origin string
+	logger *logrus.Logger
+
+	mu     sync.RWMutex
+	locals []Deleter
+}
+
+func NewInvalidator(bus Broadcaster, logger *logrus.Logger) *Invalidator {
+	return &Invalidator{bus: bus, origin: uuid.NewString(), logger: logger}
+}
+
+// AddLocal registers a cache private to this instance, such as the in-memory
+// backend
+func (i *Invalidator) AddLocal(c Deleter) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.locals = append(i.locals, c)
+}
+
+// Invalidate tells the other instances that keys changed. The caller updates
+// its own caches.
+func (i *Invalidator) Invalidate(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return i.bus.Publish(ctx, Invalidation{Origin: i.origin, Keys: keys})
+}
+
+// Run applies invalidations from other instances until ctx is cancelled
+func (i *Invalidator) Run(ctx context.Context) {
+	for {
+		inv, err := i.bus.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			i.logger.Errorf("Failed to receive cache invalidation: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		if inv.Origin == i.origin {
+			continue
+		}
+		i.apply(ctx, inv.Keys)
+	}
+}
+
+func (i *Invalidator) apply(ctx context.Context, keys []string) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	for _, local := range i.locals {
+		if err := local.Del(ctx, keys...); err != nil && !errors.Is(err, ErrMiss) {
+			i.logger.Errorf("Failed to invalidate cached keys %v: %v", keys, err)
+		}
+	}
+}
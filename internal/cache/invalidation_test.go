@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// chanBus delivers published invalidations to a single receiver
+type chanBus struct {
+	messages chan Invalidation
+}
+
+func (b *chanBus) Publish(_ context.Context, inv Invalidation) error {
+	b.messages <- inv
+	return nil
+}
+
+func (b *chanBus) Receive(ctx context.Context) (Invalidation, error) {
+	select {
+	case inv := <-b.messages:
+		return inv, nil
+	case <-ctx.Done():
+		return Invalidation{}, ctx.Err()
+	}
+}
+
+func (b *chanBus) Close() error { return nil }
+
+func TestInvalidator_DropsKeysChangedElsewhere(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bus := &chanBus{messages: make(chan Invalidation, 4)}
+	local := NewMemoryCache()
+	_ = local.Set(ctx, "user:1", "old", time.Minute)
+	_ = local.Set(ctx, "user:2", "mine", time.Minute)
+
+	inv := NewInvalidator(bus, logrus.New())
+	inv.AddLocal(local)
+	done := make(chan struct{})
+	go func() {
+		inv.Run(ctx)
+		close(done)
+	}()
+
+	// Own invalidations come back from the bus and are ignored
+	if err := inv.Invalidate(ctx, "user:2"); err != nil {
+		t.Fatalf("invalidate: %v", err)
+	}
+	_ = bus.Publish(ctx, Invalidation{Origin: "other", Keys: []string{"user:1"}})
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := local.Get(ctx, "user:1"); err == ErrMiss {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("key changed on another instance was not dropped")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if v, err := local.Get(ctx, "user:2"); err != nil || v != "mine" {
+		t.Fatalf("own key was dropped: %q %v", v, err)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Run did not stop")
+	}
+}
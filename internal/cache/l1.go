@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"highload-microservice/internal/metrics"
+)
+
+// BackendL1 labels lookups of the per-instance cache in front of the shared one
+const BackendL1 = "l1"
+
+// LRUCache is a bounded in-process cache that evicts the least recently used
+// key when full. Unlike MemoryCache it stays small, for hot keys only.
+type LRUCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // front = most recently used
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key string
+	memoryEntry
+}
+
+// NewLRUCache creates a cache holding at most size keys
+func NewLRUCache(size int) *LRUCache {
+	if size < 1 {
+		size = 1
+	}
+	return &LRUCache{size: size, order: list.New(), entries: make(map[string]*list.Element, size)}
+}
+
+func (l *LRUCache) Get(ctx context.Context, key string) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	elem, ok := l.entries[key]
+	if !ok {
+		return "", ErrMiss
+	}
+	entry := elem.Value.(*lruEntry)
+	if entry.expired(time.Now()) {
+		l.remove(elem)
+		return "", ErrMiss
+	}
+	l.order.MoveToFront(elem)
+	return entry.value, nil
+}
+
+func (l *LRUCache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	entry := memoryEntry{value: stringify(value)}
+	if expiration > 0 {
+		entry.expiresAt = time.Now().Add(expiration)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if elem, ok := l.entries[key]; ok {
+		elem.Value.(*lruEntry).memoryEntry = entry
+		l.order.MoveToFront(elem)
+		return nil
+	}
+	l.entries[key] = l.order.PushFront(&lruEntry{key: key, memoryEntry: entry})
+	if l.order.Len() > l.size {
+		l.remove(l.order.Back())
+	}
+	return nil
+}
+
+func (l *LRUCache) Del(ctx context.Context, keys ...string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, key := range keys {
+		if elem, ok := l.entries[key]; ok {
+			l.remove(elem)
+		}
+	}
+	return nil
+}
+
+// Len returns the number of cached keys, expired ones included
+func (l *LRUCache) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len()
+}
+
+func (l *LRUCache) remove(elem *list.Element) {
+	l.order.Remove(elem)
+	delete(l.entries, elem.Value.(*lruEntry).key)
+}
+
+// Tiered puts a small per-instance LRUCache (L1) in front of a shared cache
+// (L2, Redis). Reads are served from L1 for up to its TTL, so ultra-hot keys
+// skip the network; writes and deletes go to both. L1 copies of keys changed
+// on other instances live until their TTL unless the L1 is registered with
+// an Invalidator.
+type Tiered struct {
+	l1  *LRUCache
+	l2  Cache
+	ttl time.Duration
+}
+
+// NewTiered layers l1 in front of l2; l1 entries expire after ttl at most
+func NewTiered(l1 *LRUCache, l2 Cache, ttl time.Duration) *Tiered {
+	return &Tiered{l1: l1, l2: l2, ttl: ttl}
+}
+
+// L1 returns the per-instance cache, for registering with an Invalidator
+func (t *Tiered) L1() *LRUCache {
+	return t.l1
+}
+
+func (t *Tiered) Get(ctx context.Context, key string) (string, error) {
+	if value, err := t.l1.Get(ctx, key); err == nil {
+		metrics.CacheLookup(BackendL1, metrics.CacheHit)
+		return value, nil
+	}
+	metrics.CacheLookup(BackendL1, metrics.CacheMiss)
+
+	value, err := t.l2.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	_ = t.l1.Set(ctx, key, value, t.ttl)
+	return value, nil
+}
+
+func (t *Tiered) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	if err := t.l2.Set(ctx, key, value, expiration); err != nil {
+		// The L1 copy would outlive the failed write
+		_ = t.l1.Del(ctx, key)
+		return err
+	}
+	ttl := t.ttl
+	if expiration > 0 && expiration < ttl {
+		ttl = expiration
+	}
+	return t.l1.Set(ctx, key, value, ttl)
+}
+
+func (t *Tiered) Del(ctx context.Context, keys ...string) error {
+	_ = t.l1.Del(ctx, keys...)
+	return t.l2.Del(ctx, keys...)
+}
+
+// Incr counts in L2 only; counters are never served from L1
+func (t *Tiered) Incr(ctx context.Context, key string, expiration time.Duration) (int64, error) {
+	_ = t.l1.Del(ctx, key)
+	return t.l2.Incr(ctx, key, expiration)
+}
+
+func (t *Tiered) Exists(ctx context.Context, key string) (bool, error) {
+	if _, err := t.l1.Get(ctx, key); err == nil {
+		return true, nil
+	}
+	return t.l2.Exists(ctx, key)
+}
+
+func (t *Tiered) Ping(ctx context.Context) error {
+	return t.l2.Ping(ctx)
+}
+
+// Close closes L2
+func (t *Tiered) Close() error {
+	return t.l2.Close()
+}
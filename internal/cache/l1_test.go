@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLRUCache_Evicts(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRUCache(2)
+
+	_ = c.Set(ctx, "a", "1", time.Minute)
+	_ = c.Set(ctx, "b", "2", time.Minute)
+	// a is now the most recently used, b is evicted next
+	if _, err := c.Get(ctx, "a"); err != nil {
+		t.Fatalf("get a: %v", err)
+	}
+	_ = c.Set(ctx, "c", "3", time.Minute)
+
+	if _, err := c.Get(ctx, "b"); err != ErrMiss {
+		t.Fatalf("expected b to be evicted, got %v", err)
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, err := c.Get(ctx, key); err != nil {
+			t.Fatalf("expected %s to be cached, got %v", key, err)
+		}
+	}
+	if c.Len() != 2 {
+		t.Fatalf("expected 2 keys, got %d", c.Len())
+	}
+}
+
+func TestLRUCache_TTL(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRUCache(10)
+
+	_ = c.Set(ctx, "k", "v", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if _, err := c.Get(ctx, "k"); err != ErrMiss {
+		t.Fatalf("expected expired key to miss, got %v", err)
+	}
+	if c.Len() != 0 {
+		t.Fatalf("expected expired key to be removed, got %d keys", c.Len())
+	}
+}
+
+func TestTiered_ReadsThroughL1(t *testing.T) {
+	ctx := context.Background()
+	l2 := NewMemoryCache()
+	c := NewTiered(NewLRUCache(10), l2, time.Minute)
+
+	_ = l2.Set(ctx, "user:1", "alice", time.Hour)
+	if got, err := c.Get(ctx, "user:1"); err != nil || got != "alice" {
+		t.Fatalf("get: %q %v", got, err)
+	}
+
+	// Served from L1 while L2 changes underneath until it is invalidated
+	_ = l2.Set(ctx, "user:1", "bob", time.Hour)
+	if got, _ := c.Get(ctx, "user:1"); got != "alice" {
+		t.Fatalf("expected the L1 copy, got %q", got)
+	}
+	_ = c.L1().Del(ctx, "user:1")
+	if got, _ := c.Get(ctx, "user:1"); got != "bob" {
+		t.Fatalf("expected the L2 value after invalidation, got %q", got)
+	}
+
+	if err := c.Del(ctx, "user:1"); err != nil {
+		t.Fatalf("del: %v", err)
+	}
+	if _, err := c.Get(ctx, "user:1"); err != ErrMiss {
+		t.Fatalf("expected a miss after delete, got %v", err)
+	}
+}
+
+func TestTiered_SetCapsL1TTL(t *testing.T) {
+	ctx := context.Background()
+	l2 := NewMemoryCache()
+	c := NewTiered(NewLRUCache(10), l2, time.Minute)
+
+	_ = c.Set(ctx, "k", "v", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if _, err := c.L1().Get(ctx, "k"); err != ErrMiss {
+		t.Fatalf("expected the L1 copy to expire with the value, got %v", err)
+	}
+
+	if n, _ := c.Incr(ctx, "counter", time.Minute); n != 1 {
+		t.Fatalf("expected counter 1, got %d", n)
+	}
+	if _, err := c.L1().Get(ctx, "counter"); err != ErrMiss {
+		t.Fatalf("expected counters to bypass L1, got %v", err)
+	}
+}
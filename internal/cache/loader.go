@@ -0,0 +1,246 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"highload-microservice/internal/metrics"
+)
+
+// ErrNotFound is returned by a load function when the value does not exist.
+// The Loader remembers it for LoaderConfig.NegativeTTL and returns it again
+// without calling load.
+var ErrNotFound = errors.New("cache: value not found")
+
+// Stored forms of loader entries. Cached values are JSON, so neither prefix
+// can collide with a plain value.
+const (
+	negativeEntry  = "!notfound"
+	envelopePrefix = "xf1:" // xf1:<expires unix ms>:<load time µs>:<value>
+)
+
+// LoaderConfig tunes how a Loader treats misses
+type LoaderConfig struct {
+	// NegativeTTL is how long a not found result is cached; 0 disables
+	// negative caching
+	NegativeTTL time.Duration
+	// EarlyRefresh reloads hot keys shortly before they expire (XFetch), so
+	// that they rarely expire under load
+	EarlyRefresh bool
+	// Beta scales early refresh; above 1 refreshes earlier. Defaults to 1.
+	Beta float64
+}
+
+// LoadFunc loads the value of a key from the source of truth
+type LoadFunc func(ctx context.Context) (string, error)
+
+// LoadManyFunc loads the values of keys from the source of truth in one go.
+// Keys it leaves out of the result are not cached.
+type LoadManyFunc func(ctx context.Context, keys []string) (map[string]string, error)
+
+// Store is the part of a Cache the Loader uses
+type Store interface {
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+}
+
+// Loader reads through a cache and protects the source behind it from
+// stampedes: concurrent misses of a key share one load, not found results are
+// cached briefly, and hot keys may be refreshed before they expire.
+type Loader struct {
+	store Store
+	cfg   LoaderConfig
+
+	mu    sync.Mutex
+	calls map[string]*loadCall
+
+	now    func() time.Time
+	random func() float64
+}
+
+// loadCall is a load in flight; done is closed once value and err are set
+type loadCall struct {
+	done  chan struct{}
+	value string
+	err   error
+}
+
+func NewLoader(store Store, cfg LoaderConfig) *Loader {
+	if cfg.Beta <= 0 {
+		cfg.Beta = 1
+	}
+	return &Loader{
+		store:  store,
+		cfg:    cfg,
+		calls:  make(map[string]*loadCall),
+		now:    time.Now,
+		random: rand.Float64,
+	}
+}
+
+// Load returns the cached value of key, calling load on a miss and caching
+// its result for ttl. Cache errors count as misses.
+func (l *Loader) Load(ctx context.Context, key string, ttl time.Duration, load LoadFunc) (string, error) {
+	raw, err := l.store.Get(ctx, key)
+	if err != nil {
+		return l.Fill(ctx, key, ttl, load)
+	}
+	if raw == negativeEntry {
+		metrics.CacheLoad(metrics.CacheLoadNegativeHit)
+		return "", ErrNotFound
+	}
+
+	value, expires, delta, ok := decodeEnvelope(raw)
+	if !ok || !l.refreshEarly(expires, delta) {
+		return value, nil
+	}
+
+	// This caller refreshes the key for everyone; a failed refresh still has
+	// the cached value to fall back to
+	metrics.CacheLoad(metrics.CacheLoadEarlyRefresh)
+	if fresh, err := l.Fill(ctx, key, ttl, load); err == nil {
+		return fresh, nil
+	}
+	return value, nil
+}
+
+// LoadMany returns the values of keys, reading the cache in one round trip
+// and loading every miss with a single call of load, whose results are
+// cached for ttl. The keys come from the source of truth, so entries cached
+// as not found count as misses. Keys load leaves out are absent from the
+// result. Cache errors count as misses; hot keys are not refreshed early.
+func (l *Loader) LoadMany(ctx context.Context, keys []string, ttl time.Duration, load LoadManyFunc) (map[string]string, error) {
+	cached, err := GetMulti(ctx, l.store, keys)
+	if err != nil {
+		cached = nil
+	}
+
+	values := make(map[string]string, len(keys))
+	var missing []string
+	for _, key := range keys {
+		raw, ok := cached[key]
+		if !ok || raw == negativeEntry {
+			missing = append(missing, key)
+			continue
+		}
+		values[key], _, _, _ = decodeEnvelope(raw)
+	}
+	if len(missing) == 0 {
+		return values, nil
+	}
+
+	metrics.CacheLoad(metrics.CacheLoadLoaded)
+	start := l.now()
+	loaded, err := load(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	now := l.now()
+	for key, value := range loaded {
+		values[key] = value
+		stored := value
+		if l.cfg.EarlyRefresh {
+			stored = encodeEnvelope(value, now.Add(ttl), now.Sub(start))
+		}
+		_ = l.store.Set(ctx, key, stored, ttl)
+	}
+	return values, nil
+}
+
+// Fill calls load and caches its result, skipping the cache read. Callers use
+// it to replace entries they could not decode. Concurrent fills of a key share
+// one load.
+func (l *Loader) Fill(ctx context.Context, key string, ttl time.Duration, load LoadFunc) (string, error) {
+	l.mu.Lock()
+	if call, ok := l.calls[key]; ok {
+		l.mu.Unlock()
+		metrics.CacheLoad(metrics.CacheLoadCoalesced)
+		select {
+		case <-call.done:
+			return call.value, call.err
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	call := &loadCall{done: make(chan struct{})}
+	l.calls[key] = call
+	l.mu.Unlock()
+
+	metrics.CacheLoad(metrics.CacheLoadLoaded)
+	// Waiters share the result, so the leader giving up must not fail them;
+	// the database query timeout still bounds the load
+	call.value, call.err = l.load(context.WithoutCancel(ctx), key, ttl, load)
+
+	l.mu.Lock()
+	delete(l.calls, key)
+	l.mu.Unlock()
+	close(call.done)
+
+	return call.value, call.err
+}
+
+// load runs load and stores its outcome. Store errors are not returned: the
+// instrumented cache already counts them and the value is still good.
+func (l *Loader) load(ctx context.Context, key string, ttl time.Duration, load LoadFunc) (string, error) {
+	start := l.now()
+	value, err := load(ctx)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) && l.cfg.NegativeTTL > 0 {
+			_ = l.store.Set(ctx, key, negativeEntry, l.cfg.NegativeTTL)
+		}
+		return "", err
+	}
+
+	stored := value
+	if l.cfg.EarlyRefresh {
+		now := l.now()
+		stored = encodeEnvelope(value, now.Add(ttl), now.Sub(start))
+	}
+	_ = l.store.Set(ctx, key, stored, ttl)
+	return value, nil
+}
+
+// refreshEarly decides whether this read refreshes the key (XFetch). The
+// chance grows as expiry nears and with the time a load takes, so slow keys
+// are refreshed earlier.
+func (l *Loader) refreshEarly(expires time.Time, delta time.Duration) bool {
+	if !l.cfg.EarlyRefresh {
+		return false
+	}
+	r := l.random()
+	if r <= 0 {
+		return true
+	}
+	gap := time.Duration(float64(delta) * l.cfg.Beta * -math.Log(r))
+	return !l.now().Add(gap).Before(expires)
+}
+
+func encodeEnvelope(value string, expires time.Time, delta time.Duration) string {
+	return envelopePrefix + strconv.FormatInt(expires.UnixMilli(), 10) + ":" +
+		strconv.FormatInt(delta.Microseconds(), 10) + ":" + value
+}
+
+// decodeEnvelope unwraps a value stored with early refresh. Plain values are
+// returned as is with ok false.
+func decodeEnvelope(raw string) (value string, expires time.Time, delta time.Duration, ok bool) {
+	rest, found := strings.CutPrefix(raw, envelopePrefix)
+	if !found {
+		return raw, time.Time{}, 0, false
+	}
+	parts := strings.SplitN(rest, ":", 3)
+	if len(parts) != 3 {
+		return raw, time.Time{}, 0, false
+	}
+	expiresMs, err1 := strconv.ParseInt(parts[0], 10, 64)
+	deltaUs, err2 := strconv.ParseInt(parts[1], 10, 64)
+	if err1 != nil || err2 != nil {
+		return raw, time.Time{}, 0, false
+	}
+	return parts[2], time.UnixMilli(expiresMs), time.Duration(deltaUs) * time.Microsecond, true
+}
@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoader_CoalescesConcurrentMisses(t *testing.T) {
+	ctx := context.Background()
+	l := NewLoader(NewMemoryCache(), LoaderConfig{})
+
+	var calls int32
+	release := make(chan struct{})
+	load := func(context.Context) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "v", nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]string, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = l.Load(ctx, "k", time.Minute, load)
+		}(i)
+	}
+	// Let the callers pile up behind the first load
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("expected one load, got %d", n)
+	}
+	for i, v := range results {
+		if v != "v" {
+			t.Fatalf("caller %d got %q", i, v)
+		}
+	}
+}
+
+func TestLoader_CachesNotFound(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryCache()
+	l := NewLoader(store, LoaderConfig{NegativeTTL: time.Minute})
+
+	var calls int
+	load := func(context.Context) (string, error) {
+		calls++
+		return "", ErrNotFound
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := l.Load(ctx, "k", time.Minute, load); err != ErrNotFound {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected not found to be cached, got %d loads", calls)
+	}
+
+	// Writing the key replaces the negative entry
+	_ = store.Set(ctx, "k", "v", time.Minute)
+	if v, err := l.Load(ctx, "k", time.Minute, load); err != nil || v != "v" {
+		t.Fatalf("expected written value, got %q %v", v, err)
+	}
+}
+
+func TestLoader_NegativeCachingDisabled(t *testing.T) {
+	l := NewLoader(NewMemoryCache(), LoaderConfig{})
+
+	var calls int
+	load := func(context.Context) (string, error) {
+		calls++
+		return "", ErrNotFound
+	}
+	_, _ = l.Load(context.Background(), "k", time.Minute, load)
+	_, _ = l.Load(context.Background(), "k", time.Minute, load)
+	if calls != 2 {
+		t.Fatalf("expected every miss to load, got %d loads", calls)
+	}
+}
+
+func TestLoader_EarlyRefresh(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	l := NewLoader(NewMemoryCache(), LoaderConfig{EarlyRefresh: true})
+	l.now = func() time.Time { return now }
+	l.random = func() float64 { return 0.5 }
+
+	version := "v1"
+	load := func(context.Context) (string, error) { return version, nil }
+	if v, _ := l.Load(ctx, "k", time.Minute, load); v != "v1" {
+		t.Fatalf("first load: %q", v)
+	}
+
+	// Far from expiry the cached value is served
+	version = "v2"
+	if v, _ := l.Load(ctx, "k", time.Minute, load); v != "v1" {
+		t.Fatalf("expected cached value, got %q", v)
+	}
+
+	// At expiry the reader refreshes the key
+	now = now.Add(time.Minute)
+	if v, _ := l.Load(ctx, "k", time.Minute, load); v != "v2" {
+		t.Fatalf("expected refreshed value, got %q", v)
+	}
+}
+
+func TestLoader_ReadsPlainValuesWithEarlyRefresh(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryCache()
+	_ = store.Set(ctx, "k", `{"id":1}`, time.Minute)
+	l := NewLoader(store, LoaderConfig{EarlyRefresh: true})
+
+	v, err := l.Load(ctx, "k", time.Minute, func(context.Context) (string, error) {
+		t.Fatalf("unexpected load")
+		return "", nil
+	})
+	if err != nil || v != `{"id":1}` {
+		t.Fatalf("expected plain value, got %q %v", v, err)
+	}
+}
+
+func TestLoader_LoadManyLoadsMissesInOneCall(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryCache()
+	l := NewLoader(store, LoaderConfig{NegativeTTL: time.Minute, EarlyRefresh: true})
+
+	_ = store.Set(ctx, "a", "1", time.Minute)
+	_ = store.Set(ctx, "b", negativeEntry, time.Minute) // listed, so loaded again
+
+	var loads [][]string
+	load := func(_ context.Context, keys []string) (map[string]string, error) {
+		loads = append(loads, keys)
+		return map[string]string{"b": "2", "c": "3"}, nil // d is gone
+	}
+	values, err := l.LoadMany(ctx, []string{"a", "b", "c", "d"}, time.Minute, load)
+	if err != nil {
+		t.Fatalf("load many: %v", err)
+	}
+	if len(loads) != 1 || len(loads[0]) != 3 {
+		t.Fatalf("expected one load of the three misses, got %v", loads)
+	}
+	if len(values) != 3 || values["a"] != "1" || values["b"] != "2" || values["c"] != "3" {
+		t.Fatalf("unexpected values %v", values)
+	}
+
+	// Loaded values were written back in the loader's format
+	values, err = l.LoadMany(ctx, []string{"b", "c"}, time.Minute, load)
+	if err != nil || len(loads) != 1 || values["b"] != "2" || values["c"] != "3" {
+		t.Fatalf("expected cached values, got %v after %d loads: %v", values, len(loads), err)
+	}
+}
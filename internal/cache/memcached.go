@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// MemcachedCache stores entries in a Memcached cluster
+type MemcachedCache struct {
+	client *memcache.Client
+}
+
+// NewMemcachedCache connects to the given Memcached servers
+func NewMemcachedCache(servers []string) (*MemcachedCache, error) {
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("at least one memcached server is required")
+	}
+
+	client := memcache.New(servers...)
+	if err := client.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to connect to Memcached: %w", err)
+	}
+
+	return &MemcachedCache{client: client}, nil
+}
+
+func (m *MemcachedCache) Get(ctx context.Context, key string) (string, error) {
+	item, err := m.client.Get(key)
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return "", ErrMiss
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(item.Value), nil
+}
+
+func (m *MemcachedCache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	return m.client.Set(&memcache.Item{
+		Key:        key,
+		Value:      []byte(stringify(value)),
+		Expiration: memcachedTTL(expiration),
+	})
+}
+
+func (m *MemcachedCache) Del(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if err := m.client.Delete(key); err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemcachedCache) Incr(ctx context.Context, key string, expiration time.Duration) (int64, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		n, err := m.client.Increment(key, 1)
+		if err == nil {
+			return int64(n), nil // #nosec G115 -- counters stay far below the int64 range
+		}
+		if !errors.Is(err, memcache.ErrCacheMiss) {
+			return 0, err
+		}
+
+		// Create the counter; if another client won the race, increment theirs
+		err = m.client.Add(&memcache.Item{
+			Key:        key,
+			Value:      []byte("1"),
+			Expiration: memcachedTTL(expiration),
+		})
+		if err == nil {
+			return 1, nil
+		}
+		if !errors.Is(err, memcache.ErrNotStored) {
+			return 0, err
+		}
+	}
+	return 0, fmt.Errorf("failed to increment %s", key)
+}
+
+func (m *MemcachedCache) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := m.Get(ctx, key)
+	if errors.Is(err, ErrMiss) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (m *MemcachedCache) Ping(ctx context.Context) error {
+	return m.client.Ping()
+}
+
+func (m *MemcachedCache) Close() error {
+	return m.client.Close()
+}
+
+// memcachedTTL converts expiration to whole seconds, rounding up: memcached
+// reads 0 as no expiration, which a sub-second TTL would otherwise become
+func memcachedTTL(expiration time.Duration) int32 {
+	if expiration <= 0 {
+		return 0
+	}
+	return int32((expiration + time.Second - 1) / time.Second) // #nosec G115 -- cache TTLs are far below the int32 range
+}
@@ -0,0 +1,22 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemcachedTTL(t *testing.T) {
+	cases := map[time.Duration]int32{
+		0:                       0,
+		-time.Second:            0,
+		time.Millisecond:        1,
+		time.Second:             1,
+		1500 * time.Millisecond: 2,
+		time.Minute:             60,
+	}
+	for in, want := range cases {
+		if got := memcachedTTL(in); got != want {
+			t.Errorf("memcachedTTL(%v) = %d, want %d", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// memoryJanitorInterval is how often entries that were never read again are
+// dropped after they expire
+const memoryJanitorInterval = time.Minute
+
+type memoryEntry struct {
+	value     string
+	expiresAt time.Time // zero means no expiration
+}
+
+// MemoryCache is an in-process cache, useful for single-instance deployments
+// and tests
+type MemoryCache struct {
+	mu      sync.RWMutex
+	entries map[string]memoryEntry
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewMemoryCache creates an empty in-memory cache and starts a goroutine that
+// drops expired entries until Close
+func NewMemoryCache() *MemoryCache {
+	m := &MemoryCache{
+		entries: make(map[string]memoryEntry),
+		done:    make(chan struct{}),
+	}
+	go m.janitor(memoryJanitorInterval)
+	return m
+}
+
+func (m *MemoryCache) Get(ctx context.Context, key string) (string, error) {
+	m.mu.RLock()
+	entry, ok := m.entries[key]
+	m.mu.RUnlock()
+
+	if !ok {
+		return "", ErrMiss
+	}
+	if now := time.Now(); entry.expired(now) {
+		m.mu.Lock()
+		// Set may have replaced the entry since the read lock was released
+		if entry, ok := m.entries[key]; ok && entry.expired(now) {
+			delete(m.entries, key)
+		}
+		m.mu.Unlock()
+		return "", ErrMiss
+	}
+
+	return entry.value, nil
+}
+
+func (m *MemoryCache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	entry := memoryEntry{value: stringify(value)}
+	if expiration > 0 {
+		entry.expiresAt = time.Now().Add(expiration)
+	}
+
+	m.mu.Lock()
+	m.entries[key] = entry
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *MemoryCache) Del(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	for _, key := range keys {
+		delete(m.entries, key)
+	}
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *MemoryCache) Incr(ctx context.Context, key string, expiration time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok || entry.expired(time.Now()) {
+		entry = memoryEntry{value: "0"}
+		if expiration > 0 {
+			entry.expiresAt = time.Now().Add(expiration)
+		}
+	}
+
+	n, err := strconv.ParseInt(entry.value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("value at %s is not an integer", key)
+	}
+	n++
+	entry.value = strconv.FormatInt(n, 10)
+	m.entries[key] = entry
+
+	return n, nil
+}
+
+func (m *MemoryCache) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := m.Get(ctx, key)
+	if err == ErrMiss {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (m *MemoryCache) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *MemoryCache) Close() error {
+	m.closeOnce.Do(func() { close(m.done) })
+	return nil
+}
+
+func (m *MemoryCache) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case now := <-ticker.C:
+			m.purge(now)
+		}
+	}
+}
+
+// purge drops the entries expired at now
+func (m *MemoryCache) purge(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, entry := range m.entries {
+		if entry.expired(now) {
+			delete(m.entries, key)
+		}
+	}
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
+}
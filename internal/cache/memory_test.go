@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryCache_SetGetDel(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache()
+
+	if _, err := c.Get(ctx, "k"); err != ErrMiss {
+		t.Fatalf("expected ErrMiss, got %v", err)
+	}
+
+	if err := c.Set(ctx, "k", "v", time.Minute); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	got, err := c.Get(ctx, "k")
+	if err != nil || got != "v" {
+		t.Fatalf("get: %q %v", got, err)
+	}
+	if ok, _ := c.Exists(ctx, "k"); !ok {
+		t.Fatalf("expected key to exist")
+	}
+
+	if err := c.Del(ctx, "k"); err != nil {
+		t.Fatalf("del: %v", err)
+	}
+	if ok, _ := c.Exists(ctx, "k"); ok {
+		t.Fatalf("expected key to be deleted")
+	}
+}
+
+func TestMemoryCache_TTL(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache()
+
+	_ = c.Set(ctx, "short", 42, 10*time.Millisecond)
+	_ = c.Set(ctx, "forever", []byte("x"), 0)
+
+	if got, _ := c.Get(ctx, "short"); got != "42" {
+		t.Fatalf("unexpected value: %q", got)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if _, err := c.Get(ctx, "short"); err != ErrMiss {
+		t.Fatalf("expected expiry, got %v", err)
+	}
+	if got, err := c.Get(ctx, "forever"); err != nil || got != "x" {
+		t.Fatalf("unexpected value without TTL: %q %v", got, err)
+	}
+}
+
+func TestMemoryCache_Incr(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache()
+
+	for want := int64(1); want <= 3; want++ {
+		n, err := c.Incr(ctx, "counter", 20*time.Millisecond)
+		if err != nil || n != want {
+			t.Fatalf("incr: got %d %v, want %d", n, err, want)
+		}
+	}
+
+	// Expiration is set on creation and not extended by later increments
+	time.Sleep(30 * time.Millisecond)
+	if n, _ := c.Incr(ctx, "counter", time.Minute); n != 1 {
+		t.Fatalf("expected counter to restart after expiry, got %d", n)
+	}
+
+	_ = c.Set(ctx, "text", "abc", time.Minute)
+	if _, err := c.Incr(ctx, "text", time.Minute); err == nil {
+		t.Fatalf("expected error incrementing a non-integer value")
+	}
+}
+
+func TestMemoryCache_PurgeDropsUnreadExpiredEntries(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache()
+	defer c.Close()
+
+	_ = c.Set(ctx, "short", "a", time.Millisecond)
+	_ = c.Set(ctx, "long", "b", time.Hour)
+	_ = c.Set(ctx, "forever", "c", 0)
+
+	c.purge(time.Now().Add(time.Minute))
+	c.mu.RLock()
+	_, short := c.entries["short"]
+	left := len(c.entries)
+	c.mu.RUnlock()
+	if short || left != 2 {
+		t.Fatalf("expected only the expired entry to be purged, %d left (short=%v)", left, short)
+	}
+
+	// The janitor stops on Close, which is safe to repeat
+	if err := c.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+}
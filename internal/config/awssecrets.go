@@ -0,0 +1,54 @@
+package config
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// AWSSecretsBackend reads secrets from AWS Secrets Manager. Credentials come
+// from the default AWS chain (environment, shared config, instance role).
+type AWSSecretsBackend struct {
+	client *secretsmanager.Client
+}
+
+// NewAWSSecretsBackend creates a backend for region; endpoint optionally
+// overrides the service URL (LocalStack)
+func NewAWSSecretsBackend(region, endpoint string) (*AWSSecretsBackend, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretFetchTimeout)
+	defer cancel()
+
+	var opts []func(*awsconfig.LoadOptions) error
+	if region != "" {
+		opts = append(opts, awsconfig.WithRegion(region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	client := secretsmanager.NewFromConfig(awsCfg, func(o *secretsmanager.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+	return &AWSSecretsBackend{client: client}, nil
+}
+
+// GetSecret reads the current version of the secret whose name or ARN is
+// path. key selects a field of a secret stored as a JSON object.
+func (a *AWSSecretsBackend) GetSecret(ctx context.Context, path, key string) (string, error) {
+	out, err := a.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(path),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get secret %s: %w", path, err)
+	}
+	if out.SecretString == nil {
+		return "", fmt.Errorf("secret %s has no string value", path)
+	}
+	return secretField(*out.SecretString, key)
+}
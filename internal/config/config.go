@@ -1,23 +1,76 @@
 package config
 
 import (
+	"encoding/base64"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
-
-	"github.com/joho/godotenv"
+	"time"
 )
 
 type Config struct {
+	// DevMode switches the defaults of DB_DRIVER, DB_NAME, CACHE_BACKEND and
+	// MESSAGING_BACKEND to in-process stores, so the service runs without
+	// external dependencies. Explicitly set variables still apply.
+	DevMode bool
+
 	Server    ServerConfig
 	Database  DatabaseConfig
 	Redis     RedisConfig
+	Cache     CacheConfig
 	Kafka     KafkaConfig
+	Messaging MessagingConfig
+	SQS       SQSConfig
+	NATS      NATSConfig
+	RabbitMQ  RabbitMQConfig
+	Outbox    OutboxConfig
+	Worker    WorkerConfig
+	Scheduler SchedulerConfig
 	Auth      AuthConfig
 	RateLimit RateLimitConfig
+	DDoS      DDoSConfig
+	IPRules   IPRulesConfig
 	Security  SecurityConfig
+	Audit     AuditConfig
+	ArchiveS3 ArchiveS3Config
+	GeoIP     GeoIPConfig
+	Anomaly   AnomalyConfig
+	Alerting  AlertingConfig
+	SIEM      SIEMConfig
 	LogLevel  string
+	Redaction RedactionConfig
+
+	EventEncryption EventEncryptionConfig
+	UserEncryption  UserEncryptionConfig
+	EventSchemas    EventSchemaConfig
+	EventTypes      EventTypeConfig
+	EventHandlers   EventHandlerConfig
+	Sagas           SagaConfig
+	OIDC            OIDCConfig
+	Registration    RegistrationConfig
+	Invitations     InvitationConfig
+	Profile         ProfileConfig
+	Avatars         AvatarConfig
+	Mail            MailConfig
+	Webhooks        WebhookConfig
+	EventReplay     EventReplayConfig
+	EventBulk       EventBulkConfig
+	EventRetention  EventRetentionConfig
+	Export          ExportConfig
+	AuditArchive    AuditArchiveConfig
+	HTTPRecording   HTTPRecordingConfig
+	EventStats      EventStatsConfig
+	EventUsage      EventUsageConfig
+	EventUsers      EventUserConfig
+	CircuitBreaker  CircuitBreakerConfig
+	HTTPClient      HTTPClientConfig
+	LoadShedding    LoadSheddingConfig
+	Bulkheads       BulkheadConfig
+	Diagnostics     DiagnosticsConfig
+	Reload          ReloadConfig
+	APIVersions     APIVersionConfig
+	Startup         StartupConfig
 }
 
 type ServerConfig struct {
@@ -26,15 +79,49 @@ type ServerConfig struct {
 	TLSCert string
 	TLSKey  string
 	UseTLS  bool
+
+	// Client certificates (mTLS) for service-to-service calls
+	TLSClientAuth       string // none, optional or require
+	TLSClientCA         string // PEM bundle of the CAs that issue client certificates
+	TLSClientIdentities string // subject=permission,...;... API permissions per certificate subject
+
+	// Response compression (gzip/deflate)
+	CompressionEnabled       bool
+	CompressionMinSize       int      // in bytes, smaller responses are sent as is
+	CompressionLevel         int      // 1-9, -1 for the library default
+	CompressionExcludedPaths []string // path prefixes never compressed
+
+	// Per-request deadline; 0 = none
+	RequestTimeout       int      // in milliseconds
+	RequestTimeoutRoutes []string // "[METHOD ]PATTERN=DURATION" overrides, e.g. /admin/*=60s
 }
 
 type DatabaseConfig struct {
+	Driver   string // postgres, mysql or sqlite
 	Host     string
 	Port     string
 	User     string
 	Password string
-	Name     string
+	Name     string // the file with sqlite; ":memory:" keeps the data in memory
 	SSLMode  string
+
+	MaxOpenConns     int
+	MaxIdleConns     int
+	ConnMaxLifetime  int // in seconds, 0 = unlimited
+	ConnMaxIdleTime  int // in seconds, 0 = unlimited
+	StatementTimeout int // in milliseconds, enforced by the server; 0 = none
+	QueryTimeout     int // in milliseconds, context deadline per statement; 0 = none
+
+	MigrateOnStart bool // apply pending migrations at startup instead of only checking
+
+	// Prepare the hot-path queries once per pool; off behind PgBouncer in
+	// transaction mode
+	PreparedStatements bool
+
+	// Read replica for GetX/ListX queries; empty ReplicaHost disables it
+	ReplicaHost          string
+	ReplicaPort          string
+	ReplicaCheckInterval int // in seconds
 }
 
 type RedisConfig struct {
@@ -42,12 +129,250 @@ type RedisConfig struct {
 	Port     string
 	Password string
 	DB       int
+
+	// Mode is standalone (Host and Port), sentinel or cluster (Addrs)
+	Mode             string
+	Addrs            []string // sentinel or cluster node addresses, host:port
+	MasterName       string   // sentinel master name
+	SentinelPassword string
+
+	TLSEnabled    bool
+	TLSCAFile     string // CA bundle verifying the server; empty = system roots
+	TLSCertFile   string // client certificate, optional
+	TLSKeyFile    string
+	TLSServerName string // overrides the name verified in the server certificate
+}
+
+type CacheConfig struct {
+	Backend          string // redis, memcached or memory
+	MemcachedServers []string
+	// Stampede protection of GetUser and GetEvent
+	NegativeTTL  int // in seconds, how long not found is cached; 0 = disabled
+	EarlyRefresh bool
+	// Kafka topic broadcasting invalidations between instances; empty = disabled
+	InvalidationTopic string
+	// Per-instance LRU in front of the shared cache for users and events
+	L1Enabled bool
+	L1Size    int // keys
+	L1TTL     int // in milliseconds
+	// Filling the cache with recent events and their users at startup
+	WarmupEnabled bool
+	WarmupEvents  int
+	WarmupUsers   int
+	// Reading the users and events of list pages through the cache
+	ListEnabled bool
 }
 
 type KafkaConfig struct {
 	Brokers []string
-	Topic   string
+	Topic   string // default topic, for event types without a route
 	GroupID string
+
+	TopicRoutes  []string // "EVENT_TYPE=TOPIC"; a trailing * matches a type prefix
+	PartitionKey string   // user_id or event_id
+
+	HealthCheckInterval int // in seconds, metadata probe period
+	ReconnectThreshold  int // consecutive failures before the client is recreated
+	ReconnectMaxBackoff int // in seconds
+
+	// TLS; certificates come from the *File paths or, when set, the PEM values
+	TLSEnabled    bool
+	TLSCAFile     string // CA bundle verifying the brokers; empty = system roots
+	TLSCA         string
+	TLSCertFile   string // client certificate, optional
+	TLSCert       string
+	TLSKeyFile    string
+	TLSKey        string
+	TLSServerName string
+
+	// SASL: empty (none), PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512
+	SASLMechanism string
+	SASLUsername  string
+	SASLPassword  string
+}
+
+type DDoSConfig struct {
+	Backend   string // memory or redis; redis shares request counts and blocks between replicas
+	KeyPrefix string // Redis key prefix
+	// Repeat offenders are blocked twice as long each time, up to
+	// MaxBlockMinutes; a block counts as an offense for OffenseTTLHours
+	MaxBlockMinutes int
+	OffenseTTLHours int
+	// More than MaxRequests requests from an IP within WindowSeconds block it
+	// for BlockMinutes
+	MaxRequests   int
+	WindowSeconds int
+	BlockMinutes  int
+}
+
+type IPRulesConfig struct {
+	Enabled         bool
+	RefreshInterval int // in seconds, how often rules changed on other replicas are reloaded
+}
+
+type MessagingConfig struct {
+	Backend string // kafka, sqs, nats, rabbitmq or memory
+
+	// Consumer retries
+	RetryInitialBackoff int // in milliseconds
+	RetryMaxBackoff     int // in milliseconds
+	HandlerTimeout      int // in seconds, per processing attempt
+	ShutdownTimeout     int // in seconds, how long shutdown waits for the event in progress
+	Concurrency         int // events processed at once, ordered per user
+	LaneQueueSize       int // events buffered per lane before fetching blocks
+
+	// Consumer deduplication
+	DedupBackend      string // cache, database or none
+	DedupTTLHours     int    // how long processed event IDs are remembered
+	DedupLeaseSeconds int    // how long a claim blocks other consumers from the event
+
+	// Async producer buffer (ignored when the outbox is enabled)
+	AsyncProduce      bool
+	AsyncBufferSize   int
+	AsyncWorkers      int
+	AsyncSendTimeout  int // in seconds, per broker write
+	AsyncFlushTimeout int // in seconds, on shutdown
+}
+
+type SQSConfig struct {
+	Region            string
+	Endpoint          string // optional override, e.g. LocalStack
+	TopicARN          string
+	QueueURL          string
+	DLQURL            string
+	VisibilityTimeout int // in seconds
+	WaitTimeSeconds   int
+	MaxReceiveCount   int
+}
+
+// NATSConfig selects the JetStream stream events are published to and the
+// durable consumer replicas share
+type NATSConfig struct {
+	URL           string // comma separated servers
+	Username      string
+	Password      string
+	Stream        string // created with SubjectPrefix.> when missing
+	SubjectPrefix string // events are published to <prefix>.<event type>
+	Durable       string
+	AckWait       int // in seconds before an unacknowledged event is redelivered
+	MaxDeliver    int // deliveries of an event before it is dropped; -1 means no limit
+	FetchBatch    int
+	FetchWait     int // in seconds, how long a fetch waits for events
+}
+
+// RabbitMQConfig selects the topic exchange events are published to and the
+// queue replicas share
+type RabbitMQConfig struct {
+	URL                string
+	Username           string // overrides the credentials in URL
+	Password           string
+	Exchange           string // topic exchange, routing key = event type
+	Queue              string
+	BindingKey         string // event types the queue receives, * and # wildcards
+	Prefetch           int    // unacknowledged events per consumer
+	DeadLetterExchange string // receives undecodable events; empty drops them
+}
+
+type WorkerConfig struct {
+	PoolSize            int
+	QueueSize           int // per priority
+	RetryInitialBackoff int // in milliseconds
+	RetryMaxBackoff     int // in milliseconds
+}
+
+// SchedulerConfig holds cron expressions of the maintenance jobs. An empty
+// expression disables the job.
+type SchedulerConfig struct {
+	Enabled              bool
+	RefreshTokenCleanup  string
+	APIKeyExpiry         string
+	SecurityStats        string
+	EventStats           string
+	EventRetention       string
+	AuditArchive         string
+	HTTPRecordingPurge   string
+	ProcessedEventsPurge string
+	OutboxPurge          string
+	SagaResume           string
+}
+
+type OutboxConfig struct {
+	Enabled        bool
+	Publisher      string // relay (in-process) or cdc (Debezium)
+	PollInterval   int    // in milliseconds
+	BatchSize      int
+	RetentionHours int // how long the relay keeps published rows
+}
+
+// AuditConfig controls persistence of security events and alerts
+type AuditConfig struct {
+	Persist       bool
+	BatchSize     int
+	FlushInterval int // in milliseconds
+	QueueSize     int
+}
+
+// ArchiveS3Config is the S3-compatible bucket of the s3 archive backend
+type ArchiveS3Config struct {
+	Bucket       string
+	Prefix       string
+	Region       string
+	Endpoint     string // optional override, e.g. MinIO
+	PathStyle    bool
+	StorageClass string
+}
+
+// GeoIPConfig points at the IP range CSV databases used to locate security
+// events; GeoIP is off when both are empty
+type GeoIPConfig struct {
+	LocationDB string // country or city CSV
+	ASNDB      string
+}
+
+// AnomalyConfig holds the initial thresholds of the per-client traffic
+// anomaly detector; they can be changed at runtime through the admin API
+type AnomalyConfig struct {
+	Enabled            bool
+	WindowSeconds      int
+	MinBaselineWindows int
+	MinRequests        int
+	ZScore             float64
+	RateFactor         float64
+	FanOutFactor       float64
+	ErrorRateFactor    float64
+	UnauthorizedFactor float64
+}
+
+// AlertingConfig configures notification of security alerts. A channel is
+// enabled by its destination setting.
+type AlertingConfig struct {
+	SlackWebhookURL     string
+	PagerDutyRoutingKey string
+	WebhookURL          string
+	WebhookSecret       string
+	SMTPAddr            string // host:port
+	SMTPUsername        string
+	SMTPPassword        string
+	EmailFrom           string
+	EmailTo             []string
+	Routes              string // channel=severity[:type,...];...; empty sends high and critical alerts to every channel
+	RatePerMinute       int    // notifications per channel and minute; 0 means no limit
+	MaxAttempts         int
+	Timeout             int // in seconds
+}
+
+// SIEMConfig forwards security events and alerts to a SIEM collector as
+// syslog; an empty address disables it
+type SIEMConfig struct {
+	Address     string // host:port
+	Network     string // tcp, tls or udp
+	Format      string // cef, leef or syslog (JSON)
+	MinSeverity string
+	Alerts      bool
+	TLSCAFile   string
+	Hostname    string
+	QueueSize   int
+	Timeout     int // in seconds
 }
 
 type AuthConfig struct {
@@ -55,6 +380,47 @@ type AuthConfig struct {
 	JWTExpiration     int // in hours
 	RefreshExpiration int // in days
 	APIKeyLength      int
+	APIKeyGrace       int // in minutes, old secret validity after rotation
+
+	// JWT signing keys besides JWTSecret, for rotation
+	JWTKeyID       string   // kid of JWTSecret; tokens without a kid are verified with it
+	JWTActiveKeyID string   // kid of the key that signs new tokens; empty means JWTKeyID
+	JWTHMACKeys    []string // more HMAC keys, "KID:BASE64"
+	JWTKeyFiles    []string // PEM files of RSA or P-256 ECDSA keys, "KID:PATH"; public keys only verify
+
+	// Per-account login throttling
+	LoginThrottleFreeAttempts int
+	LoginThrottleBaseDelay    int // in seconds
+	LoginThrottleMaxDelay     int // in seconds
+	LoginThrottleWindow       int // in minutes
+
+	// Account lockout after repeated failed logins
+	LockoutMaxAttempts int
+	LockoutWindow      int // in minutes
+	LockoutDuration    int // in minutes
+
+	// Password policy for passwords set by users and administrators
+	PasswordMinLength      int
+	PasswordMaxLength      int // at most 72, the bcrypt limit
+	PasswordRequireUpper   bool
+	PasswordRequireLower   bool
+	PasswordRequireDigit   bool
+	PasswordRequireSpecial bool
+	PasswordMinClasses     int    // of upper, lower, digit and special
+	PasswordCheckBanned    bool   // refuse the built-in list of common passwords
+	PasswordBannedListFile string // more banned passwords, one per line
+	PasswordCheckUserInfo  bool   // refuse passwords containing the email or name
+	PasswordMaxAgeDays     int    // 0 means passwords don't expire
+
+	// Role permission overrides, e.g. "user=users:read,events:read;readonly=events:read"
+	Permissions string
+
+	// Browser sessions: bearer returns tokens in the body; cookie and both
+	// set them as httpOnly cookies guarded by a double-submit CSRF token
+	SessionMode    string
+	CookieDomain   string
+	CookieSecure   bool
+	CookieSameSite string // lax, strict or none
 }
 
 type RateLimitConfig struct {
@@ -63,6 +429,348 @@ type RateLimitConfig struct {
 	BurstSize             int
 	AuthRequestsPerMinute int
 	AuthBurstSize         int
+	ExemptCIDRs           []string // trusted IP ranges that bypass rate limiting and DDoS protection
+	ExemptAPIKeys         []string
+	ExemptRoles           []string
+	Policies              []string // per-route and per-role overrides, "[ROLES:][METHOD ]PATTERN=REQUESTS/DURATION"
+}
+
+// RedactionConfig controls masking of PII in logs and security events
+type RedactionConfig struct {
+	Patterns    []string // built-in patterns: email, token, card, password
+	Fields      []string // field names whose values are always replaced
+	AllowFields []string // field names whose values are never masked (IDs)
+}
+
+type EventEncryptionConfig struct {
+	EventTypes  []string // event types whose payload is encrypted at rest
+	KeyID       string   // ID of the active key (ENCRYPTION_KEY)
+	Key         []byte
+	KeyProvided bool     // false when ENCRYPTION_KEY was generated at startup
+	OldKeys     []string // retired keys still used for reads, "ID:BASE64"
+	ReaderRoles []string // roles allowed to read decrypted payloads
+}
+
+// UserEncryptionConfig enables encryption of user emails and names at rest
+// with the key ring of EventEncryptionConfig
+type UserEncryptionConfig struct {
+	Enabled  bool
+	IndexKey string // base64 HMAC key of the email blind index, at least 32 bytes
+}
+
+// BlindIndexKey decodes IndexKey
+func (c UserEncryptionConfig) BlindIndexKey() ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(c.IndexKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid USER_ENCRYPTION_INDEX_KEY: %w", err)
+	}
+	if len(key) < 32 {
+		return nil, fmt.Errorf("USER_ENCRYPTION_INDEX_KEY must be at least 32 bytes")
+	}
+	return key, nil
+}
+
+type EventSchemaConfig struct {
+	Dir             string // directory of <event_type>.json schemas; empty disables file schemas
+	RefreshInterval int    // in seconds, how often schemas changed on other replicas are reloaded
+	InvalidAction   string // reject or dlq, for consumed events that fail validation
+	DLQTopic        string // Kafka topic for invalid events when InvalidAction is dlq
+}
+
+// EventTypeConfig enables the registry of event types
+type EventTypeConfig struct {
+	Enabled         bool
+	Strict          bool // refuse events of unregistered types, not only of disabled ones
+	RefreshInterval int  // in seconds, how often types changed on other replicas are reloaded
+}
+
+// EventHandlerConfig tunes the handlers run for consumed events
+type EventHandlerConfig struct {
+	Enabled             bool
+	Disabled            []string // handlers off until enabled through the admin API
+	MaxRetries          int      // per handler, after the first attempt
+	RetryInitialBackoff int      // in milliseconds
+	RetryMaxBackoff     int      // in milliseconds
+	RefreshInterval     int      // in seconds, how often settings changed on other replicas are reloaded
+}
+
+// SagaConfig enables the workflows started by consumed events
+type SagaConfig struct {
+	Enabled             bool
+	ProvisioningURLs    []string // systems a new user is provisioned in, in order; none disables the saga
+	ProvisioningEvent   string   // event type that starts user provisioning
+	MaxRetries          int      // per step, after the first attempt
+	RetryInitialBackoff int      // in milliseconds
+	RetryMaxBackoff     int      // in milliseconds
+	StepTimeout         int      // in seconds
+	StaleAfter          int      // in seconds without progress before saga_resume takes an instance over
+}
+
+// EventReplayConfig limits replays of stored events
+type EventReplayConfig struct {
+	MaxEvents int // replays matching more events are refused; 0 means no limit
+	BatchSize int // events read and published per step
+}
+
+// EventBulkConfig limits NDJSON ingestion through /api/v1/events/bulk
+type EventBulkConfig struct {
+	Enabled      bool
+	MaxEvents    int // lines per request; later lines are refused
+	BatchSize    int // events stored per transaction
+	MaxLineBytes int
+}
+
+// ExportConfig enables the dataset exports of /admin/export
+type ExportConfig struct {
+	Enabled   bool
+	BatchSize int // rows read per query and flushed to the client
+}
+
+// EventRetentionConfig removes events older than Days, archiving them first
+type EventRetentionConfig struct {
+	Days           int // 0 disables retention
+	BatchSize      int // events per archive object and DELETE
+	MaxEvents      int // events removed per run; 0 means no limit
+	ArchiveBackend string
+	ArchiveDir     string // for the file backend
+}
+
+// AuditArchiveConfig exports security events, security alerts and the user
+// audit trail to object storage for long-term retention
+type AuditArchiveConfig struct {
+	Enabled    bool
+	Backend    string
+	Dir        string // for the file backend
+	BatchSize  int    // records per archive object
+	LagMinutes int    // records younger than this wait for the next run
+}
+
+// HTTPRecordingConfig records sampled requests and responses with their
+// bodies in http_recordings
+type HTTPRecordingConfig struct {
+	Enabled        bool
+	SampleRate     float64  // share of requests recorded, 0 to 1
+	Routes         []string // route patterns always recorded
+	ExcludedRoutes []string
+	MaxBodyBytes   int
+	RetentionHours int
+	QueueSize      int
+}
+
+// EventStatsConfig enables the hourly rollups behind /api/v1/events/stats
+type EventStatsConfig struct {
+	Enabled       bool
+	LookbackHours int // hours rolled up again on each run, to count events processed late
+}
+
+// EventUsageConfig counts the events each user creates per day in the cache
+// and optionally limits them
+type EventUsageConfig struct {
+	Enabled       bool
+	DailyQuota    int // events per user per UTC day; 0 means no limit
+	RetentionDays int // days of counters kept
+}
+
+// EventUserConfig controls how events reference their users
+type EventUserConfig struct {
+	Validate bool   // refuse events of unknown users with 422 before inserting
+	OnDelete string // ON DELETE action of events.user_id: cascade or restrict
+}
+
+// CircuitBreakerConfig configures the breakers guarding the database, the
+// cache and the message broker
+type CircuitBreakerConfig struct {
+	Enabled          bool
+	FailureThreshold int // consecutive failures that open a breaker
+	OpenTimeout      int // in seconds, before probe calls are let through
+	HalfOpenRequests int // successful probes that close a breaker again
+	CacheTimeout     int // in milliseconds, per cache call; 0 = none
+	PublishTimeout   int // in milliseconds, per broker write; 0 = none
+}
+
+// HTTPClientConfig tunes the clients of outbound HTTP calls (webhooks,
+// alert notifications, OIDC). Their per host breakers use the
+// CircuitBreaker thresholds.
+type HTTPClientConfig struct {
+	Timeout      int // in seconds, per call including retries
+	MaxRetries   int // retries of idempotent requests
+	RetryBackoff int // in milliseconds, before the first retry; doubles after
+	MaxBackoff   int // in milliseconds, between two retries
+}
+
+// LoadSheddingConfig configures the adaptive concurrency limit in front of
+// the API
+type LoadSheddingConfig struct {
+	Enabled       bool
+	MinLimit      int // lowest concurrency limit latency can push it to
+	MaxLimit      int // initial and highest concurrency limit
+	QueueSize     int // requests that may wait for a slot
+	QueueTimeout  int // in milliseconds, how long they wait
+	TargetLatency int // in milliseconds, p99 above which the limit shrinks
+	Window        int // in milliseconds, between limit adjustments
+	RetryAfter    int // in seconds, sent with 503
+}
+
+// BulkheadConfig sizes the concurrency pools of the public API (/api/*) and
+// of the admin routes (/admin)
+type BulkheadConfig struct {
+	Enabled            bool
+	APIMaxConcurrent   int
+	APIQueueSize       int
+	AdminMaxConcurrent int
+	AdminQueueSize     int
+	QueueTimeout       int // in milliseconds
+}
+
+// ReloadConfig configures runtime reloads of the log level, rate limits,
+// DDoS thresholds and CORS origins (see Registry)
+type ReloadConfig struct {
+	WatchInterval int // in seconds, between checks of .env for changes; 0 = SIGHUP only
+}
+
+// StartupConfig bounds how long startup waits for the database, cache and
+// message broker to answer
+type StartupConfig struct {
+	WaitTimeout    int      // in seconds, per dependency; 0 = a single attempt
+	InitialBackoff int      // in milliseconds, doubled after every failed attempt
+	MaxBackoff     int      // in milliseconds
+	Required       []string // dependencies the service can't start without: database, cache, messaging
+}
+
+// IsRequired reports whether the service must not start without dependency
+func (c StartupConfig) IsRequired(dependency string) bool {
+	for _, name := range c.Required {
+		if strings.EqualFold(name, dependency) {
+			return true
+		}
+	}
+	return false
+}
+
+// DiagnosticsConfig enables the pprof and runtime statistics endpoints
+type DiagnosticsConfig struct {
+	Enabled bool
+	// Addr is a separate listener (e.g. 127.0.0.1:6060) serving them without
+	// authentication; when empty they are served under /debug to admins
+	Addr string
+}
+
+// APIVersionConfig announces the retirement of /api/v1 in the Deprecation,
+// Sunset and Link headers of its responses
+type APIVersionConfig struct {
+	V1Deprecation string // RFC 3339 time or date since which v1 is deprecated; empty = not deprecated
+	V1Sunset      string // RFC 3339 time or date after which v1 may be removed
+	V1Link        string // documentation of the successor version
+}
+
+// V1Dates parses V1Deprecation and V1Sunset; unset ones are zero
+func (c APIVersionConfig) V1Dates() (deprecation, sunset time.Time, err error) {
+	if deprecation, err = parseDate(c.V1Deprecation); err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid API_V1_DEPRECATION: %w", err)
+	}
+	if sunset, err = parseDate(c.V1Sunset); err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid API_V1_SUNSET: %w", err)
+	}
+	return deprecation, sunset, nil
+}
+
+// parseDate parses an RFC 3339 time or a 2006-01-02 date (midnight UTC)
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// WebhookConfig configures outbound webhook deliveries
+type WebhookConfig struct {
+	Enabled        bool
+	MaxAttempts    int // attempts before a delivery is marked failed
+	InitialBackoff int // in seconds, doubled per attempt
+	MaxBackoff     int // in seconds
+	Timeout        int // in seconds, per request
+	PollInterval   int // in milliseconds
+	BatchSize      int // deliveries sent concurrently per poll
+}
+
+// OIDCConfig configures login through an OpenID Connect identity provider
+type OIDCConfig struct {
+	Issuer         string // e.g. https://accounts.google.com; empty disables OIDC login
+	ClientID       string
+	ClientSecret   string
+	RedirectURL    string   // public URL of /api/v1/auth/oidc/callback, registered at the provider
+	Scopes         []string // requested besides openid
+	AllowedDomains []string // email domains allowed to log in; empty allows all
+}
+
+// RegistrationConfig enables public self-registration with email verification
+type RegistrationConfig struct {
+	Enabled         bool
+	VerifyURL       string // link sent by email, the token is appended as ?token=
+	TokenSecret     string // signs verification and email change links; empty means JWTSecret
+	TokenTTLHours   int
+	MaxPerIPPerHour int // registration attempts per client IP; 0 means no limit
+}
+
+// InvitationConfig enables invitation links sent by administrators
+type InvitationConfig struct {
+	Enabled   bool
+	AcceptURL string // link sent by email, the token is appended as ?token=
+	TTLHours  int
+}
+
+// ProfileConfig configures PUT /auth/profile. A new email is confirmed by a
+// link signed with Registration.TokenSecret.
+type ProfileConfig struct {
+	EmailChangeEnabled bool
+	EmailConfirmURL    string // link sent to the new email, the token is appended as ?token=
+	EmailTokenTTLHours int
+}
+
+// AvatarConfig configures the /users/:id/avatar endpoints. The s3 backend
+// shares the region, endpoint and addressing style of ARCHIVE_S3_*.
+type AvatarConfig struct {
+	Enabled            bool
+	Backend            string // file or s3
+	Dir                string // for the file backend
+	S3Bucket           string
+	S3Prefix           string
+	MaxBytes           int
+	MaxPixels          int
+	ThumbnailSizes     []int // sides of the square thumbnails, in pixels
+	CacheMaxAgeSeconds int
+}
+
+// MailConfig is the SMTP server of account email: verification links,
+// invitations and email changes; without an address messages are only logged
+type MailConfig struct {
+	SMTPAddr     string // host:port
+	SMTPUsername string
+	SMTPPassword string
+	From         string
+}
+
+// Keys returns the key ring for payload encryption: the active key plus old keys
+func (c EventEncryptionConfig) Keys() (map[string][]byte, error) {
+	keys := map[string][]byte{c.KeyID: c.Key}
+	for _, entry := range c.OldKeys {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid old key entry: expected ID:BASE64")
+		}
+		if id == c.KeyID {
+			return nil, fmt.Errorf("old key %q has the same ID as the active key", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid old key %q: %w", id, err)
+		}
+		keys[id] = key
+	}
+	return keys, nil
 }
 
 type SecurityConfig struct {
@@ -82,7 +790,7 @@ type SecurityConfig struct {
 
 func Load() (*Config, error) {
 	// Load .env file if it exists
-	_ = godotenv.Load()
+	_ = loadEnvFile()
 
 	// Initialize secret manager
 	secretManager, err := NewSecretManager()
@@ -90,38 +798,224 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("failed to initialize secret manager: %w", err)
 	}
 
+	devMode := getEnvAsBool("DEV_MODE", false)
+
 	config := &Config{
+		DevMode: devMode,
 		Server: ServerConfig{
 			Host:    getEnv("SERVER_HOST", "0.0.0.0"),
 			Port:    getEnv("SERVER_PORT", "8080"),
 			TLSCert: getEnv("TLS_CERT", "certs/server.crt"),
 			TLSKey:  getEnv("TLS_KEY", "certs/server.key"),
 			UseTLS:  getEnvAsBool("USE_TLS", false),
+
+			TLSClientAuth:       getEnv("TLS_CLIENT_AUTH", "none"),
+			TLSClientCA:         getEnv("TLS_CLIENT_CA_FILE", ""),
+			TLSClientIdentities: getEnv("TLS_CLIENT_IDENTITIES", ""),
+
+			CompressionEnabled:       getEnvAsBool("COMPRESSION_ENABLED", true),
+			CompressionMinSize:       getEnvAsInt("COMPRESSION_MIN_SIZE", 1024),
+			CompressionLevel:         getEnvAsInt("COMPRESSION_LEVEL", -1),
+			CompressionExcludedPaths: splitList(getEnv("COMPRESSION_EXCLUDED_PATHS", "")),
+
+			RequestTimeout:       getEnvAsInt("REQUEST_TIMEOUT_MS", 8000),
+			RequestTimeoutRoutes: splitList(getEnv("REQUEST_TIMEOUT_ROUTES", "/admin/*=60s,POST /api/*/events/bulk=120s")),
 		},
 		Database: DatabaseConfig{
+			Driver:   getEnv("DB_DRIVER", devDefault(devMode, "sqlite", "postgres")),
 			Host:     getEnv("DB_HOST", "localhost"),
 			Port:     getEnv("DB_PORT", "5432"),
 			User:     getEnv("DB_USER", "postgres"),
 			Password: secretManager.GetSecureEnv("DB_PASSWORD", "postgres"),
-			Name:     getEnv("DB_NAME", "highload_db"),
+			Name:     getEnv("DB_NAME", devDefault(devMode, ":memory:", "highload_db")),
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
+
+			MaxOpenConns:     getEnvAsInt("DB_MAX_OPEN_CONNS", 25),
+			MaxIdleConns:     getEnvAsInt("DB_MAX_IDLE_CONNS", 5),
+			ConnMaxLifetime:  getEnvAsInt("DB_CONN_MAX_LIFETIME_SECONDS", 1800),
+			ConnMaxIdleTime:  getEnvAsInt("DB_CONN_MAX_IDLE_TIME_SECONDS", 300),
+			StatementTimeout: getEnvAsInt("DB_STATEMENT_TIMEOUT_MS", 30000),
+			QueryTimeout:     getEnvAsInt("DB_QUERY_TIMEOUT_MS", 10000),
+
+			MigrateOnStart: getEnvAsBool("DB_MIGRATE_ON_START", true),
+
+			PreparedStatements: getEnvAsBool("DB_PREPARED_STATEMENTS", true),
+
+			ReplicaHost:          getEnv("DB_REPLICA_HOST", ""),
+			ReplicaPort:          getEnv("DB_REPLICA_PORT", getEnv("DB_PORT", "5432")),
+			ReplicaCheckInterval: getEnvAsInt("DB_REPLICA_CHECK_INTERVAL_SECONDS", 5),
 		},
 		Redis: RedisConfig{
 			Host:     getEnv("REDIS_HOST", "localhost"),
 			Port:     getEnv("REDIS_PORT", "6379"),
 			Password: secretManager.GetSecureEnv("REDIS_PASSWORD", ""),
 			DB:       getEnvAsInt("REDIS_DB", 0),
+
+			Mode:             getEnv("REDIS_MODE", "standalone"),
+			Addrs:            splitList(getEnv("REDIS_ADDRS", "")),
+			MasterName:       getEnv("REDIS_SENTINEL_MASTER", ""),
+			SentinelPassword: secretManager.GetSecureEnv("REDIS_SENTINEL_PASSWORD", ""),
+
+			TLSEnabled:    getEnvAsBool("REDIS_TLS_ENABLED", false),
+			TLSCAFile:     getEnv("REDIS_TLS_CA_FILE", ""),
+			TLSCertFile:   getEnv("REDIS_TLS_CERT_FILE", ""),
+			TLSKeyFile:    getEnv("REDIS_TLS_KEY_FILE", ""),
+			TLSServerName: getEnv("REDIS_TLS_SERVER_NAME", ""),
+		},
+		Cache: CacheConfig{
+			Backend:          getEnv("CACHE_BACKEND", devDefault(devMode, "memory", "redis")),
+			MemcachedServers: getEnvAsStringSlice("MEMCACHED_SERVERS", []string{"localhost:11211"}),
+			NegativeTTL:      getEnvAsInt("CACHE_NEGATIVE_TTL_SECONDS", 10),
+			EarlyRefresh:     getEnvAsBool("CACHE_EARLY_REFRESH", false),
+
+			InvalidationTopic: getEnv("CACHE_INVALIDATION_TOPIC", ""),
+			L1Enabled:         getEnvAsBool("CACHE_L1_ENABLED", false),
+			L1Size:            getEnvAsInt("CACHE_L1_SIZE", 10000),
+			L1TTL:             getEnvAsInt("CACHE_L1_TTL_MS", 1000),
+			WarmupEnabled:     getEnvAsBool("CACHE_WARMUP_ENABLED", false),
+			WarmupEvents:      getEnvAsInt("CACHE_WARMUP_EVENTS", 1000),
+			WarmupUsers:       getEnvAsInt("CACHE_WARMUP_USERS", 1000),
+			ListEnabled:       getEnvAsBool("CACHE_LIST_ENABLED", true),
 		},
 		Kafka: KafkaConfig{
 			Brokers: []string{getEnv("KAFKA_BROKERS", "localhost:9092")},
 			Topic:   getEnv("KAFKA_TOPIC", "user-events"),
 			GroupID: getEnv("KAFKA_GROUP_ID", "highload-service"),
+
+			TopicRoutes:  splitList(getEnv("KAFKA_TOPIC_ROUTES", "")),
+			PartitionKey: getEnv("KAFKA_PARTITION_KEY", "user_id"),
+
+			HealthCheckInterval: getEnvAsInt("KAFKA_HEALTH_CHECK_INTERVAL_SECONDS", 15),
+			ReconnectThreshold:  getEnvAsInt("KAFKA_RECONNECT_THRESHOLD", 5),
+			ReconnectMaxBackoff: getEnvAsInt("KAFKA_RECONNECT_MAX_BACKOFF_SECONDS", 30),
+
+			TLSEnabled:    getEnvAsBool("KAFKA_TLS_ENABLED", false),
+			TLSCAFile:     getEnv("KAFKA_TLS_CA_FILE", ""),
+			TLSCA:         getEnv("KAFKA_TLS_CA_PEM", ""),
+			TLSCertFile:   getEnv("KAFKA_TLS_CERT_FILE", ""),
+			TLSCert:       getEnv("KAFKA_TLS_CERT_PEM", ""),
+			TLSKeyFile:    getEnv("KAFKA_TLS_KEY_FILE", ""),
+			TLSKey:        secretManager.GetSecureEnv("KAFKA_TLS_KEY_PEM", ""),
+			TLSServerName: getEnv("KAFKA_TLS_SERVER_NAME", ""),
+
+			SASLMechanism: getEnv("KAFKA_SASL_MECHANISM", ""),
+			SASLUsername:  getEnv("KAFKA_SASL_USERNAME", ""),
+			SASLPassword:  secretManager.GetSecureEnv("KAFKA_SASL_PASSWORD", ""),
+		},
+		Messaging: MessagingConfig{
+			Backend:             getEnv("MESSAGING_BACKEND", devDefault(devMode, "memory", "kafka")),
+			RetryInitialBackoff: getEnvAsInt("CONSUMER_RETRY_INITIAL_BACKOFF_MS", 200),
+			RetryMaxBackoff:     getEnvAsInt("CONSUMER_RETRY_MAX_BACKOFF_MS", 30000),
+			HandlerTimeout:      getEnvAsInt("CONSUMER_HANDLER_TIMEOUT_SECONDS", 30),
+			ShutdownTimeout:     getEnvAsInt("CONSUMER_SHUTDOWN_TIMEOUT_SECONDS", 20),
+			Concurrency:         getEnvAsInt("CONSUMER_CONCURRENCY", 1),
+			LaneQueueSize:       getEnvAsInt("CONSUMER_LANE_QUEUE_SIZE", 16),
+			DedupBackend:        getEnv("CONSUMER_DEDUP_BACKEND", "cache"),
+			DedupTTLHours:       getEnvAsInt("CONSUMER_DEDUP_TTL_HOURS", 24),
+			DedupLeaseSeconds:   getEnvAsInt("CONSUMER_DEDUP_LEASE_SECONDS", 300),
+			AsyncProduce:        getEnvAsBool("PRODUCER_ASYNC_ENABLED", false),
+			AsyncBufferSize:     getEnvAsInt("PRODUCER_ASYNC_BUFFER_SIZE", 10000),
+			AsyncWorkers:        getEnvAsInt("PRODUCER_ASYNC_WORKERS", 4),
+			AsyncSendTimeout:    getEnvAsInt("PRODUCER_ASYNC_SEND_TIMEOUT_SECONDS", 10),
+			AsyncFlushTimeout:   getEnvAsInt("PRODUCER_ASYNC_FLUSH_TIMEOUT_SECONDS", 10),
+		},
+		SQS: SQSConfig{
+			Region:            getEnv("AWS_REGION", "us-east-1"),
+			Endpoint:          getEnv("AWS_ENDPOINT_URL", ""),
+			TopicARN:          getEnv("SNS_TOPIC_ARN", ""),
+			QueueURL:          getEnv("SQS_QUEUE_URL", ""),
+			DLQURL:            getEnv("SQS_DLQ_URL", ""),
+			VisibilityTimeout: getEnvAsInt("SQS_VISIBILITY_TIMEOUT", 30),
+			WaitTimeSeconds:   getEnvAsInt("SQS_WAIT_TIME_SECONDS", 20),
+			MaxReceiveCount:   getEnvAsInt("SQS_MAX_RECEIVE_COUNT", 5),
+		},
+		NATS: NATSConfig{
+			URL:           getEnv("NATS_URL", "nats://localhost:4222"),
+			Username:      getEnv("NATS_USERNAME", ""),
+			Password:      secretManager.GetSecureEnv("NATS_PASSWORD", ""),
+			Stream:        getEnv("NATS_STREAM", "EVENTS"),
+			SubjectPrefix: getEnv("NATS_SUBJECT_PREFIX", "events"),
+			Durable:       getEnv("NATS_DURABLE", "highload-microservice"),
+			AckWait:       getEnvAsInt("NATS_ACK_WAIT_SECONDS", 30),
+			MaxDeliver:    getEnvAsInt("NATS_MAX_DELIVER", -1),
+			FetchBatch:    getEnvAsInt("NATS_FETCH_BATCH", 10),
+			FetchWait:     getEnvAsInt("NATS_FETCH_WAIT_SECONDS", 5),
+		},
+		RabbitMQ: RabbitMQConfig{
+			URL:                getEnv("RABBITMQ_URL", "amqp://localhost:5672/"),
+			Username:           getEnv("RABBITMQ_USERNAME", ""),
+			Password:           secretManager.GetSecureEnv("RABBITMQ_PASSWORD", ""),
+			Exchange:           getEnv("RABBITMQ_EXCHANGE", "events"),
+			Queue:              getEnv("RABBITMQ_QUEUE", "highload-microservice.events"),
+			BindingKey:         getEnv("RABBITMQ_BINDING_KEY", "#"),
+			Prefetch:           getEnvAsInt("RABBITMQ_PREFETCH", 32),
+			DeadLetterExchange: getEnv("RABBITMQ_DEAD_LETTER_EXCHANGE", ""),
+		},
+		Outbox: OutboxConfig{
+			Enabled:        getEnvAsBool("OUTBOX_ENABLED", false),
+			Publisher:      getEnv("OUTBOX_PUBLISHER", "relay"),
+			PollInterval:   getEnvAsInt("OUTBOX_POLL_INTERVAL_MS", 1000),
+			BatchSize:      getEnvAsInt("OUTBOX_BATCH_SIZE", 100),
+			RetentionHours: getEnvAsInt("OUTBOX_RETENTION_HOURS", 24),
+		},
+		Worker: WorkerConfig{
+			PoolSize:            getEnvAsInt("WORKER_POOL_SIZE", 10),
+			QueueSize:           getEnvAsInt("WORKER_QUEUE_SIZE", 100),
+			RetryInitialBackoff: getEnvAsInt("WORKER_RETRY_INITIAL_BACKOFF_MS", 100),
+			RetryMaxBackoff:     getEnvAsInt("WORKER_RETRY_MAX_BACKOFF_MS", 30000),
+		},
+		Scheduler: SchedulerConfig{
+			Enabled:              getEnvAsBool("SCHEDULER_ENABLED", true),
+			RefreshTokenCleanup:  getEnv("SCHEDULE_REFRESH_TOKEN_CLEANUP", "0 * * * *"),
+			APIKeyExpiry:         getEnv("SCHEDULE_API_KEY_EXPIRY", "*/5 * * * *"),
+			SecurityStats:        getEnv("SCHEDULE_SECURITY_STATS", "*/5 * * * *"),
+			EventStats:           getEnv("SCHEDULE_EVENT_STATS", "*/5 * * * *"),
+			EventRetention:       getEnv("SCHEDULE_EVENT_RETENTION", "30 3 * * *"),
+			AuditArchive:         getEnv("SCHEDULE_AUDIT_ARCHIVE", "15 * * * *"),
+			HTTPRecordingPurge:   getEnv("SCHEDULE_HTTP_RECORDING_PURGE", "45 * * * *"),
+			ProcessedEventsPurge: getEnv("SCHEDULE_PROCESSED_EVENTS_PURGE", "50 * * * *"),
+			OutboxPurge:          getEnv("SCHEDULE_OUTBOX_PURGE", "55 * * * *"),
+			SagaResume:           getEnv("SCHEDULE_SAGA_RESUME", "* * * * *"),
 		},
 		Auth: AuthConfig{
 			JWTSecret:         secretManager.GetSecureEnv("JWT_SECRET", "your-super-secret-jwt-key-change-in-production"),
 			JWTExpiration:     getEnvAsInt("JWT_EXPIRATION_HOURS", 24),
 			RefreshExpiration: getEnvAsInt("REFRESH_EXPIRATION_DAYS", 7),
 			APIKeyLength:      getEnvAsInt("API_KEY_LENGTH", 32),
+			APIKeyGrace:       getEnvAsInt("API_KEY_ROTATION_GRACE_MINUTES", 60),
+
+			JWTKeyID:       getEnv("JWT_KEY_ID", "default"),
+			JWTActiveKeyID: getEnv("JWT_ACTIVE_KEY_ID", ""),
+			JWTHMACKeys:    splitList(secretManager.GetSecureEnv("JWT_HMAC_KEYS", "")),
+			JWTKeyFiles:    splitList(getEnv("JWT_KEY_FILES", "")),
+
+			LoginThrottleFreeAttempts: getEnvAsInt("LOGIN_THROTTLE_FREE_ATTEMPTS", 3),
+			LoginThrottleBaseDelay:    getEnvAsInt("LOGIN_THROTTLE_BASE_DELAY_SECONDS", 1),
+			LoginThrottleMaxDelay:     getEnvAsInt("LOGIN_THROTTLE_MAX_DELAY_SECONDS", 900),
+			LoginThrottleWindow:       getEnvAsInt("LOGIN_THROTTLE_WINDOW_MINUTES", 60),
+
+			LockoutMaxAttempts: getEnvAsInt("AUTH_LOCKOUT_MAX_ATTEMPTS", 10),
+			LockoutWindow:      getEnvAsInt("AUTH_LOCKOUT_WINDOW_MINUTES", 15),
+			LockoutDuration:    getEnvAsInt("AUTH_LOCKOUT_DURATION_MINUTES", 30),
+
+			PasswordMinLength:      getEnvAsInt("PASSWORD_MIN_LENGTH", 8),
+			PasswordMaxLength:      getEnvAsInt("PASSWORD_MAX_LENGTH", 72),
+			PasswordRequireUpper:   getEnvAsBool("PASSWORD_REQUIRE_UPPER", false),
+			PasswordRequireLower:   getEnvAsBool("PASSWORD_REQUIRE_LOWER", false),
+			PasswordRequireDigit:   getEnvAsBool("PASSWORD_REQUIRE_DIGIT", false),
+			PasswordRequireSpecial: getEnvAsBool("PASSWORD_REQUIRE_SPECIAL", false),
+			PasswordMinClasses:     getEnvAsInt("PASSWORD_MIN_CHAR_CLASSES", 3),
+			PasswordCheckBanned:    getEnvAsBool("PASSWORD_CHECK_BANNED", true),
+			PasswordBannedListFile: getEnv("PASSWORD_BANNED_LIST_FILE", ""),
+			PasswordCheckUserInfo:  getEnvAsBool("PASSWORD_CHECK_USER_INFO", true),
+			PasswordMaxAgeDays:     getEnvAsInt("PASSWORD_MAX_AGE_DAYS", 0),
+
+			Permissions: getEnv("RBAC_PERMISSIONS", ""),
+
+			SessionMode:    getEnv("AUTH_SESSION_MODE", "bearer"),
+			CookieDomain:   getEnv("AUTH_COOKIE_DOMAIN", ""),
+			CookieSecure:   getEnvAsBool("AUTH_COOKIE_SECURE", true),
+			CookieSameSite: getEnv("AUTH_COOKIE_SAMESITE", "lax"),
 		},
 		RateLimit: RateLimitConfig{
 			Enabled:               getEnvAsBool("RATE_LIMIT_ENABLED", true),
@@ -129,12 +1023,30 @@ func Load() (*Config, error) {
 			BurstSize:             getEnvAsInt("RATE_LIMIT_BURST_SIZE", 10),
 			AuthRequestsPerMinute: getEnvAsInt("RATE_LIMIT_AUTH_REQUESTS_PER_MINUTE", 5),
 			AuthBurstSize:         getEnvAsInt("RATE_LIMIT_AUTH_BURST_SIZE", 2),
+			ExemptCIDRs:           getEnvAsStringSlice("RATE_LIMIT_EXEMPT_CIDRS", []string{}),
+			ExemptAPIKeys:         splitList(secretManager.GetSecureEnv("RATE_LIMIT_EXEMPT_API_KEYS", "")),
+			ExemptRoles:           getEnvAsStringSlice("RATE_LIMIT_EXEMPT_ROLES", []string{}),
+			// RATE_LIMIT_ROUTES is the former name of RATE_LIMIT_POLICIES
+			Policies: getEnvAsStringSlice("RATE_LIMIT_POLICIES", getEnvAsStringSlice("RATE_LIMIT_ROUTES", []string{"/api/*/auth/*=5/15m"})),
+		},
+		DDoS: DDoSConfig{
+			Backend:         getEnv("DDOS_BACKEND", "memory"),
+			KeyPrefix:       getEnv("DDOS_REDIS_KEY_PREFIX", "ddos:"),
+			MaxBlockMinutes: getEnvAsInt("DDOS_MAX_BLOCK_MINUTES", 1440),
+			OffenseTTLHours: getEnvAsInt("DDOS_OFFENSE_TTL_HOURS", 24),
+			MaxRequests:     getEnvAsInt("DDOS_MAX_REQUESTS", 100),
+			WindowSeconds:   getEnvAsInt("DDOS_WINDOW_SECONDS", 60),
+			BlockMinutes:    getEnvAsInt("DDOS_BLOCK_MINUTES", 5),
+		},
+		IPRules: IPRulesConfig{
+			Enabled:         getEnvAsBool("IP_RULES_ENABLED", true),
+			RefreshInterval: getEnvAsInt("IP_RULES_REFRESH_SECONDS", 30),
 		},
 		Security: SecurityConfig{
 			AllowedOrigins:        getEnvAsStringSlice("CORS_ALLOWED_ORIGINS", []string{"https://localhost:3000", "https://127.0.0.1:3000"}),
 			AllowedMethods:        getEnvAsStringSlice("CORS_ALLOWED_METHODS", []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "HEAD"}),
-			AllowedHeaders:        getEnvAsStringSlice("CORS_ALLOWED_HEADERS", []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With", "X-Request-ID", "X-API-Key"}),
-			ExposedHeaders:        getEnvAsStringSlice("CORS_EXPOSED_HEADERS", []string{"X-Request-ID", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"}),
+			AllowedHeaders:        getEnvAsStringSlice("CORS_ALLOWED_HEADERS", []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With", "X-Request-ID", "X-API-Key", "X-CSRF-Token", "If-None-Match", "If-Modified-Since"}),
+			ExposedHeaders:        getEnvAsStringSlice("CORS_EXPOSED_HEADERS", []string{"X-Request-ID", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "ETag", "Last-Modified"}),
 			AllowCredentials:      getEnvAsBool("CORS_ALLOW_CREDENTIALS", true),
 			MaxAge:                getEnvAsInt("CORS_MAX_AGE", 86400),
 			ContentTypeNosniff:    getEnvAsBool("SECURITY_CONTENT_TYPE_NOSNIFF", true),
@@ -144,7 +1056,261 @@ func Load() (*Config, error) {
 			PermissionsPolicy:     getEnv("SECURITY_PERMISSIONS_POLICY", "geolocation=(), microphone=(), camera=()"),
 			ContentSecurityPolicy: getEnv("SECURITY_CSP", "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; img-src 'self' data: https:; font-src 'self' data:; connect-src 'self'; frame-ancestors 'none'; base-uri 'self'; form-action 'self';"),
 		},
+		Audit: AuditConfig{
+			Persist:       getEnvAsBool("SECURITY_EVENTS_PERSIST", true),
+			BatchSize:     getEnvAsInt("SECURITY_EVENTS_BATCH_SIZE", 100),
+			FlushInterval: getEnvAsInt("SECURITY_EVENTS_FLUSH_INTERVAL_MS", 1000),
+			QueueSize:     getEnvAsInt("SECURITY_EVENTS_QUEUE_SIZE", 10000),
+		},
+		ArchiveS3: ArchiveS3Config{
+			Bucket:       getEnv("ARCHIVE_S3_BUCKET", ""),
+			Prefix:       getEnv("ARCHIVE_S3_PREFIX", ""),
+			Region:       getEnv("ARCHIVE_S3_REGION", getEnv("AWS_REGION", "us-east-1")),
+			Endpoint:     getEnv("ARCHIVE_S3_ENDPOINT", ""),
+			PathStyle:    getEnvAsBool("ARCHIVE_S3_PATH_STYLE", false),
+			StorageClass: getEnv("ARCHIVE_S3_STORAGE_CLASS", ""),
+		},
+		Anomaly: AnomalyConfig{
+			Enabled:            getEnvAsBool("ANOMALY_DETECTION_ENABLED", true),
+			WindowSeconds:      getEnvAsInt("ANOMALY_WINDOW_SECONDS", 60),
+			MinBaselineWindows: getEnvAsInt("ANOMALY_MIN_BASELINE_WINDOWS", 10),
+			MinRequests:        getEnvAsInt("ANOMALY_MIN_REQUESTS", 20),
+			ZScore:             getEnvAsFloat("ANOMALY_Z_SCORE", 3),
+			RateFactor:         getEnvAsFloat("ANOMALY_RATE_FACTOR", 5),
+			FanOutFactor:       getEnvAsFloat("ANOMALY_FAN_OUT_FACTOR", 5),
+			ErrorRateFactor:    getEnvAsFloat("ANOMALY_ERROR_RATE_FACTOR", 3),
+			UnauthorizedFactor: getEnvAsFloat("ANOMALY_UNAUTHORIZED_FACTOR", 5),
+		},
+		GeoIP: GeoIPConfig{
+			LocationDB: getEnv("GEOIP_LOCATION_DB", ""),
+			ASNDB:      getEnv("GEOIP_ASN_DB", ""),
+		},
+		Alerting: AlertingConfig{
+			SlackWebhookURL:     secretManager.GetSecureEnv("ALERT_SLACK_WEBHOOK_URL", ""),
+			PagerDutyRoutingKey: secretManager.GetSecureEnv("ALERT_PAGERDUTY_ROUTING_KEY", ""),
+			WebhookURL:          getEnv("ALERT_WEBHOOK_URL", ""),
+			WebhookSecret:       secretManager.GetSecureEnv("ALERT_WEBHOOK_SECRET", ""),
+			SMTPAddr:            getEnv("ALERT_SMTP_ADDR", ""),
+			SMTPUsername:        getEnv("ALERT_SMTP_USERNAME", ""),
+			SMTPPassword:        secretManager.GetSecureEnv("ALERT_SMTP_PASSWORD", ""),
+			EmailFrom:           getEnv("ALERT_EMAIL_FROM", ""),
+			EmailTo:             splitList(getEnv("ALERT_EMAIL_TO", "")),
+			Routes:              getEnv("ALERT_ROUTES", ""),
+			RatePerMinute:       getEnvAsInt("ALERT_RATE_LIMIT_PER_MINUTE", 10),
+			MaxAttempts:         getEnvAsInt("ALERT_MAX_ATTEMPTS", 3),
+			Timeout:             getEnvAsInt("ALERT_TIMEOUT_SECONDS", 10),
+		},
+		SIEM: SIEMConfig{
+			Address:     getEnv("SIEM_ADDRESS", ""),
+			Network:     getEnv("SIEM_NETWORK", "tls"),
+			Format:      getEnv("SIEM_FORMAT", "cef"),
+			MinSeverity: getEnv("SIEM_MIN_SEVERITY", "medium"),
+			Alerts:      getEnvAsBool("SIEM_ALERTS", true),
+			TLSCAFile:   getEnv("SIEM_TLS_CA_FILE", ""),
+			Hostname:    getEnv("SIEM_HOSTNAME", ""),
+			QueueSize:   getEnvAsInt("SIEM_QUEUE_SIZE", 10000),
+			Timeout:     getEnvAsInt("SIEM_TIMEOUT_SECONDS", 10),
+		},
 		LogLevel: getEnv("LOG_LEVEL", "info"),
+		Redaction: RedactionConfig{
+			Patterns:    getEnvAsStringSlice("REDACT_PATTERNS", []string{"email", "token", "card", "password"}),
+			Fields:      getEnvAsStringSlice("REDACT_FIELDS", []string{"password", "token", "access_token", "refresh_token", "authorization", "api_key", "secret"}),
+			AllowFields: getEnvAsStringSlice("REDACT_ALLOW_FIELDS", []string{"id", "request_id", "trace_id", "span_id", "user_id", "event_id"}),
+		},
+		EventEncryption: EventEncryptionConfig{
+			EventTypes:  splitList(getEnv("EVENT_ENCRYPTION_TYPES", "")),
+			KeyID:       getEnv("EVENT_ENCRYPTION_KEY_ID", "k1"),
+			Key:         secretManager.Key(),
+			KeyProvided: os.Getenv("ENCRYPTION_KEY") != "",
+			OldKeys:     splitList(secretManager.GetSecureEnv("EVENT_ENCRYPTION_OLD_KEYS", "")),
+			ReaderRoles: getEnvAsStringSlice("EVENT_ENCRYPTION_READER_ROLES", []string{"admin"}),
+		},
+		UserEncryption: UserEncryptionConfig{
+			Enabled:  getEnvAsBool("USER_ENCRYPTION_ENABLED", false),
+			IndexKey: secretManager.GetSecureEnv("USER_ENCRYPTION_INDEX_KEY", ""),
+		},
+		EventSchemas: EventSchemaConfig{
+			Dir:             getEnv("EVENT_SCHEMA_DIR", ""),
+			RefreshInterval: getEnvAsInt("EVENT_SCHEMA_REFRESH_SECONDS", 30),
+			InvalidAction:   getEnv("EVENT_SCHEMA_INVALID_ACTION", "reject"),
+			DLQTopic:        getEnv("EVENT_SCHEMA_DLQ_TOPIC", "events.invalid"),
+		},
+		EventTypes: EventTypeConfig{
+			Enabled:         getEnvAsBool("EVENT_TYPES_ENABLED", true),
+			Strict:          getEnvAsBool("EVENT_TYPES_STRICT", false),
+			RefreshInterval: getEnvAsInt("EVENT_TYPES_REFRESH_SECONDS", 30),
+		},
+		EventHandlers: EventHandlerConfig{
+			Enabled:             getEnvAsBool("EVENT_HANDLERS_ENABLED", true),
+			Disabled:            getEnvAsStringSlice("EVENT_HANDLERS_DISABLED", nil),
+			MaxRetries:          getEnvAsInt("EVENT_HANDLER_MAX_RETRIES", 3),
+			RetryInitialBackoff: getEnvAsInt("EVENT_HANDLER_RETRY_INITIAL_BACKOFF_MS", 100),
+			RetryMaxBackoff:     getEnvAsInt("EVENT_HANDLER_RETRY_MAX_BACKOFF_MS", 2000),
+			RefreshInterval:     getEnvAsInt("EVENT_HANDLERS_REFRESH_SECONDS", 30),
+		},
+		Sagas: SagaConfig{
+			Enabled:             getEnvAsBool("SAGAS_ENABLED", false),
+			ProvisioningURLs:    getEnvAsStringSlice("SAGA_USER_PROVISIONING_URLS", nil),
+			ProvisioningEvent:   getEnv("SAGA_USER_PROVISIONING_EVENT", "user_created"),
+			MaxRetries:          getEnvAsInt("SAGA_STEP_MAX_RETRIES", 3),
+			RetryInitialBackoff: getEnvAsInt("SAGA_RETRY_INITIAL_BACKOFF_MS", 500),
+			RetryMaxBackoff:     getEnvAsInt("SAGA_RETRY_MAX_BACKOFF_MS", 30000),
+			StepTimeout:         getEnvAsInt("SAGA_STEP_TIMEOUT_SECONDS", 30),
+			StaleAfter:          getEnvAsInt("SAGA_STALE_AFTER_SECONDS", 300),
+		},
+		OIDC: OIDCConfig{
+			Issuer:         getEnv("OIDC_ISSUER", ""),
+			ClientID:       getEnv("OIDC_CLIENT_ID", ""),
+			ClientSecret:   secretManager.GetSecureEnv("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:    getEnv("OIDC_REDIRECT_URL", ""),
+			Scopes:         getEnvAsStringSlice("OIDC_SCOPES", []string{"email", "profile"}),
+			AllowedDomains: splitList(getEnv("OIDC_ALLOWED_DOMAINS", "")),
+		},
+		Registration: RegistrationConfig{
+			Enabled:         getEnvAsBool("REGISTRATION_ENABLED", false),
+			VerifyURL:       getEnv("REGISTRATION_VERIFY_URL", "http://localhost:8080/api/v1/auth/verify"),
+			TokenSecret:     secretManager.GetSecureEnv("REGISTRATION_TOKEN_SECRET", ""),
+			TokenTTLHours:   getEnvAsInt("REGISTRATION_TOKEN_TTL_HOURS", 24),
+			MaxPerIPPerHour: getEnvAsInt("REGISTRATION_MAX_PER_IP_PER_HOUR", 5),
+		},
+		Invitations: InvitationConfig{
+			Enabled:   getEnvAsBool("INVITATIONS_ENABLED", true),
+			AcceptURL: getEnv("INVITATION_ACCEPT_URL", "http://localhost:8080/accept-invite"),
+			TTLHours:  getEnvAsInt("INVITATION_TTL_HOURS", 72),
+		},
+		Profile: ProfileConfig{
+			EmailChangeEnabled: getEnvAsBool("PROFILE_EMAIL_CHANGE_ENABLED", true),
+			EmailConfirmURL:    getEnv("PROFILE_EMAIL_CONFIRM_URL", "http://localhost:8080/api/v1/auth/profile/email/confirm"),
+			EmailTokenTTLHours: getEnvAsInt("PROFILE_EMAIL_TOKEN_TTL_HOURS", 24),
+		},
+		Avatars: AvatarConfig{
+			Enabled:            getEnvAsBool("AVATARS_ENABLED", true),
+			Backend:            getEnv("AVATAR_STORAGE_BACKEND", "file"),
+			Dir:                getEnv("AVATAR_STORAGE_DIR", "./data/avatars"),
+			S3Bucket:           getEnv("AVATAR_S3_BUCKET", getEnv("ARCHIVE_S3_BUCKET", "")),
+			S3Prefix:           getEnv("AVATAR_S3_PREFIX", "avatars"),
+			MaxBytes:           getEnvAsInt("AVATAR_MAX_BYTES", 5<<20),
+			MaxPixels:          getEnvAsInt("AVATAR_MAX_PIXELS", 25000000),
+			ThumbnailSizes:     getEnvAsIntSlice("AVATAR_THUMBNAIL_SIZES", []int{64, 256}),
+			CacheMaxAgeSeconds: getEnvAsInt("AVATAR_CACHE_MAX_AGE_SECONDS", 3600),
+		},
+		Mail: MailConfig{
+			SMTPAddr:     getEnv("MAIL_SMTP_ADDR", ""),
+			SMTPUsername: getEnv("MAIL_SMTP_USERNAME", ""),
+			SMTPPassword: secretManager.GetSecureEnv("MAIL_SMTP_PASSWORD", ""),
+			From:         getEnv("MAIL_FROM", "no-reply@localhost"),
+		},
+		EventReplay: EventReplayConfig{
+			MaxEvents: getEnvAsInt("EVENT_REPLAY_MAX_EVENTS", 1000000),
+			BatchSize: getEnvAsInt("EVENT_REPLAY_BATCH_SIZE", 500),
+		},
+		EventBulk: EventBulkConfig{
+			Enabled:      getEnvAsBool("EVENT_BULK_ENABLED", true),
+			MaxEvents:    getEnvAsInt("EVENT_BULK_MAX_EVENTS", 10000),
+			BatchSize:    getEnvAsInt("EVENT_BULK_BATCH_SIZE", 500),
+			MaxLineBytes: getEnvAsInt("EVENT_BULK_MAX_LINE_BYTES", 16384),
+		},
+		EventRetention: EventRetentionConfig{
+			Days:           getEnvAsInt("EVENT_RETENTION_DAYS", 0),
+			BatchSize:      getEnvAsInt("EVENT_RETENTION_BATCH_SIZE", 1000),
+			MaxEvents:      getEnvAsInt("EVENT_RETENTION_MAX_EVENTS", 1000000),
+			ArchiveBackend: getEnv("EVENT_ARCHIVE_BACKEND", "file"),
+			ArchiveDir:     getEnv("EVENT_ARCHIVE_DIR", "./archive"),
+		},
+		Export: ExportConfig{
+			Enabled:   getEnvAsBool("EXPORT_ENABLED", true),
+			BatchSize: getEnvAsInt("EXPORT_BATCH_SIZE", 1000),
+		},
+		AuditArchive: AuditArchiveConfig{
+			Enabled:    getEnvAsBool("AUDIT_ARCHIVE_ENABLED", false),
+			Backend:    getEnv("AUDIT_ARCHIVE_BACKEND", "s3"),
+			Dir:        getEnv("AUDIT_ARCHIVE_DIR", "./archive"),
+			BatchSize:  getEnvAsInt("AUDIT_ARCHIVE_BATCH_SIZE", 50000),
+			LagMinutes: getEnvAsInt("AUDIT_ARCHIVE_LAG_MINUTES", 10),
+		},
+		HTTPRecording: HTTPRecordingConfig{
+			Enabled:    getEnvAsBool("HTTP_RECORDING_ENABLED", false),
+			SampleRate: getEnvAsFloat("HTTP_RECORDING_SAMPLE_RATE", 0.01),
+			Routes:     getEnvAsStringSlice("HTTP_RECORDING_ROUTES", []string{"/admin/*"}),
+			ExcludedRoutes: getEnvAsStringSlice("HTTP_RECORDING_EXCLUDED_ROUTES", []string{
+				"/health*", "/readyz", "/metrics", "/debug/*", "/admin/security/recordings*", "/admin/ui*",
+			}),
+			MaxBodyBytes:   getEnvAsInt("HTTP_RECORDING_MAX_BODY_BYTES", 16384),
+			RetentionHours: getEnvAsInt("HTTP_RECORDING_RETENTION_HOURS", 72),
+			QueueSize:      getEnvAsInt("HTTP_RECORDING_QUEUE_SIZE", 1000),
+		},
+		EventStats: EventStatsConfig{
+			Enabled:       getEnvAsBool("EVENT_STATS_ENABLED", false),
+			LookbackHours: getEnvAsInt("EVENT_STATS_LOOKBACK_HOURS", 2),
+		},
+		EventUsage: EventUsageConfig{
+			Enabled:       getEnvAsBool("EVENT_USAGE_ENABLED", true),
+			DailyQuota:    getEnvAsInt("EVENT_DAILY_QUOTA", 0),
+			RetentionDays: getEnvAsInt("EVENT_USAGE_RETENTION_DAYS", 30),
+		},
+		EventUsers: EventUserConfig{
+			Validate: getEnvAsBool("EVENT_VALIDATE_USERS", true),
+			OnDelete: strings.ToLower(getEnv("EVENT_USER_ON_DELETE", "cascade")),
+		},
+		CircuitBreaker: CircuitBreakerConfig{
+			Enabled:          getEnvAsBool("CIRCUIT_BREAKER_ENABLED", true),
+			FailureThreshold: getEnvAsInt("CIRCUIT_BREAKER_FAILURE_THRESHOLD", 5),
+			OpenTimeout:      getEnvAsInt("CIRCUIT_BREAKER_OPEN_SECONDS", 30),
+			HalfOpenRequests: getEnvAsInt("CIRCUIT_BREAKER_HALF_OPEN_REQUESTS", 1),
+			CacheTimeout:     getEnvAsInt("CACHE_TIMEOUT_MS", 500),
+			PublishTimeout:   getEnvAsInt("PRODUCER_TIMEOUT_MS", 10000),
+		},
+		HTTPClient: HTTPClientConfig{
+			Timeout:      getEnvAsInt("HTTP_CLIENT_TIMEOUT_SECONDS", 10),
+			MaxRetries:   getEnvAsInt("HTTP_CLIENT_MAX_RETRIES", 2),
+			RetryBackoff: getEnvAsInt("HTTP_CLIENT_RETRY_BACKOFF_MS", 100),
+			MaxBackoff:   getEnvAsInt("HTTP_CLIENT_MAX_BACKOFF_MS", 2000),
+		},
+		LoadShedding: LoadSheddingConfig{
+			Enabled:       getEnvAsBool("LOAD_SHEDDING_ENABLED", true),
+			MinLimit:      getEnvAsInt("LOAD_SHEDDING_MIN_LIMIT", 16),
+			MaxLimit:      getEnvAsInt("LOAD_SHEDDING_MAX_LIMIT", 512),
+			QueueSize:     getEnvAsInt("LOAD_SHEDDING_QUEUE_SIZE", 256),
+			QueueTimeout:  getEnvAsInt("LOAD_SHEDDING_QUEUE_TIMEOUT_MS", 500),
+			TargetLatency: getEnvAsInt("LOAD_SHEDDING_TARGET_P99_MS", 1000),
+			Window:        getEnvAsInt("LOAD_SHEDDING_WINDOW_MS", 1000),
+			RetryAfter:    getEnvAsInt("LOAD_SHEDDING_RETRY_AFTER_SECONDS", 1),
+		},
+		Startup: StartupConfig{
+			WaitTimeout:    getEnvAsInt("STARTUP_WAIT_TIMEOUT_SECONDS", 60),
+			InitialBackoff: getEnvAsInt("STARTUP_INITIAL_BACKOFF_MS", 500),
+			MaxBackoff:     getEnvAsInt("STARTUP_MAX_BACKOFF_MS", 5000),
+			Required:       getEnvAsStringSlice("STARTUP_REQUIRED_DEPENDENCIES", []string{"database", "cache", "messaging"}),
+		},
+		Reload: ReloadConfig{
+			WatchInterval: getEnvAsInt("CONFIG_WATCH_INTERVAL_SECONDS", 10),
+		},
+		Diagnostics: DiagnosticsConfig{
+			Enabled: getEnvAsBool("DIAGNOSTICS_ENABLED", false),
+			Addr:    getEnv("DIAGNOSTICS_ADDR", ""),
+		},
+		APIVersions: APIVersionConfig{
+			V1Deprecation: getEnv("API_V1_DEPRECATION", ""),
+			V1Sunset:      getEnv("API_V1_SUNSET", ""),
+			V1Link:        getEnv("API_V1_LINK", "/api/v2"),
+		},
+		Bulkheads: BulkheadConfig{
+			Enabled:            getEnvAsBool("BULKHEADS_ENABLED", true),
+			APIMaxConcurrent:   getEnvAsInt("BULKHEAD_API_MAX_CONCURRENT", 400),
+			APIQueueSize:       getEnvAsInt("BULKHEAD_API_QUEUE_SIZE", 200),
+			AdminMaxConcurrent: getEnvAsInt("BULKHEAD_ADMIN_MAX_CONCURRENT", 32),
+			AdminQueueSize:     getEnvAsInt("BULKHEAD_ADMIN_QUEUE_SIZE", 32),
+			QueueTimeout:       getEnvAsInt("BULKHEAD_QUEUE_TIMEOUT_MS", 1000),
+		},
+		Webhooks: WebhookConfig{
+			Enabled:        getEnvAsBool("WEBHOOKS_ENABLED", false),
+			MaxAttempts:    getEnvAsInt("WEBHOOK_MAX_ATTEMPTS", 8),
+			InitialBackoff: getEnvAsInt("WEBHOOK_RETRY_INITIAL_BACKOFF_SECONDS", 10),
+			MaxBackoff:     getEnvAsInt("WEBHOOK_RETRY_MAX_BACKOFF_SECONDS", 3600),
+			Timeout:        getEnvAsInt("WEBHOOK_TIMEOUT_SECONDS", 10),
+			PollInterval:   getEnvAsInt("WEBHOOK_POLL_INTERVAL_MS", 1000),
+			BatchSize:      getEnvAsInt("WEBHOOK_BATCH_SIZE", 50),
+		},
 	}
 
 	return config, nil
@@ -166,6 +1332,15 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getEnvAsBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
@@ -181,3 +1356,37 @@ func getEnvAsStringSlice(key string, defaultValue []string) []string {
 	}
 	return defaultValue
 }
+
+// devDefault returns the default of a variable in DEV_MODE or otherwise
+func devDefault(devMode bool, dev, prod string) string {
+	if devMode {
+		return dev
+	}
+	return prod
+}
+
+// getEnvAsIntSlice parses a comma-separated list of positive integers,
+// falling back to defaultValue if any entry is invalid
+func getEnvAsIntSlice(key string, defaultValue []int) []int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	var ints []int
+	for _, part := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n <= 0 {
+			return defaultValue
+		}
+		ints = append(ints, n)
+	}
+	return ints
+}
+
+// splitList splits a comma-separated value, returning nil for an empty string
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
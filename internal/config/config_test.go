@@ -22,3 +22,20 @@ func TestLoad_Defaults(t *testing.T) {
 		t.Fatalf("unexpected server port: %s", cfg.Server.Port)
 	}
 }
+
+func TestLoad_DevMode(t *testing.T) {
+	t.Setenv("DEV_MODE", "true")
+	t.Setenv("CACHE_BACKEND", "redis")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	if cfg.Database.Driver != "sqlite" || cfg.Database.Name != ":memory:" || cfg.Messaging.Backend != "memory" {
+		t.Fatalf("unexpected dev mode defaults: %+v, messaging %s", cfg.Database, cfg.Messaging.Backend)
+	}
+	if cfg.Cache.Backend != "redis" {
+		t.Fatalf("explicit CACHE_BACKEND overridden: %s", cfg.Cache.Backend)
+	}
+}
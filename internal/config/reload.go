@@ -0,0 +1,154 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// EnvFile is the optional file of environment variables read by Load
+const EnvFile = ".env"
+
+// fileEnv tracks the variables set from EnvFile, so that a reload can change
+// or remove them while variables of the real environment keep precedence
+var fileEnv = struct {
+	sync.Mutex
+	keys map[string]bool
+}{keys: make(map[string]bool)}
+
+// loadEnvFile applies EnvFile to the environment. Variables already set
+// outside the file are left alone; variables it set earlier and no longer
+// contains are unset.
+func loadEnvFile() error {
+	vars, err := godotenv.Read(EnvFile)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	fileEnv.Lock()
+	defer fileEnv.Unlock()
+	for key := range fileEnv.keys {
+		if _, ok := vars[key]; !ok {
+			_ = os.Unsetenv(key)
+			delete(fileEnv.keys, key)
+		}
+	}
+	for key, value := range vars {
+		if _, set := os.LookupEnv(key); set && !fileEnv.keys[key] {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return err
+		}
+		fileEnv.keys[key] = true
+	}
+	return nil
+}
+
+// Registry holds the current configuration. Reload loads it again from
+// EnvFile and the environment and passes the old and new configuration to
+// every subscriber, which applies the settings that can change at runtime.
+// Everything else still needs a restart.
+type Registry struct {
+	mu          sync.RWMutex
+	current     *Config
+	subscribers []func(old, updated *Config)
+
+	// reloadMu serialises reloads, so subscribers see them in order
+	reloadMu sync.Mutex
+	load     func() (*Config, error)
+}
+
+// NewRegistry creates a registry holding cfg
+func NewRegistry(cfg *Config) *Registry {
+	return &Registry{current: cfg, load: Load}
+}
+
+// Current returns the configuration of the last successful load. It must not
+// be modified.
+func (r *Registry) Current() *Config {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current
+}
+
+// Subscribe registers fn to be called after every successful reload
+func (r *Registry) Subscribe(fn func(old, updated *Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscribers = append(r.subscribers, fn)
+}
+
+// Reload loads the configuration and notifies the subscribers. On error the
+// current configuration is kept.
+func (r *Registry) Reload() error {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+
+	updated, err := r.load()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	old := r.current
+	r.current = updated
+	subscribers := append([]func(old, updated *Config){}, r.subscribers...)
+	r.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(old, updated)
+	}
+	return nil
+}
+
+// Watch reloads on SIGHUP and, with a positive interval, when the
+// modification time of EnvFile changes, until ctx is done. Reload errors are
+// passed to onError.
+func (r *Registry) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	modTime := envFileModTime()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+		case <-tick:
+			current := envFileModTime()
+			if current.Equal(modTime) {
+				continue
+			}
+			modTime = current
+		}
+		if err := r.Reload(); err != nil {
+			onError(err)
+		}
+	}
+}
+
+// envFileModTime returns the modification time of EnvFile, zero if it does
+// not exist
+func envFileModTime() time.Time {
+	info, err := os.Stat(EnvFile)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
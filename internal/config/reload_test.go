@@ -0,0 +1,54 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+func TestRegistry_Reload(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("SERVER_PORT", "9090") // the real environment wins over .env
+	_ = os.Unsetenv("LOG_LEVEL")
+	_ = os.Unsetenv("CORS_ALLOWED_ORIGINS")
+	t.Cleanup(func() {
+		_ = os.Unsetenv("LOG_LEVEL")
+		_ = os.Unsetenv("CORS_ALLOWED_ORIGINS")
+	})
+
+	write := func(content string) {
+		if err := os.WriteFile(EnvFile, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", EnvFile, err)
+		}
+	}
+	write("LOG_LEVEL=warn\nSERVER_PORT=7070\nCORS_ALLOWED_ORIGINS=https://a.example\n")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.LogLevel != "warn" || cfg.Server.Port != "9090" {
+		t.Fatalf("unexpected initial config: log level %q, port %q", cfg.LogLevel, cfg.Server.Port)
+	}
+
+	registry := NewRegistry(cfg)
+	var notified []string
+	registry.Subscribe(func(old, updated *Config) {
+		notified = append(notified, old.LogLevel+"->"+updated.LogLevel)
+	})
+
+	// A changed value is applied and a removed one falls back to its default
+	write("LOG_LEVEL=debug\nSERVER_PORT=7070\n")
+	if err := registry.Reload(); err != nil {
+		t.Fatalf("Reload returned error: %v", err)
+	}
+	current := registry.Current()
+	if current.LogLevel != "debug" || current.Server.Port != "9090" {
+		t.Fatalf("unexpected reloaded config: log level %q, port %q", current.LogLevel, current.Server.Port)
+	}
+	if len(current.Security.AllowedOrigins) != 2 {
+		t.Fatalf("removed CORS_ALLOWED_ORIGINS not reset to defaults: %v", current.Security.AllowedOrigins)
+	}
+	if len(notified) != 1 || notified[0] != "warn->debug" {
+		t.Fatalf("unexpected notifications %v", notified)
+	}
+}
@@ -0,0 +1,251 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Supported secret backends, selected by SECRETS_BACKEND
+const (
+	SecretsBackendEnv   = "env"   // values (plain or enc:) come from the environment only
+	SecretsBackendVault = "vault" // HashiCorp Vault KV v2
+	SecretsBackendAWS   = "aws"   // AWS Secrets Manager
+)
+
+// SecretRefPrefix marks a value that references a secret of the backend:
+// secret:PATH[#KEY], e.g. DB_PASSWORD=secret:highload/database#password
+const SecretRefPrefix = "secret:"
+
+// SecretBackend fetches secrets from an external store
+type SecretBackend interface {
+	// GetSecret returns the secret at path. key selects a field of a secret
+	// holding several; it may be empty for a secret with a single value.
+	GetSecret(ctx context.Context, path, key string) (string, error)
+}
+
+// secretFetchTimeout bounds every call to a backend
+const secretFetchTimeout = 10 * time.Second
+
+// sharedBackend is created on the first Load and kept for later ones (config
+// reloads), so that its cache and renewals carry over. It is replaced only
+// when its settings change.
+var sharedBackend struct {
+	sync.Mutex
+	settings string
+	backend  *CachingSecretBackend
+}
+
+// secretBackendFromEnv returns the backend selected by SECRETS_BACKEND, nil
+// for env
+func secretBackendFromEnv() (*CachingSecretBackend, error) {
+	name := strings.ToLower(getEnv("SECRETS_BACKEND", SecretsBackendEnv))
+	ttl := time.Duration(getEnvAsInt("SECRETS_CACHE_TTL_SECONDS", 300)) * time.Second
+	settings := strings.Join([]string{
+		name, ttl.String(),
+		getEnv("VAULT_ADDR", ""), getEnv("VAULT_TOKEN", ""), getEnv("VAULT_NAMESPACE", ""), getEnv("VAULT_KV_MOUNT", "secret"),
+		getEnv("SECRETS_AWS_REGION", ""), getEnv("SECRETS_AWS_ENDPOINT", ""),
+	}, "\x00")
+
+	sharedBackend.Lock()
+	defer sharedBackend.Unlock()
+	if sharedBackend.settings == settings {
+		return sharedBackend.backend, nil
+	}
+
+	var backend SecretBackend
+	var renew func(ctx context.Context)
+	switch name {
+	case SecretsBackendEnv:
+	case SecretsBackendVault:
+		vault, err := NewVaultBackend(VaultConfig{
+			Addr:      getEnv("VAULT_ADDR", ""),
+			Token:     getEnv("VAULT_TOKEN", ""),
+			Namespace: getEnv("VAULT_NAMESPACE", ""),
+			Mount:     getEnv("VAULT_KV_MOUNT", "secret"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		backend, renew = vault, vault.RenewToken
+	case SecretsBackendAWS:
+		aws, err := NewAWSSecretsBackend(getEnv("SECRETS_AWS_REGION", ""), getEnv("SECRETS_AWS_ENDPOINT", ""))
+		if err != nil {
+			return nil, err
+		}
+		backend = aws
+	default:
+		return nil, fmt.Errorf("unsupported SECRETS_BACKEND: %s", name)
+	}
+
+	if sharedBackend.backend != nil {
+		sharedBackend.backend.Close()
+	}
+	sharedBackend.settings, sharedBackend.backend = settings, nil
+	if backend != nil {
+		sharedBackend.backend = NewCachingSecretBackend(backend, ttl)
+		if renew != nil {
+			go renew(sharedBackend.backend.ctx)
+		}
+	}
+	return sharedBackend.backend, nil
+}
+
+// CachingSecretBackend caches the secrets of a backend for a TTL and
+// refreshes them in the background before they expire, so that rotated
+// secrets are picked up by the next load and an unavailable store does not
+// fail it while a fetched value is at hand.
+type CachingSecretBackend struct {
+	backend SecretBackend
+	ttl     time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedSecret
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	now    func() time.Time
+}
+
+type cachedSecret struct {
+	path, key string
+	value     string
+	fetched   time.Time
+}
+
+// NewCachingSecretBackend caches the secrets of backend for ttl and starts
+// refreshing them every ttl/2 until Close
+func NewCachingSecretBackend(backend SecretBackend, ttl time.Duration) *CachingSecretBackend {
+	if ttl <= 0 {
+		ttl = 5 * time.Minute
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &CachingSecretBackend{
+		backend: backend,
+		ttl:     ttl,
+		entries: make(map[string]cachedSecret),
+		ctx:     ctx,
+		cancel:  cancel,
+		now:     time.Now,
+	}
+	go c.refreshLoop()
+	return c
+}
+
+// GetSecret returns the cached secret, fetching it when missing or expired.
+// When a fetch fails, an expired value is returned with the error.
+func (c *CachingSecretBackend) GetSecret(ctx context.Context, path, key string) (string, error) {
+	id := path + "#" + key
+	c.mu.Lock()
+	entry, ok := c.entries[id]
+	c.mu.Unlock()
+	if ok && c.now().Sub(entry.fetched) < c.ttl {
+		return entry.value, nil
+	}
+
+	value, err := c.fetch(ctx, path, key)
+	if err != nil {
+		if ok {
+			return entry.value, fmt.Errorf("using value fetched at %s: %w", entry.fetched.Format(time.RFC3339), err)
+		}
+		return "", err
+	}
+	return value, nil
+}
+
+func (c *CachingSecretBackend) fetch(ctx context.Context, path, key string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, secretFetchTimeout)
+	defer cancel()
+	value, err := c.backend.GetSecret(ctx, path, key)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.entries[path+"#"+key] = cachedSecret{path: path, key: key, value: value, fetched: c.now()}
+	c.mu.Unlock()
+	return value, nil
+}
+
+// Refresh fetches every cached secret again. Secrets that fail keep their
+// cached value.
+func (c *CachingSecretBackend) Refresh(ctx context.Context) error {
+	c.mu.Lock()
+	entries := make([]cachedSecret, 0, len(c.entries))
+	for _, entry := range c.entries {
+		entries = append(entries, entry)
+	}
+	c.mu.Unlock()
+
+	var failed []string
+	for _, entry := range entries {
+		if _, err := c.fetch(ctx, entry.path, entry.key); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", entry.path, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to refresh secrets: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+func (c *CachingSecretBackend) refreshLoop() {
+	ticker := time.NewTicker(c.ttl / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Refresh(c.ctx); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+		}
+	}
+}
+
+// Close stops the background refresh and renewals
+func (c *CachingSecretBackend) Close() {
+	c.cancel()
+}
+
+// parseSecretRef splits a secret:PATH[#KEY] reference
+func parseSecretRef(value string) (path, key string, ok bool) {
+	ref, ok := strings.CutPrefix(value, SecretRefPrefix)
+	if !ok {
+		return "", "", false
+	}
+	path, key, _ = strings.Cut(ref, "#")
+	return path, key, path != ""
+}
+
+// secretField selects key from a secret holding several values as a JSON
+// object. Without a key the secret is returned as is.
+func secretField(secret, key string) (string, error) {
+	if key == "" {
+		return secret, nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object, cannot select %q", key)
+	}
+	return fieldValue(fields, key)
+}
+
+// fieldValue returns the string value of key in fields
+func fieldValue(fields map[string]any, key string) (string, error) {
+	value, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("secret has no field %q", key)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestVault(t *testing.T, fields map[string]string) *VaultBackend {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "test-token" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		if r.URL.Path != "/v1/kv/data/highload/database" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		body := `{"data":{"data":{`
+		first := true
+		for k, v := range fields {
+			if !first {
+				body += ","
+			}
+			body += `"` + k + `":"` + v + `"`
+			first = false
+		}
+		_, _ = w.Write([]byte(body + `},"metadata":{"version":3}}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	vault, err := NewVaultBackend(VaultConfig{Addr: server.URL + "/", Token: "test-token", Mount: "kv"})
+	if err != nil {
+		t.Fatalf("NewVaultBackend: %v", err)
+	}
+	return vault
+}
+
+func TestVaultBackend_GetSecret(t *testing.T) {
+	ctx := context.Background()
+	vault := newTestVault(t, map[string]string{"password": "s3cret", "user": "app"})
+
+	if got, err := vault.GetSecret(ctx, "highload/database", "password"); err != nil || got != "s3cret" {
+		t.Fatalf("got %q, %v; want s3cret", got, err)
+	}
+	if _, err := vault.GetSecret(ctx, "highload/database", ""); err == nil {
+		t.Errorf("expected an error without a key for a secret with several fields")
+	}
+	if _, err := vault.GetSecret(ctx, "highload/database", "missing"); err == nil {
+		t.Errorf("expected an error for a missing field")
+	}
+	if _, err := vault.GetSecret(ctx, "highload/other", "password"); err == nil {
+		t.Errorf("expected an error for a missing secret")
+	}
+
+	single := newTestVault(t, map[string]string{"password": "only"})
+	if got, err := single.GetSecret(ctx, "highload/database", ""); err != nil || got != "only" {
+		t.Fatalf("single field: got %q, %v", got, err)
+	}
+}
+
+type countingBackend struct {
+	value string
+	err   error
+	calls int
+}
+
+func (b *countingBackend) GetSecret(ctx context.Context, path, key string) (string, error) {
+	b.calls++
+	return b.value, b.err
+}
+
+func TestCachingSecretBackend(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingBackend{value: "v1"}
+	cache := NewCachingSecretBackend(backend, time.Minute)
+	defer cache.Close()
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if got, err := cache.GetSecret(ctx, "app", "key"); err != nil || got != "v1" {
+			t.Fatalf("got %q, %v", got, err)
+		}
+	}
+	if backend.calls != 1 {
+		t.Fatalf("expected 1 fetch within the TTL, got %d", backend.calls)
+	}
+
+	// Refresh picks up a rotated secret
+	backend.value = "v2"
+	if err := cache.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if got, _ := cache.GetSecret(ctx, "app", "key"); got != "v2" {
+		t.Fatalf("got %q after refresh, want v2", got)
+	}
+
+	// An expired value is still returned while the store is unavailable
+	now = now.Add(2 * time.Minute)
+	backend.err = errors.New("unavailable")
+	got, err := cache.GetSecret(ctx, "app", "key")
+	if err == nil || got != "v2" {
+		t.Fatalf("got %q, %v; want stale v2 with an error", got, err)
+	}
+}
+
+func TestSecretManager_ResolvesReferences(t *testing.T) {
+	sm := &SecretManager{encryptionKey: make([]byte, 32)}
+	t.Setenv("TEST_SECRET_REF", "secret:highload/database#password")
+
+	if got := sm.GetSecureEnv("TEST_SECRET_REF", "fallback"); got != "fallback" {
+		t.Fatalf("without a backend: got %q, want fallback", got)
+	}
+
+	sm.SetBackend(newTestVault(t, map[string]string{"password": "s3cret"}))
+	if got := sm.GetSecureEnv("TEST_SECRET_REF", "fallback"); got != "s3cret" {
+		t.Fatalf("got %q, want s3cret", got)
+	}
+}
+
+func TestSecretField(t *testing.T) {
+	if got, err := secretField(`{"password":"p","port":5432}`, "port"); err != nil || got != "5432" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	if got, err := secretField("plain", ""); err != nil || got != "plain" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	if _, err := secretField("plain", "password"); err == nil {
+		t.Fatalf("expected an error selecting a field of a plain secret")
+	}
+}
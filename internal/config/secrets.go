@@ -1,6 +1,7 @@
 package config
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
@@ -11,9 +12,12 @@ import (
 	"strings"
 )
 
-// SecretManager handles secure storage and retrieval of secrets
+// SecretManager handles secure storage and retrieval of secrets. Values are
+// plain, encrypted with the encryption key (enc:...) or, with a backend,
+// references to secrets in Vault or AWS Secrets Manager (secret:PATH#KEY).
 type SecretManager struct {
 	encryptionKey []byte
+	backend       SecretBackend // nil without SECRETS_BACKEND
 }
 
 // NewSecretManager creates a new secret manager
@@ -35,9 +39,29 @@ func NewSecretManager() (*SecretManager, error) {
 		return nil, fmt.Errorf("invalid encryption key format: %w", err)
 	}
 
-	return &SecretManager{
+	backend, err := secretBackendFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize secrets backend: %w", err)
+	}
+
+	sm := &SecretManager{
 		encryptionKey: keyBytes,
-	}, nil
+	}
+	// Keep the interface nil, not a nil *CachingSecretBackend
+	if backend != nil {
+		sm.backend = backend
+	}
+	return sm, nil
+}
+
+// SetBackend makes secret: references resolve through backend
+func (sm *SecretManager) SetBackend(backend SecretBackend) {
+	sm.backend = backend
+}
+
+// Key returns a copy of the encryption key
+func (sm *SecretManager) Key() []byte {
+	return append([]byte(nil), sm.encryptionKey...)
 }
 
 // Encrypt encrypts a plaintext string
@@ -99,6 +123,22 @@ func (sm *SecretManager) GetSecureEnv(key, defaultValue string) string {
 		return defaultValue
 	}
 
+	// References to the secrets backend (secret:PATH[#KEY])
+	if path, field, ok := parseSecretRef(value); ok {
+		if sm.backend == nil {
+			fmt.Printf("Warning: %s references a secret but SECRETS_BACKEND is not set\n", key)
+			return defaultValue
+		}
+		secret, err := sm.backend.GetSecret(context.Background(), path, field)
+		if err != nil {
+			fmt.Printf("Warning: Failed to fetch %s: %v\n", key, err)
+			if secret == "" {
+				return defaultValue
+			}
+		}
+		return secret
+	}
+
 	// Check if the value is encrypted (starts with "enc:")
 	if strings.HasPrefix(value, "enc:") {
 		encryptedValue := strings.TrimPrefix(value, "enc:")
@@ -152,13 +192,13 @@ func ValidateSecrets(cfg *Config) []string {
 		errors = append(errors, "JWT_SECRET must be set to a secure value")
 	}
 
-	// Check database password
-	if cfg.Database.Password == "" || cfg.Database.Password == "postgres" {
+	// Check database password; SQLite has none
+	if cfg.Database.Driver != "sqlite" && (cfg.Database.Password == "" || cfg.Database.Password == "postgres") {
 		errors = append(errors, "DB_PASSWORD must be set to a secure value")
 	}
 
 	// Check Redis password (if required)
-	if cfg.Redis.Password == "" && cfg.Redis.Host != "localhost" {
+	if cfg.Redis.Password == "" && (cfg.Redis.Host != "localhost" || len(cfg.Redis.Addrs) > 0) {
 		errors = append(errors, "REDIS_PASSWORD should be set for production")
 	}
 
@@ -169,6 +209,23 @@ func ValidateSecrets(cfg *Config) []string {
 		}
 	}
 
+	if cfg.Kafka.SASLMechanism != "" && (cfg.Kafka.SASLUsername == "" || cfg.Kafka.SASLPassword == "") {
+		errors = append(errors, "KAFKA_SASL_USERNAME and KAFKA_SASL_PASSWORD must be set when KAFKA_SASL_MECHANISM is used")
+	}
+
+	// Encrypted payloads would be unreadable after a restart with a generated key
+	if len(cfg.EventEncryption.EventTypes) > 0 && !cfg.EventEncryption.KeyProvided {
+		errors = append(errors, "ENCRYPTION_KEY must be set when EVENT_ENCRYPTION_TYPES is used")
+	}
+	if cfg.UserEncryption.Enabled {
+		if !cfg.EventEncryption.KeyProvided {
+			errors = append(errors, "ENCRYPTION_KEY must be set when USER_ENCRYPTION_ENABLED=true")
+		}
+		if _, err := cfg.UserEncryption.BlindIndexKey(); err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+
 	return errors
 }
 
@@ -183,6 +240,7 @@ func SanitizeConfig(cfg *Config) map[string]interface{} {
 			"tls_key":  maskSensitive(cfg.Server.TLSKey),
 		},
 		"database": map[string]interface{}{
+			"driver":   cfg.Database.Driver,
 			"host":     cfg.Database.Host,
 			"port":     cfg.Database.Port,
 			"user":     cfg.Database.User,
@@ -195,11 +253,17 @@ func SanitizeConfig(cfg *Config) map[string]interface{} {
 			"port":     cfg.Redis.Port,
 			"password": maskSensitive(cfg.Redis.Password),
 			"db":       cfg.Redis.DB,
+			"mode":     cfg.Redis.Mode,
+			"addrs":    cfg.Redis.Addrs,
+			"tls":      cfg.Redis.TLSEnabled,
 		},
 		"kafka": map[string]interface{}{
 			"brokers":  cfg.Kafka.Brokers,
 			"topic":    cfg.Kafka.Topic,
 			"group_id": cfg.Kafka.GroupID,
+			"routes":   cfg.Kafka.TopicRoutes,
+			"tls":      cfg.Kafka.TLSEnabled,
+			"sasl":     cfg.Kafka.SASLMechanism,
 		},
 		"auth": map[string]interface{}{
 			"jwt_secret":         maskSensitive(cfg.Auth.JWTSecret),
@@ -213,8 +277,23 @@ func SanitizeConfig(cfg *Config) map[string]interface{} {
 			"burst_size":               cfg.RateLimit.BurstSize,
 			"auth_requests_per_minute": cfg.RateLimit.AuthRequestsPerMinute,
 			"auth_burst_size":          cfg.RateLimit.AuthBurstSize,
+			"policies":                 cfg.RateLimit.Policies,
+		},
+		"event_encryption": map[string]interface{}{
+			"event_types":  cfg.EventEncryption.EventTypes,
+			"key_id":       cfg.EventEncryption.KeyID,
+			"old_keys":     len(cfg.EventEncryption.OldKeys),
+			"reader_roles": cfg.EventEncryption.ReaderRoles,
+		},
+		"user_encryption": map[string]interface{}{
+			"enabled":   cfg.UserEncryption.Enabled,
+			"index_key": maskSensitive(cfg.UserEncryption.IndexKey),
 		},
 		"log_level": cfg.LogLevel,
+		"redaction": map[string]interface{}{
+			"patterns": cfg.Redaction.Patterns,
+			"fields":   cfg.Redaction.Fields,
+		},
 	}
 }
 
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"highload-microservice/internal/httpclient"
+)
+
+// VaultConfig configures VaultBackend
+type VaultConfig struct {
+	Addr      string // e.g. https://vault.internal:8200
+	Token     string
+	Namespace string // Vault Enterprise namespace, optional
+	Mount     string // KV v2 mount, defaults to secret
+}
+
+// VaultBackend reads secrets from a HashiCorp Vault KV v2 engine
+type VaultBackend struct {
+	cfg    VaultConfig
+	client *http.Client
+}
+
+// NewVaultBackend creates a backend reading from the KV v2 mount of cfg
+func NewVaultBackend(cfg VaultConfig) (*VaultBackend, error) {
+	if cfg.Addr == "" || cfg.Token == "" {
+		return nil, errors.New("VAULT_ADDR and VAULT_TOKEN must be set for SECRETS_BACKEND=vault")
+	}
+	if cfg.Mount == "" {
+		cfg.Mount = "secret"
+	}
+	cfg.Addr = strings.TrimRight(cfg.Addr, "/")
+	cfg.Mount = strings.Trim(cfg.Mount, "/")
+	return &VaultBackend{cfg: cfg, client: httpclient.New("vault", httpclient.Config{Timeout: secretFetchTimeout, MaxRetries: 2})}, nil
+}
+
+// GetSecret reads the latest version of the KV entry at path. key selects
+// one of its fields; it may be omitted for an entry with a single field.
+func (v *VaultBackend) GetSecret(ctx context.Context, path, key string) (string, error) {
+	var body struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	if err := v.do(ctx, http.MethodGet, "/v1/"+v.cfg.Mount+"/data/"+strings.TrimLeft(path, "/"), &body); err != nil {
+		return "", err
+	}
+
+	fields := body.Data.Data
+	if key == "" {
+		if len(fields) != 1 {
+			return "", fmt.Errorf("vault secret %s has %d fields, select one with #KEY", path, len(fields))
+		}
+		for only := range fields {
+			key = only
+		}
+	}
+	return fieldValue(fields, key)
+}
+
+// RenewToken keeps a renewable token alive, renewing it when half of its TTL
+// has passed, until ctx is done. Tokens without a TTL need no renewal.
+func (v *VaultBackend) RenewToken(ctx context.Context) {
+	var lookup struct {
+		Data struct {
+			TTL       int  `json:"ttl"`
+			Renewable bool `json:"renewable"`
+		} `json:"data"`
+	}
+	if err := v.do(ctx, http.MethodGet, "/v1/auth/token/lookup-self", &lookup); err != nil {
+		fmt.Printf("Warning: failed to look up Vault token: %v\n", err)
+		return
+	}
+	if !lookup.Data.Renewable || lookup.Data.TTL <= 0 {
+		return
+	}
+
+	ttl := time.Duration(lookup.Data.TTL) * time.Second
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(ttl / 2):
+		}
+
+		var renewed struct {
+			Auth struct {
+				LeaseDuration int `json:"lease_duration"`
+			} `json:"auth"`
+		}
+		if err := v.do(ctx, http.MethodPost, "/v1/auth/token/renew-self", &renewed); err != nil {
+			fmt.Printf("Warning: failed to renew Vault token: %v\n", err)
+			// Retry well before the current lease runs out
+			ttl = max(ttl/2, 10*time.Second)
+			continue
+		}
+		ttl = time.Duration(renewed.Auth.LeaseDuration) * time.Second
+		if ttl <= 0 {
+			return
+		}
+	}
+}
+
+// do calls the Vault API and decodes the JSON response into out
+func (v *VaultBackend) do(ctx context.Context, method, path string, out any) error {
+	endpoint, err := url.JoinPath(v.cfg.Addr, path)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", v.cfg.Token)
+	if v.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.cfg.Namespace)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		// Error bodies list messages only, never secret values
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("vault %s %s: status %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
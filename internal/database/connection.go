@@ -1,96 +1,71 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"os"
-	"path/filepath"
-	"strings"
+	"time"
 
 	"highload-microservice/internal/config"
-
-	_ "github.com/lib/pq"
+	"highload-microservice/internal/resilience"
 )
 
-func NewConnection(cfg config.DatabaseConfig) (*sql.DB, error) {
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Name, cfg.SSLMode)
-
-	db, err := sql.Open("postgres", dsn)
+// NewConnection opens the connection pool and checks that the database is
+// reachable. With a breaker, statements fail fast while the database is down.
+func NewConnection(cfg config.DatabaseConfig, breaker *resilience.Breaker) (*sql.DB, error) {
+	db, err := Open(cfg, breaker)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, err
 	}
 
 	if err := db.Ping(); err != nil {
+		_ = db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	// Set connection pool settings
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
-
 	return db, nil
 }
 
-// RunMigrations executes database migrations
-func RunMigrations(db *sql.DB) error {
-	// Try different possible paths for migrations file
-	possiblePaths := []string{
-		"internal/database/migrations.sql",
-		"./internal/database/migrations.sql",
-		"/app/internal/database/migrations.sql",
-		"migrations.sql",
-	}
-
-	var migrations []byte
-	var err error
-
-	for _, path := range possiblePaths {
-		// Validate path to prevent directory traversal
-		if !isValidPath(path) {
-			continue
-		}
-		migrations, err = os.ReadFile(path) // #nosec G304 -- Path is validated by isValidPath function
-		if err == nil {
-			break
-		}
-	}
-
+// Open creates the connection pool without connecting, for databases that
+// may be down at startup (the read replica)
+func Open(cfg config.DatabaseConfig, breaker *resilience.Breaker) (*sql.DB, error) {
+	dialect, err := NewDialect(cfg.Driver)
 	if err != nil {
-		return fmt.Errorf("failed to read migrations file from any path: %w", err)
-	}
-
-	// Execute migrations
-	if _, err := db.Exec(string(migrations)); err != nil {
-		return fmt.Errorf("failed to execute migrations: %w", err)
+		return nil, err
 	}
 
-	return nil
-}
-
-// isValidPath validates that the path is safe and doesn't contain directory traversal
-func isValidPath(path string) bool {
-	// Clean the path to resolve any .. or . components
-	cleanPath := filepath.Clean(path)
+	db := sql.OpenDB(&connector{
+		driver:       drivers[dialect.DriverName()],
+		dsn:          dialect.DSN(cfg),
+		queryTimeout: time.Duration(cfg.QueryTimeout) * time.Millisecond,
+		breaker:      breaker,
+	})
 
-	// Check if the path contains any directory traversal attempts
-	if strings.Contains(cleanPath, "..") {
-		return false
-	}
+	// Set connection pool settings
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime) * time.Second)
+	db.SetConnMaxIdleTime(time.Duration(cfg.ConnMaxIdleTime) * time.Second)
 
-	// Additional validation: ensure the path is within expected directories
-	allowedPrefixes := []string{
-		"internal/database/",
-		"./internal/database/",
-		"/app/internal/database/",
-		"migrations.sql",
-	}
+	return db, nil
+}
 
-	for _, prefix := range allowedPrefixes {
-		if strings.HasPrefix(cleanPath, prefix) {
-			return true
-		}
+// Ping checks that the database is reachable with a short-lived connection,
+// outside of any breaker; startup waits on it
+func Ping(ctx context.Context, cfg config.DatabaseConfig) error {
+	cfg.MaxOpenConns, cfg.MaxIdleConns = 1, 0
+	db, err := Open(cfg, nil)
+	if err != nil {
+		return err
 	}
+	defer func() { _ = db.Close() }()
+	return db.PingContext(ctx)
+}
 
-	return false
+// NewMigrationConnection opens a small pool for running migrations. Statement
+// and query timeouts are disabled because schema changes may run long.
+func NewMigrationConnection(cfg config.DatabaseConfig) (*sql.DB, error) {
+	cfg.StatementTimeout, cfg.QueryTimeout = 0, 0
+	cfg.MaxOpenConns, cfg.MaxIdleConns = 2, 1
+	return NewConnection(cfg, nil)
 }
@@ -0,0 +1,266 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"highload-microservice/internal/config"
+)
+
+// Supported values for DB_DRIVER
+const (
+	DriverPostgres = "postgres"
+	DriverMySQL    = "mysql"
+	DriverSQLite   = "sqlite" // single process only; the default in DEV_MODE
+)
+
+// Dialect hides the differences between the supported SQL databases.
+//
+// Queries in the services are written with PostgreSQL-style positional
+// placeholders ($1, $2, ...); dialects that use a different placeholder
+// syntax rewrite them transparently at the driver level (see Rebind).
+type Dialect interface {
+	// Name returns the DB_DRIVER value for this dialect
+	Name() string
+	// DriverName returns the database/sql driver to open
+	DriverName() string
+	// DSN builds the connection string from configuration
+	DSN(cfg config.DatabaseConfig) string
+	// Rebind converts $N placeholders to the dialect's native syntax
+	Rebind(query string) string
+	// Upsert builds an insert-or-update statement for the given table
+	Upsert(table string, columns, conflictColumns, updateColumns []string) string
+	// MigrationLock returns statements that take and release a session lock
+	// serializing migrations across replicas
+	MigrationLock() (lock, unlock string)
+	// ForeignKeyQuery selects the name and ON DELETE action (upper case) of
+	// the foreign keys from table $1 to table $2
+	ForeignKeyQuery() string
+	// ReplaceForeignKey returns the statements that drop the constraint
+	// named existing, if any, and add fk with the ON DELETE action
+	ReplaceForeignKey(fk ForeignKey, existing, onDelete string) []string
+}
+
+// NewDialect returns the dialect for the given DB_DRIVER value
+func NewDialect(driver string) (Dialect, error) {
+	switch strings.ToLower(driver) {
+	case "", DriverPostgres, "postgresql":
+		return postgresDialect{}, nil
+	case DriverMySQL:
+		return mysqlDialect{}, nil
+	case DriverSQLite, "sqlite3":
+		return sqliteDialect{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", driver)
+	}
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string       { return DriverPostgres }
+func (postgresDialect) DriverName() string { return postgresDriverName }
+
+func (postgresDialect) DSN(cfg config.DatabaseConfig) string {
+	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Name, cfg.SSLMode)
+	if cfg.StatementTimeout > 0 {
+		// Sent as a session parameter when the connection starts
+		dsn += fmt.Sprintf(" statement_timeout=%d", cfg.StatementTimeout)
+	}
+	return dsn
+}
+
+func (postgresDialect) Rebind(query string) string { return query }
+
+func (postgresDialect) Upsert(table string, columns, conflictColumns, updateColumns []string) string {
+	var updates []string
+	for _, col := range updateColumns {
+		updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", col, col))
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s)",
+		table, strings.Join(columns, ", "), placeholders(len(columns)), strings.Join(conflictColumns, ", "))
+	if len(updates) == 0 {
+		return query + " DO NOTHING"
+	}
+	return query + " DO UPDATE SET " + strings.Join(updates, ", ")
+}
+
+func (postgresDialect) MigrationLock() (string, string) {
+	return "SELECT pg_advisory_lock(" + migrationLockID + ")", "SELECT pg_advisory_unlock(" + migrationLockID + ")"
+}
+
+func (postgresDialect) ForeignKeyQuery() string {
+	return `SELECT conname, CASE confdeltype WHEN 'c' THEN 'CASCADE' WHEN 'r' THEN 'RESTRICT'
+		WHEN 'n' THEN 'SET NULL' WHEN 'd' THEN 'SET DEFAULT' ELSE 'NO ACTION' END
+		FROM pg_constraint WHERE contype = 'f' AND conrelid = $1::regclass AND confrelid = $2::regclass`
+}
+
+// ReplaceForeignKey swaps the constraint in one statement, so the table is
+// never without it
+func (postgresDialect) ReplaceForeignKey(fk ForeignKey, existing, onDelete string) []string {
+	add := fmt.Sprintf("ADD CONSTRAINT %s %s", fk.Name, fk.definition(onDelete))
+	if existing == "" {
+		return []string{fmt.Sprintf("ALTER TABLE %s %s", fk.Table, add)}
+	}
+	return []string{fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s, %s", fk.Table, existing, add)}
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string       { return DriverMySQL }
+func (mysqlDialect) DriverName() string { return mysqlRebindDriverName }
+
+func (mysqlDialect) DSN(cfg config.DatabaseConfig) string {
+	tls := "false"
+	if cfg.SSLMode != "" && cfg.SSLMode != "disable" {
+		tls = "true"
+	}
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true&multiStatements=true&tls=%s",
+		cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.Name, tls)
+	if cfg.StatementTimeout > 0 {
+		// Unknown DSN parameters are set as session variables; MySQL only
+		// enforces this one for SELECT statements
+		dsn += fmt.Sprintf("&max_execution_time=%d", cfg.StatementTimeout)
+	}
+	return dsn
+}
+
+func (mysqlDialect) Rebind(query string) string { return rebindQuestion(query) }
+
+func (mysqlDialect) Upsert(table string, columns, conflictColumns, updateColumns []string) string {
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		table, strings.Join(columns, ", "), placeholders(len(columns)))
+	if len(updateColumns) == 0 {
+		// MySQL has no DO NOTHING; a no-op assignment keeps the existing row
+		return fmt.Sprintf("%s ON DUPLICATE KEY UPDATE %s = %s", query, conflictColumns[0], conflictColumns[0])
+	}
+
+	var updates []string
+	for _, col := range updateColumns {
+		updates = append(updates, fmt.Sprintf("%s = VALUES(%s)", col, col))
+	}
+	return query + " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+}
+
+func (mysqlDialect) MigrationLock() (string, string) {
+	return "SELECT GET_LOCK('schema_migrations', -1)", "SELECT RELEASE_LOCK('schema_migrations')"
+}
+
+func (mysqlDialect) ForeignKeyQuery() string {
+	return `SELECT CONSTRAINT_NAME, DELETE_RULE FROM information_schema.REFERENTIAL_CONSTRAINTS
+		WHERE CONSTRAINT_SCHEMA = DATABASE() AND TABLE_NAME = $1 AND REFERENCED_TABLE_NAME = $2`
+}
+
+// ReplaceForeignKey drops and adds the constraint separately; InnoDB does not
+// accept both for the same name in one ALTER TABLE
+func (mysqlDialect) ReplaceForeignKey(fk ForeignKey, existing, onDelete string) []string {
+	var statements []string
+	if existing != "" {
+		statements = append(statements, fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s", fk.Table, existing))
+	}
+	return append(statements, fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s", fk.Table, fk.Name, fk.definition(onDelete)))
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string       { return DriverSQLite }
+func (sqliteDialect) DriverName() string { return sqliteDriverName }
+
+// DSN opens DB_NAME as a file, or with ":memory:" an in-memory database
+// shared by every connection of the process. Transactions take the write
+// lock when they begin, so two of them never deadlock upgrading a read lock.
+func (sqliteDialect) DSN(cfg config.DatabaseConfig) string {
+	params := "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate"
+	if cfg.Name == "" || cfg.Name == ":memory:" {
+		return "file:/" + sqliteMemoryName + "?vfs=memdb&" + params
+	}
+	return "file:" + cfg.Name + "?_pragma=journal_mode(WAL)&" + params
+}
+
+// lockingClause matches row locking clauses, which SQLite does not need: a
+// write transaction locks the whole database
+var lockingClause = regexp.MustCompile(`(?i)\s+FOR\s+UPDATE(\s+OF\s+\w+(\s*,\s*\w+)*)?(\s+SKIP\s+LOCKED|\s+NOWAIT)?`)
+
+// Rebind keeps $N placeholders, which SQLite binds by number
+func (sqliteDialect) Rebind(query string) string {
+	return lockingClause.ReplaceAllString(query, "")
+}
+
+// Upsert uses the PostgreSQL syntax, which SQLite shares
+func (sqliteDialect) Upsert(table string, columns, conflictColumns, updateColumns []string) string {
+	return postgresDialect{}.Upsert(table, columns, conflictColumns, updateColumns)
+}
+
+// MigrationLock takes no lock; only one process uses the database
+func (sqliteDialect) MigrationLock() (string, string) {
+	return "SELECT 1", "SELECT 1"
+}
+
+// ForeignKeyQuery names the constraint after its column; SQLite does not
+// report constraint names
+func (sqliteDialect) ForeignKeyQuery() string {
+	return `SELECT "from", upper(on_delete) FROM pragma_foreign_key_list($1) WHERE "table" = $2`
+}
+
+// ReplaceForeignKey edits the stored table definition, as SQLite cannot alter
+// constraints. This only works for constraints written exactly as fk would
+// write them (see the sqlite migrations), so a missing one is not added. The
+// table created and dropped afterwards makes the other connections reload the
+// schema. The statements must run on one connection, hence a single string.
+func (sqliteDialect) ReplaceForeignKey(fk ForeignKey, existing, onDelete string) []string {
+	def := fmt.Sprintf("replace(replace(sql, '%s', '%s'), '%s', '%s')",
+		fk.definition(OnDeleteCascade), fk.definition(onDelete), fk.definition(OnDeleteRestrict), fk.definition(onDelete))
+	return []string{fmt.Sprintf(`PRAGMA writable_schema = ON;
+UPDATE sqlite_schema SET sql = %s WHERE type = 'table' AND name = '%s';
+PRAGMA writable_schema = RESET;
+CREATE TABLE schema_reload (id INTEGER);
+DROP TABLE schema_reload`, def, fk.Table)}
+}
+
+// placeholders returns "$1, $2, ..., $n"
+func placeholders(n int) string {
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = "$" + strconv.Itoa(i+1)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// rebindQuestion replaces $N placeholders with "?" outside of quoted
+// literals. Placeholders must appear in ascending order, which holds for
+// every query in this service.
+func rebindQuestion(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+
+		if quote != 0 {
+			b.WriteByte(ch)
+			if ch == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		switch {
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+			b.WriteByte(ch)
+		case ch == '$' && i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9':
+			b.WriteByte('?')
+			for i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9' {
+				i++
+			}
+		default:
+			b.WriteByte(ch)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,43 @@
+package database
+
+import "testing"
+
+func TestRebindQuestion(t *testing.T) {
+	cases := map[string]string{
+		"SELECT * FROM users WHERE id = $1":                           "SELECT * FROM users WHERE id = ?",
+		"UPDATE users SET email = $1, first_name = $2 WHERE id = $10": "UPDATE users SET email = ?, first_name = ? WHERE id = ?",
+		"SELECT '$1' AS literal, col FROM t WHERE a = $1":             "SELECT '$1' AS literal, col FROM t WHERE a = ?",
+		"SELECT price FROM t WHERE currency = '$'":                    "SELECT price FROM t WHERE currency = '$'",
+	}
+
+	for in, want := range cases {
+		if got := rebindQuestion(in); got != want {
+			t.Fatalf("rebind(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	pg, _ := NewDialect(DriverPostgres)
+	my, _ := NewDialect(DriverMySQL)
+
+	cols := []string{"id", "name"}
+	conflict := []string{"id"}
+	update := []string{"name"}
+
+	if got, want := pg.Upsert("t", cols, conflict, update), "INSERT INTO t (id, name) VALUES ($1, $2) ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name"; got != want {
+		t.Fatalf("postgres upsert: %q", got)
+	}
+	if got, want := my.Upsert("t", cols, conflict, update), "INSERT INTO t (id, name) VALUES ($1, $2) ON DUPLICATE KEY UPDATE name = VALUES(name)"; got != want {
+		t.Fatalf("mysql upsert: %q", got)
+	}
+	if got, want := pg.Upsert("t", cols, conflict, nil), "INSERT INTO t (id, name) VALUES ($1, $2) ON CONFLICT (id) DO NOTHING"; got != want {
+		t.Fatalf("postgres insert-ignore: %q", got)
+	}
+}
+
+func TestNewDialect_Unsupported(t *testing.T) {
+	if _, err := NewDialect("oracle"); err == nil {
+		t.Fatalf("expected error for unsupported driver")
+	}
+}
@@ -0,0 +1,315 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"time"
+
+	"highload-microservice/internal/metrics"
+	"highload-microservice/internal/resilience"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// postgresDriverName is the database/sql driver used for DB_DRIVER=postgres.
+// It wraps lib/pq to record query metrics; placeholders are left as is.
+const postgresDriverName = "postgres-instrumented"
+
+func init() {
+	register(postgresDriverName, &rebindDriver{
+		Driver: &pq.Driver{},
+		rebind: func(query string) string { return query },
+	})
+}
+
+// drivers holds the registered wrappers by name so NewConnection can open
+// them with per-pool settings
+var drivers = make(map[string]*rebindDriver)
+
+func register(name string, d *rebindDriver) {
+	drivers[name] = d
+	sql.Register(name, d)
+}
+
+// rebindDriver wraps a driver so that every connection rewrites placeholders
+// with rebind and reports query latency to the metrics package
+type rebindDriver struct {
+	driver.Driver
+	rebind func(string) string
+}
+
+func (d *rebindDriver) Open(name string) (driver.Conn, error) {
+	return d.open(name, 0, nil)
+}
+
+func (d *rebindDriver) open(name string, queryTimeout time.Duration, breaker *resilience.Breaker) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &rebindConn{Conn: conn, rebind: d.rebind, queryTimeout: queryTimeout, breaker: breaker}, nil
+}
+
+// connector opens connections of a rebindDriver whose statements are bounded
+// by queryTimeout and, if set, guarded by breaker
+type connector struct {
+	driver       *rebindDriver
+	dsn          string
+	queryTimeout time.Duration
+	breaker      *resilience.Breaker
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.open(c.dsn, c.queryTimeout, c.breaker)
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// rebindConn forwards to the wrapped connection, rewriting query text on the
+// way through and recording query latency. Optional interfaces the wrapped
+// connection does not implement fall back to database/sql defaults via
+// driver.ErrSkip.
+//
+// With a queryTimeout every statement runs under a context deadline, so a
+// slow database fails requests instead of piling up goroutines waiting on
+// it. Rows keep the deadline until they are closed.
+//
+// With a breaker, statements fail at once with resilience.ErrOpen while the
+// database keeps timing out or refusing connections. Pings are not guarded.
+type rebindConn struct {
+	driver.Conn
+	rebind       func(string) string
+	queryTimeout time.Duration
+	breaker      *resilience.Breaker
+}
+
+// withTimeout applies the query timeout unless ctx has an earlier deadline
+func (c *rebindConn) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.queryTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.queryTimeout)
+}
+
+// guard admits a statement through the breaker; done records its outcome
+func (c *rebindConn) guard() (func(error), error) {
+	if c.breaker == nil {
+		return func(error) {}, nil
+	}
+	done, err := c.breaker.Allow()
+	if err != nil {
+		return nil, err
+	}
+	return func(err error) { done(outage(err)) }, nil
+}
+
+// outage classifies the error of a statement for the breaker: it returns err
+// if it means the database is unreachable or overloaded. Errors the server
+// reports about the statement itself, such as constraint violations, do not
+// count against the breaker; statement timeouts do.
+func outage(err error) error {
+	if errors.Is(err, driver.ErrSkip) {
+		// Retried through a prepared statement, which is guarded itself
+		return resilience.ErrAbandoned
+	}
+	if err == nil {
+		return nil
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code != queryCanceled {
+		return nil
+	}
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) && myErr.Number != mysqlExecutionTimeExceeded {
+		return nil
+	}
+	var liteErr *sqlite.Error
+	if errors.As(err, &liteErr) && liteErr.Code()&0xff != sqlite3.SQLITE_BUSY {
+		return nil
+	}
+	return err
+}
+
+// Server errors that mean a statement ran out of time
+const (
+	queryCanceled              = "57014" // PostgreSQL query_canceled (statement_timeout)
+	mysqlExecutionTimeExceeded = 3024    // MySQL max_execution_time
+)
+
+func (c *rebindConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(c.rebind(query))
+}
+
+func (c *rebindConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, c.rebind(query))
+	} else {
+		stmt, err = c.Conn.Prepare(c.rebind(query))
+	}
+	if err != nil || (c.queryTimeout <= 0 && c.breaker == nil) {
+		return stmt, err
+	}
+	return wrapStmt(stmt, c), nil
+}
+
+func (c *rebindConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if e, ok := c.Conn.(driver.ExecerContext); ok {
+		done, err := c.guard()
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := c.withTimeout(ctx)
+		defer cancel()
+		start := time.Now()
+		result, err := e.ExecContext(ctx, c.rebind(query), args)
+		observe(query, start, err)
+		done(err)
+		return result, err
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *rebindConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := c.Conn.(driver.QueryerContext); ok {
+		done, err := c.guard()
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := c.withTimeout(ctx)
+		start := time.Now()
+		rows, err := q.QueryContext(ctx, c.rebind(query), args)
+		observe(query, start, err)
+		done(err)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		return &timeoutRows{Rows: rows, cancel: cancel}, nil
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *rebindConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin() //nolint:staticcheck // fallback for drivers without BeginTx
+}
+
+func (c *rebindConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *rebindConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *rebindConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *rebindConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// observe records a statement in the db_query_* metrics. ErrSkip means the
+// statement is retried through a prepared statement and is not counted.
+func observe(query string, start time.Time, err error) {
+	if errors.Is(err, driver.ErrSkip) {
+		return
+	}
+	metrics.ObserveDBQuery(query, time.Since(start), err)
+}
+
+// timeoutRows releases the statement's deadline when the rows are closed
+type timeoutRows struct {
+	driver.Rows
+	cancel context.CancelFunc
+}
+
+func (r *timeoutRows) Close() error {
+	defer r.cancel()
+	return r.Rows.Close()
+}
+
+// timeoutStmt applies the connection's query timeout and breaker to prepared
+// statements, which drivers such as MySQL use for every statement with
+// arguments
+type timeoutStmt struct {
+	driver.Stmt
+	exec  driver.StmtExecContext
+	query driver.StmtQueryContext
+	conn  *rebindConn
+}
+
+// wrapStmt returns stmt unchanged if it does not support contexts
+func wrapStmt(stmt driver.Stmt, conn *rebindConn) driver.Stmt {
+	exec, okExec := stmt.(driver.StmtExecContext)
+	query, okQuery := stmt.(driver.StmtQueryContext)
+	if !okExec || !okQuery {
+		return stmt
+	}
+	return &timeoutStmt{Stmt: stmt, exec: exec, query: query, conn: conn}
+}
+
+func (s *timeoutStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	done, err := s.conn.guard()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := s.conn.withTimeout(ctx)
+	defer cancel()
+	result, err := s.exec.ExecContext(ctx, args)
+	done(err)
+	return result, err
+}
+
+func (s *timeoutStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	done, err := s.conn.guard()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := s.conn.withTimeout(ctx)
+	rows, err := s.query.QueryContext(ctx, args)
+	done(err)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &timeoutRows{Rows: rows, cancel: cancel}, nil
+}
+
+func (s *timeoutStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return s.conn.CheckNamedValue(nv)
+}
+
+func (s *timeoutStmt) ColumnConverter(idx int) driver.ValueConverter {
+	if c, ok := s.Stmt.(driver.ColumnConverter); ok { //nolint:staticcheck // forwarded for drivers that still use it
+		return c.ColumnConverter(idx)
+	}
+	return driver.DefaultParameterConverter
+}
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/config"
+	"highload-microservice/internal/resilience"
+
+	"github.com/lib/pq"
+)
+
+// deadlineConn records whether statements ran with a deadline
+type deadlineConn struct {
+	driver.Conn
+	deadlines []bool
+	rowsCtx   context.Context
+}
+
+func (c *deadlineConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	_, ok := ctx.Deadline()
+	c.deadlines = append(c.deadlines, ok)
+	return driver.RowsAffected(0), nil
+}
+
+func (c *deadlineConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	_, ok := ctx.Deadline()
+	c.deadlines = append(c.deadlines, ok)
+	c.rowsCtx = ctx
+	return &emptyRows{}, nil
+}
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string              { return nil }
+func (emptyRows) Close() error                   { return nil }
+func (emptyRows) Next(dest []driver.Value) error { return nil }
+
+func TestRebindConn_QueryTimeout(t *testing.T) {
+	inner := &deadlineConn{}
+	conn := &rebindConn{Conn: inner, rebind: rebindQuestion, queryTimeout: time.Minute}
+
+	if _, err := conn.ExecContext(context.Background(), "UPDATE t SET a = $1", nil); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	rows, err := conn.QueryContext(context.Background(), "SELECT a FROM t", nil)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if inner.rowsCtx.Err() != nil {
+		t.Fatal("deadline released before the rows were closed")
+	}
+	_ = rows.Close()
+	if inner.rowsCtx.Err() == nil {
+		t.Fatal("deadline not released when the rows were closed")
+	}
+
+	untimed := &rebindConn{Conn: inner, rebind: rebindQuestion}
+	_, _ = untimed.ExecContext(context.Background(), "UPDATE t SET a = 1", nil)
+
+	if got := fmt.Sprint(inner.deadlines); got != "[true true false]" {
+		t.Fatalf("deadlines %s, want [true true false]", got)
+	}
+}
+
+// failingConn fails every statement with err
+type failingConn struct {
+	driver.Conn
+	err   error
+	calls int
+}
+
+func (c *failingConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	c.calls++
+	return nil, c.err
+}
+
+func TestRebindConn_Breaker(t *testing.T) {
+	breaker := resilience.New("test_database", resilience.Config{FailureThreshold: 2, OpenTimeout: time.Minute})
+
+	// Constraint violations and retries through prepared statements do not
+	// count against the database
+	for _, err := range []error{&pq.Error{Code: "23505"}, driver.ErrSkip} {
+		conn := &rebindConn{Conn: &failingConn{err: err}, rebind: rebindQuestion, breaker: breaker}
+		for i := 0; i < 3; i++ {
+			_, _ = conn.ExecContext(context.Background(), "INSERT INTO t VALUES (1)", nil)
+		}
+	}
+	if breaker.State() != resilience.StateClosed {
+		t.Fatalf("want closed, got %s", breaker.State())
+	}
+
+	inner := &failingConn{err: errors.New("dial tcp: connection refused")}
+	conn := &rebindConn{Conn: inner, rebind: rebindQuestion, breaker: breaker}
+	for i := 0; i < 3; i++ {
+		_, err := conn.ExecContext(context.Background(), "UPDATE t SET a = 1", nil)
+		if i == 2 && !errors.Is(err, resilience.ErrOpen) {
+			t.Fatalf("want ErrOpen, got %v", err)
+		}
+	}
+	if inner.calls != 2 {
+		t.Fatalf("want 2 statements to reach the database, got %d", inner.calls)
+	}
+}
+
+func TestDSN_StatementTimeout(t *testing.T) {
+	cfg := config.DatabaseConfig{Host: "db", Port: "5432", StatementTimeout: 5000}
+	if dsn := (postgresDialect{}).DSN(cfg); !strings.HasSuffix(dsn, " statement_timeout=5000") {
+		t.Fatalf("postgres dsn: %s", dsn)
+	}
+	if dsn := (mysqlDialect{}).DSN(cfg); !strings.HasSuffix(dsn, "&max_execution_time=5000") {
+		t.Fatalf("mysql dsn: %s", dsn)
+	}
+
+	cfg.StatementTimeout = 0
+	if dsn := (postgresDialect{}).DSN(cfg); strings.Contains(dsn, "statement_timeout") {
+		t.Fatalf("postgres dsn without timeout: %s", dsn)
+	}
+}
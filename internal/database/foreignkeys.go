@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ON DELETE actions a configurable foreign key can take
+const (
+	OnDeleteCascade  = "cascade"  // deleting the referenced row deletes the referencing rows
+	OnDeleteRestrict = "restrict" // referenced rows cannot be deleted while referenced
+)
+
+// ForeignKey is a single-column foreign key whose ON DELETE action is set
+// from configuration rather than fixed by a migration
+type ForeignKey struct {
+	Name      string // used when the constraint is (re)created
+	Table     string
+	Column    string
+	RefTable  string
+	RefColumn string
+}
+
+// EventUser links events.user_id to users.id. The initial migrations create
+// it with ON DELETE CASCADE.
+var EventUser = ForeignKey{Name: "fk_events_user", Table: "events", Column: "user_id", RefTable: "users", RefColumn: "id"}
+
+func (fk ForeignKey) definition(onDelete string) string {
+	return fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s(%s) ON DELETE %s",
+		fk.Column, fk.RefTable, fk.RefColumn, strings.ToUpper(onDelete))
+}
+
+// ValidOnDelete reports whether action is a supported ON DELETE action
+func ValidOnDelete(action string) bool {
+	return action == OnDeleteCascade || action == OnDeleteRestrict
+}
+
+// OnDelete returns the constraint name and ON DELETE action (lower case) of
+// fk; both are empty when the constraint does not exist
+func OnDelete(ctx context.Context, db *sql.DB, dialect Dialect, fk ForeignKey) (name, action string, err error) {
+	err = db.QueryRowContext(ctx, dialect.ForeignKeyQuery(), fk.Table, fk.RefTable).Scan(&name, &action)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read foreign key of %s.%s: %w", fk.Table, fk.Column, err)
+	}
+	return name, strings.ToLower(action), nil
+}
+
+// SetOnDelete recreates fk with the ON DELETE action unless it already has
+// it, and reports whether it changed. Adding a missing constraint fails while
+// rows reference missing rows.
+func SetOnDelete(ctx context.Context, db *sql.DB, dialect Dialect, fk ForeignKey, action string) (bool, error) {
+	if !ValidOnDelete(action) {
+		return false, fmt.Errorf("unsupported ON DELETE action %q", action)
+	}
+	existing, current, err := OnDelete(ctx, db, dialect, fk)
+	if err != nil {
+		return false, err
+	}
+	if current == action {
+		return false, nil
+	}
+	for _, statement := range dialect.ReplaceForeignKey(fk, existing, action) {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return false, fmt.Errorf("failed to set ON DELETE %s on %s.%s: %w", action, fk.Table, fk.Column, err)
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestReplaceForeignKey(t *testing.T) {
+	pg, _ := NewDialect(DriverPostgres)
+	my, _ := NewDialect(DriverMySQL)
+
+	got := pg.ReplaceForeignKey(EventUser, "events_user_id_fkey", OnDeleteRestrict)
+	want := "ALTER TABLE events DROP CONSTRAINT events_user_id_fkey, ADD CONSTRAINT fk_events_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE RESTRICT"
+	if len(got) != 1 || got[0] != want {
+		t.Fatalf("postgres: %q", got)
+	}
+	got = my.ReplaceForeignKey(EventUser, "fk_events_user", OnDeleteCascade)
+	if len(got) != 2 || got[0] != "ALTER TABLE events DROP FOREIGN KEY fk_events_user" ||
+		got[1] != "ALTER TABLE events ADD CONSTRAINT fk_events_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE" {
+		t.Fatalf("mysql: %q", got)
+	}
+	if got := my.ReplaceForeignKey(EventUser, "", OnDeleteCascade); len(got) != 1 {
+		t.Fatalf("mysql without an existing constraint: %q", got)
+	}
+}
+
+func TestSetOnDelete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	pg, _ := NewDialect(DriverPostgres)
+	query := regexp.QuoteMeta("FROM pg_constraint WHERE contype = 'f' AND conrelid = $1::regclass AND confrelid = $2::regclass")
+
+	mock.ExpectQuery(query).WithArgs("events", "users").
+		WillReturnRows(sqlmock.NewRows([]string{"conname", "confdeltype"}).AddRow("events_user_id_fkey", "CASCADE"))
+	if changed, err := SetOnDelete(context.Background(), db, pg, EventUser, OnDeleteCascade); err != nil || changed {
+		t.Fatalf("unchanged policy: %v, %v", changed, err)
+	}
+
+	mock.ExpectQuery(query).WithArgs("events", "users").
+		WillReturnRows(sqlmock.NewRows([]string{"conname", "confdeltype"}).AddRow("events_user_id_fkey", "CASCADE"))
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE events DROP CONSTRAINT events_user_id_fkey, ADD CONSTRAINT fk_events_user")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	if changed, err := SetOnDelete(context.Background(), db, pg, EventUser, OnDeleteRestrict); err != nil || !changed {
+		t.Fatalf("new policy: %v, %v", changed, err)
+	}
+
+	if _, err := SetOnDelete(context.Background(), db, pg, EventUser, "set null"); err == nil {
+		t.Fatal("expected an error for an unsupported action")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
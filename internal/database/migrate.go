@@ -0,0 +1,361 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migration files live in migrations/<dialect>/ and are named
+// NNNN_description.up.sql and NNNN_description.down.sql. Versions are applied
+// in ascending order and recorded in the schema_migrations table.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationLockID is the Postgres advisory lock key held while migrating
+const migrationLockID = "7240531"
+
+const createMigrationsTable = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		dirty BOOLEAN NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string // empty if the migration cannot be reverted
+}
+
+// MigrationStatus describes a known or recorded migration
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	Dirty     bool
+	AppliedAt *time.Time
+}
+
+// DirtyError is returned when a previous migration failed halfway. The schema
+// must be repaired by hand and the version marked clean with Force.
+type DirtyError struct {
+	Version int64
+}
+
+func (e *DirtyError) Error() string {
+	return fmt.Sprintf("migration %d failed previously and left the database dirty; "+
+		"repair the schema, then run 'migrate force %d'", e.Version, e.Version)
+}
+
+// Migrator applies and reverts versioned migrations. A migration is recorded
+// as dirty before it runs and marked clean afterwards, so a failure (MySQL
+// commits DDL implicitly) is detected on the next run instead of being
+// retried on a half-changed schema.
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+	onDelete   map[ForeignKey]string // enforced by Up, see SetOnDelete
+}
+
+// NewMigrator loads the embedded migrations of the dialect
+func NewMigrator(db *sql.DB, dialect Dialect) (*Migrator, error) {
+	sub, err := fs.Sub(migrationFiles, path.Join("migrations", dialect.Name()))
+	if err != nil {
+		return nil, err
+	}
+	return newMigrator(db, dialect, sub)
+}
+
+func newMigrator(db *sql.DB, dialect Dialect, files fs.FS) (*Migrator, error) {
+	migrations, err := loadMigrations(files)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// loadMigrations reads NNNN_name.{up,down}.sql files sorted by version
+func loadMigrations(files fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		base := strings.TrimSuffix(entry.Name(), ".sql")
+		base, direction := strings.TrimSuffix(base, path.Ext(base)), strings.TrimPrefix(path.Ext(base), ".")
+		versionPart, name, ok := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(versionPart, 10, 64)
+		if !ok || err != nil || version <= 0 || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %q: want NNNN_name.up.sql or NNNN_name.down.sql", entry.Name())
+		}
+
+		content, err := fs.ReadFile(files, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Up applies every pending migration in order and returns how many ran
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.locked(ctx, func(conn *sql.Conn, recorded map[int64]MigrationStatus) error {
+		for _, migration := range m.migrations {
+			if _, ok := recorded[migration.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, migration); err != nil {
+				return err
+			}
+			applied++
+		}
+		for fk, action := range m.onDelete {
+			if _, err := SetOnDelete(ctx, m.db, m.dialect, fk, action); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// SetOnDelete makes Up give fk the ON DELETE action once the migrations
+// are applied
+func (m *Migrator) SetOnDelete(fk ForeignKey, action string) error {
+	if !ValidOnDelete(action) {
+		return fmt.Errorf("unsupported ON DELETE action %q", action)
+	}
+	if m.onDelete == nil {
+		m.onDelete = map[ForeignKey]string{}
+	}
+	m.onDelete[fk] = action
+	return nil
+}
+
+// Down reverts the last steps applied migrations and returns how many ran
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	reverted := 0
+	err := m.locked(ctx, func(conn *sql.Conn, recorded map[int64]MigrationStatus) error {
+		for i := len(m.migrations) - 1; i >= 0 && reverted < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := recorded[migration.Version]; !ok {
+				continue
+			}
+			if err := m.revert(ctx, conn, migration); err != nil {
+				return err
+			}
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Force marks version as cleanly applied after a failed migration was
+// completed by hand
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if err := m.ensureTable(ctx, conn); err != nil {
+		return err
+	}
+	result, err := conn.ExecContext(ctx, `UPDATE schema_migrations SET dirty = false WHERE version = $1`, version)
+	if err != nil {
+		return fmt.Errorf("failed to force migration %d: %w", version, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("migration %d is not recorded", version)
+	}
+	return nil
+}
+
+// Status lists known migrations and whether they are applied. Recorded
+// versions without a migration file are included too.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if err := m.ensureTable(ctx, conn); err != nil {
+		return nil, err
+	}
+	recorded, err := m.recorded(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status, ok := recorded[migration.Version]
+		if !ok {
+			status = MigrationStatus{Version: migration.Version, Name: migration.Name}
+		}
+		delete(recorded, migration.Version)
+		statuses = append(statuses, status)
+	}
+	for _, status := range recorded {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Pending returns how many migrations are not applied yet. It fails with a
+// DirtyError if a migration is dirty.
+func (m *Migrator) Pending(ctx context.Context) (int, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, status := range statuses {
+		if status.Dirty {
+			return 0, &DirtyError{Version: status.Version}
+		}
+		if !status.Applied {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// locked runs fn on a single connection holding the migration lock, after
+// checking that no migration is dirty
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn, recorded map[int64]MigrationStatus) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	lock, unlock := m.dialect.MigrationLock()
+	if _, err := conn.ExecContext(ctx, lock); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	// Release even if ctx is cancelled; the lock belongs to this session
+	defer func() { _, _ = conn.ExecContext(context.WithoutCancel(ctx), unlock) }()
+
+	if err := m.ensureTable(ctx, conn); err != nil {
+		return err
+	}
+	recorded, err := m.recorded(ctx, conn)
+	if err != nil {
+		return err
+	}
+	for _, status := range recorded {
+		if status.Dirty {
+			return &DirtyError{Version: status.Version}
+		}
+	}
+	return fn(conn, recorded)
+}
+
+func (m *Migrator) ensureTable(ctx context.Context, conn *sql.Conn) error {
+	if _, err := conn.ExecContext(ctx, createMigrationsTable); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// recorded returns the rows of schema_migrations by version
+func (m *Migrator) recorded(ctx context.Context, conn *sql.Conn) (map[int64]MigrationStatus, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, name, dirty, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	recorded := make(map[int64]MigrationStatus)
+	for rows.Next() {
+		var status MigrationStatus
+		var appliedAt time.Time
+		if err := rows.Scan(&status.Version, &status.Name, &status.Dirty, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations: %w", err)
+		}
+		status.Applied = true
+		status.AppliedAt = &appliedAt
+		recorded[status.Version] = status
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	return recorded, nil
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	_, err := conn.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, dirty, applied_at) VALUES ($1, $2, $3, $4)`,
+		migration.Version, migration.Name, true, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+	}
+	if _, err := conn.ExecContext(ctx, migration.Up); err != nil {
+		return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+	}
+	if _, err := conn.ExecContext(ctx, `UPDATE schema_migrations SET dirty = false WHERE version = $1`, migration.Version); err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+	}
+	return nil
+}
+
+func (m *Migrator) revert(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	if migration.Down == "" {
+		return fmt.Errorf("migration %d_%s has no down file", migration.Version, migration.Name)
+	}
+	if _, err := conn.ExecContext(ctx, `UPDATE schema_migrations SET dirty = true WHERE version = $1`, migration.Version); err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+	}
+	if _, err := conn.ExecContext(ctx, migration.Down); err != nil {
+		return fmt.Errorf("reverting migration %d_%s failed: %w", migration.Version, migration.Name, err)
+	}
+	if _, err := conn.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version); err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var testMigrations = fstest.MapFS{
+	"0001_initial.up.sql":   {Data: []byte("CREATE TABLE a (id INT)")},
+	"0001_initial.down.sql": {Data: []byte("DROP TABLE a")},
+	"0002_add_b.up.sql":     {Data: []byte("CREATE TABLE b (id INT)")},
+	"0002_add_b.down.sql":   {Data: []byte("DROP TABLE b")},
+	"0010_no_down.up.sql":   {Data: []byte("CREATE INDEX idx ON b (id)")},
+	"README.md":             {Data: []byte("ignored")},
+}
+
+func newTestMigrator(t *testing.T) (*Migrator, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	m, err := newMigrator(db, postgresDialect{}, testMigrations)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	return m, mock
+}
+
+func expectLockAndRecorded(mock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+	mock.ExpectExec("SELECT pg_advisory_lock(" + migrationLockID + ")").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(createMigrationsTable).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT version, name, dirty, applied_at FROM schema_migrations`).WillReturnRows(rows)
+}
+
+var recordedColumns = []string{"version", "name", "dirty", "applied_at"}
+
+func TestLoadMigrations_Order(t *testing.T) {
+	m, _ := newTestMigrator(t)
+	if len(m.migrations) != 3 {
+		t.Fatalf("want 3 migrations, got %d", len(m.migrations))
+	}
+	for i, want := range []int64{1, 2, 10} {
+		if m.migrations[i].Version != want {
+			t.Fatalf("migration %d has version %d, want %d", i, m.migrations[i].Version, want)
+		}
+	}
+	if m.migrations[2].Down != "" || m.migrations[1].Name != "add_b" {
+		t.Fatalf("unexpected migration: %+v", m.migrations)
+	}
+}
+
+func TestLoadMigrations_Invalid(t *testing.T) {
+	cases := map[string]fstest.MapFS{
+		"bad name":  {"initial.up.sql": {Data: []byte("x")}},
+		"bad kind":  {"0001_initial.sideways.sql": {Data: []byte("x")}},
+		"down only": {"0001_initial.down.sql": {Data: []byte("x")}},
+		"two names": {"0001_a.up.sql": {Data: []byte("x")}, "0001_b.down.sql": {Data: []byte("x")}},
+	}
+	for name, files := range cases {
+		if _, err := loadMigrations(files); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	pg, err := NewMigrator(nil, postgresDialect{})
+	if err != nil {
+		t.Fatalf("postgres: %v", err)
+	}
+	my, err := NewMigrator(nil, mysqlDialect{})
+	if err != nil {
+		t.Fatalf("mysql: %v", err)
+	}
+	lite, err := NewMigrator(nil, sqliteDialect{})
+	if err != nil {
+		t.Fatalf("sqlite: %v", err)
+	}
+	for _, other := range []*Migrator{my, lite} {
+		if len(pg.migrations) == 0 || len(pg.migrations) != len(other.migrations) {
+			t.Fatalf("dialects must have the same migrations: postgres %d, %s %d",
+				len(pg.migrations), other.dialect.Name(), len(other.migrations))
+		}
+		for i := range pg.migrations {
+			if pg.migrations[i].Version != other.migrations[i].Version || pg.migrations[i].Name != other.migrations[i].Name {
+				t.Fatalf("migration %d differs: %d_%s vs %d_%s", i,
+					pg.migrations[i].Version, pg.migrations[i].Name, other.migrations[i].Version, other.migrations[i].Name)
+			}
+		}
+	}
+}
+
+func TestMigrator_UpAppliesPending(t *testing.T) {
+	m, mock := newTestMigrator(t)
+
+	expectLockAndRecorded(mock, sqlmock.NewRows(recordedColumns).AddRow(1, "initial", false, time.Now()))
+	for _, mig := range []struct {
+		version int64
+		name    string
+		sql     string
+	}{{2, "add_b", "CREATE TABLE b (id INT)"}, {10, "no_down", "CREATE INDEX idx ON b (id)"}} {
+		mock.ExpectExec(`INSERT INTO schema_migrations (version, name, dirty, applied_at) VALUES ($1, $2, $3, $4)`).
+			WithArgs(mig.version, mig.name, true, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(mig.sql).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`UPDATE schema_migrations SET dirty = false WHERE version = $1`).
+			WithArgs(mig.version).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectExec("SELECT pg_advisory_unlock(" + migrationLockID + ")").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	applied, err := m.Up(context.Background())
+	if err != nil || applied != 2 {
+		t.Fatalf("want 2 applied, got %d (%v)", applied, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestMigrator_UpRefusesDirty(t *testing.T) {
+	m, mock := newTestMigrator(t)
+
+	expectLockAndRecorded(mock, sqlmock.NewRows(recordedColumns).
+		AddRow(1, "initial", false, time.Now()).
+		AddRow(2, "add_b", true, time.Now()))
+	mock.ExpectExec("SELECT pg_advisory_unlock(" + migrationLockID + ")").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	_, err := m.Up(context.Background())
+	dirty, ok := err.(*DirtyError)
+	if !ok || dirty.Version != 2 {
+		t.Fatalf("expected dirty error for version 2, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestMigrator_UpFailureLeavesDirty(t *testing.T) {
+	m, mock := newTestMigrator(t)
+
+	expectLockAndRecorded(mock, sqlmock.NewRows(recordedColumns).AddRow(1, "initial", false, time.Now()))
+	mock.ExpectExec(`INSERT INTO schema_migrations (version, name, dirty, applied_at) VALUES ($1, $2, $3, $4)`).
+		WithArgs(int64(2), "add_b", true, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("CREATE TABLE b (id INT)").WillReturnError(errors.New("syntax error"))
+	mock.ExpectExec("SELECT pg_advisory_unlock(" + migrationLockID + ")").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if _, err := m.Up(context.Background()); err == nil {
+		t.Fatal("expected migration error")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestMigrator_Down(t *testing.T) {
+	m, mock := newTestMigrator(t)
+
+	expectLockAndRecorded(mock, sqlmock.NewRows(recordedColumns).
+		AddRow(1, "initial", false, time.Now()).
+		AddRow(2, "add_b", false, time.Now()))
+	mock.ExpectExec(`UPDATE schema_migrations SET dirty = true WHERE version = $1`).
+		WithArgs(int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DROP TABLE b").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM schema_migrations WHERE version = $1`).
+		WithArgs(int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("SELECT pg_advisory_unlock(" + migrationLockID + ")").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	reverted, err := m.Down(context.Background(), 1)
+	if err != nil || reverted != 1 {
+		t.Fatalf("want 1 reverted, got %d (%v)", reverted, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestMigrator_Pending(t *testing.T) {
+	m, mock := newTestMigrator(t)
+
+	mock.ExpectExec(createMigrationsTable).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT version, name, dirty, applied_at FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows(recordedColumns).AddRow(1, "initial", false, time.Now()))
+
+	pending, err := m.Pending(context.Background())
+	if err != nil || pending != 2 {
+		t.Fatalf("want 2 pending, got %d (%v)", pending, err)
+	}
+}
@@ -1,144 +0,0 @@
--- Ensure required extensions
-CREATE EXTENSION IF NOT EXISTS pgcrypto;
-
--- Create users table
-CREATE TABLE IF NOT EXISTS users (
-    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-    email VARCHAR(255) UNIQUE NOT NULL,
-    first_name VARCHAR(100) NOT NULL,
-    last_name VARCHAR(100) NOT NULL,
-    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-);
-
--- Create events table
-CREATE TABLE IF NOT EXISTS events (
-    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-    type VARCHAR(100) NOT NULL,
-    data TEXT NOT NULL,
-    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-);
-
--- Create indexes for better performance
-CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
-CREATE INDEX IF NOT EXISTS idx_events_user_id ON events(user_id);
-CREATE INDEX IF NOT EXISTS idx_events_type ON events(type);
-CREATE INDEX IF NOT EXISTS idx_events_created_at ON events(created_at);
-
--- Create function to update updated_at timestamp
-CREATE OR REPLACE FUNCTION update_updated_at_column()
-RETURNS TRIGGER AS $$
-BEGIN
-    NEW.updated_at = CURRENT_TIMESTAMP;
-    RETURN NEW;
-END;
-$$ language 'plpgsql';
-
--- Create trigger to automatically update updated_at (if not exists)
-DO $$
-BEGIN
-    IF NOT EXISTS (
-        SELECT 1 FROM pg_trigger 
-        WHERE tgname = 'update_users_updated_at'
-    ) THEN
-        CREATE TRIGGER update_users_updated_at 
-            BEFORE UPDATE ON users 
-            FOR EACH ROW 
-            EXECUTE FUNCTION update_updated_at_column();
-    END IF;
-END $$;
-
--- =============================================
--- AUTHENTICATION AND AUTHORIZATION TABLES
--- =============================================
-
--- Create auth_users table for authentication
-CREATE TABLE IF NOT EXISTS auth_users (
-    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-    email VARCHAR(255) UNIQUE NOT NULL,
-    first_name VARCHAR(100) NOT NULL,
-    last_name VARCHAR(100) NOT NULL,
-    password_hash VARCHAR(255) NOT NULL,
-    role VARCHAR(20) NOT NULL DEFAULT 'user' CHECK (role IN ('admin', 'user', 'readonly')),
-    is_active BOOLEAN NOT NULL DEFAULT true,
-    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-);
-
--- Create refresh_tokens table
-CREATE TABLE IF NOT EXISTS refresh_tokens (
-    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-    user_id UUID NOT NULL REFERENCES auth_users(id) ON DELETE CASCADE,
-    token_hash VARCHAR(255) NOT NULL,
-    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
-    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-);
-
--- Create api_keys table
-CREATE TABLE IF NOT EXISTS api_keys (
-    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-    name VARCHAR(100) NOT NULL,
-    key_hash VARCHAR(255) UNIQUE NOT NULL,
-    permissions TEXT[] NOT NULL DEFAULT '{}',
-    is_active BOOLEAN NOT NULL DEFAULT true,
-    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-    expires_at TIMESTAMP WITH TIME ZONE
-);
-
--- Create indexes for authentication tables
-CREATE INDEX IF NOT EXISTS idx_auth_users_email ON auth_users(email);
-CREATE INDEX IF NOT EXISTS idx_auth_users_role ON auth_users(role);
-CREATE INDEX IF NOT EXISTS idx_auth_users_active ON auth_users(is_active);
-CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens(user_id);
-CREATE INDEX IF NOT EXISTS idx_refresh_tokens_hash ON refresh_tokens(token_hash);
-CREATE INDEX IF NOT EXISTS idx_refresh_tokens_expires ON refresh_tokens(expires_at);
-CREATE INDEX IF NOT EXISTS idx_api_keys_hash ON api_keys(key_hash);
-CREATE INDEX IF NOT EXISTS idx_api_keys_active ON api_keys(is_active);
-
--- Create trigger for auth_users updated_at
-DO $$
-BEGIN
-    IF NOT EXISTS (
-        SELECT 1 FROM pg_trigger 
-        WHERE tgname = 'update_auth_users_updated_at'
-    ) THEN
-        CREATE TRIGGER update_auth_users_updated_at 
-            BEFORE UPDATE ON auth_users 
-            FOR EACH ROW 
-            EXECUTE FUNCTION update_updated_at_column();
-    END IF;
-END $$;
-
--- =============================================
--- DEFAULT ADMIN USER (for initial setup)
--- =============================================
-
--- Insert default admin user (password: admin123456)
--- Note: In production, this should be removed or the password should be changed immediately
-INSERT INTO auth_users (email, first_name, last_name, password_hash, role, is_active) 
-VALUES (
-    'admin@highload-microservice.local',
-    'System',
-    'Administrator',
-    '$2a$10$Hr3FJZCXEB3iknfBJHfPuOOL1IRMfDCBqbmm8tYRQMdnd0MIW6PtO', -- admin123456
-    'admin',
-    true
-) ON CONFLICT (email) DO NOTHING;
-
--- =============================================
--- CLEANUP OLD REFRESH TOKENS (for maintenance)
--- =============================================
-
--- Create function to clean up expired refresh tokens
-CREATE OR REPLACE FUNCTION cleanup_expired_refresh_tokens()
-RETURNS INTEGER AS $$
-DECLARE
-    deleted_count INTEGER;
-BEGIN
-    DELETE FROM refresh_tokens WHERE expires_at < NOW();
-    GET DIAGNOSTICS deleted_count = ROW_COUNT;
-    RETURN deleted_count;
-END;
-$$ LANGUAGE plpgsql;
-
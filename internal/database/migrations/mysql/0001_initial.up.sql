@@ -0,0 +1,172 @@
+-- MySQL 8.0.13+ baseline schema (DB_DRIVER=mysql)
+-- Mirrors the postgres migrations; UUIDs are stored as CHAR(36) and
+-- updated_at is maintained with ON UPDATE instead of triggers.
+
+-- Create users table
+CREATE TABLE IF NOT EXISTS users (
+    id CHAR(36) PRIMARY KEY DEFAULT (UUID()),
+    email VARCHAR(255) UNIQUE NOT NULL,
+    first_name VARCHAR(100) NOT NULL,
+    last_name VARCHAR(100) NOT NULL,
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6),
+    updated_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+    deleted_at TIMESTAMP(6) NULL,
+    INDEX idx_users_is_active (is_active),
+    INDEX idx_users_deleted_at (deleted_at),
+    INDEX idx_users_created_at (created_at)
+);
+
+-- Create events table
+CREATE TABLE IF NOT EXISTS events (
+    id CHAR(36) PRIMARY KEY DEFAULT (UUID()),
+    user_id CHAR(36) NOT NULL,
+    type VARCHAR(100) NOT NULL,
+    data TEXT NOT NULL,
+    created_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6),
+    INDEX idx_events_user_id (user_id),
+    INDEX idx_events_type (type),
+    INDEX idx_events_created_at (created_at),
+    CONSTRAINT fk_events_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- =============================================
+-- AUTHENTICATION AND AUTHORIZATION TABLES
+-- =============================================
+
+-- Create auth_users table for authentication
+CREATE TABLE IF NOT EXISTS auth_users (
+    id CHAR(36) PRIMARY KEY DEFAULT (UUID()),
+    email VARCHAR(255) UNIQUE NOT NULL,
+    first_name VARCHAR(100) NOT NULL,
+    last_name VARCHAR(100) NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+    role VARCHAR(20) NOT NULL DEFAULT 'user' CHECK (role IN ('admin', 'user', 'readonly')),
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    failed_login_attempts INT NOT NULL DEFAULT 0,
+    first_failed_login_at TIMESTAMP(6) NULL,
+    locked_until TIMESTAMP(6) NULL,
+    created_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6),
+    updated_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+    INDEX idx_auth_users_role (role),
+    INDEX idx_auth_users_active (is_active)
+);
+
+-- Create refresh_tokens table
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id CHAR(36) PRIMARY KEY DEFAULT (UUID()),
+    user_id CHAR(36) NOT NULL,
+    token_hash VARCHAR(255) NOT NULL,
+    family_id CHAR(36) NULL,
+    expires_at TIMESTAMP(6) NOT NULL,
+    revoked_at TIMESTAMP(6) NULL,
+    created_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6),
+    INDEX idx_refresh_tokens_user_id (user_id),
+    INDEX idx_refresh_tokens_family (family_id),
+    INDEX idx_refresh_tokens_hash (token_hash),
+    INDEX idx_refresh_tokens_expires (expires_at),
+    CONSTRAINT fk_refresh_tokens_user FOREIGN KEY (user_id) REFERENCES auth_users(id) ON DELETE CASCADE
+);
+
+-- Create api_keys table
+-- permissions uses the same '{a,b}' text encoding as the Postgres array type
+CREATE TABLE IF NOT EXISTS api_keys (
+    id CHAR(36) PRIMARY KEY DEFAULT (UUID()),
+    name VARCHAR(100) NOT NULL,
+    key_hash VARCHAR(255) UNIQUE NOT NULL,
+    key_prefix VARCHAR(16) NOT NULL DEFAULT '',
+    previous_key_hash VARCHAR(255) NULL,
+    previous_expires_at TIMESTAMP(6) NULL,
+    permissions TEXT NOT NULL,
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6),
+    expires_at TIMESTAMP(6) NULL,
+    last_used_at TIMESTAMP(6) NULL,
+    revoked_at TIMESTAMP(6) NULL,
+    rotated_at TIMESTAMP(6) NULL,
+    rate_limit_per_minute INT NOT NULL DEFAULT 0,
+    monthly_quota BIGINT NOT NULL DEFAULT 0,
+    INDEX idx_api_keys_active (is_active),
+    INDEX idx_api_keys_previous_hash (previous_key_hash)
+);
+
+-- =============================================
+-- TRANSACTIONAL OUTBOX
+-- =============================================
+
+-- Outbox table; column layout matches Debezium's outbox event router
+CREATE TABLE IF NOT EXISTS outbox (
+    id CHAR(36) PRIMARY KEY,
+    aggregate_type VARCHAR(255) NOT NULL,
+    aggregate_id VARCHAR(255) NOT NULL,
+    type VARCHAR(255) NOT NULL,
+    payload JSON NOT NULL,
+    headers JSON NOT NULL,
+    created_at TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+    published_at TIMESTAMP(6) NULL,
+    INDEX idx_outbox_published_created (published_at, created_at)
+);
+
+-- Security events written by the security auditor
+CREATE TABLE IF NOT EXISTS security_events (
+    id CHAR(36) PRIMARY KEY,
+    occurred_at TIMESTAMP(6) NOT NULL,
+    event_type VARCHAR(64) NOT NULL,
+    severity VARCHAR(16) NOT NULL,
+    user_id CHAR(36) NULL,
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL,
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
+    endpoint TEXT NOT NULL,
+    method VARCHAR(16) NOT NULL DEFAULT '',
+    status INT NOT NULL DEFAULT 0,
+    details JSON NOT NULL,
+    risk_score INT NOT NULL DEFAULT 0,
+    blocked BOOLEAN NOT NULL DEFAULT FALSE,
+    INDEX idx_security_events_occurred_at (occurred_at),
+    INDEX idx_security_events_type (event_type, occurred_at),
+    INDEX idx_security_events_severity (severity, occurred_at),
+    INDEX idx_security_events_ip (ip_address, occurred_at)
+);
+
+-- Alerts raised by the security analyzers
+CREATE TABLE IF NOT EXISTS security_alerts (
+    id CHAR(36) PRIMARY KEY,
+    created_at TIMESTAMP(6) NOT NULL,
+    severity VARCHAR(16) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL,
+    event_ids JSON NOT NULL,
+    risk_score INT NOT NULL DEFAULT 0,
+    actions JSON NOT NULL,
+    metadata JSON NOT NULL,
+    INDEX idx_security_alerts_created_at (created_at),
+    INDEX idx_security_alerts_severity (severity, created_at)
+);
+
+-- Operator-managed IP blocklist/allowlist entries
+CREATE TABLE IF NOT EXISTS ip_rules (
+    id CHAR(36) PRIMARY KEY,
+    cidr VARCHAR(64) NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    reason TEXT NOT NULL,
+    created_by CHAR(36),
+    created_at TIMESTAMP(6) NOT NULL,
+    expires_at TIMESTAMP(6) NULL
+);
+
+-- =============================================
+-- DEFAULT ADMIN USER (for initial setup)
+-- =============================================
+
+-- Insert default admin user (password: admin123456)
+-- Note: In production, this should be removed or the password should be changed immediately
+INSERT IGNORE INTO auth_users (email, first_name, last_name, password_hash, role, is_active)
+VALUES (
+    'admin@highload-microservice.local',
+    'System',
+    'Administrator',
+    '$2a$10$Hr3FJZCXEB3iknfBJHfPuOOL1IRMfDCBqbmm8tYRQMdnd0MIW6PtO', -- admin123456
+    'admin',
+    true
+);
@@ -0,0 +1,7 @@
+-- Payload schemas registered per event type through the admin API
+CREATE TABLE IF NOT EXISTS event_schemas (
+    event_type VARCHAR(100) PRIMARY KEY,
+    definition TEXT NOT NULL,
+    updated_by CHAR(36),
+    updated_at TIMESTAMP(6) NOT NULL
+);
@@ -0,0 +1,11 @@
+-- History of changes to users: who changed which fields, and from what
+CREATE TABLE IF NOT EXISTS user_audit (
+    id CHAR(36) PRIMARY KEY,
+    user_id CHAR(36) NOT NULL,
+    action VARCHAR(32) NOT NULL,
+    actor_id CHAR(36),
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
+    changes TEXT NOT NULL,
+    created_at TIMESTAMP(6) NOT NULL,
+    INDEX idx_user_audit_user (user_id, created_at)
+);
@@ -0,0 +1,4 @@
+ALTER TABLE refresh_tokens
+    DROP COLUMN login_at,
+    DROP COLUMN ip_address,
+    DROP COLUMN user_agent;
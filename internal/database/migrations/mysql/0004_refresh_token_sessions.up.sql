@@ -0,0 +1,5 @@
+-- Session metadata captured at login and carried over on rotation
+ALTER TABLE refresh_tokens
+    ADD COLUMN user_agent VARCHAR(512) NOT NULL DEFAULT '',
+    ADD COLUMN ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    ADD COLUMN login_at TIMESTAMP(6) NULL;
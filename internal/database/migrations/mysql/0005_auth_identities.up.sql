@@ -0,0 +1,10 @@
+-- Accounts at external identity providers (OIDC) linked to auth_users
+CREATE TABLE IF NOT EXISTS auth_identities (
+    issuer VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    user_id CHAR(36) NOT NULL,
+    created_at TIMESTAMP(6) NOT NULL,
+    PRIMARY KEY (issuer, subject),
+    INDEX idx_auth_identities_user (user_id),
+    CONSTRAINT fk_auth_identities_user FOREIGN KEY (user_id) REFERENCES auth_users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,33 @@
+-- Outbound webhook subscriptions; an empty event_types receives every event.
+-- event_types uses the same '{a,b}' text encoding as the Postgres array type
+CREATE TABLE IF NOT EXISTS webhooks (
+    id CHAR(36) PRIMARY KEY,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    event_types TEXT NOT NULL,
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_by CHAR(36),
+    created_at TIMESTAMP(6) NOT NULL,
+    updated_at TIMESTAMP(6) NOT NULL
+);
+
+-- One row per event and subscription; attempts are retried until delivered or failed
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id CHAR(36) PRIMARY KEY,
+    webhook_id CHAR(36) NOT NULL,
+    event_id CHAR(36) NOT NULL,
+    event_type VARCHAR(255) NOT NULL,
+    payload TEXT NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP(6) NOT NULL,
+    last_status_code INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL,
+    created_at TIMESTAMP(6) NOT NULL,
+    updated_at TIMESTAMP(6) NOT NULL,
+    delivered_at TIMESTAMP(6) NULL,
+    UNIQUE KEY uq_webhook_deliveries_event (webhook_id, event_id),
+    INDEX idx_webhook_deliveries_due (status, next_attempt_at),
+    INDEX idx_webhook_deliveries_webhook (webhook_id, created_at),
+    CONSTRAINT fk_webhook_deliveries_webhook FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+);
@@ -0,0 +1,7 @@
+ALTER TABLE security_events
+    DROP INDEX idx_security_events_asn,
+    DROP INDEX idx_security_events_country,
+    DROP COLUMN as_org,
+    DROP COLUMN asn,
+    DROP COLUMN city,
+    DROP COLUMN country;
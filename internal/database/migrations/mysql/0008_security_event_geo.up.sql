@@ -0,0 +1,8 @@
+-- Where security events came from, filled when a GeoIP database is configured
+ALTER TABLE security_events
+    ADD COLUMN country VARCHAR(2) NOT NULL DEFAULT '',
+    ADD COLUMN city VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN asn BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN as_org VARCHAR(255) NOT NULL DEFAULT '',
+    ADD INDEX idx_security_events_country (occurred_at, country),
+    ADD INDEX idx_security_events_asn (occurred_at, asn);
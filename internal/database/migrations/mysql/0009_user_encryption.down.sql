@@ -0,0 +1,7 @@
+-- Narrowing the columns fails while encrypted rows remain
+ALTER TABLE users
+    DROP INDEX idx_users_email_hash,
+    DROP COLUMN email_hash,
+    MODIFY last_name VARCHAR(100) NOT NULL,
+    MODIFY first_name VARCHAR(100) NOT NULL,
+    MODIFY email VARCHAR(255) NOT NULL;
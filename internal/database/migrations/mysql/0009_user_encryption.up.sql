@@ -0,0 +1,10 @@
+-- Encrypted email and names (USER_ENCRYPTION_ENABLED) are longer than the
+-- plaintext; email_hash is the blind index that keeps email lookups and
+-- uniqueness working on ciphertexts. VARCHAR(768) is the longest email
+-- that still fits its unique index.
+ALTER TABLE users
+    MODIFY email VARCHAR(768) NOT NULL,
+    MODIFY first_name VARCHAR(1024) NOT NULL,
+    MODIFY last_name VARCHAR(1024) NOT NULL,
+    ADD COLUMN email_hash CHAR(64) NULL,
+    ADD UNIQUE INDEX idx_users_email_hash (email_hash);
@@ -0,0 +1,18 @@
+-- Runs of the event retention job, which archives events older than the
+-- retention period and deletes them
+CREATE TABLE IF NOT EXISTS event_retention_runs (
+    id CHAR(36) PRIMARY KEY,
+    status VARCHAR(16) NOT NULL,
+    source VARCHAR(16) NOT NULL,
+    started_by CHAR(36) NULL,
+    cutoff TIMESTAMP(6) NOT NULL,
+    archived BIGINT NOT NULL DEFAULT 0,
+    deleted BIGINT NOT NULL DEFAULT 0,
+    archives INT NOT NULL DEFAULT 0,
+    archive_location TEXT NOT NULL,
+    error TEXT NOT NULL,
+    started_at TIMESTAMP(6) NOT NULL,
+    updated_at TIMESTAMP(6) NOT NULL,
+    finished_at TIMESTAMP(6) NULL,
+    INDEX idx_event_retention_runs_started_at (started_at)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE user_audit DROP INDEX idx_user_audit_created_at;
+DROP TABLE IF EXISTS audit_archives;
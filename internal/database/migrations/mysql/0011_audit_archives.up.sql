@@ -0,0 +1,20 @@
+-- Manifest of the archives of security events, security alerts and user
+-- audit records exported to object storage. The latest archive of a source
+-- is the cursor the next export continues from.
+CREATE TABLE IF NOT EXISTS audit_archives (
+    id CHAR(36) PRIMARY KEY,
+    source VARCHAR(32) NOT NULL,
+    object_key TEXT NOT NULL,
+    location TEXT NOT NULL,
+    records INT NOT NULL,
+    bytes BIGINT NOT NULL,
+    sha256 VARCHAR(64) NOT NULL,
+    first_at TIMESTAMP(6) NOT NULL,
+    last_at TIMESTAMP(6) NOT NULL,
+    last_id VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP(6) NOT NULL,
+    INDEX idx_audit_archives_source (source, last_at)
+);
+
+-- Exports read user_audit in creation order
+ALTER TABLE user_audit ADD INDEX idx_user_audit_created_at (created_at, id);
@@ -0,0 +1,22 @@
+-- Sampled HTTP requests and responses with redacted bodies, kept for
+-- debugging and deleted after HTTP_RECORDING_RETENTION_HOURS
+CREATE TABLE IF NOT EXISTS http_recordings (
+    id CHAR(36) PRIMARY KEY,
+    recorded_at TIMESTAMP(6) NOT NULL,
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
+    method VARCHAR(16) NOT NULL,
+    path TEXT NOT NULL,
+    route TEXT NOT NULL,
+    query TEXT NOT NULL,
+    status INT NOT NULL,
+    duration_ms BIGINT NOT NULL,
+    user_id CHAR(36) NULL,
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    request_headers JSON NOT NULL,
+    request_body MEDIUMTEXT NOT NULL,
+    response_headers JSON NOT NULL,
+    response_body MEDIUMTEXT NOT NULL,
+    truncated BOOLEAN NOT NULL DEFAULT FALSE,
+    INDEX idx_http_recordings_recorded_at (recorded_at),
+    INDEX idx_http_recordings_request_id (request_id)
+);
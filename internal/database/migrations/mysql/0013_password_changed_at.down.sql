@@ -0,0 +1,2 @@
+ALTER TABLE auth_users
+    DROP COLUMN password_changed_at;
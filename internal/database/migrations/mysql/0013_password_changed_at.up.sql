@@ -0,0 +1,4 @@
+-- When the password was last set, for PASSWORD_MAX_AGE_DAYS. Existing
+-- passwords count from the migration.
+ALTER TABLE auth_users
+    ADD COLUMN password_changed_at TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6);
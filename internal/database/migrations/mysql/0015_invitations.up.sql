@@ -0,0 +1,20 @@
+-- Invitations to create an account. Only the SHA-256 hash of the emailed
+-- token is stored; a new invitation revokes the pending ones of the email.
+CREATE TABLE IF NOT EXISTS invitations (
+    id CHAR(36) PRIMARY KEY,
+    email VARCHAR(255) NOT NULL,
+    first_name VARCHAR(100) NOT NULL DEFAULT '',
+    last_name VARCHAR(100) NOT NULL DEFAULT '',
+    role VARCHAR(50) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    invited_by CHAR(36) NULL,
+    user_id CHAR(36) NULL,
+    expires_at TIMESTAMP(6) NOT NULL,
+    created_at TIMESTAMP(6) NOT NULL,
+    accepted_at TIMESTAMP(6) NULL,
+    INDEX idx_invitations_email (email),
+    INDEX idx_invitations_status_created (status, created_at),
+    CONSTRAINT fk_invitations_invited_by FOREIGN KEY (invited_by) REFERENCES auth_users(id) ON DELETE SET NULL,
+    CONSTRAINT fk_invitations_user FOREIGN KEY (user_id) REFERENCES auth_users(id) ON DELETE SET NULL
+);
@@ -0,0 +1,2 @@
+ALTER TABLE auth_users
+    DROP COLUMN pending_email;
@@ -0,0 +1,10 @@
+-- IDs of consumed events, so that redelivered events are skipped
+-- (CONSUMER_DEDUP_BACKEND=database). A row with processed_at NULL is a claim
+-- held until claimed_until.
+CREATE TABLE IF NOT EXISTS processed_events (
+    event_id CHAR(36) PRIMARY KEY,
+    claimed_until TIMESTAMP(6) NULL,
+    processed_at TIMESTAMP(6) NULL,
+    expires_at TIMESTAMP(6) NOT NULL,
+    INDEX idx_processed_events_expires_at (expires_at)
+);
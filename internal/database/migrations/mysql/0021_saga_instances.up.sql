@@ -0,0 +1,18 @@
+-- Runs of multi-step workflows started by consumed events, one per saga and
+-- event. Running and compensating rows without progress are resumed.
+CREATE TABLE IF NOT EXISTS saga_instances (
+    id CHAR(36) PRIMARY KEY,
+    saga VARCHAR(100) NOT NULL,
+    event_id CHAR(36) NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    user_id CHAR(36) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    step INT NOT NULL DEFAULT 0,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL,
+    created_at TIMESTAMP(6) NOT NULL,
+    updated_at TIMESTAMP(6) NOT NULL,
+    UNIQUE KEY uq_saga_instances_saga_event (saga, event_id),
+    INDEX idx_saga_instances_status_updated_at (status, updated_at),
+    INDEX idx_saga_instances_created_at (created_at)
+);
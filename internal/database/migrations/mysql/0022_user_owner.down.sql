@@ -0,0 +1,4 @@
+ALTER TABLE users
+    DROP FOREIGN KEY fk_users_auth_user,
+    DROP INDEX idx_users_auth_user_id,
+    DROP COLUMN auth_user_id;
@@ -0,0 +1,7 @@
+-- The account that owns a user record, for the routes a user may call on
+-- their own record. users and auth_users have independent IDs; records
+-- without an owner are open to admins only.
+ALTER TABLE users
+    ADD COLUMN auth_user_id CHAR(36) NULL,
+    ADD INDEX idx_users_auth_user_id (auth_user_id),
+    ADD CONSTRAINT fk_users_auth_user FOREIGN KEY (auth_user_id) REFERENCES auth_users(id) ON DELETE SET NULL;
@@ -0,0 +1,12 @@
+-- Drops the whole schema, including all data
+DROP FUNCTION IF EXISTS cleanup_expired_refresh_tokens();
+DROP TABLE IF EXISTS outbox;
+DROP TABLE IF EXISTS ip_rules;
+DROP TABLE IF EXISTS security_alerts;
+DROP TABLE IF EXISTS security_events;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS auth_users;
+DROP TABLE IF EXISTS events;
+DROP TABLE IF EXISTS users;
+DROP FUNCTION IF EXISTS update_updated_at_column();
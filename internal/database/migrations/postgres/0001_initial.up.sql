@@ -0,0 +1,261 @@
+-- Baseline schema. Statements are idempotent so databases created before
+-- versioned migrations adopt version 1 without changes.
+
+-- Ensure required extensions
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+-- Create users table
+CREATE TABLE IF NOT EXISTS users (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    email VARCHAR(255) UNIQUE NOT NULL,
+    first_name VARCHAR(100) NOT NULL,
+    last_name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Deactivated users are hidden from normal reads
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_active BOOLEAN NOT NULL DEFAULT true;
+
+-- Soft-deleted users keep their row (and email) until purged
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+-- Create events table
+CREATE TABLE IF NOT EXISTS events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(100) NOT NULL,
+    data TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
+CREATE INDEX IF NOT EXISTS idx_users_is_active ON users(is_active);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_users_created_at ON users(created_at);
+
+-- Trigram indexes back the case-insensitive ?q= substring search on users
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS idx_users_email_trgm ON users USING GIN (LOWER(email) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_users_first_name_trgm ON users USING GIN (LOWER(first_name) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_users_last_name_trgm ON users USING GIN (LOWER(last_name) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_events_user_id ON events(user_id);
+CREATE INDEX IF NOT EXISTS idx_events_type ON events(type);
+CREATE INDEX IF NOT EXISTS idx_events_created_at ON events(created_at);
+
+-- Create function to update updated_at timestamp
+CREATE OR REPLACE FUNCTION update_updated_at_column()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+-- Create trigger to automatically update updated_at (if not exists)
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM pg_trigger 
+        WHERE tgname = 'update_users_updated_at'
+    ) THEN
+        CREATE TRIGGER update_users_updated_at 
+            BEFORE UPDATE ON users 
+            FOR EACH ROW 
+            EXECUTE FUNCTION update_updated_at_column();
+    END IF;
+END $$;
+
+-- =============================================
+-- AUTHENTICATION AND AUTHORIZATION TABLES
+-- =============================================
+
+-- Create auth_users table for authentication
+CREATE TABLE IF NOT EXISTS auth_users (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    email VARCHAR(255) UNIQUE NOT NULL,
+    first_name VARCHAR(100) NOT NULL,
+    last_name VARCHAR(100) NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+    role VARCHAR(20) NOT NULL DEFAULT 'user' CHECK (role IN ('admin', 'user', 'readonly')),
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Account lockout state (see services.LockoutConfig)
+ALTER TABLE auth_users ADD COLUMN IF NOT EXISTS failed_login_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE auth_users ADD COLUMN IF NOT EXISTS first_failed_login_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE auth_users ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP WITH TIME ZONE;
+
+-- Create refresh_tokens table
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES auth_users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Refresh token rotation: tokens issued by one login share a family
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS family_id UUID;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMP WITH TIME ZONE;
+
+-- Create api_keys table
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(100) NOT NULL,
+    key_hash VARCHAR(255) UNIQUE NOT NULL,
+    permissions TEXT[] NOT NULL DEFAULT '{}',
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE
+);
+
+-- API key lifecycle: masked listing, usage tracking, revocation and rotation
+-- with a grace period for the previous secret
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS key_prefix VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS previous_key_hash VARCHAR(255);
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS previous_expires_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS rotated_at TIMESTAMP WITH TIME ZONE;
+
+-- Per-key rate limit (requests/minute, 0 = global limit) and monthly quota
+-- (0 = unlimited); usage counters live in the cache
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS rate_limit_per_minute INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS monthly_quota BIGINT NOT NULL DEFAULT 0;
+
+-- Create indexes for authentication tables
+CREATE INDEX IF NOT EXISTS idx_auth_users_email ON auth_users(email);
+CREATE INDEX IF NOT EXISTS idx_auth_users_role ON auth_users(role);
+CREATE INDEX IF NOT EXISTS idx_auth_users_active ON auth_users(is_active);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_hash ON refresh_tokens(token_hash);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_expires ON refresh_tokens(expires_at);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id);
+CREATE INDEX IF NOT EXISTS idx_api_keys_hash ON api_keys(key_hash);
+CREATE INDEX IF NOT EXISTS idx_api_keys_active ON api_keys(is_active);
+CREATE INDEX IF NOT EXISTS idx_api_keys_previous_hash ON api_keys(previous_key_hash);
+
+-- Create trigger for auth_users updated_at
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM pg_trigger 
+        WHERE tgname = 'update_auth_users_updated_at'
+    ) THEN
+        CREATE TRIGGER update_auth_users_updated_at 
+            BEFORE UPDATE ON auth_users 
+            FOR EACH ROW 
+            EXECUTE FUNCTION update_updated_at_column();
+    END IF;
+END $$;
+
+-- =============================================
+-- SECURITY AUDIT
+-- =============================================
+
+-- Security events written by the security auditor; user_id has no foreign
+-- key so the audit trail survives user deletion
+CREATE TABLE IF NOT EXISTS security_events (
+    id UUID PRIMARY KEY,
+    occurred_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    event_type VARCHAR(64) NOT NULL,
+    severity VARCHAR(16) NOT NULL,
+    user_id UUID,
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
+    endpoint TEXT NOT NULL DEFAULT '',
+    method VARCHAR(16) NOT NULL DEFAULT '',
+    status INTEGER NOT NULL DEFAULT 0,
+    details JSONB NOT NULL DEFAULT '{}',
+    risk_score INTEGER NOT NULL DEFAULT 0,
+    blocked BOOLEAN NOT NULL DEFAULT false
+);
+
+CREATE INDEX IF NOT EXISTS idx_security_events_occurred_at ON security_events(occurred_at);
+CREATE INDEX IF NOT EXISTS idx_security_events_type ON security_events(event_type, occurred_at);
+CREATE INDEX IF NOT EXISTS idx_security_events_severity ON security_events(severity, occurred_at);
+CREATE INDEX IF NOT EXISTS idx_security_events_ip ON security_events(ip_address, occurred_at);
+
+-- Alerts raised by the security analyzers
+CREATE TABLE IF NOT EXISTS security_alerts (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    severity VARCHAR(16) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    event_ids JSONB NOT NULL DEFAULT '[]',
+    risk_score INTEGER NOT NULL DEFAULT 0,
+    actions JSONB NOT NULL DEFAULT '[]',
+    metadata JSONB NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS idx_security_alerts_created_at ON security_alerts(created_at);
+CREATE INDEX IF NOT EXISTS idx_security_alerts_severity ON security_alerts(severity, created_at);
+
+-- Operator-managed IP blocklist/allowlist entries
+CREATE TABLE IF NOT EXISTS ip_rules (
+    id UUID PRIMARY KEY,
+    cidr VARCHAR(64) NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_by UUID,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE
+);
+
+-- =============================================
+-- TRANSACTIONAL OUTBOX
+-- =============================================
+
+-- Outbox table; column layout matches Debezium's outbox event router
+-- (see internal/outbox for the connector configuration)
+CREATE TABLE IF NOT EXISTS outbox (
+    id UUID PRIMARY KEY,
+    aggregate_type VARCHAR(255) NOT NULL,
+    aggregate_id VARCHAR(255) NOT NULL,
+    type VARCHAR(255) NOT NULL,
+    payload JSONB NOT NULL,
+    headers JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    published_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_unpublished ON outbox(created_at) WHERE published_at IS NULL;
+
+-- =============================================
+-- DEFAULT ADMIN USER (for initial setup)
+-- =============================================
+
+-- Insert default admin user (password: admin123456)
+-- Note: In production, this should be removed or the password should be changed immediately
+INSERT INTO auth_users (email, first_name, last_name, password_hash, role, is_active) 
+VALUES (
+    'admin@highload-microservice.local',
+    'System',
+    'Administrator',
+    '$2a$10$Hr3FJZCXEB3iknfBJHfPuOOL1IRMfDCBqbmm8tYRQMdnd0MIW6PtO', -- admin123456
+    'admin',
+    true
+) ON CONFLICT (email) DO NOTHING;
+
+-- =============================================
+-- CLEANUP OLD REFRESH TOKENS (for maintenance)
+-- =============================================
+
+-- Create function to clean up expired refresh tokens
+CREATE OR REPLACE FUNCTION cleanup_expired_refresh_tokens()
+RETURNS INTEGER AS $$
+DECLARE
+    deleted_count INTEGER;
+BEGIN
+    DELETE FROM refresh_tokens WHERE expires_at < NOW();
+    GET DIAGNOSTICS deleted_count = ROW_COUNT;
+    RETURN deleted_count;
+END;
+$$ LANGUAGE plpgsql;
+
@@ -0,0 +1,28 @@
+-- Milliseconds from creation until the consumer first processed the event
+ALTER TABLE events ADD COLUMN IF NOT EXISTS processing_ms BIGINT;
+
+-- Hourly event counts per type and processing latency bucket: latency_le_ms
+-- is the upper bound of the bucket, 0 for events not processed yet and -1
+-- for events slower than the largest bound
+CREATE TABLE IF NOT EXISTS event_stats_hourly (
+    bucket TIMESTAMP WITH TIME ZONE NOT NULL,
+    type VARCHAR(100) NOT NULL,
+    latency_le_ms BIGINT NOT NULL,
+    events BIGINT NOT NULL,
+    PRIMARY KEY (bucket, type, latency_le_ms)
+);
+
+-- Hourly event counts per user, for the most active users
+CREATE TABLE IF NOT EXISTS event_stats_user_hourly (
+    bucket TIMESTAMP WITH TIME ZONE NOT NULL,
+    user_id UUID NOT NULL,
+    events BIGINT NOT NULL,
+    PRIMARY KEY (bucket, user_id)
+);
+
+-- Progress of the rollup job
+CREATE TABLE IF NOT EXISTS event_stats_rollup (
+    name VARCHAR(50) PRIMARY KEY,
+    rolled_up_to TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_security_events_asn;
+DROP INDEX IF EXISTS idx_security_events_country;
+ALTER TABLE security_events DROP COLUMN IF EXISTS as_org;
+ALTER TABLE security_events DROP COLUMN IF EXISTS asn;
+ALTER TABLE security_events DROP COLUMN IF EXISTS city;
+ALTER TABLE security_events DROP COLUMN IF EXISTS country;
@@ -0,0 +1,6 @@
+-- Narrowing the columns fails while encrypted rows remain
+DROP INDEX IF EXISTS idx_users_email_hash;
+ALTER TABLE users DROP COLUMN IF EXISTS email_hash;
+ALTER TABLE users ALTER COLUMN last_name TYPE VARCHAR(100);
+ALTER TABLE users ALTER COLUMN first_name TYPE VARCHAR(100);
+ALTER TABLE users ALTER COLUMN email TYPE VARCHAR(255);
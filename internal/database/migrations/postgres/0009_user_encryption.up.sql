@@ -0,0 +1,9 @@
+-- Encrypted email and names (USER_ENCRYPTION_ENABLED) are longer than the
+-- plaintext; email_hash is the blind index that keeps email lookups and
+-- uniqueness working on ciphertexts
+ALTER TABLE users ALTER COLUMN email TYPE TEXT;
+ALTER TABLE users ALTER COLUMN first_name TYPE TEXT;
+ALTER TABLE users ALTER COLUMN last_name TYPE TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_hash VARCHAR(64);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_hash ON users(email_hash);
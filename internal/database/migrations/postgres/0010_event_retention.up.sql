@@ -0,0 +1,19 @@
+-- Runs of the event retention job, which archives events older than the
+-- retention period and deletes them
+CREATE TABLE IF NOT EXISTS event_retention_runs (
+    id UUID PRIMARY KEY,
+    status VARCHAR(16) NOT NULL,
+    source VARCHAR(16) NOT NULL,
+    started_by UUID,
+    cutoff TIMESTAMP WITH TIME ZONE NOT NULL,
+    archived BIGINT NOT NULL DEFAULT 0,
+    deleted BIGINT NOT NULL DEFAULT 0,
+    archives INTEGER NOT NULL DEFAULT 0,
+    archive_location TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_retention_runs_started_at ON event_retention_runs(started_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_user_audit_created_at;
+DROP TABLE IF EXISTS audit_archives;
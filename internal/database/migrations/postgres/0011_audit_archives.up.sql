@@ -0,0 +1,21 @@
+-- Manifest of the archives of security events, security alerts and user
+-- audit records exported to object storage. The latest archive of a source
+-- is the cursor the next export continues from.
+CREATE TABLE IF NOT EXISTS audit_archives (
+    id UUID PRIMARY KEY,
+    source VARCHAR(32) NOT NULL,
+    object_key TEXT NOT NULL,
+    location TEXT NOT NULL,
+    records INTEGER NOT NULL,
+    bytes BIGINT NOT NULL,
+    sha256 VARCHAR(64) NOT NULL,
+    first_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_id VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_archives_source ON audit_archives(source, last_at);
+
+-- Exports read user_audit in creation order
+CREATE INDEX IF NOT EXISTS idx_user_audit_created_at ON user_audit(created_at, id);
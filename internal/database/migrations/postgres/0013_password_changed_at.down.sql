@@ -0,0 +1 @@
+ALTER TABLE auth_users DROP COLUMN IF EXISTS password_changed_at;
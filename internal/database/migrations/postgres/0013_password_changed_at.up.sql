@@ -0,0 +1,3 @@
+-- When the password was last set, for PASSWORD_MAX_AGE_DAYS. Existing
+-- passwords count from the migration.
+ALTER TABLE auth_users ADD COLUMN IF NOT EXISTS password_changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW();
@@ -0,0 +1 @@
+ALTER TABLE auth_users DROP COLUMN IF EXISTS email_verified_at;
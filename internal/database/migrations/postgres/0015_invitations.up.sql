@@ -0,0 +1,19 @@
+-- Invitations to create an account. Only the SHA-256 hash of the emailed
+-- token is stored; a new invitation revokes the pending ones of the email.
+CREATE TABLE IF NOT EXISTS invitations (
+    id UUID PRIMARY KEY,
+    email VARCHAR(255) NOT NULL,
+    first_name VARCHAR(100) NOT NULL DEFAULT '',
+    last_name VARCHAR(100) NOT NULL DEFAULT '',
+    role VARCHAR(50) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending', -- pending, accepted or revoked
+    invited_by UUID REFERENCES auth_users(id) ON DELETE SET NULL,
+    user_id UUID REFERENCES auth_users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    accepted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_invitations_email ON invitations(LOWER(email));
+CREATE INDEX IF NOT EXISTS idx_invitations_status_created ON invitations(status, created_at DESC);
@@ -0,0 +1 @@
+ALTER TABLE auth_users DROP COLUMN IF EXISTS pending_email;
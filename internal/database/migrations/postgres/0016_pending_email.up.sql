@@ -0,0 +1,4 @@
+-- A new email requested through the profile, applied once the link sent to
+-- it is followed. Requesting another change replaces it, which invalidates
+-- earlier links.
+ALTER TABLE auth_users ADD COLUMN IF NOT EXISTS pending_email VARCHAR(255);
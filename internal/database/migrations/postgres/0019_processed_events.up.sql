@@ -0,0 +1,11 @@
+-- IDs of consumed events, so that redelivered events are skipped
+-- (CONSUMER_DEDUP_BACKEND=database). A row with processed_at NULL is a claim
+-- held until claimed_until.
+CREATE TABLE IF NOT EXISTS processed_events (
+    event_id UUID PRIMARY KEY,
+    claimed_until TIMESTAMP WITH TIME ZONE,
+    processed_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_processed_events_expires_at ON processed_events(expires_at);
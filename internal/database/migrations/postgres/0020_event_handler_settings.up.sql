@@ -0,0 +1,8 @@
+-- Event handlers enabled or disabled through /admin/event-handlers. Handlers
+-- without a row follow EVENT_HANDLERS_DISABLED.
+CREATE TABLE IF NOT EXISTS event_handler_settings (
+    name VARCHAR(100) PRIMARY KEY,
+    enabled BOOLEAN NOT NULL,
+    updated_by UUID,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
@@ -0,0 +1,19 @@
+-- Runs of multi-step workflows started by consumed events, one per saga and
+-- event. Running and compensating rows without progress are resumed.
+CREATE TABLE IF NOT EXISTS saga_instances (
+    id UUID PRIMARY KEY,
+    saga VARCHAR(100) NOT NULL,
+    event_id UUID NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    user_id UUID NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    step INTEGER NOT NULL DEFAULT 0,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    UNIQUE (saga, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_saga_instances_status_updated_at ON saga_instances(status, updated_at);
+CREATE INDEX IF NOT EXISTS idx_saga_instances_created_at ON saga_instances(created_at);
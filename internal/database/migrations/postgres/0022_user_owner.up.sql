@@ -0,0 +1,5 @@
+-- The account that owns a user record, for the routes a user may call on
+-- their own record. users and auth_users have independent IDs; records
+-- without an owner are open to admins only.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS auth_user_id UUID REFERENCES auth_users(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_users_auth_user_id ON users(auth_user_id);
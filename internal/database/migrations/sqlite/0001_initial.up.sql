@@ -0,0 +1,186 @@
+-- SQLite 3.35+ baseline schema (DB_DRIVER=sqlite, used by DEV_MODE)
+-- Mirrors the postgres migrations; UUIDs are stored as TEXT, generated by
+-- the random v4 expression below when not supplied, and updated_at is
+-- maintained with triggers. Column lengths are not enforced by SQLite.
+
+-- Create users table
+CREATE TABLE IF NOT EXISTS users (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    email VARCHAR(255) UNIQUE NOT NULL,
+    first_name VARCHAR(100) NOT NULL,
+    last_name VARCHAR(100) NOT NULL,
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP NULL
+);
+CREATE INDEX IF NOT EXISTS idx_users_is_active ON users(is_active);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_users_created_at ON users(created_at);
+
+CREATE TRIGGER IF NOT EXISTS update_users_updated_at
+AFTER UPDATE ON users FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE users SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+-- Create events table. The constraint text matches what
+-- EVENT_USER_ON_DELETE rewrites; see the sqlite dialect.
+CREATE TABLE IF NOT EXISTS events (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    user_id TEXT NOT NULL,
+    type VARCHAR(100) NOT NULL,
+    data TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_events_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_events_user_id ON events(user_id);
+CREATE INDEX IF NOT EXISTS idx_events_type ON events(type);
+CREATE INDEX IF NOT EXISTS idx_events_created_at ON events(created_at);
+
+-- =============================================
+-- AUTHENTICATION AND AUTHORIZATION TABLES
+-- =============================================
+
+-- Create auth_users table for authentication
+CREATE TABLE IF NOT EXISTS auth_users (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    email VARCHAR(255) UNIQUE NOT NULL,
+    first_name VARCHAR(100) NOT NULL,
+    last_name VARCHAR(100) NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+    role VARCHAR(20) NOT NULL DEFAULT 'user' CHECK (role IN ('admin', 'user', 'readonly')),
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    failed_login_attempts INTEGER NOT NULL DEFAULT 0,
+    first_failed_login_at TIMESTAMP NULL,
+    locked_until TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_auth_users_role ON auth_users(role);
+CREATE INDEX IF NOT EXISTS idx_auth_users_active ON auth_users(is_active);
+
+CREATE TRIGGER IF NOT EXISTS update_auth_users_updated_at
+AFTER UPDATE ON auth_users FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE auth_users SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+-- Create refresh_tokens table
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    user_id TEXT NOT NULL,
+    token_hash VARCHAR(255) NOT NULL,
+    family_id TEXT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_refresh_tokens_user FOREIGN KEY (user_id) REFERENCES auth_users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_hash ON refresh_tokens(token_hash);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_expires ON refresh_tokens(expires_at);
+
+-- Create api_keys table
+-- permissions uses the same '{a,b}' text encoding as the Postgres array type
+CREATE TABLE IF NOT EXISTS api_keys (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    name VARCHAR(100) NOT NULL,
+    key_hash VARCHAR(255) UNIQUE NOT NULL,
+    key_prefix VARCHAR(16) NOT NULL DEFAULT '',
+    previous_key_hash VARCHAR(255) NULL,
+    previous_expires_at TIMESTAMP NULL,
+    permissions TEXT NOT NULL,
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NULL,
+    last_used_at TIMESTAMP NULL,
+    revoked_at TIMESTAMP NULL,
+    rotated_at TIMESTAMP NULL,
+    rate_limit_per_minute INTEGER NOT NULL DEFAULT 0,
+    monthly_quota BIGINT NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_api_keys_active ON api_keys(is_active);
+CREATE INDEX IF NOT EXISTS idx_api_keys_previous_hash ON api_keys(previous_key_hash);
+
+-- =============================================
+-- TRANSACTIONAL OUTBOX
+-- =============================================
+
+-- Outbox table; column layout matches Debezium's outbox event router
+CREATE TABLE IF NOT EXISTS outbox (
+    id TEXT PRIMARY KEY,
+    aggregate_type VARCHAR(255) NOT NULL,
+    aggregate_id VARCHAR(255) NOT NULL,
+    type VARCHAR(255) NOT NULL,
+    payload TEXT NOT NULL,
+    headers TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    published_at TIMESTAMP NULL
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_published_created ON outbox(published_at, created_at);
+
+-- Security events written by the security auditor
+CREATE TABLE IF NOT EXISTS security_events (
+    id TEXT PRIMARY KEY,
+    occurred_at TIMESTAMP NOT NULL,
+    event_type VARCHAR(64) NOT NULL,
+    severity VARCHAR(16) NOT NULL,
+    user_id TEXT NULL,
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL,
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
+    endpoint TEXT NOT NULL,
+    method VARCHAR(16) NOT NULL DEFAULT '',
+    status INTEGER NOT NULL DEFAULT 0,
+    details TEXT NOT NULL,
+    risk_score INTEGER NOT NULL DEFAULT 0,
+    blocked BOOLEAN NOT NULL DEFAULT false
+);
+CREATE INDEX IF NOT EXISTS idx_security_events_occurred_at ON security_events(occurred_at);
+CREATE INDEX IF NOT EXISTS idx_security_events_type ON security_events(event_type, occurred_at);
+CREATE INDEX IF NOT EXISTS idx_security_events_severity ON security_events(severity, occurred_at);
+CREATE INDEX IF NOT EXISTS idx_security_events_ip ON security_events(ip_address, occurred_at);
+
+-- Alerts raised by the security analyzers
+CREATE TABLE IF NOT EXISTS security_alerts (
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    severity VARCHAR(16) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL,
+    event_ids TEXT NOT NULL,
+    risk_score INTEGER NOT NULL DEFAULT 0,
+    actions TEXT NOT NULL,
+    metadata TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_security_alerts_created_at ON security_alerts(created_at);
+CREATE INDEX IF NOT EXISTS idx_security_alerts_severity ON security_alerts(severity, created_at);
+
+-- Operator-managed IP blocklist/allowlist entries
+CREATE TABLE IF NOT EXISTS ip_rules (
+    id TEXT PRIMARY KEY,
+    cidr VARCHAR(64) NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    reason TEXT NOT NULL,
+    created_by TEXT,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NULL
+);
+
+-- =============================================
+-- DEFAULT ADMIN USER (for initial setup)
+-- =============================================
+
+-- Insert default admin user (password: admin123456)
+-- Note: In production, this should be removed or the password should be changed immediately
+INSERT OR IGNORE INTO auth_users (email, first_name, last_name, password_hash, role, is_active)
+VALUES (
+    'admin@highload-microservice.local',
+    'System',
+    'Administrator',
+    '$2a$10$Hr3FJZCXEB3iknfBJHfPuOOL1IRMfDCBqbmm8tYRQMdnd0MIW6PtO', -- admin123456
+    'admin',
+    true
+);
@@ -0,0 +1,11 @@
+-- History of changes to users: who changed which fields, and from what
+CREATE TABLE IF NOT EXISTS user_audit (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    action VARCHAR(32) NOT NULL,
+    actor_id TEXT,
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
+    changes TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_user_audit_user ON user_audit(user_id, created_at);
@@ -0,0 +1,3 @@
+ALTER TABLE refresh_tokens DROP COLUMN login_at;
+ALTER TABLE refresh_tokens DROP COLUMN ip_address;
+ALTER TABLE refresh_tokens DROP COLUMN user_agent;
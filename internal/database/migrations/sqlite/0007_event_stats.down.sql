@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS event_stats_rollup;
+DROP TABLE IF EXISTS event_stats_user_hourly;
+DROP TABLE IF EXISTS event_stats_hourly;
+ALTER TABLE events DROP COLUMN processing_ms;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_security_events_asn;
+DROP INDEX IF EXISTS idx_security_events_country;
+ALTER TABLE security_events DROP COLUMN as_org;
+ALTER TABLE security_events DROP COLUMN asn;
+ALTER TABLE security_events DROP COLUMN city;
+ALTER TABLE security_events DROP COLUMN country;
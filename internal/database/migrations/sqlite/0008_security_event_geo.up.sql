@@ -0,0 +1,7 @@
+-- Where security events came from, filled when a GeoIP database is configured
+ALTER TABLE security_events ADD COLUMN country VARCHAR(2) NOT NULL DEFAULT '';
+ALTER TABLE security_events ADD COLUMN city VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE security_events ADD COLUMN asn BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE security_events ADD COLUMN as_org VARCHAR(255) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_security_events_country ON security_events(occurred_at, country);
+CREATE INDEX IF NOT EXISTS idx_security_events_asn ON security_events(occurred_at, asn);
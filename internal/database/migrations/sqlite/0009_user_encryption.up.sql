@@ -0,0 +1,5 @@
+-- email_hash is the blind index that keeps email lookups and uniqueness
+-- working on encrypted emails (USER_ENCRYPTION_ENABLED). SQLite does not
+-- limit the length of the encrypted columns.
+ALTER TABLE users ADD COLUMN email_hash CHAR(64) NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_hash ON users(email_hash);
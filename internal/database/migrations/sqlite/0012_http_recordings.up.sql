@@ -0,0 +1,22 @@
+-- Sampled HTTP requests and responses with redacted bodies, kept for
+-- debugging and deleted after HTTP_RECORDING_RETENTION_HOURS
+CREATE TABLE IF NOT EXISTS http_recordings (
+    id TEXT PRIMARY KEY,
+    recorded_at TIMESTAMP NOT NULL,
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
+    method VARCHAR(16) NOT NULL,
+    path TEXT NOT NULL,
+    route TEXT NOT NULL,
+    query TEXT NOT NULL,
+    status INTEGER NOT NULL,
+    duration_ms BIGINT NOT NULL,
+    user_id TEXT NULL,
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    request_headers TEXT NOT NULL,
+    request_body TEXT NOT NULL,
+    response_headers TEXT NOT NULL,
+    response_body TEXT NOT NULL,
+    truncated BOOLEAN NOT NULL DEFAULT false
+);
+CREATE INDEX IF NOT EXISTS idx_http_recordings_recorded_at ON http_recordings(recorded_at);
+CREATE INDEX IF NOT EXISTS idx_http_recordings_request_id ON http_recordings(request_id);
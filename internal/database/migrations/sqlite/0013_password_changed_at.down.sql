@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS insert_auth_users_password_changed_at;
+ALTER TABLE auth_users DROP COLUMN password_changed_at;
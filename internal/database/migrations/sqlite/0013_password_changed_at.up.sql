@@ -0,0 +1,12 @@
+-- When the password was last set, for PASSWORD_MAX_AGE_DAYS. Existing
+-- passwords count from the migration. SQLite cannot add a column with a
+-- CURRENT_TIMESTAMP default, so new rows get it from a trigger.
+ALTER TABLE auth_users
+    ADD COLUMN password_changed_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00';
+UPDATE auth_users SET password_changed_at = CURRENT_TIMESTAMP;
+
+CREATE TRIGGER IF NOT EXISTS insert_auth_users_password_changed_at
+AFTER INSERT ON auth_users FOR EACH ROW WHEN NEW.password_changed_at = '1970-01-01 00:00:00'
+BEGIN
+    UPDATE auth_users SET password_changed_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
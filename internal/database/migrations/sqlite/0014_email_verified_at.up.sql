@@ -0,0 +1,5 @@
+-- When a self-registered account confirmed its email. Accounts created by
+-- administrators are never verified this way; a verification link only
+-- activates an account once.
+ALTER TABLE auth_users
+    ADD COLUMN email_verified_at TIMESTAMP NULL;
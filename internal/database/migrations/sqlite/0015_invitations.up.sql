@@ -0,0 +1,20 @@
+-- Invitations to create an account. Only the SHA-256 hash of the emailed
+-- token is stored; a new invitation revokes the pending ones of the email.
+CREATE TABLE IF NOT EXISTS invitations (
+    id TEXT PRIMARY KEY,
+    email VARCHAR(255) NOT NULL,
+    first_name VARCHAR(100) NOT NULL DEFAULT '',
+    last_name VARCHAR(100) NOT NULL DEFAULT '',
+    role VARCHAR(50) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    invited_by TEXT NULL,
+    user_id TEXT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP NULL,
+    CONSTRAINT fk_invitations_invited_by FOREIGN KEY (invited_by) REFERENCES auth_users(id) ON DELETE SET NULL,
+    CONSTRAINT fk_invitations_user FOREIGN KEY (user_id) REFERENCES auth_users(id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS idx_invitations_email ON invitations(email);
+CREATE INDEX IF NOT EXISTS idx_invitations_status_created ON invitations(status, created_at);
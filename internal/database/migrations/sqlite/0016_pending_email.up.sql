@@ -0,0 +1,5 @@
+-- A new email requested through the profile, applied once the link sent to
+-- it is followed. Requesting another change replaces it, which invalidates
+-- earlier links.
+ALTER TABLE auth_users
+    ADD COLUMN pending_email VARCHAR(255) NULL;
@@ -0,0 +1,14 @@
+-- The current avatar of a user. Images live in the avatar object store under
+-- <user_id>/<version>/; a new upload gets a new version. thumbnails lists the
+-- sizes resized so far, comma separated.
+CREATE TABLE IF NOT EXISTS user_avatars (
+    user_id TEXT PRIMARY KEY,
+    version VARCHAR(36) NOT NULL,
+    content_type VARCHAR(32) NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    thumbnails VARCHAR(255) NOT NULL DEFAULT '',
+    updated_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user_avatars_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,11 @@
+-- Registered event types. With EVENT_TYPES_STRICT only these are accepted;
+-- disabled types are refused either way. Payload schemas stay in
+-- event_schemas.
+CREATE TABLE IF NOT EXISTS event_types (
+    name VARCHAR(100) PRIMARY KEY,
+    description TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    updated_by TEXT,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
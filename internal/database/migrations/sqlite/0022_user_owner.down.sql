@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS delete_auth_users_user_owner;
+DROP INDEX IF EXISTS idx_users_auth_user_id;
+ALTER TABLE users DROP COLUMN auth_user_id;
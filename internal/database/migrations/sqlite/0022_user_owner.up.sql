@@ -0,0 +1,12 @@
+-- The account that owns a user record, for the routes a user may call on
+-- their own record. users and auth_users have independent IDs; records
+-- without an owner are open to admins only. SQLite cannot drop a column that
+-- a foreign key uses, so a trigger stands in for ON DELETE SET NULL.
+ALTER TABLE users ADD COLUMN auth_user_id TEXT NULL;
+CREATE INDEX IF NOT EXISTS idx_users_auth_user_id ON users(auth_user_id);
+
+CREATE TRIGGER IF NOT EXISTS delete_auth_users_user_owner
+AFTER DELETE ON auth_users FOR EACH ROW
+BEGIN
+    UPDATE users SET auth_user_id = NULL WHERE auth_user_id = OLD.id;
+END;
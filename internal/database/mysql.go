@@ -0,0 +1,15 @@
+package database
+
+import "github.com/go-sql-driver/mysql"
+
+// mysqlRebindDriverName is the database/sql driver used for DB_DRIVER=mysql.
+// It wraps the MySQL driver and rewrites $N placeholders to "?" so the
+// services can keep a single set of queries for every dialect.
+const mysqlRebindDriverName = "mysql-rebind"
+
+func init() {
+	register(mysqlRebindDriverName, &rebindDriver{
+		Driver: &mysql.MySQLDriver{},
+		rebind: rebindQuestion,
+	})
+}
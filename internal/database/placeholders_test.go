@@ -0,0 +1,174 @@
+package database
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var placeholderPattern = regexp.MustCompile(`\$(\d+)`)
+
+// queryMethods maps database/sql call names to the position of their query
+// argument
+var queryMethods = map[string]int{
+	"Exec": 0, "Query": 0, "QueryRow": 0,
+	"ExecContext": 1, "QueryContext": 1, "QueryRowContext": 1,
+}
+
+// TestQueries_RebindForMySQL checks every literal query in the service: MySQL
+// rebinds $N to "?" by position, so placeholders must run $1..$n in the order
+// they appear, once each, with one argument per placeholder
+func TestQueries_RebindForMySQL(t *testing.T) {
+	root := filepath.Join("..", "..")
+	fset := token.NewFileSet()
+	checked := 0
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name := d.Name(); name == "vendor" || name == "migrations" || (strings.HasPrefix(name, ".") && path != root) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		consts := stringConsts(file)
+		locals := map[string]string{}
+
+		ast.Inspect(file, func(n ast.Node) bool {
+			if assign, ok := n.(*ast.AssignStmt); ok {
+				trackLocals(assign, consts, locals)
+				return true
+			}
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			idx, ok := queryMethods[sel.Sel.Name]
+			if !ok || len(call.Args) <= idx {
+				return true
+			}
+			query, ok := literalQuery(call.Args[idx], consts)
+			if !ok {
+				query, ok = literalQuery(call.Args[idx], locals)
+			}
+			if !ok {
+				return true
+			}
+			checked++
+			pos := fset.Position(call.Pos())
+
+			for i, m := range placeholderPattern.FindAllStringSubmatch(query, -1) {
+				if n, _ := strconv.Atoi(m[1]); n != i+1 {
+					t.Errorf("%s: placeholder $%d at position %d, want $%d", pos, n, i+1, i+1)
+					break
+				}
+			}
+			if call.Ellipsis.IsValid() {
+				return true
+			}
+			bound := strings.Count(rebindQuestion(query), "?") - strings.Count(query, "?")
+			if args := len(call.Args) - idx - 1; bound != args {
+				t.Errorf("%s: %d placeholders after rebind, %d args", pos, bound, args)
+			}
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked == 0 {
+		t.Fatalf("no queries found under %s", root)
+	}
+}
+
+// stringConsts collects the file's string constants, which queries are often
+// assembled from
+func stringConsts(file *ast.File) map[string]string {
+	consts := map[string]string{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		decl, ok := n.(*ast.GenDecl)
+		if !ok || decl.Tok != token.CONST {
+			return true
+		}
+		for _, spec := range decl.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, name := range vs.Names {
+				if i < len(vs.Values) {
+					if s, ok := literalQuery(vs.Values[i], consts); ok {
+						consts[name.Name] = s
+					}
+				}
+			}
+		}
+		return true
+	})
+	return consts
+}
+
+// trackLocals follows query variables in source order, forgetting any that
+// are reassigned or appended to with something that is not a literal
+func trackLocals(assign *ast.AssignStmt, consts, locals map[string]string) {
+	for i, lhs := range assign.Lhs {
+		ident, ok := lhs.(*ast.Ident)
+		if !ok {
+			continue
+		}
+		delete(locals, ident.Name)
+		if len(assign.Rhs) != len(assign.Lhs) || (assign.Tok != token.DEFINE && assign.Tok != token.ASSIGN) {
+			continue
+		}
+		if s, ok := literalQuery(assign.Rhs[i], consts); ok {
+			locals[ident.Name] = s
+		}
+	}
+}
+
+// literalQuery evaluates expressions built from string literals and known
+// constants; anything else is assembled at run time and skipped
+func literalQuery(expr ast.Expr, consts map[string]string) (string, bool) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.STRING {
+			return "", false
+		}
+		s, err := strconv.Unquote(e.Value)
+		return s, err == nil
+	case *ast.Ident:
+		s, ok := consts[e.Name]
+		return s, ok
+	case *ast.ParenExpr:
+		return literalQuery(e.X, consts)
+	case *ast.BinaryExpr:
+		if e.Op != token.ADD {
+			return "", false
+		}
+		x, ok := literalQuery(e.X, consts)
+		if !ok {
+			return "", false
+		}
+		y, ok := literalQuery(e.Y, consts)
+		return x + y, ok
+	}
+	return "", false
+}
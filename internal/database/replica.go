@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"highload-microservice/internal/metrics"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ReadPool routes read-only queries to a replica. The replica is pinged
+// periodically; while it is unreachable reads go to the primary. Replicas
+// lag behind the primary, so only reads that tolerate slightly stale data
+// should use it.
+type ReadPool struct {
+	primary  *sql.DB
+	replica  *sql.DB
+	interval time.Duration
+	logger   *logrus.Logger
+	healthy  atomic.Bool
+	checked  bool // only touched by check, which never runs concurrently
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func NewReadPool(primary, replica *sql.DB, interval time.Duration, logger *logrus.Logger) *ReadPool {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	return &ReadPool{
+		primary:  primary,
+		replica:  replica,
+		interval: interval,
+		logger:   logger,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Reader returns the replica while it is healthy, otherwise the primary
+func (p *ReadPool) Reader() *sql.DB {
+	if p.healthy.Load() {
+		return p.replica
+	}
+	return p.primary
+}
+
+// ReplicaHealthy reports whether reads currently go to the replica
+func (p *ReadPool) ReplicaHealthy() bool {
+	return p.healthy.Load()
+}
+
+// Start checks the replica once and then every interval
+func (p *ReadPool) Start() {
+	p.check()
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.check()
+			}
+		}
+	}()
+}
+
+// check pings the replica and logs when its state changes
+func (p *ReadPool) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), p.interval)
+	defer cancel()
+	err := p.replica.PingContext(ctx)
+
+	healthy := err == nil
+	metrics.SetDBReplicaUp(healthy)
+	if p.healthy.Swap(healthy) == healthy && p.checked {
+		return
+	}
+	p.checked = true
+	if healthy {
+		p.logger.Info("Read replica is up; routing reads to it")
+	} else {
+		p.logger.Warnf("Read replica is down; reading from the primary: %v", err)
+	}
+}
+
+// Stop ends health checks and closes the replica pool
+func (p *ReadPool) Stop() {
+	close(p.stop)
+	p.wg.Wait()
+	_ = p.replica.Close()
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sirupsen/logrus"
+)
+
+func TestReadPool_FallsBackToPrimary(t *testing.T) {
+	primary, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer primary.Close()
+	replica, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+
+	pool := NewReadPool(primary, replica, time.Hour, logrus.New())
+
+	mock.ExpectPing()
+	pool.check()
+	if pool.Reader() != replica || !pool.ReplicaHealthy() {
+		t.Fatal("healthy replica should serve reads")
+	}
+
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	pool.check()
+	if pool.Reader() != primary || pool.ReplicaHealthy() {
+		t.Fatal("reads should fall back to the primary while the replica is down")
+	}
+
+	mock.ExpectPing()
+	pool.check()
+	if pool.Reader() != replica {
+		t.Fatal("reads should return to the replica once it recovers")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("ping expectations: %v", err)
+	}
+}
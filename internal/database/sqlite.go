@@ -0,0 +1,49 @@
+package database
+
+import (
+	"database/sql/driver"
+	"strings"
+	"sync"
+
+	"modernc.org/sqlite"
+)
+
+// sqliteDriverName is the database/sql driver used for DB_DRIVER=sqlite. It
+// wraps the pure Go SQLite driver, which needs no cgo.
+const sqliteDriverName = "sqlite-instrumented"
+
+// sqliteMemoryName names the in-memory database of DB_NAME=":memory:"
+const sqliteMemoryName = "highload-microservice"
+
+func init() {
+	register(sqliteDriverName, &rebindDriver{
+		Driver: &sqliteDriver{kept: make(map[string]driver.Conn)},
+		rebind: sqliteDialect{}.Rebind,
+	})
+}
+
+// sqliteDriver keeps a connection to every in-memory database open. SQLite
+// drops such a database with its last connection, which would happen when
+// the migration pool is closed or the pool lets idle connections go.
+type sqliteDriver struct {
+	sqlite.Driver
+
+	mu   sync.Mutex
+	kept map[string]driver.Conn
+}
+
+func (d *sqliteDriver) Open(name string) (driver.Conn, error) {
+	if strings.Contains(name, "vfs=memdb") {
+		d.mu.Lock()
+		if _, ok := d.kept[name]; !ok {
+			conn, err := d.Driver.Open(name)
+			if err != nil {
+				d.mu.Unlock()
+				return nil, err
+			}
+			d.kept[name] = conn
+		}
+		d.mu.Unlock()
+	}
+	return d.Driver.Open(name)
+}
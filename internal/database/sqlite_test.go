@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"highload-microservice/internal/config"
+)
+
+func openSQLite(t *testing.T, name string) *sql.DB {
+	t.Helper()
+	db, err := NewConnection(config.DatabaseConfig{Driver: DriverSQLite, Name: name, MaxOpenConns: 4, MaxIdleConns: 1}, nil)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func TestSQLite_Migrations(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t, filepath.Join(t.TempDir(), "test.db"))
+	m, err := NewMigrator(db, sqliteDialect{})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if err := m.SetOnDelete(EventUser, OnDeleteRestrict); err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := m.Up(ctx)
+	if err != nil || applied != len(m.migrations) {
+		t.Fatalf("up: applied %d of %d: %v", applied, len(m.migrations), err)
+	}
+	if _, action, err := OnDelete(ctx, db, sqliteDialect{}, EventUser); err != nil || action != OnDeleteRestrict {
+		t.Fatalf("events.user_id: ON DELETE %q, %v", action, err)
+	}
+
+	var id string
+	if err := db.QueryRow(`SELECT id FROM auth_users WHERE email = $1`, "admin@highload-microservice.local").Scan(&id); err != nil || len(id) != 36 {
+		t.Fatalf("seeded admin: %q, %v", id, err)
+	}
+	if _, err := db.Exec(`INSERT INTO users (id, email, first_name, last_name) VALUES ($1, $2, $3, $4)`, "u1", "a@example.com", "A", "B"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO events (id, user_id, type, data) VALUES ($1, $2, $3, $4)`, "e1", "u1", "t", "{}"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`DELETE FROM users WHERE id = $1`, "u1"); err == nil {
+		t.Fatalf("ON DELETE RESTRICT not enforced")
+	}
+
+	reverted, err := m.Down(ctx, len(m.migrations))
+	if err != nil || reverted != len(m.migrations) {
+		t.Fatalf("down: reverted %d of %d: %v", reverted, len(m.migrations), err)
+	}
+	var tables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_schema WHERE type = 'table' AND name <> 'schema_migrations'`).Scan(&tables); err != nil || tables != 0 {
+		t.Fatalf("%d tables left after down: %v", tables, err)
+	}
+}
+
+func TestSQLite_MemoryOutlivesConnections(t *testing.T) {
+	db := openSQLite(t, ":memory:")
+	if _, err := db.Exec(`CREATE TABLE memory_test (id INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	_ = db.Close()
+
+	db = openSQLite(t, ":memory:")
+	defer func() { _, _ = db.Exec(`DROP TABLE memory_test`) }()
+	if _, err := db.Exec(`INSERT INTO memory_test (id) VALUES ($1)`, 1); err != nil {
+		t.Fatalf("in-memory database dropped with its pool: %v", err)
+	}
+}
+
+func TestSQLite_RebindDropsRowLocks(t *testing.T) {
+	cases := map[string]string{
+		"SELECT id FROM outbox ORDER BY created_at LIMIT $1 FOR UPDATE SKIP LOCKED": "SELECT id FROM outbox ORDER BY created_at LIMIT $1",
+		"SELECT d.id FROM d JOIN w ON w.id = d.w\n\t\tFOR UPDATE OF d SKIP LOCKED":  "SELECT d.id FROM d JOIN w ON w.id = d.w",
+		"SELECT id FROM t WHERE id = $1":                                            "SELECT id FROM t WHERE id = $1",
+	}
+	for in, want := range cases {
+		if got := (sqliteDialect{}).Rebind(in); got != want {
+			t.Fatalf("rebind(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
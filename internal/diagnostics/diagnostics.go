@@ -0,0 +1,134 @@
+// Package diagnostics serves pprof profiles and runtime statistics, so that
+// performance issues can be profiled in production. The endpoints are only
+// mounted when enabled, either on a separate listener or behind admin
+// authentication (see main).
+package diagnostics
+
+import (
+	"expvar"
+	"math"
+	"net/http"
+	"runtime"
+	"runtime/metrics"
+	"time"
+
+	"github.com/gin-contrib/pprof"
+	"github.com/gin-gonic/gin"
+)
+
+// recentPauses is how many of the latest GC pauses Stats reports
+const recentPauses = 16
+
+var started = time.Now()
+
+// Source reports the state of a component (worker pool, producer buffer)
+type Source func() any
+
+// Runtime is a snapshot of the Go runtime
+type Runtime struct {
+	GoVersion  string        `json:"go_version"`
+	Uptime     time.Duration `json:"uptime_ns"`
+	Goroutines int           `json:"goroutines"`
+	CPUs       int           `json:"cpus"`
+	GOMAXPROCS int           `json:"gomaxprocs"`
+	Heap       Heap          `json:"heap"`
+	GC         GC            `json:"gc"`
+}
+
+// Heap is the state of the heap in bytes
+type Heap struct {
+	Alloc    uint64 `json:"alloc"`
+	InUse    uint64 `json:"in_use"`
+	Idle     uint64 `json:"idle"`
+	Released uint64 `json:"released"`
+	Objects  uint64 `json:"objects"`
+	Sys      uint64 `json:"sys"` // obtained from the OS for everything, not only the heap
+}
+
+// GC describes garbage collection so far
+type GC struct {
+	Count         uint32          `json:"count"`
+	NextTarget    uint64          `json:"next_target_bytes"`
+	PauseTotal    time.Duration   `json:"pause_total_ns"`
+	RecentPauses  []time.Duration `json:"recent_pauses_ns"` // newest first
+	LastRun       *time.Time      `json:"last_run,omitempty"`
+	CPUFraction   float64         `json:"cpu_fraction"`
+	MemoryLimit   int64           `json:"memory_limit_bytes"`
+	TargetPercent int             `json:"target_percent"` // GOGC
+}
+
+// RuntimeStats reads the runtime statistics. It briefly stops the world.
+func RuntimeStats() Runtime {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	gc := GC{
+		Count:       mem.NumGC,
+		NextTarget:  mem.NextGC,
+		PauseTotal:  time.Duration(mem.PauseTotalNs),
+		CPUFraction: mem.GCCPUFraction,
+	}
+	settings := []metrics.Sample{{Name: "/gc/gogc:percent"}, {Name: "/gc/gomemlimit:bytes"}}
+	metrics.Read(settings)
+	if settings[0].Value.Kind() == metrics.KindUint64 {
+		gc.TargetPercent = int(settings[0].Value.Uint64())
+	}
+	if settings[1].Value.Kind() == metrics.KindUint64 {
+		gc.MemoryLimit = int64(min(settings[1].Value.Uint64(), math.MaxInt64))
+	}
+	for i := uint32(0); i < min(mem.NumGC, recentPauses); i++ {
+		// PauseNs is a ring buffer; the latest pause is at (NumGC+255)%256
+		gc.RecentPauses = append(gc.RecentPauses, time.Duration(mem.PauseNs[(mem.NumGC-1-i)%256]))
+	}
+	if mem.LastGC > 0 {
+		last := time.Unix(0, int64(mem.LastGC))
+		gc.LastRun = &last
+	}
+
+	return Runtime{
+		GoVersion:  runtime.Version(),
+		Uptime:     time.Since(started),
+		Goroutines: runtime.NumGoroutine(),
+		CPUs:       runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Heap: Heap{
+			Alloc:    mem.HeapAlloc,
+			InUse:    mem.HeapInuse,
+			Idle:     mem.HeapIdle,
+			Released: mem.HeapReleased,
+			Objects:  mem.HeapObjects,
+			Sys:      mem.Sys,
+		},
+		GC: gc,
+	}
+}
+
+// Register mounts the diagnostics endpoints under group:
+//
+//	GET /pprof/*  net/http/pprof profiles
+//	GET /vars     expvar variables, including the sources
+//	GET /runtime  RuntimeStats and the state of every source
+//
+// Sources are also published as expvar variables, once per name.
+func Register(group *gin.RouterGroup, sources map[string]Source) {
+	pprof.RouteRegister(group, "pprof")
+
+	for name, source := range sources {
+		if expvar.Get(name) == nil {
+			expvar.Publish(name, expvar.Func(source))
+		}
+	}
+	group.GET("/vars", gin.WrapH(expvar.Handler()))
+
+	group.GET("/runtime", func(c *gin.Context) {
+		components := make(map[string]any, len(sources))
+		for name, source := range sources {
+			components[name] = source()
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"runtime":    RuntimeStats(),
+			"components": components,
+			"timestamp":  time.Now().Unix(),
+		})
+	})
+}
@@ -0,0 +1,60 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRuntimeStats(t *testing.T) {
+	runtime.GC()
+	stats := RuntimeStats()
+	if stats.Goroutines == 0 || stats.Heap.Alloc == 0 || stats.GC.Count == 0 {
+		t.Fatalf("empty stats: %+v", stats)
+	}
+	if len(stats.GC.RecentPauses) == 0 || len(stats.GC.RecentPauses) > recentPauses {
+		t.Errorf("got %d recent pauses", len(stats.GC.RecentPauses))
+	}
+	if stats.GC.TargetPercent == 0 {
+		t.Errorf("GOGC not reported")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	Register(r.Group("/debug"), map[string]Source{
+		"diagnostics_test_pool": func() any { return map[string]int{"queued": 3} },
+	})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d", path, w.Code)
+		}
+		return w
+	}
+
+	var body struct {
+		Runtime    Runtime                   `json:"runtime"`
+		Components map[string]map[string]int `json:"components"`
+	}
+	if err := json.Unmarshal(get("/debug/runtime").Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Runtime.Goroutines == 0 || body.Components["diagnostics_test_pool"]["queued"] != 3 {
+		t.Errorf("unexpected body: %+v", body)
+	}
+
+	if vars := get("/debug/vars").Body.String(); !strings.Contains(vars, `"diagnostics_test_pool": {"queued":3}`) {
+		t.Errorf("source not published to expvar: %s", vars)
+	}
+	get("/debug/pprof/goroutine?debug=1")
+}
@@ -0,0 +1,103 @@
+package events
+
+import (
+	"fmt"
+	"sync"
+
+	"highload-microservice/internal/models"
+)
+
+// InitialVersion is the schema version of events published before
+// versioning was introduced (they carry no version field).
+const InitialVersion = 1
+
+// Upcaster migrates an event payload from one schema version to the next
+type Upcaster func(data string) (string, error)
+
+type upcasterKey struct {
+	eventType string
+	from      int
+}
+
+// Registry holds upcasters per event type and knows the current schema
+// version of every type. Upcasters are chained, so a v1 payload is migrated
+// to v3 by running v1->v2 and then v2->v3.
+type Registry struct {
+	mu        sync.RWMutex
+	upcasters map[upcasterKey]Upcaster
+	current   map[string]int
+}
+
+// NewRegistry creates an empty upcaster registry
+func NewRegistry() *Registry {
+	return &Registry{
+		upcasters: make(map[upcasterKey]Upcaster),
+		current:   make(map[string]int),
+	}
+}
+
+// Register adds an upcaster migrating eventType payloads from version from
+// to version from+1
+func (r *Registry) Register(eventType string, from int, upcaster Upcaster) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.upcasters[upcasterKey{eventType: eventType, from: from}] = upcaster
+	if from+1 > r.current[eventType] {
+		r.current[eventType] = from + 1
+	}
+}
+
+// CurrentVersion returns the schema version producers should stamp on new
+// events of the given type
+func (r *Registry) CurrentVersion(eventType string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if v, ok := r.current[eventType]; ok {
+		return v
+	}
+	return InitialVersion
+}
+
+// Upcast migrates the event in place to the current schema version of its type
+func (r *Registry) Upcast(event *models.KafkaEvent) error {
+	if event.Version == 0 {
+		event.Version = InitialVersion
+	}
+
+	target := r.CurrentVersion(event.Type)
+	if event.Version > target {
+		return fmt.Errorf("event %s has version %d, newer than supported version %d for type %s",
+			event.ID, event.Version, target, event.Type)
+	}
+
+	for event.Version < target {
+		r.mu.RLock()
+		upcaster, ok := r.upcasters[upcasterKey{eventType: event.Type, from: event.Version}]
+		r.mu.RUnlock()
+		if !ok {
+			return fmt.Errorf("no upcaster registered for %s from version %d", event.Type, event.Version)
+		}
+
+		data, err := upcaster(event.Data)
+		if err != nil {
+			return fmt.Errorf("failed to upcast %s from version %d: %w", event.Type, event.Version, err)
+		}
+
+		event.Data = data
+		event.Version++
+	}
+
+	return nil
+}
+
+// Default is the registry used by the services. Upcasters for built-in event
+// types are registered here when their payload shape changes.
+var Default = NewRegistry()
+
+// CurrentVersion returns the current schema version of eventType in the
+// default registry
+func CurrentVersion(eventType string) int {
+	return Default.CurrentVersion(eventType)
+}
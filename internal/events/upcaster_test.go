@@ -0,0 +1,125 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// newTestRegistry registers a three-version history for "user_created":
+// v1 {"name": "John Doe"} -> v2 {"first_name","last_name"} -> v3 adds "locale"
+func newTestRegistry() *Registry {
+	r := NewRegistry()
+
+	r.Register("user_created", 1, func(data string) (string, error) {
+		var v1 struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal([]byte(data), &v1); err != nil {
+			return "", err
+		}
+		first, last := v1.Name, ""
+		for i, ch := range v1.Name {
+			if ch == ' ' {
+				first, last = v1.Name[:i], v1.Name[i+1:]
+				break
+			}
+		}
+		out, err := json.Marshal(map[string]string{"first_name": first, "last_name": last})
+		return string(out), err
+	})
+
+	r.Register("user_created", 2, func(data string) (string, error) {
+		var v2 map[string]string
+		if err := json.Unmarshal([]byte(data), &v2); err != nil {
+			return "", err
+		}
+		v2["locale"] = "en"
+		out, err := json.Marshal(v2)
+		return string(out), err
+	})
+
+	return r
+}
+
+func TestRegistry_UpcastMultiStep(t *testing.T) {
+	r := newTestRegistry()
+
+	event := models.KafkaEvent{ID: uuid.New(), Type: "user_created", Data: `{"name":"John Doe"}`}
+	if err := r.Upcast(&event); err != nil {
+		t.Fatalf("upcast: %v", err)
+	}
+
+	if event.Version != 3 {
+		t.Fatalf("expected version 3, got %d", event.Version)
+	}
+
+	var got map[string]string
+	if err := json.Unmarshal([]byte(event.Data), &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if got["first_name"] != "John" || got["last_name"] != "Doe" || got["locale"] != "en" {
+		t.Fatalf("unexpected payload: %v", got)
+	}
+}
+
+func TestRegistry_UpcastFromIntermediateVersion(t *testing.T) {
+	r := newTestRegistry()
+
+	event := models.KafkaEvent{Type: "user_created", Version: 2, Data: `{"first_name":"A","last_name":"B"}`}
+	if err := r.Upcast(&event); err != nil {
+		t.Fatalf("upcast: %v", err)
+	}
+	if event.Version != 3 {
+		t.Fatalf("expected version 3, got %d", event.Version)
+	}
+}
+
+func TestRegistry_CurrentVersionIsNoop(t *testing.T) {
+	r := newTestRegistry()
+
+	event := models.KafkaEvent{Type: "user_created", Version: 3, Data: `{"x":1}`}
+	if err := r.Upcast(&event); err != nil {
+		t.Fatalf("upcast: %v", err)
+	}
+	if event.Data != `{"x":1}` {
+		t.Fatalf("payload should be untouched: %s", event.Data)
+	}
+
+	other := models.KafkaEvent{Type: "unknown"}
+	if err := r.Upcast(&other); err != nil || other.Version != InitialVersion {
+		t.Fatalf("unversioned type should stay at initial version: v=%d err=%v", other.Version, err)
+	}
+}
+
+func TestRegistry_UpcastErrors(t *testing.T) {
+	r := newTestRegistry()
+
+	future := models.KafkaEvent{Type: "user_created", Version: 4}
+	if err := r.Upcast(&future); err == nil {
+		t.Fatalf("expected error for version newer than supported")
+	}
+
+	broken := models.KafkaEvent{Type: "user_created", Version: 1, Data: "not-json"}
+	if err := r.Upcast(&broken); err == nil {
+		t.Fatalf("expected error from failing upcaster")
+	}
+
+	gap := NewRegistry()
+	gap.Register("t", 2, func(data string) (string, error) { return data, nil })
+	missing := models.KafkaEvent{Type: "t", Version: 1}
+	if err := gap.Upcast(&missing); err == nil {
+		t.Fatalf("expected error for missing upcaster step")
+	}
+
+	failing := NewRegistry()
+	failing.Register("t", 1, func(string) (string, error) { return "", fmt.Errorf("boom") })
+	ev := models.KafkaEvent{Type: "t"}
+	if err := failing.Upcast(&ev); err == nil || ev.Version != 1 {
+		t.Fatalf("failed upcast should leave version unchanged: v=%d err=%v", ev.Version, err)
+	}
+}
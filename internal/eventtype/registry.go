@@ -0,0 +1,248 @@
+// Package eventtype keeps the registry of known event types: their
+// description, whether they are enabled and, through the schema registry,
+// their payload schema.
+package eventtype
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/schema"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// validName matches the names a type can be registered under; events are
+// limited to 50 characters of type too
+var validName = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,50}$`)
+
+const maxDescription = 500
+
+// Store persists the registered types
+type Store interface {
+	ListTypes(ctx context.Context) ([]models.EventType, error)
+	SaveType(ctx context.Context, eventType models.EventType) error
+	// DeleteType reports whether name was registered
+	DeleteType(ctx context.Context, name string) (bool, error)
+}
+
+// Schemas holds the payload schemas of the types. Implemented by
+// schema.Registry.
+type Schemas interface {
+	Get(eventType string) (schema.EventSchema, bool)
+	Put(ctx context.Context, eventType string, raw json.RawMessage, updatedBy *uuid.UUID) (schema.EventSchema, error)
+}
+
+// Update is the registration of a type. A nil Enabled means true for new
+// types and unchanged for existing ones; a nil Schema leaves the schema as
+// it is.
+type Update struct {
+	Description string          `json:"description"`
+	Enabled     *bool           `json:"enabled"`
+	Schema      json.RawMessage `json:"schema"`
+}
+
+// Registry holds the registered types in memory, so checking the type of
+// every created event costs no query. Other replicas pick up API changes on
+// their next refresh.
+type Registry struct {
+	store   Store
+	schemas Schemas
+	strict  bool
+	logger  *logrus.Logger
+
+	mu    sync.RWMutex
+	types map[string]models.EventType
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewRegistry creates a registry. In strict mode events of unregistered
+// types are refused; disabled types are refused in either mode.
+func NewRegistry(store Store, schemas Schemas, strict bool, logger *logrus.Logger) *Registry {
+	return &Registry{
+		store:   store,
+		schemas: schemas,
+		strict:  strict,
+		logger:  logger,
+		types:   make(map[string]models.EventType),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Strict reports whether unregistered types are refused
+func (r *Registry) Strict() bool {
+	return r.strict
+}
+
+// Load replaces the in-memory types with the stored ones
+func (r *Registry) Load(ctx context.Context) error {
+	list, err := r.store.ListTypes(ctx)
+	if err != nil {
+		return err
+	}
+	types := make(map[string]models.EventType, len(list))
+	for _, t := range list {
+		types[t.Name] = t
+	}
+
+	r.mu.Lock()
+	r.types = types
+	r.mu.Unlock()
+	return nil
+}
+
+// Start reloads the stored types every interval until Stop is called
+func (r *Registry) Start(interval time.Duration) {
+	go func() {
+		defer close(r.stopped)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.done:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				if err := r.Load(ctx); err != nil {
+					r.logger.Errorf("Failed to refresh event types: %v", err)
+				}
+				cancel()
+			}
+		}
+	}()
+}
+
+// Stop stops the refresh loop started by Start
+func (r *Registry) Stop() {
+	close(r.done)
+	<-r.stopped
+}
+
+func (r *Registry) lookup(name string) (models.EventType, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.types[name]
+	return t, ok
+}
+
+// Check returns an ErrValidation error if events of type name are not
+// accepted
+func (r *Registry) Check(name string) error {
+	t, ok := r.lookup(name)
+	switch {
+	case ok && !t.Enabled:
+		return apperrors.Validation(fmt.Sprintf("event type %s is disabled", name))
+	case !ok && r.strict:
+		return apperrors.Validation(fmt.Sprintf("unknown event type %s", name))
+	}
+	return nil
+}
+
+// Get returns the registered type name with its payload schema
+func (r *Registry) Get(name string) (models.EventType, bool) {
+	t, ok := r.lookup(name)
+	if !ok {
+		return t, false
+	}
+	if s, ok := r.schemas.Get(name); ok {
+		t.Schema = s.Schema
+	}
+	return t, true
+}
+
+// List returns the registered types without schemas, sorted by name
+func (r *Registry) List() []models.EventType {
+	r.mu.RLock()
+	types := make([]models.EventType, 0, len(r.types))
+	for _, t := range r.types {
+		types = append(types, t)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(types, func(i, j int) bool { return types[i].Name < types[j].Name })
+	return types
+}
+
+// Describe returns the registered types among names, without schemas, by
+// name. Unregistered names are left out.
+func (r *Registry) Describe(names []string) map[string]models.EventType {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	described := make(map[string]models.EventType)
+	for _, name := range names {
+		if t, ok := r.types[name]; ok {
+			described[name] = t
+		}
+	}
+	return described
+}
+
+// Put registers name or updates its registration. A schema in update is
+// stored in the schema registry first, so an invalid one changes nothing.
+func (r *Registry) Put(ctx context.Context, name string, update Update, updatedBy *uuid.UUID) (models.EventType, error) {
+	if !validName.MatchString(name) {
+		return models.EventType{}, apperrors.Validation("event type must be 1-50 letters, digits or _.:-")
+	}
+	if len(update.Description) > maxDescription {
+		return models.EventType{}, apperrors.Validation(fmt.Sprintf("description must be at most %d bytes", maxDescription))
+	}
+	if len(update.Schema) > 0 {
+		if _, err := r.schemas.Put(ctx, name, update.Schema, updatedBy); err != nil {
+			return models.EventType{}, err
+		}
+	}
+
+	now := time.Now().UTC()
+	t, exists := r.lookup(name)
+	if !exists {
+		t = models.EventType{Name: name, Enabled: true, CreatedAt: now}
+	}
+	t.Description = update.Description
+	if update.Enabled != nil {
+		t.Enabled = *update.Enabled
+	}
+	t.UpdatedBy = updatedBy
+	t.UpdatedAt = now
+	t.Schema = nil
+	if err := r.store.SaveType(ctx, t); err != nil {
+		return models.EventType{}, apperrors.FromDB(err, "failed to save event type")
+	}
+
+	r.mu.Lock()
+	r.types[name] = t
+	r.mu.Unlock()
+
+	t, _ = r.Get(name)
+	return t, nil
+}
+
+// Delete unregisters name. Its payload schema stays registered; in strict
+// mode events of the type are refused from now on.
+func (r *Registry) Delete(ctx context.Context, name string) error {
+	deleted, err := r.store.DeleteType(ctx, name)
+	if err != nil {
+		return apperrors.FromDB(err, "failed to delete event type")
+	}
+
+	r.mu.Lock()
+	delete(r.types, name)
+	r.mu.Unlock()
+
+	if !deleted {
+		return apperrors.NotFound("event type not found")
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package eventtype
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/schema"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type memoryStore struct {
+	types map[string]models.EventType
+}
+
+func (m *memoryStore) ListTypes(ctx context.Context) ([]models.EventType, error) {
+	var types []models.EventType
+	for _, t := range m.types {
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+func (m *memoryStore) SaveType(ctx context.Context, t models.EventType) error {
+	m.types[t.Name] = t
+	return nil
+}
+
+func (m *memoryStore) DeleteType(ctx context.Context, name string) (bool, error) {
+	_, ok := m.types[name]
+	delete(m.types, name)
+	return ok, nil
+}
+
+// memorySchemas keeps schemas that compile
+type memorySchemas map[string]json.RawMessage
+
+func (m memorySchemas) Get(eventType string) (schema.EventSchema, bool) {
+	raw, ok := m[eventType]
+	return schema.EventSchema{EventType: eventType, Schema: raw}, ok
+}
+
+func (m memorySchemas) Put(ctx context.Context, eventType string, raw json.RawMessage, updatedBy *uuid.UUID) (schema.EventSchema, error) {
+	if _, err := schema.Compile(raw); err != nil {
+		return schema.EventSchema{}, apperrors.Validation("invalid schema: " + err.Error())
+	}
+	m[eventType] = raw
+	return schema.EventSchema{EventType: eventType, Schema: raw}, nil
+}
+
+func TestRegistry_Check(t *testing.T) {
+	ctx := context.Background()
+	disabled := false
+	for _, strict := range []bool{false, true} {
+		r := NewRegistry(&memoryStore{types: map[string]models.EventType{}}, memorySchemas{}, strict, logrus.New())
+		if _, err := r.Put(ctx, "order_paid", Update{Description: "An order was paid"}, nil); err != nil {
+			t.Fatalf("put: %v", err)
+		}
+		if _, err := r.Put(ctx, "legacy", Update{Enabled: &disabled}, nil); err != nil {
+			t.Fatalf("put: %v", err)
+		}
+
+		if err := r.Check("order_paid"); err != nil {
+			t.Errorf("strict=%t: registered type refused: %v", strict, err)
+		}
+		if err := r.Check("legacy"); !errors.Is(err, apperrors.ErrValidation) {
+			t.Errorf("strict=%t: disabled type accepted: %v", strict, err)
+		}
+		if err := r.Check("unknown"); (err != nil) != strict {
+			t.Errorf("strict=%t: unregistered type: %v", strict, err)
+		}
+	}
+}
+
+func TestRegistry_PutKeepsStateAndValidatesSchema(t *testing.T) {
+	ctx := context.Background()
+	store := &memoryStore{types: map[string]models.EventType{}}
+	schemas := memorySchemas{}
+	r := NewRegistry(store, schemas, true, logrus.New())
+
+	created, err := r.Put(ctx, "order_paid", Update{Schema: json.RawMessage(`{"type": "object"}`)}, nil)
+	if err != nil || !created.Enabled || string(created.Schema) != `{"type": "object"}` {
+		t.Fatalf("unexpected type %+v, %v", created, err)
+	}
+
+	// Omitted fields keep the type enabled and its schema in place
+	updated, err := r.Put(ctx, "order_paid", Update{Description: "paid"}, nil)
+	if err != nil || !updated.Enabled || updated.Schema == nil || !updated.CreatedAt.Equal(created.CreatedAt) {
+		t.Fatalf("unexpected update %+v, %v", updated, err)
+	}
+
+	if _, err := r.Put(ctx, "broken", Update{Schema: json.RawMessage(`[]`)}, nil); !errors.Is(err, apperrors.ErrValidation) {
+		t.Fatalf("want validation error for an invalid schema, got %v", err)
+	}
+	if _, ok := store.types["broken"]; ok {
+		t.Fatalf("type with an invalid schema must not be registered")
+	}
+	if _, err := r.Put(ctx, "has spaces", Update{}, nil); !errors.Is(err, apperrors.ErrValidation) {
+		t.Fatalf("want validation error for an invalid name, got %v", err)
+	}
+
+	// Another replica sees the type after loading
+	replica := NewRegistry(store, schemas, true, logrus.New())
+	if err := replica.Load(ctx); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if described := replica.Describe([]string{"order_paid", "unknown"}); len(described) != 1 || described["order_paid"].Description != "paid" {
+		t.Fatalf("unexpected description %+v", described)
+	}
+
+	if err := r.Delete(ctx, "order_paid"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := r.Delete(ctx, "order_paid"); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Fatalf("want not found, got %v", err)
+	}
+	if err := r.Check("order_paid"); err == nil {
+		t.Fatalf("deleted type accepted in strict mode")
+	}
+}
@@ -0,0 +1,77 @@
+package eventtype
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"highload-microservice/internal/database"
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// SQLStore keeps event types in the event_types table
+type SQLStore struct {
+	db     *sql.DB
+	upsert string
+}
+
+func NewSQLStore(db *sql.DB, dialect database.Dialect) *SQLStore {
+	return &SQLStore{
+		db: db,
+		upsert: dialect.Upsert("event_types",
+			[]string{"name", "description", "enabled", "updated_by", "created_at", "updated_at"},
+			[]string{"name"},
+			[]string{"description", "enabled", "updated_by", "updated_at"}),
+	}
+}
+
+func (s *SQLStore) ListTypes(ctx context.Context) ([]models.EventType, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT name, description, enabled, updated_by, created_at, updated_at
+		FROM event_types ORDER BY name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list event types: %w", err)
+	}
+	defer rows.Close()
+
+	var types []models.EventType
+	for rows.Next() {
+		var (
+			t         models.EventType
+			updatedBy sql.NullString
+		)
+		if err := rows.Scan(&t.Name, &t.Description, &t.Enabled, &updatedBy, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan event type: %w", err)
+		}
+		if updatedBy.Valid {
+			if id, err := uuid.Parse(updatedBy.String); err == nil {
+				t.UpdatedBy = &id
+			}
+		}
+		types = append(types, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list event types: %w", err)
+	}
+	return types, nil
+}
+
+func (s *SQLStore) SaveType(ctx context.Context, t models.EventType) error {
+	_, err := s.db.ExecContext(ctx, s.upsert, t.Name, t.Description, t.Enabled, t.UpdatedBy, t.CreatedAt, t.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save event type: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) DeleteType(ctx context.Context, name string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM event_types WHERE name = $1`, name)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete event type: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return err != nil || n > 0, nil
+}
@@ -0,0 +1,102 @@
+// Package export encodes users and events for offline analysis, as CSV with
+// a header row or as NDJSON with one JSON object per line. Rows are written
+// as they come, so datasets of any size stream without being buffered.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"highload-microservice/internal/models"
+)
+
+// Supported export formats
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// ContentType returns the media type of format
+func ContentType(format string) string {
+	if format == FormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// ValidFormat reports whether format is supported
+func ValidFormat(format string) bool {
+	return format == FormatCSV || format == FormatNDJSON
+}
+
+// Columns of the CSV exports, in order
+var (
+	UserColumns  = []string{"id", "email", "first_name", "last_name", "is_active", "created_at", "updated_at", "deleted_at"}
+	EventColumns = []string{"id", "user_id", "type", "data", "encrypted", "created_at"}
+)
+
+// Writer encodes the rows of one dataset
+type Writer struct {
+	csv  *csv.Writer
+	json *json.Encoder
+}
+
+// NewWriter returns a writer of format to w. A CSV writer writes columns as
+// its header row first.
+func NewWriter(w io.Writer, format string, columns []string) (*Writer, error) {
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(columns); err != nil {
+			return nil, err
+		}
+		return &Writer{csv: cw}, nil
+	case FormatNDJSON:
+		return &Writer{json: json.NewEncoder(w)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported export format: %s", format)
+	}
+}
+
+// WriteUser writes one user
+func (w *Writer) WriteUser(user models.User) error {
+	if w.json != nil {
+		return w.json.Encode(user)
+	}
+	deletedAt := ""
+	if user.DeletedAt != nil {
+		deletedAt = timestamp(*user.DeletedAt)
+	}
+	return w.csv.Write([]string{
+		user.ID.String(), user.Email, user.FirstName, user.LastName, strconv.FormatBool(user.IsActive),
+		timestamp(user.CreatedAt), timestamp(user.UpdatedAt), deletedAt,
+	})
+}
+
+// WriteEvent writes one event
+func (w *Writer) WriteEvent(event models.Event) error {
+	if w.json != nil {
+		return w.json.Encode(event)
+	}
+	return w.csv.Write([]string{
+		event.ID.String(), event.UserID.String(), event.Type, event.Data, strconv.FormatBool(event.Encrypted),
+		timestamp(event.CreatedAt),
+	})
+}
+
+// Flush writes buffered CSV rows to the underlying writer
+func (w *Writer) Flush() error {
+	if w.csv == nil {
+		return nil
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+func timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,47 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestWriter_Users(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.FixedZone("MSK", 3*3600))
+	deleted := created.Add(time.Hour)
+	user := models.User{ID: uuid.New(), Email: "a@example.com", FirstName: "Ann, Jr.", LastName: "A", CreatedAt: created, UpdatedAt: created, DeletedAt: &deleted}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, FormatCSV, UserColumns)
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	if err := w.WriteUser(user); err != nil || w.Flush() != nil {
+		t.Fatalf("write: %v", err)
+	}
+	want := strings.Join(UserColumns, ",") + "\n" +
+		user.ID.String() + `,a@example.com,"Ann, Jr.",A,false,2024-03-01T09:00:00Z,2024-03-01T09:00:00Z,2024-03-01T10:00:00Z` + "\n"
+	if buf.String() != want {
+		t.Fatalf("unexpected CSV:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	w, _ = NewWriter(&buf, FormatNDJSON, UserColumns)
+	_ = w.WriteUser(user)
+	_ = w.WriteUser(user)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var decoded models.User
+	if len(lines) != 2 || json.Unmarshal([]byte(lines[0]), &decoded) != nil || decoded.ID != user.ID {
+		t.Fatalf("unexpected NDJSON:\n%s", buf.String())
+	}
+
+	if _, err := NewWriter(&buf, "xml", nil); err == nil {
+		t.Fatalf("expected an unsupported format error")
+	}
+}
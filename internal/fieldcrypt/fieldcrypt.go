@@ -0,0 +1,103 @@
+// Package fieldcrypt encrypts individual fields (e.g. event payloads) with
+// AES-GCM. Ciphertexts are self-describing, "enc:v1:<key id>:<base64>", so
+// keys can be rotated: new values use the active key while older values are
+// still decrypted with the key named in their prefix.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const prefix = "enc:v1:"
+
+// ErrUnknownKey is returned when a ciphertext names a key that is not configured
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// Encryptor encrypts with the active key and decrypts with any known key
+type Encryptor struct {
+	activeID string
+	aeads    map[string]cipher.AEAD
+}
+
+// NewEncryptor creates an encryptor. keys maps key IDs to 16, 24 or 32 byte
+// AES keys; activeID selects the key used for new ciphertexts.
+func NewEncryptor(activeID string, keys map[string][]byte) (*Encryptor, error) {
+	if activeID == "" || strings.Contains(activeID, ":") {
+		return nil, fmt.Errorf("invalid key ID %q", activeID)
+	}
+	if _, ok := keys[activeID]; !ok {
+		return nil, fmt.Errorf("active key %q is not configured", activeID)
+	}
+
+	aeads := make(map[string]cipher.AEAD, len(keys))
+	for id, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", id, err)
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", id, err)
+		}
+		aeads[id] = gcm
+	}
+
+	return &Encryptor{activeID: activeID, aeads: aeads}, nil
+}
+
+// IsEncrypted reports whether value looks like an fieldcrypt ciphertext
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Encrypt seals plaintext. associatedData (e.g. the record ID) binds the
+// ciphertext to its record so it can't be copied onto another one.
+func (e *Encryptor) Encrypt(plaintext string, associatedData []byte) (string, error) {
+	gcm := e.aeads[e.activeID]
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), associatedData)
+	return prefix + e.activeID + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value produced by Encrypt. Values without the ciphertext
+// prefix are returned unchanged so that pre-existing plaintext rows keep working.
+func (e *Encryptor) Decrypt(value string, associatedData []byte) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	keyID, encoded, ok := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	if !ok {
+		return "", fmt.Errorf("malformed ciphertext")
+	}
+	gcm, ok := e.aeads[keyID]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("malformed ciphertext: %w", err)
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("ciphertext too short")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, associatedData)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,59 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestEncryptor_RoundTripAndRotation(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+
+	old, err := NewEncryptor("k1", map[string][]byte{"k1": oldKey})
+	if err != nil {
+		t.Fatalf("encryptor: %v", err)
+	}
+	ciphertext, err := old.Encrypt(`{"email":"a@b.c"}`, []byte("event-1"))
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if !IsEncrypted(ciphertext) || bytes.Contains([]byte(ciphertext), []byte("a@b.c")) {
+		t.Fatalf("unexpected ciphertext: %s", ciphertext)
+	}
+
+	// After rotation the old key is still usable for reads
+	rotated, err := NewEncryptor("k2", map[string][]byte{"k1": oldKey, "k2": newKey})
+	if err != nil {
+		t.Fatalf("encryptor: %v", err)
+	}
+	plaintext, err := rotated.Decrypt(ciphertext, []byte("event-1"))
+	if err != nil || plaintext != `{"email":"a@b.c"}` {
+		t.Fatalf("decrypt: %q %v", plaintext, err)
+	}
+
+	// Associated data must match
+	if _, err := rotated.Decrypt(ciphertext, []byte("event-2")); err == nil {
+		t.Fatalf("expected error for mismatched associated data")
+	}
+
+	// Unknown key ID
+	onlyNew, _ := NewEncryptor("k2", map[string][]byte{"k2": newKey})
+	if _, err := onlyNew.Decrypt(ciphertext, []byte("event-1")); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected ErrUnknownKey, got %v", err)
+	}
+
+	// Plaintext passes through
+	if got, err := rotated.Decrypt("{}", nil); err != nil || got != "{}" {
+		t.Fatalf("plaintext passthrough: %q %v", got, err)
+	}
+}
+
+func TestNewEncryptor_Validation(t *testing.T) {
+	if _, err := NewEncryptor("missing", map[string][]byte{"k1": make([]byte, 32)}); err == nil {
+		t.Fatalf("expected error for missing active key")
+	}
+	if _, err := NewEncryptor("k1", map[string][]byte{"k1": make([]byte, 7)}); err == nil {
+		t.Fatalf("expected error for bad key length")
+	}
+}
@@ -0,0 +1,244 @@
+// Package geoip maps IP addresses to their country, city, coordinates and
+// autonomous system. Databases are IP range CSV files in the format of the
+// free DB-IP "lite" downloads:
+//
+//	country: ip_start,ip_end,country
+//	city:    ip_start,ip_end,continent,country,region,city,latitude,longitude
+//	ASN:     ip_start,ip_end,as_number,as_organization
+//
+// The files are loaded into memory and looked up with a binary search.
+package geoip
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Location is what is known about an address
+type Location struct {
+	Country   string  `json:"country,omitempty"` // ISO 3166-1 alpha-2
+	City      string  `json:"city,omitempty"`
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+	// HasCoordinates tells a location at 0,0 from one without coordinates
+	HasCoordinates bool   `json:"-"`
+	ASN            uint32 `json:"asn,omitempty"`
+	ASOrg          string `json:"as_org,omitempty"`
+}
+
+// Locator looks up addresses. Implemented by DB.
+type Locator interface {
+	Lookup(ip netip.Addr) (Location, bool)
+}
+
+// place is the location part of a range; ranges of a city share one
+type place struct {
+	country, city       string
+	latitude, longitude float64
+	hasCoordinates      bool
+}
+
+type asys struct {
+	number uint32
+	org    string
+}
+
+type ipRange[T any] struct {
+	start, end netip.Addr
+	value      *T
+}
+
+// DB is an in-memory GeoIP database
+type DB struct {
+	places []ipRange[place]
+	asns   []ipRange[asys]
+}
+
+// Open loads the location (country or city) and ASN files; either may be
+// empty. Files ending in .gz are decompressed.
+func Open(locationPath, asnPath string) (*DB, error) {
+	db := &DB{}
+	if locationPath != "" {
+		if err := loadFile(locationPath, db.LoadLocations); err != nil {
+			return nil, err
+		}
+	}
+	if asnPath != "" {
+		if err := loadFile(asnPath, db.LoadASNs); err != nil {
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+func loadFile(path string, load func(io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	if err := load(r); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// LoadLocations replaces the location ranges with a country or city CSV
+func (db *DB) LoadLocations(r io.Reader) error {
+	places := map[place]*place{} // rows of the same city share one value
+	ranges, err := readRanges(r, func(fields []string) (*place, error) {
+		var p place
+		switch len(fields) {
+		case 1:
+			p.country = fields[0]
+		case 6:
+			p.country, p.city = fields[1], fields[3]
+			lat, latErr := strconv.ParseFloat(fields[4], 64)
+			lon, lonErr := strconv.ParseFloat(fields[5], 64)
+			if latErr != nil || lonErr != nil {
+				return nil, errors.New("invalid coordinates")
+			}
+			p.latitude, p.longitude, p.hasCoordinates = lat, lon, true
+		default:
+			return nil, fmt.Errorf("want 3 (country) or 8 (city) columns, got %d", len(fields)+2)
+		}
+		if shared, ok := places[p]; ok {
+			return shared, nil
+		}
+		places[p] = &p
+		return &p, nil
+	})
+	if err != nil {
+		return err
+	}
+	db.places = ranges
+	return nil
+}
+
+// LoadASNs replaces the autonomous system ranges with an ASN CSV
+func (db *DB) LoadASNs(r io.Reader) error {
+	systems := map[asys]*asys{}
+	ranges, err := readRanges(r, func(fields []string) (*asys, error) {
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("want 4 columns, got %d", len(fields)+2)
+		}
+		number, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AS number %q", fields[0])
+		}
+		a := asys{number: uint32(number), org: fields[1]}
+		if shared, ok := systems[a]; ok {
+			return shared, nil
+		}
+		systems[a] = &a
+		return &a, nil
+	})
+	if err != nil {
+		return err
+	}
+	db.asns = ranges
+	return nil
+}
+
+// readRanges reads "start,end,fields..." rows sorted by start address
+func readRanges[T any](r io.Reader, parse func(fields []string) (*T, error)) ([]ipRange[T], error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	var ranges []ipRange[T]
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("line %d: too few columns", line)
+		}
+		start, err := netip.ParseAddr(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		end, err := netip.ParseAddr(record[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if end.Less(start) || start.Is4() != end.Is4() {
+			return nil, fmt.Errorf("line %d: invalid range %s-%s", line, start, end)
+		}
+		value, err := parse(record[2:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		ranges = append(ranges, ipRange[T]{start: start, end: end, value: value})
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start.Less(ranges[j].start) })
+	return ranges, nil
+}
+
+// find returns the range containing ip
+func find[T any](ranges []ipRange[T], ip netip.Addr) *T {
+	// The first range starting after ip; the one before may contain it
+	i := sort.Search(len(ranges), func(i int) bool { return ip.Less(ranges[i].start) })
+	if i == 0 {
+		return nil
+	}
+	r := ranges[i-1]
+	if ip.Compare(r.end) > 0 || ip.Is4() != r.start.Is4() {
+		return nil
+	}
+	return r.value
+}
+
+// Lookup returns the location of ip, and whether anything is known about it
+func (db *DB) Lookup(ip netip.Addr) (Location, bool) {
+	ip = ip.Unmap()
+	var loc Location
+	found := false
+	if p := find(db.places, ip); p != nil {
+		loc.Country, loc.City = p.country, p.city
+		loc.Latitude, loc.Longitude, loc.HasCoordinates = p.latitude, p.longitude, p.hasCoordinates
+		found = true
+	}
+	if a := find(db.asns, ip); a != nil {
+		loc.ASN, loc.ASOrg = a.number, a.org
+		found = true
+	}
+	return loc, found
+}
+
+// earthRadiusKm is the mean radius of the Earth
+const earthRadiusKm = 6371.0
+
+// DistanceKm returns the great-circle distance between two locations with
+// coordinates
+func DistanceKm(a, b Location) float64 {
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := rad(b.Latitude - a.Latitude)
+	dLon := rad(b.Longitude - a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(a.Latitude))*math.Cos(rad(b.Latitude))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
@@ -0,0 +1,63 @@
+package geoip
+
+import (
+	"math"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+const cityCSV = `1.0.0.0,1.0.0.255,OC,AU,Queensland,South Brisbane,-27.4748,153.017
+8.8.8.0,8.8.8.255,NA,US,California,Mountain View,37.4223,-122.085
+2001:4860::,2001:4860:ffff:ffff:ffff:ffff:ffff:ffff,NA,US,California,Mountain View,37.4223,-122.085
+`
+
+const asnCSV = `8.8.8.0,8.8.8.255,15169,Google LLC
+`
+
+func TestDB_Lookup(t *testing.T) {
+	db := &DB{}
+	if err := db.LoadLocations(strings.NewReader(cityCSV)); err != nil {
+		t.Fatalf("load locations: %v", err)
+	}
+	if err := db.LoadASNs(strings.NewReader(asnCSV)); err != nil {
+		t.Fatalf("load asns: %v", err)
+	}
+
+	loc, ok := db.Lookup(netip.MustParseAddr("::ffff:8.8.8.8"))
+	if !ok || loc.Country != "US" || loc.City != "Mountain View" || loc.ASN != 15169 || loc.ASOrg != "Google LLC" || !loc.HasCoordinates {
+		t.Fatalf("unexpected location: %+v", loc)
+	}
+	if loc, _ := db.Lookup(netip.MustParseAddr("2001:4860::8888")); loc.Country != "US" || loc.ASN != 0 {
+		t.Fatalf("unexpected IPv6 location: %+v", loc)
+	}
+	for _, ip := range []string{"8.8.9.1", "0.0.0.1", "1.0.1.0", "::1"} {
+		if _, ok := db.Lookup(netip.MustParseAddr(ip)); ok {
+			t.Errorf("%s: want no location", ip)
+		}
+	}
+
+	if err := db.LoadLocations(strings.NewReader("1.0.0.0,1.0.0.255,AU\n")); err != nil {
+		t.Fatalf("load countries: %v", err)
+	}
+	if loc, _ := db.Lookup(netip.MustParseAddr("1.0.0.1")); loc.Country != "AU" || loc.HasCoordinates {
+		t.Fatalf("unexpected country location: %+v", loc)
+	}
+
+	for _, bad := range []string{"1.0.0.9,1.0.0.1,AU\n", "1.0.0.0,::1,AU\n", "1.0.0.0,1.0.0.1,a,b\n"} {
+		if err := db.LoadLocations(strings.NewReader(bad)); err == nil {
+			t.Errorf("LoadLocations(%q): want error", bad)
+		}
+	}
+}
+
+func TestDistanceKm(t *testing.T) {
+	london := Location{Latitude: 51.5074, Longitude: -0.1278}
+	newYork := Location{Latitude: 40.7128, Longitude: -74.0060}
+	if d := DistanceKm(london, newYork); math.Abs(d-5570) > 20 {
+		t.Fatalf("London - New York = %.0f km, want about 5570", d)
+	}
+	if d := DistanceKm(london, london); d != 0 {
+		t.Fatalf("want 0, got %v", d)
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"highload-microservice/internal/alerting"
+	"highload-microservice/internal/security"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// TestAlertNotificationRequest names the channel to send a test alert to
+type TestAlertNotificationRequest struct {
+	Channel string `json:"channel" binding:"required"`
+}
+
+// SetAlertDispatcher enables the alert notification endpoints
+func (sh *SecurityHandler) SetAlertDispatcher(dispatcher *alerting.Dispatcher) {
+	sh.alerts = dispatcher
+}
+
+// alertsEnabled responds 503 when no notification channel is configured
+func (sh *SecurityHandler) alertsEnabled(c *gin.Context) bool {
+	if sh.alerts == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Alert notifications are not enabled"})
+		return false
+	}
+	return true
+}
+
+// ListAlertNotifications returns the outcome of recent alert notifications,
+// newest first
+func (sh *SecurityHandler) ListAlertNotifications(c *gin.Context) {
+	if !sh.alertsEnabled(c) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"channels":      sh.alerts.Channels(),
+		"notifications": sh.alerts.Deliveries(),
+		"timestamp":     time.Now().Unix(),
+	})
+}
+
+// TestAlertNotification sends a low severity test alert to one channel,
+// bypassing routes
+func (sh *SecurityHandler) TestAlertNotification(c *gin.Context) {
+	if !sh.alertsEnabled(c) {
+		return
+	}
+	var req TestAlertNotificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	alert := security.SecurityAlert{
+		ID:          uuid.New().String(),
+		Timestamp:   time.Now(),
+		Severity:    security.SeverityLow,
+		Title:       "Test notification",
+		Description: "Sent from /admin/security/notifications/test to check the " + req.Channel + " channel",
+	}
+	if err := sh.alerts.Test(req.Channel, alert); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Test alert queued", "alert_id": alert.ID})
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GetAnomalyThresholds returns the thresholds of the traffic anomaly detector
+func (sh *SecurityHandler) GetAnomalyThresholds(c *gin.Context) {
+	c.JSON(http.StatusOK, sh.auditor.AnomalyDetector().Thresholds())
+}
+
+// UpdateAnomalyThresholds changes the thresholds of the traffic anomaly
+// detector. Fields missing from the body keep their current value.
+func (sh *SecurityHandler) UpdateAnomalyThresholds(c *gin.Context) {
+	detector := sh.auditor.AnomalyDetector()
+	previous := detector.Thresholds()
+	thresholds := previous
+	if err := c.ShouldBindJSON(&thresholds); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if err := detector.SetThresholds(thresholds); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	adminUUID, _ := adminID.(uuid.UUID)
+	sh.auditor.LogAnomalyThresholdsChanged(adminUUID, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"), previous, thresholds)
+
+	c.JSON(http.StatusOK, thresholds)
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"highload-microservice/internal/auditarchive"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetAuditArchive enables the archive status endpoint
+func (sh *SecurityHandler) SetAuditArchive(exporter *auditarchive.Exporter) {
+	sh.archive = exporter
+}
+
+// GetAuditArchives reports what was archived per source and the latest
+// archives, of one source with ?source=
+func (sh *SecurityHandler) GetAuditArchives(c *gin.Context) {
+	if sh.archive == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Audit archiving is not enabled"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+
+	status, err := sh.archive.Status(c.Request.Context(), c.Query("source"), limit)
+	if err != nil {
+		sh.logger.Errorf("Failed to get audit archive status: %v", err)
+		respondError(c, err, "Failed to get audit archive status")
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
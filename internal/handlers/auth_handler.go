@@ -1,20 +1,32 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/middleware"
 	"highload-microservice/internal/models"
+	"highload-microservice/internal/oidc"
 	"highload-microservice/internal/security"
 	"highload-microservice/internal/services"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
 type AuthHandler struct {
-	authService     *services.AuthService
-	securityAuditor *security.SecurityAuditor
-	logger          *logrus.Logger
+	authService      *services.AuthService
+	securityAuditor  *security.SecurityAuditor
+	logger           *logrus.Logger
+	identityProvider *oidc.Provider             // nil disables OIDC login
+	sessions         *middleware.SessionCookies // nil when tokens are only returned in the body
 }
 
 func NewAuthHandler(authService *services.AuthService, securityAuditor *security.SecurityAuditor, logger *logrus.Logger) *AuthHandler {
@@ -25,6 +37,24 @@ func NewAuthHandler(authService *services.AuthService, securityAuditor *security
 	}
 }
 
+// SetSessionCookies sets the tokens of logins and refreshes as cookies too
+func (h *AuthHandler) SetSessionCookies(sessions *middleware.SessionCookies) {
+	h.sessions = sessions
+}
+
+// respondTokens writes a login or refresh response, setting the session
+// cookies when cookie sessions are enabled
+func (h *AuthHandler) respondTokens(c *gin.Context, response *models.LoginResponse) {
+	if h.sessions != nil {
+		if err := h.sessions.Issue(c, response); err != nil {
+			h.logger.Errorf("Failed to issue session cookies: %v", err)
+			respondError(c, err, "Failed to start session")
+			return
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
 // Login handles user login
 func (h *AuthHandler) Login(c *gin.Context) {
 	// The body is already bound by validation middleware; read from context to avoid EOF
@@ -43,7 +73,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 	req := *reqPtr
 
-	response, err := h.authService.AuthenticateUser(c.Request.Context(), req)
+	response, err := h.authService.AuthenticateUser(clientContext(c), req)
 	if err != nil {
 		// Log failed login attempt
 		h.securityAuditor.LogLoginFailure(
@@ -55,7 +85,22 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		)
 
 		h.logger.Errorf("Login failed for email %s: %v", req.Email, err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		if locked, ok := services.IsAccountLocked(err); ok {
+			if locked.JustLocked {
+				h.securityAuditor.LogAccountLocked(locked.UserID, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"), locked.Until)
+			}
+			seconds := int(math.Ceil(time.Until(locked.Until).Seconds()))
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.JSON(http.StatusLocked, gin.H{"error": "Account temporarily locked", "retry_after": seconds})
+			return
+		}
+		if retryAfter, throttled := services.IsLoginThrottled(err); throttled {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many login attempts", "retry_after": seconds})
+			return
+		}
+		respondError(c, err, "Login failed")
 		return
 	}
 
@@ -68,34 +113,67 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	)
 
 	h.logger.Infof("User logged in successfully: %s", req.Email)
-	c.JSON(http.StatusOK, response)
+	h.respondTokens(c, response)
+}
+
+// clientContext returns the request context carrying the caller's device,
+// recorded with the session a login starts
+func clientContext(c *gin.Context) context.Context {
+	return services.WithClientInfo(c.Request.Context(), services.ClientInfo{
+		IPAddress: c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+	})
 }
 
 // RefreshToken handles token refresh
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
-	val, exists := c.Get("validated_data")
-	if !exists {
+	var req models.RefreshTokenRequest
+	if val, exists := c.Get("validated_data"); exists {
+		reqPtr, ok := val.(*models.RefreshTokenRequest)
+		if !ok || reqPtr == nil {
+			h.logger.Errorf("Validated refresh data has invalid type")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": "invalid validated data"})
+			return
+		}
+		req = *reqPtr
+	} else if h.sessions != nil {
+		// With cookie sessions the body is optional: browsers send the cookie
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+			return
+		}
+		if req.RefreshToken == "" {
+			if req.RefreshToken = h.sessions.RefreshToken(c); req.RefreshToken == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": "refresh_token is required"})
+				return
+			}
+			if !h.sessions.ValidCSRF(c) {
+				return
+			}
+		}
+	} else {
 		h.logger.Errorf("Validated refresh data not found in context")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": "missing validated data"})
 		return
 	}
-	reqPtr, ok := val.(*models.RefreshTokenRequest)
-	if !ok || reqPtr == nil {
-		h.logger.Errorf("Validated refresh data has invalid type")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": "invalid validated data"})
-		return
-	}
-	req := *reqPtr
 
 	response, err := h.authService.RefreshToken(c.Request.Context(), req)
 	if err != nil {
 		h.logger.Errorf("Token refresh failed: %v", err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		if reuse, ok := services.IsRefreshTokenReuse(err); ok {
+			h.securityAuditor.LogRefreshTokenReuse(reuse.UserID, reuse.FamilyID, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"))
+		}
+		if errors.Is(err, apperrors.ErrUnauthorized) {
+			// Don't reveal whether the token or its user was the problem
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		respondError(c, err, "Failed to refresh token")
 		return
 	}
 
 	h.logger.Info("Token refreshed successfully")
-	c.JSON(http.StatusOK, response)
+	h.respondTokens(c, response)
 }
 
 // CreateAPIKey handles API key creation
@@ -118,6 +196,223 @@ func (h *AuthHandler) CreateAPIKey(c *gin.Context) {
 	c.JSON(http.StatusCreated, response)
 }
 
+// ListAPIKeys returns all API keys with masked secrets (admin only)
+func (h *AuthHandler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.authService.ListAPIKeys(c.Request.Context())
+	if err != nil {
+		h.logger.Errorf("Failed to list API keys: %v", err)
+		respondError(c, err, "Failed to list API keys")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+// RevokeAPIKey deactivates an API key (admin only)
+func (h *AuthHandler) RevokeAPIKey(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	revoked, err := h.authService.RevokeAPIKey(c.Request.Context(), id)
+	if err != nil {
+		h.logger.Errorf("Failed to revoke API key: %v", err)
+		respondError(c, err, "Failed to revoke API key")
+		return
+	}
+
+	if revoked {
+		adminID, _ := c.Get("user_id")
+		adminUUID, _ := adminID.(uuid.UUID)
+		h.securityAuditor.LogAPIKeyRevoked(id, adminUUID, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"))
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RotateAPIKey issues a new secret for an API key (admin only). The body is
+// optional; see models.RotateAPIKeyRequest.
+func (h *AuthHandler) RotateAPIKey(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	var req models.RotateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	var grace *time.Duration
+	if req.GraceSeconds != nil {
+		d := time.Duration(*req.GraceSeconds) * time.Second
+		grace = &d
+	}
+
+	response, err := h.authService.RotateAPIKey(c.Request.Context(), id, grace)
+	if err != nil {
+		h.logger.Errorf("Failed to rotate API key: %v", err)
+		respondError(c, err, "Failed to rotate API key")
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	adminUUID, _ := adminID.(uuid.UUID)
+	h.securityAuditor.LogAPIKeyRotated(id, adminUUID, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"), response.PreviousKeyExpiresAt)
+
+	c.JSON(http.StatusOK, response)
+}
+
+// UpdateAPIKeyLimits changes an API key's rate limit and monthly quota (admin only)
+func (h *AuthHandler) UpdateAPIKeyLimits(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	var req models.UpdateAPIKeyLimitsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	limits, err := h.authService.UpdateAPIKeyLimits(c.Request.Context(), id, req)
+	if err != nil {
+		h.logger.Errorf("Failed to update API key limits: %v", err)
+		respondError(c, err, "Failed to update API key limits")
+		return
+	}
+
+	c.JSON(http.StatusOK, limits)
+}
+
+// UnlockAccount lifts a lockout caused by repeated failed logins (admin only)
+func (h *AuthHandler) UnlockAccount(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := h.authService.UnlockAccount(c.Request.Context(), id); err != nil {
+		h.logger.Errorf("Failed to unlock account: %v", err)
+		respondError(c, err, "Failed to unlock account")
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	adminUUID, _ := adminID.(uuid.UUID)
+	h.securityAuditor.LogAccountUnlocked(id, adminUUID, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlocked"})
+}
+
+// UpdateUserRole changes the role of an account (admin only)
+func (h *AuthHandler) UpdateUserRole(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	change, err := h.authService.UpdateUserRole(c.Request.Context(), id, req.Role)
+	if err != nil {
+		h.logger.Errorf("Failed to update role: %v", err)
+		respondError(c, err, "Failed to update role")
+		return
+	}
+
+	if change.Previous != change.Role {
+		adminID, _ := c.Get("user_id")
+		adminUUID, _ := adminID.(uuid.UUID)
+		h.securityAuditor.LogRoleChanged(id, adminUUID, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"),
+			string(change.Previous), string(change.Role), change.Escalation)
+	}
+
+	c.JSON(http.StatusOK, change)
+}
+
+// RevokeSessions revokes every refresh token of the current user, signing
+// them out everywhere once their access tokens expire
+func (h *AuthHandler) RevokeSessions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	uid, ok := userID.(uuid.UUID)
+	if !exists || !ok {
+		h.logger.Error("User ID not found in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	revoked, err := h.authService.RevokeAllSessions(c.Request.Context(), uid)
+	if err != nil {
+		h.logger.Errorf("Failed to revoke sessions: %v", err)
+		respondError(c, err, "Failed to revoke sessions")
+		return
+	}
+
+	h.securityAuditor.LogSessionsRevoked(uid, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"), revoked)
+
+	c.JSON(http.StatusOK, gin.H{"revoked": revoked})
+}
+
+// ListSessions returns the current user's active sessions
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	uid, ok := userID.(uuid.UUID)
+	if !exists || !ok {
+		h.logger.Error("User ID not found in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	sessions, err := h.authService.ListSessions(c.Request.Context(), uid)
+	if err != nil {
+		h.logger.Errorf("Failed to list sessions: %v", err)
+		respondError(c, err, "Failed to list sessions")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions, "total": len(sessions)})
+}
+
+// RevokeSession revokes one of the current user's sessions, e.g. a lost
+// device
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	uid, ok := userID.(uuid.UUID)
+	if !exists || !ok {
+		h.logger.Error("User ID not found in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	if err := h.authService.RevokeSession(c.Request.Context(), uid, id); err != nil {
+		h.logger.Errorf("Failed to revoke session: %v", err)
+		respondError(c, err, "Failed to revoke session")
+		return
+	}
+
+	h.securityAuditor.LogSessionRevoked(uid, id, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"))
+
+	c.Status(http.StatusNoContent)
+}
+
 // GetProfile returns current user profile
 func (h *AuthHandler) GetProfile(c *gin.Context) {
 	userID, exists := c.Get("user_id")
@@ -139,11 +434,38 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 	c.JSON(http.StatusOK, profile)
 }
 
-// Logout handles user logout (in a stateless system, this is mainly for logging)
+// Logout revokes the current access token and, if its refresh token is
+// given, the session it belongs to
 func (h *AuthHandler) Logout(c *gin.Context) {
-	userEmail, exists := c.Get("user_email")
-	if exists {
-		h.logger.Infof("User logged out: %s", userEmail)
+	value, _ := c.Get("claims")
+	claims, ok := value.(*models.JWTClaims)
+	if !ok {
+		h.logger.Error("Token claims not found in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// The body is optional: without it only the access token is revoked
+	var req models.LogoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	if req.RefreshToken == "" && h.sessions != nil {
+		req.RefreshToken = h.sessions.RefreshToken(c)
+	}
+
+	if err := h.authService.Logout(c.Request.Context(), claims, req.RefreshToken); err != nil {
+		h.logger.Errorf("Logout failed: %v", err)
+		respondError(c, err, "Logout failed")
+		return
+	}
+
+	h.securityAuditor.LogLogout(claims.UserID, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"))
+	h.logger.Infof("User logged out: %s", claims.Email)
+	if h.sessions != nil {
+		h.sessions.Clear(c)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
@@ -9,7 +9,9 @@ import (
 	"testing"
 	"time"
 
+	"highload-microservice/internal/mail"
 	"highload-microservice/internal/models"
+	"highload-microservice/internal/repository"
 	"highload-microservice/internal/security"
 	"highload-microservice/internal/services"
 
@@ -18,6 +20,7 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -29,7 +32,7 @@ func newAuthHandlerForTest(t *testing.T) (*AuthHandler, sqlmock.Sqlmock, func())
 	}
 	logger := logrus.New()
 	cfg := services.AuthConfig{JWTSecret: "secret", JWTExpiration: time.Hour, RefreshExpiration: 24 * time.Hour, APIKeyLength: 4}
-	authSvc := services.NewAuthService(db, logger, cfg)
+	authSvc := services.NewAuthService(repository.NewPostgresAuthRepository(db), nil, logger, cfg)
 	auditor := security.NewSecurityAuditor(logger)
 	h := NewAuthHandler(authSvc, auditor, logger)
 	cleanup := func() { _ = db.Close() }
@@ -45,10 +48,10 @@ func TestAuthHandler_Login_Success(t *testing.T) {
 	hash, _ := bcrypt.GenerateFromPassword([]byte("pwd123456"), bcrypt.DefaultCost)
 	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, email, first_name, last_name, role, is_active, created_at, updated_at, password_hash`)).
 		WithArgs("u@example.com").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "first_name", "last_name", "role", "is_active", "created_at", "updated_at", "password_hash"}).
-			AddRow(uid, "u@example.com", "U", "S", "user", true, time.Now(), time.Now(), string(hash)))
-	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO refresh_tokens (user_id, token_hash, expires_at, created_at)`)).
-		WithArgs(uid, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "first_name", "last_name", "role", "is_active", "created_at", "updated_at", "password_hash", "failed_login_attempts", "locked_until"}).
+			AddRow(uid, "u@example.com", "U", "S", "user", true, time.Now(), time.Now(), string(hash), 0, nil))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at, created_at, user_agent, ip_address, login_at)`)).
+		WithArgs(uid, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	r := gin.New()
@@ -92,8 +95,8 @@ func TestAuthHandler_Login_InvalidCreds(t *testing.T) {
 	hash, _ := bcrypt.GenerateFromPassword([]byte("correct"), bcrypt.DefaultCost)
 	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, email, first_name, last_name, role, is_active, created_at, updated_at, password_hash`)).
 		WithArgs("u@example.com").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "first_name", "last_name", "role", "is_active", "created_at", "updated_at", "password_hash"}).
-			AddRow(uid, "u@example.com", "U", "S", "user", true, time.Now(), time.Now(), string(hash)))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "first_name", "last_name", "role", "is_active", "created_at", "updated_at", "password_hash", "failed_login_attempts", "locked_until"}).
+			AddRow(uid, "u@example.com", "U", "S", "user", true, time.Now(), time.Now(), string(hash), 0, nil))
 
 	r := gin.New()
 	r.POST("/login", func(c *gin.Context) {
@@ -116,15 +119,22 @@ func TestAuthHandler_Refresh_Success(t *testing.T) {
 	defer cleanup()
 
 	uid := uuid.New()
-	// verifyRefreshToken
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT user_id, expires_at FROM refresh_tokens WHERE token_hash = $1`)).
+	// lookupRefreshToken
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, user_id, COALESCE(family_id, id), expires_at, revoked_at, user_agent, ip_address, COALESCE(login_at, created_at) FROM refresh_tokens WHERE token_hash = $1`)).
 		WithArgs(sqlmock.AnyArg()).
-		WillReturnRows(sqlmock.NewRows([]string{"user_id", "expires_at"}).AddRow(uid, time.Now().Add(time.Hour)))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "family_id", "expires_at", "revoked_at", "user_agent", "ip_address", "login_at"}).
+			AddRow(uuid.New(), uid, uuid.New(), time.Now().Add(time.Hour), nil, "", "", time.Now()))
+	// rotation revokes the presented token
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE refresh_tokens SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
 	// user fetch
 	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, email, first_name, last_name, role, is_active, created_at, updated_at`)).
 		WithArgs(uid).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "first_name", "last_name", "role", "is_active", "created_at", "updated_at"}).
 			AddRow(uid, "u@example.com", "U", "S", "user", true, time.Now(), time.Now()))
+	// new refresh token
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at, created_at, user_agent, ip_address, login_at)`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	r := gin.New()
 	r.POST("/refresh", func(c *gin.Context) {
@@ -161,10 +171,11 @@ func TestAuthHandler_Refresh_Unauthorized(t *testing.T) {
 	h, mock, cleanup := newAuthHandlerForTest(t)
 	defer cleanup()
 
-	// verifyRefreshToken returns expired
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT user_id, expires_at FROM refresh_tokens WHERE token_hash = $1`)).
+	// lookupRefreshToken returns expired
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, user_id, COALESCE(family_id, id), expires_at, revoked_at, user_agent, ip_address, COALESCE(login_at, created_at) FROM refresh_tokens WHERE token_hash = $1`)).
 		WithArgs(sqlmock.AnyArg()).
-		WillReturnRows(sqlmock.NewRows([]string{"user_id", "expires_at"}).AddRow(uuid.New(), time.Now().Add(-time.Hour)))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "family_id", "expires_at", "revoked_at", "user_agent", "ip_address", "login_at"}).
+			AddRow(uuid.New(), uuid.New(), uuid.New(), time.Now().Add(-time.Hour), nil, "", "", time.Now()))
 
 	r := gin.New()
 	r.POST("/refresh", func(c *gin.Context) {
@@ -185,8 +196,8 @@ func TestAuthHandler_CreateAPIKey_Fail(t *testing.T) {
 	h, mock, cleanup := newAuthHandlerForTest(t)
 	defer cleanup()
 
-	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO api_keys (id, name, key_hash, permissions, is_active, created_at, expires_at)`)).
-		WithArgs(sqlmock.AnyArg(), "key", sqlmock.AnyArg(), sqlmock.AnyArg(), true, sqlmock.AnyArg(), sqlmock.AnyArg()).
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO api_keys (id, name, key_hash, key_prefix, permissions, is_active, created_at, expires_at, rate_limit_per_minute, monthly_quota)`)).
+		WithArgs(sqlmock.AnyArg(), "key", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), true, sqlmock.AnyArg(), sqlmock.AnyArg(), 0, int64(0)).
 		WillReturnError(sql.ErrConnDone)
 
 	r := gin.New()
@@ -207,8 +218,8 @@ func TestAuthHandler_CreateAPIKey_Success(t *testing.T) {
 	h, mock, cleanup := newAuthHandlerForTest(t)
 	defer cleanup()
 
-	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO api_keys (id, name, key_hash, permissions, is_active, created_at, expires_at)`)).
-		WithArgs(sqlmock.AnyArg(), "key", sqlmock.AnyArg(), sqlmock.AnyArg(), true, sqlmock.AnyArg(), sqlmock.AnyArg()).
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO api_keys (id, name, key_hash, key_prefix, permissions, is_active, created_at, expires_at, rate_limit_per_minute, monthly_quota)`)).
+		WithArgs(sqlmock.AnyArg(), "key", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), true, sqlmock.AnyArg(), sqlmock.AnyArg(), 0, int64(0)).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	r := gin.New()
@@ -273,3 +284,144 @@ func TestAuthHandler_GetProfile_Success(t *testing.T) {
 		t.Fatalf("want 200, got %d", w.Code)
 	}
 }
+
+func TestAuthHandler_RevokeSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h, mock, cleanup := newAuthHandlerForTest(t)
+	defer cleanup()
+
+	uid, sessionID := uuid.New(), uuid.New()
+	r := gin.New()
+	r.DELETE("/sessions/:id", func(c *gin.Context) {
+		c.Set("user_id", uid)
+		h.RevokeSession(c)
+	})
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE refresh_tokens SET revoked_at = $1 WHERE user_id = $2 AND (family_id = $3 OR id = $4)`)).
+		WithArgs(sqlmock.AnyArg(), uid, sessionID, sessionID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	for path, want := range map[string]int{
+		"/sessions/not-a-uuid":            http.StatusBadRequest,
+		"/sessions/" + sessionID.String(): http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodDelete, path, nil)
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Fatalf("%s: want %d, got %d", path, want, w.Code)
+		}
+	}
+}
+
+func TestAuthHandler_Register_HidesTakenEmails(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h, mock, cleanup := newAuthHandlerForTest(t)
+	defer cleanup()
+	h.authService.SetRegistration(&mail.LogSender{Logger: logrus.New()}, services.RegistrationConfig{VerifyURL: "https://app.example.com/verify", TokenSecret: "s"})
+
+	insert := regexp.QuoteMeta(`INSERT INTO auth_users`)
+	mock.ExpectExec(insert).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insert).WillReturnError(&pq.Error{Code: "23505"})
+
+	r := gin.New()
+	r.POST("/register", func(c *gin.Context) {
+		c.Set("validated_data", &models.RegisterRequest{Email: "u@example.com", Password: "s3cure-Passphrase", FirstName: "U", LastName: "S"})
+		h.Register(c)
+	})
+	r.GET("/verify", h.VerifyEmail)
+
+	var bodies []string
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/register", nil))
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("attempt %d: want 202, got %d, body=%s", i, w.Code, w.Body.String())
+		}
+		bodies = append(bodies, w.Body.String())
+	}
+	if bodies[0] != bodies[1] {
+		t.Fatalf("a taken email must look like a new one: %s vs %s", bodies[0], bodies[1])
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/verify?token=bogus", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("bogus token: want 400, got %d", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestAuthHandler_InviteUser_OnlyCoveredRoles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h, mock, cleanup := newAuthHandlerForTest(t)
+	defer cleanup()
+	h.authService.SetInvitations(&mail.LogSender{Logger: logrus.New()}, services.InvitationConfig{AcceptURL: "https://app.example.com/accept-invite"})
+
+	invite := func(callerRole models.UserRole, role models.UserRole) int {
+		r := gin.New()
+		r.POST("/invite", func(c *gin.Context) {
+			c.Set("user_id", uuid.New())
+			c.Set("user_role", callerRole)
+			c.Set("validated_data", &models.InviteUserRequest{Email: "new@example.com", Role: role})
+			h.InviteUser(c)
+		})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/invite", nil))
+		return w.Code
+	}
+
+	if code := invite(models.RoleUser, models.RoleAdmin); code != http.StatusForbidden {
+		t.Fatalf("user inviting an admin: want 403, got %d", code)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, role, is_active FROM auth_users WHERE email = $1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "role", "is_active"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE invitations`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO invitations`)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if code := invite(models.RoleAdmin, models.RoleAdmin); code != http.StatusCreated {
+		t.Fatalf("admin inviting an admin: want 201, got %d", code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestAuthHandler_UpdateProfile_ChangesOwnNames(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h, mock, cleanup := newAuthHandlerForTest(t)
+	defer cleanup()
+
+	uid := uuid.New()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, email, first_name, last_name, role, is_active, created_at, updated_at, pending_email`)).
+		WithArgs(uid).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "first_name", "last_name", "role", "is_active", "created_at", "updated_at", "pending_email"}).
+			AddRow(uid, "u@example.com", "U", "S", "user", true, time.Now(), time.Now(), nil))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE auth_users SET first_name = $1, last_name = $2`)).
+		WithArgs("New", "S", "", sqlmock.AnyArg(), uid).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	first := "New"
+	r := gin.New()
+	r.PUT("/profile", func(c *gin.Context) {
+		c.Set("user_id", uid)
+		c.Set("validated_data", &models.UpdateUserRequest{FirstName: &first})
+		h.UpdateProfile(c)
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/profile", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("want 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+	var profile models.Profile
+	if err := json.Unmarshal(w.Body.Bytes(), &profile); err != nil || profile.FirstName != "New" || profile.Email != "u@example.com" {
+		t.Fatalf("unexpected profile %s: %v", w.Body.String(), err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"highload-microservice/internal/avatar"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// SetAvatars enables the /users/:id/avatar endpoints. Served images may be
+// cached for maxAge; every upload changes their ETag.
+func (h *UserHandler) SetAvatars(manager *avatar.Manager, maxAge time.Duration) {
+	h.avatars = manager
+	h.avatarMaxAge = maxAge
+}
+
+// avatarsEnabled responds 503 when avatars are not enabled
+func (h *UserHandler) avatarsEnabled(c *gin.Context) bool {
+	if h.avatars == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Avatars are not enabled"})
+		return false
+	}
+	return true
+}
+
+// UploadAvatar replaces the user's avatar with the multipart "file" field,
+// validated by ValidateFileUpload. Thumbnails are resized in the background.
+func (h *UserHandler) UploadAvatar(c *gin.Context) {
+	if !h.avatarsEnabled(c) {
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	upload, exists := c.Get("uploaded_file")
+	file, ok := upload.(multipart.File)
+	if !exists || !ok {
+		h.logger.Error("Uploaded file not found in context")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+
+	if _, err := h.userService.GetUser(c.Request.Context(), id); err != nil {
+		respondError(c, err, "Failed to get user")
+		return
+	}
+
+	maxBytes := h.avatars.Config().MaxBytes
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		h.logger.Errorf("Failed to read avatar upload: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read upload"})
+		return
+	}
+
+	uploaded, err := h.avatars.Upload(c.Request.Context(), id, data)
+	if err != nil {
+		h.logger.Errorf("Failed to upload avatar: %v", err)
+		respondError(c, err, "Failed to upload avatar")
+		return
+	}
+	c.JSON(http.StatusCreated, uploaded)
+}
+
+// GetAvatar serves the user's avatar, or its square thumbnail with ?size=.
+// A thumbnail that is not resized yet is served as the original, uncached.
+func (h *UserHandler) GetAvatar(c *gin.Context) {
+	if !h.avatarsEnabled(c) {
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	size := 0
+	if raw := c.Query("size"); raw != "" {
+		sizes := h.avatars.Config().ThumbnailSizes
+		if size, err = strconv.Atoi(raw); err != nil || !slices.Contains(sizes, size) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid size", "sizes": sizes})
+			return
+		}
+	}
+
+	current, err := h.avatars.Get(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err, "Failed to get avatar")
+		return
+	}
+
+	// The tag changes when the requested thumbnail replaces the original
+	ready := size == 0 || slices.Contains(current.Thumbnails, size)
+	unchanged := notModified(c, etag(current.Version, strconv.Itoa(size), strconv.FormatBool(ready)), current.UpdatedAt)
+	if ready {
+		c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(h.avatarMaxAge.Seconds())))
+	}
+	if unchanged {
+		return
+	}
+
+	data, contentType, err := h.avatars.Image(c.Request.Context(), current, size)
+	if err != nil {
+		h.logger.Errorf("Failed to read avatar: %v", err)
+		respondError(c, err, "Failed to get avatar")
+		return
+	}
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// DeleteAvatar removes the user's avatar and its thumbnails
+func (h *UserHandler) DeleteAvatar(c *gin.Context) {
+	if !h.avatarsEnabled(c) {
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if _, err := h.avatars.Get(c.Request.Context(), id); err != nil {
+		respondError(c, err, "Failed to get avatar")
+		return
+	}
+	if err := h.avatars.Remove(c.Request.Context(), id); err != nil {
+		h.logger.Errorf("Failed to delete avatar: %v", err)
+		respondError(c, err, "Failed to delete avatar")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// etag returns a weak entity tag for a resource version. Weak, because the
+// body may be re-encoded (compressed) on the way out.
+func etag(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "|")))
+	return `W/"` + hex.EncodeToString(sum[:12]) + `"`
+}
+
+// notModified sets the validators of a single resource and, if the client's
+// copy is current, responds 304 and returns true. If-None-Match takes
+// precedence over If-Modified-Since, as in RFC 9110.
+func notModified(c *gin.Context, tag string, modified time.Time) bool {
+	c.Header("ETag", tag)
+	c.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	// Cacheable, but revalidated on every use
+	c.Header("Cache-Control", "no-cache")
+
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		if !etagMatches(match, tag) {
+			return false
+		}
+		c.Status(http.StatusNotModified)
+		return true
+	}
+
+	if since := c.GetHeader("If-Modified-Since"); since != "" {
+		t, err := http.ParseTime(since)
+		// Last-Modified has a resolution of one second
+		if err != nil || modified.Truncate(time.Second).After(t) {
+			return false
+		}
+		c.Status(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// etagMatches compares an If-None-Match header with tag using the weak
+// comparison
+func etagMatches(header, tag string) bool {
+	opaque := strings.TrimPrefix(tag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == opaque {
+			return true
+		}
+	}
+	return false
+}
+
+// setLastModified sets Last-Modified on a list response to its newest item;
+// empty lists get no header
+func setLastModified(c *gin.Context, times ...time.Time) {
+	var latest time.Time
+	for _, t := range times {
+		if t.After(latest) {
+			latest = t
+		}
+	}
+	if !latest.IsZero() {
+		c.Header("Last-Modified", latest.UTC().Format(http.TimeFormat))
+	}
+}
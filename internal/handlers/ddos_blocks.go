@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"highload-microservice/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// DDoSBlocklist lists and lifts the blocks of DDoS protection. Implemented by
+// middleware.DDoSProtection.
+type DDoSBlocklist interface {
+	Blocks(ctx context.Context) ([]middleware.DDoSBlock, error)
+	Unblock(ctx context.Context, ip string) (bool, error)
+}
+
+// DDoSBlockResponse is an active block with its remaining time
+type DDoSBlockResponse struct {
+	middleware.DDoSBlock
+	RemainingSeconds int64 `json:"remaining_seconds"`
+}
+
+// SetDDoSBlocklist enables the DDoS block management endpoints
+func (sh *SecurityHandler) SetDDoSBlocklist(blocklist DDoSBlocklist) {
+	sh.ddos = blocklist
+}
+
+// ListDDoSBlocks returns the IPs blocked by DDoS protection, longest
+// remaining first
+func (sh *SecurityHandler) ListDDoSBlocks(c *gin.Context) {
+	if sh.ddos == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "DDoS protection is not enabled"})
+		return
+	}
+
+	blocks, err := sh.ddos.Blocks(c.Request.Context())
+	if err != nil {
+		sh.logger.Errorf("Failed to list DDoS blocks: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list DDoS blocks"})
+		return
+	}
+	now := time.Now()
+	response := make([]DDoSBlockResponse, 0, len(blocks))
+	for _, block := range blocks {
+		remaining := int64(block.Until.Sub(now).Round(time.Second) / time.Second)
+		response = append(response, DDoSBlockResponse{DDoSBlock: block, RemainingSeconds: max(remaining, 0)})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"blocks":    response,
+		"timestamp": now.Unix(),
+	})
+}
+
+// DeleteDDoSBlock lifts the DDoS protection block of an IP and resets its
+// repeat offender escalation
+func (sh *SecurityHandler) DeleteDDoSBlock(c *gin.Context) {
+	if sh.ddos == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "DDoS protection is not enabled"})
+		return
+	}
+
+	ip, err := netip.ParseAddr(c.Param("ip"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid IP address"})
+		return
+	}
+	unblocked, err := sh.ddos.Unblock(c.Request.Context(), ip.String())
+	if err != nil {
+		sh.logger.Errorf("Failed to unblock %s: %v", ip, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unblock IP"})
+		return
+	}
+	if !unblocked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "IP is not blocked"})
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	adminUUID, _ := adminID.(uuid.UUID)
+	sh.auditor.LogDDoSUnblocked(adminUUID, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"), ip.String())
+
+	c.JSON(http.StatusNoContent, nil)
+}
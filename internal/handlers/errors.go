@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"highload-microservice/internal/apperrors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondError maps a service error to an HTTP response. Domain errors carry
+// their status and a client-safe message; anything else becomes a 500 with
+// the given fallback message so internals don't leak.
+func respondError(c *gin.Context, err error, fallback string) {
+	status := apperrors.HTTPStatus(err)
+	message := apperrors.Message(err)
+	if status == http.StatusInternalServerError || message == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+		return
+	}
+	c.JSON(status, gin.H{"error": capitalize(message)})
+}
+
+// capitalize upper-cases the first letter; service messages are lower-case
+// like Go errors, response messages are sentence case
+func capitalize(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError {
+		return s
+	}
+	return string(unicode.ToUpper(r)) + strings.TrimPrefix(s, s[:size])
+}
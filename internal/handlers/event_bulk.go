@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/services"
+	"highload-microservice/internal/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StructValidator validates request structs against their validate tags.
+// Implemented by middleware.ValidationMiddleware.
+type StructValidator interface {
+	ValidateStruct(obj interface{}) []validation.ValidationError
+}
+
+// BulkIngestConfig limits POST /api/v1/events/bulk
+type BulkIngestConfig struct {
+	MaxEvents    int // lines per request; ingestion stops at the next one
+	BatchSize    int // events stored per transaction
+	MaxLineBytes int
+}
+
+// SetBulkIngest enables POST /api/v1/events/bulk. Lines are validated like
+// the body of POST /api/v1/events.
+func (h *EventHandler) SetBulkIngest(validator StructValidator, cfg BulkIngestConfig) {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	if cfg.MaxLineBytes <= 0 {
+		cfg.MaxLineBytes = 16384
+	}
+	h.bulkValidator = validator
+	h.bulk = cfg
+}
+
+// BulkCreateEvents ingests an NDJSON stream of events, one create request
+// per line. Valid lines are stored in batches as they are read; the response
+// reports every line, 200 when all were created and 207 otherwise. Batches
+// stored before a failure that stops the ingestion stay stored.
+func (h *EventHandler) BulkCreateEvents(c *gin.Context) {
+	if h.bulkValidator == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Bulk event ingestion is not enabled"})
+		return
+	}
+	switch c.ContentType() {
+	case "application/x-ndjson", "application/jsonl":
+	default:
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be application/x-ndjson"})
+		return
+	}
+
+	ingest := &bulkIngest{handler: h, c: c, response: models.BulkEventResponse{Results: []models.BulkEventResult{}}}
+	scanner := bufio.NewScanner(c.Request.Body)
+	scanner.Buffer(make([]byte, 0, min(4096, h.bulk.MaxLineBytes)), h.bulk.MaxLineBytes)
+
+	line, events := 0, 0
+	for scanner.Scan() {
+		line++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		if events++; h.bulk.MaxEvents > 0 && events > h.bulk.MaxEvents {
+			if !ingest.flush() {
+				return
+			}
+			ingest.stop(http.StatusRequestEntityTooLarge, fmt.Sprintf("Too many events, at most %d per request; stopped at line %d", h.bulk.MaxEvents, line))
+			return
+		}
+
+		var req models.CreateEventRequest
+		if err := json.Unmarshal(raw, &req); err != nil {
+			ingest.reject(line, "Invalid JSON: "+err.Error())
+			continue
+		}
+		if errs := h.bulkValidator.ValidateStruct(&req); len(errs) > 0 {
+			messages := make([]string, len(errs))
+			for i, e := range errs {
+				messages[i] = e.Message
+			}
+			ingest.reject(line, strings.Join(messages, "; "))
+			continue
+		}
+		if ingest.add(line, req) >= h.bulk.BatchSize && !ingest.flush() {
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		if !ingest.flush() {
+			return
+		}
+		if errors.Is(err, bufio.ErrTooLong) {
+			ingest.stop(http.StatusRequestEntityTooLarge, fmt.Sprintf("Line %d exceeds %d bytes", line+1, h.bulk.MaxLineBytes))
+			return
+		}
+		h.logger.Warnf("Failed to read bulk events: %v", err)
+		ingest.stop(http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+	if !ingest.flush() {
+		return
+	}
+	if events == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Request body has no events"})
+		return
+	}
+
+	status := http.StatusOK
+	if ingest.response.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, ingest.response)
+}
+
+// bulkIngest collects the results of a bulk ingestion and the valid lines
+// waiting to be stored
+type bulkIngest struct {
+	handler  *EventHandler
+	c        *gin.Context
+	response models.BulkEventResponse
+
+	pending []models.CreateEventRequest
+	slots   []int // indexes in response.Results of the pending lines
+}
+
+func (b *bulkIngest) reject(line int, message string) {
+	b.response.Results = append(b.response.Results, models.BulkEventResult{Line: line, Status: models.BulkEventFailed, Error: message})
+	b.response.Failed++
+}
+
+// add queues a valid line and returns the number of pending lines
+func (b *bulkIngest) add(line int, req models.CreateEventRequest) int {
+	b.slots = append(b.slots, len(b.response.Results))
+	b.response.Results = append(b.response.Results, models.BulkEventResult{Line: line})
+	b.pending = append(b.pending, req)
+	return len(b.pending)
+}
+
+// flush stores the pending lines. On a failure that stops the ingestion it
+// responds and returns false.
+func (b *bulkIngest) flush() bool {
+	if len(b.pending) == 0 {
+		return true
+	}
+	results, err := b.handler.eventService.CreateEvents(b.c.Request.Context(), b.pending)
+	for n, i := range b.slots {
+		result := services.BulkResult{Err: err}
+		if n < len(results) {
+			result = results[n]
+		}
+		slot := &b.response.Results[i]
+		if result.Err != nil {
+			slot.Status = models.BulkEventFailed
+			slot.Error = bulkError(result.Err)
+			b.response.Failed++
+			continue
+		}
+		id := result.Event.ID
+		slot.Status = models.BulkEventCreated
+		slot.ID = &id
+		b.response.Created++
+	}
+	b.pending, b.slots = b.pending[:0], b.slots[:0]
+
+	if err != nil {
+		b.handler.logger.Errorf("Failed to create events: %v", err)
+		b.stop(apperrors.HTTPStatus(err), bulkError(err))
+		return false
+	}
+	return true
+}
+
+// stop ends the ingestion before the end of the body with the results so far
+func (b *bulkIngest) stop(status int, message string) {
+	b.response.Error = message
+	b.c.JSON(status, b.response)
+}
+
+// bulkError is the client-safe message of a line that was not stored
+func bulkError(err error) string {
+	message := apperrors.Message(err)
+	if message == "" || apperrors.HTTPStatus(err) == http.StatusInternalServerError {
+		return "Failed to create event"
+	}
+	return capitalize(message)
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"highload-microservice/internal/cache"
+	"highload-microservice/internal/middleware"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/repository"
+	"highload-microservice/internal/services"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+func newBulkRouter(t *testing.T, cfg BulkIngestConfig) (*gin.Engine, sqlmock.Sqlmock) {
+	gin.SetMode(gin.TestMode)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	repo := repository.NewPostgresEventRepository(db)
+	svc := services.NewEventService(repo, cache.NewMemoryCache(), &stubKafkaEH{}, logrus.New())
+	svc.SetBulkStore(repo, nil)
+	h := NewEventHandler(svc, logrus.New())
+	h.SetBulkIngest(middleware.NewValidationMiddleware(logrus.New()), cfg)
+
+	r := gin.New()
+	r.POST("/events/bulk", h.BulkCreateEvents)
+	return r, mock
+}
+
+func postBulk(r *gin.Engine, body string) (*httptest.ResponseRecorder, models.BulkEventResponse) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/events/bulk", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	r.ServeHTTP(w, req)
+	var resp models.BulkEventResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	return w, resp
+}
+
+// expectCopy expects one COPY transaction of n events
+func expectCopy(mock sqlmock.Sqlmock, n int) {
+	mock.ExpectBegin()
+	copyIn := mock.ExpectPrepare(regexp.QuoteMeta(`COPY "events" ("id", "user_id", "type", "data", "created_at") FROM STDIN`))
+	for i := 0; i < n; i++ {
+		copyIn.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	copyIn.ExpectExec().WithArgs().WillReturnResult(sqlmock.NewResult(0, int64(n)))
+	mock.ExpectCommit()
+}
+
+func bulkLine(userID uuid.UUID, eventType string) string {
+	return fmt.Sprintf(`{"user_id":%q,"type":%q,"data":"{}"}`, userID, eventType)
+}
+
+func TestEventHandler_BulkCreateEvents(t *testing.T) {
+	r, mock := newBulkRouter(t, BulkIngestConfig{MaxEvents: 10, BatchSize: 2})
+	expectCopy(mock, 2)
+	expectCopy(mock, 1)
+
+	body := strings.Join([]string{
+		bulkLine(uuid.New(), "login"),
+		`{"user_id":`,
+		"",
+		bulkLine(uuid.New(), "login"),
+		`{"user_id":"` + uuid.NewString() + `","type":"login"}`,
+		bulkLine(uuid.New(), "logout"),
+	}, "\n")
+	w, resp := postBulk(r, body)
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("want 207, got %d: %s", w.Code, w.Body.String())
+	}
+	if resp.Created != 3 || resp.Failed != 2 || len(resp.Results) != 5 {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	wantLines := []int{1, 2, 4, 5, 6}
+	wantStatus := []string{models.BulkEventCreated, models.BulkEventFailed, models.BulkEventCreated, models.BulkEventFailed, models.BulkEventCreated}
+	for i, result := range resp.Results {
+		if result.Line != wantLines[i] || result.Status != wantStatus[i] {
+			t.Errorf("result %d: got line %d %s, want line %d %s", i, result.Line, result.Status, wantLines[i], wantStatus[i])
+		}
+		if (result.ID != nil) != (result.Status == models.BulkEventCreated) {
+			t.Errorf("result %d: unexpected id %v", i, result.ID)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEventHandler_BulkCreateEvents_TooManyEvents(t *testing.T) {
+	r, mock := newBulkRouter(t, BulkIngestConfig{MaxEvents: 2, BatchSize: 10})
+	expectCopy(mock, 2)
+
+	body := strings.Join([]string{bulkLine(uuid.New(), "a"), bulkLine(uuid.New(), "b"), bulkLine(uuid.New(), "c")}, "\n")
+	w, resp := postBulk(r, body)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("want 413, got %d", w.Code)
+	}
+	if resp.Created != 2 || resp.Error == "" {
+		t.Fatalf("expected the first two events stored before stopping, got %+v", resp)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEventHandler_BulkCreateEvents_RequiresNDJSON(t *testing.T) {
+	r, _ := newBulkRouter(t, BulkIngestConfig{})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/events/bulk", strings.NewReader(bulkLine(uuid.New(), "a")))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("want 415, got %d", w.Code)
+	}
+}
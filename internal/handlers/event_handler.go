@@ -1,11 +1,20 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
 	"strconv"
+	"time"
 
+	"highload-microservice/internal/analytics"
+	"highload-microservice/internal/eventtype"
 	"highload-microservice/internal/models"
+	"highload-microservice/internal/processor"
+	"highload-microservice/internal/retention"
+	"highload-microservice/internal/saga"
+	"highload-microservice/internal/schema"
 	"highload-microservice/internal/services"
+	"highload-microservice/internal/webhook"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -14,7 +23,18 @@ import (
 
 type EventHandler struct {
 	eventService *services.EventService
+	schemas      *schema.Registry
+	types        *eventtype.Registry
+	webhooks     *webhook.Manager
+	analytics    *analytics.Service
+	retention    *retention.Service
+	processor    *processor.Registry
+	sagas        *saga.Engine
 	logger       *logrus.Logger
+
+	// NDJSON ingestion, see SetBulkIngest
+	bulkValidator StructValidator
+	bulk          BulkIngestConfig
 }
 
 func NewEventHandler(eventService *services.EventService, logger *logrus.Logger) *EventHandler {
@@ -35,7 +55,11 @@ func (h *EventHandler) CreateEvent(c *gin.Context) {
 	event, err := h.eventService.CreateEvent(c.Request.Context(), req)
 	if err != nil {
 		h.logger.Errorf("Failed to create event: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create event"})
+		if exceeded, ok := services.IsEventQuotaExceeded(err); ok {
+			respondQuotaExceeded(c, exceeded)
+			return
+		}
+		respondError(c, err, "Failed to create event")
 		return
 	}
 
@@ -51,17 +75,18 @@ func (h *EventHandler) GetEvent(c *gin.Context) {
 		return
 	}
 
-	event, err := h.eventService.GetEvent(c.Request.Context(), id)
+	event, err := h.eventService.GetEvent(callerContext(c), id)
 	if err != nil {
 		h.logger.Errorf("Failed to get event: %v", err)
-		if err.Error() == "event not found" {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get event"})
+		respondError(c, err, "Failed to get event")
 		return
 	}
 
+	// Events are immutable; the tag only differs for callers that may not
+	// read an encrypted payload
+	if notModified(c, etag(event.ID.String(), event.CreatedAt.UTC().Format(time.RFC3339Nano), strconv.FormatBool(event.Encrypted)), event.CreatedAt) {
+		return
+	}
 	c.JSON(http.StatusOK, event)
 }
 
@@ -79,12 +104,47 @@ func (h *EventHandler) ListEvents(c *gin.Context) {
 		limit = 10
 	}
 
-	events, err := h.eventService.ListEvents(c.Request.Context(), page, limit)
+	after, ok := parseCursor(c)
+	if !ok {
+		return
+	}
+
+	events, err := h.eventService.ListEvents(callerContext(c), page, limit, after)
 	if err != nil {
 		h.logger.Errorf("Failed to list events: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list events"})
 		return
 	}
 
+	created := make([]time.Time, 0, len(events.Events))
+	for _, event := range events.Events {
+		created = append(created, event.CreatedAt)
+	}
+	setLastModified(c, created...)
+	if c.Query("expand") == "type" && h.types != nil {
+		names := make([]string, 0, len(events.Events))
+		for _, event := range events.Events {
+			names = append(names, event.Type)
+		}
+		events.Types = h.types.Describe(names)
+	}
 	c.JSON(http.StatusOK, events)
 }
+
+// callerContext returns the request context annotated with the authenticated
+// caller's role, which decides whether encrypted payloads are revealed, and
+// user ID, recorded as the actor of audited changes
+func callerContext(c *gin.Context) context.Context {
+	ctx := c.Request.Context()
+	if role, ok := c.Get("user_role"); ok {
+		if userRole, ok := role.(models.UserRole); ok {
+			ctx = services.WithCallerRole(ctx, string(userRole))
+		}
+	}
+	if id, ok := c.Get("user_id"); ok {
+		if userID, ok := id.(uuid.UUID); ok {
+			ctx = services.WithCallerID(ctx, userID)
+		}
+	}
+	return ctx
+}
@@ -11,7 +11,9 @@ import (
 	"testing"
 	"time"
 
+	"highload-microservice/internal/cache"
 	"highload-microservice/internal/models"
+	"highload-microservice/internal/repository"
 	"highload-microservice/internal/services"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -24,20 +26,12 @@ type stubKafkaEH struct{}
 
 func (s *stubKafkaEH) SendEvent(ctx context.Context, event models.KafkaEvent) error { return nil }
 
-type stubRedisEH struct{}
-
-func (s *stubRedisEH) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
-	return nil
-}
-func (s *stubRedisEH) Get(ctx context.Context, key string) (string, error) { return "", sql.ErrNoRows }
-func (s *stubRedisEH) Del(ctx context.Context, keys ...string) error       { return nil }
-
 func newEventHandlerForTest(t *testing.T) (*EventHandler, sqlmock.Sqlmock, func()) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("sqlmock: %v", err)
 	}
-	svc := services.NewEventService(db, &stubRedisEH{}, &stubKafkaEH{}, logrus.New())
+	svc := services.NewEventService(repository.NewPostgresEventRepository(db), cache.NewMemoryCache(), &stubKafkaEH{}, logrus.New())
 	h := NewEventHandler(svc, logrus.New())
 	cleanup := func() { _ = db.Close() }
 	return h, mock, cleanup
@@ -143,6 +137,21 @@ func TestEventHandler_ListEvents_PaginationBounds(t *testing.T) {
 	}
 }
 
+func TestEventHandler_ListEvents_InvalidCursor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h, _, cleanup := newEventHandlerForTest(t)
+	defer cleanup()
+
+	r := gin.New()
+	r.GET("/events", h.ListEvents)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/events?cursor=bogus", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("want 400, got %d", w.Code)
+	}
+}
+
 func TestEventHandler_CreateEvent_Fail(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	h, mock, cleanup := newEventHandlerForTest(t)
@@ -178,3 +187,41 @@ func TestEventHandler_GetEvent_BadID(t *testing.T) {
 		t.Fatalf("want 400, got %d", w.Code)
 	}
 }
+
+func TestEventHandler_CreateEvent_QuotaExceeded(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h, mock, cleanup := newEventHandlerForTest(t)
+	defer cleanup()
+	h.eventService.SetUsage(cache.NewMemoryCache(), services.EventUsageConfig{DailyQuota: 1})
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events")).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	r := gin.New()
+	r.POST("/events", h.CreateEvent)
+	r.GET("/users/:id/usage", h.GetUserUsage)
+	userID := uuid.New()
+	body, _ := json.Marshal(models.CreateEventRequest{UserID: userID, Type: "t", Data: "{}"})
+	for _, want := range []int{http.StatusCreated, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/events", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Fatalf("want %d, got %d", want, w.Code)
+		}
+		if want == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Fatal("429 without Retry-After")
+		}
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/users/"+userID.String()+"/usage?days=2", nil)
+	r.ServeHTTP(w, req)
+	var usage services.EventUsage
+	if err := json.Unmarshal(w.Body.Bytes(), &usage); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("usage: %d %s", w.Code, w.Body.String())
+	}
+	if usage.Today != 1 || *usage.Remaining != 0 || len(usage.Days) != 2 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
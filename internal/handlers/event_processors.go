@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"highload-microservice/internal/processor"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// SetProcessor enables the event handler endpoints
+func (h *EventHandler) SetProcessor(registry *processor.Registry) {
+	h.processor = registry
+}
+
+// processorEnabled responds 503 when event handlers are not enabled
+func (h *EventHandler) processorEnabled(c *gin.Context) bool {
+	if h.processor == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Event handlers are not enabled"})
+		return false
+	}
+	return true
+}
+
+// UpdateEventProcessorRequest enables or disables an event handler
+type UpdateEventProcessorRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// ListEventProcessors returns the registered event handlers with their state
+// and the run counts of this instance
+func (h *EventHandler) ListEventProcessors(c *gin.Context) {
+	if !h.processorEnabled(c) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"handlers":  h.processor.List(),
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// UpdateEventProcessor enables or disables an event handler on all replicas
+func (h *EventHandler) UpdateEventProcessor(c *gin.Context) {
+	if !h.processorEnabled(c) {
+		return
+	}
+	var req UpdateEventProcessorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	adminUUID, _ := adminID.(uuid.UUID)
+	var updatedBy *uuid.UUID
+	if adminUUID != uuid.Nil {
+		updatedBy = &adminUUID
+	}
+
+	info, err := h.processor.SetEnabled(c.Request.Context(), c.Param("name"), *req.Enabled, updatedBy)
+	if err != nil {
+		h.logger.Errorf("Failed to update event handler: %v", err)
+		respondError(c, err, "Failed to update event handler")
+		return
+	}
+
+	h.logger.Infof("Event handler %s (enabled %t) updated by %s", info.Name, info.Enabled, adminUUID)
+	c.JSON(http.StatusOK, info)
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+
+	"highload-microservice/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ReplayEvents starts publishing stored events to the broker again and
+// responds with the job to poll for progress
+func (h *EventHandler) ReplayEvents(c *gin.Context) {
+	var req models.EventReplayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	job, err := h.eventService.StartReplay(callerContext(c), req)
+	if err != nil {
+		h.logger.Errorf("Failed to start event replay: %v", err)
+		respondError(c, err, "Failed to start event replay")
+		return
+	}
+
+	c.Header("Location", "/admin/events/replay/"+job.ID.String())
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetReplayJob reports the progress of a replay
+func (h *EventHandler) GetReplayJob(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	job, err := h.eventService.ReplayJob(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err, "Failed to get replay job")
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
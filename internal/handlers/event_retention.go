@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"highload-microservice/internal/retention"
+	"highload-microservice/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// SetRetention enables the /admin/events/retention endpoints
+func (h *EventHandler) SetRetention(service *retention.Service) {
+	h.retention = service
+}
+
+// retentionEnabled responds 503 when retention is not enabled
+func (h *EventHandler) retentionEnabled(c *gin.Context) bool {
+	if h.retention == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Event retention is not enabled"})
+		return false
+	}
+	return true
+}
+
+// StartRetentionRun archives and deletes expired events in the background
+// and responds with the run to poll for progress
+func (h *EventHandler) StartRetentionRun(c *gin.Context) {
+	if !h.retentionEnabled(c) {
+		return
+	}
+	run, err := h.retention.Start(c.Request.Context(), services.CallerID(callerContext(c)))
+	if err != nil {
+		h.logger.Errorf("Failed to start retention run: %v", err)
+		respondError(c, err, "Failed to start retention run")
+		return
+	}
+
+	c.Header("Location", "/admin/events/retention/runs/"+run.ID.String())
+	c.JSON(http.StatusAccepted, run)
+}
+
+// ListRetentionRuns returns the latest retention runs, newest first
+func (h *EventHandler) ListRetentionRuns(c *gin.Context) {
+	if !h.retentionEnabled(c) {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+
+	runs, err := h.retention.ListRuns(c.Request.Context(), limit)
+	if err != nil {
+		h.logger.Errorf("Failed to list retention runs: %v", err)
+		respondError(c, err, "Failed to list retention runs")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"runs": runs})
+}
+
+// GetRetentionRun reports the progress of a retention run
+func (h *EventHandler) GetRetentionRun(c *gin.Context) {
+	if !h.retentionEnabled(c) {
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid run ID"})
+		return
+	}
+
+	run, err := h.retention.GetRun(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err, "Failed to get retention run")
+		return
+	}
+	c.JSON(http.StatusOK, run)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"highload-microservice/internal/schema"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxSchemaSize bounds the body of PutEventSchema
+const maxSchemaSize = 64 << 10
+
+// SetSchemaRegistry enables the event schema management endpoints
+func (h *EventHandler) SetSchemaRegistry(registry *schema.Registry) {
+	h.schemas = registry
+}
+
+// ListEventSchemas returns the payload schemas in effect for every event type
+func (h *EventHandler) ListEventSchemas(c *gin.Context) {
+	if h.schemas == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Event schemas are not enabled"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"schemas":   h.schemas.List(),
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// GetEventSchema returns the payload schema of an event type
+func (h *EventHandler) GetEventSchema(c *gin.Context) {
+	if h.schemas == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Event schemas are not enabled"})
+		return
+	}
+
+	s, ok := h.schemas.Get(c.Param("type"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event schema not found"})
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+// PutEventSchema registers or replaces the payload schema of an event type.
+// The body is the JSON Schema itself.
+func (h *EventHandler) PutEventSchema(c *gin.Context) {
+	if h.schemas == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Event schemas are not enabled"})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxSchemaSize+1))
+	if err != nil || len(body) > maxSchemaSize || !json.Valid(body) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	adminUUID, _ := adminID.(uuid.UUID)
+	var updatedBy *uuid.UUID
+	if adminUUID != uuid.Nil {
+		updatedBy = &adminUUID
+	}
+
+	s, err := h.schemas.Put(c.Request.Context(), c.Param("type"), body, updatedBy)
+	if err != nil {
+		h.logger.Errorf("Failed to save event schema: %v", err)
+		respondError(c, err, "Failed to save event schema")
+		return
+	}
+
+	h.logger.Infof("Event schema for %s updated by %s", s.EventType, adminUUID)
+	c.JSON(http.StatusOK, s)
+}
+
+// DeleteEventSchema removes the schema of an event type registered through
+// the API
+func (h *EventHandler) DeleteEventSchema(c *gin.Context) {
+	if h.schemas == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Event schemas are not enabled"})
+		return
+	}
+
+	if _, err := h.schemas.Delete(c.Request.Context(), c.Param("type")); err != nil {
+		h.logger.Errorf("Failed to delete event schema: %v", err)
+		respondError(c, err, "Failed to delete event schema")
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	h.logger.Infof("Event schema for %s deleted by %v", c.Param("type"), adminID)
+	c.JSON(http.StatusNoContent, nil)
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"highload-microservice/internal/analytics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetAnalytics enables GET /api/v1/events/stats
+func (h *EventHandler) SetAnalytics(service *analytics.Service) {
+	h.analytics = service
+}
+
+// GetEventStats returns event counts per type and time bucket, the most
+// active users and processing latency percentiles, from the hourly rollups
+func (h *EventHandler) GetEventStats(c *gin.Context) {
+	if h.analytics == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Event stats are not enabled"})
+		return
+	}
+
+	q := analytics.Query{Bucket: c.Query("bucket")}
+	for _, param := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &q.From}, {"to", &q.To}} {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param.name + " time, expected RFC 3339"})
+			return
+		}
+		*param.dst = t
+	}
+	if raw := c.Query("top_users"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid top_users"})
+			return
+		}
+		q.TopUsers = n
+	}
+
+	stats, err := h.analytics.Stats(c.Request.Context(), q)
+	if err != nil {
+		h.logger.Errorf("Failed to get event stats: %v", err)
+		respondError(c, err, "Failed to get event stats")
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"highload-microservice/internal/stream"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	streamWriteWait  = 10 * time.Second
+	streamPongWait   = 60 * time.Second
+	streamPingPeriod = streamPongWait * 9 / 10
+)
+
+// The default origin check applies: browsers must connect from the API's own
+// origin, non-browser clients send no Origin header
+var streamUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// StreamEvents upgrades to a WebSocket and pushes consumed events as JSON
+// messages. Query parameters narrow the stream: type (repeatable or
+// comma-separated) and user_id.
+func (h *EventHandler) StreamEvents(c *gin.Context) {
+	filter := stream.Filter{}
+	for _, value := range c.QueryArray("type") {
+		for _, t := range strings.Split(value, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				if filter.Types == nil {
+					filter.Types = make(map[string]bool)
+				}
+				filter.Types[t] = true
+			}
+		}
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		id, err := uuid.Parse(userID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		filter.UserID = id
+	}
+
+	sub, err := h.eventService.SubscribeEvents(filter)
+	if err != nil {
+		h.logger.Errorf("Failed to subscribe to events: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Event streaming unavailable"})
+		return
+	}
+	defer sub.Close()
+
+	// Deadlines are managed per message below, not by the server timeouts
+	ctx := callerContext(c)
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	conn, err := streamUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade has already written the error response
+		h.logger.Warnf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	// Read pump: clients send nothing but control frames; a read error means
+	// the connection is gone
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		conn.SetReadLimit(512)
+		_ = conn.SetReadDeadline(time.Now().Add(streamPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(streamPongWait))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(streamPingPeriod)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case event := <-sub.C:
+			_ = conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			if err := conn.WriteJSON(h.eventService.StreamView(ctx, event)); err != nil {
+				h.logger.Debugf("Event stream write failed: %v", err)
+				return
+			}
+		case <-ping.C:
+			_ = conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/stream"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+func TestEventHandler_StreamEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h, _, cleanup := newEventHandlerForTest(t)
+	defer cleanup()
+
+	hub := stream.NewHub(0)
+	h.eventService.SetStreamHub(hub)
+
+	r := gin.New()
+	r.GET("/events/stream", h.StreamEvents)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/events/stream?type=login"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.Subscribers() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("subscriber not registered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	want := models.KafkaEvent{ID: uuid.New(), UserID: uuid.New(), Type: "login", Data: "{}", Timestamp: time.Now()}
+	hub.Publish(models.KafkaEvent{ID: uuid.New(), Type: "purchase"})
+	hub.Publish(want)
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var got models.Event
+	if err := conn.ReadJSON(&got); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if got.ID != want.ID || got.Type != "login" {
+		t.Fatalf("unexpected event: %+v", got)
+	}
+
+	_ = conn.Close()
+	for hub.Subscribers() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("subscription not released after disconnect")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestEventHandler_StreamEvents_InvalidUserID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h, _, cleanup := newEventHandlerForTest(t)
+	defer cleanup()
+	h.eventService.SetStreamHub(stream.NewHub(0))
+
+	r := gin.New()
+	r.GET("/events/stream", h.StreamEvents)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/events/stream?user_id=nope", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("want 400, got %d", w.Code)
+	}
+}
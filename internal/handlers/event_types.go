@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"highload-microservice/internal/eventtype"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// SetEventTypes enables the event type registry endpoints and ?expand=type
+// on event lists
+func (h *EventHandler) SetEventTypes(registry *eventtype.Registry) {
+	h.types = registry
+}
+
+// eventTypesEnabled responds 503 when the registry is not enabled
+func (h *EventHandler) eventTypesEnabled(c *gin.Context) bool {
+	if h.types == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Event types are not enabled"})
+		return false
+	}
+	return true
+}
+
+// ListEventTypes returns the registered event types
+func (h *EventHandler) ListEventTypes(c *gin.Context) {
+	if !h.eventTypesEnabled(c) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"types":     h.types.List(),
+		"strict":    h.types.Strict(),
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// GetEventType returns a registered event type with its payload schema
+func (h *EventHandler) GetEventType(c *gin.Context) {
+	if !h.eventTypesEnabled(c) {
+		return
+	}
+	t, ok := h.types.Get(c.Param("type"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event type not found"})
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+// PutEventType registers an event type or updates its description, enabled
+// flag and, if given, payload schema
+func (h *EventHandler) PutEventType(c *gin.Context) {
+	if !h.eventTypesEnabled(c) {
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSchemaSize)
+	var update eventtype.Update
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	adminUUID, _ := adminID.(uuid.UUID)
+	var updatedBy *uuid.UUID
+	if adminUUID != uuid.Nil {
+		updatedBy = &adminUUID
+	}
+
+	t, err := h.types.Put(c.Request.Context(), c.Param("type"), update, updatedBy)
+	if err != nil {
+		h.logger.Errorf("Failed to save event type: %v", err)
+		respondError(c, err, "Failed to save event type")
+		return
+	}
+
+	h.logger.Infof("Event type %s (enabled %t) updated by %s", t.Name, t.Enabled, adminUUID)
+	c.JSON(http.StatusOK, t)
+}
+
+// DeleteEventType unregisters an event type
+func (h *EventHandler) DeleteEventType(c *gin.Context) {
+	if !h.eventTypesEnabled(c) {
+		return
+	}
+	if err := h.types.Delete(c.Request.Context(), c.Param("type")); err != nil {
+		h.logger.Errorf("Failed to delete event type: %v", err)
+		respondError(c, err, "Failed to delete event type")
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	h.logger.Infof("Event type %s deleted by %v", c.Param("type"), adminID)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"highload-microservice/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GetUserUsage returns the events a user created per day and what is left of
+// the daily quota
+func (h *EventHandler) GetUserUsage(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	days := 0
+	if value := c.Query("days"); value != "" {
+		if days, err = strconv.Atoi(value); err != nil || days < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid days, expected a positive number"})
+			return
+		}
+	}
+
+	usage, err := h.eventService.GetUsage(c.Request.Context(), userID, days)
+	if err != nil {
+		h.logger.Errorf("Failed to get event usage: %v", err)
+		respondError(c, err, "Failed to get event usage")
+		return
+	}
+	c.JSON(http.StatusOK, usage)
+}
+
+// respondQuotaExceeded answers a request refused by the daily event quota
+func respondQuotaExceeded(c *gin.Context, exceeded *services.EventQuotaExceededError) {
+	seconds := int(math.Ceil(exceeded.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Daily event quota exceeded",
+		"daily_quota": exceeded.Limit,
+		"retry_after": seconds,
+	})
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"time"
+
+	"highload-microservice/internal/export"
+	"highload-microservice/internal/middleware"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/repository"
+	"highload-microservice/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// exportWriteWait bounds the write of one batch; the export as a whole has
+// no deadline
+const exportWriteWait = time.Minute
+
+// exportStatusTrailer reports whether the whole dataset was sent: the status
+// code is sent with the first rows, before a later failure is known
+const exportStatusTrailer = "X-Export-Status"
+
+// ExportHandler streams datasets for offline analysis
+type ExportHandler struct {
+	userService  *services.UserService
+	eventService *services.EventService
+	batchSize    int
+	logger       *logrus.Logger
+}
+
+func NewExportHandler(userService *services.UserService, eventService *services.EventService, batchSize int, logger *logrus.Logger) *ExportHandler {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	return &ExportHandler{
+		userService:  userService,
+		eventService: eventService,
+		batchSize:    batchSize,
+		logger:       logger,
+	}
+}
+
+// Export streams the users or events dataset, named by the dataset path
+// parameter, as CSV or NDJSON (format, default ndjson). from and to
+// (RFC 3339) bound created_at. The body is gzip-compressed when the client
+// accepts it.
+func (h *ExportHandler) Export(c *gin.Context) {
+	dataset := c.Param("dataset")
+	if dataset != "users" && dataset != "events" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown dataset"})
+		return
+	}
+	format := c.DefaultQuery("format", export.FormatNDJSON)
+	if !export.ValidFormat(format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format: use csv or ndjson"})
+		return
+	}
+	from, to, ok := exportRange(c)
+	if !ok {
+		return
+	}
+
+	stream := &exportStream{c: c, format: format, dataset: dataset}
+	ctx := callerContext(c)
+	var err error
+	if dataset == "users" {
+		stream.columns = export.UserColumns
+		err = h.userService.ExportUsers(ctx, repository.UserRangeQuery{From: from, To: to}, h.batchSize, func(users []models.User) error {
+			return stream.batch(func(w *export.Writer) error {
+				for _, user := range users {
+					if err := w.WriteUser(user); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		})
+	} else {
+		stream.columns = export.EventColumns
+		err = h.eventService.ExportEvents(ctx, repository.EventRangeQuery{From: from, To: to}, h.batchSize, func(events []models.Event) error {
+			return stream.batch(func(w *export.Writer) error {
+				for _, event := range events {
+					if err := w.WriteEvent(event); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		})
+	}
+
+	if err != nil && !stream.started {
+		h.logger.Errorf("Failed to export %s: %v", dataset, err)
+		respondError(c, err, "Failed to export "+dataset)
+		return
+	}
+	if err == nil {
+		err = stream.start()
+	}
+	if err != nil {
+		// The client sees the failure in the trailer, and a gzip body
+		// without its end
+		if ctx.Err() == nil {
+			h.logger.Errorf("Export of %s failed mid-stream: %v", dataset, err)
+		}
+		c.Writer.Header().Set(exportStatusTrailer, "failed")
+		return
+	}
+	if err := stream.close(); err != nil {
+		h.logger.Warnf("Failed to finish export of %s: %v", dataset, err)
+		c.Writer.Header().Set(exportStatusTrailer, "failed")
+		return
+	}
+	c.Writer.Header().Set(exportStatusTrailer, "complete")
+}
+
+// exportRange parses the from and to query parameters, responding with 400
+// when they are invalid
+func exportRange(c *gin.Context) (from, to *time.Time, ok bool) {
+	for _, bound := range []struct {
+		name string
+		dst  **time.Time
+	}{{"from", &from}, {"to", &to}} {
+		value := c.Query(bound.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + bound.name + ": expected an RFC 3339 timestamp"})
+			return nil, nil, false
+		}
+		*bound.dst = &t
+	}
+	if from != nil && to != nil && !from.Before(*to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid range: from must be before to"})
+		return nil, nil, false
+	}
+	return from, to, true
+}
+
+// exportStream writes an export response batch by batch, sending the
+// headers with the first batch so that errors before it still get a JSON
+// error response
+type exportStream struct {
+	c       *gin.Context
+	format  string
+	dataset string
+	columns []string
+
+	started bool
+	gz      *gzip.Writer
+	writer  *export.Writer
+	control *http.ResponseController
+}
+
+func (s *exportStream) start() error {
+	if s.started {
+		return nil
+	}
+	s.started = true
+
+	header := s.c.Writer.Header()
+	header.Set("Content-Type", export.ContentType(s.format))
+	header.Set("Content-Disposition", `attachment; filename="`+s.dataset+"."+s.format+`"`)
+	header.Set("Cache-Control", "no-store")
+	header.Set("Trailer", exportStatusTrailer)
+	s.control = http.NewResponseController(s.c.Writer)
+
+	var body io.Writer = s.c.Writer
+	if middleware.NegotiateEncoding(s.c.GetHeader("Accept-Encoding")) == middleware.EncodingGzip {
+		header.Set("Content-Encoding", middleware.EncodingGzip)
+		header.Add("Vary", "Accept-Encoding")
+		s.gz = gzip.NewWriter(s.c.Writer)
+		body = s.gz
+	}
+	s.c.Status(http.StatusOK)
+
+	var err error
+	s.writer, err = export.NewWriter(body, s.format, s.columns)
+	return err
+}
+
+// batch writes rows with write and sends them to the client
+func (s *exportStream) batch(write func(w *export.Writer) error) error {
+	if err := s.start(); err != nil {
+		return err
+	}
+	_ = s.control.SetWriteDeadline(time.Now().Add(exportWriteWait))
+	if err := write(s.writer); err != nil {
+		return err
+	}
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+	if s.gz != nil {
+		if err := s.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	s.c.Writer.Flush()
+	return s.c.Request.Context().Err()
+}
+
+// close completes the body
+func (s *exportStream) close() error {
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+	if s.gz != nil {
+		return s.gz.Close()
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/cache"
+	"highload-microservice/internal/repository"
+	"highload-microservice/internal/services"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+func newExportHandlerForTest(t *testing.T, batchSize int) (*gin.Engine, sqlmock.Sqlmock) {
+	gin.SetMode(gin.TestMode)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	users := services.NewUserService(repository.NewPostgresUserRepository(db), cache.NewMemoryCache(), &stubKafkaEH{}, logrus.New())
+	events := services.NewEventService(repository.NewPostgresEventRepository(db), cache.NewMemoryCache(), &stubKafkaEH{}, logrus.New())
+	r := gin.New()
+	r.GET("/admin/export/:dataset", NewExportHandler(users, events, batchSize, logrus.New()).Export)
+	return r, mock
+}
+
+func TestExportHandler_StreamsEventsInBatches(t *testing.T) {
+	r, mock := newExportHandlerForTest(t, 2)
+	cols := []string{"id", "user_id", "type", "data", "created_at"}
+	base := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM events WHERE created_at >= $1")).
+		WithArgs(from, 2).
+		WillReturnRows(sqlmock.NewRows(cols).
+			AddRow(ids[0], uuid.New(), "created", `{"a":1}`, base).
+			AddRow(ids[1], uuid.New(), "created", "{}", base.Add(time.Minute)))
+	// The second batch continues after the last event of the first
+	mock.ExpectQuery(regexp.QuoteMeta("AND (created_at > $2 OR (created_at = $3 AND id > $4))")).
+		WithArgs(from, base.Add(time.Minute), base.Add(time.Minute), ids[1], 2).
+		WillReturnRows(sqlmock.NewRows(cols).AddRow(ids[2], uuid.New(), "created", "{}", base.Add(2*time.Minute)))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/admin/export/events?format=csv&from=2024-03-01T00:00:00Z", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	r.ServeHTTP(w, req)
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("want a gzip 200, got %d %v", resp.StatusCode, resp.Header)
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	records, err := csv.NewReader(zr).ReadAll()
+	if err != nil {
+		t.Fatalf("csv: %v", err)
+	}
+	if len(records) != 4 || records[0][0] != "id" || records[1][0] != ids[0].String() || records[1][3] != `{"a":1}` || records[3][0] != ids[2].String() {
+		t.Fatalf("unexpected rows %v", records)
+	}
+	if status := resp.Trailer.Get(exportStatusTrailer); status != "complete" {
+		t.Fatalf("want a complete export, got %q", status)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestExportHandler_Errors(t *testing.T) {
+	r, mock := newExportHandlerForTest(t, 10)
+
+	for url, want := range map[string]int{
+		"/admin/export/sessions":                                                http.StatusNotFound,
+		"/admin/export/users?format=xml":                                        http.StatusBadRequest,
+		"/admin/export/users?from=yesterday":                                    http.StatusBadRequest,
+		"/admin/export/users?from=2024-03-02T00:00:00Z&to=2024-03-01T00:00:00Z": http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Fatalf("%s: want %d, got %d", url, want, w.Code)
+		}
+	}
+
+	// A failure before the first batch is still a JSON error
+	mock.ExpectQuery(regexp.QuoteMeta("FROM users WHERE 1 = 1")).WillReturnError(errors.New("connection reset"))
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/admin/export/users", nil)
+	r.ServeHTTP(w, req)
+	body, _ := io.ReadAll(w.Body)
+	if w.Code != http.StatusInternalServerError || !regexp.MustCompile(`"error"`).Match(body) {
+		t.Fatalf("want a 500 JSON error, got %d %s", w.Code, body)
+	}
+}
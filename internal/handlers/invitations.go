@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// InviteUser emails a one-time link to create an account. Callers can only
+// invite roles whose permissions their own role has.
+func (h *AuthHandler) InviteUser(c *gin.Context) {
+	val, exists := c.Get("validated_data")
+	req, ok := val.(*models.InviteUserRequest)
+	if !exists || !ok || req == nil {
+		h.logger.Errorf("Validated invitation data not found in context")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": "missing validated data"})
+		return
+	}
+
+	role := req.Role
+	if role == "" {
+		role = models.RoleUser
+	}
+	callerRole, _ := c.Get("user_role")
+	if inviter, _ := callerRole.(models.UserRole); !h.authService.Permissions().Covers(inviter, role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot invite a role with permissions you don't have"})
+		return
+	}
+
+	invitation, err := h.authService.InviteUser(callerContext(c), *req)
+	if err != nil {
+		if apperrors.HTTPStatus(err) >= http.StatusInternalServerError {
+			h.logger.Errorf("Failed to invite user: %v", err)
+		}
+		respondError(c, err, "Failed to invite user")
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	adminUUID, _ := adminID.(uuid.UUID)
+	h.securityAuditor.LogInvitationCreated(invitation.ID, adminUUID, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"),
+		invitation.Email, string(invitation.Role))
+	c.JSON(http.StatusCreated, invitation)
+}
+
+// ListInvitations lists invitations, the pending ones unless ?status= names
+// another status or is empty
+func (h *AuthHandler) ListInvitations(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	status := models.InvitationStatus(c.DefaultQuery("status", string(models.InvitationPending)))
+
+	invitations, err := h.authService.ListInvitations(c.Request.Context(), status, limit)
+	if err != nil {
+		h.logger.Errorf("Failed to list invitations: %v", err)
+		respondError(c, err, "Failed to list invitations")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"invitations": invitations, "count": len(invitations)})
+}
+
+// AcceptInvitation creates the invited account with the invitee's password
+func (h *AuthHandler) AcceptInvitation(c *gin.Context) {
+	val, exists := c.Get("validated_data")
+	req, ok := val.(*models.AcceptInviteRequest)
+	if !exists || !ok || req == nil {
+		h.logger.Errorf("Validated invitation data not found in context")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": "missing validated data"})
+		return
+	}
+
+	user, err := h.authService.AcceptInvitation(c.Request.Context(), *req)
+	if err != nil {
+		// Refused invitations are audited, outages are not
+		if apperrors.HTTPStatus(err) < http.StatusInternalServerError {
+			h.securityAuditor.LogInvitationAccepted(nil, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"), apperrors.Message(err))
+		} else {
+			h.logger.Errorf("Failed to accept invitation: %v", err)
+		}
+		respondError(c, err, "Failed to accept invitation")
+		return
+	}
+
+	h.securityAuditor.LogInvitationAccepted(&user.ID, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"), "")
+	c.JSON(http.StatusCreated, user)
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"highload-microservice/internal/security"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// CreateIPRuleRequest blocks or allowlists an IP or CIDR range
+type CreateIPRuleRequest struct {
+	CIDR       string            `json:"cidr" binding:"required"`
+	Action     security.IPAction `json:"action"` // block (default) or allow
+	Reason     string            `json:"reason"`
+	TTLSeconds int               `json:"ttl_seconds"` // 0 keeps the rule until deleted
+}
+
+// ListIPRules returns the active IP blocklist and allowlist rules
+func (sh *SecurityHandler) ListIPRules(c *gin.Context) {
+	if sh.ipList == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "IP rules are not enabled"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rules":     sh.ipList.Rules(),
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// CreateIPRule adds an IP blocklist or allowlist rule
+func (sh *SecurityHandler) CreateIPRule(c *gin.Context) {
+	if sh.ipList == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "IP rules are not enabled"})
+		return
+	}
+
+	var req CreateIPRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if req.Action == security.IPActionNone {
+		req.Action = security.IPActionBlock
+	}
+	if req.TTLSeconds < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ttl_seconds must not be negative"})
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	adminUUID, _ := adminID.(uuid.UUID)
+	var createdBy *uuid.UUID
+	if adminUUID != uuid.Nil {
+		createdBy = &adminUUID
+	}
+
+	rule, err := sh.ipList.Add(c.Request.Context(), req.CIDR, req.Action, req.Reason, time.Duration(req.TTLSeconds)*time.Second, createdBy)
+	if err != nil {
+		sh.logger.Errorf("Failed to create IP rule: %v", err)
+		respondError(c, err, "Failed to create IP rule")
+		return
+	}
+
+	sh.auditor.LogIPRuleChanged(adminUUID, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"), "created", rule)
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+// DeleteIPRule removes an IP blocklist or allowlist rule
+func (sh *SecurityHandler) DeleteIPRule(c *gin.Context) {
+	if sh.ipList == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "IP rules are not enabled"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule ID"})
+		return
+	}
+
+	rule, err := sh.ipList.Remove(c.Request.Context(), id)
+	if err != nil {
+		sh.logger.Errorf("Failed to delete IP rule: %v", err)
+		respondError(c, err, "Failed to delete IP rule")
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	adminUUID, _ := adminID.(uuid.UUID)
+	sh.auditor.LogIPRuleChanged(adminUUID, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"), "deleted", rule)
+
+	c.JSON(http.StatusNoContent, nil)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+
+	"highload-microservice/internal/oidc"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetIdentityProvider enables login through an OIDC identity provider
+func (h *AuthHandler) SetIdentityProvider(provider *oidc.Provider) {
+	h.identityProvider = provider
+}
+
+// OIDCLogin redirects the user to the identity provider
+func (h *AuthHandler) OIDCLogin(c *gin.Context) {
+	if h.identityProvider == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "OIDC login is not enabled"})
+		return
+	}
+
+	redirect, err := h.identityProvider.Begin(c.Request.Context())
+	if err != nil {
+		h.logger.Errorf("Failed to start OIDC login: %v", err)
+		respondError(c, err, "Failed to start OIDC login")
+		return
+	}
+	c.Redirect(http.StatusFound, redirect)
+}
+
+// OIDCCallback completes a login at the identity provider and returns the
+// same tokens as a password login
+func (h *AuthHandler) OIDCCallback(c *gin.Context) {
+	if h.identityProvider == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "OIDC login is not enabled"})
+		return
+	}
+
+	// The user declined or the provider failed
+	if reason := c.Query("error"); reason != "" {
+		h.securityAuditor.LogLoginFailure("", c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"), "oidc: "+reason)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "OIDC login failed", "details": reason})
+		return
+	}
+
+	identity, err := h.identityProvider.Complete(c.Request.Context(), c.Query("state"), c.Query("code"))
+	if err != nil {
+		h.logger.Warnf("OIDC login failed: %v", err)
+		h.securityAuditor.LogLoginFailure("", c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"), err.Error())
+		respondError(c, err, "OIDC login failed")
+		return
+	}
+
+	response, err := h.authService.LoginWithIdentity(clientContext(c), *identity)
+	if err != nil {
+		h.logger.Warnf("OIDC login failed for %s: %v", identity.Email, err)
+		h.securityAuditor.LogLoginFailure(identity.Email, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"), err.Error())
+		respondError(c, err, "OIDC login failed")
+		return
+	}
+
+	h.securityAuditor.LogLoginSuccess(response.User.ID, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"))
+	h.respondTokens(c, response)
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"net/http"
+
+	"highload-microservice/internal/pagination"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseCursor reads the optional cursor query parameter. It writes a 400
+// response and returns false if the cursor is malformed.
+func parseCursor(c *gin.Context) (*pagination.Cursor, bool) {
+	raw := c.Query("cursor")
+	if raw == "" {
+		return nil, true
+	}
+	cursor, err := pagination.Decode(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return nil, false
+	}
+	return &cursor, true
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+
+	"highload-microservice/internal/password"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// SetPasswordPolicy enables the password policy endpoints
+func (sh *SecurityHandler) SetPasswordPolicy(checker *password.Checker) {
+	sh.passwords = checker
+}
+
+// GetPasswordPolicy returns the password policy and the size of the banned list
+func (sh *SecurityHandler) GetPasswordPolicy(c *gin.Context) {
+	if sh.passwords == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Password policy is not enabled"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"policy": sh.passwords.Policy(), "banned_passwords": sh.passwords.BannedCount()})
+}
+
+// UpdatePasswordPolicy changes the password policy of this instance. Fields
+// missing from the body keep their current value; passwords already set are
+// not rechecked.
+func (sh *SecurityHandler) UpdatePasswordPolicy(c *gin.Context) {
+	if sh.passwords == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Password policy is not enabled"})
+		return
+	}
+	previous := sh.passwords.Policy()
+	policy := previous
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if err := sh.passwords.SetPolicy(policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	adminUUID, _ := adminID.(uuid.UUID)
+	sh.auditor.LogPasswordPolicyChanged(adminUUID, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"), previous, policy)
+
+	c.JSON(http.StatusOK, gin.H{"policy": policy, "banned_passwords": sh.passwords.BannedCount()})
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// UpdateProfile lets users change their own names and email without the
+// permissions of PUT /users/:id. A new email only takes effect once the link
+// sent to it is followed.
+func (h *AuthHandler) UpdateProfile(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	uid, ok := userID.(uuid.UUID)
+	if !exists || !ok {
+		h.logger.Error("User ID not found in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	val, exists := c.Get("validated_data")
+	req, ok := val.(*models.UpdateUserRequest)
+	if !exists || !ok || req == nil {
+		h.logger.Errorf("Validated profile data not found in context")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": "missing validated data"})
+		return
+	}
+
+	profile, err := h.authService.UpdateProfile(callerContext(c), uid, *req)
+	if err != nil {
+		if apperrors.HTTPStatus(err) >= http.StatusInternalServerError {
+			h.logger.Errorf("Failed to update profile: %v", err)
+		}
+		respondError(c, err, "Failed to update profile")
+		return
+	}
+
+	var fields []string
+	requestedEmail := ""
+	if req.FirstName != nil {
+		fields = append(fields, "first_name")
+	}
+	if req.LastName != nil {
+		fields = append(fields, "last_name")
+	}
+	if req.Email != nil {
+		fields = append(fields, "email")
+		requestedEmail = profile.PendingEmail
+	}
+	h.securityAuditor.LogProfileUpdated(uid, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"), fields, requestedEmail)
+	c.JSON(http.StatusOK, profile)
+}
+
+// ConfirmEmailChange applies a pending email by the token of the link sent
+// to it
+func (h *AuthHandler) ConfirmEmailChange(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token is required"})
+		return
+	}
+
+	profile, err := h.authService.ConfirmEmailChange(c.Request.Context(), token)
+	if err != nil {
+		// Refused tokens are audited, outages are not
+		if apperrors.HTTPStatus(err) < http.StatusInternalServerError {
+			h.securityAuditor.LogEmailChangeConfirmed(nil, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"), apperrors.Message(err))
+		} else {
+			h.logger.Errorf("Failed to confirm email change: %v", err)
+		}
+		respondError(c, err, "Email change failed")
+		return
+	}
+
+	h.securityAuditor.LogEmailChangeConfirmed(&profile.ID, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"), "")
+	c.JSON(http.StatusOK, profile)
+}
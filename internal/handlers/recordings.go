@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"highload-microservice/internal/recording"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// SetRecordings enables the HTTP recording endpoints
+func (sh *SecurityHandler) SetRecordings(store recording.Store) {
+	sh.recordings = store
+}
+
+// recordingsEnabled responds 503 when HTTP recording is off
+func (sh *SecurityHandler) recordingsEnabled(c *gin.Context) bool {
+	if sh.recordings == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "HTTP recording is not enabled"})
+		return false
+	}
+	return true
+}
+
+// ListRecordings returns recorded requests without their bodies, newest
+// first, filtered by request_id, method, path, status, user_id and from/to
+func (sh *SecurityHandler) ListRecordings(c *gin.Context) {
+	if !sh.recordingsEnabled(c) {
+		return
+	}
+	q, ok := parseSecurityQuery(c)
+	if !ok {
+		return
+	}
+	filter := recording.Filter{
+		RequestID: c.Query("request_id"),
+		Method:    strings.ToUpper(c.Query("method")),
+		Path:      c.Query("path"),
+		From:      q.from,
+		To:        q.to,
+		Page:      q.page,
+		Limit:     q.limit,
+	}
+	if status := c.Query("status"); status != "" {
+		code, err := strconv.Atoi(status)
+		if err != nil || code < 100 || code > 599 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+			return
+		}
+		filter.Status = code
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		id, err := uuid.Parse(userID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		filter.UserID = &id
+	}
+
+	recordings, total, err := sh.recordings.List(c.Request.Context(), filter)
+	if err != nil {
+		sh.logger.Errorf("Failed to list HTTP recordings: %v", err)
+		respondError(c, err, "Failed to list HTTP recordings")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"recordings": recordings,
+		"total":      total,
+		"page":       q.page,
+		"limit":      q.limit,
+		"timestamp":  time.Now().Unix(),
+	})
+}
+
+// GetRecording returns a recorded request with its headers and bodies
+func (sh *SecurityHandler) GetRecording(c *gin.Context) {
+	if !sh.recordingsEnabled(c) {
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recording ID"})
+		return
+	}
+
+	rec, err := sh.recordings.Get(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err, "Failed to get HTTP recording")
+		return
+	}
+	c.JSON(http.StatusOK, rec)
+}
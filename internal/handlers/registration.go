@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// registrationAccepted is the response to every registration that passed
+// validation, so that it doesn't tell whether the email was already taken
+const registrationAccepted = "If the email can be registered, a verification link has been sent to it"
+
+// Register signs up an inactive account and emails it a verification link
+func (h *AuthHandler) Register(c *gin.Context) {
+	val, exists := c.Get("validated_data")
+	req, ok := val.(*models.RegisterRequest)
+	if !exists || !ok || req == nil {
+		h.logger.Errorf("Validated registration data not found in context")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": "missing validated data"})
+		return
+	}
+
+	user, err := h.authService.Register(clientContext(c), *req)
+	audit := func(userID *uuid.UUID, outcome string) {
+		h.securityAuditor.LogRegistration(userID, req.Email, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"), outcome)
+	}
+	if err != nil {
+		if retryAfter, throttled := services.IsRegistrationThrottled(err); throttled {
+			audit(nil, "throttled")
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many registration attempts", "retry_after": seconds})
+			return
+		}
+		switch {
+		case errors.Is(err, apperrors.ErrConflict):
+			audit(nil, "email_taken")
+			c.JSON(http.StatusAccepted, gin.H{"message": registrationAccepted})
+			return
+		case errors.Is(err, apperrors.ErrValidation):
+			audit(nil, "invalid")
+		case !errors.Is(err, apperrors.ErrUnavailable):
+			h.logger.Errorf("Registration failed: %v", err)
+		}
+		respondError(c, err, "Registration failed")
+		return
+	}
+
+	audit(&user.ID, "created")
+	c.JSON(http.StatusAccepted, gin.H{"message": registrationAccepted})
+}
+
+// VerifyEmail activates the account of the verification link's token
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token is required"})
+		return
+	}
+
+	userID, err := h.authService.VerifyEmail(c.Request.Context(), token)
+	if err != nil {
+		// Refused tokens are audited, outages are not
+		if apperrors.HTTPStatus(err) < http.StatusInternalServerError {
+			h.securityAuditor.LogEmailVerification(nil, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"), apperrors.Message(err))
+		}
+		respondError(c, err, "Email verification failed")
+		return
+	}
+
+	h.securityAuditor.LogEmailVerification(&userID, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"), "")
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified, the account is active", "user_id": userID})
+}
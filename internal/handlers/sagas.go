@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"highload-microservice/internal/saga"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const maxSagaLimit = 500
+
+// SetSagas enables the saga endpoints
+func (h *EventHandler) SetSagas(engine *saga.Engine) {
+	h.sagas = engine
+}
+
+// sagasEnabled responds 503 when sagas are not enabled
+func (h *EventHandler) sagasEnabled(c *gin.Context) bool {
+	if h.sagas == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Sagas are not enabled"})
+		return false
+	}
+	return true
+}
+
+func sagaID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid saga ID"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// ListSagas returns saga instances, newest first. stuck=true narrows the
+// list to failed instances and those without recent progress.
+func (h *EventHandler) ListSagas(c *gin.Context) {
+	if !h.sagasEnabled(c) {
+		return
+	}
+
+	status := c.Query("status")
+	switch status {
+	case "", saga.StatusRunning, saga.StatusCompensating, saga.StatusCompleted, saga.StatusCompensated, saga.StatusFailed:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+	stuck, err := strconv.ParseBool(c.DefaultQuery("stuck", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "stuck must be true or false"})
+		return
+	}
+	limit := 100
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxSagaLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxSagaLimit)})
+			return
+		}
+		limit = n
+	}
+
+	instances, err := h.sagas.List(c.Request.Context(), status, stuck, limit)
+	if err != nil {
+		h.logger.Errorf("Failed to list sagas: %v", err)
+		respondError(c, err, "Failed to list sagas")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"sagas":     instances,
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// GetSaga returns a saga instance with its current step
+func (h *EventHandler) GetSaga(c *gin.Context) {
+	if !h.sagasEnabled(c) {
+		return
+	}
+	id, ok := sagaID(c)
+	if !ok {
+		return
+	}
+
+	instance, err := h.sagas.Get(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err, "Failed to get saga")
+		return
+	}
+	c.JSON(http.StatusOK, instance)
+}
+
+// RetrySaga compensates a failed saga again, once the operator fixed what
+// made its compensation fail
+func (h *EventHandler) RetrySaga(c *gin.Context) {
+	if !h.sagasEnabled(c) {
+		return
+	}
+	id, ok := sagaID(c)
+	if !ok {
+		return
+	}
+
+	instance, err := h.sagas.Retry(c.Request.Context(), id)
+	if err != nil {
+		h.logger.Errorf("Failed to retry saga %s: %v", id, err)
+		respondError(c, err, "Failed to retry saga")
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	h.logger.Infof("Saga %s (%s) retried by %v", instance.ID, instance.Saga, adminID)
+	c.JSON(http.StatusAccepted, instance)
+}
@@ -1,10 +1,17 @@
 package handlers
 
 import (
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 
+	"highload-microservice/internal/alerting"
+	"highload-microservice/internal/auditarchive"
+	"highload-microservice/internal/password"
+	"highload-microservice/internal/recording"
 	"highload-microservice/internal/security"
+	"highload-microservice/internal/siem"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -12,8 +19,15 @@ import (
 
 // SecurityHandler handles security-related endpoints
 type SecurityHandler struct {
-	auditor *security.SecurityAuditor
-	logger  *logrus.Logger
+	auditor    *security.SecurityAuditor
+	ipList     *security.IPListManager
+	alerts     *alerting.Dispatcher
+	ddos       DDoSBlocklist
+	archive    *auditarchive.Exporter
+	siem       *siem.Forwarder
+	recordings recording.Store
+	passwords  *password.Checker
+	logger     *logrus.Logger
 }
 
 // NewSecurityHandler creates a new security handler
@@ -24,6 +38,16 @@ func NewSecurityHandler(auditor *security.SecurityAuditor, logger *logrus.Logger
 	}
 }
 
+// SetIPList enables the IP blocklist/allowlist management endpoints
+func (sh *SecurityHandler) SetIPList(ipList *security.IPListManager) {
+	sh.ipList = ipList
+}
+
+// SetSIEM reports the SIEM forwarder in the security health
+func (sh *SecurityHandler) SetSIEM(forwarder *siem.Forwarder) {
+	sh.siem = forwarder
+}
+
 // GetSecurityStats returns security statistics
 func (sh *SecurityHandler) GetSecurityStats(c *gin.Context) {
 	stats := sh.auditor.GetSecurityStats()
@@ -34,30 +58,168 @@ func (sh *SecurityHandler) GetSecurityStats(c *gin.Context) {
 	})
 }
 
-// GetSecurityAlerts returns recent security alerts
+// GetSecurityAlerts returns security alerts. With a store configured it
+// supports filtering by severity and time range and pagination; otherwise the
+// in-memory recent alerts are returned.
 func (sh *SecurityHandler) GetSecurityAlerts(c *gin.Context) {
-	// This would typically query a database for recent alerts
-	// For now, return empty list
-	alerts := []security.SecurityAlert{}
+	store := sh.auditor.Store()
+	if store == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"alerts":    sh.auditor.GetRecentAlerts(),
+			"timestamp": time.Now().Unix(),
+		})
+		return
+	}
+
+	q, ok := parseSecurityQuery(c)
+	if !ok {
+		return
+	}
+	alerts, total, err := store.ListAlerts(c.Request.Context(), security.AlertFilter{
+		Severity: q.severity,
+		From:     q.from,
+		To:       q.to,
+		Page:     q.page,
+		Limit:    q.limit,
+	})
+	if err != nil {
+		sh.logger.Errorf("Failed to list security alerts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list security alerts"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"alerts":    alerts,
+		"total":     total,
+		"page":      q.page,
+		"limit":     q.limit,
 		"timestamp": time.Now().Unix(),
 	})
 }
 
-// GetSecurityEvents returns recent security events
+// StreamSecurityAlerts streams new security alerts as server-sent events
+func (sh *SecurityHandler) StreamSecurityAlerts(c *gin.Context) {
+	alerts, unsubscribe := sh.auditor.SubscribeAlerts()
+	defer unsubscribe()
+
+	// The stream outlives the server write timeout; clients reconnect if this fails
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case alert := <-alerts:
+			c.SSEvent("alert", alert)
+			return true
+		case <-keepAlive.C:
+			_, _ = io.WriteString(w, ": keep-alive\n\n")
+			return true
+		}
+	})
+}
+
+// GetSecurityEvents returns stored security events filtered by type,
+// severity, IP and time range, newest first
 func (sh *SecurityHandler) GetSecurityEvents(c *gin.Context) {
-	// This would typically query a database for recent events
-	// For now, return empty list
-	events := []security.SecurityEvent{}
+	q, ok := parseSecurityQuery(c)
+	if !ok {
+		return
+	}
+
+	store := sh.auditor.Store()
+	if store == nil {
+		// Persistence disabled
+		c.JSON(http.StatusOK, gin.H{
+			"events":    []security.SecurityEvent{},
+			"total":     0,
+			"page":      q.page,
+			"limit":     q.limit,
+			"timestamp": time.Now().Unix(),
+		})
+		return
+	}
+
+	events, total, err := store.ListEvents(c.Request.Context(), security.EventFilter{
+		EventType: security.SecurityEventType(c.Query("type")),
+		Severity:  q.severity,
+		IPAddress: c.Query("ip"),
+		From:      q.from,
+		To:        q.to,
+		Page:      q.page,
+		Limit:     q.limit,
+	})
+	if err != nil {
+		sh.logger.Errorf("Failed to list security events: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list security events"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"events":    events,
+		"total":     total,
+		"page":      q.page,
+		"limit":     q.limit,
 		"timestamp": time.Now().Unix(),
 	})
 }
 
+// securityQuery holds the filters shared by the event and alert listings
+type securityQuery struct {
+	severity security.SecuritySeverity
+	from, to time.Time
+	page     int
+	limit    int
+}
+
+// parseSecurityQuery reads severity, from/to (RFC 3339), page and limit.
+// It writes a 400 response and returns false on invalid input.
+func parseSecurityQuery(c *gin.Context) (securityQuery, bool) {
+	q := securityQuery{page: 1, limit: 50}
+
+	if page, err := strconv.Atoi(c.DefaultQuery("page", "1")); err == nil && page > 0 {
+		q.page = page
+	}
+	if limit, err := strconv.Atoi(c.DefaultQuery("limit", "50")); err == nil && limit > 0 && limit <= 500 {
+		q.limit = limit
+	}
+
+	switch severity := security.SecuritySeverity(c.Query("severity")); severity {
+	case "", security.SeverityLow, security.SeverityMedium, security.SeverityHigh, security.SeverityCritical:
+		q.severity = severity
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid severity"})
+		return q, false
+	}
+
+	for _, param := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &q.from}, {"to", &q.to}} {
+		name, dst := param.name, param.dst
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name + " time, expected RFC 3339"})
+			return q, false
+		}
+		*dst = t
+	}
+
+	return q, true
+}
+
 // GetThreatIntelligence returns threat intelligence data
 func (sh *SecurityHandler) GetThreatIntelligence(c *gin.Context) {
 	// This would typically query threat intelligence feeds
@@ -86,6 +248,9 @@ func (sh *SecurityHandler) GetSecurityHealth(c *gin.Context) {
 		"threats_detected": 0,
 		"alerts_generated": 0,
 	}
+	if sh.siem != nil {
+		health["siem"] = sh.siem.Stats()
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"security_health": health,
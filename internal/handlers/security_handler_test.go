@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"highload-microservice/internal/middleware"
+	"highload-microservice/internal/password"
 	"highload-microservice/internal/security"
 
 	"github.com/gin-gonic/gin"
@@ -36,3 +41,147 @@ func TestSecurityHandler_All_OK(t *testing.T) {
 		}
 	}
 }
+
+func TestSecurityHandler_Events_InvalidFilters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := newSecurityHandler()
+	r := gin.New()
+	r.GET("/security/events", h.GetSecurityEvents)
+
+	for _, q := range []string{"?severity=urgent", "?from=yesterday"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/security/events"+q, nil)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("query %s expected 400, got %d", q, w.Code)
+		}
+	}
+}
+
+func TestSecurityHandler_UpdateAnomalyThresholds(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := newSecurityHandler()
+	r := gin.New()
+	r.GET("/security/anomaly-thresholds", h.GetAnomalyThresholds)
+	r.PUT("/security/anomaly-thresholds", h.UpdateAnomalyThresholds)
+
+	put := func(body string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/security/anomaly-thresholds", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := put(`{"fan_out_factor": 8}`); code != http.StatusOK {
+		t.Fatalf("want 200, got %d", code)
+	}
+	if th := h.auditor.AnomalyDetector().Thresholds(); th.FanOutFactor != 8 || th.RateFactor != security.DefaultAnomalyThresholds().RateFactor {
+		t.Fatalf("want a partial update, got %+v", th)
+	}
+	for _, body := range []string{`{"rate_factor": 0.5}`, `{"window_seconds": "x"}`} {
+		if code := put(body); code != http.StatusBadRequest {
+			t.Errorf("%s: want 400, got %d", body, code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/security/anomaly-thresholds", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"fan_out_factor":8`) {
+		t.Fatalf("unexpected response %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestSecurityHandler_UpdatePasswordPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := newSecurityHandler()
+	r := gin.New()
+	r.GET("/security/password-policy", h.GetPasswordPolicy)
+	r.PUT("/security/password-policy", h.UpdatePasswordPolicy)
+
+	put := func(body string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/security/password-policy", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := put(`{"min_length": 12}`); code != http.StatusServiceUnavailable {
+		t.Fatalf("without a checker: want 503, got %d", code)
+	}
+
+	checker, _ := password.NewChecker(password.DefaultPolicy(), []string{"letmein"})
+	h.SetPasswordPolicy(checker)
+	if code := put(`{"min_length": 12, "require_digit": true}`); code != http.StatusOK {
+		t.Fatalf("want 200, got %d", code)
+	}
+	if p := checker.Policy(); p.MinLength != 12 || !p.RequireDigit || p.MinClasses != password.DefaultPolicy().MinClasses {
+		t.Fatalf("want a partial update, got %+v", p)
+	}
+	if code := put(`{"max_length": 200}`); code != http.StatusBadRequest {
+		t.Errorf("max_length above the bcrypt limit: want 400, got %d", code)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/security/password-policy", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"min_length":12`) || !strings.Contains(w.Body.String(), `"banned_passwords":1`) {
+		t.Fatalf("unexpected response %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// fakeDDoSBlocklist blocks the IPs in blocked
+type fakeDDoSBlocklist struct {
+	blocked map[string]middleware.DDoSBlock
+}
+
+func (f *fakeDDoSBlocklist) Blocks(context.Context) ([]middleware.DDoSBlock, error) {
+	blocks := []middleware.DDoSBlock{}
+	for _, block := range f.blocked {
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+func (f *fakeDDoSBlocklist) Unblock(_ context.Context, ip string) (bool, error) {
+	_, ok := f.blocked[ip]
+	delete(f.blocked, ip)
+	return ok, nil
+}
+
+func TestSecurityHandler_DDoSBlocks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := newSecurityHandler()
+	r := gin.New()
+	r.GET("/ddos/blocks", h.ListDDoSBlocks)
+	r.DELETE("/ddos/blocks/:ip", h.DeleteDDoSBlock)
+	do := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("GET", "/ddos/blocks"); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("want 503 without DDoS protection, got %d", w.Code)
+	}
+
+	now := time.Now()
+	h.SetDDoSBlocklist(&fakeDDoSBlocklist{blocked: map[string]middleware.DDoSBlock{
+		"2001:db8::1": {IP: "2001:db8::1", Reason: "too many requests", Offense: 2, BlockedAt: now, Until: now.Add(10 * time.Minute)},
+	}})
+	w := do("GET", "/ddos/blocks")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"remaining_seconds":600`) || !strings.Contains(w.Body.String(), `"reason":"too many requests"`) {
+		t.Fatalf("unexpected response %d: %s", w.Code, w.Body.String())
+	}
+
+	for path, want := range map[string]int{
+		"/ddos/blocks/not-an-ip":   http.StatusBadRequest,
+		"/ddos/blocks/2001:db8::1": http.StatusNoContent,
+		"/ddos/blocks/10.0.0.1":    http.StatusNotFound,
+	} {
+		if w := do("DELETE", path); w.Code != want {
+			t.Errorf("DELETE %s: want %d, got %d", path, want, w.Code)
+		}
+	}
+}
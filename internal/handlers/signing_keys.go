@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListSigningKeys lists the JWT signing keys without their material (admin only)
+func (h *AuthHandler) ListSigningKeys(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"keys": h.authService.SigningKeys()})
+}
+
+// ActivateSigningKey switches the key that signs new access tokens (admin only)
+func (h *AuthHandler) ActivateSigningKey(c *gin.Context) {
+	kid := c.Param("kid")
+	if err := h.authService.ActivateSigningKey(kid); err != nil {
+		h.logger.Errorf("Failed to activate signing key: %v", err)
+		respondError(c, err, "Failed to activate signing key")
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	h.logger.Infof("JWT signing key %s activated by %v", kid, adminID)
+	c.JSON(http.StatusOK, gin.H{"keys": h.authService.SigningKeys()})
+}
+
+// JWKS publishes the public signing keys for services that verify access
+// tokens themselves
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.authService.JWKS())
+}
@@ -3,9 +3,11 @@ package handlers
 import (
 	"net/http"
 	"strconv"
-	"strings"
+	"time"
 
+	"highload-microservice/internal/avatar"
 	"highload-microservice/internal/models"
+	"highload-microservice/internal/rbac"
 	"highload-microservice/internal/services"
 
 	"github.com/gin-gonic/gin"
@@ -13,20 +15,28 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-const errUserNotFound = "user not found"
-
 type UserHandler struct {
-	userService *services.UserService
-	logger      *logrus.Logger
+	userService  *services.UserService
+	avatars      *avatar.Manager
+	avatarMaxAge time.Duration
+	permissions  rbac.Matrix
+	logger       *logrus.Logger
 }
 
 func NewUserHandler(userService *services.UserService, logger *logrus.Logger) *UserHandler {
 	return &UserHandler{
 		userService: userService,
+		permissions: rbac.Default(),
 		logger:      logger,
 	}
 }
 
+// SetPermissions replaces the role permission matrix used for checks made
+// inside handlers, such as listing soft-deleted users
+func (h *UserHandler) SetPermissions(matrix rbac.Matrix) {
+	h.permissions = matrix
+}
+
 func (h *UserHandler) CreateUser(c *gin.Context) {
 	h.logger.Info("CreateUser handler called")
 
@@ -45,15 +55,10 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 	}
 
 	h.logger.Infof("Creating user with email: %s", req.Email)
-	user, err := h.userService.CreateUser(c.Request.Context(), *req)
+	user, err := h.userService.CreateUser(callerContext(c), *req)
 	if err != nil {
-		// Map duplicate email (unique constraint) to 409 if detected
-		if strings.Contains(strings.ToLower(err.Error()), "duplicate") || strings.Contains(strings.ToLower(err.Error()), "unique") || strings.Contains(strings.ToLower(err.Error()), "23505") {
-			c.JSON(http.StatusConflict, gin.H{"error": "User with this email already exists"})
-			return
-		}
 		h.logger.Errorf("Failed to create user: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user", "details": err.Error()})
+		respondError(c, err, "Failed to create user")
 		return
 	}
 
@@ -73,14 +78,14 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 	user, err := h.userService.GetUser(c.Request.Context(), id)
 	if err != nil {
 		h.logger.Errorf("Failed to get user: %v", err)
-		if err.Error() == errUserNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		respondError(c, err, "Failed to get user")
 		return
 	}
 
+	// updated_at changes with every write, including (de)activation and deletion
+	if notModified(c, etag(user.ID.String(), user.UpdatedAt.UTC().Format(time.RFC3339Nano)), user.UpdatedAt) {
+		return
+	}
 	c.JSON(http.StatusOK, user)
 }
 
@@ -100,14 +105,10 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userService.UpdateUser(c.Request.Context(), id, req)
+	user, err := h.userService.UpdateUser(callerContext(c), id, req)
 	if err != nil {
 		h.logger.Errorf("Failed to update user: %v", err)
-		if err.Error() == errUserNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		respondError(c, err, "Failed to update user")
 		return
 	}
 
@@ -123,20 +124,87 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
-	err = h.userService.DeleteUser(c.Request.Context(), id)
+	err = h.userService.DeleteUser(callerContext(c), id)
 	if err != nil {
 		h.logger.Errorf("Failed to delete user: %v", err)
-		if err.Error() == errUserNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		respondError(c, err, "Failed to delete user")
 		return
 	}
 
 	c.JSON(http.StatusNoContent, nil)
 }
 
+// ActivateUser re-enables a deactivated user (admin only)
+func (h *UserHandler) ActivateUser(c *gin.Context) {
+	h.setUserActive(c, true)
+}
+
+// DeactivateUser hides a user from normal reads without deleting it (admin only)
+func (h *UserHandler) DeactivateUser(c *gin.Context) {
+	h.setUserActive(c, false)
+}
+
+func (h *UserHandler) setUserActive(c *gin.Context, active bool) {
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		h.logger.Errorf("Invalid user ID: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	user, err := h.userService.SetUserActive(callerContext(c), id, active)
+	if err != nil {
+		h.logger.Errorf("Failed to change user status: %v", err)
+		respondError(c, err, "Failed to update user status")
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// RestoreUser brings back a soft-deleted user (admin only)
+func (h *UserHandler) RestoreUser(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		h.logger.Errorf("Invalid user ID: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	user, err := h.userService.RestoreUser(callerContext(c), id)
+	if err != nil {
+		h.logger.Errorf("Failed to restore user: %v", err)
+		respondError(c, err, "Failed to restore user")
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// SetUserOwner links a user record to the account that may act on it as its
+// owner, or unlinks it with a null auth_user_id
+func (h *UserHandler) SetUserOwner(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	var req models.SetUserOwnerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if err := h.userService.SetUserOwner(callerContext(c), id, req.AuthUserID); err != nil {
+		h.logger.Errorf("Failed to set user owner: %v", err)
+		respondError(c, err, "Failed to set user owner")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
 func (h *UserHandler) ListUsers(c *gin.Context) {
 	pageStr := c.DefaultQuery("page", "1")
 	limitStr := c.DefaultQuery("limit", "10")
@@ -151,12 +219,81 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 		limit = 10
 	}
 
-	users, err := h.userService.ListUsers(c.Request.Context(), page, limit)
+	filter := models.UserFilter{
+		Query: c.Query("q"),
+		Email: c.Query("email"),
+		Sort:  c.Query("sort"),
+		Order: c.Query("order"),
+	}
+	for _, param := range []struct {
+		name string
+		dst  *time.Time
+	}{{"created_after", &filter.CreatedAfter}, {"created_before", &filter.CreatedBefore}} {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param.name + " time, expected RFC 3339"})
+			return
+		}
+		*param.dst = t
+	}
+
+	// Soft-deleted users are only listed for roles that manage users
+	filter.IncludeDeleted = c.Query("include_deleted") == "true"
+	if filter.IncludeDeleted {
+		role, _ := c.Get("user_role")
+		if caller, _ := role.(models.UserRole); !h.permissions.Allows(caller, rbac.PermUsersManage) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			return
+		}
+	}
+
+	after, ok := parseCursor(c)
+	if !ok {
+		return
+	}
+
+	users, err := h.userService.ListUsers(c.Request.Context(), page, limit, filter, after)
 	if err != nil {
 		h.logger.Errorf("Failed to list users: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list users"})
+		respondError(c, err, "Failed to list users")
 		return
 	}
 
+	updated := make([]time.Time, 0, len(users.Users))
+	for _, user := range users.Users {
+		updated = append(updated, user.UpdatedAt)
+	}
+	setLastModified(c, updated...)
 	c.JSON(http.StatusOK, users)
 }
+
+// GetUserAudit returns the history of changes to a user, newest first
+func (h *UserHandler) GetUserAudit(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	entries, err := h.userService.ListUserAudit(c.Request.Context(), id, page, limit)
+	if err != nil {
+		h.logger.Errorf("Failed to list user audit: %v", err)
+		respondError(c, err, "Failed to list user audit")
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
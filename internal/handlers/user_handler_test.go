@@ -6,14 +6,23 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/png"
 	"net/http"
 	"net/http/httptest"
 	"regexp"
 	"testing"
 	"time"
 
+	"highload-microservice/internal/avatar"
+	"highload-microservice/internal/cache"
+	"highload-microservice/internal/database"
 	"highload-microservice/internal/models"
+	"highload-microservice/internal/objectstore"
+	"highload-microservice/internal/rbac"
+	"highload-microservice/internal/repository"
 	"highload-microservice/internal/services"
+	"highload-microservice/internal/worker"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gin-gonic/gin"
@@ -21,14 +30,6 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-type stubRedis struct{}
-
-func (s *stubRedis) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
-	return nil
-}
-func (s *stubRedis) Get(ctx context.Context, key string) (string, error) { return "", sql.ErrNoRows }
-func (s *stubRedis) Del(ctx context.Context, keys ...string) error       { return nil }
-
 type stubKafka struct{}
 
 func (s *stubKafka) SendEvent(ctx context.Context, event models.KafkaEvent) error { return nil }
@@ -39,7 +40,7 @@ func newUserHandler(t *testing.T) (*UserHandler, sqlmock.Sqlmock, func()) {
 		t.Fatalf("sqlmock: %v", err)
 	}
 	logger := logrus.New()
-	svc := services.NewUserService(db, &stubRedis{}, &stubKafka{}, logger)
+	svc := services.NewUserService(repository.NewPostgresUserRepository(db), cache.NewMemoryCache(), &stubKafka{}, logger)
 	h := NewUserHandler(svc, logger)
 	cleanup := func() { db.Close() }
 	return h, mock, cleanup
@@ -51,7 +52,7 @@ func TestUserHandler_CreateUser(t *testing.T) {
 	defer cleanup()
 
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users")).
-		WithArgs(sqlmock.AnyArg(), "u@example.com", "John", "Doe", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WithArgs(sqlmock.AnyArg(), "u@example.com", "John", "Doe", sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	r := gin.New()
@@ -127,6 +128,83 @@ func TestUserHandler_ListUsers(t *testing.T) {
 	_ = json.Unmarshal(w.Body.Bytes(), &out)
 }
 
+func TestUserHandler_ListUsers_IncludeDeletedRequiresAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h, _, cleanup := newUserHandler(t)
+	defer cleanup()
+
+	r := gin.New()
+	r.GET("/users", func(c *gin.Context) {
+		c.Set("user_role", models.RoleUser)
+		h.ListUsers(c)
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/users?include_deleted=true", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", w.Code)
+	}
+}
+
+func TestUserHandler_ListUsers_IncludeDeletedFollowsPermissions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	matrix, err := rbac.ParseMatrix("user=users:read,users:manage;admin=users:read")
+	if err != nil {
+		t.Fatalf("parse matrix: %v", err)
+	}
+
+	for _, tc := range []struct {
+		role models.UserRole
+		want int
+	}{
+		{models.RoleUser, http.StatusOK},
+		{models.RoleAdmin, http.StatusForbidden},
+	} {
+		h, mock, cleanup := newUserHandler(t)
+		h.SetPermissions(matrix)
+		if tc.want == http.StatusOK {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM users")).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT id, email, first_name, last_name, created_at, updated_at, deleted_at ")).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "email", "first_name", "last_name", "created_at", "updated_at", "deleted_at"}).
+					AddRow(uuid.New(), "u@example.com", "J", "D", time.Now(), time.Now(), time.Now()))
+		}
+
+		r := gin.New()
+		r.GET("/users", func(c *gin.Context) {
+			c.Set("user_role", tc.role)
+			h.ListUsers(c)
+		})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/users?include_deleted=true", nil)
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Fatalf("role %s: expected %d, got %d: %s", tc.role, tc.want, w.Code, w.Body.String())
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatalf("role %s: %v", tc.role, err)
+		}
+		cleanup()
+	}
+}
+
+func TestUserHandler_ListUsers_InvalidFilters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h, _, cleanup := newUserHandler(t)
+	defer cleanup()
+
+	r := gin.New()
+	r.GET("/users", h.ListUsers)
+	for _, q := range []string{"?created_after=yesterday", "?sort=password", "?order=up"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/users"+q, nil)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("query %s expected 400, got %d", q, w.Code)
+		}
+	}
+}
+
 func TestUserHandler_ListUsers_PaginationBounds(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	h, mock, cleanup := newUserHandler(t)
@@ -202,7 +280,7 @@ func TestUserHandler_CreateUser_Conflict(t *testing.T) {
 	defer cleanup()
 
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users")).
-		WithArgs(sqlmock.AnyArg(), "u@example.com", "John", "Doe", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WithArgs(sqlmock.AnyArg(), "u@example.com", "John", "Doe", sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
 		WillReturnError(fmt.Errorf("duplicate key value violates unique constraint (SQLSTATE 23505)"))
 
 	r := gin.New()
@@ -225,7 +303,7 @@ func TestUserHandler_CreateUser_DBError(t *testing.T) {
 	defer cleanup()
 
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users")).
-		WithArgs(sqlmock.AnyArg(), "u@example.com", "John", "Doe", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WithArgs(sqlmock.AnyArg(), "u@example.com", "John", "Doe", sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
 		WillReturnError(fmt.Errorf("db down"))
 
 	r := gin.New()
@@ -339,8 +417,8 @@ func TestUserHandler_DeleteUser_NoContent(t *testing.T) {
 	defer cleanup()
 
 	id := uuid.New()
-	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM users WHERE id = $1")).
-		WithArgs(id).
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET deleted_at = $1, updated_at = $2 WHERE id = $3 AND deleted_at IS NULL")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), id).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	r := gin.New()
@@ -359,8 +437,8 @@ func TestUserHandler_DeleteUser_NotFound(t *testing.T) {
 	defer cleanup()
 
 	id := uuid.New()
-	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM users WHERE id = $1")).
-		WithArgs(id).
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET deleted_at = $1, updated_at = $2 WHERE id = $3 AND deleted_at IS NULL")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), id).
 		WillReturnResult(sqlmock.NewResult(0, 0))
 
 	r := gin.New()
@@ -379,8 +457,8 @@ func TestUserHandler_DeleteUser_DBError(t *testing.T) {
 	defer cleanup()
 
 	id := uuid.New()
-	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM users WHERE id = $1")).
-		WithArgs(id).
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET deleted_at = $1, updated_at = $2 WHERE id = $3 AND deleted_at IS NULL")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), id).
 		WillReturnError(fmt.Errorf("db failed"))
 
 	r := gin.New()
@@ -392,3 +470,205 @@ func TestUserHandler_DeleteUser_DBError(t *testing.T) {
 		t.Fatalf("expected 500, got %d", w.Code)
 	}
 }
+
+func TestUserHandler_DeactivateAndActivate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h, mock, cleanup := newUserHandler(t)
+	defer cleanup()
+
+	id := uuid.New()
+	cols := []string{"id", "email", "first_name", "last_name", "is_active", "created_at", "updated_at"}
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET is_active = $1")).
+		WithArgs(false, sqlmock.AnyArg(), id, false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, email, first_name, last_name, is_active")).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows(cols).AddRow(id, "u@example.com", "U", "S", false, time.Now(), time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET is_active = $1")).
+		WithArgs(true, sqlmock.AnyArg(), id, true).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, email, first_name, last_name, is_active")).
+		WithArgs(id).WillReturnError(sql.ErrNoRows)
+
+	r := gin.New()
+	r.POST("/users/:id/deactivate", h.DeactivateUser)
+	r.POST("/users/:id/activate", h.ActivateUser)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/users/"+id.String()+"/deactivate", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("deactivate: expected 200, got %d", w.Code)
+	}
+	var user models.User
+	if err := json.Unmarshal(w.Body.Bytes(), &user); err != nil || user.IsActive {
+		t.Fatalf("expected inactive user, got %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/users/"+id.String()+"/activate", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("activate unknown: expected 404, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/users/not-a-uuid/activate", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid id: expected 400, got %d", w.Code)
+	}
+}
+
+func TestUserHandler_GetUser_ConditionalRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h, mock, cleanup := newUserHandler(t)
+	defer cleanup()
+
+	id := uuid.New()
+	updatedAt := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+	// Later requests are served from the cache
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, email, first_name, last_name, created_at, updated_at FROM users WHERE id = $1")).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "first_name", "last_name", "created_at", "updated_at"}).
+			AddRow(id, "u@example.com", "J", "D", updatedAt, updatedAt))
+
+	r := gin.New()
+	r.GET("/users/:id", h.GetUser)
+	get := func(header, value string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/users/"+id.String(), nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("", "")
+	tag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || tag == "" {
+		t.Fatalf("expected 200 with ETag, got %d (ETag %q)", w.Code, tag)
+	}
+	if w.Header().Get("Last-Modified") != "Wed, 01 May 2024 12:00:00 GMT" {
+		t.Fatalf("unexpected Last-Modified %q", w.Header().Get("Last-Modified"))
+	}
+
+	if w := get("If-None-Match", `W/"stale", `+tag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatalf("expected 304 for matching ETag, got %d", w.Code)
+	}
+	if w := get("If-None-Match", `"stale"`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for stale ETag, got %d", w.Code)
+	}
+	if w := get("If-Modified-Since", "Wed, 01 May 2024 12:00:00 GMT"); w.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 for unmodified resource, got %d", w.Code)
+	}
+	if w := get("If-Modified-Since", "Wed, 01 May 2024 11:59:59 GMT"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for modified resource, got %d", w.Code)
+	}
+}
+
+func TestUserHandler_ListUsers_LastModified(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h, mock, cleanup := newUserHandler(t)
+	defer cleanup()
+
+	older := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM users")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, email, first_name, last_name, created_at, updated_at ")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "first_name", "last_name", "created_at", "updated_at"}).
+			AddRow(uuid.New(), "a@example.com", "A", "A", older, newer).
+			AddRow(uuid.New(), "b@example.com", "B", "B", older, older))
+
+	r := gin.New()
+	r.GET("/users", h.ListUsers)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/users", nil)
+	r.ServeHTTP(w, req)
+	if got := w.Header().Get("Last-Modified"); got != newer.Format(http.TimeFormat) {
+		t.Fatalf("expected Last-Modified of the newest user, got %q", got)
+	}
+}
+
+// droppedTasks discards submitted tasks, leaving thumbnails unresized
+type droppedTasks struct{}
+
+func (droppedTasks) Submit(worker.Task) error { return nil }
+
+func TestUserHandler_GetAvatar_CachesFinalImages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h, _, cleanup := newUserHandler(t)
+	defer cleanup()
+
+	r := gin.New()
+	r.GET("/users/:id/avatar", h.GetAvatar)
+	userID := uuid.New()
+	get := func(query, ifNoneMatch string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/users/"+userID.String()+"/avatar"+query, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	if w := get("", ""); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("avatars disabled: expected 503, got %d", w.Code)
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	objects, err := objectstore.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("file store: %v", err)
+	}
+	dialect, _ := database.NewDialect(database.DriverPostgres)
+	manager := avatar.NewManager(avatar.NewSQLStore(db, dialect), objects, droppedTasks{}, avatar.Config{ThumbnailSizes: []int{64}}, logrus.New())
+	h.SetAvatars(manager, time.Minute)
+
+	columns := []string{"user_id", "version", "content_type", "width", "height", "size_bytes", "thumbnails", "updated_at"}
+	selectAvatar := regexp.QuoteMeta("FROM user_avatars WHERE user_id = $1")
+	mock.ExpectQuery(selectAvatar).WithArgs(userID).WillReturnRows(sqlmock.NewRows(columns))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO user_avatars")).WillReturnResult(sqlmock.NewResult(0, 1))
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, img)
+	uploaded, err := manager.Upload(context.Background(), userID, buf.Bytes())
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	row := func() *sqlmock.Rows {
+		return sqlmock.NewRows(columns).AddRow(userID, uploaded.Version, "image/png", 8, 8, buf.Len(), "", uploaded.UpdatedAt)
+	}
+
+	mock.ExpectQuery(selectAvatar).WithArgs(userID).WillReturnRows(row())
+	w := get("", "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" || !bytes.Equal(w.Body.Bytes(), buf.Bytes()) {
+		t.Fatalf("status=%d content-type=%s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "private, max-age=60" {
+		t.Fatalf("Cache-Control = %q", cc)
+	}
+
+	mock.ExpectQuery(selectAvatar).WithArgs(userID).WillReturnRows(row())
+	if w := get("", w.Header().Get("ETag")); w.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", w.Code)
+	}
+
+	// The original stands in for the thumbnail, but must be revalidated
+	mock.ExpectQuery(selectAvatar).WithArgs(userID).WillReturnRows(row())
+	if w := get("?size=64", ""); w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "no-cache" {
+		t.Fatalf("pending thumbnail: status=%d Cache-Control=%q", w.Code, w.Header().Get("Cache-Control"))
+	}
+	if w := get("?size=65", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("unsupported size: expected 400, got %d", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"highload-microservice/internal/webhook"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 500
+)
+
+// CreateWebhookRequest subscribes an endpoint to events
+type CreateWebhookRequest struct {
+	URL        string   `json:"url" binding:"required"`
+	EventTypes []string `json:"event_types"` // TYPE or PREFIX*; empty receives every event
+	Secret     string   `json:"secret"`      // generated when empty
+}
+
+// UpdateWebhookRequest changes a webhook; omitted fields are kept
+type UpdateWebhookRequest struct {
+	URL        *string  `json:"url"`
+	EventTypes []string `json:"event_types"`
+	IsActive   *bool    `json:"is_active"`
+}
+
+// SetWebhooks enables the webhook management endpoints
+func (h *EventHandler) SetWebhooks(manager *webhook.Manager) {
+	h.webhooks = manager
+}
+
+// webhooksEnabled responds 503 when webhooks are not enabled
+func (h *EventHandler) webhooksEnabled(c *gin.Context) bool {
+	if h.webhooks == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Webhooks are not enabled"})
+		return false
+	}
+	return true
+}
+
+// ListWebhooks returns every webhook subscription
+func (h *EventHandler) ListWebhooks(c *gin.Context) {
+	if !h.webhooksEnabled(c) {
+		return
+	}
+
+	hooks, err := h.webhooks.List(c.Request.Context())
+	if err != nil {
+		h.logger.Errorf("Failed to list webhooks: %v", err)
+		respondError(c, err, "Failed to list webhooks")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"webhooks":  hooks,
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// CreateWebhook subscribes an endpoint to events. The response carries the
+// signing secret, which is not shown again.
+func (h *EventHandler) CreateWebhook(c *gin.Context) {
+	if !h.webhooksEnabled(c) {
+		return
+	}
+
+	var req CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	adminUUID, _ := adminID.(uuid.UUID)
+	var createdBy *uuid.UUID
+	if adminUUID != uuid.Nil {
+		createdBy = &adminUUID
+	}
+
+	hook, err := h.webhooks.Create(c.Request.Context(), req.URL, req.EventTypes, req.Secret, createdBy)
+	if err != nil {
+		h.logger.Errorf("Failed to create webhook: %v", err)
+		respondError(c, err, "Failed to create webhook")
+		return
+	}
+	c.JSON(http.StatusCreated, hook)
+}
+
+// GetWebhook returns a webhook subscription
+func (h *EventHandler) GetWebhook(c *gin.Context) {
+	if !h.webhooksEnabled(c) {
+		return
+	}
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	hook, err := h.webhooks.Get(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err, "Failed to get webhook")
+		return
+	}
+	c.JSON(http.StatusOK, hook)
+}
+
+// UpdateWebhook changes a webhook's URL, event types or state
+func (h *EventHandler) UpdateWebhook(c *gin.Context) {
+	if !h.webhooksEnabled(c) {
+		return
+	}
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	hook, err := h.webhooks.Update(c.Request.Context(), id, webhook.Changes{
+		URL:        req.URL,
+		EventTypes: req.EventTypes,
+		IsActive:   req.IsActive,
+	})
+	if err != nil {
+		h.logger.Errorf("Failed to update webhook: %v", err)
+		respondError(c, err, "Failed to update webhook")
+		return
+	}
+	c.JSON(http.StatusOK, hook)
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+func (h *EventHandler) DeleteWebhook(c *gin.Context) {
+	if !h.webhooksEnabled(c) {
+		return
+	}
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.webhooks.Delete(c.Request.Context(), id); err != nil {
+		h.logger.Errorf("Failed to delete webhook: %v", err)
+		respondError(c, err, "Failed to delete webhook")
+		return
+	}
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// ListWebhookDeliveries returns the most recent deliveries of a webhook,
+// newest first
+func (h *EventHandler) ListWebhookDeliveries(c *gin.Context) {
+	if !h.webhooksEnabled(c) {
+		return
+	}
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	limit := defaultDeliveryLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxDeliveryLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxDeliveryLimit)})
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := h.webhooks.Deliveries(c.Request.Context(), id, limit)
+	if err != nil {
+		h.logger.Errorf("Failed to list webhook deliveries: %v", err)
+		respondError(c, err, "Failed to list webhook deliveries")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"deliveries": deliveries,
+		"timestamp":  time.Now().Unix(),
+	})
+}
+
+// RedeliverWebhook queues a delivery again with a fresh set of attempts
+func (h *EventHandler) RedeliverWebhook(c *gin.Context) {
+	if !h.webhooksEnabled(c) {
+		return
+	}
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	deliveryID, err := uuid.Parse(c.Param("delivery_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID"})
+		return
+	}
+
+	if err := h.webhooks.Redeliver(c.Request.Context(), id, deliveryID); err != nil {
+		h.logger.Errorf("Failed to redeliver webhook: %v", err)
+		respondError(c, err, "Failed to redeliver webhook")
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Delivery queued"})
+}
+
+func webhookID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
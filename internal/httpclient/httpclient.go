@@ -0,0 +1,246 @@
+// Package httpclient builds the clients of outbound HTTP calls: webhook
+// deliveries, alert notifications, OIDC and secret backends. Every client
+// shares one connection pool with bounded dial and TLS timeouts, retries
+// idempotent requests with backoff, guards each host with a circuit breaker,
+// records metrics and propagates the request ID and trace of the calling
+// request.
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"highload-microservice/internal/metrics"
+	"highload-microservice/internal/requestid"
+	"highload-microservice/internal/resilience"
+)
+
+// IdempotencyKeyHeader marks a request as safe to retry whatever its method
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// Config tunes a client. The zero value has a 10s timeout and neither
+// retries nor circuit breaking.
+type Config struct {
+	// Timeout bounds a call including its retries. Defaults to 10s.
+	Timeout time.Duration
+	// MaxRetries is the number of retries of idempotent requests after
+	// network errors and 429, 502, 503 and 504 responses
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry, doubled for each
+	// further one with jitter. Defaults to 100ms.
+	RetryBackoff time.Duration
+	// MaxBackoff caps the delay between retries, including one asked for by
+	// Retry-After. Defaults to 2s.
+	MaxBackoff time.Duration
+	// Breaker enables a circuit breaker per host; network errors and 5xx
+	// responses count as failures
+	Breaker *resilience.Config
+	// NoRedirects returns redirect responses instead of following them,
+	// for calls whose signed payload must not be sent elsewhere
+	NoRedirects bool
+}
+
+func (c Config) withDefaults() Config {
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.RetryBackoff <= 0 {
+		c.RetryBackoff = 100 * time.Millisecond
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = 2 * time.Second
+	}
+	return c
+}
+
+// shared is the connection pool of every client
+var shared = sync.OnceValue(func() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   16,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+})
+
+// New returns a client for the outbound calls of name, which labels its
+// metrics and breakers
+func New(name string, cfg Config) *http.Client {
+	cfg = cfg.withDefaults()
+	client := &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: newTransport(name, cfg, shared()),
+	}
+	if cfg.NoRedirects {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	}
+	return client
+}
+
+// transport adds retries, breakers, metrics and tracing to base
+type transport struct {
+	name string
+	cfg  Config
+	base http.RoundTripper
+
+	mu       sync.Mutex
+	breakers map[string]*resilience.Breaker
+}
+
+func newTransport(name string, cfg Config, base http.RoundTripper) *transport {
+	return &transport{name: name, cfg: cfg, base: base, breakers: make(map[string]*resilience.Breaker)}
+}
+
+// breaker returns the breaker of host, or nil when breaking is disabled
+func (t *transport) breaker(host string) *resilience.Breaker {
+	if t.cfg.Breaker == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.breakers[host]
+	if !ok {
+		b = resilience.New("http_"+t.name+"_"+host, *t.cfg.Breaker)
+		t.breakers[host] = b
+	}
+	return b
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	// RoundTrip must not modify the caller's request
+	req = req.Clone(ctx)
+	if id := requestid.FromContext(ctx); id != "" && req.Header.Get(requestid.Header) == "" {
+		req.Header.Set(requestid.Header, id)
+	}
+	if req.Header.Get(requestid.TraceHeader) == "" {
+		if traceparent := requestid.TraceParent(ctx); traceparent != "" {
+			req.Header.Set(requestid.TraceHeader, traceparent)
+		}
+	}
+
+	retryable := retryableRequest(req)
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := t.attempt(req)
+		if attempt >= t.cfg.MaxRetries || !retryable || !retryableOutcome(ctx, resp, err) {
+			return resp, err
+		}
+		delay, ok := t.backoff(attempt, resp)
+		if !ok {
+			return resp, err
+		}
+		if resp != nil {
+			// Reuse the connection for the next attempt
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+
+		metrics.HTTPClientRetried(t.name)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends req once through the breaker of its host
+func (t *transport) attempt(req *http.Request) (*http.Response, error) {
+	var done func(error)
+	if b := t.breaker(req.URL.Host); b != nil {
+		var err error
+		if done, err = b.Allow(); err != nil {
+			return nil, fmt.Errorf("%s: %w", req.URL.Host, err)
+		}
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	statusCode := 0
+	if resp != nil {
+		statusCode = resp.StatusCode
+	}
+	metrics.HTTPClientRequest(t.name, req.Method, statusCode, time.Since(start), err)
+
+	if done != nil {
+		switch {
+		case err != nil && req.Context().Err() != nil:
+			done(resilience.ErrAbandoned)
+		case err != nil:
+			done(err)
+		case statusCode >= http.StatusInternalServerError:
+			done(fmt.Errorf("status %d", statusCode))
+		default:
+			done(nil)
+		}
+	}
+	return resp, err
+}
+
+// backoff returns the delay before retrying after attempt, honouring a
+// Retry-After of resp. A Retry-After beyond MaxBackoff is not waited for.
+func (t *transport) backoff(attempt int, resp *http.Response) (time.Duration, bool) {
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			after := time.Duration(seconds) * time.Second
+			return after, after <= t.cfg.MaxBackoff
+		}
+	}
+	delay := t.cfg.RetryBackoff << attempt
+	if delay <= 0 || delay > t.cfg.MaxBackoff {
+		delay = t.cfg.MaxBackoff
+	}
+	// Equal jitter keeps callers that failed together from retrying together
+	return delay/2 + rand.N(delay/2+1), true
+}
+
+// retryableRequest reports whether req may be sent again: its method is
+// idempotent or it carries an idempotency key, and its body can be replayed
+func retryableRequest(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get(IdempotencyKeyHeader) != ""
+}
+
+// retryableOutcome reports whether an attempt failed in a way another
+// attempt may not
+func retryableOutcome(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil && !errors.Is(err, resilience.ErrOpen)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/requestid"
+	"highload-microservice/internal/resilience"
+)
+
+// flaky fails the first failures requests with status
+func flaky(t *testing.T, failures int32, status int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestClient_RetriesIdempotentRequests(t *testing.T) {
+	client := New("test", Config{MaxRetries: 2, RetryBackoff: time.Millisecond})
+
+	server, calls := flaky(t, 2, http.StatusServiceUnavailable)
+	resp, err := client.Get(server.URL)
+	if err != nil || resp.StatusCode != http.StatusOK || calls.Load() != 3 {
+		t.Fatalf("want success on the third attempt, got %v after %d calls", err, calls.Load())
+	}
+	resp.Body.Close()
+
+	// POST is only retried with an idempotency key, and its body is replayed
+	server, calls = flaky(t, 1, http.StatusBadGateway)
+	resp, err = client.Post(server.URL, "application/json", strings.NewReader(`{}`))
+	if err != nil || resp.StatusCode != http.StatusBadGateway || calls.Load() != 1 {
+		t.Fatalf("want a single POST, got %v after %d calls", err, calls.Load())
+	}
+	resp.Body.Close()
+
+	server, calls = flaky(t, 1, http.StatusBadGateway)
+	req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(`{}`))
+	req.Header.Set(IdempotencyKeyHeader, "k1")
+	resp, err = client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK || calls.Load() != 2 {
+		t.Fatalf("want the keyed POST retried, got %v after %d calls", err, calls.Load())
+	}
+	resp.Body.Close()
+
+	// Client errors are final
+	server, calls = flaky(t, 5, http.StatusNotFound)
+	resp, err = client.Get(server.URL)
+	if err != nil || resp.StatusCode != http.StatusNotFound || calls.Load() != 1 {
+		t.Fatalf("want no retry of a 404, got %v after %d calls", err, calls.Load())
+	}
+	resp.Body.Close()
+}
+
+func TestClient_BreakerOpensPerHost(t *testing.T) {
+	client := New("test", Config{Breaker: &resilience.Config{FailureThreshold: 2, OpenTimeout: time.Minute}})
+	server, calls := flaky(t, 100, http.StatusInternalServerError)
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("attempt %d: %v", i, err)
+		}
+		resp.Body.Close()
+	}
+	if _, err := client.Get(server.URL); !errors.Is(err, resilience.ErrOpen) {
+		t.Fatalf("want an open breaker, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("open breaker must not reach the server, got %d calls", calls.Load())
+	}
+}
+
+func TestClient_PropagatesRequestIDAndTrace(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	ctx := requestid.NewContext(context.Background(), "0190b4c4-7d2c-7b6e-8f1a-2b3c4d5e6f70")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	resp, err := New("test", Config{}).Do(req)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+
+	if header.Get(requestid.Header) != "0190b4c4-7d2c-7b6e-8f1a-2b3c4d5e6f70" {
+		t.Fatalf("request ID not propagated: %v", header)
+	}
+	if traceparent := header.Get(requestid.TraceHeader); !strings.HasPrefix(traceparent, "00-0190b4c47d2c7b6e8f1a2b3c4d5e6f70-") {
+		t.Fatalf("unexpected traceparent %q", traceparent)
+	}
+	if req.Header.Get(requestid.Header) != "" {
+		t.Fatalf("the caller's request must not be modified")
+	}
+}
@@ -0,0 +1,371 @@
+// Package jwtkeys holds the keys that sign and verify access tokens. Each key
+// has an ID written to the token's "kid" header, so keys can be rotated: new
+// tokens are signed with the active key while tokens signed with any other
+// configured key stay valid until they expire.
+package jwtkeys
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+)
+
+var (
+	// ErrUnknownKey is returned for a key ID that is not configured
+	ErrUnknownKey = errors.New("unknown signing key")
+	// ErrVerifyOnly is returned when a key without a private part is activated
+	ErrVerifyOnly = errors.New("key can only verify")
+)
+
+// Key is a signing key, or a verification key when only the public part of
+// an asymmetric key is known
+type Key struct {
+	ID        string
+	Algorithm string
+	sign      interface{} // nil for verification keys
+	verify    interface{}
+}
+
+// NewHMACKey creates an HS256 key
+func NewHMACKey(id string, secret []byte) (Key, error) {
+	if err := validID(id); err != nil {
+		return Key{}, err
+	}
+	if len(secret) == 0 {
+		return Key{}, fmt.Errorf("key %q: empty secret", id)
+	}
+	return Key{ID: id, Algorithm: AlgHS256, sign: secret, verify: secret}, nil
+}
+
+// ParsePEM parses an RSA (RS256) or P-256 ECDSA (ES256) key. Private keys in
+// PKCS#8, PKCS#1 or SEC 1 form sign and verify; public keys only verify.
+func ParsePEM(id string, data []byte) (Key, error) {
+	if err := validID(id); err != nil {
+		return Key{}, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, fmt.Errorf("key %q: no PEM block found", id)
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return Key{}, fmt.Errorf("key %q: unsupported PEM block %q", id, block.Type)
+	}
+	if err != nil {
+		return Key{}, fmt.Errorf("key %q: %w", id, err)
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return Key{ID: id, Algorithm: AlgRS256, sign: k, verify: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return Key{ID: id, Algorithm: AlgRS256, verify: k}, nil
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return Key{}, fmt.Errorf("key %q: only P-256 ECDSA keys are supported", id)
+		}
+		return Key{ID: id, Algorithm: AlgES256, sign: k, verify: &k.PublicKey}, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return Key{}, fmt.Errorf("key %q: only P-256 ECDSA keys are supported", id)
+		}
+		return Key{ID: id, Algorithm: AlgES256, verify: k}, nil
+	default:
+		return Key{}, fmt.Errorf("key %q: unsupported key type %T", id, parsed)
+	}
+}
+
+// CanSign reports whether the private part of the key is known
+func (k Key) CanSign() bool {
+	return k.sign != nil
+}
+
+func validID(id string) error {
+	if id == "" || strings.ContainsAny(id, ":, ") {
+		return fmt.Errorf("invalid key ID %q", id)
+	}
+	return nil
+}
+
+// Info describes a key without its material
+type Info struct {
+	ID        string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Active    bool   `json:"active"`
+	CanSign   bool   `json:"can_sign"`
+}
+
+// KeySet signs tokens with the active key and verifies them with any key
+type KeySet struct {
+	legacyID string // verifies tokens issued without a kid
+
+	mu       sync.RWMutex
+	activeID string
+	keys     map[string]Key
+}
+
+// NewKeySet creates a key set signing with activeID. Tokens without a kid,
+// issued before keys had IDs, are verified with legacyID; an empty legacyID
+// rejects them.
+func NewKeySet(activeID, legacyID string, keys ...Key) (*KeySet, error) {
+	set := &KeySet{legacyID: legacyID, keys: make(map[string]Key, len(keys))}
+	for _, key := range keys {
+		if _, dup := set.keys[key.ID]; dup {
+			return nil, fmt.Errorf("duplicate key ID %q", key.ID)
+		}
+		set.keys[key.ID] = key
+	}
+	if legacyID != "" {
+		if _, ok := set.keys[legacyID]; !ok {
+			return nil, fmt.Errorf("legacy key %q is not configured", legacyID)
+		}
+	}
+	if err := set.Activate(activeID); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// Activate makes id the key that signs new tokens
+func (s *KeySet) Activate(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	}
+	if !key.CanSign() {
+		return fmt.Errorf("%w: %q", ErrVerifyOnly, id)
+	}
+	s.activeID = id
+	return nil
+}
+
+// ActiveID returns the ID of the key that signs new tokens
+func (s *KeySet) ActiveID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.activeID
+}
+
+// Sign signs claims with the active key
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	s.mu.RLock()
+	key := s.keys[s.activeID]
+	s.mu.RUnlock()
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.sign)
+}
+
+// Keyfunc returns the verification key of a token, for jwt.Parse. The
+// token's algorithm must be the one of its key, so an HMAC token can't be
+// verified with a public key used as the secret.
+func (s *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	id, _ := token.Header["kid"].(string)
+	if id == "" {
+		id = s.legacyID
+	}
+
+	s.mu.RLock()
+	key, ok := s.keys[id]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.verify, nil
+}
+
+// Keys describes the configured keys, sorted by ID
+func (s *KeySet) Keys() []Info {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	infos := make([]Info, 0, len(s.keys))
+	for id, key := range s.keys {
+		infos = append(infos, Info{ID: id, Algorithm: key.Algorithm, Active: id == s.activeID, CanSign: key.CanSign()})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// JWK is a public key in JSON Web Key form (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	ID        string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys, so downstream services can verify tokens
+// themselves. HMAC keys are secret and never included.
+func (s *KeySet) JWKS() JWKS {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	set := JWKS{Keys: []JWK{}}
+	for id, key := range s.keys {
+		switch pub := key.verify.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType: "RSA", ID: id, Use: "sig", Algorithm: key.Algorithm,
+				N: encode(pub.N.Bytes()),
+				E: encode(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case *ecdsa.PublicKey:
+			point, err := pub.ECDH()
+			if err != nil {
+				continue
+			}
+			// Uncompressed point: 0x04 || X || Y
+			raw := point.Bytes()
+			size := (len(raw) - 1) / 2
+			set.Keys = append(set.Keys, JWK{
+				KeyType: "EC", ID: id, Use: "sig", Algorithm: key.Algorithm, Curve: "P-256",
+				X: encode(raw[1 : 1+size]),
+				Y: encode(raw[1+size:]),
+			})
+		}
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].ID < set.Keys[j].ID })
+	return set
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// PublicKey decodes an RSA or P-256 key published by another service, e.g.
+// an identity provider
+func (k JWK) PublicKey() (interface{}, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: invalid modulus: %w", k.ID, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("key %q: invalid exponent", k.ID)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Curve != "P-256" {
+			return nil, fmt.Errorf("key %q: unsupported curve %q", k.ID, k.Curve)
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("key %q: invalid point", k.ID)
+		}
+		// Rejects points that are not on the curve
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.ID, err)
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("key %q: unsupported key type %q", k.ID, k.KeyType)
+	}
+}
+
+// Config lists the keys of a key set as they are configured
+type Config struct {
+	Secret   string   // JWT_SECRET
+	SecretID string   // ID of Secret; tokens without a kid are verified with it
+	ActiveID string   // signs new tokens; empty means SecretID
+	HMACKeys []string // more HMAC keys, "ID:BASE64"
+	KeyFiles []string // PEM files of RSA/ECDSA keys, "ID:PATH"
+}
+
+// Load builds a key set from configuration, reading the PEM files
+func Load(cfg Config) (*KeySet, error) {
+	secret, err := NewHMACKey(cfg.SecretID, []byte(cfg.Secret))
+	if err != nil {
+		return nil, err
+	}
+	keys := []Key{secret}
+
+	for _, entry := range cfg.HMACKeys {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid HMAC key entry: expected ID:BASE64")
+		}
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HMAC key %q: %w", id, err)
+		}
+		key, err := NewHMACKey(id, decoded)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	for _, entry := range cfg.KeyFiles {
+		id, path, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid key file entry: expected ID:PATH")
+		}
+		data, err := os.ReadFile(path) // #nosec G304 -- paths come from configuration
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key %q: %w", id, err)
+		}
+		key, err := ParsePEM(id, data)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	activeID := cfg.ActiveID
+	if activeID == "" {
+		activeID = cfg.SecretID
+	}
+	return NewKeySet(activeID, cfg.SecretID, keys...)
+}
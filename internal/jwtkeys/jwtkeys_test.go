@@ -0,0 +1,129 @@
+package jwtkeys
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func parse(t *testing.T, set *KeySet, token string) error {
+	t.Helper()
+	_, err := jwt.Parse(token, set.Keyfunc)
+	return err
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	k1, _ := NewHMACKey("k1", []byte("first-secret"))
+	k2, _ := NewHMACKey("k2", []byte("second-secret"))
+	set, err := NewKeySet("k1", "k1", k1, k2)
+	if err != nil {
+		t.Fatalf("key set: %v", err)
+	}
+
+	old, err := set.Sign(jwt.MapClaims{"sub": "a"})
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	if err := set.Activate("k2"); err != nil {
+		t.Fatalf("activate: %v", err)
+	}
+	current, _ := set.Sign(jwt.MapClaims{"sub": "a"})
+	token, _, _ := jwt.NewParser().ParseUnverified(current, jwt.MapClaims{})
+	if token.Header["kid"] != "k2" {
+		t.Fatalf("want kid k2, got %v", token.Header["kid"])
+	}
+
+	// Tokens signed with the previous key stay valid
+	for _, tok := range []string{old, current} {
+		if err := parse(t, set, tok); err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+	}
+
+	// Tokens issued before kids existed use the legacy key
+	legacy, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "a"}).SignedString([]byte("first-secret"))
+	if err := parse(t, set, legacy); err != nil {
+		t.Fatalf("legacy token: %v", err)
+	}
+
+	if err := set.Activate("missing"); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("want ErrUnknownKey, got %v", err)
+	}
+}
+
+func TestKeySet_RejectsUnknownKidAndAlgorithmMismatch(t *testing.T) {
+	k1, _ := NewHMACKey("k1", []byte("secret"))
+	set, _ := NewKeySet("k1", "", k1)
+
+	unknown := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{})
+	unknown.Header["kid"] = "other"
+	tok, _ := unknown.SignedString([]byte("secret"))
+	if err := parse(t, set, tok); err == nil {
+		t.Fatalf("expected unknown kid to be rejected")
+	}
+
+	// No legacy key: tokens without kid are rejected
+	tok, _ = jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{}).SignedString([]byte("secret"))
+	if err := parse(t, set, tok); err == nil {
+		t.Fatalf("expected token without kid to be rejected")
+	}
+
+	// A token claiming another algorithm for an HMAC key
+	mismatch := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{})
+	mismatch.Header["kid"] = "k1"
+	tok, _ = mismatch.SignedString([]byte("secret"))
+	if err := parse(t, set, tok); err == nil {
+		t.Fatalf("expected algorithm mismatch to be rejected")
+	}
+}
+
+func TestKeySet_ECDSAAndJWKS(t *testing.T) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(private)
+	signer, err := ParsePEM("ec1", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil || signer.Algorithm != AlgES256 || !signer.CanSign() {
+		t.Fatalf("parse private key: %+v %v", signer, err)
+	}
+	hmacKey, _ := NewHMACKey("h1", []byte("secret"))
+
+	set, err := NewKeySet("ec1", "h1", signer, hmacKey)
+	if err != nil {
+		t.Fatalf("key set: %v", err)
+	}
+	tok, err := set.Sign(jwt.MapClaims{"sub": "a"})
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if err := parse(t, set, tok); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	// A downstream service with only the public key can verify
+	pubDER, _ := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	verifier, err := ParsePEM("ec1", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))
+	if err != nil || verifier.CanSign() {
+		t.Fatalf("parse public key: %+v %v", verifier, err)
+	}
+	if _, err := NewKeySet("ec1", "", verifier); !errors.Is(err, ErrVerifyOnly) {
+		t.Fatalf("want ErrVerifyOnly for a public key, got %v", err)
+	}
+
+	jwks := set.JWKS()
+	if len(jwks.Keys) != 1 {
+		t.Fatalf("want only the public key in JWKS, got %+v", jwks.Keys)
+	}
+	jwk := jwks.Keys[0]
+	if jwk.ID != "ec1" || jwk.KeyType != "EC" || jwk.Curve != "P-256" || len(jwk.X) != 43 || len(jwk.Y) != 43 {
+		t.Fatalf("unexpected JWK: %+v", jwk)
+	}
+}
@@ -4,44 +4,153 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
+	"time"
 
 	"highload-microservice/internal/config"
+	"highload-microservice/internal/metrics"
 	"highload-microservice/internal/models"
+	"highload-microservice/internal/requestid"
 
 	"github.com/segmentio/kafka-go"
 )
 
+// Consumer reads every topic the producer routes events to
 type Consumer struct {
-	reader *kafka.Reader
+	cfg     config.KafkaConfig
+	sec     connSecurity
+	topics  []string
+	mu      sync.RWMutex
+	reader  *kafka.Reader
+	tracker *healthTracker
+	stop    chan struct{}
 }
 
 func NewConsumer(cfg config.KafkaConfig) (*Consumer, error) {
-	reader := kafka.NewReader(kafka.ReaderConfig{
+	sec, err := newConnSecurity(cfg)
+	if err != nil {
+		return nil, err
+	}
+	router, err := NewRouter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	c := &Consumer{
+		cfg:     cfg,
+		sec:     sec,
+		topics:  router.Topics(),
+		tracker: newHealthTracker("consumer", cfg.ReconnectThreshold, time.Duration(cfg.ReconnectMaxBackoff)*time.Second),
+		stop:    make(chan struct{}),
+	}
+	c.reader = newReader(cfg, sec, c.topics)
+
+	go probe(sec, cfg.Brokers, c.topics, time.Duration(cfg.HealthCheckInterval)*time.Second, c.tracker, c.reconnect, c.stop)
+
+	return c, nil
+}
+
+func newReader(cfg config.KafkaConfig, sec connSecurity, topics []string) *kafka.Reader {
+	readerCfg := kafka.ReaderConfig{
 		Brokers:  cfg.Brokers,
 		Topic:    cfg.Topic,
 		GroupID:  cfg.GroupID,
 		MinBytes: 10e3, // 10KB
 		MaxBytes: 10e6, // 10MB
-	})
-
-	return &Consumer{reader: reader}, nil
+		Dialer:   sec.dialer(),
+	}
+	// Several topics can only be read by a consumer group
+	if len(topics) > 1 && cfg.GroupID != "" {
+		readerCfg.Topic = ""
+		readerCfg.GroupTopics = topics
+	}
+	return kafka.NewReader(readerCfg)
 }
 
-func (c *Consumer) ReadMessage(ctx context.Context) (models.KafkaEvent, error) {
+// FetchMessage reads the next event without committing its offset. The
+// returned commit marks it processed; uncommitted events are redelivered
+// after a restart or rebalance. Events that cannot be decoded are committed
+// here so they do not come back.
+func (c *Consumer) FetchMessage(ctx context.Context) (models.KafkaEvent, func(context.Context) error, error) {
 	var event models.KafkaEvent
 
-	message, err := c.reader.ReadMessage(ctx)
+	c.mu.RLock()
+	reader := c.reader
+	c.mu.RUnlock()
+
+	message, err := reader.FetchMessage(ctx)
 	if err != nil {
-		return event, fmt.Errorf("failed to read message: %w", err)
+		// An idle topic ends in a context timeout; only broker errors count
+		if !isContextError(ctx, err) && c.tracker.failure(err, time.Now()) {
+			c.reconnect()
+		}
+		return event, nil, fmt.Errorf("failed to read message: %w", err)
 	}
+	c.tracker.success()
 
-	if err := json.Unmarshal(message.Value, &event); err != nil {
-		return event, fmt.Errorf("failed to unmarshal message: %w", err)
+	// The offset can only be committed through the reader that fetched it
+	commit := func(ctx context.Context) error {
+		if err := reader.CommitMessages(ctx, message); err != nil {
+			return fmt.Errorf("failed to commit message: %w", err)
+		}
+		return nil
 	}
 
-	return event, nil
+	err = json.Unmarshal(message.Value, &event)
+	metrics.KafkaConsumed(message.Topic, err)
+	if err != nil {
+		_ = commit(ctx)
+		return event, nil, fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+
+	// Producers outside this service may only set the header
+	if event.RequestID == "" {
+		for _, header := range message.Headers {
+			if header.Key == requestid.Header {
+				event.RequestID = string(header.Value)
+				break
+			}
+		}
+	}
+
+	return event, commit, nil
+}
+
+// reconnect replaces the reader after persistent failures. The consumer group
+// resumes from the last committed offset.
+func (c *Consumer) reconnect() {
+	c.mu.Lock()
+	select {
+	case <-c.stop:
+		// Closed, nothing to reconnect
+		c.mu.Unlock()
+		return
+	default:
+	}
+	old := c.reader
+	c.reader = newReader(c.cfg, c.sec, c.topics)
+	c.mu.Unlock()
+
+	_ = old.Close()
+}
+
+// Health returns the current connection state
+func (c *Consumer) Health() Health {
+	return c.tracker.health()
+}
+
+// Lag is the number of messages behind the end of the partition last read
+// from, as of the last fetch. Reading the reader stats resets its counters,
+// which nothing else uses.
+func (c *Consumer) Lag() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.reader.Stats().Lag
 }
 
 func (c *Consumer) Close() error {
+	close(c.stop)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.reader.Close()
 }
@@ -0,0 +1,179 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+)
+
+// Connection states reported by Health
+const (
+	StateConnected    = "connected"
+	StateDegraded     = "degraded" // recent failures, below the reconnect threshold
+	StateDisconnected = "disconnected"
+)
+
+const (
+	defaultHealthCheckInterval = 15 * time.Second
+	defaultReconnectThreshold  = 5
+	defaultReconnectBaseDelay  = 1 * time.Second
+	defaultReconnectMaxBackoff = 30 * time.Second
+)
+
+var (
+	connectionUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kafka_connection_up",
+		Help: "Whether the Kafka client can reach the brokers (1) or not (0).",
+	}, []string{"client"})
+	reconnectsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_reconnects_total",
+		Help: "Number of times the Kafka client was recreated after persistent failures.",
+	}, []string{"client"})
+)
+
+func init() {
+	prometheus.MustRegister(connectionUp, reconnectsTotal)
+}
+
+// Health describes the connection state of a producer or consumer
+type Health struct {
+	State               string    `json:"state"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastSuccess         time.Time `json:"last_success,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	Reconnects          int       `json:"reconnects"`
+}
+
+// Healthy reports whether the client is usable
+func (h Health) Healthy() bool {
+	return h.State != StateDisconnected
+}
+
+// healthTracker counts consecutive failures and decides when a client should be
+// recreated, with exponential backoff between reconnect attempts
+type healthTracker struct {
+	mu            sync.Mutex
+	client        string
+	threshold     int
+	baseDelay     time.Duration
+	maxBackoff    time.Duration
+	failures      int
+	lastErr       error
+	lastSuccess   time.Time
+	reconnects    int
+	backoff       time.Duration
+	nextReconnect time.Time
+}
+
+func newHealthTracker(client string, threshold int, maxBackoff time.Duration) *healthTracker {
+	if threshold <= 0 {
+		threshold = defaultReconnectThreshold
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultReconnectMaxBackoff
+	}
+	connectionUp.WithLabelValues(client).Set(1)
+	return &healthTracker{
+		client:     client,
+		threshold:  threshold,
+		baseDelay:  defaultReconnectBaseDelay,
+		maxBackoff: maxBackoff,
+	}
+}
+
+func (t *healthTracker) success() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failures = 0
+	t.lastErr = nil
+	t.lastSuccess = time.Now()
+	t.backoff = 0
+	connectionUp.WithLabelValues(t.client).Set(1)
+}
+
+// failure records an error and reports whether the client should be recreated now
+func (t *healthTracker) failure(err error, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failures++
+	t.lastErr = err
+	if t.failures < t.threshold {
+		return false
+	}
+
+	connectionUp.WithLabelValues(t.client).Set(0)
+	if now.Before(t.nextReconnect) {
+		return false
+	}
+
+	if t.backoff == 0 {
+		t.backoff = t.baseDelay
+	} else if t.backoff *= 2; t.backoff > t.maxBackoff {
+		t.backoff = t.maxBackoff
+	}
+	t.nextReconnect = now.Add(t.backoff)
+	t.reconnects++
+	reconnectsTotal.WithLabelValues(t.client).Inc()
+	return true
+}
+
+func (t *healthTracker) health() Health {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h := Health{
+		State:               StateConnected,
+		LastSuccess:         t.lastSuccess,
+		ConsecutiveFailures: t.failures,
+		Reconnects:          t.reconnects,
+	}
+	if t.lastErr != nil {
+		h.LastError = t.lastErr.Error()
+	}
+	switch {
+	case t.failures >= t.threshold:
+		h.State = StateDisconnected
+	case t.failures > 0:
+		h.State = StateDegraded
+	}
+	return h
+}
+
+// isContextError reports errors caused by the caller's context (e.g. a read
+// timeout with no messages), which say nothing about broker health
+func isContextError(ctx context.Context, err error) bool {
+	return ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// probe periodically fetches the metadata of topics until stop is closed
+func probe(sec connSecurity, brokers []string, topics []string, interval time.Duration, tracker *healthTracker, reconnect func(), stop <-chan struct{}) {
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+	client := sec.client(brokers, interval/2)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval/2)
+			_, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: topics})
+			cancel()
+			if err != nil {
+				if tracker.failure(err, time.Now()) {
+					reconnect()
+				}
+				continue
+			}
+			tracker.success()
+		}
+	}
+}
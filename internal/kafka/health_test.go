@@ -0,0 +1,46 @@
+package kafka
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHealthTracker_ReconnectBackoff(t *testing.T) {
+	tracker := newHealthTracker("test", 2, 4*time.Second)
+	now := time.Now()
+	errBroker := errors.New("broker unreachable")
+
+	if tracker.failure(errBroker, now) {
+		t.Fatalf("should not reconnect below threshold")
+	}
+	if h := tracker.health(); h.State != StateDegraded || !h.Healthy() {
+		t.Fatalf("expected degraded, got %+v", h)
+	}
+
+	if !tracker.failure(errBroker, now) {
+		t.Fatalf("expected reconnect at threshold")
+	}
+	if h := tracker.health(); h.State != StateDisconnected || h.Healthy() || h.Reconnects != 1 {
+		t.Fatalf("expected disconnected, got %+v", h)
+	}
+
+	// Backoff: 1s, then 2s, then capped at 4s
+	if tracker.failure(errBroker, now.Add(500*time.Millisecond)) {
+		t.Fatalf("reconnect attempted during backoff")
+	}
+	if !tracker.failure(errBroker, now.Add(1*time.Second)) {
+		t.Fatalf("expected reconnect after backoff")
+	}
+	if tracker.failure(errBroker, now.Add(2*time.Second)) || !tracker.failure(errBroker, now.Add(3*time.Second)) {
+		t.Fatalf("expected 2s backoff")
+	}
+	if !tracker.failure(errBroker, now.Add(7*time.Second)) || tracker.failure(errBroker, now.Add(10*time.Second)) {
+		t.Fatalf("expected backoff capped at 4s")
+	}
+
+	tracker.success()
+	if h := tracker.health(); h.State != StateConnected || h.LastError != "" {
+		t.Fatalf("expected connected after success, got %+v", h)
+	}
+}
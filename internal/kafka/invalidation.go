@@ -0,0 +1,92 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"highload-microservice/internal/cache"
+	"highload-microservice/internal/config"
+	"highload-microservice/internal/metrics"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// InvalidationBus broadcasts cache invalidations over a Kafka topic. Every
+// instance reads the whole topic without a consumer group, so the topic must
+// have a single partition; reading starts at the end, since invalidations
+// older than the process are of no use.
+type InvalidationBus struct {
+	topic  string
+	writer *kafka.Writer
+	reader *kafka.Reader
+}
+
+func NewInvalidationBus(cfg config.KafkaConfig, topic string) (*InvalidationBus, error) {
+	sec, err := newConnSecurity(cfg)
+	if err != nil {
+		return nil, err
+	}
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Topic:        topic,
+		BatchSize:    1,
+		BatchTimeout: 10 * time.Millisecond,
+		RequiredAcks: kafka.RequireOne,
+	}
+	if transport := sec.transport(); transport != nil {
+		writer.Transport = transport
+	}
+	return &InvalidationBus{
+		topic:  topic,
+		writer: writer,
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     cfg.Brokers,
+			Topic:       topic,
+			Partition:   0,
+			StartOffset: kafka.LastOffset,
+			MaxWait:     time.Second,
+			Dialer:      sec.dialer(),
+		}),
+	}, nil
+}
+
+func (b *InvalidationBus) Publish(ctx context.Context, inv cache.Invalidation) error {
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return fmt.Errorf("failed to marshal invalidation: %w", err)
+	}
+	err = b.writer.WriteMessages(ctx, kafka.Message{Value: data, Time: time.Now()})
+	metrics.KafkaProduced(b.topic, err)
+	if err != nil {
+		return fmt.Errorf("failed to write invalidation: %w", err)
+	}
+	return nil
+}
+
+// Receive returns the next invalidation. Messages that cannot be decoded are
+// skipped.
+func (b *InvalidationBus) Receive(ctx context.Context) (cache.Invalidation, error) {
+	for {
+		message, err := b.reader.ReadMessage(ctx)
+		if err != nil {
+			return cache.Invalidation{}, fmt.Errorf("failed to read invalidation: %w", err)
+		}
+		var inv cache.Invalidation
+		err = json.Unmarshal(message.Value, &inv)
+		metrics.KafkaConsumed(message.Topic, err)
+		if err == nil {
+			return inv, nil
+		}
+	}
+}
+
+func (b *InvalidationBus) Close() error {
+	werr := b.writer.Close()
+	rerr := b.reader.Close()
+	if werr != nil {
+		return werr
+	}
+	return rerr
+}
@@ -4,51 +4,148 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"highload-microservice/internal/config"
+	"highload-microservice/internal/metrics"
 	"highload-microservice/internal/models"
+	"highload-microservice/internal/requestid"
 
 	"github.com/segmentio/kafka-go"
 )
 
+// Producer writes events to the topic their type is routed to. One writer
+// serves every topic: it batches per topic and partition and shares the
+// broker connections.
 type Producer struct {
-	writer *kafka.Writer
+	cfg     config.KafkaConfig
+	sec     connSecurity
+	router  *Router
+	mu      sync.RWMutex
+	writer  *kafka.Writer
+	tracker *healthTracker
+	stop    chan struct{}
 }
 
 func NewProducer(cfg config.KafkaConfig) (*Producer, error) {
+	sec, err := newConnSecurity(cfg)
+	if err != nil {
+		return nil, err
+	}
+	router, err := NewRouter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	p := &Producer{
+		cfg:     cfg,
+		sec:     sec,
+		router:  router,
+		writer:  newWriter(cfg, sec),
+		tracker: newHealthTracker("producer", cfg.ReconnectThreshold, time.Duration(cfg.ReconnectMaxBackoff)*time.Second),
+		stop:    make(chan struct{}),
+	}
+
+	go probe(sec, cfg.Brokers, router.Topics(), time.Duration(cfg.HealthCheckInterval)*time.Second, p.tracker, p.reconnect, p.stop)
+
+	return p, nil
+}
+
+func newWriter(cfg config.KafkaConfig, sec connSecurity) *kafka.Writer {
 	writer := &kafka.Writer{
 		Addr:         kafka.TCP(cfg.Brokers...),
-		Topic:        cfg.Topic,
 		Balancer:     &kafka.LeastBytes{},
 		BatchSize:    1,
 		BatchTimeout: 10 * time.Millisecond,
 		RequiredAcks: kafka.RequireOne,
 		Compression:  kafka.Snappy,
 	}
-
-	return &Producer{writer: writer}, nil
+	if transport := sec.transport(); transport != nil {
+		writer.Transport = transport
+	}
+	return writer
 }
 
 func (p *Producer) SendEvent(ctx context.Context, event models.KafkaEvent) error {
+	return p.SendEventTo(ctx, p.router.Topic(event.Type), event)
+}
+
+// SendEventTo writes event to topic instead of the topic its type is routed to
+func (p *Producer) SendEventTo(ctx context.Context, topic string, event models.KafkaEvent) error {
 	data, err := json.Marshal(event)
 	if err != nil {
 		return fmt.Errorf("failed to marshal event: %w", err)
 	}
 
 	message := kafka.Message{
-		Key:   []byte(event.UserID.String()),
+		Topic: topic,
+		Key:   p.router.Key(event),
 		Value: data,
 		Time:  time.Now(),
 	}
+	if event.RequestID != "" {
+		message.Headers = append(message.Headers, kafka.Header{Key: requestid.Header, Value: []byte(event.RequestID)})
+	}
+
+	p.mu.RLock()
+	writer := p.writer
+	p.mu.RUnlock()
 
-	if err := p.writer.WriteMessages(ctx, message); err != nil {
+	err = writer.WriteMessages(ctx, message)
+	metrics.KafkaProduced(topic, err)
+	if err != nil {
+		if !isContextError(ctx, err) && p.tracker.failure(err, time.Now()) {
+			p.reconnect()
+		}
 		return fmt.Errorf("failed to write message: %w", err)
 	}
+	p.tracker.success()
+
+	return nil
+}
+
+// reconnect replaces the writer after persistent failures
+func (p *Producer) reconnect() {
+	p.mu.Lock()
+	select {
+	case <-p.stop:
+		// Closed, nothing to reconnect
+		p.mu.Unlock()
+		return
+	default:
+	}
+	old := p.writer
+	p.writer = newWriter(p.cfg, p.sec)
+	p.mu.Unlock()
+
+	_ = old.Close()
+}
 
+// Ping fetches the metadata of every routed topic from the brokers. Unlike Health, which
+// reflects the last writes and background probes, it checks the connection now.
+func (p *Producer) Ping(ctx context.Context) error {
+	client := p.sec.client(p.cfg.Brokers, 0)
+	resp, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: p.router.Topics()})
+	if err != nil {
+		return fmt.Errorf("failed to fetch metadata: %w", err)
+	}
+	for _, topic := range resp.Topics {
+		if topic.Error != nil {
+			return fmt.Errorf("topic %s: %w", topic.Name, topic.Error)
+		}
+	}
 	return nil
 }
 
+// Health returns the current connection state
+func (p *Producer) Health() Health {
+	return p.tracker.health()
+}
+
 func (p *Producer) Close() error {
+	close(p.stop)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	return p.writer.Close()
 }
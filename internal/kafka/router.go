@@ -0,0 +1,106 @@
+package kafka
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"highload-microservice/internal/config"
+	"highload-microservice/internal/models"
+)
+
+// Partition key strategies for KAFKA_PARTITION_KEY
+const (
+	PartitionByUserID  = "user_id"  // events of a user stay in order
+	PartitionByEventID = "event_id" // spreads a busy user over partitions
+)
+
+// Router picks the topic and partition key of an event. Types without a
+// route go to the default topic (KAFKA_TOPIC).
+type Router struct {
+	defaultTopic string
+	routes       map[string]string // exact event type -> topic
+	prefixes     []prefixRoute     // longest prefix first
+	keyByEventID bool
+}
+
+// prefixRoute routes every type starting with prefix ("user_*")
+type prefixRoute struct {
+	prefix string
+	topic  string
+}
+
+// NewRouter parses KAFKA_TOPIC_ROUTES entries of the form TYPE=TOPIC, where
+// TYPE may end in * to match a prefix
+func NewRouter(cfg config.KafkaConfig) (*Router, error) {
+	r := &Router{defaultTopic: cfg.Topic, routes: make(map[string]string)}
+
+	switch cfg.PartitionKey {
+	case "", PartitionByUserID:
+	case PartitionByEventID:
+		r.keyByEventID = true
+	default:
+		return nil, fmt.Errorf("unsupported partition key: %s", cfg.PartitionKey)
+	}
+
+	for _, entry := range cfg.TopicRoutes {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		eventType, topic, ok := strings.Cut(entry, "=")
+		eventType, topic = strings.TrimSpace(eventType), strings.TrimSpace(topic)
+		if !ok || eventType == "" || topic == "" {
+			return nil, fmt.Errorf("invalid topic route %q, expected TYPE=TOPIC", entry)
+		}
+		if prefix, found := strings.CutSuffix(eventType, "*"); found {
+			r.prefixes = append(r.prefixes, prefixRoute{prefix: prefix, topic: topic})
+			continue
+		}
+		r.routes[eventType] = topic
+	}
+	sort.SliceStable(r.prefixes, func(i, j int) bool {
+		return len(r.prefixes[i].prefix) > len(r.prefixes[j].prefix)
+	})
+
+	return r, nil
+}
+
+// Topic returns the topic for events of eventType
+func (r *Router) Topic(eventType string) string {
+	if topic, ok := r.routes[eventType]; ok {
+		return topic
+	}
+	for _, route := range r.prefixes {
+		if strings.HasPrefix(eventType, route.prefix) {
+			return route.topic
+		}
+	}
+	return r.defaultTopic
+}
+
+// Key returns the partition key of event
+func (r *Router) Key(event models.KafkaEvent) []byte {
+	if r.keyByEventID {
+		return []byte(event.ID.String())
+	}
+	return []byte(event.UserID.String())
+}
+
+// Topics returns every topic events may be written to, sorted
+func (r *Router) Topics() []string {
+	seen := map[string]bool{r.defaultTopic: true}
+	for _, topic := range r.routes {
+		seen[topic] = true
+	}
+	for _, route := range r.prefixes {
+		seen[route.topic] = true
+	}
+
+	topics := make([]string, 0, len(seen))
+	for topic := range seen {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
@@ -0,0 +1,70 @@
+package kafka
+
+import (
+	"reflect"
+	"testing"
+
+	"highload-microservice/internal/config"
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestRouter_Topic(t *testing.T) {
+	r, err := NewRouter(config.KafkaConfig{
+		Topic:       "events",
+		TopicRoutes: []string{"user_*=user-lifecycle", "user_role_*=user-security", "order_paid = payments"},
+	})
+	if err != nil {
+		t.Fatalf("new router: %v", err)
+	}
+
+	tests := map[string]string{
+		"user_created":      "user-lifecycle",
+		"user_role_changed": "user-security", // longest prefix wins
+		"order_paid":        "payments",
+		"order_created":     "events",
+	}
+	for eventType, want := range tests {
+		if got := r.Topic(eventType); got != want {
+			t.Fatalf("%s: expected %s, got %s", eventType, want, got)
+		}
+	}
+
+	want := []string{"events", "payments", "user-lifecycle", "user-security"}
+	if got := r.Topics(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("topics: expected %v, got %v", want, got)
+	}
+}
+
+func TestRouter_Key(t *testing.T) {
+	event := models.KafkaEvent{ID: uuid.New(), UserID: uuid.New()}
+
+	byUser, err := NewRouter(config.KafkaConfig{Topic: "events"})
+	if err != nil {
+		t.Fatalf("new router: %v", err)
+	}
+	if got := string(byUser.Key(event)); got != event.UserID.String() {
+		t.Fatalf("expected user id key, got %s", got)
+	}
+
+	byEvent, err := NewRouter(config.KafkaConfig{Topic: "events", PartitionKey: PartitionByEventID})
+	if err != nil {
+		t.Fatalf("new router: %v", err)
+	}
+	if got := string(byEvent.Key(event)); got != event.ID.String() {
+		t.Fatalf("expected event id key, got %s", got)
+	}
+}
+
+func TestNewRouter_Invalid(t *testing.T) {
+	for _, cfg := range []config.KafkaConfig{
+		{Topic: "events", TopicRoutes: []string{"user_created"}},
+		{Topic: "events", TopicRoutes: []string{"=topic"}},
+		{Topic: "events", PartitionKey: "random"},
+	} {
+		if _, err := NewRouter(cfg); err == nil {
+			t.Fatalf("expected %+v to be rejected", cfg)
+		}
+	}
+}
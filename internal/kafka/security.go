@@ -0,0 +1,144 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"highload-microservice/internal/config"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// Supported values for KAFKA_SASL_MECHANISM
+const (
+	SASLPlain       = "PLAIN"
+	SASLScramSHA256 = "SCRAM-SHA-256"
+	SASLScramSHA512 = "SCRAM-SHA-512"
+)
+
+// connSecurity is the TLS and SASL setup shared by all connections to the
+// brokers. The zero value connects in plain text without authentication.
+type connSecurity struct {
+	tls  *tls.Config
+	sasl sasl.Mechanism
+}
+
+func newConnSecurity(cfg config.KafkaConfig) (connSecurity, error) {
+	var sec connSecurity
+
+	if cfg.TLSEnabled {
+		tlsConfig, err := newTLSConfig(cfg)
+		if err != nil {
+			return sec, err
+		}
+		sec.tls = tlsConfig
+	}
+
+	switch strings.ToUpper(cfg.SASLMechanism) {
+	case "":
+	case SASLPlain:
+		sec.sasl = plain.Mechanism{Username: cfg.SASLUsername, Password: cfg.SASLPassword}
+	case SASLScramSHA256, SASLScramSHA512:
+		algorithm := scram.SHA256
+		if strings.ToUpper(cfg.SASLMechanism) == SASLScramSHA512 {
+			algorithm = scram.SHA512
+		}
+		mechanism, err := scram.Mechanism(algorithm, cfg.SASLUsername, cfg.SASLPassword)
+		if err != nil {
+			return sec, fmt.Errorf("failed to set up SASL %s: %w", cfg.SASLMechanism, err)
+		}
+		sec.sasl = mechanism
+	default:
+		return sec, fmt.Errorf("unsupported SASL mechanism: %s", cfg.SASLMechanism)
+	}
+
+	return sec, nil
+}
+
+// transport returns the transport for writers and clients, or nil for the
+// kafka-go default when no security is configured
+func (s connSecurity) transport() *kafka.Transport {
+	if s.tls == nil && s.sasl == nil {
+		return nil
+	}
+	return &kafka.Transport{TLS: s.tls, SASL: s.sasl}
+}
+
+// dialer returns the dialer for readers, or nil for the kafka-go default
+func (s connSecurity) dialer() *kafka.Dialer {
+	if s.tls == nil && s.sasl == nil {
+		return nil
+	}
+	return &kafka.Dialer{
+		Timeout:       10 * time.Second,
+		DualStack:     true,
+		TLS:           s.tls,
+		SASLMechanism: s.sasl,
+	}
+}
+
+// client returns a client for admin requests such as metadata probes
+func (s connSecurity) client(brokers []string, timeout time.Duration) *kafka.Client {
+	client := &kafka.Client{Addr: kafka.TCP(brokers...), Timeout: timeout}
+	if transport := s.transport(); transport != nil {
+		client.Transport = transport
+	}
+	return client
+}
+
+// newTLSConfig builds the TLS settings. Certificates come from files or, for
+// secrets injected as environment variables, from PEM values.
+func newTLSConfig(cfg config.KafkaConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: cfg.TLSServerName,
+	}
+
+	caPEM, err := pemValue(cfg.TLSCA, cfg.TLSCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Kafka CA: %w", err)
+	}
+	if caPEM != nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in Kafka CA")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	certPEM, err := pemValue(cfg.TLSCert, cfg.TLSCertFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Kafka client certificate: %w", err)
+	}
+	keyPEM, err := pemValue(cfg.TLSKey, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Kafka client key: %w", err)
+	}
+	if certPEM != nil || keyPEM != nil {
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Kafka client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// pemValue returns value if set, else the contents of file, else nil
+func pemValue(value, file string) ([]byte, error) {
+	if value != "" {
+		return []byte(value), nil
+	}
+	if file == "" {
+		return nil, nil
+	}
+	return os.ReadFile(file) // #nosec G304 -- path comes from configuration
+}
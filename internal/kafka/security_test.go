@@ -0,0 +1,97 @@
+package kafka
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/config"
+)
+
+func TestNewConnSecurity_Mechanisms(t *testing.T) {
+	for _, mechanism := range []string{SASLPlain, SASLScramSHA256, "scram-sha-512"} {
+		sec, err := newConnSecurity(config.KafkaConfig{SASLMechanism: mechanism, SASLUsername: "u", SASLPassword: "p"})
+		if err != nil {
+			t.Fatalf("%s: %v", mechanism, err)
+		}
+		if sec.sasl == nil || sec.transport() == nil || sec.dialer() == nil {
+			t.Fatalf("%s: expected SASL to be configured", mechanism)
+		}
+	}
+
+	if _, err := newConnSecurity(config.KafkaConfig{SASLMechanism: "GSSAPI"}); err == nil {
+		t.Fatalf("expected unsupported mechanism to fail")
+	}
+}
+
+func TestNewConnSecurity_PlainTextByDefault(t *testing.T) {
+	sec, err := newConnSecurity(config.KafkaConfig{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sec.transport() != nil || sec.dialer() != nil {
+		t.Fatalf("expected kafka-go defaults without TLS or SASL")
+	}
+}
+
+func TestNewConnSecurity_TLSFromPEM(t *testing.T) {
+	certPEM, keyPEM := selfSigned(t)
+
+	sec, err := newConnSecurity(config.KafkaConfig{
+		TLSEnabled:    true,
+		TLSCA:         string(certPEM),
+		TLSCert:       string(certPEM),
+		TLSKey:        string(keyPEM),
+		TLSServerName: "broker.internal",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sec.tls == nil || sec.tls.RootCAs == nil || len(sec.tls.Certificates) != 1 {
+		t.Fatalf("expected CA and client certificate to be loaded")
+	}
+	if sec.tls.ServerName != "broker.internal" {
+		t.Fatalf("unexpected server name: %s", sec.tls.ServerName)
+	}
+
+	if _, err := newConnSecurity(config.KafkaConfig{TLSEnabled: true, TLSCA: "not a certificate"}); err == nil {
+		t.Fatalf("expected invalid CA to fail")
+	}
+	if _, err := newConnSecurity(config.KafkaConfig{TLSEnabled: true, TLSCAFile: "/nonexistent/ca.pem"}); err == nil {
+		t.Fatalf("expected missing CA file to fail")
+	}
+}
+
+// selfSigned returns a PEM certificate and key usable as both CA and client
+// certificate
+func selfSigned(t *testing.T) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
@@ -0,0 +1,24 @@
+package mail
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	message := string(Format("no-reply@example.com", Message{
+		To:      []string{"a@example.com"},
+		Subject: "Verify\r\nBcc: victim@example.com",
+		Body:    "line one\nline two",
+	}))
+	for _, want := range []string{
+		"From: no-reply@example.com\r\n",
+		"To: a@example.com\r\n",
+		"Subject: Verify  Bcc: victim@example.com\r\n",
+		"\r\n\r\nline one\r\nline two",
+	} {
+		if !strings.Contains(message, want) {
+			t.Errorf("missing %q in %q", want, message)
+		}
+	}
+}
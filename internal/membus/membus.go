@@ -0,0 +1,103 @@
+// Package membus passes events from the producer to the consumer of the same
+// process through a buffered channel (MESSAGING_BACKEND=memory, the DEV_MODE
+// default). Events are neither shared between instances nor kept across
+// restarts, and an event fetched but not committed is not delivered again.
+package membus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"highload-microservice/internal/models"
+)
+
+// Capacity is how many events the default bus buffers before SendEvent blocks
+const Capacity = 1024
+
+var (
+	defaultBus  *Bus
+	defaultOnce sync.Once
+)
+
+// Default returns the bus shared by the producer and the consumer of the
+// process
+func Default() *Bus {
+	defaultOnce.Do(func() { defaultBus = New(Capacity) })
+	return defaultBus
+}
+
+// Bus is a queue of encoded events. Events are marshalled like on a real
+// broker, so producer and consumer never share memory.
+type Bus struct {
+	events chan []byte
+}
+
+// New returns a bus buffering up to capacity events
+func New(capacity int) *Bus {
+	return &Bus{events: make(chan []byte, capacity)}
+}
+
+// Len returns the number of events waiting for the consumer
+func (b *Bus) Len() int {
+	return len(b.events)
+}
+
+// Producer publishes events to a bus
+type Producer struct {
+	bus *Bus
+}
+
+func NewProducer(bus *Bus) *Producer {
+	return &Producer{bus: bus}
+}
+
+// SendEvent waits for room on the bus while it is full
+func (p *Producer) SendEvent(ctx context.Context, event models.KafkaEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	select {
+	case p.bus.events <- data:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to publish event: %w", ctx.Err())
+	}
+}
+
+// Close leaves the bus open; it lives as long as the process
+func (p *Producer) Close() error {
+	return nil
+}
+
+// Consumer reads events from a bus. Events are removed from the bus when
+// fetched, so their commit has nothing to do.
+type Consumer struct {
+	bus *Bus
+}
+
+func NewConsumer(bus *Bus) *Consumer {
+	return &Consumer{bus: bus}
+}
+
+func (c *Consumer) FetchMessage(ctx context.Context) (models.KafkaEvent, func(context.Context) error, error) {
+	for {
+		select {
+		case data := <-c.bus.events:
+			var event models.KafkaEvent
+			if err := json.Unmarshal(data, &event); err != nil {
+				// Cannot happen for events marshalled by SendEvent
+				continue
+			}
+			return event, func(context.Context) error { return nil }, nil
+		case <-ctx.Done():
+			return models.KafkaEvent{}, nil, ctx.Err()
+		}
+	}
+}
+
+func (c *Consumer) Close() error {
+	return nil
+}
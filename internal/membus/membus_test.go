@@ -0,0 +1,62 @@
+package membus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestBus_DeliversInOrder(t *testing.T) {
+	bus := New(4)
+	producer, consumer := NewProducer(bus), NewConsumer(bus)
+	ctx := context.Background()
+
+	first := models.KafkaEvent{ID: uuid.New(), UserID: uuid.New(), Type: "user_created", Data: "{}", RequestID: "req-1"}
+	second := models.KafkaEvent{ID: uuid.New(), UserID: first.UserID, Type: "user_updated", Data: "{}"}
+	for _, event := range []models.KafkaEvent{first, second} {
+		if err := producer.SendEvent(ctx, event); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+
+	for _, want := range []models.KafkaEvent{first, second} {
+		got, commit, err := consumer.FetchMessage(ctx)
+		if err != nil {
+			t.Fatalf("fetch: %v", err)
+		}
+		if got.ID != want.ID || got.Type != want.Type || got.RequestID != want.RequestID {
+			t.Fatalf("got %+v, want %+v", got, want)
+		}
+		if err := commit(ctx); err != nil {
+			t.Fatalf("commit: %v", err)
+		}
+	}
+	if bus.Len() != 0 {
+		t.Fatalf("%d events left on the bus", bus.Len())
+	}
+}
+
+func TestBus_FullAndEmpty(t *testing.T) {
+	bus := New(1)
+	producer, consumer := NewProducer(bus), NewConsumer(bus)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := producer.SendEvent(ctx, models.KafkaEvent{ID: uuid.New()}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if err := producer.SendEvent(ctx, models.KafkaEvent{ID: uuid.New()}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("send on a full bus: want deadline exceeded, got %v", err)
+	}
+	if _, _, err := consumer.FetchMessage(context.Background()); err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if _, _, err := consumer.FetchMessage(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("fetch on an empty bus: want deadline exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"highload-microservice/internal/kafka"
+	"highload-microservice/internal/metrics"
+	"highload-microservice/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrBufferFull is returned by AsyncProducer.SendEvent when the buffer has no
+// room; the event is dropped
+var ErrBufferFull = errors.New("producer buffer full")
+
+// ErrProducerClosed is returned by AsyncProducer.SendEvent after Close
+var ErrProducerClosed = errors.New("producer closed")
+
+// AsyncConfig sizes the buffer of an AsyncProducer
+type AsyncConfig struct {
+	BufferSize   int           // events buffered across all workers
+	Workers      int           // concurrent senders; events of one user always use the same one
+	SendTimeout  time.Duration // per broker write
+	FlushTimeout time.Duration // how long Close waits for buffered events
+}
+
+// AsyncStats is reported on /health/ready
+type AsyncStats struct {
+	Buffered int   `json:"buffered"`
+	Capacity int   `json:"capacity"`
+	Dropped  int64 `json:"dropped"`
+}
+
+// AsyncProducer buffers events in memory and writes them to the wrapped
+// producer in the background, so request latency does not depend on the
+// broker. Events are sent in order per user. The buffer is bounded: when it
+// is full, or the broker write fails, the event is dropped and counted in
+// producer_buffer_dropped_total. Use the outbox when events must not be lost.
+type AsyncProducer struct {
+	producer Producer
+	cfg      AsyncConfig
+	logger   *logrus.Logger
+
+	mu      sync.RWMutex // guards closed against sends racing Close
+	closed  bool
+	queues  []chan models.KafkaEvent
+	wg      sync.WaitGroup
+	stop    chan struct{}
+	dropped atomic.Int64
+}
+
+func NewAsyncProducer(producer Producer, cfg AsyncConfig, logger *logrus.Logger) *AsyncProducer {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.BufferSize < cfg.Workers {
+		cfg.BufferSize = cfg.Workers
+	}
+	if cfg.SendTimeout <= 0 {
+		cfg.SendTimeout = 10 * time.Second
+	}
+	if cfg.FlushTimeout <= 0 {
+		cfg.FlushTimeout = 10 * time.Second
+	}
+
+	p := &AsyncProducer{
+		producer: producer,
+		cfg:      cfg,
+		logger:   logger,
+		queues:   make([]chan models.KafkaEvent, cfg.Workers),
+		stop:     make(chan struct{}),
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan models.KafkaEvent, cfg.BufferSize/cfg.Workers)
+		p.wg.Add(1)
+		go p.worker(p.queues[i])
+	}
+	return p
+}
+
+// SendEvent queues the event without waiting for the broker
+func (p *AsyncProducer) SendEvent(ctx context.Context, event models.KafkaEvent) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrProducerClosed
+	}
+
+	select {
+	case p.queues[p.shard(event)] <- event:
+		metrics.AddProducerBufferDepth(1)
+		return nil
+	default:
+		p.drop(metrics.ProducerDropOverflow)
+		return ErrBufferFull
+	}
+}
+
+// shard keeps the events of one user on one worker so they stay ordered
+func (p *AsyncProducer) shard(event models.KafkaEvent) int {
+	h := fnv.New32a()
+	_, _ = h.Write(event.UserID[:])
+	return int(h.Sum32() % uint32(len(p.queues))) // #nosec G115 -- len(queues) is a small positive int
+}
+
+func (p *AsyncProducer) worker(queue <-chan models.KafkaEvent) {
+	defer p.wg.Done()
+	for event := range queue {
+		metrics.AddProducerBufferDepth(-1)
+
+		select {
+		case <-p.stop:
+			// Flush timed out; count what is left instead of sending it
+			p.drop(metrics.ProducerDropShutdown)
+			continue
+		default:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), p.cfg.SendTimeout)
+		err := p.producer.SendEvent(ctx, event)
+		cancel()
+		if err != nil {
+			p.drop(metrics.ProducerDropSendFailed)
+			p.logger.Errorf("Failed to send buffered event %s (%s): %v", event.ID, event.Type, err)
+		}
+	}
+}
+
+func (p *AsyncProducer) drop(reason string) {
+	p.dropped.Add(1)
+	metrics.ProducerEventDropped(reason)
+}
+
+// Stats returns the current buffer usage
+func (p *AsyncProducer) Stats() AsyncStats {
+	buffered := 0
+	for _, queue := range p.queues {
+		buffered += len(queue)
+	}
+	return AsyncStats{
+		Buffered: buffered,
+		Capacity: cap(p.queues[0]) * len(p.queues),
+		Dropped:  p.dropped.Load(),
+	}
+}
+
+// Health reports the state of the wrapped producer
+func (p *AsyncProducer) Health() kafka.Health {
+	if reporter, ok := p.producer.(HealthReporter); ok {
+		return reporter.Health()
+	}
+	return kafka.Health{State: kafka.StateConnected}
+}
+
+// Ping checks the wrapped producer's broker connection
+func (p *AsyncProducer) Ping(ctx context.Context) error {
+	if pinger, ok := p.producer.(Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// Close stops accepting events and sends the buffered ones, waiting at most
+// FlushTimeout. It does not close the wrapped producer.
+func (p *AsyncProducer) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(p.cfg.FlushTimeout):
+		p.logger.Warnf("Producer buffer flush timed out after %v; dropping remaining events", p.cfg.FlushTimeout)
+		close(p.stop)
+		<-done
+	}
+	if dropped := p.dropped.Load(); dropped > 0 {
+		p.logger.Warnf("Async producer dropped %d events in total", dropped)
+	}
+	return nil
+}
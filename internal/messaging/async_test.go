@@ -0,0 +1,120 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// recordingProducer records sent events; while block is open it waits for it
+type recordingProducer struct {
+	mu    sync.Mutex
+	sent  []models.KafkaEvent
+	block chan struct{}
+}
+
+func (p *recordingProducer) SendEvent(ctx context.Context, event models.KafkaEvent) error {
+	if p.block != nil {
+		<-p.block
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sent = append(p.sent, event)
+	return nil
+}
+
+func (p *recordingProducer) Close() error { return nil }
+
+func (p *recordingProducer) events() []models.KafkaEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]models.KafkaEvent(nil), p.sent...)
+}
+
+func TestAsyncProducer_KeepsPerUserOrderAndFlushesOnClose(t *testing.T) {
+	inner := &recordingProducer{}
+	p := NewAsyncProducer(inner, AsyncConfig{BufferSize: 100, Workers: 4}, quietLogger())
+
+	users := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	for i := 0; i < 30; i++ {
+		event := models.KafkaEvent{ID: uuid.New(), UserID: users[i%len(users)], Version: i}
+		if err := p.SendEvent(context.Background(), event); err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	sent := inner.events()
+	if len(sent) != 30 {
+		t.Fatalf("sent %d events, want 30", len(sent))
+	}
+	last := map[uuid.UUID]int{}
+	for _, event := range sent {
+		if prev, ok := last[event.UserID]; ok && event.Version < prev {
+			t.Fatalf("events of user %s out of order: %d after %d", event.UserID, event.Version, prev)
+		}
+		last[event.UserID] = event.Version
+	}
+
+	if err := p.SendEvent(context.Background(), models.KafkaEvent{}); !errors.Is(err, ErrProducerClosed) {
+		t.Fatalf("expected ErrProducerClosed, got %v", err)
+	}
+}
+
+func TestAsyncProducer_DropsWhenFull(t *testing.T) {
+	inner := &recordingProducer{block: make(chan struct{})}
+	p := NewAsyncProducer(inner, AsyncConfig{BufferSize: 2, Workers: 1}, quietLogger())
+	user := uuid.New()
+
+	// One event is taken by the blocked worker, two fill the buffer
+	if err := p.SendEvent(context.Background(), models.KafkaEvent{UserID: user}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	waitFor(t, func() bool { return p.Stats().Buffered == 0 })
+	for i := 0; i < 2; i++ {
+		if err := p.SendEvent(context.Background(), models.KafkaEvent{UserID: user}); err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+	}
+
+	if err := p.SendEvent(context.Background(), models.KafkaEvent{UserID: user}); !errors.Is(err, ErrBufferFull) {
+		t.Fatalf("expected ErrBufferFull, got %v", err)
+	}
+	if stats := p.Stats(); stats.Dropped != 1 || stats.Buffered != 2 || stats.Capacity != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	close(inner.block)
+	_ = p.Close()
+	if n := len(inner.events()); n != 3 {
+		t.Fatalf("sent %d events, want 3", n)
+	}
+}
+
+func TestAsyncProducer_FlushTimeout(t *testing.T) {
+	block := make(chan struct{})
+	inner := &recordingProducer{block: block}
+	p := NewAsyncProducer(inner, AsyncConfig{BufferSize: 10, Workers: 1, FlushTimeout: 20 * time.Millisecond}, quietLogger())
+	for i := 0; i < 5; i++ {
+		_ = p.SendEvent(context.Background(), models.KafkaEvent{})
+	}
+
+	// Unblock the in-flight write only after the flush gave up
+	time.AfterFunc(50*time.Millisecond, func() { close(block) })
+	_ = p.Close()
+
+	if n := len(inner.events()); n != 1 {
+		t.Fatalf("sent %d events, want only the in-flight one", n)
+	}
+	if stats := p.Stats(); stats.Dropped != 4 {
+		t.Fatalf("dropped %d, want 4", stats.Dropped)
+	}
+}
@@ -0,0 +1,26 @@
+package messaging
+
+import (
+	"context"
+
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/resilience"
+)
+
+// WithBreaker guards SendEvent of p with breaker. While the broker is down
+// sends fail at once with resilience.ErrOpen; the outbox relay and the async
+// producer retry or count them like any other failed send.
+func WithBreaker(p Producer, breaker *resilience.Breaker) Producer {
+	return &guardedProducer{Producer: p, breaker: breaker}
+}
+
+type guardedProducer struct {
+	Producer
+	breaker *resilience.Breaker
+}
+
+func (g *guardedProducer) SendEvent(ctx context.Context, event models.KafkaEvent) error {
+	return g.breaker.Execute(ctx, func(ctx context.Context) error {
+		return g.Producer.SendEvent(ctx, event)
+	})
+}
@@ -0,0 +1,189 @@
+package messaging
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"highload-microservice/internal/cache"
+	"highload-microservice/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// Supported values for CONSUMER_DEDUP_BACKEND
+const (
+	DedupCache    = "cache"
+	DedupDatabase = "database"
+	DedupNone     = "none"
+)
+
+// ClaimState is the outcome of Deduplicator.Claim
+type ClaimState int
+
+const (
+	// Claimed: the event was not processed yet and this consumer holds it
+	// until Done, Release or the lease expires
+	Claimed ClaimState = iota
+	// Processed: the event was processed before and must be skipped
+	Processed
+	// InFlight: another consumer holds the event; it is claimed again later
+	InFlight
+)
+
+// Deduplicator remembers processed event IDs so that redelivered events
+// (after a restart, a rebalance or a failed commit) are not processed twice
+type Deduplicator interface {
+	Claim(ctx context.Context, id uuid.UUID) (ClaimState, error)
+	// Done marks a claimed event processed
+	Done(ctx context.Context, id uuid.UUID) error
+	// Release gives up a claim on an event that was not processed
+	Release(ctx context.Context, id uuid.UUID) error
+}
+
+// counterStore is the part of cache.Cache CacheDeduplicator uses
+type counterStore interface {
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+	Del(ctx context.Context, keys ...string) error
+	Incr(ctx context.Context, key string, expiration time.Duration) (int64, error)
+}
+
+// CacheDeduplicator keeps processed event IDs in the cache. A claim is an
+// atomic increment, so of the consumers racing for an event exactly one gets
+// it.
+type CacheDeduplicator struct {
+	store counterStore
+	lease time.Duration
+	ttl   time.Duration
+}
+
+// NewCacheDeduplicator keeps claims for lease and processed IDs for ttl
+func NewCacheDeduplicator(store counterStore, lease, ttl time.Duration) *CacheDeduplicator {
+	return &CacheDeduplicator{store: store, lease: lease, ttl: ttl}
+}
+
+func processedKey(id uuid.UUID) string { return "consumed:" + id.String() }
+func claimKey(id uuid.UUID) string     { return "consumed:" + id.String() + ":claim" }
+
+func (d *CacheDeduplicator) Claim(ctx context.Context, id uuid.UUID) (ClaimState, error) {
+	_, err := d.store.Get(ctx, processedKey(id))
+	if err == nil {
+		return Processed, nil
+	}
+	if !errors.Is(err, cache.ErrMiss) {
+		return 0, err
+	}
+	n, err := d.store.Incr(ctx, claimKey(id), d.lease)
+	if err != nil {
+		return 0, err
+	}
+	if n == 1 {
+		return Claimed, nil
+	}
+	return InFlight, nil
+}
+
+// Done leaves the claim to expire, so a consumer that missed the processed
+// key sees the event in flight and checks again
+func (d *CacheDeduplicator) Done(ctx context.Context, id uuid.UUID) error {
+	return d.store.Set(ctx, processedKey(id), "1", d.ttl)
+}
+
+func (d *CacheDeduplicator) Release(ctx context.Context, id uuid.UUID) error {
+	return d.store.Del(ctx, claimKey(id))
+}
+
+// SQLDeduplicator keeps processed event IDs in the processed_events table,
+// which survives cache flushes and restarts of an in-memory cache
+type SQLDeduplicator struct {
+	db     *sql.DB
+	insert string
+	lease  time.Duration
+	ttl    time.Duration
+}
+
+// NewSQLDeduplicator keeps claims for lease and processed IDs for ttl;
+// DeleteExpired removes them afterwards
+func NewSQLDeduplicator(db *sql.DB, dialect database.Dialect, lease, ttl time.Duration) *SQLDeduplicator {
+	return &SQLDeduplicator{
+		db: db,
+		insert: dialect.Upsert("processed_events",
+			[]string{"event_id", "claimed_until", "expires_at"},
+			[]string{"event_id"},
+			nil),
+		lease: lease,
+		ttl:   ttl,
+	}
+}
+
+// Claim inserts the event, or takes over a lease that expired with the
+// event unprocessed
+func (d *SQLDeduplicator) Claim(ctx context.Context, id uuid.UUID) (ClaimState, error) {
+	now := time.Now().UTC()
+	claimedUntil, expiresAt := now.Add(d.lease), now.Add(d.ttl)
+
+	result, err := d.db.ExecContext(ctx, d.insert, id, claimedUntil, expiresAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim event: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 1 {
+		return Claimed, nil
+	}
+
+	result, err = d.db.ExecContext(ctx, `
+		UPDATE processed_events SET claimed_until = $1, expires_at = $2
+		WHERE event_id = $3 AND processed_at IS NULL AND claimed_until < $4
+	`, claimedUntil, expiresAt, id, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim event: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 1 {
+		return Claimed, nil
+	}
+
+	var processedAt sql.NullTime
+	err = d.db.QueryRowContext(ctx, `SELECT processed_at FROM processed_events WHERE event_id = $1`, id).Scan(&processedAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		// Released or purged since the insert; claimed on the next try
+		return InFlight, nil
+	case err != nil:
+		return 0, fmt.Errorf("failed to claim event: %w", err)
+	case processedAt.Valid:
+		return Processed, nil
+	default:
+		return InFlight, nil
+	}
+}
+
+func (d *SQLDeduplicator) Done(ctx context.Context, id uuid.UUID) error {
+	now := time.Now().UTC()
+	_, err := d.db.ExecContext(ctx, `
+		UPDATE processed_events SET processed_at = $1, expires_at = $2 WHERE event_id = $3
+	`, now, now.Add(d.ttl), id)
+	if err != nil {
+		return fmt.Errorf("failed to mark event processed: %w", err)
+	}
+	return nil
+}
+
+func (d *SQLDeduplicator) Release(ctx context.Context, id uuid.UUID) error {
+	_, err := d.db.ExecContext(ctx, `DELETE FROM processed_events WHERE event_id = $1 AND processed_at IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to release event: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired removes IDs older than the retention, run by the
+// processed_events_purge job
+func (d *SQLDeduplicator) DeleteExpired(ctx context.Context) error {
+	_, err := d.db.ExecContext(ctx, `DELETE FROM processed_events WHERE expires_at < $1`, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to delete expired processed events: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package messaging
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/cache"
+
+	"github.com/google/uuid"
+)
+
+func TestCacheDeduplicator_ClaimDoneRelease(t *testing.T) {
+	ctx := context.Background()
+	dedup := NewCacheDeduplicator(cache.NewMemoryCache(), time.Minute, time.Hour)
+	id := uuid.New()
+
+	claim := func(want ClaimState) {
+		t.Helper()
+		state, err := dedup.Claim(ctx, id)
+		if err != nil {
+			t.Fatalf("Claim: %v", err)
+		}
+		if state != want {
+			t.Fatalf("Claim = %v, want %v", state, want)
+		}
+	}
+
+	claim(Claimed)
+	claim(InFlight)
+
+	// A released event can be claimed again
+	if err := dedup.Release(ctx, id); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	claim(Claimed)
+
+	if err := dedup.Done(ctx, id); err != nil {
+		t.Fatalf("Done: %v", err)
+	}
+	claim(Processed)
+}
@@ -0,0 +1,101 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"highload-microservice/internal/config"
+	"highload-microservice/internal/kafka"
+	"highload-microservice/internal/membus"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/nats"
+	"highload-microservice/internal/rabbitmq"
+	"highload-microservice/internal/sqs"
+)
+
+// Supported values for MESSAGING_BACKEND
+const (
+	BackendKafka    = "kafka"
+	BackendSQS      = "sqs"
+	BackendNATS     = "nats"     // JetStream
+	BackendRabbitMQ = "rabbitmq" // topic exchange + shared queue
+	BackendMemory   = "memory"   // in-process channel, for DEV_MODE
+)
+
+// Producer publishes events to the configured message broker. Producer and
+// Consumer are the message bus every backend implements; KafkaEvent is the
+// message model on all of them.
+type Producer interface {
+	SendEvent(ctx context.Context, event models.KafkaEvent) error
+	Close() error
+}
+
+// Consumer reads events from the configured message broker. FetchMessage
+// returns a commit function that acknowledges the event once it has been
+// processed; events that are never committed are delivered again.
+type Consumer interface {
+	FetchMessage(ctx context.Context) (models.KafkaEvent, func(context.Context) error, error)
+	Close() error
+}
+
+// HealthReporter is implemented by producers and consumers that track broker
+// connectivity (Kafka). Others are assumed healthy.
+type HealthReporter interface {
+	Health() kafka.Health
+}
+
+// LagReporter is implemented by consumers that know how far behind the
+// broker they are (Kafka)
+type LagReporter interface {
+	Lag() int64
+}
+
+// Pinger is implemented by producers that can actively check the broker
+// connection; /health/ready calls it on every probe
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// NewProducer creates a producer for the backend selected by MESSAGING_BACKEND
+func NewProducer(cfg *config.Config) (Producer, error) {
+	switch backend(cfg) {
+	case BackendKafka:
+		return kafka.NewProducer(cfg.Kafka)
+	case BackendSQS:
+		return sqs.NewProducer(cfg.SQS)
+	case BackendNATS:
+		return nats.NewProducer(cfg.NATS)
+	case BackendRabbitMQ:
+		return rabbitmq.NewProducer(cfg.RabbitMQ)
+	case BackendMemory:
+		return membus.NewProducer(membus.Default()), nil
+	default:
+		return nil, fmt.Errorf("unsupported messaging backend: %s", cfg.Messaging.Backend)
+	}
+}
+
+// NewConsumer creates a consumer for the backend selected by MESSAGING_BACKEND
+func NewConsumer(cfg *config.Config) (Consumer, error) {
+	switch backend(cfg) {
+	case BackendKafka:
+		return kafka.NewConsumer(cfg.Kafka)
+	case BackendSQS:
+		return sqs.NewConsumer(cfg.SQS)
+	case BackendNATS:
+		return nats.NewConsumer(cfg.NATS)
+	case BackendRabbitMQ:
+		return rabbitmq.NewConsumer(cfg.RabbitMQ)
+	case BackendMemory:
+		return membus.NewConsumer(membus.Default()), nil
+	default:
+		return nil, fmt.Errorf("unsupported messaging backend: %s", cfg.Messaging.Backend)
+	}
+}
+
+func backend(cfg *config.Config) string {
+	if cfg.Messaging.Backend == "" {
+		return BackendKafka
+	}
+	return strings.ToLower(cfg.Messaging.Backend)
+}
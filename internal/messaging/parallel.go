@@ -0,0 +1,114 @@
+package messaging
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// fetched is an event handed to a lane, waiting for its commit
+type fetched struct {
+	event    models.KafkaEvent
+	commit   func(context.Context) error
+	finished bool
+	ok       bool // processed (or dropped) and may be committed
+}
+
+// commitQueue commits events in the order they were fetched, whatever order
+// the lanes finish them in, so a committed offset never skips an event that
+// is still being processed
+type commitQueue struct {
+	mu      sync.Mutex
+	pending []*fetched
+	stalled bool // an event was left uncommitted; later ones stay uncommitted too
+}
+
+func (q *commitQueue) push(item *fetched) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = append(q.pending, item)
+}
+
+// finish records the outcome of item and commits the events fetched before
+// it that are finished. Commits run under the lock to keep their order.
+func (q *commitQueue) finish(r *Runner, item *fetched, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	item.finished, item.ok = true, ok
+
+	for len(q.pending) > 0 && q.pending[0].finished && !q.stalled {
+		head := q.pending[0]
+		if !head.ok {
+			q.stalled = true
+			break
+		}
+		q.pending = q.pending[1:]
+		r.commit(context.Background(), head.event, head.commit)
+	}
+}
+
+// runParallel processes events on cfg.Concurrency lanes. Events of one user
+// always go to the same lane and are processed in order; a full lane blocks
+// fetching, so the consumer reads no faster than the lanes process.
+func (r *Runner) runParallel(ctx context.Context) {
+	queue := &commitQueue{}
+	lanes := make([]chan *fetched, r.cfg.Concurrency)
+	var wg sync.WaitGroup
+	for i := range lanes {
+		lanes[i] = make(chan *fetched, r.cfg.LaneQueueSize)
+		wg.Add(1)
+		go func(lane <-chan *fetched) {
+			defer wg.Done()
+			for item := range lane {
+				// Events not started before shutdown are redelivered
+				queue.finish(r, item, ctx.Err() == nil && r.process(ctx, item.event))
+			}
+		}(lanes[i])
+	}
+	defer func() {
+		for _, lane := range lanes {
+			close(lane)
+		}
+		wg.Wait()
+	}()
+
+	readFailures := 0
+	for ctx.Err() == nil {
+		event, commit, err := r.consumer.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			r.logger.Errorf("Failed to read message: %v", err)
+			readFailures++
+			r.sleep(ctx, readFailures)
+			continue
+		}
+		readFailures = 0
+
+		item := &fetched{event: event, commit: commit}
+		queue.push(item)
+		select {
+		case lanes[lane(event, len(lanes))] <- item:
+		case <-ctx.Done():
+			queue.finish(r, item, false)
+			return
+		}
+	}
+}
+
+// lane picks the lane of event by user, so events of one user keep their
+// order. Events without a user are spread by ID.
+func lane(event models.KafkaEvent, lanes int) int {
+	key := event.UserID
+	if key == uuid.Nil {
+		key = event.ID
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(key[:])
+	return int(h.Sum32() % uint32(lanes))
+}
@@ -0,0 +1,121 @@
+package messaging
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// usersOnLanes returns two users whose events go to different lanes
+func usersOnLanes(lanes int) (uuid.UUID, uuid.UUID) {
+	first := uuid.New()
+	for {
+		second := uuid.New()
+		if lane(models.KafkaEvent{UserID: first}, lanes) != lane(models.KafkaEvent{UserID: second}, lanes) {
+			return first, second
+		}
+	}
+}
+
+func TestRunner_ParallelOrdersPerUserAndCommitsInFetchOrder(t *testing.T) {
+	alice, bob := usersOnLanes(2)
+	slow := models.KafkaEvent{ID: uuid.New(), UserID: alice}
+	other := models.KafkaEvent{ID: uuid.New(), UserID: bob}
+	next := models.KafkaEvent{ID: uuid.New(), UserID: alice}
+	consumer := &fakeConsumer{events: []models.KafkaEvent{slow, other, next}}
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var handled []uuid.UUID
+	handler := func(ctx context.Context, e models.KafkaEvent) error {
+		if e.ID == slow.ID {
+			<-release
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, e.ID)
+		return nil
+	}
+	handledIDs := func() []uuid.UUID {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]uuid.UUID(nil), handled...)
+	}
+
+	cfg := fastConfig()
+	cfg.Concurrency = 2
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewRunner(consumer, handler, cfg, quietLogger()).Run(ctx)
+	}()
+
+	// Bob's event is processed while Alice's first one is blocked, but is
+	// not committed before it; Alice's second event waits behind her first
+	waitFor(t, func() bool { return len(handledIDs()) == 1 })
+	time.Sleep(10 * time.Millisecond)
+	if got := handledIDs(); len(got) != 1 || got[0] != other.ID {
+		t.Fatalf("handled %v, want only %v", got, other.ID)
+	}
+	if n := len(consumer.commits()); n != 0 {
+		t.Fatalf("committed %d events ahead of the blocked one", n)
+	}
+
+	close(release)
+	waitFor(t, func() bool { return len(consumer.commits()) == 3 })
+	cancel()
+	<-done
+
+	if got := handledIDs(); got[1] != slow.ID || got[2] != next.ID {
+		t.Fatalf("handled %v, want %v before %v", got, slow.ID, next.ID)
+	}
+	commits := consumer.commits()
+	for i, want := range []uuid.UUID{slow.ID, other.ID, next.ID} {
+		if commits[i] != want {
+			t.Fatalf("commits %v, want fetch order", commits)
+		}
+	}
+}
+
+func TestRunner_ParallelShutdownLeavesLaterEventsUncommitted(t *testing.T) {
+	alice, bob := usersOnLanes(2)
+	stuck := models.KafkaEvent{ID: uuid.New(), UserID: alice}
+	later := models.KafkaEvent{ID: uuid.New(), UserID: bob}
+	consumer := &fakeConsumer{events: []models.KafkaEvent{stuck, later}}
+
+	laterDone := make(chan struct{})
+	handler := func(ctx context.Context, e models.KafkaEvent) error {
+		if e.ID == later.ID {
+			close(laterDone)
+			return nil
+		}
+		return context.DeadlineExceeded
+	}
+
+	cfg := fastConfig()
+	cfg.Concurrency = 2
+	cfg.InitialBackoff, cfg.MaxBackoff = time.Hour, time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewRunner(consumer, handler, cfg, quietLogger()).Run(ctx)
+	}()
+
+	<-laterDone
+	cancel()
+	<-done
+
+	// Committing the later event would move the offset past the failing one
+	if n := len(consumer.commits()); n != 0 {
+		t.Fatalf("committed %v, want nothing", consumer.commits())
+	}
+}
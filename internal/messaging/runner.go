@@ -0,0 +1,241 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"highload-microservice/internal/metrics"
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Handler processes one consumed event. Returned errors are retried with
+// backoff unless wrapped with Permanent.
+type Handler func(ctx context.Context, event models.KafkaEvent) error
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks a handler error that retrying cannot fix (e.g. an event
+// that cannot be decrypted). The event is logged and committed.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether err was wrapped with Permanent
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// RunnerConfig tunes retries and shutdown of a Runner
+type RunnerConfig struct {
+	InitialBackoff time.Duration // first retry delay after a failed read or handler call
+	MaxBackoff     time.Duration // retry delay cap
+	HandlerTimeout time.Duration // per attempt, also bounds the last event during shutdown
+	Concurrency    int           // events processed at once, ordered per user; 1 processes one at a time
+	LaneQueueSize  int           // events waiting per lane before fetching blocks
+}
+
+// Runner feeds events from a Consumer to a Handler one at a time and commits
+// each event only after the handler succeeded, so a crash or shutdown never
+// loses an event (delivery is at least once). Events are committed in the
+// order they were fetched. With a Deduplicator, an event is marked processed
+// before its commit, so one redelivered after a failed commit or a restart is
+// skipped instead of processed twice.
+type Runner struct {
+	consumer Consumer
+	handler  Handler
+	cfg      RunnerConfig
+	dedup    Deduplicator
+	logger   *logrus.Logger
+}
+
+func NewRunner(consumer Consumer, handler Handler, cfg RunnerConfig, logger *logrus.Logger) *Runner {
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 200 * time.Millisecond
+	}
+	if cfg.MaxBackoff < cfg.InitialBackoff {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+	if cfg.HandlerTimeout <= 0 {
+		cfg.HandlerTimeout = 30 * time.Second
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.LaneQueueSize <= 0 {
+		cfg.LaneQueueSize = 16
+	}
+
+	return &Runner{
+		consumer: consumer,
+		handler:  handler,
+		cfg:      cfg,
+		logger:   logger,
+	}
+}
+
+// SetDeduplicator skips events dedup has seen processed. Replayed events and
+// events without an ID are always processed.
+func (r *Runner) SetDeduplicator(dedup Deduplicator) {
+	r.dedup = dedup
+}
+
+// Run consumes until ctx is cancelled. An event being handled when ctx is
+// cancelled is finished (within HandlerTimeout) and committed; one that is
+// still failing is left uncommitted for redelivery. With Concurrency above 1
+// events of different users are processed in parallel, see runParallel.
+func (r *Runner) Run(ctx context.Context) {
+	r.logger.Info("Starting event processing...")
+	defer r.logger.Info("Event processing stopped")
+
+	if r.cfg.Concurrency > 1 {
+		r.runParallel(ctx)
+		return
+	}
+
+	readFailures := 0
+	for ctx.Err() == nil {
+		event, commit, err := r.consumer.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			r.logger.Errorf("Failed to read message: %v", err)
+			readFailures++
+			r.sleep(ctx, readFailures)
+			continue
+		}
+		readFailures = 0
+
+		if !r.process(ctx, event) {
+			return
+		}
+		r.commit(ctx, event, commit)
+	}
+}
+
+// commit acknowledges a processed event. Failures are only logged: the event
+// is redelivered and, with a Deduplicator, skipped.
+func (r *Runner) commit(ctx context.Context, event models.KafkaEvent, commit func(context.Context) error) {
+	commitCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.cfg.HandlerTimeout)
+	defer cancel()
+	if err := commit(commitCtx); err != nil {
+		r.logger.Errorf("Failed to commit event %s: %v", event.ID, err)
+	}
+}
+
+// process handles the event unless it was processed before and reports
+// whether it should be committed. While another consumer holds the event it
+// is claimed again with backoff.
+func (r *Runner) process(ctx context.Context, event models.KafkaEvent) bool {
+	if r.dedup == nil || event.ID == uuid.Nil || event.Replay {
+		return r.handle(ctx, event)
+	}
+
+	for attempt := 1; ; attempt++ {
+		state, err := r.claim(ctx, event.ID)
+		if err != nil {
+			// Processing twice beats not processing at all
+			r.logger.Warnf("Failed to check whether event %s was processed: %v", event.ID, err)
+			return r.handle(ctx, event)
+		}
+
+		switch state {
+		case Processed:
+			r.logger.Infof("Skipping event %s: already processed", event.ID)
+			metrics.ConsumerDuplicate()
+			return true
+		case Claimed:
+			if !r.handle(ctx, event) {
+				r.unclaim(ctx, event.ID, r.dedup.Release)
+				return false
+			}
+			r.unclaim(ctx, event.ID, r.dedup.Done)
+			return true
+		}
+
+		r.logger.Debugf("Event %s is being processed by another consumer (attempt %d)", event.ID, attempt)
+		if !r.sleep(ctx, attempt) {
+			return false
+		}
+	}
+}
+
+func (r *Runner) claim(ctx context.Context, id uuid.UUID) (ClaimState, error) {
+	claimCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.cfg.HandlerTimeout)
+	defer cancel()
+	return r.dedup.Claim(claimCtx, id)
+}
+
+// unclaim calls Done or Release, which must run during shutdown too
+func (r *Runner) unclaim(ctx context.Context, id uuid.UUID, fn func(context.Context, uuid.UUID) error) {
+	unclaimCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.cfg.HandlerTimeout)
+	defer cancel()
+	if err := fn(unclaimCtx, id); err != nil {
+		r.logger.Warnf("Failed to record the outcome of event %s: %v", id, err)
+	}
+}
+
+// handle calls the handler until it succeeds or fails permanently and
+// reports whether the event should be committed. Shutdown does not cancel an
+// attempt in progress but stops further retries.
+func (r *Runner) handle(ctx context.Context, event models.KafkaEvent) bool {
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.cfg.HandlerTimeout)
+		err := r.handler(attemptCtx, event)
+		cancel()
+
+		switch {
+		case err == nil:
+			return true
+		case IsPermanent(err):
+			r.logger.Errorf("Dropping event %s: %v", event.ID, err)
+			return true
+		}
+
+		r.logger.Warnf("Failed to process event %s (attempt %d): %v", event.ID, attempt, err)
+		if !r.sleep(ctx, attempt) {
+			r.logger.Warnf("Shutting down with event %s unprocessed; it will be redelivered", event.ID)
+			return false
+		}
+	}
+}
+
+// sleep waits the backoff for the given attempt and reports false if ctx was
+// cancelled first
+func (r *Runner) sleep(ctx context.Context, attempt int) bool {
+	timer := time.NewTimer(backoff(r.cfg.InitialBackoff, r.cfg.MaxBackoff, attempt))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// backoff doubles initial per attempt up to max and randomises the upper half
+// so replicas failing together do not retry in lockstep
+func backoff(initial, max time.Duration, attempt int) time.Duration {
+	d := initial
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	half := d / 2
+	return half + rand.N(half+1) // #nosec G404 -- jitter, not security sensitive
+}
@@ -0,0 +1,320 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeConsumer serves events from a slice, then blocks until ctx ends
+type fakeConsumer struct {
+	mu        sync.Mutex
+	events    []models.KafkaEvent
+	committed []uuid.UUID
+}
+
+func (f *fakeConsumer) FetchMessage(ctx context.Context) (models.KafkaEvent, func(context.Context) error, error) {
+	f.mu.Lock()
+	if len(f.events) == 0 {
+		f.mu.Unlock()
+		<-ctx.Done()
+		return models.KafkaEvent{}, nil, ctx.Err()
+	}
+	event := f.events[0]
+	f.events = f.events[1:]
+	f.mu.Unlock()
+
+	return event, func(context.Context) error {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.committed = append(f.committed, event.ID)
+		return nil
+	}, nil
+}
+
+func (f *fakeConsumer) Close() error { return nil }
+
+func (f *fakeConsumer) commits() []uuid.UUID {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]uuid.UUID(nil), f.committed...)
+}
+
+func quietLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func fastConfig() RunnerConfig {
+	return RunnerConfig{InitialBackoff: time.Millisecond, MaxBackoff: 4 * time.Millisecond, HandlerTimeout: time.Second}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRunner_RetriesUntilSuccessThenCommits(t *testing.T) {
+	event := models.KafkaEvent{ID: uuid.New()}
+	consumer := &fakeConsumer{events: []models.KafkaEvent{event}}
+
+	var mu sync.Mutex
+	attempts := 0
+	handler := func(ctx context.Context, e models.KafkaEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts < 3 {
+			return errors.New("downstream unavailable")
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewRunner(consumer, handler, fastConfig(), quietLogger()).Run(ctx)
+	}()
+
+	waitFor(t, func() bool { return len(consumer.commits()) == 1 })
+	cancel()
+	<-done
+
+	if attempts != 3 {
+		t.Fatalf("attempts = %d, want 3", attempts)
+	}
+	if consumer.commits()[0] != event.ID {
+		t.Fatalf("committed %v, want %v", consumer.commits(), event.ID)
+	}
+}
+
+func TestRunner_PermanentErrorIsCommitted(t *testing.T) {
+	event := models.KafkaEvent{ID: uuid.New()}
+	consumer := &fakeConsumer{events: []models.KafkaEvent{event}}
+	handler := func(ctx context.Context, e models.KafkaEvent) error {
+		return Permanent(errors.New("cannot decrypt"))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewRunner(consumer, handler, fastConfig(), quietLogger()).Run(ctx)
+	}()
+
+	waitFor(t, func() bool { return len(consumer.commits()) == 1 })
+	cancel()
+	<-done
+}
+
+func TestRunner_ShutdownLeavesFailingEventUncommitted(t *testing.T) {
+	consumer := &fakeConsumer{events: []models.KafkaEvent{{ID: uuid.New()}}}
+	failed := make(chan struct{}, 1)
+	handler := func(ctx context.Context, e models.KafkaEvent) error {
+		select {
+		case failed <- struct{}{}:
+		default:
+		}
+		return errors.New("still failing")
+	}
+
+	cfg := fastConfig()
+	cfg.InitialBackoff, cfg.MaxBackoff = time.Hour, time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewRunner(consumer, handler, cfg, quietLogger()).Run(ctx)
+	}()
+
+	<-failed
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("runner did not stop on shutdown")
+	}
+	if n := len(consumer.commits()); n != 0 {
+		t.Fatalf("committed %d events, want 0", n)
+	}
+}
+
+func TestRunner_ShutdownFinishesInFlightEvent(t *testing.T) {
+	first, second := models.KafkaEvent{ID: uuid.New()}, models.KafkaEvent{ID: uuid.New()}
+	consumer := &fakeConsumer{events: []models.KafkaEvent{first, second}}
+	started, release := make(chan struct{}), make(chan struct{})
+	var handled []uuid.UUID
+	handler := func(ctx context.Context, e models.KafkaEvent) error {
+		close(started)
+		<-release
+		// Shutdown must not cancel the attempt in progress
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		handled = append(handled, e.ID)
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewRunner(consumer, handler, fastConfig(), quietLogger()).Run(ctx)
+	}()
+
+	<-started
+	cancel()
+	close(release)
+	<-done
+
+	// The in-flight event is committed, the next one is not fetched
+	if len(handled) != 1 || handled[0] != first.ID {
+		t.Fatalf("handled %v, want only %v", handled, first.ID)
+	}
+	if commits := consumer.commits(); len(commits) != 1 || commits[0] != first.ID {
+		t.Fatalf("committed %v, want only %v", commits, first.ID)
+	}
+}
+
+func TestBackoff_GrowsWithJitterAndCap(t *testing.T) {
+	initial, max := 100*time.Millisecond, time.Second
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second} {
+		for i := 0; i < 50; i++ {
+			d := backoff(initial, max, attempt)
+			if d < want/2 || d > want {
+				t.Fatalf("attempt %d: backoff %v outside [%v, %v]", attempt, d, want/2, want)
+			}
+		}
+	}
+}
+
+// fakeDedup reports the events in processed as processed and records the
+// order of Done calls and commits
+type fakeDedup struct {
+	mu        sync.Mutex
+	processed map[uuid.UUID]bool
+	consumer  *fakeConsumer
+	done      []uuid.UUID
+	released  []uuid.UUID
+	early     bool // Done was called after the event was committed
+}
+
+func (f *fakeDedup) Claim(ctx context.Context, id uuid.UUID) (ClaimState, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.processed[id] {
+		return Processed, nil
+	}
+	return Claimed, nil
+}
+
+func (f *fakeDedup) Done(ctx context.Context, id uuid.UUID) error {
+	for _, committed := range f.consumer.commits() {
+		if committed == id {
+			f.early = true
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.done = append(f.done, id)
+	return nil
+}
+
+func (f *fakeDedup) Release(ctx context.Context, id uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.released = append(f.released, id)
+	return nil
+}
+
+func TestRunner_SkipsProcessedEventsAndMarksBeforeCommit(t *testing.T) {
+	seen, fresh := models.KafkaEvent{ID: uuid.New()}, models.KafkaEvent{ID: uuid.New()}
+	replayed := models.KafkaEvent{ID: seen.ID, Replay: true}
+	consumer := &fakeConsumer{events: []models.KafkaEvent{seen, fresh, replayed}}
+	dedup := &fakeDedup{processed: map[uuid.UUID]bool{seen.ID: true}, consumer: consumer}
+
+	var mu sync.Mutex
+	var handled []models.KafkaEvent
+	handler := func(ctx context.Context, e models.KafkaEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, e)
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runner := NewRunner(consumer, handler, fastConfig(), quietLogger())
+		runner.SetDeduplicator(dedup)
+		runner.Run(ctx)
+	}()
+
+	waitFor(t, func() bool { return len(consumer.commits()) == 3 })
+	cancel()
+	<-done
+
+	// The duplicate is committed without being handled; the replay is
+	// handled although its ID was processed
+	if len(handled) != 2 || handled[0].ID != fresh.ID || !handled[1].Replay {
+		t.Fatalf("handled %v, want %v and the replay", handled, fresh.ID)
+	}
+	if len(dedup.done) != 1 || dedup.done[0] != fresh.ID {
+		t.Fatalf("marked %v processed, want only %v", dedup.done, fresh.ID)
+	}
+	if dedup.early {
+		t.Fatal("event committed before it was marked processed")
+	}
+}
+
+func TestRunner_ShutdownReleasesUnprocessedClaim(t *testing.T) {
+	event := models.KafkaEvent{ID: uuid.New()}
+	consumer := &fakeConsumer{events: []models.KafkaEvent{event}}
+	dedup := &fakeDedup{consumer: consumer}
+	failed := make(chan struct{}, 1)
+	handler := func(ctx context.Context, e models.KafkaEvent) error {
+		select {
+		case failed <- struct{}{}:
+		default:
+		}
+		return errors.New("still failing")
+	}
+
+	cfg := fastConfig()
+	cfg.InitialBackoff, cfg.MaxBackoff = time.Hour, time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runner := NewRunner(consumer, handler, cfg, quietLogger())
+		runner.SetDeduplicator(dedup)
+		runner.Run(ctx)
+	}()
+
+	<-failed
+	cancel()
+	<-done
+
+	if len(dedup.released) != 1 || len(dedup.done) != 0 || len(consumer.commits()) != 0 {
+		t.Fatalf("released %v, done %v, committed %v; want only a release", dedup.released, dedup.done, consumer.commits())
+	}
+}
@@ -0,0 +1,381 @@
+// Package metrics defines the service's Prometheus collectors and the hooks
+// used to update them. Collectors are registered with the default registry,
+// which main exposes on /metrics.
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Cache lookup results
+const (
+	CacheHit   = "hit"
+	CacheMiss  = "miss"
+	CacheError = "error"
+)
+
+// How the cache loader served a read it could not answer from the cache
+const (
+	CacheLoadLoaded       = "loaded"        // this read loaded the value
+	CacheLoadCoalesced    = "coalesced"     // waited for a load already in flight
+	CacheLoadNegativeHit  = "negative_hit"  // a cached not found result
+	CacheLoadEarlyRefresh = "early_refresh" // refreshed a hot key before expiry
+)
+
+// Results of event handler attempts
+const (
+	HandlerSucceeded = "succeeded"
+	HandlerRetried   = "retried" // failed, tried again
+	HandlerFailed    = "failed"  // failed for good
+)
+
+// Reasons for requests rejected by the protection middleware
+const (
+	BlockDDoS      = "ddos"
+	BlockBlockedIP = "blocked_ip"
+	BlockRateLimit = "rate_limit"
+	BlockIPRule    = "ip_rule"
+	BlockQuota     = "quota"
+	BlockOverload  = "overload"
+)
+
+// Reasons for events lost by the async producer buffer
+const (
+	ProducerDropOverflow   = "overflow"    // buffer full
+	ProducerDropSendFailed = "send_failed" // broker write failed after dequeue
+	ProducerDropShutdown   = "shutdown"    // still queued when the flush timeout ran out
+)
+
+var (
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method, route and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "Database query latency by statement type.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"operation"})
+	dbQueryErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_query_errors_total",
+		Help: "Number of failed database queries by statement type.",
+	}, []string{"operation"})
+
+	dbReplicaUp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "db_replica_up",
+		Help: "1 while reads are routed to the read replica, 0 while they fall back to the primary.",
+	})
+
+	cacheRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_requests_total",
+		Help: "Number of cache lookups by backend and result (hit, miss, error).",
+	}, []string{"backend", "result"})
+	cacheLoadsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_loads_total",
+		Help: "Number of cache loader outcomes (loaded, coalesced, negative_hit, early_refresh).",
+	}, []string{"result"})
+
+	kafkaProducedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_messages_produced_total",
+		Help: "Number of messages written to Kafka by topic and status.",
+	}, []string{"topic", "status"})
+	kafkaConsumedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_messages_consumed_total",
+		Help: "Number of messages read from Kafka by topic and status.",
+	}, []string{"topic", "status"})
+	consumerDuplicatesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "consumer_duplicates_total",
+		Help: "Number of redelivered events skipped because they were already processed.",
+	})
+	eventHandlerRunsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "event_handler_runs_total",
+		Help: "Number of event handler attempts by handler and result (succeeded, retried, failed).",
+	}, []string{"handler", "result"})
+	eventHandlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "event_handler_duration_seconds",
+		Help:    "Event handler attempt latency by handler.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"handler"})
+
+	producerBufferDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "producer_buffer_depth",
+		Help: "Number of events waiting in the async producer buffer.",
+	})
+	producerBufferDroppedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "producer_buffer_dropped_total",
+		Help: "Number of events lost by the async producer by reason (overflow, send_failed, shutdown).",
+	}, []string{"reason"})
+
+	workerQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "worker_pool_queue_depth",
+		Help: "Number of jobs waiting for a worker.",
+	})
+	workerJobsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "worker_pool_jobs_total",
+		Help: "Number of worker pool jobs by result (processed, failed, retried, dropped).",
+	}, []string{"result"})
+
+	requestsBlockedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "requests_blocked_total",
+		Help: "Number of requests rejected by DDoS protection, rate limiting and load shedding.",
+	}, []string{"reason"})
+
+	requestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "Number of requests being handled under the load shedder.",
+	})
+	requestsQueued = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_queued",
+		Help: "Number of requests waiting for a load shedder slot.",
+	})
+	concurrencyLimit = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_concurrency_limit",
+		Help: "Current adaptive concurrency limit of the load shedder.",
+	})
+
+	bulkheadInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "bulkhead_in_flight",
+		Help: "Number of requests being handled by route group bulkhead.",
+	}, []string{"group"})
+	bulkheadQueued = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "bulkhead_queued",
+		Help: "Number of requests waiting for a slot by route group bulkhead.",
+	}, []string{"group"})
+	bulkheadRejectedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "bulkhead_rejected_total",
+		Help: "Number of requests rejected by a full route group bulkhead.",
+	}, []string{"group"})
+
+	circuitBreakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "circuit_breaker_state",
+		Help: "State of each circuit breaker: 0 closed, 1 open, 2 half open.",
+	}, []string{"name"})
+	circuitBreakerRejectedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "circuit_breaker_rejected_total",
+		Help: "Number of calls rejected by an open circuit breaker.",
+	}, []string{"name"})
+
+	httpClientRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_client_requests_total",
+		Help: "Number of outbound HTTP attempts by client, method and status (code or error).",
+	}, []string{"client", "method", "status"})
+	httpClientRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_client_request_duration_seconds",
+		Help:    "Outbound HTTP attempt latency by client.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"client"})
+	httpClientRetriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_client_retries_total",
+		Help: "Number of outbound HTTP attempts retried by client.",
+	}, []string{"client"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		httpRequestsTotal, httpRequestDuration,
+		dbQueryDuration, dbQueryErrorsTotal, dbReplicaUp,
+		cacheRequestsTotal, cacheLoadsTotal,
+		kafkaProducedTotal, kafkaConsumedTotal, consumerDuplicatesTotal,
+		eventHandlerRunsTotal, eventHandlerDuration,
+		producerBufferDepth, producerBufferDroppedTotal,
+		workerQueueDepth, workerJobsTotal,
+		requestsBlockedTotal,
+		requestsInFlight, requestsQueued, concurrencyLimit,
+		bulkheadInFlight, bulkheadQueued, bulkheadRejectedTotal,
+		circuitBreakerState, circuitBreakerRejectedTotal,
+		httpClientRequestsTotal, httpClientRequestDuration, httpClientRetriesTotal,
+	)
+}
+
+// Middleware records request count and latency. Routes are labelled with
+// their registered pattern (/api/v1/users/:id) to keep cardinality bounded.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		httpRequestsTotal.WithLabelValues(c.Request.Method, route, status).Inc()
+		httpRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveDBQuery records the latency and outcome of a database statement
+func ObserveDBQuery(query string, duration time.Duration, err error) {
+	operation := queryOperation(query)
+	dbQueryDuration.WithLabelValues(operation).Observe(duration.Seconds())
+	if err != nil {
+		dbQueryErrorsTotal.WithLabelValues(operation).Inc()
+	}
+}
+
+// queryOperation returns the statement type of a query, e.g. "select"
+func queryOperation(query string) string {
+	query = strings.TrimLeft(query, " \t\r\n(")
+	end := strings.IndexAny(query, " \t\r\n(")
+	if end < 0 {
+		end = len(query)
+	}
+
+	switch keyword := strings.ToLower(query[:end]); keyword {
+	case "select", "insert", "update", "delete", "with", "begin", "commit", "rollback":
+		return keyword
+	default:
+		return "other"
+	}
+}
+
+// CacheLookup records the result of a cache Get
+func CacheLookup(backend, result string) {
+	cacheRequestsTotal.WithLabelValues(backend, result).Inc()
+}
+
+// CacheLoad records how the cache loader served a read
+func CacheLoad(result string) {
+	cacheLoadsTotal.WithLabelValues(result).Inc()
+}
+
+// KafkaProduced records a message written (or failed to be written) to Kafka
+func KafkaProduced(topic string, err error) {
+	kafkaProducedTotal.WithLabelValues(topic, status(err)).Inc()
+}
+
+// SetDBReplicaUp reports whether the read replica is serving reads
+func SetDBReplicaUp(up bool) {
+	if up {
+		dbReplicaUp.Set(1)
+	} else {
+		dbReplicaUp.Set(0)
+	}
+}
+
+// KafkaConsumed records a message read (or failed to be decoded) from Kafka
+func KafkaConsumed(topic string, err error) {
+	kafkaConsumedTotal.WithLabelValues(topic, status(err)).Inc()
+}
+
+// ConsumerDuplicate counts a redelivered event skipped by the consumer
+func ConsumerDuplicate() {
+	consumerDuplicatesTotal.Inc()
+}
+
+// EventHandlerRun records the result of an event handler attempt
+func EventHandlerRun(handler, result string) {
+	eventHandlerRunsTotal.WithLabelValues(handler, result).Inc()
+}
+
+// ObserveEventHandler records the duration of an event handler attempt
+func ObserveEventHandler(handler string, d time.Duration) {
+	eventHandlerDuration.WithLabelValues(handler).Observe(d.Seconds())
+}
+
+// AddProducerBufferDepth adjusts the number of buffered producer events
+func AddProducerBufferDepth(delta int) {
+	producerBufferDepth.Add(float64(delta))
+}
+
+// ProducerEventDropped counts an event lost by the async producer
+func ProducerEventDropped(reason string) {
+	producerBufferDroppedTotal.WithLabelValues(reason).Inc()
+}
+
+// SetWorkerQueueDepth reports the number of queued worker pool jobs
+func SetWorkerQueueDepth(depth int) {
+	workerQueueDepth.Set(float64(depth))
+}
+
+// WorkerJobProcessed counts a job picked up by a worker
+func WorkerJobProcessed() {
+	workerJobsTotal.WithLabelValues("processed").Inc()
+}
+
+// WorkerJobFailed counts a job that failed its last attempt
+func WorkerJobFailed() {
+	workerJobsTotal.WithLabelValues("failed").Inc()
+}
+
+// WorkerJobRetried counts a failed attempt that will be retried
+func WorkerJobRetried() {
+	workerJobsTotal.WithLabelValues("retried").Inc()
+}
+
+// WorkerJobDropped counts a job dropped because the queue was full
+func WorkerJobDropped() {
+	workerJobsTotal.WithLabelValues("dropped").Inc()
+}
+
+// RequestBlocked counts a request rejected for the given reason
+func RequestBlocked(reason string) {
+	requestsBlockedTotal.WithLabelValues(reason).Inc()
+}
+
+// SetLoadShedderState reports the requests in flight and queued and the
+// concurrency limit of the load shedder
+func SetLoadShedderState(inFlight, queued, limit int) {
+	requestsInFlight.Set(float64(inFlight))
+	requestsQueued.Set(float64(queued))
+	concurrencyLimit.Set(float64(limit))
+}
+
+// SetBulkheadState reports the requests in flight and queued in the bulkhead
+// of a route group
+func SetBulkheadState(group string, inFlight, queued int) {
+	bulkheadInFlight.WithLabelValues(group).Set(float64(inFlight))
+	bulkheadQueued.WithLabelValues(group).Set(float64(queued))
+}
+
+// BulkheadRejected counts a request rejected by the full bulkhead of a route
+// group
+func BulkheadRejected(group string) {
+	bulkheadRejectedTotal.WithLabelValues(group).Inc()
+}
+
+// SetCircuitBreakerState reports the state of a circuit breaker (0 closed,
+// 1 open, 2 half open)
+func SetCircuitBreakerState(name string, state int) {
+	circuitBreakerState.WithLabelValues(name).Set(float64(state))
+}
+
+// CircuitBreakerRejected counts a call rejected by an open circuit breaker
+func CircuitBreakerRejected(name string) {
+	circuitBreakerRejectedTotal.WithLabelValues(name).Inc()
+}
+
+// HTTPClientRequest records an outbound HTTP attempt; statusCode is ignored
+// when err is set
+func HTTPClientRequest(client, method string, statusCode int, duration time.Duration, err error) {
+	label := "error"
+	if err == nil {
+		label = strconv.Itoa(statusCode)
+	}
+	httpClientRequestsTotal.WithLabelValues(client, method, label).Inc()
+	httpClientRequestDuration.WithLabelValues(client).Observe(duration.Seconds())
+}
+
+// HTTPClientRetried counts an outbound HTTP attempt that is retried
+func HTTPClientRetried(client string) {
+	httpClientRetriesTotal.WithLabelValues(client).Inc()
+}
+
+func status(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddleware_LabelsRoutePattern(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware())
+	r.GET("/users/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	before := testutil.ToFloat64(httpRequestsTotal.WithLabelValues("GET", "/users/:id", "204"))
+	for _, path := range []string{"/users/1", "/users/2"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	unmatched := testutil.ToFloat64(httpRequestsTotal.WithLabelValues("GET", "unmatched", "404"))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/nope", nil))
+
+	if got := testutil.ToFloat64(httpRequestsTotal.WithLabelValues("GET", "/users/:id", "204")) - before; got != 2 {
+		t.Fatalf("want 2 requests for route pattern, got %v", got)
+	}
+	if got := testutil.ToFloat64(httpRequestsTotal.WithLabelValues("GET", "unmatched", "404")) - unmatched; got != 1 {
+		t.Fatalf("want 1 unmatched request, got %v", got)
+	}
+}
+
+func TestQueryOperation(t *testing.T) {
+	cases := map[string]string{
+		"SELECT 1":                            "select",
+		"\n\t\tINSERT INTO users (id) VALUES": "insert",
+		"(SELECT id FROM users) UNION":        "select",
+		"update users set":                    "update",
+		"TRUNCATE users":                      "other",
+		"":                                    "other",
+	}
+	for query, want := range cases {
+		if got := queryOperation(query); got != want {
+			t.Fatalf("queryOperation(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
+
+func TestObserveDBQuery_CountsErrors(t *testing.T) {
+	before := testutil.ToFloat64(dbQueryErrorsTotal.WithLabelValues("delete"))
+	ObserveDBQuery("DELETE FROM users", time.Millisecond, nil)
+	ObserveDBQuery("DELETE FROM users", time.Millisecond, errors.New("boom"))
+
+	if got := testutil.ToFloat64(dbQueryErrorsTotal.WithLabelValues("delete")) - before; got != 1 {
+		t.Fatalf("want 1 error, got %v", got)
+	}
+}
@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// totals are the counter values a Sampler keeps
+type totals struct {
+	at           time.Time
+	requests     float64
+	serverErrors float64 // 5xx responses
+	clientErrors float64 // 4xx responses
+	blocked      float64
+	cache        map[string]cacheTotals // by backend
+}
+
+type cacheTotals struct {
+	hits, misses, errors float64
+}
+
+// Traffic is what was served over the last window
+type Traffic struct {
+	WindowSeconds     float64 `json:"window_seconds"`
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	ErrorRate         float64 `json:"error_rate"`        // share of 5xx responses
+	ClientErrorRate   float64 `json:"client_error_rate"` // share of 4xx responses
+	BlockedPerSecond  float64 `json:"blocked_per_second"`
+	// Cache lookups by backend
+	Cache map[string]CacheTraffic `json:"cache"`
+}
+
+// CacheTraffic is the lookups of one cache backend over the window
+type CacheTraffic struct {
+	Lookups float64 `json:"lookups"`
+	HitRate float64 `json:"hit_rate"`
+	Errors  float64 `json:"errors"`
+}
+
+// Sampler reads the request and cache counters periodically, so that rates
+// cover the last window rather than the time since start
+type Sampler struct {
+	window time.Duration
+	mu     sync.Mutex
+	// samples[0] is the newest sample at least window old, or the first one
+	samples []totals
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewSampler takes a first sample; Start keeps sampling
+func NewSampler(window time.Duration) *Sampler {
+	return &Sampler{window: window, samples: []totals{readTotals()}, done: make(chan struct{})}
+}
+
+// Start samples window/6 apart until Stop is called
+func (s *Sampler) Start() {
+	go func() {
+		ticker := time.NewTicker(s.window / 6)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.sample(readTotals())
+			case <-s.done:
+				return
+			}
+		}
+	}()
+}
+
+func (s *Sampler) Stop() {
+	s.once.Do(func() { close(s.done) })
+}
+
+func (s *Sampler) sample(t totals) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.samples = append(s.samples, t)
+	start := t.at.Add(-s.window)
+	for len(s.samples) > 1 && !s.samples[1].at.After(start) {
+		s.samples = s.samples[1:]
+	}
+}
+
+// Traffic compares the counters now with the oldest sample in the window
+func (s *Sampler) Traffic() Traffic {
+	s.mu.Lock()
+	from := s.samples[0]
+	s.mu.Unlock()
+	return traffic(from, readTotals())
+}
+
+func traffic(from, to totals) Traffic {
+	elapsed := to.at.Sub(from.at).Seconds()
+	requests := to.requests - from.requests
+	t := Traffic{
+		WindowSeconds:   elapsed,
+		ErrorRate:       ratio(to.serverErrors-from.serverErrors, requests),
+		ClientErrorRate: ratio(to.clientErrors-from.clientErrors, requests),
+		Cache:           make(map[string]CacheTraffic, len(to.cache)),
+	}
+	if elapsed > 0 {
+		t.RequestsPerSecond = requests / elapsed
+		t.BlockedPerSecond = (to.blocked - from.blocked) / elapsed
+	}
+	for backend, c := range to.cache {
+		prev := from.cache[backend]
+		hits, misses := c.hits-prev.hits, c.misses-prev.misses
+		t.Cache[backend] = CacheTraffic{
+			Lookups: hits + misses,
+			HitRate: ratio(hits, hits+misses),
+			Errors:  c.errors - prev.errors,
+		}
+	}
+	return t
+}
+
+func ratio(n, total float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return n / total
+}
+
+// readTotals reads the counters the overview reports on
+func readTotals() totals {
+	t := totals{at: time.Now(), cache: map[string]cacheTotals{}}
+	collect(httpRequestsTotal, func(labels map[string]string, value float64) {
+		t.requests += value
+		switch status := labels["status"]; {
+		case len(status) == 3 && status[0] == '5':
+			t.serverErrors += value
+		case len(status) == 3 && status[0] == '4':
+			t.clientErrors += value
+		}
+	})
+	collect(requestsBlockedTotal, func(_ map[string]string, value float64) {
+		t.blocked += value
+	})
+	collect(cacheRequestsTotal, func(labels map[string]string, value float64) {
+		c := t.cache[labels["backend"]]
+		switch labels["result"] {
+		case CacheHit:
+			c.hits += value
+		case CacheMiss:
+			c.misses += value
+		case CacheError:
+			c.errors += value
+		}
+		t.cache[labels["backend"]] = c
+	})
+	return t
+}
+
+// collect calls fn with the labels and value of every series of a counter
+func collect(counter *prometheus.CounterVec, fn func(labels map[string]string, value float64)) {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		counter.Collect(ch)
+		close(ch)
+	}()
+	for metric := range ch {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			continue
+		}
+		labels := make(map[string]string, len(m.GetLabel()))
+		for _, pair := range m.GetLabel() {
+			labels[pair.GetName()] = pair.GetValue()
+		}
+		fn(labels, m.GetCounter().GetValue())
+	}
+}
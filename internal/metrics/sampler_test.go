@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTraffic_RatesSinceSample(t *testing.T) {
+	from := readTotals()
+	from.at = from.at.Add(-10 * time.Second)
+	for status, n := range map[string]int{"200": 14, "404": 4, "503": 2} {
+		httpRequestsTotal.WithLabelValues("GET", "/sampled", status).Add(float64(n))
+	}
+	RequestBlocked("rate_limit")
+	CacheLookup("sampled", CacheHit)
+	CacheLookup("sampled", CacheHit)
+	CacheLookup("sampled", CacheHit)
+	CacheLookup("sampled", CacheMiss)
+	CacheLookup("sampled", CacheError)
+
+	got := traffic(from, readTotals())
+	if got.WindowSeconds < 10 || got.WindowSeconds > 11 {
+		t.Errorf("window = %vs, want 10", got.WindowSeconds)
+	}
+	if got.RequestsPerSecond < 1.8 || got.RequestsPerSecond > 2 {
+		t.Errorf("requests/s = %v, want about 2", got.RequestsPerSecond)
+	}
+	if got.ErrorRate != 0.1 || got.ClientErrorRate != 0.2 {
+		t.Errorf("error rate %v, client error rate %v, want 0.1 and 0.2", got.ErrorRate, got.ClientErrorRate)
+	}
+	if got.BlockedPerSecond <= 0 {
+		t.Errorf("blocked/s = %v", got.BlockedPerSecond)
+	}
+	if cache := got.Cache["sampled"]; cache.Lookups != 4 || cache.HitRate != 0.75 || cache.Errors != 1 {
+		t.Errorf("cache = %+v", cache)
+	}
+}
+
+func TestSampler_KeepsOneSampleBeforeWindow(t *testing.T) {
+	now := time.Now()
+	s := &Sampler{window: time.Minute, samples: []totals{{at: now.Add(-3 * time.Minute)}}}
+	s.sample(totals{at: now.Add(-90 * time.Second)})
+	s.sample(totals{at: now.Add(-30 * time.Second)})
+	s.sample(totals{at: now})
+
+	if len(s.samples) != 3 || !s.samples[0].at.Equal(now.Add(-90*time.Second)) {
+		t.Errorf("oldest sample at %v, want the last one before the window", now.Sub(s.samples[0].at))
+	}
+}
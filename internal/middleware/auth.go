@@ -1,18 +1,24 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"strings"
 
 	"highload-microservice/internal/models"
+	"highload-microservice/internal/rbac"
+	"highload-microservice/internal/security"
 	"highload-microservice/internal/services"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
 type AuthMiddleware struct {
 	authService *services.AuthService
+	auditor     *security.SecurityAuditor
+	sessions    *SessionCookies
 	logger      *logrus.Logger
 }
 
@@ -23,10 +29,32 @@ func NewAuthMiddleware(authService *services.AuthService, logger *logrus.Logger)
 	}
 }
 
+// SetAuditor records denied ownership checks as access_denied security events
+func (m *AuthMiddleware) SetAuditor(auditor *security.SecurityAuditor) {
+	m.auditor = auditor
+}
+
+// SetSessionCookies also accepts the access token cookie of browser
+// sessions; requests authenticated by it need a valid CSRF token
+func (m *AuthMiddleware) SetSessionCookies(sessions *SessionCookies) {
+	m.sessions = sessions
+}
+
 // RequireAuth middleware that requires JWT authentication
 func (m *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		token := m.extractToken(c)
+		fromCookie := false
+		if token == "" {
+			token = m.sessionToken(c)
+			fromCookie = token != ""
+		}
+		if token == "" && c.GetString("client_cert_subject") != "" {
+			// A service authenticated by its client certificate; routes
+			// check its permissions in RequirePermission
+			c.Next()
+			return
+		}
 		if token == "" {
 			m.logger.Warn("Authentication failed: no token provided")
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
@@ -34,13 +62,16 @@ func (m *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 			return
 		}
 
-		claims, err := m.authService.ValidateToken(token)
+		claims, err := m.authService.ValidateToken(c.Request.Context(), token)
 		if err != nil {
 			m.logger.Warnf("Authentication failed: invalid token - %v", err)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
+		if fromCookie && !m.sessions.ValidCSRF(c) {
+			return
+		}
 
 		// Add user info to context
 		c.Set("user_id", claims.UserID)
@@ -73,8 +104,8 @@ func (m *AuthMiddleware) RequireRole(requiredRole models.UserRole) gin.HandlerFu
 			return
 		}
 
-		// Check role permissions
-		if !m.hasPermission(userRole, requiredRole) {
+		// The role must be allowed everything the required role is
+		if !m.authService.Permissions().Covers(userRole, requiredRole) {
 			m.logger.Warnf("Authorization failed: insufficient permissions - user: %s, required: %s", userRole, requiredRole)
 			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
 			c.Abort()
@@ -86,6 +117,48 @@ func (m *AuthMiddleware) RequireRole(requiredRole models.UserRole) gin.HandlerFu
 	}
 }
 
+// RequirePermission middleware that requires the user's role to grant
+// permission in the role permission matrix. Services authenticated by client
+// certificate need it among their configured permissions instead.
+func (m *AuthMiddleware) RequirePermission(permission rbac.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, exists := c.Get("user_role")
+		if !exists {
+			if allowed, ok := clientCertAllows(c, permission); ok {
+				if !allowed {
+					m.logger.Warnf("Authorization failed: service %s lacks permission %s", c.GetString("client_cert_subject"), permission)
+					c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+					c.Abort()
+					return
+				}
+				c.Next()
+				return
+			}
+			m.logger.Warn("Authorization failed: user not authenticated")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			c.Abort()
+			return
+		}
+
+		userRole, ok := role.(models.UserRole)
+		if !ok {
+			m.logger.Error("Authorization failed: invalid role type")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			c.Abort()
+			return
+		}
+
+		if !m.authService.Permissions().Allows(userRole, permission) {
+			m.logger.Warnf("Authorization failed: role %s lacks permission %s", userRole, permission)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
 // RequireAPIKey middleware that requires API key authentication
 func (m *AuthMiddleware) RequireAPIKey() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -154,6 +227,62 @@ func (m *AuthMiddleware) RequireAPIPermission(requiredPermission string) gin.Han
 	}
 }
 
+// OwnerFunc reports whether the account authUserID owns the record id
+type OwnerFunc func(ctx context.Context, id, authUserID uuid.UUID) (bool, error)
+
+// RequireSelfOrRole allows a request on a record, identified by the param path
+// parameter, that owns reports as the caller's own, and lets roles covering
+// one of roles act on any record. It must run after RequireAuth.
+func (m *AuthMiddleware) RequireSelfOrRole(param string, owns OwnerFunc, roles ...models.UserRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, _ := c.Get("user_role")
+		userRole, roleOK := role.(models.UserRole)
+		id, _ := c.Get("user_id")
+		userID, idOK := id.(uuid.UUID)
+		if (!roleOK || !idOK) && c.GetString("client_cert_subject") != "" {
+			// Services own no records; admin access needs a user token
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			c.Abort()
+			return
+		}
+		if !roleOK || !idOK {
+			m.logger.Warn("Authorization failed: user not authenticated")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			c.Abort()
+			return
+		}
+
+		for _, allowed := range roles {
+			if m.authService.Permissions().Covers(userRole, allowed) {
+				c.Next()
+				return
+			}
+		}
+		// The record and the caller's account live in different tables, so
+		// ownership is looked up rather than compared by ID
+		if id, err := uuid.Parse(c.Param(param)); err == nil && owns != nil {
+			owned, err := owns(c.Request.Context(), id, userID)
+			if err != nil {
+				m.logger.Errorf("Authorization failed: ownership of %s: %v", id, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+				c.Abort()
+				return
+			}
+			if owned {
+				c.Next()
+				return
+			}
+		}
+
+		m.logger.Warnf("Authorization failed: user %s (%s) may not access %s of another user", userID, userRole, c.FullPath())
+		if m.auditor != nil {
+			m.auditor.LogAccessDenied(&userID, c.ClientIP(), c.GetHeader("User-Agent"), c.GetString("request_id"), c.Request.URL.Path, "not_owner")
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		c.Abort()
+	}
+}
+
 // OptionalAuth middleware that adds user info if token is provided but doesn't require it
 func (m *AuthMiddleware) OptionalAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -163,7 +292,7 @@ func (m *AuthMiddleware) OptionalAuth() gin.HandlerFunc {
 			return
 		}
 
-		claims, err := m.authService.ValidateToken(token)
+		claims, err := m.authService.ValidateToken(c.Request.Context(), token)
 		if err != nil {
 			m.logger.Debugf("Optional authentication failed: %v", err)
 			c.Next()
@@ -181,6 +310,25 @@ func (m *AuthMiddleware) OptionalAuth() gin.HandlerFunc {
 	}
 }
 
+// ResolveRole returns the role from a valid bearer token or session cookie
+// without requiring one. Used where auth has not run yet (e.g. rate limit
+// exemptions).
+func (m *AuthMiddleware) ResolveRole(c *gin.Context) string {
+	token := m.extractToken(c)
+	if token == "" {
+		token = m.sessionToken(c)
+	}
+	if token == "" {
+		return ""
+	}
+
+	claims, err := m.authService.ValidateToken(c.Request.Context(), token)
+	if err != nil {
+		return ""
+	}
+	return string(claims.Role)
+}
+
 // Helper methods
 
 func (m *AuthMiddleware) extractToken(c *gin.Context) string {
@@ -197,6 +345,14 @@ func (m *AuthMiddleware) extractToken(c *gin.Context) string {
 	return c.Query("token")
 }
 
+// sessionToken returns the access token cookie of a browser session, if any
+func (m *AuthMiddleware) sessionToken(c *gin.Context) string {
+	if m.sessions == nil {
+		return ""
+	}
+	return m.sessions.AccessToken(c)
+}
+
 func (m *AuthMiddleware) extractAPIKey(c *gin.Context) string {
 	// Try X-API-Key header first
 	apiKey := c.GetHeader("X-API-Key")
@@ -216,22 +372,3 @@ func (m *AuthMiddleware) extractAPIKey(c *gin.Context) string {
 	// Try query parameter
 	return c.Query("api_key")
 }
-
-func (m *AuthMiddleware) hasPermission(userRole, requiredRole models.UserRole) bool {
-	// Define role hierarchy
-	roleHierarchy := map[models.UserRole]int{
-		models.RoleReadOnly: 1,
-		models.RoleUser:     2,
-		models.RoleAdmin:    3,
-	}
-
-	userLevel, userExists := roleHierarchy[userRole]
-	requiredLevel, requiredExists := roleHierarchy[requiredRole]
-
-	if !userExists || !requiredExists {
-		return false
-	}
-
-	// User must have equal or higher level than required
-	return userLevel >= requiredLevel
-}
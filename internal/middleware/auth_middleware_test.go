@@ -1,12 +1,15 @@
 package middleware
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"highload-microservice/internal/models"
+	"highload-microservice/internal/rbac"
+	"highload-microservice/internal/security"
 	"highload-microservice/internal/services"
 
 	"github.com/gin-gonic/gin"
@@ -16,7 +19,7 @@ import (
 
 type stubAuthService struct{}
 
-func (s *stubAuthService) ValidateToken(token string) (*models.JWTClaims, error) {
+func (s *stubAuthService) ValidateToken(ctx context.Context, token string) (*models.JWTClaims, error) {
 	return nil, errors.New("not impl")
 }
 
@@ -60,3 +63,64 @@ func TestRequireRole_Denied(t *testing.T) {
 		t.Fatalf("want 403, got %d", w.Code)
 	}
 }
+
+func TestRequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := NewAuthMiddleware(&services.AuthService{}, logrus.New())
+
+	for role, want := range map[models.UserRole]int{
+		models.RoleUser:     http.StatusOK,
+		models.RoleReadOnly: http.StatusForbidden,
+	} {
+		r := gin.New()
+		r.POST("/events", func(c *gin.Context) {
+			c.Set("user_role", role)
+			c.Next()
+		}, m.RequirePermission(rbac.PermEventsWrite), func(c *gin.Context) { c.String(200, "ok") })
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/events", nil)
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Fatalf("role %s: want %d, got %d", role, want, w.Code)
+		}
+	}
+}
+
+func TestRequireSelfOrRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := NewAuthMiddleware(&services.AuthService{}, logrus.New())
+	m.SetAuditor(security.NewSecurityAuditor(logrus.New()))
+
+	// The caller's account owns one user record; its ID is not the account's
+	account, own, other := uuid.New(), uuid.New(), uuid.New()
+	owns := func(ctx context.Context, id, authUserID uuid.UUID) (bool, error) {
+		return id == own && authUserID == account, nil
+	}
+	serve := func(role models.UserRole, target uuid.UUID) int {
+		r := gin.New()
+		r.GET("/users/:id", func(c *gin.Context) {
+			c.Set("user_id", account)
+			c.Set("user_role", role)
+			c.Next()
+		}, m.RequireSelfOrRole("id", owns, models.RoleAdmin), func(c *gin.Context) { c.String(200, "ok") })
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/users/"+target.String(), nil)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := serve(models.RoleUser, own); code != http.StatusOK {
+		t.Fatalf("own record: want 200, got %d", code)
+	}
+	if code := serve(models.RoleUser, account); code != http.StatusForbidden {
+		t.Fatalf("record with the account's ID: want 403, got %d", code)
+	}
+	if code := serve(models.RoleUser, other); code != http.StatusForbidden {
+		t.Fatalf("other record: want 403, got %d", code)
+	}
+	if code := serve(models.RoleAdmin, other); code != http.StatusOK {
+		t.Fatalf("admin: want 200, got %d", code)
+	}
+}
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"highload-microservice/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// BulkheadConfig configures a Bulkhead
+type BulkheadConfig struct {
+	// MaxConcurrent requests of the group are handled at once
+	MaxConcurrent int
+	// QueueSize requests may wait up to QueueTimeout for a slot; 0 rejects
+	// at once
+	QueueSize    int
+	QueueTimeout time.Duration
+	// RetryAfter is sent with 503. Defaults to 1s.
+	RetryAfter time.Duration
+	// ExcludedRoutes take no slot (streams); a trailing * matches any suffix
+	ExcludedRoutes []string
+}
+
+// Bulkhead gives a route group its own pool of concurrent requests, so that
+// a flood of slow requests in one group (admin reports, security queries)
+// cannot take every connection to Postgres and Redis from the others.
+// Requests over the pool wait in a bounded queue and get 503 with
+// Retry-After when it is full or they are not served in time.
+type Bulkhead struct {
+	name   string
+	cfg    BulkheadConfig
+	logger *logrus.Logger
+
+	slots  chan struct{}
+	queued atomic.Int64
+}
+
+// NewBulkhead creates the pool of a route group. name labels its metrics.
+func NewBulkhead(name string, cfg BulkheadConfig, logger *logrus.Logger) *Bulkhead {
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = 1
+	}
+	if cfg.QueueSize < 0 {
+		cfg.QueueSize = 0
+	}
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = time.Second
+	}
+	b := &Bulkhead{
+		name:   name,
+		cfg:    cfg,
+		logger: logger,
+		slots:  make(chan struct{}, cfg.MaxConcurrent),
+	}
+	b.report()
+	return b
+}
+
+// Handler holds a slot of the pool while the rest of the chain runs
+func (b *Bulkhead) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.FullPath()
+		if path == "" {
+			path = c.Request.URL.Path
+		}
+		for _, pattern := range b.cfg.ExcludedRoutes {
+			if routeMatches(pattern, path) {
+				c.Next()
+				return
+			}
+		}
+
+		if !b.acquire(c.Request.Context()) {
+			metrics.BulkheadRejected(b.name)
+			b.logger.Warnf("Bulkhead %s full, rejected %s %s from %s", b.name, c.Request.Method, path, c.ClientIP())
+			seconds := int(math.Ceil(b.cfg.RetryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error":   "Service overloaded",
+				"message": "Too many requests in progress. Try again in " + strconv.Itoa(seconds) + " seconds",
+			})
+			return
+		}
+		defer b.release()
+		c.Next()
+	}
+}
+
+// acquire takes a slot, waiting in the queue while the pool is full
+func (b *Bulkhead) acquire(ctx context.Context) bool {
+	select {
+	case b.slots <- struct{}{}:
+		b.report()
+		return true
+	default:
+	}
+
+	if b.queued.Add(1) > int64(b.cfg.QueueSize) {
+		b.queued.Add(-1)
+		return false
+	}
+	b.report()
+	defer func() {
+		b.queued.Add(-1)
+		b.report()
+	}()
+
+	timer := time.NewTimer(b.cfg.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case b.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return false
+}
+
+func (b *Bulkhead) release() {
+	<-b.slots
+	b.report()
+}
+
+func (b *Bulkhead) report() {
+	metrics.SetBulkheadState(b.name, len(b.slots), int(b.queued.Load()))
+}
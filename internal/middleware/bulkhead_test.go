@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBulkheadIsolatesGroups(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	release := make(chan struct{})
+	slow := func(c *gin.Context) {
+		<-release
+		c.Status(http.StatusOK)
+	}
+
+	adminPool := NewBulkhead("admin-test", BulkheadConfig{
+		MaxConcurrent: 1, QueueSize: 1, QueueTimeout: time.Second,
+		RetryAfter: 3 * time.Second, ExcludedRoutes: []string{"/admin/stream"},
+	}, quietLogger())
+	admin := r.Group("/admin", adminPool.Handler())
+	admin.GET("/report", slow)
+	admin.GET("/stream", slow)
+	api := r.Group("/api", NewBulkhead("api-test", BulkheadConfig{MaxConcurrent: 1}, quietLogger()).Handler())
+	api.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	first := serve(r, "/admin/report")
+	waitFor(t, func() bool { return len(adminPool.slots) == 1 })
+	queued := serve(r, "/admin/report")
+	waitFor(t, func() bool { return adminPool.queued.Load() == 1 })
+
+	w := <-serve(r, "/admin/report")
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "3" {
+		t.Fatalf("full pool: got %d, Retry-After %q; want 503, 3", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := <-serve(r, "/api/ping"); w.Code != http.StatusOK {
+		t.Fatalf("other group: got %d, want 200", w.Code)
+	}
+	stream := serve(r, "/admin/stream")
+
+	close(release)
+	for _, done := range []<-chan *httptest.ResponseRecorder{first, queued, stream} {
+		if w := <-done; w.Code != http.StatusOK {
+			t.Errorf("got %d, want 200", w.Code)
+		}
+	}
+	if len(adminPool.slots) != 0 || adminPool.queued.Load() != 0 {
+		t.Errorf("leaked slots: %d in flight, %d queued", len(adminPool.slots), adminPool.queued.Load())
+	}
+}
+
+func TestBulkheadQueueTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	release := make(chan struct{})
+	defer close(release)
+	pool := NewBulkhead("timeout-test", BulkheadConfig{MaxConcurrent: 1, QueueSize: 1, QueueTimeout: 10 * time.Millisecond}, quietLogger())
+	r.GET("/slow", pool.Handler(), func(c *gin.Context) { <-release })
+
+	serve(r, "/slow")
+	waitFor(t, func() bool { return len(pool.slots) == 1 })
+	if w := <-serve(r, "/slow"); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got %d, want 503", w.Code)
+	}
+	if pool.queued.Load() != 0 {
+		t.Errorf("timed out request left in queue")
+	}
+}
@@ -0,0 +1,275 @@
+package middleware
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Content encodings produced by Compression
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+)
+
+// noCompressionKey marks a request whose response must not be compressed
+const noCompressionKey = "compression.skip"
+
+// CompressionConfig configures response compression
+type CompressionConfig struct {
+	MinSize       int      // responses smaller than this many bytes are sent as is
+	Level         int      // 1 (fastest) to 9 (smallest), -1 for the library default
+	ExcludedPaths []string // path prefixes that are never compressed
+}
+
+// alreadyCompressed lists content types that do not shrink any further
+var alreadyCompressed = []string{
+	"image/", "video/", "audio/", "application/zip", "application/gzip",
+	"application/x-gzip", "application/octet-stream", "font/woff",
+}
+
+// NoCompression opts a route out of response compression, e.g. streams whose
+// messages must reach the client as they are written
+func NoCompression() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(noCompressionKey, true)
+		c.Next()
+	}
+}
+
+// Compression compresses responses with gzip or deflate, as negotiated with
+// Accept-Encoding. The response is buffered until it reaches MinSize, so
+// small bodies are sent uncompressed; responses that are flushed early
+// (server-sent events), upgraded (WebSocket), already encoded or of an
+// already compressed content type pass through unchanged.
+func Compression(cfg CompressionConfig) gin.HandlerFunc {
+	pools := map[string]*sync.Pool{
+		EncodingGzip: {New: func() interface{} {
+			w, err := gzip.NewWriterLevel(io.Discard, cfg.Level)
+			if err != nil {
+				w = gzip.NewWriter(io.Discard)
+			}
+			return w
+		}},
+		EncodingDeflate: {New: func() interface{} {
+			w, err := flate.NewWriter(io.Discard, cfg.Level)
+			if err != nil {
+				w, _ = flate.NewWriter(io.Discard, flate.DefaultCompression)
+			}
+			return w
+		}},
+	}
+
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodHead || c.GetHeader("Upgrade") != "" || excludedPath(c.Request.URL.Path, cfg.ExcludedPaths) {
+			c.Next()
+			return
+		}
+		c.Header("Vary", "Accept-Encoding")
+
+		encoding := NegotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" {
+			c.Next()
+			return
+		}
+
+		w := &compressWriter{
+			ResponseWriter: c.Writer,
+			ctx:            c,
+			encoding:       encoding,
+			pool:           pools[encoding],
+			minSize:        cfg.MinSize,
+		}
+		c.Writer = w
+		defer func() {
+			w.finish()
+			c.Writer = w.ResponseWriter
+		}()
+
+		c.Next()
+	}
+}
+
+func excludedPath(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if prefix != "" && strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// NegotiateEncoding picks gzip or deflate from an Accept-Encoding header,
+// preferring gzip when the client weighs them equally, or "" for neither
+func NegotiateEncoding(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		candidates := []string{name}
+		if name == "*" {
+			candidates = []string{EncodingGzip, EncodingDeflate}
+		}
+		for _, candidate := range candidates {
+			if candidate != EncodingGzip && candidate != EncodingDeflate {
+				continue
+			}
+			if q > bestQ || (q == bestQ && q > 0 && candidate == EncodingGzip) {
+				best, bestQ = candidate, q
+			}
+		}
+	}
+	if bestQ <= 0 {
+		return ""
+	}
+	return best
+}
+
+type resettableWriter interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// compressWriter buffers the start of a response to decide whether it is
+// worth compressing
+type compressWriter struct {
+	gin.ResponseWriter
+	ctx      *gin.Context
+	encoding string
+	pool     *sync.Pool
+	minSize  int
+
+	buf     []byte
+	decided bool
+	encoder resettableWriter
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		if w.ctx.GetBool(noCompressionKey) {
+			if err := w.decide(false); err != nil {
+				return 0, err
+			}
+		} else {
+			w.buf = append(w.buf, data...)
+			if len(w.buf) < w.minSize {
+				return len(data), nil
+			}
+			if err := w.decide(w.compressible()); err != nil {
+				return 0, err
+			}
+			return len(data), nil
+		}
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Written reports buffered bytes as written, so later middleware does not
+// try to write a second response
+func (w *compressWriter) Written() bool {
+	return len(w.buf) > 0 || w.ResponseWriter.Written()
+}
+
+// WriteHeaderNow sends the headers; the response is then sent uncompressed
+func (w *compressWriter) WriteHeaderNow() {
+	if !w.decided {
+		_ = w.decide(false)
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Flush sends what was written so far. A response flushed before it was
+// compressed is a stream and is sent uncompressed.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		_ = w.decide(false)
+	}
+	if w.encoder != nil {
+		_ = w.encoder.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressWriter) compressible() bool {
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	status := w.Status()
+	if status == http.StatusNoContent || status == http.StatusNotModified || status < http.StatusOK {
+		return false
+	}
+	contentType := strings.ToLower(header.Get("Content-Type"))
+	for _, prefix := range alreadyCompressed {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// decide sends the buffered bytes, through the encoder if compress is set
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+	buf := w.buf
+	w.buf = nil
+
+	if compress {
+		header := w.Header()
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		w.encoder = w.pool.Get().(resettableWriter)
+		w.encoder.Reset(w.ResponseWriter)
+	}
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.encoder != nil {
+		_, err := w.encoder.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// finish sends a response that stayed below MinSize and completes the
+// compressed stream
+func (w *compressWriter) finish() {
+	if !w.decided && len(w.buf) > 0 {
+		_ = w.decide(false)
+	}
+	if w.encoder != nil {
+		_ = w.encoder.Close()
+		w.encoder.Reset(io.Discard)
+		w.pool.Put(w.encoder)
+		w.encoder = nil
+	}
+}
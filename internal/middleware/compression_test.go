@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func compressionRouter(cfg CompressionConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Compression(cfg))
+	large := strings.Repeat(`{"id":"00000000-0000-0000-0000-000000000000"},`, 100)
+	r.GET("/large", func(c *gin.Context) { c.String(http.StatusOK, large) })
+	r.GET("/small", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	r.GET("/opt-out", NoCompression(), func(c *gin.Context) { c.String(http.StatusOK, large) })
+	r.GET("/image", func(c *gin.Context) { c.Data(http.StatusOK, "image/png", []byte(large)) })
+	r.GET("/stream", func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		c.Writer.WriteString("data: 1\n\n")
+		c.Writer.Flush()
+		c.Writer.WriteString(large)
+	})
+	r.GET("/excluded/large", func(c *gin.Context) { c.String(http.StatusOK, large) })
+	return r
+}
+
+func get(r *gin.Engine, path, acceptEncoding string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCompression_Gzip(t *testing.T) {
+	r := compressionRouter(CompressionConfig{MinSize: 1024, Level: -1})
+
+	w := get(r, "/large", "br;q=1.0, gzip;q=0.8")
+	if w.Header().Get("Content-Encoding") != EncodingGzip {
+		t.Fatalf("expected gzip, got %q", w.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("read gzip body: %v", err)
+	}
+	if !strings.HasPrefix(string(body), `{"id":`) || len(body) < 1024 {
+		t.Fatalf("unexpected body after decompression: %d bytes", len(body))
+	}
+	if w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("expected Vary: Accept-Encoding")
+	}
+}
+
+func TestCompression_Deflate(t *testing.T) {
+	r := compressionRouter(CompressionConfig{MinSize: 1024, Level: 9})
+
+	w := get(r, "/large", "deflate")
+	if w.Header().Get("Content-Encoding") != EncodingDeflate {
+		t.Fatalf("expected deflate, got %q", w.Header().Get("Content-Encoding"))
+	}
+	body, err := io.ReadAll(flate.NewReader(w.Body))
+	if err != nil || len(body) < 1024 {
+		t.Fatalf("read deflate body: %d bytes, %v", len(body), err)
+	}
+}
+
+func TestCompression_PassThrough(t *testing.T) {
+	r := compressionRouter(CompressionConfig{MinSize: 1024, Level: -1, ExcludedPaths: []string{"/excluded"}})
+
+	cases := map[string]struct {
+		path           string
+		acceptEncoding string
+		body           string
+	}{
+		"not accepted":  {"/large", "", `{"id":`},
+		"refused":       {"/large", "gzip;q=0, deflate;q=0", `{"id":`},
+		"below minimum": {"/small", "gzip", "ok"},
+		"opted out":     {"/opt-out", "gzip", `{"id":`},
+		"excluded path": {"/excluded/large", "gzip", `{"id":`},
+		"compressed":    {"/image", "gzip", `{"id":`},
+		"flushed":       {"/stream", "gzip", "data: 1"},
+	}
+	for name, tc := range cases {
+		w := get(r, tc.path, tc.acceptEncoding)
+		if enc := w.Header().Get("Content-Encoding"); enc != "" {
+			t.Errorf("%s: expected no encoding, got %q", name, enc)
+		}
+		if !strings.HasPrefix(w.Body.String(), tc.body) {
+			t.Errorf("%s: unexpected body %.20q", name, w.Body.String())
+		}
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	cases := map[string]string{
+		"":                          "",
+		"gzip, deflate, br":         EncodingGzip,
+		"deflate":                   EncodingDeflate,
+		"gzip;q=0.5, deflate":       EncodingDeflate,
+		"*":                         EncodingGzip,
+		"identity":                  "",
+		"gzip;q=0":                  "",
+		"GZIP;q=bad, deflate;q=0.1": EncodingDeflate,
+	}
+	for header, want := range cases {
+		if got := NegotiateEncoding(header); got != want {
+			t.Errorf("%q: expected %q, got %q", header, want, got)
+		}
+	}
+}
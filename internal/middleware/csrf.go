@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"highload-microservice/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Session modes: how login, refresh and OIDC callbacks hand out tokens
+const (
+	SessionModeBearer = "bearer" // in the response body only
+	SessionModeCookie = "cookie" // in httpOnly cookies only
+	SessionModeBoth   = "both"   // in the body and in cookies
+)
+
+// Cookie and header names of cookie sessions
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	CSRFCookie         = "csrf_token"
+	CSRFHeader         = "X-CSRF-Token"
+)
+
+// refreshCookiePath limits the refresh token cookie to the API, whose
+// versions all serve the auth endpoints
+const refreshCookiePath = "/api"
+
+// SessionCookieConfig configures SessionCookies
+type SessionCookieConfig struct {
+	Mode       string // cookie or both; bearer disables cookies
+	Domain     string
+	Secure     bool
+	SameSite   string        // lax, strict or none
+	RefreshTTL time.Duration // lifetime of the refresh token cookie
+}
+
+// SessionCookies keeps the tokens of browser clients in httpOnly cookies.
+// State-changing requests authenticated by cookie must repeat the value of
+// the readable csrf_token cookie in the X-CSRF-Token header (double submit),
+// which a cross-site page can't do. Bearer tokens need no CSRF token.
+type SessionCookies struct {
+	cfg      SessionCookieConfig
+	sameSite http.SameSite
+	logger   *logrus.Logger
+}
+
+// NewSessionCookies creates the cookie session handling for cfg
+func NewSessionCookies(cfg SessionCookieConfig, logger *logrus.Logger) (*SessionCookies, error) {
+	if cfg.Mode != SessionModeCookie && cfg.Mode != SessionModeBoth {
+		return nil, fmt.Errorf("unknown session mode %q: expected bearer, cookie or both", cfg.Mode)
+	}
+
+	var sameSite http.SameSite
+	switch strings.ToLower(cfg.SameSite) {
+	case "", "lax":
+		sameSite = http.SameSiteLaxMode
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		if !cfg.Secure {
+			return nil, fmt.Errorf("SameSite=None cookies must be Secure")
+		}
+		sameSite = http.SameSiteNoneMode
+	default:
+		return nil, fmt.Errorf("unknown SameSite mode %q: expected lax, strict or none", cfg.SameSite)
+	}
+
+	return &SessionCookies{cfg: cfg, sameSite: sameSite, logger: logger}, nil
+}
+
+// Issue sets the token and CSRF cookies for a login or refresh response and
+// puts the CSRF token into it. In cookie mode the tokens are removed from
+// the body, so scripts never see them.
+func (s *SessionCookies) Issue(c *gin.Context, response *models.LoginResponse) error {
+	csrfToken, err := newCSRFToken()
+	if err != nil {
+		return err
+	}
+
+	s.setCookie(c, AccessTokenCookie, response.AccessToken, "/", int(response.ExpiresIn), true)
+	s.setCookie(c, RefreshTokenCookie, response.RefreshToken, refreshCookiePath, int(s.cfg.RefreshTTL.Seconds()), true)
+	s.setCookie(c, CSRFCookie, csrfToken, "/", int(s.cfg.RefreshTTL.Seconds()), false)
+
+	response.CSRFToken = csrfToken
+	if s.cfg.Mode == SessionModeCookie {
+		response.AccessToken = ""
+		response.RefreshToken = ""
+	}
+	return nil
+}
+
+// Clear expires the session cookies
+func (s *SessionCookies) Clear(c *gin.Context) {
+	s.setCookie(c, AccessTokenCookie, "", "/", -1, true)
+	s.setCookie(c, RefreshTokenCookie, "", refreshCookiePath, -1, true)
+	s.setCookie(c, CSRFCookie, "", "/", -1, false)
+}
+
+// AccessToken returns the access token cookie, empty when absent
+func (s *SessionCookies) AccessToken(c *gin.Context) string {
+	token, _ := c.Cookie(AccessTokenCookie)
+	return token
+}
+
+// RefreshToken returns the refresh token cookie, empty when absent
+func (s *SessionCookies) RefreshToken(c *gin.Context) string {
+	token, _ := c.Cookie(RefreshTokenCookie)
+	return token
+}
+
+// ValidCSRF reports whether a request authenticated by cookie may proceed:
+// safe methods always may, state-changing ones only with an X-CSRF-Token
+// header matching the csrf_token cookie. Otherwise it aborts with 403.
+func (s *SessionCookies) ValidCSRF(c *gin.Context) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+
+	expected, _ := c.Cookie(CSRFCookie)
+	actual := c.GetHeader(CSRFHeader)
+	if expected != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) == 1 {
+		return true
+	}
+	s.logger.Warnf("CSRF check failed for %s %s from %s", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+	c.JSON(http.StatusForbidden, gin.H{"error": "CSRF token missing or invalid"})
+	c.Abort()
+	return false
+}
+
+func (s *SessionCookies) setCookie(c *gin.Context, name, value, path string, maxAge int, httpOnly bool) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   s.cfg.Domain,
+		MaxAge:   maxAge,
+		Secure:   s.cfg.Secure,
+		HttpOnly: httpOnly,
+		SameSite: s.sameSite,
+	})
+}
+
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate CSRF token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestNewSessionCookies_Validation(t *testing.T) {
+	for _, cfg := range []SessionCookieConfig{
+		{Mode: SessionModeBearer},
+		{Mode: SessionModeCookie, SameSite: "loose"},
+		{Mode: SessionModeCookie, SameSite: "none", Secure: false},
+	} {
+		if _, err := NewSessionCookies(cfg, quietLogger()); err == nil {
+			t.Errorf("%+v: expected error", cfg)
+		}
+	}
+}
+
+func TestSessionCookies_Issue(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for mode, bodyTokens := range map[string]bool{SessionModeCookie: false, SessionModeBoth: true} {
+		sessions, err := NewSessionCookies(SessionCookieConfig{Mode: mode, Secure: true, SameSite: "strict", RefreshTTL: time.Hour}, quietLogger())
+		if err != nil {
+			t.Fatalf("sessions: %v", err)
+		}
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		response := &models.LoginResponse{AccessToken: "access", RefreshToken: "refresh", ExpiresIn: 60}
+		if err := sessions.Issue(c, response); err != nil {
+			t.Fatalf("issue: %v", err)
+		}
+
+		cookies := map[string]*http.Cookie{}
+		for _, cookie := range w.Result().Cookies() {
+			cookies[cookie.Name] = cookie
+		}
+		access, refresh, csrf := cookies[AccessTokenCookie], cookies[RefreshTokenCookie], cookies[CSRFCookie]
+		if access == nil || access.Value != "access" || !access.HttpOnly || !access.Secure || access.SameSite != http.SameSiteStrictMode || access.MaxAge != 60 {
+			t.Fatalf("%s: unexpected access cookie: %+v", mode, access)
+		}
+		if refresh == nil || refresh.Value != "refresh" || !refresh.HttpOnly || refresh.Path != refreshCookiePath {
+			t.Fatalf("%s: unexpected refresh cookie: %+v", mode, refresh)
+		}
+		if csrf == nil || csrf.HttpOnly || csrf.Value == "" || csrf.Value != response.CSRFToken {
+			t.Fatalf("%s: unexpected CSRF cookie: %+v (body %q)", mode, csrf, response.CSRFToken)
+		}
+		if (response.AccessToken != "") != bodyTokens || (response.RefreshToken != "") != bodyTokens {
+			t.Fatalf("%s: unexpected body tokens: %+v", mode, response)
+		}
+	}
+}
+
+func TestRequireAuth_CookieSessionNeedsCSRF(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	authService := services.NewAuthService(nil, nil, quietLogger(), services.AuthConfig{JWTSecret: "csrf-test-secret-csrf-test-secret"})
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": uuid.New().String(),
+		"email":   "u@example.com",
+		"role":    string(models.RoleUser),
+		"exp":     time.Now().Add(time.Hour).Unix(),
+		"iat":     time.Now().Unix(),
+		"iss":     "test",
+	}).SignedString([]byte("csrf-test-secret-csrf-test-secret"))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	sessions, _ := NewSessionCookies(SessionCookieConfig{Mode: SessionModeCookie}, quietLogger())
+	m := NewAuthMiddleware(authService, quietLogger())
+	m.SetSessionCookies(sessions)
+	r := gin.New()
+	r.Any("/p", m.RequireAuth(), func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	do := func(method string, cookies map[string]string, headers map[string]string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/p", strings.NewReader("{}"))
+		for name, value := range cookies {
+			req.AddCookie(&http.Cookie{Name: name, Value: value})
+		}
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	session := map[string]string{AccessTokenCookie: token, CSRFCookie: "csrf-value"}
+	cases := []struct {
+		name    string
+		method  string
+		cookies map[string]string
+		headers map[string]string
+		want    int
+	}{
+		{"safe method", http.MethodGet, session, nil, http.StatusOK},
+		{"missing header", http.MethodPost, session, nil, http.StatusForbidden},
+		{"wrong header", http.MethodDelete, session, map[string]string{CSRFHeader: "other"}, http.StatusForbidden},
+		{"matching header", http.MethodPost, session, map[string]string{CSRFHeader: "csrf-value"}, http.StatusOK},
+		{"bearer token", http.MethodPost, nil, map[string]string{"Authorization": "Bearer " + token}, http.StatusOK},
+		{"no credentials", http.MethodPost, nil, nil, http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		if got := do(tc.method, tc.cookies, tc.headers); got != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
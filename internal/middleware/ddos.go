@@ -1,91 +1,214 @@
 package middleware
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 
+	"highload-microservice/internal/metrics"
+	"highload-microservice/internal/security"
+
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
 
+// Supported DDoS protection state backends
+const (
+	DDoSBackendMemory = "memory"
+	DDoSBackendRedis  = "redis"
+)
+
+// DDoSStore holds request history and the blocklist used by DDoSProtection.
+// A shared store (Redis) makes blocks apply across all replicas.
+type DDoSStore interface {
+	// Hit records a request from ip at now and returns the number of requests
+	// from ip within the window ending at now
+	Hit(ctx context.Context, ip string, now time.Time, window time.Duration) (int, error)
+	// Block blocks block.IP until block.Until
+	Block(ctx context.Context, block DDoSBlock, now time.Time) error
+	// IsBlocked reports whether ip is blocked at now
+	IsBlocked(ctx context.Context, ip string, now time.Time) (bool, error)
+	// RecordOffense records that ip was blocked at now and returns how many
+	// times it was blocked within ttl
+	RecordOffense(ctx context.Context, ip string, now time.Time, ttl time.Duration) (int, error)
+	// ListBlocks returns the blocks active at now
+	ListBlocks(ctx context.Context, now time.Time) ([]DDoSBlock, error)
+	// Unblock lifts the block of ip and forgets its requests and offenses. It
+	// reports whether ip was blocked.
+	Unblock(ctx context.Context, ip string, now time.Time) (bool, error)
+	// Stats summarises the tracked state
+	Stats(ctx context.Context, now time.Time, window time.Duration) (DDoSStats, error)
+}
+
+// DDoSBlock is an IP blocked by DDoS protection
+type DDoSBlock struct {
+	IP        string    `json:"ip"`
+	Reason    string    `json:"reason"`
+	Offense   int       `json:"offense"` // 1 for a first block, 2 for the next within the offense TTL...
+	BlockedAt time.Time `json:"blocked_at"`
+	Until     time.Time `json:"until"`
+}
+
+// DDoSStats is a snapshot of DDoS protection state
+type DDoSStats struct {
+	TrackedIPs     int
+	ActiveRequests int
+	BlockedIPs     int
+}
+
 type DDoSProtection struct {
-	requests map[string][]time.Time
-	mutex    sync.RWMutex
-	logger   *logrus.Logger
+	store  DDoSStore
+	ipList IPList
+	logger *logrus.Logger
 
 	// Configuration
-	maxRequests     int           // Maximum requests per window
-	windowDuration  time.Duration // Time window
-	blockDuration   time.Duration // How long to block IP
-	cleanupInterval time.Duration // How often to cleanup old entries
+	backend    string
+	mu         sync.RWMutex
+	thresholds DDoSThresholds
 }
 
-type DDoSConfig struct {
-	MaxRequests     int           // Maximum requests per window (default: 100)
-	WindowDuration  time.Duration // Time window (default: 1 minute)
-	BlockDuration   time.Duration // Block duration (default: 5 minutes)
-	CleanupInterval time.Duration // Cleanup interval (default: 1 minute)
+// DDoSThresholds are the limits of DDoS protection, which can be changed at
+// runtime with SetThresholds
+type DDoSThresholds struct {
+	MaxRequests      int           // Maximum requests per window
+	WindowDuration   time.Duration // Time window
+	BlockDuration    time.Duration // How long to block IP on a first offense
+	MaxBlockDuration time.Duration // Cap of escalating blocks
+	OffenseTTL       time.Duration // How long a block counts towards escalation
 }
 
-func NewDDoSProtection(config DDoSConfig, logger *logrus.Logger) *DDoSProtection {
-	if config.MaxRequests == 0 {
-		config.MaxRequests = 100
+// withDefaults fills in zero thresholds
+func (t DDoSThresholds) withDefaults() DDoSThresholds {
+	if t.MaxRequests == 0 {
+		t.MaxRequests = 100
 	}
-	if config.WindowDuration == 0 {
-		config.WindowDuration = 1 * time.Minute
+	if t.WindowDuration == 0 {
+		t.WindowDuration = 1 * time.Minute
 	}
-	if config.BlockDuration == 0 {
-		config.BlockDuration = 5 * time.Minute
+	if t.BlockDuration == 0 {
+		t.BlockDuration = 5 * time.Minute
 	}
+	if t.MaxBlockDuration == 0 {
+		t.MaxBlockDuration = 24 * time.Hour
+	}
+	t.MaxBlockDuration = max(t.MaxBlockDuration, t.BlockDuration)
+	if t.OffenseTTL == 0 {
+		t.OffenseTTL = 24 * time.Hour
+	}
+	return t
+}
+
+type DDoSConfig struct {
+	MaxRequests      int           // Maximum requests per window (default: 100)
+	WindowDuration   time.Duration // Time window (default: 1 minute)
+	BlockDuration    time.Duration // Block duration of a first offense, doubled for each repeat (default: 5 minutes)
+	MaxBlockDuration time.Duration // Longest block of a repeat offender (default: 24 hours)
+	OffenseTTL       time.Duration // How long a block counts as a previous offense (default: 24 hours)
+	CleanupInterval  time.Duration // Cleanup interval of the in-memory store (default: 1 minute)
+
+	// Store holds request history and blocks; nil keeps them in process memory
+	Store DDoSStore
+}
+
+func NewDDoSProtection(config DDoSConfig, logger *logrus.Logger) *DDoSProtection {
+	thresholds := DDoSThresholds{
+		MaxRequests:      config.MaxRequests,
+		WindowDuration:   config.WindowDuration,
+		BlockDuration:    config.BlockDuration,
+		MaxBlockDuration: config.MaxBlockDuration,
+		OffenseTTL:       config.OffenseTTL,
+	}.withDefaults()
 	if config.CleanupInterval == 0 {
 		config.CleanupInterval = 1 * time.Minute
 	}
 
-	ddos := &DDoSProtection{
-		requests:        make(map[string][]time.Time),
-		logger:          logger,
-		maxRequests:     config.MaxRequests,
-		windowDuration:  config.WindowDuration,
-		blockDuration:   config.BlockDuration,
-		cleanupInterval: config.CleanupInterval,
+	backend := DDoSBackendRedis
+	if config.Store == nil {
+		config.Store = NewMemoryDDoSStore(config.CleanupInterval, thresholds.WindowDuration)
+		backend = DDoSBackendMemory
+	}
+
+	return &DDoSProtection{
+		store:      config.Store,
+		logger:     logger,
+		backend:    backend,
+		thresholds: thresholds,
 	}
+}
 
-	// Start cleanup goroutine
-	go ddos.cleanup()
+// Thresholds returns the limits in effect
+func (d *DDoSProtection) Thresholds() DDoSThresholds {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.thresholds
+}
 
-	return ddos
+// SetThresholds changes the limits; zero values take the defaults. Request
+// history and existing blocks are kept.
+func (d *DDoSProtection) SetThresholds(thresholds DDoSThresholds) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.thresholds = thresholds.withDefaults()
 }
 
-// Protect middleware that implements DDoS protection
+// SetIPList makes Protect consult the operator-managed IP rules before its
+// own checks: blocklisted IPs are rejected, allowlisted IPs skip protection
+func (d *DDoSProtection) SetIPList(list IPList) {
+	d.ipList = list
+}
+
+// Protect middleware that implements DDoS protection. Store errors are
+// logged and the request is let through.
 func (d *DDoSProtection) Protect() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if d.ipList != nil {
+			switch d.ipList.Check(c.ClientIP()) {
+			case security.IPActionBlock:
+				metrics.RequestBlocked(metrics.BlockIPRule)
+				rejectBlockedIP(c)
+				return
+			case security.IPActionAllow:
+				c.Next()
+				return
+			}
+		}
+		if isRateLimitExempt(c) {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
 		clientIP := c.ClientIP()
 		now := time.Now()
+		thresholds := d.Thresholds()
 
 		// Check if IP is blocked
-		if d.isBlocked(clientIP, now) {
+		blocked, err := d.store.IsBlocked(ctx, clientIP, now)
+		if err != nil {
+			d.logger.Errorf("DDoS protection: failed to check blocklist for %s: %v", clientIP, err)
+		}
+		if blocked {
+			metrics.RequestBlocked(metrics.BlockBlockedIP)
 			d.logger.Warnf("Blocked request from IP: %s (DDoS protection)", clientIP)
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error":   "Request blocked",
-				"message": "Your IP has been temporarily blocked due to suspicious activity.",
-			})
-			c.Abort()
+			d.reject(c)
 			return
 		}
 
-		// Record request
-		d.recordRequest(clientIP, now)
-
-		// Check if IP should be blocked
-		if d.shouldBlock(clientIP, now) {
-			d.blockIP(clientIP, now)
-			d.logger.Warnf("IP blocked due to DDoS: %s", clientIP)
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error":   "Request blocked",
-				"message": "Your IP has been temporarily blocked due to suspicious activity.",
-			})
-			c.Abort()
+		// Record request and block the IP once it exceeds the window limit
+		count, err := d.store.Hit(ctx, clientIP, now, thresholds.WindowDuration)
+		if err != nil {
+			d.logger.Errorf("DDoS protection: failed to record request from %s: %v", clientIP, err)
+			c.Next()
+			return
+		}
+		if count > thresholds.MaxRequests {
+			block := d.block(ctx, thresholds, clientIP, count, now)
+			metrics.RequestBlocked(metrics.BlockDDoS)
+			d.logger.Warnf("IP blocked due to DDoS: %s (offense %d, until %s)", clientIP, block.Offense, block.Until.Format(time.RFC3339))
+			d.reject(c)
 			return
 		}
 
@@ -93,133 +216,233 @@ func (d *DDoSProtection) Protect() gin.HandlerFunc {
 	}
 }
 
-// isBlocked checks if an IP is currently blocked
-func (d *DDoSProtection) isBlocked(ip string, now time.Time) bool {
-	d.mutex.RLock()
-	defer d.mutex.RUnlock()
-
-	requests, exists := d.requests[ip]
-	if !exists {
-		return false
+// block blocks ip for the block duration, doubled for each earlier offense
+// within the offense TTL
+func (d *DDoSProtection) block(ctx context.Context, thresholds DDoSThresholds, ip string, count int, now time.Time) DDoSBlock {
+	offense, err := d.store.RecordOffense(ctx, ip, now, thresholds.OffenseTTL)
+	if err != nil {
+		d.logger.Errorf("DDoS protection: failed to record offense of %s: %v", ip, err)
 	}
+	offense = max(offense, 1)
 
-	// Check if the last request was within block duration
-	if len(requests) > 0 {
-		lastRequest := requests[len(requests)-1]
-		if now.Sub(lastRequest) < d.blockDuration {
-			return true
-		}
+	duration := thresholds.BlockDuration
+	for i := 1; i < offense && duration < thresholds.MaxBlockDuration; i++ {
+		duration *= 2
 	}
+	duration = min(duration, thresholds.MaxBlockDuration)
+
+	block := DDoSBlock{
+		IP:        ip,
+		Reason:    fmt.Sprintf("%d requests within %s exceeded the limit of %d", count, thresholds.WindowDuration, thresholds.MaxRequests),
+		Offense:   offense,
+		BlockedAt: now,
+		Until:     now.Add(duration),
+	}
+	if err := d.store.Block(ctx, block, now); err != nil {
+		d.logger.Errorf("DDoS protection: failed to block %s: %v", ip, err)
+	}
+	return block
+}
 
-	return false
+// Blocks returns the active blocks, longest remaining first
+func (d *DDoSProtection) Blocks(ctx context.Context) ([]DDoSBlock, error) {
+	blocks, err := d.store.ListBlocks(ctx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Until.After(blocks[j].Until) })
+	return blocks, nil
 }
 
-// recordRequest records a request from an IP
-func (d *DDoSProtection) recordRequest(ip string, now time.Time) {
-	d.mutex.Lock()
-	defer d.mutex.Unlock()
+// Unblock lifts the block of ip and resets its escalation. It reports
+// whether ip was blocked.
+func (d *DDoSProtection) Unblock(ctx context.Context, ip string) (bool, error) {
+	return d.store.Unblock(ctx, ip, time.Now())
+}
 
-	// Add current request
-	d.requests[ip] = append(d.requests[ip], now)
+func (d *DDoSProtection) reject(c *gin.Context) {
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":   "Request blocked",
+		"message": "Your IP has been temporarily blocked due to suspicious activity.",
+	})
+	c.Abort()
 }
 
-// shouldBlock determines if an IP should be blocked
-func (d *DDoSProtection) shouldBlock(ip string, now time.Time) bool {
-	d.mutex.RLock()
-	defer d.mutex.RUnlock()
+// GetStats returns current protection statistics
+func (d *DDoSProtection) GetStats() map[string]interface{} {
+	thresholds := d.Thresholds()
+	stats := map[string]interface{}{
+		"backend":         d.backend,
+		"max_requests":    thresholds.MaxRequests,
+		"window_duration": thresholds.WindowDuration.String(),
+		"block_duration":  thresholds.BlockDuration.String(),
+		"max_block":       thresholds.MaxBlockDuration.String(),
+		"offense_ttl":     thresholds.OffenseTTL.String(),
+	}
 
-	requests, exists := d.requests[ip]
-	if !exists {
-		return false
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	snapshot, err := d.store.Stats(ctx, time.Now(), thresholds.WindowDuration)
+	if err != nil {
+		d.logger.Errorf("DDoS protection: failed to collect stats: %v", err)
+		stats["error"] = "stats unavailable"
+		return stats
 	}
 
-	// Count requests within the window
-	windowStart := now.Add(-d.windowDuration)
-	count := 0
+	stats["total_ips"] = snapshot.TrackedIPs
+	stats["active_requests"] = snapshot.ActiveRequests
+	stats["blocked_ips"] = snapshot.BlockedIPs
+	return stats
+}
+
+// MemoryDDoSStore keeps DDoS state in process memory. Blocks only apply to
+// the replica that issued them.
+type MemoryDDoSStore struct {
+	mutex    sync.Mutex
+	requests map[string][]time.Time
+	blocked  map[string]DDoSBlock
+	offenses map[string][]time.Time
+	// window is the last window passed to Hit, for cleanup
+	window time.Duration
+	// offenseTTL is the last TTL passed to RecordOffense, for cleanup
+	offenseTTL time.Duration
+}
 
-	for _, reqTime := range requests {
-		if reqTime.After(windowStart) {
-			count++
-		}
+// NewMemoryDDoSStore creates an in-memory store and starts a goroutine that
+// drops request history older than window and expired blocks
+func NewMemoryDDoSStore(cleanupInterval, window time.Duration) *MemoryDDoSStore {
+	s := &MemoryDDoSStore{
+		requests: make(map[string][]time.Time),
+		blocked:  make(map[string]DDoSBlock),
+		offenses: make(map[string][]time.Time),
+		window:   window,
 	}
+	go s.cleanup(cleanupInterval)
+	return s
+}
 
-	return count > d.maxRequests
+func (s *MemoryDDoSStore) Hit(ctx context.Context, ip string, now time.Time, window time.Duration) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.window = window
+	requests := pruneBefore(s.requests[ip], now.Add(-window))
+	requests = append(requests, now)
+	s.requests[ip] = requests
+	return len(requests), nil
 }
 
-// blockIP blocks an IP by adding a special marker
-func (d *DDoSProtection) blockIP(ip string, now time.Time) {
-	d.mutex.Lock()
-	defer d.mutex.Unlock()
+func (s *MemoryDDoSStore) Block(ctx context.Context, block DDoSBlock, now time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-	// Add a special "blocked" timestamp
-	d.requests[ip] = append(d.requests[ip], now)
+	s.blocked[block.IP] = block
+	return nil
 }
 
-// cleanup removes old entries to prevent memory leaks
-func (d *DDoSProtection) cleanup() {
-	ticker := time.NewTicker(d.cleanupInterval)
-	defer ticker.Stop()
+func (s *MemoryDDoSStore) IsBlocked(ctx context.Context, ip string, now time.Time) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-	for range ticker.C {
-		d.mutex.Lock()
-		now := time.Now()
-		cutoff := now.Add(-d.blockDuration * 2) // Keep some history
-
-		for ip, requests := range d.requests {
-			// Remove old requests
-			var newRequests []time.Time
-			for _, reqTime := range requests {
-				if reqTime.After(cutoff) {
-					newRequests = append(newRequests, reqTime)
-				}
-			}
+	block, ok := s.blocked[ip]
+	return ok && now.Before(block.Until), nil
+}
 
-			if len(newRequests) == 0 {
-				delete(d.requests, ip)
-			} else {
-				d.requests[ip] = newRequests
-			}
+func (s *MemoryDDoSStore) RecordOffense(ctx context.Context, ip string, now time.Time, ttl time.Duration) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	offenses := append(pruneBefore(s.offenses[ip], now.Add(-ttl)), now)
+	s.offenses[ip] = offenses
+	s.offenseTTL = ttl
+	return len(offenses), nil
+}
+
+func (s *MemoryDDoSStore) ListBlocks(ctx context.Context, now time.Time) ([]DDoSBlock, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	blocks := make([]DDoSBlock, 0, len(s.blocked))
+	for _, block := range s.blocked {
+		if now.Before(block.Until) {
+			blocks = append(blocks, block)
 		}
-		d.mutex.Unlock()
 	}
+	return blocks, nil
 }
 
-// GetStats returns current protection statistics
-func (d *DDoSProtection) GetStats() map[string]interface{} {
-	d.mutex.RLock()
-	defer d.mutex.RUnlock()
-
-	now := time.Now()
-	windowStart := now.Add(-d.windowDuration)
+func (s *MemoryDDoSStore) Unblock(ctx context.Context, ip string, now time.Time) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-	stats := map[string]interface{}{
-		"total_ips":       len(d.requests),
-		"max_requests":    d.maxRequests,
-		"window_duration": d.windowDuration.String(),
-		"block_duration":  d.blockDuration.String(),
-		"active_requests": 0,
-		"blocked_ips":     0,
-	}
+	block, ok := s.blocked[ip]
+	delete(s.blocked, ip)
+	delete(s.requests, ip)
+	delete(s.offenses, ip)
+	return ok && now.Before(block.Until), nil
+}
 
-	activeRequests := 0
-	blockedIPs := 0
+func (s *MemoryDDoSStore) Stats(ctx context.Context, now time.Time, window time.Duration) (DDoSStats, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-	for ip, requests := range d.requests {
-		// Count active requests
+	stats := DDoSStats{TrackedIPs: len(s.requests)}
+	windowStart := now.Add(-window)
+	for _, requests := range s.requests {
 		for _, reqTime := range requests {
 			if reqTime.After(windowStart) {
-				activeRequests++
+				stats.ActiveRequests++
 			}
 		}
-
-		// Check if IP is blocked
-		if d.isBlocked(ip, now) {
-			blockedIPs++
+	}
+	for _, block := range s.blocked {
+		if now.Before(block.Until) {
+			stats.BlockedIPs++
 		}
 	}
+	return stats, nil
+}
+
+// cleanup removes old entries to prevent memory leaks
+func (s *MemoryDDoSStore) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	stats["active_requests"] = activeRequests
-	stats["blocked_ips"] = blockedIPs
+	for range ticker.C {
+		s.mutex.Lock()
+		now := time.Now()
+		cutoff := now.Add(-s.window)
 
-	return stats
+		for ip, requests := range s.requests {
+			if requests = pruneBefore(requests, cutoff); len(requests) == 0 {
+				delete(s.requests, ip)
+			} else {
+				s.requests[ip] = requests
+			}
+		}
+		for ip, block := range s.blocked {
+			if !now.Before(block.Until) {
+				delete(s.blocked, ip)
+			}
+		}
+		for ip, offenses := range s.offenses {
+			if offenses = pruneBefore(offenses, now.Add(-s.offenseTTL)); len(offenses) == 0 {
+				delete(s.offenses, ip)
+			} else {
+				s.offenses[ip] = offenses
+			}
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// pruneBefore drops the leading timestamps that are not after cutoff;
+// requests are appended in order so the remainder is all in the window
+func pruneBefore(requests []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(requests) && !requests[i].After(cutoff) {
+		i++
+	}
+	return requests[i:]
 }
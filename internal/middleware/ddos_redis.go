@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"highload-microservice/internal/redis"
+)
+
+// RedisDDoSStore shares DDoS state between replicas and keeps blocks across
+// restarts. Each IP's requests are kept in a sorted set scored by time
+// (<prefix>req:<ip>), blocks are JSON keys that expire with the block
+// (<prefix>block:<ip>) and offenses are a sorted set like requests
+// (<prefix>offense:<ip>).
+type RedisDDoSStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisDDoSStore creates a Redis-backed store; an empty prefix defaults to "ddos:"
+func NewRedisDDoSStore(client *redis.Client, prefix string) *RedisDDoSStore {
+	if prefix == "" {
+		prefix = "ddos:"
+	}
+	return &RedisDDoSStore{client: client, prefix: prefix}
+}
+
+func (s *RedisDDoSStore) requestKey(ip string) string { return s.prefix + "req:" + ip }
+func (s *RedisDDoSStore) blockKey(ip string) string   { return s.prefix + "block:" + ip }
+func (s *RedisDDoSStore) offenseKey(ip string) string { return s.prefix + "offense:" + ip }
+
+func (s *RedisDDoSStore) Hit(ctx context.Context, ip string, now time.Time, window time.Duration) (int, error) {
+	count, err := s.client.SlidingWindowAdd(ctx, s.requestKey(ip), now, window)
+	return int(count), err
+}
+
+func (s *RedisDDoSStore) Block(ctx context.Context, block DDoSBlock, now time.Time) error {
+	data, err := json.Marshal(block)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.blockKey(block.IP), data, block.Until.Sub(now))
+}
+
+// getBlock reads the block of ip; ok is false when there is none
+func (s *RedisDDoSStore) getBlock(ctx context.Context, ip string) (block DDoSBlock, ok bool, err error) {
+	value, err := s.client.Get(ctx, s.blockKey(ip))
+	if err != nil {
+		if redis.IsNil(err) {
+			return block, false, nil
+		}
+		return block, false, err
+	}
+	if json.Unmarshal([]byte(value), &block) == nil {
+		return block, true, nil
+	}
+	// Blocks written before block details were stored hold the Unix time
+	// they end; unreadable entries block until the key expires
+	block = DDoSBlock{IP: ip, Until: time.Now().Add(time.Minute)}
+	if until, err := strconv.ParseInt(value, 10, 64); err == nil {
+		block.Until = time.Unix(until, 0)
+	}
+	return block, true, nil
+}
+
+func (s *RedisDDoSStore) IsBlocked(ctx context.Context, ip string, now time.Time) (bool, error) {
+	block, ok, err := s.getBlock(ctx, ip)
+	return ok && now.Before(block.Until), err
+}
+
+func (s *RedisDDoSStore) RecordOffense(ctx context.Context, ip string, now time.Time, ttl time.Duration) (int, error) {
+	count, err := s.client.SlidingWindowAdd(ctx, s.offenseKey(ip), now, ttl)
+	return int(count), err
+}
+
+// ListBlocks scans the key space, so it is meant for the admin endpoint only
+func (s *RedisDDoSStore) ListBlocks(ctx context.Context, now time.Time) ([]DDoSBlock, error) {
+	blocks := []DDoSBlock{}
+	err := s.client.ScanKeys(ctx, s.prefix+"block:*", func(keys []string) error {
+		for _, key := range keys {
+			block, ok, err := s.getBlock(ctx, strings.TrimPrefix(key, s.prefix+"block:"))
+			if err != nil {
+				return err
+			}
+			if ok && now.Before(block.Until) {
+				blocks = append(blocks, block)
+			}
+		}
+		return nil
+	})
+	return blocks, err
+}
+
+func (s *RedisDDoSStore) Unblock(ctx context.Context, ip string, now time.Time) (bool, error) {
+	blocked, err := s.IsBlocked(ctx, ip, now)
+	if err != nil {
+		return false, err
+	}
+	return blocked, s.client.Del(ctx, s.blockKey(ip), s.requestKey(ip), s.offenseKey(ip))
+}
+
+// Stats scans the key space, so it is meant for the admin endpoint only
+func (s *RedisDDoSStore) Stats(ctx context.Context, now time.Time, window time.Duration) (DDoSStats, error) {
+	var stats DDoSStats
+	err := s.client.ScanKeys(ctx, s.prefix+"req:*", func(keys []string) error {
+		for _, key := range keys {
+			count, err := s.client.SlidingWindowCount(ctx, key, now, window)
+			if err != nil {
+				return err
+			}
+			stats.TrackedIPs++
+			stats.ActiveRequests += int(count)
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+	err = s.client.ScanKeys(ctx, s.prefix+"block:*", func(keys []string) error {
+		stats.BlockedIPs += len(keys)
+		return nil
+	})
+	return stats, err
+}
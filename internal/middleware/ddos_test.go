@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -33,3 +35,142 @@ func TestDDoS_BlockAfterThreshold(t *testing.T) {
 		t.Fatalf("expected 429, got %d", w2.Code)
 	}
 }
+
+func TestMemoryDDoSStore_BlockExpires(t *testing.T) {
+	store := NewMemoryDDoSStore(time.Minute, time.Second)
+	ctx := context.Background()
+	now := time.Now()
+
+	if err := store.Block(ctx, DDoSBlock{IP: "10.0.0.1", BlockedAt: now, Until: now.Add(time.Second)}, now); err != nil {
+		t.Fatalf("block: %v", err)
+	}
+	if blocked, _ := store.IsBlocked(ctx, "10.0.0.1", now); !blocked {
+		t.Fatalf("expected IP to be blocked")
+	}
+	if blocked, _ := store.IsBlocked(ctx, "10.0.0.2", now); blocked {
+		t.Fatalf("unrelated IP must not be blocked")
+	}
+	if blocked, _ := store.IsBlocked(ctx, "10.0.0.1", now.Add(2*time.Second)); blocked {
+		t.Fatalf("block should have expired")
+	}
+
+	// Requests older than the window no longer count
+	store.Hit(ctx, "10.0.0.1", now, time.Second)
+	if n, _ := store.Hit(ctx, "10.0.0.1", now.Add(2*time.Second), time.Second); n != 1 {
+		t.Fatalf("expected 1 request in window, got %d", n)
+	}
+}
+
+type failingDDoSStore struct{}
+
+func (failingDDoSStore) Hit(context.Context, string, time.Time, time.Duration) (int, error) {
+	return 0, errors.New("unavailable")
+}
+func (failingDDoSStore) Block(context.Context, DDoSBlock, time.Time) error {
+	return errors.New("unavailable")
+}
+func (failingDDoSStore) RecordOffense(context.Context, string, time.Time, time.Duration) (int, error) {
+	return 0, errors.New("unavailable")
+}
+func (failingDDoSStore) ListBlocks(context.Context, time.Time) ([]DDoSBlock, error) {
+	return nil, errors.New("unavailable")
+}
+func (failingDDoSStore) Unblock(context.Context, string, time.Time) (bool, error) {
+	return false, errors.New("unavailable")
+}
+func (failingDDoSStore) IsBlocked(context.Context, string, time.Time) (bool, error) {
+	return false, errors.New("unavailable")
+}
+func (failingDDoSStore) Stats(context.Context, time.Time, time.Duration) (DDoSStats, error) {
+	return DDoSStats{}, errors.New("unavailable")
+}
+
+func TestDDoS_StoreErrorsFailOpen(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ddos := NewDDoSProtection(DDoSConfig{MaxRequests: 1, Store: failingDDoSStore{}}, logrus.New())
+	r := gin.New()
+	r.Use(ddos.Protect())
+	r.GET("/", func(c *gin.Context) { c.String(200, "ok") })
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		r.ServeHTTP(w, req)
+		if w.Code != 200 {
+			t.Fatalf("request %d: expected 200, got %d", i, w.Code)
+		}
+	}
+}
+
+func TestDDoS_EscalatesRepeatOffendersAndUnblocks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := NewMemoryDDoSStore(time.Minute, time.Minute)
+	ddos := NewDDoSProtection(DDoSConfig{MaxRequests: 1, BlockDuration: time.Minute, MaxBlockDuration: 3 * time.Minute, Store: store}, logrus.New())
+	r := gin.New()
+	r.Use(ddos.Protect())
+	r.GET("/", func(c *gin.Context) { c.String(200, "ok") })
+	get := func() int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "10.0.0.7:1234"
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Each offense doubles the block, up to the maximum
+	ctx := context.Background()
+	for offense, want := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute} {
+		if code := get(); code != 200 {
+			t.Fatalf("offense %d: first request got %d", offense+1, code)
+		}
+		if code := get(); code != http.StatusTooManyRequests {
+			t.Fatalf("offense %d: want 429, got %d", offense+1, code)
+		}
+		blocks, err := ddos.Blocks(ctx)
+		if err != nil || len(blocks) != 1 {
+			t.Fatalf("want 1 block, got %v (%v)", blocks, err)
+		}
+		if b := blocks[0]; b.IP != "10.0.0.7" || b.Offense != offense+1 || b.Until.Sub(b.BlockedAt) != want || b.Reason == "" {
+			t.Fatalf("offense %d: unexpected block %+v", offense+1, b)
+		}
+		if ok, err := ddos.Unblock(ctx, "10.0.0.7"); !ok || err != nil {
+			t.Fatalf("unblock: %v %v", ok, err)
+		}
+		// Unblocking resets the escalation; keep the offenses for the next round
+		for i := 0; i <= offense; i++ {
+			_, _ = store.RecordOffense(ctx, "10.0.0.7", time.Now(), time.Hour)
+		}
+	}
+
+	if ok, _ := ddos.Unblock(ctx, "10.0.0.8"); ok {
+		t.Fatal("want false for an IP that is not blocked")
+	}
+	if blocks, _ := ddos.Blocks(ctx); len(blocks) != 0 {
+		t.Fatalf("want no blocks, got %v", blocks)
+	}
+}
+
+func TestDDoS_SetThresholds(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ddos := NewDDoSProtection(DDoSConfig{MaxRequests: 1, WindowDuration: time.Minute}, logrus.New())
+	r := gin.New()
+	r.Use(ddos.Protect())
+	r.GET("/", func(c *gin.Context) { c.String(200, "ok") })
+
+	ddos.SetThresholds(DDoSThresholds{MaxRequests: 3, WindowDuration: time.Minute})
+	if got := ddos.Thresholds(); got.MaxRequests != 3 || got.BlockDuration != 5*time.Minute {
+		t.Fatalf("unexpected thresholds %+v", got)
+	}
+	for i := 0; i < 4; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		r.ServeHTTP(w, req)
+		want := 200
+		if i == 3 {
+			want = http.StatusTooManyRequests
+		}
+		if w.Code != want {
+			t.Fatalf("request %d: got %d, want %d", i+1, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// rateLimitExemptKey marks a request as exempt from RateLimit/DDoS checks
+const rateLimitExemptKey = "rate_limit_exempt"
+
+// RoleResolver returns the role of the caller, or "" if unauthenticated.
+// Exemptions run before route-level auth, so the role has to be resolved
+// from the request itself.
+type RoleResolver func(c *gin.Context) string
+
+type ExemptionConfig struct {
+	CIDRs   []string // IPs or CIDR ranges (health checkers, internal networks)
+	APIKeys []string // raw API keys sent in X-API-Key (batch jobs)
+	Roles   []string // user roles taken from a valid bearer token
+}
+
+// RateLimitExemptions decides which trusted callers bypass rate limiting and DDoS protection
+type RateLimitExemptions struct {
+	networks     []*net.IPNet
+	apiKeys      map[string]struct{}
+	roles        map[string]struct{}
+	resolveRole  RoleResolver
+	logger       *logrus.Logger
+	mutex        sync.Mutex
+	exemptCounts map[string]int64
+}
+
+func NewRateLimitExemptions(config ExemptionConfig, resolveRole RoleResolver, logger *logrus.Logger) (*RateLimitExemptions, error) {
+	e := &RateLimitExemptions{
+		apiKeys:      make(map[string]struct{}),
+		roles:        make(map[string]struct{}),
+		resolveRole:  resolveRole,
+		logger:       logger,
+		exemptCounts: make(map[string]int64),
+	}
+
+	for _, raw := range config.CIDRs {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		if !strings.Contains(raw, "/") {
+			if ip := net.ParseIP(raw); ip != nil && ip.To4() != nil {
+				raw += "/32"
+			} else {
+				raw += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exempt CIDR %q: %w", raw, err)
+		}
+		e.networks = append(e.networks, network)
+	}
+	for _, key := range config.APIKeys {
+		if key = strings.TrimSpace(key); key != "" {
+			e.apiKeys[key] = struct{}{}
+		}
+	}
+	for _, role := range config.Roles {
+		if role = strings.TrimSpace(role); role != "" {
+			e.roles[role] = struct{}{}
+		}
+	}
+
+	return e, nil
+}
+
+// Mark flags exempt requests so that RateLimit and DDoS middleware skip them.
+// It must be registered before those middleware.
+func (e *RateLimitExemptions) Mark() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if reason := e.match(c); reason != "" {
+			c.Set(rateLimitExemptKey, true)
+			e.mutex.Lock()
+			e.exemptCounts[reason]++
+			e.mutex.Unlock()
+			e.logger.Debugf("Rate limit exemption (%s) for IP: %s", reason, c.ClientIP())
+		}
+		c.Next()
+	}
+}
+
+// match returns the reason the request is exempt, or "" if it is not
+func (e *RateLimitExemptions) match(c *gin.Context) string {
+	if len(e.networks) > 0 {
+		if ip := net.ParseIP(c.ClientIP()); ip != nil {
+			for _, network := range e.networks {
+				if network.Contains(ip) {
+					return "ip"
+				}
+			}
+		}
+	}
+
+	if len(e.apiKeys) > 0 {
+		if key := c.GetHeader("X-API-Key"); key != "" {
+			if _, ok := e.apiKeys[key]; ok {
+				return "api_key"
+			}
+		}
+	}
+
+	if len(e.roles) > 0 && e.resolveRole != nil {
+		if role := e.resolveRole(c); role != "" {
+			if _, ok := e.roles[role]; ok {
+				return "role"
+			}
+		}
+	}
+
+	return ""
+}
+
+// GetStats returns the configured exemptions and how often each matched
+func (e *RateLimitExemptions) GetStats() map[string]interface{} {
+	networks := make([]string, 0, len(e.networks))
+	for _, network := range e.networks {
+		networks = append(networks, network.String())
+	}
+	roles := make([]string, 0, len(e.roles))
+	for role := range e.roles {
+		roles = append(roles, role)
+	}
+
+	e.mutex.Lock()
+	counts := make(map[string]int64, len(e.exemptCounts))
+	for reason, n := range e.exemptCounts {
+		counts[reason] = n
+	}
+	e.mutex.Unlock()
+
+	return map[string]interface{}{
+		"cidrs":             networks,
+		"roles":             roles,
+		"api_keys":          len(e.apiKeys), // never expose the keys themselves
+		"exempted_requests": counts,
+	}
+}
+
+// isRateLimitExempt reports whether Mark flagged the request as exempt
+func isRateLimitExempt(c *gin.Context) bool {
+	return c.GetBool(rateLimitExemptKey)
+}
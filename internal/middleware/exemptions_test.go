@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func newExemptRouter(t *testing.T, cfg ExemptionConfig, resolve RoleResolver) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	ex, err := NewRateLimitExemptions(cfg, resolve, logrus.New())
+	if err != nil {
+		t.Fatalf("exemptions: %v", err)
+	}
+	mw := NewRateLimitMiddleware(RateLimitConfig{Requests: 1, Duration: time.Minute}, logrus.New())
+	r := gin.New()
+	r.Use(ex.Mark(), mw.RateLimit())
+	r.GET("/", func(c *gin.Context) { c.String(200, "ok") })
+	return r
+}
+
+func serveN(r *gin.Engine, n int, setup func(*http.Request)) int {
+	code := 0
+	for i := 0; i < n; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "10.1.2.3:1234"
+		if setup != nil {
+			setup(req)
+		}
+		r.ServeHTTP(w, req)
+		code = w.Code
+	}
+	return code
+}
+
+func TestExemptions_CIDRBypassesRateLimit(t *testing.T) {
+	r := newExemptRouter(t, ExemptionConfig{CIDRs: []string{"10.0.0.0/8"}}, nil)
+	if code := serveN(r, 3, nil); code != 200 {
+		t.Fatalf("exempt IP should not be limited, got %d", code)
+	}
+}
+
+func TestExemptions_APIKeyBypassesRateLimit(t *testing.T) {
+	r := newExemptRouter(t, ExemptionConfig{APIKeys: []string{"batch-key"}}, nil)
+	if code := serveN(r, 3, func(req *http.Request) { req.Header.Set("X-API-Key", "batch-key") }); code != 200 {
+		t.Fatalf("exempt API key should not be limited, got %d", code)
+	}
+	if code := serveN(r, 2, func(req *http.Request) { req.Header.Set("X-API-Key", "other") }); code != 429 {
+		t.Fatalf("unknown API key should be limited, got %d", code)
+	}
+}
+
+func TestExemptions_RoleBypassesRateLimit(t *testing.T) {
+	resolve := func(c *gin.Context) string {
+		if c.GetHeader("Authorization") == "Bearer svc" {
+			return "service"
+		}
+		return ""
+	}
+	r := newExemptRouter(t, ExemptionConfig{Roles: []string{"service"}}, resolve)
+	if code := serveN(r, 3, func(req *http.Request) { req.Header.Set("Authorization", "Bearer svc") }); code != 200 {
+		t.Fatalf("exempt role should not be limited, got %d", code)
+	}
+}
+
+func TestExemptions_InvalidCIDR(t *testing.T) {
+	if _, err := NewRateLimitExemptions(ExemptionConfig{CIDRs: []string{"not-an-ip/99"}}, nil, logrus.New()); err == nil {
+		t.Fatalf("expected error for invalid CIDR")
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+
+	"highload-microservice/internal/metrics"
+	"highload-microservice/internal/security"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// IPList resolves the operator-managed rule for a client IP
+type IPList interface {
+	Check(ip string) security.IPAction
+}
+
+// IPFilter applies the operator-managed IP blocklist and allowlist
+type IPFilter struct {
+	list   IPList
+	logger *logrus.Logger
+}
+
+func NewIPFilter(list IPList, logger *logrus.Logger) *IPFilter {
+	return &IPFilter{list: list, logger: logger}
+}
+
+// Filter rejects blocked IPs and marks allowlisted IPs exempt from rate
+// limiting and DDoS protection. It must be registered before those middleware.
+func (f *IPFilter) Filter() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch f.list.Check(c.ClientIP()) {
+		case security.IPActionBlock:
+			metrics.RequestBlocked(metrics.BlockIPRule)
+			f.logger.Warnf("Rejected request from blocklisted IP: %s", c.ClientIP())
+			rejectBlockedIP(c)
+			return
+		case security.IPActionAllow:
+			c.Set(rateLimitExemptKey, true)
+		}
+		c.Next()
+	}
+}
+
+func rejectBlockedIP(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":   "Access denied",
+		"message": "Your IP address has been blocked.",
+	})
+	c.Abort()
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"highload-microservice/internal/security"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type staticIPList security.IPAction
+
+func (s staticIPList) Check(ip string) security.IPAction { return security.IPAction(s) }
+
+func TestIPFilter_BlockAndAllow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	serve := func(action security.IPAction) (int, bool) {
+		exempt := false
+		r := gin.New()
+		r.Use(NewIPFilter(staticIPList(action), logrus.New()).Filter())
+		r.GET("/", func(c *gin.Context) {
+			exempt = isRateLimitExempt(c)
+			c.String(200, "ok")
+		})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		r.ServeHTTP(w, req)
+		return w.Code, exempt
+	}
+
+	if code, _ := serve(security.IPActionBlock); code != http.StatusForbidden {
+		t.Fatalf("blocked IP: expected 403, got %d", code)
+	}
+	if code, exempt := serve(security.IPActionAllow); code != 200 || !exempt {
+		t.Fatalf("allowed IP: expected 200 and exempt, got %d (exempt %v)", code, exempt)
+	}
+	if code, exempt := serve(security.IPActionNone); code != 200 || exempt {
+		t.Fatalf("unlisted IP: expected 200 and not exempt, got %d (exempt %v)", code, exempt)
+	}
+}
+
+func TestDDoS_ConsultsIPList(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ddos := NewDDoSProtection(DDoSConfig{MaxRequests: 1}, logrus.New())
+	ddos.SetIPList(staticIPList(security.IPActionAllow))
+	r := gin.New()
+	r.Use(ddos.Protect())
+	r.GET("/", func(c *gin.Context) { c.String(200, "ok") })
+
+	// Allowlisted IPs are never throttled
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		r.ServeHTTP(w, req)
+		if w.Code != 200 {
+			t.Fatalf("request %d: expected 200, got %d", i, w.Code)
+		}
+	}
+}
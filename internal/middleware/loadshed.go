@@ -0,0 +1,238 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"highload-microservice/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// loadShedSamples caps the latencies kept per window for the p99
+	loadShedSamples = 1024
+	// loadShedMinSamples is the fewest latencies a window needs before the
+	// limit is adjusted from it
+	loadShedMinSamples = 20
+)
+
+// LoadSheddingConfig configures a LoadShedder
+type LoadSheddingConfig struct {
+	// MinLimit and MaxLimit bound the concurrency limit, which starts at
+	// MaxLimit. Default to 16 and 512.
+	MinLimit int
+	MaxLimit int
+	// QueueSize requests may wait up to QueueTimeout for a slot once the
+	// limit is reached; 0 rejects at once
+	QueueSize    int
+	QueueTimeout time.Duration
+	// TargetLatency is the p99 above which the limit shrinks. Defaults to 1s.
+	TargetLatency time.Duration
+	// Window is how often the limit is adjusted. Defaults to 1s.
+	Window time.Duration
+	// RetryAfter is sent with 503. Defaults to 1s.
+	RetryAfter time.Duration
+	// ExcludedRoutes are never limited (health checks, streams); a trailing *
+	// matches any suffix
+	ExcludedRoutes []string
+}
+
+// LoadShedder limits the number of requests handled at once, so that a
+// traffic spike is turned away with 503 instead of piling up on Postgres and
+// Redis until every request times out. The limit adapts: it shrinks while
+// the p99 latency is above the target and grows back while it is below and
+// the limit is in use.
+type LoadShedder struct {
+	cfg    LoadSheddingConfig
+	logger *logrus.Logger
+
+	mu          sync.Mutex
+	limit       int
+	inFlight    int
+	queue       []chan struct{} // waiters, each closed when granted a slot
+	saturated   bool            // the limit was reached in this window
+	samples     []time.Duration // latencies of this window
+	observed    int             // latencies seen in this window
+	windowStart time.Time
+
+	now func() time.Time
+}
+
+// NewLoadShedder creates a load shedder whose limit starts at MaxLimit
+func NewLoadShedder(cfg LoadSheddingConfig, logger *logrus.Logger) *LoadShedder {
+	if cfg.MinLimit <= 0 {
+		cfg.MinLimit = 16
+	}
+	if cfg.MaxLimit < cfg.MinLimit {
+		cfg.MaxLimit = max(512, cfg.MinLimit)
+	}
+	if cfg.QueueSize < 0 {
+		cfg.QueueSize = 0
+	}
+	if cfg.TargetLatency <= 0 {
+		cfg.TargetLatency = time.Second
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = time.Second
+	}
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = time.Second
+	}
+	s := &LoadShedder{
+		cfg:     cfg,
+		logger:  logger,
+		limit:   cfg.MaxLimit,
+		samples: make([]time.Duration, 0, loadShedSamples),
+		now:     time.Now,
+	}
+	s.windowStart = s.now()
+	metrics.SetLoadShedderState(0, 0, s.limit)
+	return s
+}
+
+// Limit returns the current concurrency limit
+func (s *LoadShedder) Limit() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limit
+}
+
+// Handler rejects requests with 503 and Retry-After while the limit is
+// reached and the queue is full, or when a queued request was not given a
+// slot in time
+func (s *LoadShedder) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.FullPath()
+		if path == "" {
+			path = c.Request.URL.Path
+		}
+		for _, pattern := range s.cfg.ExcludedRoutes {
+			if routeMatches(pattern, path) {
+				c.Next()
+				return
+			}
+		}
+
+		if !s.acquire(c) {
+			metrics.RequestBlocked(metrics.BlockOverload)
+			s.logger.Warnf("Load shed %s %s from %s", c.Request.Method, path, c.ClientIP())
+			seconds := int(math.Ceil(s.cfg.RetryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error":   "Service overloaded",
+				"message": "Too many requests in progress. Try again in " + strconv.Itoa(seconds) + " seconds",
+			})
+			return
+		}
+
+		start := s.now()
+		defer func() { s.release(s.now().Sub(start)) }()
+		c.Next()
+	}
+}
+
+// acquire takes a slot, waiting in the queue while the limit is reached
+func (s *LoadShedder) acquire(c *gin.Context) bool {
+	s.mu.Lock()
+	if s.inFlight < s.limit {
+		s.inFlight++
+		s.reportLocked()
+		s.mu.Unlock()
+		return true
+	}
+	s.saturated = true
+	if len(s.queue) >= s.cfg.QueueSize {
+		s.mu.Unlock()
+		return false
+	}
+	granted := make(chan struct{})
+	s.queue = append(s.queue, granted)
+	s.reportLocked()
+	s.mu.Unlock()
+
+	timer := time.NewTimer(s.cfg.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case <-granted:
+		return true
+	case <-timer.C:
+	case <-c.Request.Context().Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := slices.Index(s.queue, granted); i >= 0 {
+		s.queue = slices.Delete(s.queue, i, i+1)
+		s.reportLocked()
+		return false
+	}
+	// Granted while giving up; the slot is ours
+	return true
+}
+
+// release frees a slot, hands free slots to queued requests and records the
+// request's latency
+func (s *LoadShedder) release(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight--
+	s.observeLocked(latency)
+	for s.inFlight < s.limit && len(s.queue) > 0 {
+		close(s.queue[0])
+		s.queue = s.queue[1:]
+		s.inFlight++
+	}
+	s.reportLocked()
+}
+
+// observeLocked adds a latency to the window and adjusts the limit once the
+// window is over. Callers hold mu.
+func (s *LoadShedder) observeLocked(latency time.Duration) {
+	if len(s.samples) < loadShedSamples {
+		s.samples = append(s.samples, latency)
+	} else {
+		s.samples[s.observed%loadShedSamples] = latency
+	}
+	s.observed++
+
+	now := s.now()
+	if now.Sub(s.windowStart) < s.cfg.Window || len(s.samples) < loadShedMinSamples {
+		return
+	}
+
+	p99 := percentile(s.samples, 0.99)
+	previous := s.limit
+	switch {
+	case p99 > s.cfg.TargetLatency:
+		// Back off multiplicatively so that saturation clears quickly
+		s.limit = max(s.cfg.MinLimit, s.limit*9/10)
+	case s.saturated:
+		s.limit = min(s.cfg.MaxLimit, s.limit+max(1, s.limit/10))
+	}
+	if s.limit < previous {
+		s.logger.Warnf("Load shedder limit lowered from %d to %d (p99 %s)", previous, s.limit, p99)
+	}
+
+	s.samples = s.samples[:0]
+	s.observed = 0
+	s.saturated = false
+	s.windowStart = now
+}
+
+// reportLocked exports the state to metrics. Callers hold mu.
+func (s *LoadShedder) reportLocked() {
+	metrics.SetLoadShedderState(s.inFlight, len(s.queue), s.limit)
+}
+
+// percentile returns the q quantile of samples, reordering them
+func percentile(samples []time.Duration, q float64) time.Duration {
+	slices.Sort(samples)
+	i := int(math.Ceil(q*float64(len(samples)))) - 1
+	return samples[max(i, 0)]
+}
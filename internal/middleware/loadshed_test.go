@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func loadShedRouter(s *LoadShedder, release <-chan struct{}) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(s.Handler())
+	r.GET("/slow", func(c *gin.Context) {
+		<-release
+		c.Status(http.StatusOK)
+	})
+	r.GET("/health", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r
+}
+
+func quietLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func serve(r *gin.Engine, path string) <-chan *httptest.ResponseRecorder {
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		r.ServeHTTP(w, req)
+		done <- w
+	}()
+	return done
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not reached")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLoadShedderRejectsWhenSaturated(t *testing.T) {
+	s := NewLoadShedder(LoadSheddingConfig{
+		MinLimit: 1, MaxLimit: 1, QueueSize: 1, QueueTimeout: time.Second,
+		RetryAfter: 2 * time.Second, ExcludedRoutes: []string{"/health"},
+	}, quietLogger())
+	release := make(chan struct{})
+	r := loadShedRouter(s, release)
+
+	first := serve(r, "/slow")
+	waitFor(t, func() bool { s.mu.Lock(); defer s.mu.Unlock(); return s.inFlight == 1 })
+	queued := serve(r, "/slow")
+	waitFor(t, func() bool { s.mu.Lock(); defer s.mu.Unlock(); return len(s.queue) == 1 })
+
+	w := <-serve(r, "/slow")
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "2" {
+		t.Fatalf("got %d, Retry-After %q; want 503, 2", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := <-serve(r, "/health"); w.Code != http.StatusOK {
+		t.Fatalf("excluded route: got %d, want 200", w.Code)
+	}
+
+	close(release)
+	for _, done := range []<-chan *httptest.ResponseRecorder{first, queued} {
+		if w := <-done; w.Code != http.StatusOK {
+			t.Errorf("got %d, want 200", w.Code)
+		}
+	}
+	if s.inFlight != 0 || len(s.queue) != 0 {
+		t.Errorf("leaked slots: %d in flight, %d queued", s.inFlight, len(s.queue))
+	}
+}
+
+func TestLoadShedderQueueTimeout(t *testing.T) {
+	s := NewLoadShedder(LoadSheddingConfig{
+		MinLimit: 1, MaxLimit: 1, QueueSize: 1, QueueTimeout: 10 * time.Millisecond,
+	}, quietLogger())
+	release := make(chan struct{})
+	defer close(release)
+	r := loadShedRouter(s, release)
+
+	serve(r, "/slow")
+	waitFor(t, func() bool { s.mu.Lock(); defer s.mu.Unlock(); return s.inFlight == 1 })
+	if w := <-serve(r, "/slow"); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got %d, want 503", w.Code)
+	}
+	if len(s.queue) != 0 {
+		t.Errorf("timed out request left in queue")
+	}
+}
+
+func TestLoadShedderAdaptsLimit(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := NewLoadShedder(LoadSheddingConfig{
+		MinLimit: 10, MaxLimit: 100, TargetLatency: 100 * time.Millisecond, Window: time.Second,
+	}, quietLogger())
+	s.now = func() time.Time { return now }
+	s.windowStart = now
+
+	window := func(latency time.Duration, saturated bool) {
+		now = now.Add(time.Second)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.saturated = saturated
+		for i := 0; i < loadShedMinSamples; i++ {
+			s.inFlight++
+			s.observeLocked(latency)
+			s.inFlight--
+		}
+	}
+
+	window(time.Second, true)
+	if s.Limit() != 90 {
+		t.Fatalf("after slow window: limit %d, want 90", s.Limit())
+	}
+	for i := 0; i < 50; i++ {
+		window(time.Second, true)
+	}
+	if s.Limit() != 10 {
+		t.Fatalf("limit %d went below MinLimit", s.Limit())
+	}
+
+	window(10*time.Millisecond, false)
+	if s.Limit() != 10 {
+		t.Fatalf("unsaturated window: limit %d, want 10", s.Limit())
+	}
+	window(10*time.Millisecond, true)
+	if s.Limit() != 11 {
+		t.Fatalf("saturated fast window: limit %d, want 11", s.Limit())
+	}
+}
@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"highload-microservice/internal/rbac"
+	"highload-microservice/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Client certificate modes of the HTTPS server
+const (
+	ClientAuthNone     = "none"     // client certificates are not requested
+	ClientAuthOptional = "optional" // verified when presented
+	ClientAuthRequire  = "require"  // the handshake fails without a valid certificate
+)
+
+// ClientCertTLSConfig returns server TLS settings that verify client
+// certificates against the CA bundle in caFile
+func ClientCertTLSConfig(mode, caFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	switch mode {
+	case "", ClientAuthNone:
+		return tlsConfig, nil
+	case ClientAuthOptional:
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown client auth mode %q: expected none, optional or require", mode)
+	}
+
+	if caFile == "" {
+		return nil, fmt.Errorf("client auth mode %q requires a CA bundle", mode)
+	}
+	pem, err := os.ReadFile(caFile) // #nosec G304 -- path comes from configuration
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	tlsConfig.ClientCAs = pool
+	return tlsConfig, nil
+}
+
+// ClientCertIdentities maps client certificate subjects to the permissions
+// they are granted
+type ClientCertIdentities map[string][]rbac.Permission
+
+// ParseClientCertIdentities parses a semicolon-separated list of
+// subject=permission,... entries, e.g.
+// "orders-service=events:read,events:write;billing=*". Permissions are those
+// of the role matrix.
+func ParseClientCertIdentities(spec string) (ClientCertIdentities, error) {
+	identities := ClientCertIdentities{}
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		subject, perms, ok := strings.Cut(entry, "=")
+		subject = strings.TrimSpace(subject)
+		if !ok || subject == "" {
+			return nil, fmt.Errorf("invalid client identity %q: expected SUBJECT=PERMISSION,...", entry)
+		}
+		permissions := []rbac.Permission{}
+		for _, p := range strings.Split(perms, ",") {
+			perm := rbac.Permission(strings.TrimSpace(p))
+			if perm == "" {
+				continue
+			}
+			if !rbac.ValidPermission(perm) {
+				return nil, fmt.Errorf("unknown permission %q for client identity %s", perm, subject)
+			}
+			permissions = append(permissions, perm)
+		}
+		identities[subject] = permissions
+	}
+	return identities, nil
+}
+
+// ClientCertAuth authenticates callers that presented a verified client
+// certificate. The certificate's subject (its common name, or else its first
+// URI SAN such as a SPIFFE ID) is stored as the caller's service identity
+// along with its permissions from identities. RequireAuth then accepts the
+// caller without a token and RequirePermission checks those permissions
+// where it would check a user's role. Unknown subjects get no permissions;
+// requests without a certificate pass through unchanged.
+func (m *AuthMiddleware) ClientCertAuth(identities ClientCertIdentities) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subject := clientCertSubject(c)
+		if subject == "" {
+			c.Next()
+			return
+		}
+
+		permissions, ok := identities[subject]
+		if !ok {
+			m.logger.Warnf("Client certificate %q has no configured permissions", subject)
+			permissions = []rbac.Permission{}
+		}
+		c.Set("client_cert_subject", subject)
+		c.Set("client_cert_permissions", permissions)
+		c.Request = c.Request.WithContext(services.WithServiceIdentity(c.Request.Context(), subject))
+
+		m.logger.Debugf("Service authenticated by client certificate: %s", subject)
+		c.Next()
+	}
+}
+
+// clientCertAllows reports whether the caller authenticated by client
+// certificate has permission; ok is false for callers without one
+func clientCertAllows(c *gin.Context, permission rbac.Permission) (allowed, ok bool) {
+	value, exists := c.Get("client_cert_permissions")
+	if !exists {
+		return false, false
+	}
+	perms, _ := value.([]rbac.Permission)
+	for _, perm := range perms {
+		if perm == permission || perm == rbac.PermAll {
+			return true, true
+		}
+	}
+	return false, true
+}
+
+// clientCertSubject returns the subject of the verified client certificate,
+// or "" if none was presented
+func clientCertSubject(c *gin.Context) string {
+	state := c.Request.TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	leaf := state.VerifiedChains[0][0]
+	if leaf.Subject.CommonName != "" {
+		return leaf.Subject.CommonName
+	}
+	if len(leaf.URIs) > 0 {
+		return leaf.URIs[0].String()
+	}
+	return ""
+}
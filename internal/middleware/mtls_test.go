@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/rbac"
+	"highload-microservice/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+func TestParseClientCertIdentities(t *testing.T) {
+	identities, err := ParseClientCertIdentities(" orders-service=events:read, events:write ; billing=* ;")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if got := identities["orders-service"]; len(got) != 2 || got[1] != "events:write" {
+		t.Fatalf("unexpected orders-service permissions: %v", got)
+	}
+	if got := identities["billing"]; len(got) != 1 || got[0] != "*" {
+		t.Fatalf("unexpected billing permissions: %v", got)
+	}
+
+	if _, err := ParseClientCertIdentities("orders-service"); err == nil {
+		t.Fatal("want error for an entry without permissions")
+	}
+	if _, err := ParseClientCertIdentities("orders-service=events:publish"); err == nil {
+		t.Fatal("want error for an unknown permission")
+	}
+}
+
+func TestClientCertTLSConfig(t *testing.T) {
+	if cfg, err := ClientCertTLSConfig(ClientAuthNone, ""); err != nil || cfg.ClientAuth != tls.NoClientCert {
+		t.Fatalf("none: got %v, %v", cfg, err)
+	}
+	if _, err := ClientCertTLSConfig(ClientAuthRequire, ""); err == nil {
+		t.Fatal("want error without a CA bundle")
+	}
+	if _, err := ClientCertTLSConfig("always", "ca.pem"); err == nil {
+		t.Fatal("want error for an unknown mode")
+	}
+}
+
+func TestClientCertAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := NewAuthMiddleware(&services.AuthService{}, logrus.New())
+	identities := ClientCertIdentities{"orders-service": {rbac.PermEventsWrite}}
+
+	// Routes are guarded the way main.go guards them for JWT callers
+	r := gin.New()
+	r.Use(m.ClientCertAuth(identities))
+	events := r.Group("/api/v1/events", m.RequireAuth())
+	events.POST("/", m.RequirePermission(rbac.PermEventsWrite), func(c *gin.Context) {
+		c.String(http.StatusOK, services.ServiceIdentity(c.Request.Context()))
+	})
+	events.GET("/", m.RequirePermission(rbac.PermEventsRead), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.GET("/api/v1/users/:id", m.RequireAuth(), m.RequirePermission(rbac.PermEventsWrite),
+		m.RequireSelfOrRole("id", nil, models.RoleAdmin), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		subject string // "" sends no certificate
+		want    int
+	}{
+		{"granted permission", http.MethodPost, "/api/v1/events/", "orders-service", http.StatusOK},
+		{"missing permission", http.MethodGet, "/api/v1/events/", "orders-service", http.StatusForbidden},
+		{"unknown service", http.MethodPost, "/api/v1/events/", "reports-service", http.StatusForbidden},
+		{"no certificate", http.MethodPost, "/api/v1/events/", "", http.StatusUnauthorized},
+		{"user record", http.MethodGet, "/api/v1/users/" + uuid.NewString(), "orders-service", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.subject != "" {
+				req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+					{Subject: pkix.Name{CommonName: tt.subject}},
+				}}}
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("want %d, got %d", tt.want, w.Code)
+			}
+			if tt.want == http.StatusOK && tt.method == http.MethodPost && w.Body.String() != tt.subject {
+				t.Fatalf("want service identity %q in context, got %q", tt.subject, w.Body.String())
+			}
+		})
+	}
+}
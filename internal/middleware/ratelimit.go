@@ -2,28 +2,110 @@ package middleware
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/metrics"
+	"highload-microservice/internal/models"
+
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"github.com/ulule/limiter/v3"
 	"github.com/ulule/limiter/v3/drivers/store/memory"
 )
 
 type RateLimitMiddleware struct {
-	limiter *limiter.Limiter
-	logger  *logrus.Logger
+	mu          sync.RWMutex // guards limiter and policies, see SetLimits
+	limiter     *limiter.Limiter
+	policies    []policyLimiter
+	resolveRole RoleResolver
+	logger      *logrus.Logger
+
+	// Per-API-key limits, see SetAPIKeyQuotas
+	quotas      APIKeyQuotas
+	keyStore    limiter.Store
+	keyMutex    sync.Mutex
+	keyLimiters map[int]*limiter.Limiter // by requests per minute
+	keyCache    map[string]cachedAPIKeyLimits
+}
+
+// APIKeyQuotas resolves the limits of API keys sent in X-API-Key and counts
+// their monthly usage (implemented by services.AuthService)
+type APIKeyQuotas interface {
+	ResolveAPIKeyLimits(ctx context.Context, apiKey string) (*models.APIKeyLimits, error)
+	RecordAPIKeyUsage(ctx context.Context, id uuid.UUID) (int64, error)
+}
+
+type cachedAPIKeyLimits struct {
+	limits  *models.APIKeyLimits // nil for keys that failed to resolve
+	expires time.Time
 }
 
+const (
+	// apiKeyLimitsTTL bounds how long limit changes and revocations take to
+	// reach the rate limiter
+	apiKeyLimitsTTL = time.Minute
+	// maxCachedAPIKeys caps the resolution cache; it is cleared when full
+	maxCachedAPIKeys = 10000
+)
+
 type RateLimitConfig struct {
-	Requests int           // Number of requests
-	Duration time.Duration // Duration window
+	Requests int               // Number of requests
+	Duration time.Duration     // Duration window
+	Policies []RateLimitPolicy // Per-route and per-role overrides, first match wins
+}
+
+// AnonymousRole matches callers without a valid bearer token in policies
+const AnonymousRole = "anonymous"
+
+// RateLimitPolicy overrides the global limit for requests matching Method
+// and Pattern from callers with one of Roles. Pattern is a gin route path
+// (e.g. /api/v1/users/:id); a trailing * matches any suffix, so "*" matches
+// every route, and a * segment any one segment (/api/*/auth/*). An empty Method matches every method and empty Roles every
+// caller.
+type RateLimitPolicy struct {
+	Roles    []string
+	Method   string
+	Pattern  string
+	Requests int
+	Duration time.Duration
+}
+
+// String is the policy in the format of ParseRateLimitPolicies
+func (p RateLimitPolicy) String() string {
+	target := strings.TrimSpace(p.Method + " " + p.Pattern)
+	if len(p.Roles) > 0 {
+		target = strings.Join(p.Roles, ",") + ":" + target
+	}
+	return fmt.Sprintf("%s=%d/%s", target, p.Requests, p.Duration)
+}
+
+type policyLimiter struct {
+	RateLimitPolicy
+	name    string
+	limiter *limiter.Limiter
 }
 
 func NewRateLimitMiddleware(config RateLimitConfig, logger *logrus.Logger) *RateLimitMiddleware {
+	instance, policies := newLimiters(config)
+	return &RateLimitMiddleware{
+		limiter:  instance,
+		policies: policies,
+		logger:   logger,
+	}
+}
+
+// newLimiters creates the global limiter and one per policy
+func newLimiters(config RateLimitConfig) (*limiter.Limiter, []policyLimiter) {
 	// Create rate limiter with memory store
 	store := memory.NewStore()
 
@@ -35,23 +117,183 @@ func NewRateLimitMiddleware(config RateLimitConfig, logger *logrus.Logger) *Rate
 
 	instance := limiter.New(store, rate)
 
-	return &RateLimitMiddleware{
-		limiter: instance,
-		logger:  logger,
+	// Each policy gets its own store so that counters are independent
+	policies := make([]policyLimiter, 0, len(config.Policies))
+	for _, policy := range config.Policies {
+		policies = append(policies, policyLimiter{
+			RateLimitPolicy: policy,
+			name:            policy.String(),
+			limiter: limiter.New(memory.NewStore(), limiter.Rate{
+				Period: policy.Duration,
+				Limit:  int64(policy.Requests),
+			}),
+		})
 	}
+	return instance, policies
+}
+
+// SetLimits replaces the global limit and the policies. Counters start over.
+// Per-API-key limits are not affected.
+func (m *RateLimitMiddleware) SetLimits(config RateLimitConfig) {
+	instance, policies := newLimiters(config)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.limiter, m.policies = instance, policies
+}
+
+// SetRoleResolver enables policies with roles. Rate limiting runs before
+// route-level auth, so the role is resolved from the request itself.
+func (m *RateLimitMiddleware) SetRoleResolver(resolve RoleResolver) {
+	m.resolveRole = resolve
+}
+
+// SetAPIKeyQuotas enables per-API-key limiting: requests with a valid
+// X-API-Key are counted per key rather than per IP, at the key's own
+// requests/minute when set, and are rejected once the key's monthly quota is
+// used up.
+func (m *RateLimitMiddleware) SetAPIKeyQuotas(quotas APIKeyQuotas) {
+	m.quotas = quotas
+	m.keyStore = memory.NewStore()
+	m.keyLimiters = make(map[int]*limiter.Limiter)
+	m.keyCache = make(map[string]cachedAPIKeyLimits)
+}
+
+// ParseRateLimitPolicies parses entries of the form
+// "[ROLE[,ROLE]:][METHOD ]PATTERN=REQUESTS/DURATION", e.g.
+// "POST /api/v1/events/=600/1m", "/api/v1/auth/*=5/15m" or "admin:*=6000/1m"
+func ParseRateLimitPolicies(entries []string) ([]RateLimitPolicy, error) {
+	var policies []RateLimitPolicy
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		eq := strings.LastIndex(entry, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("invalid rate limit policy %q: expected PATTERN=REQUESTS/DURATION", entry)
+		}
+		target, limit := strings.TrimSpace(entry[:eq]), strings.TrimSpace(entry[eq+1:])
+
+		var policy RateLimitPolicy
+		// Roles come before the first colon, unless it is part of the route
+		// (/users/:id)
+		if colon := strings.Index(target, ":"); colon >= 0 && !strings.Contains(target[:colon], "/") {
+			for _, role := range strings.Split(target[:colon], ",") {
+				if role = strings.TrimSpace(role); role != "" {
+					policy.Roles = append(policy.Roles, role)
+				}
+			}
+			if len(policy.Roles) == 0 {
+				return nil, fmt.Errorf("invalid rate limit policy %q: empty roles", entry)
+			}
+			target = strings.TrimSpace(target[colon+1:])
+		}
+		if fields := strings.Fields(target); len(fields) == 2 {
+			policy.Method, policy.Pattern = strings.ToUpper(fields[0]), fields[1]
+		} else if len(fields) == 1 {
+			policy.Pattern = fields[0]
+		} else {
+			return nil, fmt.Errorf("invalid rate limit policy %q: bad route", entry)
+		}
+
+		parts := strings.SplitN(limit, "/", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid rate limit policy %q: expected REQUESTS/DURATION", entry)
+		}
+		requests, err := strconv.Atoi(parts[0])
+		if err != nil || requests <= 0 {
+			return nil, fmt.Errorf("invalid rate limit policy %q: bad request count", entry)
+		}
+		duration, err := time.ParseDuration(parts[1])
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("invalid rate limit policy %q: bad duration", entry)
+		}
+		policy.Requests, policy.Duration = requests, duration
+
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// matches reports whether the policy applies to the given method, gin route
+// path and role
+func (p RateLimitPolicy) matches(method, path, role string) bool {
+	if p.Method != "" && p.Method != method {
+		return false
+	}
+	if !routeMatches(p.Pattern, path) {
+		return false
+	}
+	if len(p.Roles) == 0 {
+		return true
+	}
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// limiterFor resolves the policy of the request, falling back to the global
+// limit. The caller's role is only resolved when a policy needs it.
+func (m *RateLimitMiddleware) limiterFor(c *gin.Context) (*limiter.Limiter, string) {
+	path := c.FullPath()
+	if path == "" {
+		path = c.Request.URL.Path
+	}
+	m.mu.RLock()
+	instance, policies := m.limiter, m.policies
+	m.mu.RUnlock()
+
+	role, resolved := "", false
+	for i := range policies {
+		policy := &policies[i]
+		if len(policy.Roles) > 0 && !resolved {
+			if m.resolveRole != nil {
+				role = m.resolveRole(c)
+			}
+			if role == "" {
+				role = AnonymousRole
+			}
+			resolved = true
+		}
+		if policy.matches(c.Request.Method, path, role) {
+			return policy.limiter, policy.name
+		}
+	}
+	return instance, ""
 }
 
 // RateLimit middleware that applies rate limiting to requests
 func (m *RateLimitMiddleware) RateLimit() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if isRateLimitExempt(c) {
+			c.Next()
+			return
+		}
+
 		// Get client IP
 		clientIP := c.ClientIP()
 
 		// Create context for rate limiter
 		ctx := context.Background()
 
-		// Get rate limit info
-		context, err := m.limiter.Get(ctx, clientIP)
+		// Get rate limit info for the matching policy (or the global limit).
+		// API key callers are counted per key, not per IP.
+		instance, policy := m.limiterFor(c)
+		identity, subject := clientIP, "IP: "+clientIP
+		keyLimits := m.apiKeyLimits(c)
+		if keyLimits != nil {
+			identity, subject = "api_key:"+keyLimits.ID.String(), "API key: "+keyLimits.ID.String()
+			if policy == "" && keyLimits.RateLimitPerMinute > 0 {
+				// Key limiters share a store; the rate keeps their counters apart
+				instance = m.keyLimiter(keyLimits.RateLimitPerMinute)
+				identity = fmt.Sprintf("%s:%d", identity, keyLimits.RateLimitPerMinute)
+			}
+		}
+		context, err := instance.Get(ctx, identity)
 		if err != nil {
 			m.logger.Errorf("Rate limiter error: %v", err)
 			// If rate limiter fails, allow request (fail open)
@@ -66,7 +308,12 @@ func (m *RateLimitMiddleware) RateLimit() gin.HandlerFunc {
 
 		// Check if rate limit exceeded
 		if context.Reached {
-			m.logger.Warnf("Rate limit exceeded for IP: %s", clientIP)
+			metrics.RequestBlocked(metrics.BlockRateLimit)
+			if policy != "" {
+				m.logger.Warnf("Rate limit exceeded for %s by policy %s", subject, policy)
+			} else {
+				m.logger.Warnf("Rate limit exceeded for %s", subject)
+			}
 			c.JSON(http.StatusTooManyRequests, gin.H{
 				"error":   "Rate limit exceeded",
 				"message": fmt.Sprintf("Too many requests. Try again in %d seconds", context.Reset-time.Now().Unix()),
@@ -75,88 +322,101 @@ func (m *RateLimitMiddleware) RateLimit() gin.HandlerFunc {
 			return
 		}
 
+		if keyLimits != nil && !m.checkQuota(c, keyLimits) {
+			return
+		}
+
 		c.Next()
 	}
 }
 
-// StrictRateLimit middleware with stricter limits for sensitive endpoints
-func (m *RateLimitMiddleware) StrictRateLimit() gin.HandlerFunc {
-	// Create stricter rate limiter
-	store := memory.NewStore()
-	rate := limiter.Rate{
-		Period: 1 * time.Minute, // 1 minute window
-		Limit:  5,               // 5 requests per minute
+// apiKeyLimits resolves the X-API-Key of the request, or returns nil when
+// there is none or it is invalid (the request is then limited by IP and
+// rejected later by authentication)
+func (m *RateLimitMiddleware) apiKeyLimits(c *gin.Context) *models.APIKeyLimits {
+	if m.quotas == nil {
+		return nil
+	}
+	apiKey := c.GetHeader("X-API-Key")
+	if apiKey == "" {
+		return nil
 	}
 
-	strictLimiter := limiter.New(store, rate)
+	sum := sha256.Sum256([]byte(apiKey))
+	cacheKey := hex.EncodeToString(sum[:])
+	now := time.Now()
 
-	return func(c *gin.Context) {
-		clientIP := c.ClientIP()
-		ctx := context.Background()
+	m.keyMutex.Lock()
+	cached, ok := m.keyCache[cacheKey]
+	m.keyMutex.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.limits
+	}
 
-		context, err := strictLimiter.Get(ctx, clientIP)
-		if err != nil {
-			m.logger.Errorf("Strict rate limiter error: %v", err)
-			c.Next()
-			return
+	limits, err := m.quotas.ResolveAPIKeyLimits(c.Request.Context(), apiKey)
+	if err != nil {
+		if !errors.Is(err, apperrors.ErrUnauthorized) {
+			// Do not cache lookup failures; fall back to IP limiting
+			m.logger.Errorf("Failed to resolve API key limits: %v", err)
+			return nil
 		}
+		limits = nil
+	}
 
-		// Set rate limit headers
-		c.Header("X-RateLimit-Limit", strconv.FormatInt(context.Limit, 10))
-		c.Header("X-RateLimit-Remaining", strconv.FormatInt(context.Remaining, 10))
-		c.Header("X-RateLimit-Reset", strconv.FormatInt(context.Reset, 10))
+	m.keyMutex.Lock()
+	if len(m.keyCache) >= maxCachedAPIKeys {
+		m.keyCache = make(map[string]cachedAPIKeyLimits)
+	}
+	m.keyCache[cacheKey] = cachedAPIKeyLimits{limits: limits, expires: now.Add(apiKeyLimitsTTL)}
+	m.keyMutex.Unlock()
+	return limits
+}
 
-		if context.Reached {
-			m.logger.Warnf("Strict rate limit exceeded for IP: %s", clientIP)
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error":   "Rate limit exceeded",
-				"message": "Too many requests to sensitive endpoint. Try again later.",
-			})
-			c.Abort()
-			return
-		}
+// keyLimiter returns the shared limiter for keys allowed requestsPerMinute
+func (m *RateLimitMiddleware) keyLimiter(requestsPerMinute int) *limiter.Limiter {
+	m.keyMutex.Lock()
+	defer m.keyMutex.Unlock()
 
-		c.Next()
+	instance, ok := m.keyLimiters[requestsPerMinute]
+	if !ok {
+		instance = limiter.New(m.keyStore, limiter.Rate{Period: time.Minute, Limit: int64(requestsPerMinute)})
+		m.keyLimiters[requestsPerMinute] = instance
 	}
+	return instance
 }
 
-// AuthRateLimit middleware for authentication endpoints
-func (m *RateLimitMiddleware) AuthRateLimit() gin.HandlerFunc {
-	// Very strict rate limiter for auth endpoints
-	store := memory.NewStore()
-	rate := limiter.Rate{
-		Period: 15 * time.Minute, // 15 minute window
-		Limit:  5,                // 5 attempts per 15 minutes
+// checkQuota counts the request against the key's monthly usage and rejects
+// it with 429 once the quota is used up. Counter errors fail open.
+func (m *RateLimitMiddleware) checkQuota(c *gin.Context, limits *models.APIKeyLimits) bool {
+	usage, err := m.quotas.RecordAPIKeyUsage(c.Request.Context(), limits.ID)
+	if err != nil {
+		m.logger.Errorf("Failed to record API key usage: %v", err)
+		return true
+	}
+	if limits.MonthlyQuota <= 0 {
+		return true
 	}
 
-	authLimiter := limiter.New(store, rate)
-
-	return func(c *gin.Context) {
-		clientIP := c.ClientIP()
-		ctx := context.Background()
-
-		context, err := authLimiter.Get(ctx, clientIP)
-		if err != nil {
-			m.logger.Errorf("Auth rate limiter error: %v", err)
-			c.Next()
-			return
-		}
-
-		// Set rate limit headers
-		c.Header("X-RateLimit-Limit", strconv.FormatInt(context.Limit, 10))
-		c.Header("X-RateLimit-Remaining", strconv.FormatInt(context.Remaining, 10))
-		c.Header("X-RateLimit-Reset", strconv.FormatInt(context.Reset, 10))
-
-		if context.Reached {
-			m.logger.Warnf("Auth rate limit exceeded for IP: %s", clientIP)
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error":   "Authentication rate limit exceeded",
-				"message": "Too many authentication attempts. Try again in 15 minutes.",
-			})
-			c.Abort()
-			return
-		}
+	now := time.Now().UTC()
+	reset := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	remaining := limits.MonthlyQuota - usage
+	if remaining < 0 {
+		remaining = 0
+	}
+	c.Header("X-Quota-Limit", strconv.FormatInt(limits.MonthlyQuota, 10))
+	c.Header("X-Quota-Remaining", strconv.FormatInt(remaining, 10))
+	c.Header("X-Quota-Reset", strconv.FormatInt(reset.Unix(), 10))
 
-		c.Next()
+	if usage <= limits.MonthlyQuota {
+		return true
 	}
+
+	metrics.RequestBlocked(metrics.BlockQuota)
+	m.logger.Warnf("Monthly quota exceeded for API key: %s", limits.ID)
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":   "Quota exceeded",
+		"message": fmt.Sprintf("Monthly quota of %d requests exhausted. It resets on %s", limits.MonthlyQuota, reset.Format(time.RFC3339)),
+	})
+	c.Abort()
+	return false
 }
@@ -1,12 +1,19 @@
 package middleware
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/models"
+
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
@@ -50,3 +57,259 @@ func TestRateLimit_ExceedsLimit(t *testing.T) {
 		t.Fatalf("expected 429, got %d", w2.Code)
 	}
 }
+
+func TestParseRateLimitPolicies(t *testing.T) {
+	routes, err := ParseRateLimitPolicies([]string{"POST /api/v1/events/=600/1m", " /api/v1/auth/*=5/15m", "", "admin, service:GET /api/v1/users/:id=50/1s"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(routes) != 3 {
+		t.Fatalf("expected 3 routes, got %d", len(routes))
+	}
+	if routes[0].Method != "POST" || routes[0].Pattern != "/api/v1/events/" || routes[0].Requests != 600 || routes[0].Duration != time.Minute {
+		t.Fatalf("unexpected first route: %+v", routes[0])
+	}
+	if routes[1].Method != "" || routes[1].Duration != 15*time.Minute || len(routes[1].Roles) != 0 {
+		t.Fatalf("unexpected second route: %+v", routes[1])
+	}
+	if p := routes[2]; len(p.Roles) != 2 || p.Roles[1] != "service" || p.Method != "GET" || p.Pattern != "/api/v1/users/:id" {
+		t.Fatalf("unexpected role policy: %+v", p)
+	}
+	if got := routes[2].String(); got != "admin,service:GET /api/v1/users/:id=50/1s" {
+		t.Fatalf("String() = %q", got)
+	}
+
+	for _, bad := range []string{"/x", "/x=abc/1m", "/x=5/forever", "A B C=1/1m", " :/x=1/1m"} {
+		if _, err := ParseRateLimitPolicies([]string{bad}); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestRateLimit_PerRouteOverride(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mw := NewRateLimitMiddleware(RateLimitConfig{
+		Requests: 100,
+		Duration: time.Minute,
+		Policies: []RateLimitPolicy{{Method: "POST", Pattern: "/auth/*", Requests: 1, Duration: time.Minute}},
+	}, logrus.New())
+	r := gin.New()
+	r.Use(mw.RateLimit())
+	r.POST("/auth/login", func(c *gin.Context) { c.String(200, "ok") })
+	r.GET("/users/:id", func(c *gin.Context) { c.String(200, "ok") })
+
+	do := func(method, path string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := do("POST", "/auth/login"); code != 200 {
+		t.Fatalf("first login: %d", code)
+	}
+	if code := do("POST", "/auth/login"); code != 429 {
+		t.Fatalf("second login should be limited, got %d", code)
+	}
+	// Other routes use the global limit and are unaffected
+	for i := 0; i < 3; i++ {
+		if code := do("GET", "/users/1"); code != 200 {
+			t.Fatalf("users: %d", code)
+		}
+	}
+}
+
+func TestRateLimit_PerRolePolicies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	policies, _ := ParseRateLimitPolicies([]string{"admin:*=3/1m", "POST /events=1/1m", "anonymous:*=1/1m"})
+	mw := NewRateLimitMiddleware(RateLimitConfig{Requests: 2, Duration: time.Minute, Policies: policies}, logrus.New())
+	mw.SetRoleResolver(func(c *gin.Context) string { return c.GetHeader("X-Role") })
+	r := gin.New()
+	r.Use(mw.RateLimit())
+	r.GET("/events", func(c *gin.Context) { c.String(200, "ok") })
+	r.POST("/events", func(c *gin.Context) { c.String(200, "ok") })
+
+	// Requests come from different IPs so that counters do not mix
+	do := func(method, role, ip string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/events", nil)
+		req.RemoteAddr = ip + ":1234"
+		if role != "" {
+			req.Header.Set("X-Role", role)
+		}
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	codes := func(n int, method, role, ip string) []int {
+		var got []int
+		for i := 0; i < n; i++ {
+			got = append(got, do(method, role, ip))
+		}
+		return got
+	}
+
+	for _, tc := range []struct {
+		method, role, ip string
+		want             []int
+	}{
+		{"POST", "admin", "10.0.0.1", []int{200, 200, 200, 429}}, // admins are matched first
+		{"POST", "user", "10.0.0.2", []int{200, 429}},            // route policy
+		{"GET", "user", "10.0.0.3", []int{200, 200, 429}},        // global limit
+		{"GET", "", "10.0.0.4", []int{200, 429}},                 // anonymous callers
+	} {
+		if got := codes(len(tc.want), tc.method, tc.role, tc.ip); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%s as %q: got %v, want %v", tc.method, tc.role, got, tc.want)
+		}
+	}
+}
+
+// fakeQuotas resolves API keys from a map and counts usage in memory
+type fakeQuotas struct {
+	mu    sync.Mutex
+	keys  map[string]models.APIKeyLimits
+	usage map[uuid.UUID]int64
+}
+
+func (f *fakeQuotas) ResolveAPIKeyLimits(ctx context.Context, apiKey string) (*models.APIKeyLimits, error) {
+	limits, ok := f.keys[apiKey]
+	if !ok {
+		return nil, apperrors.Unauthorized("invalid API key")
+	}
+	return &limits, nil
+}
+
+func (f *fakeQuotas) RecordAPIKeyUsage(ctx context.Context, id uuid.UUID) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.usage[id]++
+	return f.usage[id], nil
+}
+
+func apiKeyRouter(mw *RateLimitMiddleware) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(mw.RateLimit())
+	r.GET("/", func(c *gin.Context) { c.String(200, "ok") })
+	return r
+}
+
+func getWithKey(r *gin.Engine, apiKey string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimit_APIKeysAreLimitedPerKey(t *testing.T) {
+	quotas := &fakeQuotas{
+		keys: map[string]models.APIKeyLimits{
+			"hl_a": {ID: uuid.New()},
+			"hl_b": {ID: uuid.New(), RateLimitPerMinute: 3},
+		},
+		usage: map[uuid.UUID]int64{},
+	}
+	mw := NewRateLimitMiddleware(RateLimitConfig{Requests: 1, Duration: time.Minute}, logrus.New())
+	mw.SetAPIKeyQuotas(quotas)
+	r := apiKeyRouter(mw)
+
+	// Each key gets its own budget, separate from the caller's IP
+	if w := getWithKey(r, ""); w.Code != 200 {
+		t.Fatalf("ip request: status %d", w.Code)
+	}
+	if w := getWithKey(r, "hl_a"); w.Code != 200 {
+		t.Fatalf("key a: status %d", w.Code)
+	}
+	if w := getWithKey(r, "hl_a"); w.Code != 429 {
+		t.Fatalf("key a over global limit: status %d, want 429", w.Code)
+	}
+
+	// A key with its own rate uses it instead of the global limit
+	for i := 0; i < 3; i++ {
+		w := getWithKey(r, "hl_b")
+		if w.Code != 200 {
+			t.Fatalf("key b request %d: status %d", i+1, w.Code)
+		}
+		if got := w.Header().Get("X-RateLimit-Limit"); got != "3" {
+			t.Fatalf("X-RateLimit-Limit = %q, want 3", got)
+		}
+	}
+	if w := getWithKey(r, "hl_b"); w.Code != 429 {
+		t.Fatalf("key b over its limit: status %d, want 429", w.Code)
+	}
+}
+
+func TestRateLimit_MonthlyQuotaExceeded(t *testing.T) {
+	id := uuid.New()
+	quotas := &fakeQuotas{
+		keys:  map[string]models.APIKeyLimits{"hl_q": {ID: id, MonthlyQuota: 2}},
+		usage: map[uuid.UUID]int64{},
+	}
+	mw := NewRateLimitMiddleware(RateLimitConfig{Requests: 100, Duration: time.Minute}, logrus.New())
+	mw.SetAPIKeyQuotas(quotas)
+	r := apiKeyRouter(mw)
+
+	for i, remaining := range []string{"1", "0"} {
+		w := getWithKey(r, "hl_q")
+		if w.Code != 200 {
+			t.Fatalf("request %d: status %d", i+1, w.Code)
+		}
+		if got := w.Header().Get("X-Quota-Remaining"); got != remaining {
+			t.Fatalf("request %d: X-Quota-Remaining = %q, want %s", i+1, got, remaining)
+		}
+	}
+
+	w := getWithKey(r, "hl_q")
+	if w.Code != 429 {
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+	if w.Header().Get("X-Quota-Limit") != "2" || w.Header().Get("X-Quota-Reset") == "" {
+		t.Fatalf("missing quota headers: %v", w.Header())
+	}
+}
+
+func TestRateLimit_InvalidAPIKeyFallsBackToIP(t *testing.T) {
+	quotas := &fakeQuotas{keys: map[string]models.APIKeyLimits{}, usage: map[uuid.UUID]int64{}}
+	mw := NewRateLimitMiddleware(RateLimitConfig{Requests: 1, Duration: time.Minute}, logrus.New())
+	mw.SetAPIKeyQuotas(quotas)
+	r := apiKeyRouter(mw)
+
+	if w := getWithKey(r, "hl_unknown"); w.Code != 200 {
+		t.Fatalf("status %d", w.Code)
+	}
+	// Rotating bogus keys must not bypass the IP limit
+	if w := getWithKey(r, "hl_other"); w.Code != 429 {
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+}
+
+func TestRateLimit_SetLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mw := NewRateLimitMiddleware(RateLimitConfig{Requests: 1, Duration: time.Minute}, logrus.New())
+	r := gin.New()
+	r.Use(mw.RateLimit())
+	r.GET("/", func(c *gin.Context) { c.String(200, "ok") })
+
+	get := func() int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	get()
+	if code := get(); code != 429 {
+		t.Fatalf("expected 429 before reload, got %d", code)
+	}
+
+	mw.SetLimits(RateLimitConfig{Requests: 3, Duration: time.Minute})
+	for i := 0; i < 3; i++ {
+		if code := get(); code != 200 {
+			t.Fatalf("request %d after reload: got %d", i+1, code)
+		}
+	}
+	if code := get(); code != 429 {
+		t.Fatalf("expected 429 at the new limit, got %d", code)
+	}
+}
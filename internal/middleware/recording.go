@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"highload-microservice/internal/recording"
+	"highload-microservice/internal/redact"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestRecordingConfig selects the requests RequestRecording records
+type RequestRecordingConfig struct {
+	SampleRate     float64  // share of requests recorded, 0 to 1
+	Routes         []string // route patterns recorded in full, e.g. /admin/*
+	ExcludedRoutes []string // never recorded: streams, the recordings endpoints
+	MaxBodyBytes   int      // bodies are captured up to this many bytes
+	Redactor       *redact.Redactor
+}
+
+// RequestRecording records a sample of requests, and every request to
+// Routes, with their responses. Bodies are captured as they pass through, as
+// far as the handler reads the request, up to MaxBodyBytes each; they are
+// redacted before they are queued. Server-sent event streams and WebSocket
+// upgrades are not recorded.
+func RequestRecording(recorder *recording.Recorder, cfg RequestRecordingConfig) gin.HandlerFunc {
+	if cfg.Redactor == nil {
+		cfg.Redactor = redact.Default()
+	}
+
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		path := route
+		if path == "" {
+			path = c.Request.URL.Path
+		}
+		if c.GetHeader("Upgrade") != "" || !cfg.records(path) {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		var body *bodyCapture
+		if c.Request.Body != nil && c.Request.Body != http.NoBody {
+			body = &bodyCapture{ReadCloser: c.Request.Body, limit: cfg.MaxBodyBytes}
+			c.Request.Body = body
+		}
+		w := &recordingWriter{ResponseWriter: c.Writer, limit: cfg.MaxBodyBytes}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if w.stream {
+			return
+		}
+		rec := recording.Recording{
+			ID:              uuid.New(),
+			RecordedAt:      start.UTC(),
+			RequestID:       c.GetString("request_id"),
+			Method:          c.Request.Method,
+			Path:            c.Request.URL.Path,
+			Route:           route,
+			Query:           recording.Query(cfg.Redactor, c.Request.URL.RawQuery),
+			Status:          w.Status(),
+			DurationMS:      time.Since(start).Milliseconds(),
+			IPAddress:       c.ClientIP(),
+			RequestHeaders:  recording.Headers(cfg.Redactor, c.Request.Header),
+			ResponseHeaders: recording.Headers(cfg.Redactor, w.Header()),
+			ResponseBody:    recording.Body(cfg.Redactor, w.Header().Get("Content-Type"), w.buf.Bytes()),
+			Truncated:       w.truncated,
+		}
+		if body != nil {
+			rec.RequestBody = recording.Body(cfg.Redactor, c.GetHeader("Content-Type"), body.buf.Bytes())
+			rec.Truncated = rec.Truncated || body.truncated
+		}
+		if id, ok := c.Get("user_id"); ok {
+			if parsed, ok := id.(uuid.UUID); ok {
+				rec.UserID = &parsed
+			}
+		}
+		recorder.Record(rec)
+	}
+}
+
+// records decides whether the request to path is recorded
+func (cfg RequestRecordingConfig) records(path string) bool {
+	for _, pattern := range cfg.ExcludedRoutes {
+		if routeMatches(pattern, path) {
+			return false
+		}
+	}
+	for _, pattern := range cfg.Routes {
+		if routeMatches(pattern, path) {
+			return true
+		}
+	}
+	return cfg.SampleRate > 0 && rand.Float64() < cfg.SampleRate // #nosec G404 -- sampling, not security sensitive
+}
+
+// bodyCapture keeps the first limit bytes read from a request body
+type bodyCapture struct {
+	io.ReadCloser
+	limit     int
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (b *bodyCapture) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.truncated = capture(&b.buf, p[:n], b.limit) || b.truncated
+	return n, err
+}
+
+// recordingWriter keeps the first limit bytes of the response
+type recordingWriter struct {
+	gin.ResponseWriter
+	limit     int
+	buf       bytes.Buffer
+	truncated bool
+	stream    bool
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		w.stream = true
+	}
+	if !w.stream {
+		w.truncated = capture(&w.buf, data, w.limit) || w.truncated
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *recordingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// capture appends data to buf up to limit bytes and reports whether some of
+// it didn't fit
+func capture(buf *bytes.Buffer, data []byte, limit int) bool {
+	room := limit - buf.Len()
+	if room <= 0 {
+		return len(data) > 0
+	}
+	if len(data) > room {
+		buf.Write(data[:room])
+		return true
+	}
+	buf.Write(data)
+	return false
+}
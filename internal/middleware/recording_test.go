@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/recording"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// recordingStore keeps saved recordings in memory
+type recordingStore struct {
+	mu    sync.Mutex
+	saved []recording.Recording
+}
+
+func (s *recordingStore) Save(_ context.Context, recordings []recording.Recording) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saved = append(s.saved, recordings...)
+	return nil
+}
+
+func (s *recordingStore) List(context.Context, recording.Filter) ([]recording.Recording, int, error) {
+	return nil, 0, nil
+}
+
+func (s *recordingStore) Get(context.Context, uuid.UUID) (*recording.Recording, error) {
+	return nil, nil
+}
+
+func (s *recordingStore) DeleteBefore(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
+
+// record sends requests through RequestRecording and returns what was stored
+func record(t *testing.T, cfg RequestRecordingConfig, requests ...*http.Request) []recording.Recording {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	store := &recordingStore{}
+	recorder := recording.NewRecorder(store, recording.Config{}, logrus.New())
+	recorder.Start()
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("request_id", "req-1") })
+	r.Use(RequestRecording(recorder, cfg))
+	r.POST("/admin/users/:id", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.JSON(http.StatusCreated, gin.H{"received": string(body), "access_token": "secret"})
+	})
+	r.GET("/api/v1/events", func(c *gin.Context) { c.String(http.StatusOK, strings.Repeat("x", 100)) })
+	r.GET("/health", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, req := range requests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code >= 400 {
+			t.Fatalf("%s %s: %d", req.Method, req.URL, w.Code)
+		}
+	}
+	recorder.Stop()
+	return store.saved
+}
+
+func TestRequestRecording_RecordsRoutes(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/admin/users/42?email=a@b.io&token=opaque", strings.NewReader(`{"name":"x","password":"hunter2"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer abc")
+
+	saved := record(t, RequestRecordingConfig{Routes: []string{"/admin/*"}, MaxBodyBytes: 1024}, req,
+		httptest.NewRequest(http.MethodGet, "/api/v1/events", nil))
+	if len(saved) != 1 {
+		t.Fatalf("recorded %d requests, want only the admin route", len(saved))
+	}
+	rec := saved[0]
+	if rec.RequestID != "req-1" || rec.Route != "/admin/users/:id" || rec.Path != "/admin/users/42" || rec.Status != http.StatusCreated {
+		t.Errorf("recording = %+v", rec)
+	}
+	if rec.Query != "email=a***@b.io&token=[REDACTED]" || rec.RequestHeaders["Authorization"] != "[REDACTED]" {
+		t.Errorf("query %q, headers %v", rec.Query, rec.RequestHeaders)
+	}
+	if rec.RequestBody != `{"name":"x","password":"[REDACTED]"}` {
+		t.Errorf("request body = %s", rec.RequestBody)
+	}
+	if !strings.Contains(rec.ResponseBody, `"access_token":"[REDACTED]"`) || strings.Contains(rec.ResponseBody, "hunter2") {
+		t.Errorf("response body = %s", rec.ResponseBody)
+	}
+}
+
+func TestRequestRecording_SamplesAndTruncates(t *testing.T) {
+	saved := record(t, RequestRecordingConfig{SampleRate: 1, ExcludedRoutes: []string{"/health*"}, MaxBodyBytes: 10},
+		httptest.NewRequest(http.MethodGet, "/api/v1/events", nil),
+		httptest.NewRequest(http.MethodGet, "/health", nil))
+	if len(saved) != 1 {
+		t.Fatalf("recorded %d requests, want the sampled one and not the excluded", len(saved))
+	}
+	if saved[0].ResponseBody != strings.Repeat("x", 10) || !saved[0].Truncated {
+		t.Errorf("response body %q, truncated %v", saved[0].ResponseBody, saved[0].Truncated)
+	}
+
+	if saved := record(t, RequestRecordingConfig{}, httptest.NewRequest(http.MethodGet, "/api/v1/events", nil)); len(saved) != 0 {
+		t.Errorf("recorded %d requests with no sampling and no routes", len(saved))
+	}
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errorBodyWriter adds "request_id" to JSON error bodies (status >= 400) so
+// clients can quote it when reporting problems. Handlers keep writing plain
+// gin.H{"error": ...} bodies.
+type errorBodyWriter struct {
+	gin.ResponseWriter
+	requestID string
+}
+
+func (w *errorBodyWriter) Write(data []byte) (int, error) {
+	if body, ok := w.withRequestID(data); ok {
+		if _, err := w.ResponseWriter.Write(body); err != nil {
+			return 0, err
+		}
+		// Report the caller's length so the rewrite is transparent to it
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *errorBodyWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *errorBodyWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *errorBodyWriter) withRequestID(data []byte) ([]byte, bool) {
+	if w.Status() < http.StatusBadRequest || w.Written() {
+		return nil, false
+	}
+	if !strings.Contains(w.Header().Get("Content-Type"), "application/json") {
+		return nil, false
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return nil, false
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, false
+	}
+	if _, exists := body["request_id"]; exists {
+		return nil, false
+	}
+	// Error envelopes (/api/v2) carry the request ID inside the error
+	if _, envelope := body["error"].(map[string]interface{}); envelope {
+		return nil, false
+	}
+	body["request_id"] = w.requestID
+
+	rewritten, err := json.Marshal(body)
+	if err != nil {
+		return nil, false
+	}
+	return rewritten, true
+}
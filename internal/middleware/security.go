@@ -3,6 +3,9 @@ package middleware
 import (
 	"net/http"
 	"strings"
+	"sync"
+
+	"highload-microservice/internal/requestid"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -28,6 +31,8 @@ type SecurityConfig struct {
 type SecurityMiddleware struct {
 	config SecurityConfig
 	logger *logrus.Logger
+
+	originsMu sync.RWMutex // guards config.AllowedOrigins, see SetAllowedOrigins
 }
 
 // NewSecurityMiddleware creates a new security middleware
@@ -38,6 +43,13 @@ func NewSecurityMiddleware(config SecurityConfig, logger *logrus.Logger) *Securi
 	}
 }
 
+// SetAllowedOrigins replaces the origins allowed by CORS; empty allows all
+func (sm *SecurityMiddleware) SetAllowedOrigins(origins []string) {
+	sm.originsMu.Lock()
+	defer sm.originsMu.Unlock()
+	sm.config.AllowedOrigins = origins
+}
+
 // SecurityHeaders adds security headers to responses
 func (sm *SecurityMiddleware) SecurityHeaders() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -87,7 +99,7 @@ func (sm *SecurityMiddleware) SecurityHeaders() gin.HandlerFunc {
 		c.Header("Cross-Origin-Resource-Policy", "same-origin")
 
 		// Cache-Control for sensitive endpoints
-		if strings.HasPrefix(c.Request.URL.Path, "/api/v1/auth") {
+		if routeMatches("/api/*/auth*", c.Request.URL.Path) {
 			c.Header("Cache-Control", "no-store, no-cache, must-revalidate, private")
 			c.Header("Pragma", "no-cache")
 			c.Header("Expires", "0")
@@ -108,12 +120,16 @@ func (sm *SecurityMiddleware) CORS() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		origin := c.Request.Header.Get("Origin")
 
+		sm.originsMu.RLock()
+		allowedOrigins := sm.config.AllowedOrigins
+		sm.originsMu.RUnlock()
+
 		// Check if origin is allowed
 		allowed := false
-		if len(sm.config.AllowedOrigins) == 0 {
+		if len(allowedOrigins) == 0 {
 			allowed = true // Allow all origins if none specified
 		} else {
-			for _, allowedOrigin := range sm.config.AllowedOrigins {
+			for _, allowedOrigin := range allowedOrigins {
 				if allowedOrigin == "*" || allowedOrigin == origin {
 					allowed = true
 					break
@@ -155,16 +171,21 @@ func (sm *SecurityMiddleware) CORS() gin.HandlerFunc {
 	}
 }
 
-// RequestID adds a unique request ID to each request
+// RequestID adds a unique request ID to each request. The ID is exposed in the
+// X-Request-ID header, the gin and request contexts, and every JSON error body.
+// A traceparent header is kept in the request context for outbound calls.
 func (sm *SecurityMiddleware) RequestID() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		requestID := c.GetHeader("X-Request-ID")
-		if requestID == "" {
-			requestID = generateRequestID()
+		requestID := c.GetHeader(requestid.Header)
+		if !requestid.Valid(requestID) {
+			requestID = requestid.New()
 		}
 
-		c.Header("X-Request-ID", requestID)
+		c.Header(requestid.Header, requestID)
 		c.Set("request_id", requestID)
+		ctx := requestid.NewContext(c.Request.Context(), requestID)
+		c.Request = c.Request.WithContext(requestid.NewTraceContext(ctx, c.GetHeader(requestid.TraceHeader)))
+		c.Writer = &errorBodyWriter{ResponseWriter: c.Writer, requestID: requestID}
 
 		c.Next()
 	}
@@ -180,7 +201,7 @@ func (sm *SecurityMiddleware) SecurityLogging() gin.HandlerFunc {
 		}
 
 		// Log requests to sensitive endpoints
-		if strings.HasPrefix(c.Request.URL.Path, "/api/v1/auth") {
+		if routeMatches("/api/*/auth*", c.Request.URL.Path) {
 			sm.logger.Infof("Authentication request from IP: %s to %s", c.ClientIP(), c.Request.URL.Path)
 		}
 
@@ -193,22 +214,6 @@ func (sm *SecurityMiddleware) SecurityLogging() gin.HandlerFunc {
 	}
 }
 
-// generateRequestID generates a unique request ID
-func generateRequestID() string {
-	// Simple implementation - in production, use a proper UUID generator
-	return "req_" + randomString(16)
-}
-
-// randomString generates a random string of specified length
-func randomString(length int) string {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = charset[i%len(charset)]
-	}
-	return string(b)
-}
-
 // isSuspiciousUserAgent checks if user agent looks suspicious
 func isSuspiciousUserAgent(userAgent string) bool {
 	if userAgent == "" {
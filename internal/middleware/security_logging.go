@@ -59,6 +59,20 @@ func (slm *SecurityLoggingMiddleware) LogRequest() gin.HandlerFunc {
 		if status >= 400 {
 			slm.logSecurityEvent(c, status)
 		}
+
+		// Route templates keep IDs in paths from counting as distinct
+		// endpoints; unmatched paths (scanners) count as they are
+		route := c.FullPath()
+		if route == "" {
+			route = endpoint
+		}
+		var userID *uuid.UUID
+		if id, ok := c.Get("user_id"); ok {
+			if parsed, ok := id.(uuid.UUID); ok {
+				userID = &parsed
+			}
+		}
+		slm.auditor.ObserveRequest(userID, ipAddress, method, route, status)
 	}
 }
 
@@ -1,10 +1,13 @@
 package middleware
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"highload-microservice/internal/requestid"
+
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
@@ -43,3 +46,59 @@ func TestRequestID_PropagatesExisting(t *testing.T) {
 		t.Fatalf("expected propagated X-Request-ID, got %q", got)
 	}
 }
+
+func TestRequestID_ReplacesInvalidAndPropagatesToContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mw := NewSecurityMiddleware(DefaultSecurityConfig(), logrus.New())
+
+	var fromCtx string
+	r := gin.New()
+	r.Use(mw.RequestID())
+	r.GET("/ping", func(c *gin.Context) {
+		fromCtx = requestid.FromContext(c.Request.Context())
+		c.String(200, "ok")
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ping", nil)
+	req.Header.Set("X-Request-ID", "bad id\twith spaces")
+	r.ServeHTTP(w, req)
+
+	got := w.Header().Get("X-Request-ID")
+	if got == "" || got == "bad id\twith spaces" {
+		t.Fatalf("expected invalid ID to be replaced, got %q", got)
+	}
+	if fromCtx != got {
+		t.Fatalf("expected request context to carry %q, got %q", got, fromCtx)
+	}
+}
+
+func TestRequestID_AddedToErrorBodies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mw := NewSecurityMiddleware(DefaultSecurityConfig(), logrus.New())
+
+	r := gin.New()
+	r.Use(mw.RequestID())
+	r.GET("/fail", func(c *gin.Context) { c.JSON(http.StatusNotFound, gin.H{"error": "User not found"}) })
+	r.GET("/ok", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"status": "ok"}) })
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/fail", nil)
+	req.Header.Set("X-Request-ID", "fixed-id")
+	r.ServeHTTP(w, req)
+
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body["request_id"] != "fixed-id" || body["error"] != "User not found" {
+		t.Fatalf("unexpected error body: %v", body)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/ok", nil)
+	r.ServeHTTP(w, req)
+	if w.Body.String() != `{"status":"ok"}` {
+		t.Fatalf("success bodies must be untouched, got %s", w.Body.String())
+	}
+}
@@ -52,3 +52,29 @@ func TestCORS(t *testing.T) {
 		t.Fatalf("cors allow origin not set")
 	}
 }
+
+func TestCORS_SetAllowedOrigins(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	cfg := DefaultSecurityConfig()
+	cfg.AllowedOrigins = []string{"http://example.com"}
+	sm := NewSecurityMiddleware(cfg, logrus.New())
+	r.Use(sm.CORS())
+	r.GET("/ping", func(c *gin.Context) { c.String(200, "pong") })
+
+	allowed := func(origin string) bool {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ping", nil)
+		req.Header.Set("Origin", origin)
+		r.ServeHTTP(w, req)
+		return w.Header().Get("Access-Control-Allow-Origin") == origin
+	}
+
+	sm.SetAllowedOrigins([]string{"http://new.example.com"})
+	if allowed("http://example.com") {
+		t.Fatalf("removed origin still allowed")
+	}
+	if !allowed("http://new.example.com") {
+		t.Fatalf("added origin not allowed")
+	}
+}
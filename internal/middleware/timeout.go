@@ -0,0 +1,185 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// timeoutWriteGrace is how long after its deadline a request may still write
+// its (504) response
+const timeoutWriteGrace = 5 * time.Second
+
+// RequestTimeoutConfig configures RequestTimeout
+type RequestTimeoutConfig struct {
+	Timeout time.Duration  // deadline of every request; 0 = none
+	Routes  []RouteTimeout // per-route overrides, first match wins
+}
+
+// RouteTimeout overrides the deadline of requests matching Method and
+// Pattern. Pattern is a gin route path; a trailing * matches any suffix and a
+// * segment any one segment. An
+// empty Method matches every method, and a zero Timeout removes the deadline
+// (streams).
+type RouteTimeout struct {
+	Method  string
+	Pattern string
+	Timeout time.Duration
+}
+
+// ParseRouteTimeouts parses REQUEST_TIMEOUT_ROUTES entries of the form
+// "[METHOD ]PATTERN=DURATION", e.g. "/admin/*=60s" or "GET /api/v1/events/stats=30s"
+func ParseRouteTimeouts(entries []string) ([]RouteTimeout, error) {
+	var routes []RouteTimeout
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		eq := strings.LastIndex(entry, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("invalid route timeout %q: expected PATTERN=DURATION", entry)
+		}
+
+		var route RouteTimeout
+		if fields := strings.Fields(entry[:eq]); len(fields) == 2 {
+			route.Method, route.Pattern = strings.ToUpper(fields[0]), fields[1]
+		} else if len(fields) == 1 {
+			route.Pattern = fields[0]
+		} else {
+			return nil, fmt.Errorf("invalid route timeout %q: bad route", entry)
+		}
+
+		timeout, err := time.ParseDuration(strings.TrimSpace(entry[eq+1:]))
+		if err != nil || timeout < 0 {
+			return nil, fmt.Errorf("invalid route timeout %q: bad duration", entry)
+		}
+		route.Timeout = timeout
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// RequestTimeout gives every request a deadline on c.Request.Context(), so
+// database, cache and broker calls made for it give up once it has passed.
+// If the deadline passes before the handler has written a response, what it
+// writes afterwards is discarded and the client gets 504 with a JSON error.
+//
+// The handler is not interrupted: it returns when its calls observe the
+// deadline. WebSocket upgrades never get a deadline.
+func RequestTimeout(cfg RequestTimeoutConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout := cfg.timeoutFor(c)
+		if timeout <= 0 || c.GetHeader("Upgrade") != "" {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		// Deadlines longer than the server's WriteTimeout still get to respond
+		_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(timeout + timeoutWriteGrace))
+
+		w := &timeoutWriter{ResponseWriter: c.Writer, ctx: ctx}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if w.expired() {
+			c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{"error": "Request timed out"})
+		}
+	}
+}
+
+// timeoutFor returns the deadline of the request's route
+func (cfg RequestTimeoutConfig) timeoutFor(c *gin.Context) time.Duration {
+	path := c.FullPath()
+	if path == "" {
+		path = c.Request.URL.Path
+	}
+	for _, route := range cfg.Routes {
+		if (route.Method == "" || route.Method == c.Request.Method) && routeMatches(route.Pattern, path) {
+			return route.Timeout
+		}
+	}
+	return cfg.Timeout
+}
+
+// routeMatches reports whether path matches pattern; a trailing * in pattern
+// matches any suffix and a * segment any one segment, so /api/*/auth/*
+// covers the auth routes of every API version
+func routeMatches(pattern, path string) bool {
+	prefix, anySuffix := strings.CutSuffix(pattern, "*")
+	if !strings.Contains(prefix, "*") {
+		if anySuffix {
+			return strings.HasPrefix(path, prefix)
+		}
+		return pattern == path
+	}
+
+	patternSegments := strings.Split(prefix, "/")
+	pathSegments := strings.Split(path, "/")
+	last := len(patternSegments) - 1
+	if len(pathSegments) < len(patternSegments) || (!anySuffix && len(pathSegments) != len(patternSegments)) {
+		return false
+	}
+	for i, segment := range patternSegments[:last] {
+		if segment != "*" && segment != pathSegments[i] {
+			return false
+		}
+	}
+	if anySuffix {
+		return strings.HasPrefix(pathSegments[last], patternSegments[last])
+	}
+	return patternSegments[last] == "*" || patternSegments[last] == pathSegments[last]
+}
+
+// timeoutWriter discards the handler's response once the deadline has passed
+// without anything written, leaving the 504 to RequestTimeout
+type timeoutWriter struct {
+	gin.ResponseWriter
+	ctx      context.Context
+	timedOut bool
+}
+
+// expired reports whether the deadline passed before a response was written
+func (w *timeoutWriter) expired() bool {
+	if !w.timedOut && !w.ResponseWriter.Written() && errors.Is(w.ctx.Err(), context.DeadlineExceeded) {
+		w.timedOut = true
+	}
+	return w.timedOut
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	if !w.expired() {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	if !w.expired() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	if w.expired() {
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *timeoutWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func timeoutRouter(cfg RequestTimeoutConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestTimeout(cfg))
+	slow := func(c *gin.Context) {
+		select {
+		case <-c.Request.Context().Done():
+		case <-time.After(100 * time.Millisecond):
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+	r.GET("/slow", slow)
+	r.GET("/admin/report", slow)
+	r.GET("/fast", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) })
+	r.GET("/deadline", func(c *gin.Context) {
+		_, ok := c.Request.Context().Deadline()
+		c.JSON(http.StatusOK, gin.H{"deadline": ok})
+	})
+	return r
+}
+
+func TestRequestTimeout(t *testing.T) {
+	r := timeoutRouter(RequestTimeoutConfig{
+		Timeout: 20 * time.Millisecond,
+		Routes:  []RouteTimeout{{Pattern: "/admin/*", Timeout: time.Second}, {Method: http.MethodGet, Pattern: "/deadline"}},
+	})
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/slow", http.StatusGatewayTimeout, `{"error":"Request timed out"}`},
+		{"/fast", http.StatusOK, `{"ok":true}`},
+		{"/admin/report", http.StatusOK, `{"ok":true}`},
+		{"/deadline", http.StatusOK, `{"deadline":false}`},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, tt.path, nil)
+		r.ServeHTTP(w, req)
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("%s: got %d %s, want %d %s", tt.path, w.Code, w.Body.String(), tt.code, tt.body)
+		}
+	}
+}
+
+func TestParseRouteTimeouts(t *testing.T) {
+	routes, err := ParseRouteTimeouts([]string{"/admin/*=60s", " get /api/v1/events/stats=30s", ""})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []RouteTimeout{
+		{Pattern: "/admin/*", Timeout: time.Minute},
+		{Method: http.MethodGet, Pattern: "/api/v1/events/stats", Timeout: 30 * time.Second},
+	}
+	if len(routes) != len(want) {
+		t.Fatalf("got %v, want %v", routes, want)
+	}
+	for i := range want {
+		if routes[i] != want[i] {
+			t.Errorf("route %d: got %+v, want %+v", i, routes[i], want[i])
+		}
+	}
+
+	for _, bad := range []string{"/admin/*", "/admin/*=soon", "/admin/*=-1s", "GET POST /x=1s"} {
+		if _, err := ParseRouteTimeouts([]string{bad}); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
+
+func TestRouteMatches(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/health", "/health", true},
+		{"/health*", "/health/ready", true},
+		{"/admin/*", "/admin", false},
+		{"/api/*/events/stream", "/api/v2/events/stream", true},
+		{"/api/*/events/stream", "/api/v1/events/stream/x", false},
+		{"/api/*/auth/*", "/api/v1/auth/login", true},
+		{"/api/*/auth/*", "/api/v1/auth", false},
+		{"/api/*/auth*", "/api/v2/auth", true},
+		{"/api/*/auth*", "/api/v2/users", false},
+		{"/api/*", "/api", false},
+	}
+	for _, tt := range tests {
+		if got := routeMatches(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("routeMatches(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
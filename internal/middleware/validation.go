@@ -1,10 +1,12 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"reflect"
 	"strings"
 
+	"highload-microservice/internal/password"
 	"highload-microservice/internal/validation"
 
 	"github.com/gin-gonic/gin"
@@ -31,6 +33,12 @@ func NewValidationMiddleware(logger *logrus.Logger) *ValidationMiddleware {
 	}
 }
 
+// SetPasswordChecker makes strong_password fields follow the configured
+// password policy
+func (vm *ValidationMiddleware) SetPasswordChecker(checker *password.Checker) {
+	vm.validator.SetPasswordChecker(checker)
+}
+
 // ValidateStruct validates a struct and returns errors
 func (vm *ValidationMiddleware) ValidateStruct(obj interface{}) []validation.ValidationError {
 	if err := vm.validator.Validate(obj); err != nil {
@@ -144,11 +152,28 @@ func (vm *ValidationMiddleware) sanitizeString(input string) string {
 	return result.String()
 }
 
-// ValidateFileUpload validates file uploads
+// multipartOverhead is the room left in upload bodies for the multipart
+// boundaries, part headers and other form fields
+const multipartOverhead = 1 << 20
+
+// ValidateFileUpload validates the multipart "file" field of uploads. The
+// body is capped before it is parsed, so oversized uploads are refused
+// without being buffered.
 func (vm *ValidationMiddleware) ValidateFileUpload(maxSize int64, allowedTypes []string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+multipartOverhead)
 		file, header, err := c.Request.FormFile("file")
 		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				vm.logger.Warnf("Upload body too large (max: %d)", maxSize)
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+					"error":    "File too large",
+					"max_size": maxSize,
+				})
+				c.Abort()
+				return
+			}
 			vm.logger.Warnf("File upload failed: %v", err)
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": "No file uploaded",
@@ -161,7 +186,7 @@ func (vm *ValidationMiddleware) ValidateFileUpload(maxSize int64, allowedTypes [
 		// Check file size
 		if header.Size > maxSize {
 			vm.logger.Warnf("File too large: %d bytes (max: %d)", header.Size, maxSize)
-			c.JSON(http.StatusBadRequest, gin.H{
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
 				"error":    "File too large",
 				"max_size": maxSize,
 			})
@@ -2,8 +2,10 @@ package middleware
 
 import (
 	"bytes"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -45,3 +47,52 @@ func TestValidationMiddleware_ValidateRequest_Bad(t *testing.T) {
 		t.Fatalf("expected 400, got %d", w.Code)
 	}
 }
+
+func uploadRequest(t *testing.T, contentType string, data []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="file"; filename="avatar"`)
+	header.Set("Content-Type", contentType)
+	part, err := form.CreatePart(header)
+	if err != nil {
+		t.Fatalf("create part: %v", err)
+	}
+	_, _ = part.Write(data)
+	_ = form.Close()
+	req, _ := http.NewRequest("POST", "/", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+func TestValidationMiddleware_ValidateFileUpload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	vm := NewValidationMiddleware(logrus.New())
+	r.POST("/", vm.ValidateFileUpload(16, []string{"image/png"}), func(c *gin.Context) {
+		if _, ok := c.Get("uploaded_file"); !ok {
+			t.Error("uploaded_file not set")
+		}
+		c.String(200, "ok")
+	})
+
+	cases := []struct {
+		name        string
+		contentType string
+		size        int
+		want        int
+	}{
+		{"allowed", "image/png", 16, http.StatusOK},
+		{"wrong type", "text/plain", 4, http.StatusBadRequest},
+		{"too large", "image/png", 17, http.StatusRequestEntityTooLarge},
+		{"body over the cap", "image/png", 2 << 20, http.StatusRequestEntityTooLarge},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, uploadRequest(t, tc.contentType, bytes.Repeat([]byte("x"), tc.size)))
+		if w.Code != tc.want {
+			t.Errorf("%s: status=%d, want %d (%s)", tc.name, w.Code, tc.want, w.Body.String())
+		}
+	}
+}
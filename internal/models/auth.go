@@ -28,19 +28,38 @@ type AuthUser struct {
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// Profile is the authenticated user's own account as edited through
+// PUT /auth/profile
+type Profile struct {
+	AuthUser
+	PendingEmail string `json:"pending_email,omitempty" db:"pending_email"` // awaiting confirmation
+}
+
 // LoginRequest represents login request
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email" validate:"required,email,email_domain,no_sql_injection,no_xss"`
 	Password string `json:"password" binding:"required,min=8" validate:"required,min=8,max=128,no_sql_injection,no_xss"`
 }
 
+// RegisterRequest signs up a new account, activated once its email is verified
+type RegisterRequest struct {
+	Email     string `json:"email" binding:"required,email" validate:"required,email,email_domain,no_sql_injection,no_xss"`
+	Password  string `json:"password" binding:"required" validate:"required,strong_password"`
+	FirstName string `json:"first_name" binding:"required" validate:"required,min=1,max=100,safe_string,no_sql_injection,no_xss"`
+	LastName  string `json:"last_name" binding:"required" validate:"required,min=1,max=100,safe_string,no_sql_injection,no_xss"`
+}
+
 // LoginResponse represents login response
 type LoginResponse struct {
-	AccessToken  string   `json:"access_token"`
-	RefreshToken string   `json:"refresh_token"`
+	AccessToken  string   `json:"access_token,omitempty"` // empty when tokens are only set as cookies
+	RefreshToken string   `json:"refresh_token,omitempty"`
 	TokenType    string   `json:"token_type"`
 	ExpiresIn    int64    `json:"expires_in"`
 	User         AuthUser `json:"user"`
+	CSRFToken    string   `json:"csrf_token,omitempty"` // with cookie sessions, for the X-CSRF-Token header
+	// With PASSWORD_MAX_AGE_DAYS, when the password expires and whether it has
+	PasswordExpiresAt *time.Time `json:"password_expires_at,omitempty"`
+	PasswordExpired   bool       `json:"password_expired,omitempty"`
 }
 
 // RefreshTokenRequest represents refresh token request
@@ -48,8 +67,30 @@ type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required" validate:"required,min=32,max=128,safe_string,no_sql_injection,no_xss"`
 }
 
+// LogoutRequest optionally names the refresh token to revoke with the access token
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"omitempty,max=128"`
+}
+
+// Session is a login of the current user: the chain of refresh tokens issued
+// since, identified by the token family
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// UpdateRoleRequest represents a role change by an administrator
+type UpdateRoleRequest struct {
+	Role UserRole `json:"role" binding:"required,oneof=admin user readonly"`
+}
+
 // JWTClaims represents JWT token claims
 type JWTClaims struct {
+	ID        string    `json:"jti"` // empty in tokens issued before logout revocation
 	UserID    uuid.UUID `json:"user_id"`
 	Email     string    `json:"email"`
 	Role      UserRole  `json:"role"`
@@ -93,10 +134,36 @@ type APIKey struct {
 	ID          uuid.UUID  `json:"id" db:"id"`
 	Name        string     `json:"name" db:"name"`
 	KeyHash     string     `json:"-" db:"key_hash"`
+	KeyPrefix   string     `json:"-" db:"key_prefix"`
+	MaskedKey   string     `json:"masked_key"`
 	Permissions []string   `json:"permissions" db:"permissions"`
 	IsActive    bool       `json:"is_active" db:"is_active"`
 	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
 	ExpiresAt   *time.Time `json:"expires_at" db:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at" db:"last_used_at"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	RotatedAt   *time.Time `json:"rotated_at,omitempty" db:"rotated_at"`
+	// The secret replaced by the last rotation is accepted until then
+	PreviousKeyExpiresAt *time.Time `json:"previous_key_expires_at,omitempty" db:"previous_expires_at"`
+
+	RateLimitPerMinute int   `json:"rate_limit_per_minute" db:"rate_limit_per_minute"` // 0 = global limit
+	MonthlyQuota       int64 `json:"monthly_quota" db:"monthly_quota"`                 // 0 = unlimited
+	MonthlyUsage       int64 `json:"monthly_usage"`                                    // requests this month (UTC)
+}
+
+// APIKeyLimits is the rate limit and quota applied to requests made with an
+// API key
+type APIKeyLimits struct {
+	ID                 uuid.UUID `json:"id"`
+	RateLimitPerMinute int       `json:"rate_limit_per_minute"`
+	MonthlyQuota       int64     `json:"monthly_quota"`
+}
+
+// UpdateAPIKeyLimitsRequest changes an API key's limits; omitted fields are
+// kept
+type UpdateAPIKeyLimitsRequest struct {
+	RateLimitPerMinute *int   `json:"rate_limit_per_minute" binding:"omitempty,min=0,max=1000000"`
+	MonthlyQuota       *int64 `json:"monthly_quota" binding:"omitempty,min=0"`
 }
 
 // CreateAPIKeyRequest represents API key creation request
@@ -104,13 +171,25 @@ type CreateAPIKeyRequest struct {
 	Name        string     `json:"name" binding:"required,min=3,max=50" validate:"required,min=3,max=50,safe_string,no_sql_injection,no_xss"`
 	Permissions []string   `json:"permissions" binding:"required" validate:"required,min=1,dive,required,safe_string,no_sql_injection,no_xss"`
 	ExpiresAt   *time.Time `json:"expires_at"`
+
+	RateLimitPerMinute int   `json:"rate_limit_per_minute" binding:"omitempty,min=0,max=1000000" validate:"omitempty,min=0,max=1000000"`
+	MonthlyQuota       int64 `json:"monthly_quota" binding:"omitempty,min=0" validate:"omitempty,min=0"`
 }
 
-// CreateAPIKeyResponse represents API key creation response
+// CreateAPIKeyResponse represents API key creation (and rotation) response
 type CreateAPIKeyResponse struct {
 	ID        uuid.UUID  `json:"id"`
 	Name      string     `json:"name"`
 	APIKey    string     `json:"api_key"` // Only shown once during creation
 	ExpiresAt *time.Time `json:"expires_at"`
 	CreatedAt time.Time  `json:"created_at"`
+
+	PreviousKeyExpiresAt *time.Time `json:"previous_key_expires_at,omitempty"` // rotation only
+}
+
+// RotateAPIKeyRequest represents an API key rotation request. GraceSeconds
+// defaults to API_KEY_ROTATION_GRACE_MINUTES; 0 invalidates the old secret
+// immediately.
+type RotateAPIKeyRequest struct {
+	GraceSeconds *int `json:"grace_seconds" binding:"omitempty,min=0,max=604800"`
 }
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -11,6 +12,7 @@ type Event struct {
 	UserID    uuid.UUID `json:"user_id" db:"user_id"`
 	Type      string    `json:"type" db:"type"`
 	Data      string    `json:"data" db:"data"`
+	Encrypted bool      `json:"encrypted,omitempty" db:"-"` // Data withheld: encrypted at rest and caller may not read it
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
@@ -20,17 +22,89 @@ type CreateEventRequest struct {
 	Data   string    `json:"data" binding:"required" validate:"required,min=1,max=1000,safe_string,no_sql_injection,no_xss"`
 }
 
+// Outcomes of a line of a bulk ingestion
+const (
+	BulkEventCreated = "created"
+	BulkEventFailed  = "failed"
+)
+
+// BulkEventResult is the outcome of one line of a bulk ingestion
+type BulkEventResult struct {
+	Line   int        `json:"line"` // 1-based line of the request body
+	Status string     `json:"status"`
+	ID     *uuid.UUID `json:"id,omitempty"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// BulkEventResponse reports a bulk ingestion line by line. Error is set when
+// the ingestion stopped before the end of the body; lines after the last
+// result were not read.
+type BulkEventResponse struct {
+	Created int               `json:"created"`
+	Failed  int               `json:"failed"`
+	Results []BulkEventResult `json:"results"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// EventType is a registered event type
+type EventType struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Enabled     bool            `json:"enabled"`
+	Schema      json.RawMessage `json:"schema,omitempty"` // payload schema in effect, if any
+	UpdatedBy   *uuid.UUID      `json:"updated_by,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
 type EventListResponse struct {
-	Events []Event `json:"events"`
-	Total  int     `json:"total"`
-	Page   int     `json:"page"`
-	Limit  int     `json:"limit"`
+	Events     []Event `json:"events"`
+	Total      int     `json:"total"`
+	Page       int     `json:"page,omitempty"` // not set in cursor mode
+	Limit      int     `json:"limit"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+	// Registered types of the listed events by name, with ?expand=type
+	Types map[string]EventType `json:"types,omitempty"`
 }
 
 type KafkaEvent struct {
 	ID        uuid.UUID `json:"id"`
 	UserID    uuid.UUID `json:"user_id"`
 	Type      string    `json:"type"`
+	Version   int       `json:"version,omitempty"` // schema version of Data; 0 means version 1
 	Data      string    `json:"data"`
 	Timestamp time.Time `json:"timestamp"`
+	RequestID string    `json:"request_id,omitempty"` // HTTP request that caused the event
+	Replay    bool      `json:"replay,omitempty"`     // published again by a replay job; consumers process it even if seen before
+}
+
+// EventReplayRequest selects stored events to publish to the broker again
+type EventReplayRequest struct {
+	From      *time.Time `json:"from,omitempty"`
+	To        *time.Time `json:"to,omitempty"` // exclusive
+	Types     []string   `json:"types,omitempty"`
+	Topic     string     `json:"topic,omitempty"`      // publish here instead of each type's topic (Kafka only)
+	AllEvents bool       `json:"all_events,omitempty"` // required to replay without from, to or types
+}
+
+// Replay job states
+const (
+	ReplayRunning   = "running"
+	ReplayCompleted = "completed"
+	ReplayFailed    = "failed"
+	ReplayCanceled  = "canceled" // interrupted by shutdown
+)
+
+// EventReplayJob reports the progress of a replay
+type EventReplayJob struct {
+	ID         uuid.UUID          `json:"id"`
+	Status     string             `json:"status"`
+	Request    EventReplayRequest `json:"request"`
+	Total      int                `json:"total"` // matching events when the job started
+	Published  int                `json:"published"`
+	Error      string             `json:"error,omitempty"`
+	StartedBy  *uuid.UUID         `json:"started_by,omitempty"`
+	StartedAt  time.Time          `json:"started_at"`
+	UpdatedAt  time.Time          `json:"updated_at"`
+	FinishedAt *time.Time         `json:"finished_at,omitempty"`
 }
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// InvitationStatus is the state of an invitation. Expired is never stored:
+// it is reported for pending invitations past their expiry.
+type InvitationStatus string
+
+const (
+	InvitationPending  InvitationStatus = "pending"
+	InvitationAccepted InvitationStatus = "accepted"
+	InvitationRevoked  InvitationStatus = "revoked"
+	InvitationExpired  InvitationStatus = "expired"
+)
+
+// Invitation is an emailed offer to create an account with a given role
+type Invitation struct {
+	ID         uuid.UUID        `json:"id" db:"id"`
+	Email      string           `json:"email" db:"email"`
+	FirstName  string           `json:"first_name" db:"first_name"`
+	LastName   string           `json:"last_name" db:"last_name"`
+	Role       UserRole         `json:"role" db:"role"`
+	Status     InvitationStatus `json:"status" db:"status"`
+	InvitedBy  *uuid.UUID       `json:"invited_by,omitempty" db:"invited_by"`
+	UserID     *uuid.UUID       `json:"user_id,omitempty" db:"user_id"` // the account created on acceptance
+	ExpiresAt  time.Time        `json:"expires_at" db:"expires_at"`
+	CreatedAt  time.Time        `json:"created_at" db:"created_at"`
+	AcceptedAt *time.Time       `json:"accepted_at,omitempty" db:"accepted_at"`
+}
+
+// InviteUserRequest invites someone to create an account; the role defaults to user
+type InviteUserRequest struct {
+	Email     string   `json:"email" binding:"required,email" validate:"required,email,email_domain,no_sql_injection,no_xss"`
+	FirstName string   `json:"first_name" validate:"omitempty,max=100,safe_string,no_sql_injection,no_xss"`
+	LastName  string   `json:"last_name" validate:"omitempty,max=100,safe_string,no_sql_injection,no_xss"`
+	Role      UserRole `json:"role" binding:"omitempty,oneof=admin user readonly"`
+}
+
+// AcceptInviteRequest creates the invited account with the invitee's password
+type AcceptInviteRequest struct {
+	Token    string `json:"token" binding:"required" validate:"required,min=32,max=128,safe_string"`
+	Password string `json:"password" binding:"required" validate:"required,strong_password"`
+}
@@ -7,18 +7,31 @@ import (
 )
 
 type User struct {
-	ID        uuid.UUID `json:"id" db:"id"`
-	Email     string    `json:"email" db:"email"`
-	FirstName string    `json:"first_name" db:"first_name"`
-	LastName  string    `json:"last_name" db:"last_name"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ID        uuid.UUID  `json:"id" db:"id"`
+	Email     string     `json:"email" db:"email"`
+	FirstName string     `json:"first_name" db:"first_name"`
+	LastName  string     `json:"last_name" db:"last_name"`
+	IsActive  bool       `json:"is_active" db:"is_active"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	// AuthUserID is the account that owns the record; written on create and
+	// read only by ownership checks
+	AuthUserID *uuid.UUID `json:"-" db:"auth_user_id"`
 }
 
 type CreateUserRequest struct {
 	Email     string `json:"email" binding:"required,email" validate:"required,email,email_domain,no_sql_injection,no_xss"`
 	FirstName string `json:"first_name" binding:"required" validate:"required,min=1,max=100,safe_string,no_sql_injection,no_xss"`
 	LastName  string `json:"last_name" binding:"required" validate:"required,min=1,max=100,safe_string,no_sql_injection,no_xss"`
+	// AuthUserID links the record to the account that may act on it as its owner
+	AuthUserID *uuid.UUID `json:"auth_user_id,omitempty"`
+}
+
+// SetUserOwnerRequest links a user record to an account, or unlinks it when
+// AuthUserID is null
+type SetUserOwnerRequest struct {
+	AuthUserID *uuid.UUID `json:"auth_user_id"`
 }
 
 type UpdateUserRequest struct {
@@ -28,8 +41,30 @@ type UpdateUserRequest struct {
 }
 
 type UserListResponse struct {
-	Users []User `json:"users"`
-	Total int    `json:"total"`
-	Page  int    `json:"page"`
-	Limit int    `json:"limit"`
+	Users      []User `json:"users"`
+	Total      int    `json:"total"`
+	Page       int    `json:"page,omitempty"` // not set in cursor mode
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Sort fields and directions accepted by UserFilter
+const (
+	UserSortCreatedAt = "created_at"
+	UserSortEmail     = "email"
+
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// UserFilter narrows and orders ListUsers. Zero values match everything and
+// sort by created_at, newest first.
+type UserFilter struct {
+	Query          string // case-insensitive substring of email, first or last name
+	Email          string // exact email
+	CreatedAfter   time.Time
+	CreatedBefore  time.Time
+	Sort           string // created_at (default) or email
+	Order          string // asc or desc; defaults to desc for created_at, asc for email
+	IncludeDeleted bool
 }
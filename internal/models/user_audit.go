@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Actions recorded in the user audit trail
+const (
+	UserAuditCreated     = "created"
+	UserAuditUpdated     = "updated"
+	UserAuditDeleted     = "deleted"
+	UserAuditRestored    = "restored"
+	UserAuditActivated   = "activated"
+	UserAuditDeactivated = "deactivated"
+)
+
+// FieldChange is the old and new value of a changed field
+type FieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// UserAuditEntry records one change to a user
+type UserAuditEntry struct {
+	ID        uuid.UUID              `json:"id" db:"id"`
+	UserID    uuid.UUID              `json:"user_id" db:"user_id"`
+	Action    string                 `json:"action" db:"action"`
+	ActorID   *uuid.UUID             `json:"actor_id,omitempty" db:"actor_id"` // nil for unauthenticated or internal callers
+	RequestID string                 `json:"request_id,omitempty" db:"request_id"`
+	Changes   map[string]FieldChange `json:"changes" db:"changes"`
+	CreatedAt time.Time              `json:"created_at" db:"created_at"`
+}
+
+type UserAuditListResponse struct {
+	Entries []UserAuditEntry `json:"entries"`
+	Total   int              `json:"total"`
+	Page    int              `json:"page"`
+	Limit   int              `json:"limit"`
+}
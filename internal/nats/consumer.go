@@ -0,0 +1,136 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"highload-microservice/internal/config"
+	"highload-microservice/internal/models"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Consumer reads events through a durable pull consumer shared by all
+// replicas, so each event goes to one of them.
+//
+// Events are acknowledged when they are committed; unacknowledged events are
+// redelivered after AckWait, up to MaxDeliver times. Unlike Kafka partitions,
+// redelivery does not keep the order of a user's events across replicas.
+// Events that cannot be decoded are terminated so they do not come back.
+type Consumer struct {
+	cfg config.NATSConfig
+	nc  *nats.Conn
+	js  jetstream.JetStream
+
+	mu       sync.Mutex
+	consumer jetstream.Consumer
+	buffer   []jetstream.Msg
+}
+
+func NewConsumer(cfg config.NATSConfig) (*Consumer, error) {
+	if cfg.Stream == "" || cfg.SubjectPrefix == "" || cfg.Durable == "" {
+		return nil, fmt.Errorf("NATS_STREAM, NATS_SUBJECT_PREFIX and NATS_DURABLE are required for the nats messaging backend")
+	}
+	if cfg.FetchBatch < 1 {
+		cfg.FetchBatch = 1
+	}
+	if cfg.FetchWait < 1 {
+		cfg.FetchWait = 1
+	}
+	nc, js, err := connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Consumer{cfg: cfg, nc: nc, js: js}, nil
+}
+
+// FetchMessage reads the next event. The returned commit acknowledges it.
+func (c *Consumer) FetchMessage(ctx context.Context) (models.KafkaEvent, func(context.Context) error, error) {
+	var event models.KafkaEvent
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.buffer) == 0 {
+		if err := c.fetch(ctx); err != nil {
+			return event, nil, err
+		}
+	}
+
+	msg := c.buffer[0]
+	c.buffer = c.buffer[1:]
+
+	event, err := decode(msg.Data(), msg.Headers())
+	if err != nil {
+		_ = msg.Term()
+		return event, nil, fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+
+	commit := func(ctx context.Context) error {
+		if err := msg.Ack(); err != nil {
+			return fmt.Errorf("failed to acknowledge message: %w", err)
+		}
+		return nil
+	}
+	return event, commit, nil
+}
+
+// fetch waits up to FetchWait for a batch of events and buffers it. Events
+// buffered when ctx is cancelled are redelivered after AckWait.
+func (c *Consumer) fetch(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to read message: %w", err)
+	}
+	if c.consumer == nil {
+		consumer, err := c.durable(ctx)
+		if err != nil {
+			return err
+		}
+		c.consumer = consumer
+	}
+
+	batch, err := c.consumer.Fetch(c.cfg.FetchBatch, jetstream.FetchMaxWait(seconds(c.cfg.FetchWait)))
+	if err != nil {
+		return fmt.Errorf("failed to read message: %w", err)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to read message: %w", ctx.Err())
+		case msg, ok := <-batch.Messages():
+			if !ok {
+				if err := batch.Error(); err != nil {
+					return fmt.Errorf("failed to read message: %w", err)
+				}
+				return nil
+			}
+			c.buffer = append(c.buffer, msg)
+		}
+	}
+}
+
+// durable creates or updates the consumer, and the stream when missing
+func (c *Consumer) durable(ctx context.Context) (jetstream.Consumer, error) {
+	if err := ensureStream(ctx, c.js, c.cfg); err != nil {
+		return nil, err
+	}
+	consumer, err := c.js.CreateOrUpdateConsumer(ctx, c.cfg.Stream, jetstream.ConsumerConfig{
+		Durable:       c.cfg.Durable,
+		FilterSubject: c.cfg.SubjectPrefix + ".>",
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       seconds(c.cfg.AckWait),
+		MaxDeliver:    c.cfg.MaxDeliver,
+		DeliverPolicy: jetstream.DeliverAllPolicy,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consumer %s: %w", c.cfg.Durable, err)
+	}
+	return consumer, nil
+}
+
+func (c *Consumer) Close() error {
+	c.nc.Close()
+	return nil
+}
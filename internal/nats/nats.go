@@ -0,0 +1,104 @@
+// Package nats publishes and consumes events through a NATS JetStream stream
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"highload-microservice/internal/config"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/requestid"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// connect returns a connection that is established in the background when the
+// servers are down and reconnects for as long as it is open
+func connect(cfg config.NATSConfig) (*nats.Conn, jetstream.JetStream, error) {
+	opts := []nats.Option{
+		nats.Name("highload-microservice"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+	}
+	if cfg.Username != "" {
+		opts = append(opts, nats.UserInfo(cfg.Username, cfg.Password))
+	}
+	nc, err := nats.Connect(cfg.URL, opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+	return nc, js, nil
+}
+
+// ensureStream creates the stream when it does not exist. An existing stream
+// is left as configured by the operator.
+func ensureStream(ctx context.Context, js jetstream.JetStream, cfg config.NATSConfig) error {
+	_, err := js.Stream(ctx, cfg.Stream)
+	if errors.Is(err, jetstream.ErrStreamNotFound) {
+		_, err = js.CreateStream(ctx, jetstream.StreamConfig{
+			Name:     cfg.Stream,
+			Subjects: []string{cfg.SubjectPrefix + ".>"},
+			Storage:  jetstream.FileStorage,
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get stream %s: %w", cfg.Stream, err)
+	}
+	return nil
+}
+
+// subject is the subject event is published to. Subjects are split on dots,
+// so dots and wildcards in the event type are replaced.
+func subject(prefix string, event models.KafkaEvent) string {
+	token := strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_").Replace(event.Type)
+	if token == "" {
+		token = "unknown"
+	}
+	return prefix + "." + token
+}
+
+// encode builds the message of event; the event ID deduplicates retried
+// publishes within the stream's duplicate window
+func encode(prefix string, event models.KafkaEvent) (*nats.Msg, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event: %w", err)
+	}
+	msg := nats.NewMsg(subject(prefix, event))
+	msg.Data = data
+	if event.ID != uuid.Nil {
+		msg.Header.Set(jetstream.MsgIDHeader, event.ID.String())
+	}
+	if event.RequestID != "" {
+		msg.Header.Set(requestid.Header, event.RequestID)
+	}
+	return msg, nil
+}
+
+// decode reads the event of a message, taking the request ID from the header
+// when the producer only set that
+func decode(data []byte, header nats.Header) (models.KafkaEvent, error) {
+	var event models.KafkaEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return event, err
+	}
+	if event.RequestID == "" {
+		event.RequestID = header.Get(requestid.Header)
+	}
+	return event, nil
+}
+
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
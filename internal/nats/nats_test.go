@@ -0,0 +1,56 @@
+package nats
+
+import (
+	"testing"
+	"time"
+
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/requestid"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestEncode_SubjectAndHeaders(t *testing.T) {
+	event := models.KafkaEvent{ID: uuid.New(), UserID: uuid.New(), Type: "user.created", Data: "{}", Timestamp: time.Now().UTC(), RequestID: "req-1"}
+
+	msg, err := encode("events", event)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	// Dots in the type would add subject tokens
+	if msg.Subject != "events.user_created" {
+		t.Fatalf("subject = %q", msg.Subject)
+	}
+	if msg.Header.Get(jetstream.MsgIDHeader) != event.ID.String() || msg.Header.Get(requestid.Header) != "req-1" {
+		t.Fatalf("headers = %v", msg.Header)
+	}
+
+	got, err := decode(msg.Data, msg.Header)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.ID != event.ID || got.Type != event.Type || got.RequestID != "req-1" {
+		t.Fatalf("unexpected event: %+v", got)
+	}
+}
+
+func TestDecode_RequestIDFromHeader(t *testing.T) {
+	header := nats.Header{}
+	header.Set(requestid.Header, "req-2")
+
+	got, err := decode([]byte(`{"id":"`+uuid.NewString()+`","type":"user_updated"}`), header)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.RequestID != "req-2" {
+		t.Fatalf("request ID = %q", got.RequestID)
+	}
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	if _, err := decode([]byte("not-json"), nil); err == nil {
+		t.Fatalf("expected error")
+	}
+}
@@ -0,0 +1,78 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"highload-microservice/internal/config"
+	"highload-microservice/internal/models"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Producer publishes events to the JetStream stream and waits for the
+// stream to acknowledge them
+type Producer struct {
+	cfg config.NATSConfig
+	nc  *nats.Conn
+	js  jetstream.JetStream
+
+	mu    sync.Mutex
+	ready bool // the stream exists
+}
+
+func NewProducer(cfg config.NATSConfig) (*Producer, error) {
+	if cfg.Stream == "" || cfg.SubjectPrefix == "" {
+		return nil, fmt.Errorf("NATS_STREAM and NATS_SUBJECT_PREFIX are required for the nats messaging backend")
+	}
+	nc, js, err := connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Producer{cfg: cfg, nc: nc, js: js}, nil
+}
+
+// setup creates the stream on first use, once the server is reachable
+func (p *Producer) setup(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ready {
+		return nil
+	}
+	if err := ensureStream(ctx, p.js, p.cfg); err != nil {
+		return err
+	}
+	p.ready = true
+	return nil
+}
+
+// Ping checks that the stream is reachable, creating it on the first call
+func (p *Producer) Ping(ctx context.Context) error {
+	if err := p.setup(ctx); err != nil {
+		return err
+	}
+	if _, err := p.js.Stream(ctx, p.cfg.Stream); err != nil {
+		return fmt.Errorf("failed to get stream %s: %w", p.cfg.Stream, err)
+	}
+	return nil
+}
+
+func (p *Producer) SendEvent(ctx context.Context, event models.KafkaEvent) error {
+	if err := p.setup(ctx); err != nil {
+		return err
+	}
+	msg, err := encode(p.cfg.SubjectPrefix, event)
+	if err != nil {
+		return err
+	}
+	if _, err := p.js.PublishMsg(ctx, msg, jetstream.WithExpectStream(p.cfg.Stream)); err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+	return nil
+}
+
+func (p *Producer) Close() error {
+	return p.nc.Drain()
+}
@@ -0,0 +1,155 @@
+// Package objectstore stores objects such as archives and avatars in a
+// directory (for example a mounted volume) or an S3-compatible bucket. Keys
+// are slash-separated paths such as events/2024/03/01/<id>/00001.ndjson.gz.
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrNotFound is returned by Get for keys that are not stored
+var ErrNotFound = errors.New("object not found")
+
+// Backends
+const (
+	BackendNone = "none" // nothing is archived
+	BackendFile = "file"
+	BackendS3   = "s3"
+)
+
+// Store stores objects durably
+type Store interface {
+	// Put stores data under key and returns once it is durable
+	Put(ctx context.Context, key string, data []byte) error
+	// Location describes where key is stored, for reports
+	Location(key string) string
+}
+
+// Bucket is a Store objects are also read back from and deleted from
+type Bucket interface {
+	Store
+	// Get returns the object stored under key or ErrNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Delete removes the object under key; deleting a missing key is no error
+	Delete(ctx context.Context, key string) error
+}
+
+// Config selects and configures a backend
+type Config struct {
+	Backend string
+	Dir     string // BackendFile
+	S3      S3Config
+}
+
+// New creates the store of cfg.Backend; BackendNone returns nil
+func New(ctx context.Context, cfg Config) (Store, error) {
+	if cfg.Backend == BackendNone {
+		return nil, nil
+	}
+	return NewBucket(ctx, cfg)
+}
+
+// NewBucket creates the bucket of cfg.Backend, which must not be BackendNone
+func NewBucket(ctx context.Context, cfg Config) (Bucket, error) {
+	switch cfg.Backend {
+	case BackendFile:
+		store, err := NewFileStore(cfg.Dir)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	case BackendS3:
+		store, err := NewS3Store(ctx, cfg.S3)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unsupported object store backend: %s", cfg.Backend)
+	}
+}
+
+// FileStore writes objects below a directory
+type FileStore struct {
+	dir string
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("object store directory is not set")
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid object store directory: %w", err)
+	}
+	return &FileStore{dir: abs}, nil
+}
+
+// Put writes data to a temporary file, syncs it and renames it into place,
+// so an object is either complete or absent
+func (s *FileStore) Put(ctx context.Context, key string, data []byte) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("failed to create object directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".object-*")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", key, err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to sync %s: %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", key, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to store %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *FileStore) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return data, nil
+}
+
+// Delete removes the object and the directories it leaves empty
+func (s *FileStore) Delete(ctx context.Context, key string) error {
+	path := s.path(key)
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	for dir := filepath.Dir(path); dir != s.dir; dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// path is the file of key; keys cannot point outside the directory
+func (s *FileStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.Clean(string(filepath.Separator)+filepath.FromSlash(key)))
+}
+
+func (s *FileStore) Location(key string) string {
+	return "file://" + filepath.ToSlash(s.path(key))
+}
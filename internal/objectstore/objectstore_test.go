@@ -0,0 +1,173 @@
+package objectstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestNew(t *testing.T) {
+	if store, err := New(context.Background(), Config{Backend: BackendNone}); store != nil || err != nil {
+		t.Errorf("none = %v, %v; want nil, nil", store, err)
+	}
+	if _, err := New(context.Background(), Config{Backend: BackendFile}); err == nil {
+		t.Error("file without a directory: expected an error")
+	}
+	if _, err := New(context.Background(), Config{Backend: BackendS3}); err == nil {
+		t.Error("s3 without a bucket: expected an error")
+	}
+	if _, err := New(context.Background(), Config{Backend: "tape"}); err == nil {
+		t.Error("unknown backend: expected an error")
+	}
+}
+
+func TestFileStore_Put(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+
+	key := "events/2024/03/01/run/00001.ndjson.gz"
+	if err := store.Put(context.Background(), key, []byte("archive")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(key)))
+	if err != nil || string(data) != "archive" {
+		t.Errorf("stored %q, %v; want archive", data, err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(filepath.Join(dir, filepath.FromSlash(key))))
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d files, want no temporary files left", len(entries))
+	}
+	if got := store.Location(key); got != "file://"+filepath.ToSlash(filepath.Join(dir, key)) {
+		t.Errorf("Location = %q", got)
+	}
+}
+
+func TestFileStore_GetDelete(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+
+	if err := store.Put(ctx, "../../user/v1/original.png", []byte("image")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "user", "v1", "original.png")); err != nil {
+		t.Fatalf("keys must stay inside the directory: %v", err)
+	}
+	if data, err := store.Get(ctx, "user/v1/original.png"); err != nil || string(data) != "image" {
+		t.Errorf("Get = %q, %v; want image", data, err)
+	}
+
+	if err := store.Delete(ctx, "user/v1/original.png"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get(ctx, "user/v1/original.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete = %v; want ErrNotFound", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "user")); !os.IsNotExist(err) {
+		t.Errorf("emptied directories must be removed, got %v", err)
+	}
+	if err := store.Delete(ctx, "user/v1/original.png"); err != nil {
+		t.Errorf("deleting a missing key: %v", err)
+	}
+}
+
+func TestS3Store_GetMissing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = io.WriteString(w, `<Error><Code>NoSuchKey</Code><Message>missing</Message></Error>`)
+	}))
+	defer server.Close()
+
+	client := s3.New(s3.Options{
+		Region:           "us-east-1",
+		BaseEndpoint:     aws.String(server.URL),
+		UsePathStyle:     true,
+		Credentials:      credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		RetryMaxAttempts: 1,
+	})
+	store := newS3Store(client, S3Config{Bucket: "avatars"})
+	if _, err := store.Get(context.Background(), "k"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestS3Store_Put(t *testing.T) {
+	var (
+		method, path, storageClass, checksum string
+		body                                 []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		storageClass = r.Header.Get("X-Amz-Storage-Class")
+		checksum = r.Header.Get("X-Amz-Meta-Sha256")
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := s3.New(s3.Options{
+		Region:                     "us-east-1",
+		BaseEndpoint:               aws.String(server.URL),
+		UsePathStyle:               true,
+		Credentials:                credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		RequestChecksumCalculation: aws.RequestChecksumCalculationWhenRequired,
+	})
+	store := newS3Store(client, S3Config{Bucket: "archive", Prefix: "/prod/", StorageClass: "STANDARD_IA"})
+
+	data := []byte("compressed ndjson")
+	if err := store.Put(context.Background(), "audit/user_audit/x.ndjson.gz", data); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if method != http.MethodPut || path != "/archive/prod/audit/user_audit/x.ndjson.gz" {
+		t.Errorf("request = %s %s", method, path)
+	}
+	if string(body) != string(data) {
+		t.Errorf("body = %q, want %q", body, data)
+	}
+	sum := sha256.Sum256(data)
+	if checksum != hex.EncodeToString(sum[:]) || storageClass != "STANDARD_IA" {
+		t.Errorf("sha256 = %q, storage class = %q", checksum, storageClass)
+	}
+	if got := store.Location("a/b.gz"); got != "s3://archive/prod/a/b.gz" {
+		t.Errorf("Location = %q", got)
+	}
+}
+
+func TestS3Store_PutError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = io.WriteString(w, `<Error><Code>AccessDenied</Code><Message>denied</Message></Error>`)
+	}))
+	defer server.Close()
+
+	client := s3.New(s3.Options{
+		Region:           "us-east-1",
+		BaseEndpoint:     aws.String(server.URL),
+		UsePathStyle:     true,
+		Credentials:      credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		RetryMaxAttempts: 1,
+	})
+	store := newS3Store(client, S3Config{Bucket: "archive"})
+	err := store.Put(context.Background(), "k", []byte("x"))
+	if err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("err = %v, want AccessDenied", err)
+	}
+}
@@ -0,0 +1,134 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3Config is an S3 or S3-compatible (MinIO, Ceph, ...) bucket. Credentials
+// come from the default AWS chain (environment, shared config, IAM role).
+type S3Config struct {
+	Bucket       string
+	Prefix       string // prepended to every key
+	Region       string
+	Endpoint     string // optional override for S3-compatible storage
+	PathStyle    bool   // bucket in the path instead of the host name
+	StorageClass string // e.g. STANDARD_IA or GLACIER_IR; empty for the bucket default
+}
+
+// S3Store uploads objects to a bucket
+type S3Store struct {
+	client       *s3.Client
+	bucket       string
+	prefix       string
+	storageClass types.StorageClass
+}
+
+func NewS3Store(ctx context.Context, cfg S3Config) (*S3Store, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("a bucket is required for the s3 backend")
+	}
+
+	loadCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	awsCfg, err := awsconfig.LoadDefaultConfig(loadCtx, awsconfig.WithRegion(cfg.Region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return newS3Store(s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+		o.UsePathStyle = cfg.PathStyle
+		// Not every S3-compatible store accepts the trailing checksums the
+		// SDK sends by default; the object's SHA-256 is sent as metadata
+		o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+		o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+	}), cfg), nil
+}
+
+func newS3Store(client *s3.Client, cfg S3Config) *S3Store {
+	prefix := strings.Trim(cfg.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &S3Store{client: client, bucket: cfg.Bucket, prefix: prefix, storageClass: types.StorageClass(cfg.StorageClass)}
+}
+
+// Put uploads data in a single request; S3 makes the object visible only
+// once it is stored completely
+func (s *S3Store) Put(ctx context.Context, key string, data []byte) error {
+	sum := sha256.Sum256(data)
+	input := &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(s.prefix + key),
+		Body:          bytes.NewReader(data),
+		ContentLength: aws.Int64(int64(len(data))),
+		ContentType:   aws.String(contentType(key)),
+		Metadata:      map[string]string{"sha256": hex.EncodeToString(sum[:])},
+		StorageClass:  s.storageClass,
+	}
+	if _, err := s.client.PutObject(ctx, input); err != nil {
+		return fmt.Errorf("failed to upload %s to bucket %s: %w", key, s.bucket, err)
+	}
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) ([]byte, error) {
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(s.prefix + key)})
+	if err != nil {
+		var noKey *types.NoSuchKey
+		if errors.As(err, &noKey) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to download %s from bucket %s: %w", key, s.bucket, err)
+	}
+	defer func() { _ = output.Body.Close() }()
+	data, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s from bucket %s: %w", key, s.bucket, err)
+	}
+	return data, nil
+}
+
+// Delete removes the object; S3 reports success for missing keys too
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if _, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(s.prefix + key)}); err != nil {
+		return fmt.Errorf("failed to delete %s from bucket %s: %w", key, s.bucket, err)
+	}
+	return nil
+}
+
+func (s *S3Store) Location(key string) string {
+	return "s3://" + path.Join(s.bucket, s.prefix+key)
+}
+
+func contentType(key string) string {
+	switch {
+	case strings.HasSuffix(key, ".gz"):
+		return "application/gzip"
+	case strings.HasSuffix(key, ".ndjson"):
+		return "application/x-ndjson"
+	case strings.HasSuffix(key, ".png"):
+		return "image/png"
+	case strings.HasSuffix(key, ".jpg"):
+		return "image/jpeg"
+	case strings.HasSuffix(key, ".gif"):
+		return "image/gif"
+	default:
+		return "application/octet-stream"
+	}
+}
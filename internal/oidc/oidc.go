@@ -0,0 +1,351 @@
+// Package oidc implements the OpenID Connect authorization code flow with
+// PKCE against a single identity provider (Google, Keycloak, ...). The
+// provider's endpoints are discovered from its issuer URL on first use, and
+// ID tokens are verified against its published keys.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/jwtkeys"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// stateTTL bounds how long a user may take at the identity provider
+	stateTTL = 10 * time.Minute
+	// keyRefreshInterval limits JWKS refetches for tokens with unknown kids
+	keyRefreshInterval = time.Minute
+	// maxResponseSize bounds responses read from the identity provider
+	maxResponseSize = 1 << 20
+)
+
+// Config configures the identity provider
+type Config struct {
+	Issuer         string
+	ClientID       string
+	ClientSecret   string
+	RedirectURL    string   // this service's callback URL, registered at the provider
+	Scopes         []string // "openid" is always requested
+	AllowedDomains []string // email domains allowed to log in; empty allows all
+}
+
+// StateStore keeps pending logins between the redirect and the callback.
+// Implemented by the Redis and in-memory caches.
+type StateStore interface {
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+	Get(ctx context.Context, key string) (string, error)
+	Del(ctx context.Context, keys ...string) error
+}
+
+// Identity is a user as asserted by the identity provider
+type Identity struct {
+	Issuer    string
+	Subject   string
+	Email     string
+	FirstName string
+	LastName  string
+}
+
+// pending is a login started by Begin
+type pending struct {
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider runs logins against one identity provider
+type Provider struct {
+	cfg    Config
+	states StateStore
+	client *http.Client
+
+	mu          sync.Mutex
+	meta        *metadata
+	keys        map[string]interface{}
+	keysFetched time.Time
+}
+
+// NewProvider creates a provider; client may be nil for a default client
+func NewProvider(cfg Config, states StateStore, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	cfg.Issuer = strings.TrimRight(cfg.Issuer, "/")
+	return &Provider{cfg: cfg, states: states, client: client}
+}
+
+// Begin starts a login and returns the provider URL to redirect the user to
+func (p *Provider) Begin(ctx context.Context) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	state, nonce, verifier := randomString(), randomString(), randomString()
+	value, _ := json.Marshal(pending{Nonce: nonce, Verifier: verifier})
+	if err := p.states.Set(ctx, stateKey(state), string(value), stateTTL); err != nil {
+		return "", apperrors.Wrap(apperrors.ErrUnavailable, "failed to store login state", err)
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {p.scope()},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return meta.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Complete finishes a login started by Begin: the code is exchanged for an ID
+// token, which is verified and turned into an Identity. Each state can be
+// used once.
+func (p *Provider) Complete(ctx context.Context, state, code string) (*Identity, error) {
+	if state == "" || code == "" {
+		return nil, apperrors.Unauthorized("missing state or code")
+	}
+	value, err := p.states.Get(ctx, stateKey(state))
+	if err != nil {
+		return nil, apperrors.Unauthorized("unknown or expired login state")
+	}
+	_ = p.states.Del(ctx, stateKey(state))
+
+	var login pending
+	if err := json.Unmarshal([]byte(value), &login); err != nil {
+		return nil, apperrors.Unauthorized("unknown or expired login state")
+	}
+
+	rawIDToken, err := p.exchange(ctx, code, login.Verifier)
+	if err != nil {
+		return nil, err
+	}
+	return p.verify(ctx, rawIDToken, login.Nonce)
+}
+
+func (p *Provider) scope() string {
+	scopes := []string{"openid"}
+	for _, scope := range p.cfg.Scopes {
+		if scope != "" && scope != "openid" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return strings.Join(scopes, " ")
+}
+
+// discover fetches the provider metadata once
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	var meta metadata
+	if err := p.getJSON(ctx, p.cfg.Issuer+"/.well-known/openid-configuration", &meta); err != nil {
+		return nil, err
+	}
+	if strings.TrimRight(meta.Issuer, "/") != p.cfg.Issuer {
+		return nil, apperrors.New(apperrors.ErrUnavailable, "identity provider reports issuer "+meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, apperrors.New(apperrors.ErrUnavailable, "incomplete identity provider metadata")
+	}
+	p.meta = &meta
+	return p.meta, nil
+}
+
+// exchange redeems an authorization code and returns the raw ID token
+func (p *Provider) exchange(ctx context.Context, code, verifier string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", apperrors.Wrap(apperrors.ErrUnavailable, "identity provider unreachable", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return "", apperrors.Wrap(apperrors.ErrUnavailable, "failed to read token response", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		// Typically invalid_grant: the code was used or has expired
+		return "", apperrors.Unauthorized(fmt.Sprintf("code exchange failed with status %d", resp.StatusCode))
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil || tokens.IDToken == "" {
+		return "", apperrors.Unauthorized("token response has no ID token")
+	}
+	return tokens.IDToken, nil
+}
+
+// verify checks the ID token's signature, issuer, audience, expiry and nonce
+func (p *Provider) verify(ctx context.Context, rawIDToken, nonce string) (*Identity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims,
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return p.key(ctx, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256"}),
+		jwt.WithIssuer(p.cfg.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30*time.Second),
+	)
+	if err != nil {
+		return nil, apperrors.Wrap(apperrors.ErrUnauthorized, "invalid ID token", err)
+	}
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, apperrors.Unauthorized("ID token nonce mismatch")
+	}
+
+	identity := &Identity{Issuer: p.cfg.Issuer}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.FirstName, _ = claims["given_name"].(string)
+	identity.LastName, _ = claims["family_name"].(string)
+	identity.Email = strings.ToLower(strings.TrimSpace(identity.Email))
+
+	if identity.Subject == "" || identity.Email == "" {
+		return nil, apperrors.Unauthorized("ID token has no subject or email")
+	}
+	// Unverified addresses could be used to take over an existing account
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		return nil, apperrors.Unauthorized("email address is not verified")
+	}
+	if !p.domainAllowed(identity.Email) {
+		return nil, apperrors.Unauthorized("email domain is not allowed")
+	}
+	return identity, nil
+}
+
+func (p *Provider) domainAllowed(email string) bool {
+	if len(p.cfg.AllowedDomains) == 0 {
+		return true
+	}
+	_, domain, _ := strings.Cut(email, "@")
+	for _, allowed := range p.cfg.AllowedDomains {
+		if strings.EqualFold(domain, strings.TrimSpace(allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// key returns the provider key with kid, refetching the key set when the
+// provider has rotated its keys
+func (p *Provider) key(ctx context.Context, kid string) (interface{}, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < keyRefreshInterval {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	var set jwtkeys.JWKS
+	if err := p.getJSON(ctx, meta.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.PublicKey(); err == nil {
+			keys[jwk.ID] = key
+		}
+	}
+	p.keys, p.keysFetched = keys, time.Now()
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+func (p *Provider) getJSON(ctx context.Context, endpoint string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return apperrors.Wrap(apperrors.ErrUnavailable, "identity provider unreachable", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return apperrors.New(apperrors.ErrUnavailable, fmt.Sprintf("identity provider returned status %d for %s", resp.StatusCode, endpoint))
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v); err != nil {
+		return apperrors.Wrap(apperrors.ErrUnavailable, "invalid identity provider response", err)
+	}
+	return nil
+}
+
+func stateKey(state string) string {
+	return "oidc_state:" + state
+}
+
+// randomString returns 256 random bits, long enough for a PKCE verifier
+func randomString() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b) // never fails since Go 1.24
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,148 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/cache"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeProvider is an identity provider that issues an ID token with claims
+// for any code, echoing the nonce of the pending login
+type fakeProvider struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	claims jwt.MapClaims
+	nonce  string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	f := &fakeProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 f.URL,
+			"authorization_endpoint": f.URL + "/authorize",
+			"token_endpoint":         f.URL + "/token",
+			"jwks_uri":               f.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "idp-1", "use": "sig", "alg": "RS256",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "good-code" || r.FormValue("code_verifier") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		claims := jwt.MapClaims{
+			"iss": f.URL, "aud": "client", "sub": "subject-1", "nonce": f.nonce,
+			"exp": time.Now().Add(time.Minute).Unix(), "iat": time.Now().Unix(),
+		}
+		for k, v := range f.claims {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "idp-1"
+		signed, _ := token.SignedString(key)
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// begin starts a login and returns its state, remembering the nonce
+func (f *fakeProvider) begin(t *testing.T, p *Provider) string {
+	t.Helper()
+	redirect, err := p.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	u, _ := url.Parse(redirect)
+	query := u.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("client_id") != "client" || query.Get("scope") != "openid email" {
+		t.Fatalf("unexpected authorization URL: %s", redirect)
+	}
+	f.nonce = query.Get("nonce")
+	return query.Get("state")
+}
+
+func TestProvider_LoginFlow(t *testing.T) {
+	idp := newFakeProvider(t)
+	idp.claims = jwt.MapClaims{"email": "Jane@Example.com", "email_verified": true, "given_name": "Jane", "family_name": "Doe"}
+	p := NewProvider(Config{Issuer: idp.URL, ClientID: "client", RedirectURL: "http://svc/callback", Scopes: []string{"email"}},
+		cache.NewMemoryCache(), idp.Client())
+
+	state := idp.begin(t, p)
+	identity, err := p.Complete(context.Background(), state, "good-code")
+	if err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if identity.Subject != "subject-1" || identity.Email != "jane@example.com" || identity.FirstName != "Jane" || identity.Issuer != idp.URL {
+		t.Fatalf("unexpected identity: %+v", identity)
+	}
+
+	// A state can only be used once
+	if _, err := p.Complete(context.Background(), state, "good-code"); !errors.Is(err, apperrors.ErrUnauthorized) {
+		t.Fatalf("want unauthorized for a reused state, got %v", err)
+	}
+}
+
+func TestProvider_RejectsInvalidLogins(t *testing.T) {
+	idp := newFakeProvider(t)
+	p := NewProvider(Config{Issuer: idp.URL, ClientID: "client", RedirectURL: "http://svc/callback", Scopes: []string{"email"},
+		AllowedDomains: []string{"example.com"}}, cache.NewMemoryCache(), idp.Client())
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		code   string
+		nonce  string
+	}{
+		{"domain not allowed", jwt.MapClaims{"email": "eve@evil.com"}, "good-code", ""},
+		{"unverified email", jwt.MapClaims{"email": "jane@example.com", "email_verified": false}, "good-code", ""},
+		{"wrong audience", jwt.MapClaims{"email": "jane@example.com", "aud": "other"}, "good-code", ""},
+		{"nonce mismatch", jwt.MapClaims{"email": "jane@example.com"}, "good-code", "forged"},
+		{"rejected code", jwt.MapClaims{"email": "jane@example.com"}, "bad-code", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp.claims = tt.claims
+			state := idp.begin(t, p)
+			if tt.nonce != "" {
+				idp.nonce = tt.nonce
+			}
+			if _, err := p.Complete(context.Background(), state, tt.code); !errors.Is(err, apperrors.ErrUnauthorized) {
+				t.Fatalf("want unauthorized, got %v", err)
+			}
+		})
+	}
+
+	if _, err := p.Complete(context.Background(), "unknown", "good-code"); !errors.Is(err, apperrors.ErrUnauthorized) {
+		t.Fatalf("want unauthorized for an unknown state, got %v", err)
+	}
+}
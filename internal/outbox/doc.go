@@ -0,0 +1,45 @@
+// Package outbox implements the transactional outbox pattern for domain
+// events.
+//
+// Instead of writing to the broker directly, services append events to the
+// outbox table. Two publishing modes are supported (OUTBOX_PUBLISHER):
+//
+//   - relay: an in-process Relay polls unpublished rows and forwards them to
+//     the configured messaging backend, marking them published_at. Published
+//     rows are deleted by the outbox_purge job after OUTBOX_RETENTION_HOURS.
+//   - cdc: rows are captured from the database log by Debezium and routed to
+//     Kafka by its outbox event router. Rows are inserted and deleted in the
+//     same transaction, so the table stays empty while the log still carries
+//     every event.
+//
+// The table columns follow Debezium's outbox event router naming with
+// snake_case column names. A matching Kafka Connect configuration for
+// PostgreSQL looks like:
+//
+//	{
+//	  "connector.class": "io.debezium.connector.postgresql.PostgresConnector",
+//	  "plugin.name": "pgoutput",
+//	  "database.hostname": "postgres",
+//	  "database.port": "5432",
+//	  "database.user": "postgres",
+//	  "database.password": "postgres",
+//	  "database.dbname": "highload_db",
+//	  "topic.prefix": "highload",
+//	  "table.include.list": "public.outbox",
+//	  "tombstones.on.delete": "false",
+//	  "transforms": "outbox",
+//	  "transforms.outbox.type": "io.debezium.transforms.outbox.EventRouter",
+//	  "transforms.outbox.table.field.event.id": "id",
+//	  "transforms.outbox.table.field.event.key": "aggregate_id",
+//	  "transforms.outbox.table.field.event.type": "type",
+//	  "transforms.outbox.table.field.event.payload": "payload",
+//	  "transforms.outbox.table.field.event.timestamp": "created_at",
+//	  "transforms.outbox.route.by.field": "aggregate_type",
+//	  "transforms.outbox.route.topic.replacement": "user-events",
+//	  "transforms.outbox.table.expand.json.payload": "true",
+//	  "transforms.outbox.table.fields.additional.placement": "type:header:eventType,headers:header:headers"
+//	}
+//
+// route.topic.replacement should match KAFKA_TOPIC so consumers of this
+// service see the same messages regardless of the publishing mode.
+package outbox
@@ -0,0 +1,247 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/config"
+	"highload-microservice/internal/database"
+	"highload-microservice/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type recordingSender struct {
+	sent []models.KafkaEvent
+	err  error
+}
+
+func (r *recordingSender) SendEvent(ctx context.Context, event models.KafkaEvent) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.sent = append(r.sent, event)
+	return nil
+}
+
+func TestProducer_Relay_WritesRow(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	p, err := NewProducer(db, PublisherRelay)
+	if err != nil {
+		t.Fatalf("new producer: %v", err)
+	}
+
+	event := models.KafkaEvent{ID: uuid.New(), UserID: uuid.New(), Type: "user_created", Data: "{}", Timestamp: time.Now()}
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO outbox")).
+		WithArgs(event.ID, "user", event.UserID.String(), "user_created", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if err := p.SendEvent(context.Background(), event); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestProducer_CDC_InsertsAndDeletesInTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	p, _ := NewProducer(db, PublisherCDC)
+	event := models.KafkaEvent{ID: uuid.New(), UserID: uuid.New(), Type: "login", Timestamp: time.Now()}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO outbox")).
+		WithArgs(event.ID, "event", event.UserID.String(), "login", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM outbox WHERE id = $1")).
+		WithArgs(event.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := p.SendEvent(context.Background(), event); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestNewProducer_UnknownPublisher(t *testing.T) {
+	if _, err := NewProducer(nil, "carrier-pigeon"); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestRelay_PublishBatch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	first := models.KafkaEvent{ID: uuid.New(), UserID: uuid.New(), Type: "user_created"}
+	second := models.KafkaEvent{ID: uuid.New(), UserID: uuid.New(), Type: "user_updated"}
+	p1, _ := json.Marshal(first)
+	p2, _ := json.Marshal(second)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, payload FROM outbox")).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "payload"}).
+			AddRow(first.ID.String(), string(p1)).
+			AddRow(second.ID.String(), string(p2)))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE outbox SET published_at = $1 WHERE id = $2")).
+		WithArgs(sqlmock.AnyArg(), first.ID.String()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE outbox SET published_at = $1 WHERE id = $2")).
+		WithArgs(sqlmock.AnyArg(), second.ID.String()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	sender := &recordingSender{}
+	relay := NewRelay(db, sender, time.Second, 10, time.Hour, logrus.New())
+
+	n, err := relay.PublishBatch(context.Background())
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if n != 2 || len(sender.sent) != 2 || sender.sent[0].ID != first.ID {
+		t.Fatalf("unexpected publish result: n=%d sent=%d", n, len(sender.sent))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestRelay_PublishBatch_StopsOnSendError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	event := models.KafkaEvent{ID: uuid.New(), UserID: uuid.New(), Type: "user_created"}
+	payload, _ := json.Marshal(event)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, payload FROM outbox")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "payload"}).AddRow(event.ID.String(), string(payload)))
+	mock.ExpectCommit()
+
+	relay := NewRelay(db, &recordingSender{err: fmt.Errorf("broker down")}, time.Second, 10, time.Hour, logrus.New())
+	n, err := relay.PublishBatch(context.Background())
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if n != 0 {
+		t.Fatalf("expected nothing published, got %d", n)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestRelay_DeletePublished(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.NewConnection(config.DatabaseConfig{Driver: database.DriverSQLite, Name: filepath.Join(t.TempDir(), "outbox.db"), MaxOpenConns: 1}, nil)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	dialect, _ := database.NewDialect(database.DriverSQLite)
+	migrator, err := database.NewMigrator(db, dialect)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	now := time.Now()
+	rows := map[string]interface{}{
+		"old":         now.Add(-2 * time.Hour),
+		"recent":      now.Add(-time.Minute),
+		"unpublished": nil,
+	}
+	for id, publishedAt := range rows {
+		if _, err := db.Exec(`INSERT INTO outbox (id, aggregate_type, aggregate_id, type, payload, headers, created_at, published_at)
+			VALUES ($1, 'user', 'u1', 'user_created', '{}', '{}', $2, $3)`, id, now.Add(-3*time.Hour), publishedAt); err != nil {
+			t.Fatalf("insert %s: %v", id, err)
+		}
+	}
+
+	relay := NewRelay(db, &recordingSender{}, time.Second, 10, time.Hour, logrus.New())
+	if err := relay.DeletePublished(ctx); err != nil {
+		t.Fatalf("delete published: %v", err)
+	}
+
+	var left []string
+	result, err := db.Query(`SELECT id FROM outbox ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer result.Close()
+	for result.Next() {
+		var id string
+		_ = result.Scan(&id)
+		left = append(left, id)
+	}
+	if len(left) != 2 || left[0] != "recent" || left[1] != "unpublished" {
+		t.Fatalf("rows left after purge: %v, want recent and unpublished", left)
+	}
+}
+
+func TestProducer_CDC_SendEventsTx(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	p, _ := NewProducer(db, PublisherCDC)
+	events := []models.KafkaEvent{
+		{ID: uuid.New(), UserID: uuid.New(), Type: "login", Timestamp: time.Now()},
+		{ID: uuid.New(), UserID: uuid.New(), Type: "user_created", Timestamp: time.Now()},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO outbox (id, aggregate_type, aggregate_id, type, payload, headers, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7), ($8, $9, $10, $11, $12, $13, $14)")).
+		WithArgs(events[0].ID, "event", events[0].UserID.String(), "login", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			events[1].ID, "user", events[1].UserID.String(), "user_created", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM outbox WHERE id IN ($1, $2)")).
+		WithArgs(events[0].ID, events[1].ID).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if err := p.SendEventsTx(context.Background(), tx, events); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
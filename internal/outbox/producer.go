@@ -0,0 +1,189 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Supported values for OUTBOX_PUBLISHER
+const (
+	PublisherRelay = "relay"
+	PublisherCDC   = "cdc"
+)
+
+// Execer is satisfied by both *sql.DB and *sql.Tx, so events can be written in
+// the same transaction as the aggregate they describe.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Producer writes events to the outbox table. It satisfies the producer
+// interface used by the services, so it can replace the broker producer
+// without changing them.
+type Producer struct {
+	db        *sql.DB
+	publisher string
+}
+
+func NewProducer(db *sql.DB, publisher string) (*Producer, error) {
+	if publisher != PublisherRelay && publisher != PublisherCDC {
+		return nil, fmt.Errorf("unsupported outbox publisher: %s", publisher)
+	}
+
+	return &Producer{db: db, publisher: publisher}, nil
+}
+
+func (p *Producer) SendEvent(ctx context.Context, event models.KafkaEvent) error {
+	if p.publisher == PublisherRelay {
+		return Write(ctx, p.db, event)
+	}
+
+	// CDC mode: insert and delete in one transaction. Debezium picks the
+	// insert up from the log and the router ignores the delete.
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin outbox transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := Write(ctx, tx, event); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM outbox WHERE id = $1`, event.ID); err != nil {
+		return fmt.Errorf("failed to delete outbox event: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit outbox event: %w", err)
+	}
+	return nil
+}
+
+// SendEventsTx writes events to the outbox in the caller's transaction, so
+// they are published if and only if tx commits
+func (p *Producer) SendEventsTx(ctx context.Context, tx *sql.Tx, events []models.KafkaEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	for i := range events {
+		if events[i].ID == uuid.Nil {
+			events[i].ID = uuid.New()
+		}
+	}
+	if err := WriteBatch(ctx, tx, events); err != nil {
+		return err
+	}
+	if p.publisher == PublisherRelay {
+		return nil
+	}
+
+	placeholders := make([]string, len(events))
+	ids := make([]interface{}, len(events))
+	for i, event := range events {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		ids[i] = event.ID
+	}
+	query := `DELETE FROM outbox WHERE id IN (` + strings.Join(placeholders, ", ") + `)`
+	if _, err := tx.ExecContext(ctx, query, ids...); err != nil {
+		return fmt.Errorf("failed to delete outbox events: %w", err)
+	}
+	return nil
+}
+
+func (p *Producer) Close() error {
+	return nil
+}
+
+// Write appends an event to the outbox using the given connection or transaction
+func Write(ctx context.Context, exec Execer, event models.KafkaEvent) error {
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+
+	row, err := rowValues(event)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO outbox (id, aggregate_type, aggregate_id, type, payload, headers, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	if _, err := exec.ExecContext(ctx, query, row...); err != nil {
+		return fmt.Errorf("failed to write outbox event: %w", err)
+	}
+
+	return nil
+}
+
+// writeBatchRows bounds the rows of one INSERT; Postgres allows at most
+// 65535 parameters per statement
+const writeBatchRows = 1000
+
+// WriteBatch appends events to the outbox with multi-row inserts; events
+// must have IDs
+func WriteBatch(ctx context.Context, exec Execer, events []models.KafkaEvent) error {
+	for start := 0; start < len(events); start += writeBatchRows {
+		chunk := events[start:min(start+writeBatchRows, len(events))]
+
+		values := make([]string, len(chunk))
+		args := make([]interface{}, 0, len(chunk)*7)
+		for i, event := range chunk {
+			row, err := rowValues(event)
+			if err != nil {
+				return err
+			}
+			n := len(args)
+			values[i] = fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7)
+			args = append(args, row...)
+		}
+
+		query := `INSERT INTO outbox (id, aggregate_type, aggregate_id, type, payload, headers, created_at) VALUES ` +
+			strings.Join(values, ", ")
+		if _, err := exec.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to write outbox events: %w", err)
+		}
+	}
+	return nil
+}
+
+// rowValues returns the outbox columns of event in insert order
+func rowValues(event models.KafkaEvent) ([]interface{}, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	headerValues := map[string]string{
+		"event_id": event.ID.String(),
+	}
+	if event.RequestID != "" {
+		headerValues["request_id"] = event.RequestID
+	}
+	headers, err := json.Marshal(headerValues)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal headers: %w", err)
+	}
+
+	return []interface{}{
+		event.ID, aggregateType(event.Type), event.UserID.String(), event.Type,
+		string(payload), string(headers), event.Timestamp,
+	}, nil
+}
+
+// aggregateType derives the aggregate from the event type prefix
+// ("user_created" -> "user"). Events without a prefix belong to "event".
+func aggregateType(eventType string) string {
+	if i := strings.Index(eventType, "_"); i > 0 {
+		return eventType[:i]
+	}
+	return "event"
+}
@@ -0,0 +1,161 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"highload-microservice/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// EventSender publishes events to the message broker
+type EventSender interface {
+	SendEvent(ctx context.Context, event models.KafkaEvent) error
+}
+
+// Relay forwards unpublished outbox rows to the message broker
+type Relay struct {
+	db           *sql.DB
+	sender       EventSender
+	logger       *logrus.Logger
+	pollInterval time.Duration
+	batchSize    int
+	retention    time.Duration
+	done         chan struct{}
+	stopped      chan struct{}
+}
+
+// NewRelay creates a relay; published rows are kept for retention, then
+// removed by DeletePublished
+func NewRelay(db *sql.DB, sender EventSender, pollInterval time.Duration, batchSize int, retention time.Duration, logger *logrus.Logger) *Relay {
+	if pollInterval <= 0 {
+		pollInterval = time.Second
+	}
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	return &Relay{
+		db:           db,
+		sender:       sender,
+		logger:       logger,
+		pollInterval: pollInterval,
+		batchSize:    batchSize,
+		retention:    retention,
+		done:         make(chan struct{}),
+		stopped:      make(chan struct{}),
+	}
+}
+
+// Start runs the relay loop in a goroutine until Stop is called
+func (r *Relay) Start() {
+	go func() {
+		defer close(r.stopped)
+
+		ticker := time.NewTicker(r.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.done:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				if n, err := r.PublishBatch(ctx); err != nil {
+					r.logger.Errorf("Outbox relay failed: %v", err)
+				} else if n > 0 {
+					r.logger.Debugf("Outbox relay published %d events", n)
+				}
+				cancel()
+			}
+		}
+	}()
+}
+
+// Stop stops the relay and waits for the current batch to finish
+func (r *Relay) Stop() {
+	close(r.done)
+	<-r.stopped
+}
+
+// PublishBatch publishes up to batchSize pending events and returns how many
+// were published. Rows are locked with SKIP LOCKED so several instances can
+// run relays concurrently.
+func (r *Relay) PublishBatch(ctx context.Context) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin relay transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := `
+		SELECT id, payload FROM outbox
+		WHERE published_at IS NULL
+		ORDER BY created_at
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`
+
+	rows, err := tx.QueryContext(ctx, query, r.batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query outbox: %w", err)
+	}
+
+	type pending struct {
+		id      string
+		payload string
+	}
+	var batch []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.payload); err != nil {
+			_ = rows.Close()
+			return 0, fmt.Errorf("failed to scan outbox row: %w", err)
+		}
+		batch = append(batch, p)
+	}
+	_ = rows.Close()
+
+	published := 0
+	for _, p := range batch {
+		var event models.KafkaEvent
+		if err := json.Unmarshal([]byte(p.payload), &event); err != nil {
+			// Mark malformed rows as handled so they don't block the queue
+			r.logger.Errorf("Dropping malformed outbox event %s: %v", p.id, err)
+		} else if err := r.sender.SendEvent(ctx, event); err != nil {
+			// Stop here to preserve ordering; the remaining rows are retried
+			// on the next poll.
+			r.logger.Errorf("Failed to publish outbox event %s: %v", p.id, err)
+			break
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE outbox SET published_at = $1 WHERE id = $2`, time.Now(), p.id); err != nil {
+			return 0, fmt.Errorf("failed to mark outbox event published: %w", err)
+		}
+		published++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit relay transaction: %w", err)
+	}
+
+	return published, nil
+}
+
+// DeletePublished removes rows published longer than the retention ago, run
+// by the outbox_purge job. Unpublished rows are never removed.
+func (r *Relay) DeletePublished(ctx context.Context) error {
+	cutoff := time.Now().Add(-r.retention)
+	result, err := r.db.ExecContext(ctx, `DELETE FROM outbox WHERE published_at IS NOT NULL AND published_at < $1`, cutoff)
+	if err != nil {
+		return fmt.Errorf("failed to delete published outbox events: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n > 0 {
+		r.logger.Debugf("Outbox purge deleted %d published events", n)
+	}
+	return nil
+}
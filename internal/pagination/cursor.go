@@ -0,0 +1,58 @@
+// Package pagination implements opaque keyset cursors for list endpoints.
+// A cursor marks the last row of a page by (created_at, id); the next page
+// continues strictly after it, which stays fast at any depth unlike OFFSET.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidCursor is returned for cursors that were not produced by Encode
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is the position of a row in a listing ordered by created_at, id
+type Cursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+type cursorPayload struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
+}
+
+// Encode returns the cursor as an opaque URL-safe string
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(cursorPayload{CreatedAt: c.CreatedAt.UTC(), ID: c.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode parses a cursor produced by Encode
+func Decode(s string) (Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	var payload cursorPayload
+	if err := json.Unmarshal(data, &payload); err != nil || payload.ID == uuid.Nil || payload.CreatedAt.IsZero() {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return Cursor{CreatedAt: payload.CreatedAt, ID: payload.ID}, nil
+}
+
+// After returns the keyset condition selecting rows after c when ordered by
+// created_at and id in the given direction (desc when true). p is called for
+// each placeholder so that callers can number them; every placeholder is
+// used once, which keeps the MySQL ? rebinding positional.
+func (c Cursor) After(desc bool, p func(value interface{}) string) string {
+	op := ">"
+	if desc {
+		op = "<"
+	}
+	return "(created_at " + op + " " + p(c.CreatedAt) + " OR (created_at = " + p(c.CreatedAt) + " AND id " + op + " " + p(c.ID) + "))"
+}
@@ -0,0 +1,47 @@
+package pagination
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCursor_RoundTrip(t *testing.T) {
+	c := Cursor{CreatedAt: time.Date(2024, 5, 1, 12, 30, 0, 123456000, time.UTC), ID: uuid.New()}
+
+	got, err := Decode(c.Encode())
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !got.CreatedAt.Equal(c.CreatedAt) || got.ID != c.ID {
+		t.Fatalf("round trip mismatch: %+v != %+v", got, c)
+	}
+
+	for _, bad := range []string{"", "not base64!", "e30", "eyJ0IjoiMjAyNCJ9"} {
+		if _, err := Decode(bad); err != ErrInvalidCursor {
+			t.Fatalf("%q: expected ErrInvalidCursor, got %v", bad, err)
+		}
+	}
+}
+
+func TestCursor_After(t *testing.T) {
+	c := Cursor{CreatedAt: time.Now(), ID: uuid.New()}
+	var args []interface{}
+	p := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args)+2)
+	}
+
+	if got, want := c.After(true, p), "(created_at < $3 OR (created_at = $4 AND id < $5))"; got != want {
+		t.Fatalf("desc: got %s, want %s", got, want)
+	}
+	if len(args) != 3 || args[2] != c.ID {
+		t.Fatalf("unexpected args: %v", args)
+	}
+	args = nil
+	if got := c.After(false, p); got != "(created_at > $3 OR (created_at = $4 AND id > $5))" {
+		t.Fatalf("asc: got %s", got)
+	}
+}
@@ -0,0 +1,320 @@
+// Package password checks new passwords against the password policy: length,
+// character classes, a list of banned passwords and similarity to the
+// account's own details. The policy can be changed at runtime by
+// administrators; the banned list is loaded once at startup.
+package password
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/config"
+)
+
+// bcryptMaxLength is the most bytes bcrypt hashes; longer passwords are refused
+const bcryptMaxLength = 72
+
+//go:embed common.txt
+var common string
+
+// Common returns the built-in list of frequently used passwords
+func Common() []string {
+	return parseList(common)
+}
+
+// Policy is what a new password must satisfy
+type Policy struct {
+	MinLength      int  `json:"min_length"`
+	MaxLength      int  `json:"max_length"` // at most 72, the bcrypt limit
+	RequireUpper   bool `json:"require_upper"`
+	RequireLower   bool `json:"require_lower"`
+	RequireDigit   bool `json:"require_digit"`
+	RequireSpecial bool `json:"require_special"`
+	MinClasses     int  `json:"min_classes"` // of upper, lower, digit and special
+	CheckBanned    bool `json:"check_banned"`
+	CheckUserInfo  bool `json:"check_user_info"`
+	MaxAgeDays     int  `json:"max_age_days"` // 0 means passwords don't expire
+}
+
+// DefaultPolicy is the policy of the former strong_password rule: 8 to 72
+// characters with at least 3 character classes
+func DefaultPolicy() Policy {
+	return Policy{MinLength: 8, MaxLength: bcryptMaxLength, MinClasses: 3, CheckBanned: true, CheckUserInfo: true}
+}
+
+// Validate checks that the policy can be satisfied
+func (p Policy) Validate() error {
+	switch {
+	case p.MinLength < 1:
+		return errors.New("min_length must be at least 1")
+	case p.MaxLength < p.MinLength || p.MaxLength > bcryptMaxLength:
+		return fmt.Errorf("max_length must be between min_length and %d", bcryptMaxLength)
+	case p.MinClasses < 0 || p.MinClasses > 4:
+		return errors.New("min_classes must be between 0 and 4")
+	case p.MaxAgeDays < 0:
+		return errors.New("max_age_days must not be negative")
+	}
+	return nil
+}
+
+// UserInfo is what a password should not be derived from
+type UserInfo struct {
+	Email     string
+	FirstName string
+	LastName  string
+}
+
+// Violation is one rule a password breaks
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PolicyError is returned for a password that breaks the policy. It is a
+// validation error: the message lists every violation.
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return "password " + strings.Join(messages, "; ")
+}
+
+func (e *PolicyError) Unwrap() error {
+	return apperrors.Validation(e.Error())
+}
+
+// Checker applies the current policy
+type Checker struct {
+	mu     sync.RWMutex
+	policy Policy
+	banned map[string]struct{}
+}
+
+// NewChecker returns a checker of policy refusing the banned passwords,
+// compared case-insensitively
+func NewChecker(policy Policy, banned []string) (*Checker, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	c := &Checker{policy: policy, banned: make(map[string]struct{}, len(banned))}
+	for _, password := range banned {
+		c.banned[strings.ToLower(password)] = struct{}{}
+	}
+	return c, nil
+}
+
+func (c *Checker) Policy() Policy {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.policy
+}
+
+// SetPolicy replaces the policy; passwords already set are not rechecked
+func (c *Checker) SetPolicy(policy Policy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.policy = policy
+	return nil
+}
+
+// BannedCount is the size of the banned list
+func (c *Checker) BannedCount() int {
+	return len(c.banned)
+}
+
+// Check returns a PolicyError listing every rule password breaks, or nil
+func (c *Checker) Check(password string, info UserInfo) error {
+	if violations := c.Violations(password, info); len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// Violations lists the rules password breaks
+func (c *Checker) Violations(password string, info UserInfo) []Violation {
+	p := c.Policy()
+	var violations []Violation
+	add := func(code, format string, args ...interface{}) {
+		violations = append(violations, Violation{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(password) < p.MinLength {
+		add("too_short", "must be at least %d characters", p.MinLength)
+	}
+	if len(password) > p.MaxLength {
+		add("too_long", "must be at most %d characters", p.MaxLength)
+	}
+
+	var upper, lower, digit, special bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			special = true
+		}
+	}
+	for _, class := range []struct {
+		required, present bool
+		code, name        string
+	}{
+		{p.RequireUpper, upper, "missing_upper", "an uppercase letter"},
+		{p.RequireLower, lower, "missing_lower", "a lowercase letter"},
+		{p.RequireDigit, digit, "missing_digit", "a digit"},
+		{p.RequireSpecial, special, "missing_special", "a special character"},
+	} {
+		if class.required && !class.present {
+			add(class.code, "must contain %s", class.name)
+		}
+	}
+	if classes := count(upper, lower, digit, special); classes < p.MinClasses {
+		add("too_few_classes", "must contain at least %d of: uppercase, lowercase, digit, special character", p.MinClasses)
+	}
+
+	if p.CheckBanned && c.isBanned(password) {
+		add("banned", "is too common")
+	}
+	if p.CheckUserInfo {
+		if part := similarTo(password, info); part != "" {
+			add("similar_to_user_info", "must not contain your %s", part)
+		}
+	}
+	return violations
+}
+
+// ExpiresAt is when a password set at changedAt expires; zero if passwords
+// don't expire
+func (c *Checker) ExpiresAt(changedAt time.Time) time.Time {
+	days := c.Policy().MaxAgeDays
+	if days == 0 {
+		return time.Time{}
+	}
+	return changedAt.AddDate(0, 0, days)
+}
+
+// isBanned also catches banned passwords with digits or symbols appended,
+// e.g. Password1!
+func (c *Checker) isBanned(password string) bool {
+	if len(c.banned) == 0 {
+		return false
+	}
+	lower := strings.ToLower(password)
+	if _, ok := c.banned[lower]; ok {
+		return true
+	}
+	base := strings.TrimRightFunc(lower, func(r rune) bool { return !unicode.IsLetter(r) })
+	_, ok := c.banned[base]
+	return ok && base != ""
+}
+
+// similarTo returns which detail of info the password contains, if any.
+// Names and the parts of the email's local part count from 3 characters.
+func similarTo(password string, info UserInfo) string {
+	lower := strings.ToLower(password)
+	local, _, _ := strings.Cut(strings.ToLower(info.Email), "@")
+	parts := []struct{ value, name string }{
+		{local, "email"},
+		{strings.ToLower(info.FirstName), "name"},
+		{strings.ToLower(info.LastName), "name"},
+	}
+	for _, word := range strings.FieldsFunc(local, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		parts = append(parts, struct{ value, name string }{word, "email"})
+	}
+	for _, part := range parts {
+		if len(part.value) >= 3 && strings.Contains(lower, part.value) {
+			return part.name
+		}
+	}
+	return ""
+}
+
+func count(flags ...bool) int {
+	n := 0
+	for _, flag := range flags {
+		if flag {
+			n++
+		}
+	}
+	return n
+}
+
+// LoadList reads a banned password list with one password per line, such as
+// a top-10k list. Blank lines and lines starting with # are skipped.
+func LoadList(path string) ([]string, error) {
+	file, err := os.Open(path) // #nosec G304 -- path comes from configuration
+	if err != nil {
+		return nil, fmt.Errorf("failed to open password list: %w", err)
+	}
+	defer file.Close()
+
+	var list []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		list = append(list, parseList(scanner.Text())...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read password list: %w", err)
+	}
+	return list, nil
+}
+
+func parseList(text string) []string {
+	var list []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			list = append(list, line)
+		}
+	}
+	return list
+}
+
+// FromConfig returns a checker of the PASSWORD_* policy, refusing the
+// built-in common passwords and those of PASSWORD_BANNED_LIST_FILE
+func FromConfig(cfg config.AuthConfig) (*Checker, error) {
+	policy := Policy{
+		MinLength:      cfg.PasswordMinLength,
+		MaxLength:      cfg.PasswordMaxLength,
+		RequireUpper:   cfg.PasswordRequireUpper,
+		RequireLower:   cfg.PasswordRequireLower,
+		RequireDigit:   cfg.PasswordRequireDigit,
+		RequireSpecial: cfg.PasswordRequireSpecial,
+		MinClasses:     cfg.PasswordMinClasses,
+		CheckBanned:    cfg.PasswordCheckBanned,
+		CheckUserInfo:  cfg.PasswordCheckUserInfo,
+		MaxAgeDays:     cfg.PasswordMaxAgeDays,
+	}
+	banned := Common()
+	if cfg.PasswordBannedListFile != "" {
+		list, err := LoadList(cfg.PasswordBannedListFile)
+		if err != nil {
+			return nil, err
+		}
+		banned = append(banned, list...)
+	}
+	checker, err := NewChecker(policy, banned)
+	if err != nil {
+		return nil, fmt.Errorf("invalid password policy: %w", err)
+	}
+	return checker, nil
+}
@@ -0,0 +1,101 @@
+package password
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+)
+
+func codes(violations []Violation) map[string]bool {
+	set := map[string]bool{}
+	for _, v := range violations {
+		set[v.Code] = true
+	}
+	return set
+}
+
+func TestChecker_Violations(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.MinLength = 10
+	policy.RequireSpecial = true
+	checker, err := NewChecker(policy, Common())
+	if err != nil {
+		t.Fatalf("NewChecker: %v", err)
+	}
+	info := UserInfo{Email: "jane.doe@example.com", FirstName: "Jane", LastName: "Doe"}
+
+	tests := []struct {
+		password string
+		want     []string
+	}{
+		{"Tr0ub4dor&3x", nil},
+		{"short", []string{"too_short", "too_few_classes", "missing_special"}},
+		{"Password123!", []string{"banned"}},
+		{"Qwerty2024!!", []string{"banned"}},
+		{"JaneSecret9!", []string{"similar_to_user_info"}},
+		{"x.jane.doe.X9", []string{"similar_to_user_info"}},
+	}
+	for _, tt := range tests {
+		got := codes(checker.Violations(tt.password, info))
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: violations %v, want %v", tt.password, got, tt.want)
+			continue
+		}
+		for _, code := range tt.want {
+			if !got[code] {
+				t.Errorf("%s: violations %v, want %v", tt.password, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestChecker_CheckIsValidationError(t *testing.T) {
+	checker, _ := NewChecker(DefaultPolicy(), nil)
+	err := checker.Check("abc", UserInfo{})
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) || !errors.Is(err, apperrors.ErrValidation) {
+		t.Fatalf("Check = %v, want a validation PolicyError", err)
+	}
+	if got := apperrors.Message(err); got != "password must be at least 8 characters; must contain at least 3 of: uppercase, lowercase, digit, special character" {
+		t.Errorf("message = %q", got)
+	}
+}
+
+func TestChecker_SetPolicyAndExpiry(t *testing.T) {
+	checker, _ := NewChecker(DefaultPolicy(), nil)
+	if err := checker.SetPolicy(Policy{MinLength: 8, MaxLength: 100}); err == nil {
+		t.Fatal("accepted max_length above the bcrypt limit")
+	}
+	if !checker.ExpiresAt(time.Now()).IsZero() {
+		t.Fatal("passwords expire without max_age_days")
+	}
+
+	policy := DefaultPolicy()
+	policy.MaxAgeDays = 90
+	if err := checker.SetPolicy(policy); err != nil {
+		t.Fatalf("SetPolicy: %v", err)
+	}
+	changed := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if got := checker.ExpiresAt(changed); !got.Equal(changed.AddDate(0, 0, 90)) {
+		t.Errorf("ExpiresAt = %v", got)
+	}
+}
+
+func TestLoadList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "banned.txt")
+	if err := os.WriteFile(path, []byte("# top passwords\nCorrectHorse\n\nbatterystaple\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	list, err := LoadList(path)
+	if err != nil || len(list) != 2 {
+		t.Fatalf("LoadList = %v, %v", list, err)
+	}
+	checker, _ := NewChecker(DefaultPolicy(), list)
+	if !codes(checker.Violations("correcthorse1!", UserInfo{}))["banned"] {
+		t.Error("list entries are not banned case-insensitively")
+	}
+}
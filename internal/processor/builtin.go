@@ -0,0 +1,56 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/mail"
+	"highload-microservice/internal/messaging"
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// UserLookup reads users. Implemented by services.UserService.
+type UserLookup interface {
+	GetUser(ctx context.Context, id uuid.UUID) (*models.User, error)
+}
+
+// SessionRevoker revokes the sessions of a user. Implemented by
+// services.AuthService.
+type SessionRevoker interface {
+	RevokeAllSessions(ctx context.Context, userID uuid.UUID) (int64, error)
+}
+
+// WelcomeEmail sends a welcome email to the user of user_created events
+func WelcomeEmail(users UserLookup, sender mail.Sender) Handler {
+	return Handler{
+		Name:      "welcome_email",
+		EventType: "user_created",
+		Run: func(ctx context.Context, event models.KafkaEvent) error {
+			user, err := users.GetUser(ctx, event.UserID)
+			if errors.Is(err, apperrors.ErrNotFound) {
+				return messaging.Permanent(err)
+			}
+			if err != nil {
+				return err
+			}
+			body := fmt.Sprintf("Hello %s,\n\nwelcome aboard! Your account %s is ready.\n", user.FirstName, user.Email)
+			return sender.Send(ctx, mail.Message{To: []string{user.Email}, Subject: "Welcome", Body: body})
+		},
+	}
+}
+
+// SessionCleanup revokes the sessions of the user of user_deleted events
+func SessionCleanup(sessions SessionRevoker) Handler {
+	return Handler{
+		Name:      "session_cleanup",
+		EventType: "user_deleted",
+		Run: func(ctx context.Context, event models.KafkaEvent) error {
+			_, err := sessions.RevokeAllSessions(ctx, event.UserID)
+			return err
+		},
+	}
+}
@@ -0,0 +1,332 @@
+// Package processor runs the handlers registered for the type of every
+// consumed event (e.g. a welcome email on user_created). Each handler is
+// retried on its own and can be disabled by config or, at runtime, through
+// the admin API.
+package processor
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/messaging"
+	"highload-microservice/internal/metrics"
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// AnyType registers a handler for events of every type
+const AnyType = "*"
+
+var validName = regexp.MustCompile(`^[a-z0-9_]{1,100}$`)
+
+// Func processes one event. Errors are retried unless wrapped with
+// messaging.Permanent.
+type Func func(ctx context.Context, event models.KafkaEvent) error
+
+// Handler is a processor of one event type
+type Handler struct {
+	Name       string // unique, lower case letters, digits and _
+	EventType  string // or AnyType
+	MaxRetries int    // retries after the first attempt; 0 uses the registry default
+	Run        Func
+}
+
+// Setting is the runtime state of a handler set through the admin API. It
+// takes precedence over EVENT_HANDLERS_DISABLED.
+type Setting struct {
+	Name      string     `json:"name"`
+	Enabled   bool       `json:"enabled"`
+	UpdatedBy *uuid.UUID `json:"updated_by,omitempty"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// Store persists the settings
+type Store interface {
+	ListSettings(ctx context.Context) ([]Setting, error)
+	SaveSetting(ctx context.Context, setting Setting) error
+}
+
+// Stats counts the runs of a handler since startup on this instance
+type Stats struct {
+	Succeeded int64 `json:"succeeded"`
+	Failed    int64 `json:"failed"` // gave up after the last retry
+	Retried   int64 `json:"retried"`
+}
+
+// Info describes a registered handler
+type Info struct {
+	Name       string     `json:"name"`
+	EventType  string     `json:"event_type"`
+	Enabled    bool       `json:"enabled"`
+	MaxRetries int        `json:"max_retries"`
+	UpdatedBy  *uuid.UUID `json:"updated_by,omitempty"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+	Stats      Stats      `json:"stats"`
+}
+
+// Config tunes handler retries
+type Config struct {
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Disabled       []string // handlers off unless enabled through the admin API
+}
+
+type registered struct {
+	Handler
+	succeeded, failed, retried atomic.Int64
+}
+
+// Registry holds the handlers by event type. Settings changed on other
+// replicas are picked up on the next refresh.
+type Registry struct {
+	store    Store
+	cfg      Config
+	disabled map[string]bool
+	logger   *logrus.Logger
+
+	mu       sync.RWMutex
+	byType   map[string][]*registered
+	byName   map[string]*registered
+	settings map[string]Setting
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func NewRegistry(store Store, cfg Config, logger *logrus.Logger) *Registry {
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 100 * time.Millisecond
+	}
+	if cfg.MaxBackoff < cfg.InitialBackoff {
+		cfg.MaxBackoff = 2 * time.Second
+	}
+	disabled := make(map[string]bool, len(cfg.Disabled))
+	for _, name := range cfg.Disabled {
+		disabled[name] = true
+	}
+	return &Registry{
+		store:    store,
+		cfg:      cfg,
+		disabled: disabled,
+		logger:   logger,
+		byType:   make(map[string][]*registered),
+		byName:   make(map[string]*registered),
+		settings: make(map[string]Setting),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// Register adds a handler. Handlers of one type run in registration order.
+func (r *Registry) Register(h Handler) error {
+	if !validName.MatchString(h.Name) {
+		return fmt.Errorf("invalid event handler name %q", h.Name)
+	}
+	if h.EventType == "" || h.Run == nil {
+		return fmt.Errorf("event handler %s needs an event type and a function", h.Name)
+	}
+	if h.MaxRetries <= 0 {
+		h.MaxRetries = r.cfg.MaxRetries
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.byName[h.Name]; exists {
+		return fmt.Errorf("event handler %s is already registered", h.Name)
+	}
+	reg := &registered{Handler: h}
+	r.byName[h.Name] = reg
+	r.byType[h.EventType] = append(r.byType[h.EventType], reg)
+	return nil
+}
+
+// Load replaces the in-memory settings with the stored ones
+func (r *Registry) Load(ctx context.Context) error {
+	list, err := r.store.ListSettings(ctx)
+	if err != nil {
+		return err
+	}
+	settings := make(map[string]Setting, len(list))
+	for _, s := range list {
+		settings[s.Name] = s
+	}
+
+	r.mu.Lock()
+	r.settings = settings
+	r.mu.Unlock()
+	return nil
+}
+
+// Start reloads the stored settings every interval until Stop is called
+func (r *Registry) Start(interval time.Duration) {
+	go func() {
+		defer close(r.stopped)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.done:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				if err := r.Load(ctx); err != nil {
+					r.logger.Errorf("Failed to refresh event handler settings: %v", err)
+				}
+				cancel()
+			}
+		}
+	}()
+}
+
+// Stop stops the refresh loop started by Start
+func (r *Registry) Stop() {
+	close(r.done)
+	<-r.stopped
+}
+
+// enabled reports whether the handler runs; the caller holds r.mu
+func (r *Registry) enabled(name string) bool {
+	if s, ok := r.settings[name]; ok {
+		return s.Enabled
+	}
+	return !r.disabled[name]
+}
+
+// Dispatch runs the enabled handlers of the event's type, then those of
+// AnyType. A handler that still fails after its retries is logged and
+// counted but does not fail the event: returning the error would make the
+// consumer run the handlers that succeeded again.
+func (r *Registry) Dispatch(ctx context.Context, event models.KafkaEvent) error {
+	r.mu.RLock()
+	var handlers []*registered
+	for _, list := range [][]*registered{r.byType[event.Type], r.byType[AnyType]} {
+		for _, h := range list {
+			if r.enabled(h.Name) {
+				handlers = append(handlers, h)
+			}
+		}
+	}
+	r.mu.RUnlock()
+
+	for _, h := range handlers {
+		if err := r.run(ctx, h, event); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			r.logger.Errorf("Event handler %s failed on event %s: %v", h.Name, event.ID, err)
+		}
+	}
+	return nil
+}
+
+func (r *Registry) run(ctx context.Context, h *registered, event models.KafkaEvent) error {
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		err := h.Run(ctx, event)
+		metrics.ObserveEventHandler(h.Name, time.Since(start))
+		if err == nil {
+			h.succeeded.Add(1)
+			metrics.EventHandlerRun(h.Name, metrics.HandlerSucceeded)
+			return nil
+		}
+		if messaging.IsPermanent(err) || attempt > h.MaxRetries || ctx.Err() != nil {
+			h.failed.Add(1)
+			metrics.EventHandlerRun(h.Name, metrics.HandlerFailed)
+			return err
+		}
+		h.retried.Add(1)
+		metrics.EventHandlerRun(h.Name, metrics.HandlerRetried)
+		r.logger.Warnf("Event handler %s failed on event %s (attempt %d): %v", h.Name, event.ID, attempt, err)
+
+		timer := time.NewTimer(backoff(r.cfg.InitialBackoff, r.cfg.MaxBackoff, attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			h.failed.Add(1)
+			metrics.EventHandlerRun(h.Name, metrics.HandlerFailed)
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// List returns the registered handlers, sorted by name
+func (r *Registry) List() []Info {
+	r.mu.RLock()
+	list := make([]Info, 0, len(r.byName))
+	for _, h := range r.byName {
+		list = append(list, r.info(h))
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// info describes h; the caller holds r.mu
+func (r *Registry) info(h *registered) Info {
+	info := Info{
+		Name:       h.Name,
+		EventType:  h.EventType,
+		Enabled:    r.enabled(h.Name),
+		MaxRetries: h.MaxRetries,
+		Stats: Stats{
+			Succeeded: h.succeeded.Load(),
+			Failed:    h.failed.Load(),
+			Retried:   h.retried.Load(),
+		},
+	}
+	if s, ok := r.settings[h.Name]; ok {
+		updatedAt := s.UpdatedAt
+		info.UpdatedBy, info.UpdatedAt = s.UpdatedBy, &updatedAt
+	}
+	return info
+}
+
+// SetEnabled enables or disables a handler on all replicas
+func (r *Registry) SetEnabled(ctx context.Context, name string, enabled bool, updatedBy *uuid.UUID) (Info, error) {
+	r.mu.RLock()
+	_, ok := r.byName[name]
+	r.mu.RUnlock()
+	if !ok {
+		return Info{}, apperrors.NotFound("event handler not found")
+	}
+
+	setting := Setting{Name: name, Enabled: enabled, UpdatedBy: updatedBy, UpdatedAt: time.Now().UTC()}
+	if err := r.store.SaveSetting(ctx, setting); err != nil {
+		return Info{}, apperrors.FromDB(err, "failed to save event handler setting")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.settings[name] = setting
+	return r.info(r.byName[name]), nil
+}
+
+// backoff doubles initial per attempt up to max and randomises the upper half
+func backoff(initial, max time.Duration, attempt int) time.Duration {
+	d := initial
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	half := d / 2
+	return half + rand.N(half+1) // #nosec G404 -- jitter, not security sensitive
+}
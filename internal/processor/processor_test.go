@@ -0,0 +1,162 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/messaging"
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type memoryStore struct {
+	settings map[string]Setting
+}
+
+func (m *memoryStore) ListSettings(ctx context.Context) ([]Setting, error) {
+	var settings []Setting
+	for _, s := range m.settings {
+		settings = append(settings, s)
+	}
+	return settings, nil
+}
+
+func (m *memoryStore) SaveSetting(ctx context.Context, s Setting) error {
+	m.settings[s.Name] = s
+	return nil
+}
+
+func newTestRegistry(disabled ...string) (*Registry, *memoryStore) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	store := &memoryStore{settings: map[string]Setting{}}
+	return NewRegistry(store, Config{
+		MaxRetries:     2,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		Disabled:       disabled,
+	}, logger), store
+}
+
+// recorder registers a handler that appends its name to calls and returns
+// the errors in fail one by one
+func recorder(t *testing.T, r *Registry, calls *[]string, name, eventType string, fail ...error) {
+	t.Helper()
+	err := r.Register(Handler{Name: name, EventType: eventType, Run: func(ctx context.Context, event models.KafkaEvent) error {
+		*calls = append(*calls, name)
+		if len(fail) == 0 {
+			return nil
+		}
+		err := fail[0]
+		fail = fail[1:]
+		return err
+	}})
+	if err != nil {
+		t.Fatalf("Register(%s): %v", name, err)
+	}
+}
+
+func TestRegistry_DispatchRunsHandlersOfTypeWithRetries(t *testing.T) {
+	r, _ := newTestRegistry()
+	var calls []string
+	flaky := errors.New("smtp unavailable")
+	recorder(t, r, &calls, "welcome", "user_created", flaky, flaky)
+	recorder(t, r, &calls, "cleanup", "user_deleted")
+	recorder(t, r, &calls, "audit", AnyType)
+
+	if err := r.Dispatch(context.Background(), models.KafkaEvent{ID: uuid.New(), Type: "user_created"}); err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	want := []string{"welcome", "welcome", "welcome", "audit"}
+	if len(calls) != len(want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Fatalf("calls = %v, want %v", calls, want)
+		}
+	}
+
+	stats := r.List()[2].Stats // sorted: audit, cleanup, welcome
+	if stats.Succeeded != 1 || stats.Retried != 2 || stats.Failed != 0 {
+		t.Fatalf("welcome stats = %+v", stats)
+	}
+}
+
+func TestRegistry_FailedHandlerDoesNotFailEvent(t *testing.T) {
+	r, _ := newTestRegistry()
+	var calls []string
+	down := errors.New("down")
+	recorder(t, r, &calls, "broken", "order_paid", down, down, down)
+	recorder(t, r, &calls, "rejected", "order_paid", messaging.Permanent(errors.New("bad payload")))
+	recorder(t, r, &calls, "fine", "order_paid")
+
+	if err := r.Dispatch(context.Background(), models.KafkaEvent{ID: uuid.New(), Type: "order_paid"}); err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	// Three attempts of broken, one of the permanent failure, then fine
+	if len(calls) != 5 || calls[4] != "fine" {
+		t.Fatalf("calls = %v", calls)
+	}
+	for _, info := range r.List() {
+		if info.Name != "fine" && info.Stats.Failed != 1 {
+			t.Fatalf("%s stats = %+v, want one failure", info.Name, info.Stats)
+		}
+	}
+}
+
+func TestRegistry_EnableAndDisable(t *testing.T) {
+	ctx := context.Background()
+	r, store := newTestRegistry("welcome")
+	var calls []string
+	recorder(t, r, &calls, "welcome", "user_created")
+	event := models.KafkaEvent{ID: uuid.New(), Type: "user_created"}
+
+	// Disabled by config
+	_ = r.Dispatch(ctx, event)
+	if len(calls) != 0 {
+		t.Fatalf("disabled handler ran: %v", calls)
+	}
+
+	// The admin API overrides the config and is stored for other replicas
+	info, err := r.SetEnabled(ctx, "welcome", true, nil)
+	if err != nil || !info.Enabled {
+		t.Fatalf("SetEnabled = %+v, %v", info, err)
+	}
+	_ = r.Dispatch(ctx, event)
+	if len(calls) != 1 {
+		t.Fatalf("enabled handler did not run: %v", calls)
+	}
+	if !store.settings["welcome"].Enabled {
+		t.Fatal("setting not stored")
+	}
+
+	// Another replica disables it; this one picks it up on refresh
+	store.settings["welcome"] = Setting{Name: "welcome", Enabled: false, UpdatedAt: time.Now()}
+	if err := r.Load(ctx); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	_ = r.Dispatch(ctx, event)
+	if len(calls) != 1 {
+		t.Fatalf("handler disabled on another replica ran: %v", calls)
+	}
+
+	if _, err := r.SetEnabled(ctx, "missing", true, nil); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Fatalf("SetEnabled(missing) error = %v, want not found", err)
+	}
+}
+
+func TestRegistry_RegisterRejectsDuplicates(t *testing.T) {
+	r, _ := newTestRegistry()
+	var calls []string
+	recorder(t, r, &calls, "welcome", "user_created")
+	if err := r.Register(Handler{Name: "welcome", EventType: "user_updated", Run: func(context.Context, models.KafkaEvent) error { return nil }}); err == nil {
+		t.Fatal("duplicate handler name accepted")
+	}
+}
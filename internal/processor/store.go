@@ -0,0 +1,64 @@
+package processor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"highload-microservice/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// SQLStore keeps handler settings in the event_handler_settings table
+type SQLStore struct {
+	db     *sql.DB
+	upsert string
+}
+
+func NewSQLStore(db *sql.DB, dialect database.Dialect) *SQLStore {
+	return &SQLStore{
+		db: db,
+		upsert: dialect.Upsert("event_handler_settings",
+			[]string{"name", "enabled", "updated_by", "updated_at"},
+			[]string{"name"},
+			[]string{"enabled", "updated_by", "updated_at"}),
+	}
+}
+
+func (s *SQLStore) ListSettings(ctx context.Context) ([]Setting, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT name, enabled, updated_by, updated_at FROM event_handler_settings`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list event handler settings: %w", err)
+	}
+	defer rows.Close()
+
+	var settings []Setting
+	for rows.Next() {
+		var (
+			setting   Setting
+			updatedBy sql.NullString
+		)
+		if err := rows.Scan(&setting.Name, &setting.Enabled, &updatedBy, &setting.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan event handler setting: %w", err)
+		}
+		if updatedBy.Valid {
+			if id, err := uuid.Parse(updatedBy.String); err == nil {
+				setting.UpdatedBy = &id
+			}
+		}
+		settings = append(settings, setting)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list event handler settings: %w", err)
+	}
+	return settings, nil
+}
+
+func (s *SQLStore) SaveSetting(ctx context.Context, setting Setting) error {
+	_, err := s.db.ExecContext(ctx, s.upsert, setting.Name, setting.Enabled, setting.UpdatedBy, setting.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save event handler setting: %w", err)
+	}
+	return nil
+}
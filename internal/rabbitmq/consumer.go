@@ -0,0 +1,121 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"highload-microservice/internal/config"
+	"highload-microservice/internal/models"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Consumer reads events from a durable queue bound to the exchange. Replicas
+// share the queue, so each event goes to one of them.
+//
+// Events are acknowledged when they are committed; unacknowledged events are
+// requeued when the channel closes. Events that cannot be decoded are
+// rejected without requeueing, which moves them to the dead-letter exchange
+// if one is configured.
+type Consumer struct {
+	cfg config.RabbitMQConfig
+
+	mu         sync.Mutex
+	session    *session
+	deliveries <-chan amqp.Delivery
+}
+
+// NewConsumer connects on first fetch, so the broker may start later
+func NewConsumer(cfg config.RabbitMQConfig) (*Consumer, error) {
+	if cfg.Exchange == "" || cfg.Queue == "" {
+		return nil, fmt.Errorf("RABBITMQ_EXCHANGE and RABBITMQ_QUEUE are required for the rabbitmq messaging backend")
+	}
+	return &Consumer{cfg: cfg}, nil
+}
+
+// FetchMessage reads the next event. The returned commit acknowledges it;
+// after a reconnect the acknowledgement fails and the event is redelivered.
+func (c *Consumer) FetchMessage(ctx context.Context) (models.KafkaEvent, func(context.Context) error, error) {
+	var event models.KafkaEvent
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.session.closed() {
+		if err := c.subscribe(); err != nil {
+			return event, nil, fmt.Errorf("failed to read message: %w", err)
+		}
+	}
+
+	var delivery amqp.Delivery
+	select {
+	case <-ctx.Done():
+		return event, nil, fmt.Errorf("failed to read message: %w", ctx.Err())
+	case d, ok := <-c.deliveries:
+		if !ok {
+			c.session.close()
+			return event, nil, fmt.Errorf("failed to read message: channel closed")
+		}
+		delivery = d
+	}
+
+	event, err := decode(delivery.Body, delivery.Headers)
+	if err != nil {
+		_ = delivery.Nack(false, false)
+		return event, nil, fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+
+	commit := func(ctx context.Context) error {
+		if err := delivery.Ack(false); err != nil {
+			return fmt.Errorf("failed to acknowledge message: %w", err)
+		}
+		return nil
+	}
+	return event, commit, nil
+}
+
+// subscribe dials a session, declares and binds the queue and starts
+// consuming from it
+func (c *Consumer) subscribe() error {
+	c.session.close()
+	c.session, c.deliveries = nil, nil
+
+	s, err := dial(c.cfg)
+	if err != nil {
+		return err
+	}
+	var args amqp.Table
+	if c.cfg.DeadLetterExchange != "" {
+		args = amqp.Table{"x-dead-letter-exchange": c.cfg.DeadLetterExchange}
+	}
+	if _, err := s.ch.QueueDeclare(c.cfg.Queue, true, false, false, false, args); err != nil {
+		s.close()
+		return fmt.Errorf("failed to declare queue %s: %w", c.cfg.Queue, err)
+	}
+	if err := s.ch.QueueBind(c.cfg.Queue, c.cfg.BindingKey, c.cfg.Exchange, false, nil); err != nil {
+		s.close()
+		return fmt.Errorf("failed to bind queue %s: %w", c.cfg.Queue, err)
+	}
+	if c.cfg.Prefetch > 0 {
+		if err := s.ch.Qos(c.cfg.Prefetch, 0, false); err != nil {
+			s.close()
+			return fmt.Errorf("failed to set prefetch: %w", err)
+		}
+	}
+	deliveries, err := s.ch.Consume(c.cfg.Queue, "", false, false, false, false, nil)
+	if err != nil {
+		s.close()
+		return fmt.Errorf("failed to consume queue %s: %w", c.cfg.Queue, err)
+	}
+	c.session, c.deliveries = s, deliveries
+	return nil
+}
+
+func (c *Consumer) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.session.close()
+	c.session = nil
+	return nil
+}
@@ -0,0 +1,87 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"highload-microservice/internal/config"
+	"highload-microservice/internal/models"
+)
+
+// Producer publishes events to the topic exchange with publisher confirms,
+// so SendEvent returns once the broker has taken the event
+type Producer struct {
+	cfg config.RabbitMQConfig
+
+	mu      sync.Mutex
+	session *session
+}
+
+// NewProducer connects on first use, so the broker may start later
+func NewProducer(cfg config.RabbitMQConfig) (*Producer, error) {
+	if cfg.Exchange == "" {
+		return nil, fmt.Errorf("RABBITMQ_EXCHANGE is required for the rabbitmq messaging backend")
+	}
+	return &Producer{cfg: cfg}, nil
+}
+
+// open returns the current session, dialling a new one when it is closed
+func (p *Producer) open() (*session, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.session.closed() {
+		return p.session, nil
+	}
+	p.session.close()
+	p.session = nil
+
+	s, err := dial(p.cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ch.Confirm(false); err != nil {
+		s.close()
+		return nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+	p.session = s
+	return s, nil
+}
+
+// Ping checks that a session to the broker is open
+func (p *Producer) Ping(ctx context.Context) error {
+	_, err := p.open()
+	return err
+}
+
+func (p *Producer) SendEvent(ctx context.Context, event models.KafkaEvent) error {
+	key, msg, err := encode(event)
+	if err != nil {
+		return err
+	}
+	s, err := p.open()
+	if err != nil {
+		return err
+	}
+
+	confirm, err := s.ch.PublishWithDeferredConfirmWithContext(ctx, p.cfg.Exchange, key, false, false, msg)
+	if err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+	if !acked {
+		return fmt.Errorf("failed to publish message: rejected by the broker")
+	}
+	return nil
+}
+
+func (p *Producer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.session.close()
+	p.session = nil
+	return nil
+}
@@ -0,0 +1,95 @@
+// Package rabbitmq publishes and consumes events through a RabbitMQ topic
+// exchange
+package rabbitmq
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"highload-microservice/internal/config"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/requestid"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// session is a connection with the channel used on it. amqp091 does not
+// reconnect: a closed session is dropped and dialled again on next use.
+type session struct {
+	conn *amqp.Connection
+	ch   *amqp.Channel
+}
+
+func (s *session) closed() bool {
+	return s == nil || s.conn.IsClosed() || s.ch.IsClosed()
+}
+
+func (s *session) close() {
+	if s != nil {
+		_ = s.conn.Close()
+	}
+}
+
+// dial opens a session and declares the exchange
+func dial(cfg config.RabbitMQConfig) (*session, error) {
+	amqpCfg := amqp.Config{
+		Heartbeat:  10 * time.Second,
+		Properties: amqp.Table{"connection_name": "highload-microservice"},
+	}
+	if cfg.Username != "" {
+		amqpCfg.SASL = []amqp.Authentication{&amqp.PlainAuth{Username: cfg.Username, Password: cfg.Password}}
+	}
+	conn, err := amqp.DialConfig(cfg.URL, amqpCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to open channel: %w", err)
+	}
+	if err := ch.ExchangeDeclare(cfg.Exchange, amqp.ExchangeTopic, true, false, false, false, nil); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to declare exchange %s: %w", cfg.Exchange, err)
+	}
+	return &session{conn: conn, ch: ch}, nil
+}
+
+// encode builds the message of event, routed by its type
+func encode(event models.KafkaEvent) (string, amqp.Publishing, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return "", amqp.Publishing{}, fmt.Errorf("failed to marshal event: %w", err)
+	}
+	msg := amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    event.Timestamp,
+		Type:         event.Type,
+		Body:         data,
+	}
+	if event.ID != uuid.Nil {
+		msg.MessageId = event.ID.String()
+	}
+	if event.RequestID != "" {
+		msg.Headers = amqp.Table{requestid.Header: event.RequestID}
+	}
+	return event.Type, msg, nil
+}
+
+// decode reads the event of a delivery, taking the request ID from the
+// header when the producer only set that
+func decode(body []byte, headers amqp.Table) (models.KafkaEvent, error) {
+	var event models.KafkaEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return event, err
+	}
+	if event.RequestID == "" {
+		if id, ok := headers[requestid.Header].(string); ok {
+			event.RequestID = id
+		}
+	}
+	return event, nil
+}
@@ -0,0 +1,50 @@
+package rabbitmq
+
+import (
+	"testing"
+	"time"
+
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/requestid"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestEncode_RoutedByType(t *testing.T) {
+	event := models.KafkaEvent{ID: uuid.New(), UserID: uuid.New(), Type: "user_created", Data: "{}", Timestamp: time.Now().UTC(), RequestID: "req-1"}
+
+	key, msg, err := encode(event)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if key != "user_created" || msg.MessageId != event.ID.String() || msg.DeliveryMode != amqp.Persistent {
+		t.Fatalf("key = %q, message = %+v", key, msg)
+	}
+
+	got, err := decode(msg.Body, msg.Headers)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.ID != event.ID || got.Type != event.Type || got.RequestID != "req-1" {
+		t.Fatalf("unexpected event: %+v", got)
+	}
+}
+
+func TestDecode_RequestIDFromHeader(t *testing.T) {
+	body := []byte(`{"id":"` + uuid.NewString() + `","type":"user_updated"}`)
+
+	got, err := decode(body, amqp.Table{requestid.Header: "req-2"})
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.RequestID != "req-2" {
+		t.Fatalf("request ID = %q", got.RequestID)
+	}
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	if _, err := decode([]byte("not-json"), nil); err == nil {
+		t.Fatalf("expected error")
+	}
+}
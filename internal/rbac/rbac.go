@@ -0,0 +1,177 @@
+// Package rbac maps user roles to the actions they may perform.
+package rbac
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"highload-microservice/internal/models"
+)
+
+// Permission is an action guarded by AuthMiddleware.RequirePermission
+type Permission string
+
+const (
+	PermUsersRead       Permission = "users:read"
+	PermUsersWrite      Permission = "users:write"  // update profiles
+	PermUsersManage     Permission = "users:manage" // create, delete, (de)activate, restore
+	PermRolesManage     Permission = "roles:manage"
+	PermEventsRead      Permission = "events:read"
+	PermEventsWrite     Permission = "events:write"
+	PermEventsReplay    Permission = "events:replay"    // republish stored events
+	PermEventsRetention Permission = "events:retention" // archive and delete expired events
+	PermAPIKeysManage   Permission = "api_keys:manage"
+	PermSchemasManage   Permission = "schemas:manage" // event types and payload schemas
+	PermWebhooksManage  Permission = "webhooks:manage"
+	PermSagasManage     Permission = "sagas:manage"   // inspect and retry workflows
+	PermDataExport      Permission = "data:export"    // stream users and events for offline analysis
+	PermSecurityAdmin   Permission = "security:admin" // security, DDoS and worker endpoints, account unlock
+
+	// PermEventHandlersManage enables and disables handlers of consumed
+	// events, which can stop event processing altogether
+	PermEventHandlersManage Permission = "event_handlers:manage"
+
+	// PermAll grants every permission
+	PermAll Permission = "*"
+)
+
+// Permissions lists every known permission except PermAll
+var Permissions = []Permission{
+	PermUsersRead, PermUsersWrite, PermUsersManage, PermRolesManage,
+	PermEventsRead, PermEventsWrite, PermEventsReplay, PermEventsRetention, PermAPIKeysManage, PermSchemasManage, PermEventHandlersManage,
+	PermWebhooksManage, PermSagasManage, PermDataExport, PermSecurityAdmin,
+}
+
+// Roles lists the roles accepted by auth_users.role
+var Roles = []models.UserRole{models.RoleAdmin, models.RoleUser, models.RoleReadOnly}
+
+// ValidRole reports whether role is one of Roles
+func ValidRole(role models.UserRole) bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Matrix is the set of permissions granted to each role
+type Matrix map[models.UserRole]map[Permission]bool
+
+var defaultMatrix = Matrix{
+	models.RoleAdmin: {PermAll: true},
+	models.RoleUser: {
+		PermUsersRead: true, PermUsersWrite: true,
+		PermEventsRead: true, PermEventsWrite: true,
+	},
+	models.RoleReadOnly: {PermUsersRead: true, PermEventsRead: true},
+}
+
+// Default returns the built-in matrix. It must not be modified.
+func Default() Matrix {
+	return defaultMatrix
+}
+
+// ParseMatrix overrides the default matrix with spec, a semicolon-separated
+// list of role=permission,... entries, e.g.
+// "user=users:read,events:read,events:write;readonly=events:read".
+// Roles not mentioned keep their defaults; an empty permission list revokes
+// everything.
+func ParseMatrix(spec string) (Matrix, error) {
+	matrix := make(Matrix, len(defaultMatrix))
+	for role, perms := range defaultMatrix {
+		matrix[role] = copyPerms(perms)
+	}
+
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, list, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid permission entry %q: expected role=permission,...", entry)
+		}
+		role := models.UserRole(strings.TrimSpace(name))
+		if !ValidRole(role) {
+			return nil, fmt.Errorf("unknown role %q", role)
+		}
+
+		perms := make(map[Permission]bool)
+		for _, p := range strings.Split(list, ",") {
+			perm := Permission(strings.TrimSpace(p))
+			if perm == "" {
+				continue
+			}
+			if !ValidPermission(perm) {
+				return nil, fmt.Errorf("unknown permission %q for role %s", perm, role)
+			}
+			perms[perm] = true
+		}
+		matrix[role] = perms
+	}
+	return matrix, nil
+}
+
+// Allows reports whether role has perm
+func (m Matrix) Allows(role models.UserRole, perm Permission) bool {
+	perms := m[role]
+	return perms[PermAll] || perms[perm]
+}
+
+// Covers reports whether role has every permission of other. It replaces a
+// fixed role hierarchy: "at least admin" means "allowed everything admin is".
+func (m Matrix) Covers(role, other models.UserRole) bool {
+	if _, ok := m[role]; !ok {
+		return false
+	}
+	if _, ok := m[other]; !ok {
+		return false
+	}
+	if m[role][PermAll] {
+		return true
+	}
+	if m[other][PermAll] {
+		return false
+	}
+	for perm := range m[other] {
+		if !m[role][perm] {
+			return false
+		}
+	}
+	return true
+}
+
+// Granted returns the sorted permissions of role, with PermAll expanded
+func (m Matrix) Granted(role models.UserRole) []Permission {
+	var granted []Permission
+	for _, perm := range Permissions {
+		if m.Allows(role, perm) {
+			granted = append(granted, perm)
+		}
+	}
+	sort.Slice(granted, func(i, j int) bool { return granted[i] < granted[j] })
+	return granted
+}
+
+// ValidPermission reports whether perm is one of Permissions or PermAll
+func ValidPermission(perm Permission) bool {
+	if perm == PermAll {
+		return true
+	}
+	for _, p := range Permissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+func copyPerms(perms map[Permission]bool) map[Permission]bool {
+	out := make(map[Permission]bool, len(perms))
+	for p, v := range perms {
+		out[p] = v
+	}
+	return out
+}
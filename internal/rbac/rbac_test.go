@@ -0,0 +1,68 @@
+package rbac
+
+import (
+	"testing"
+
+	"highload-microservice/internal/models"
+)
+
+func TestDefaultMatrix(t *testing.T) {
+	m := Default()
+	cases := []struct {
+		role models.UserRole
+		perm Permission
+		want bool
+	}{
+		{models.RoleAdmin, PermRolesManage, true},
+		{models.RoleUser, PermEventsWrite, true},
+		{models.RoleUser, PermUsersManage, false},
+		{models.RoleAdmin, PermEventHandlersManage, true},
+		{models.RoleUser, PermEventHandlersManage, false},
+		{models.RoleReadOnly, PermEventsRead, true},
+		{models.RoleReadOnly, PermEventsWrite, false},
+		{models.UserRole("ghost"), PermUsersRead, false},
+	}
+	for _, tc := range cases {
+		if got := m.Allows(tc.role, tc.perm); got != tc.want {
+			t.Errorf("Allows(%s, %s) = %v, want %v", tc.role, tc.perm, got, tc.want)
+		}
+	}
+}
+
+func TestMatrix_Covers(t *testing.T) {
+	m := Default()
+	if !m.Covers(models.RoleAdmin, models.RoleUser) || !m.Covers(models.RoleUser, models.RoleReadOnly) {
+		t.Fatal("expected the default roles to form a hierarchy")
+	}
+	if m.Covers(models.RoleUser, models.RoleAdmin) || m.Covers(models.RoleReadOnly, models.RoleUser) {
+		t.Fatal("lower role must not cover a higher one")
+	}
+	if m.Covers(models.UserRole("ghost"), models.RoleReadOnly) {
+		t.Fatal("unknown role must not cover anything")
+	}
+}
+
+func TestParseMatrix(t *testing.T) {
+	m, err := ParseMatrix("readonly=events:read; user=users:read,events:read,events:write")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if m.Allows(models.RoleReadOnly, PermUsersRead) {
+		t.Fatal("override should replace readonly permissions")
+	}
+	if m.Allows(models.RoleUser, PermUsersWrite) {
+		t.Fatal("override should replace user permissions")
+	}
+	if !m.Allows(models.RoleAdmin, PermSecurityAdmin) {
+		t.Fatal("admin should keep its default")
+	}
+	if Default().Allows(models.RoleReadOnly, PermUsersRead) != true {
+		t.Fatal("parsing must not modify the default matrix")
+	}
+
+	for _, spec := range []string{"ghost=users:read", "user=users:fly", "user"} {
+		if _, err := ParseMatrix(spec); err == nil {
+			t.Errorf("ParseMatrix(%q): expected error", spec)
+		}
+	}
+}
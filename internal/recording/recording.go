@@ -0,0 +1,198 @@
+// Package recording keeps sampled HTTP requests and their responses, bodies
+// included, for debugging production incidents. Bodies and headers are
+// redacted before they are stored; recordings are written to the
+// http_recordings table in the background, so a slow database never delays
+// the request, and deleted after the retention period.
+package recording
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultBatchSize     = 100
+	defaultFlushInterval = time.Second
+	defaultQueueSize     = 1000
+)
+
+// Recording is one request and its response
+type Recording struct {
+	ID              uuid.UUID         `json:"id"`
+	RecordedAt      time.Time         `json:"recorded_at"`
+	RequestID       string            `json:"request_id"`
+	Method          string            `json:"method"`
+	Path            string            `json:"path"`
+	Route           string            `json:"route,omitempty"` // gin route template
+	Query           string            `json:"query,omitempty"`
+	Status          int               `json:"status"`
+	DurationMS      int64             `json:"duration_ms"`
+	UserID          *uuid.UUID        `json:"user_id,omitempty"`
+	IPAddress       string            `json:"ip_address"`
+	RequestHeaders  map[string]string `json:"request_headers"`
+	RequestBody     string            `json:"request_body,omitempty"`
+	ResponseHeaders map[string]string `json:"response_headers"`
+	ResponseBody    string            `json:"response_body,omitempty"`
+	Truncated       bool              `json:"truncated"` // a body was longer than the capture limit
+}
+
+// Filter selects stored recordings. Zero values match everything.
+type Filter struct {
+	RequestID string
+	Method    string
+	Path      string
+	Status    int
+	UserID    *uuid.UUID
+	From      time.Time
+	To        time.Time
+	Page      int
+	Limit     int
+}
+
+// Store persists recordings
+type Store interface {
+	Save(ctx context.Context, recordings []Recording) error
+	// List returns one page of matching recordings without their bodies,
+	// newest first, and the total number of matches
+	List(ctx context.Context, filter Filter) ([]Recording, int, error)
+	Get(ctx context.Context, id uuid.UUID) (*Recording, error)
+	DeleteBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Config controls batching and how long recordings are kept
+type Config struct {
+	BatchSize     int
+	FlushInterval time.Duration
+	QueueSize     int           // recordings waiting to be written; more are dropped
+	Retention     time.Duration // Cleanup deletes older recordings
+}
+
+// Recorder writes recordings to a Store in batches
+type Recorder struct {
+	store  Store
+	cfg    Config
+	logger *logrus.Logger
+
+	queue   chan Recording
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+
+	dropping atomic.Bool // warned about a full queue since the last write
+}
+
+func NewRecorder(store Store, cfg Config, logger *logrus.Logger) *Recorder {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	return &Recorder{
+		store:   store,
+		cfg:     cfg,
+		logger:  logger,
+		queue:   make(chan Recording, cfg.QueueSize),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Store returns the store recordings are written to
+func (r *Recorder) Store() Store {
+	return r.store
+}
+
+// Start writes queued recordings until Stop is called
+func (r *Recorder) Start() {
+	go r.run()
+}
+
+// Stop writes what is queued and stops the writer
+func (r *Recorder) Stop() {
+	r.once.Do(func() { close(r.done) })
+	<-r.stopped
+}
+
+// Record queues rec; it is dropped when the queue is full
+func (r *Recorder) Record(rec Recording) {
+	select {
+	case r.queue <- rec:
+	default:
+		if r.dropping.CompareAndSwap(false, true) {
+			r.logger.Warn("HTTP recording queue full, dropping recordings")
+		}
+	}
+}
+
+// Cleanup deletes recordings older than the retention period; it is the
+// scheduler job
+func (r *Recorder) Cleanup(ctx context.Context) error {
+	if r.cfg.Retention <= 0 {
+		return nil
+	}
+	deleted, err := r.store.DeleteBefore(ctx, time.Now().Add(-r.cfg.Retention))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		r.logger.Infof("Deleted %d expired HTTP recordings", deleted)
+	}
+	return nil
+}
+
+func (r *Recorder) run() {
+	defer close(r.stopped)
+
+	ticker := time.NewTicker(r.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Recording, 0, r.cfg.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := r.store.Save(ctx, batch); err != nil {
+			r.logger.Errorf("Failed to store %d HTTP recordings: %v", len(batch), err)
+		} else {
+			r.dropping.Store(false)
+		}
+		cancel()
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case rec := <-r.queue:
+			batch = append(batch, rec)
+			if len(batch) >= r.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-r.done:
+			// Drain what is already queued
+			for {
+				select {
+				case rec := <-r.queue:
+					batch = append(batch, rec)
+					if len(batch) >= r.cfg.BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package recording
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/redact"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type memoryStore struct {
+	mu         sync.Mutex
+	recordings []Recording
+	batches    int
+	deleted    time.Time
+}
+
+func (m *memoryStore) Save(_ context.Context, recordings []Recording) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.recordings = append(m.recordings, recordings...)
+	m.batches++
+	return nil
+}
+
+func (m *memoryStore) List(context.Context, Filter) ([]Recording, int, error) {
+	return nil, 0, nil
+}
+
+func (m *memoryStore) Get(context.Context, uuid.UUID) (*Recording, error) {
+	return nil, nil
+}
+
+func (m *memoryStore) DeleteBefore(_ context.Context, before time.Time) (int64, error) {
+	m.deleted = before
+	return 1, nil
+}
+
+func TestBody(t *testing.T) {
+	r := redact.Default()
+	tests := []struct {
+		name, contentType, body, want string
+	}{
+		{"json", "application/json; charset=utf-8", `{"email":"a@b.io","password":"x","items":[{"token":"t"}]}`,
+			`{"email":"a***@b.io","items":[{"token":"[REDACTED]"}],"password":"[REDACTED]"}`},
+		{"ndjson", "application/x-ndjson", "{\"password\":\"x\"}\n{\"n\":1}\n", `{"password":"[REDACTED]"}` + "\n" + `{"n":1}`},
+		{"truncated json", "application/json", `{"note":"mail a@b.io","passw`, `{"note":"mail a***@b.io","passw`},
+		{"form", "application/x-www-form-urlencoded", "user=a&password=hunter2", "user=a&password=[REDACTED]"},
+		{"binary", "image/png", "\x89PNG....", "[8 bytes of image/png]"},
+		{"sniffed", "", `{"a":1}`, `{"a":1}`},
+		{"empty", "application/json", "", ""},
+	}
+	for _, tt := range tests {
+		if got := Body(r, tt.contentType, []byte(tt.body)); got != tt.want {
+			t.Errorf("%s: Body = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	r := redact.Default()
+	tests := []struct {
+		raw, want string
+	}{
+		{"token=abc123&page=2", "token=[REDACTED]&page=2"},
+		{"state=xyz&code=4%2F0Ad&scope=openid", "state=xyz&code=[REDACTED]&scope=openid"},
+		{"Password=hunter2&access_token=opaque", "Password=[REDACTED]&access_token=[REDACTED]"},
+		{"email=a%40b.io&q=plain+text", "email=a***@b.io&q=plain+text"},
+		{"user_id=4111111111111111&flag&token=", "user_id=4111111111111111&flag&token="},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Query(r, tt.raw); got != tt.want {
+			t.Errorf("Query(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	got := Headers(redact.Default(), http.Header{
+		"Authorization": {"Bearer abc"},
+		"X-Api-Key":     {"k"},
+		"Accept":        {"application/json", "text/plain"},
+	})
+	if got["Authorization"] != redact.Placeholder || got["X-Api-Key"] != redact.Placeholder {
+		t.Errorf("credentials kept: %v", got)
+	}
+	if got["Accept"] != "application/json, text/plain" {
+		t.Errorf("Accept = %q", got["Accept"])
+	}
+}
+
+func TestRecorder_WritesInBatchesAndOnStop(t *testing.T) {
+	store := &memoryStore{}
+	r := NewRecorder(store, Config{BatchSize: 2, FlushInterval: time.Hour}, logrus.New())
+	r.Start()
+	for i := 0; i < 3; i++ {
+		r.Record(Recording{ID: uuid.New()})
+	}
+	r.Stop()
+
+	if len(store.recordings) != 3 || store.batches != 2 {
+		t.Errorf("stored %d recordings in %d batches, want 3 in 2", len(store.recordings), store.batches)
+	}
+}
+
+func TestRecorder_DropsWhenQueueIsFull(t *testing.T) {
+	store := &memoryStore{}
+	r := NewRecorder(store, Config{QueueSize: 1}, logrus.New())
+	r.Record(Recording{ID: uuid.New()})
+	r.Record(Recording{ID: uuid.New()})
+	r.Start()
+	r.Stop()
+
+	if len(store.recordings) != 1 {
+		t.Errorf("stored %d recordings, want the one that fit in the queue", len(store.recordings))
+	}
+}
+
+func TestRecorder_Cleanup(t *testing.T) {
+	store := &memoryStore{}
+	if err := NewRecorder(store, Config{}, logrus.New()).Cleanup(context.Background()); err != nil || !store.deleted.IsZero() {
+		t.Errorf("no retention: err = %v, deleted before %v", err, store.deleted)
+	}
+	if err := NewRecorder(store, Config{Retention: time.Hour}, logrus.New()).Cleanup(context.Background()); err != nil {
+		t.Fatalf("Cleanup: %v", err)
+	}
+	if age := time.Since(store.deleted); age < time.Hour || age > time.Hour+time.Minute {
+		t.Errorf("deleted recordings older than %v, want an hour", age)
+	}
+}
+
+func TestSQLStore_List(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM http_recordings WHERE request_id = $1 AND status = $2 AND recorded_at >= $3`)).
+		WithArgs("req-1", 500, from).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	id := uuid.New()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT `+summaryColumns+` FROM http_recordings WHERE request_id = $1 AND status = $2 AND recorded_at >= $3 ORDER BY recorded_at DESC LIMIT $4 OFFSET $5`)).
+		WithArgs("req-1", 500, from, 20, 20).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "recorded_at", "request_id", "method", "path", "route", "query", "status", "duration_ms", "user_id", "ip_address", "truncated"}).
+			AddRow(id, from, "req-1", "POST", "/api/v1/events", "/api/v1/events", "", 500, 12, nil, "10.0.0.1", false))
+
+	recordings, total, err := NewSQLStore(db).List(context.Background(), Filter{RequestID: "req-1", Status: 500, From: from, Page: 2, Limit: 20})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if total != 1 || len(recordings) != 1 || recordings[0].ID != id || recordings[0].UserID != nil {
+		t.Errorf("List = %+v, %d", recordings, total)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,138 @@
+package recording
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"highload-microservice/internal/redact"
+)
+
+// secretHeaders are never stored
+var secretHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+	"x-api-key":           true,
+	"x-csrf-token":        true,
+}
+
+// secretParams are query parameters whose values are never stored: one-time
+// tokens and codes in links and OAuth callbacks, and passwords
+var secretParams = map[string]bool{
+	"token":    true,
+	"code":     true,
+	"password": true,
+}
+
+// Headers returns the headers with credentials replaced and the other
+// values redacted; repeated headers are joined with ", "
+func Headers(r *redact.Redactor, header http.Header) map[string]string {
+	out := make(map[string]string, len(header))
+	for name, values := range header {
+		if secretHeaders[strings.ToLower(name)] {
+			out[name] = redact.Placeholder
+			continue
+		}
+		out[name] = r.String(strings.Join(values, ", "))
+	}
+	return out
+}
+
+// Query returns a raw query string with the values of secret parameters and
+// sensitive fields replaced and the other values redacted. Parameters keep
+// their order; values that need no masking are kept as they were sent.
+func Query(r *redact.Redactor, raw string) string {
+	if raw == "" {
+		return ""
+	}
+	params := strings.Split(raw, "&")
+	for i, param := range params {
+		rawKey, rawValue, _ := strings.Cut(param, "=")
+		if rawValue == "" {
+			continue
+		}
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			key = rawKey
+		}
+		value, err := url.QueryUnescape(rawValue)
+		if err != nil {
+			value = rawValue
+		}
+
+		masked := redact.Placeholder
+		if !secretParams[strings.ToLower(key)] {
+			masked, _ = r.Field(key, value).(string)
+		}
+		if masked != value {
+			params[i] = rawKey + "=" + masked
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// Body returns data as it is stored: JSON with sensitive fields replaced and
+// strings redacted, other text redacted, and a size note for binary and
+// multipart content. A truncated JSON body can't be parsed and is redacted
+// as text.
+func Body(r *redact.Redactor, contentType string, data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "" {
+		mediaType = http.DetectContentType(data)
+		mediaType, _, _ = mime.ParseMediaType(mediaType)
+	}
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") || mediaType == "application/x-ndjson":
+		if body, ok := redactJSON(r, data); ok {
+			return body
+		}
+		return r.String(string(data))
+	case strings.HasPrefix(mediaType, "text/"), mediaType == "application/x-www-form-urlencoded",
+		mediaType == "application/xml", strings.HasSuffix(mediaType, "+xml"):
+		return r.String(string(data))
+	default:
+		return fmt.Sprintf("[%d bytes of %s]", len(data), mediaType)
+	}
+}
+
+// redactJSON redacts a JSON document, or every line of NDJSON
+func redactJSON(r *redact.Redactor, data []byte) (string, bool) {
+	var out []string
+	for _, line := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var v interface{}
+		if err := json.Unmarshal(line, &v); err != nil {
+			// Not line delimited: the document as a whole
+			if len(out) == 0 && json.Unmarshal(data, &v) == nil {
+				return marshal(r, v)
+			}
+			return "", false
+		}
+		body, ok := marshal(r, v)
+		if !ok {
+			return "", false
+		}
+		out = append(out, body)
+	}
+	return strings.Join(out, "\n"), true
+}
+
+func marshal(r *redact.Redactor, v interface{}) (string, bool) {
+	data, err := json.Marshal(r.Value(v))
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
@@ -0,0 +1,184 @@
+package recording
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+
+	"github.com/google/uuid"
+)
+
+// SQLStore keeps recordings in the http_recordings table
+type SQLStore struct {
+	db *sql.DB
+}
+
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+const summaryColumns = `id, recorded_at, request_id, method, path, route, query, status, duration_ms, user_id, ip_address, truncated`
+
+// Save inserts recordings in a single transaction
+func (s *SQLStore) Save(ctx context.Context, recordings []Recording) error {
+	if len(recordings) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := `
+		INSERT INTO http_recordings (id, recorded_at, request_id, method, path, route, query, status, duration_ms,
+			user_id, ip_address, request_headers, request_body, response_headers, response_body, truncated)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+	`
+	for _, rec := range recordings {
+		requestHeaders, err := json.Marshal(rec.RequestHeaders)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request headers: %w", err)
+		}
+		responseHeaders, err := json.Marshal(rec.ResponseHeaders)
+		if err != nil {
+			return fmt.Errorf("failed to marshal response headers: %w", err)
+		}
+		_, err = tx.ExecContext(ctx, query,
+			rec.ID, rec.RecordedAt, rec.RequestID, rec.Method, rec.Path, rec.Route, rec.Query, rec.Status, rec.DurationMS,
+			rec.UserID, rec.IPAddress, string(requestHeaders), rec.RequestBody, string(responseHeaders), rec.ResponseBody, rec.Truncated,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert HTTP recording: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit HTTP recordings: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) List(ctx context.Context, filter Filter) ([]Recording, int, error) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	cond := func(expr string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, strings.Replace(expr, "?", "$"+strconv.Itoa(len(args)), 1))
+	}
+	if filter.RequestID != "" {
+		cond("request_id = ?", filter.RequestID)
+	}
+	if filter.Method != "" {
+		cond("method = ?", filter.Method)
+	}
+	if filter.Path != "" {
+		cond("path = ?", filter.Path)
+	}
+	if filter.Status != 0 {
+		cond("status = ?", filter.Status)
+	}
+	if filter.UserID != nil {
+		cond("user_id = ?", *filter.UserID)
+	}
+	if !filter.From.IsZero() {
+		cond("recorded_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		cond("recorded_at < ?", filter.To)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM http_recordings`+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count HTTP recordings: %w", err)
+	}
+
+	page, limit := max(filter.Page, 1), filter.Limit
+	if limit < 1 {
+		limit = 50
+	}
+	query := `SELECT ` + summaryColumns + ` FROM http_recordings` + where +
+		fmt.Sprintf(` ORDER BY recorded_at DESC LIMIT $%d OFFSET $%d`, len(args)+1, len(args)+2)
+	rows, err := s.db.QueryContext(ctx, query, append(args, limit, (page-1)*limit)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list HTTP recordings: %w", err)
+	}
+	defer rows.Close()
+
+	recordings := []Recording{}
+	for rows.Next() {
+		var rec Recording
+		if err := scanSummary(rows, &rec); err != nil {
+			return nil, 0, err
+		}
+		recordings = append(recordings, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to list HTTP recordings: %w", err)
+	}
+	return recordings, total, nil
+}
+
+func (s *SQLStore) Get(ctx context.Context, id uuid.UUID) (*Recording, error) {
+	var (
+		rec                             Recording
+		requestHeaders, responseHeaders []byte
+	)
+	row := s.db.QueryRowContext(ctx, `
+		SELECT `+summaryColumns+`, request_headers, request_body, response_headers, response_body
+		FROM http_recordings WHERE id = $1
+	`, id)
+	if err := scanSummary(row, &rec, &requestHeaders, &rec.RequestBody, &responseHeaders, &rec.ResponseBody); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(requestHeaders, &rec.RequestHeaders); err != nil {
+		return nil, fmt.Errorf("failed to decode request headers: %w", err)
+	}
+	if err := json.Unmarshal(responseHeaders, &rec.ResponseHeaders); err != nil {
+		return nil, fmt.Errorf("failed to decode response headers: %w", err)
+	}
+	return &rec, nil
+}
+
+func (s *SQLStore) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM http_recordings WHERE recorded_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete HTTP recordings: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSummary scans summaryColumns into rec, followed by extra columns
+func scanSummary(row scanner, rec *Recording, extra ...interface{}) error {
+	var userID uuid.NullUUID
+	dest := append([]interface{}{&rec.ID, &rec.RecordedAt, &rec.RequestID, &rec.Method, &rec.Path, &rec.Route, &rec.Query,
+		&rec.Status, &rec.DurationMS, &userID, &rec.IPAddress, &rec.Truncated}, extra...)
+	err := row.Scan(dest...)
+	if err == sql.ErrNoRows {
+		return apperrors.NotFound("recording not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to scan HTTP recording: %w", err)
+	}
+	if userID.Valid {
+		rec.UserID = &userID.UUID
+	}
+	return nil
+}
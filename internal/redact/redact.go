@@ -0,0 +1,235 @@
+// Package redact masks personal data and credentials (emails, tokens,
+// card numbers, passwords) in log messages, log fields and security events.
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Placeholder replaces values that are removed entirely
+const Placeholder = "[REDACTED]"
+
+// Built-in pattern names accepted by New
+const (
+	PatternEmail    = "email"
+	PatternToken    = "token"
+	PatternCard     = "card"
+	PatternPassword = "password"
+)
+
+// DefaultPatterns and DefaultFields are used when nothing is configured
+var (
+	DefaultPatterns = []string{PatternEmail, PatternToken, PatternCard, PatternPassword}
+	DefaultFields   = []string{"password", "token", "access_token", "refresh_token", "authorization", "api_key", "secret"}
+	// DefaultAllowFields hold identifiers, which can look like card numbers
+	DefaultAllowFields = []string{"id", "request_id", "trace_id", "span_id", "user_id", "event_id"}
+)
+
+// passwordAssignment matches "password=...", "pwd: ..." and the like in free
+// text, query strings and JSON; the value is group 2
+var passwordAssignment = regexp.MustCompile(`(?i)((?:password|passwd|pwd|secret|api[_-]?key)["']?\s*[:=]\s*["']?)([^\s"'&,;]+)`)
+
+type rule struct {
+	re      *regexp.Regexp
+	replace func(match string) string
+}
+
+var builtinRules = map[string]rule{
+	PatternEmail: {
+		re:      regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+		replace: maskEmail,
+	},
+	PatternToken: {
+		// Bearer credentials and bare JWTs
+		re:      regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9._~+/\-]+=*|eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]*`),
+		replace: func(string) string { return Placeholder },
+	},
+	PatternCard: {
+		re:      regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`),
+		replace: maskCard,
+	},
+	PatternPassword: {
+		re: passwordAssignment,
+		replace: func(match string) string {
+			return passwordAssignment.ReplaceAllString(match, "${1}"+Placeholder)
+		},
+	},
+}
+
+// Redactor masks sensitive substrings and sensitive fields
+type Redactor struct {
+	rules  []rule
+	fields map[string]bool
+	allow  map[string]bool
+}
+
+// New creates a redactor for the named patterns (email, token, card,
+// password). Values of fields whose name is in fields (case-insensitive) are
+// replaced entirely.
+func New(patterns, fields []string) (*Redactor, error) {
+	r := &Redactor{fields: make(map[string]bool, len(fields))}
+	for _, name := range patterns {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		rl, ok := builtinRules[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown redaction pattern %q", name)
+		}
+		r.rules = append(r.rules, rl)
+	}
+	for _, field := range fields {
+		if field = strings.ToLower(strings.TrimSpace(field)); field != "" {
+			r.fields[field] = true
+		}
+	}
+	return r, nil
+}
+
+// Default returns a redactor with the default patterns and fields
+func Default() *Redactor {
+	r, _ := New(DefaultPatterns, DefaultFields)
+	r.AllowFields(DefaultAllowFields)
+	return r
+}
+
+// AllowFields exempts the values of fields (case-insensitive) from pattern
+// masking. Sensitive fields passed to New are still replaced.
+func (r *Redactor) AllowFields(fields []string) {
+	r.allow = make(map[string]bool, len(fields))
+	for _, field := range fields {
+		if field = strings.ToLower(strings.TrimSpace(field)); field != "" {
+			r.allow[field] = true
+		}
+	}
+}
+
+// String masks every pattern match in s
+func (r *Redactor) String(s string) string {
+	for _, rl := range r.rules {
+		s = rl.re.ReplaceAllStringFunc(s, rl.replace)
+	}
+	return s
+}
+
+// Field returns value with sensitive content masked; the whole value is
+// replaced when key is a sensitive field name. Allowed fields are returned
+// as they are.
+func (r *Redactor) Field(key string, value interface{}) interface{} {
+	key = strings.ToLower(key)
+	if r.fields[key] {
+		return Placeholder
+	}
+	if r.allow[key] {
+		return value
+	}
+	return r.Value(value)
+}
+
+// Value masks strings, including those nested in slices and maps (decoded
+// JSON as well)
+func (r *Redactor) Value(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return r.String(v)
+	case []string:
+		out := make([]string, len(v))
+		for i, s := range v {
+			out[i] = r.String(s)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = r.Value(item)
+		}
+		return out
+	case map[string]interface{}:
+		return r.Map(v)
+	case error:
+		return r.String(v.Error())
+	default:
+		return value
+	}
+}
+
+// Map returns a redacted copy of m
+func (r *Redactor) Map(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = r.Field(k, v)
+	}
+	return out
+}
+
+// Hook is a logrus hook that redacts entry messages and fields before they are written
+type Hook struct {
+	redactor *Redactor
+}
+
+// NewHook creates a logrus hook backed by r
+func NewHook(r *Redactor) *Hook {
+	return &Hook{redactor: r}
+}
+
+// Levels implements logrus.Hook
+func (h *Hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook
+func (h *Hook) Fire(entry *logrus.Entry) error {
+	entry.Message = h.redactor.String(entry.Message)
+	for k, v := range entry.Data {
+		entry.Data[k] = h.redactor.Field(k, v)
+	}
+	return nil
+}
+
+// maskEmail keeps the first character of the local part and the domain
+func maskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return Placeholder
+	}
+	return email[:1] + "***" + email[at:]
+}
+
+// maskCard keeps the last four digits of numbers that pass the Luhn check
+func maskCard(match string) string {
+	digits := make([]byte, 0, len(match))
+	for i := 0; i < len(match); i++ {
+		if match[i] >= '0' && match[i] <= '9' {
+			digits = append(digits, match[i])
+		}
+	}
+	if !luhnValid(digits) {
+		return match
+	}
+	return "****" + string(digits[len(digits)-4:])
+}
+
+func luhnValid(digits []byte) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,111 @@
+package redact
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestRedactor_String(t *testing.T) {
+	r := Default()
+
+	cases := map[string]string{
+		"login failed for john.doe@example.com":    "login failed for j***@example.com",
+		"Authorization: Bearer abc.def-123":        "Authorization: [REDACTED]",
+		"token eyJhbGciOi.eyJzdWIiOi.c2lnbmF0dXJl": "token [REDACTED]",
+		"card 4111 1111 1111 1111 declined":        "card ****1111 declined",
+		"order 1234567890123 shipped":              "order 1234567890123 shipped", // fails Luhn
+	}
+	for in, want := range cases {
+		if got := r.String(in); got != want {
+			t.Errorf("String(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRedactor_FieldsAndMaps(t *testing.T) {
+	r, err := New([]string{"email"}, []string{"Password"})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	out := r.Map(map[string]interface{}{
+		"password": "hunter2",
+		"email":    "a@b.io",
+		"errors":   []string{"x@y.io is taken"},
+		"count":    3,
+	})
+	if out["password"] != Placeholder || out["email"] != "a***@b.io" || out["count"] != 3 {
+		t.Fatalf("unexpected map: %#v", out)
+	}
+	if errs := out["errors"].([]string); errs[0] != "x***@y.io is taken" {
+		t.Fatalf("unexpected slice: %#v", errs)
+	}
+
+	// Decoded JSON: objects nested in arrays
+	decoded := r.Map(map[string]interface{}{
+		"users": []interface{}{map[string]interface{}{"email": "a@b.io", "password": "x"}},
+	})
+	user := decoded["users"].([]interface{})[0].(map[string]interface{})
+	if user["email"] != "a***@b.io" || user["password"] != Placeholder {
+		t.Fatalf("unexpected nested JSON: %#v", user)
+	}
+
+	if _, err := New([]string{"ssn"}, nil); err == nil {
+		t.Fatalf("expected error for unknown pattern")
+	}
+}
+
+func TestHook(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	logger.AddHook(NewHook(Default()))
+
+	logger.WithField("refresh_token", "abc").WithField("email", "jane@corp.com").
+		Warnf("Authentication failed for email: %s", "jane@corp.com")
+
+	line := buf.String()
+	if strings.Contains(line, "jane@corp.com") || strings.Contains(line, "abc") {
+		t.Fatalf("sensitive data leaked: %s", line)
+	}
+	if !strings.Contains(line, "j***@corp.com") || !strings.Contains(line, Placeholder) {
+		t.Fatalf("expected masked values: %s", line)
+	}
+}
+
+func TestRedactor_Passwords(t *testing.T) {
+	r := Default()
+
+	cases := map[string]string{
+		"login?user=bob&password=hunter2&next=/": "login?user=bob&password=[REDACTED]&next=/",
+		`{"pwd": "s3cr3t!", "name":"x"}`:         `{"pwd": "[REDACTED]", "name":"x"}`,
+		"API_KEY: abc123 rejected":               "API_KEY: [REDACTED] rejected",
+		"password reset requested":               "password reset requested",
+	}
+	for in, want := range cases {
+		if got := r.String(in); got != want {
+			t.Errorf("String(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRedactor_AllowFields(t *testing.T) {
+	r := Default()
+	r.AllowFields([]string{"Request_ID", "password"})
+
+	out := r.Map(map[string]interface{}{
+		"request_id": "4111 1111 1111 1111",
+		"note":       "4111 1111 1111 1111",
+		"password":   "hunter2",
+	})
+	if out["request_id"] != "4111 1111 1111 1111" || out["note"] != "****1111" {
+		t.Fatalf("unexpected map: %#v", out)
+	}
+	// Sensitive fields stay redacted even when allowed
+	if out["password"] != Placeholder {
+		t.Fatalf("password leaked: %#v", out)
+	}
+}
@@ -2,36 +2,127 @@ package redis
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"highload-microservice/internal/config"
 
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 )
 
+// Supported values for REDIS_MODE
+const (
+	ModeStandalone = "standalone"
+	ModeSentinel   = "sentinel"
+	ModeCluster    = "cluster"
+)
+
 type Client struct {
-	rdb *redis.Client
+	rdb redis.UniversalClient
 }
 
 func NewClient(cfg config.RedisConfig) (*Client, error) {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%s", cfg.Host, cfg.Port),
-		Password: cfg.Password,
-		DB:       cfg.DB,
-	})
+	rdb, err := newUniversalClient(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	// Test connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := rdb.Ping(ctx).Err(); err != nil {
+		_ = rdb.Close()
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
 	return &Client{rdb: rdb}, nil
 }
 
+// newUniversalClient creates the client for the configured deployment: a
+// single server, a master found through Sentinel, or a Cluster
+func newUniversalClient(cfg config.RedisConfig) (redis.UniversalClient, error) {
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(cfg.Mode) {
+	case "", ModeStandalone:
+		return redis.NewClient(&redis.Options{
+			Addr:      fmt.Sprintf("%s:%s", cfg.Host, cfg.Port),
+			Password:  cfg.Password,
+			DB:        cfg.DB,
+			TLSConfig: tlsConfig,
+		}), nil
+	case ModeSentinel:
+		if cfg.MasterName == "" || len(cfg.Addrs) == 0 {
+			return nil, errors.New("redis sentinel mode requires REDIS_SENTINEL_MASTER and REDIS_ADDRS")
+		}
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       cfg.MasterName,
+			SentinelAddrs:    cfg.Addrs,
+			SentinelPassword: cfg.SentinelPassword,
+			Password:         cfg.Password,
+			DB:               cfg.DB,
+			TLSConfig:        tlsConfig,
+		}), nil
+	case ModeCluster:
+		if len(cfg.Addrs) == 0 {
+			return nil, errors.New("redis cluster mode requires REDIS_ADDRS")
+		}
+		if cfg.DB != 0 {
+			return nil, errors.New("redis cluster mode only supports REDIS_DB=0")
+		}
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     cfg.Addrs,
+			Password:  cfg.Password,
+			TLSConfig: tlsConfig,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unsupported redis mode: %s", cfg.Mode)
+	}
+}
+
+// newTLSConfig returns the TLS settings for connections to Redis, or nil when
+// TLS is disabled
+func newTLSConfig(cfg config.RedisConfig) (*tls.Config, error) {
+	if !cfg.TLSEnabled {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: cfg.TLSServerName,
+	}
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Redis CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Redis client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
 func (c *Client) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
 	return c.rdb.Set(ctx, key, value, expiration).Err()
 }
@@ -40,10 +131,64 @@ func (c *Client) Get(ctx context.Context, key string) (string, error) {
 	return c.rdb.Get(ctx, key).Result()
 }
 
+// MGet returns the values of keys in order; missing keys are nil. Cluster
+// keys may hash to different slots, so there they are read with one GET
+// each in a pipeline.
+func (c *Client) MGet(ctx context.Context, keys ...string) ([]interface{}, error) {
+	if _, ok := c.rdb.(*redis.ClusterClient); !ok || len(keys) < 2 {
+		return c.rdb.MGet(ctx, keys...).Result()
+	}
+	cmds := make([]*redis.StringCmd, len(keys))
+	_, err := c.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Get(ctx, key)
+		}
+		return nil
+	})
+	if err != nil && !IsNil(err) {
+		return nil, err
+	}
+	values := make([]interface{}, len(keys))
+	for i, cmd := range cmds {
+		if value, err := cmd.Result(); err == nil {
+			values[i] = value
+		}
+	}
+	return values, nil
+}
+
 func (c *Client) Del(ctx context.Context, keys ...string) error {
+	if _, ok := c.rdb.(*redis.ClusterClient); ok && len(keys) > 1 {
+		// Keys may hash to different slots; send one DEL each
+		_, err := c.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range keys {
+				pipe.Del(ctx, key)
+			}
+			return nil
+		})
+		return err
+	}
 	return c.rdb.Del(ctx, keys...).Err()
 }
 
+// incrScript increments a counter and sets its TTL in one step, so a counter
+// never outlives its window. A key left without a TTL gets one too.
+var incrScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if n == 1 or redis.call('PTTL', KEYS[1]) == -1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return n
+`)
+
+// Incr increments the counter at key, setting the expiration when the key is created
+func (c *Client) Incr(ctx context.Context, key string, expiration time.Duration) (int64, error) {
+	if expiration <= 0 {
+		return c.rdb.Incr(ctx, key).Result()
+	}
+	return incrScript.Run(ctx, c.rdb, []string{key}, max(expiration.Milliseconds(), 1)).Int64()
+}
+
 func (c *Client) Exists(ctx context.Context, key string) (bool, error) {
 	result, err := c.rdb.Exists(ctx, key).Result()
 	return result > 0, err
@@ -56,3 +201,66 @@ func (c *Client) Ping(ctx context.Context) error {
 func (c *Client) Close() error {
 	return c.rdb.Close()
 }
+
+// IsNil reports whether err is the Redis "key does not exist" reply
+func IsNil(err error) bool {
+	return errors.Is(err, redis.Nil)
+}
+
+// SlidingWindowAdd records an occurrence at now in the sorted set at key,
+// drops occurrences older than window and returns how many remain. The key
+// expires once the window passes without new occurrences.
+func (c *Client) SlidingWindowAdd(ctx context.Context, key string, now time.Time, window time.Duration) (int64, error) {
+	pipe := c.rdb.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.Add(-window).UnixMilli(), 10))
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.UnixMilli()), Member: uuid.NewString()})
+	count := pipe.ZCard(ctx, key)
+	pipe.PExpire(ctx, key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return count.Val(), nil
+}
+
+// SlidingWindowCount returns the number of occurrences within window of now
+func (c *Client) SlidingWindowCount(ctx context.Context, key string, now time.Time, window time.Duration) (int64, error) {
+	return c.rdb.ZCount(ctx, key, "("+strconv.FormatInt(now.Add(-window).UnixMilli(), 10), "+inf").Result()
+}
+
+// ScanKeys calls fn with batches of keys matching pattern. It uses SCAN and
+// does not block the server, but keys changing during the scan may be missed.
+// In cluster mode every master is scanned; fn is never called concurrently.
+func (c *Client) ScanKeys(ctx context.Context, pattern string, fn func(keys []string) error) error {
+	cluster, ok := c.rdb.(*redis.ClusterClient)
+	if !ok {
+		return scanKeys(ctx, c.rdb, pattern, fn)
+	}
+
+	var mu sync.Mutex
+	return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		return scanKeys(ctx, node, pattern, func(keys []string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			return fn(keys)
+		})
+	})
+}
+
+func scanKeys(ctx context.Context, rdb redis.Cmdable, pattern string, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := rdb.Scan(ctx, cursor, pattern, 500).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
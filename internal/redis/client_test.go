@@ -0,0 +1,57 @@
+package redis
+
+import (
+	"testing"
+
+	"highload-microservice/internal/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestNewUniversalClient_Modes(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.RedisConfig
+		wantErr bool
+	}{
+		{name: "standalone", cfg: config.RedisConfig{Host: "localhost", Port: "6379"}},
+		{name: "sentinel", cfg: config.RedisConfig{Mode: ModeSentinel, MasterName: "mymaster", Addrs: []string{"s1:26379"}}},
+		{name: "sentinel without master", cfg: config.RedisConfig{Mode: ModeSentinel, Addrs: []string{"s1:26379"}}, wantErr: true},
+		{name: "cluster", cfg: config.RedisConfig{Mode: ModeCluster, Addrs: []string{"n1:6379", "n2:6379"}}},
+		{name: "cluster without nodes", cfg: config.RedisConfig{Mode: ModeCluster}, wantErr: true},
+		{name: "cluster with db", cfg: config.RedisConfig{Mode: ModeCluster, Addrs: []string{"n1:6379"}, DB: 1}, wantErr: true},
+		{name: "unknown mode", cfg: config.RedisConfig{Mode: "ring"}, wantErr: true},
+		{name: "missing CA file", cfg: config.RedisConfig{TLSEnabled: true, TLSCAFile: "/nonexistent/ca.pem"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rdb, err := newUniversalClient(tt.cfg)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			_ = rdb.Close()
+		})
+	}
+}
+
+func TestNewUniversalClient_ClusterClient(t *testing.T) {
+	rdb, err := newUniversalClient(config.RedisConfig{Mode: ModeCluster, Addrs: []string{"n1:6379"}, TLSEnabled: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer rdb.Close()
+
+	cluster, ok := rdb.(*redis.ClusterClient)
+	if !ok {
+		t.Fatalf("expected a cluster client, got %T", rdb)
+	}
+	if cluster.Options().TLSConfig == nil {
+		t.Fatalf("expected TLS to be configured")
+	}
+}
@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// AuthRepository stores login accounts, refresh tokens and API keys. All
+// reads use the primary: authentication must see revocations immediately.
+type AuthRepository interface {
+	// Accounts
+
+	// FindCredentials returns the active account with email and its login state
+	FindCredentials(ctx context.Context, email string) (*Credentials, error)
+	// GetActiveUser returns an active account
+	GetActiveUser(ctx context.Context, id uuid.UUID) (*models.AuthUser, error)
+	// GetAccount returns the state of an account in any activation state
+	GetAccount(ctx context.Context, id uuid.UUID) (*Account, error)
+	// FindAccount is GetAccount by email
+	FindAccount(ctx context.Context, email string) (*Account, error)
+	CreateUser(ctx context.Context, user *models.AuthUser, passwordHash string) error
+	// CountActiveAdmins guards against removing the last admin
+	CountActiveAdmins(ctx context.Context) (int, error)
+	// SetPassword replaces the password hash and clears failed login state
+	SetPassword(ctx context.Context, id uuid.UUID, passwordHash string, at time.Time) error
+	// PasswordChangedAt is when the account's password was last set
+	PasswordChangedAt(ctx context.Context, id uuid.UUID) (time.Time, error)
+	SetRole(ctx context.Context, id uuid.UUID, role models.UserRole, at time.Time) error
+	Deactivate(ctx context.Context, id uuid.UUID, at time.Time) error
+	// VerifyEmail activates an account whose email was never verified and
+	// reports whether it did
+	VerifyEmail(ctx context.Context, id uuid.UUID, at time.Time) (bool, error)
+	// GetProfile returns an active account with its pending email change
+	GetProfile(ctx context.Context, id uuid.UUID) (*models.Profile, error)
+	// UpdateProfile saves the names and pending email of an active account
+	UpdateProfile(ctx context.Context, profile *models.Profile, at time.Time) error
+	// ConfirmEmailChange replaces the email of an active account with its
+	// pending email if that is still email, and reports whether it did
+	ConfirmEmailChange(ctx context.Context, id uuid.UUID, email string, at time.Time) (bool, error)
+	// FindIdentity returns the account linked to a subject of an external
+	// identity provider
+	FindIdentity(ctx context.Context, issuer, subject string) (uuid.UUID, error)
+	LinkIdentity(ctx context.Context, userID uuid.UUID, issuer, subject string, at time.Time) error
+
+	// Lockout
+
+	// RecordFailedLogin counts a failed login at now, starting a new count
+	// when the first failure is older than windowStart, and returns the count
+	RecordFailedLogin(ctx context.Context, id uuid.UUID, windowStart, now time.Time) (int, error)
+	// Lock locks the account until the given time and resets the count
+	Lock(ctx context.Context, id uuid.UUID, until time.Time) error
+	// ClearFailedLogins resets the count and lifts any lock
+	ClearFailedLogins(ctx context.Context, id uuid.UUID) error
+
+	// Refresh tokens
+
+	CreateRefreshToken(ctx context.Context, token *RefreshToken) error
+	FindRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error)
+	// RevokeRefreshToken reports whether this call revoked the token
+	RevokeRefreshToken(ctx context.Context, id uuid.UUID, at time.Time) (bool, error)
+	// RevokeRefreshTokenFamily revokes every live token of a family
+	RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID, at time.Time) error
+	// RevokeUserRefreshTokens revokes every live token of a user and returns
+	// how many were revoked
+	RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID, at time.Time) (int64, error)
+	// ListRefreshSessions returns the live token of every family of a user
+	// that is neither revoked nor expired at now, most recently used first
+	ListRefreshSessions(ctx context.Context, userID uuid.UUID, now time.Time) ([]models.Session, error)
+	// RevokeRefreshSession revokes a family of a user and reports whether
+	// it had a live token
+	RevokeRefreshSession(ctx context.Context, userID, familyID uuid.UUID, at time.Time) (bool, error)
+	DeleteRefreshTokensExpiredBefore(ctx context.Context, t time.Time) (int64, error)
+
+	// Invitations
+
+	// CreateInvitation stores an invitation and revokes the pending
+	// invitations of the same email
+	CreateInvitation(ctx context.Context, invitation *models.Invitation, tokenHash string) error
+	FindInvitation(ctx context.Context, tokenHash string) (*models.Invitation, error)
+	// AcceptInvitation creates the account of a pending invitation unexpired
+	// at and marks it accepted in one transaction. It reports false, creating
+	// nothing, when the invitation is no longer pending or has expired.
+	AcceptInvitation(ctx context.Context, id uuid.UUID, user *models.AuthUser, passwordHash string, at time.Time) (bool, error)
+	// ListInvitations returns invitations newest first. Pending and expired
+	// are told apart by now; an empty status lists all.
+	ListInvitations(ctx context.Context, status models.InvitationStatus, now time.Time, limit int) ([]models.Invitation, error)
+
+	// API keys
+
+	CreateAPIKey(ctx context.Context, key *NewAPIKey) error
+	// FindAPIKey returns the key whose current or previous secret has keyHash
+	FindAPIKey(ctx context.Context, keyHash string) (*APIKeyCredentials, error)
+	// GetAPIKeySecret returns what rotating a key needs to know
+	GetAPIKeySecret(ctx context.Context, id uuid.UUID) (*APIKeySecret, error)
+	ListAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	GetAPIKeyLimits(ctx context.Context, id uuid.UUID) (*models.APIKeyLimits, error)
+	UpdateAPIKeyLimits(ctx context.Context, limits *models.APIKeyLimits) error
+	// RevokeAPIKey reports whether this call revoked the key
+	RevokeAPIKey(ctx context.Context, id uuid.UUID, at time.Time) (bool, error)
+	APIKeyExists(ctx context.Context, id uuid.UUID) (bool, error)
+	// RotateAPIKey replaces the secret if it still has oldHash and reports
+	// whether it did
+	RotateAPIKey(ctx context.Context, rotation *APIKeyRotation) (bool, error)
+	// ExpireAPIKeys deactivates keys expired before now, forgets rotated
+	// secrets whose grace period is over and returns the deactivated count
+	ExpireAPIKeys(ctx context.Context, now time.Time) (int64, error)
+	TouchAPIKey(ctx context.Context, id uuid.UUID, at time.Time) error
+}
+
+// Credentials is an account as seen by login
+type Credentials struct {
+	User           models.AuthUser
+	PasswordHash   string
+	FailedAttempts int
+	LockedUntil    *time.Time
+}
+
+// Account is the role and activation state of an account
+type Account struct {
+	ID       uuid.UUID
+	Email    string
+	Role     models.UserRole
+	IsActive bool
+}
+
+// RefreshToken is a stored refresh token. Tokens issued by one login share a
+// family; tokens issued before families existed form a family of their own.
+type RefreshToken struct {
+	ID        uuid.UUID // assigned by the database
+	UserID    uuid.UUID
+	TokenHash string
+	FamilyID  uuid.UUID
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	RevokedAt *time.Time
+
+	// Session metadata, captured at login and copied on rotation
+	UserAgent string
+	IPAddress string
+	LoginAt   time.Time
+}
+
+// NewAPIKey is an API key to store
+type NewAPIKey struct {
+	ID                 uuid.UUID
+	Name               string
+	KeyHash            string
+	KeyPrefix          string
+	Permissions        []string
+	CreatedAt          time.Time
+	ExpiresAt          *time.Time
+	RateLimitPerMinute int
+	MonthlyQuota       int64
+}
+
+// APIKeyCredentials is an API key as seen by authentication
+type APIKeyCredentials struct {
+	ID                 uuid.UUID
+	Permissions        []string
+	IsActive           bool
+	ExpiresAt          *time.Time
+	KeyHash            string // the current secret
+	PreviousExpiresAt  *time.Time
+	LastUsedAt         *time.Time
+	RateLimitPerMinute int
+	MonthlyQuota       int64
+}
+
+// APIKeySecret is an API key as seen by rotation
+type APIKeySecret struct {
+	Name      string
+	KeyHash   string
+	IsActive  bool
+	ExpiresAt *time.Time
+	CreatedAt time.Time
+}
+
+// APIKeyRotation replaces the secret of a key. A nil PreviousKeyHash revokes
+// the old secret immediately.
+type APIKeyRotation struct {
+	ID                uuid.UUID
+	OldKeyHash        string
+	KeyHash           string
+	KeyPrefix         string
+	PreviousKeyHash   *string
+	PreviousExpiresAt *time.Time
+	RotatedAt         time.Time
+}
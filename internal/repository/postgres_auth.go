@@ -0,0 +1,388 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// PostgresAuthRepository stores authentication state in the auth_users,
+// refresh_tokens and api_keys tables
+type PostgresAuthRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresAuthRepository(db *sql.DB) *PostgresAuthRepository {
+	return &PostgresAuthRepository{db: db}
+}
+
+func (r *PostgresAuthRepository) FindCredentials(ctx context.Context, email string) (*Credentials, error) {
+	var c Credentials
+	var lockedUntil sql.NullTime
+
+	query := `SELECT id, email, first_name, last_name, role, is_active, created_at, updated_at, password_hash, failed_login_attempts, locked_until 
+			  FROM auth_users WHERE email = $1 AND is_active = true`
+
+	err := r.db.QueryRowContext(ctx, query, email).Scan(
+		&c.User.ID, &c.User.Email, &c.User.FirstName, &c.User.LastName,
+		&c.User.Role, &c.User.IsActive, &c.User.CreatedAt, &c.User.UpdatedAt, &c.PasswordHash,
+		&c.FailedAttempts, &lockedUntil,
+	)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if lockedUntil.Valid {
+		c.LockedUntil = &lockedUntil.Time
+	}
+	return &c, nil
+}
+
+func (r *PostgresAuthRepository) GetActiveUser(ctx context.Context, id uuid.UUID) (*models.AuthUser, error) {
+	var user models.AuthUser
+	query := `SELECT id, email, first_name, last_name, role, is_active, created_at, updated_at 
+			  FROM auth_users WHERE id = $1 AND is_active = true`
+
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&user.ID, &user.Email, &user.FirstName, &user.LastName,
+		&user.Role, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r *PostgresAuthRepository) GetAccount(ctx context.Context, id uuid.UUID) (*Account, error) {
+	account := Account{ID: id}
+	err := r.db.QueryRowContext(ctx, `SELECT email, role, is_active FROM auth_users WHERE id = $1`, id).
+		Scan(&account.Email, &account.Role, &account.IsActive)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &account, nil
+}
+
+func (r *PostgresAuthRepository) FindAccount(ctx context.Context, email string) (*Account, error) {
+	account := Account{Email: email}
+	err := r.db.QueryRowContext(ctx, `SELECT id, role, is_active FROM auth_users WHERE email = $1`, email).
+		Scan(&account.ID, &account.Role, &account.IsActive)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &account, nil
+}
+
+func (r *PostgresAuthRepository) CreateUser(ctx context.Context, user *models.AuthUser, passwordHash string) error {
+	query := `INSERT INTO auth_users (id, email, first_name, last_name, password_hash, role, is_active, created_at, updated_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	_, err := r.db.ExecContext(ctx, query, user.ID, user.Email, user.FirstName, user.LastName, passwordHash,
+		user.Role, user.IsActive, user.CreatedAt, user.UpdatedAt)
+	return err
+}
+
+func (r *PostgresAuthRepository) FindIdentity(ctx context.Context, issuer, subject string) (uuid.UUID, error) {
+	var userID uuid.UUID
+	err := r.db.QueryRowContext(ctx, `SELECT user_id FROM auth_identities WHERE issuer = $1 AND subject = $2`, issuer, subject).
+		Scan(&userID)
+	if err != nil {
+		return uuid.Nil, notFound(err)
+	}
+	return userID, nil
+}
+
+func (r *PostgresAuthRepository) LinkIdentity(ctx context.Context, userID uuid.UUID, issuer, subject string, at time.Time) error {
+	query := `INSERT INTO auth_identities (issuer, subject, user_id, created_at) VALUES ($1, $2, $3, $4)`
+	_, err := r.db.ExecContext(ctx, query, issuer, subject, userID, at)
+	return err
+}
+
+func (r *PostgresAuthRepository) CountActiveAdmins(ctx context.Context) (int, error) {
+	var admins int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM auth_users WHERE role = $1 AND is_active = true`, models.RoleAdmin).Scan(&admins)
+	return admins, err
+}
+
+func (r *PostgresAuthRepository) SetPassword(ctx context.Context, id uuid.UUID, passwordHash string, at time.Time) error {
+	query := `UPDATE auth_users SET password_hash = $1, failed_login_attempts = 0, first_failed_login_at = NULL, locked_until = NULL, updated_at = $2,
+			  password_changed_at = $3 WHERE id = $4`
+	_, err := r.db.ExecContext(ctx, query, passwordHash, at, at, id)
+	return err
+}
+
+func (r *PostgresAuthRepository) PasswordChangedAt(ctx context.Context, id uuid.UUID) (time.Time, error) {
+	var changedAt time.Time
+	err := r.db.QueryRowContext(ctx, `SELECT password_changed_at FROM auth_users WHERE id = $1`, id).Scan(&changedAt)
+	if err != nil {
+		return time.Time{}, notFound(err)
+	}
+	return changedAt, nil
+}
+
+func (r *PostgresAuthRepository) SetRole(ctx context.Context, id uuid.UUID, role models.UserRole, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE auth_users SET role = $1, updated_at = $2 WHERE id = $3`, role, at, id)
+	return err
+}
+
+func (r *PostgresAuthRepository) Deactivate(ctx context.Context, id uuid.UUID, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE auth_users SET is_active = false, updated_at = $1 WHERE id = $2`, at, id)
+	return err
+}
+
+func (r *PostgresAuthRepository) VerifyEmail(ctx context.Context, id uuid.UUID, at time.Time) (bool, error) {
+	return changed(r.db.ExecContext(ctx,
+		`UPDATE auth_users SET is_active = true, email_verified_at = $1, updated_at = $2 WHERE id = $3 AND email_verified_at IS NULL`, at, at, id))
+}
+
+func (r *PostgresAuthRepository) GetProfile(ctx context.Context, id uuid.UUID) (*models.Profile, error) {
+	var profile models.Profile
+	var pendingEmail sql.NullString
+	query := `SELECT id, email, first_name, last_name, role, is_active, created_at, updated_at, pending_email
+			  FROM auth_users WHERE id = $1 AND is_active = true`
+
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&profile.ID, &profile.Email, &profile.FirstName, &profile.LastName,
+		&profile.Role, &profile.IsActive, &profile.CreatedAt, &profile.UpdatedAt, &pendingEmail,
+	)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	profile.PendingEmail = pendingEmail.String
+	return &profile, nil
+}
+
+func (r *PostgresAuthRepository) UpdateProfile(ctx context.Context, profile *models.Profile, at time.Time) error {
+	query := `UPDATE auth_users SET first_name = $1, last_name = $2, pending_email = NULLIF($3, ''), updated_at = $4
+			  WHERE id = $5 AND is_active = true`
+	updated, err := changed(r.db.ExecContext(ctx, query, profile.FirstName, profile.LastName, profile.PendingEmail, at, profile.ID))
+	if err == nil && !updated {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (r *PostgresAuthRepository) ConfirmEmailChange(ctx context.Context, id uuid.UUID, email string, at time.Time) (bool, error) {
+	query := `UPDATE auth_users SET email = pending_email, pending_email = NULL, email_verified_at = $1, updated_at = $2
+			  WHERE id = $3 AND pending_email = $4 AND is_active = true`
+	return changed(r.db.ExecContext(ctx, query, at, at, id, email))
+}
+
+func (r *PostgresAuthRepository) RecordFailedLogin(ctx context.Context, id uuid.UUID, windowStart, now time.Time) (int, error) {
+	query := `UPDATE auth_users SET
+			  failed_login_attempts = CASE WHEN first_failed_login_at IS NULL OR first_failed_login_at < $1 THEN 1 ELSE failed_login_attempts + 1 END,
+			  first_failed_login_at = CASE WHEN first_failed_login_at IS NULL OR first_failed_login_at < $2 THEN $3 ELSE first_failed_login_at END
+			  WHERE id = $4`
+	if _, err := r.db.ExecContext(ctx, query, windowStart, windowStart, now, id); err != nil {
+		return 0, err
+	}
+
+	var attempts int
+	err := r.db.QueryRowContext(ctx, `SELECT failed_login_attempts FROM auth_users WHERE id = $1`, id).Scan(&attempts)
+	return attempts, err
+}
+
+func (r *PostgresAuthRepository) Lock(ctx context.Context, id uuid.UUID, until time.Time) error {
+	query := `UPDATE auth_users SET locked_until = $1, failed_login_attempts = 0, first_failed_login_at = NULL WHERE id = $2`
+	_, err := r.db.ExecContext(ctx, query, until, id)
+	return err
+}
+
+func (r *PostgresAuthRepository) ClearFailedLogins(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE auth_users SET failed_login_attempts = 0, first_failed_login_at = NULL, locked_until = NULL WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+func (r *PostgresAuthRepository) CreateRefreshToken(ctx context.Context, token *RefreshToken) error {
+	query := `INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at, created_at, user_agent, ip_address, login_at) 
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err := r.db.ExecContext(ctx, query, token.UserID, token.TokenHash, token.FamilyID, token.ExpiresAt, token.CreatedAt,
+		token.UserAgent, token.IPAddress, token.LoginAt)
+	return err
+}
+
+func (r *PostgresAuthRepository) FindRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	token := RefreshToken{TokenHash: tokenHash}
+	var revokedAt sql.NullTime
+
+	query := `SELECT id, user_id, COALESCE(family_id, id), expires_at, revoked_at, user_agent, ip_address, COALESCE(login_at, created_at) FROM refresh_tokens WHERE token_hash = $1`
+	err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(
+		&token.ID, &token.UserID, &token.FamilyID, &token.ExpiresAt, &revokedAt,
+		&token.UserAgent, &token.IPAddress, &token.LoginAt,
+	)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return &token, nil
+}
+
+func (r *PostgresAuthRepository) RevokeRefreshToken(ctx context.Context, id uuid.UUID, at time.Time) (bool, error) {
+	n, err := affected(r.db.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`, at, id))
+	return n == 1, err
+}
+
+func (r *PostgresAuthRepository) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID, at time.Time) error {
+	// Tokens without a family are their own family
+	query := `UPDATE refresh_tokens SET revoked_at = $1 WHERE (family_id = $2 OR id = $3) AND revoked_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, at, familyID, familyID)
+	return err
+}
+
+func (r *PostgresAuthRepository) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID, at time.Time) (int64, error) {
+	return affected(r.db.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`, at, userID))
+}
+
+func (r *PostgresAuthRepository) ListRefreshSessions(ctx context.Context, userID uuid.UUID, now time.Time) ([]models.Session, error) {
+	// Rotation keeps one live token per family, so each row is a session; the
+	// live token was issued when the session was last used
+	query := `SELECT COALESCE(family_id, id), user_agent, ip_address, COALESCE(login_at, created_at), created_at, expires_at
+			  FROM refresh_tokens WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+			  ORDER BY created_at DESC`
+	rows, err := r.db.QueryContext(ctx, query, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(&session.ID, &session.UserAgent, &session.IPAddress, &session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *PostgresAuthRepository) RevokeRefreshSession(ctx context.Context, userID, familyID uuid.UUID, at time.Time) (bool, error) {
+	query := `UPDATE refresh_tokens SET revoked_at = $1 WHERE user_id = $2 AND (family_id = $3 OR id = $4) AND revoked_at IS NULL`
+	n, err := affected(r.db.ExecContext(ctx, query, at, userID, familyID, familyID))
+	return n > 0, err
+}
+
+func (r *PostgresAuthRepository) DeleteRefreshTokensExpiredBefore(ctx context.Context, t time.Time) (int64, error) {
+	return affected(r.db.ExecContext(ctx, `DELETE FROM refresh_tokens WHERE expires_at < $1`, t))
+}
+
+func (r *PostgresAuthRepository) CreateAPIKey(ctx context.Context, key *NewAPIKey) error {
+	query := `INSERT INTO api_keys (id, name, key_hash, key_prefix, permissions, is_active, created_at, expires_at, rate_limit_per_minute, monthly_quota) 
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	_, err := r.db.ExecContext(ctx, query, key.ID, key.Name, key.KeyHash, key.KeyPrefix, pq.Array(key.Permissions), true, key.CreatedAt, key.ExpiresAt,
+		key.RateLimitPerMinute, key.MonthlyQuota)
+	return err
+}
+
+func (r *PostgresAuthRepository) FindAPIKey(ctx context.Context, keyHash string) (*APIKeyCredentials, error) {
+	var key APIKeyCredentials
+	var permissions pq.StringArray
+
+	query := `SELECT id, permissions, is_active, expires_at, key_hash, previous_expires_at, last_used_at, rate_limit_per_minute, monthly_quota
+			  FROM api_keys WHERE key_hash = $1 OR previous_key_hash = $2`
+	err := r.db.QueryRowContext(ctx, query, keyHash, keyHash).Scan(&key.ID, &permissions, &key.IsActive, &key.ExpiresAt,
+		&key.KeyHash, &key.PreviousExpiresAt, &key.LastUsedAt, &key.RateLimitPerMinute, &key.MonthlyQuota)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	key.Permissions = []string(permissions)
+	return &key, nil
+}
+
+func (r *PostgresAuthRepository) GetAPIKeySecret(ctx context.Context, id uuid.UUID) (*APIKeySecret, error) {
+	var key APIKeySecret
+	err := r.db.QueryRowContext(ctx, `SELECT name, key_hash, is_active, expires_at, created_at FROM api_keys WHERE id = $1`, id).
+		Scan(&key.Name, &key.KeyHash, &key.IsActive, &key.ExpiresAt, &key.CreatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &key, nil
+}
+
+func (r *PostgresAuthRepository) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	query := `SELECT id, name, key_prefix, permissions, is_active, created_at, expires_at, last_used_at, revoked_at, rotated_at, previous_expires_at,
+			  rate_limit_per_minute, monthly_quota
+			  FROM api_keys ORDER BY created_at DESC`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var key models.APIKey
+		var permissions pq.StringArray
+		if err := rows.Scan(&key.ID, &key.Name, &key.KeyPrefix, &permissions, &key.IsActive, &key.CreatedAt,
+			&key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt, &key.RotatedAt, &key.PreviousKeyExpiresAt,
+			&key.RateLimitPerMinute, &key.MonthlyQuota); err != nil {
+			return nil, err
+		}
+		key.Permissions = []string(permissions)
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *PostgresAuthRepository) GetAPIKeyLimits(ctx context.Context, id uuid.UUID) (*models.APIKeyLimits, error) {
+	limits := models.APIKeyLimits{ID: id}
+	err := r.db.QueryRowContext(ctx, `SELECT rate_limit_per_minute, monthly_quota FROM api_keys WHERE id = $1`, id).
+		Scan(&limits.RateLimitPerMinute, &limits.MonthlyQuota)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &limits, nil
+}
+
+func (r *PostgresAuthRepository) UpdateAPIKeyLimits(ctx context.Context, limits *models.APIKeyLimits) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE api_keys SET rate_limit_per_minute = $1, monthly_quota = $2 WHERE id = $3`,
+		limits.RateLimitPerMinute, limits.MonthlyQuota, limits.ID)
+	return err
+}
+
+func (r *PostgresAuthRepository) RevokeAPIKey(ctx context.Context, id uuid.UUID, at time.Time) (bool, error) {
+	return changed(r.db.ExecContext(ctx,
+		`UPDATE api_keys SET is_active = false, revoked_at = $1, previous_key_hash = NULL WHERE id = $2 AND is_active = true`,
+		at, id))
+}
+
+func (r *PostgresAuthRepository) APIKeyExists(ctx context.Context, id uuid.UUID) (bool, error) {
+	var exists int
+	err := r.db.QueryRowContext(ctx, `SELECT 1 FROM api_keys WHERE id = $1`, id).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *PostgresAuthRepository) RotateAPIKey(ctx context.Context, rotation *APIKeyRotation) (bool, error) {
+	return changed(r.db.ExecContext(ctx,
+		`UPDATE api_keys SET key_hash = $1, key_prefix = $2, previous_key_hash = $3, previous_expires_at = $4, rotated_at = $5 WHERE id = $6 AND key_hash = $7`,
+		rotation.KeyHash, rotation.KeyPrefix, rotation.PreviousKeyHash, rotation.PreviousExpiresAt, rotation.RotatedAt, rotation.ID, rotation.OldKeyHash))
+}
+
+func (r *PostgresAuthRepository) ExpireAPIKeys(ctx context.Context, now time.Time) (int64, error) {
+	expired, err := affected(r.db.ExecContext(ctx,
+		`UPDATE api_keys SET is_active = false WHERE is_active = true AND expires_at IS NOT NULL AND expires_at < $1`, now))
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = r.db.ExecContext(ctx,
+		`UPDATE api_keys SET previous_key_hash = NULL WHERE previous_key_hash IS NOT NULL AND previous_expires_at < $1`, now)
+	return expired, err
+}
+
+func (r *PostgresAuthRepository) TouchAPIKey(ctx context.Context, id uuid.UUID, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = $1 WHERE id = $2`, at, id)
+	return err
+}
@@ -0,0 +1,323 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/pagination"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// PostgresEventRepository stores events in the events table
+type PostgresEventRepository struct {
+	db     *sql.DB
+	reader Reader
+	stmts  *Statements
+	noCopy bool // MySQL has no COPY; CreateBatch uses multi-row inserts
+}
+
+func NewPostgresEventRepository(db *sql.DB) *PostgresEventRepository {
+	return &PostgresEventRepository{db: db}
+}
+
+// SetReader routes Get and List to a read replica
+func (r *PostgresEventRepository) SetReader(reader Reader) {
+	r.reader = reader
+}
+
+// SetStatements prepares the queries of Create and Get once
+func (r *PostgresEventRepository) SetStatements(stmts *Statements) {
+	r.stmts = stmts
+}
+
+// DisableCopy makes CreateBatch use multi-row inserts, for databases other
+// than Postgres
+func (r *PostgresEventRepository) DisableCopy() {
+	r.noCopy = true
+}
+
+// readDB returns the pool for reads that tolerate replica lag
+func (r *PostgresEventRepository) readDB() *sql.DB {
+	if r.reader != nil {
+		return r.reader.Reader()
+	}
+	return r.db
+}
+
+func (r *PostgresEventRepository) Create(ctx context.Context, event *models.Event) error {
+	query := `
+		INSERT INTO events (id, user_id, type, data, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err := r.stmts.exec(ctx, r.db, query, event.ID, event.UserID, event.Type, event.Data, event.CreatedAt)
+	return err
+}
+
+// CreateBatch stores events in one transaction, streamed with COPY, and runs
+// within (if set) in the same transaction, e.g. to write them to the outbox.
+// Either all events are stored or none.
+func (r *PostgresEventRepository) CreateBatch(ctx context.Context, events []models.Event, within func(tx *sql.Tx) error) error {
+	if len(events) == 0 {
+		return nil
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if r.noCopy {
+		err = insertEvents(ctx, tx, events)
+	} else {
+		err = copyEvents(ctx, tx, events)
+	}
+	if err != nil {
+		return err
+	}
+	if within != nil {
+		if err := within(tx); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// copyEvents streams events into the events table with COPY FROM STDIN
+func copyEvents(ctx context.Context, tx *sql.Tx, events []models.Event) error {
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("events", "id", "user_id", "type", "data", "created_at"))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = stmt.Close() }()
+
+	for _, event := range events {
+		if _, err := stmt.ExecContext(ctx, event.ID, event.UserID, event.Type, event.Data, event.CreatedAt); err != nil {
+			return err
+		}
+	}
+	// Flushes the buffered rows; constraint violations surface here
+	_, err = stmt.ExecContext(ctx)
+	return err
+}
+
+// insertEvents stores events with one INSERT per 1000 rows
+func insertEvents(ctx context.Context, tx *sql.Tx, events []models.Event) error {
+	const rows = 1000
+	for start := 0; start < len(events); start += rows {
+		chunk := events[start:min(start+rows, len(events))]
+		values := make([]string, len(chunk))
+		args := make([]interface{}, 0, len(chunk)*5)
+		for i, event := range chunk {
+			n := len(args)
+			values[i] = fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5)
+			args = append(args, event.ID, event.UserID, event.Type, event.Data, event.CreatedAt)
+		}
+		query := `INSERT INTO events (id, user_id, type, data, created_at) VALUES ` + strings.Join(values, ", ")
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *PostgresEventRepository) Get(ctx context.Context, id uuid.UUID) (*models.Event, error) {
+	event := &models.Event{}
+	query := `SELECT id, user_id, type, data, created_at FROM events WHERE id = $1`
+
+	err := r.stmts.queryRow(ctx, r.readDB(), query, id).Scan(
+		&event.ID, &event.UserID, &event.Type, &event.Data, &event.CreatedAt,
+	)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return event, nil
+}
+
+func (r *PostgresEventRepository) List(ctx context.Context, q EventListQuery) (*EventPage, error) {
+	page := &EventPage{}
+	var err error
+	page.Total, page.More, err = r.list(ctx, q, "id, user_id, type, data, created_at", func(rows *sql.Rows) error {
+		var event models.Event
+		if err := rows.Scan(&event.ID, &event.UserID, &event.Type, &event.Data, &event.CreatedAt); err != nil {
+			return fmt.Errorf("failed to scan event: %w", err)
+		}
+		page.Events = append(page.Events, event)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if page.More {
+		page.Events = page.Events[:q.Limit]
+	}
+	return page, nil
+}
+
+func (r *PostgresEventRepository) ListIDs(ctx context.Context, q EventListQuery) (*IDPage, error) {
+	page := &IDPage{}
+	var err error
+	page.Total, page.More, err = r.list(ctx, q, "id", func(rows *sql.Rows) error {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return fmt.Errorf("failed to scan event: %w", err)
+		}
+		page.IDs = append(page.IDs, id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if page.More {
+		page.IDs = page.IDs[:q.Limit]
+	}
+	return page, nil
+}
+
+// list counts all events and calls scan with each row of columns of the
+// page, plus one extra row when more events follow
+func (r *PostgresEventRepository) list(ctx context.Context, q EventListQuery, columns string, scan func(rows *sql.Rows) error) (total int, more bool, err error) {
+	db := r.readDB()
+
+	// Get total count
+	countQuery := `SELECT COUNT(*) FROM events`
+	if err := db.QueryRowContext(ctx, countQuery).Scan(&total); err != nil {
+		return 0, false, fmt.Errorf("failed to count events: %w", err)
+	}
+
+	offset := q.Offset
+	where := ""
+	var args []interface{}
+	if q.After != nil {
+		where = "WHERE " + q.After.After(true, func(value interface{}) string {
+			args = append(args, value)
+			return fmt.Sprintf("$%d", len(args))
+		})
+		offset = 0
+	}
+
+	// Get events; one extra row tells whether there is a next page
+	query := fmt.Sprintf(`
+		SELECT %s 
+		FROM events %s
+		ORDER BY created_at DESC, id DESC 
+		LIMIT $%d OFFSET $%d
+	`, columns, where, len(args)+1, len(args)+2)
+
+	rows, err := db.QueryContext(ctx, query, append(args, q.Limit+1, offset)...)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to list events: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	n := 0
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return 0, false, err
+		}
+		n++
+	}
+	return total, n > q.Limit, nil
+}
+
+func (r *PostgresEventRepository) GetMany(ctx context.Context, ids []uuid.UUID) ([]models.Event, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = id
+	}
+	query := `SELECT id, user_id, type, data, created_at FROM events WHERE id IN (` + strings.Join(placeholders, ", ") + `)`
+
+	rows, err := r.readDB().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get events: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	events := make([]models.Event, 0, len(ids))
+	for rows.Next() {
+		var event models.Event
+		if err := rows.Scan(&event.ID, &event.UserID, &event.Type, &event.Data, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// rangeCondition returns the WHERE condition of q, numbering placeholders
+// from len(args)+1
+func rangeCondition(q EventRangeQuery, args []interface{}) (string, []interface{}) {
+	var conditions []string
+	bind := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if q.From != nil {
+		conditions = append(conditions, "created_at >= "+bind(*q.From))
+	}
+	if q.To != nil {
+		conditions = append(conditions, "created_at < "+bind(*q.To))
+	}
+	if len(q.Types) > 0 {
+		placeholders := make([]string, len(q.Types))
+		for i, t := range q.Types {
+			placeholders[i] = bind(t)
+		}
+		conditions = append(conditions, "type IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if len(conditions) == 0 {
+		return "1 = 1", args
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+func (r *PostgresEventRepository) CountRange(ctx context.Context, q EventRangeQuery) (int, error) {
+	where, args := rangeCondition(q, nil)
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM events WHERE `+where, args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("failed to count events: %w", err)
+	}
+	return total, nil
+}
+
+func (r *PostgresEventRepository) ListRange(ctx context.Context, q EventRangeQuery, after *pagination.Cursor, limit int) ([]models.Event, error) {
+	where, args := rangeCondition(q, nil)
+	if after != nil {
+		where += " AND " + after.After(false, func(value interface{}) string {
+			args = append(args, value)
+			return fmt.Sprintf("$%d", len(args))
+		})
+	}
+	args = append(args, limit)
+	query := fmt.Sprintf(`
+		SELECT id, user_id, type, data, created_at
+		FROM events WHERE %s
+		ORDER BY created_at, id
+		LIMIT $%d
+	`, where, len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var events []models.Event
+	for rows.Next() {
+		var event models.Event
+		if err := rows.Scan(&event.ID, &event.UserID, &event.Type, &event.Data, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
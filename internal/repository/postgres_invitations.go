@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const invitationColumns = `id, email, first_name, last_name, role, status, invited_by, user_id, expires_at, created_at, accepted_at`
+
+func (r *PostgresAuthRepository) CreateInvitation(ctx context.Context, invitation *models.Invitation, tokenHash string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE invitations SET status = $1 WHERE LOWER(email) = LOWER($2) AND status = $3`,
+		models.InvitationRevoked, invitation.Email, models.InvitationPending); err != nil {
+		return err
+	}
+	query := `INSERT INTO invitations (id, email, first_name, last_name, role, status, invited_by, token_hash, expires_at, created_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	if _, err := tx.ExecContext(ctx, query, invitation.ID, invitation.Email, invitation.FirstName, invitation.LastName,
+		invitation.Role, invitation.Status, invitation.InvitedBy, tokenHash, invitation.ExpiresAt, invitation.CreatedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *PostgresAuthRepository) FindInvitation(ctx context.Context, tokenHash string) (*models.Invitation, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+invitationColumns+` FROM invitations WHERE token_hash = $1`, tokenHash)
+	invitation, err := scanInvitation(row)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return invitation, nil
+}
+
+func (r *PostgresAuthRepository) AcceptInvitation(ctx context.Context, id uuid.UUID, user *models.AuthUser, passwordHash string, at time.Time) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// The invitation was sent to the email, so it counts as verified
+	query := `INSERT INTO auth_users (id, email, first_name, last_name, password_hash, role, is_active, created_at, updated_at, email_verified_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	if _, err := tx.ExecContext(ctx, query, user.ID, user.Email, user.FirstName, user.LastName, passwordHash,
+		user.Role, user.IsActive, user.CreatedAt, user.UpdatedAt, at); err != nil {
+		return false, err
+	}
+	// Rolling back removes the account again if the invitation was taken
+	accepted, err := changed(tx.ExecContext(ctx,
+		`UPDATE invitations SET status = $1, user_id = $2, accepted_at = $3 WHERE id = $4 AND status = $5 AND expires_at > $6`,
+		models.InvitationAccepted, user.ID, at, id, models.InvitationPending, at))
+	if err != nil || !accepted {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (r *PostgresAuthRepository) ListInvitations(ctx context.Context, status models.InvitationStatus, now time.Time, limit int) ([]models.Invitation, error) {
+	var args []interface{}
+	bind := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	query := `SELECT ` + invitationColumns + ` FROM invitations`
+	switch status {
+	case "":
+	case models.InvitationPending:
+		query += ` WHERE status = ` + bind(models.InvitationPending) + ` AND expires_at > ` + bind(now)
+	case models.InvitationExpired:
+		query += ` WHERE status = ` + bind(models.InvitationPending) + ` AND expires_at <= ` + bind(now)
+	default:
+		query += ` WHERE status = ` + bind(status)
+	}
+	query += ` ORDER BY created_at DESC LIMIT ` + bind(limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []models.Invitation{}
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		if invitation.Status == models.InvitationPending && !now.Before(invitation.ExpiresAt) {
+			invitation.Status = models.InvitationExpired
+		}
+		invitations = append(invitations, *invitation)
+	}
+	return invitations, rows.Err()
+}
+
+func scanInvitation(row interface{ Scan(...interface{}) error }) (*models.Invitation, error) {
+	var invitation models.Invitation
+	var invitedBy, userID uuid.NullUUID
+	var acceptedAt sql.NullTime
+	if err := row.Scan(&invitation.ID, &invitation.Email, &invitation.FirstName, &invitation.LastName, &invitation.Role,
+		&invitation.Status, &invitedBy, &userID, &invitation.ExpiresAt, &invitation.CreatedAt, &acceptedAt); err != nil {
+		return nil, err
+	}
+	if invitedBy.Valid {
+		invitation.InvitedBy = &invitedBy.UUID
+	}
+	if userID.Valid {
+		invitation.UserID = &userID.UUID
+	}
+	if acceptedAt.Valid {
+		invitation.AcceptedAt = &acceptedAt.Time
+	}
+	return &invitation, nil
+}
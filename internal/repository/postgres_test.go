@@ -0,0 +1,251 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/fieldcrypt"
+	"highload-microservice/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+type fixedReader struct{ db *sql.DB }
+
+func (r fixedReader) Reader() *sql.DB { return r.db }
+
+func TestPostgresUserRepository_ReadsFromReplica(t *testing.T) {
+	primary, primaryMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer primary.Close()
+	replica, replicaMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer replica.Close()
+
+	repo := NewPostgresUserRepository(primary)
+	repo.SetReader(fixedReader{db: replica})
+
+	id := uuid.New()
+	selectUser := regexp.QuoteMeta("SELECT id, email, first_name, last_name, created_at, updated_at FROM users WHERE id = $1")
+	columns := []string{"id", "email", "first_name", "last_name", "created_at", "updated_at"}
+	replicaMock.ExpectQuery(selectUser).WithArgs(id).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(id, "r@example.com", "Re", "Plica", time.Now(), time.Now()))
+	replicaMock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM users")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	replicaMock.ExpectQuery(regexp.QuoteMeta("FROM users")).
+		WillReturnRows(sqlmock.NewRows(columns))
+	primaryMock.ExpectQuery(selectUser).WithArgs(id).WillReturnError(sql.ErrNoRows)
+
+	if user, err := repo.Get(context.Background(), id); err != nil || user.Email != "r@example.com" {
+		t.Fatalf("get: %+v, %v", user, err)
+	}
+	if _, err := repo.List(context.Background(), UserListQuery{Limit: 10}); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	// Read-modify-write paths see the primary
+	if _, err := repo.GetPrimary(context.Background(), id); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound from the primary, got %v", err)
+	}
+
+	if err := replicaMock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("replica expectations: %v", err)
+	}
+	if err := primaryMock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("primary expectations: %v", err)
+	}
+}
+
+func TestPostgresUserRepository_ListRejectsUnknownSort(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewPostgresUserRepository(db)
+	_, err = repo.List(context.Background(), UserListQuery{Filter: models.UserFilter{Sort: "password"}, Limit: 10})
+	if !errors.Is(err, apperrors.ErrValidation) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+}
+
+func TestPostgresAuthRepository_APIKeyExists(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewPostgresAuthRepository(db)
+	id := uuid.New()
+	query := regexp.QuoteMeta("SELECT 1 FROM api_keys WHERE id = $1")
+	mock.ExpectQuery(query).WithArgs(id).WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+	mock.ExpectQuery(query).WithArgs(id).WillReturnError(sql.ErrNoRows)
+
+	if exists, err := repo.APIKeyExists(context.Background(), id); err != nil || !exists {
+		t.Fatalf("expected key to exist: %v, %v", exists, err)
+	}
+	if exists, err := repo.APIKeyExists(context.Background(), id); err != nil || exists {
+		t.Fatalf("expected missing key: %v, %v", exists, err)
+	}
+}
+
+func TestPostgresUserAuditRepository_List(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	userID, actorID := uuid.New(), uuid.New()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM user_audit WHERE user_id = $1")).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, action, actor_id, request_id, changes, created_at")).
+		WithArgs(userID, 10, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "action", "actor_id", "request_id", "changes", "created_at"}).
+			AddRow(uuid.New(), userID, models.UserAuditUpdated, actorID.String(), "req-1", `{"email":{"old":"a@x","new":"b@x"}}`, time.Now()).
+			AddRow(uuid.New(), userID, models.UserAuditCreated, nil, "", `{"email":{"old":null,"new":"a@x"}}`, time.Now()))
+
+	entries, total, err := NewPostgresUserAuditRepository(db).List(context.Background(), userID, 0, 10)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if total != 2 || len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d of %d", len(entries), total)
+	}
+	if entries[0].ActorID == nil || *entries[0].ActorID != actorID || entries[0].Changes["email"].New != "b@x" {
+		t.Fatalf("unexpected entry: %+v", entries[0])
+	}
+	if entries[1].ActorID != nil || entries[1].Changes["email"].Old != nil {
+		t.Fatalf("unexpected entry: %+v", entries[1])
+	}
+}
+
+// capture is an sqlmock argument matching any string and remembering it
+type capture struct{ value *string }
+
+func (c capture) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	*c.value = s
+	return ok
+}
+
+func TestPostgresUserRepository_Encryption(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	encryptor, err := fieldcrypt.NewEncryptor("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		t.Fatalf("encryptor: %v", err)
+	}
+	crypto := &UserEncryption{Encryptor: encryptor, IndexKey: bytes.Repeat([]byte{2}, 32)}
+	repo := NewPostgresUserRepository(db)
+	repo.SetEncryption(crypto)
+
+	user := &models.User{ID: uuid.New(), Email: "Ann@Example.com", FirstName: "Ann", LastName: "Lee", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	var email, firstName, lastName string
+	hash := crypto.EmailIndex("ann@example.com ")
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users (id, email, first_name, last_name, email_hash, created_at, updated_at, auth_user_id)")).
+		WithArgs(user.ID, capture{&email}, capture{&firstName}, capture{&lastName}, hash, sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	if err := repo.Create(context.Background(), user); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	for _, value := range []string{email, firstName, lastName} {
+		if !fieldcrypt.IsEncrypted(value) {
+			t.Fatalf("stored plaintext: %q", value)
+		}
+	}
+
+	columns := []string{"id", "email", "first_name", "last_name", "created_at", "updated_at"}
+	mock.ExpectQuery(regexp.QuoteMeta("FROM users WHERE id = $1")).WithArgs(user.ID).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(user.ID, email, firstName, lastName, time.Now(), time.Now()))
+	got, err := repo.Get(context.Background(), user.ID)
+	if err != nil || got.Email != user.Email || got.FirstName != "Ann" || got.LastName != "Lee" {
+		t.Fatalf("get: %+v, %v", got, err)
+	}
+
+	// A ciphertext copied onto another row doesn't decrypt
+	other := uuid.New()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM users WHERE id = $1")).WithArgs(other).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(other, email, firstName, lastName, time.Now(), time.Now()))
+	if _, err := repo.Get(context.Background(), other); err == nil {
+		t.Fatalf("expected decryption error for a moved ciphertext")
+	}
+
+	// Email filters and searches use the blind index; plaintext rows still read
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM users WHERE is_active = true AND deleted_at IS NULL AND email_hash = $1")).
+		WithArgs(hash).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM users")).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(user.ID, email, firstName, lastName, time.Now(), time.Now()).
+			AddRow(other, "old@example.com", "Old", "Row", time.Now(), time.Now()))
+	page, err := repo.List(context.Background(), UserListQuery{Filter: models.UserFilter{Query: "ANN@example.com"}, Limit: 10})
+	if err != nil || len(page.Users) != 2 || page.Users[0].Email != user.Email || page.Users[1].Email != "old@example.com" {
+		t.Fatalf("list: %+v, %v", page, err)
+	}
+
+	for _, filter := range []models.UserFilter{{Query: "ann"}, {Sort: models.UserSortEmail}} {
+		if _, err := repo.List(context.Background(), UserListQuery{Filter: filter, Limit: 10}); !errors.Is(err, apperrors.ErrValidation) {
+			t.Fatalf("%+v: expected validation error, got %v", filter, err)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestPostgresUserRepository_EncryptExisting(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewPostgresUserRepository(db)
+	if _, err := repo.EncryptExisting(context.Background(), 10); err == nil {
+		t.Fatalf("expected error without encryption")
+	}
+
+	encryptor, _ := fieldcrypt.NewEncryptor("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	crypto := &UserEncryption{Encryptor: encryptor, IndexKey: bytes.Repeat([]byte{2}, 32)}
+	repo.SetEncryption(crypto)
+
+	id := uuid.New()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, email, first_name, last_name FROM users WHERE email_hash IS NULL LIMIT $1")).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "first_name", "last_name"}).AddRow(id, "a@x", "A", "X"))
+	var email string
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET email = $1, first_name = $2, last_name = $3, email_hash = $4 WHERE id = $5 AND email_hash IS NULL")).
+		WithArgs(capture{&email}, sqlmock.AnyArg(), sqlmock.AnyArg(), crypto.EmailIndex("a@x"), id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	n, err := repo.EncryptExisting(context.Background(), 10)
+	if err != nil || n != 1 {
+		t.Fatalf("encrypt existing: %d, %v", n, err)
+	}
+	if plaintext, err := encryptor.Decrypt(email, userColumnAD(&models.User{ID: id}, "email")); err != nil || plaintext != "a@x" {
+		t.Fatalf("stored email: %q, %v", plaintext, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// PostgresUserAuditRepository stores the user audit trail in the user_audit table
+type PostgresUserAuditRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresUserAuditRepository(db *sql.DB) *PostgresUserAuditRepository {
+	return &PostgresUserAuditRepository{db: db}
+}
+
+func (r *PostgresUserAuditRepository) Record(ctx context.Context, entry *models.UserAuditEntry) error {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit changes: %w", err)
+	}
+	query := `
+		INSERT INTO user_audit (id, user_id, action, actor_id, request_id, changes, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err = r.db.ExecContext(ctx, query, entry.ID, entry.UserID, entry.Action, entry.ActorID, entry.RequestID, string(changes), entry.CreatedAt)
+	return err
+}
+
+func (r *PostgresUserAuditRepository) List(ctx context.Context, userID uuid.UUID, offset, limit int) ([]models.UserAuditEntry, int, error) {
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM user_audit WHERE user_id = $1`, userID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit entries: %w", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, user_id, action, actor_id, request_id, changes, created_at
+		FROM user_audit WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3
+	`, userID, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	entries := []models.UserAuditEntry{}
+	for rows.Next() {
+		var (
+			entry   models.UserAuditEntry
+			actorID sql.NullString
+			changes string
+		)
+		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.Action, &actorID, &entry.RequestID, &changes, &entry.CreatedAt); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		if actorID.Valid {
+			if id, err := uuid.Parse(actorID.String); err == nil {
+				entry.ActorID = &id
+			}
+		}
+		if err := json.Unmarshal([]byte(changes), &entry.Changes); err != nil {
+			return nil, 0, fmt.Errorf("failed to decode audit changes: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	return entries, total, nil
+}
@@ -0,0 +1,514 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/pagination"
+
+	"github.com/google/uuid"
+)
+
+// PostgresUserRepository stores users in the users table
+type PostgresUserRepository struct {
+	db     *sql.DB
+	reader Reader
+	crypto *UserEncryption
+	stmts  *Statements
+}
+
+func NewPostgresUserRepository(db *sql.DB) *PostgresUserRepository {
+	return &PostgresUserRepository{db: db}
+}
+
+// SetReader routes Get and List to a read replica
+func (r *PostgresUserRepository) SetReader(reader Reader) {
+	r.reader = reader
+}
+
+// readDB returns the pool for reads that tolerate replica lag
+func (r *PostgresUserRepository) readDB() *sql.DB {
+	if r.reader != nil {
+		return r.reader.Reader()
+	}
+	return r.db
+}
+
+// SetStatements prepares the queries of Create, Get and GetPrimary once
+func (r *PostgresUserRepository) SetStatements(stmts *Statements) {
+	r.stmts = stmts
+}
+
+// SetEncryption encrypts the email and names of users written from now on.
+// Plaintext rows stay readable until EncryptExisting rewrites them.
+func (r *PostgresUserRepository) SetEncryption(crypto *UserEncryption) {
+	r.crypto = crypto
+}
+
+func (r *PostgresUserRepository) Create(ctx context.Context, user *models.User) error {
+	if r.crypto != nil {
+		sealed, err := r.crypto.seal(user)
+		if err != nil {
+			return err
+		}
+		query := `
+			INSERT INTO users (id, email, first_name, last_name, email_hash, created_at, updated_at, auth_user_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`
+		_, err = r.stmts.exec(ctx, r.db, query, user.ID, sealed.email, sealed.firstName, sealed.lastName, sealed.emailHash, user.CreatedAt, user.UpdatedAt, user.AuthUserID)
+		return err
+	}
+
+	query := `
+		INSERT INTO users (id, email, first_name, last_name, created_at, updated_at, auth_user_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := r.stmts.exec(ctx, r.db, query, user.ID, user.Email, user.FirstName, user.LastName, user.CreatedAt, user.UpdatedAt, user.AuthUserID)
+	return err
+}
+
+func (r *PostgresUserRepository) Get(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	return r.open(r.getActive(ctx, r.readDB(), id))
+}
+
+func (r *PostgresUserRepository) GetPrimary(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	return r.open(r.getActive(ctx, r.db, id))
+}
+
+// open decrypts a user read from the database
+func (r *PostgresUserRepository) open(user *models.User, err error) (*models.User, error) {
+	if err != nil || r.crypto == nil {
+		return user, err
+	}
+	if err := r.crypto.open(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// getActive reads a user that is neither deactivated nor deleted from db
+func (r *PostgresUserRepository) getActive(ctx context.Context, db *sql.DB, id uuid.UUID) (*models.User, error) {
+	user := &models.User{IsActive: true}
+	query := `SELECT id, email, first_name, last_name, created_at, updated_at FROM users WHERE id = $1 AND is_active = true AND deleted_at IS NULL`
+
+	err := r.stmts.queryRow(ctx, db, query, id).Scan(
+		&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return user, nil
+}
+
+func (r *PostgresUserRepository) Lookup(ctx context.Context, id uuid.UUID, includeDeleted bool) (*models.User, error) {
+	query := `SELECT id, email, first_name, last_name, is_active, created_at, updated_at FROM users WHERE id = $1`
+	if !includeDeleted {
+		query += ` AND deleted_at IS NULL`
+	}
+
+	user := &models.User{}
+	err := r.db.QueryRowContext(ctx, query, id).
+		Scan(&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.IsActive, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return r.open(user, nil)
+}
+
+func (r *PostgresUserRepository) Update(ctx context.Context, user *models.User) error {
+	if r.crypto != nil {
+		sealed, err := r.crypto.seal(user)
+		if err != nil {
+			return err
+		}
+		query := `
+			UPDATE users 
+			SET email = $1, first_name = $2, last_name = $3, email_hash = $4, updated_at = $5
+			WHERE id = $6
+		`
+		_, err = r.db.ExecContext(ctx, query, sealed.email, sealed.firstName, sealed.lastName, sealed.emailHash, user.UpdatedAt, user.ID)
+		return err
+	}
+
+	query := `
+		UPDATE users 
+		SET email = $1, first_name = $2, last_name = $3, updated_at = $4
+		WHERE id = $5
+	`
+	_, err := r.db.ExecContext(ctx, query, user.Email, user.FirstName, user.LastName, user.UpdatedAt, user.ID)
+	return err
+}
+
+func (r *PostgresUserRepository) SoftDelete(ctx context.Context, id uuid.UUID, at time.Time) (bool, error) {
+	query := `UPDATE users SET deleted_at = $1, updated_at = $2 WHERE id = $3 AND deleted_at IS NULL`
+	return changed(r.db.ExecContext(ctx, query, at, at, id))
+}
+
+func (r *PostgresUserRepository) Restore(ctx context.Context, id uuid.UUID, at time.Time) (bool, error) {
+	query := `UPDATE users SET deleted_at = NULL, updated_at = $1 WHERE id = $2 AND deleted_at IS NOT NULL`
+	return changed(r.db.ExecContext(ctx, query, at, id))
+}
+
+func (r *PostgresUserRepository) SetActive(ctx context.Context, id uuid.UUID, active bool, at time.Time) (bool, error) {
+	query := `UPDATE users SET is_active = $1, updated_at = $2 WHERE id = $3 AND is_active <> $4 AND deleted_at IS NULL`
+	return changed(r.db.ExecContext(ctx, query, active, at, id, active))
+}
+
+func (r *PostgresUserRepository) SetOwner(ctx context.Context, id uuid.UUID, authUserID *uuid.UUID, at time.Time) (bool, error) {
+	query := `UPDATE users SET auth_user_id = $1, updated_at = $2 WHERE id = $3 AND deleted_at IS NULL`
+	return changed(r.db.ExecContext(ctx, query, authUserID, at, id))
+}
+
+func (r *PostgresUserRepository) OwnedBy(ctx context.Context, id, authUserID uuid.UUID) (bool, error) {
+	var owned bool
+	query := `SELECT COUNT(*) > 0 FROM users WHERE id = $1 AND auth_user_id = $2 AND deleted_at IS NULL`
+	err := r.db.QueryRowContext(ctx, query, id, authUserID).Scan(&owned)
+	return owned, err
+}
+
+func (r *PostgresUserRepository) List(ctx context.Context, q UserListQuery) (*UserPage, error) {
+	columns := "id, email, first_name, last_name, created_at, updated_at"
+	if q.Filter.IncludeDeleted {
+		columns += ", deleted_at"
+	}
+
+	page := &UserPage{}
+	var err error
+	page.Total, page.More, err = r.list(ctx, q, columns, func(rows *sql.Rows) error {
+		user := models.User{IsActive: true}
+		dest := []interface{}{&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.CreatedAt, &user.UpdatedAt}
+		var deletedAt sql.NullTime
+		if q.Filter.IncludeDeleted {
+			dest = append(dest, &deletedAt)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("failed to scan user: %w", err)
+		}
+		if deletedAt.Valid {
+			user.DeletedAt = &deletedAt.Time
+		}
+		if _, err := r.open(&user, nil); err != nil {
+			return err
+		}
+		page.Users = append(page.Users, user)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if page.More {
+		page.Users = page.Users[:q.Limit]
+	}
+	return page, nil
+}
+
+func (r *PostgresUserRepository) ListIDs(ctx context.Context, q UserListQuery) (*IDPage, error) {
+	page := &IDPage{}
+	var err error
+	page.Total, page.More, err = r.list(ctx, q, "id", func(rows *sql.Rows) error {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return fmt.Errorf("failed to scan user: %w", err)
+		}
+		page.IDs = append(page.IDs, id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if page.More {
+		page.IDs = page.IDs[:q.Limit]
+	}
+	return page, nil
+}
+
+// list counts the users matching q and calls scan with each row of columns
+// of the page, plus one extra row when more users follow
+func (r *PostgresUserRepository) list(ctx context.Context, q UserListQuery, columns string, scan func(rows *sql.Rows) error) (total int, more bool, err error) {
+	db := r.readDB()
+
+	where, args, err := r.userFilterWhere(q.Filter)
+	if err != nil {
+		return 0, false, err
+	}
+	sortColumn, desc, err := r.userFilterOrder(q.Filter)
+	if err != nil {
+		return 0, false, err
+	}
+
+	// Get total count
+	countQuery := `SELECT COUNT(*) FROM users WHERE ` + where
+	if err := db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		return 0, false, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	offset := q.Offset
+	listArgs := append([]interface{}{}, args...)
+	if q.After != nil {
+		where += " AND " + q.After.After(desc, func(value interface{}) string {
+			listArgs = append(listArgs, value)
+			return fmt.Sprintf("$%d", len(listArgs))
+		})
+		offset = 0
+	}
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+
+	// Get users; one extra row tells whether there is a next page
+	query := fmt.Sprintf(`
+		SELECT %s 
+		FROM users 
+		WHERE %s
+		ORDER BY %s %s, id %s 
+		LIMIT $%d OFFSET $%d
+	`, columns, where, sortColumn, direction, direction, len(listArgs)+1, len(listArgs)+2)
+
+	rows, err := db.QueryContext(ctx, query, append(listArgs, q.Limit+1, offset)...)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	n := 0
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return 0, false, err
+		}
+		n++
+	}
+	return total, n > q.Limit, nil
+}
+
+func (r *PostgresUserRepository) GetMany(ctx context.Context, ids []uuid.UUID) ([]models.User, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = id
+	}
+	query := `SELECT id, email, first_name, last_name, is_active, created_at, updated_at, deleted_at FROM users WHERE id IN (` +
+		strings.Join(placeholders, ", ") + `)`
+
+	rows, err := r.readDB().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	users := make([]models.User, 0, len(ids))
+	for rows.Next() {
+		var user models.User
+		var deletedAt sql.NullTime
+		if err := rows.Scan(&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.IsActive, &user.CreatedAt, &user.UpdatedAt, &deletedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		if deletedAt.Valid {
+			user.DeletedAt = &deletedAt.Time
+		}
+		if _, err := r.open(&user, nil); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (r *PostgresUserRepository) ListRange(ctx context.Context, q UserRangeQuery, after *pagination.Cursor, limit int) ([]models.User, error) {
+	conditions := []string{"1 = 1"}
+	var args []interface{}
+	bind := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if q.From != nil {
+		conditions = append(conditions, "created_at >= "+bind(*q.From))
+	}
+	if q.To != nil {
+		conditions = append(conditions, "created_at < "+bind(*q.To))
+	}
+	if after != nil {
+		conditions = append(conditions, after.After(false, bind))
+	}
+	query := fmt.Sprintf(`
+		SELECT id, email, first_name, last_name, is_active, created_at, updated_at, deleted_at
+		FROM users WHERE %s
+		ORDER BY created_at, id
+		LIMIT %s
+	`, strings.Join(conditions, " AND "), bind(limit))
+
+	rows, err := r.readDB().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		var deletedAt sql.NullTime
+		if err := rows.Scan(&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.IsActive, &user.CreatedAt, &user.UpdatedAt, &deletedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		if deletedAt.Valid {
+			user.DeletedAt = &deletedAt.Time
+		}
+		if _, err := r.open(&user, nil); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// EncryptExisting encrypts up to limit users stored before encryption was
+// enabled, i.e. without email_hash, and returns how many it rewrote
+func (r *PostgresUserRepository) EncryptExisting(ctx context.Context, limit int) (int, error) {
+	if r.crypto == nil {
+		return 0, errors.New("user encryption is not enabled")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT id, email, first_name, last_name FROM users WHERE email_hash IS NULL LIMIT $1`, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list plaintext users: %w", err)
+	}
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Email, &user.FirstName, &user.LastName); err != nil {
+			_ = rows.Close()
+			return 0, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to list plaintext users: %w", err)
+	}
+
+	encrypted := 0
+	for i := range users {
+		user := &users[i]
+		if err := r.crypto.open(user); err != nil {
+			return encrypted, err
+		}
+		sealed, err := r.crypto.seal(user)
+		if err != nil {
+			return encrypted, err
+		}
+		query := `UPDATE users SET email = $1, first_name = $2, last_name = $3, email_hash = $4 WHERE id = $5 AND email_hash IS NULL`
+		n, err := affected(r.db.ExecContext(ctx, query, sealed.email, sealed.firstName, sealed.lastName, sealed.emailHash, user.ID))
+		if err != nil {
+			return encrypted, fmt.Errorf("failed to encrypt user %s: %w", user.ID, err)
+		}
+		encrypted += int(n)
+	}
+	return encrypted, nil
+}
+
+// userFilterWhere returns the WHERE clause for filter and its arguments.
+// Placeholders are numbered from $1; each is used once so that the MySQL
+// rebinding to ? stays positional. With encryption, emails are matched
+// through their blind index and names can't be searched.
+func (r *PostgresUserRepository) userFilterWhere(filter models.UserFilter) (string, []interface{}, error) {
+	conditions := []string{"is_active = true"}
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if !filter.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+	if q := strings.TrimSpace(filter.Query); q != "" && r.crypto != nil {
+		if !strings.Contains(q, "@") {
+			return "", nil, apperrors.Validation("q must be a full email address while user data is encrypted")
+		}
+		conditions = append(conditions, "email_hash = "+arg(r.crypto.EmailIndex(q)))
+	} else if q != "" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(q)) + "%"
+		conditions = append(conditions, fmt.Sprintf("(LOWER(email) LIKE %s OR LOWER(first_name) LIKE %s OR LOWER(last_name) LIKE %s)",
+			arg(pattern), arg(pattern), arg(pattern)))
+	}
+	if filter.Email != "" && r.crypto != nil {
+		conditions = append(conditions, "email_hash = "+arg(r.crypto.EmailIndex(filter.Email)))
+	} else if filter.Email != "" {
+		conditions = append(conditions, "email = "+arg(filter.Email))
+	}
+	if !filter.CreatedAfter.IsZero() {
+		conditions = append(conditions, "created_at >= "+arg(filter.CreatedAfter))
+	}
+	if !filter.CreatedBefore.IsZero() {
+		conditions = append(conditions, "created_at < "+arg(filter.CreatedBefore))
+	}
+
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+// likeEscaper escapes LIKE wildcards so user input matches literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// userFilterOrder returns the sort column and direction; id breaks ties so
+// pages are stable
+func (r *PostgresUserRepository) userFilterOrder(filter models.UserFilter) (string, bool, error) {
+	column, desc := "created_at", true
+	switch filter.Sort {
+	case "", models.UserSortCreatedAt:
+	case models.UserSortEmail:
+		if r.crypto != nil {
+			return "", false, apperrors.Validation("sort by email is not available while user data is encrypted")
+		}
+		column, desc = "email", false
+	default:
+		return "", false, apperrors.Validation("sort must be created_at or email")
+	}
+
+	switch filter.Order {
+	case "":
+	case models.SortAsc:
+		desc = false
+	case models.SortDesc:
+		desc = true
+	default:
+		return "", false, apperrors.Validation("order must be asc or desc")
+	}
+
+	return column, desc, nil
+}
+
+// notFound turns sql.ErrNoRows into ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// changed reports whether an UPDATE or DELETE touched any row
+func changed(result sql.Result, err error) (bool, error) {
+	n, err := affected(result, err)
+	return n > 0, err
+}
+
+// affected returns the number of rows an UPDATE or DELETE touched
+func affected(result sql.Result, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,143 @@
+// Package repository holds the storage of users, events and authentication
+// state behind interfaces, so services do not depend on SQL and can be unit
+// tested with in-memory fakes.
+//
+// The Postgres implementations also serve MySQL: the database driver wrapper
+// rebinds their $N placeholders.
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/pagination"
+
+	"github.com/google/uuid"
+)
+
+// ErrNotFound is returned when the requested row does not exist. Services map
+// it to their own not found errors.
+var ErrNotFound = errors.New("record not found")
+
+// Reader selects the pool for read-only queries (database.ReadPool routes
+// them to a replica)
+type Reader interface {
+	Reader() *sql.DB
+}
+
+// UserRepository stores users. Get and List tolerate replica lag; the other
+// methods use the primary.
+type UserRepository interface {
+	Create(ctx context.Context, user *models.User) error
+	// Get returns an active, not deleted user
+	Get(ctx context.Context, id uuid.UUID) (*models.User, error)
+	// GetPrimary is Get for read-modify-write paths
+	GetPrimary(ctx context.Context, id uuid.UUID) (*models.User, error)
+	// Lookup returns a user in any activation state with IsActive set.
+	// Deleted users are only returned with includeDeleted.
+	Lookup(ctx context.Context, id uuid.UUID, includeDeleted bool) (*models.User, error)
+	// Update writes email, names and updated_at
+	Update(ctx context.Context, user *models.User) error
+	// SoftDelete sets deleted_at and reports whether the user was live
+	SoftDelete(ctx context.Context, id uuid.UUID, at time.Time) (bool, error)
+	// Restore clears deleted_at and reports whether the user was deleted
+	Restore(ctx context.Context, id uuid.UUID, at time.Time) (bool, error)
+	// SetActive changes is_active of a not deleted user and reports whether
+	// it changed
+	SetActive(ctx context.Context, id uuid.UUID, active bool, at time.Time) (bool, error)
+	// SetOwner links a not deleted user to the account authUserID, or unlinks
+	// it when nil, and reports whether the user exists
+	SetOwner(ctx context.Context, id uuid.UUID, authUserID *uuid.UUID, at time.Time) (bool, error)
+	// OwnedBy reports whether the not deleted user id is linked to the account
+	// authUserID. The two tables have independent IDs.
+	OwnedBy(ctx context.Context, id, authUserID uuid.UUID) (bool, error)
+	List(ctx context.Context, query UserListQuery) (*UserPage, error)
+	// ListIDs is List returning only the IDs of the page, for callers that
+	// read the users themselves through a cache
+	ListIDs(ctx context.Context, query UserListQuery) (*IDPage, error)
+	// GetMany returns the users with ids in any state and order, with
+	// IsActive and DeletedAt set. Missing ids are left out.
+	GetMany(ctx context.Context, ids []uuid.UUID) ([]models.User, error)
+	// ListRange returns up to limit users in any state created in query's
+	// range after the cursor, oldest first
+	ListRange(ctx context.Context, query UserRangeQuery, after *pagination.Cursor, limit int) ([]models.User, error)
+}
+
+// UserRangeQuery selects users created in [From, To); nil bounds are open
+type UserRangeQuery struct {
+	From *time.Time
+	To   *time.Time
+}
+
+// UserListQuery selects a page of active users
+type UserListQuery struct {
+	Filter models.UserFilter
+	After  *pagination.Cursor // keyset position; Offset is ignored when set
+	Offset int
+	Limit  int
+}
+
+// UserPage is one page of users
+type UserPage struct {
+	Users []models.User
+	Total int  // users matching the filter
+	More  bool // more users follow the page
+}
+
+// EventRepository stores events. Get and List tolerate replica lag.
+type EventRepository interface {
+	// Create stores event as given; encryption of Data is up to the caller
+	Create(ctx context.Context, event *models.Event) error
+	Get(ctx context.Context, id uuid.UUID) (*models.Event, error)
+	// List returns events newest first
+	List(ctx context.Context, query EventListQuery) (*EventPage, error)
+	// ListIDs is List returning only the IDs of the page
+	ListIDs(ctx context.Context, query EventListQuery) (*IDPage, error)
+	// GetMany returns the events with ids in any order; missing ids are
+	// left out
+	GetMany(ctx context.Context, ids []uuid.UUID) ([]models.Event, error)
+	// CountRange counts the events matching query
+	CountRange(ctx context.Context, query EventRangeQuery) (int, error)
+	// ListRange returns up to limit events matching query after the cursor,
+	// oldest first. It reads from the primary.
+	ListRange(ctx context.Context, query EventRangeQuery, after *pagination.Cursor, limit int) ([]models.Event, error)
+}
+
+// EventRangeQuery selects events created in [From, To) with one of Types;
+// zero fields match everything
+type EventRangeQuery struct {
+	From  *time.Time
+	To    *time.Time
+	Types []string
+}
+
+// EventListQuery selects a page of events
+type EventListQuery struct {
+	After  *pagination.Cursor // keyset position; Offset is ignored when set
+	Offset int
+	Limit  int
+}
+
+// EventPage is one page of events
+type EventPage struct {
+	Events []models.Event
+	Total  int  // all events
+	More   bool // more events follow the page
+}
+
+// IDPage is one page of IDs, for lists read through a cache
+type IDPage struct {
+	IDs   []uuid.UUID
+	Total int  // rows matching the query
+	More  bool // more rows follow the page
+}
+
+// UserAuditRepository stores the history of changes to users
+type UserAuditRepository interface {
+	Record(ctx context.Context, entry *models.UserAuditEntry) error
+	// List returns the entries of a user, newest first, and their total
+	List(ctx context.Context, userID uuid.UUID, offset, limit int) ([]models.UserAuditEntry, int, error)
+}
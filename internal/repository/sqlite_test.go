@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/config"
+	"highload-microservice/internal/database"
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// newSQLiteDB returns a migrated SQLite database (the DEV_MODE store), for
+// tests that run the real queries without a database server
+func newSQLiteDB(t *testing.T) *sql.DB {
+	t.Helper()
+	cfg := config.DatabaseConfig{Driver: database.DriverSQLite, Name: filepath.Join(t.TempDir(), "test.db"), MaxOpenConns: 4, MaxIdleConns: 1}
+	db, err := database.NewConnection(cfg, nil)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	dialect, _ := database.NewDialect(database.DriverSQLite)
+	migrator, err := database.NewMigrator(db, dialect)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func TestSQLite_UsersAndEvents(t *testing.T) {
+	ctx := context.Background()
+	db := newSQLiteDB(t)
+	users, events := NewPostgresUserRepository(db), NewPostgresEventRepository(db)
+	events.DisableCopy()
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	user := &models.User{ID: uuid.New(), Email: "dev@example.com", FirstName: "Dev", LastName: "User", CreatedAt: now, UpdatedAt: now}
+	if err := users.Create(ctx, user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	got, err := users.Get(ctx, user.ID)
+	if err != nil || got.Email != user.Email || !got.IsActive || !got.CreatedAt.Equal(now) {
+		t.Fatalf("get user: %+v, %v", got, err)
+	}
+
+	batch := []models.Event{
+		{ID: uuid.New(), UserID: user.ID, Type: "page_view", Data: "a", CreatedAt: now},
+		{ID: uuid.New(), UserID: user.ID, Type: "click", Data: "b", CreatedAt: now.Add(time.Second)},
+	}
+	if err := events.CreateBatch(ctx, batch, nil); err != nil {
+		t.Fatalf("create events: %v", err)
+	}
+	page, err := events.List(ctx, EventListQuery{Limit: 10})
+	if err != nil || page.Total != 2 || len(page.Events) != 2 {
+		t.Fatalf("list events: %+v, %v", page, err)
+	}
+
+	if deleted, err := users.SoftDelete(ctx, user.ID, now); err != nil || !deleted {
+		t.Fatalf("soft delete: %v, %v", deleted, err)
+	}
+	if list, err := users.List(ctx, UserListQuery{Limit: 10}); err != nil || list.Total != 0 {
+		t.Fatalf("deleted user listed: %+v, %v", list, err)
+	}
+}
+
+func TestSQLite_UserOwnership(t *testing.T) {
+	ctx := context.Background()
+	db := newSQLiteDB(t)
+	users := NewPostgresUserRepository(db)
+
+	account := func(email string) uuid.UUID {
+		var id uuid.UUID
+		err := db.QueryRow(`INSERT INTO auth_users (email, first_name, last_name, password_hash, role) VALUES ($1, 'A', 'B', 'x', 'user') RETURNING id`, email).Scan(&id)
+		if err != nil {
+			t.Fatalf("create account: %v", err)
+		}
+		return id
+	}
+	owner, stranger := account("owner@example.com"), account("stranger@example.com")
+
+	// The record's ID collides with the stranger's account ID
+	now := time.Now().UTC()
+	user := &models.User{ID: stranger, Email: "owner@example.com", FirstName: "O", LastName: "W", CreatedAt: now, UpdatedAt: now, AuthUserID: &owner}
+	if err := users.Create(ctx, user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if owned, err := users.OwnedBy(ctx, user.ID, owner); err != nil || !owned {
+		t.Fatalf("owner: owned=%v, %v", owned, err)
+	}
+	if owned, err := users.OwnedBy(ctx, user.ID, stranger); err != nil || owned {
+		t.Fatalf("account with the record's ID: owned=%v, %v", owned, err)
+	}
+
+	if found, err := users.SetOwner(ctx, user.ID, &stranger, now); err != nil || !found {
+		t.Fatalf("set owner: %v, %v", found, err)
+	}
+	if owned, _ := users.OwnedBy(ctx, user.ID, owner); owned {
+		t.Fatalf("previous owner kept access")
+	}
+
+	// Deleting the account unlinks the record
+	if _, err := db.Exec(`DELETE FROM auth_users WHERE id = $1`, stranger); err != nil {
+		t.Fatal(err)
+	}
+	if owned, _ := users.OwnedBy(ctx, user.ID, stranger); owned {
+		t.Fatalf("record still owned by a deleted account")
+	}
+	if found, err := users.SetOwner(ctx, uuid.New(), nil, now); err != nil || found {
+		t.Fatalf("unknown user: found=%v, %v", found, err)
+	}
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+)
+
+// Statements prepares the queries of hot paths (reads by ID, inserts) once
+// per pool and reuses them. database/sql prepares a statement on each
+// connection the first time it runs there, so later calls skip the parse
+// round trip and the server may reuse the plan. A nil *Statements runs
+// queries unprepared.
+//
+// Named statements don't survive connection poolers in transaction mode
+// (PgBouncer), which need them off.
+type Statements struct {
+	mu    sync.RWMutex
+	stmts map[statementKey]*sql.Stmt
+}
+
+// statementKey tells apart the same query on the primary and the replica
+type statementKey struct {
+	db    *sql.DB
+	query string
+}
+
+func NewStatements() *Statements {
+	return &Statements{stmts: make(map[statementKey]*sql.Stmt)}
+}
+
+// prepare returns the statement of query on db, preparing it on first use
+func (s *Statements) prepare(ctx context.Context, db *sql.DB, query string) (*sql.Stmt, error) {
+	key := statementKey{db: db, query: query}
+	s.mu.RLock()
+	stmt, ok := s.stmts[key]
+	s.mu.RUnlock()
+	if ok {
+		return stmt, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stmt, ok := s.stmts[key]; ok {
+		return stmt, nil
+	}
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	s.stmts[key] = stmt
+	return stmt, nil
+}
+
+// queryRow runs a single-row query, prepared if s is set. Queries that fail
+// to prepare run unprepared and report their own error.
+func (s *Statements) queryRow(ctx context.Context, db *sql.DB, query string, args ...interface{}) *sql.Row {
+	if s != nil {
+		if stmt, err := s.prepare(ctx, db, query); err == nil {
+			return stmt.QueryRowContext(ctx, args...)
+		}
+	}
+	return db.QueryRowContext(ctx, query, args...)
+}
+
+// exec runs a statement, prepared if s is set, like queryRow
+func (s *Statements) exec(ctx context.Context, db *sql.DB, query string, args ...interface{}) (sql.Result, error) {
+	if s != nil {
+		if stmt, err := s.prepare(ctx, db, query); err == nil {
+			return stmt.ExecContext(ctx, args...)
+		}
+	}
+	return db.ExecContext(ctx, query, args...)
+}
+
+// Close closes the prepared statements; call it before closing the pools
+func (s *Statements) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for key, stmt := range s.stmts {
+		if err := stmt.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(s.stmts, key)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"highload-microservice/internal/fieldcrypt"
+	"highload-microservice/internal/models"
+)
+
+// UserEncryption encrypts the email and names of users at rest. Emails get a
+// blind index, email_hash, so that lookups by email and its unique index keep
+// working on ciphertexts.
+type UserEncryption struct {
+	Encryptor *fieldcrypt.Encryptor
+	// IndexKey is the HMAC key of the blind index. Unlike the key ring it
+	// can't be rotated without rebuilding email_hash.
+	IndexKey []byte
+}
+
+// EmailIndex returns the blind index of email. Emails are compared case
+// insensitively, like logins.
+func (e *UserEncryption) EmailIndex(email string) string {
+	mac := hmac.New(sha256.New, e.IndexKey)
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sealedUser is the at-rest form of the personal data of a user
+type sealedUser struct {
+	email, firstName, lastName string
+	emailHash                  string
+}
+
+// seal encrypts the personal data of user. Each column is bound to the user
+// ID and its name, so ciphertexts can't be moved between rows or columns.
+func (e *UserEncryption) seal(user *models.User) (*sealedUser, error) {
+	sealed := &sealedUser{emailHash: e.EmailIndex(user.Email)}
+	for _, field := range []struct {
+		column string
+		value  string
+		dest   *string
+	}{
+		{"email", user.Email, &sealed.email},
+		{"first_name", user.FirstName, &sealed.firstName},
+		{"last_name", user.LastName, &sealed.lastName},
+	} {
+		ciphertext, err := e.Encryptor.Encrypt(field.value, userColumnAD(user, field.column))
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt %s: %w", field.column, err)
+		}
+		*field.dest = ciphertext
+	}
+	return sealed, nil
+}
+
+// open decrypts the personal data of user in place. Rows written before
+// encryption was enabled are plaintext and are left as they are.
+func (e *UserEncryption) open(user *models.User) error {
+	for _, field := range []struct {
+		column string
+		value  *string
+	}{
+		{"email", &user.Email},
+		{"first_name", &user.FirstName},
+		{"last_name", &user.LastName},
+	} {
+		plaintext, err := e.Encryptor.Decrypt(*field.value, userColumnAD(user, field.column))
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s of user %s: %w", field.column, user.ID, err)
+		}
+		*field.value = plaintext
+	}
+	return nil
+}
+
+func userColumnAD(user *models.User, column string) []byte {
+	return append(user.ID[:len(user.ID):len(user.ID)], column...)
+}
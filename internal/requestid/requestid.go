@@ -0,0 +1,51 @@
+// Package requestid carries the per-request correlation ID through contexts,
+// logs, Kafka messages, HTTP responses and outbound HTTP calls.
+package requestid
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Header is the HTTP and Kafka header carrying the request ID
+const Header = "X-Request-ID"
+
+// maxLength bounds client-supplied IDs so they can't bloat logs and headers
+const maxLength = 128
+
+type contextKey struct{}
+
+// New returns a time-ordered UUIDv7 request ID
+func New() string {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return uuid.NewString()
+	}
+	return id.String()
+}
+
+// NewContext returns a copy of ctx carrying the request ID
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID stored in ctx, or ""
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Valid reports whether a client-supplied ID is safe to propagate
+// (bounded length, no whitespace or control characters)
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, r := range id {
+		if r <= ' ' || r > '~' || r == '"' || r == '\\' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package requestid
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestNew_IsUniqueUUIDv7(t *testing.T) {
+	a, b := New(), New()
+	if a == b {
+		t.Fatalf("expected unique IDs")
+	}
+	parsed, err := uuid.Parse(a)
+	if err != nil || parsed.Version() != 7 {
+		t.Fatalf("expected UUIDv7, got %q (%v)", a, err)
+	}
+}
+
+func TestContextRoundTrip(t *testing.T) {
+	if FromContext(context.Background()) != "" {
+		t.Fatalf("expected empty ID")
+	}
+	if got := FromContext(NewContext(context.Background(), "abc")); got != "abc" {
+		t.Fatalf("expected abc, got %q", got)
+	}
+}
+
+func TestValid(t *testing.T) {
+	for _, id := range []string{"fixed-id", New(), "req_0123"} {
+		if !Valid(id) {
+			t.Fatalf("expected %q to be valid", id)
+		}
+	}
+	for _, id := range []string{"", "a b", "line\nbreak", `quote"`, strings.Repeat("x", 200)} {
+		if Valid(id) {
+			t.Fatalf("expected %q to be invalid", id)
+		}
+	}
+}
+
+func TestTraceParent(t *testing.T) {
+	if TraceParent(context.Background()) != "" {
+		t.Fatalf("expected no traceparent without a trace")
+	}
+
+	incoming := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx := NewTraceContext(NewContext(context.Background(), New()), incoming)
+	header := TraceParent(ctx)
+	parts := strings.Split(header, "-")
+	if len(parts) != 4 || parts[1] != "4bf92f3577b34da6a3ce929d0e0e4736" || parts[2] == "00f067aa0ba902b7" {
+		t.Fatalf("expected the incoming trace with a new span, got %q", header)
+	}
+
+	// Without a valid incoming header the trace is the request ID
+	id := uuid.New()
+	ctx = NewTraceContext(NewContext(context.Background(), id.String()), "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+	if got := TraceID(ctx); got != strings.ReplaceAll(id.String(), "-", "") {
+		t.Fatalf("expected the request ID as trace ID, got %q", got)
+	}
+}
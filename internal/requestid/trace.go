@@ -0,0 +1,66 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// TraceHeader is the W3C Trace Context header propagated to outbound calls
+const TraceHeader = "traceparent"
+
+type traceKey struct{}
+
+// NewTraceContext returns a copy of ctx continuing the trace of an incoming
+// traceparent header. Invalid headers are ignored.
+func NewTraceContext(ctx context.Context, traceparent string) context.Context {
+	traceID, ok := parseTraceParent(traceparent)
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, traceKey{}, traceID)
+}
+
+// TraceID returns the trace ID of ctx: the one of the incoming traceparent,
+// else the request ID when it is a UUID (as generated ones are), else ""
+func TraceID(ctx context.Context) string {
+	if id, ok := ctx.Value(traceKey{}).(string); ok {
+		return id
+	}
+	if id, err := uuid.Parse(FromContext(ctx)); err == nil && id != uuid.Nil {
+		return hex.EncodeToString(id[:])
+	}
+	return ""
+}
+
+// TraceParent returns the traceparent header of an outbound call made in
+// ctx, with a new span ID, or "" when ctx carries no trace
+func TraceParent(ctx context.Context) string {
+	traceID := TraceID(ctx)
+	if traceID == "" {
+		return ""
+	}
+	var span [8]byte
+	_, _ = rand.Read(span[:])
+	return "00-" + traceID + "-" + hex.EncodeToString(span[:]) + "-01"
+}
+
+// parseTraceParent returns the trace ID of a version 00 traceparent
+func parseTraceParent(header string) (string, bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return "", false
+	}
+	for _, part := range parts[1:] {
+		if _, err := hex.DecodeString(part); err != nil || part != strings.ToLower(part) {
+			return "", false
+		}
+	}
+	if strings.Trim(parts[1], "0") == "" || strings.Trim(parts[2], "0") == "" {
+		return "", false
+	}
+	return parts[1], true
+}
@@ -0,0 +1,203 @@
+// Package resilience guards calls to the service's dependencies with circuit
+// breakers. While a dependency keeps failing its breaker is open and calls
+// fail at once with ErrOpen, instead of each request waiting for a timeout
+// and piling more load on a dependency that is trying to recover.
+package resilience
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"highload-microservice/internal/metrics"
+)
+
+// ErrOpen is returned instead of calling a dependency whose breaker is open
+var ErrOpen = errors.New("circuit breaker open")
+
+// ErrAbandoned may be passed to done for an admitted call that was given up
+// before it reached the dependency. Like a cancelled context, it counts
+// neither as a success nor as a failure.
+var ErrAbandoned = errors.New("call abandoned")
+
+// State is the state of a breaker
+type State int
+
+const (
+	// StateClosed lets every call through
+	StateClosed State = iota
+	// StateOpen rejects every call until the open timeout has passed
+	StateOpen
+	// StateHalfOpen lets a few probe calls through to test the dependency
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// Config tunes a Breaker
+type Config struct {
+	// FailureThreshold is the number of consecutive failures that opens the
+	// breaker. Defaults to 5.
+	FailureThreshold int
+	// OpenTimeout is how long calls are rejected before probes are let
+	// through. Defaults to 30s.
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of probes that must succeed to close the
+	// breaker again. Defaults to 1.
+	HalfOpenRequests int
+	// Timeout bounds calls made with Execute; 0 leaves the caller's deadline
+	Timeout time.Duration
+}
+
+// Breaker is a circuit breaker for one dependency. The state is exported in
+// the circuit_breaker_state metric.
+type Breaker struct {
+	name string
+	cfg  Config
+
+	mu        sync.Mutex
+	state     State
+	failures  int       // consecutive failures while closed
+	probes    int       // probes in flight while half open
+	successes int       // successful probes while half open
+	openedAt  time.Time // when the breaker last opened
+	// generation changes on every transition, so that calls admitted in an
+	// earlier state do not count towards the current one
+	generation uint64
+
+	now func() time.Time
+}
+
+// New creates a closed breaker. name labels its metrics.
+func New(name string, cfg Config) *Breaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = 30 * time.Second
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 1
+	}
+	metrics.SetCircuitBreakerState(name, int(StateClosed))
+	return &Breaker{name: name, cfg: cfg, now: time.Now}
+}
+
+// Name returns the name of the breaker
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State returns the current state. An open breaker whose timeout has passed
+// is reported as half open, since the next call will probe.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.cfg.OpenTimeout {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// Allow admits a call, or returns ErrOpen. The caller must pass the outcome
+// of an admitted call to done; errors that do not mean the dependency is
+// unhealthy (a missing key, a constraint violation) should be passed as nil.
+// A cancelled context is not held against the dependency either.
+func (b *Breaker) Allow() (done func(err error), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen {
+		if b.now().Sub(b.openedAt) < b.cfg.OpenTimeout {
+			metrics.CircuitBreakerRejected(b.name)
+			return nil, ErrOpen
+		}
+		b.transition(StateHalfOpen)
+	}
+	if b.state == StateHalfOpen {
+		if b.probes >= b.cfg.HalfOpenRequests {
+			metrics.CircuitBreakerRejected(b.name)
+			return nil, ErrOpen
+		}
+		b.probes++
+	}
+
+	generation := b.generation
+	return func(err error) { b.record(generation, err) }, nil
+}
+
+// Execute calls fn unless the breaker is open, bounding it by the configured
+// timeout. Every error of fn counts as a failure.
+func (b *Breaker) Execute(ctx context.Context, fn func(ctx context.Context) error) error {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	if b.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.cfg.Timeout)
+		defer cancel()
+	}
+	err = fn(ctx)
+	done(err)
+	return err
+}
+
+func (b *Breaker) record(generation uint64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation != b.generation {
+		return
+	}
+	neutral := errors.Is(err, ErrAbandoned) || errors.Is(err, context.Canceled)
+	if neutral {
+		if b.state == StateHalfOpen {
+			b.probes--
+		}
+		return
+	}
+	failed := err != nil
+
+	switch b.state {
+	case StateClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.cfg.FailureThreshold {
+			b.transition(StateOpen)
+		}
+	case StateHalfOpen:
+		b.probes--
+		if failed {
+			b.transition(StateOpen)
+			return
+		}
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenRequests {
+			b.transition(StateClosed)
+		}
+	}
+}
+
+// transition moves to state and resets the counters. Callers hold mu.
+func (b *Breaker) transition(state State) {
+	b.state = state
+	b.failures, b.probes, b.successes = 0, 0, 0
+	b.generation++
+	if state == StateOpen {
+		b.openedAt = b.now()
+	}
+	metrics.SetCircuitBreakerState(b.name, int(state))
+}
@@ -0,0 +1,100 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errDown = errors.New("connection refused")
+
+func TestBreaker_OpensAndRecovers(t *testing.T) {
+	now := time.Now()
+	b := New("test", Config{FailureThreshold: 3, OpenTimeout: time.Minute, HalfOpenRequests: 2})
+	b.now = func() time.Time { return now }
+	fail := func(context.Context) error { return errDown }
+	ok := func(context.Context) error { return nil }
+	ctx := context.Background()
+
+	// A success resets the count of consecutive failures
+	_ = b.Execute(ctx, fail)
+	_ = b.Execute(ctx, fail)
+	_ = b.Execute(ctx, ok)
+	_ = b.Execute(ctx, fail)
+	_ = b.Execute(ctx, fail)
+	if b.State() != StateClosed {
+		t.Fatalf("want closed after non-consecutive failures, got %s", b.State())
+	}
+	_ = b.Execute(ctx, fail)
+	if b.State() != StateOpen {
+		t.Fatalf("want open, got %s", b.State())
+	}
+
+	called := false
+	if err := b.Execute(ctx, func(context.Context) error { called = true; return nil }); !errors.Is(err, ErrOpen) || called {
+		t.Fatalf("want ErrOpen without a call, got %v (called %v)", err, called)
+	}
+
+	// After the timeout probes are let through; a failed probe opens it again
+	now = now.Add(time.Minute)
+	if b.State() != StateHalfOpen {
+		t.Fatalf("want half open, got %s", b.State())
+	}
+	if err := b.Execute(ctx, fail); !errors.Is(err, errDown) {
+		t.Fatalf("want the probe to run, got %v", err)
+	}
+	if b.State() != StateOpen {
+		t.Fatalf("want open after a failed probe, got %s", b.State())
+	}
+
+	// Only HalfOpenRequests probes run at a time, and all must succeed
+	now = now.Add(time.Minute)
+	done1, err1 := b.Allow()
+	done2, err2 := b.Allow()
+	if err1 != nil || err2 != nil {
+		t.Fatalf("want two probes admitted, got %v and %v", err1, err2)
+	}
+	if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Fatalf("want a third probe rejected, got %v", err)
+	}
+	done1(nil)
+	if b.State() != StateHalfOpen {
+		t.Fatalf("want half open after one probe, got %s", b.State())
+	}
+	done2(nil)
+	if b.State() != StateClosed {
+		t.Fatalf("want closed, got %s", b.State())
+	}
+}
+
+func TestBreaker_IgnoresCanceledAndStaleCalls(t *testing.T) {
+	b := New("test", Config{FailureThreshold: 1, OpenTimeout: time.Minute})
+	ctx := context.Background()
+
+	for _, err := range []error{context.Canceled, ErrAbandoned} {
+		_ = b.Execute(ctx, func(context.Context) error { return err })
+	}
+	if b.State() != StateClosed {
+		t.Fatalf("want closed, got %s", b.State())
+	}
+
+	// A call admitted before the breaker opened does not close it
+	slow, _ := b.Allow()
+	_ = b.Execute(ctx, func(context.Context) error { return errDown })
+	slow(nil)
+	if b.State() != StateOpen {
+		t.Fatalf("want open, got %s", b.State())
+	}
+}
+
+func TestBreaker_Timeout(t *testing.T) {
+	b := New("test", Config{Timeout: 10 * time.Millisecond})
+	err := b.Execute(context.Background(), func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want a deadline error, got %v", err)
+	}
+}
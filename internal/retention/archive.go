@@ -0,0 +1,38 @@
+package retention
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"highload-microservice/internal/models"
+)
+
+// Archiver stores archives of deleted events in cold storage. Implemented
+// by the objectstore backends.
+type Archiver interface {
+	// Put stores data under key and returns once it is durable; events are
+	// deleted only after their archive was put
+	Put(ctx context.Context, key string, data []byte) error
+	// Location describes where key is stored, for run reports
+	Location(key string) string
+}
+
+// encodeEvents returns events as gzip-compressed NDJSON. Payloads stay as
+// stored, so encrypted ones stay encrypted.
+func encodeEvents(events []models.Event) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			return nil, fmt.Errorf("failed to encode event %s: %w", event.ID, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress archive: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,255 @@
+// Package retention bounds the events table. A scheduled job (or an admin)
+// starts a run that moves events older than the retention period to cold
+// storage: batch by batch, the oldest events are written to an archive and
+// deleted once the archive is stored. Runs are recorded in
+// event_retention_runs.
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Run states
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// What started a run
+const (
+	SourceSchedule = "schedule"
+	SourceManual   = "manual"
+)
+
+const (
+	defaultBatchSize = 1000
+	defaultRunsLimit = 20
+	maxRunsLimit     = 100
+)
+
+// Run reports a retention run
+type Run struct {
+	ID              uuid.UUID  `json:"id"`
+	Status          string     `json:"status"`
+	Source          string     `json:"source"`
+	StartedBy       *uuid.UUID `json:"started_by,omitempty"`
+	Cutoff          time.Time  `json:"cutoff"` // events created before it are removed
+	Archived        int64      `json:"archived"`
+	Deleted         int64      `json:"deleted"`
+	Archives        int        `json:"archives"`                   // archive objects written
+	ArchiveLocation string     `json:"archive_location,omitempty"` // prefix of the run's archives
+	Error           string     `json:"error,omitempty"`
+	StartedAt       time.Time  `json:"started_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+}
+
+// Config sets the retention period and the size of a run
+type Config struct {
+	MaxAge    time.Duration // events older than this are removed
+	BatchSize int           // events per archive and DELETE
+	MaxEvents int           // events removed per run; 0 means no limit
+}
+
+// Service runs retention. Without an archiver events are deleted without
+// being archived. Cached copies of deleted events expire on their own.
+type Service struct {
+	store    Store
+	archiver Archiver
+	cfg      Config
+	logger   *logrus.Logger
+
+	// One run at a time per instance; the scheduler's claimer keeps
+	// replicas from running the same slot
+	running atomic.Bool
+
+	// Manual runs continue after the request that started them
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewService(store Store, archiver Archiver, cfg Config, logger *logrus.Logger) *Service {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Service{store: store, archiver: archiver, cfg: cfg, logger: logger, ctx: ctx, cancel: cancel}
+}
+
+// RunScheduled runs retention to completion; it is the scheduler job
+func (s *Service) RunScheduled(ctx context.Context) error {
+	run, err := s.begin(ctx, SourceSchedule, nil)
+	if err != nil {
+		return err
+	}
+	defer s.running.Store(false)
+	return s.execute(ctx, run)
+}
+
+// Start starts a run in the background and returns it; poll GetRun for
+// its progress
+func (s *Service) Start(ctx context.Context, startedBy *uuid.UUID) (*Run, error) {
+	run, err := s.begin(ctx, SourceManual, startedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	started := *run
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.running.Store(false)
+		_ = s.execute(s.ctx, run)
+	}()
+	return &started, nil
+}
+
+// Stop cancels background runs and waits for them to record where they
+// stopped
+func (s *Service) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *Service) GetRun(ctx context.Context, id uuid.UUID) (*Run, error) {
+	run, err := s.store.GetRun(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, apperrors.NotFound("retention run not found")
+	}
+	if err != nil {
+		return nil, apperrors.FromDB(err, "failed to get retention run")
+	}
+	return run, nil
+}
+
+// ListRuns returns the latest runs, newest first
+func (s *Service) ListRuns(ctx context.Context, limit int) ([]Run, error) {
+	if limit <= 0 {
+		limit = defaultRunsLimit
+	}
+	runs, err := s.store.ListRuns(ctx, min(limit, maxRunsLimit))
+	if err != nil {
+		return nil, apperrors.FromDB(err, "failed to list retention runs")
+	}
+	return runs, nil
+}
+
+// begin records a new run unless one is in progress on this instance
+func (s *Service) begin(ctx context.Context, source string, startedBy *uuid.UUID) (*Run, error) {
+	if !s.running.CompareAndSwap(false, true) {
+		return nil, apperrors.New(apperrors.ErrConflict, "a retention run is already in progress")
+	}
+
+	now := time.Now().UTC()
+	run := &Run{
+		ID:        uuid.New(),
+		Status:    StatusRunning,
+		Source:    source,
+		StartedBy: startedBy,
+		Cutoff:    now.Add(-s.cfg.MaxAge),
+		StartedAt: now,
+		UpdatedAt: now,
+	}
+	if s.archiver != nil {
+		run.ArchiveLocation = s.archiver.Location(archivePrefix(run))
+	}
+	if err := s.store.CreateRun(ctx, run); err != nil {
+		s.running.Store(false)
+		return nil, apperrors.FromDB(err, "failed to start retention run")
+	}
+	s.logger.Infof("Event retention run %s started (%s): removing events created before %s", run.ID, source, run.Cutoff.Format(time.RFC3339))
+	return run, nil
+}
+
+// execute archives and deletes batches of old events until none are left or
+// the run's limit is reached, then records the outcome
+func (s *Service) execute(ctx context.Context, run *Run) error {
+	err := s.removeOld(ctx, run)
+
+	now := time.Now().UTC()
+	run.UpdatedAt, run.FinishedAt = now, &now
+	run.Status = StatusCompleted
+	if err != nil {
+		run.Status, run.Error = StatusFailed, err.Error()
+	}
+	// Recorded even if ctx was cancelled, so the run doesn't stay running
+	saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	if saveErr := s.store.UpdateRun(saveCtx, run); saveErr != nil {
+		s.logger.Errorf("Failed to record retention run %s: %v", run.ID, saveErr)
+	}
+
+	if err != nil {
+		s.logger.Errorf("Event retention run %s failed after deleting %d events: %v", run.ID, run.Deleted, err)
+		return err
+	}
+	s.logger.Infof("Event retention run %s completed: %d events archived, %d deleted", run.ID, run.Archived, run.Deleted)
+	return nil
+}
+
+func (s *Service) removeOld(ctx context.Context, run *Run) error {
+	for s.cfg.MaxEvents <= 0 || run.Deleted < int64(s.cfg.MaxEvents) {
+		limit := s.cfg.BatchSize
+		if s.cfg.MaxEvents > 0 {
+			limit = min(limit, s.cfg.MaxEvents-int(run.Deleted))
+		}
+		events, err := s.store.OldEvents(ctx, run.Cutoff, limit)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		if s.archiver != nil {
+			data, err := encodeEvents(events)
+			if err != nil {
+				return err
+			}
+			key := fmt.Sprintf("%s%05d.ndjson.gz", archivePrefix(run), run.Archives+1)
+			if err := s.archiver.Put(ctx, key, data); err != nil {
+				return fmt.Errorf("failed to archive events: %w", err)
+			}
+			run.Archives++
+			run.Archived += int64(len(events))
+		}
+
+		ids := make([]uuid.UUID, len(events))
+		for i, event := range events {
+			ids[i] = event.ID
+		}
+		deleted, err := s.store.DeleteEvents(ctx, ids)
+		if err != nil {
+			return err
+		}
+		run.Deleted += deleted
+
+		// Progress is best effort; the outcome is recorded at the end
+		run.UpdatedAt = time.Now().UTC()
+		if err := s.store.UpdateRun(ctx, run); err != nil {
+			s.logger.Warnf("Failed to record progress of retention run %s: %v", run.ID, err)
+		}
+		if len(events) < limit {
+			return nil
+		}
+	}
+	return nil
+}
+
+// archivePrefix is where the archives of run are stored:
+// events/<year>/<month>/<day>/<run id>/
+func archivePrefix(run *Run) string {
+	return fmt.Sprintf("events/%s/%s/", run.StartedAt.Format("2006/01/02"), run.ID)
+}
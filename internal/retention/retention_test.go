@@ -0,0 +1,245 @@
+package retention
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/objectstore"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// memoryStore keeps events and runs in memory
+type memoryStore struct {
+	mu        sync.Mutex
+	events    []models.Event
+	runs      map[uuid.UUID]Run
+	deleteErr error
+}
+
+func newMemoryStore(events ...models.Event) *memoryStore {
+	return &memoryStore{events: events, runs: map[uuid.UUID]Run{}}
+}
+
+func (m *memoryStore) OldEvents(_ context.Context, cutoff time.Time, limit int) ([]models.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var old []models.Event
+	for _, event := range m.events {
+		if event.CreatedAt.Before(cutoff) {
+			old = append(old, event)
+		}
+	}
+	sort.Slice(old, func(i, j int) bool { return old[i].CreatedAt.Before(old[j].CreatedAt) })
+	return old[:min(limit, len(old))], nil
+}
+
+func (m *memoryStore) DeleteEvents(_ context.Context, ids []uuid.UUID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.deleteErr != nil {
+		return 0, m.deleteErr
+	}
+	remove := map[uuid.UUID]bool{}
+	for _, id := range ids {
+		remove[id] = true
+	}
+	kept := m.events[:0]
+	for _, event := range m.events {
+		if !remove[event.ID] {
+			kept = append(kept, event)
+		}
+	}
+	deleted := int64(len(m.events) - len(kept))
+	m.events = kept
+	return deleted, nil
+}
+
+func (m *memoryStore) CreateRun(_ context.Context, run *Run) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runs[run.ID] = *run
+	return nil
+}
+
+func (m *memoryStore) UpdateRun(ctx context.Context, run *Run) error {
+	return m.CreateRun(ctx, run)
+}
+
+func (m *memoryStore) GetRun(_ context.Context, id uuid.UUID) (*Run, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	run, ok := m.runs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &run, nil
+}
+
+func (m *memoryStore) ListRuns(_ context.Context, limit int) ([]Run, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	runs := []Run{}
+	for _, run := range m.runs {
+		runs = append(runs, run)
+	}
+	return runs[:min(limit, len(runs))], nil
+}
+
+func (m *memoryStore) remaining() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.events)
+}
+
+func eventsAged(ages ...time.Duration) []models.Event {
+	events := make([]models.Event, len(ages))
+	for i, age := range ages {
+		events[i] = models.Event{ID: uuid.New(), UserID: uuid.New(), Type: "order_paid", Data: `{"n":1}`, CreatedAt: time.Now().Add(-age)}
+	}
+	return events
+}
+
+// readArchive decodes a gzip NDJSON archive
+func readArchive(t *testing.T, path string) []models.Event {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	var events []models.Event
+	scanner := bufio.NewScanner(zr)
+	for scanner.Scan() {
+		var event models.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("decode archived event: %v", err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestService_RunScheduledArchivesAndDeletes(t *testing.T) {
+	day := 24 * time.Hour
+	store := newMemoryStore(eventsAged(40*day, 35*day, 31*day, 10*day, time.Hour)...)
+	dir := t.TempDir()
+	archiver, err := objectstore.NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	s := NewService(store, archiver, Config{MaxAge: 30 * day, BatchSize: 2}, logrus.New())
+
+	if err := s.RunScheduled(context.Background()); err != nil {
+		t.Fatalf("RunScheduled: %v", err)
+	}
+	if got := store.remaining(); got != 2 {
+		t.Errorf("remaining events = %d, want 2", got)
+	}
+
+	runs, _ := s.ListRuns(context.Background(), 0)
+	if len(runs) != 1 {
+		t.Fatalf("runs = %d, want 1", len(runs))
+	}
+	run := runs[0]
+	if run.Status != StatusCompleted || run.Source != SourceSchedule || run.FinishedAt == nil {
+		t.Errorf("run = %+v, want a completed scheduled run", run)
+	}
+	if run.Archived != 3 || run.Deleted != 3 || run.Archives != 2 {
+		t.Errorf("archived/deleted/archives = %d/%d/%d, want 3/3/2", run.Archived, run.Deleted, run.Archives)
+	}
+	if !strings.HasPrefix(run.ArchiveLocation, "file://") {
+		t.Errorf("archive location = %q", run.ArchiveLocation)
+	}
+
+	prefix := filepath.Join(dir, filepath.FromSlash(archivePrefix(&run)))
+	first := readArchive(t, filepath.Join(prefix, "00001.ndjson.gz"))
+	second := readArchive(t, filepath.Join(prefix, "00002.ndjson.gz"))
+	if len(first) != 2 || len(second) != 1 {
+		t.Fatalf("archives hold %d and %d events, want 2 and 1", len(first), len(second))
+	}
+	if !first[0].CreatedAt.Before(first[1].CreatedAt) || first[0].Data != `{"n":1}` {
+		t.Errorf("first archive = %+v, want the oldest events as stored", first)
+	}
+}
+
+func TestService_MaxEventsLimitsRun(t *testing.T) {
+	store := newMemoryStore(eventsAged(5*time.Hour, 4*time.Hour, 3*time.Hour, 2*time.Hour)...)
+	s := NewService(store, nil, Config{MaxAge: time.Hour, BatchSize: 10, MaxEvents: 3}, logrus.New())
+
+	if err := s.RunScheduled(context.Background()); err != nil {
+		t.Fatalf("RunScheduled: %v", err)
+	}
+	if got := store.remaining(); got != 1 {
+		t.Errorf("remaining events = %d, want 1", got)
+	}
+	runs, _ := s.ListRuns(context.Background(), 0)
+	if runs[0].Deleted != 3 || runs[0].Archived != 0 || runs[0].ArchiveLocation != "" {
+		t.Errorf("run = %+v, want 3 events deleted without archives", runs[0])
+	}
+}
+
+func TestService_FailedRunIsRecorded(t *testing.T) {
+	store := newMemoryStore(eventsAged(2 * time.Hour)...)
+	store.deleteErr = errors.New("connection reset")
+	s := NewService(store, nil, Config{MaxAge: time.Hour}, logrus.New())
+
+	if err := s.RunScheduled(context.Background()); err == nil {
+		t.Fatal("expected the delete error")
+	}
+	runs, _ := s.ListRuns(context.Background(), 0)
+	if runs[0].Status != StatusFailed || !strings.Contains(runs[0].Error, "connection reset") {
+		t.Errorf("run = %+v, want failed with the error", runs[0])
+	}
+
+	// The guard is released after a failure
+	store.deleteErr = nil
+	if err := s.RunScheduled(context.Background()); err != nil {
+		t.Errorf("second run: %v", err)
+	}
+}
+
+func TestService_OneRunAtATime(t *testing.T) {
+	s := NewService(newMemoryStore(), nil, Config{MaxAge: time.Hour}, logrus.New())
+	s.running.Store(true)
+
+	if _, err := s.Start(context.Background(), nil); !errors.Is(err, apperrors.ErrConflict) {
+		t.Errorf("Start while running: err = %v, want ErrConflict", err)
+	}
+	s.running.Store(false)
+
+	callerID := uuid.New()
+	run, err := s.Start(context.Background(), &callerID)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	s.Stop()
+
+	got, err := s.GetRun(context.Background(), run.ID)
+	if err != nil {
+		t.Fatalf("GetRun: %v", err)
+	}
+	if got.Source != SourceManual || got.StartedBy == nil || *got.StartedBy != callerID || got.Status != StatusCompleted {
+		t.Errorf("run = %+v, want a completed manual run started by the caller", got)
+	}
+	if _, err := s.GetRun(context.Background(), uuid.New()); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("GetRun of an unknown run: err = %v, want ErrNotFound", err)
+	}
+}
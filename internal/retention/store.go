@@ -0,0 +1,168 @@
+package retention
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// ErrNotFound is returned for unknown runs
+var ErrNotFound = errors.New("retention run not found")
+
+// Store reads and deletes old events and records retention runs
+type Store interface {
+	// OldEvents returns up to limit of the oldest events created before cutoff
+	OldEvents(ctx context.Context, cutoff time.Time, limit int) ([]models.Event, error)
+	// DeleteEvents deletes events by ID and returns how many were deleted
+	DeleteEvents(ctx context.Context, ids []uuid.UUID) (int64, error)
+
+	CreateRun(ctx context.Context, run *Run) error
+	UpdateRun(ctx context.Context, run *Run) error
+	GetRun(ctx context.Context, id uuid.UUID) (*Run, error)
+	// ListRuns returns the latest runs, newest first
+	ListRuns(ctx context.Context, limit int) ([]Run, error)
+}
+
+// SQLStore works on the events and event_retention_runs tables
+type SQLStore struct {
+	db *sql.DB
+}
+
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+func (s *SQLStore) OldEvents(ctx context.Context, cutoff time.Time, limit int) ([]models.Event, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, type, data, created_at FROM events
+		WHERE created_at < $1
+		ORDER BY created_at, id
+		LIMIT $2`, cutoff, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read old events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.Event
+	for rows.Next() {
+		var event models.Event
+		if err := rows.Scan(&event.ID, &event.UserID, &event.Type, &event.Data, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (s *SQLStore) DeleteEvents(ctx context.Context, ids []uuid.UUID) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = id
+	}
+	result, err := s.db.ExecContext(ctx, `DELETE FROM events WHERE id IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete events: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+func (s *SQLStore) CreateRun(ctx context.Context, run *Run) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO event_retention_runs
+			(id, status, source, started_by, cutoff, archived, deleted, archives, archive_location, error, started_at, updated_at, finished_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+		run.ID, run.Status, run.Source, nullableID(run.StartedBy), run.Cutoff, run.Archived, run.Deleted, run.Archives,
+		run.ArchiveLocation, run.Error, run.StartedAt, run.UpdatedAt, run.FinishedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create retention run: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) UpdateRun(ctx context.Context, run *Run) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE event_retention_runs
+		SET status = $1, archived = $2, deleted = $3, archives = $4, error = $5, updated_at = $6, finished_at = $7
+		WHERE id = $8`,
+		run.Status, run.Archived, run.Deleted, run.Archives, run.Error, run.UpdatedAt, run.FinishedAt, run.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update retention run: %w", err)
+	}
+	return nil
+}
+
+const runColumns = `id, status, source, started_by, cutoff, archived, deleted, archives, archive_location, error, started_at, updated_at, finished_at`
+
+func (s *SQLStore) GetRun(ctx context.Context, id uuid.UUID) (*Run, error) {
+	run, err := scanRun(s.db.QueryRowContext(ctx, `SELECT `+runColumns+` FROM event_retention_runs WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get retention run: %w", err)
+	}
+	return run, nil
+}
+
+func (s *SQLStore) ListRuns(ctx context.Context, limit int) ([]Run, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+runColumns+` FROM event_retention_runs ORDER BY started_at DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list retention runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []Run{}
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan retention run: %w", err)
+		}
+		runs = append(runs, *run)
+	}
+	return runs, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRun(row rowScanner) (*Run, error) {
+	var (
+		run        Run
+		startedBy  sql.NullString
+		finishedAt sql.NullTime
+	)
+	err := row.Scan(&run.ID, &run.Status, &run.Source, &startedBy, &run.Cutoff, &run.Archived, &run.Deleted, &run.Archives,
+		&run.ArchiveLocation, &run.Error, &run.StartedAt, &run.UpdatedAt, &finishedAt)
+	if err != nil {
+		return nil, err
+	}
+	if startedBy.Valid {
+		if id, err := uuid.Parse(startedBy.String); err == nil {
+			run.StartedBy = &id
+		}
+	}
+	if finishedAt.Valid {
+		run.FinishedAt = &finishedAt.Time
+	}
+	return &run, nil
+}
+
+func nullableID(id *uuid.UUID) interface{} {
+	if id == nil {
+		return nil
+	}
+	return *id
+}
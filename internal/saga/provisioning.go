@@ -0,0 +1,81 @@
+package saga
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"highload-microservice/internal/messaging"
+)
+
+// UserProvisioning is the user_provisioning saga: every system in urls gets
+// the new user in turn, and when one of them keeps refusing, the systems
+// provisioned before it remove the user again
+func UserProvisioning(trigger string, urls []string, client *http.Client) (Definition, error) {
+	def := Definition{Name: "user_provisioning", Trigger: trigger}
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return Definition{}, fmt.Errorf("invalid provisioning URL %q", raw)
+		}
+		def.Steps = append(def.Steps, HTTPStep(u.Host, strings.TrimSuffix(raw, "/"), client))
+	}
+	return def, nil
+}
+
+// HTTPStep POSTs the instance to endpoint and compensates with DELETE
+// endpoint/{user_id}. The saga ID is sent as Idempotency-Key, so a retried
+// request can be recognised. 4xx responses other than 408 and 429 are not
+// retried.
+func HTTPStep(name, endpoint string, client *http.Client) Step {
+	return Step{
+		Name: name,
+		Do: func(ctx context.Context, instance Instance) error {
+			body, err := json.Marshal(map[string]string{
+				"saga_id":    instance.ID.String(),
+				"user_id":    instance.UserID.String(),
+				"event_id":   instance.EventID.String(),
+				"event_type": instance.EventType,
+			})
+			if err != nil {
+				return err
+			}
+			return call(ctx, client, http.MethodPost, endpoint, body, instance)
+		},
+		Compensate: func(ctx context.Context, instance Instance) error {
+			return call(ctx, client, http.MethodDelete, endpoint+"/"+instance.UserID.String(), nil, instance)
+		},
+	}
+}
+
+func call(ctx context.Context, client *http.Client, method, endpoint string, body []byte, instance Instance) error {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return messaging.Permanent(err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Idempotency-Key", instance.ID.String()+":"+method)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode < 300, method == http.MethodDelete && resp.StatusCode == http.StatusNotFound:
+		return nil
+	case resp.StatusCode >= 500, resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("%s %s: status %d", method, endpoint, resp.StatusCode)
+	default:
+		return messaging.Permanent(fmt.Errorf("%s %s: status %d", method, endpoint, resp.StatusCode))
+	}
+}
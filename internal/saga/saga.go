@@ -0,0 +1,468 @@
+// Package saga runs multi-step workflows started by consumed events. Every
+// instance is persisted after each step, so it survives restarts; a step is
+// retried with backoff, and when it keeps failing the completed steps are
+// undone in reverse order by their compensating actions. Steps run at least
+// once and must be idempotent.
+package saga
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/messaging"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/processor"
+	"highload-microservice/internal/worker"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// TaskType is the worker pool task type of saga execution
+const TaskType = "saga"
+
+// Instance statuses
+const (
+	StatusRunning      = "running"
+	StatusCompensating = "compensating"
+	StatusCompleted    = "completed"
+	StatusCompensated  = "compensated" // a step failed for good and the completed ones were undone
+	StatusFailed       = "failed"      // a compensation failed for good; needs an operator
+)
+
+// Instance is one run of a saga for one event
+type Instance struct {
+	ID        uuid.UUID `json:"id"`
+	Saga      string    `json:"saga"`
+	EventID   uuid.UUID `json:"event_id"`
+	EventType string    `json:"event_type"`
+	UserID    uuid.UUID `json:"user_id"`
+	Status    string    `json:"status"`
+	// Step is the index of the next step to run; while compensating, the
+	// number of completed steps still to undo
+	Step      int       `json:"step"`
+	StepName  string    `json:"step_name,omitempty"` // of the step Step refers to
+	Attempts  int       `json:"attempts"`            // failed attempts of that step
+	LastError string    `json:"last_error,omitempty"`
+	Stuck     bool      `json:"stuck"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Step is one action of a saga. Errors are retried unless wrapped with
+// messaging.Permanent.
+type Step struct {
+	Name       string
+	Do         func(ctx context.Context, instance Instance) error
+	Compensate func(ctx context.Context, instance Instance) error // nil when there is nothing to undo
+}
+
+// Definition is a saga started by every event of type Trigger
+type Definition struct {
+	Name    string
+	Trigger string
+	Steps   []Step
+}
+
+// Filter selects instances to list
+type Filter struct {
+	Status      string
+	StuckBefore *time.Time // running or compensating without progress since, or failed
+	Limit       int
+}
+
+// Store persists instances
+type Store interface {
+	// Create reports false when the saga already runs for the event
+	Create(ctx context.Context, instance Instance) (bool, error)
+	// Save stores instance unless it changed since prevUpdatedAt, which
+	// means another executor took it over, and reports whether it did
+	Save(ctx context.Context, instance Instance, prevUpdatedAt time.Time) (bool, error)
+	// Get returns nil for an unknown ID
+	Get(ctx context.Context, id uuid.UUID) (*Instance, error)
+	List(ctx context.Context, filter Filter) ([]Instance, error)
+	// ListStale returns running and compensating instances last updated
+	// before before
+	ListStale(ctx context.Context, before time.Time, limit int) ([]Instance, error)
+}
+
+// Tasks runs executions in the background. Implemented by worker.Pool.
+type Tasks interface {
+	Submit(task worker.Task) error
+}
+
+// Config tunes step retries and recovery
+type Config struct {
+	MaxRetries     int           // per step and compensation, after the first attempt
+	InitialBackoff time.Duration // first retry delay
+	MaxBackoff     time.Duration
+	StepTimeout    time.Duration // per attempt
+	StaleAfter     time.Duration // instances without progress this long are resumed and reported stuck
+}
+
+func (c Config) withDefaults() Config {
+	if c.MaxRetries < 0 {
+		c.MaxRetries = 0
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = 500 * time.Millisecond
+	}
+	if c.MaxBackoff < c.InitialBackoff {
+		c.MaxBackoff = 30 * time.Second
+	}
+	if c.StepTimeout <= 0 {
+		c.StepTimeout = 30 * time.Second
+	}
+	if c.StaleAfter <= 0 {
+		c.StaleAfter = 5 * time.Minute
+	}
+	return c
+}
+
+// Engine starts, executes and resumes sagas
+type Engine struct {
+	store  Store
+	tasks  Tasks
+	cfg    Config
+	logger *logrus.Logger
+
+	mu          sync.RWMutex
+	definitions map[string]Definition
+}
+
+func NewEngine(store Store, tasks Tasks, cfg Config, logger *logrus.Logger) *Engine {
+	return &Engine{
+		store:       store,
+		tasks:       tasks,
+		cfg:         cfg.withDefaults(),
+		logger:      logger,
+		definitions: make(map[string]Definition),
+	}
+}
+
+// Register adds a saga definition
+func (e *Engine) Register(def Definition) error {
+	if def.Name == "" || def.Trigger == "" || len(def.Steps) == 0 {
+		return fmt.Errorf("saga %q needs a trigger and steps", def.Name)
+	}
+	for _, step := range def.Steps {
+		if step.Name == "" || step.Do == nil {
+			return fmt.Errorf("saga %s has a step without a name or action", def.Name)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, exists := e.definitions[def.Name]; exists {
+		return fmt.Errorf("saga %s is already registered", def.Name)
+	}
+	e.definitions[def.Name] = def
+	return nil
+}
+
+func (e *Engine) definition(name string) (Definition, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	def, ok := e.definitions[name]
+	return def, ok
+}
+
+// Handlers returns an event handler per saga, named saga_<name>, that starts
+// it for the events of its trigger type
+func (e *Engine) Handlers() []processor.Handler {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	handlers := make([]processor.Handler, 0, len(e.definitions))
+	for _, def := range e.definitions {
+		name := def.Name
+		handlers = append(handlers, processor.Handler{
+			Name:      "saga_" + name,
+			EventType: def.Trigger,
+			Run: func(ctx context.Context, event models.KafkaEvent) error {
+				return e.Start(ctx, name, event)
+			},
+		})
+	}
+	sort.Slice(handlers, func(i, j int) bool { return handlers[i].Name < handlers[j].Name })
+	return handlers
+}
+
+// Start persists a new instance of saga for event and queues its execution.
+// A redelivered event does not start the saga again.
+func (e *Engine) Start(ctx context.Context, saga string, event models.KafkaEvent) error {
+	if _, ok := e.definition(saga); !ok {
+		return messaging.Permanent(fmt.Errorf("unknown saga %s", saga))
+	}
+	now := timestamp()
+	instance := Instance{
+		ID:        uuid.New(),
+		Saga:      saga,
+		EventID:   event.ID,
+		EventType: event.Type,
+		UserID:    event.UserID,
+		Status:    StatusRunning,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	created, err := e.store.Create(ctx, instance)
+	if err != nil {
+		return fmt.Errorf("failed to start saga %s: %w", saga, err)
+	}
+	if !created {
+		return nil
+	}
+	e.logger.Infof("Saga %s started for event %s: %s", saga, event.ID, instance.ID)
+	e.queue(instance)
+	return nil
+}
+
+// queue submits the execution of instance. When the pool is full the
+// instance goes stale and Resume picks it up.
+func (e *Engine) queue(instance Instance) {
+	err := e.tasks.Submit(worker.Task{
+		Type:     TaskType,
+		Priority: worker.PriorityNormal,
+		Run: func(ctx context.Context) error {
+			return e.execute(ctx, instance)
+		},
+	})
+	if err != nil {
+		e.logger.Warnf("Failed to queue saga %s; it will be resumed: %v", instance.ID, err)
+	}
+}
+
+// execute runs instance until it completes, is compensated or fails
+func (e *Engine) execute(ctx context.Context, instance Instance) error {
+	def, ok := e.definition(instance.Saga)
+	if !ok {
+		instance.Status, instance.LastError = StatusFailed, "unknown saga"
+		_, err := e.save(ctx, &instance)
+		return err
+	}
+
+	for {
+		var (
+			action func(context.Context, Instance) error
+			name   string
+		)
+		switch instance.Status {
+		case StatusRunning:
+			if instance.Step >= len(def.Steps) {
+				instance.Status = StatusCompleted
+				e.logger.Infof("Saga %s completed: %s", instance.Saga, instance.ID)
+				_, err := e.save(ctx, &instance)
+				return err
+			}
+			step := def.Steps[instance.Step]
+			action, name = step.Do, step.Name
+		case StatusCompensating:
+			if instance.Step == 0 {
+				instance.Status = StatusCompensated
+				e.logger.Warnf("Saga %s compensated: %s (%s)", instance.Saga, instance.ID, instance.LastError)
+				_, err := e.save(ctx, &instance)
+				return err
+			}
+			step := def.Steps[instance.Step-1]
+			action, name = step.Compensate, "compensate "+step.Name
+		default:
+			return nil
+		}
+
+		err := e.attempt(ctx, action, instance)
+		if ctx.Err() != nil {
+			// Shutdown; the instance is resumed once it goes stale
+			return nil
+		}
+		e.advance(&instance, name, err)
+		if ok, err := e.save(ctx, &instance); err != nil || !ok {
+			return err
+		}
+		if err != nil && instance.Attempts > 0 && !e.sleep(ctx, instance.Attempts) {
+			return nil
+		}
+	}
+}
+
+func (e *Engine) attempt(ctx context.Context, action func(context.Context, Instance) error, instance Instance) error {
+	if action == nil {
+		return nil
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, e.cfg.StepTimeout)
+	defer cancel()
+	return action(attemptCtx, instance)
+}
+
+// advance moves instance on after an attempt of the named action
+func (e *Engine) advance(instance *Instance, name string, err error) {
+	if err == nil {
+		if instance.Status == StatusRunning {
+			instance.Step++
+			instance.LastError = ""
+		} else {
+			instance.Step--
+		}
+		instance.Attempts = 0
+		return
+	}
+
+	instance.Attempts++
+	instance.LastError = name + ": " + err.Error()
+	if instance.Attempts <= e.cfg.MaxRetries && !messaging.IsPermanent(err) {
+		e.logger.Warnf("Saga %s: %s failed (attempt %d): %v", instance.ID, name, instance.Attempts, err)
+		return
+	}
+	if instance.Status == StatusRunning {
+		// Undo the steps completed before this one
+		e.logger.Errorf("Saga %s: %s failed, compensating: %v", instance.ID, name, err)
+		instance.Status = StatusCompensating
+	} else {
+		e.logger.Errorf("Saga %s: %s failed, giving up: %v", instance.ID, name, err)
+		instance.Status = StatusFailed
+	}
+	instance.Attempts = 0
+}
+
+// save stores instance and reports false when another executor took it over
+func (e *Engine) save(ctx context.Context, instance *Instance) (bool, error) {
+	prev := instance.UpdatedAt
+	instance.UpdatedAt = timestamp()
+	ok, err := e.store.Save(context.WithoutCancel(ctx), *instance, prev)
+	if err != nil {
+		return false, fmt.Errorf("failed to save saga %s: %w", instance.ID, err)
+	}
+	if !ok {
+		e.logger.Warnf("Saga %s was taken over by another executor", instance.ID)
+	}
+	return ok, nil
+}
+
+// Resume queues instances that made no progress for StaleAfter, e.g. after
+// a crash or a full worker queue. Run by the saga_resume job.
+func (e *Engine) Resume(ctx context.Context) error {
+	stale, err := e.store.ListStale(ctx, time.Now().Add(-e.cfg.StaleAfter), 100)
+	if err != nil {
+		return fmt.Errorf("failed to list stale sagas: %w", err)
+	}
+	for _, instance := range stale {
+		// Taking the instance over fails if another replica resumed it
+		if ok, err := e.save(ctx, &instance); err != nil || !ok {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		e.logger.Infof("Resuming saga %s: %s", instance.Saga, instance.ID)
+		e.queue(instance)
+	}
+	return nil
+}
+
+// Retry compensates a failed instance again
+func (e *Engine) Retry(ctx context.Context, id uuid.UUID) (*Instance, error) {
+	instance, err := e.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if instance.Status != StatusFailed {
+		return nil, apperrors.Conflict("only failed sagas can be retried")
+	}
+	instance.Status, instance.Attempts = StatusCompensating, 0
+	ok, err := e.save(ctx, instance)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, apperrors.Conflict("saga changed meanwhile")
+	}
+	e.queue(*instance)
+	e.describe(instance)
+	return instance, nil
+}
+
+// Get returns an instance
+func (e *Engine) Get(ctx context.Context, id uuid.UUID) (*Instance, error) {
+	instance, err := e.store.Get(ctx, id)
+	if err != nil {
+		return nil, apperrors.FromDB(err, "failed to get saga")
+	}
+	if instance == nil {
+		return nil, apperrors.NotFound("saga not found")
+	}
+	e.describe(instance)
+	return instance, nil
+}
+
+// List returns instances, newest first. With stuck only failed ones and
+// those without progress for StaleAfter are returned.
+func (e *Engine) List(ctx context.Context, status string, stuck bool, limit int) ([]Instance, error) {
+	filter := Filter{Status: status, Limit: limit}
+	if stuck {
+		before := time.Now().Add(-e.cfg.StaleAfter)
+		filter.StuckBefore = &before
+	}
+	instances, err := e.store.List(ctx, filter)
+	if err != nil {
+		return nil, apperrors.FromDB(err, "failed to list sagas")
+	}
+	for i := range instances {
+		e.describe(&instances[i])
+	}
+	return instances, nil
+}
+
+// describe fills the fields derived from the definition and the clock
+func (e *Engine) describe(instance *Instance) {
+	switch instance.Status {
+	case StatusFailed:
+		instance.Stuck = true
+	case StatusRunning, StatusCompensating:
+		instance.Stuck = time.Since(instance.UpdatedAt) > e.cfg.StaleAfter
+	}
+	def, ok := e.definition(instance.Saga)
+	if !ok {
+		return
+	}
+	step := instance.Step
+	switch instance.Status {
+	case StatusRunning:
+	case StatusCompensating, StatusFailed:
+		step--
+	default:
+		return
+	}
+	if step >= 0 && step < len(def.Steps) {
+		instance.StepName = def.Steps[step].Name
+	}
+}
+
+// sleep waits the backoff of the given attempt and reports false if ctx was
+// cancelled first
+func (e *Engine) sleep(ctx context.Context, attempt int) bool {
+	d := e.cfg.InitialBackoff
+	for i := 1; i < attempt && d < e.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > e.cfg.MaxBackoff {
+		d = e.cfg.MaxBackoff
+	}
+	half := d / 2
+	timer := time.NewTimer(half + rand.N(half+1)) // #nosec G404 -- jitter, not security sensitive
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// timestamp is now at the precision both databases store
+func timestamp() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
@@ -0,0 +1,273 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/messaging"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/worker"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type memoryStore struct {
+	mu        sync.Mutex
+	instances map[uuid.UUID]Instance
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{instances: map[uuid.UUID]Instance{}}
+}
+
+func (m *memoryStore) Create(ctx context.Context, i Instance) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.instances {
+		if existing.Saga == i.Saga && existing.EventID == i.EventID {
+			return false, nil
+		}
+	}
+	m.instances[i.ID] = i
+	return true, nil
+}
+
+func (m *memoryStore) Save(ctx context.Context, i Instance, prev time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.instances[i.ID].UpdatedAt.Equal(prev) {
+		return false, nil
+	}
+	m.instances[i.ID] = i
+	return true, nil
+}
+
+func (m *memoryStore) Get(ctx context.Context, id uuid.UUID) (*Instance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, ok := m.instances[id]
+	if !ok {
+		return nil, nil
+	}
+	return &i, nil
+}
+
+func (m *memoryStore) List(ctx context.Context, f Filter) ([]Instance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var list []Instance
+	for _, i := range m.instances {
+		if f.Status == "" || i.Status == f.Status {
+			list = append(list, i)
+		}
+	}
+	return list, nil
+}
+
+func (m *memoryStore) ListStale(ctx context.Context, before time.Time, limit int) ([]Instance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var list []Instance
+	for _, i := range m.instances {
+		if (i.Status == StatusRunning || i.Status == StatusCompensating) && i.UpdatedAt.Before(before) {
+			list = append(list, i)
+		}
+	}
+	return list, nil
+}
+
+func (m *memoryStore) only(t *testing.T) Instance {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.instances) != 1 {
+		t.Fatalf("%d instances, want 1", len(m.instances))
+	}
+	for _, i := range m.instances {
+		return i
+	}
+	return Instance{}
+}
+
+// inlineTasks runs tasks when submitted
+type inlineTasks struct{ submitted int }
+
+func (t *inlineTasks) Submit(task worker.Task) error {
+	t.submitted++
+	return task.Run(context.Background())
+}
+
+// fullTasks rejects every task
+type fullTasks struct{}
+
+func (fullTasks) Submit(worker.Task) error { return worker.ErrQueueFull }
+
+func newTestEngine(store Store, tasks Tasks) *Engine {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return NewEngine(store, tasks, Config{MaxRetries: 1, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}, logger)
+}
+
+// journal records the actions of steps a, b and c; fail makes the named
+// actions fail every time
+func journal(fail map[string]error) (Definition, *[]string) {
+	var calls []string
+	step := func(name string) Step {
+		act := func(action string) func(context.Context, Instance) error {
+			return func(context.Context, Instance) error {
+				calls = append(calls, action)
+				return fail[action]
+			}
+		}
+		return Step{Name: name, Do: act(name), Compensate: act("undo " + name)}
+	}
+	return Definition{Name: "provision", Trigger: "user_created", Steps: []Step{step("a"), step("b"), step("c")}}, &calls
+}
+
+func start(t *testing.T, engine *Engine, def Definition, event models.KafkaEvent) {
+	t.Helper()
+	if err := engine.Register(def); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if err := engine.Start(context.Background(), def.Name, event); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestEngine_CompletesStepsOncePerEvent(t *testing.T) {
+	store, tasks := newMemoryStore(), &inlineTasks{}
+	engine := newTestEngine(store, tasks)
+	def, calls := journal(nil)
+	event := models.KafkaEvent{ID: uuid.New(), UserID: uuid.New(), Type: "user_created"}
+	start(t, engine, def, event)
+
+	// A redelivered event does not start the saga again
+	if err := engine.Start(context.Background(), def.Name, event); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	if !equal(*calls, []string{"a", "b", "c"}) {
+		t.Fatalf("calls = %v", *calls)
+	}
+	if i := store.only(t); i.Status != StatusCompleted || i.Step != 3 || tasks.submitted != 1 {
+		t.Fatalf("instance = %+v, %d executions", i, tasks.submitted)
+	}
+}
+
+func TestEngine_CompensatesCompletedStepsInReverse(t *testing.T) {
+	store := newMemoryStore()
+	engine := newTestEngine(store, &inlineTasks{})
+	def, calls := journal(map[string]error{"c": errors.New("unavailable")})
+	start(t, engine, def, models.KafkaEvent{ID: uuid.New(), UserID: uuid.New()})
+
+	// c is retried once, then b and a are undone
+	want := []string{"a", "b", "c", "c", "undo b", "undo a"}
+	if !equal(*calls, want) {
+		t.Fatalf("calls = %v, want %v", *calls, want)
+	}
+	if i := store.only(t); i.Status != StatusCompensated || i.LastError != "c: unavailable" {
+		t.Fatalf("instance = %+v", i)
+	}
+}
+
+func TestEngine_FailedCompensationIsStuckUntilRetried(t *testing.T) {
+	store := newMemoryStore()
+	engine := newTestEngine(store, &inlineTasks{})
+	fail := map[string]error{"b": messaging.Permanent(errors.New("rejected")), "undo a": errors.New("timeout")}
+	def, calls := journal(fail)
+	start(t, engine, def, models.KafkaEvent{ID: uuid.New(), UserID: uuid.New()})
+
+	// The permanent failure of b is not retried
+	want := []string{"a", "b", "undo a", "undo a"}
+	if !equal(*calls, want) {
+		t.Fatalf("calls = %v, want %v", *calls, want)
+	}
+	id := store.only(t).ID
+	stuck, err := engine.Get(context.Background(), id)
+	if err != nil || stuck.Status != StatusFailed || !stuck.Stuck || stuck.StepName != "a" {
+		t.Fatalf("Get = %+v, %v", stuck, err)
+	}
+
+	delete(fail, "undo a")
+	if _, err := engine.Retry(context.Background(), id); err != nil {
+		t.Fatalf("Retry: %v", err)
+	}
+	if i := store.only(t); i.Status != StatusCompensated {
+		t.Fatalf("after retry instance = %+v", i)
+	}
+}
+
+func TestEngine_ResumeRunsStaleInstances(t *testing.T) {
+	store := newMemoryStore()
+	def, calls := journal(nil)
+
+	// The execution could not be queued
+	starter := newTestEngine(store, fullTasks{})
+	start(t, starter, def, models.KafkaEvent{ID: uuid.New(), UserID: uuid.New()})
+	if len(*calls) != 0 {
+		t.Fatalf("calls = %v", *calls)
+	}
+
+	engine := newTestEngine(store, &inlineTasks{})
+	engine.cfg.StaleAfter = -time.Second // everything is stale
+	if err := engine.Register(def); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if err := engine.Resume(context.Background()); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if i := store.only(t); i.Status != StatusCompleted || len(*calls) != 3 {
+		t.Fatalf("instance = %+v, calls %v", i, *calls)
+	}
+}
+
+func TestHTTPStep_ClientErrorsArePermanent(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	var deleted string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Idempotency-Key") == "" {
+			t.Error("missing Idempotency-Key")
+		}
+		if r.Method == http.MethodDelete {
+			deleted = r.URL.Path
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	step := HTTPStep("crm", srv.URL+"/accounts", srv.Client())
+	instance := Instance{ID: uuid.New(), UserID: uuid.New()}
+
+	if err := step.Do(context.Background(), instance); err == nil || messaging.IsPermanent(err) {
+		t.Fatalf("503: err = %v, want a retryable error", err)
+	}
+	status = http.StatusUnprocessableEntity
+	if err := step.Do(context.Background(), instance); !messaging.IsPermanent(err) {
+		t.Fatalf("422: err = %v, want a permanent error", err)
+	}
+	// A user the system does not know is already removed
+	if err := step.Compensate(context.Background(), instance); err != nil || deleted != "/accounts/"+instance.UserID.String() {
+		t.Fatalf("Compensate = %v, deleted %q", err, deleted)
+	}
+}
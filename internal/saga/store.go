@@ -0,0 +1,135 @@
+package saga
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"highload-microservice/internal/database"
+
+	"github.com/google/uuid"
+)
+
+const instanceColumns = "id, saga, event_id, event_type, user_id, status, step, attempts, last_error, created_at, updated_at"
+
+// SQLStore keeps instances in the saga_instances table
+type SQLStore struct {
+	db     *sql.DB
+	insert string
+}
+
+func NewSQLStore(db *sql.DB, dialect database.Dialect) *SQLStore {
+	return &SQLStore{
+		db: db,
+		insert: dialect.Upsert("saga_instances",
+			strings.Split(instanceColumns, ", "),
+			[]string{"saga", "event_id"},
+			nil),
+	}
+}
+
+func (s *SQLStore) Create(ctx context.Context, i Instance) (bool, error) {
+	result, err := s.db.ExecContext(ctx, s.insert,
+		i.ID, i.Saga, i.EventID, i.EventType, i.UserID, i.Status, i.Step, i.Attempts, i.LastError, i.CreatedAt, i.UpdatedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to create saga: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return err == nil && n == 1, nil
+}
+
+func (s *SQLStore) Save(ctx context.Context, i Instance, prevUpdatedAt time.Time) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE saga_instances SET status = $1, step = $2, attempts = $3, last_error = $4, updated_at = $5
+		WHERE id = $6 AND updated_at = $7
+	`, i.Status, i.Step, i.Attempts, i.LastError, i.UpdatedAt, i.ID, prevUpdatedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to save saga: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to save saga: %w", err)
+	}
+	return n == 1, nil
+}
+
+func (s *SQLStore) Get(ctx context.Context, id uuid.UUID) (*Instance, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+instanceColumns+` FROM saga_instances WHERE id = $1`, id)
+	i, err := scanInstance(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get saga: %w", err)
+	}
+	return &i, nil
+}
+
+func (s *SQLStore) List(ctx context.Context, f Filter) ([]Instance, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	if f.Status != "" {
+		args = append(args, f.Status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if f.StuckBefore != nil {
+		args = append(args, StatusFailed, StatusRunning, StatusCompensating, *f.StuckBefore)
+		n := len(args)
+		conditions = append(conditions, fmt.Sprintf("(status = $%d OR (status IN ($%d, $%d) AND updated_at < $%d))", n-3, n-2, n-1, n))
+	}
+	query := `SELECT ` + instanceColumns + ` FROM saga_instances`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if f.Limit <= 0 {
+		f.Limit = 100
+	}
+	args = append(args, f.Limit)
+	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d", len(args))
+	return s.query(ctx, query, args...)
+}
+
+func (s *SQLStore) ListStale(ctx context.Context, before time.Time, limit int) ([]Instance, error) {
+	return s.query(ctx, `
+		SELECT `+instanceColumns+` FROM saga_instances
+		WHERE status IN ($1, $2) AND updated_at < $3
+		ORDER BY updated_at LIMIT $4
+	`, StatusRunning, StatusCompensating, before.UTC(), limit)
+}
+
+func (s *SQLStore) query(ctx context.Context, query string, args ...interface{}) ([]Instance, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sagas: %w", err)
+	}
+	defer rows.Close()
+
+	instances := []Instance{}
+	for rows.Next() {
+		i, err := scanInstance(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan saga: %w", err)
+		}
+		instances = append(instances, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list sagas: %w", err)
+	}
+	return instances, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanInstance(row scanner) (Instance, error) {
+	var i Instance
+	err := row.Scan(&i.ID, &i.Saga, &i.EventID, &i.EventType, &i.UserID, &i.Status, &i.Step, &i.Attempts, &i.LastError, &i.CreatedAt, &i.UpdatedAt)
+	i.CreatedAt, i.UpdatedAt = i.CreatedAt.UTC(), i.UpdatedAt.UTC()
+	return i, err
+}
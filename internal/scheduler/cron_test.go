@@ -0,0 +1,57 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse_Next(t *testing.T) {
+	// Wednesday
+	from := time.Date(2024, 1, 10, 10, 17, 30, 0, time.UTC)
+
+	cases := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 10, 10, 18, 0, 0, time.UTC)},
+		{"*/5 * * * *", time.Date(2024, 1, 10, 10, 20, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2024, 1, 10, 11, 0, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2024, 1, 11, 2, 30, 0, 0, time.UTC)},
+		{"15,45 9-17 * * *", time.Date(2024, 1, 10, 10, 45, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Either day field matches when both are restricted: the 15th or a Friday
+		{"0 0 15 * 5", time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		{"@every 10m", time.Date(2024, 1, 10, 10, 20, 0, 0, time.UTC)},
+	}
+	for _, tc := range cases {
+		schedule, err := Parse(tc.spec)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.spec, err)
+		}
+		if got := schedule.Next(from); !got.Equal(tc.want) {
+			t.Errorf("%q: next %v, want %v", tc.spec, got, tc.want)
+		}
+	}
+}
+
+func TestParse_Impossible(t *testing.T) {
+	schedule, err := Parse("0 0 31 2 *")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if next := schedule.Next(time.Now()); !next.IsZero() {
+		t.Fatalf("February 31st should never run, got %v", next)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "0 0 0 * *", "5-1 * * * *", "*/0 * * * *", "a * * * *", "@every 100ms", "@every soon"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"highload-microservice/internal/worker"
+
+	"github.com/sirupsen/logrus"
+)
+
+// JobFunc is the body of a scheduled job
+type JobFunc func(ctx context.Context) error
+
+// Claimer is the shared counter used to pick one replica per run (the cache
+// backend). The first replica to increment a run's key executes it.
+type Claimer interface {
+	Incr(ctx context.Context, key string, expiration time.Duration) (int64, error)
+}
+
+// JobStatus is reported on /admin/scheduler/jobs
+type JobStatus struct {
+	Name           string     `json:"name"`
+	Schedule       string     `json:"schedule"`
+	Running        bool       `json:"running"`
+	NextRun        *time.Time `json:"next_run,omitempty"`
+	LastStart      *time.Time `json:"last_start,omitempty"`
+	LastEnd        *time.Time `json:"last_end,omitempty"`
+	LastDurationMS int64      `json:"last_duration_ms"`
+	LastError      string     `json:"last_error,omitempty"`
+	LastSuccess    *time.Time `json:"last_success,omitempty"`
+	Runs           int64      `json:"runs"`
+	Failures       int64      `json:"failures"`
+	Skipped        int64      `json:"skipped"` // previous run still in progress
+}
+
+type job struct {
+	name     string
+	spec     string
+	schedule Schedule
+	timeout  time.Duration
+	run      JobFunc
+	running  atomic.Bool
+
+	mu     sync.Mutex
+	status JobStatus
+}
+
+// Scheduler fires jobs at their scheduled times and runs them as low
+// priority tasks on a worker pool. A job is skipped while its previous run
+// is still in progress, and with a Claimer only one replica runs each slot.
+type Scheduler struct {
+	pool    *worker.Pool
+	claimer Claimer
+	logger  *logrus.Logger
+	jobs    []*job
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	started bool
+}
+
+func New(pool *worker.Pool, logger *logrus.Logger) *Scheduler {
+	return &Scheduler{
+		pool:   pool,
+		logger: logger,
+		stop:   make(chan struct{}),
+	}
+}
+
+// SetClaimer makes replicas share runs instead of each running every job.
+// Must be called before Start.
+func (s *Scheduler) SetClaimer(claimer Claimer) {
+	s.claimer = claimer
+}
+
+// Add registers a job. An empty spec disables it. timeout bounds each run.
+// Must be called before Start.
+func (s *Scheduler) Add(name, spec string, timeout time.Duration, run JobFunc) error {
+	if spec == "" {
+		s.logger.Infof("Scheduled job %s is disabled", name)
+		return nil
+	}
+	schedule, err := Parse(spec)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", name, err)
+	}
+	for _, j := range s.jobs {
+		if j.name == name {
+			return fmt.Errorf("job %s is already registered", name)
+		}
+	}
+	if timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+
+	s.jobs = append(s.jobs, &job{
+		name:     name,
+		spec:     spec,
+		schedule: schedule,
+		timeout:  timeout,
+		run:      run,
+		status:   JobStatus{Name: name, Schedule: spec},
+	})
+	return nil
+}
+
+func (s *Scheduler) Start() {
+	s.started = true
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(j)
+	}
+	s.logger.Infof("Scheduler started with %d jobs", len(s.jobs))
+}
+
+// loop waits for each scheduled time of j and fires it
+func (s *Scheduler) loop(j *job) {
+	defer s.wg.Done()
+
+	for {
+		next := j.schedule.Next(time.Now())
+		if next.IsZero() {
+			s.logger.Warnf("Scheduled job %s has no future runs", j.name)
+			return
+		}
+		j.mu.Lock()
+		j.status.NextRun = &next
+		j.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+			s.fire(j, next)
+		}
+	}
+}
+
+// fire submits one run of j unless it is still running or another replica
+// claimed the slot
+func (s *Scheduler) fire(j *job, slot time.Time) {
+	if !j.running.CompareAndSwap(false, true) {
+		j.mu.Lock()
+		j.status.Skipped++
+		j.mu.Unlock()
+		s.logger.Warnf("Skipping scheduled job %s: previous run still in progress", j.name)
+		return
+	}
+
+	if !s.claim(j, slot) {
+		j.running.Store(false)
+		return
+	}
+
+	err := s.pool.Submit(worker.Task{
+		Type:     "scheduled:" + j.name,
+		Priority: worker.PriorityLow,
+		Run: func(ctx context.Context) error {
+			return s.execute(ctx, j)
+		},
+	})
+	if err != nil {
+		j.running.Store(false)
+		now := time.Now()
+		s.finish(j, now, now, fmt.Errorf("not queued: %w", err))
+	}
+}
+
+// claim reports whether this replica should run the slot. Claim errors fail
+// open: a duplicate run is better than a missed one for cleanup jobs.
+func (s *Scheduler) claim(j *job, slot time.Time) bool {
+	if s.claimer == nil {
+		return true
+	}
+
+	ttl := time.Hour
+	if next := j.schedule.Next(slot); !next.IsZero() && next.Sub(slot) < ttl {
+		ttl = next.Sub(slot)
+	}
+	key := fmt.Sprintf("scheduler:%s:%d", j.name, slot.Unix())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	n, err := s.claimer.Incr(ctx, key, ttl)
+	if err != nil {
+		s.logger.Warnf("Failed to claim scheduled job %s, running it anyway: %v", j.name, err)
+		return true
+	}
+	if n > 1 {
+		s.logger.Debugf("Scheduled job %s at %s runs on another replica", j.name, slot.Format(time.RFC3339))
+		return false
+	}
+	return true
+}
+
+func (s *Scheduler) execute(ctx context.Context, j *job) (err error) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, j.timeout)
+	defer cancel()
+
+	// Record the outcome even if the job panics; the pool recovers the panic
+	defer func() {
+		r := recover()
+		if r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+		s.finish(j, start, time.Now(), err)
+		j.running.Store(false)
+		if r != nil {
+			panic(r)
+		}
+	}()
+
+	return j.run(ctx)
+}
+
+func (s *Scheduler) finish(j *job, start, end time.Time, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.status.Runs++
+	j.status.LastStart = &start
+	j.status.LastEnd = &end
+	j.status.LastDurationMS = end.Sub(start).Milliseconds()
+	if err != nil {
+		j.status.Failures++
+		j.status.LastError = err.Error()
+		s.logger.Errorf("Scheduled job %s failed: %v", j.name, err)
+		return
+	}
+	j.status.LastError = ""
+	j.status.LastSuccess = &end
+	s.logger.Debugf("Scheduled job %s finished in %v", j.name, end.Sub(start))
+}
+
+// Status returns the state of every job, sorted by name
+func (s *Scheduler) Status() []JobStatus {
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		j.mu.Lock()
+		status := j.status
+		j.mu.Unlock()
+		status.Running = j.running.Load()
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(a, b int) bool { return statuses[a].Name < statuses[b].Name })
+	return statuses
+}
+
+// Stop stops firing jobs. Runs already queued finish on the worker pool.
+func (s *Scheduler) Stop() {
+	if !s.started {
+		return
+	}
+	close(s.stop)
+	s.wg.Wait()
+	s.logger.Info("Scheduler stopped")
+}
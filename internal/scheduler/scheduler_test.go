@@ -0,0 +1,158 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/worker"
+
+	"github.com/sirupsen/logrus"
+)
+
+func newTestLogger() *logrus.Logger {
+	l := logrus.New()
+	l.SetLevel(logrus.FatalLevel)
+	return l
+}
+
+func newTestScheduler(t *testing.T) *Scheduler {
+	pool := worker.NewPool(2, newTestLogger())
+	pool.Start()
+	t.Cleanup(pool.Stop)
+	return New(pool, newTestLogger())
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func status(s *Scheduler, name string) JobStatus {
+	for _, st := range s.Status() {
+		if st.Name == name {
+			return st
+		}
+	}
+	return JobStatus{}
+}
+
+func TestScheduler_SkipsOverlappingRun(t *testing.T) {
+	s := newTestScheduler(t)
+	release := make(chan struct{})
+	if err := s.Add("slow", "@hourly", 0, func(ctx context.Context) error {
+		<-release
+		return nil
+	}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	j := s.jobs[0]
+
+	s.fire(j, time.Now())
+	waitFor(t, func() bool { return status(s, "slow").Running })
+	s.fire(j, time.Now())
+
+	close(release)
+	waitFor(t, func() bool { return status(s, "slow").Runs == 1 && !status(s, "slow").Running })
+	if st := status(s, "slow"); st.Skipped != 1 || st.LastSuccess == nil {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+}
+
+func TestScheduler_RecordsFailuresAndPanics(t *testing.T) {
+	s := newTestScheduler(t)
+	_ = s.Add("failing", "@hourly", 0, func(ctx context.Context) error { return errors.New("db down") })
+	_ = s.Add("panicking", "@hourly", 0, func(ctx context.Context) error { panic("boom") })
+
+	for _, j := range s.jobs {
+		s.fire(j, time.Now())
+	}
+	waitFor(t, func() bool { return status(s, "failing").Runs == 1 && status(s, "panicking").Runs == 1 })
+
+	if st := status(s, "failing"); st.Failures != 1 || st.LastError != "db down" || st.LastSuccess != nil {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+	if st := status(s, "panicking"); st.Failures != 1 || st.LastError != "panic: boom" {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+	// The panic does not leave the job marked as running
+	waitFor(t, func() bool { return !status(s, "panicking").Running })
+}
+
+type fakeClaimer struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (f *fakeClaimer) Incr(ctx context.Context, key string, expiration time.Duration) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.counts[key]++
+	return f.counts[key], nil
+}
+
+func TestScheduler_OneReplicaPerSlot(t *testing.T) {
+	claimer := &fakeClaimer{counts: make(map[string]int64)}
+	var mu sync.Mutex
+	runs := 0
+
+	// Two replicas sharing the claimer fire the same slot
+	var replicas []*Scheduler
+	for i := 0; i < 2; i++ {
+		s := newTestScheduler(t)
+		s.SetClaimer(claimer)
+		_ = s.Add("cleanup", "*/5 * * * *", 0, func(ctx context.Context) error {
+			mu.Lock()
+			runs++
+			mu.Unlock()
+			return nil
+		})
+		replicas = append(replicas, s)
+	}
+
+	slot := time.Date(2024, 1, 10, 10, 20, 0, 0, time.UTC)
+	for _, s := range replicas {
+		s.fire(s.jobs[0], slot)
+	}
+	waitFor(t, func() bool { return status(replicas[0], "cleanup").Runs+status(replicas[1], "cleanup").Runs == 1 })
+
+	// The next slot is claimed again
+	replicas[1].fire(replicas[1].jobs[0], slot.Add(5*time.Minute))
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return runs == 2
+	})
+}
+
+func TestScheduler_AddValidates(t *testing.T) {
+	s := newTestScheduler(t)
+	noop := func(ctx context.Context) error { return nil }
+
+	if err := s.Add("bad", "every day", 0, noop); err == nil {
+		t.Fatal("expected invalid schedule error")
+	}
+	if err := s.Add("off", "", 0, noop); err != nil || len(s.jobs) != 0 {
+		t.Fatalf("empty spec should disable the job: %v", err)
+	}
+	_ = s.Add("dup", "@daily", 0, noop)
+	if err := s.Add("dup", "@daily", 0, noop); err == nil {
+		t.Fatal("expected duplicate job error")
+	}
+}
+
+func TestScheduler_StartStop(t *testing.T) {
+	s := newTestScheduler(t)
+	_ = s.Add("tick", "@every 1s", 0, func(ctx context.Context) error { return nil })
+	s.Start()
+	waitFor(t, func() bool { return status(s, "tick").NextRun != nil })
+	s.Stop()
+}
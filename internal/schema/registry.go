@@ -0,0 +1,261 @@
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Where a schema was registered
+const (
+	SourceDatabase = "database" // through the admin API; overrides config
+	SourceConfig   = "config"   // a file in EVENT_SCHEMA_DIR
+)
+
+// EventSchema is the payload schema of an event type
+type EventSchema struct {
+	EventType string          `json:"event_type"`
+	Schema    json.RawMessage `json:"schema"`
+	Source    string          `json:"source"`
+	UpdatedBy *uuid.UUID      `json:"updated_by,omitempty"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// Store persists the schemas registered through the API
+type Store interface {
+	ListSchemas(ctx context.Context) ([]EventSchema, error)
+	SaveSchema(ctx context.Context, schema EventSchema) error
+	// DeleteSchema reports whether a schema was stored for eventType
+	DeleteSchema(ctx context.Context, eventType string) (bool, error)
+}
+
+type entry struct {
+	info     EventSchema
+	compiled *Schema
+}
+
+// Registry holds the schemas of all event types. Types without a schema
+// accept any payload. Schemas stored in the database override those from
+// files; other replicas pick up API changes on their next refresh.
+type Registry struct {
+	store  Store
+	logger *logrus.Logger
+
+	mu         sync.RWMutex
+	configured map[string]entry
+	stored     map[string]entry
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewRegistry creates a registry; store may be nil when schemas only come
+// from files
+func NewRegistry(store Store, logger *logrus.Logger) *Registry {
+	return &Registry{
+		store:      store,
+		logger:     logger,
+		configured: make(map[string]entry),
+		stored:     make(map[string]entry),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+}
+
+// LoadDir registers every <event_type>.json file in dir
+func (r *Registry) LoadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	configured := make(map[string]entry, len(files))
+	for _, file := range files {
+		raw, err := os.ReadFile(file) // #nosec G304 -- files come from the configured schema directory
+		if err != nil {
+			return fmt.Errorf("failed to read schema %s: %w", file, err)
+		}
+		compiled, err := Compile(raw)
+		if err != nil {
+			return fmt.Errorf("invalid schema %s: %w", file, err)
+		}
+		eventType := strings.TrimSuffix(filepath.Base(file), ".json")
+		configured[eventType] = entry{
+			info:     EventSchema{EventType: eventType, Schema: raw, Source: SourceConfig},
+			compiled: compiled,
+		}
+	}
+
+	r.mu.Lock()
+	r.configured = configured
+	r.mu.Unlock()
+	return nil
+}
+
+// Load replaces the in-memory schemas with the stored ones
+func (r *Registry) Load(ctx context.Context) error {
+	if r.store == nil {
+		return nil
+	}
+	schemas, err := r.store.ListSchemas(ctx)
+	if err != nil {
+		return err
+	}
+
+	stored := make(map[string]entry, len(schemas))
+	for _, s := range schemas {
+		compiled, err := Compile(s.Schema)
+		if err != nil {
+			r.logger.Warnf("Skipping stored schema for %s: %v", s.EventType, err)
+			continue
+		}
+		stored[s.EventType] = entry{info: s, compiled: compiled}
+	}
+
+	r.mu.Lock()
+	r.stored = stored
+	r.mu.Unlock()
+	return nil
+}
+
+// Start reloads the stored schemas every interval until Stop is called
+func (r *Registry) Start(interval time.Duration) {
+	go func() {
+		defer close(r.stopped)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.done:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				if err := r.Load(ctx); err != nil {
+					r.logger.Errorf("Failed to refresh event schemas: %v", err)
+				}
+				cancel()
+			}
+		}
+	}()
+}
+
+// Stop stops the refresh loop started by Start
+func (r *Registry) Stop() {
+	close(r.done)
+	<-r.stopped
+}
+
+func (r *Registry) lookup(eventType string) (entry, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if e, ok := r.stored[eventType]; ok {
+		return e, true
+	}
+	e, ok := r.configured[eventType]
+	return e, ok
+}
+
+// Validate checks data against the schema of eventType. Types without a
+// schema always pass.
+func (r *Registry) Validate(eventType, data string) error {
+	e, ok := r.lookup(eventType)
+	if !ok {
+		return nil
+	}
+	return e.compiled.Validate(data)
+}
+
+// Get returns the schema in effect for eventType
+func (r *Registry) Get(eventType string) (EventSchema, bool) {
+	e, ok := r.lookup(eventType)
+	return e.info, ok
+}
+
+// List returns the schemas in effect, sorted by event type
+func (r *Registry) List() []EventSchema {
+	r.mu.RLock()
+	effective := make(map[string]EventSchema, len(r.configured)+len(r.stored))
+	for eventType, e := range r.configured {
+		effective[eventType] = e.info
+	}
+	for eventType, e := range r.stored {
+		effective[eventType] = e.info
+	}
+	r.mu.RUnlock()
+
+	schemas := make([]EventSchema, 0, len(effective))
+	for _, s := range effective {
+		schemas = append(schemas, s)
+	}
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].EventType < schemas[j].EventType })
+	return schemas
+}
+
+// Put compiles and stores the schema of eventType, replacing any previous one
+func (r *Registry) Put(ctx context.Context, eventType string, raw json.RawMessage, updatedBy *uuid.UUID) (EventSchema, error) {
+	if r.store == nil {
+		return EventSchema{}, apperrors.Conflict("schemas can only be changed in EVENT_SCHEMA_DIR")
+	}
+	if strings.TrimSpace(eventType) == "" {
+		return EventSchema{}, apperrors.Validation("event type is required")
+	}
+	compiled, err := Compile(raw)
+	if err != nil {
+		return EventSchema{}, apperrors.Wrap(apperrors.ErrValidation, "invalid schema: "+err.Error(), err)
+	}
+
+	info := EventSchema{
+		EventType: eventType,
+		Schema:    raw,
+		Source:    SourceDatabase,
+		UpdatedBy: updatedBy,
+		UpdatedAt: time.Now().UTC(),
+	}
+	if err := r.store.SaveSchema(ctx, info); err != nil {
+		return EventSchema{}, err
+	}
+
+	r.mu.Lock()
+	r.stored[eventType] = entry{info: info, compiled: compiled}
+	r.mu.Unlock()
+	return info, nil
+}
+
+// Delete removes the stored schema of eventType. A schema from a file then
+// applies again; those cannot be deleted through the API.
+func (r *Registry) Delete(ctx context.Context, eventType string) (EventSchema, error) {
+	e, ok := r.lookup(eventType)
+	if !ok {
+		return EventSchema{}, apperrors.NotFound("event schema not found")
+	}
+	if e.info.Source == SourceConfig || r.store == nil {
+		return EventSchema{}, apperrors.Conflict("schema is defined in EVENT_SCHEMA_DIR")
+	}
+
+	deleted, err := r.store.DeleteSchema(ctx, eventType)
+	if err != nil {
+		return EventSchema{}, err
+	}
+
+	r.mu.Lock()
+	delete(r.stored, eventType)
+	r.mu.Unlock()
+
+	if !deleted {
+		return EventSchema{}, apperrors.NotFound("event schema not found")
+	}
+	return e.info, nil
+}
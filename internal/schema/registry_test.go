@@ -0,0 +1,105 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"highload-microservice/internal/apperrors"
+
+	"github.com/sirupsen/logrus"
+)
+
+type memoryStore struct {
+	schemas map[string]EventSchema
+}
+
+func (m *memoryStore) ListSchemas(ctx context.Context) ([]EventSchema, error) {
+	var schemas []EventSchema
+	for _, s := range m.schemas {
+		schemas = append(schemas, s)
+	}
+	return schemas, nil
+}
+
+func (m *memoryStore) SaveSchema(ctx context.Context, schema EventSchema) error {
+	m.schemas[schema.EventType] = schema
+	return nil
+}
+
+func (m *memoryStore) DeleteSchema(ctx context.Context, eventType string) (bool, error) {
+	_, ok := m.schemas[eventType]
+	delete(m.schemas, eventType)
+	return ok, nil
+}
+
+func TestRegistry_StoredSchemaOverridesFile(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "order_paid.json"), []byte(`{"type": "object"}`), 0o600); err != nil {
+		t.Fatalf("write schema: %v", err)
+	}
+
+	r := NewRegistry(&memoryStore{schemas: map[string]EventSchema{}}, logrus.New())
+	if err := r.LoadDir(dir); err != nil {
+		t.Fatalf("load dir: %v", err)
+	}
+	if err := r.Validate("order_paid", `[]`); err == nil {
+		t.Fatalf("expected file schema to apply")
+	}
+	if err := r.Validate("unknown", `not even json`); err != nil {
+		t.Fatalf("types without a schema must pass, got %v", err)
+	}
+
+	if _, err := r.Put(ctx, "order_paid", []byte(`{"type": "array"}`), nil); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if err := r.Validate("order_paid", `[]`); err != nil {
+		t.Fatalf("expected stored schema to override the file, got %v", err)
+	}
+	if s, _ := r.Get("order_paid"); s.Source != SourceDatabase {
+		t.Fatalf("expected database source, got %s", s.Source)
+	}
+
+	// Deleting the stored schema restores the file one, which cannot be deleted
+	if _, err := r.Delete(ctx, "order_paid"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if s, _ := r.Get("order_paid"); s.Source != SourceConfig {
+		t.Fatalf("expected config source after delete, got %s", s.Source)
+	}
+	if _, err := r.Delete(ctx, "order_paid"); !errors.Is(err, apperrors.ErrConflict) {
+		t.Fatalf("expected conflict for file schema, got %v", err)
+	}
+	if _, err := r.Delete(ctx, "unknown"); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestRegistry_PutRejectsInvalidSchema(t *testing.T) {
+	r := NewRegistry(&memoryStore{schemas: map[string]EventSchema{}}, logrus.New())
+
+	if _, err := r.Put(context.Background(), "order_paid", []byte(`{"oneOf": []}`), nil); !errors.Is(err, apperrors.ErrValidation) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	if len(r.List()) != 0 {
+		t.Fatalf("invalid schema must not be registered")
+	}
+}
+
+func TestRegistry_LoadPicksUpOtherReplicas(t *testing.T) {
+	store := &memoryStore{schemas: map[string]EventSchema{
+		"order_paid": {EventType: "order_paid", Schema: []byte(`{"type": "object"}`), Source: SourceDatabase},
+		"broken":     {EventType: "broken", Schema: []byte(`{"$ref": "#"}`), Source: SourceDatabase},
+	}}
+	r := NewRegistry(store, logrus.New())
+
+	if err := r.Load(context.Background()); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if list := r.List(); len(list) != 1 || list[0].EventType != "order_paid" {
+		t.Fatalf("expected only the valid stored schema, got %+v", list)
+	}
+}
@@ -0,0 +1,345 @@
+// Package schema validates event payloads against JSON Schemas registered
+// per event type.
+//
+// Only the structural subset of JSON Schema that payload checks need is
+// supported: type, properties, required, additionalProperties, items, enum,
+// const, minLength, maxLength, pattern, minimum, maximum, minItems and
+// maxItems. Annotations (title, description, format, ...) are ignored; any
+// other keyword, such as $ref or oneOf, is rejected when the schema is
+// compiled rather than silently not enforced.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a compiled JSON Schema
+type Schema struct {
+	root *node
+}
+
+// ValidationError lists every violation found in a payload
+type ValidationError struct {
+	Violations []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Violations, "; ")
+}
+
+type node struct {
+	types      []string
+	properties map[string]*node
+	required   []string
+	// additionalProperties: nil allows anything, noExtra forbids extra keys
+	additional *node
+	noExtra    bool
+	items      *node
+	enum       []interface{}
+	constant   interface{}
+	hasConst   bool
+	minLength  *int
+	maxLength  *int
+	pattern    *regexp.Regexp
+	minimum    *float64
+	maximum    *float64
+	minItems   *int
+	maxItems   *int
+}
+
+// annotations carry no validation rules
+var annotations = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true,
+	"default": true, "examples": true, "format": true, "deprecated": true,
+}
+
+var jsonTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true,
+	"integer": true, "boolean": true, "null": true,
+}
+
+// Compile parses a JSON Schema document
+func Compile(raw []byte) (*Schema, error) {
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("schema is not valid JSON: %w", err)
+	}
+	root, err := compileNode(doc, "$")
+	if err != nil {
+		return nil, err
+	}
+	return &Schema{root: root}, nil
+}
+
+func compileNode(doc interface{}, path string) (*node, error) {
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: schema must be an object", path)
+	}
+
+	n := &node{}
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys) // report the same error on every run
+
+	for _, key := range keys {
+		value := obj[key]
+		var err error
+		switch key {
+		case "type":
+			n.types, err = compileTypes(value, path)
+		case "properties":
+			props, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: properties must be an object", path)
+			}
+			n.properties = make(map[string]*node, len(props))
+			for name, prop := range props {
+				if n.properties[name], err = compileNode(prop, path+"."+name); err != nil {
+					return nil, err
+				}
+			}
+		case "required":
+			n.required, err = stringList(value, path, key)
+		case "additionalProperties":
+			switch v := value.(type) {
+			case bool:
+				n.noExtra = !v
+			default:
+				n.additional, err = compileNode(v, path+".*")
+			}
+		case "items":
+			n.items, err = compileNode(value, path+"[]")
+		case "enum":
+			list, ok := value.([]interface{})
+			if !ok || len(list) == 0 {
+				return nil, fmt.Errorf("%s: enum must be a non-empty array", path)
+			}
+			n.enum = list
+		case "const":
+			n.constant, n.hasConst = value, true
+		case "minLength":
+			n.minLength, err = count(value, path, key)
+		case "maxLength":
+			n.maxLength, err = count(value, path, key)
+		case "minItems":
+			n.minItems, err = count(value, path, key)
+		case "maxItems":
+			n.maxItems, err = count(value, path, key)
+		case "minimum":
+			n.minimum, err = number(value, path, key)
+		case "maximum":
+			n.maximum, err = number(value, path, key)
+		case "pattern":
+			s, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: pattern must be a string", path)
+			}
+			if n.pattern, err = regexp.Compile(s); err != nil {
+				return nil, fmt.Errorf("%s: invalid pattern: %w", path, err)
+			}
+		default:
+			if !annotations[key] {
+				return nil, fmt.Errorf("%s: unsupported keyword %q", path, key)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+func compileTypes(value interface{}, path string) ([]string, error) {
+	var types []string
+	switch v := value.(type) {
+	case string:
+		types = []string{v}
+	case []interface{}:
+		list, err := stringList(v, path, "type")
+		if err != nil {
+			return nil, err
+		}
+		types = list
+	default:
+		return nil, fmt.Errorf("%s: type must be a string or an array of strings", path)
+	}
+	for _, t := range types {
+		if !jsonTypes[t] {
+			return nil, fmt.Errorf("%s: unknown type %q", path, t)
+		}
+	}
+	return types, nil
+}
+
+func stringList(value interface{}, path, keyword string) ([]string, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: %s must be an array of strings", path, keyword)
+	}
+	out := make([]string, 0, len(list))
+	for _, item := range list {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: %s must be an array of strings", path, keyword)
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+func count(value interface{}, path, keyword string) (*int, error) {
+	f, ok := value.(float64)
+	if !ok || f < 0 || f != math.Trunc(f) {
+		return nil, fmt.Errorf("%s: %s must be a non-negative integer", path, keyword)
+	}
+	n := int(f)
+	return &n, nil
+}
+
+func number(value interface{}, path, keyword string) (*float64, error) {
+	f, ok := value.(float64)
+	if !ok {
+		return nil, fmt.Errorf("%s: %s must be a number", path, keyword)
+	}
+	return &f, nil
+}
+
+// Validate checks a JSON payload against the schema. It returns a
+// *ValidationError when the payload does not conform.
+func (s *Schema) Validate(data string) error {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(data)))
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		return &ValidationError{Violations: []string{"$: payload is not valid JSON"}}
+	}
+
+	var violations []string
+	s.root.validate(value, "$", &violations)
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+func (n *node) validate(value interface{}, path string, violations *[]string) {
+	fail := func(format string, args ...interface{}) {
+		*violations = append(*violations, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if len(n.types) > 0 && !matchesType(value, n.types) {
+		fail("expected %s, got %s", strings.Join(n.types, " or "), typeOf(value))
+		return
+	}
+	if n.hasConst && !reflect.DeepEqual(value, n.constant) {
+		fail("must be %v", n.constant)
+	}
+	if n.enum != nil && !inEnum(value, n.enum) {
+		fail("must be one of %v", n.enum)
+	}
+
+	switch v := value.(type) {
+	case string:
+		length := utf8.RuneCountInString(v)
+		if n.minLength != nil && length < *n.minLength {
+			fail("must be at least %d characters", *n.minLength)
+		}
+		if n.maxLength != nil && length > *n.maxLength {
+			fail("must be at most %d characters", *n.maxLength)
+		}
+		if n.pattern != nil && !n.pattern.MatchString(v) {
+			fail("must match %s", n.pattern)
+		}
+	case float64:
+		if n.minimum != nil && v < *n.minimum {
+			fail("must be at least %v", *n.minimum)
+		}
+		if n.maximum != nil && v > *n.maximum {
+			fail("must be at most %v", *n.maximum)
+		}
+	case []interface{}:
+		if n.minItems != nil && len(v) < *n.minItems {
+			fail("must have at least %d items", *n.minItems)
+		}
+		if n.maxItems != nil && len(v) > *n.maxItems {
+			fail("must have at most %d items", *n.maxItems)
+		}
+		if n.items != nil {
+			for i, item := range v {
+				n.items.validate(item, fmt.Sprintf("%s[%d]", path, i), violations)
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range n.required {
+			if _, ok := v[name]; !ok {
+				*violations = append(*violations, path+"."+name+": is required")
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if prop, ok := n.properties[name]; ok {
+				prop.validate(v[name], path+"."+name, violations)
+				continue
+			}
+			switch {
+			case n.noExtra:
+				*violations = append(*violations, path+"."+name+": is not allowed")
+			case n.additional != nil:
+				n.additional.validate(v[name], path+"."+name, violations)
+			}
+		}
+	}
+}
+
+func matchesType(value interface{}, types []string) bool {
+	actual := typeOf(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func inEnum(value interface{}, enum []interface{}) bool {
+	for _, allowed := range enum {
+		if reflect.DeepEqual(value, allowed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package schema
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const userSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"title": "user_created",
+	"type": "object",
+	"required": ["email", "age"],
+	"additionalProperties": false,
+	"properties": {
+		"email": {"type": "string", "pattern": "@", "maxLength": 64},
+		"age": {"type": "integer", "minimum": 0, "maximum": 150},
+		"plan": {"enum": ["free", "pro"]},
+		"tags": {"type": "array", "maxItems": 2, "items": {"type": "string", "minLength": 1}}
+	}
+}`
+
+func TestValidate(t *testing.T) {
+	s, err := Compile([]byte(userSchema))
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	if err := s.Validate(`{"email": "a@b.c", "age": 30, "plan": "pro", "tags": ["x"]}`); err != nil {
+		t.Fatalf("expected valid payload, got %v", err)
+	}
+
+	cases := map[string]struct {
+		data string
+		want string
+	}{
+		"wrong type":    {`{"email": 1, "age": 30}`, "$.email: expected string, got integer"},
+		"missing":       {`{"email": "a@b.c"}`, "$.age: is required"},
+		"fraction":      {`{"email": "a@b.c", "age": 1.5}`, "$.age: expected integer, got number"},
+		"range":         {`{"email": "a@b.c", "age": 200}`, "$.age: must be at most 150"},
+		"pattern":       {`{"email": "nope", "age": 1}`, "$.email: must match @"},
+		"enum":          {`{"email": "a@b.c", "age": 1, "plan": "gold"}`, "$.plan: must be one of"},
+		"extra":         {`{"email": "a@b.c", "age": 1, "admin": true}`, "$.admin: is not allowed"},
+		"items":         {`{"email": "a@b.c", "age": 1, "tags": [""]}`, "$.tags[0]: must be at least 1 characters"},
+		"max items":     {`{"email": "a@b.c", "age": 1, "tags": ["a", "b", "c"]}`, "$.tags: must have at most 2 items"},
+		"not an object": {`[]`, "$: expected object, got array"},
+		"not json":      {`{"email":`, "$: payload is not valid JSON"},
+	}
+	for name, tc := range cases {
+		err := s.Validate(tc.data)
+		var verr *ValidationError
+		if !errors.As(err, &verr) || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: expected %q, got %v", name, tc.want, err)
+		}
+	}
+}
+
+func TestValidate_ReportsEveryViolation(t *testing.T) {
+	s, err := Compile([]byte(userSchema))
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	var verr *ValidationError
+	if err := s.Validate(`{"email": "nope", "age": -1}`); !errors.As(err, &verr) || len(verr.Violations) != 2 {
+		t.Fatalf("expected two violations, got %v", err)
+	}
+}
+
+func TestCompile_RejectsUnsupportedKeywords(t *testing.T) {
+	for _, raw := range []string{
+		`{"$ref": "#/definitions/x"}`,
+		`{"oneOf": [{"type": "string"}]}`,
+		`{"type": "text"}`,
+		`{"properties": {"a": {"minLength": -1}}}`,
+		`{"pattern": "("}`,
+		`"string"`,
+	} {
+		if _, err := Compile([]byte(raw)); err == nil {
+			t.Errorf("expected %s to be rejected", raw)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"highload-microservice/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// SQLStore keeps event schemas in the event_schemas table
+type SQLStore struct {
+	db     *sql.DB
+	upsert string
+}
+
+func NewSQLStore(db *sql.DB, dialect database.Dialect) *SQLStore {
+	return &SQLStore{
+		db: db,
+		upsert: dialect.Upsert("event_schemas",
+			[]string{"event_type", "definition", "updated_by", "updated_at"},
+			[]string{"event_type"},
+			[]string{"definition", "updated_by", "updated_at"}),
+	}
+}
+
+func (s *SQLStore) ListSchemas(ctx context.Context) ([]EventSchema, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT event_type, definition, updated_by, updated_at
+		FROM event_schemas ORDER BY event_type
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list event schemas: %w", err)
+	}
+	defer rows.Close()
+
+	var schemas []EventSchema
+	for rows.Next() {
+		var (
+			schema     EventSchema
+			definition string
+			updatedBy  sql.NullString
+		)
+		if err := rows.Scan(&schema.EventType, &definition, &updatedBy, &schema.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan event schema: %w", err)
+		}
+		schema.Schema = []byte(definition)
+		schema.Source = SourceDatabase
+		if updatedBy.Valid {
+			if id, err := uuid.Parse(updatedBy.String); err == nil {
+				schema.UpdatedBy = &id
+			}
+		}
+		schemas = append(schemas, schema)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list event schemas: %w", err)
+	}
+	return schemas, nil
+}
+
+func (s *SQLStore) SaveSchema(ctx context.Context, schema EventSchema) error {
+	_, err := s.db.ExecContext(ctx, s.upsert, schema.EventType, string(schema.Schema), schema.UpdatedBy, schema.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save event schema: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) DeleteSchema(ctx context.Context, eventType string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM event_schemas WHERE event_type = $1`, eventType)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete event schema: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return err != nil || n > 0, nil
+}
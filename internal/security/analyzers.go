@@ -2,9 +2,12 @@ package security
 
 import (
 	"fmt"
+	"math"
 	"sync"
 	"time"
 
+	"highload-microservice/internal/geoip"
+
 	"github.com/google/uuid"
 )
 
@@ -237,6 +240,112 @@ func (rla *RateLimitAnalyzer) Analyze(event SecurityEvent) (*SecurityAlert, erro
 	return nil, nil
 }
 
+const (
+	// impossibleTravelWindow is how long a login location is remembered
+	impossibleTravelWindow = 24 * time.Hour
+	// impossibleTravelSpeedKmh is faster than any commercial flight
+	impossibleTravelSpeedKmh = 1000.0
+	// impossibleTravelMinKm ignores hops within the accuracy of GeoIP data
+	impossibleTravelMinKm = 500.0
+)
+
+// lastLogin is where and when a user last logged in
+type lastLogin struct {
+	eventID   string
+	ipAddress string
+	at        time.Time
+	location  geoip.Location
+}
+
+// ImpossibleTravelAnalyzer detects logins of a user from places too far
+// apart to travel between in the time since the previous login. It needs
+// events located with coordinates, see SecurityAuditor.SetGeoLocator.
+type ImpossibleTravelAnalyzer struct {
+	logins map[uuid.UUID]lastLogin
+	pruned time.Time
+	mu     sync.Mutex
+}
+
+// NewImpossibleTravelAnalyzer creates a new impossible travel analyzer
+func NewImpossibleTravelAnalyzer() *ImpossibleTravelAnalyzer {
+	return &ImpossibleTravelAnalyzer{
+		logins: make(map[uuid.UUID]lastLogin),
+	}
+}
+
+// Analyze compares a successful login with the user's previous one
+func (ita *ImpossibleTravelAnalyzer) Analyze(event SecurityEvent) (*SecurityAlert, error) {
+	if event.EventType != EventTypeLoginSuccess || event.UserID == nil || event.Geo == nil || !event.Geo.HasCoordinates {
+		return nil, nil
+	}
+
+	ita.mu.Lock()
+	defer ita.mu.Unlock()
+
+	current := lastLogin{eventID: event.ID, ipAddress: event.IPAddress, at: event.Timestamp, location: *event.Geo}
+	previous, ok := ita.logins[*event.UserID]
+	ita.logins[*event.UserID] = current
+
+	// Drop logins nobody can be compared with any more, once an hour
+	cutoff := time.Now().Add(-impossibleTravelWindow)
+	if time.Since(ita.pruned) > time.Hour {
+		for userID, login := range ita.logins {
+			if login.at.Before(cutoff) {
+				delete(ita.logins, userID)
+			}
+		}
+		ita.pruned = time.Now()
+	}
+	if !ok || previous.at.Before(cutoff) {
+		return nil, nil
+	}
+
+	distance := geoip.DistanceKm(previous.location, current.location)
+	if distance < impossibleTravelMinKm {
+		return nil, nil
+	}
+	elapsed := current.at.Sub(previous.at)
+	hours := math.Max(elapsed.Hours(), 1.0/60) // logins in the same minute
+	speed := distance / hours
+	if speed <= impossibleTravelSpeedKmh {
+		return nil, nil
+	}
+
+	return &SecurityAlert{
+		ID:        uuid.New().String(),
+		Timestamp: time.Now(),
+		Severity:  SeverityHigh,
+		Title:     "Impossible Travel Detected",
+		Description: fmt.Sprintf("User %s logged in from %s and %s, %.0f km apart, within %s",
+			event.UserID, placeName(previous.location), placeName(current.location), distance, elapsed.Round(time.Minute)),
+		EventIDs:  []string{previous.eventID, event.ID},
+		RiskScore: 80,
+		Actions: []string{
+			"Confirm the logins with the user",
+			"Consider revoking the user's sessions",
+			"Check for credential compromise",
+		},
+		Metadata: map[string]interface{}{
+			"user_id":             event.UserID.String(),
+			"ip_address":          event.IPAddress,
+			"country":             current.location.Country,
+			"previous_ip_address": previous.ipAddress,
+			"previous_country":    previous.location.Country,
+			"distance_km":         math.Round(distance),
+			"speed_kmh":           math.Round(speed),
+			"attack_type":         "impossible_travel",
+		},
+	}, nil
+}
+
+// placeName describes a location for alert descriptions
+func placeName(loc geoip.Location) string {
+	if loc.City != "" {
+		return loc.City + ", " + loc.Country
+	}
+	return loc.Country
+}
+
 // SecurityMetrics tracks security metrics
 type SecurityMetrics struct {
 	TotalEvents          int64 `json:"total_events"`
@@ -0,0 +1,68 @@
+package security
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/geoip"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// fixedLocator maps IP addresses to locations
+type fixedLocator map[string]geoip.Location
+
+func (l fixedLocator) Lookup(ip netip.Addr) (geoip.Location, bool) {
+	loc, ok := l[ip.String()]
+	return loc, ok
+}
+
+func TestImpossibleTravelAnalyzer(t *testing.T) {
+	berlin := &geoip.Location{Country: "DE", City: "Berlin", Latitude: 52.52, Longitude: 13.405, HasCoordinates: true}
+	potsdam := &geoip.Location{Country: "DE", City: "Potsdam", Latitude: 52.39, Longitude: 13.065, HasCoordinates: true}
+	sydney := &geoip.Location{Country: "AU", City: "Sydney", Latitude: -33.87, Longitude: 151.21, HasCoordinates: true}
+
+	userID := uuid.New()
+	start := time.Now().Add(-3 * time.Hour)
+	login := func(at time.Time, loc *geoip.Location) SecurityEvent {
+		return SecurityEvent{ID: uuid.NewString(), EventType: EventTypeLoginSuccess, UserID: &userID, Timestamp: at, Geo: loc}
+	}
+
+	analyzer := NewImpossibleTravelAnalyzer()
+	for _, event := range []SecurityEvent{login(start, berlin), login(start.Add(10*time.Minute), potsdam)} {
+		if alert, _ := analyzer.Analyze(event); alert != nil {
+			t.Fatalf("unexpected alert: %+v", alert)
+		}
+	}
+	alert, _ := analyzer.Analyze(login(start.Add(2*time.Hour), sydney))
+	if alert == nil || alert.Severity != SeverityHigh || alert.Metadata["previous_country"] != "DE" || alert.Metadata["country"] != "AU" {
+		t.Fatalf("want an impossible travel alert, got %+v", alert)
+	}
+
+	// A day later the flight is possible; logins without coordinates are ignored
+	if alert, _ := analyzer.Analyze(login(start.Add(26*time.Hour), berlin)); alert != nil {
+		t.Fatalf("unexpected alert after a day: %+v", alert)
+	}
+	if alert, _ := analyzer.Analyze(login(start.Add(26*time.Hour+time.Minute), &geoip.Location{Country: "AU"})); alert != nil {
+		t.Fatalf("unexpected alert without coordinates: %+v", alert)
+	}
+}
+
+func TestSecurityAuditor_LocatesEvents(t *testing.T) {
+	auditor := NewSecurityAuditor(logrus.New())
+	auditor.SetGeoLocator(fixedLocator{"203.0.113.7": {Country: "NZ", ASN: 64500}})
+
+	located := SecurityEvent{IPAddress: "203.0.113.7"}
+	auditor.locate(&located)
+	if located.Geo == nil || located.Geo.Country != "NZ" || located.Geo.ASN != 64500 {
+		t.Fatalf("unexpected location: %+v", located.Geo)
+	}
+	for _, ip := range []string{"198.51.100.1", "not-an-ip", ""} {
+		event := SecurityEvent{IPAddress: ip}
+		if auditor.locate(&event); event.Geo != nil {
+			t.Errorf("%q: want no location, got %+v", ip, event.Geo)
+		}
+	}
+}
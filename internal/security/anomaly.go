@@ -0,0 +1,293 @@
+package security
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AnomalyThresholds tune AnomalyAnalyzer. They can be changed at runtime.
+type AnomalyThresholds struct {
+	Enabled bool `json:"enabled"`
+	// WindowSeconds is the length of one observation window
+	WindowSeconds int `json:"window_seconds"`
+	// MinBaselineWindows is how many windows of a client are observed before
+	// it can raise alerts
+	MinBaselineWindows int `json:"min_baseline_windows"`
+	// MinRequests ignores windows with fewer requests
+	MinRequests int `json:"min_requests"`
+	// ZScore is how many standard deviations above its baseline a value must be
+	ZScore float64 `json:"z_score"`
+	// The factors are how many times its baseline a value must be
+	RateFactor         float64 `json:"rate_factor"`
+	FanOutFactor       float64 `json:"fan_out_factor"`
+	ErrorRateFactor    float64 `json:"error_rate_factor"`
+	UnauthorizedFactor float64 `json:"unauthorized_factor"`
+}
+
+// DefaultAnomalyThresholds are used until SetThresholds is called
+func DefaultAnomalyThresholds() AnomalyThresholds {
+	return AnomalyThresholds{
+		Enabled:            true,
+		WindowSeconds:      60,
+		MinBaselineWindows: 10,
+		MinRequests:        20,
+		ZScore:             3,
+		RateFactor:         5,
+		FanOutFactor:       5,
+		ErrorRateFactor:    3,
+		UnauthorizedFactor: 5,
+	}
+}
+
+// Validate reports thresholds that would alert on every request or never
+func (t AnomalyThresholds) Validate() error {
+	switch {
+	case t.WindowSeconds < 1:
+		return errors.New("window_seconds must be positive")
+	case t.MinBaselineWindows < 1:
+		return errors.New("min_baseline_windows must be positive")
+	case t.MinRequests < 1:
+		return errors.New("min_requests must be positive")
+	case t.ZScore < 0:
+		return errors.New("z_score must not be negative")
+	case t.RateFactor <= 1 || t.FanOutFactor <= 1 || t.ErrorRateFactor <= 1 || t.UnauthorizedFactor <= 1:
+		return errors.New("factors must be greater than 1")
+	}
+	return nil
+}
+
+const (
+	// anomalyAlpha is the weight of the latest window in a baseline
+	anomalyAlpha = 0.1
+	// anomalyIdleTTL is how long the baseline of an idle client is kept
+	anomalyIdleTTL = 24 * time.Hour
+	// maxAnomalyClients bounds the clients tracked; further ones are ignored
+	maxAnomalyClients = 100000
+	// maxWindowEndpoints bounds the distinct endpoints counted per window
+	maxWindowEndpoints = 1000
+)
+
+// anomalyMetric is a measure of a client's traffic in one window
+type anomalyMetric int
+
+const (
+	metricRate anomalyMetric = iota
+	metricFanOut
+	metricErrorRate
+	metricUnauthorized
+	metricCount
+)
+
+var anomalyMetricNames = [metricCount]string{"request_rate", "endpoint_fan_out", "error_rate", "unauthorized"}
+
+// anomalyFloors keep a baseline near zero from turning any activity into a
+// large multiple of it
+var anomalyFloors = [metricCount]float64{1, 1, 0.05, 1}
+
+// baseline is an exponentially weighted mean and variance
+type baseline struct {
+	mean, variance float64
+}
+
+func (b *baseline) add(value float64) {
+	diff := value - b.mean
+	b.mean += anomalyAlpha * diff
+	b.variance = (1 - anomalyAlpha) * (b.variance + anomalyAlpha*diff*diff)
+}
+
+// clientTraffic is the baseline and current window of one IP or user
+type clientTraffic struct {
+	baselines [metricCount]baseline
+	windows   int // windows folded into the baselines
+
+	windowStart  time.Time
+	requests     int
+	errors       int
+	unauthorized int
+	endpoints    map[string]struct{}
+	alerted      bool // at most one alert per window
+}
+
+func (ct *clientTraffic) values() [metricCount]float64 {
+	var v [metricCount]float64
+	v[metricRate] = float64(ct.requests)
+	v[metricFanOut] = float64(len(ct.endpoints))
+	if ct.requests > 0 {
+		v[metricErrorRate] = float64(ct.errors) / float64(ct.requests)
+	}
+	v[metricUnauthorized] = float64(ct.unauthorized)
+	return v
+}
+
+// AnomalyAnalyzer keeps rolling baselines of the request rate, number of
+// distinct endpoints, error rate and 401 responses of every IP and user, and
+// raises an alert when a window deviates from them both by a factor and
+// statistically. Windows without requests are not part of the baselines.
+//
+// It is fed one event per HTTP request by SecurityAuditor.ObserveRequest,
+// not the audit event stream.
+type AnomalyAnalyzer struct {
+	mu         sync.Mutex
+	thresholds AnomalyThresholds
+	clients    map[string]*clientTraffic
+	pruned     time.Time
+}
+
+// NewAnomalyAnalyzer creates an anomaly analyzer with the default thresholds
+func NewAnomalyAnalyzer() *AnomalyAnalyzer {
+	return &AnomalyAnalyzer{
+		thresholds: DefaultAnomalyThresholds(),
+		clients:    make(map[string]*clientTraffic),
+	}
+}
+
+// Thresholds returns the current thresholds
+func (aa *AnomalyAnalyzer) Thresholds() AnomalyThresholds {
+	aa.mu.Lock()
+	defer aa.mu.Unlock()
+	return aa.thresholds
+}
+
+// SetThresholds replaces the thresholds. Baselines are kept, except when the
+// window length changes.
+func (aa *AnomalyAnalyzer) SetThresholds(t AnomalyThresholds) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	aa.mu.Lock()
+	defer aa.mu.Unlock()
+	if t.WindowSeconds != aa.thresholds.WindowSeconds {
+		aa.clients = make(map[string]*clientTraffic)
+	}
+	aa.thresholds = t
+	return nil
+}
+
+// Analyze counts event as a request of its IP and, when set, its user
+func (aa *AnomalyAnalyzer) Analyze(event SecurityEvent) (*SecurityAlert, error) {
+	aa.mu.Lock()
+	defer aa.mu.Unlock()
+	if !aa.thresholds.Enabled {
+		return nil, nil
+	}
+
+	now := event.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	if now.Sub(aa.pruned) > time.Hour {
+		for key, ct := range aa.clients {
+			if now.Sub(ct.windowStart) > anomalyIdleTTL {
+				delete(aa.clients, key)
+			}
+		}
+		aa.pruned = now
+	}
+
+	var alert *SecurityAlert
+	if event.IPAddress != "" {
+		alert = aa.observe("ip:"+event.IPAddress, event, now)
+	}
+	if event.UserID != nil {
+		if userAlert := aa.observe("user:"+event.UserID.String(), event, now); alert == nil {
+			alert = userAlert
+		}
+	}
+	return alert, nil
+}
+
+// observe adds a request to the current window of key and checks it
+func (aa *AnomalyAnalyzer) observe(key string, event SecurityEvent, now time.Time) *SecurityAlert {
+	ct := aa.clients[key]
+	if ct == nil {
+		if len(aa.clients) >= maxAnomalyClients {
+			return nil
+		}
+		ct = &clientTraffic{windowStart: now, endpoints: make(map[string]struct{})}
+		aa.clients[key] = ct
+	}
+
+	window := time.Duration(aa.thresholds.WindowSeconds) * time.Second
+	if now.Sub(ct.windowStart) >= window {
+		if ct.requests > 0 {
+			values := ct.values()
+			for m := range ct.baselines {
+				ct.baselines[m].add(values[m])
+			}
+			ct.windows++
+		}
+		ct.windowStart = now
+		ct.requests, ct.errors, ct.unauthorized, ct.alerted = 0, 0, 0, false
+		clear(ct.endpoints)
+	}
+
+	ct.requests++
+	if event.Status >= 400 {
+		ct.errors++
+	}
+	if event.Status == 401 {
+		ct.unauthorized++
+	}
+	if len(ct.endpoints) < maxWindowEndpoints {
+		ct.endpoints[event.Method+" "+event.Endpoint] = struct{}{}
+	}
+
+	// Counts only grow within a window, so a spike is reported as soon as it
+	// crosses the thresholds rather than when the window ends
+	if ct.alerted || ct.windows < aa.thresholds.MinBaselineWindows || ct.requests < aa.thresholds.MinRequests {
+		return nil
+	}
+	values := ct.values()
+	factors := [metricCount]float64{aa.thresholds.RateFactor, aa.thresholds.FanOutFactor, aa.thresholds.ErrorRateFactor, aa.thresholds.UnauthorizedFactor}
+	var deviations []string
+	details := map[string]interface{}{}
+	for m := anomalyMetric(0); m < metricCount; m++ {
+		b := ct.baselines[m]
+		expected := math.Max(b.mean, anomalyFloors[m])
+		if values[m] < factors[m]*expected || values[m]-b.mean <= aa.thresholds.ZScore*math.Sqrt(b.variance) {
+			continue
+		}
+		name := anomalyMetricNames[m]
+		deviations = append(deviations, fmt.Sprintf("%s %.2f vs baseline %.2f", name, values[m], b.mean))
+		details[name] = map[string]interface{}{
+			"value":    math.Round(values[m]*100) / 100,
+			"baseline": math.Round(b.mean*100) / 100,
+			"stddev":   math.Round(math.Sqrt(b.variance)*100) / 100,
+		}
+	}
+	if len(deviations) == 0 {
+		return nil
+	}
+	ct.alerted = true
+
+	severity := SeverityMedium
+	if len(deviations) > 1 {
+		severity = SeverityHigh
+	}
+	details["client"] = key
+	details["ip_address"] = event.IPAddress
+	details["window_seconds"] = aa.thresholds.WindowSeconds
+	details["attack_type"] = "traffic_anomaly"
+	return &SecurityAlert{
+		ID:          uuid.New().String(),
+		Timestamp:   time.Now(),
+		Severity:    severity,
+		EventType:   EventTypeUnusualActivity,
+		Title:       "Traffic Anomaly Detected",
+		Description: fmt.Sprintf("%s deviates from its baseline: %s", key, strings.Join(deviations, "; ")),
+		EventIDs:    []string{},
+		RiskScore:   min(100, 50+15*len(deviations)),
+		Actions: []string{
+			"Review the client's recent requests",
+			"Consider rate limiting or blocking the client",
+			"Check for scanning or credential stuffing",
+		},
+		Metadata: details,
+	}
+}
@@ -0,0 +1,88 @@
+package security
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestAnomalyAnalyzer_DetectsDeviations(t *testing.T) {
+	analyzer := NewAnomalyAnalyzer()
+	thresholds := DefaultAnomalyThresholds()
+	thresholds.MinBaselineWindows = 5
+	if err := analyzer.SetThresholds(thresholds); err != nil {
+		t.Fatalf("thresholds: %v", err)
+	}
+
+	userID := uuid.New()
+	start := time.Now().Add(-time.Hour)
+	request := func(at time.Time, endpoint string, status int) *SecurityAlert {
+		alert, _ := analyzer.Analyze(SecurityEvent{Timestamp: at, IPAddress: "10.0.0.1", UserID: &userID,
+			Method: "GET", Endpoint: endpoint, Status: status})
+		return alert
+	}
+
+	// Baseline: 20 requests a minute to two endpoints, all successful
+	var at time.Time
+	for window := 0; window < 6; window++ {
+		for i := 0; i < 20; i++ {
+			at = start.Add(time.Duration(window)*time.Minute + time.Duration(i)*time.Second)
+			if alert := request(at, fmt.Sprintf("/api/v1/events/%d", i%2), 200); alert != nil {
+				t.Fatalf("unexpected alert in window %d: %+v", window, alert)
+			}
+		}
+	}
+
+	// The next window fans out to many endpoints with 401s
+	var alert *SecurityAlert
+	for i := 0; i < 20 && alert == nil; i++ {
+		alert = request(start.Add(6*time.Minute+time.Duration(i)*time.Second), fmt.Sprintf("/admin/%d", i), 401)
+	}
+	if alert == nil {
+		t.Fatal("want a traffic anomaly alert")
+	}
+	for _, metric := range []string{"endpoint_fan_out", "error_rate", "unauthorized"} {
+		if _, ok := alert.Metadata[metric]; !ok {
+			t.Errorf("want %s in the alert, got %v", metric, alert.Metadata)
+		}
+	}
+	if _, ok := alert.Metadata["request_rate"]; ok {
+		t.Errorf("the request rate is within its baseline: %v", alert.Metadata)
+	}
+	if alert.Severity != SeverityHigh || alert.EventType != EventTypeUnusualActivity {
+		t.Fatalf("unexpected alert: %+v", alert)
+	}
+
+	// One alert per client and window
+	if again := request(start.Add(6*time.Minute+30*time.Second), "/admin/x", 401); again != nil {
+		t.Fatalf("want no second alert in the window, got %+v", again)
+	}
+
+	thresholds.Enabled = false
+	_ = analyzer.SetThresholds(thresholds)
+	for i := 0; i < 40; i++ {
+		if alert := request(start.Add(7*time.Minute+time.Duration(i)*time.Second), fmt.Sprintf("/scan/%d", i), 404); alert != nil {
+			t.Fatalf("disabled detector raised %+v", alert)
+		}
+	}
+}
+
+func TestAnomalyThresholds_Validate(t *testing.T) {
+	if err := DefaultAnomalyThresholds().Validate(); err != nil {
+		t.Fatalf("defaults: %v", err)
+	}
+	for _, mutate := range []func(*AnomalyThresholds){
+		func(th *AnomalyThresholds) { th.WindowSeconds = 0 },
+		func(th *AnomalyThresholds) { th.MinRequests = 0 },
+		func(th *AnomalyThresholds) { th.ZScore = -1 },
+		func(th *AnomalyThresholds) { th.FanOutFactor = 1 },
+	} {
+		th := DefaultAnomalyThresholds()
+		mutate(&th)
+		if err := NewAnomalyAnalyzer().SetThresholds(th); err == nil {
+			t.Errorf("want an error for %+v", th)
+		}
+	}
+}
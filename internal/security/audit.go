@@ -1,8 +1,14 @@
 package security
 
 import (
+	"net/netip"
+	"sync"
 	"time"
 
+	"highload-microservice/internal/geoip"
+	"highload-microservice/internal/password"
+	"highload-microservice/internal/redact"
+
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
@@ -23,6 +29,7 @@ type SecurityEvent struct {
 	Details   map[string]interface{} `json:"details"`
 	RiskScore int                    `json:"risk_score"`
 	Blocked   bool                   `json:"blocked"`
+	Geo       *geoip.Location        `json:"geo,omitempty"` // set when a GeoIP database is configured
 }
 
 // SecurityEventType represents the type of security event
@@ -30,12 +37,20 @@ type SecurityEventType string
 
 const (
 	// Authentication events
-	EventTypeLoginSuccess SecurityEventType = "login_success"
-	EventTypeLoginFailure SecurityEventType = "login_failure"
-	EventTypeLogout       SecurityEventType = "logout"
-	EventTypeTokenRefresh SecurityEventType = "token_refresh"
-	EventTypeTokenExpired SecurityEventType = "token_expired"
-	EventTypeInvalidToken SecurityEventType = "invalid_token"
+	EventTypeLoginSuccess      SecurityEventType = "login_success"
+	EventTypeLoginFailure      SecurityEventType = "login_failure"
+	EventTypeLogout            SecurityEventType = "logout"
+	EventTypeTokenRefresh      SecurityEventType = "token_refresh"
+	EventTypeTokenExpired      SecurityEventType = "token_expired"
+	EventTypeInvalidToken      SecurityEventType = "invalid_token"
+	EventTypeAccountLocked     SecurityEventType = "account_locked"
+	EventTypeAccountUnlocked   SecurityEventType = "account_unlocked"
+	EventTypeRefreshTokenReuse SecurityEventType = "refresh_token_reuse"
+	EventTypeSessionsRevoked   SecurityEventType = "sessions_revoked"
+	EventTypeRegistration      SecurityEventType = "registration"
+	EventTypeEmailVerification SecurityEventType = "email_verification"
+	EventTypeInvitation        SecurityEventType = "invitation"
+	EventTypeProfileUpdated    SecurityEventType = "profile_updated"
 
 	// Authorization events
 	EventTypeAccessGranted       SecurityEventType = "access_granted"
@@ -84,6 +99,31 @@ type SecurityAuditor struct {
 	logger    *logrus.Logger
 	events    chan SecurityEvent
 	analyzers []SecurityAnalyzer
+	redactor  *redact.Redactor
+	persister *persister
+	geo       geoip.Locator
+	anomaly   *AnomalyAnalyzer
+	outputs   []EventOutput
+
+	// Recent alerts and live subscribers (admin dashboard SSE stream)
+	alertsMutex  sync.RWMutex
+	recentAlerts []SecurityAlert
+	subscribers  map[chan SecurityAlert]struct{}
+
+	// Counts for GetSecurityStats, refreshed by AggregateStats
+	statsMutex sync.RWMutex
+	stats      securityStats
+}
+
+// maxRecentAlerts bounds the in-memory alert history
+const maxRecentAlerts = 100
+
+// EventOutput receives every processed event and raised alert, for example
+// to forward them to a SIEM. Alerts may be sent from request goroutines, so
+// implementations must be safe for concurrent use and must not block.
+type EventOutput interface {
+	SendEvent(event SecurityEvent)
+	SendAlert(alert SecurityAlert)
 }
 
 // SecurityAnalyzer interface for analyzing security events
@@ -96,6 +136,7 @@ type SecurityAlert struct {
 	ID          string                 `json:"id"`
 	Timestamp   time.Time              `json:"timestamp"`
 	Severity    SecuritySeverity       `json:"severity"`
+	EventType   SecurityEventType      `json:"event_type,omitempty"` // type of the event that raised it
 	Title       string                 `json:"title"`
 	Description string                 `json:"description"`
 	EventIDs    []string               `json:"event_ids"`
@@ -107,12 +148,16 @@ type SecurityAlert struct {
 // NewSecurityAuditor creates a new security auditor
 func NewSecurityAuditor(logger *logrus.Logger) *SecurityAuditor {
 	auditor := &SecurityAuditor{
-		logger: logger,
-		events: make(chan SecurityEvent, 1000),
+		logger:      logger,
+		events:      make(chan SecurityEvent, 1000),
+		subscribers: make(map[chan SecurityAlert]struct{}),
+		redactor:    redact.Default(),
+		anomaly:     NewAnomalyAnalyzer(),
 		analyzers: []SecurityAnalyzer{
 			NewBruteForceAnalyzer(),
 			NewSuspiciousActivityAnalyzer(),
 			NewRateLimitAnalyzer(),
+			NewImpossibleTravelAnalyzer(),
 		},
 	}
 
@@ -122,6 +167,38 @@ func NewSecurityAuditor(logger *logrus.Logger) *SecurityAuditor {
 	return auditor
 }
 
+// SetRedactor replaces the redactor applied to events and alerts. Must be
+// called before events are logged.
+func (sa *SecurityAuditor) SetRedactor(r *redact.Redactor) {
+	sa.redactor = r
+}
+
+// SetGeoLocator enriches events with the location of their IP address. Must
+// be called before events are logged.
+func (sa *SecurityAuditor) SetGeoLocator(locator geoip.Locator) {
+	sa.geo = locator
+}
+
+// AddOutput sends events and alerts to out as well. Must be called before
+// events are logged.
+func (sa *SecurityAuditor) AddOutput(out EventOutput) {
+	sa.outputs = append(sa.outputs, out)
+}
+
+// locate sets the location of event from its IP address
+func (sa *SecurityAuditor) locate(event *SecurityEvent) {
+	if sa.geo == nil || event.Geo != nil {
+		return
+	}
+	ip, err := netip.ParseAddr(event.IPAddress)
+	if err != nil {
+		return
+	}
+	if loc, ok := sa.geo.Lookup(ip); ok {
+		event.Geo = &loc
+	}
+}
+
 // LogEvent logs a security event
 func (sa *SecurityAuditor) LogEvent(event SecurityEvent) {
 	// Set default values
@@ -135,6 +212,12 @@ func (sa *SecurityAuditor) LogEvent(event SecurityEvent) {
 		event.Details = make(map[string]interface{})
 	}
 
+	// Mask PII and credentials before the event is stored, analyzed or logged
+	event.Details = sa.redactor.Map(event.Details)
+	event.UserAgent = sa.redactor.String(event.UserAgent)
+	event.Endpoint = sa.redactor.String(event.Endpoint)
+	sa.locate(&event)
+
 	// Calculate risk score if not set
 	if event.RiskScore == 0 {
 		event.RiskScore = sa.calculateRiskScore(event)
@@ -179,6 +262,216 @@ func (sa *SecurityAuditor) LogLoginFailure(email, ipAddress, userAgent, requestI
 	})
 }
 
+// LogAccountLocked logs an account being locked after repeated failed logins
+func (sa *SecurityAuditor) LogAccountLocked(userID uuid.UUID, ipAddress, userAgent, requestID string, until time.Time) {
+	sa.LogEvent(SecurityEvent{
+		EventType: EventTypeAccountLocked,
+		Severity:  SeverityHigh,
+		UserID:    &userID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		RequestID: requestID,
+		Blocked:   true,
+		Details: map[string]interface{}{
+			"locked_until": until.Format(time.RFC3339),
+		},
+	})
+}
+
+// LogAccountUnlocked logs an administrator unlocking an account
+func (sa *SecurityAuditor) LogAccountUnlocked(userID, adminID uuid.UUID, ipAddress, userAgent, requestID string) {
+	sa.LogEvent(SecurityEvent{
+		EventType: EventTypeAccountUnlocked,
+		Severity:  SeverityMedium,
+		UserID:    &userID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		RequestID: requestID,
+		Details: map[string]interface{}{
+			"unlocked_by": adminID.String(),
+		},
+	})
+}
+
+// LogRefreshTokenReuse logs a rotated refresh token being presented again,
+// which means the token family was stolen and has been revoked
+func (sa *SecurityAuditor) LogRefreshTokenReuse(userID, familyID uuid.UUID, ipAddress, userAgent, requestID string) {
+	sa.LogEvent(SecurityEvent{
+		EventType: EventTypeRefreshTokenReuse,
+		Severity:  SeverityHigh,
+		UserID:    &userID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		RequestID: requestID,
+		Blocked:   true,
+		Details: map[string]interface{}{
+			"token_family": familyID.String(),
+		},
+	})
+}
+
+// LogLogout logs a user logging out
+func (sa *SecurityAuditor) LogLogout(userID uuid.UUID, ipAddress, userAgent, requestID string) {
+	sa.LogEvent(SecurityEvent{
+		EventType: EventTypeLogout,
+		Severity:  SeverityLow,
+		UserID:    &userID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		RequestID: requestID,
+	})
+}
+
+// LogSessionsRevoked logs a user revoking all of their sessions
+func (sa *SecurityAuditor) LogSessionsRevoked(userID uuid.UUID, ipAddress, userAgent, requestID string, revoked int64) {
+	sa.LogEvent(SecurityEvent{
+		EventType: EventTypeSessionsRevoked,
+		Severity:  SeverityLow,
+		UserID:    &userID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		RequestID: requestID,
+		Details: map[string]interface{}{
+			"revoked": revoked,
+		},
+	})
+}
+
+// LogSessionRevoked logs a user revoking one of their sessions
+func (sa *SecurityAuditor) LogSessionRevoked(userID, sessionID uuid.UUID, ipAddress, userAgent, requestID string) {
+	sa.LogEvent(SecurityEvent{
+		EventType: EventTypeSessionsRevoked,
+		Severity:  SeverityLow,
+		UserID:    &userID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		RequestID: requestID,
+		Details: map[string]interface{}{
+			"revoked":    1,
+			"session_id": sessionID.String(),
+		},
+	})
+}
+
+// LogRegistration logs a self-registration attempt. outcome is created for
+// new accounts, otherwise why the attempt was refused.
+func (sa *SecurityAuditor) LogRegistration(userID *uuid.UUID, email, ipAddress, userAgent, requestID, outcome string) {
+	severity := SeverityLow
+	if outcome != "created" {
+		severity = SeverityMedium
+	}
+	sa.LogEvent(SecurityEvent{
+		EventType: EventTypeRegistration,
+		Severity:  severity,
+		UserID:    userID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		RequestID: requestID,
+		Blocked:   outcome == "throttled",
+		Details: map[string]interface{}{
+			"email":   email,
+			"outcome": outcome,
+		},
+	})
+}
+
+// LogEmailVerification logs a verification link being used; reason is empty
+// when the account was activated
+func (sa *SecurityAuditor) LogEmailVerification(userID *uuid.UUID, ipAddress, userAgent, requestID, reason string) {
+	event := SecurityEvent{
+		EventType: EventTypeEmailVerification,
+		Severity:  SeverityLow,
+		UserID:    userID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		RequestID: requestID,
+		Details:   map[string]interface{}{"verified": reason == ""},
+	}
+	if reason != "" {
+		event.Severity = SeverityMedium
+		event.Details["reason"] = reason
+	}
+	sa.LogEvent(event)
+}
+
+// LogInvitationCreated logs an administrator inviting someone to create an
+// account
+func (sa *SecurityAuditor) LogInvitationCreated(invitationID, adminID uuid.UUID, ipAddress, userAgent, requestID, email, role string) {
+	sa.LogEvent(SecurityEvent{
+		EventType: EventTypeInvitation,
+		Severity:  SeverityLow,
+		UserID:    &adminID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		RequestID: requestID,
+		Details: map[string]interface{}{
+			"action":        "created",
+			"invitation_id": invitationID.String(),
+			"email":         email,
+			"role":          role,
+		},
+	})
+}
+
+// LogInvitationAccepted logs an invitation link being used; reason is empty
+// when the account was created
+func (sa *SecurityAuditor) LogInvitationAccepted(userID *uuid.UUID, ipAddress, userAgent, requestID, reason string) {
+	event := SecurityEvent{
+		EventType: EventTypeInvitation,
+		Severity:  SeverityLow,
+		UserID:    userID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		RequestID: requestID,
+		Details:   map[string]interface{}{"action": "accepted"},
+	}
+	if reason != "" {
+		event.Severity = SeverityMedium
+		event.Details["action"] = "refused"
+		event.Details["reason"] = reason
+	}
+	sa.LogEvent(event)
+}
+
+// LogProfileUpdated logs users editing their own profile. fields are the
+// submitted fields; requestedEmail is the new email awaiting confirmation,
+// if one was requested.
+func (sa *SecurityAuditor) LogProfileUpdated(userID uuid.UUID, ipAddress, userAgent, requestID string, fields []string, requestedEmail string) {
+	event := SecurityEvent{
+		EventType: EventTypeProfileUpdated,
+		Severity:  SeverityLow,
+		UserID:    &userID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		RequestID: requestID,
+		Details:   map[string]interface{}{"action": "updated", "fields": fields},
+	}
+	if requestedEmail != "" {
+		event.Severity = SeverityMedium
+		event.Details["requested_email"] = requestedEmail
+	}
+	sa.LogEvent(event)
+}
+
+// LogEmailChangeConfirmed logs an email change link being used; reason is
+// empty when the email was changed
+func (sa *SecurityAuditor) LogEmailChangeConfirmed(userID *uuid.UUID, ipAddress, userAgent, requestID, reason string) {
+	event := SecurityEvent{
+		EventType: EventTypeProfileUpdated,
+		Severity:  SeverityMedium,
+		UserID:    userID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		RequestID: requestID,
+		Details:   map[string]interface{}{"action": "email_confirmed"},
+	}
+	if reason != "" {
+		event.Details["action"] = "email_refused"
+		event.Details["reason"] = reason
+	}
+	sa.LogEvent(event)
+}
+
 // LogAccessDenied logs an access denied event
 func (sa *SecurityAuditor) LogAccessDenied(userID *uuid.UUID, ipAddress, userAgent, requestID, endpoint, reason string) {
 	sa.LogEvent(SecurityEvent{
@@ -225,6 +518,113 @@ func (sa *SecurityAuditor) LogDDoSDetected(ipAddress, userAgent, requestID strin
 	})
 }
 
+// LogIPRuleChanged logs an administrator adding ("created") or removing
+// ("deleted") an IP blocklist/allowlist rule
+func (sa *SecurityAuditor) LogIPRuleChanged(adminID uuid.UUID, ipAddress, userAgent, requestID, operation string, rule IPRule) {
+	sa.LogEvent(SecurityEvent{
+		EventType: EventTypeConfigChange,
+		Severity:  SeverityMedium,
+		UserID:    &adminID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		RequestID: requestID,
+		Details: map[string]interface{}{
+			"operation": "ip_rule_" + operation,
+			"rule_id":   rule.ID.String(),
+			"cidr":      rule.CIDR,
+			"action":    string(rule.Action),
+		},
+	})
+}
+
+// LogDDoSUnblocked logs an administrator lifting the DDoS protection block
+// of an IP
+func (sa *SecurityAuditor) LogDDoSUnblocked(adminID uuid.UUID, ipAddress, userAgent, requestID, unblockedIP string) {
+	sa.LogEvent(SecurityEvent{
+		EventType: EventTypeConfigChange,
+		Severity:  SeverityMedium,
+		UserID:    &adminID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		RequestID: requestID,
+		Details: map[string]interface{}{
+			"operation":    "ddos_unblock",
+			"unblocked_ip": unblockedIP,
+		},
+	})
+}
+
+// LogAnomalyThresholdsChanged logs an administrator changing the thresholds
+// of the traffic anomaly detector
+func (sa *SecurityAuditor) LogAnomalyThresholdsChanged(adminID uuid.UUID, ipAddress, userAgent, requestID string, previous, thresholds AnomalyThresholds) {
+	sa.LogEvent(SecurityEvent{
+		EventType: EventTypeConfigChange,
+		Severity:  SeverityMedium,
+		UserID:    &adminID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		RequestID: requestID,
+		Details: map[string]interface{}{
+			"operation":           "anomaly_thresholds_updated",
+			"previous_thresholds": previous,
+			"thresholds":          thresholds,
+		},
+	})
+}
+
+// LogPasswordPolicyChanged logs an administrator changing the password policy
+func (sa *SecurityAuditor) LogPasswordPolicyChanged(adminID uuid.UUID, ipAddress, userAgent, requestID string, previous, policy password.Policy) {
+	sa.LogEvent(SecurityEvent{
+		EventType: EventTypeConfigChange,
+		Severity:  SeverityMedium,
+		UserID:    &adminID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		RequestID: requestID,
+		Details: map[string]interface{}{
+			"operation":       "password_policy_updated",
+			"previous_policy": previous,
+			"policy":          policy,
+		},
+	})
+}
+
+// LogRoleChanged logs an administrator changing a user's role. Changes that
+// grant new permissions are additionally logged as privilege escalation.
+func (sa *SecurityAuditor) LogRoleChanged(userID, adminID uuid.UUID, ipAddress, userAgent, requestID, previousRole, role string, escalation bool) {
+	details := map[string]interface{}{
+		"operation":     "role_changed",
+		"user_id":       userID.String(),
+		"previous_role": previousRole,
+		"role":          role,
+	}
+	sa.LogEvent(SecurityEvent{
+		EventType: EventTypeConfigChange,
+		Severity:  SeverityMedium,
+		UserID:    &adminID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		RequestID: requestID,
+		Details:   details,
+	})
+
+	if escalation {
+		sa.LogEvent(SecurityEvent{
+			EventType: EventTypePrivilegeEscalation,
+			Severity:  SeverityHigh,
+			UserID:    &userID,
+			IPAddress: ipAddress,
+			UserAgent: userAgent,
+			RequestID: requestID,
+			Details: map[string]interface{}{
+				"granted_by":    adminID.String(),
+				"previous_role": previousRole,
+				"role":          role,
+			},
+		})
+	}
+}
+
 // LogValidationFailed logs a validation failure
 func (sa *SecurityAuditor) LogValidationFailed(ipAddress, userAgent, requestID, endpoint string, errors []string) {
 	sa.LogEvent(SecurityEvent{
@@ -257,6 +657,41 @@ func (sa *SecurityAuditor) LogSuspiciousInput(ipAddress, userAgent, requestID, e
 	})
 }
 
+// LogAPIKeyRevoked logs an administrator revoking an API key
+func (sa *SecurityAuditor) LogAPIKeyRevoked(apiKeyID, adminID uuid.UUID, ipAddress, userAgent, requestID string) {
+	sa.LogEvent(SecurityEvent{
+		EventType: EventTypeAPIKeyRevoked,
+		Severity:  SeverityMedium,
+		UserID:    &adminID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		RequestID: requestID,
+		Details: map[string]interface{}{
+			"api_key_id": apiKeyID.String(),
+		},
+	})
+}
+
+// LogAPIKeyRotated logs an administrator issuing a new secret for an API key
+func (sa *SecurityAuditor) LogAPIKeyRotated(apiKeyID, adminID uuid.UUID, ipAddress, userAgent, requestID string, previousKeyExpiresAt *time.Time) {
+	details := map[string]interface{}{
+		"operation":  "api_key_rotated",
+		"api_key_id": apiKeyID.String(),
+	}
+	if previousKeyExpiresAt != nil {
+		details["previous_key_expires_at"] = previousKeyExpiresAt.Format(time.RFC3339)
+	}
+	sa.LogEvent(SecurityEvent{
+		EventType: EventTypeConfigChange,
+		Severity:  SeverityMedium,
+		UserID:    &adminID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		RequestID: requestID,
+		Details:   details,
+	})
+}
+
 // LogAPIKeyUsage logs API key usage
 func (sa *SecurityAuditor) LogAPIKeyUsage(apiKeyID uuid.UUID, userID *uuid.UUID, ipAddress, userAgent, requestID, endpoint string) {
 	sa.LogEvent(SecurityEvent{
@@ -278,16 +713,57 @@ func (sa *SecurityAuditor) processEvents() {
 	for event := range sa.events {
 		// Log the event
 		sa.logEventDirectly(event)
+		sa.persist(persistItem{event: &event})
+		for _, out := range sa.outputs {
+			out.SendEvent(event)
+		}
 
 		// Analyze the event
 		for _, analyzer := range sa.analyzers {
 			if alert, err := analyzer.Analyze(event); err == nil && alert != nil {
-				sa.logAlert(*alert)
+				if alert.EventType == "" {
+					alert.EventType = event.EventType
+				}
+				sa.raise(alert)
 			}
 		}
 	}
 }
 
+// raise logs, publishes and persists an alert
+func (sa *SecurityAuditor) raise(alert *SecurityAlert) {
+	alert.Description = sa.redactor.String(alert.Description)
+	alert.Metadata = sa.redactor.Map(alert.Metadata)
+	sa.logAlert(*alert)
+	sa.publishAlert(*alert)
+	sa.persist(persistItem{alert: alert})
+	for _, out := range sa.outputs {
+		out.SendAlert(*alert)
+	}
+}
+
+// AnomalyDetector returns the analyzer of per-client traffic baselines, to
+// read or change its thresholds
+func (sa *SecurityAuditor) AnomalyDetector() *AnomalyAnalyzer {
+	return sa.anomaly
+}
+
+// ObserveRequest feeds an HTTP request to the anomaly detector. Requests are
+// not security events: they are neither logged nor stored.
+func (sa *SecurityAuditor) ObserveRequest(userID *uuid.UUID, ipAddress, method, endpoint string, status int) {
+	alert, _ := sa.anomaly.Analyze(SecurityEvent{
+		Timestamp: time.Now(),
+		UserID:    userID,
+		IPAddress: ipAddress,
+		Method:    method,
+		Endpoint:  endpoint,
+		Status:    status,
+	})
+	if alert != nil {
+		sa.raise(alert)
+	}
+}
+
 // logEventDirectly logs an event directly
 func (sa *SecurityAuditor) logEventDirectly(event SecurityEvent) {
 	// Create structured log entry
@@ -309,6 +785,9 @@ func (sa *SecurityAuditor) logEventDirectly(event SecurityEvent) {
 	if event.UserID != nil {
 		entry = entry.WithField("user_id", event.UserID.String())
 	}
+	if event.Geo != nil {
+		entry = entry.WithFields(logrus.Fields{"country": event.Geo.Country, "asn": event.Geo.ASN})
+	}
 
 	// Add details
 	for key, value := range event.Details {
@@ -358,6 +837,52 @@ func (sa *SecurityAuditor) logAlert(alert SecurityAlert) {
 	}
 }
 
+// publishAlert records the alert and fans it out to subscribers
+func (sa *SecurityAuditor) publishAlert(alert SecurityAlert) {
+	sa.alertsMutex.Lock()
+	defer sa.alertsMutex.Unlock()
+
+	sa.recentAlerts = append(sa.recentAlerts, alert)
+	if len(sa.recentAlerts) > maxRecentAlerts {
+		sa.recentAlerts = sa.recentAlerts[len(sa.recentAlerts)-maxRecentAlerts:]
+	}
+
+	for ch := range sa.subscribers {
+		select {
+		case ch <- alert:
+		default:
+			// Slow subscriber, drop rather than block event processing
+		}
+	}
+}
+
+// SubscribeAlerts returns a channel receiving new alerts and a function to unsubscribe
+func (sa *SecurityAuditor) SubscribeAlerts() (<-chan SecurityAlert, func()) {
+	ch := make(chan SecurityAlert, 16)
+
+	sa.alertsMutex.Lock()
+	sa.subscribers[ch] = struct{}{}
+	sa.alertsMutex.Unlock()
+
+	return ch, func() {
+		sa.alertsMutex.Lock()
+		delete(sa.subscribers, ch)
+		sa.alertsMutex.Unlock()
+	}
+}
+
+// GetRecentAlerts returns the most recent alerts, newest first
+func (sa *SecurityAuditor) GetRecentAlerts() []SecurityAlert {
+	sa.alertsMutex.RLock()
+	defer sa.alertsMutex.RUnlock()
+
+	alerts := make([]SecurityAlert, 0, len(sa.recentAlerts))
+	for i := len(sa.recentAlerts) - 1; i >= 0; i-- {
+		alerts = append(alerts, sa.recentAlerts[i])
+	}
+	return alerts
+}
+
 // calculateRiskScore calculates a risk score for an event
 func (sa *SecurityAuditor) calculateRiskScore(event SecurityEvent) int {
 	score := 0
@@ -366,6 +891,10 @@ func (sa *SecurityAuditor) calculateRiskScore(event SecurityEvent) int {
 	switch event.EventType {
 	case EventTypeLoginFailure:
 		score += 20
+	case EventTypeAccountLocked:
+		score += 40
+	case EventTypeRefreshTokenReuse:
+		score += 45
 	case EventTypeAccessDenied:
 		score += 15
 	case EventTypeRateLimitExceeded:
@@ -410,15 +939,3 @@ func (sa *SecurityAuditor) calculateRiskScore(event SecurityEvent) int {
 
 	return score
 }
-
-// GetSecurityStats returns security statistics
-func (sa *SecurityAuditor) GetSecurityStats() map[string]interface{} {
-	// This would typically query a database or cache
-	// For now, return basic stats
-	return map[string]interface{}{
-		"total_events":     0,
-		"blocked_requests": 0,
-		"high_risk_events": 0,
-		"active_threats":   0,
-	}
-}
@@ -0,0 +1,312 @@
+package security
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// IPAction is what an IP rule does to matching requests
+type IPAction string
+
+const (
+	IPActionNone  IPAction = ""
+	IPActionBlock IPAction = "block"
+	IPActionAllow IPAction = "allow"
+)
+
+// IPRule blocks or allowlists an IP or CIDR range
+type IPRule struct {
+	ID        uuid.UUID  `json:"id"`
+	CIDR      string     `json:"cidr"`
+	Action    IPAction   `json:"action"`
+	Reason    string     `json:"reason"`
+	CreatedBy *uuid.UUID `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// IPRuleStore persists IP rules
+type IPRuleStore interface {
+	ListRules(ctx context.Context) ([]IPRule, error)
+	SaveRule(ctx context.Context, rule IPRule) error
+	DeleteRule(ctx context.Context, id uuid.UUID) error
+}
+
+// SQLIPRuleStore keeps IP rules in the ip_rules table
+type SQLIPRuleStore struct {
+	db *sql.DB
+}
+
+func NewSQLIPRuleStore(db *sql.DB) *SQLIPRuleStore {
+	return &SQLIPRuleStore{db: db}
+}
+
+func (s *SQLIPRuleStore) ListRules(ctx context.Context) ([]IPRule, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, cidr, action, reason, created_by, created_at, expires_at
+		FROM ip_rules ORDER BY created_at
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ip rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []IPRule
+	for rows.Next() {
+		var (
+			rule      IPRule
+			action    string
+			createdBy sql.NullString
+			expiresAt sql.NullTime
+		)
+		if err := rows.Scan(&rule.ID, &rule.CIDR, &action, &rule.Reason, &createdBy, &rule.CreatedAt, &expiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan ip rule: %w", err)
+		}
+		rule.Action = IPAction(action)
+		if createdBy.Valid {
+			if id, err := uuid.Parse(createdBy.String); err == nil {
+				rule.CreatedBy = &id
+			}
+		}
+		if expiresAt.Valid {
+			rule.ExpiresAt = &expiresAt.Time
+		}
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list ip rules: %w", err)
+	}
+	return rules, nil
+}
+
+func (s *SQLIPRuleStore) SaveRule(ctx context.Context, rule IPRule) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO ip_rules (id, cidr, action, reason, created_by, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, rule.ID, rule.CIDR, string(rule.Action), rule.Reason, rule.CreatedBy, rule.CreatedAt, rule.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert ip rule: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLIPRuleStore) DeleteRule(ctx context.Context, id uuid.UUID) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM ip_rules WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete ip rule: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return apperrors.NotFound("ip rule not found")
+	}
+	return nil
+}
+
+// ParseCIDR accepts a CIDR range or a single IP and returns the normalised network
+func ParseCIDR(raw string) (*net.IPNet, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "/") {
+		ip := net.ParseIP(raw)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP or CIDR %q", raw)
+		}
+		if ip.To4() != nil {
+			raw += "/32"
+		} else {
+			raw += "/128"
+		}
+	}
+	_, network, err := net.ParseCIDR(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IP or CIDR %q", raw)
+	}
+	return network, nil
+}
+
+// ipRuleEntry is a rule with its parsed network
+type ipRuleEntry struct {
+	rule    IPRule
+	network *net.IPNet
+	prefix  int
+}
+
+// IPListManager holds the operator-managed IP rules in memory for fast
+// lookups and keeps them in sync with the store. Rules changed on another
+// replica are picked up on the next refresh.
+type IPListManager struct {
+	store  IPRuleStore
+	logger *logrus.Logger
+
+	mutex   sync.RWMutex
+	entries []ipRuleEntry
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func NewIPListManager(store IPRuleStore, logger *logrus.Logger) *IPListManager {
+	return &IPListManager{
+		store:   store,
+		logger:  logger,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Load replaces the in-memory rules with the stored ones
+func (m *IPListManager) Load(ctx context.Context) error {
+	rules, err := m.store.ListRules(ctx)
+	if err != nil {
+		return err
+	}
+
+	entries := make([]ipRuleEntry, 0, len(rules))
+	for _, rule := range rules {
+		network, err := ParseCIDR(rule.CIDR)
+		if err != nil {
+			m.logger.Warnf("Skipping stored IP rule %s: %v", rule.ID, err)
+			continue
+		}
+		prefix, _ := network.Mask.Size()
+		entries = append(entries, ipRuleEntry{rule: rule, network: network, prefix: prefix})
+	}
+
+	m.mutex.Lock()
+	m.entries = entries
+	m.mutex.Unlock()
+	return nil
+}
+
+// Start reloads the rules every interval until Stop is called
+func (m *IPListManager) Start(interval time.Duration) {
+	go func() {
+		defer close(m.stopped)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.done:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				if err := m.Load(ctx); err != nil {
+					m.logger.Errorf("Failed to refresh IP rules: %v", err)
+				}
+				cancel()
+			}
+		}
+	}()
+}
+
+// Stop stops the refresh loop started by Start
+func (m *IPListManager) Stop() {
+	close(m.done)
+	<-m.stopped
+}
+
+// Rules returns the active rules
+func (m *IPListManager) Rules() []IPRule {
+	now := time.Now()
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	rules := make([]IPRule, 0, len(m.entries))
+	for _, entry := range m.entries {
+		if !entry.expired(now) {
+			rules = append(rules, entry.rule)
+		}
+	}
+	return rules
+}
+
+// Add validates and stores a new rule. ttl <= 0 means the rule never expires.
+func (m *IPListManager) Add(ctx context.Context, cidr string, action IPAction, reason string, ttl time.Duration, createdBy *uuid.UUID) (IPRule, error) {
+	if action != IPActionBlock && action != IPActionAllow {
+		return IPRule{}, apperrors.Validation("action must be block or allow")
+	}
+	network, err := ParseCIDR(cidr)
+	if err != nil {
+		return IPRule{}, apperrors.Wrap(apperrors.ErrValidation, "invalid IP or CIDR", err)
+	}
+
+	rule := IPRule{
+		ID:        uuid.New(),
+		CIDR:      network.String(),
+		Action:    action,
+		Reason:    reason,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().UTC(),
+	}
+	if ttl > 0 {
+		expiresAt := rule.CreatedAt.Add(ttl)
+		rule.ExpiresAt = &expiresAt
+	}
+	if err := m.store.SaveRule(ctx, rule); err != nil {
+		return IPRule{}, err
+	}
+
+	prefix, _ := network.Mask.Size()
+	m.mutex.Lock()
+	m.entries = append(m.entries, ipRuleEntry{rule: rule, network: network, prefix: prefix})
+	m.mutex.Unlock()
+	return rule, nil
+}
+
+// Remove deletes a rule and returns it. Rules added on another replica that
+// have not been loaded here yet come back with only the ID set.
+func (m *IPListManager) Remove(ctx context.Context, id uuid.UUID) (IPRule, error) {
+	if err := m.store.DeleteRule(ctx, id); err != nil {
+		return IPRule{}, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for i, entry := range m.entries {
+		if entry.rule.ID == id {
+			m.entries = append(m.entries[:i:i], m.entries[i+1:]...)
+			return entry.rule, nil
+		}
+	}
+	return IPRule{ID: id}, nil
+}
+
+// Check returns the action for ip. The most specific matching rule wins, so
+// a single address can be allowlisted inside a blocked range; on equal
+// prefixes block wins.
+func (m *IPListManager) Check(ip string) IPAction {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return IPActionNone
+	}
+	now := time.Now()
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	action, best := IPActionNone, -1
+	for _, entry := range m.entries {
+		if entry.expired(now) || !entry.network.Contains(parsed) {
+			continue
+		}
+		if entry.prefix > best || (entry.prefix == best && entry.rule.Action == IPActionBlock) {
+			action, best = entry.rule.Action, entry.prefix
+		}
+	}
+	return action
+}
+
+func (e ipRuleEntry) expired(now time.Time) bool {
+	return e.rule.ExpiresAt != nil && !now.Before(*e.rule.ExpiresAt)
+}
@@ -0,0 +1,104 @@
+package security
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type memoryIPRuleStore struct {
+	rules []IPRule
+}
+
+func (m *memoryIPRuleStore) ListRules(ctx context.Context) ([]IPRule, error) {
+	return m.rules, nil
+}
+
+func (m *memoryIPRuleStore) SaveRule(ctx context.Context, rule IPRule) error {
+	m.rules = append(m.rules, rule)
+	return nil
+}
+
+func (m *memoryIPRuleStore) DeleteRule(ctx context.Context, id uuid.UUID) error {
+	for i, rule := range m.rules {
+		if rule.ID == id {
+			m.rules = append(m.rules[:i], m.rules[i+1:]...)
+			return nil
+		}
+	}
+	return apperrors.NotFound("ip rule not found")
+}
+
+func TestIPListManager_MostSpecificRuleWins(t *testing.T) {
+	ctx := context.Background()
+	m := NewIPListManager(&memoryIPRuleStore{}, logrus.New())
+
+	if _, err := m.Add(ctx, "10.0.0.0/8", IPActionBlock, "abuse", 0, nil); err != nil {
+		t.Fatalf("add block: %v", err)
+	}
+	allow, err := m.Add(ctx, "10.1.2.3", IPActionAllow, "monitoring", 0, nil)
+	if err != nil {
+		t.Fatalf("add allow: %v", err)
+	}
+	if allow.CIDR != "10.1.2.3/32" {
+		t.Fatalf("single IP should be stored as /32, got %s", allow.CIDR)
+	}
+
+	cases := map[string]IPAction{
+		"10.9.9.9":    IPActionBlock,
+		"10.1.2.3":    IPActionAllow,
+		"192.168.1.1": IPActionNone,
+		"not-an-ip":   IPActionNone,
+	}
+	for ip, want := range cases {
+		if got := m.Check(ip); got != want {
+			t.Fatalf("%s: want %q, got %q", ip, want, got)
+		}
+	}
+
+	if _, err := m.Remove(ctx, allow.ID); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if got := m.Check("10.1.2.3"); got != IPActionBlock {
+		t.Fatalf("after removing the allow rule want block, got %q", got)
+	}
+	if _, err := m.Remove(ctx, allow.ID); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Fatalf("removing twice should be not found, got %v", err)
+	}
+}
+
+func TestIPListManager_ExpiredAndInvalidRules(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	store := &memoryIPRuleStore{rules: []IPRule{
+		{ID: uuid.New(), CIDR: "203.0.113.0/24", Action: IPActionBlock, ExpiresAt: &past},
+		{ID: uuid.New(), CIDR: "garbage", Action: IPActionBlock},
+		{ID: uuid.New(), CIDR: "2001:db8::/32", Action: IPActionBlock},
+	}}
+	m := NewIPListManager(store, logrus.New())
+	if err := m.Load(context.Background()); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if got := m.Check("203.0.113.5"); got != IPActionNone {
+		t.Fatalf("expired rule must not match, got %q", got)
+	}
+	if got := m.Check("2001:db8::1"); got != IPActionBlock {
+		t.Fatalf("IPv6 rule should match, got %q", got)
+	}
+	if rules := m.Rules(); len(rules) != 1 {
+		t.Fatalf("want 1 active rule, got %d", len(rules))
+	}
+
+	if _, err := m.Add(context.Background(), "1.2.3.4", "deny", "", 0, nil); !errors.Is(err, apperrors.ErrValidation) {
+		t.Fatalf("invalid action should be a validation error, got %v", err)
+	}
+	if _, err := m.Add(context.Background(), "1.2.3.400", IPActionBlock, "", 0, nil); !errors.Is(err, apperrors.ErrValidation) {
+		t.Fatalf("invalid CIDR should be a validation error, got %v", err)
+	}
+}
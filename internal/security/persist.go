@@ -0,0 +1,136 @@
+package security
+
+import (
+	"context"
+	"time"
+)
+
+// PersistConfig controls how the auditor writes events to its store
+type PersistConfig struct {
+	BatchSize     int
+	FlushInterval time.Duration
+	QueueSize     int
+}
+
+// persistItem is either an event or an alert waiting to be stored
+type persistItem struct {
+	event *SecurityEvent
+	alert *SecurityAlert
+}
+
+// persister writes events and alerts to a Store in the background so that
+// request handling never waits on the database
+type persister struct {
+	store   Store
+	cfg     PersistConfig
+	queue   chan persistItem
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// SetStore enables persistence of events and alerts. Events are written
+// asynchronously in batches; when the queue is full they are only logged.
+// Must be called before events are logged.
+func (sa *SecurityAuditor) SetStore(store Store, cfg PersistConfig) {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 10000
+	}
+
+	p := &persister{
+		store:   store,
+		cfg:     cfg,
+		queue:   make(chan persistItem, cfg.QueueSize),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	sa.persister = p
+	go sa.runPersister(p)
+}
+
+// Store returns the configured store, or nil when persistence is disabled
+func (sa *SecurityAuditor) Store() Store {
+	if sa.persister == nil {
+		return nil
+	}
+	return sa.persister.store
+}
+
+// Close stops the background writer after flushing queued events
+func (sa *SecurityAuditor) Close() {
+	if sa.persister == nil {
+		return
+	}
+	close(sa.persister.done)
+	<-sa.persister.stopped
+}
+
+func (sa *SecurityAuditor) persist(item persistItem) {
+	if sa.persister == nil {
+		return
+	}
+	select {
+	case sa.persister.queue <- item:
+	default:
+		sa.logger.Warn("Security event store queue full, dropping event")
+	}
+}
+
+func (sa *SecurityAuditor) runPersister(p *persister) {
+	defer close(p.stopped)
+
+	ticker := time.NewTicker(p.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]SecurityEvent, 0, p.cfg.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := p.store.SaveEvents(ctx, batch); err != nil {
+			sa.logger.Errorf("Failed to persist %d security events: %v", len(batch), err)
+		}
+		cancel()
+		batch = batch[:0]
+	}
+	handle := func(item persistItem) {
+		if item.alert != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := p.store.SaveAlert(ctx, *item.alert); err != nil {
+				sa.logger.Errorf("Failed to persist security alert %s: %v", item.alert.ID, err)
+			}
+			cancel()
+			return
+		}
+		batch = append(batch, *item.event)
+		if len(batch) >= p.cfg.BatchSize {
+			flush()
+		}
+	}
+
+	for {
+		select {
+		case item := <-p.queue:
+			handle(item)
+		case <-ticker.C:
+			flush()
+		case <-p.done:
+			// Drain what is already queued
+			for {
+				select {
+				case item := <-p.queue:
+					handle(item)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package security
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// statsWindow is the period covered by GetSecurityStats
+const statsWindow = 24 * time.Hour
+
+// topGeoLimit bounds the countries and autonomous systems in the stats
+const topGeoLimit = 10
+
+// blockedEventTypes are the events recorded when a request is rejected by
+// rate limiting, DDoS protection or the IP blocklist
+var blockedEventTypes = []SecurityEventType{EventTypeRateLimitExceeded, EventTypeDDoSDetected, EventTypeIPBlocked}
+
+// securityStats is the last result of AggregateStats
+type securityStats struct {
+	TotalEvents     int
+	BlockedRequests int
+	HighRiskEvents  int
+	ActiveThreats   int
+	Geo             *GeoBreakdown
+	AggregatedAt    time.Time
+}
+
+// AggregateStats counts the stored events and alerts of the last 24 hours
+// for GetSecurityStats. It runs as a scheduled job because the counts scan
+// the security tables. It requires a store.
+func (sa *SecurityAuditor) AggregateStats(ctx context.Context) error {
+	store := sa.Store()
+	if store == nil {
+		return errors.New("security event store is not configured")
+	}
+
+	now := time.Now()
+	from := now.Add(-statsWindow)
+	count := func(filter EventFilter) (int, error) {
+		filter.From, filter.Limit = from, 1
+		_, total, err := store.ListEvents(ctx, filter)
+		return total, err
+	}
+
+	var stats securityStats
+	var err error
+	if stats.TotalEvents, err = count(EventFilter{}); err != nil {
+		return err
+	}
+	for _, severity := range []SecuritySeverity{SeverityHigh, SeverityCritical} {
+		n, err := count(EventFilter{Severity: severity})
+		if err != nil {
+			return err
+		}
+		stats.HighRiskEvents += n
+	}
+	for _, eventType := range blockedEventTypes {
+		n, err := count(EventFilter{EventType: eventType})
+		if err != nil {
+			return err
+		}
+		stats.BlockedRequests += n
+	}
+	if _, stats.ActiveThreats, err = store.ListAlerts(ctx, AlertFilter{From: from, Limit: 1}); err != nil {
+		return err
+	}
+	if stats.Geo, err = store.CountByGeo(ctx, from, topGeoLimit); err != nil {
+		return err
+	}
+	stats.AggregatedAt = now
+
+	sa.statsMutex.Lock()
+	sa.stats = stats
+	sa.statsMutex.Unlock()
+	return nil
+}
+
+// GetSecurityStats returns the counts of the last AggregateStats run. They
+// are zero until the first run completes.
+func (sa *SecurityAuditor) GetSecurityStats() map[string]interface{} {
+	sa.statsMutex.RLock()
+	stats := sa.stats
+	sa.statsMutex.RUnlock()
+
+	result := map[string]interface{}{
+		"total_events":     stats.TotalEvents,
+		"blocked_requests": stats.BlockedRequests,
+		"high_risk_events": stats.HighRiskEvents,
+		"active_threats":   stats.ActiveThreats,
+		"window":           statsWindow.String(),
+	}
+	if stats.Geo != nil {
+		result["top_countries"] = stats.Geo.Countries
+		result["top_asns"] = stats.Geo.ASNs
+	}
+	if !stats.AggregatedAt.IsZero() {
+		result["aggregated_at"] = stats.AggregatedAt.Unix()
+	}
+	return result
+}
@@ -0,0 +1,74 @@
+package security
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/geoip"
+
+	"github.com/sirupsen/logrus"
+)
+
+// countingStore reports a fixed total per severity, event type and for alerts
+type countingStore struct {
+	memoryStore
+	bySeverity map[SecuritySeverity]int
+	byType     map[SecurityEventType]int
+	all        int
+	alerts     int
+}
+
+func (c *countingStore) ListEvents(ctx context.Context, filter EventFilter) ([]SecurityEvent, int, error) {
+	switch {
+	case filter.Severity != "":
+		return nil, c.bySeverity[filter.Severity], nil
+	case filter.EventType != "":
+		return nil, c.byType[filter.EventType], nil
+	}
+	return nil, c.all, nil
+}
+
+func (c *countingStore) ListAlerts(ctx context.Context, filter AlertFilter) ([]SecurityAlert, int, error) {
+	return nil, c.alerts, nil
+}
+
+func TestSecurityAuditor_AggregateStats(t *testing.T) {
+	auditor := NewSecurityAuditor(logrus.New())
+	if err := auditor.AggregateStats(context.Background()); err == nil {
+		t.Fatal("expected an error without a store")
+	}
+
+	now := time.Now()
+	auditor.SetStore(&countingStore{
+		memoryStore: memoryStore{events: []SecurityEvent{
+			{Timestamp: now, Blocked: true, Geo: &geoip.Location{Country: "NL", ASN: 1136, ASOrg: "KPN B.V."}},
+			{Timestamp: now, Geo: &geoip.Location{Country: "NL", ASN: 1136, ASOrg: "KPN B.V."}},
+			{Timestamp: now, Geo: &geoip.Location{Country: "US"}},
+			{Timestamp: now.Add(-48 * time.Hour), Geo: &geoip.Location{Country: "US"}},
+		}},
+		all:        40,
+		bySeverity: map[SecuritySeverity]int{SeverityHigh: 5, SeverityCritical: 2, SeverityLow: 30},
+		byType:     map[SecurityEventType]int{EventTypeRateLimitExceeded: 7, EventTypeDDoSDetected: 1},
+		alerts:     3,
+	}, PersistConfig{FlushInterval: time.Hour})
+	defer auditor.Close()
+
+	if err := auditor.AggregateStats(context.Background()); err != nil {
+		t.Fatalf("aggregate: %v", err)
+	}
+	stats := auditor.GetSecurityStats()
+	if stats["total_events"] != 40 || stats["high_risk_events"] != 7 || stats["blocked_requests"] != 8 || stats["active_threats"] != 3 {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+	countries, _ := stats["top_countries"].([]CountryCount)
+	if len(countries) != 2 || countries[0] != (CountryCount{Country: "NL", Events: 2, Blocked: 1}) || countries[1].Events != 1 {
+		t.Fatalf("unexpected countries: %+v", stats["top_countries"])
+	}
+	if asns, _ := stats["top_asns"].([]ASNCount); len(asns) != 1 || asns[0].ASOrg != "KPN B.V." {
+		t.Fatalf("unexpected ASNs: %+v", stats["top_asns"])
+	}
+	if _, ok := stats["aggregated_at"]; !ok {
+		t.Fatal("missing aggregated_at")
+	}
+}
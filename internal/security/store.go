@@ -0,0 +1,371 @@
+package security
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"highload-microservice/internal/geoip"
+
+	"github.com/google/uuid"
+)
+
+// Store persists security events and alerts
+type Store interface {
+	SaveEvents(ctx context.Context, events []SecurityEvent) error
+	SaveAlert(ctx context.Context, alert SecurityAlert) error
+	ListEvents(ctx context.Context, filter EventFilter) ([]SecurityEvent, int, error)
+	ListAlerts(ctx context.Context, filter AlertFilter) ([]SecurityAlert, int, error)
+	// CountByGeo returns the countries and autonomous systems with the most
+	// events since from
+	CountByGeo(ctx context.Context, from time.Time, limit int) (*GeoBreakdown, error)
+}
+
+// GeoBreakdown counts located events by country and autonomous system
+type GeoBreakdown struct {
+	Countries []CountryCount `json:"countries"`
+	ASNs      []ASNCount     `json:"asns"`
+}
+
+// CountryCount is the number of events, and blocked ones, from a country
+type CountryCount struct {
+	Country string `json:"country"`
+	Events  int    `json:"events"`
+	Blocked int    `json:"blocked"`
+}
+
+// ASNCount is the number of events, and blocked ones, from an autonomous
+// system
+type ASNCount struct {
+	ASN     uint32 `json:"asn"`
+	ASOrg   string `json:"as_org"`
+	Events  int    `json:"events"`
+	Blocked int    `json:"blocked"`
+}
+
+// EventFilter selects stored security events. Zero values match everything.
+type EventFilter struct {
+	EventType SecurityEventType
+	Severity  SecuritySeverity
+	IPAddress string
+	From      time.Time
+	To        time.Time
+	Page      int
+	Limit     int
+}
+
+// AlertFilter selects stored security alerts. Zero values match everything.
+type AlertFilter struct {
+	Severity SecuritySeverity
+	From     time.Time
+	To       time.Time
+	Page     int
+	Limit    int
+}
+
+// SQLStore stores security events and alerts in the security_events and
+// security_alerts tables. Queries use $N placeholders and work on every
+// supported dialect.
+type SQLStore struct {
+	db *sql.DB
+}
+
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// SaveEvents inserts events in a single transaction
+func (s *SQLStore) SaveEvents(ctx context.Context, events []SecurityEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := `
+		INSERT INTO security_events (id, occurred_at, event_type, severity, user_id, ip_address, user_agent,
+			request_id, endpoint, method, status, details, risk_score, blocked, country, city, asn, as_org)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+	`
+	for _, event := range events {
+		details, err := json.Marshal(event.Details)
+		if err != nil {
+			return fmt.Errorf("failed to marshal event details: %w", err)
+		}
+		var geo geoip.Location
+		if event.Geo != nil {
+			geo = *event.Geo
+		}
+		_, err = tx.ExecContext(ctx, query,
+			event.ID, event.Timestamp, string(event.EventType), string(event.Severity), event.UserID,
+			event.IPAddress, event.UserAgent, event.RequestID, event.Endpoint, event.Method, event.Status,
+			string(details), event.RiskScore, event.Blocked, geo.Country, geo.City, int64(geo.ASN), geo.ASOrg,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert security event: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit security events: %w", err)
+	}
+	return nil
+}
+
+// SaveAlert inserts an alert
+func (s *SQLStore) SaveAlert(ctx context.Context, alert SecurityAlert) error {
+	eventIDs, err := json.Marshal(alert.EventIDs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert event ids: %w", err)
+	}
+	actions, err := json.Marshal(alert.Actions)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert actions: %w", err)
+	}
+	metadata, err := json.Marshal(alert.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert metadata: %w", err)
+	}
+
+	query := `
+		INSERT INTO security_alerts (id, created_at, severity, title, description, event_ids, risk_score, actions, metadata)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err = s.db.ExecContext(ctx, query,
+		alert.ID, alert.Timestamp, string(alert.Severity), alert.Title, alert.Description,
+		string(eventIDs), alert.RiskScore, string(actions), string(metadata),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert security alert: %w", err)
+	}
+	return nil
+}
+
+// ListEvents returns one page of matching events, newest first, and the
+// total number of matches
+func (s *SQLStore) ListEvents(ctx context.Context, filter EventFilter) ([]SecurityEvent, int, error) {
+	var where whereBuilder
+	where.add("event_type", string(filter.EventType))
+	where.add("severity", string(filter.Severity))
+	where.add("ip_address", filter.IPAddress)
+	where.timeRange("occurred_at", filter.From, filter.To)
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM security_events`+where.sql(), where.args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count security events: %w", err)
+	}
+
+	pageClause, args := where.page(filter.Page, filter.Limit)
+	query := `
+		SELECT id, occurred_at, event_type, severity, user_id, ip_address, user_agent,
+			request_id, endpoint, method, status, details, risk_score, blocked, country, city, asn, as_org
+		FROM security_events` + where.sql() + `
+		ORDER BY occurred_at DESC` + pageClause
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list security events: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	events := []SecurityEvent{}
+	for rows.Next() {
+		var (
+			event     SecurityEvent
+			eventType string
+			severity  string
+			userID    uuid.NullUUID
+			details   []byte
+			geo       geoip.Location
+			asn       int64
+		)
+		err := rows.Scan(&event.ID, &event.Timestamp, &eventType, &severity, &userID, &event.IPAddress,
+			&event.UserAgent, &event.RequestID, &event.Endpoint, &event.Method, &event.Status, &details,
+			&event.RiskScore, &event.Blocked, &geo.Country, &geo.City, &asn, &geo.ASOrg)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan security event: %w", err)
+		}
+		event.EventType = SecurityEventType(eventType)
+		event.Severity = SecuritySeverity(severity)
+		if userID.Valid {
+			event.UserID = &userID.UUID
+		}
+		if len(details) > 0 {
+			_ = json.Unmarshal(details, &event.Details)
+		}
+		if geo.ASN = uint32(asn); geo.Country != "" || geo.ASN != 0 {
+			event.Geo = &geo
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to list security events: %w", err)
+	}
+
+	return events, total, nil
+}
+
+// ListAlerts returns one page of matching alerts, newest first, and the
+// total number of matches
+func (s *SQLStore) ListAlerts(ctx context.Context, filter AlertFilter) ([]SecurityAlert, int, error) {
+	var where whereBuilder
+	where.add("severity", string(filter.Severity))
+	where.timeRange("created_at", filter.From, filter.To)
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM security_alerts`+where.sql(), where.args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count security alerts: %w", err)
+	}
+
+	pageClause, args := where.page(filter.Page, filter.Limit)
+	query := `
+		SELECT id, created_at, severity, title, description, event_ids, risk_score, actions, metadata
+		FROM security_alerts` + where.sql() + `
+		ORDER BY created_at DESC` + pageClause
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list security alerts: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	alerts := []SecurityAlert{}
+	for rows.Next() {
+		var (
+			alert                       SecurityAlert
+			severity                    string
+			eventIDs, actions, metadata []byte
+		)
+		err := rows.Scan(&alert.ID, &alert.Timestamp, &severity, &alert.Title, &alert.Description,
+			&eventIDs, &alert.RiskScore, &actions, &metadata)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan security alert: %w", err)
+		}
+		alert.Severity = SecuritySeverity(severity)
+		_ = json.Unmarshal(eventIDs, &alert.EventIDs)
+		_ = json.Unmarshal(actions, &alert.Actions)
+		_ = json.Unmarshal(metadata, &alert.Metadata)
+		alerts = append(alerts, alert)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to list security alerts: %w", err)
+	}
+
+	return alerts, total, nil
+}
+
+// CountByGeo groups the events since from by country and by autonomous
+// system, most events first
+func (s *SQLStore) CountByGeo(ctx context.Context, from time.Time, limit int) (*GeoBreakdown, error) {
+	breakdown := &GeoBreakdown{Countries: []CountryCount{}, ASNs: []ASNCount{}}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT country, COUNT(*) AS events, SUM(CASE WHEN blocked THEN 1 ELSE 0 END)
+		FROM security_events WHERE occurred_at >= $1 AND country <> ''
+		GROUP BY country
+		ORDER BY events DESC, country
+		LIMIT $2
+	`, from, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count security events by country: %w", err)
+	}
+	for rows.Next() {
+		var c CountryCount
+		if err := rows.Scan(&c.Country, &c.Events, &c.Blocked); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan country count: %w", err)
+		}
+		breakdown.Countries = append(breakdown.Countries, c)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to count security events by country: %w", err)
+	}
+
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT asn, MAX(as_org), COUNT(*) AS events, SUM(CASE WHEN blocked THEN 1 ELSE 0 END)
+		FROM security_events WHERE occurred_at >= $1 AND asn <> 0
+		GROUP BY asn
+		ORDER BY events DESC, asn
+		LIMIT $2
+	`, from, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count security events by ASN: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var (
+			a   ASNCount
+			asn int64
+		)
+		if err := rows.Scan(&asn, &a.ASOrg, &a.Events, &a.Blocked); err != nil {
+			return nil, fmt.Errorf("failed to scan ASN count: %w", err)
+		}
+		a.ASN = uint32(asn)
+		breakdown.ASNs = append(breakdown.ASNs, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to count security events by ASN: %w", err)
+	}
+	return breakdown, nil
+}
+
+// whereBuilder assembles a WHERE clause with numbered placeholders
+type whereBuilder struct {
+	conds []string
+	args  []interface{}
+}
+
+func (w *whereBuilder) cond(expr string, arg interface{}) {
+	w.args = append(w.args, arg)
+	w.conds = append(w.conds, strings.Replace(expr, "?", "$"+strconv.Itoa(len(w.args)), 1))
+}
+
+func (w *whereBuilder) add(column, value string) {
+	if value != "" {
+		w.cond(column+" = ?", value)
+	}
+}
+
+func (w *whereBuilder) timeRange(column string, from, to time.Time) {
+	if !from.IsZero() {
+		w.cond(column+" >= ?", from)
+	}
+	if !to.IsZero() {
+		w.cond(column+" < ?", to)
+	}
+}
+
+func (w *whereBuilder) sql() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(w.conds, " AND ")
+}
+
+// page appends LIMIT/OFFSET placeholders and returns the clause with its args
+func (w *whereBuilder) page(page, limit int) (string, []interface{}) {
+	limit, offset := pageBounds(page, limit)
+	n := len(w.args)
+	clause := fmt.Sprintf(" LIMIT $%d OFFSET $%d", n+1, n+2)
+	return clause, append(append([]interface{}{}, w.args...), limit, offset)
+}
+
+// pageBounds converts a 1-based page and limit to LIMIT/OFFSET values
+func pageBounds(page, limit int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 50
+	}
+	return limit, (page - 1) * limit
+}
@@ -0,0 +1,149 @@
+package security
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+func TestSQLStore_ListEvents_Filters(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	from := time.Now().Add(-time.Hour)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM security_events WHERE event_type = $1 AND ip_address = $2 AND occurred_at >= $3`)).
+		WithArgs("login_failure", "10.0.0.1", from).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	uid := uuid.New()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM security_events WHERE event_type = $1 AND ip_address = $2 AND occurred_at >= $3 ORDER BY occurred_at DESC LIMIT $4 OFFSET $5`)).
+		WithArgs("login_failure", "10.0.0.1", from, 20, 20).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "occurred_at", "event_type", "severity", "user_id", "ip_address", "user_agent",
+			"request_id", "endpoint", "method", "status", "details", "risk_score", "blocked", "country", "city", "asn", "as_org"}).
+			AddRow(uuid.NewString(), time.Now(), "login_failure", "medium", uid.String(), "10.0.0.1", "curl",
+				"req-1", "/api/v1/auth/login", "POST", 401, []byte(`{"reason":"bad password"}`), 30, false, "DE", "Berlin", 3320, "Deutsche Telekom AG"))
+
+	store := NewSQLStore(db)
+	events, total, err := store.ListEvents(context.Background(), EventFilter{
+		EventType: EventTypeLoginFailure,
+		IPAddress: "10.0.0.1",
+		From:      from,
+		Page:      2,
+		Limit:     20,
+	})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if total != 1 || len(events) != 1 {
+		t.Fatalf("want 1 event, got %d (total %d)", len(events), total)
+	}
+	if events[0].UserID == nil || *events[0].UserID != uid || events[0].Details["reason"] != "bad password" {
+		t.Fatalf("unexpected event: %+v", events[0])
+	}
+	if geo := events[0].Geo; geo == nil || geo.Country != "DE" || geo.ASN != 3320 {
+		t.Fatalf("unexpected location: %+v", geo)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+type memoryStore struct {
+	mu     sync.Mutex
+	events []SecurityEvent
+	alerts []SecurityAlert
+}
+
+func (m *memoryStore) SaveEvents(ctx context.Context, events []SecurityEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, events...)
+	return nil
+}
+
+func (m *memoryStore) SaveAlert(ctx context.Context, alert SecurityAlert) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.alerts = append(m.alerts, alert)
+	return nil
+}
+
+func (m *memoryStore) ListEvents(ctx context.Context, filter EventFilter) ([]SecurityEvent, int, error) {
+	return nil, 0, nil
+}
+
+func (m *memoryStore) ListAlerts(ctx context.Context, filter AlertFilter) ([]SecurityAlert, int, error) {
+	return nil, 0, nil
+}
+
+func (m *memoryStore) CountByGeo(ctx context.Context, from time.Time, limit int) (*GeoBreakdown, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	breakdown := &GeoBreakdown{Countries: []CountryCount{}, ASNs: []ASNCount{}}
+	for _, event := range m.events {
+		if event.Geo == nil || event.Timestamp.Before(from) {
+			continue
+		}
+		blocked := 0
+		if event.Blocked {
+			blocked = 1
+		}
+		if i := slices.IndexFunc(breakdown.Countries, func(c CountryCount) bool { return c.Country == event.Geo.Country }); i >= 0 {
+			breakdown.Countries[i].Events++
+			breakdown.Countries[i].Blocked += blocked
+		} else if event.Geo.Country != "" {
+			breakdown.Countries = append(breakdown.Countries, CountryCount{Country: event.Geo.Country, Events: 1, Blocked: blocked})
+		}
+		if i := slices.IndexFunc(breakdown.ASNs, func(a ASNCount) bool { return a.ASN == event.Geo.ASN }); i >= 0 {
+			breakdown.ASNs[i].Events++
+			breakdown.ASNs[i].Blocked += blocked
+		} else if event.Geo.ASN != 0 {
+			breakdown.ASNs = append(breakdown.ASNs, ASNCount{ASN: event.Geo.ASN, ASOrg: event.Geo.ASOrg, Events: 1, Blocked: blocked})
+		}
+	}
+	slices.SortFunc(breakdown.Countries, func(a, b CountryCount) int { return b.Events - a.Events })
+	slices.SortFunc(breakdown.ASNs, func(a, b ASNCount) int { return b.Events - a.Events })
+	breakdown.Countries = breakdown.Countries[:min(limit, len(breakdown.Countries))]
+	breakdown.ASNs = breakdown.ASNs[:min(limit, len(breakdown.ASNs))]
+	return breakdown, nil
+}
+
+func TestSecurityAuditor_PersistsEventsAndAlerts(t *testing.T) {
+	store := &memoryStore{}
+	auditor := NewSecurityAuditor(logrus.New())
+	auditor.SetStore(store, PersistConfig{BatchSize: 2, FlushInterval: 10 * time.Millisecond})
+
+	// Enough failures from one IP to trigger the brute force analyzer
+	for i := 0; i < 6; i++ {
+		auditor.LogLoginFailure("user@example.com", "10.0.0.9", "test", "", "invalid credentials")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		store.mu.Lock()
+		events, alerts := len(store.events), len(store.alerts)
+		store.mu.Unlock()
+		if events == 6 && alerts > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("want 6 events and an alert persisted, got %d events and %d alerts", events, alerts)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	auditor.Close()
+	if store.events[0].Details["email"] == "user@example.com" {
+		t.Fatalf("persisted event was not redacted")
+	}
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// LockoutConfig controls account lockout. After MaxAttempts failed logins
+// within Window the account is locked for Duration; unlike login throttling
+// the state lives in auth_users and survives cache loss. MaxAttempts <= 0
+// disables lockout.
+type LockoutConfig struct {
+	MaxAttempts int
+	Window      time.Duration
+	Duration    time.Duration
+}
+
+// AccountLockedError is returned by AuthenticateUser while an account is locked
+type AccountLockedError struct {
+	UserID uuid.UUID
+	Until  time.Time
+	// JustLocked is set on the failed attempt that caused the lock
+	JustLocked bool
+}
+
+func (e *AccountLockedError) Error() string {
+	return "account locked"
+}
+
+// IsAccountLocked reports whether err is an AccountLockedError
+func IsAccountLocked(err error) (*AccountLockedError, bool) {
+	var locked *AccountLockedError
+	if errors.As(err, &locked) {
+		return locked, true
+	}
+	return nil, false
+}
+
+func (c LockoutConfig) withDefaults() LockoutConfig {
+	if c.Window <= 0 {
+		c.Window = 15 * time.Minute
+	}
+	if c.Duration <= 0 {
+		c.Duration = 30 * time.Minute
+	}
+	return c
+}
+
+// recordFailedLogin counts a failed password check and locks the account once
+// the limit is reached. Attempts older than the window start a new count.
+func (s *AuthService) recordFailedLogin(ctx context.Context, userID uuid.UUID) error {
+	cfg := s.config.Lockout
+	if cfg.MaxAttempts <= 0 {
+		return nil
+	}
+	cfg = cfg.withDefaults()
+	now := time.Now()
+
+	attempts, err := s.repo.RecordFailedLogin(ctx, userID, now.Add(-cfg.Window), now)
+	if err != nil {
+		return fmt.Errorf("failed to record failed login: %w", err)
+	}
+	if attempts < cfg.MaxAttempts {
+		return nil
+	}
+
+	until := now.Add(cfg.Duration)
+	if err := s.repo.Lock(ctx, userID, until); err != nil {
+		return fmt.Errorf("failed to lock account: %w", err)
+	}
+
+	s.logger.Warnf("Account %s locked until %s after %d failed logins", userID, until.Format(time.RFC3339), attempts)
+	return &AccountLockedError{UserID: userID, Until: until, JustLocked: true}
+}
+
+// clearFailedLogins resets the failure count after a successful login
+func (s *AuthService) clearFailedLogins(ctx context.Context, userID uuid.UUID) {
+	if err := s.repo.ClearFailedLogins(ctx, userID); err != nil {
+		s.logger.Warnf("Failed to reset failed logins for %s: %v", userID, err)
+	}
+}
+
+// UnlockAccount lifts a lockout and clears failed login state (admin only)
+func (s *AuthService) UnlockAccount(ctx context.Context, userID uuid.UUID) error {
+	account, err := s.repo.GetAccount(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return apperrors.NotFound("user not found")
+		}
+		return apperrors.FromDB(err, "failed to get user")
+	}
+
+	if err := s.repo.ClearFailedLogins(ctx, userID); err != nil {
+		return fmt.Errorf("failed to unlock account: %w", err)
+	}
+
+	// Per-account throttling would otherwise still delay the next login
+	s.resetLoginThrottle(ctx, account.Email)
+
+	s.logger.Infof("Account unlocked: %s", userID)
+	return nil
+}
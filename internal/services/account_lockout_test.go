@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/repository"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var authUserColumns = []string{"id", "email", "first_name", "last_name", "role", "is_active", "created_at", "updated_at", "password_hash", "failed_login_attempts", "locked_until"}
+
+func newLockoutService(t *testing.T) (*AuthService, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	cfg := AuthConfig{
+		JWTSecret:     "secret",
+		JWTExpiration: time.Hour,
+		Lockout:       LockoutConfig{MaxAttempts: 3, Window: 15 * time.Minute, Duration: 30 * time.Minute},
+	}
+	return NewAuthService(repository.NewPostgresAuthRepository(db), nil, logrus.New(), cfg), mock
+}
+
+func TestAuthenticateUser_LocksAccountAtLimit(t *testing.T) {
+	svc, mock := newLockoutService(t)
+	uid := uuid.New()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("correct"), bcrypt.MinCost)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, email, first_name, last_name, role, is_active, created_at, updated_at, password_hash, failed_login_attempts, locked_until`)).
+		WithArgs("u@example.com").
+		WillReturnRows(sqlmock.NewRows(authUserColumns).
+			AddRow(uid, "u@example.com", "U", "S", "user", true, time.Now(), time.Now(), string(hash), 2, nil))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE auth_users SET`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), uid).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT failed_login_attempts FROM auth_users WHERE id = $1`)).
+		WithArgs(uid).
+		WillReturnRows(sqlmock.NewRows([]string{"failed_login_attempts"}).AddRow(3))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE auth_users SET locked_until = $1, failed_login_attempts = 0, first_failed_login_at = NULL WHERE id = $2`)).
+		WithArgs(sqlmock.AnyArg(), uid).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	_, err := svc.AuthenticateUser(context.Background(), models.LoginRequest{Email: "u@example.com", Password: "wrong"})
+	locked, ok := IsAccountLocked(err)
+	if !ok || !locked.JustLocked || locked.UserID != uid {
+		t.Fatalf("expected account to be locked, got %v", err)
+	}
+	if d := time.Until(locked.Until); d < 29*time.Minute || d > 30*time.Minute {
+		t.Fatalf("unexpected lock duration %s", d)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestAuthenticateUser_LockedAccountRejectsCorrectPassword(t *testing.T) {
+	svc, mock := newLockoutService(t)
+	uid := uuid.New()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("correct"), bcrypt.MinCost)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, email, first_name, last_name, role, is_active, created_at, updated_at, password_hash, failed_login_attempts, locked_until`)).
+		WithArgs("u@example.com").
+		WillReturnRows(sqlmock.NewRows(authUserColumns).
+			AddRow(uid, "u@example.com", "U", "S", "user", true, time.Now(), time.Now(), string(hash), 0, time.Now().Add(10*time.Minute)))
+
+	_, err := svc.AuthenticateUser(context.Background(), models.LoginRequest{Email: "u@example.com", Password: "correct"})
+	locked, ok := IsAccountLocked(err)
+	if !ok || locked.JustLocked {
+		t.Fatalf("expected existing lock, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestUnlockAccount(t *testing.T) {
+	svc, mock := newLockoutService(t)
+	uid := uuid.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT email, role, is_active FROM auth_users WHERE id = $1`)).
+		WithArgs(uid).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "role", "is_active"}).AddRow("u@example.com", "user", true))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE auth_users SET failed_login_attempts = 0, first_failed_login_at = NULL, locked_until = NULL WHERE id = $1`)).
+		WithArgs(uid).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := svc.UnlockAccount(context.Background(), uid); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT email, role, is_active FROM auth_users WHERE id = $1`)).
+		WithArgs(uid).
+		WillReturnError(sql.ErrNoRows)
+	if err := svc.UnlockAccount(context.Background(), uid); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// lastUsedResolution bounds last_used_at writes to one per key per interval,
+// so busy keys do not turn every request into a database write
+const lastUsedResolution = time.Minute
+
+// apiKeyPrefixLength is how much of a key is kept in clear text to tell keys
+// apart in listings ("hl_" plus 8 hex characters)
+const apiKeyPrefixLength = 11
+
+// lookupAPIKey finds the active key matching apiKey, accepting a rotated
+// secret until its grace period ends
+func (s *AuthService) lookupAPIKey(ctx context.Context, apiKey string) (*repository.APIKeyCredentials, error) {
+	keyHash := s.hashAPIKey(apiKey)
+
+	key, err := s.repo.FindAPIKey(ctx, keyHash)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, apperrors.Unauthorized("invalid API key")
+		}
+		s.logger.Errorf("Database error during API key validation: %v", err)
+		return nil, fmt.Errorf("API key validation failed")
+	}
+
+	if !key.IsActive {
+		return nil, apperrors.Unauthorized("API key is inactive")
+	}
+
+	now := time.Now()
+	if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+		return nil, apperrors.Unauthorized("API key expired")
+	}
+
+	if key.KeyHash != keyHash && (key.PreviousExpiresAt == nil || now.After(*key.PreviousExpiresAt)) {
+		return nil, apperrors.Unauthorized("API key was rotated")
+	}
+
+	return key, nil
+}
+
+// ResolveAPIKeyLimits returns the rate limit and quota of a valid API key.
+// Unlike ValidateAPIKey it does not record usage; rate limiting calls it
+// before authentication.
+func (s *AuthService) ResolveAPIKeyLimits(ctx context.Context, apiKey string) (*models.APIKeyLimits, error) {
+	key, err := s.lookupAPIKey(ctx, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return &models.APIKeyLimits{
+		ID:                 key.ID,
+		RateLimitPerMinute: key.RateLimitPerMinute,
+		MonthlyQuota:       key.MonthlyQuota,
+	}, nil
+}
+
+// RecordAPIKeyUsage counts a request against the key's monthly usage and
+// returns the usage so far this month (UTC). Without a counter store usage is
+// not tracked and 0 is returned.
+func (s *AuthService) RecordAPIKeyUsage(ctx context.Context, id uuid.UUID) (int64, error) {
+	if s.counters == nil {
+		return 0, nil
+	}
+	// Keep the counter a little past the end of the month for reporting
+	return s.counters.Incr(ctx, apiKeyUsageKey(id, time.Now()), 32*24*time.Hour)
+}
+
+// APIKeyUsage returns the key's request count for the current month
+func (s *AuthService) APIKeyUsage(ctx context.Context, id uuid.UUID) (int64, error) {
+	if s.counters == nil {
+		return 0, nil
+	}
+	value, err := s.counters.Get(ctx, apiKeyUsageKey(id, time.Now()))
+	if err != nil || value == "" {
+		// Missing counters mean no usage yet
+		return 0, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// UpdateAPIKeyLimits changes the rate limit and monthly quota of an API key.
+// Nil fields are left unchanged; 0 means the global limit and no quota.
+func (s *AuthService) UpdateAPIKeyLimits(ctx context.Context, id uuid.UUID, req models.UpdateAPIKeyLimitsRequest) (*models.APIKeyLimits, error) {
+	limits, err := s.repo.GetAPIKeyLimits(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, apperrors.NotFound("API key not found")
+		}
+		return nil, apperrors.FromDB(err, "failed to get API key")
+	}
+
+	if req.RateLimitPerMinute != nil {
+		limits.RateLimitPerMinute = *req.RateLimitPerMinute
+	}
+	if req.MonthlyQuota != nil {
+		limits.MonthlyQuota = *req.MonthlyQuota
+	}
+
+	if err := s.repo.UpdateAPIKeyLimits(ctx, limits); err != nil {
+		return nil, apperrors.FromDB(err, "failed to update API key limits")
+	}
+
+	s.logger.Infof("API key limits updated: %s (%d/min, %d/month)", id, limits.RateLimitPerMinute, limits.MonthlyQuota)
+	return limits, nil
+}
+
+// ListAPIKeys returns every API key, newest first, with masked secrets
+func (s *AuthService) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	keys, err := s.repo.ListAPIKeys(ctx)
+	if err != nil {
+		return nil, apperrors.FromDB(err, "failed to list API keys")
+	}
+
+	for i := range keys {
+		key := &keys[i]
+		key.MaskedKey = maskAPIKey(key.KeyPrefix)
+		// Only report a grace period that is still running
+		if key.PreviousKeyExpiresAt != nil && time.Now().After(*key.PreviousKeyExpiresAt) {
+			key.PreviousKeyExpiresAt = nil
+		}
+		key.MonthlyUsage, _ = s.APIKeyUsage(ctx, key.ID)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey deactivates an API key, including a rotated secret still in
+// its grace period. It reports false if the key was already revoked.
+func (s *AuthService) RevokeAPIKey(ctx context.Context, id uuid.UUID) (bool, error) {
+	revoked, err := s.repo.RevokeAPIKey(ctx, id, time.Now())
+	if err != nil {
+		return false, apperrors.FromDB(err, "failed to revoke API key")
+	}
+	if revoked {
+		s.logger.Infof("API key revoked: %s", id)
+		return true, nil
+	}
+
+	exists, err := s.repo.APIKeyExists(ctx, id)
+	if err != nil {
+		return false, apperrors.FromDB(err, "failed to get API key")
+	}
+	if !exists {
+		return false, apperrors.NotFound("API key not found")
+	}
+	return false, nil
+}
+
+// RotateAPIKey issues a new secret for an active API key. The old secret
+// stays valid for grace (nil means the configured default, 0 revokes it
+// immediately) so clients can be redeployed without downtime.
+func (s *AuthService) RotateAPIKey(ctx context.Context, id uuid.UUID, grace *time.Duration) (*models.CreateAPIKeyResponse, error) {
+	current, err := s.repo.GetAPIKeySecret(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, apperrors.NotFound("API key not found")
+		}
+		return nil, apperrors.FromDB(err, "failed to get API key")
+	}
+	if !current.IsActive {
+		return nil, apperrors.Conflict("API key is revoked")
+	}
+
+	apiKey, err := s.generateAPIKey()
+	if err != nil {
+		s.logger.Errorf("Failed to generate API key: %v", err)
+		return nil, fmt.Errorf("failed to generate API key")
+	}
+
+	now := time.Now()
+	window := s.config.APIKeyGrace
+	if grace != nil {
+		window = *grace
+	}
+	var previousHash *string
+	var previousExpiresAt *time.Time
+	if window > 0 {
+		until := now.Add(window)
+		previousHash, previousExpiresAt = &current.KeyHash, &until
+	}
+
+	// Matching on the old hash makes concurrent rotations fail instead of
+	// silently discarding each other's secret
+	rotated, err := s.repo.RotateAPIKey(ctx, &repository.APIKeyRotation{
+		ID:                id,
+		OldKeyHash:        current.KeyHash,
+		KeyHash:           s.hashAPIKey(apiKey),
+		KeyPrefix:         apiKeyPrefix(apiKey),
+		PreviousKeyHash:   previousHash,
+		PreviousExpiresAt: previousExpiresAt,
+		RotatedAt:         now,
+	})
+	if err != nil {
+		return nil, apperrors.FromDB(err, "failed to rotate API key")
+	}
+	if !rotated {
+		return nil, apperrors.Conflict("API key was rotated concurrently")
+	}
+
+	s.logger.Infof("API key rotated: %s", id)
+	return &models.CreateAPIKeyResponse{
+		ID:                   id,
+		Name:                 current.Name,
+		APIKey:               apiKey,
+		ExpiresAt:            current.ExpiresAt,
+		CreatedAt:            current.CreatedAt,
+		PreviousKeyExpiresAt: previousExpiresAt,
+	}, nil
+}
+
+// ExpireAPIKeys deactivates keys past their expires_at and forgets rotated
+// secrets whose grace period is over. Validation already rejects both; this
+// keeps the table and the key listing accurate.
+func (s *AuthService) ExpireAPIKeys(ctx context.Context) (int64, error) {
+	expired, err := s.repo.ExpireAPIKeys(ctx, time.Now())
+	if err != nil {
+		return expired, fmt.Errorf("failed to expire API keys: %w", err)
+	}
+
+	if expired > 0 {
+		s.logger.Infof("Deactivated %d expired API keys", expired)
+	}
+	return expired, nil
+}
+
+// touchAPIKey records that a key was used. Failures are only logged: usage
+// tracking must not fail authentication.
+func (s *AuthService) touchAPIKey(ctx context.Context, id uuid.UUID, lastUsedAt *time.Time, now time.Time) {
+	if lastUsedAt != nil && now.Sub(*lastUsedAt) < lastUsedResolution {
+		return
+	}
+	if err := s.repo.TouchAPIKey(ctx, id, now); err != nil {
+		s.logger.Warnf("Failed to record API key usage for %s: %v", id, err)
+	}
+}
+
+// apiKeyUsageKey is the monthly usage counter of a key, e.g.
+// api_key_usage:<id>:2024-05
+func apiKeyUsageKey(id uuid.UUID, now time.Time) string {
+	return "api_key_usage:" + id.String() + ":" + now.UTC().Format("2006-01")
+}
+
+func apiKeyPrefix(apiKey string) string {
+	if len(apiKey) < apiKeyPrefixLength {
+		return ""
+	}
+	return apiKey[:apiKeyPrefixLength]
+}
+
+// maskAPIKey renders a stored prefix for display; keys created before
+// prefixes were stored show only the scheme
+func maskAPIKey(prefix string) string {
+	if prefix == "" {
+		return "hl_****"
+	}
+	return prefix + "****"
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const validateAPIKeyQuery = `SELECT id, permissions, is_active, expires_at, key_hash, previous_expires_at, last_used_at, rate_limit_per_minute, monthly_quota
+			  FROM api_keys WHERE key_hash = $1 OR previous_key_hash = $2`
+
+func apiKeyRow(id uuid.UUID, storedHash string, previousExpiresAt, lastUsedAt interface{}) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "permissions", "is_active", "expires_at", "key_hash", "previous_expires_at", "last_used_at", "rate_limit_per_minute", "monthly_quota"}).
+		AddRow(id, pq.Array([]string{"read"}), true, nil, storedHash, previousExpiresAt, lastUsedAt, 0, 0)
+}
+
+func TestValidateAPIKey_TracksLastUsed(t *testing.T) {
+	svc, mock, cleanup := newAuthServiceMock(t)
+	defer cleanup()
+	id := uuid.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(validateAPIKeyQuery)).
+		WillReturnRows(apiKeyRow(id, svc.hashAPIKey("hl_abc"), nil, nil))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE api_keys SET last_used_at = $1 WHERE id = $2`)).
+		WithArgs(sqlmock.AnyArg(), id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	perms, err := svc.ValidateAPIKey(context.Background(), "hl_abc")
+	if err != nil || len(perms) != 1 {
+		t.Fatalf("validate: %v %v", perms, err)
+	}
+
+	// Used a moment ago: no write
+	mock.ExpectQuery(regexp.QuoteMeta(validateAPIKeyQuery)).
+		WillReturnRows(apiKeyRow(id, svc.hashAPIKey("hl_abc"), nil, time.Now().Add(-time.Second)))
+	if _, err := svc.ValidateAPIKey(context.Background(), "hl_abc"); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestValidateAPIKey_RotatedSecretGracePeriod(t *testing.T) {
+	svc, mock, cleanup := newAuthServiceMock(t)
+	defer cleanup()
+	id := uuid.New()
+	recent := time.Now()
+
+	// Old secret within the grace period
+	mock.ExpectQuery(regexp.QuoteMeta(validateAPIKeyQuery)).
+		WillReturnRows(apiKeyRow(id, svc.hashAPIKey("hl_new"), time.Now().Add(time.Minute), recent))
+	if _, err := svc.ValidateAPIKey(context.Background(), "hl_old"); err != nil {
+		t.Fatalf("old secret in grace period: %v", err)
+	}
+
+	// Old secret after the grace period
+	mock.ExpectQuery(regexp.QuoteMeta(validateAPIKeyQuery)).
+		WillReturnRows(apiKeyRow(id, svc.hashAPIKey("hl_new"), time.Now().Add(-time.Minute), recent))
+	_, err := svc.ValidateAPIKey(context.Background(), "hl_old")
+	if !errors.Is(err, apperrors.ErrUnauthorized) || !strings.Contains(err.Error(), "rotated") {
+		t.Fatalf("expected rotated error, got %v", err)
+	}
+}
+
+func TestRotateAPIKey(t *testing.T) {
+	svc, mock, cleanup := newAuthServiceMock(t)
+	defer cleanup()
+	id := uuid.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT name, key_hash, is_active, expires_at, created_at FROM api_keys WHERE id = $1`)).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "key_hash", "is_active", "expires_at", "created_at"}).
+			AddRow("ci", "oldhash", true, nil, time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE api_keys SET key_hash = $1, key_prefix = $2, previous_key_hash = $3, previous_expires_at = $4, rotated_at = $5 WHERE id = $6 AND key_hash = $7`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "oldhash", sqlmock.AnyArg(), sqlmock.AnyArg(), id, "oldhash").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	grace := time.Hour
+	resp, err := svc.RotateAPIKey(context.Background(), id, &grace)
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if !strings.HasPrefix(resp.APIKey, "hl_") || resp.PreviousKeyExpiresAt == nil {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	// Revoked keys cannot be rotated
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT name, key_hash, is_active, expires_at, created_at FROM api_keys WHERE id = $1`)).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "key_hash", "is_active", "expires_at", "created_at"}).
+			AddRow("ci", "oldhash", false, nil, time.Now()))
+	if _, err := svc.RotateAPIKey(context.Background(), id, nil); !errors.Is(err, apperrors.ErrConflict) {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	svc, mock, cleanup := newAuthServiceMock(t)
+	defer cleanup()
+	id := uuid.New()
+	revoke := regexp.QuoteMeta(`UPDATE api_keys SET is_active = false, revoked_at = $1, previous_key_hash = NULL WHERE id = $2 AND is_active = true`)
+
+	mock.ExpectExec(revoke).WithArgs(sqlmock.AnyArg(), id).WillReturnResult(sqlmock.NewResult(0, 1))
+	if revoked, err := svc.RevokeAPIKey(context.Background(), id); err != nil || !revoked {
+		t.Fatalf("revoke: %v %v", revoked, err)
+	}
+
+	// Already revoked
+	mock.ExpectExec(revoke).WithArgs(sqlmock.AnyArg(), id).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT 1 FROM api_keys WHERE id = $1`)).WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+	if revoked, err := svc.RevokeAPIKey(context.Background(), id); err != nil || revoked {
+		t.Fatalf("repeat revoke: %v %v", revoked, err)
+	}
+
+	// Unknown
+	mock.ExpectExec(revoke).WithArgs(sqlmock.AnyArg(), id).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT 1 FROM api_keys WHERE id = $1`)).WithArgs(id).WillReturnError(sql.ErrNoRows)
+	if _, err := svc.RevokeAPIKey(context.Background(), id); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestListAPIKeys_Masked(t *testing.T) {
+	svc, mock, cleanup := newAuthServiceMock(t)
+	defer cleanup()
+
+	rows := sqlmock.NewRows([]string{"id", "name", "key_prefix", "permissions", "is_active", "created_at", "expires_at", "last_used_at", "revoked_at", "rotated_at", "previous_expires_at", "rate_limit_per_minute", "monthly_quota"}).
+		AddRow(uuid.New(), "ci", "hl_1a2b3c4d", pq.Array([]string{"read"}), true, time.Now(), nil, nil, nil, nil, time.Now().Add(-time.Hour), 600, 100000).
+		AddRow(uuid.New(), "legacy", "", pq.Array([]string{"*"}), false, time.Now(), nil, nil, time.Now(), nil, nil, 0, 0)
+	mock.ExpectQuery(`SELECT id, name, key_prefix, permissions, .* FROM api_keys ORDER BY created_at DESC`).WillReturnRows(rows)
+
+	keys, err := svc.ListAPIKeys(context.Background())
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(keys) != 2 || keys[0].MaskedKey != "hl_1a2b3c4d****" || keys[1].MaskedKey != "hl_****" {
+		t.Fatalf("unexpected keys: %+v", keys)
+	}
+	if keys[0].PreviousKeyExpiresAt != nil {
+		t.Fatal("expired grace period should not be reported")
+	}
+}
+
+func TestUpdateAPIKeyLimits_KeepsOmittedFields(t *testing.T) {
+	svc, mock, cleanup := newAuthServiceMock(t)
+	defer cleanup()
+	id := uuid.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT rate_limit_per_minute, monthly_quota FROM api_keys WHERE id = $1`)).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"rate_limit_per_minute", "monthly_quota"}).AddRow(600, 100000))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE api_keys SET rate_limit_per_minute = $1, monthly_quota = $2 WHERE id = $3`)).
+		WithArgs(600, int64(5000), id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	quota := int64(5000)
+	limits, err := svc.UpdateAPIKeyLimits(context.Background(), id, models.UpdateAPIKeyLimitsRequest{MonthlyQuota: &quota})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if limits.RateLimitPerMinute != 600 || limits.MonthlyQuota != 5000 {
+		t.Fatalf("unexpected limits: %+v", limits)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT rate_limit_per_minute, monthly_quota FROM api_keys WHERE id = $1`)).
+		WithArgs(id).WillReturnError(sql.ErrNoRows)
+	if _, err := svc.UpdateAPIKeyLimits(context.Background(), id, models.UpdateAPIKeyLimitsRequest{}); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestExpireAPIKeys(t *testing.T) {
+	svc, mock, cleanup := newAuthServiceMock(t)
+	defer cleanup()
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE api_keys SET is_active = false WHERE is_active = true AND expires_at IS NOT NULL AND expires_at < $1`)).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE api_keys SET previous_key_hash = NULL WHERE previous_key_hash IS NOT NULL AND previous_expires_at < $1`)).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	n, err := svc.ExpireAPIKeys(context.Background())
+	if err != nil || n != 2 {
+		t.Fatalf("want 2 expired, got %d (%v)", n, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
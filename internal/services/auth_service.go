@@ -4,71 +4,138 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
-	"database/sql"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"time"
 
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/jwtkeys"
+	"highload-microservice/internal/mail"
 	"highload-microservice/internal/models"
+	"highload-microservice/internal/password"
+	"highload-microservice/internal/rbac"
+	"highload-microservice/internal/repository"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"github.com/lib/pq"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthService struct {
-	db     *sql.DB
-	logger *logrus.Logger
-	config AuthConfig
+	repo     repository.AuthRepository
+	counters Counter // per-account login throttling; nil disables it
+	logger   *logrus.Logger
+	config   AuthConfig
+	keys     *jwtkeys.KeySet
+
+	// Account email: verification links, invitations and email changes
+	mailer       mail.Sender
+	registration *RegistrationConfig // nil disables self-registration
+	invitations  *InvitationConfig   // nil disables invitations
+	profile      *ProfileConfig      // nil disables email changes
+
+	events KafkaProducer // profile_updated; nil disables it
 }
 
 type AuthConfig struct {
 	JWTSecret         string
+	SigningKeys       *jwtkeys.KeySet // nil signs with JWTSecret under DefaultKeyID
 	JWTExpiration     time.Duration
 	RefreshExpiration time.Duration
 	APIKeyLength      int
+	APIKeyGrace       time.Duration // default validity of the old secret after rotation
+	LoginThrottle     LoginThrottleConfig
+	Lockout           LockoutConfig
+	Permissions       rbac.Matrix       // nil means rbac.Default()
+	Passwords         *password.Checker // nil checks password.DefaultPolicy()
 }
 
-func NewAuthService(db *sql.DB, logger *logrus.Logger, config AuthConfig) *AuthService {
+// DefaultKeyID is the key ID of JWT_SECRET when JWT_KEY_ID is not set
+const DefaultKeyID = "default"
+
+func NewAuthService(repo repository.AuthRepository, counters Counter, logger *logrus.Logger, config AuthConfig) *AuthService {
+	keys := config.SigningKeys
+	if keys == nil {
+		var err error
+		keys, err = jwtkeys.Load(jwtkeys.Config{Secret: config.JWTSecret, SecretID: DefaultKeyID})
+		if err != nil {
+			logger.Errorf("Invalid JWT secret: %v", err)
+		}
+	}
+
+	if config.Passwords == nil {
+		config.Passwords, _ = password.NewChecker(password.DefaultPolicy(), nil)
+	}
+
 	return &AuthService{
-		db:     db,
-		logger: logger,
-		config: config,
+		repo:     repo,
+		counters: counters,
+		logger:   logger,
+		config:   config,
+		keys:     keys,
 	}
 }
 
 // AuthenticateUser authenticates user with email and password
 func (s *AuthService) AuthenticateUser(ctx context.Context, req models.LoginRequest) (*models.LoginResponse, error) {
-	// Get user by email
-	var user models.AuthUser
-	var passwordHash string
-
-	query := `SELECT id, email, first_name, last_name, role, is_active, created_at, updated_at, password_hash 
-			  FROM auth_users WHERE email = $1 AND is_active = true`
-
-	err := s.db.QueryRowContext(ctx, query, req.Email).Scan(
-		&user.ID, &user.Email, &user.FirstName, &user.LastName,
-		&user.Role, &user.IsActive, &user.CreatedAt, &user.UpdatedAt, &passwordHash,
-	)
+	// Per-account throttling, independent of the caller's IP
+	if err := s.checkLoginThrottle(ctx, req.Email); err != nil {
+		s.logger.Warnf("Authentication throttled for email: %s", req.Email)
+		return nil, err
+	}
 
+	// Get user by email
+	creds, err := s.repo.FindCredentials(ctx, req.Email)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, repository.ErrNotFound) {
 			s.logger.Warnf("Authentication failed for email: %s - user not found", req.Email)
-			return nil, fmt.Errorf("invalid credentials")
+			s.recordLoginFailure(ctx, req.Email)
+			return nil, apperrors.Unauthorized("invalid credentials")
 		}
 		s.logger.Errorf("Database error during authentication: %v", err)
 		return nil, fmt.Errorf("authentication failed")
 	}
 
+	user := creds.User
+
+	// Locked accounts are rejected before the password is checked
+	if creds.LockedUntil != nil && time.Now().Before(*creds.LockedUntil) {
+		s.logger.Warnf("Authentication rejected for email: %s - account locked", req.Email)
+		return nil, &AccountLockedError{UserID: user.ID, Until: *creds.LockedUntil}
+	}
+
 	// Verify password
-	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
+	if err := bcrypt.CompareHashAndPassword([]byte(creds.PasswordHash), []byte(req.Password)); err != nil {
 		s.logger.Warnf("Authentication failed for email: %s - invalid password", req.Email)
-		return nil, fmt.Errorf("invalid credentials")
+		s.recordLoginFailure(ctx, req.Email)
+		if err := s.recordFailedLogin(ctx, user.ID); err != nil {
+			if _, locked := IsAccountLocked(err); locked {
+				return nil, err
+			}
+			s.logger.Errorf("Failed to track failed login: %v", err)
+		}
+		return nil, apperrors.Unauthorized("invalid credentials")
+	}
+
+	if creds.FailedAttempts > 0 || creds.LockedUntil != nil {
+		s.clearFailedLogins(ctx, user.ID)
 	}
 
-	// Generate tokens
+	response, err := s.startSession(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	s.reportPasswordExpiry(ctx, response)
+
+	s.resetLoginThrottle(ctx, req.Email)
+	s.logger.Infof("User authenticated successfully: %s", user.Email)
+	return response, nil
+}
+
+// startSession issues the tokens of a new session of an authenticated user
+func (s *AuthService) startSession(ctx context.Context, user models.AuthUser) (*models.LoginResponse, error) {
 	accessToken, err := s.generateAccessToken(user)
 	if err != nil {
 		s.logger.Errorf("Failed to generate access token: %v", err)
@@ -82,13 +149,11 @@ func (s *AuthService) AuthenticateUser(ctx context.Context, req models.LoginRequ
 	}
 
 	// Store refresh token in database
-	if err := s.storeRefreshToken(ctx, user.ID, refreshToken); err != nil {
+	if err := s.storeRefreshToken(ctx, refreshToken, newSession(ctx, user.ID)); err != nil {
 		s.logger.Errorf("Failed to store refresh token: %v", err)
 		return nil, fmt.Errorf("token storage failed")
 	}
 
-	s.logger.Infof("User authenticated successfully: %s", user.Email)
-
 	return &models.LoginResponse{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
@@ -98,54 +163,79 @@ func (s *AuthService) AuthenticateUser(ctx context.Context, req models.LoginRequ
 	}, nil
 }
 
-// RefreshToken generates new access token using refresh token
+// RefreshToken rotates a refresh token: the presented token is revoked and a
+// new one from the same family is issued together with a new access token.
+// Presenting an already rotated token revokes the whole family, since either
+// the client or an attacker holds a stolen copy.
 func (s *AuthService) RefreshToken(ctx context.Context, req models.RefreshTokenRequest) (*models.LoginResponse, error) {
 	// Verify refresh token
-	userID, err := s.verifyRefreshToken(ctx, req.RefreshToken)
+	stored, err := s.lookupRefreshToken(ctx, req.RefreshToken)
 	if err != nil {
 		s.logger.Warnf("Invalid refresh token: %v", err)
-		return nil, fmt.Errorf("invalid refresh token")
+		return nil, apperrors.Wrap(apperrors.ErrUnauthorized, "invalid refresh token", err)
 	}
 
-	// Get user
-	var user models.AuthUser
-	query := `SELECT id, email, first_name, last_name, role, is_active, created_at, updated_at 
-			  FROM auth_users WHERE id = $1 AND is_active = true`
+	if stored.RevokedAt != nil {
+		return nil, s.handleRefreshTokenReuse(ctx, stored)
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, apperrors.Unauthorized("refresh token expired")
+	}
 
-	err = s.db.QueryRowContext(ctx, query, userID).Scan(
-		&user.ID, &user.Email, &user.FirstName, &user.LastName,
-		&user.Role, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
-	)
+	// Revoke the presented token; losing this race to a concurrent refresh
+	// with the same token means it was reused
+	rotated, err := s.repo.RevokeRefreshToken(ctx, stored.ID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	if !rotated {
+		return nil, s.handleRefreshTokenReuse(ctx, stored)
+	}
 
+	// Get user
+	user, err := s.repo.GetActiveUser(ctx, stored.UserID)
 	if err != nil {
 		s.logger.Errorf("Failed to get user for refresh: %v", err)
-		return nil, fmt.Errorf("user not found")
+		if errors.Is(err, repository.ErrNotFound) {
+			// Deactivated or deleted since the token was issued
+			return nil, apperrors.Wrap(apperrors.ErrUnauthorized, "user not found", err)
+		}
+		return nil, apperrors.FromDB(err, "failed to get user")
 	}
 
 	// Generate new access token
-	accessToken, err := s.generateAccessToken(user)
+	accessToken, err := s.generateAccessToken(*user)
 	if err != nil {
 		s.logger.Errorf("Failed to generate new access token: %v", err)
 		return nil, fmt.Errorf("token generation failed")
 	}
 
+	refreshToken, err := s.generateRefreshToken(user.ID)
+	if err != nil {
+		s.logger.Errorf("Failed to generate refresh token: %v", err)
+		return nil, fmt.Errorf("token generation failed")
+	}
+	if err := s.storeRefreshToken(ctx, refreshToken, *stored); err != nil {
+		s.logger.Errorf("Failed to store refresh token: %v", err)
+		return nil, fmt.Errorf("token storage failed")
+	}
+
 	return &models.LoginResponse{
 		AccessToken:  accessToken,
-		RefreshToken: req.RefreshToken, // Keep the same refresh token
+		RefreshToken: refreshToken,
 		TokenType:    "Bearer",
 		ExpiresIn:    int64(s.config.JWTExpiration.Seconds()),
-		User:         user,
+		User:         *user,
 	}, nil
 }
 
-// ValidateToken validates JWT token and returns claims
-func (s *AuthService) ValidateToken(tokenString string) (*models.JWTClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(s.config.JWTSecret), nil
-	})
+// ValidateToken validates JWT token and returns claims. Tokens revoked by
+// Logout are rejected until they expire.
+func (s *AuthService) ValidateToken(ctx context.Context, tokenString string) (*models.JWTClaims, error) {
+	if s.keys == nil {
+		return nil, fmt.Errorf("invalid token: no signing keys configured")
+	}
+	token, err := jwt.Parse(tokenString, s.keys.Keyfunc)
 
 	if err != nil {
 		return nil, fmt.Errorf("invalid token: %v", err)
@@ -193,7 +283,13 @@ func (s *AuthService) ValidateToken(tokenString string) (*models.JWTClaims, erro
 			return nil, fmt.Errorf("token expired")
 		}
 
+		jti, _ := claims["jti"].(string)
+		if s.isTokenRevoked(ctx, jti) {
+			return nil, fmt.Errorf("token revoked")
+		}
+
 		return &models.JWTClaims{
+			ID:        jti,
 			UserID:    userID,
 			Email:     email,
 			Role:      models.UserRole(roleStr),
@@ -220,10 +316,17 @@ func (s *AuthService) CreateAPIKey(ctx context.Context, req models.CreateAPIKeyR
 
 	// Create API key record
 	apiKeyID := uuid.New()
-	query := `INSERT INTO api_keys (id, name, key_hash, permissions, is_active, created_at, expires_at) 
-			  VALUES ($1, $2, $3, $4, $5, $6, $7)`
-
-	_, err = s.db.ExecContext(ctx, query, apiKeyID, req.Name, keyHash, pq.Array(req.Permissions), true, time.Now(), req.ExpiresAt)
+	err = s.repo.CreateAPIKey(ctx, &repository.NewAPIKey{
+		ID:                 apiKeyID,
+		Name:               req.Name,
+		KeyHash:            keyHash,
+		KeyPrefix:          apiKeyPrefix(apiKey),
+		Permissions:        req.Permissions,
+		CreatedAt:          time.Now(),
+		ExpiresAt:          req.ExpiresAt,
+		RateLimitPerMinute: req.RateLimitPerMinute,
+		MonthlyQuota:       req.MonthlyQuota,
+	})
 	if err != nil {
 		s.logger.Errorf("Failed to create API key: %v", err)
 		return nil, fmt.Errorf("failed to create API key")
@@ -240,34 +343,16 @@ func (s *AuthService) CreateAPIKey(ctx context.Context, req models.CreateAPIKeyR
 	}, nil
 }
 
-// ValidateAPIKey validates API key and returns permissions
+// ValidateAPIKey validates API key and returns permissions. The secret
+// replaced by a rotation is accepted until its grace period ends.
 func (s *AuthService) ValidateAPIKey(ctx context.Context, apiKey string) ([]string, error) {
-	keyHash := s.hashAPIKey(apiKey)
-
-	var permissions pq.StringArray
-	var isActive bool
-	var expiresAt *time.Time
-
-	query := `SELECT permissions, is_active, expires_at FROM api_keys WHERE key_hash = $1`
-	err := s.db.QueryRowContext(ctx, query, keyHash).Scan(&permissions, &isActive, &expiresAt)
-
+	key, err := s.lookupAPIKey(ctx, apiKey)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("invalid API key")
-		}
-		s.logger.Errorf("Database error during API key validation: %v", err)
-		return nil, fmt.Errorf("API key validation failed")
+		return nil, err
 	}
 
-	if !isActive {
-		return nil, fmt.Errorf("API key is inactive")
-	}
-
-	if expiresAt != nil && time.Now().After(*expiresAt) {
-		return nil, fmt.Errorf("API key expired")
-	}
-
-	return []string(permissions), nil
+	s.touchAPIKey(ctx, key.ID, key.LastUsedAt, time.Now())
+	return key.Permissions, nil
 }
 
 // Helper methods
@@ -275,6 +360,7 @@ func (s *AuthService) ValidateAPIKey(ctx context.Context, apiKey string) ([]stri
 func (s *AuthService) generateAccessToken(user models.AuthUser) (string, error) {
 	now := time.Now()
 	claims := jwt.MapClaims{
+		"jti":     uuid.NewString(),
 		"user_id": user.ID.String(),
 		"email":   user.Email,
 		"role":    string(user.Role),
@@ -283,8 +369,10 @@ func (s *AuthService) generateAccessToken(user models.AuthUser) (string, error)
 		"iss":     "highload-microservice",
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.config.JWTSecret))
+	if s.keys == nil {
+		return "", fmt.Errorf("no signing keys configured")
+	}
+	return s.keys.Sign(claims)
 }
 
 func (s *AuthService) generateRefreshToken(userID uuid.UUID) (string, error) {
@@ -295,37 +383,6 @@ func (s *AuthService) generateRefreshToken(userID uuid.UUID) (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
-func (s *AuthService) storeRefreshToken(ctx context.Context, userID uuid.UUID, token string) error {
-	query := `INSERT INTO refresh_tokens (user_id, token_hash, expires_at, created_at) 
-			  VALUES ($1, $2, $3, $4)`
-
-	tokenHash := s.hashAPIKey(token) // Reuse hash function
-	expiresAt := time.Now().Add(s.config.RefreshExpiration)
-
-	_, err := s.db.ExecContext(ctx, query, userID, tokenHash, expiresAt, time.Now())
-	return err
-}
-
-func (s *AuthService) verifyRefreshToken(ctx context.Context, token string) (uuid.UUID, error) {
-	tokenHash := s.hashAPIKey(token)
-
-	var userID uuid.UUID
-	var expiresAt time.Time
-
-	query := `SELECT user_id, expires_at FROM refresh_tokens WHERE token_hash = $1`
-	err := s.db.QueryRowContext(ctx, query, tokenHash).Scan(&userID, &expiresAt)
-
-	if err != nil {
-		return uuid.Nil, err
-	}
-
-	if time.Now().After(expiresAt) {
-		return uuid.Nil, fmt.Errorf("refresh token expired")
-	}
-
-	return userID, nil
-}
-
 func (s *AuthService) generateAPIKey() (string, error) {
 	bytes := make([]byte, s.config.APIKeyLength)
 	if _, err := rand.Read(bytes); err != nil {
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"highload-microservice/internal/models"
+	"highload-microservice/internal/repository"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/golang-jwt/jwt/v5"
@@ -25,7 +26,7 @@ func newAuthServiceMock(t *testing.T) (*AuthService, sqlmock.Sqlmock, func()) {
 		t.Fatalf("sqlmock: %v", err)
 	}
 	cfg := AuthConfig{JWTSecret: "secret", JWTExpiration: time.Hour, RefreshExpiration: 24 * time.Hour, APIKeyLength: 4}
-	svc := NewAuthService(db, logrus.New(), cfg)
+	svc := NewAuthService(repository.NewPostgresAuthRepository(db), nil, logrus.New(), cfg)
 	cleanup := func() { db.Close() }
 	return svc, mock, cleanup
 }
@@ -38,15 +39,15 @@ func TestAuthenticateUser_Success(t *testing.T) {
 	// bcrypt password: hash of "admin123456"
 	hash, _ := bcrypt.GenerateFromPassword([]byte("admin123456"), bcrypt.DefaultCost)
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, email, first_name, last_name, role, is_active, created_at, updated_at, password_hash 
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, email, first_name, last_name, role, is_active, created_at, updated_at, password_hash, failed_login_attempts, locked_until 
               FROM auth_users WHERE email = $1 AND is_active = true`)).
 		WithArgs("admin@local").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "first_name", "last_name", "role", "is_active", "created_at", "updated_at", "password_hash"}).
-			AddRow(uid, "admin@local", "Admin", "User", "admin", true, time.Now(), time.Now(), string(hash)))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "first_name", "last_name", "role", "is_active", "created_at", "updated_at", "password_hash", "failed_login_attempts", "locked_until"}).
+			AddRow(uid, "admin@local", "Admin", "User", "admin", true, time.Now(), time.Now(), string(hash), 0, nil))
 
-	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO refresh_tokens (user_id, token_hash, expires_at, created_at) 
-              VALUES ($1, $2, $3, $4)`)).
-		WithArgs(uid, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at, created_at, user_agent, ip_address, login_at) 
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`)).
+		WithArgs(uid, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	resp, err := svc.AuthenticateUser(context.Background(), models.LoginRequest{Email: "admin@local", Password: "admin123456"})
@@ -67,12 +68,19 @@ func TestRefreshToken_Success(t *testing.T) {
 	defer cleanup()
 
 	uid := uuid.New()
+	tokenID, familyID := uuid.New(), uuid.New()
 	// prepare stored refresh token
 	tok := "abcdef"
-	// Expect verifyRefreshToken query
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT user_id, expires_at FROM refresh_tokens WHERE token_hash = $1`)).
+	// Expect lookupRefreshToken query
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, user_id, COALESCE(family_id, id), expires_at, revoked_at, user_agent, ip_address, COALESCE(login_at, created_at) FROM refresh_tokens WHERE token_hash = $1`)).
 		WithArgs(svc.hashAPIKey(tok)).
-		WillReturnRows(sqlmock.NewRows([]string{"user_id", "expires_at"}).AddRow(uid, time.Now().Add(time.Hour)))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "family_id", "expires_at", "revoked_at", "user_agent", "ip_address", "login_at"}).
+			AddRow(tokenID, uid, familyID, time.Now().Add(time.Hour), nil, "", "", time.Now()))
+
+	// Expect the presented token to be revoked
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE refresh_tokens SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), tokenID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
 
 	// Expect user fetch
 	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, email, first_name, last_name, role, is_active, created_at, updated_at 
@@ -81,6 +89,11 @@ func TestRefreshToken_Success(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "first_name", "last_name", "role", "is_active", "created_at", "updated_at"}).
 			AddRow(uid, "admin@local", "Admin", "User", "admin", true, time.Now(), time.Now()))
 
+	// Expect the rotated token in the same family
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at, created_at, user_agent, ip_address, login_at)`)).
+		WithArgs(uid, sqlmock.AnyArg(), familyID, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
 	resp, err := svc.RefreshToken(context.Background(), models.RefreshTokenRequest{RefreshToken: tok})
 	if err != nil {
 		t.Fatalf("refresh: %v", err)
@@ -88,6 +101,9 @@ func TestRefreshToken_Success(t *testing.T) {
 	if resp.AccessToken == "" {
 		t.Fatalf("no new access token")
 	}
+	if resp.RefreshToken == "" || resp.RefreshToken == tok {
+		t.Fatalf("refresh token not rotated")
+	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Fatalf("sql expectations: %v", err)
@@ -101,11 +117,11 @@ func TestAuthenticateUser_InvalidPassword(t *testing.T) {
 	uid := uuid.New()
 	hash, _ := bcrypt.GenerateFromPassword([]byte("correct"), bcrypt.DefaultCost)
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, email, first_name, last_name, role, is_active, created_at, updated_at, password_hash 
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, email, first_name, last_name, role, is_active, created_at, updated_at, password_hash, failed_login_attempts, locked_until 
               FROM auth_users WHERE email = $1 AND is_active = true`)).
 		WithArgs("user@local").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "first_name", "last_name", "role", "is_active", "created_at", "updated_at", "password_hash"}).
-			AddRow(uid, "user@local", "U", "S", "user", true, time.Now(), time.Now(), string(hash)))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "first_name", "last_name", "role", "is_active", "created_at", "updated_at", "password_hash", "failed_login_attempts", "locked_until"}).
+			AddRow(uid, "user@local", "U", "S", "user", true, time.Now(), time.Now(), string(hash), 0, nil))
 
 	_, err := svc.AuthenticateUser(context.Background(), models.LoginRequest{Email: "user@local", Password: "wrong"})
 	if err == nil {
@@ -117,7 +133,7 @@ func TestAuthenticateUser_DBError(t *testing.T) {
 	svc, mock, cleanup := newAuthServiceMock(t)
 	defer cleanup()
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, email, first_name, last_name, role, is_active, created_at, updated_at, password_hash 
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, email, first_name, last_name, role, is_active, created_at, updated_at, password_hash, failed_login_attempts, locked_until 
              FROM auth_users WHERE email = $1 AND is_active = true`)).
 		WithArgs("u@example.com").
 		WillReturnError(fmt.Errorf("db down"))
@@ -132,8 +148,8 @@ func TestValidateAPIKey_NotFound(t *testing.T) {
 	svc, mock, cleanup := newAuthServiceMock(t)
 	defer cleanup()
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT permissions, is_active, expires_at FROM api_keys WHERE key_hash = $1`)).
-		WithArgs(sqlmock.AnyArg()).
+	mock.ExpectQuery(regexp.QuoteMeta(validateAPIKeyQuery)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).
 		WillReturnError(sql.ErrNoRows)
 
 	_, err := svc.ValidateAPIKey(context.Background(), "hl_abc")
@@ -146,8 +162,8 @@ func TestValidateAPIKey_DBError(t *testing.T) {
 	svc, mock, cleanup := newAuthServiceMock(t)
 	defer cleanup()
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT permissions, is_active, expires_at FROM api_keys WHERE key_hash = $1`)).
-		WithArgs(sqlmock.AnyArg()).
+	mock.ExpectQuery(regexp.QuoteMeta(validateAPIKeyQuery)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).
 		WillReturnError(fmt.Errorf("db err"))
 
 	_, err := svc.ValidateAPIKey(context.Background(), "hl_abc")
@@ -161,10 +177,10 @@ func TestValidateAPIKey_Expired(t *testing.T) {
 	defer cleanup()
 
 	past := time.Now().Add(-time.Hour)
-	rows := sqlmock.NewRows([]string{"permissions", "is_active", "expires_at"}).
-		AddRow(pq.Array([]string{"read"}), true, past)
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT permissions, is_active, expires_at FROM api_keys WHERE key_hash = $1`)).
-		WithArgs(sqlmock.AnyArg()).
+	rows := sqlmock.NewRows([]string{"id", "permissions", "is_active", "expires_at", "key_hash", "previous_expires_at", "last_used_at", "rate_limit_per_minute", "monthly_quota"}).
+		AddRow(uuid.New(), pq.Array([]string{"read"}), true, past, svc.hashAPIKey("hl_abc"), nil, nil, 0, 0)
+	mock.ExpectQuery(regexp.QuoteMeta(validateAPIKeyQuery)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).
 		WillReturnRows(rows)
 
 	_, err := svc.ValidateAPIKey(context.Background(), "hl_abc")
@@ -182,11 +198,11 @@ func TestValidateToken_SuccessAndInvalid(t *testing.T) {
 	if err != nil {
 		t.Fatalf("generate: %v", err)
 	}
-	if _, err := svc.ValidateToken(tok); err != nil {
+	if _, err := svc.ValidateToken(context.Background(), tok); err != nil {
 		t.Fatalf("validate: %v", err)
 	}
 
-	if _, err := svc.ValidateToken("not-a-token"); err == nil {
+	if _, err := svc.ValidateToken(context.Background(), "not-a-token"); err == nil {
 		t.Fatalf("expected error for invalid token")
 	}
 }
@@ -218,7 +234,7 @@ func TestValidateToken_MissingAndBadClaims(t *testing.T) {
 		c1[k] = v
 	}
 	delete(c1, "user_id")
-	if _, err := svc.ValidateToken(makeTok(c1)); err == nil {
+	if _, err := svc.ValidateToken(context.Background(), makeTok(c1)); err == nil {
 		t.Fatalf("expected error for missing user_id")
 	}
 
@@ -228,7 +244,7 @@ func TestValidateToken_MissingAndBadClaims(t *testing.T) {
 		c2[k] = v
 	}
 	c2["user_id"] = "not-uuid"
-	if _, err := svc.ValidateToken(makeTok(c2)); err == nil {
+	if _, err := svc.ValidateToken(context.Background(), makeTok(c2)); err == nil {
 		t.Fatalf("expected error for bad user_id format")
 	}
 
@@ -238,7 +254,7 @@ func TestValidateToken_MissingAndBadClaims(t *testing.T) {
 		c3[k] = v
 	}
 	delete(c3, "email")
-	if _, err := svc.ValidateToken(makeTok(c3)); err == nil {
+	if _, err := svc.ValidateToken(context.Background(), makeTok(c3)); err == nil {
 		t.Fatalf("expected error for missing email")
 	}
 
@@ -248,7 +264,7 @@ func TestValidateToken_MissingAndBadClaims(t *testing.T) {
 		c4[k] = v
 	}
 	delete(c4, "role")
-	if _, err := svc.ValidateToken(makeTok(c4)); err == nil {
+	if _, err := svc.ValidateToken(context.Background(), makeTok(c4)); err == nil {
 		t.Fatalf("expected error for missing role")
 	}
 
@@ -258,7 +274,7 @@ func TestValidateToken_MissingAndBadClaims(t *testing.T) {
 		c5[k] = v
 	}
 	delete(c5, "exp")
-	if _, err := svc.ValidateToken(makeTok(c5)); err == nil {
+	if _, err := svc.ValidateToken(context.Background(), makeTok(c5)); err == nil {
 		t.Fatalf("expected error for missing exp")
 	}
 
@@ -268,7 +284,7 @@ func TestValidateToken_MissingAndBadClaims(t *testing.T) {
 		c6[k] = v
 	}
 	delete(c6, "iat")
-	if _, err := svc.ValidateToken(makeTok(c6)); err == nil {
+	if _, err := svc.ValidateToken(context.Background(), makeTok(c6)); err == nil {
 		t.Fatalf("expected error for missing iat")
 	}
 
@@ -278,7 +294,7 @@ func TestValidateToken_MissingAndBadClaims(t *testing.T) {
 		c7[k] = v
 	}
 	delete(c7, "iss")
-	if _, err := svc.ValidateToken(makeTok(c7)); err == nil {
+	if _, err := svc.ValidateToken(context.Background(), makeTok(c7)); err == nil {
 		t.Fatalf("expected error for missing iss")
 	}
 }
@@ -288,9 +304,10 @@ func TestRefreshToken_Expired(t *testing.T) {
 	defer cleanup()
 
 	tok := "expired"
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT user_id, expires_at FROM refresh_tokens WHERE token_hash = $1`)).
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, user_id, COALESCE(family_id, id), expires_at, revoked_at, user_agent, ip_address, COALESCE(login_at, created_at) FROM refresh_tokens WHERE token_hash = $1`)).
 		WithArgs(svc.hashAPIKey(tok)).
-		WillReturnRows(sqlmock.NewRows([]string{"user_id", "expires_at"}).AddRow(uuid.New(), time.Now().Add(-time.Hour)))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "family_id", "expires_at", "revoked_at", "user_agent", "ip_address", "login_at"}).
+			AddRow(uuid.New(), uuid.New(), uuid.New(), time.Now().Add(-time.Hour), nil, "", "", time.Now()))
 
 	_, err := svc.RefreshToken(context.Background(), models.RefreshTokenRequest{RefreshToken: tok})
 	if err == nil {
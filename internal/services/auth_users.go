@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/password"
+	"highload-microservice/internal/rbac"
+	"highload-microservice/internal/repository"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// CreateAuthUserRequest describes an account created by an operator
+type CreateAuthUserRequest struct {
+	Email     string
+	Password  string
+	FirstName string
+	LastName  string
+	Role      models.UserRole
+}
+
+// CreateAuthUser creates a login account. It is used by the admin CLI to
+// bootstrap the first admin without writing SQL by hand.
+func (s *AuthService) CreateAuthUser(ctx context.Context, req CreateAuthUserRequest) (*models.AuthUser, error) {
+	email := strings.TrimSpace(req.Email)
+	if email == "" || !strings.Contains(email, "@") {
+		return nil, apperrors.Validation("a valid email is required")
+	}
+	if !rbac.ValidRole(req.Role) {
+		return nil, apperrors.Validation(fmt.Sprintf("unknown role %q", req.Role))
+	}
+	hash, err := s.hashPassword(req.Password, password.UserInfo{Email: email, FirstName: req.FirstName, LastName: req.LastName})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user := models.AuthUser{
+		ID:        uuid.New(),
+		Email:     email,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Role:      req.Role,
+		IsActive:  true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := s.repo.CreateUser(ctx, &user, hash); err != nil {
+		if apperrors.IsUniqueViolation(err) {
+			return nil, apperrors.Conflict("user with this email already exists")
+		}
+		return nil, apperrors.FromDB(err, "failed to create user")
+	}
+
+	s.logger.Infof("Auth user created: %s (%s)", user.Email, user.Role)
+	return &user, nil
+}
+
+// ResetPassword sets a new password, lifts any lockout and revokes the
+// user's sessions so tokens issued under the old password stop refreshing
+func (s *AuthService) ResetPassword(ctx context.Context, email, newPassword string) (uuid.UUID, error) {
+	hash, err := s.hashPassword(newPassword, password.UserInfo{Email: email})
+	if err != nil {
+		return uuid.Nil, err
+	}
+	account, err := s.findAccount(ctx, email)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	userID := account.ID
+
+	if err := s.repo.SetPassword(ctx, userID, hash, time.Now()); err != nil {
+		return uuid.Nil, apperrors.FromDB(err, "failed to reset password")
+	}
+
+	if _, err := s.RevokeAllSessions(ctx, userID); err != nil {
+		s.logger.Errorf("Failed to revoke sessions after password reset for %s: %v", userID, err)
+	}
+	s.resetLoginThrottle(ctx, email)
+
+	s.logger.Infof("Password reset for %s", userID)
+	return userID, nil
+}
+
+// DeactivateAuthUser disables login for an account and revokes its sessions.
+// The last active admin cannot be deactivated. Deactivating an inactive
+// account is a no-op.
+func (s *AuthService) DeactivateAuthUser(ctx context.Context, email string) (uuid.UUID, error) {
+	account, err := s.findAccount(ctx, email)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	userID := account.ID
+	if !account.IsActive {
+		return userID, nil
+	}
+
+	if account.Role == models.RoleAdmin {
+		admins, err := s.repo.CountActiveAdmins(ctx)
+		if err != nil {
+			return uuid.Nil, apperrors.FromDB(err, "failed to count admins")
+		}
+		if admins <= 1 {
+			return uuid.Nil, apperrors.Validation("cannot deactivate the last active admin")
+		}
+	}
+
+	if err := s.repo.Deactivate(ctx, userID, time.Now()); err != nil {
+		return uuid.Nil, apperrors.FromDB(err, "failed to deactivate user")
+	}
+	if _, err := s.RevokeAllSessions(ctx, userID); err != nil {
+		s.logger.Errorf("Failed to revoke sessions after deactivation of %s: %v", userID, err)
+	}
+
+	s.logger.Infof("Auth user deactivated: %s", userID)
+	return userID, nil
+}
+
+func (s *AuthService) findAccount(ctx context.Context, email string) (*repository.Account, error) {
+	account, err := s.repo.FindAccount(ctx, email)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, apperrors.NotFound("user not found")
+		}
+		return nil, apperrors.FromDB(err, "failed to get user")
+	}
+	return account, nil
+}
+
+// hashPassword checks a new password against the password policy and
+// hashes it. Policy violations are returned as a *password.PolicyError.
+func (s *AuthService) hashPassword(newPassword string, info password.UserInfo) (string, error) {
+	if err := s.config.Passwords.Check(newPassword, info); err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// reportPasswordExpiry tells the client when the user's password expires
+// under PASSWORD_MAX_AGE_DAYS. Expired passwords still log in: clients are
+// expected to ask for a new one.
+func (s *AuthService) reportPasswordExpiry(ctx context.Context, response *models.LoginResponse) {
+	if s.config.Passwords.Policy().MaxAgeDays == 0 {
+		return
+	}
+	changedAt, err := s.repo.PasswordChangedAt(ctx, response.User.ID)
+	if err != nil {
+		s.logger.Errorf("Failed to check password age of %s: %v", response.User.ID, err)
+		return
+	}
+	expiresAt := s.config.Passwords.ExpiresAt(changedAt)
+	response.PasswordExpiresAt = &expiresAt
+	response.PasswordExpired = !time.Now().Before(expiresAt)
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/password"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+func TestCreateAuthUser(t *testing.T) {
+	svc, mock := newLockoutService(t)
+	insert := regexp.QuoteMeta(`INSERT INTO auth_users (id, email, first_name, last_name, password_hash, role, is_active, created_at, updated_at)`)
+
+	mock.ExpectExec(insert).
+		WithArgs(sqlmock.AnyArg(), "ops@example.com", "Ops", "Team", sqlmock.AnyArg(), models.RoleAdmin, true, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	user, err := svc.CreateAuthUser(context.Background(), CreateAuthUserRequest{
+		Email: "ops@example.com", Password: "s3cure-password", FirstName: "Ops", LastName: "Team", Role: models.RoleAdmin,
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if user.Role != models.RoleAdmin || !user.IsActive {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+
+	mock.ExpectExec(insert).WillReturnError(&pq.Error{Code: "23505"})
+	_, err = svc.CreateAuthUser(context.Background(), CreateAuthUserRequest{Email: "ops@example.com", Password: "s3cure-password", Role: models.RoleAdmin})
+	if !errors.Is(err, apperrors.ErrConflict) {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+
+	// Rejected before touching the database
+	for _, req := range []CreateAuthUserRequest{
+		{Email: "ops@example.com", Password: "short", Role: models.RoleAdmin},
+		{Email: "ops@example.com", Password: "s3cure-password", Role: "root"},
+		{Email: "not-an-email", Password: "s3cure-password", Role: models.RoleAdmin},
+	} {
+		if _, err := svc.CreateAuthUser(context.Background(), req); !errors.Is(err, apperrors.ErrValidation) {
+			t.Fatalf("%+v: expected validation error, got %v", req, err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestResetPassword_ClearsLockoutAndRevokesSessions(t *testing.T) {
+	svc, mock := newLockoutService(t)
+	uid := uuid.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, role, is_active FROM auth_users WHERE email = $1`)).
+		WithArgs("ops@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "role", "is_active"}).AddRow(uid, "user", true))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE auth_users SET password_hash = $1, failed_login_attempts = 0, first_failed_login_at = NULL, locked_until = NULL, updated_at = $2`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), uid).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE refresh_tokens SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), uid).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	got, err := svc.ResetPassword(context.Background(), "ops@example.com", "n3w-password")
+	if err != nil || got != uid {
+		t.Fatalf("reset: %v %v", got, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestDeactivateAuthUser_LastAdmin(t *testing.T) {
+	svc, mock := newLockoutService(t)
+	uid := uuid.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, role, is_active FROM auth_users WHERE email = $1`)).
+		WithArgs("ops@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "role", "is_active"}).AddRow(uid, "admin", true))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM auth_users WHERE role = $1 AND is_active = true`)).
+		WithArgs(models.RoleAdmin).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	if _, err := svc.DeactivateAuthUser(context.Background(), "ops@example.com"); !errors.Is(err, apperrors.ErrValidation) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestCreateAuthUser_PasswordPolicy(t *testing.T) {
+	svc, mock := newLockoutService(t)
+
+	_, err := svc.CreateAuthUser(context.Background(), CreateAuthUserRequest{
+		Email: "ops@example.com", Password: "Opsteam-2024", FirstName: "Ops", LastName: "Team", Role: models.RoleAdmin,
+	})
+	var policyErr *password.PolicyError
+	if !errors.As(err, &policyErr) || !errors.Is(err, apperrors.ErrValidation) {
+		t.Fatalf("expected a password policy error, got %v", err)
+	}
+	if policyErr.Violations[0].Code != "similar_to_user_info" {
+		t.Errorf("violations = %+v", policyErr.Violations)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestReportPasswordExpiry(t *testing.T) {
+	svc, mock := newLockoutService(t)
+	policy := password.DefaultPolicy()
+	policy.MaxAgeDays = 90
+	if err := svc.config.Passwords.SetPolicy(policy); err != nil {
+		t.Fatalf("SetPolicy: %v", err)
+	}
+
+	uid := uuid.New()
+	changedAt := time.Now().AddDate(0, 0, -100)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT password_changed_at FROM auth_users WHERE id = $1`)).
+		WithArgs(uid).
+		WillReturnRows(sqlmock.NewRows([]string{"password_changed_at"}).AddRow(changedAt))
+
+	response := &models.LoginResponse{User: models.AuthUser{ID: uid}}
+	svc.reportPasswordExpiry(context.Background(), response)
+	if !response.PasswordExpired || response.PasswordExpiresAt == nil || !response.PasswordExpiresAt.Equal(changedAt.AddDate(0, 0, 90)) {
+		t.Fatalf("expired %v at %v", response.PasswordExpired, response.PasswordExpiresAt)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/pagination"
+	"highload-microservice/internal/repository"
+	"highload-microservice/internal/worker"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// cacheWarmupTask is the worker pool task type of warm-up batches
+const cacheWarmupTask = "cache_warmup"
+
+// CacheWarmupConfig sizes the cache warm-up
+type CacheWarmupConfig struct {
+	Events    int // newest events to cache
+	Users     int // users to cache, the authors of those events first
+	BatchSize int // records per worker pool task
+}
+
+// CacheWarmer fills the cache after a cold start with the newest events and
+// the users who created them (topped up with the newest users), so the first
+// wave of traffic doesn't all miss and fall through to the database. The
+// records are cached in batches on the worker pool at low priority.
+type CacheWarmer struct {
+	users  *UserService
+	events *EventService
+	pool   TaskSubmitter
+	cfg    CacheWarmupConfig
+	logger *logrus.Logger
+}
+
+func NewCacheWarmer(users *UserService, events *EventService, pool TaskSubmitter, cfg CacheWarmupConfig, logger *logrus.Logger) *CacheWarmer {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	return &CacheWarmer{users: users, events: events, pool: pool, cfg: cfg, logger: logger}
+}
+
+// Run queues the warm-up batches and returns the number of events and users
+// queued. Failed batches are retried by the pool and otherwise only logged:
+// an incomplete warm-up just leaves more misses.
+func (w *CacheWarmer) Run(ctx context.Context) (events, users int, err error) {
+	authors, events, err := w.queueEvents(ctx)
+	if err != nil {
+		return events, 0, err
+	}
+	users, err = w.queueUsers(ctx, authors)
+	return events, users, err
+}
+
+// queueEvents caches the newest events page by page and returns the IDs of
+// their authors, most recent first
+func (w *CacheWarmer) queueEvents(ctx context.Context) ([]uuid.UUID, int, error) {
+	var (
+		authors []uuid.UUID
+		seen    = make(map[uuid.UUID]bool)
+		after   *pagination.Cursor
+		queued  int
+	)
+	for queued < w.cfg.Events {
+		page, err := w.events.events.List(ctx, repository.EventListQuery{After: after, Limit: min(w.cfg.BatchSize, w.cfg.Events-queued)})
+		if err != nil {
+			return authors, queued, fmt.Errorf("failed to list events: %w", err)
+		}
+		if len(page.Events) == 0 {
+			break
+		}
+
+		batch := page.Events
+		if err := w.submit(func(ctx context.Context) error { return w.events.cacheEvents(ctx, batch) }); err != nil {
+			return authors, queued, err
+		}
+		queued += len(batch)
+
+		for _, event := range batch {
+			if !seen[event.UserID] {
+				seen[event.UserID] = true
+				authors = append(authors, event.UserID)
+			}
+		}
+		if !page.More {
+			break
+		}
+		last := batch[len(batch)-1]
+		after = &pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+	return authors, queued, nil
+}
+
+// queueUsers caches the authors of the cached events and then the newest
+// users until Users are queued
+func (w *CacheWarmer) queueUsers(ctx context.Context, ids []uuid.UUID) (int, error) {
+	if len(ids) < w.cfg.Users {
+		page, err := w.users.users.List(ctx, repository.UserListQuery{Limit: w.cfg.Users})
+		if err != nil {
+			return 0, fmt.Errorf("failed to list users: %w", err)
+		}
+		seen := make(map[uuid.UUID]bool, len(ids))
+		for _, id := range ids {
+			seen[id] = true
+		}
+		for _, user := range page.Users {
+			if !seen[user.ID] {
+				ids = append(ids, user.ID)
+			}
+		}
+	}
+	ids = ids[:min(len(ids), w.cfg.Users)]
+
+	// Users are read through the cache rather than cached from the list, so
+	// one changed in the meantime is never overwritten by the listed copy
+	for start := 0; start < len(ids); start += w.cfg.BatchSize {
+		batch := ids[start:min(start+w.cfg.BatchSize, len(ids))]
+		if err := w.submit(func(ctx context.Context) error { return w.users.warmUsers(ctx, batch) }); err != nil {
+			return start, err
+		}
+	}
+	return len(ids), nil
+}
+
+func (w *CacheWarmer) submit(run func(ctx context.Context) error) error {
+	err := w.pool.Submit(worker.Task{
+		Type:       cacheWarmupTask,
+		Priority:   worker.PriorityLow,
+		MaxRetries: 1,
+		Run:        run,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to queue cache warm-up: %w", err)
+	}
+	return nil
+}
+
+// cacheEvents caches events that aren't cached yet, as GetEvent would;
+// payloads stay as stored, encrypted or not
+func (s *EventService) cacheEvents(ctx context.Context, events []models.Event) error {
+	for _, event := range events {
+		eventData, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal event: %w", err)
+		}
+		if _, err := s.loader.Load(ctx, fmt.Sprintf("event:%s", event.ID), eventCacheTTL, constant(string(eventData))); err != nil {
+			return fmt.Errorf("failed to cache event %s: %w", event.ID, err)
+		}
+	}
+	return nil
+}
+
+// warmUsers reads users through the cache; users that are missing or
+// inactive are remembered as not found, like any read of them
+func (s *UserService) warmUsers(ctx context.Context, ids []uuid.UUID) error {
+	for _, id := range ids {
+		if _, err := s.GetUser(ctx, id); err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func constant(value string) func(context.Context) (string, error) {
+	return func(context.Context) (string, error) { return value, nil }
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/cache"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/repository"
+	"highload-microservice/internal/worker"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// inlinePool runs submitted tasks right away
+type inlinePool struct{ tasks int }
+
+func (p *inlinePool) Submit(task worker.Task) error {
+	p.tasks++
+	return task.Run(context.Background())
+}
+
+// listedUsers is fakeUsers with the newest users listed in order
+type listedUsers struct {
+	*fakeUsers
+	newest []models.User
+}
+
+func (l *listedUsers) List(_ context.Context, q repository.UserListQuery) (*repository.UserPage, error) {
+	return &repository.UserPage{Users: l.newest[:min(q.Limit, len(l.newest))]}, nil
+}
+
+// listedEvents pages through events newest first
+type listedEvents struct {
+	repository.EventRepository
+	events []models.Event
+}
+
+func (l *listedEvents) List(_ context.Context, q repository.EventListQuery) (*repository.EventPage, error) {
+	start := 0
+	if q.After != nil {
+		for i, event := range l.events {
+			if event.ID == q.After.ID {
+				start = i + 1
+			}
+		}
+	}
+	end := min(start+q.Limit, len(l.events))
+	return &repository.EventPage{Events: l.events[start:end], More: end < len(l.events)}, nil
+}
+
+func TestCacheWarmer_Run(t *testing.T) {
+	author, other, newest := uuid.New(), uuid.New(), uuid.New()
+	users := &listedUsers{
+		fakeUsers: &fakeUsers{users: map[uuid.UUID]models.User{
+			author: {ID: author, IsActive: true},
+			other:  {ID: other, IsActive: true},
+			newest: {ID: newest, IsActive: true},
+		}},
+		newest: []models.User{{ID: newest}, {ID: author}},
+	}
+	now := time.Now()
+	events := &listedEvents{events: []models.Event{
+		{ID: uuid.New(), UserID: author, CreatedAt: now},
+		{ID: uuid.New(), UserID: other, CreatedAt: now.Add(-time.Second)},
+		{ID: uuid.New(), UserID: author, CreatedAt: now.Add(-2 * time.Second)},
+	}}
+
+	mc := cache.NewMemoryCache()
+	userService := NewUserService(users, mc, &stubProducer{}, logrus.New())
+	eventService := NewEventService(events, mc, &stubProducer{}, logrus.New())
+	pool := &inlinePool{}
+	warmer := NewCacheWarmer(userService, eventService, pool, CacheWarmupConfig{Events: 3, Users: 3, BatchSize: 2}, logrus.New())
+
+	queuedEvents, queuedUsers, err := warmer.Run(context.Background())
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if queuedEvents != 3 || queuedUsers != 3 {
+		t.Fatalf("expected 3 events and 3 users, got %d and %d", queuedEvents, queuedUsers)
+	}
+	// Events in batches of 2, then users in batches of 2
+	if pool.tasks != 4 {
+		t.Fatalf("expected 4 tasks, got %d", pool.tasks)
+	}
+
+	for _, event := range events.events {
+		if _, err := mc.Get(context.Background(), "event:"+event.ID.String()); err != nil {
+			t.Errorf("expected event %s to be cached: %v", event.ID, err)
+		}
+	}
+	for _, id := range []uuid.UUID{author, other, newest} {
+		if _, err := mc.Get(context.Background(), "user:"+id.String()); err != nil {
+			t.Errorf("expected user %s to be cached: %v", id, err)
+		}
+	}
+	if users.gets != 3 {
+		t.Fatalf("expected each user to be read once, got %d reads", users.gets)
+	}
+}
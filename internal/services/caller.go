@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type (
+	callerRoleKey   struct{}
+	callerIDKey     struct{}
+	callerClientKey struct{}
+	serviceKey      struct{}
+)
+
+// maxUserAgentLength bounds the user agent stored with a session
+const maxUserAgentLength = 512
+
+// ClientInfo describes the device a request came from
+type ClientInfo struct {
+	IPAddress string
+	UserAgent string
+}
+
+// WithCallerRole stores the authenticated caller's role in ctx. Services use it
+// to decide whether encrypted fields may be revealed.
+func WithCallerRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, callerRoleKey{}, role)
+}
+
+// CallerRole returns the role stored by WithCallerRole, or "" if none
+func CallerRole(ctx context.Context) string {
+	role, _ := ctx.Value(callerRoleKey{}).(string)
+	return role
+}
+
+// WithCallerID stores the authenticated caller's user ID in ctx, recorded as
+// the actor of audited changes
+func WithCallerID(ctx context.Context, id uuid.UUID) context.Context {
+	return context.WithValue(ctx, callerIDKey{}, id)
+}
+
+// CallerID returns the user ID stored by WithCallerID, or nil if none
+func CallerID(ctx context.Context) *uuid.UUID {
+	id, ok := ctx.Value(callerIDKey{}).(uuid.UUID)
+	if !ok || id == uuid.Nil {
+		return nil
+	}
+	return &id
+}
+
+// WithClientInfo stores the caller's device in ctx; logins record it with the
+// session they start
+func WithClientInfo(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, callerClientKey{}, info)
+}
+
+// ClientInfoFrom returns the device stored by WithClientInfo, or the zero
+// value if none
+func ClientInfoFrom(ctx context.Context) ClientInfo {
+	info, _ := ctx.Value(callerClientKey{}).(ClientInfo)
+	if len(info.UserAgent) > maxUserAgentLength {
+		info.UserAgent = info.UserAgent[:maxUserAgentLength]
+	}
+	return info
+}
+
+// WithServiceIdentity stores the subject of the client certificate a service
+// authenticated with in ctx
+func WithServiceIdentity(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, serviceKey{}, subject)
+}
+
+// ServiceIdentity returns the subject stored by WithServiceIdentity, or "" if
+// the caller is not a service
+func ServiceIdentity(ctx context.Context) string {
+	subject, _ := ctx.Value(serviceKey{}).(string)
+	return subject
+}
@@ -2,19 +2,105 @@ package services
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"highload-microservice/internal/models"
+	"highload-microservice/internal/worker"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
 )
 
-// RedisClient abstracts the subset of Redis methods used by services.
-type RedisClient interface {
+// Cache abstracts the subset of cache methods used by services.
+// Implementations live in internal/cache (Redis, Memcached, in-memory).
+type Cache interface {
 	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
 	Get(ctx context.Context, key string) (string, error)
 	Del(ctx context.Context, keys ...string) error
 }
 
+// Counter is a Cache that also supports atomic counters (login throttling).
+type Counter interface {
+	Cache
+	Incr(ctx context.Context, key string, expiration time.Duration) (int64, error)
+}
+
 // KafkaProducer abstracts sending events to Kafka.
 type KafkaProducer interface {
 	SendEvent(ctx context.Context, event models.KafkaEvent) error
 }
+
+// BulkEventStore stores batches of events in one transaction, running within
+// in it. Implemented by repository.PostgresEventRepository.
+type BulkEventStore interface {
+	CreateBatch(ctx context.Context, events []models.Event, within func(tx *sql.Tx) error) error
+}
+
+// TxProducer writes events in the caller's transaction. Implemented by
+// outbox.Producer.
+type TxProducer interface {
+	SendEventsTx(ctx context.Context, tx *sql.Tx, events []models.KafkaEvent) error
+}
+
+// SchemaValidator checks event payloads against the schema registered for
+// their type. Implemented by schema.Registry.
+type SchemaValidator interface {
+	Validate(eventType, data string) error
+}
+
+// TypeChecker refuses events of unknown or disabled types. Implemented by
+// eventtype.Registry.
+type TypeChecker interface {
+	Check(eventType string) error
+}
+
+// WebhookQueue queues events for delivery to webhook subscribers.
+// Implemented by webhook.Manager.
+type WebhookQueue interface {
+	Enqueue(ctx context.Context, event models.Event) error
+}
+
+// EventProcessor runs the handlers registered for consumed events.
+// Implemented by processor.Registry.
+type EventProcessor interface {
+	Dispatch(ctx context.Context, event models.KafkaEvent) error
+}
+
+// ProcessingRecorder records when consumed events were processed.
+// Implemented by analytics.Service.
+type ProcessingRecorder interface {
+	RecordProcessed(ctx context.Context, eventID uuid.UUID, createdAt, processedAt time.Time) error
+}
+
+// UserLookup reads users through the cache. Implemented by UserService.
+type UserLookup interface {
+	GetUser(ctx context.Context, id uuid.UUID) (*models.User, error)
+}
+
+// AvatarRemover deletes the avatar of a user. Implemented by avatar.Manager.
+type AvatarRemover interface {
+	Remove(ctx context.Context, userID uuid.UUID) error
+}
+
+// TaskSubmitter queues background work. Implemented by worker.Pool.
+type TaskSubmitter interface {
+	Submit(task worker.Task) error
+}
+
+// Invalidator tells other instances that cached keys changed, so that caches
+// private to them do not serve stale data. Implemented by cache.Invalidator.
+type Invalidator interface {
+	Invalidate(ctx context.Context, keys ...string) error
+}
+
+// invalidate publishes keys if inv is set. The change is already stored, so
+// failures are only logged; other instances catch up when their entries expire.
+func invalidate(ctx context.Context, inv Invalidator, logger *logrus.Logger, keys ...string) {
+	if inv == nil {
+		return
+	}
+	if err := inv.Invalidate(ctx, keys...); err != nil {
+		logger.Errorf("Failed to publish cache invalidation: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// BulkResult is the outcome of one event of CreateEvents: the stored event,
+// or why it was not stored
+type BulkResult struct {
+	Event *models.Event
+	Err   error
+}
+
+// SetBulkStore enables CreateEvents. With outbox set, events are written to
+// the outbox in the transaction that stores them and published by its relay;
+// otherwise they are sent to the producer once stored.
+func (s *EventService) SetBulkStore(store BulkEventStore, outbox TxProducer) {
+	s.bulk = store
+	s.bulkOutbox = outbox
+}
+
+// CreateEvents validates reqs and stores the valid events in one
+// transaction. When the database rejects the batch over a constraint (such
+// as an unknown user) each event is stored on its own, so that only the
+// offending ones fail. The error is set when the database failed otherwise;
+// events not stored because of it carry it as well.
+func (s *EventService) CreateEvents(ctx context.Context, reqs []models.CreateEventRequest) ([]BulkResult, error) {
+	if s.bulk == nil {
+		return nil, fmt.Errorf("bulk event ingestion is not enabled")
+	}
+
+	results := make([]BulkResult, len(reqs))
+	var (
+		batch  []int // indexes of the valid requests
+		stored = make([]*models.Event, len(reqs))
+	)
+	userIDs := make([]uuid.UUID, len(reqs))
+	for i, req := range reqs {
+		userIDs[i] = req.UserID
+	}
+	unknown := s.checkUsers(ctx, userIDs)
+	for i, req := range reqs {
+		if err := unknown[req.UserID]; err != nil {
+			results[i].Err = err
+			continue
+		}
+		event, sealed, err := s.newEvent(req)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		results[i].Event = event
+		stored[i] = sealed
+		batch = append(batch, i)
+	}
+
+	err := s.storeEvents(ctx, batch, stored)
+	if err == nil {
+		return results, nil
+	}
+	if len(batch) == 1 || !rejected(err) {
+		fail(results, batch, err)
+		if rejected(err) {
+			return results, nil
+		}
+		return results, err
+	}
+
+	for n, i := range batch {
+		if err := s.storeEvents(ctx, []int{i}, stored); err != nil {
+			if !rejected(err) {
+				fail(results, batch[n:], err)
+				return results, err
+			}
+			fail(results, []int{i}, err)
+		}
+	}
+	return results, nil
+}
+
+// storeEvents stores the events at indexes of stored in one transaction
+// and publishes them
+func (s *EventService) storeEvents(ctx context.Context, indexes []int, stored []*models.Event) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+	events := make([]models.Event, len(indexes))
+	messages := make([]models.KafkaEvent, len(indexes))
+	keys := make([]string, len(indexes))
+	for n, i := range indexes {
+		events[n] = *stored[i]
+		messages[n] = kafkaEvent(ctx, stored[i])
+		keys[n] = fmt.Sprintf("event:%s", stored[i].ID.String())
+	}
+
+	var within func(tx *sql.Tx) error
+	if s.bulkOutbox != nil {
+		within = func(tx *sql.Tx) error { return s.bulkOutbox.SendEventsTx(ctx, tx, messages) }
+	}
+	if err := s.bulk.CreateBatch(ctx, events, within); err != nil {
+		return apperrors.FromDB(err, "failed to create events")
+	}
+	// Other instances may have cached the ids as not found
+	invalidate(ctx, s.invalidator, s.logger, keys...)
+
+	if s.bulkOutbox == nil {
+		for _, message := range messages {
+			if err := s.kafkaProducer.SendEvent(ctx, message); err != nil {
+				s.logger.Errorf("Failed to send event to Kafka: %v", err)
+			}
+		}
+	}
+	s.logger.Infof("Events created: %d", len(events))
+	return nil
+}
+
+// rejected reports whether the database refused the events themselves
+// rather than failed
+func rejected(err error) bool {
+	return errors.Is(err, apperrors.ErrValidation) || errors.Is(err, apperrors.ErrConflict) || errors.Is(err, apperrors.ErrUnprocessable)
+}
+
+// fail marks the results at indexes as not stored
+func fail(results []BulkResult, indexes []int, err error) {
+	for _, i := range indexes {
+		results[i] = BulkResult{Err: err}
+	}
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/cache"
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeBulkStore stores batches unless one of their users is unknown, which
+// fails the whole batch like a foreign key violation
+type fakeBulkStore struct {
+	unknown map[uuid.UUID]bool
+	err     error
+	batches [][]models.Event
+}
+
+func (f *fakeBulkStore) CreateBatch(ctx context.Context, events []models.Event, within func(tx *sql.Tx) error) error {
+	if f.err != nil {
+		return f.err
+	}
+	for _, event := range events {
+		if f.unknown[event.UserID] {
+			return &pq.Error{Code: "23503"}
+		}
+	}
+	if within != nil {
+		if err := within(nil); err != nil {
+			return err
+		}
+	}
+	f.batches = append(f.batches, events)
+	return nil
+}
+
+type recordingTxProducer struct{ events []models.KafkaEvent }
+
+func (r *recordingTxProducer) SendEventsTx(ctx context.Context, tx *sql.Tx, events []models.KafkaEvent) error {
+	r.events = append(r.events, events...)
+	return nil
+}
+
+func newBulkService(store BulkEventStore, outbox TxProducer) (*EventService, *recordingKafka) {
+	kafka := &recordingKafka{}
+	svc := NewEventService(nil, cache.NewMemoryCache(), kafka, logrus.New())
+	svc.SetBulkStore(store, outbox)
+	return svc, kafka
+}
+
+func TestEventService_CreateEvents_RetriesRejectedBatchOneByOne(t *testing.T) {
+	unknown := uuid.New()
+	store := &fakeBulkStore{unknown: map[uuid.UUID]bool{unknown: true}}
+	svc, kafka := newBulkService(store, nil)
+
+	reqs := []models.CreateEventRequest{
+		{UserID: uuid.New(), Type: "login", Data: "{}"},
+		{UserID: unknown, Type: "login", Data: "{}"},
+		{UserID: uuid.New(), Type: "logout", Data: "{}"},
+	}
+	results, err := svc.CreateEvents(context.Background(), reqs)
+	if err != nil {
+		t.Fatalf("create events: %v", err)
+	}
+	if results[0].Err != nil || results[2].Err != nil {
+		t.Fatalf("expected events 0 and 2 stored, got %+v", results)
+	}
+	if !errors.Is(results[1].Err, apperrors.ErrUnprocessable) || results[1].Event != nil {
+		t.Fatalf("expected event 1 rejected, got %+v", results[1])
+	}
+	if len(store.batches) != 2 {
+		t.Fatalf("expected 2 single-event batches after the rejected one, got %d", len(store.batches))
+	}
+	if len(kafka.events) != 2 || kafka.events[0].ID != results[0].Event.ID {
+		t.Fatalf("expected the stored events published, got %+v", kafka.events)
+	}
+}
+
+func TestEventService_CreateEvents_WritesOutboxInTransaction(t *testing.T) {
+	store := &fakeBulkStore{}
+	outbox := &recordingTxProducer{}
+	svc, kafka := newBulkService(store, outbox)
+
+	reqs := []models.CreateEventRequest{
+		{UserID: uuid.New(), Type: "login", Data: "{}"},
+		{UserID: uuid.New(), Type: "login", Data: "{}"},
+	}
+	if _, err := svc.CreateEvents(context.Background(), reqs); err != nil {
+		t.Fatalf("create events: %v", err)
+	}
+	if len(store.batches) != 1 || len(store.batches[0]) != 2 {
+		t.Fatalf("expected one batch of 2, got %+v", store.batches)
+	}
+	if len(outbox.events) != 2 || len(kafka.events) != 0 {
+		t.Fatalf("expected events written to the outbox only, got outbox %d, producer %d", len(outbox.events), len(kafka.events))
+	}
+}
+
+func TestEventService_CreateEvents_DatabaseDown(t *testing.T) {
+	store := &fakeBulkStore{err: errors.New("connection refused")}
+	svc, _ := newBulkService(store, nil)
+
+	results, err := svc.CreateEvents(context.Background(), []models.CreateEventRequest{
+		{UserID: uuid.New(), Type: "login", Data: "{}"},
+		{UserID: uuid.New(), Type: "login", Data: "{}"},
+	})
+	if err == nil {
+		t.Fatal("expected the database error")
+	}
+	for i, result := range results {
+		if result.Err == nil {
+			t.Fatalf("expected event %d not stored", i)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+
+	"highload-microservice/internal/fieldcrypt"
+	"highload-microservice/internal/models"
+)
+
+// PayloadEncryption encrypts Event.Data at rest for the configured event types.
+// Only callers whose role is in ReaderRoles get the decrypted payload back.
+type PayloadEncryption struct {
+	Encryptor   *fieldcrypt.Encryptor
+	EventTypes  []string
+	ReaderRoles []string
+}
+
+// SetPayloadEncryption enables encryption of event payloads at rest
+func (s *EventService) SetPayloadEncryption(cfg PayloadEncryption) {
+	s.encryptor = cfg.Encryptor
+	s.encryptedTypes = make(map[string]bool, len(cfg.EventTypes))
+	for _, t := range cfg.EventTypes {
+		s.encryptedTypes[t] = true
+	}
+	s.readerRoles = make(map[string]bool, len(cfg.ReaderRoles))
+	for _, r := range cfg.ReaderRoles {
+		s.readerRoles[r] = true
+	}
+}
+
+// sealData returns the at-rest form of an event payload
+func (s *EventService) sealData(event *models.Event) (string, error) {
+	if s.encryptor == nil || !s.encryptedTypes[event.Type] {
+		return event.Data, nil
+	}
+	return s.encryptor.Encrypt(event.Data, event.ID[:])
+}
+
+// revealEvent decrypts the payload of a stored event for authorized callers.
+// Other callers get the event with an empty payload and Encrypted set.
+func (s *EventService) revealEvent(ctx context.Context, event *models.Event) {
+	if !fieldcrypt.IsEncrypted(event.Data) {
+		return
+	}
+
+	if s.encryptor == nil || !s.readerRoles[CallerRole(ctx)] {
+		event.Data = ""
+		event.Encrypted = true
+		return
+	}
+
+	plaintext, err := s.encryptor.Decrypt(event.Data, event.ID[:])
+	if err != nil {
+		s.logger.Errorf("Failed to decrypt event %s: %v", event.ID, err)
+		event.Data = ""
+		event.Encrypted = true
+		return
+	}
+	event.Data = plaintext
+}
+
+// openKafkaEvent decrypts a consumed event payload in place
+func (s *EventService) openKafkaEvent(event *models.KafkaEvent) error {
+	if !fieldcrypt.IsEncrypted(event.Data) || s.encryptor == nil {
+		return nil
+	}
+	plaintext, err := s.encryptor.Decrypt(event.Data, event.ID[:])
+	if err != nil {
+		return err
+	}
+	event.Data = plaintext
+	return nil
+}
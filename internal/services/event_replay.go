@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/events"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/pagination"
+	"highload-microservice/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// replayJobTTL is how long replay progress can be looked up
+	replayJobTTL = 7 * 24 * time.Hour
+	// maxReplayTypes bounds the event types of one replay
+	maxReplayTypes = 50
+)
+
+// TopicProducer publishes events to a given topic. Implemented by the Kafka
+// producer.
+type TopicProducer interface {
+	SendEventTo(ctx context.Context, topic string, event models.KafkaEvent) error
+}
+
+// ReplayConfig enables replays of stored events
+type ReplayConfig struct {
+	Producer  KafkaProducer // the broker, not the outbox
+	BatchSize int           // events read and published per step
+	MaxEvents int           // replays matching more events are refused; 0 means no limit
+}
+
+// replays tracks the running replays of this instance
+type replays struct {
+	cfg    ReplayConfig
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// SetReplay enables StartReplay
+func (s *EventService) SetReplay(cfg ReplayConfig) {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.replay = &replays{cfg: cfg, ctx: ctx, cancel: cancel}
+}
+
+// StopReplays cancels the running replays and waits for them to record
+// their progress
+func (s *EventService) StopReplays() {
+	if s.replay == nil {
+		return
+	}
+	s.replay.cancel()
+	s.replay.wg.Wait()
+}
+
+func replayJobKey(id uuid.UUID) string {
+	return "event_replay:" + id.String()
+}
+
+// StartReplay publishes the stored events selected by req again, oldest
+// first, in the background. Progress is kept in the cache, so any instance
+// sharing it can report it through ReplayJob.
+func (s *EventService) StartReplay(ctx context.Context, req models.EventReplayRequest) (*models.EventReplayJob, error) {
+	if s.replay == nil {
+		return nil, apperrors.New(apperrors.ErrUnavailable, "event replay is not enabled")
+	}
+	query, err := s.replayQuery(req)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := s.events.CountRange(ctx, query)
+	if err != nil {
+		return nil, apperrors.FromDB(err, "failed to count events")
+	}
+	if max := s.replay.cfg.MaxEvents; max > 0 && total > max {
+		return nil, apperrors.Validation(fmt.Sprintf("%d events match, more than the limit of %d; narrow the range", total, max))
+	}
+
+	now := time.Now()
+	job := &models.EventReplayJob{
+		ID:        uuid.New(),
+		Status:    models.ReplayRunning,
+		Request:   req,
+		Total:     total,
+		StartedBy: CallerID(ctx),
+		StartedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.saveReplayJob(ctx, job); err != nil {
+		return nil, apperrors.Wrap(apperrors.ErrUnavailable, "failed to store replay job", err)
+	}
+
+	s.logger.Infof("Replaying %d events (job %s)", total, job.ID)
+	progress := *job
+	s.replay.wg.Add(1)
+	go func() {
+		defer s.replay.wg.Done()
+		s.runReplay(&progress, query)
+	}()
+	return job, nil
+}
+
+// replayQuery validates req; replays without a range or types must be
+// confirmed with AllEvents
+func (s *EventService) replayQuery(req models.EventReplayRequest) (repository.EventRangeQuery, error) {
+	query := repository.EventRangeQuery{From: req.From, To: req.To}
+	for _, t := range req.Types {
+		if t = strings.TrimSpace(t); t != "" {
+			query.Types = append(query.Types, t)
+		}
+	}
+	switch {
+	case len(query.Types) > maxReplayTypes:
+		return query, apperrors.Validation(fmt.Sprintf("at most %d event types can be replayed at once", maxReplayTypes))
+	case req.From != nil && req.To != nil && !req.From.Before(*req.To):
+		return query, apperrors.Validation("from must be before to")
+	case req.From == nil && req.To == nil && len(query.Types) == 0 && !req.AllEvents:
+		return query, apperrors.Validation("set from, to or types, or all_events to replay every event")
+	}
+	if req.Topic != "" {
+		if _, ok := s.replay.cfg.Producer.(TopicProducer); !ok {
+			return query, apperrors.Validation("replaying to a topic requires the Kafka messaging backend")
+		}
+	}
+	return query, nil
+}
+
+// runReplay publishes batches until the range is exhausted, the broker
+// fails or the service stops
+func (s *EventService) runReplay(job *models.EventReplayJob, query repository.EventRangeQuery) {
+	ctx := s.replay.ctx
+	var after *pagination.Cursor
+	var err error
+	for {
+		var batch []models.Event
+		batch, err = s.events.ListRange(ctx, query, after, s.replay.cfg.BatchSize)
+		if err != nil || len(batch) == 0 {
+			break
+		}
+		for _, event := range batch {
+			if err = s.publishReplayed(ctx, job.Request.Topic, event); err != nil {
+				break
+			}
+			job.Published++
+		}
+		if err != nil {
+			break
+		}
+		last := batch[len(batch)-1]
+		after = &pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+
+		job.UpdatedAt = time.Now()
+		if err := s.saveReplayJob(ctx, job); err != nil {
+			s.logger.Warnf("Failed to record progress of replay %s: %v", job.ID, err)
+		}
+	}
+
+	now := time.Now()
+	job.UpdatedAt, job.FinishedAt = now, &now
+	switch {
+	case err == nil:
+		job.Status = models.ReplayCompleted
+		s.logger.Infof("Replay %s completed: %d events published", job.ID, job.Published)
+	case errors.Is(err, context.Canceled):
+		job.Status = models.ReplayCanceled
+		s.logger.Warnf("Replay %s canceled after %d of %d events", job.ID, job.Published, job.Total)
+	default:
+		job.Status, job.Error = models.ReplayFailed, err.Error()
+		s.logger.Errorf("Replay %s failed after %d of %d events: %v", job.ID, job.Published, job.Total, err)
+	}
+
+	// The replay context may be canceled already
+	saveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.saveReplayJob(saveCtx, job); err != nil {
+		s.logger.Errorf("Failed to record result of replay %s: %v", job.ID, err)
+	}
+}
+
+// publishReplayed publishes a stored event as it was published on creation;
+// encrypted payloads stay encrypted
+func (s *EventService) publishReplayed(ctx context.Context, topic string, event models.Event) error {
+	kafkaEvent := models.KafkaEvent{
+		ID:        event.ID,
+		UserID:    event.UserID,
+		Type:      event.Type,
+		Version:   events.CurrentVersion(event.Type),
+		Data:      event.Data,
+		Timestamp: event.CreatedAt,
+		Replay:    true,
+	}
+	if topic != "" {
+		return s.replay.cfg.Producer.(TopicProducer).SendEventTo(ctx, topic, kafkaEvent)
+	}
+	return s.replay.cfg.Producer.SendEvent(ctx, kafkaEvent)
+}
+
+func (s *EventService) saveReplayJob(ctx context.Context, job *models.EventReplayJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return s.cache.Set(ctx, replayJobKey(job.ID), string(data), replayJobTTL)
+}
+
+// ReplayJob returns the progress of a replay
+func (s *EventService) ReplayJob(ctx context.Context, id uuid.UUID) (*models.EventReplayJob, error) {
+	data, err := s.cache.Get(ctx, replayJobKey(id))
+	if err != nil {
+		return nil, apperrors.NotFound("replay job not found")
+	}
+	var job models.EventReplayJob
+	if err := json.Unmarshal([]byte(data), &job); err != nil {
+		return nil, fmt.Errorf("failed to decode replay job: %w", err)
+	}
+	return &job, nil
+}
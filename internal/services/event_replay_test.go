@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/cache"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/repository"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// topicKafka records events per topic
+type topicKafka struct {
+	recordingKafka
+	topics []string
+}
+
+func (k *topicKafka) SendEventTo(ctx context.Context, topic string, event models.KafkaEvent) error {
+	k.topics = append(k.topics, topic)
+	return k.SendEvent(ctx, event)
+}
+
+// waitForReplay polls a replay job until it stops running
+func waitForReplay(t *testing.T, svc *EventService, id uuid.UUID) *models.EventReplayJob {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := svc.ReplayJob(context.Background(), id)
+		if err != nil {
+			t.Fatalf("replay job: %v", err)
+		}
+		if job.Status != models.ReplayRunning {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("replay did not finish")
+	return nil
+}
+
+func TestEventService_Replay(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	producer := &topicKafka{}
+	svc := NewEventService(repository.NewPostgresEventRepository(db), cache.NewMemoryCache(), &stubKafka{}, logrus.New())
+	svc.SetReplay(ReplayConfig{Producer: producer, BatchSize: 2})
+
+	from := time.Now().Add(-time.Hour)
+	columns := []string{"id", "user_id", "type", "data", "created_at"}
+	first, second, third := uuid.New(), uuid.New(), uuid.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM events WHERE created_at >= $1 AND type IN ($2)")).
+		WithArgs(from, "order_paid").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM events WHERE created_at >= $1 AND type IN ($2)\n\t\tORDER BY created_at, id")).
+		WithArgs(from, "order_paid", 2).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(first, uuid.New(), "order_paid", "{}", from.Add(time.Minute)).
+			AddRow(second, uuid.New(), "order_paid", "{}", from.Add(2*time.Minute)))
+	// The next batch continues after the last event of the previous one
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE created_at >= $1 AND type IN ($2) AND (created_at > $3 OR (created_at = $4 AND id > $5))")).
+		WithArgs(from, "order_paid", from.Add(2*time.Minute), from.Add(2*time.Minute), second, 2).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(third, uuid.New(), "order_paid", "{}", from.Add(3*time.Minute)))
+	mock.ExpectQuery(regexp.QuoteMeta("AND id > $5))")).
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	admin := uuid.New()
+	job, err := svc.StartReplay(WithCallerID(context.Background(), admin),
+		models.EventReplayRequest{From: &from, Types: []string{"order_paid"}, Topic: "orders.replay"})
+	if err != nil {
+		t.Fatalf("start replay: %v", err)
+	}
+	if job.Total != 3 || job.StartedBy == nil || *job.StartedBy != admin {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+
+	done := waitForReplay(t, svc, job.ID)
+	if done.Status != models.ReplayCompleted || done.Published != 3 || done.FinishedAt == nil {
+		t.Fatalf("unexpected result: %+v", done)
+	}
+	if len(producer.events) != 3 || producer.events[2].ID != third || producer.topics[0] != "orders.replay" {
+		t.Fatalf("unexpected published events: %+v to %v", producer.events, producer.topics)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestEventService_ReplayGuards(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	svc := NewEventService(repository.NewPostgresEventRepository(db), cache.NewMemoryCache(), &stubKafka{}, logrus.New())
+	if _, err := svc.StartReplay(context.Background(), models.EventReplayRequest{AllEvents: true}); !errors.Is(err, apperrors.ErrUnavailable) {
+		t.Fatalf("want unavailable without SetReplay, got %v", err)
+	}
+	svc.SetReplay(ReplayConfig{Producer: &recordingKafka{}, MaxEvents: 10})
+
+	now := time.Now()
+	for name, req := range map[string]models.EventReplayRequest{
+		"whole table unconfirmed": {},
+		"empty range":             {From: &now, To: &now},
+		"topic without kafka":     {Types: []string{"order_paid"}, Topic: "elsewhere"},
+	} {
+		if _, err := svc.StartReplay(context.Background(), req); !errors.Is(err, apperrors.ErrValidation) {
+			t.Errorf("%s: want validation error, got %v", name, err)
+		}
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM events WHERE 1 = 1")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(11))
+	if _, err := svc.StartReplay(context.Background(), models.EventReplayRequest{AllEvents: true}); !errors.Is(err, apperrors.ErrValidation) {
+		t.Fatalf("want validation error above MaxEvents, got %v", err)
+	}
+
+	if _, err := svc.ReplayJob(context.Background(), uuid.New()); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Fatalf("want not found for an unknown job, got %v", err)
+	}
+}
@@ -2,68 +2,117 @@ package services
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/cache"
+	"highload-microservice/internal/events"
+	"highload-microservice/internal/fieldcrypt"
+	"highload-microservice/internal/messaging"
 	"highload-microservice/internal/models"
+	"highload-microservice/internal/pagination"
+	"highload-microservice/internal/repository"
+	"highload-microservice/internal/requestid"
+	"highload-microservice/internal/stream"
 
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
+// eventCacheTTL is how long an event stays cached
+const eventCacheTTL = 30 * time.Minute
+
 type EventService struct {
-	db            *sql.DB
-	redisClient   RedisClient
+	events        repository.EventRepository
+	cache         Cache
+	loader        *cache.Loader
+	listCache     bool
+	invalidator   Invalidator
 	kafkaProducer KafkaProducer
+	upcasters     *events.Registry
 	logger        *logrus.Logger
-}
 
-// RedisClient abstracts the subset of Redis methods used by the service
-// RedisClient interface defined in deps.go
+	// Payload encryption at rest, see SetPayloadEncryption
+	encryptor      *fieldcrypt.Encryptor
+	encryptedTypes map[string]bool
+	readerRoles    map[string]bool
+
+	// Live subscribers of consumed events, see SetStreamHub
+	hub *stream.Hub
+
+	// Webhook subscribers of consumed events, see SetWebhooks
+	webhooks WebhookQueue
+
+	// Processing latency for event stats, see SetProcessingRecorder
+	processing ProcessingRecorder
+
+	// Handlers of consumed events by type, see SetProcessor
+	processor EventProcessor
+
+	// Replays of stored events, see SetReplay
+	replay *replays
+
+	// Bulk ingestion, see SetBulkStore
+	bulk       BulkEventStore
+	bulkOutbox TxProducer
+
+	// Payload schemas, see SetSchemaValidation
+	schemas     SchemaValidator
+	invalidSink KafkaProducer
+
+	// Daily event counters and quota, see SetUsage
+	usage       Counter
+	usageConfig EventUsageConfig
+
+	// Existence checks of event users, see SetUserLookup
+	users UserLookup
+	// Registered event types, see SetTypeRegistry
+	types TypeChecker
+}
 
 // KafkaProducer abstracts the subset of Kafka producer methods used by the service
 // KafkaProducer interface defined in deps.go
 
-func NewEventService(db *sql.DB, redisClient RedisClient, kafkaProducer KafkaProducer, logger *logrus.Logger) *EventService {
+func NewEventService(repo repository.EventRepository, cacheClient Cache, kafkaProducer KafkaProducer, logger *logrus.Logger) *EventService {
 	return &EventService{
-		db:            db,
-		redisClient:   redisClient,
+		events:        repo,
+		cache:         cacheClient,
+		loader:        cache.NewLoader(cacheClient, cache.LoaderConfig{}),
 		kafkaProducer: kafkaProducer,
+		upcasters:     events.Default,
 		logger:        logger,
 	}
 }
 
 func (s *EventService) CreateEvent(ctx context.Context, req models.CreateEventRequest) (*models.Event, error) {
-	event := &models.Event{
-		ID:        uuid.New(),
-		UserID:    req.UserID,
-		Type:      req.Type,
-		Data:      req.Data,
-		CreatedAt: time.Now(),
+	if err := s.checkUser(ctx, req.UserID); err != nil {
+		return nil, err
 	}
-
-	query := `
-		INSERT INTO events (id, user_id, type, data, created_at)
-		VALUES ($1, $2, $3, $4, $5)
-	`
-
-	_, err := s.db.ExecContext(ctx, query, event.ID, event.UserID, event.Type, event.Data, event.CreatedAt)
+	if err := s.checkQuota(ctx, req.UserID); err != nil {
+		return nil, err
+	}
+	event, stored, err := s.newEvent(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create event: %w", err)
+		return nil, err
 	}
 
-	// Send event to Kafka
-	kafkaEvent := models.KafkaEvent{
-		ID:        event.ID,
-		UserID:    event.UserID,
-		Type:      event.Type,
-		Data:      event.Data,
-		Timestamp: event.CreatedAt,
+	if err := s.events.Create(ctx, stored); err != nil {
+		err = apperrors.FromDB(err, "failed to create event")
+		// The foreign key refused the user: lookups are off or missed it
+		if errors.Is(err, apperrors.ErrUnprocessable) {
+			return nil, apperrors.Wrap(apperrors.ErrUnprocessable, fmt.Sprintf("user %s does not exist", req.UserID), err)
+		}
+		return nil, err
 	}
+	s.countEvent(ctx, event.UserID)
+	// Other instances may have cached the id as not found
+	invalidate(ctx, s.invalidator, s.logger, fmt.Sprintf("event:%s", event.ID.String()))
 
-	if err := s.kafkaProducer.SendEvent(ctx, kafkaEvent); err != nil {
+	// Send event to Kafka
+	if err := s.kafkaProducer.SendEvent(ctx, kafkaEvent(ctx, stored)); err != nil {
 		s.logger.Errorf("Failed to send event to Kafka: %v", err)
 	}
 
@@ -71,125 +120,267 @@ func (s *EventService) CreateEvent(ctx context.Context, req models.CreateEventRe
 	return event, nil
 }
 
-func (s *EventService) GetEvent(ctx context.Context, id uuid.UUID) (*models.Event, error) {
-	// Try to get from cache first
-	cacheKey := fmt.Sprintf("event:%s", id.String())
-	if cached, err := s.redisClient.Get(ctx, cacheKey); err == nil {
-		var event models.Event
-		if err := json.Unmarshal([]byte(cached), &event); err == nil {
-			s.logger.Debugf("Event %s retrieved from cache", id)
-			return &event, nil
+// newEvent validates req and returns the event to respond with and the copy
+// to store and publish, whose payload is encrypted if its type is sensitive
+func (s *EventService) newEvent(req models.CreateEventRequest) (event, stored *models.Event, err error) {
+	if s.types != nil {
+		if err := s.types.Check(req.Type); err != nil {
+			return nil, nil, err
+		}
+	}
+	if s.schemas != nil {
+		if err := s.schemas.Validate(req.Type, req.Data); err != nil {
+			return nil, nil, apperrors.Wrap(apperrors.ErrValidation, "invalid event data: "+err.Error(), err)
 		}
 	}
 
-	// Get from database
-	event := &models.Event{}
-	query := `SELECT id, user_id, type, data, created_at FROM events WHERE id = $1`
+	event = &models.Event{
+		ID:        uuid.New(),
+		UserID:    req.UserID,
+		Type:      req.Type,
+		Data:      req.Data,
+		CreatedAt: time.Now(),
+	}
 
-	err := s.db.QueryRowContext(ctx, query, id).Scan(
-		&event.ID, &event.UserID, &event.Type, &event.Data, &event.CreatedAt,
-	)
+	// Sensitive payloads are stored and published encrypted
+	data, err := s.sealData(event)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("event not found")
-		}
-		return nil, fmt.Errorf("failed to get event: %w", err)
+		return nil, nil, fmt.Errorf("failed to encrypt event data: %w", err)
 	}
 
-	// Cache the result
-	s.cacheEvent(ctx, event)
+	sealed := *event
+	sealed.Data = data
+	return event, &sealed, nil
+}
 
-	s.logger.Debugf("Event %s retrieved from database", id)
-	return event, nil
+// kafkaEvent is the broker message announcing a stored event
+func kafkaEvent(ctx context.Context, stored *models.Event) models.KafkaEvent {
+	return models.KafkaEvent{
+		ID:        stored.ID,
+		UserID:    stored.UserID,
+		Type:      stored.Type,
+		Version:   events.CurrentVersion(stored.Type),
+		Data:      stored.Data,
+		Timestamp: stored.CreatedAt,
+		RequestID: requestid.FromContext(ctx),
+	}
 }
 
-func (s *EventService) ListEvents(ctx context.Context, page, limit int) (*models.EventListResponse, error) {
-	offset := (page - 1) * limit
+// SetCacheLoader replaces the loader GetEvent reads through, which by default
+// only coalesces concurrent misses. The loader must wrap the service's cache.
+func (s *EventService) SetCacheLoader(loader *cache.Loader) {
+	s.loader = loader
+}
 
-	// Get total count
-	var total int
-	countQuery := `SELECT COUNT(*) FROM events`
-	err := s.db.QueryRowContext(ctx, countQuery).Scan(&total)
-	if err != nil {
-		return nil, fmt.Errorf("failed to count events: %w", err)
-	}
+// SetSchemaValidation validates payloads of created and consumed events
+// against the schema of their type. Consumed events that fail are published
+// to invalidSink if set, otherwise logged and skipped.
+func (s *EventService) SetSchemaValidation(schemas SchemaValidator, invalidSink KafkaProducer) {
+	s.schemas = schemas
+	s.invalidSink = invalidSink
+}
 
-	// Get events
-	query := `
-		SELECT id, user_id, type, data, created_at 
-		FROM events 
-		ORDER BY created_at DESC 
-		LIMIT $1 OFFSET $2
-	`
+// SetTypeRegistry makes CreateEvent and CreateEvents refuse events whose
+// type the registry does not accept
+func (s *EventService) SetTypeRegistry(types TypeChecker) {
+	s.types = types
+}
 
-	rows, err := s.db.QueryContext(ctx, query, limit, offset)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list events: %w", err)
-	}
-	defer func() { _ = rows.Close() }()
+// SetInvalidator publishes the event keys changed on this instance to the
+// other instances
+func (s *EventService) SetInvalidator(inv Invalidator) {
+	s.invalidator = inv
+}
 
-	var events []models.Event
-	for rows.Next() {
-		var event models.Event
-		err := rows.Scan(&event.ID, &event.UserID, &event.Type, &event.Data, &event.CreatedAt)
+func (s *EventService) GetEvent(ctx context.Context, id uuid.UUID) (*models.Event, error) {
+	cacheKey := fmt.Sprintf("event:%s", id.String())
+	load := func(ctx context.Context) (string, error) {
+		event, err := s.events.Get(ctx, id)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan event: %v", err)
+			if errors.Is(err, repository.ErrNotFound) {
+				return "", cache.ErrNotFound
+			}
+			return "", err
 		}
-		events = append(events, event)
+		// Cached still encrypted, if it was stored that way
+		eventData, err := json.Marshal(event)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal event: %w", err)
+		}
+		return string(eventData), nil
+	}
+
+	var event models.Event
+	cached, err := s.loader.Load(ctx, cacheKey, eventCacheTTL, load)
+	if err == nil && json.Unmarshal([]byte(cached), &event) != nil {
+		// Corrupt entry; replace it from the database
+		cached, err = s.loader.Fill(ctx, cacheKey, eventCacheTTL, load)
+		if err == nil {
+			err = json.Unmarshal([]byte(cached), &event)
+		}
+	}
+	if err != nil {
+		if errors.Is(err, cache.ErrNotFound) {
+			return nil, apperrors.NotFound("event not found")
+		}
+		return nil, apperrors.FromDB(err, "failed to get event")
+	}
+
+	s.revealEvent(ctx, &event)
+	return &event, nil
+}
+
+// ListEvents returns a page of events, newest first. With after set the page
+// starts after that cursor instead of at page's offset; NextCursor is returned
+// when more events follow.
+func (s *EventService) ListEvents(ctx context.Context, page, limit int, after *pagination.Cursor) (*models.EventListResponse, error) {
+	query := repository.EventListQuery{After: after, Offset: (page - 1) * limit, Limit: limit}
+	if after != nil {
+		page = 0
+	}
+	list := s.events.List
+	if s.listCache {
+		list = s.listEventsCached
+	}
+	result, err := list(ctx, query)
+	if err != nil {
+		return nil, err
 	}
 
-	return &models.EventListResponse{
-		Events: events,
-		Total:  total,
+	response := &models.EventListResponse{
+		Events: result.Events,
+		Total:  result.Total,
 		Page:   page,
 		Limit:  limit,
-	}, nil
+	}
+	if result.More {
+		last := response.Events[len(response.Events)-1]
+		response.NextCursor = pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	for i := range response.Events {
+		s.revealEvent(ctx, &response.Events[i])
+	}
+	return response, nil
 }
 
-func (s *EventService) ProcessEvents(consumer interface {
-	ReadMessage(ctx context.Context) (models.KafkaEvent, error)
-}) {
-	s.logger.Info("Starting event processing...")
+// HandleEvent processes one consumed event. It is the messaging.Handler for
+// the consumer runner: decode and schema failures are permanent, processing
+// failures are retried.
+func (s *EventService) HandleEvent(ctx context.Context, event models.KafkaEvent) error {
+	received := event
+	if err := s.openKafkaEvent(&event); err != nil {
+		return messaging.Permanent(fmt.Errorf("failed to decrypt event: %w", err))
+	}
 
-	for {
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// Migrate older payload versions to the current schema
+	if err := s.upcasters.Upcast(&event); err != nil {
+		return messaging.Permanent(fmt.Errorf("failed to upcast event: %w", err))
+	}
 
-		event, err := consumer.ReadMessage(ctx)
-		if err != nil {
-			s.logger.Errorf("Failed to read message from Kafka: %v", err)
-			cancel()
-			time.Sleep(5 * time.Second)
-			continue
+	if s.schemas != nil {
+		if err := s.schemas.Validate(event.Type, event.Data); err != nil {
+			return s.rejectInvalid(ctx, received, err)
 		}
+	}
 
-		// Process event in a goroutine for parallel processing
-		go s.processEvent(event)
+	if err := s.processEvent(ctx, event); err != nil {
+		return err
+	}
 
-		cancel()
+	if s.processing != nil {
+		// Stats are best effort; the event was processed either way
+		if err := s.processing.RecordProcessed(ctx, event.ID, event.Timestamp, time.Now()); err != nil {
+			s.logger.Warnf("Failed to record processing time of event %s: %v", event.ID, err)
+		}
 	}
+
+	if s.webhooks != nil {
+		// Consumed events carry no caller role, so encrypted payloads are
+		// withheld from subscribers
+		if err := s.webhooks.Enqueue(ctx, s.StreamView(ctx, event)); err != nil {
+			return fmt.Errorf("failed to queue webhooks: %w", err)
+		}
+	}
+
+	if s.hub != nil {
+		s.hub.Publish(event)
+	}
+	return nil
 }
 
-func (s *EventService) processEvent(event models.KafkaEvent) {
-	s.logger.Infof("Processing event: %s (type: %s)", event.ID, event.Type)
+// rejectInvalid handles a consumed event whose payload fails validation. The
+// event is forwarded as received, so encrypted payloads stay encrypted.
+func (s *EventService) rejectInvalid(ctx context.Context, event models.KafkaEvent, cause error) error {
+	if s.invalidSink == nil {
+		return messaging.Permanent(fmt.Errorf("invalid event payload: %w", cause))
+	}
+	if err := s.invalidSink.SendEvent(ctx, event); err != nil {
+		return fmt.Errorf("failed to publish invalid event: %w", err)
+	}
+	s.logger.WithField("request_id", event.RequestID).
+		Warnf("Invalid event %s (type: %s) moved to dead letter topic: %v", event.ID, event.Type, cause)
+	return nil
+}
 
-	// Simulate some processing time
-	time.Sleep(100 * time.Millisecond)
+// SetStreamHub publishes every consumed event to hub for live streaming
+func (s *EventService) SetStreamHub(hub *stream.Hub) {
+	s.hub = hub
+}
 
-	// Here you would implement your business logic for processing events
-	// For example: sending notifications, updating analytics, etc.
+// SetWebhooks queues every consumed event for the webhooks subscribed to it
+func (s *EventService) SetWebhooks(queue WebhookQueue) {
+	s.webhooks = queue
+}
 
-	s.logger.Infof("Event processed successfully: %s", event.ID)
+// SetProcessor runs the handlers registered for the type of every consumed
+// event
+func (s *EventService) SetProcessor(processor EventProcessor) {
+	s.processor = processor
 }
 
-func (s *EventService) cacheEvent(ctx context.Context, event *models.Event) {
-	cacheKey := fmt.Sprintf("event:%s", event.ID.String())
-	eventData, err := json.Marshal(event)
-	if err != nil {
-		s.logger.Errorf("Failed to marshal event for cache: %v", err)
-		return
+// SetProcessingRecorder records the processing latency of every consumed
+// event
+func (s *EventService) SetProcessingRecorder(recorder ProcessingRecorder) {
+	s.processing = recorder
+}
+
+// SubscribeEvents subscribes to consumed events matching filter. It fails
+// when streaming is not enabled.
+func (s *EventService) SubscribeEvents(filter stream.Filter) (*stream.Subscription, error) {
+	if s.hub == nil {
+		return nil, fmt.Errorf("event streaming is not enabled")
 	}
+	return s.hub.Subscribe(filter), nil
+}
 
-	if err := s.redisClient.Set(ctx, cacheKey, string(eventData), 30*time.Minute); err != nil {
-		s.logger.Errorf("Failed to cache event: %v", err)
+// StreamView converts a consumed event to the API representation for the
+// caller in ctx, withholding payloads of encrypted types from roles that may
+// not read them
+func (s *EventService) StreamView(ctx context.Context, event models.KafkaEvent) models.Event {
+	view := models.Event{
+		ID:        event.ID,
+		UserID:    event.UserID,
+		Type:      event.Type,
+		Data:      event.Data,
+		CreatedAt: event.Timestamp,
+	}
+	if s.encryptedTypes[event.Type] && !s.readerRoles[CallerRole(ctx)] {
+		view.Data = ""
+		view.Encrypted = true
+	}
+	return view
+}
+
+func (s *EventService) processEvent(ctx context.Context, event models.KafkaEvent) error {
+	s.logger.WithField("request_id", event.RequestID).
+		Infof("Processing event: %s (type: %s, version: %d)", event.ID, event.Type, event.Version)
+
+	if s.processor != nil {
+		if err := s.processor.Dispatch(ctx, event); err != nil {
+			return err
+		}
 	}
+
+	s.logger.Infof("Event processed successfully: %s", event.ID)
+	return nil
 }
@@ -3,44 +3,35 @@ package services
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/cache"
+	"highload-microservice/internal/fieldcrypt"
+	"highload-microservice/internal/messaging"
 	"highload-microservice/internal/models"
+	"highload-microservice/internal/pagination"
+	"highload-microservice/internal/repository"
+	"highload-microservice/internal/schema"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
-type stubRedisGetSet struct{}
-
-func (s *stubRedisGetSet) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
-	return nil
-}
-func (s *stubRedisGetSet) Get(ctx context.Context, key string) (string, error) {
-	return "", sql.ErrNoRows
-}
-func (s *stubRedisGetSet) Del(ctx context.Context, keys ...string) error { return nil }
-
 type stubKafka struct{}
 
 func (s *stubKafka) SendEvent(ctx context.Context, event models.KafkaEvent) error { return nil }
 
-// redisHit returns cached payload for Get
-type redisHitWithPayload struct{ payload string }
-
-func (r *redisHitWithPayload) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
-	return nil
-}
-func (r *redisHitWithPayload) Get(ctx context.Context, key string) (string, error) {
-	return r.payload, nil
-}
-func (r *redisHitWithPayload) Del(ctx context.Context, keys ...string) error { return nil }
-
 func TestEventService_CreateAndList(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -48,7 +39,7 @@ func TestEventService_CreateAndList(t *testing.T) {
 	}
 	defer db.Close()
 
-	svc := NewEventService(db, &stubRedisGetSet{}, &stubKafka{}, logrus.New())
+	svc := NewEventService(repository.NewPostgresEventRepository(db), cache.NewMemoryCache(), &stubKafka{}, logrus.New())
 
 	// Create
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events")).
@@ -67,7 +58,7 @@ func TestEventService_CreateAndList(t *testing.T) {
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, type, data, created_at ")).
 		WillReturnRows(rows)
 
-	list, err := svc.ListEvents(context.Background(), 1, 10)
+	list, err := svc.ListEvents(context.Background(), 1, 10, nil)
 	if err != nil {
 		t.Fatalf("list: %v", err)
 	}
@@ -103,7 +94,7 @@ func TestEventService_Create_WithKafkaRedisErrors(t *testing.T) {
 	}
 	defer db.Close()
 
-	svc := NewEventService(db, &redisErr{}, &kafkaErr{}, logrus.New())
+	svc := NewEventService(repository.NewPostgresEventRepository(db), &redisErr{}, &kafkaErr{}, logrus.New())
 
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events")).
 		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
@@ -127,7 +118,7 @@ func TestEventService_GetEvent_CacheMissThenDB_SetsCacheError(t *testing.T) {
 	defer db.Close()
 
 	// redisErr.Get returns error -> cache miss; Set will also error
-	svc := NewEventService(db, &redisErr{}, &stubKafka{}, logrus.New())
+	svc := NewEventService(repository.NewPostgresEventRepository(db), &redisErr{}, &stubKafka{}, logrus.New())
 
 	id := uuid.New()
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, type, data, created_at FROM events WHERE id = $1")).
@@ -154,9 +145,10 @@ func TestEventService_GetEvent_CacheHit(t *testing.T) {
 	// cached event
 	e := models.Event{ID: uuid.New(), UserID: uuid.New(), Type: "t", Data: "{}", CreatedAt: time.Now()}
 	payload, _ := json.Marshal(e)
-	rh := &redisHitWithPayload{payload: string(payload)}
+	mc := cache.NewMemoryCache()
+	_ = mc.Set(context.Background(), "event:"+e.ID.String(), string(payload), time.Minute)
 
-	svc := NewEventService(db, rh, &stubKafka{}, logrus.New())
+	svc := NewEventService(repository.NewPostgresEventRepository(db), mc, &stubKafka{}, logrus.New())
 
 	// No DB expectations; should return from cache directly
 	got, err := svc.GetEvent(context.Background(), e.ID)
@@ -177,12 +169,12 @@ func TestEventService_ListEvents_CountError(t *testing.T) {
 		t.Fatalf("sqlmock: %v", err)
 	}
 	defer db.Close()
-	svc := NewEventService(db, &stubRedisGetSet{}, &stubKafka{}, logrus.New())
+	svc := NewEventService(repository.NewPostgresEventRepository(db), cache.NewMemoryCache(), &stubKafka{}, logrus.New())
 
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM events")).
 		WillReturnError(sql.ErrConnDone)
 
-	if _, err := svc.ListEvents(context.Background(), 1, 10); err == nil {
+	if _, err := svc.ListEvents(context.Background(), 1, 10, nil); err == nil {
 		t.Fatalf("expected error on count")
 	}
 }
@@ -193,14 +185,14 @@ func TestEventService_ListEvents_QueryError(t *testing.T) {
 		t.Fatalf("sqlmock: %v", err)
 	}
 	defer db.Close()
-	svc := NewEventService(db, &stubRedisGetSet{}, &stubKafka{}, logrus.New())
+	svc := NewEventService(repository.NewPostgresEventRepository(db), cache.NewMemoryCache(), &stubKafka{}, logrus.New())
 
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM events")).
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, type, data, created_at ")).
 		WillReturnError(sql.ErrConnDone)
 
-	if _, err := svc.ListEvents(context.Background(), 1, 10); err == nil {
+	if _, err := svc.ListEvents(context.Background(), 1, 10, nil); err == nil {
 		t.Fatalf("expected error on list query")
 	}
 }
@@ -211,7 +203,7 @@ func TestEventService_ListEvents_ScanError(t *testing.T) {
 		t.Fatalf("sqlmock: %v", err)
 	}
 	defer db.Close()
-	svc := NewEventService(db, &stubRedisGetSet{}, &stubKafka{}, logrus.New())
+	svc := NewEventService(repository.NewPostgresEventRepository(db), cache.NewMemoryCache(), &stubKafka{}, logrus.New())
 
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM events")).
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
@@ -221,7 +213,7 @@ func TestEventService_ListEvents_ScanError(t *testing.T) {
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, type, data, created_at ")).
 		WillReturnRows(rows)
 
-	if _, err := svc.ListEvents(context.Background(), 1, 10); err == nil {
+	if _, err := svc.ListEvents(context.Background(), 1, 10, nil); err == nil {
 		t.Fatalf("expected scan error")
 	}
 }
@@ -232,7 +224,7 @@ func TestEventService_GetEvent_DBErrors(t *testing.T) {
 		t.Fatalf("sqlmock: %v", err)
 	}
 	defer db.Close()
-	svc := NewEventService(db, &stubRedisGetSet{}, &stubKafka{}, logrus.New())
+	svc := NewEventService(repository.NewPostgresEventRepository(db), cache.NewMemoryCache(), &stubKafka{}, logrus.New())
 
 	id := uuid.New()
 	// not found
@@ -249,3 +241,270 @@ func TestEventService_GetEvent_DBErrors(t *testing.T) {
 		t.Fatalf("expected db error")
 	}
 }
+
+func TestEventService_PayloadEncryption(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	encryptor, err := fieldcrypt.NewEncryptor("k1", map[string][]byte{"k1": make([]byte, 32)})
+	if err != nil {
+		t.Fatalf("encryptor: %v", err)
+	}
+	producer := &recordingProducer{}
+	svc := NewEventService(repository.NewPostgresEventRepository(db), cache.NewMemoryCache(), producer, logrus.New())
+	svc.SetPayloadEncryption(PayloadEncryption{Encryptor: encryptor, EventTypes: []string{"pii"}, ReaderRoles: []string{"admin"}})
+
+	var stored string
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "pii", captureArg(&stored), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	event, err := svc.CreateEvent(context.Background(), models.CreateEventRequest{UserID: uuid.New(), Type: "pii", Data: `{"ssn":"123"}`})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if event.Data != `{"ssn":"123"}` {
+		t.Fatalf("creator should get plaintext back, got %q", event.Data)
+	}
+	if !fieldcrypt.IsEncrypted(stored) || producer.events[0].Data != stored {
+		t.Fatalf("payload not encrypted at rest: db=%q kafka=%q", stored, producer.events[0].Data)
+	}
+
+	// Admins read the plaintext (first from DB, then from cache); others don't
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, type, data, created_at FROM events WHERE id = $1")).
+		WithArgs(event.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "type", "data", "created_at"}).
+			AddRow(event.ID, event.UserID, "pii", stored, event.CreatedAt))
+
+	got, err := svc.GetEvent(WithCallerRole(context.Background(), "admin"), event.ID)
+	if err != nil || got.Data != `{"ssn":"123"}` || got.Encrypted {
+		t.Fatalf("admin read: %+v %v", got, err)
+	}
+	got, err = svc.GetEvent(WithCallerRole(context.Background(), "user"), event.ID)
+	if err != nil || got.Data != "" || !got.Encrypted {
+		t.Fatalf("user read: %+v %v", got, err)
+	}
+
+	// Consumers get the plaintext
+	consumed := producer.events[0]
+	if err := svc.openKafkaEvent(&consumed); err != nil || consumed.Data != `{"ssn":"123"}` {
+		t.Fatalf("consume: %q %v", consumed.Data, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+// captureArg is a sqlmock argument matcher that records the string it sees
+type stringCapture struct{ dst *string }
+
+func captureArg(dst *string) stringCapture { return stringCapture{dst} }
+
+func (c stringCapture) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	*c.dst = s
+	return ok
+}
+
+func TestEventService_ListEvents_Cursor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	svc := NewEventService(repository.NewPostgresEventRepository(db), cache.NewMemoryCache(), &stubKafka{}, logrus.New())
+	cols := []string{"id", "user_id", "type", "data", "created_at"}
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+
+	// First page: the extra third row means another page follows
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM events")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(regexp.QuoteMeta("ORDER BY created_at DESC, id DESC \n\t\tLIMIT $1 OFFSET $2")).
+		WithArgs(3, 0).
+		WillReturnRows(sqlmock.NewRows(cols).
+			AddRow(ids[0], uuid.New(), "created", "{}", base.Add(2*time.Minute)).
+			AddRow(ids[1], uuid.New(), "created", "{}", base.Add(time.Minute)).
+			AddRow(ids[2], uuid.New(), "created", "{}", base))
+
+	first, err := svc.ListEvents(context.Background(), 1, 2, nil)
+	if err != nil {
+		t.Fatalf("first page: %v", err)
+	}
+	if len(first.Events) != 2 || first.NextCursor == "" {
+		t.Fatalf("expected 2 events and a next cursor, got %d events, cursor %q", len(first.Events), first.NextCursor)
+	}
+
+	// Second page continues strictly after the last event of the first
+	cursor, err := pagination.Decode(first.NextCursor)
+	if err != nil || cursor.ID != ids[1] {
+		t.Fatalf("unexpected cursor %+v: %v", cursor, err)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM events")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM events WHERE (created_at < $1 OR (created_at = $2 AND id < $3))")).
+		WithArgs(cursor.CreatedAt, cursor.CreatedAt, ids[1], 3, 0).
+		WillReturnRows(sqlmock.NewRows(cols).AddRow(ids[2], uuid.New(), "created", "{}", base))
+
+	second, err := svc.ListEvents(context.Background(), 1, 2, &cursor)
+	if err != nil {
+		t.Fatalf("second page: %v", err)
+	}
+	if len(second.Events) != 1 || second.NextCursor != "" || second.Page != 0 {
+		t.Fatalf("unexpected last page: %+v", second)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+type recordingKafka struct{ events []models.KafkaEvent }
+
+func (r *recordingKafka) SendEvent(ctx context.Context, event models.KafkaEvent) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+func TestEventService_SchemaValidation(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	registry := schema.NewRegistry(nil, logrus.New())
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "order_paid.json"), []byte(`{"type":"object","required":["amount"]}`), 0o600); err != nil {
+		t.Fatalf("write schema: %v", err)
+	}
+	if err := registry.LoadDir(dir); err != nil {
+		t.Fatalf("load schemas: %v", err)
+	}
+
+	svc := NewEventService(repository.NewPostgresEventRepository(db), cache.NewMemoryCache(), &stubKafka{}, logrus.New())
+	svc.SetSchemaValidation(registry, nil)
+
+	// Rejected before anything is stored
+	_, err = svc.CreateEvent(context.Background(), models.CreateEventRequest{UserID: uuid.New(), Type: "order_paid", Data: `{}`})
+	if !errors.Is(err, apperrors.ErrValidation) || !strings.Contains(err.Error(), "$.amount: is required") {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+
+	invalid := models.KafkaEvent{ID: uuid.New(), UserID: uuid.New(), Type: "order_paid", Data: `{}`}
+	if err := svc.HandleEvent(context.Background(), invalid); !messaging.IsPermanent(err) {
+		t.Fatalf("expected permanent error without a sink, got %v", err)
+	}
+
+	sink := &recordingKafka{}
+	svc.SetSchemaValidation(registry, sink)
+	if err := svc.HandleEvent(context.Background(), invalid); err != nil {
+		t.Fatalf("expected invalid event to be moved, got %v", err)
+	}
+	if len(sink.events) != 1 || sink.events[0].ID != invalid.ID {
+		t.Fatalf("expected invalid event in sink, got %+v", sink.events)
+	}
+}
+
+type recordingWebhooks struct{ events []models.Event }
+
+func (r *recordingWebhooks) Enqueue(ctx context.Context, event models.Event) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+func TestEventService_QueuesWebhooks(t *testing.T) {
+	encryptor, err := fieldcrypt.NewEncryptor("k1", map[string][]byte{"k1": make([]byte, 32)})
+	if err != nil {
+		t.Fatalf("encryptor: %v", err)
+	}
+	svc := NewEventService(nil, cache.NewMemoryCache(), &stubKafka{}, logrus.New())
+	svc.SetPayloadEncryption(PayloadEncryption{Encryptor: encryptor, EventTypes: []string{"pii"}, ReaderRoles: []string{"admin"}})
+	hooks := &recordingWebhooks{}
+	svc.SetWebhooks(hooks)
+
+	plain := models.KafkaEvent{ID: uuid.New(), UserID: uuid.New(), Type: "order_paid", Data: `{"amount":1}`}
+	sensitive := models.KafkaEvent{ID: uuid.New(), UserID: uuid.New(), Type: "pii", Data: `{"ssn":"1"}`}
+	for _, event := range []models.KafkaEvent{plain, sensitive} {
+		if err := svc.HandleEvent(context.Background(), event); err != nil {
+			t.Fatalf("handle %s: %v", event.Type, err)
+		}
+	}
+
+	if len(hooks.events) != 2 || hooks.events[0].Data != plain.Data {
+		t.Fatalf("want both events queued, got %+v", hooks.events)
+	}
+	if hooks.events[1].Data != "" || !hooks.events[1].Encrypted {
+		t.Fatalf("encrypted payloads must be withheld from webhooks, got %+v", hooks.events[1])
+	}
+}
+
+type failingRecorder struct{ calls int }
+
+func (r *failingRecorder) RecordProcessed(ctx context.Context, eventID uuid.UUID, createdAt, processedAt time.Time) error {
+	r.calls++
+	return errors.New("database is down")
+}
+
+func TestEventService_RecordsProcessingTime(t *testing.T) {
+	svc := NewEventService(nil, cache.NewMemoryCache(), &stubKafka{}, logrus.New())
+	recorder := &failingRecorder{}
+	svc.SetProcessingRecorder(recorder)
+
+	// Stats failures do not fail processing
+	event := models.KafkaEvent{ID: uuid.New(), UserID: uuid.New(), Type: "order_paid", Data: "{}", Timestamp: time.Now()}
+	if err := svc.HandleEvent(context.Background(), event); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	if recorder.calls != 1 {
+		t.Fatalf("want processing time recorded once, got %d", recorder.calls)
+	}
+}
+
+func TestEventService_ListEvents_ListCache(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	svc := NewEventService(repository.NewPostgresEventRepository(db), cache.NewMemoryCache(), &stubKafka{}, logrus.New())
+	svc.SetListCache(true)
+	ids := []uuid.UUID{uuid.New(), uuid.New()}
+	expectPage := func() {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM events")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id \n\t\tFROM events")).
+			WithArgs(11, 0).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(ids[0]).AddRow(ids[1]))
+	}
+
+	expectPage()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM events WHERE id IN ($1, $2)")).
+		WithArgs(ids[0], ids[1]).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "type", "data", "created_at"}).
+			AddRow(ids[1], uuid.New(), "created", "{}", time.Now()).
+			AddRow(ids[0], uuid.New(), "created", "{}", time.Now()))
+	if _, err := svc.ListEvents(context.Background(), 1, 10, nil); err != nil {
+		t.Fatalf("cold list: %v", err)
+	}
+
+	// Every event is cached now; the page costs the ID query only
+	expectPage()
+	list, err := svc.ListEvents(context.Background(), 1, 10, nil)
+	if err != nil {
+		t.Fatalf("warm list: %v", err)
+	}
+	if len(list.Events) != 2 || list.Events[0].ID != ids[0] || list.Events[1].ID != ids[1] {
+		t.Fatalf("expected the events in page order, got %+v", list.Events)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/cache"
+
+	"github.com/google/uuid"
+)
+
+// EventUsageConfig enables per-user daily counters of created events
+type EventUsageConfig struct {
+	DailyQuota int // events a user may create per UTC day; 0 means no limit
+	Days       int // days of counters kept and reported
+}
+
+// EventQuotaExceededError is returned by CreateEvent when the user has used up
+// the daily quota
+type EventQuotaExceededError struct {
+	Limit      int
+	RetryAfter time.Duration // until the next UTC day
+}
+
+func (e *EventQuotaExceededError) Error() string {
+	return "daily event quota exceeded"
+}
+
+// IsEventQuotaExceeded reports whether err is an EventQuotaExceededError
+func IsEventQuotaExceeded(err error) (*EventQuotaExceededError, bool) {
+	var exceeded *EventQuotaExceededError
+	if errors.As(err, &exceeded) {
+		return exceeded, true
+	}
+	return nil, false
+}
+
+// EventUsage is the number of events a user created per day, newest first
+type EventUsage struct {
+	UserID     uuid.UUID    `json:"user_id"`
+	Today      int64        `json:"today"`
+	DailyQuota int          `json:"daily_quota"`         // 0 means no limit
+	Remaining  *int64       `json:"remaining,omitempty"` // left today, with a quota
+	Days       []DailyUsage `json:"days"`
+}
+
+type DailyUsage struct {
+	Date   string `json:"date"` // UTC, YYYY-MM-DD
+	Events int64  `json:"events"`
+}
+
+// SetUsage enables the daily event counters and, with a quota, its enforcement
+// in CreateEvent. Counters are not transactional with the events: a failed
+// increment only logs, and concurrent requests may overshoot the quota by the
+// few that were checked before the others were counted.
+func (s *EventService) SetUsage(counters Counter, cfg EventUsageConfig) {
+	if cfg.Days <= 0 {
+		cfg.Days = 30
+	}
+	s.usage = counters
+	s.usageConfig = cfg
+}
+
+// usageKey is the counter of the events userID created on day
+func usageKey(userID uuid.UUID, day time.Time) string {
+	return "event_usage:" + userID.String() + ":" + day.UTC().Format("2006-01-02")
+}
+
+// checkQuota returns an EventQuotaExceededError once userID has created
+// DailyQuota events today. Cache errors fail open.
+func (s *EventService) checkQuota(ctx context.Context, userID uuid.UUID) error {
+	if s.usage == nil || s.usageConfig.DailyQuota <= 0 {
+		return nil
+	}
+	now := time.Now().UTC()
+	value, err := s.usage.Get(ctx, usageKey(userID, now))
+	if err != nil {
+		if !errors.Is(err, cache.ErrMiss) {
+			s.logger.Warnf("Failed to read event usage of user %s: %v", userID, err)
+		}
+		return nil
+	}
+	count, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || count < int64(s.usageConfig.DailyQuota) {
+		return nil
+	}
+	tomorrow := now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+	return &EventQuotaExceededError{Limit: s.usageConfig.DailyQuota, RetryAfter: tomorrow.Sub(now)}
+}
+
+// countEvent adds a created event to today's counter of userID. The counter
+// outlives the day by the days reported.
+func (s *EventService) countEvent(ctx context.Context, userID uuid.UUID) {
+	if s.usage == nil {
+		return
+	}
+	ttl := time.Duration(s.usageConfig.Days+1) * 24 * time.Hour
+	if _, err := s.usage.Incr(ctx, usageKey(userID, time.Now()), ttl); err != nil {
+		s.logger.Warnf("Failed to count event of user %s: %v", userID, err)
+	}
+}
+
+// GetUsage returns the events userID created on each of the last days days,
+// today included. days is capped at the days counters are kept.
+func (s *EventService) GetUsage(ctx context.Context, userID uuid.UUID, days int) (*EventUsage, error) {
+	if s.usage == nil {
+		return nil, apperrors.New(apperrors.ErrUnavailable, "event usage is not enabled")
+	}
+	if days <= 0 || days > s.usageConfig.Days {
+		days = s.usageConfig.Days
+	}
+
+	usage := &EventUsage{UserID: userID, DailyQuota: s.usageConfig.DailyQuota, Days: make([]DailyUsage, 0, days)}
+	day := time.Now().UTC()
+	for i := 0; i < days; i++ {
+		var count int64
+		value, err := s.usage.Get(ctx, usageKey(userID, day))
+		switch {
+		case err == nil:
+			count, _ = strconv.ParseInt(value, 10, 64)
+		case !errors.Is(err, cache.ErrMiss):
+			return nil, apperrors.Wrap(apperrors.ErrUnavailable, "event usage is unavailable", err)
+		}
+		usage.Days = append(usage.Days, DailyUsage{Date: day.Format("2006-01-02"), Events: count})
+		day = day.AddDate(0, 0, -1)
+	}
+
+	usage.Today = usage.Days[0].Events
+	if usage.DailyQuota > 0 {
+		remaining := max(int64(usage.DailyQuota)-usage.Today, 0)
+		usage.Remaining = &remaining
+	}
+	return usage, nil
+}
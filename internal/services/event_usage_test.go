@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/cache"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/repository"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+func TestEventService_DailyQuota(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	counters := cache.NewMemoryCache()
+	svc := NewEventService(repository.NewPostgresEventRepository(db), counters, &stubKafka{}, logrus.New())
+	svc.SetUsage(counters, EventUsageConfig{DailyQuota: 2, Days: 7})
+
+	userID := uuid.New()
+	for i := 0; i < 2; i++ {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events")).WillReturnResult(sqlmock.NewResult(1, 1))
+		if _, err := svc.CreateEvent(context.Background(), models.CreateEventRequest{UserID: userID, Type: "t", Data: "{}"}); err != nil {
+			t.Fatalf("create %d: %v", i, err)
+		}
+	}
+	_, err = svc.CreateEvent(context.Background(), models.CreateEventRequest{UserID: userID, Type: "t", Data: "{}"})
+	exceeded, ok := IsEventQuotaExceeded(err)
+	if !ok || exceeded.Limit != 2 || exceeded.RetryAfter <= 0 || exceeded.RetryAfter > 24*time.Hour {
+		t.Fatalf("third create: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+
+	// Other users have their own quota
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events")).WillReturnResult(sqlmock.NewResult(1, 1))
+	if _, err := svc.CreateEvent(context.Background(), models.CreateEventRequest{UserID: uuid.New(), Type: "t", Data: "{}"}); err != nil {
+		t.Fatalf("create for another user: %v", err)
+	}
+}
+
+func TestEventService_GetUsage(t *testing.T) {
+	counters := cache.NewMemoryCache()
+	svc := NewEventService(nil, counters, &stubKafka{}, logrus.New())
+	if _, err := svc.GetUsage(context.Background(), uuid.New(), 0); apperrors.HTTPStatus(err) != 503 {
+		t.Fatalf("usage without counters: %v", err)
+	}
+	svc.SetUsage(counters, EventUsageConfig{DailyQuota: 5, Days: 3})
+
+	userID := uuid.New()
+	now := time.Now()
+	for _, day := range []time.Time{now, now, now.AddDate(0, 0, -2)} {
+		if _, err := counters.Incr(context.Background(), usageKey(userID, day), time.Hour); err != nil {
+			t.Fatalf("incr: %v", err)
+		}
+	}
+
+	usage, err := svc.GetUsage(context.Background(), userID, 10)
+	if err != nil {
+		t.Fatalf("GetUsage: %v", err)
+	}
+	if usage.Today != 2 || usage.Remaining == nil || *usage.Remaining != 3 {
+		t.Errorf("today %d, remaining %v", usage.Today, usage.Remaining)
+	}
+	if len(usage.Days) != 3 || usage.Days[1].Events != 0 || usage.Days[2].Events != 1 ||
+		usage.Days[2].Date != now.UTC().AddDate(0, 0, -2).Format("2006-01-02") {
+		t.Errorf("days = %+v, want 3 days newest first", usage.Days)
+	}
+}
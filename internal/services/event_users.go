@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"highload-microservice/internal/apperrors"
+
+	"github.com/google/uuid"
+)
+
+// SetUserLookup makes CreateEvent and CreateEvents refuse events of users
+// that do not exist, or are deleted or deactivated, before they reach the
+// database. Lookups go through the user cache, so repeated events of a user
+// cost no query.
+func (s *EventService) SetUserLookup(users UserLookup) {
+	s.users = users
+}
+
+// unknownUser is the error of events whose user does not exist
+func unknownUser(userID uuid.UUID) error {
+	return apperrors.Unprocessable(fmt.Sprintf("user %s does not exist", userID))
+}
+
+// checkUser returns an ErrUnprocessable error if userID is not a visible
+// user. Lookup failures are only logged; the events.user_id foreign key still
+// refuses users that are missing altogether.
+func (s *EventService) checkUser(ctx context.Context, userID uuid.UUID) error {
+	if s.users == nil {
+		return nil
+	}
+	if _, err := s.users.GetUser(ctx, userID); err != nil {
+		if errors.Is(err, apperrors.ErrNotFound) {
+			return unknownUser(userID)
+		}
+		s.logger.Warnf("Failed to look up user %s of event: %v", userID, err)
+	}
+	return nil
+}
+
+// checkUsers runs checkUser once per distinct user and returns the errors
+// by user
+func (s *EventService) checkUsers(ctx context.Context, userIDs []uuid.UUID) map[uuid.UUID]error {
+	errs := make(map[uuid.UUID]error)
+	if s.users == nil {
+		return errs
+	}
+	checked := make(map[uuid.UUID]bool, len(userIDs))
+	for _, id := range userIDs {
+		if checked[id] {
+			continue
+		}
+		checked[id] = true
+		if err := s.checkUser(ctx, id); err != nil {
+			errs[id] = err
+		}
+	}
+	return errs
+}
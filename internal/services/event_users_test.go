@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/cache"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/repository"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// knownUsers answers lookups from a set and counts them
+type knownUsers struct {
+	ids     map[uuid.UUID]bool
+	lookups int
+	err     error
+}
+
+func (k *knownUsers) GetUser(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	k.lookups++
+	if k.err != nil {
+		return nil, k.err
+	}
+	if !k.ids[id] {
+		return nil, apperrors.NotFound("user not found")
+	}
+	return &models.User{ID: id}, nil
+}
+
+func TestEventService_CreateEvent_RefusesUnknownUsers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	known := uuid.New()
+	users := &knownUsers{ids: map[uuid.UUID]bool{known: true}}
+	svc := NewEventService(repository.NewPostgresEventRepository(db), cache.NewMemoryCache(), &stubKafka{}, logrus.New())
+	svc.SetUserLookup(users)
+
+	missing := uuid.New()
+	_, err = svc.CreateEvent(context.Background(), models.CreateEventRequest{UserID: missing, Type: "login", Data: "{}"})
+	if !errors.Is(err, apperrors.ErrUnprocessable) || apperrors.Message(err) != "user "+missing.String()+" does not exist" {
+		t.Fatalf("want unprocessable, got %v", err)
+	}
+
+	insert := regexp.QuoteMeta("INSERT INTO events")
+	mock.ExpectExec(insert).WillReturnResult(sqlmock.NewResult(1, 1))
+	if _, err := svc.CreateEvent(context.Background(), models.CreateEventRequest{UserID: known, Type: "login", Data: "{}"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	// With the lookup failing the foreign key still refuses the user
+	users.err = errors.New("cache and database down")
+	mock.ExpectExec(insert).WillReturnError(&pq.Error{Code: "23503"})
+	_, err = svc.CreateEvent(context.Background(), models.CreateEventRequest{UserID: missing, Type: "login", Data: "{}"})
+	if !errors.Is(err, apperrors.ErrUnprocessable) || apperrors.HTTPStatus(err) != 422 {
+		t.Fatalf("foreign key violation: want 422, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestEventService_CreateEvents_LooksUpEachUserOnce(t *testing.T) {
+	known, missing := uuid.New(), uuid.New()
+	users := &knownUsers{ids: map[uuid.UUID]bool{known: true}}
+	store := &fakeBulkStore{}
+	svc, _ := newBulkService(store, nil)
+	svc.SetUserLookup(users)
+
+	reqs := []models.CreateEventRequest{
+		{UserID: known, Type: "login", Data: "{}"},
+		{UserID: missing, Type: "login", Data: "{}"},
+		{UserID: known, Type: "logout", Data: "{}"},
+		{UserID: missing, Type: "logout", Data: "{}"},
+	}
+	results, err := svc.CreateEvents(context.Background(), reqs)
+	if err != nil {
+		t.Fatalf("create events: %v", err)
+	}
+	for i, result := range results {
+		if refused := errors.Is(result.Err, apperrors.ErrUnprocessable); refused != (reqs[i].UserID == missing) {
+			t.Errorf("event %d: unexpected result %+v", i, result)
+		}
+	}
+	if users.lookups != 2 || len(store.batches) != 1 || len(store.batches[0]) != 2 {
+		t.Fatalf("want 2 lookups and one batch of 2, got %d lookups and batches %v", users.lookups, store.batches)
+	}
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/pagination"
+	"highload-microservice/internal/repository"
+)
+
+// ExportUsers calls fn with consecutive batches of up to batchSize users in
+// any state created in query's range, oldest first. Batches are read with
+// keyset pagination, so memory stays bounded whatever the range.
+func (s *UserService) ExportUsers(ctx context.Context, query repository.UserRangeQuery, batchSize int, fn func([]models.User) error) error {
+	var after *pagination.Cursor
+	for {
+		batch, err := s.users.ListRange(ctx, query, after, batchSize)
+		if err != nil {
+			return apperrors.FromDB(err, "failed to export users")
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		if len(batch) < batchSize {
+			return nil
+		}
+		last := batch[len(batch)-1]
+		after = &pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+}
+
+// ExportEvents calls fn with consecutive batches of up to batchSize events
+// created in query's range, oldest first, as ExportUsers does. Encrypted
+// payloads are revealed to callers allowed to read them.
+func (s *EventService) ExportEvents(ctx context.Context, query repository.EventRangeQuery, batchSize int, fn func([]models.Event) error) error {
+	var after *pagination.Cursor
+	for {
+		batch, err := s.events.ListRange(ctx, query, after, batchSize)
+		if err != nil {
+			return apperrors.FromDB(err, "failed to export events")
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		last := batch[len(batch)-1]
+		for i := range batch {
+			s.revealEvent(ctx, &batch[i])
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		if len(batch) < batchSize {
+			return nil
+		}
+		after = &pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+}
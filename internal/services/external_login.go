@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/oidc"
+	"highload-microservice/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// externalPasswordHash is stored for accounts provisioned by an identity
+// provider. It never matches a bcrypt hash, so such accounts can't log in
+// with a password until an operator sets one.
+const externalPasswordHash = "!external"
+
+// LoginWithIdentity starts a session for a user authenticated by an external
+// identity provider. The identity is linked to the account with the same
+// email on first login; users without an account get one with the user role.
+func (s *AuthService) LoginWithIdentity(ctx context.Context, identity oidc.Identity) (*models.LoginResponse, error) {
+	userID, err := s.repo.FindIdentity(ctx, identity.Issuer, identity.Subject)
+	switch {
+	case err == nil:
+	case errors.Is(err, repository.ErrNotFound):
+		userID, err = s.linkIdentity(ctx, identity)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, apperrors.FromDB(err, "failed to find identity")
+	}
+
+	user, err := s.repo.GetActiveUser(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, apperrors.Wrap(apperrors.ErrUnauthorized, "account is deactivated", err)
+		}
+		return nil, apperrors.FromDB(err, "failed to get user")
+	}
+
+	response, err := s.startSession(ctx, *user)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Infof("User authenticated through %s: %s", identity.Issuer, user.Email)
+	return response, nil
+}
+
+// linkIdentity links an identity to the account with its email, creating the
+// account if there is none
+func (s *AuthService) linkIdentity(ctx context.Context, identity oidc.Identity) (uuid.UUID, error) {
+	var userID uuid.UUID
+	account, err := s.repo.FindAccount(ctx, identity.Email)
+	switch {
+	case err == nil:
+		if !account.IsActive {
+			return uuid.Nil, apperrors.Unauthorized("account is deactivated")
+		}
+		userID = account.ID
+	case errors.Is(err, repository.ErrNotFound):
+		now := time.Now()
+		user := models.AuthUser{
+			ID:        uuid.New(),
+			Email:     identity.Email,
+			FirstName: identity.FirstName,
+			LastName:  identity.LastName,
+			Role:      models.RoleUser,
+			IsActive:  true,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := s.repo.CreateUser(ctx, &user, externalPasswordHash); err != nil {
+			if apperrors.IsUniqueViolation(err) {
+				// Provisioned by a concurrent first login; it links on retry
+				return uuid.Nil, apperrors.Conflict("account is being created, please retry")
+			}
+			return uuid.Nil, apperrors.FromDB(err, "failed to create user")
+		}
+		s.logger.Infof("Auth user provisioned from %s: %s", identity.Issuer, user.Email)
+		userID = user.ID
+	default:
+		return uuid.Nil, apperrors.FromDB(err, "failed to find account")
+	}
+
+	if err := s.repo.LinkIdentity(ctx, userID, identity.Issuer, identity.Subject, time.Now()); err != nil {
+		if !apperrors.IsUniqueViolation(err) {
+			return uuid.Nil, apperrors.FromDB(err, "failed to link identity")
+		}
+		// Linked by a concurrent login
+		return s.repo.FindIdentity(ctx, identity.Issuer, identity.Subject)
+	}
+	return userID, nil
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/oidc"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+const (
+	findIdentityQuery  = `SELECT user_id FROM auth_identities WHERE issuer = $1 AND subject = $2`
+	getActiveUserQuery = `SELECT id, email, first_name, last_name, role, is_active, created_at, updated_at`
+)
+
+var activeUserColumns = []string{"id", "email", "first_name", "last_name", "role", "is_active", "created_at", "updated_at"}
+
+func TestLoginWithIdentity_ProvisionsNewUser(t *testing.T) {
+	svc, mock, cleanup := newAuthServiceMock(t)
+	defer cleanup()
+
+	identity := oidc.Identity{Issuer: "https://idp", Subject: "s1", Email: "jane@example.com", FirstName: "Jane", LastName: "Doe"}
+	mock.ExpectQuery(regexp.QuoteMeta(findIdentityQuery)).
+		WithArgs("https://idp", "s1").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, role, is_active FROM auth_users WHERE email = $1`)).
+		WithArgs("jane@example.com").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO auth_users`)).
+		WithArgs(sqlmock.AnyArg(), "jane@example.com", "Jane", "Doe", externalPasswordHash, "user", true, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO auth_identities (issuer, subject, user_id, created_at)`)).
+		WithArgs("https://idp", "s1", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(getActiveUserQuery)).
+		WillReturnRows(sqlmock.NewRows(activeUserColumns).
+			AddRow(uuid.New(), "jane@example.com", "Jane", "Doe", "user", true, time.Now(), time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO refresh_tokens`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	resp, err := svc.LoginWithIdentity(context.Background(), identity)
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if resp.AccessToken == "" || resp.RefreshToken == "" || resp.User.Email != "jane@example.com" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestLoginWithIdentity_DeactivatedAccount(t *testing.T) {
+	svc, mock, cleanup := newAuthServiceMock(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(findIdentityQuery)).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, role, is_active FROM auth_users WHERE email = $1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "role", "is_active"}).AddRow(uuid.New(), "user", false))
+
+	_, err := svc.LoginWithIdentity(context.Background(), oidc.Identity{Issuer: "https://idp", Subject: "s1", Email: "old@example.com"})
+	if !errors.Is(err, apperrors.ErrUnauthorized) {
+		t.Fatalf("want unauthorized, got %v", err)
+	}
+}
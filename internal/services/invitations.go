@@ -0,0 +1,175 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/mail"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/password"
+	"highload-microservice/internal/rbac"
+	"highload-microservice/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// InvitationConfig configures invitations
+type InvitationConfig struct {
+	AcceptURL string // link sent by email, the token is appended as ?token=
+	TTL       time.Duration
+}
+
+// maxInvitationList bounds ListInvitations
+const maxInvitationList = 500
+
+// errInvalidInvitation is returned for unknown, used, revoked and expired
+// invitation tokens alike
+var errInvalidInvitation = apperrors.Validation("invalid or expired invitation")
+
+// SetInvitations enables InviteUser and AcceptInvitation, sending invitations
+// through sender
+func (s *AuthService) SetInvitations(sender mail.Sender, cfg InvitationConfig) {
+	if cfg.TTL <= 0 {
+		cfg.TTL = 72 * time.Hour
+	}
+	s.mailer = sender
+	s.invitations = &cfg
+}
+
+// InviteUser emails a one-time link to create an account with req.Role,
+// user by default. Inviting an email again revokes its earlier invitations.
+func (s *AuthService) InviteUser(ctx context.Context, req models.InviteUserRequest) (*models.Invitation, error) {
+	if s.invitations == nil {
+		return nil, apperrors.New(apperrors.ErrUnavailable, "invitations are not enabled")
+	}
+	role := req.Role
+	if role == "" {
+		role = models.RoleUser
+	}
+	if !rbac.ValidRole(role) {
+		return nil, apperrors.Validation(fmt.Sprintf("unknown role %q", role))
+	}
+	email := strings.TrimSpace(req.Email)
+	if _, err := s.repo.FindAccount(ctx, email); err == nil {
+		return nil, apperrors.Conflict("user with this email already exists")
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, apperrors.FromDB(err, "failed to get user")
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate invitation token: %w", err)
+	}
+	token := hex.EncodeToString(secret)
+
+	now := time.Now()
+	invitation := models.Invitation{
+		ID:        uuid.New(),
+		Email:     email,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Role:      role,
+		Status:    models.InvitationPending,
+		InvitedBy: CallerID(ctx),
+		ExpiresAt: now.Add(s.invitations.TTL),
+		CreatedAt: now,
+	}
+	if err := s.repo.CreateInvitation(ctx, &invitation, s.hashAPIKey(token)); err != nil {
+		return nil, apperrors.FromDB(err, "failed to create invitation")
+	}
+
+	go s.sendInvitation(invitation, token)
+
+	s.logger.Infof("Invitation %s created for role %s", invitation.ID, invitation.Role)
+	return &invitation, nil
+}
+
+// AcceptInvitation creates the invited account, active and with the invited
+// role, with the invitee's password
+func (s *AuthService) AcceptInvitation(ctx context.Context, req models.AcceptInviteRequest) (*models.AuthUser, error) {
+	if s.invitations == nil {
+		return nil, apperrors.New(apperrors.ErrUnavailable, "invitations are not enabled")
+	}
+	invitation, err := s.repo.FindInvitation(ctx, s.hashAPIKey(req.Token))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errInvalidInvitation
+		}
+		return nil, apperrors.FromDB(err, "failed to get invitation")
+	}
+	now := time.Now()
+	if invitation.Status != models.InvitationPending || !now.Before(invitation.ExpiresAt) {
+		return nil, errInvalidInvitation
+	}
+
+	hash, err := s.hashPassword(req.Password, password.UserInfo{
+		Email: invitation.Email, FirstName: invitation.FirstName, LastName: invitation.LastName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	user := models.AuthUser{
+		ID:        uuid.New(),
+		Email:     invitation.Email,
+		FirstName: invitation.FirstName,
+		LastName:  invitation.LastName,
+		Role:      invitation.Role,
+		IsActive:  true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	accepted, err := s.repo.AcceptInvitation(ctx, invitation.ID, &user, hash, now)
+	if err != nil {
+		if apperrors.IsUniqueViolation(err) {
+			return nil, apperrors.Conflict("user with this email already exists")
+		}
+		return nil, apperrors.FromDB(err, "failed to accept invitation")
+	}
+	if !accepted {
+		return nil, errInvalidInvitation
+	}
+
+	s.logger.Infof("Invitation %s accepted, user %s created", invitation.ID, user.ID)
+	return &user, nil
+}
+
+// ListInvitations returns up to limit invitations in status, newest first;
+// an empty status lists all
+func (s *AuthService) ListInvitations(ctx context.Context, status models.InvitationStatus, limit int) ([]models.Invitation, error) {
+	switch status {
+	case "", models.InvitationPending, models.InvitationAccepted, models.InvitationRevoked, models.InvitationExpired:
+	default:
+		return nil, apperrors.Validation(fmt.Sprintf("unknown invitation status %q", status))
+	}
+	if limit <= 0 || limit > maxInvitationList {
+		limit = maxInvitationList
+	}
+	invitations, err := s.repo.ListInvitations(ctx, status, time.Now(), limit)
+	if err != nil {
+		return nil, apperrors.FromDB(err, "failed to list invitations")
+	}
+	return invitations, nil
+}
+
+// sendInvitation emails the invitation link
+func (s *AuthService) sendInvitation(invitation models.Invitation, token string) {
+	link, err := tokenLink(s.invitations.AcceptURL, token)
+	if err != nil {
+		s.logger.Errorf("Invalid invitation URL: %v", err)
+		return
+	}
+	var body bytes.Buffer
+	if invitation.FirstName != "" {
+		fmt.Fprintf(&body, "Hello %s,\n\n", invitation.FirstName)
+	}
+	fmt.Fprintf(&body, "You have been invited to create an account. Choose a password at:\n\n%s\n\n", link)
+	fmt.Fprintf(&body, "The link can be used once and expires on %s.\n", invitation.ExpiresAt.UTC().Format(time.RFC1123))
+	s.sendAccountEmail(mail.Message{To: []string{invitation.Email}, Subject: "You have been invited", Body: body.String()})
+}
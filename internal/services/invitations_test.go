@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/mail"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/repository"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+var invitationRow = []string{"id", "email", "first_name", "last_name", "role", "status", "invited_by", "user_id", "expires_at", "created_at", "accepted_at"}
+
+func newInvitationService(t *testing.T) (*AuthService, sqlmock.Sqlmock, outbox) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	svc := NewAuthService(repository.NewPostgresAuthRepository(db), nil, logrus.New(), AuthConfig{JWTSecret: "secret"})
+	sent := make(outbox, 1)
+	svc.SetInvitations(sent, InvitationConfig{AcceptURL: "https://app.example.com/accept-invite", TTL: time.Hour})
+	return svc, mock, sent
+}
+
+func TestInviteUser_EmailsOneTimeToken(t *testing.T) {
+	svc, mock, sent := newInvitationService(t)
+	adminID := uuid.New()
+	ctx := WithCallerID(context.Background(), adminID)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, role, is_active FROM auth_users WHERE email = $1`)).
+		WithArgs("new@example.com").WillReturnRows(sqlmock.NewRows([]string{"id", "role", "is_active"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE invitations SET status = $1 WHERE LOWER(email) = LOWER($2)`)).
+		WithArgs(models.InvitationRevoked, "new@example.com", models.InvitationPending).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO invitations`)).
+		WithArgs(sqlmock.AnyArg(), "new@example.com", "New", "", models.RoleReadOnly, models.InvitationPending, &adminID,
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	invitation, err := svc.InviteUser(ctx, models.InviteUserRequest{Email: "new@example.com", FirstName: "New", Role: models.RoleReadOnly})
+	if err != nil {
+		t.Fatalf("invite: %v", err)
+	}
+	if invitation.Status != models.InvitationPending || time.Until(invitation.ExpiresAt) > time.Hour {
+		t.Fatalf("unexpected invitation: %+v", invitation)
+	}
+
+	var msg mail.Message
+	select {
+	case msg = <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("no invitation email sent")
+	}
+	start := strings.Index(msg.Body, "https://app.example.com/accept-invite?token=")
+	if start < 0 || msg.To[0] != "new@example.com" {
+		t.Fatalf("unexpected email to %v: %q", msg.To, msg.Body)
+	}
+	link, _ := url.Parse(strings.Fields(msg.Body[start:])[0])
+	token := link.Query().Get("token")
+
+	// Only the hash of the token is stored
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, email, first_name, last_name, role, status, invited_by, user_id, expires_at, created_at, accepted_at FROM invitations WHERE token_hash = $1`)).
+		WithArgs(svc.hashAPIKey(token)).
+		WillReturnRows(sqlmock.NewRows(invitationRow).AddRow(invitation.ID, "new@example.com", "New", "", "readonly", "pending", adminID, nil, invitation.ExpiresAt, invitation.CreatedAt, nil))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO auth_users (id, email, first_name, last_name, password_hash, role, is_active, created_at, updated_at, email_verified_at)`)).
+		WithArgs(sqlmock.AnyArg(), "new@example.com", "New", "", sqlmock.AnyArg(), models.RoleReadOnly, true, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE invitations SET status = $1, user_id = $2, accepted_at = $3`)).
+		WithArgs(models.InvitationAccepted, sqlmock.AnyArg(), sqlmock.AnyArg(), invitation.ID, models.InvitationPending, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	user, err := svc.AcceptInvitation(context.Background(), models.AcceptInviteRequest{Token: token, Password: "s3cure-Passphrase"})
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	if !user.IsActive || user.Role != models.RoleReadOnly {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestAcceptInvitation_RefusesUsedAndExpired(t *testing.T) {
+	svc, mock, _ := newInvitationService(t)
+	find := regexp.QuoteMeta(`FROM invitations WHERE token_hash = $1`)
+	now := time.Now()
+
+	for _, row := range [][]interface{}{
+		{uuid.New(), "a@example.com", "", "", "user", "accepted", nil, uuid.New(), now.Add(time.Hour), now, now},
+		{uuid.New(), "a@example.com", "", "", "user", "pending", nil, nil, now.Add(-time.Minute), now, nil},
+	} {
+		rows := sqlmock.NewRows(invitationRow)
+		rows.AddRow(row[0], row[1], row[2], row[3], row[4], row[5], row[6], row[7], row[8], row[9], row[10])
+		mock.ExpectQuery(find).WillReturnRows(rows)
+		if _, err := svc.AcceptInvitation(context.Background(), models.AcceptInviteRequest{Token: "t", Password: "s3cure-Passphrase"}); !errors.Is(err, apperrors.ErrValidation) {
+			t.Fatalf("%s invitation: want validation error, got %v", row[5], err)
+		}
+	}
+
+	mock.ExpectQuery(find).WillReturnRows(sqlmock.NewRows(invitationRow))
+	if _, err := svc.AcceptInvitation(context.Background(), models.AcceptInviteRequest{Token: "unknown", Password: "s3cure-Passphrase"}); !errors.Is(err, apperrors.ErrValidation) {
+		t.Fatalf("unknown token: want validation error, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestInviteUser_ExistingAccountAndDisabled(t *testing.T) {
+	svc, mock, _ := newInvitationService(t)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, role, is_active FROM auth_users WHERE email = $1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "role", "is_active"}).AddRow(uuid.New(), "user", true))
+	if _, err := svc.InviteUser(context.Background(), models.InviteUserRequest{Email: "taken@example.com"}); !errors.Is(err, apperrors.ErrConflict) {
+		t.Fatalf("want conflict, got %v", err)
+	}
+	if _, err := svc.ListInvitations(context.Background(), "bogus", 10); !errors.Is(err, apperrors.ErrValidation) {
+		t.Fatalf("want validation error for an unknown status, got %v", err)
+	}
+
+	disabled := NewAuthService(nil, nil, logrus.New(), AuthConfig{})
+	if _, err := disabled.InviteUser(context.Background(), models.InviteUserRequest{Email: "a@example.com"}); !errors.Is(err, apperrors.ErrUnavailable) {
+		t.Fatalf("want unavailable without invitations, got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"highload-microservice/internal/cache"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// SetListCache reads the users of ListUsers pages through the cache: the
+// page query returns IDs only, cached users are read in one round trip and
+// the others with one query, then cached for GetUser and later pages
+func (s *UserService) SetListCache(enabled bool) {
+	s.listCache = enabled
+}
+
+// SetListCache reads the events of ListEvents pages through the cache, as
+// UserService.SetListCache does for users
+func (s *EventService) SetListCache(enabled bool) {
+	s.listCache = enabled
+}
+
+// listUsersCached is users.List reading the users of the page through the
+// cache. Deactivated and deleted users are not cached, as GetUser would not
+// return them.
+func (s *UserService) listUsersCached(ctx context.Context, query repository.UserListQuery) (*repository.UserPage, error) {
+	ids, err := s.users.ListIDs(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	users, err := readThrough(ctx, s.loader, "user:", userCacheTTL, ids.IDs, s.users.GetMany,
+		func(user models.User) uuid.UUID { return user.ID },
+		func(user models.User) bool { return user.IsActive && user.DeletedAt == nil })
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+	return &repository.UserPage{Users: users, Total: ids.Total, More: ids.More}, nil
+}
+
+// listEventsCached is events.List reading the events of the page through
+// the cache. Payloads are cached as stored, encrypted or not.
+func (s *EventService) listEventsCached(ctx context.Context, query repository.EventListQuery) (*repository.EventPage, error) {
+	ids, err := s.events.ListIDs(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	events, err := readThrough(ctx, s.loader, "event:", eventCacheTTL, ids.IDs, s.events.GetMany,
+		func(event models.Event) uuid.UUID { return event.ID },
+		func(models.Event) bool { return true })
+	if err != nil {
+		return nil, fmt.Errorf("failed to get events: %w", err)
+	}
+	return &repository.EventPage{Events: events, Total: ids.Total, More: ids.More}, nil
+}
+
+// readThrough returns the entities of ids in their order. Cached entities are
+// read in one round trip and the others with one call of getMany, caching
+// those cacheable reports true for. Entities gone since ids were listed are
+// left out; corrupt entries are read from the database again.
+func readThrough[T any](ctx context.Context, loader *cache.Loader, prefix string, ttl time.Duration, ids []uuid.UUID,
+	getMany func(context.Context, []uuid.UUID) ([]T, error), idOf func(T) uuid.UUID, cacheable func(T) bool) ([]T, error) {
+	keys := make([]string, len(ids))
+	idOfKey := make(map[string]uuid.UUID, len(ids))
+	for i, id := range ids {
+		keys[i] = prefix + id.String()
+		idOfKey[keys[i]] = id
+	}
+
+	found := make(map[uuid.UUID]T, len(ids))
+	load := func(ctx context.Context, missing []string) (map[string]string, error) {
+		missingIDs := make([]uuid.UUID, len(missing))
+		for i, key := range missing {
+			missingIDs[i] = idOfKey[key]
+		}
+		items, err := getMany(ctx, missingIDs)
+		if err != nil {
+			return nil, err
+		}
+		values := make(map[string]string, len(items))
+		for _, item := range items {
+			found[idOf(item)] = item
+			if !cacheable(item) {
+				continue
+			}
+			data, err := json.Marshal(item)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal %s: %w", idOf(item), err)
+			}
+			values[prefix+idOf(item).String()] = string(data)
+		}
+		return values, nil
+	}
+
+	values, err := loader.LoadMany(ctx, keys, ttl, load)
+	if err != nil {
+		return nil, err
+	}
+	var corrupt []string
+	for key, value := range values {
+		id := idOfKey[key]
+		if _, ok := found[id]; ok {
+			continue
+		}
+		var item T
+		if json.Unmarshal([]byte(value), &item) != nil {
+			corrupt = append(corrupt, key)
+			continue
+		}
+		found[id] = item
+	}
+	if len(corrupt) > 0 {
+		if _, err := load(ctx, corrupt); err != nil {
+			return nil, err
+		}
+	}
+
+	items := make([]T, 0, len(ids))
+	for _, id := range ids {
+		if item, ok := found[id]; ok {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LoginThrottleConfig controls per-account login throttling. After FreeAttempts
+// failures within Window each further failure blocks the account for
+// BaseDelay, doubling up to MaxDelay, regardless of the caller's IP.
+type LoginThrottleConfig struct {
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	Window       time.Duration
+}
+
+// LoginThrottledError is returned by AuthenticateUser while an account is throttled
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return "too many login attempts"
+}
+
+func (c LoginThrottleConfig) withDefaults() LoginThrottleConfig {
+	if c.FreeAttempts <= 0 {
+		c.FreeAttempts = 3
+	}
+	if c.BaseDelay <= 0 {
+		c.BaseDelay = time.Second
+	}
+	if c.MaxDelay <= 0 {
+		c.MaxDelay = 15 * time.Minute
+	}
+	if c.Window <= 0 {
+		c.Window = time.Hour
+	}
+	return c
+}
+
+// loginThrottleKeys returns the failure counter and block keys for an email.
+// The email is hashed so that addresses don't end up in cache key listings.
+func loginThrottleKeys(email string) (failures, block string) {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	id := hex.EncodeToString(sum[:])
+	return "login_throttle:failures:" + id, "login_throttle:block:" + id
+}
+
+// checkLoginThrottle returns a LoginThrottledError if the account is currently blocked.
+// Cache errors fail open so that a cache outage doesn't lock everyone out.
+func (s *AuthService) checkLoginThrottle(ctx context.Context, email string) error {
+	if s.counters == nil {
+		return nil
+	}
+
+	_, blockKey := loginThrottleKeys(email)
+	value, err := s.counters.Get(ctx, blockKey)
+	if err != nil {
+		return nil
+	}
+
+	until, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil
+	}
+	if retryAfter := time.Until(time.Unix(0, until)); retryAfter > 0 {
+		return &LoginThrottledError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed attempt and blocks the account with
+// exponential delay once the free attempts are used up
+func (s *AuthService) recordLoginFailure(ctx context.Context, email string) {
+	if s.counters == nil {
+		return
+	}
+
+	cfg := s.config.LoginThrottle.withDefaults()
+	failuresKey, blockKey := loginThrottleKeys(email)
+
+	failures, err := s.counters.Incr(ctx, failuresKey, cfg.Window)
+	if err != nil {
+		s.logger.Warnf("Failed to record login failure: %v", err)
+		return
+	}
+
+	excess := failures - int64(cfg.FreeAttempts)
+	if excess <= 0 {
+		return
+	}
+
+	delay := cfg.MaxDelay
+	if excess <= 30 {
+		if d := cfg.BaseDelay << (excess - 1); d > 0 && d < cfg.MaxDelay {
+			delay = d
+		}
+	}
+
+	until := time.Now().Add(delay).UnixNano()
+	if err := s.counters.Set(ctx, blockKey, strconv.FormatInt(until, 10), delay); err != nil {
+		s.logger.Warnf("Failed to set login throttle: %v", err)
+		return
+	}
+	s.logger.Warnf("Login throttled for %s after %d failed attempts (delay %s)", email, failures, delay)
+}
+
+// resetLoginThrottle clears the failure history after a successful login
+func (s *AuthService) resetLoginThrottle(ctx context.Context, email string) {
+	if s.counters == nil {
+		return
+	}
+
+	failuresKey, blockKey := loginThrottleKeys(email)
+	if err := s.counters.Del(ctx, failuresKey, blockKey); err != nil {
+		s.logger.Warnf("Failed to reset login throttle: %v", err)
+	}
+}
+
+// IsLoginThrottled reports whether err is a LoginThrottledError and returns the retry delay
+func IsLoginThrottled(err error) (time.Duration, bool) {
+	var throttled *LoginThrottledError
+	if errors.As(err, &throttled) {
+		return throttled.RetryAfter, true
+	}
+	return 0, false
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/cache"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/repository"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sirupsen/logrus"
+)
+
+func TestAuthenticateUser_ThrottlesPerAccount(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	counters := cache.NewMemoryCache()
+	cfg := AuthConfig{
+		JWTSecret:     "secret",
+		JWTExpiration: time.Hour,
+		LoginThrottle: LoginThrottleConfig{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour},
+	}
+	svc := NewAuthService(repository.NewPostgresAuthRepository(db), counters, logrus.New(), cfg)
+
+	query := regexp.QuoteMeta(`SELECT id, email, first_name, last_name, role, is_active, created_at, updated_at, password_hash`)
+	req := models.LoginRequest{Email: "victim@example.com", Password: "wrong-password"}
+
+	// Free attempts plus the one that triggers the block all reach the database
+	for i := 0; i < 3; i++ {
+		mock.ExpectQuery(query).WithArgs(req.Email).WillReturnError(sql.ErrNoRows)
+		_, err := svc.AuthenticateUser(context.Background(), req)
+		if err == nil || err.Error() != "invalid credentials" {
+			t.Fatalf("attempt %d: expected invalid credentials, got %v", i+1, err)
+		}
+	}
+
+	// Now throttled without touching the database, whatever the case of the email
+	_, err = svc.AuthenticateUser(context.Background(), models.LoginRequest{Email: "Victim@Example.com", Password: "x"})
+	retryAfter, throttled := IsLoginThrottled(err)
+	if !throttled {
+		t.Fatalf("expected throttled error, got %v", err)
+	}
+	if retryAfter <= 0 || retryAfter > time.Minute {
+		t.Fatalf("unexpected retry after: %s", retryAfter)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestRecordLoginFailure_ExponentialDelay(t *testing.T) {
+	counters := cache.NewMemoryCache()
+	svc := NewAuthService(nil, counters, logrus.New(), AuthConfig{
+		LoginThrottle: LoginThrottleConfig{FreeAttempts: 1, BaseDelay: time.Second, MaxDelay: 5 * time.Second, Window: time.Hour},
+	})
+	ctx := context.Background()
+	email := "a@b.c"
+
+	want := []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+	for i, expected := range want {
+		svc.recordLoginFailure(ctx, email)
+		retryAfter, _ := IsLoginThrottled(svc.checkLoginThrottle(ctx, email))
+		if retryAfter > expected || (expected > 0 && retryAfter < expected-100*time.Millisecond) {
+			t.Fatalf("failure %d: expected delay ~%s, got %s", i+1, expected, retryAfter)
+		}
+	}
+
+	svc.resetLoginThrottle(ctx, email)
+	if err := svc.checkLoginThrottle(ctx, email); err != nil {
+		t.Fatalf("expected throttle to be cleared, got %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/repository"
+)
+
+// revokedTokenKey is the cache key marking an access token as revoked
+func revokedTokenKey(jti string) string {
+	return "token_blacklist:" + jti
+}
+
+// isTokenRevoked reports whether Logout revoked the token with this ID.
+// Cache errors fail open, like login throttling: a cache outage must not
+// sign everyone out.
+func (s *AuthService) isTokenRevoked(ctx context.Context, jti string) bool {
+	if s.counters == nil || jti == "" {
+		return false
+	}
+	_, err := s.counters.Get(ctx, revokedTokenKey(jti))
+	return err == nil
+}
+
+// Logout revokes the access token described by claims until it expires and,
+// if given, the refresh token of the same session. Refresh tokens that are
+// unknown, already rotated or of another user are ignored, so logging out
+// twice is harmless.
+func (s *AuthService) Logout(ctx context.Context, claims *models.JWTClaims, refreshToken string) error {
+	if ttl := time.Until(time.Unix(claims.ExpiresAt, 0)); claims.ID != "" && ttl > 0 {
+		if s.counters == nil {
+			s.logger.Warnf("Access token of user %s stays valid until it expires: no cache for revocation", claims.UserID)
+		} else if err := s.counters.Set(ctx, revokedTokenKey(claims.ID), "1", ttl); err != nil {
+			return apperrors.Wrap(apperrors.ErrUnavailable, "failed to revoke access token", err)
+		}
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+	stored, err := s.lookupRefreshToken(ctx, refreshToken)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		return apperrors.FromDB(err, "failed to revoke refresh token")
+	}
+	if stored.UserID != claims.UserID {
+		s.logger.Warnf("User %s presented a refresh token of user %s on logout", claims.UserID, stored.UserID)
+		return nil
+	}
+	if _, err := s.repo.RevokeRefreshSession(ctx, stored.UserID, stored.FamilyID, time.Now()); err != nil {
+		return apperrors.FromDB(err, "failed to revoke refresh token")
+	}
+	return nil
+}
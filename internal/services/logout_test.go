@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/cache"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/repository"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+func TestLogout_RevokesAccessAndRefreshToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	cfg := AuthConfig{JWTSecret: "secret", JWTExpiration: time.Hour}
+	svc := NewAuthService(repository.NewPostgresAuthRepository(db), cache.NewMemoryCache(), logrus.New(), cfg)
+
+	user := models.AuthUser{ID: uuid.New(), Email: "a@b.c", Role: models.RoleUser}
+	token, err := svc.generateAccessToken(user)
+	if err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	claims, err := svc.ValidateToken(context.Background(), token)
+	if err != nil || claims.ID == "" {
+		t.Fatalf("validate: %+v %v", claims, err)
+	}
+
+	familyID := uuid.New()
+	mock.ExpectQuery(regexp.QuoteMeta(lookupRefreshTokenQuery)).
+		WithArgs(svc.hashAPIKey("refresh")).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow(uuid.New(), user.ID, familyID, time.Now().Add(time.Hour), nil, "", "", time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE refresh_tokens SET revoked_at = $1 WHERE user_id = $2 AND (family_id = $3 OR id = $4)`)).
+		WithArgs(sqlmock.AnyArg(), user.ID, familyID, familyID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := svc.Logout(context.Background(), claims, "refresh"); err != nil {
+		t.Fatalf("logout: %v", err)
+	}
+	if _, err := svc.ValidateToken(context.Background(), token); err == nil {
+		t.Fatalf("expected revoked token to be rejected")
+	}
+
+	// Other tokens of the same user are unaffected
+	other, _ := svc.generateAccessToken(user)
+	if _, err := svc.ValidateToken(context.Background(), other); err != nil {
+		t.Fatalf("other token: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestLogout_IgnoresRefreshTokenOfAnotherUser(t *testing.T) {
+	svc, mock, cleanup := newAuthServiceMock(t)
+	defer cleanup()
+
+	claims := &models.JWTClaims{ID: uuid.NewString(), UserID: uuid.New(), ExpiresAt: time.Now().Add(time.Hour).Unix()}
+	mock.ExpectQuery(regexp.QuoteMeta(lookupRefreshTokenQuery)).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow(uuid.New(), uuid.New(), uuid.New(), time.Now().Add(time.Hour), nil, "", "", time.Now()))
+
+	if err := svc.Logout(context.Background(), claims, "stolen"); err != nil {
+		t.Fatalf("logout: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/events"
+	"highload-microservice/internal/mail"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/repository"
+	"highload-microservice/internal/requestid"
+
+	"github.com/google/uuid"
+)
+
+// ProfileConfig configures email changes made through the profile
+type ProfileConfig struct {
+	ConfirmURL  string // link sent to the new email, the token is appended as ?token=
+	TokenSecret string // signs confirmation tokens
+	TokenTTL    time.Duration
+}
+
+// errInvalidEmailChangeToken is returned for confirmation tokens that are
+// malformed, expired or not signed for the pending email
+var errInvalidEmailChangeToken = apperrors.Validation("invalid or expired confirmation token")
+
+// SetProfile enables email changes in UpdateProfile, sending confirmation
+// links through sender
+func (s *AuthService) SetProfile(sender mail.Sender, cfg ProfileConfig) {
+	if cfg.TokenTTL <= 0 {
+		cfg.TokenTTL = 24 * time.Hour
+	}
+	s.mailer = sender
+	s.profile = &cfg
+}
+
+// SetEventProducer publishes profile_updated events through producer
+func (s *AuthService) SetEventProducer(producer KafkaProducer) {
+	s.events = producer
+}
+
+// GetProfile returns the account of an active user
+func (s *AuthService) GetProfile(ctx context.Context, userID uuid.UUID) (*models.Profile, error) {
+	profile, err := s.repo.GetProfile(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, apperrors.NotFound("user not found")
+		}
+		return nil, apperrors.FromDB(err, "failed to get profile")
+	}
+	return profile, nil
+}
+
+// UpdateProfile changes the user's own names and email. Names change at
+// once; a new email only becomes pending and a link to confirm it is sent
+// to it. Setting the email back to the current one cancels a pending change.
+func (s *AuthService) UpdateProfile(ctx context.Context, userID uuid.UUID, req models.UpdateUserRequest) (*models.Profile, error) {
+	profile, err := s.GetProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	before := *profile
+
+	if req.FirstName != nil {
+		profile.FirstName = *req.FirstName
+	}
+	if req.LastName != nil {
+		profile.LastName = *req.LastName
+	}
+	requested := ""
+	if req.Email != nil {
+		email := strings.TrimSpace(*req.Email)
+		switch {
+		case strings.EqualFold(email, profile.Email):
+			profile.PendingEmail = ""
+		case s.profile == nil:
+			return nil, apperrors.New(apperrors.ErrUnavailable, "email changes are not enabled")
+		default:
+			if _, err := s.repo.FindAccount(ctx, email); err == nil {
+				return nil, apperrors.Conflict("user with this email already exists")
+			} else if !errors.Is(err, repository.ErrNotFound) {
+				return nil, apperrors.FromDB(err, "failed to get user")
+			}
+			profile.PendingEmail = email
+			requested = email
+		}
+	}
+	if profile.FirstName == before.FirstName && profile.LastName == before.LastName && profile.PendingEmail == before.PendingEmail && requested == "" {
+		return profile, nil
+	}
+
+	now := time.Now()
+	profile.UpdatedAt = now
+	if err := s.repo.UpdateProfile(ctx, profile, now); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, apperrors.NotFound("user not found")
+		}
+		return nil, apperrors.FromDB(err, "failed to update profile")
+	}
+
+	if requested != "" {
+		token := signAccountToken(s.profile.TokenSecret, "email_change", userID, requested, now.Add(s.profile.TokenTTL))
+		go s.sendEmailChange(requested, token)
+	}
+	s.publishProfileUpdated(ctx, &before, profile)
+
+	s.logger.Infof("Profile updated: %s", userID)
+	return profile, nil
+}
+
+// ConfirmEmailChange applies the pending email a confirmation token was
+// issued for. Requesting another email since invalidates the token.
+func (s *AuthService) ConfirmEmailChange(ctx context.Context, token string) (*models.Profile, error) {
+	if s.profile == nil {
+		return nil, apperrors.New(apperrors.ErrUnavailable, "email changes are not enabled")
+	}
+	userID, expiresAt, err := parseAccountToken(token)
+	if err != nil || time.Now().After(expiresAt) {
+		return nil, errInvalidEmailChangeToken
+	}
+
+	profile, err := s.repo.GetProfile(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errInvalidEmailChangeToken
+		}
+		return nil, apperrors.FromDB(err, "failed to get profile")
+	}
+	expected := signAccountToken(s.profile.TokenSecret, "email_change", userID, profile.PendingEmail, expiresAt)
+	if profile.PendingEmail == "" || !hmac.Equal([]byte(token), []byte(expected)) {
+		return nil, errInvalidEmailChangeToken
+	}
+
+	now := time.Now()
+	confirmed, err := s.repo.ConfirmEmailChange(ctx, userID, profile.PendingEmail, now)
+	if err != nil {
+		if apperrors.IsUniqueViolation(err) {
+			return nil, apperrors.Conflict("user with this email already exists")
+		}
+		return nil, apperrors.FromDB(err, "failed to change email")
+	}
+	if !confirmed {
+		return nil, errInvalidEmailChangeToken
+	}
+
+	before := *profile
+	profile.Email, profile.PendingEmail, profile.UpdatedAt = profile.PendingEmail, "", now
+	s.publishProfileUpdated(ctx, &before, profile)
+
+	s.logger.Infof("Email changed: %s", userID)
+	return profile, nil
+}
+
+// profileUpdatedEvent is the payload of profile_updated
+type profileUpdatedEvent struct {
+	Email     string   `json:"email"`
+	FirstName string   `json:"first_name"`
+	LastName  string   `json:"last_name"`
+	Changed   []string `json:"changed"`
+}
+
+// publishProfileUpdated emits profile_updated when the email or a name of
+// the profile changed; a pending email alone is not a change
+func (s *AuthService) publishProfileUpdated(ctx context.Context, before, after *models.Profile) {
+	var changed []string
+	if before.Email != after.Email {
+		changed = append(changed, "email")
+	}
+	if before.FirstName != after.FirstName {
+		changed = append(changed, "first_name")
+	}
+	if before.LastName != after.LastName {
+		changed = append(changed, "last_name")
+	}
+	if s.events == nil || len(changed) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(profileUpdatedEvent{Email: after.Email, FirstName: after.FirstName, LastName: after.LastName, Changed: changed})
+	if err != nil {
+		s.logger.Errorf("Failed to marshal profile update event: %v", err)
+		return
+	}
+	event := models.KafkaEvent{
+		ID:        uuid.New(),
+		UserID:    after.ID,
+		Type:      "profile_updated",
+		Version:   events.CurrentVersion("profile_updated"),
+		Data:      string(data),
+		Timestamp: time.Now(),
+		RequestID: requestid.FromContext(ctx),
+	}
+	if err := s.events.SendEvent(ctx, event); err != nil {
+		s.logger.Errorf("Failed to send profile update event: %v", err)
+	}
+}
+
+// sendEmailChange emails the link confirming a new email
+func (s *AuthService) sendEmailChange(email, token string) {
+	link, err := tokenLink(s.profile.ConfirmURL, token)
+	if err != nil {
+		s.logger.Errorf("Invalid email change URL: %v", err)
+		return
+	}
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "Confirm your new email address:\n\n%s\n\n", link)
+	fmt.Fprintf(&body, "The link expires in %s. If you didn't ask for this change, ignore this email.\n", s.profile.TokenTTL)
+	s.sendAccountEmail(mail.Message{To: []string{email}, Subject: "Confirm your new email address", Body: body.String()})
+}
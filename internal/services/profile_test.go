@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/mail"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/repository"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+var profileRow = []string{"id", "email", "first_name", "last_name", "role", "is_active", "created_at", "updated_at", "pending_email"}
+
+func newProfileService(t *testing.T) (*AuthService, sqlmock.Sqlmock, outbox, *recordingProducer) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	svc := NewAuthService(repository.NewPostgresAuthRepository(db), nil, logrus.New(), AuthConfig{JWTSecret: "secret"})
+	sent := make(outbox, 1)
+	svc.SetProfile(sent, ProfileConfig{ConfirmURL: "https://app.example.com/confirm-email", TokenSecret: "profile-secret", TokenTTL: time.Hour})
+	producer := &recordingProducer{}
+	svc.SetEventProducer(producer)
+	return svc, mock, sent, producer
+}
+
+func TestUpdateProfile_EmailChangeWaitsForConfirmation(t *testing.T) {
+	svc, mock, sent, producer := newProfileService(t)
+	id := uuid.New()
+	get := regexp.QuoteMeta(`SELECT id, email, first_name, last_name, role, is_active, created_at, updated_at, pending_email FROM auth_users WHERE id = $1`)
+	update := regexp.QuoteMeta(`UPDATE auth_users SET first_name = $1, last_name = $2, pending_email = NULLIF($3, '')`)
+	now := time.Now()
+
+	mock.ExpectQuery(get).WithArgs(id).
+		WillReturnRows(sqlmock.NewRows(profileRow).AddRow(id, "old@example.com", "Old", "Name", "user", true, now, now, nil))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, role, is_active FROM auth_users WHERE email = $1`)).
+		WithArgs("new@example.com").WillReturnRows(sqlmock.NewRows([]string{"id", "role", "is_active"}))
+	mock.ExpectExec(update).WithArgs("New", "Name", "new@example.com", sqlmock.AnyArg(), id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	first, email := "New", "new@example.com"
+	profile, err := svc.UpdateProfile(context.Background(), id, models.UpdateUserRequest{Email: &email, FirstName: &first})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if profile.Email != "old@example.com" || profile.PendingEmail != "new@example.com" || profile.FirstName != "New" {
+		t.Fatalf("unexpected profile: %+v", profile)
+	}
+
+	// Only the name change is published; the email hasn't changed yet
+	if len(producer.events) != 1 || producer.events[0].Type != "profile_updated" {
+		t.Fatalf("want one profile_updated event, got %+v", producer.events)
+	}
+	var payload profileUpdatedEvent
+	if err := json.Unmarshal([]byte(producer.events[0].Data), &payload); err != nil || payload.Email != "old@example.com" ||
+		len(payload.Changed) != 1 || payload.Changed[0] != "first_name" {
+		t.Fatalf("unexpected payload %s: %v", producer.events[0].Data, err)
+	}
+
+	var msg mail.Message
+	select {
+	case msg = <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("no confirmation email sent")
+	}
+	start := strings.Index(msg.Body, "https://app.example.com/confirm-email?token=")
+	if start < 0 || msg.To[0] != "new@example.com" {
+		t.Fatalf("unexpected email to %v: %q", msg.To, msg.Body)
+	}
+	link, _ := url.Parse(strings.Fields(msg.Body[start:])[0])
+	token := link.Query().Get("token")
+
+	confirm := regexp.QuoteMeta(`UPDATE auth_users SET email = pending_email, pending_email = NULL`)
+	mock.ExpectQuery(get).WithArgs(id).
+		WillReturnRows(sqlmock.NewRows(profileRow).AddRow(id, "old@example.com", "New", "Name", "user", true, now, now, "new@example.com"))
+	mock.ExpectExec(confirm).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), id, "new@example.com").WillReturnResult(sqlmock.NewResult(0, 1))
+	profile, err = svc.ConfirmEmailChange(context.Background(), token)
+	if err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	if profile.Email != "new@example.com" || profile.PendingEmail != "" {
+		t.Fatalf("unexpected profile: %+v", profile)
+	}
+	if len(producer.events) != 2 || !strings.Contains(producer.events[1].Data, `"changed":["email"]`) {
+		t.Fatalf("want an email profile_updated event, got %+v", producer.events)
+	}
+
+	// Requesting another email since invalidates the link
+	mock.ExpectQuery(get).WithArgs(id).
+		WillReturnRows(sqlmock.NewRows(profileRow).AddRow(id, "old@example.com", "New", "Name", "user", true, now, now, "other@example.com"))
+	if _, err := svc.ConfirmEmailChange(context.Background(), token); !errors.Is(err, apperrors.ErrValidation) {
+		t.Fatalf("superseded token: want validation error, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestUpdateProfile_RefusesTakenEmailAndForgedTokens(t *testing.T) {
+	svc, mock, _, producer := newProfileService(t)
+	id := uuid.New()
+	now := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM auth_users WHERE id = $1 AND is_active = true`)).
+		WillReturnRows(sqlmock.NewRows(profileRow).AddRow(id, "old@example.com", "Old", "Name", "user", true, now, now, nil))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, role, is_active FROM auth_users WHERE email = $1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "role", "is_active"}).AddRow(uuid.New(), "user", true))
+	email := "taken@example.com"
+	if _, err := svc.UpdateProfile(context.Background(), id, models.UpdateUserRequest{Email: &email}); !errors.Is(err, apperrors.ErrConflict) {
+		t.Fatalf("want conflict, got %v", err)
+	}
+
+	forged := signAccountToken("other", "email_change", id, "new@example.com", now.Add(time.Hour))
+	verification := signAccountToken("profile-secret", "email_verification", id, "new@example.com", now.Add(time.Hour))
+	for name, token := range map[string]string{"forged": forged, "other purpose": verification} {
+		mock.ExpectQuery(regexp.QuoteMeta(`FROM auth_users WHERE id = $1 AND is_active = true`)).
+			WillReturnRows(sqlmock.NewRows(profileRow).AddRow(id, "old@example.com", "Old", "Name", "user", true, now, now, "new@example.com"))
+		if _, err := svc.ConfirmEmailChange(context.Background(), token); !errors.Is(err, apperrors.ErrValidation) {
+			t.Errorf("%s: want validation error, got %v", name, err)
+		}
+	}
+	if len(producer.events) != 0 {
+		t.Fatalf("unexpected events: %+v", producer.events)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
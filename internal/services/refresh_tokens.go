@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// RefreshTokenReuseError is returned by RefreshToken when a rotated (revoked)
+// refresh token is presented again. The token's whole family has been revoked.
+type RefreshTokenReuseError struct {
+	UserID   uuid.UUID
+	FamilyID uuid.UUID
+}
+
+func (e *RefreshTokenReuseError) Error() string {
+	return "refresh token reuse detected"
+}
+
+// Is makes reuse errors match apperrors.ErrUnauthorized
+func (e *RefreshTokenReuseError) Is(target error) bool {
+	return target == apperrors.ErrUnauthorized
+}
+
+// IsRefreshTokenReuse reports whether err is a RefreshTokenReuseError
+func IsRefreshTokenReuse(err error) (*RefreshTokenReuseError, bool) {
+	var reuse *RefreshTokenReuseError
+	if errors.As(err, &reuse) {
+		return reuse, true
+	}
+	return nil, false
+}
+
+// storeRefreshToken adds a token to the family of session. Tokens issued by
+// one login share a family and its session metadata; rotation revokes the old
+// token and adds a new one to it.
+func (s *AuthService) storeRefreshToken(ctx context.Context, token string, session repository.RefreshToken) error {
+	now := time.Now()
+	return s.repo.CreateRefreshToken(ctx, &repository.RefreshToken{
+		UserID:    session.UserID,
+		TokenHash: s.hashAPIKey(token), // Reuse hash function
+		FamilyID:  session.FamilyID,
+		ExpiresAt: now.Add(s.config.RefreshExpiration),
+		CreatedAt: now,
+		UserAgent: session.UserAgent,
+		IPAddress: session.IPAddress,
+		LoginAt:   session.LoginAt,
+	})
+}
+
+// newSession describes a session started by a login from the client in ctx
+func newSession(ctx context.Context, userID uuid.UUID) repository.RefreshToken {
+	client := ClientInfoFrom(ctx)
+	return repository.RefreshToken{
+		UserID:    userID,
+		FamilyID:  uuid.New(),
+		UserAgent: client.UserAgent,
+		IPAddress: client.IPAddress,
+		LoginAt:   time.Now(),
+	}
+}
+
+// lookupRefreshToken finds a refresh token by value
+func (s *AuthService) lookupRefreshToken(ctx context.Context, token string) (*repository.RefreshToken, error) {
+	return s.repo.FindRefreshToken(ctx, s.hashAPIKey(token))
+}
+
+// handleRefreshTokenReuse revokes every token in the family of a reused token
+func (s *AuthService) handleRefreshTokenReuse(ctx context.Context, stored *repository.RefreshToken) error {
+	s.logger.Warnf("Refresh token reuse detected for user %s, revoking token family %s", stored.UserID, stored.FamilyID)
+
+	if err := s.repo.RevokeRefreshTokenFamily(ctx, stored.FamilyID, time.Now()); err != nil {
+		s.logger.Errorf("Failed to revoke refresh token family %s: %v", stored.FamilyID, err)
+	}
+
+	return &RefreshTokenReuseError{UserID: stored.UserID, FamilyID: stored.FamilyID}
+}
+
+// RevokeAllSessions revokes every active refresh token of a user and returns
+// how many were revoked. Access tokens stay valid until they expire.
+func (s *AuthService) RevokeAllSessions(ctx context.Context, userID uuid.UUID) (int64, error) {
+	n, err := s.repo.RevokeUserRefreshTokens(ctx, userID, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	s.logger.Infof("Revoked %d sessions for user %s", n, userID)
+	return n, nil
+}
+
+// ListSessions returns the current sessions of a user, most recently used
+// first
+func (s *AuthService) ListSessions(ctx context.Context, userID uuid.UUID) ([]models.Session, error) {
+	sessions, err := s.repo.ListRefreshSessions(ctx, userID, time.Now())
+	if err != nil {
+		return nil, apperrors.FromDB(err, "failed to list sessions")
+	}
+	return sessions, nil
+}
+
+// RevokeSession revokes one session of a user. Sessions of other users are
+// reported as not found.
+func (s *AuthService) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	revoked, err := s.repo.RevokeRefreshSession(ctx, userID, sessionID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if !revoked {
+		return apperrors.NotFound("session not found")
+	}
+
+	s.logger.Infof("Revoked session %s for user %s", sessionID, userID)
+	return nil
+}
+
+// DeleteExpiredRefreshTokens removes refresh tokens past their expiry. They
+// can no longer be used, and reuse detection only matters for live families.
+func (s *AuthService) DeleteExpiredRefreshTokens(ctx context.Context) (int64, error) {
+	n, err := s.repo.DeleteRefreshTokensExpiredBefore(ctx, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired refresh tokens: %w", err)
+	}
+	if n > 0 {
+		s.logger.Infof("Deleted %d expired refresh tokens", n)
+	}
+	return n, nil
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var refreshTokenColumns = []string{"id", "user_id", "family_id", "expires_at", "revoked_at", "user_agent", "ip_address", "login_at"}
+
+const lookupRefreshTokenQuery = `SELECT id, user_id, COALESCE(family_id, id), expires_at, revoked_at, user_agent, ip_address, COALESCE(login_at, created_at) FROM refresh_tokens WHERE token_hash = $1`
+
+func TestRefreshToken_ReuseRevokesFamily(t *testing.T) {
+	svc, mock, cleanup := newAuthServiceMock(t)
+	defer cleanup()
+
+	uid, tokenID, familyID := uuid.New(), uuid.New(), uuid.New()
+	mock.ExpectQuery(regexp.QuoteMeta(lookupRefreshTokenQuery)).
+		WithArgs(svc.hashAPIKey("rotated")).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow(tokenID, uid, familyID, time.Now().Add(time.Hour), time.Now().Add(-time.Minute), "", "", time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE refresh_tokens SET revoked_at = $1 WHERE (family_id = $2 OR id = $3) AND revoked_at IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), familyID, familyID).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	_, err := svc.RefreshToken(context.Background(), models.RefreshTokenRequest{RefreshToken: "rotated"})
+	reuse, ok := IsRefreshTokenReuse(err)
+	if !ok || reuse.UserID != uid || reuse.FamilyID != familyID {
+		t.Fatalf("expected reuse error, got %v", err)
+	}
+	if !errors.Is(err, apperrors.ErrUnauthorized) {
+		t.Fatalf("reuse error should be unauthorized")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestRefreshToken_ConcurrentRotationIsReuse(t *testing.T) {
+	svc, mock, cleanup := newAuthServiceMock(t)
+	defer cleanup()
+
+	uid, tokenID, familyID := uuid.New(), uuid.New(), uuid.New()
+	mock.ExpectQuery(regexp.QuoteMeta(lookupRefreshTokenQuery)).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow(tokenID, uid, familyID, time.Now().Add(time.Hour), nil, "", "", time.Now()))
+	// Another request rotated the token first
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE refresh_tokens SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), tokenID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE refresh_tokens SET revoked_at = $1 WHERE (family_id = $2 OR id = $3)`)).
+		WithArgs(sqlmock.AnyArg(), familyID, familyID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	_, err := svc.RefreshToken(context.Background(), models.RefreshTokenRequest{RefreshToken: "raced"})
+	if _, ok := IsRefreshTokenReuse(err); !ok {
+		t.Fatalf("expected reuse error, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestRevokeAllSessions(t *testing.T) {
+	svc, mock, cleanup := newAuthServiceMock(t)
+	defer cleanup()
+
+	uid := uuid.New()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE refresh_tokens SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), uid).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	n, err := svc.RevokeAllSessions(context.Background(), uid)
+	if err != nil || n != 3 {
+		t.Fatalf("want 3 revoked, got %d (%v)", n, err)
+	}
+}
+
+func TestDeleteExpiredRefreshTokens(t *testing.T) {
+	svc, mock, cleanup := newAuthServiceMock(t)
+	defer cleanup()
+
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM refresh_tokens WHERE expires_at < $1`)).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 5))
+
+	n, err := svc.DeleteExpiredRefreshTokens(context.Background())
+	if err != nil || n != 5 {
+		t.Fatalf("want 5 deleted, got %d (%v)", n, err)
+	}
+}
+
+func TestListSessions(t *testing.T) {
+	svc, mock, cleanup := newAuthServiceMock(t)
+	defer cleanup()
+
+	uid, familyID := uuid.New(), uuid.New()
+	loginAt := time.Now().Add(-time.Hour)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(family_id, id), user_agent, ip_address, COALESCE(login_at, created_at), created_at, expires_at`)).
+		WithArgs(uid, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"family_id", "user_agent", "ip_address", "login_at", "created_at", "expires_at"}).
+			AddRow(familyID, "curl/8.0", "10.0.0.1", loginAt, time.Now(), time.Now().Add(time.Hour)))
+
+	sessions, err := svc.ListSessions(context.Background(), uid)
+	if err != nil {
+		t.Fatalf("list sessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != familyID || sessions[0].UserAgent != "curl/8.0" || !sessions[0].CreatedAt.Equal(loginAt) {
+		t.Fatalf("unexpected sessions: %+v", sessions)
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	svc, mock, cleanup := newAuthServiceMock(t)
+	defer cleanup()
+
+	uid, familyID := uuid.New(), uuid.New()
+	const query = `UPDATE refresh_tokens SET revoked_at = $1 WHERE user_id = $2 AND (family_id = $3 OR id = $4) AND revoked_at IS NULL`
+	mock.ExpectExec(regexp.QuoteMeta(query)).
+		WithArgs(sqlmock.AnyArg(), uid, familyID, familyID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := svc.RevokeSession(context.Background(), uid, familyID); err != nil {
+		t.Fatalf("revoke session: %v", err)
+	}
+
+	// Another user's session, or one already revoked
+	mock.ExpectExec(regexp.QuoteMeta(query)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := svc.RevokeSession(context.Background(), uid, uuid.New()); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Fatalf("want not found, got %v", err)
+	}
+}
+
+func TestAuthenticateUser_RecordsClient(t *testing.T) {
+	svc, mock, cleanup := newAuthServiceMock(t)
+	defer cleanup()
+
+	uid := uuid.New()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("admin123456"), bcrypt.MinCost)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, email, first_name, last_name, role, is_active, created_at, updated_at, password_hash, failed_login_attempts, locked_until`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "first_name", "last_name", "role", "is_active", "created_at", "updated_at", "password_hash", "failed_login_attempts", "locked_until"}).
+			AddRow(uid, "admin@local", "Admin", "User", "admin", true, time.Now(), time.Now(), string(hash), 0, nil))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at, created_at, user_agent, ip_address, login_at)`)).
+		WithArgs(uid, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "Firefox", "10.0.0.2", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	ctx := WithClientInfo(context.Background(), ClientInfo{IPAddress: "10.0.0.2", UserAgent: "Firefox"})
+	if _, err := svc.AuthenticateUser(ctx, models.LoginRequest{Email: "admin@local", Password: "admin123456"}); err != nil {
+		t.Fatalf("auth: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/mail"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/password"
+	"highload-microservice/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// RegistrationConfig configures self-registration
+type RegistrationConfig struct {
+	VerifyURL   string // link sent by email, the token is appended as ?token=
+	TokenSecret string // signs verification tokens
+	TokenTTL    time.Duration
+	MaxPerIP    int // registration attempts per client IP and hour; 0 means no limit
+}
+
+// RegistrationThrottledError is returned by Register when the client IP has
+// used up its attempts for the hour
+type RegistrationThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RegistrationThrottledError) Error() string {
+	return "too many registration attempts"
+}
+
+// IsRegistrationThrottled reports whether err is a RegistrationThrottledError
+// and returns the retry delay
+func IsRegistrationThrottled(err error) (time.Duration, bool) {
+	var throttled *RegistrationThrottledError
+	if errors.As(err, &throttled) {
+		return throttled.RetryAfter, true
+	}
+	return 0, false
+}
+
+// errInvalidVerificationToken is returned for tokens that are malformed,
+// expired or not signed for the account's email
+var errInvalidVerificationToken = apperrors.Validation("invalid or expired verification token")
+
+// accountEmailTimeout bounds the delivery of a verification or invitation
+// email
+const accountEmailTimeout = 30 * time.Second
+
+// SetRegistration enables Register and VerifyEmail, sending verification
+// links through sender
+func (s *AuthService) SetRegistration(sender mail.Sender, cfg RegistrationConfig) {
+	if cfg.TokenTTL <= 0 {
+		cfg.TokenTTL = 24 * time.Hour
+	}
+	s.mailer = sender
+	s.registration = &cfg
+}
+
+// Register creates an inactive account and emails it a verification link.
+// The email is sent in the background so that the response time doesn't
+// tell whether the address was already taken.
+func (s *AuthService) Register(ctx context.Context, req models.RegisterRequest) (*models.AuthUser, error) {
+	if s.registration == nil {
+		return nil, apperrors.New(apperrors.ErrUnavailable, "registration is not enabled")
+	}
+	if err := s.checkRegistrationThrottle(ctx, ClientInfoFrom(ctx).IPAddress); err != nil {
+		return nil, err
+	}
+
+	email := strings.TrimSpace(req.Email)
+	hash, err := s.hashPassword(req.Password, password.UserInfo{Email: email, FirstName: req.FirstName, LastName: req.LastName})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user := models.AuthUser{
+		ID:        uuid.New(),
+		Email:     email,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Role:      models.RoleUser,
+		IsActive:  false,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.repo.CreateUser(ctx, &user, hash); err != nil {
+		if apperrors.IsUniqueViolation(err) {
+			return nil, apperrors.Conflict("user with this email already exists")
+		}
+		return nil, apperrors.FromDB(err, "failed to create user")
+	}
+
+	token := s.verificationToken(user.ID, user.Email, now.Add(s.registration.TokenTTL))
+	go s.sendVerification(user.Email, token)
+
+	s.logger.Infof("User registered, awaiting email verification: %s", user.ID)
+	return &user, nil
+}
+
+// VerifyEmail activates the account a verification token was issued for.
+// A token activates an account only once: accounts deactivated later stay
+// deactivated.
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) (uuid.UUID, error) {
+	if s.registration == nil {
+		return uuid.Nil, apperrors.New(apperrors.ErrUnavailable, "registration is not enabled")
+	}
+	userID, expiresAt, err := parseAccountToken(token)
+	if err != nil || time.Now().After(expiresAt) {
+		return uuid.Nil, errInvalidVerificationToken
+	}
+
+	account, err := s.repo.GetAccount(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return uuid.Nil, errInvalidVerificationToken
+		}
+		return uuid.Nil, apperrors.FromDB(err, "failed to get user")
+	}
+	if !hmac.Equal([]byte(token), []byte(s.verificationToken(userID, account.Email, expiresAt))) {
+		return uuid.Nil, errInvalidVerificationToken
+	}
+
+	verified, err := s.repo.VerifyEmail(ctx, userID, time.Now())
+	if err != nil {
+		return uuid.Nil, apperrors.FromDB(err, "failed to verify email")
+	}
+	if !verified {
+		return uuid.Nil, apperrors.Conflict("email already verified")
+	}
+
+	s.logger.Infof("Email verified, account activated: %s", userID)
+	return userID, nil
+}
+
+// verificationToken signs the account ID and expiry together with the email,
+// so a token stops working if the account's email changes
+func (s *AuthService) verificationToken(userID uuid.UUID, email string, expiresAt time.Time) string {
+	return signAccountToken(s.registration.TokenSecret, "email_verification", userID, email, expiresAt)
+}
+
+// signAccountToken signs the account ID and expiry together with an email
+// for purpose; tokens of one purpose are not valid for another
+func signAccountToken(secret, purpose string, userID uuid.UUID, email string, expiresAt time.Time) string {
+	payload := make([]byte, 0, 24)
+	payload = append(payload, userID[:]...)
+	payload = binary.BigEndian.AppendUint64(payload, uint64(expiresAt.Unix()))
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose + "\x00"))
+	mac.Write(payload)
+	mac.Write([]byte(strings.ToLower(email)))
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseAccountToken returns the account ID and expiry of a token without
+// checking its signature
+func parseAccountToken(token string) (uuid.UUID, time.Time, error) {
+	encoded, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return uuid.Nil, time.Time{}, errors.New("malformed token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(payload) != 24 {
+		return uuid.Nil, time.Time{}, errors.New("malformed token")
+	}
+	userID, _ := uuid.FromBytes(payload[:16])
+	expiresAt := time.Unix(int64(binary.BigEndian.Uint64(payload[16:])), 0)
+	return userID, expiresAt, nil
+}
+
+// sendVerification emails the verification link
+func (s *AuthService) sendVerification(email, token string) {
+	link, err := tokenLink(s.registration.VerifyURL, token)
+	if err != nil {
+		s.logger.Errorf("Invalid verification URL: %v", err)
+		return
+	}
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "Confirm your email address to activate your account:\n\n%s\n\n", link)
+	fmt.Fprintf(&body, "The link expires in %s. If you didn't sign up, ignore this email.\n", s.registration.TokenTTL)
+	s.sendAccountEmail(mail.Message{To: []string{email}, Subject: "Verify your email address", Body: body.String()})
+}
+
+// sendAccountEmail sends msg within accountEmailTimeout; failures are only
+// logged
+func (s *AuthService) sendAccountEmail(msg mail.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), accountEmailTimeout)
+	defer cancel()
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		s.logger.Errorf("Failed to send %q email: %v", msg.Subject, err)
+	}
+}
+
+// tokenLink appends token to base as the token query parameter
+func tokenLink(base, token string) (string, error) {
+	link, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
+
+// registrationKey counts the attempts of ip in the hour of t
+func registrationKey(ip string, t time.Time) string {
+	return fmt.Sprintf("registration:%s:%d", ip, t.Unix()/3600)
+}
+
+// checkRegistrationThrottle counts an attempt of ip and refuses it beyond
+// MaxPerIP in the current hour. Cache errors fail open.
+func (s *AuthService) checkRegistrationThrottle(ctx context.Context, ip string) error {
+	if s.counters == nil || s.registration.MaxPerIP <= 0 || ip == "" {
+		return nil
+	}
+	now := time.Now()
+	attempts, err := s.counters.Incr(ctx, registrationKey(ip, now), time.Hour)
+	if err != nil {
+		s.logger.Warnf("Failed to count registration attempt: %v", err)
+		return nil
+	}
+	if attempts <= int64(s.registration.MaxPerIP) {
+		return nil
+	}
+	nextHour := now.Truncate(time.Hour).Add(time.Hour)
+	return &RegistrationThrottledError{RetryAfter: nextHour.Sub(now)}
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/cache"
+	"highload-microservice/internal/mail"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/repository"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sirupsen/logrus"
+)
+
+// outbox is a mail.Sender handing messages to the test
+type outbox chan mail.Message
+
+func (o outbox) Send(_ context.Context, msg mail.Message) error {
+	o <- msg
+	return nil
+}
+
+func newRegistrationService(t *testing.T, maxPerIP int) (*AuthService, sqlmock.Sqlmock, outbox) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	svc := NewAuthService(repository.NewPostgresAuthRepository(db), cache.NewMemoryCache(), logrus.New(), AuthConfig{JWTSecret: "secret"})
+	sent := make(outbox, 1)
+	svc.SetRegistration(sent, RegistrationConfig{
+		VerifyURL:   "https://app.example.com/verify",
+		TokenSecret: "registration-secret",
+		TokenTTL:    time.Hour,
+		MaxPerIP:    maxPerIP,
+	})
+	return svc, mock, sent
+}
+
+func TestRegister_SendsVerificationLinkThatActivates(t *testing.T) {
+	svc, mock, sent := newRegistrationService(t, 0)
+	insert := regexp.QuoteMeta(`INSERT INTO auth_users (id, email, first_name, last_name, password_hash, role, is_active, created_at, updated_at)`)
+
+	mock.ExpectExec(insert).
+		WithArgs(sqlmock.AnyArg(), "new@example.com", "New", "User", sqlmock.AnyArg(), models.RoleUser, false, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	user, err := svc.Register(context.Background(), models.RegisterRequest{
+		Email: "new@example.com", Password: "s3cure-Passphrase", FirstName: "New", LastName: "User",
+	})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if user.IsActive || user.Role != models.RoleUser {
+		t.Fatalf("registered user must be an inactive user: %+v", user)
+	}
+
+	var msg mail.Message
+	select {
+	case msg = <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("no verification email sent")
+	}
+	if len(msg.To) != 1 || msg.To[0] != "new@example.com" {
+		t.Fatalf("sent to %v", msg.To)
+	}
+	start := strings.Index(msg.Body, "https://app.example.com/verify?token=")
+	if start < 0 {
+		t.Fatalf("no verification link in %q", msg.Body)
+	}
+	link, err := url.Parse(strings.Fields(msg.Body[start:])[0])
+	if err != nil {
+		t.Fatalf("link: %v", err)
+	}
+	token := link.Query().Get("token")
+
+	account := regexp.QuoteMeta(`SELECT email, role, is_active FROM auth_users WHERE id = $1`)
+	verify := regexp.QuoteMeta(`UPDATE auth_users SET is_active = true, email_verified_at = $1`)
+	mock.ExpectQuery(account).WithArgs(user.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "role", "is_active"}).AddRow("new@example.com", "user", false))
+	mock.ExpectExec(verify).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), user.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	if id, err := svc.VerifyEmail(context.Background(), token); err != nil || id != user.ID {
+		t.Fatalf("verify: %v, %v", id, err)
+	}
+
+	// A second use doesn't reactivate an account deactivated since
+	mock.ExpectQuery(account).WithArgs(user.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "role", "is_active"}).AddRow("new@example.com", "user", false))
+	mock.ExpectExec(verify).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), user.ID).WillReturnResult(sqlmock.NewResult(0, 0))
+	if _, err := svc.VerifyEmail(context.Background(), token); !errors.Is(err, apperrors.ErrConflict) {
+		t.Fatalf("reused token: want conflict, got %v", err)
+	}
+
+	// The token is bound to the email it was sent to
+	mock.ExpectQuery(account).WithArgs(user.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "role", "is_active"}).AddRow("changed@example.com", "user", false))
+	if _, err := svc.VerifyEmail(context.Background(), token); !errors.Is(err, apperrors.ErrValidation) {
+		t.Fatalf("changed email: want validation error, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestVerifyEmail_RejectsForgedAndExpiredTokens(t *testing.T) {
+	svc, mock, _ := newRegistrationService(t, 0)
+	user := models.AuthUser{Email: "new@example.com"}
+
+	expired := svc.verificationToken(user.ID, user.Email, time.Now().Add(-time.Minute))
+	forged := (&AuthService{registration: &RegistrationConfig{TokenSecret: "other"}}).verificationToken(user.ID, user.Email, time.Now().Add(time.Hour))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT email, role, is_active FROM auth_users`)).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "role", "is_active"}).AddRow(user.Email, "user", false))
+
+	for name, token := range map[string]string{"garbage": "not-a-token", "expired": expired, "forged": forged} {
+		if _, err := svc.VerifyEmail(context.Background(), token); !errors.Is(err, apperrors.ErrValidation) {
+			t.Errorf("%s: want validation error, got %v", name, err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestRegister_ThrottlesPerIPAndRequiresSetup(t *testing.T) {
+	svc, mock, _ := newRegistrationService(t, 1)
+	ctx := WithClientInfo(context.Background(), ClientInfo{IPAddress: "203.0.113.7"})
+
+	// The policy violation still counts as an attempt
+	if _, err := svc.Register(ctx, models.RegisterRequest{Email: "new@example.com", Password: "short"}); !errors.Is(err, apperrors.ErrValidation) {
+		t.Fatalf("want validation error, got %v", err)
+	}
+	_, err := svc.Register(ctx, models.RegisterRequest{Email: "new@example.com", Password: "s3cure-Passphrase"})
+	if retryAfter, throttled := IsRegistrationThrottled(err); !throttled || retryAfter <= 0 || retryAfter > time.Hour {
+		t.Fatalf("want throttled within the hour, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+
+	disabled := NewAuthService(nil, nil, logrus.New(), AuthConfig{})
+	if _, err := disabled.Register(ctx, models.RegisterRequest{}); !errors.Is(err, apperrors.ErrUnavailable) {
+		t.Fatalf("want unavailable without registration, got %v", err)
+	}
+}
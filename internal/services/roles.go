@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/rbac"
+	"highload-microservice/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// RoleChange describes the outcome of UpdateUserRole
+type RoleChange struct {
+	UserID   uuid.UUID       `json:"id"`
+	Previous models.UserRole `json:"previous_role"`
+	Role     models.UserRole `json:"role"`
+	// Escalation is set when the new role grants permissions the previous
+	// one did not
+	Escalation bool `json:"-"`
+}
+
+// Permissions returns the role permission matrix
+func (s *AuthService) Permissions() rbac.Matrix {
+	if s.config.Permissions == nil {
+		return rbac.Default()
+	}
+	return s.config.Permissions
+}
+
+// UpdateUserRole changes the role of an account. The user's refresh tokens
+// are revoked so the new role applies from the next login rather than
+// surviving token refreshes. The last active admin cannot be demoted.
+func (s *AuthService) UpdateUserRole(ctx context.Context, userID uuid.UUID, role models.UserRole) (*RoleChange, error) {
+	if !rbac.ValidRole(role) {
+		return nil, apperrors.Validation(fmt.Sprintf("unknown role %q", role))
+	}
+
+	account, err := s.repo.GetAccount(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, apperrors.NotFound("user not found")
+		}
+		return nil, apperrors.FromDB(err, "failed to get user")
+	}
+
+	previous := account.Role
+	change := &RoleChange{UserID: userID, Previous: previous, Role: role}
+	if previous == role {
+		return change, nil
+	}
+
+	if previous == models.RoleAdmin && account.IsActive {
+		admins, err := s.repo.CountActiveAdmins(ctx)
+		if err != nil {
+			return nil, apperrors.FromDB(err, "failed to count admins")
+		}
+		if admins <= 1 {
+			return nil, apperrors.Validation("cannot demote the last active admin")
+		}
+	}
+
+	if err := s.repo.SetRole(ctx, userID, role, time.Now()); err != nil {
+		return nil, apperrors.FromDB(err, "failed to update role")
+	}
+
+	if _, err := s.RevokeAllSessions(ctx, userID); err != nil {
+		s.logger.Errorf("Failed to revoke sessions after role change for %s: %v", userID, err)
+	}
+
+	change.Escalation = !s.Permissions().Covers(previous, role)
+	s.logger.Infof("Role of %s changed from %s to %s", userID, previous, role)
+	return change, nil
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+func TestUpdateUserRole_Promotion(t *testing.T) {
+	svc, mock := newLockoutService(t)
+	uid := uuid.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT email, role, is_active FROM auth_users WHERE id = $1`)).
+		WithArgs(uid).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "role", "is_active"}).AddRow("u@example.com", "readonly", true))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE auth_users SET role = $1, updated_at = $2 WHERE id = $3`)).
+		WithArgs(models.RoleUser, sqlmock.AnyArg(), uid).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE refresh_tokens SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), uid).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	change, err := svc.UpdateUserRole(context.Background(), uid, models.RoleUser)
+	if err != nil {
+		t.Fatalf("update role: %v", err)
+	}
+	if change.Previous != models.RoleReadOnly || change.Role != models.RoleUser || !change.Escalation {
+		t.Fatalf("unexpected change: %+v", change)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestUpdateUserRole_LastAdmin(t *testing.T) {
+	svc, mock := newLockoutService(t)
+	uid := uuid.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT email, role, is_active FROM auth_users WHERE id = $1`)).
+		WithArgs(uid).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "role", "is_active"}).AddRow("admin@example.com", "admin", true))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM auth_users WHERE role = $1 AND is_active = true`)).
+		WithArgs(models.RoleAdmin).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	_, err := svc.UpdateUserRole(context.Background(), uid, models.RoleUser)
+	if !errors.Is(err, apperrors.ErrValidation) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestUpdateUserRole_Errors(t *testing.T) {
+	svc, mock := newLockoutService(t)
+	uid := uuid.New()
+
+	if _, err := svc.UpdateUserRole(context.Background(), uid, models.UserRole("root")); !errors.Is(err, apperrors.ErrValidation) {
+		t.Fatalf("expected validation error for unknown role, got %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT email, role, is_active FROM auth_users WHERE id = $1`)).
+		WithArgs(uid).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "role", "is_active"}))
+	if _, err := svc.UpdateUserRole(context.Background(), uid, models.RoleAdmin); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"errors"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/jwtkeys"
+)
+
+// SigningKeys describes the keys that sign and verify access tokens
+func (s *AuthService) SigningKeys() []jwtkeys.Info {
+	if s.keys == nil {
+		return []jwtkeys.Info{}
+	}
+	return s.keys.Keys()
+}
+
+// ActivateSigningKey makes a configured key sign new access tokens. Tokens
+// signed with the previous key stay valid until they expire. The change is
+// local to this instance; JWT_ACTIVE_KEY_ID makes it permanent.
+func (s *AuthService) ActivateSigningKey(id string) error {
+	if s.keys == nil {
+		return apperrors.New(apperrors.ErrUnavailable, "no signing keys configured")
+	}
+
+	previous := s.keys.ActiveID()
+	if err := s.keys.Activate(id); err != nil {
+		switch {
+		case errors.Is(err, jwtkeys.ErrUnknownKey):
+			return apperrors.Wrap(apperrors.ErrNotFound, "signing key not found", err)
+		case errors.Is(err, jwtkeys.ErrVerifyOnly):
+			return apperrors.Wrap(apperrors.ErrValidation, "signing key has no private key", err)
+		}
+		return err
+	}
+
+	s.logger.Infof("JWT signing key rotated from %s to %s", previous, id)
+	return nil
+}
+
+// JWKS returns the public signing keys for services that verify access
+// tokens themselves
+func (s *AuthService) JWKS() jwtkeys.JWKS {
+	if s.keys == nil {
+		return jwtkeys.JWKS{Keys: []jwtkeys.JWK{}}
+	}
+	return s.keys.JWKS()
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/jwtkeys"
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+func TestActivateSigningKey(t *testing.T) {
+	k1, _ := jwtkeys.NewHMACKey("k1", []byte("first-secret"))
+	k2, _ := jwtkeys.NewHMACKey("k2", []byte("second-secret"))
+	keys, err := jwtkeys.NewKeySet("k1", "k1", k1, k2)
+	if err != nil {
+		t.Fatalf("key set: %v", err)
+	}
+	svc := NewAuthService(nil, nil, logrus.New(), AuthConfig{SigningKeys: keys, JWTExpiration: time.Hour})
+
+	user := models.AuthUser{ID: uuid.New(), Email: "a@b.c", Role: models.RoleUser}
+	before, _ := svc.generateAccessToken(user)
+
+	if err := svc.ActivateSigningKey("k2"); err != nil {
+		t.Fatalf("activate: %v", err)
+	}
+	after, _ := svc.generateAccessToken(user)
+
+	for _, tok := range []string{before, after} {
+		if _, err := svc.ValidateToken(context.Background(), tok); err != nil {
+			t.Fatalf("validate: %v", err)
+		}
+	}
+
+	if err := svc.ActivateSigningKey("missing"); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Fatalf("want not found, got %v", err)
+	}
+	for _, info := range svc.SigningKeys() {
+		if info.Active != (info.ID == "k2") {
+			t.Fatalf("unexpected key state: %+v", info)
+		}
+	}
+}
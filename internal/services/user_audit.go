@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/models"
+	"highload-microservice/internal/repository"
+	"highload-microservice/internal/requestid"
+
+	"github.com/google/uuid"
+)
+
+// SetAuditLog records every change to a user, with the caller from
+// WithCallerID as the actor
+func (s *UserService) SetAuditLog(audit repository.UserAuditRepository) {
+	s.audit = audit
+}
+
+// recordChange writes an audit entry for a change that is already stored, so
+// failures are only logged
+func (s *UserService) recordChange(ctx context.Context, userID uuid.UUID, action string, changes map[string]models.FieldChange) {
+	if s.audit == nil {
+		return
+	}
+	entry := &models.UserAuditEntry{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Action:    action,
+		ActorID:   CallerID(ctx),
+		RequestID: requestid.FromContext(ctx),
+		Changes:   changes,
+		CreatedAt: time.Now(),
+	}
+	if err := s.audit.Record(ctx, entry); err != nil {
+		s.logger.Errorf("Failed to record audit entry for user %s: %v", userID, err)
+	}
+}
+
+// userChanges returns the profile fields that differ between before and
+// after; before is nil for a new user
+func userChanges(before *models.User, after *models.User) map[string]models.FieldChange {
+	if before == nil {
+		before = &models.User{}
+	}
+	changes := make(map[string]models.FieldChange)
+	for _, field := range []struct {
+		name     string
+		old, new string
+	}{
+		{"email", before.Email, after.Email},
+		{"first_name", before.FirstName, after.FirstName},
+		{"last_name", before.LastName, after.LastName},
+	} {
+		if field.old == field.new {
+			continue
+		}
+		change := models.FieldChange{New: field.new}
+		if field.old != "" {
+			change.Old = field.old
+		}
+		changes[field.name] = change
+	}
+	return changes
+}
+
+// ListUserAudit returns a page of the audit trail of a user, newest first
+func (s *UserService) ListUserAudit(ctx context.Context, userID uuid.UUID, page, limit int) (*models.UserAuditListResponse, error) {
+	if s.audit == nil {
+		return nil, apperrors.New(apperrors.ErrUnavailable, "user audit is not enabled")
+	}
+	entries, total, err := s.audit.List(ctx, userID, (page-1)*limit, limit)
+	if err != nil {
+		return nil, apperrors.FromDB(err, "failed to list audit entries")
+	}
+	return &models.UserAuditListResponse{
+		Entries: entries,
+		Total:   total,
+		Page:    page,
+		Limit:   limit,
+	}, nil
+}
@@ -2,56 +2,91 @@ package services
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/cache"
+	"highload-microservice/internal/events"
 	"highload-microservice/internal/models"
+	"highload-microservice/internal/pagination"
+	"highload-microservice/internal/repository"
+	"highload-microservice/internal/requestid"
 
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	errUserNotFound = "user not found"
+	errEmailTaken   = "user with this email already exists"
+)
+
+// userCacheTTL is how long a user stays cached
+const userCacheTTL = time.Hour
+
 type UserService struct {
-	db            *sql.DB
-	redisClient   RedisClient
+	users         repository.UserRepository
+	cache         Cache
+	loader        *cache.Loader
+	listCache     bool
+	invalidator   Invalidator
 	kafkaProducer KafkaProducer
+	audit         repository.UserAuditRepository
+	avatars       AvatarRemover
 	logger        *logrus.Logger
 }
 
-// RedisClient abstracts the subset of Redis methods used by the service
-// interfaces are defined in deps.go
-
-func NewUserService(db *sql.DB, redisClient RedisClient, kafkaProducer KafkaProducer, logger *logrus.Logger) *UserService {
+func NewUserService(repo repository.UserRepository, cacheClient Cache, kafkaProducer KafkaProducer, logger *logrus.Logger) *UserService {
 	return &UserService{
-		db:            db,
-		redisClient:   redisClient,
+		users:         repo,
+		cache:         cacheClient,
+		loader:        cache.NewLoader(cacheClient, cache.LoaderConfig{}),
 		kafkaProducer: kafkaProducer,
 		logger:        logger,
 	}
 }
 
+// SetCacheLoader replaces the loader GetUser reads through, which by default
+// only coalesces concurrent misses. The loader must wrap the service's cache.
+func (s *UserService) SetCacheLoader(loader *cache.Loader) {
+	s.loader = loader
+}
+
+// SetInvalidator publishes the user keys changed on this instance to the
+// other instances
+func (s *UserService) SetInvalidator(inv Invalidator) {
+	s.invalidator = inv
+}
+
+// SetAvatars removes the avatars of deleted users
+func (s *UserService) SetAvatars(avatars AvatarRemover) {
+	s.avatars = avatars
+}
+
 func (s *UserService) CreateUser(ctx context.Context, req models.CreateUserRequest) (*models.User, error) {
 	user := &models.User{
-		ID:        uuid.New(),
-		Email:     req.Email,
-		FirstName: req.FirstName,
-		LastName:  req.LastName,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		ID:         uuid.New(),
+		Email:      req.Email,
+		FirstName:  req.FirstName,
+		LastName:   req.LastName,
+		IsActive:   true,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+		AuthUserID: req.AuthUserID,
 	}
 
-	query := `
-		INSERT INTO users (id, email, first_name, last_name, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`
-
-	_, err := s.db.ExecContext(ctx, query, user.ID, user.Email, user.FirstName, user.LastName, user.CreatedAt, user.UpdatedAt)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
+	if err := s.users.Create(ctx, user); err != nil {
+		if apperrors.IsUniqueViolation(err) {
+			return nil, apperrors.Wrap(apperrors.ErrConflict, errEmailTaken, err)
+		}
+		return nil, apperrors.FromDB(err, "failed to create user")
 	}
 
+	s.recordChange(ctx, user.ID, models.UserAuditCreated, userChanges(nil, user))
+
 	// Cache user data
 	s.cacheUser(ctx, user)
 
@@ -60,8 +95,10 @@ func (s *UserService) CreateUser(ctx context.Context, req models.CreateUserReque
 		ID:        uuid.New(),
 		UserID:    user.ID,
 		Type:      "user_created",
-		Data:      fmt.Sprintf(`{"email":"%s","first_name":"%s","last_name":"%s"}`, user.Email, user.FirstName, user.LastName),
+		Version:   events.CurrentVersion("user_created"),
+		Data:      userEventData(user),
 		Timestamp: time.Now(),
+		RequestID: requestid.FromContext(ctx),
 	}
 
 	if err := s.kafkaProducer.SendEvent(ctx, event); err != nil {
@@ -73,43 +110,55 @@ func (s *UserService) CreateUser(ctx context.Context, req models.CreateUserReque
 }
 
 func (s *UserService) GetUser(ctx context.Context, id uuid.UUID) (*models.User, error) {
-	// Try to get from cache first
+	return s.getUser(ctx, s.users.Get, id)
+}
+
+// getUser reads a user through the cache, loading it with get on a miss.
+// Concurrent misses share one load and not found results may be cached.
+func (s *UserService) getUser(ctx context.Context, get func(context.Context, uuid.UUID) (*models.User, error), id uuid.UUID) (*models.User, error) {
 	cacheKey := fmt.Sprintf("user:%s", id.String())
-	if cached, err := s.redisClient.Get(ctx, cacheKey); err == nil {
-		var user models.User
-		if err := json.Unmarshal([]byte(cached), &user); err == nil {
-			s.logger.Debugf("User %s retrieved from cache", id)
-			return &user, nil
+	load := func(ctx context.Context) (string, error) {
+		// Deactivated and deleted users are not visible to normal reads
+		user, err := get(ctx, id)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return "", cache.ErrNotFound
+			}
+			return "", err
+		}
+		userData, err := json.Marshal(user)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal user: %w", err)
 		}
+		return string(userData), nil
 	}
 
-	// Get from database
-	user := &models.User{}
-	query := `SELECT id, email, first_name, last_name, created_at, updated_at FROM users WHERE id = $1`
-
-	err := s.db.QueryRowContext(ctx, query, id).Scan(
-		&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.CreatedAt, &user.UpdatedAt,
-	)
+	var user models.User
+	cached, err := s.loader.Load(ctx, cacheKey, userCacheTTL, load)
+	if err == nil && json.Unmarshal([]byte(cached), &user) != nil {
+		// Corrupt entry; replace it from the database
+		cached, err = s.loader.Fill(ctx, cacheKey, userCacheTTL, load)
+		if err == nil {
+			err = json.Unmarshal([]byte(cached), &user)
+		}
+	}
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user not found")
+		if errors.Is(err, cache.ErrNotFound) {
+			return nil, apperrors.NotFound(errUserNotFound)
 		}
-		return nil, fmt.Errorf("failed to get user: %w", err)
+		return nil, apperrors.FromDB(err, "failed to get user")
 	}
 
-	// Cache the result
-	s.cacheUser(ctx, user)
-
-	s.logger.Debugf("User %s retrieved from database", id)
-	return user, nil
+	return &user, nil
 }
 
 func (s *UserService) UpdateUser(ctx context.Context, id uuid.UUID, req models.UpdateUserRequest) (*models.User, error) {
-	// Get existing user
-	user, err := s.GetUser(ctx, id)
+	// Get existing user; the primary, since the row is about to be rewritten
+	user, err := s.getUser(ctx, s.users.GetPrimary, id)
 	if err != nil {
 		return nil, err
 	}
+	before := *user
 
 	// Update fields if provided
 	if req.Email != nil {
@@ -123,15 +172,15 @@ func (s *UserService) UpdateUser(ctx context.Context, id uuid.UUID, req models.U
 	}
 	user.UpdatedAt = time.Now()
 
-	query := `
-		UPDATE users 
-		SET email = $1, first_name = $2, last_name = $3, updated_at = $4
-		WHERE id = $5
-	`
+	if err := s.users.Update(ctx, user); err != nil {
+		if apperrors.IsUniqueViolation(err) {
+			return nil, apperrors.Wrap(apperrors.ErrConflict, errEmailTaken, err)
+		}
+		return nil, apperrors.FromDB(err, "failed to update user")
+	}
 
-	_, err = s.db.ExecContext(ctx, query, user.Email, user.FirstName, user.LastName, user.UpdatedAt, id)
-	if err != nil {
-		return nil, fmt.Errorf("failed to update user: %w", err)
+	if changes := userChanges(&before, user); len(changes) > 0 {
+		s.recordChange(ctx, user.ID, models.UserAuditUpdated, changes)
 	}
 
 	// Update cache
@@ -142,8 +191,10 @@ func (s *UserService) UpdateUser(ctx context.Context, id uuid.UUID, req models.U
 		ID:        uuid.New(),
 		UserID:    user.ID,
 		Type:      "user_updated",
-		Data:      fmt.Sprintf(`{"email":"%s","first_name":"%s","last_name":"%s"}`, user.Email, user.FirstName, user.LastName),
+		Version:   events.CurrentVersion("user_updated"),
+		Data:      userEventData(user),
 		Timestamp: time.Now(),
+		RequestID: requestid.FromContext(ctx),
 	}
 
 	if err := s.kafkaProducer.SendEvent(ctx, event); err != nil {
@@ -154,33 +205,40 @@ func (s *UserService) UpdateUser(ctx context.Context, id uuid.UUID, req models.U
 	return user, nil
 }
 
+// DeleteUser soft-deletes a user by setting deleted_at. Deleted users are
+// hidden from GetUser/ListUsers and can be brought back with RestoreUser.
 func (s *UserService) DeleteUser(ctx context.Context, id uuid.UUID) error {
-	query := `DELETE FROM users WHERE id = $1`
-	result, err := s.db.ExecContext(ctx, query, id)
+	deleted, err := s.users.SoftDelete(ctx, id, time.Now())
 	if err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+	if !deleted {
+		return apperrors.NotFound(errUserNotFound)
 	}
+	s.recordChange(ctx, id, models.UserAuditDeleted, map[string]models.FieldChange{"deleted": {Old: false, New: true}})
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("user not found")
+	// Restoring the user does not bring the avatar back; a failure only
+	// leaves it behind until the user row is purged
+	if s.avatars != nil {
+		if err := s.avatars.Remove(ctx, id); err != nil {
+			s.logger.Errorf("Failed to remove avatar of deleted user %s: %v", id, err)
+		}
 	}
 
 	// Remove from cache
 	cacheKey := fmt.Sprintf("user:%s", id.String())
-	_ = s.redisClient.Del(ctx, cacheKey) // Ignore cache deletion errors
+	_ = s.cache.Del(ctx, cacheKey) // Ignore cache deletion errors
+	invalidate(ctx, s.invalidator, s.logger, cacheKey)
 
 	// Send event to Kafka
 	event := models.KafkaEvent{
 		ID:        uuid.New(),
 		UserID:    id,
 		Type:      "user_deleted",
+		Version:   events.CurrentVersion("user_deleted"),
 		Data:      `{}`,
 		Timestamp: time.Now(),
+		RequestID: requestid.FromContext(ctx),
 	}
 
 	if err := s.kafkaProducer.SendEvent(ctx, event); err != nil {
@@ -191,49 +249,163 @@ func (s *UserService) DeleteUser(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
-func (s *UserService) ListUsers(ctx context.Context, page, limit int) (*models.UserListResponse, error) {
-	offset := (page - 1) * limit
+// RestoreUser clears deleted_at of a soft-deleted user and emits
+// user_restored. Restoring a user that is not deleted is a no-op.
+func (s *UserService) RestoreUser(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	restored, err := s.users.Restore(ctx, id, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore user: %w", err)
+	}
+
+	user, err := s.users.Lookup(ctx, id, true)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, apperrors.NotFound(errUserNotFound)
+		}
+		return nil, apperrors.FromDB(err, "failed to get user")
+	}
+
+	// Not deleted
+	if !restored {
+		return user, nil
+	}
+	s.recordChange(ctx, id, models.UserAuditRestored, map[string]models.FieldChange{"deleted": {Old: true, New: false}})
+
+	cacheKey := fmt.Sprintf("user:%s", id.String())
+	_ = s.cache.Del(ctx, cacheKey) // Ignore cache deletion errors
+	invalidate(ctx, s.invalidator, s.logger, cacheKey)
+
+	event := models.KafkaEvent{
+		ID:        uuid.New(),
+		UserID:    id,
+		Type:      "user_restored",
+		Version:   events.CurrentVersion("user_restored"),
+		Data:      userEventData(user),
+		Timestamp: time.Now(),
+		RequestID: requestid.FromContext(ctx),
+	}
+
+	if err := s.kafkaProducer.SendEvent(ctx, event); err != nil {
+		s.logger.Errorf("Failed to send user restore event: %v", err)
+	}
 
-	// Get total count
-	var total int
-	countQuery := `SELECT COUNT(*) FROM users`
-	err := s.db.QueryRowContext(ctx, countQuery).Scan(&total)
+	s.logger.Infof("User restored: %s", id)
+	return user, nil
+}
+
+// SetUserOwner links the user to the account authUserID, which may then call
+// the routes open to the record's owner, or unlinks it when nil
+func (s *UserService) SetUserOwner(ctx context.Context, id uuid.UUID, authUserID *uuid.UUID) error {
+	found, err := s.users.SetOwner(ctx, id, authUserID, time.Now())
 	if err != nil {
-		return nil, fmt.Errorf("failed to count users: %w", err)
+		return apperrors.FromDB(err, "failed to set user owner")
+	}
+	if !found {
+		return apperrors.NotFound(errUserNotFound)
 	}
+	s.recordChange(ctx, id, models.UserAuditUpdated, map[string]models.FieldChange{"auth_user_id": {New: authUserID}})
+	return nil
+}
 
-	// Get users
-	query := `
-		SELECT id, email, first_name, last_name, created_at, updated_at 
-		FROM users 
-		ORDER BY created_at DESC 
-		LIMIT $1 OFFSET $2
-	`
+// OwnedBy reports whether the user id is linked to the account authUserID
+func (s *UserService) OwnedBy(ctx context.Context, id, authUserID uuid.UUID) (bool, error) {
+	owned, err := s.users.OwnedBy(ctx, id, authUserID)
+	if err != nil {
+		return false, apperrors.FromDB(err, "failed to check user owner")
+	}
+	return owned, nil
+}
 
-	rows, err := s.db.QueryContext(ctx, query, limit, offset)
+// SetUserActive activates or deactivates a user. Deactivated users are hidden
+// from GetUser/ListUsers; changing the state invalidates the cache and emits
+// user_activated or user_deactivated.
+func (s *UserService) SetUserActive(ctx context.Context, id uuid.UUID, active bool) (*models.User, error) {
+	updated, err := s.users.SetActive(ctx, id, active, time.Now())
 	if err != nil {
-		return nil, fmt.Errorf("failed to list users: %w", err)
+		return nil, fmt.Errorf("failed to update user status: %w", err)
 	}
-	defer func() { _ = rows.Close() }()
 
-	var users []models.User
-	for rows.Next() {
-		var user models.User
-		err := rows.Scan(&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.CreatedAt, &user.UpdatedAt)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan user: %w", err)
+	user, err := s.users.Lookup(ctx, id, false)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, apperrors.NotFound(errUserNotFound)
 		}
-		users = append(users, user)
+		return nil, apperrors.FromDB(err, "failed to get user")
+	}
+
+	// Already in the requested state
+	if !updated {
+		return user, nil
+	}
+	action := models.UserAuditDeactivated
+	if active {
+		action = models.UserAuditActivated
+	}
+	s.recordChange(ctx, id, action, map[string]models.FieldChange{"is_active": {Old: !active, New: active}})
+
+	cacheKey := fmt.Sprintf("user:%s", id.String())
+	_ = s.cache.Del(ctx, cacheKey) // Ignore cache deletion errors
+	invalidate(ctx, s.invalidator, s.logger, cacheKey)
+
+	eventType := "user_deactivated"
+	if active {
+		eventType = "user_activated"
+	}
+	event := models.KafkaEvent{
+		ID:        uuid.New(),
+		UserID:    id,
+		Type:      eventType,
+		Version:   events.CurrentVersion(eventType),
+		Data:      eventData(userActiveEvent{IsActive: active}),
+		Timestamp: time.Now(),
+		RequestID: requestid.FromContext(ctx),
 	}
 
-	return &models.UserListResponse{
-		Users: users,
-		Total: total,
+	if err := s.kafkaProducer.SendEvent(ctx, event); err != nil {
+		s.logger.Errorf("Failed to send %s event: %v", eventType, err)
+	}
+
+	s.logger.Infof("User %s: %s", eventType, id)
+	return user, nil
+}
+
+// ListUsers returns a page of active users matching filter.
+// filter.IncludeDeleted also returns soft-deleted users with their deleted_at set.
+// With after set the page starts after that cursor instead of at page's
+// offset; NextCursor is returned when more users follow (created_at sort only).
+func (s *UserService) ListUsers(ctx context.Context, page, limit int, filter models.UserFilter, after *pagination.Cursor) (*models.UserListResponse, error) {
+	keyset := filter.Sort == "" || filter.Sort == models.UserSortCreatedAt
+	if after != nil && !keyset {
+		return nil, apperrors.Validation("cursor pagination requires sort=created_at")
+	}
+
+	query := repository.UserListQuery{Filter: filter, After: after, Offset: (page - 1) * limit, Limit: limit}
+	if after != nil {
+		page = 0
+	}
+	list := s.users.List
+	if s.listCache {
+		list = s.listUsersCached
+	}
+	result, err := list(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.UserListResponse{
+		Users: result.Users,
+		Total: result.Total,
 		Page:  page,
 		Limit: limit,
-	}, nil
+	}
+	if result.More && keyset {
+		last := response.Users[len(response.Users)-1]
+		response.NextCursor = pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	return response, nil
 }
 
+// cacheUser stores a changed user and tells other instances to drop theirs
 func (s *UserService) cacheUser(ctx context.Context, user *models.User) {
 	cacheKey := fmt.Sprintf("user:%s", user.ID.String())
 	userData, err := json.Marshal(user)
@@ -242,7 +414,30 @@ func (s *UserService) cacheUser(ctx context.Context, user *models.User) {
 		return
 	}
 
-	if err := s.redisClient.Set(ctx, cacheKey, string(userData), 1*time.Hour); err != nil {
+	if err := s.cache.Set(ctx, cacheKey, string(userData), userCacheTTL); err != nil {
 		s.logger.Errorf("Failed to cache user: %v", err)
 	}
+	invalidate(ctx, s.invalidator, s.logger, cacheKey)
+}
+
+// userEvent is the payload of user_created, user_updated and user_restored
+type userEvent struct {
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// userActiveEvent is the payload of user_activated and user_deactivated
+type userActiveEvent struct {
+	IsActive bool `json:"is_active"`
+}
+
+func userEventData(user *models.User) string {
+	return eventData(userEvent{Email: user.Email, FirstName: user.FirstName, LastName: user.LastName})
+}
+
+// eventData encodes a payload of plain fields, which cannot fail to marshal
+func eventData(payload interface{}) string {
+	data, _ := json.Marshal(payload)
+	return string(data)
 }
@@ -4,36 +4,30 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"regexp"
 	"testing"
 	"time"
 
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/cache"
 	"highload-microservice/internal/models"
+	"highload-microservice/internal/pagination"
+	"highload-microservice/internal/repository"
+	"highload-microservice/internal/requestid"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
-type stubRedis struct{}
-
-func (s *stubRedis) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
-	return nil
-}
-func (s *stubRedis) Get(ctx context.Context, key string) (string, error)  { return "", sql.ErrNoRows }
-func (s *stubRedis) Del(ctx context.Context, keys ...string) error        { return nil }
-func (s *stubRedis) Exists(ctx context.Context, key string) (bool, error) { return false, nil }
-func (s *stubRedis) Ping(ctx context.Context) error                       { return nil }
-func (s *stubRedis) Close() error                                         { return nil }
-
 type stubProducer struct{}
 
 func (s *stubProducer) SendEvent(ctx context.Context, _ models.KafkaEvent) error { return nil }
 func (s *stubProducer) Close() error                                             { return nil }
 
 // compile-time checks that stubs satisfy minimal interfaces used in service
-var _ = (&stubRedis{}).Ping
 var _ = (&stubProducer{}).Close
 
 func TestUserService_CreateAndGet(t *testing.T) {
@@ -44,11 +38,11 @@ func TestUserService_CreateAndGet(t *testing.T) {
 	defer db.Close()
 
 	logger := logrus.New()
-	svc := &UserService{db: db, redisClient: &stubRedis{}, kafkaProducer: &stubProducer{}, logger: logger}
+	svc := NewUserService(repository.NewPostgresUserRepository(db), cache.NewMemoryCache(), &stubProducer{}, logger)
 
 	// Insert expectation
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users")).
-		WithArgs(sqlmock.AnyArg(), "u@example.com", "John", "Doe", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WithArgs(sqlmock.AnyArg(), "u@example.com", "John", "Doe", sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	// Create
@@ -61,6 +55,9 @@ func TestUserService_CreateAndGet(t *testing.T) {
 		t.Fatalf("create: %v", err)
 	}
 
+	// Evict the copy cached by CreateUser so GetUser reads from the database
+	_ = svc.cache.Del(context.Background(), "user:"+user.ID.String())
+
 	// Query expectation for GetUser
 	rows := sqlmock.NewRows([]string{"id", "email", "first_name", "last_name", "created_at", "updated_at"}).
 		AddRow(user.ID, user.Email, user.FirstName, user.LastName, time.Now(), time.Now())
@@ -87,10 +84,10 @@ func TestUserService_Delete_NotFound(t *testing.T) {
 	}
 	defer db.Close()
 
-	svc := &UserService{db: db, logger: logrus.New()}
+	svc := &UserService{users: repository.NewPostgresUserRepository(db), logger: logrus.New()}
 
-	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM users WHERE id = $1")).
-		WithArgs(sqlmock.AnyArg()).
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET deleted_at = $1, updated_at = $2 WHERE id = $3 AND deleted_at IS NULL")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewResult(0, 0))
 
 	err = svc.DeleteUser(context.Background(), uuid.New())
@@ -110,10 +107,10 @@ func TestUserService_Delete_RowsAffectedError(t *testing.T) {
 	}
 	defer db.Close()
 
-	svc := &UserService{db: db, logger: logrus.New()}
+	svc := &UserService{users: repository.NewPostgresUserRepository(db), logger: logrus.New()}
 
-	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM users WHERE id = $1")).
-		WithArgs(sqlmock.AnyArg()).
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET deleted_at = $1, updated_at = $2 WHERE id = $3 AND deleted_at IS NULL")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewErrorResult(fmt.Errorf("rows affected failed")))
 
 	if err := svc.DeleteUser(context.Background(), uuid.New()); err == nil {
@@ -128,12 +125,12 @@ func TestUserService_ListUsers_Errors(t *testing.T) {
 	}
 	defer db.Close()
 
-	svc := &UserService{db: db, logger: logrus.New()}
+	svc := &UserService{users: repository.NewPostgresUserRepository(db), logger: logrus.New()}
 
 	// count error
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM users")).
 		WillReturnError(fmt.Errorf("count failed"))
-	if _, err := svc.ListUsers(context.Background(), 1, 10); err == nil {
+	if _, err := svc.ListUsers(context.Background(), 1, 10, models.UserFilter{}, nil); err == nil {
 		t.Fatalf("expected count error")
 	}
 
@@ -142,7 +139,7 @@ func TestUserService_ListUsers_Errors(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, email, first_name, last_name, created_at, updated_at ")).
 		WillReturnError(fmt.Errorf("list failed"))
-	if _, err := svc.ListUsers(context.Background(), 1, 10); err == nil {
+	if _, err := svc.ListUsers(context.Background(), 1, 10, models.UserFilter{}, nil); err == nil {
 		t.Fatalf("expected list query error")
 	}
 
@@ -152,7 +149,7 @@ func TestUserService_ListUsers_Errors(t *testing.T) {
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, email, first_name, last_name, created_at, updated_at ")).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "first_name", "last_name", "created_at", "updated_at"}).
 			AddRow("not-uuid", "e@x", "f", "l", time.Now(), time.Now()))
-	if _, err := svc.ListUsers(context.Background(), 1, 10); err == nil {
+	if _, err := svc.ListUsers(context.Background(), 1, 10, models.UserFilter{}, nil); err == nil {
 		t.Fatalf("expected scan error")
 	}
 }
@@ -164,7 +161,7 @@ func TestUserService_ListUsers_SuccessMultiple(t *testing.T) {
 	}
 	defer db.Close()
 
-	svc := &UserService{db: db, logger: logrus.New()}
+	svc := &UserService{users: repository.NewPostgresUserRepository(db), logger: logrus.New()}
 
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM users")).
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
@@ -174,7 +171,7 @@ func TestUserService_ListUsers_SuccessMultiple(t *testing.T) {
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, email, first_name, last_name, created_at, updated_at ")).
 		WillReturnRows(rows)
 
-	out, err := svc.ListUsers(context.Background(), 1, 10)
+	out, err := svc.ListUsers(context.Background(), 1, 10, models.UserFilter{}, nil)
 	if err != nil {
 		t.Fatalf("list: %v", err)
 	}
@@ -190,7 +187,7 @@ func TestUserService_UpdateUser_NotFoundAndDBError(t *testing.T) {
 	}
 	defer db.Close()
 
-	svc := &UserService{db: db, redisClient: &stubRedis{}, kafkaProducer: &stubProducer{}, logger: logrus.New()}
+	svc := NewUserService(repository.NewPostgresUserRepository(db), cache.NewMemoryCache(), &stubProducer{}, logrus.New())
 	id := uuid.New()
 
 	// GetUser not found
@@ -213,17 +210,6 @@ func TestUserService_UpdateUser_NotFoundAndDBError(t *testing.T) {
 	}
 }
 
-type stubRedisWithValue struct{ val string }
-
-func (s *stubRedisWithValue) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
-	return nil
-}
-func (s *stubRedisWithValue) Get(ctx context.Context, key string) (string, error)  { return s.val, nil }
-func (s *stubRedisWithValue) Del(ctx context.Context, keys ...string) error        { return nil }
-func (s *stubRedisWithValue) Exists(ctx context.Context, key string) (bool, error) { return true, nil }
-func (s *stubRedisWithValue) Ping(ctx context.Context) error                       { return nil }
-func (s *stubRedisWithValue) Close() error                                         { return nil }
-
 func TestUserService_GetUser_CacheHit(t *testing.T) {
 	db, _, err := sqlmock.New()
 	if err != nil {
@@ -233,7 +219,9 @@ func TestUserService_GetUser_CacheHit(t *testing.T) {
 
 	u := models.User{ID: uuid.New(), Email: "c@example.com", FirstName: "C", LastName: "H", CreatedAt: time.Now(), UpdatedAt: time.Now()}
 	buf, _ := json.Marshal(u)
-	svc := &UserService{db: db, redisClient: &stubRedisWithValue{val: string(buf)}, kafkaProducer: &stubProducer{}, logger: logrus.New()}
+	mc := cache.NewMemoryCache()
+	_ = mc.Set(context.Background(), "user:"+u.ID.String(), string(buf), time.Minute)
+	svc := NewUserService(repository.NewPostgresUserRepository(db), mc, &stubProducer{}, logrus.New())
 
 	got, err := svc.GetUser(context.Background(), u.ID)
 	if err != nil {
@@ -244,19 +232,6 @@ func TestUserService_GetUser_CacheHit(t *testing.T) {
 	}
 }
 
-type stubRedisCorrupt struct{}
-
-func (s *stubRedisCorrupt) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
-	return nil
-}
-func (s *stubRedisCorrupt) Get(ctx context.Context, key string) (string, error) {
-	return "{not-json}", nil
-}
-func (s *stubRedisCorrupt) Del(ctx context.Context, keys ...string) error        { return nil }
-func (s *stubRedisCorrupt) Exists(ctx context.Context, key string) (bool, error) { return false, nil }
-func (s *stubRedisCorrupt) Ping(ctx context.Context) error                       { return nil }
-func (s *stubRedisCorrupt) Close() error                                         { return nil }
-
 func TestUserService_GetUser_DBErrorAndCorruptCache(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -264,8 +239,10 @@ func TestUserService_GetUser_DBErrorAndCorruptCache(t *testing.T) {
 	}
 	defer db.Close()
 
-	svc := &UserService{db: db, redisClient: &stubRedisCorrupt{}, kafkaProducer: &stubProducer{}, logger: logrus.New()}
 	id := uuid.New()
+	mc := cache.NewMemoryCache()
+	_ = mc.Set(context.Background(), "user:"+id.String(), "{not-json}", time.Minute)
+	svc := NewUserService(repository.NewPostgresUserRepository(db), mc, &stubProducer{}, logrus.New())
 
 	// Non-ErrNoRows DB error
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, email, first_name, last_name, created_at, updated_at FROM users WHERE id = $1")).
@@ -295,22 +272,22 @@ func (s *stubProducerErr) SendEvent(ctx context.Context, _ models.KafkaEvent) er
 }
 func (s *stubProducerErr) Close() error { return nil }
 
-type stubRedisErr struct{}
+type stubCacheErr struct{}
 
-func (s *stubRedisErr) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+func (s *stubCacheErr) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
 	return fmt.Errorf("set failed")
 }
-func (s *stubRedisErr) Get(ctx context.Context, key string) (string, error) {
+func (s *stubCacheErr) Get(ctx context.Context, key string) (string, error) {
 	return "", fmt.Errorf("get failed")
 }
-func (s *stubRedisErr) Del(ctx context.Context, keys ...string) error {
+func (s *stubCacheErr) Del(ctx context.Context, keys ...string) error {
 	return fmt.Errorf("del failed")
 }
-func (s *stubRedisErr) Exists(ctx context.Context, key string) (bool, error) {
+func (s *stubCacheErr) Exists(ctx context.Context, key string) (bool, error) {
 	return false, fmt.Errorf("exists failed")
 }
-func (s *stubRedisErr) Ping(ctx context.Context) error { return nil }
-func (s *stubRedisErr) Close() error                   { return nil }
+func (s *stubCacheErr) Ping(ctx context.Context) error { return nil }
+func (s *stubCacheErr) Close() error                   { return nil }
 
 func TestUserService_Create_Update_Delete_WithKafkaRedisErrors(t *testing.T) {
 	db, mock, err := sqlmock.New()
@@ -320,11 +297,11 @@ func TestUserService_Create_Update_Delete_WithKafkaRedisErrors(t *testing.T) {
 	defer db.Close()
 
 	logger := logrus.New()
-	svc := &UserService{db: db, redisClient: &stubRedisErr{}, kafkaProducer: &stubProducerErr{}, logger: logger}
+	svc := NewUserService(repository.NewPostgresUserRepository(db), &stubCacheErr{}, &stubProducerErr{}, logger)
 
 	// CreateUser still succeeds even if cache/kafka fail
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users")).
-		WithArgs(sqlmock.AnyArg(), "e@x", "F", "L", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WithArgs(sqlmock.AnyArg(), "e@x", "F", "L", sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	u, err := svc.CreateUser(context.Background(), models.CreateUserRequest{Email: "e@x", FirstName: "F", LastName: "L"})
 	if err != nil {
@@ -343,9 +320,9 @@ func TestUserService_Create_Update_Delete_WithKafkaRedisErrors(t *testing.T) {
 		t.Fatalf("update err: %v", err)
 	}
 
-	// DeleteUser: DELETE returns 1 row; redis Del fails but method returns nil
-	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM users WHERE id = $1")).
-		WithArgs(u.ID).
+	// DeleteUser: soft delete updates 1 row; redis Del fails but method returns nil
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET deleted_at = $1, updated_at = $2 WHERE id = $3 AND deleted_at IS NULL")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), u.ID).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	if err := svc.DeleteUser(context.Background(), u.ID); err != nil {
 		t.Fatalf("delete err: %v", err)
@@ -355,3 +332,533 @@ func TestUserService_Create_Update_Delete_WithKafkaRedisErrors(t *testing.T) {
 		t.Fatalf("sql expectations: %v", err)
 	}
 }
+
+type recordingProducer struct{ events []models.KafkaEvent }
+
+func (r *recordingProducer) SendEvent(ctx context.Context, event models.KafkaEvent) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+func TestUserService_SetUserActive(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mc := cache.NewMemoryCache()
+	producer := &recordingProducer{}
+	svc := NewUserService(repository.NewPostgresUserRepository(db), mc, producer, logrus.New())
+
+	id := uuid.New()
+	_ = mc.Set(context.Background(), "user:"+id.String(), `{"id":"`+id.String()+`"}`, time.Minute)
+
+	update := regexp.QuoteMeta("UPDATE users SET is_active = $1, updated_at = $2 WHERE id = $3 AND is_active <> $4")
+	selectUser := regexp.QuoteMeta("SELECT id, email, first_name, last_name, is_active, created_at, updated_at FROM users WHERE id = $1")
+	cols := []string{"id", "email", "first_name", "last_name", "is_active", "created_at", "updated_at"}
+
+	// Deactivate: state changes, cache is invalidated and an event is emitted
+	mock.ExpectExec(update).WithArgs(false, sqlmock.AnyArg(), id, false).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(selectUser).WithArgs(id).
+		WillReturnRows(sqlmock.NewRows(cols).AddRow(id, "u@example.com", "U", "S", false, time.Now(), time.Now()))
+
+	user, err := svc.SetUserActive(context.Background(), id, false)
+	if err != nil || user.IsActive {
+		t.Fatalf("deactivate: %+v %v", user, err)
+	}
+	if ok, _ := mc.Exists(context.Background(), "user:"+id.String()); ok {
+		t.Fatalf("expected cache entry to be invalidated")
+	}
+	if len(producer.events) != 1 || producer.events[0].Type != "user_deactivated" {
+		t.Fatalf("expected user_deactivated event, got %+v", producer.events)
+	}
+
+	// Deactivate again: no change, no event
+	mock.ExpectExec(update).WithArgs(false, sqlmock.AnyArg(), id, false).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(selectUser).WithArgs(id).
+		WillReturnRows(sqlmock.NewRows(cols).AddRow(id, "u@example.com", "U", "S", false, time.Now(), time.Now()))
+	if _, err := svc.SetUserActive(context.Background(), id, false); err != nil {
+		t.Fatalf("repeat deactivate: %v", err)
+	}
+	if len(producer.events) != 1 {
+		t.Fatalf("expected no event for unchanged state, got %d", len(producer.events))
+	}
+
+	// Unknown user
+	mock.ExpectExec(update).WithArgs(true, sqlmock.AnyArg(), id, true).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(selectUser).WithArgs(id).WillReturnError(sql.ErrNoRows)
+	if _, err := svc.SetUserActive(context.Background(), id, true); err == nil || err.Error() != "user not found" {
+		t.Fatalf("expected user not found, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestUserService_RestoreUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	producer := &recordingProducer{}
+	svc := NewUserService(repository.NewPostgresUserRepository(db), cache.NewMemoryCache(), producer, logrus.New())
+	id := uuid.New()
+
+	restore := regexp.QuoteMeta("UPDATE users SET deleted_at = NULL, updated_at = $1 WHERE id = $2 AND deleted_at IS NOT NULL")
+	selectUser := regexp.QuoteMeta("SELECT id, email, first_name, last_name, is_active, created_at, updated_at FROM users WHERE id = $1")
+	cols := []string{"id", "email", "first_name", "last_name", "is_active", "created_at", "updated_at"}
+
+	// Soft-deleted user comes back and user_restored is emitted
+	mock.ExpectExec(restore).WithArgs(sqlmock.AnyArg(), id).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(selectUser).WithArgs(id).
+		WillReturnRows(sqlmock.NewRows(cols).AddRow(id, "u@example.com", `U "the \ user"`, "S", true, time.Now(), time.Now()))
+	user, err := svc.RestoreUser(context.Background(), id)
+	if err != nil || user.ID != id {
+		t.Fatalf("restore: %+v %v", user, err)
+	}
+	if len(producer.events) != 1 || producer.events[0].Type != "user_restored" {
+		t.Fatalf("expected user_restored event, got %+v", producer.events)
+	}
+	var payload map[string]string
+	if err := json.Unmarshal([]byte(producer.events[0].Data), &payload); err != nil || payload["first_name"] != `U "the \ user"` {
+		t.Fatalf("user_restored payload %s: %v", producer.events[0].Data, err)
+	}
+
+	// Not deleted: no change, no event
+	mock.ExpectExec(restore).WithArgs(sqlmock.AnyArg(), id).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(selectUser).WithArgs(id).
+		WillReturnRows(sqlmock.NewRows(cols).AddRow(id, "u@example.com", "U", "S", true, time.Now(), time.Now()))
+	if _, err := svc.RestoreUser(context.Background(), id); err != nil {
+		t.Fatalf("repeat restore: %v", err)
+	}
+	if len(producer.events) != 1 {
+		t.Fatalf("expected no event for a user that is not deleted, got %d", len(producer.events))
+	}
+
+	// Unknown user
+	mock.ExpectExec(restore).WithArgs(sqlmock.AnyArg(), id).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(selectUser).WithArgs(id).WillReturnError(sql.ErrNoRows)
+	if _, err := svc.RestoreUser(context.Background(), id); err == nil || err.Error() != "user not found" {
+		t.Fatalf("expected user not found, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestUserService_ListUsers_IncludeDeleted(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	svc := &UserService{users: repository.NewPostgresUserRepository(db), logger: logrus.New()}
+
+	deletedAt := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM users WHERE is_active = true")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, email, first_name, last_name, created_at, updated_at, deleted_at ")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "first_name", "last_name", "created_at", "updated_at", "deleted_at"}).
+			AddRow(uuid.New(), "a@example.com", "A", "A", time.Now(), time.Now(), nil).
+			AddRow(uuid.New(), "b@example.com", "B", "B", time.Now(), time.Now(), deletedAt))
+
+	out, err := svc.ListUsers(context.Background(), 1, 10, models.UserFilter{IncludeDeleted: true}, nil)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(out.Users) != 2 || out.Users[0].DeletedAt != nil || out.Users[1].DeletedAt == nil {
+		t.Fatalf("unexpected deleted_at in result: %+v", out.Users)
+	}
+}
+
+func TestUserService_ListUsers_Filters(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	svc := &UserService{users: repository.NewPostgresUserRepository(db), logger: logrus.New()}
+
+	after := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := after.AddDate(0, 1, 0)
+	where := "is_active = true AND deleted_at IS NULL AND (LOWER(email) LIKE $1 OR LOWER(first_name) LIKE $2 OR LOWER(last_name) LIKE $3) " +
+		"AND email = $4 AND created_at >= $5 AND created_at < $6"
+	pattern := `%jo\_hn%`
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM users WHERE "+where)).
+		WithArgs(pattern, pattern, pattern, "john@example.com", after, before).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE "+where+"\n\t\tORDER BY email DESC, id DESC \n\t\tLIMIT $7 OFFSET $8")).
+		WithArgs(pattern, pattern, pattern, "john@example.com", after, before, 11, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "first_name", "last_name", "created_at", "updated_at"}).
+			AddRow(uuid.New(), "john@example.com", "Jo_hn", "Doe", after, after))
+
+	out, err := svc.ListUsers(context.Background(), 1, 10, models.UserFilter{
+		Query:         " Jo_hn ",
+		Email:         "john@example.com",
+		CreatedAfter:  after,
+		CreatedBefore: before,
+		Sort:          models.UserSortEmail,
+		Order:         models.SortDesc,
+	}, nil)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if out.Total != 1 || len(out.Users) != 1 {
+		t.Fatalf("unexpected list result: %+v", out)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+
+	for _, filter := range []models.UserFilter{{Sort: "password"}, {Order: "sideways"}} {
+		if _, err := svc.ListUsers(context.Background(), 1, 10, filter, nil); !errors.Is(err, apperrors.ErrValidation) {
+			t.Fatalf("%+v: expected validation error, got %v", filter, err)
+		}
+	}
+}
+
+func TestUserService_ListUsers_Cursor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	svc := &UserService{users: repository.NewPostgresUserRepository(db), logger: logrus.New()}
+	cursor := pagination.Cursor{CreatedAt: time.Now().UTC(), ID: uuid.New()}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM users WHERE is_active = true AND deleted_at IS NULL AND email = $1")).
+		WithArgs("a@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE is_active = true AND deleted_at IS NULL AND email = $1 AND (created_at > $2 OR (created_at = $3 AND id > $4))\n\t\tORDER BY created_at ASC, id ASC")).
+		WithArgs("a@example.com", cursor.CreatedAt, cursor.CreatedAt, cursor.ID, 11, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "first_name", "last_name", "created_at", "updated_at"}).
+			AddRow(uuid.New(), "a@example.com", "A", "A", time.Now(), time.Now()))
+
+	out, err := svc.ListUsers(context.Background(), 3, 10, models.UserFilter{Email: "a@example.com", Order: models.SortAsc}, &cursor)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(out.Users) != 1 || out.NextCursor != "" || out.Page != 0 {
+		t.Fatalf("unexpected result: %+v", out)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+
+	// Keyset pagination only works on the created_at order
+	if _, err := svc.ListUsers(context.Background(), 1, 10, models.UserFilter{Sort: models.UserSortEmail}, &cursor); !errors.Is(err, apperrors.ErrValidation) {
+		t.Fatalf("expected validation error for cursor with sort=email, got %v", err)
+	}
+}
+
+type fixedReader struct{ db *sql.DB }
+
+func (r fixedReader) Reader() *sql.DB { return r.db }
+
+func TestUserService_ReadsFromReplica(t *testing.T) {
+	primary, primaryMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer primary.Close()
+	replica, replicaMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer replica.Close()
+
+	repo := repository.NewPostgresUserRepository(primary)
+	repo.SetReader(fixedReader{db: replica})
+	svc := NewUserService(repo, cache.NewMemoryCache(), &stubProducer{}, logrus.New())
+
+	id := uuid.New()
+	columns := []string{"id", "email", "first_name", "last_name", "created_at", "updated_at"}
+	replicaMock.ExpectQuery(regexp.QuoteMeta("SELECT id, email, first_name, last_name, created_at, updated_at FROM users WHERE id = $1")).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(id, "r@example.com", "Re", "Plica", time.Now(), time.Now()))
+	if _, err := svc.GetUser(context.Background(), id); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+
+	// Updates read the current row from the primary
+	other := uuid.New()
+	primaryMock.ExpectQuery(regexp.QuoteMeta("SELECT id, email, first_name, last_name, created_at, updated_at FROM users WHERE id = $1")).
+		WithArgs(other).
+		WillReturnError(sql.ErrNoRows)
+	name := "New"
+	if _, err := svc.UpdateUser(context.Background(), other, models.UpdateUserRequest{FirstName: &name}); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Fatalf("expected not found from the primary, got %v", err)
+	}
+
+	if err := replicaMock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("replica expectations: %v", err)
+	}
+	if err := primaryMock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("primary expectations: %v", err)
+	}
+}
+
+// fakeUsers serves GetUser from memory; other repository methods are not
+// implemented
+type fakeUsers struct {
+	repository.UserRepository
+	users map[uuid.UUID]models.User
+	gets  int
+}
+
+func (f *fakeUsers) Get(_ context.Context, id uuid.UUID) (*models.User, error) {
+	f.gets++
+	user, ok := f.users[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &user, nil
+}
+
+func TestUserService_GetUser_WithFakeRepository(t *testing.T) {
+	id := uuid.New()
+	repo := &fakeUsers{users: map[uuid.UUID]models.User{id: {ID: id, Email: "fake@example.com", IsActive: true}}}
+	svc := NewUserService(repo, cache.NewMemoryCache(), &stubProducer{}, logrus.New())
+
+	for i := 0; i < 2; i++ {
+		user, err := svc.GetUser(context.Background(), id)
+		if err != nil || user.Email != "fake@example.com" {
+			t.Fatalf("get %d: %+v, %v", i, user, err)
+		}
+	}
+	if repo.gets != 1 {
+		t.Fatalf("expected the second read to hit the cache, repository was read %d times", repo.gets)
+	}
+
+	if _, err := svc.GetUser(context.Background(), uuid.New()); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestUserService_GetUser_CachesNotFound(t *testing.T) {
+	repo := &fakeUsers{users: map[uuid.UUID]models.User{}}
+	mc := cache.NewMemoryCache()
+	svc := NewUserService(repo, mc, &stubProducer{}, logrus.New())
+	svc.SetCacheLoader(cache.NewLoader(mc, cache.LoaderConfig{NegativeTTL: time.Minute}))
+
+	id := uuid.New()
+	for i := 0; i < 2; i++ {
+		if _, err := svc.GetUser(context.Background(), id); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Fatalf("get %d: expected not found, got %v", i, err)
+		}
+	}
+	if repo.gets != 1 {
+		t.Fatalf("expected the second miss to be served from the cache, repository was read %d times", repo.gets)
+	}
+}
+
+// recordingInvalidator collects published keys
+type recordingInvalidator struct {
+	keys []string
+}
+
+func (r *recordingInvalidator) Invalidate(_ context.Context, keys ...string) error {
+	r.keys = append(r.keys, keys...)
+	return nil
+}
+
+func TestUserService_DeleteUser_PublishesInvalidation(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	inv := &recordingInvalidator{}
+	svc := NewUserService(repository.NewPostgresUserRepository(db), cache.NewMemoryCache(), &stubProducer{}, logrus.New())
+	svc.SetInvalidator(inv)
+
+	id := uuid.New()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET deleted_at = $1, updated_at = $2 WHERE id = $3 AND deleted_at IS NULL")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := svc.DeleteUser(context.Background(), id); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	if len(inv.keys) != 1 || inv.keys[0] != "user:"+id.String() {
+		t.Fatalf("expected user key to be invalidated, got %v", inv.keys)
+	}
+}
+
+// removedAvatars collects the users whose avatar was removed
+type removedAvatars struct {
+	users []uuid.UUID
+}
+
+func (r *removedAvatars) Remove(_ context.Context, userID uuid.UUID) error {
+	r.users = append(r.users, userID)
+	return nil
+}
+
+func TestUserService_DeleteUser_RemovesAvatar(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	avatars := &removedAvatars{}
+	svc := NewUserService(repository.NewPostgresUserRepository(db), cache.NewMemoryCache(), &stubProducer{}, logrus.New())
+	svc.SetAvatars(avatars)
+
+	id := uuid.New()
+	del := regexp.QuoteMeta("UPDATE users SET deleted_at = $1, updated_at = $2 WHERE id = $3 AND deleted_at IS NULL")
+	mock.ExpectExec(del).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), id).WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := svc.DeleteUser(context.Background(), id); err == nil {
+		t.Fatal("expected not found")
+	}
+	mock.ExpectExec(del).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), id).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := svc.DeleteUser(context.Background(), id); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	if len(avatars.users) != 1 || avatars.users[0] != id {
+		t.Fatalf("expected only the deleted user's avatar removed, got %v", avatars.users)
+	}
+}
+
+type memoryUserAudit struct{ entries []models.UserAuditEntry }
+
+func (m *memoryUserAudit) Record(ctx context.Context, entry *models.UserAuditEntry) error {
+	m.entries = append(m.entries, *entry)
+	return nil
+}
+
+func (m *memoryUserAudit) List(ctx context.Context, userID uuid.UUID, offset, limit int) ([]models.UserAuditEntry, int, error) {
+	return m.entries, len(m.entries), nil
+}
+
+func TestUserService_AuditTrail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	audit := &memoryUserAudit{}
+	svc := NewUserService(repository.NewPostgresUserRepository(db), cache.NewMemoryCache(), &stubProducer{}, logrus.New())
+	svc.SetAuditLog(audit)
+
+	actor := uuid.New()
+	ctx := requestid.NewContext(WithCallerID(context.Background(), actor), "req-1")
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users")).
+		WithArgs(sqlmock.AnyArg(), "e@x", "F", "L", sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	u, err := svc.CreateUser(ctx, models.CreateUserRequest{Email: "e@x", FirstName: "F", LastName: "L"})
+	if err != nil {
+		t.Fatalf("create err: %v", err)
+	}
+
+	// Served from the cache filled by CreateUser
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users ")).
+		WithArgs("new@x", "F", "L", sqlmock.AnyArg(), u.ID).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	email := "new@x"
+	if _, err := svc.UpdateUser(ctx, u.ID, models.UpdateUserRequest{Email: &email}); err != nil {
+		t.Fatalf("update err: %v", err)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET deleted_at = $1, updated_at = $2 WHERE id = $3 AND deleted_at IS NULL")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), u.ID).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	if err := svc.DeleteUser(ctx, u.ID); err != nil {
+		t.Fatalf("delete err: %v", err)
+	}
+
+	if len(audit.entries) != 3 {
+		t.Fatalf("expected 3 audit entries, got %d", len(audit.entries))
+	}
+	created, updated, deleted := audit.entries[0], audit.entries[1], audit.entries[2]
+	if created.Action != models.UserAuditCreated || created.Changes["email"].New != "e@x" || created.Changes["email"].Old != nil {
+		t.Fatalf("unexpected create entry: %+v", created)
+	}
+	if updated.Action != models.UserAuditUpdated || len(updated.Changes) != 1 ||
+		updated.Changes["email"] != (models.FieldChange{Old: "e@x", New: "new@x"}) {
+		t.Fatalf("unexpected update entry: %+v", updated)
+	}
+	if deleted.Action != models.UserAuditDeleted || deleted.UserID != u.ID {
+		t.Fatalf("unexpected delete entry: %+v", deleted)
+	}
+	for _, entry := range audit.entries {
+		if entry.ActorID == nil || *entry.ActorID != actor || entry.RequestID != "req-1" {
+			t.Fatalf("expected actor and request id on %+v", entry)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
+
+func TestUserService_ListUsers_ListCache(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	store := cache.NewMemoryCache()
+	svc := NewUserService(repository.NewPostgresUserRepository(db), store, &stubProducer{}, logrus.New())
+	svc.SetListCache(true)
+
+	live, deleted := uuid.New(), uuid.New()
+	deletedAt := time.Now()
+	filter := models.UserFilter{IncludeDeleted: true}
+	expectPage := func() {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM users")).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id \n\t\tFROM users")).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(deleted).AddRow(live))
+	}
+
+	// Cold cache: both users are read with one query, the live one is cached
+	expectPage()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM users WHERE id IN ($1, $2)")).
+		WithArgs(deleted, live).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "first_name", "last_name", "is_active", "created_at", "updated_at", "deleted_at"}).
+			AddRow(live, "a@example.com", "A", "A", true, time.Now(), time.Now(), nil).
+			AddRow(deleted, "d@example.com", "D", "D", true, time.Now(), time.Now(), deletedAt))
+	out, err := svc.ListUsers(context.Background(), 1, 10, filter, nil)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(out.Users) != 2 || out.Users[0].ID != deleted || out.Users[0].DeletedAt == nil || out.Users[1].ID != live {
+		t.Fatalf("unexpected page %+v", out.Users)
+	}
+	if _, err := store.Get(context.Background(), "user:"+deleted.String()); !errors.Is(err, cache.ErrMiss) {
+		t.Fatalf("deleted users must not be cached, got %v", err)
+	}
+
+	// Warm cache: only the deleted user is read again
+	expectPage()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM users WHERE id IN ($1)")).
+		WithArgs(deleted).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "first_name", "last_name", "is_active", "created_at", "updated_at", "deleted_at"}).
+			AddRow(deleted, "d@example.com", "D", "D", true, time.Now(), time.Now(), deletedAt))
+	out, err = svc.ListUsers(context.Background(), 1, 10, filter, nil)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(out.Users) != 2 || out.Users[1].Email != "a@example.com" || !out.Users[1].IsActive {
+		t.Fatalf("unexpected cached page %+v", out.Users)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("sql expectations: %v", err)
+	}
+}
@@ -0,0 +1,285 @@
+package siem
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"highload-microservice/internal/security"
+)
+
+// Message formats
+const (
+	FormatCEF    = "cef"    // ArcSight Common Event Format
+	FormatLEEF   = "leef"   // QRadar Log Event Extended Format 1.0
+	FormatSyslog = "syslog" // the event as JSON
+)
+
+const (
+	vendor  = "highload-microservice"
+	product = "security-auditor"
+	version = "1.0"
+
+	// syslog facility of every message: security/authorization (authpriv)
+	facility = 10
+)
+
+// formatter renders events and alerts as the MSG part of a syslog message
+type formatter interface {
+	event(event security.SecurityEvent) string
+	alert(alert security.SecurityAlert) string
+}
+
+func newFormatter(format string) (formatter, error) {
+	switch format {
+	case FormatCEF:
+		return cefFormatter{}, nil
+	case FormatLEEF:
+		return leefFormatter{}, nil
+	case FormatSyslog:
+		return jsonFormatter{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported SIEM format: %s", format)
+	}
+}
+
+// syslogLine wraps msg in an RFC 5424 header: <PRI>1 TIMESTAMP HOST APP - MSGID - MSG
+func syslogLine(severity security.SecuritySeverity, at time.Time, host, msgID, msg string) string {
+	pri := facility*8 + syslogSeverity(severity)
+	return fmt.Sprintf("<%d>1 %s %s %s - %s - %s", pri, at.UTC().Format(time.RFC3339Nano),
+		printable(host, 255), vendor, printable(msgID, 32), msg)
+}
+
+// syslogSeverity maps severities to syslog levels: critical is crit,
+// high err, medium warning and low informational
+func syslogSeverity(severity security.SecuritySeverity) int {
+	switch severity {
+	case security.SeverityCritical:
+		return 2
+	case security.SeverityHigh:
+		return 3
+	case security.SeverityMedium:
+		return 4
+	default:
+		return 6
+	}
+}
+
+// numericSeverity maps severities to the 0-10 scale of CEF and LEEF
+func numericSeverity(severity security.SecuritySeverity) int {
+	switch severity {
+	case security.SeverityCritical:
+		return 10
+	case security.SeverityHigh:
+		return 8
+	case security.SeverityMedium:
+		return 5
+	default:
+		return 3
+	}
+}
+
+// printable keeps a syslog header field to printable ASCII of at most max
+// characters; an empty field is "-"
+func printable(s string, max int) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r > 32 && r < 127 && b.Len() < max {
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() == 0 {
+		return "-"
+	}
+	return b.String()
+}
+
+// detailsJSON returns details as compact JSON with sorted keys
+func detailsJSON(details map[string]interface{}) string {
+	if len(details) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(details)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// cefFormatter renders CEF:0|vendor|product|version|signature|name|severity|extension
+type cefFormatter struct{}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+func (cefFormatter) event(event security.SecurityEvent) string {
+	ext := []string{
+		"rt", strconv.FormatInt(event.Timestamp.UnixMilli(), 10),
+		"externalId", event.ID,
+		"src", event.IPAddress,
+		"requestClientApplication", event.UserAgent,
+		"request", event.Endpoint,
+		"requestMethod", event.Method,
+		"msg", detailsJSON(event.Details),
+	}
+	ext = labeled(ext, "cs1", "requestId", event.RequestID)
+	ext = labeled(ext, "cn1", "riskScore", strconv.Itoa(event.RiskScore))
+	if event.UserID != nil {
+		ext = append(ext, "suid", event.UserID.String())
+	}
+	if event.Status != 0 {
+		ext = labeled(ext, "cn2", "httpStatus", strconv.Itoa(event.Status))
+	}
+	if event.Blocked {
+		ext = append(ext, "act", "blocked")
+	}
+	if event.Geo != nil {
+		ext = labeled(ext, "cs2", "country", event.Geo.Country)
+	}
+	return cef(string(event.EventType), string(event.EventType), event.Severity, ext)
+}
+
+func (cefFormatter) alert(alert security.SecurityAlert) string {
+	ext := []string{
+		"rt", strconv.FormatInt(alert.Timestamp.UnixMilli(), 10),
+		"externalId", alert.ID,
+		"msg", alert.Description,
+	}
+	ext = labeled(ext, "cn1", "riskScore", strconv.Itoa(alert.RiskScore))
+	ext = labeled(ext, "cs1", "eventIds", strings.Join(alert.EventIDs, ","))
+	ext = labeled(ext, "cs2", "actions", strings.Join(alert.Actions, ","))
+	ext = labeled(ext, "cs3", "eventType", string(alert.EventType))
+	return cef("alert", alert.Title, alert.Severity, ext)
+}
+
+// labeled adds a CEF custom field with its label, unless value is empty
+func labeled(ext []string, key, label, value string) []string {
+	if value == "" {
+		return ext
+	}
+	return append(ext, key+"Label", label, key, value)
+}
+
+// cef joins the header and the key=value extension, skipping empty values
+func cef(signature, name string, severity security.SecuritySeverity, ext []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CEF:0|%s|%s|%s|%s|%s|%d|", vendor, product, version,
+		cefHeaderEscaper.Replace(signature), cefHeaderEscaper.Replace(name), numericSeverity(severity))
+	first := true
+	for i := 0; i+1 < len(ext); i += 2 {
+		if ext[i+1] == "" {
+			continue
+		}
+		if !first {
+			b.WriteByte(' ')
+		}
+		first = false
+		b.WriteString(ext[i])
+		b.WriteByte('=')
+		b.WriteString(cefExtensionEscaper.Replace(ext[i+1]))
+	}
+	return b.String()
+}
+
+// leefFormatter renders LEEF:1.0|vendor|product|version|eventID|attributes,
+// attributes separated by tabs
+type leefFormatter struct{}
+
+var (
+	leefHeaderEscaper = strings.NewReplacer(`|`, `\|`, "\n", " ", "\r", " ", "\t", " ")
+	leefValueEscaper  = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+)
+
+func (leefFormatter) event(event security.SecurityEvent) string {
+	attrs := map[string]string{
+		"devTime":       strconv.FormatInt(event.Timestamp.UnixMilli(), 10),
+		"devTimeFormat": "epoch_ms",
+		"cat":           string(event.EventType),
+		"sev":           strconv.Itoa(numericSeverity(event.Severity)),
+		"src":           event.IPAddress,
+		"url":           event.Endpoint,
+		"method":        event.Method,
+		"userAgent":     event.UserAgent,
+		"requestId":     event.RequestID,
+		"eventId":       event.ID,
+		"riskScore":     strconv.Itoa(event.RiskScore),
+		"details":       detailsJSON(event.Details),
+	}
+	if event.UserID != nil {
+		attrs["usrName"] = event.UserID.String()
+	}
+	if event.Status != 0 {
+		attrs["httpStatus"] = strconv.Itoa(event.Status)
+	}
+	if event.Blocked {
+		attrs["action"] = "blocked"
+	}
+	if event.Geo != nil && event.Geo.Country != "" {
+		attrs["srcCountry"] = event.Geo.Country
+	}
+	return leef(string(event.EventType), attrs)
+}
+
+func (leefFormatter) alert(alert security.SecurityAlert) string {
+	return leef("alert", map[string]string{
+		"devTime":       strconv.FormatInt(alert.Timestamp.UnixMilli(), 10),
+		"devTimeFormat": "epoch_ms",
+		"cat":           "alert",
+		"sev":           strconv.Itoa(numericSeverity(alert.Severity)),
+		"alertId":       alert.ID,
+		"title":         alert.Title,
+		"description":   alert.Description,
+		"riskScore":     strconv.Itoa(alert.RiskScore),
+		"eventIds":      strings.Join(alert.EventIDs, ","),
+		"actions":       strings.Join(alert.Actions, ","),
+		"eventType":     string(alert.EventType),
+	})
+}
+
+// leef joins the header and the attributes in key order, skipping empty values
+func leef(eventID string, attrs map[string]string) string {
+	keys := make([]string, 0, len(attrs))
+	for key, value := range attrs {
+		if value != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "LEEF:1.0|%s|%s|%s|%s|", vendor, product, version, leefHeaderEscaper.Replace(eventID))
+	for i, key := range keys {
+		if i > 0 {
+			b.WriteByte('\t')
+		}
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(leefValueEscaper.Replace(attrs[key]))
+	}
+	return b.String()
+}
+
+// jsonFormatter renders the event or alert as JSON, with "kind" telling
+// them apart
+type jsonFormatter struct{}
+
+func (jsonFormatter) event(event security.SecurityEvent) string {
+	return marshalKind("event", event)
+}
+
+func (jsonFormatter) alert(alert security.SecurityAlert) string {
+	return marshalKind("alert", alert)
+}
+
+func marshalKind(kind string, v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil || len(data) < 2 {
+		return `{"kind":"` + kind + `"}`
+	}
+	return `{"kind":"` + kind + `",` + string(data[1:])
+}
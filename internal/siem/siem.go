@@ -0,0 +1,321 @@
+// Package siem forwards security events and alerts to a SIEM as syslog
+// messages (RFC 5424) over TCP, TLS or UDP. The message body is CEF, LEEF or
+// the event as JSON. Events below the severity threshold are not sent.
+// Messages wait in a bounded queue while the collector is unreachable; when
+// it is full, new messages are dropped rather than slowing the auditor.
+package siem
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"highload-microservice/internal/security"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Transports
+const (
+	NetworkTCP = "tcp"
+	NetworkTLS = "tls"
+	NetworkUDP = "udp"
+)
+
+const (
+	defaultQueueSize = 10000
+	defaultTimeout   = 10 * time.Second
+	maxBackoff       = 30 * time.Second
+)
+
+// Config selects the collector, the format and what is forwarded
+type Config struct {
+	Network     string // tcp, tls or udp
+	Address     string // host:port
+	Format      string // cef, leef or syslog
+	MinSeverity security.SecuritySeverity
+	Alerts      bool   // forward alerts as well as events
+	TLSCAFile   string // CA bundle of the collector's certificate; system roots when empty
+	Hostname    string // HOSTNAME of the syslog header; the host name when empty
+	QueueSize   int
+	Timeout     time.Duration // dial and write timeout
+}
+
+// Stats reports the forwarder for the security health endpoint
+type Stats struct {
+	Address   string `json:"address"`
+	Format    string `json:"format"`
+	Connected bool   `json:"connected"`
+	Queued    int    `json:"queued"`
+	Sent      int64  `json:"sent"`
+	Dropped   int64  `json:"dropped"` // the queue was full
+	Failures  int64  `json:"failures"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Forwarder sends events and alerts to a collector. It implements
+// security.EventOutput.
+type Forwarder struct {
+	cfg       Config
+	format    formatter
+	tlsConfig *tls.Config
+	logger    *logrus.Logger
+	minRank   int
+
+	queue chan string
+	done  chan struct{}
+	wg    sync.WaitGroup
+	once  sync.Once
+
+	// dial is replaced in tests
+	dial func() (net.Conn, error)
+
+	connected atomic.Bool
+	dropping  atomic.Bool // warned about drops since the last connect
+	sent      atomic.Int64
+	dropped   atomic.Int64
+	failures  atomic.Int64
+	mu        sync.Mutex
+	lastError string
+}
+
+func NewForwarder(cfg Config, logger *logrus.Logger) (*Forwarder, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("SIEM address is not set")
+	}
+	format, err := newFormatter(cfg.Format)
+	if err != nil {
+		return nil, err
+	}
+	minRank := severityRank(cfg.MinSeverity)
+	if minRank == 0 {
+		return nil, fmt.Errorf("invalid SIEM severity threshold: %q", cfg.MinSeverity)
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.Hostname == "" {
+		cfg.Hostname, _ = os.Hostname()
+	}
+
+	f := &Forwarder{
+		cfg:     cfg,
+		format:  format,
+		logger:  logger,
+		minRank: minRank,
+		queue:   make(chan string, cfg.QueueSize),
+		done:    make(chan struct{}),
+	}
+	switch cfg.Network {
+	case NetworkTCP, NetworkUDP:
+	case NetworkTLS:
+		if f.tlsConfig, err = tlsConfig(cfg); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported SIEM network: %s", cfg.Network)
+	}
+	f.dial = f.dialCollector
+	return f, nil
+}
+
+func tlsConfig(cfg Config) (*tls.Config, error) {
+	host, _, err := net.SplitHostPort(cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SIEM address: %w", err)
+	}
+	config := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SIEM CA file: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in SIEM CA file %s", cfg.TLSCAFile)
+		}
+	}
+	return config, nil
+}
+
+func severityRank(s security.SecuritySeverity) int {
+	switch s {
+	case security.SeverityLow:
+		return 1
+	case security.SeverityMedium:
+		return 2
+	case security.SeverityHigh:
+		return 3
+	case security.SeverityCritical:
+		return 4
+	}
+	return 0
+}
+
+// Start connects and sends queued messages until Stop is called
+func (f *Forwarder) Start() {
+	f.wg.Add(1)
+	go f.run()
+}
+
+// Stop sends what is queued, giving up after the write timeout, and closes
+// the connection
+func (f *Forwarder) Stop() {
+	f.once.Do(func() { close(f.done) })
+	f.wg.Wait()
+}
+
+// SendEvent queues event if it reaches the severity threshold
+func (f *Forwarder) SendEvent(event security.SecurityEvent) {
+	if severityRank(event.Severity) < f.minRank {
+		return
+	}
+	f.enqueue(syslogLine(event.Severity, event.Timestamp, f.cfg.Hostname, string(event.EventType), f.format.event(event)))
+}
+
+// SendAlert queues alert if alerts are forwarded and it reaches the
+// severity threshold
+func (f *Forwarder) SendAlert(alert security.SecurityAlert) {
+	if !f.cfg.Alerts || severityRank(alert.Severity) < f.minRank {
+		return
+	}
+	f.enqueue(syslogLine(alert.Severity, alert.Timestamp, f.cfg.Hostname, "alert", f.format.alert(alert)))
+}
+
+func (f *Forwarder) enqueue(message string) {
+	select {
+	case f.queue <- message:
+	default:
+		// Warn once per connection rather than per message
+		f.dropped.Add(1)
+		if f.dropping.CompareAndSwap(false, true) {
+			f.logger.Warn("SIEM queue full, dropping security events")
+		}
+	}
+}
+
+func (f *Forwarder) Stats() Stats {
+	f.mu.Lock()
+	lastError := f.lastError
+	f.mu.Unlock()
+	return Stats{
+		Address:   f.cfg.Address,
+		Format:    f.cfg.Format,
+		Connected: f.connected.Load(),
+		Queued:    len(f.queue),
+		Sent:      f.sent.Load(),
+		Dropped:   f.dropped.Load(),
+		Failures:  f.failures.Load(),
+		LastError: lastError,
+	}
+}
+
+func (f *Forwarder) dialCollector() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: f.cfg.Timeout, KeepAlive: 30 * time.Second}
+	if f.tlsConfig != nil {
+		return tls.DialWithDialer(dialer, "tcp", f.cfg.Address, f.tlsConfig)
+	}
+	return dialer.Dial(f.cfg.Network, f.cfg.Address)
+}
+
+func (f *Forwarder) run() {
+	defer f.wg.Done()
+
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			_ = conn.Close()
+		}
+		f.connected.Store(false)
+	}()
+
+	backoff := time.Second
+	for {
+		var message string
+		select {
+		case message = <-f.queue:
+		case <-f.done:
+			f.drain(conn)
+			return
+		}
+
+		// A message is retried until it is written or the forwarder stops
+		for {
+			if conn == nil {
+				c, err := f.dial()
+				if err != nil {
+					f.fail(fmt.Errorf("failed to connect to %s: %w", f.cfg.Address, err))
+					select {
+					case <-time.After(backoff):
+						backoff = min(backoff*2, maxBackoff)
+						continue
+					case <-f.done:
+						return
+					}
+				}
+				conn, backoff = c, time.Second
+				f.connected.Store(true)
+				f.dropping.Store(false)
+				f.logger.Infof("Connected to SIEM collector %s", f.cfg.Address)
+			}
+			if err := f.write(conn, message); err != nil {
+				f.fail(err)
+				_ = conn.Close()
+				conn = nil
+				f.connected.Store(false)
+				continue
+			}
+			break
+		}
+	}
+}
+
+// drain writes the queued messages on shutdown while the connection works
+func (f *Forwarder) drain(conn net.Conn) {
+	if conn == nil {
+		return
+	}
+	deadline := time.Now().Add(f.cfg.Timeout)
+	for time.Now().Before(deadline) {
+		select {
+		case message := <-f.queue:
+			if err := f.write(conn, message); err != nil {
+				f.fail(err)
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// write sends one message: a datagram over UDP, a line over TCP and TLS
+// (non-transparent framing, as collectors expect for CEF and LEEF)
+func (f *Forwarder) write(conn net.Conn, message string) error {
+	if f.cfg.Network != NetworkUDP {
+		message += "\n"
+	}
+	_ = conn.SetWriteDeadline(time.Now().Add(f.cfg.Timeout))
+	if _, err := conn.Write([]byte(message)); err != nil {
+		return fmt.Errorf("failed to send to %s: %w", f.cfg.Address, err)
+	}
+	f.sent.Add(1)
+	return nil
+}
+
+// fail records err; reconnects back off to 30s, which bounds the log rate
+func (f *Forwarder) fail(err error) {
+	f.failures.Add(1)
+	f.logger.Warnf("SIEM forwarding failed: %v", err)
+	f.mu.Lock()
+	f.lastError = err.Error()
+	f.mu.Unlock()
+}
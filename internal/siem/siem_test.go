@@ -0,0 +1,204 @@
+package siem
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/security"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+var at = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func testEvent() security.SecurityEvent {
+	userID := uuid.MustParse("11111111-2222-3333-4444-555555555555")
+	return security.SecurityEvent{
+		ID:        "e1",
+		Timestamp: at,
+		EventType: security.EventTypeLoginFailure,
+		Severity:  security.SeverityMedium,
+		UserID:    &userID,
+		IPAddress: "203.0.113.7",
+		Endpoint:  "/api/v1/auth/login",
+		Method:    "POST",
+		Status:    401,
+		Details:   map[string]interface{}{"reason": "a=b\nc"},
+		RiskScore: 40,
+	}
+}
+
+func TestSyslogLine(t *testing.T) {
+	got := syslogLine(security.SeverityHigh, at, "api 1", "login_failure", "body")
+	want := "<83>1 2024-03-01T12:00:00Z api1 highload-microservice - login_failure - body"
+	if got != want {
+		t.Errorf("syslogLine = %q\nwant %q", got, want)
+	}
+	if got := syslogLine(security.SeverityLow, at, "", "", "x"); !strings.HasPrefix(got, "<86>1 ") || !strings.Contains(got, " - highload-microservice - - - x") {
+		t.Errorf("empty host and msgid: %q", got)
+	}
+}
+
+func TestCEF(t *testing.T) {
+	got := cefFormatter{}.event(testEvent())
+	want := `CEF:0|highload-microservice|security-auditor|1.0|login_failure|login_failure|5|` +
+		`rt=1709294400000 externalId=e1 src=203.0.113.7 request=/api/v1/auth/login requestMethod=POST ` +
+		`msg={"reason":"a\=b\\nc"} cn1Label=riskScore cn1=40 suid=11111111-2222-3333-4444-555555555555 cn2Label=httpStatus cn2=401`
+	if got != want {
+		t.Errorf("CEF event = %s\nwant %s", got, want)
+	}
+
+	alert := cefFormatter{}.alert(security.SecurityAlert{ID: "a1", Timestamp: at, Severity: security.SeverityCritical, Title: "Brute|force"})
+	if !strings.HasPrefix(alert, `CEF:0|highload-microservice|security-auditor|1.0|alert|Brute\|force|10|rt=1709294400000 externalId=a1`) {
+		t.Errorf("CEF alert = %s", alert)
+	}
+}
+
+func TestLEEF(t *testing.T) {
+	event := testEvent()
+	event.UserAgent = "curl\t8"
+	got := leefFormatter{}.event(event)
+	header, attrs, _ := strings.Cut(got, "|login_failure|")
+	if header != "LEEF:1.0|highload-microservice|security-auditor|1.0" {
+		t.Fatalf("LEEF header = %q", header)
+	}
+	fields := strings.Split(attrs, "\t")
+	for _, want := range []string{"cat=login_failure", "sev=5", "src=203.0.113.7", "httpStatus=401", "userAgent=curl 8", `details={"reason":"a=b\nc"}`} {
+		found := false
+		for _, field := range fields {
+			found = found || field == want
+		}
+		if !found {
+			t.Errorf("LEEF attributes %q lack %q", fields, want)
+		}
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(jsonFormatter{}.event(testEvent())), &decoded); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if decoded["kind"] != "event" || decoded["event_type"] != "login_failure" {
+		t.Errorf("JSON event = %v", decoded)
+	}
+}
+
+func TestNewForwarder_Validates(t *testing.T) {
+	valid := Config{Network: NetworkTCP, Address: "127.0.0.1:514", Format: FormatCEF, MinSeverity: security.SeverityMedium}
+	if _, err := NewForwarder(valid, logrus.New()); err != nil {
+		t.Fatalf("valid config: %v", err)
+	}
+	for name, change := range map[string]func(*Config){
+		"address":  func(c *Config) { c.Address = "" },
+		"format":   func(c *Config) { c.Format = "xml" },
+		"severity": func(c *Config) { c.MinSeverity = "urgent" },
+		"network":  func(c *Config) { c.Network = "sctp" },
+		"ca file":  func(c *Config) { c.Network, c.TLSCAFile = NetworkTLS, "/nonexistent/ca.pem" },
+	} {
+		cfg := valid
+		change(&cfg)
+		if _, err := NewForwarder(cfg, logrus.New()); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestForwarder_FiltersBySeverity(t *testing.T) {
+	f, _ := NewForwarder(Config{Network: NetworkTCP, Address: "127.0.0.1:514", Format: FormatCEF, MinSeverity: security.SeverityHigh, Alerts: true}, logrus.New())
+
+	event := testEvent()
+	f.SendEvent(event)
+	event.Severity = security.SeverityCritical
+	f.SendEvent(event)
+	f.SendAlert(security.SecurityAlert{Severity: security.SeverityCritical})
+	if got := f.Stats().Queued; got != 2 {
+		t.Errorf("queued = %d, want the critical event and alert", got)
+	}
+
+	f.cfg.Alerts = false
+	f.SendAlert(security.SecurityAlert{Severity: security.SeverityCritical})
+	if got := f.Stats().Queued; got != 2 {
+		t.Errorf("queued = %d, want alerts skipped", got)
+	}
+}
+
+func TestForwarder_DropsWhenQueueIsFull(t *testing.T) {
+	f, _ := NewForwarder(Config{Network: NetworkTCP, Address: "127.0.0.1:514", Format: FormatCEF, MinSeverity: security.SeverityLow, QueueSize: 1}, logrus.New())
+	f.SendEvent(testEvent())
+	f.SendEvent(testEvent())
+	if stats := f.Stats(); stats.Queued != 1 || stats.Dropped != 1 {
+		t.Errorf("stats = %+v, want 1 queued and 1 dropped", stats)
+	}
+}
+
+func TestForwarder_SendsLinesAndReconnects(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	lines := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			scanner := bufio.NewScanner(conn)
+			// The first connection is closed after one message
+			if scanner.Scan() {
+				lines <- scanner.Text()
+			}
+			conn.Close()
+		}
+	}()
+
+	f, _ := NewForwarder(Config{Network: NetworkTCP, Address: ln.Addr().String(), Format: FormatCEF, MinSeverity: security.SeverityLow, Alerts: true, Hostname: "api-1", Timeout: time.Second}, logrus.New())
+	// Fail the first dial to exercise the retry
+	dials := 0
+	f.dial = func() (net.Conn, error) {
+		if dials++; dials == 1 {
+			return nil, errors.New("connection refused")
+		}
+		return f.dialCollector()
+	}
+	f.Start()
+	defer f.Stop()
+
+	f.SendEvent(testEvent())
+	select {
+	case line := <-lines:
+		if !strings.HasPrefix(line, "<84>1 2024-03-01T12:00:00Z api-1 highload-microservice - login_failure - CEF:0|") {
+			t.Errorf("line = %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+
+	// Writes to the closed connection fail until the forwarder reconnects
+	deadline := time.After(10 * time.Second)
+	for {
+		f.SendAlert(security.SecurityAlert{ID: "a1", Timestamp: at, Severity: security.SeverityHigh, Title: "t"})
+		select {
+		case line := <-lines:
+			if !strings.Contains(line, "|alert|t|8|") {
+				t.Errorf("line = %q", line)
+			}
+			if stats := f.Stats(); stats.Failures == 0 || stats.LastError == "" {
+				t.Errorf("stats = %+v, want the failed dial recorded", stats)
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("no message after reconnecting")
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package sqs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"highload-microservice/internal/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+)
+
+// loadAWSConfig resolves credentials through the default AWS provider chain
+// (env vars, shared config, IRSA / instance roles) for the configured region.
+func loadAWSConfig(cfg config.SQSConfig) (aws.Config, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(cfg.Region))
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	return awsCfg, nil
+}
@@ -0,0 +1,173 @@
+package sqs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"highload-microservice/internal/config"
+	"highload-microservice/internal/models"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// Consumer reads events from an SQS queue subscribed to the SNS topic.
+//
+// Messages are deleted when their event is committed; uncommitted messages
+// become visible again after the visibility timeout. Messages that cannot be
+// decoded are left on the queue too; once they have been received
+// MaxReceiveCount times they are moved to the dead-letter queue (if
+// configured) and deleted.
+type Consumer struct {
+	client            *sqs.Client
+	queueURL          string
+	dlqURL            string
+	visibilityTimeout int32
+	waitTimeSeconds   int32
+	maxReceiveCount   int
+
+	mu     sync.Mutex
+	buffer []types.Message
+}
+
+func NewConsumer(cfg config.SQSConfig) (*Consumer, error) {
+	if cfg.QueueURL == "" {
+		return nil, fmt.Errorf("SQS_QUEUE_URL is required for the sqs messaging backend")
+	}
+
+	awsCfg, err := loadAWSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	client := sqs.NewFromConfig(awsCfg, func(o *sqs.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+	})
+
+	return &Consumer{
+		client:            client,
+		queueURL:          cfg.QueueURL,
+		dlqURL:            cfg.DLQURL,
+		visibilityTimeout: int32(cfg.VisibilityTimeout), // #nosec G115 -- small config value
+		waitTimeSeconds:   int32(cfg.WaitTimeSeconds),   // #nosec G115 -- small config value
+		maxReceiveCount:   cfg.MaxReceiveCount,
+	}, nil
+}
+
+// FetchMessage reads the next event. The returned commit deletes the message
+// from the queue.
+func (c *Consumer) FetchMessage(ctx context.Context) (models.KafkaEvent, func(context.Context) error, error) {
+	var event models.KafkaEvent
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.buffer) == 0 {
+		if err := c.receive(ctx); err != nil {
+			return event, nil, err
+		}
+	}
+
+	message := c.buffer[0]
+	c.buffer = c.buffer[1:]
+
+	event, err := decodeMessage(aws.ToString(message.Body))
+	if err != nil {
+		c.handleUndecodable(ctx, message)
+		return event, nil, fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+
+	commit := func(ctx context.Context) error {
+		if _, err := c.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(c.queueURL),
+			ReceiptHandle: message.ReceiptHandle,
+		}); err != nil {
+			return fmt.Errorf("failed to delete message: %w", err)
+		}
+		return nil
+	}
+
+	return event, commit, nil
+}
+
+func (c *Consumer) Close() error {
+	return nil
+}
+
+// receive long-polls the queue and fills the local buffer.
+func (c *Consumer) receive(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to read message: %w", err)
+	}
+
+	output, err := c.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(c.queueURL),
+		MaxNumberOfMessages: 10,
+		VisibilityTimeout:   c.visibilityTimeout,
+		WaitTimeSeconds:     c.waitTimeSeconds,
+		MessageSystemAttributeNames: []types.MessageSystemAttributeName{
+			types.MessageSystemAttributeNameApproximateReceiveCount,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read message: %w", err)
+	}
+
+	c.buffer = append(c.buffer, output.Messages...)
+	return nil
+}
+
+// handleUndecodable moves poison messages to the DLQ once they have exhausted
+// their receive budget; otherwise they are retried after the visibility timeout.
+func (c *Consumer) handleUndecodable(ctx context.Context, message types.Message) {
+	if c.dlqURL == "" {
+		return
+	}
+
+	receiveCount, _ := strconv.Atoi(message.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+	if receiveCount < c.maxReceiveCount {
+		return
+	}
+
+	if _, err := c.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(c.dlqURL),
+		MessageBody: message.Body,
+	}); err != nil {
+		return
+	}
+
+	_, _ = c.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(c.queueURL),
+		ReceiptHandle: message.ReceiptHandle,
+	})
+}
+
+// snsEnvelope is the wrapper SNS adds around messages unless raw message
+// delivery is enabled on the subscription.
+type snsEnvelope struct {
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+}
+
+// decodeMessage decodes an event from an SQS body, unwrapping the SNS
+// notification envelope when present.
+func decodeMessage(body string) (models.KafkaEvent, error) {
+	var event models.KafkaEvent
+
+	var envelope snsEnvelope
+	if err := json.Unmarshal([]byte(body), &envelope); err == nil && envelope.Type == "Notification" {
+		body = envelope.Message
+	}
+
+	if err := json.Unmarshal([]byte(body), &event); err != nil {
+		return event, err
+	}
+
+	return event, nil
+}
@@ -0,0 +1,44 @@
+package sqs
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestDecodeMessage_Raw(t *testing.T) {
+	want := models.KafkaEvent{ID: uuid.New(), UserID: uuid.New(), Type: "user_created", Data: "{}", Timestamp: time.Now().UTC()}
+	body, _ := json.Marshal(want)
+
+	got, err := decodeMessage(string(body))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.ID != want.ID || got.Type != want.Type {
+		t.Fatalf("unexpected event: %+v", got)
+	}
+}
+
+func TestDecodeMessage_SNSEnvelope(t *testing.T) {
+	want := models.KafkaEvent{ID: uuid.New(), UserID: uuid.New(), Type: "user_updated", Data: "{}", Timestamp: time.Now().UTC()}
+	inner, _ := json.Marshal(want)
+	body, _ := json.Marshal(map[string]string{"Type": "Notification", "Message": string(inner)})
+
+	got, err := decodeMessage(string(body))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.ID != want.ID || got.Type != want.Type {
+		t.Fatalf("unexpected event: %+v", got)
+	}
+}
+
+func TestDecodeMessage_Invalid(t *testing.T) {
+	if _, err := decodeMessage("not-json"); err == nil {
+		t.Fatalf("expected error")
+	}
+}
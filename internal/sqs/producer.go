@@ -0,0 +1,96 @@
+package sqs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"highload-microservice/internal/config"
+	"highload-microservice/internal/models"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+// Producer publishes events to an SNS topic, which fans them out to every
+// subscribed SQS queue.
+type Producer struct {
+	client   *sns.Client
+	topicARN string
+	fifo     bool
+}
+
+func NewProducer(cfg config.SQSConfig) (*Producer, error) {
+	if cfg.TopicARN == "" {
+		return nil, fmt.Errorf("SNS_TOPIC_ARN is required for the sqs messaging backend")
+	}
+
+	awsCfg, err := loadAWSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	client := sns.NewFromConfig(awsCfg, func(o *sns.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+	})
+
+	return &Producer{
+		client:   client,
+		topicARN: cfg.TopicARN,
+		fifo:     strings.HasSuffix(cfg.TopicARN, ".fifo"),
+	}, nil
+}
+
+// Ping checks that the SNS topic is reachable
+func (p *Producer) Ping(ctx context.Context) error {
+	if _, err := p.client.GetTopicAttributes(ctx, &sns.GetTopicAttributesInput{TopicArn: aws.String(p.topicARN)}); err != nil {
+		return fmt.Errorf("failed to get topic attributes: %w", err)
+	}
+	return nil
+}
+
+func (p *Producer) SendEvent(ctx context.Context, event models.KafkaEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	input := &sns.PublishInput{
+		TopicArn: aws.String(p.topicARN),
+		Message:  aws.String(string(data)),
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"event_type": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(event.Type),
+			},
+		},
+	}
+
+	if event.RequestID != "" {
+		input.MessageAttributes["request_id"] = types.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(event.RequestID),
+		}
+	}
+
+	// FIFO topics need a group (ordering per user, like the Kafka key) and a
+	// deduplication ID.
+	if p.fifo {
+		input.MessageGroupId = aws.String(event.UserID.String())
+		input.MessageDeduplicationId = aws.String(event.ID.String())
+	}
+
+	if _, err := p.client.Publish(ctx, input); err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+
+	return nil
+}
+
+func (p *Producer) Close() error {
+	return nil
+}
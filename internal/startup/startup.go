@@ -0,0 +1,98 @@
+// Package startup waits for the service's dependencies when it starts.
+// Orchestrators start containers in no particular order, so Postgres, Redis
+// or the broker may still be coming up; instead of exiting on the first
+// failed connection the service retries each one with backoff for a bounded
+// time.
+package startup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Dependency is a service that is checked until it answers
+type Dependency struct {
+	Name string
+	// Required dependencies must answer within the wait; the service starts
+	// without optional ones and they recover on their own
+	Required bool
+	Check    func(ctx context.Context) error
+}
+
+// Config bounds the wait for each dependency
+type Config struct {
+	Timeout        time.Duration // total wait per dependency; 0 = a single attempt
+	AttemptTimeout time.Duration // per check
+	InitialBackoff time.Duration // first delay between checks, doubled up to MaxBackoff
+	MaxBackoff     time.Duration
+}
+
+// Waiter checks dependencies with retries and logs the progress of startup
+type Waiter struct {
+	cfg    Config
+	logger *logrus.Logger
+}
+
+// NewWaiter creates a waiter, filling in defaults for unset delays
+func NewWaiter(cfg Config, logger *logrus.Logger) *Waiter {
+	if cfg.AttemptTimeout <= 0 {
+		cfg.AttemptTimeout = 5 * time.Second
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 500 * time.Millisecond
+	}
+	if cfg.MaxBackoff < cfg.InitialBackoff {
+		cfg.MaxBackoff = 10 * time.Second
+	}
+	return &Waiter{cfg: cfg, logger: logger}
+}
+
+// Wait checks dep until it answers or the wait runs out. It reports whether
+// dep is available; the error is set only for a required dependency that
+// never answered (or when ctx is cancelled).
+func (w *Waiter) Wait(ctx context.Context, dep Dependency) (bool, error) {
+	start := time.Now()
+	deadline := start.Add(w.cfg.Timeout)
+	backoff := w.cfg.InitialBackoff
+
+	w.logger.Infof("Startup: waiting for %s", dep.Name)
+	for attempt := 1; ; attempt++ {
+		checkCtx, cancel := context.WithTimeout(ctx, w.cfg.AttemptTimeout)
+		err := dep.Check(checkCtx)
+		cancel()
+		if err == nil {
+			w.logger.Infof("Startup: %s is available (attempt %d, %s)", dep.Name, attempt, time.Since(start).Round(time.Millisecond))
+			return true, nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			if dep.Required {
+				return false, fmt.Errorf("%s unavailable after %d attempts: %w", dep.Name, attempt, err)
+			}
+			w.logger.Warnf("Startup: %s unavailable after %d attempts, continuing without it: %v", dep.Name, attempt, err)
+			return false, nil
+		}
+
+		delay := min(backoff, remaining)
+		w.logger.Warnf("Startup: %s unavailable (attempt %d), retrying in %s: %v", dep.Name, attempt, delay, err)
+		if err := sleep(ctx, delay); err != nil {
+			return false, err
+		}
+		backoff = min(backoff*2, w.cfg.MaxBackoff)
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
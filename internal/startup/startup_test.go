@@ -0,0 +1,79 @@
+package startup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func testWaiter(timeout time.Duration) *Waiter {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return NewWaiter(Config{Timeout: timeout, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}, logger)
+}
+
+func TestWaiter_RetriesUntilAvailable(t *testing.T) {
+	attempts := 0
+	available, err := testWaiter(time.Second).Wait(context.Background(), Dependency{
+		Name:     "database",
+		Required: true,
+		Check: func(ctx context.Context) error {
+			attempts++
+			if attempts < 3 {
+				return errors.New("connection refused")
+			}
+			return nil
+		},
+	})
+	if err != nil || !available {
+		t.Fatalf("expected database to become available, got %v, %v", available, err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestWaiter_GivesUp(t *testing.T) {
+	down := func(ctx context.Context) error { return errors.New("connection refused") }
+
+	available, err := testWaiter(20*time.Millisecond).Wait(context.Background(), Dependency{Name: "cache", Required: true, Check: down})
+	if err == nil || available {
+		t.Fatalf("expected an error for a required dependency, got %v, %v", available, err)
+	}
+
+	available, err = testWaiter(20*time.Millisecond).Wait(context.Background(), Dependency{Name: "messaging", Check: down})
+	if err != nil || available {
+		t.Fatalf("expected an optional dependency to be skipped, got %v, %v", available, err)
+	}
+}
+
+func TestWaiter_SingleAttempt(t *testing.T) {
+	attempts := 0
+	_, err := testWaiter(0).Wait(context.Background(), Dependency{
+		Name:     "database",
+		Required: true,
+		Check: func(ctx context.Context) error {
+			attempts++
+			return errors.New("connection refused")
+		},
+	})
+	if err == nil || attempts != 1 {
+		t.Fatalf("expected one failed attempt, got %d, %v", attempts, err)
+	}
+}
+
+func TestWaiter_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := testWaiter(time.Minute).Wait(ctx, Dependency{
+		Name:  "database",
+		Check: func(ctx context.Context) error { return ctx.Err() },
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
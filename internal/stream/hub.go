@@ -0,0 +1,116 @@
+// Package stream fans out consumed events to live subscribers such as
+// WebSocket connections.
+package stream
+
+import (
+	"sync"
+
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// defaultBuffer is the number of events queued per subscriber before new
+// events are dropped for it
+const defaultBuffer = 64
+
+// Filter selects the events a subscriber receives. Empty fields match all.
+type Filter struct {
+	Types  map[string]bool
+	UserID uuid.UUID
+}
+
+// Matches reports whether the event passes the filter
+func (f Filter) Matches(event models.KafkaEvent) bool {
+	if len(f.Types) > 0 && !f.Types[event.Type] {
+		return false
+	}
+	if f.UserID != uuid.Nil && f.UserID != event.UserID {
+		return false
+	}
+	return true
+}
+
+// Subscription receives matching events on C until Close is called
+type Subscription struct {
+	C <-chan models.KafkaEvent
+
+	hub     *Hub
+	ch      chan models.KafkaEvent
+	filter  Filter
+	dropped uint64
+	once    sync.Once
+}
+
+// Close unsubscribes; C is closed afterwards
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.hub.mu.Lock()
+		delete(s.hub.subs, s)
+		s.hub.mu.Unlock()
+		close(s.ch)
+	})
+}
+
+// Dropped returns how many events were skipped because the subscriber was slow
+func (s *Subscription) Dropped() uint64 {
+	s.hub.mu.RLock()
+	defer s.hub.mu.RUnlock()
+	return s.dropped
+}
+
+// Hub broadcasts events to subscriptions
+type Hub struct {
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	buffer int
+}
+
+// NewHub creates a hub; buffer <= 0 uses the default per-subscriber buffer
+func NewHub(buffer int) *Hub {
+	if buffer <= 0 {
+		buffer = defaultBuffer
+	}
+	return &Hub{
+		subs:   make(map[*Subscription]struct{}),
+		buffer: buffer,
+	}
+}
+
+// Subscribe registers a subscriber for events matching filter
+func (h *Hub) Subscribe(filter Filter) *Subscription {
+	ch := make(chan models.KafkaEvent, h.buffer)
+	sub := &Subscription{C: ch, hub: h, ch: ch, filter: filter}
+
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+
+	return sub
+}
+
+// Publish delivers the event to every matching subscriber without blocking.
+// Subscribers whose buffer is full miss the event.
+func (h *Hub) Publish(event models.KafkaEvent) {
+	// Write lock: dropped counters are updated and Close must not race a send
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subs {
+		if !sub.filter.Matches(event) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			sub.dropped++
+		}
+	}
+}
+
+// Subscribers returns the number of active subscriptions
+func (h *Hub) Subscribers() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subs)
+}
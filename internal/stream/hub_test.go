@@ -0,0 +1,49 @@
+package stream
+
+import (
+	"testing"
+
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestHub_FiltersByTypeAndUser(t *testing.T) {
+	hub := NewHub(4)
+	user := uuid.New()
+
+	all := hub.Subscribe(Filter{})
+	defer all.Close()
+	logins := hub.Subscribe(Filter{Types: map[string]bool{"login": true}, UserID: user})
+	defer logins.Close()
+
+	hub.Publish(models.KafkaEvent{Type: "login", UserID: user})
+	hub.Publish(models.KafkaEvent{Type: "login", UserID: uuid.New()})
+	hub.Publish(models.KafkaEvent{Type: "purchase", UserID: user})
+
+	if got := len(all.C); got != 3 {
+		t.Fatalf("unfiltered subscriber: want 3 events, got %d", got)
+	}
+	if got := len(logins.C); got != 1 {
+		t.Fatalf("filtered subscriber: want 1 event, got %d", got)
+	}
+}
+
+func TestHub_DropsForSlowSubscriber(t *testing.T) {
+	hub := NewHub(1)
+	sub := hub.Subscribe(Filter{})
+
+	hub.Publish(models.KafkaEvent{Type: "a"})
+	hub.Publish(models.KafkaEvent{Type: "b"})
+
+	if sub.Dropped() != 1 {
+		t.Fatalf("want 1 dropped event, got %d", sub.Dropped())
+	}
+
+	sub.Close()
+	sub.Close() // idempotent
+	if hub.Subscribers() != 0 {
+		t.Fatalf("subscription not removed")
+	}
+	hub.Publish(models.KafkaEvent{Type: "c"}) // must not panic on closed channel
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
-	"unicode"
+	"sync/atomic"
+
+	"highload-microservice/internal/password"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -12,14 +14,22 @@ import (
 // CustomValidator wraps the validator with custom validation rules
 type CustomValidator struct {
 	validator *validator.Validate
+	passwords atomic.Pointer[password.Checker]
 }
 
-// NewCustomValidator creates a new custom validator
+// NewCustomValidator creates a new custom validator. strong_password checks
+// the default password policy until SetPasswordChecker is called.
 func NewCustomValidator() (*CustomValidator, error) {
 	v := validator.New()
+	cv := &CustomValidator{validator: v}
+	checker, err := password.NewChecker(password.DefaultPolicy(), nil)
+	if err != nil {
+		return nil, err
+	}
+	cv.passwords.Store(checker)
 
 	// Register custom validations
-	if err := v.RegisterValidation("strong_password", validateStrongPassword); err != nil {
+	if err := v.RegisterValidation("strong_password", cv.validateStrongPassword); err != nil {
 		return nil, fmt.Errorf("failed to register strong_password validation: %w", err)
 	}
 	if err := v.RegisterValidation("safe_string", validateSafeString); err != nil {
@@ -38,9 +48,14 @@ func NewCustomValidator() (*CustomValidator, error) {
 		return nil, fmt.Errorf("failed to register no_xss validation: %w", err)
 	}
 
-	return &CustomValidator{
-		validator: v,
-	}, nil
+	return cv, nil
+}
+
+// SetPasswordChecker makes strong_password check the configured password
+// policy. The account's details are not known to the validator, so
+// similarity to them is checked where the password is set.
+func (cv *CustomValidator) SetPasswordChecker(checker *password.Checker) {
+	cv.passwords.Store(checker)
 }
 
 // Validate validates a struct
@@ -53,58 +68,9 @@ func (cv *CustomValidator) ValidateVar(field interface{}, tag string) error {
 	return cv.validator.Var(field, tag)
 }
 
-// validateStrongPassword validates password strength
-func validateStrongPassword(fl validator.FieldLevel) bool {
-	password := fl.Field().String()
-
-	// Minimum length
-	if len(password) < 8 {
-		return false
-	}
-
-	// Maximum length
-	if len(password) > 128 {
-		return false
-	}
-
-	// Check for at least one uppercase letter
-	hasUpper := false
-	// Check for at least one lowercase letter
-	hasLower := false
-	// Check for at least one digit
-	hasDigit := false
-	// Check for at least one special character
-	hasSpecial := false
-
-	for _, char := range password {
-		switch {
-		case unicode.IsUpper(char):
-			hasUpper = true
-		case unicode.IsLower(char):
-			hasLower = true
-		case unicode.IsDigit(char):
-			hasDigit = true
-		case unicode.IsPunct(char) || unicode.IsSymbol(char):
-			hasSpecial = true
-		}
-	}
-
-	// Must have at least 3 of the 4 character types
-	count := 0
-	if hasUpper {
-		count++
-	}
-	if hasLower {
-		count++
-	}
-	if hasDigit {
-		count++
-	}
-	if hasSpecial {
-		count++
-	}
-
-	return count >= 3
+// validateStrongPassword checks the password policy
+func (cv *CustomValidator) validateStrongPassword(fl validator.FieldLevel) bool {
+	return len(cv.passwords.Load().Violations(fl.Field().String(), password.UserInfo{})) == 0
 }
 
 // validateSafeString validates that string doesn't contain dangerous characters
@@ -129,6 +95,10 @@ func validateSafeString(fl validator.FieldLevel) bool {
 // validateUUID validates UUID format
 func validateUUID(fl validator.FieldLevel) bool {
 	value := fl.Field().String()
+	// uuid.UUID fields are arrays; their text comes from String
+	if s, ok := fl.Field().Interface().(fmt.Stringer); ok {
+		value = s.String()
+	}
 
 	// UUID v4 pattern
 	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
@@ -256,6 +226,8 @@ type ValidationError struct {
 	Tag     string `json:"tag"`
 	Value   string `json:"value"`
 	Message string `json:"message"`
+	// Rules of the password policy a strong_password field breaks
+	Violations []password.Violation `json:"violations,omitempty"`
 }
 
 // GetValidationErrors returns formatted validation errors
@@ -264,6 +236,17 @@ func (cv *CustomValidator) GetValidationErrors(err error) []ValidationError {
 
 	if validationErrors, ok := err.(validator.ValidationErrors); ok {
 		for _, e := range validationErrors {
+			if e.Tag() == "strong_password" {
+				// Passwords are not echoed back
+				violations := cv.passwords.Load().Violations(fmt.Sprintf("%v", e.Value()), password.UserInfo{})
+				errors = append(errors, ValidationError{
+					Field:      e.Field(),
+					Tag:        e.Tag(),
+					Message:    (&password.PolicyError{Violations: violations}).Error(),
+					Violations: violations,
+				})
+				continue
+			}
 			errors = append(errors, ValidationError{
 				Field:   e.Field(),
 				Tag:     e.Tag(),
@@ -287,8 +270,6 @@ func getErrorMessage(fe validator.FieldError) string {
 		return fmt.Sprintf("%s must be at least %s characters long", fe.Field(), fe.Param())
 	case "max":
 		return fmt.Sprintf("%s must be at most %s characters long", fe.Field(), fe.Param())
-	case "strong_password":
-		return fmt.Sprintf("%s must be a strong password (8-128 chars, at least 3 of: uppercase, lowercase, digit, special)", fe.Field())
 	case "safe_string":
 		return fmt.Sprintf("%s contains unsafe characters", fe.Field())
 	case "uuid":
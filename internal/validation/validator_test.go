@@ -2,6 +2,10 @@ package validation
 
 import (
 	"testing"
+
+	"highload-microservice/internal/password"
+
+	"github.com/google/uuid"
 )
 
 type sampleStruct struct {
@@ -39,6 +43,28 @@ func TestValidateStrongPassword(t *testing.T) {
 	}
 }
 
+func TestValidateStrongPassword_ConfiguredPolicy(t *testing.T) {
+	v := mustValidator(t)
+	policy := password.DefaultPolicy()
+	policy.MinLength = 12
+	checker, err := password.NewChecker(policy, []string{"password"})
+	if err != nil {
+		t.Fatalf("checker: %v", err)
+	}
+	v.SetPasswordChecker(checker)
+
+	err = v.Validate(&struct {
+		Password string `validate:"strong_password"`
+	}{Password: "Password1!"})
+	errs := v.GetValidationErrors(err)
+	if len(errs) != 1 || errs[0].Value != "" {
+		t.Fatalf("want one error without the password, got %+v", errs)
+	}
+	if len(errs[0].Violations) != 2 || errs[0].Violations[0].Code != "too_short" || errs[0].Violations[1].Code != "banned" {
+		t.Errorf("violations = %+v", errs[0].Violations)
+	}
+}
+
 func TestValidateSafeString(t *testing.T) {
 	v := mustValidator(t)
 	if err := v.ValidateVar("hello\nworld", "safe_string"); err != nil {
@@ -57,6 +83,9 @@ func TestValidateUUID(t *testing.T) {
 	if err := v.ValidateVar("not-a-uuid", "uuid"); err == nil {
 		t.Fatalf("expected invalid uuid")
 	}
+	if err := v.ValidateVar(uuid.New(), "uuid"); err != nil {
+		t.Fatalf("want uuid.UUID ok, got %v", err)
+	}
 }
 
 func TestValidateEmailDomain(t *testing.T) {
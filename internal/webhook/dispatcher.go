@@ -0,0 +1,203 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Request headers sent with every delivery
+const (
+	HeaderWebhookID = "X-Webhook-ID"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// maxErrorLength bounds the response excerpt stored with a failed attempt
+const maxErrorLength = 512
+
+// Sign returns the signature header of a delivery: the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the webhook secret. Receivers should
+// recompute it and reject old timestamps to prevent replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher sends due deliveries
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	cfg    Config
+	logger *logrus.Logger
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewDispatcher creates a dispatcher; client may be nil for a default client
+func NewDispatcher(store Store, cfg Config, client *http.Client, logger *logrus.Logger) *Dispatcher {
+	cfg = cfg.withDefaults()
+	if client == nil {
+		client = &http.Client{
+			Timeout: cfg.Timeout,
+			// A redirect could point a signed payload anywhere
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		}
+	}
+	return &Dispatcher{
+		store:   store,
+		client:  client,
+		cfg:     cfg,
+		logger:  logger,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Start runs the delivery loop in a goroutine until Stop is called
+func (d *Dispatcher) Start() {
+	go func() {
+		defer close(d.stopped)
+
+		ticker := time.NewTicker(d.cfg.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-d.done:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), d.cfg.Timeout+30*time.Second)
+				if n, err := d.DeliverBatch(ctx); err != nil {
+					d.logger.Errorf("Webhook delivery failed: %v", err)
+				} else if n > 0 {
+					d.logger.Debugf("Attempted %d webhook deliveries", n)
+				}
+				cancel()
+			}
+		}
+	}()
+}
+
+// Stop stops the loop and waits for the current batch to finish
+func (d *Dispatcher) Stop() {
+	close(d.done)
+	<-d.stopped
+}
+
+// DeliverBatch sends up to BatchSize due deliveries concurrently and returns
+// how many were attempted
+func (d *Dispatcher) DeliverBatch(ctx context.Context) (int, error) {
+	now := time.Now()
+	// Claimed rows come back after the lease if this instance dies mid-send
+	claims, err := d.store.ClaimDeliveries(ctx, now, now.Add(2*d.cfg.Timeout), d.cfg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for i := range claims {
+		wg.Add(1)
+		go func(claim *Claim) {
+			defer wg.Done()
+			d.attempt(ctx, claim)
+		}(&claims[i])
+	}
+	wg.Wait()
+	return len(claims), nil
+}
+
+// attempt sends a delivery once and records the outcome
+func (d *Dispatcher) attempt(ctx context.Context, claim *Claim) {
+	delivery := &claim.Delivery
+	delivery.Attempts++
+
+	var statusCode int
+	var sendErr error
+	if claim.Active {
+		statusCode, sendErr = d.send(ctx, claim)
+	} else {
+		sendErr = fmt.Errorf("webhook is disabled")
+		delivery.Attempts = d.cfg.MaxAttempts
+	}
+
+	now := time.Now()
+	delivery.LastStatusCode, delivery.UpdatedAt = statusCode, now
+	switch {
+	case sendErr == nil:
+		delivery.Status, delivery.DeliveredAt, delivery.LastError = StatusDelivered, &now, ""
+	case delivery.Attempts >= d.cfg.MaxAttempts:
+		delivery.Status, delivery.LastError = StatusFailed, sendErr.Error()
+		d.logger.Warnf("Webhook delivery %s to %s failed after %d attempts: %v", delivery.ID, claim.URL, delivery.Attempts, sendErr)
+	default:
+		delivery.LastError = sendErr.Error()
+		delivery.NextAttemptAt = now.Add(backoff(d.cfg.InitialBackoff, d.cfg.MaxBackoff, delivery.Attempts))
+		d.logger.Debugf("Webhook delivery %s attempt %d failed, retrying at %s: %v", delivery.ID, delivery.Attempts, delivery.NextAttemptAt.Format(time.RFC3339), sendErr)
+	}
+
+	if err := d.store.SaveAttempt(ctx, delivery); err != nil {
+		// The lease expires and the delivery is attempted again
+		d.logger.Errorf("Failed to record webhook delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// send POSTs the payload and returns the response status; non-2xx responses
+// are errors
+func (d *Dispatcher) send(ctx context.Context, claim *Claim) (int, error) {
+	body := []byte(claim.Delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, claim.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "highload-microservice-webhooks/1.0")
+	req.Header.Set(HeaderWebhookID, claim.Delivery.WebhookID.String())
+	req.Header.Set(HeaderDelivery, claim.Delivery.ID.String())
+	req.Header.Set(HeaderEvent, claim.Delivery.EventType)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(claim.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorLength))
+		return resp.StatusCode, fmt.Errorf("endpoint responded %d: %s", resp.StatusCode, bytes.TrimSpace(excerpt))
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16)) // lets the connection be reused
+	return resp.StatusCode, nil
+}
+
+// backoff doubles initial per attempt up to max, with jitter in the upper half
+func backoff(initial, max time.Duration, attempt int) time.Duration {
+	d := initial
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	half := d / 2
+	return half + rand.N(half+1) // #nosec G404 -- jitter, not security sensitive
+}
@@ -0,0 +1,260 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Store persists subscriptions and their deliveries
+type Store interface {
+	CreateWebhook(ctx context.Context, hook *Webhook) error
+	ListWebhooks(ctx context.Context) ([]Webhook, error)
+	GetWebhook(ctx context.Context, id uuid.UUID) (*Webhook, error)
+	UpdateWebhook(ctx context.Context, hook *Webhook) error
+	DeleteWebhook(ctx context.Context, id uuid.UUID) error
+
+	// CreateDeliveries queues deliveries, skipping events already queued
+	// for the same subscription
+	CreateDeliveries(ctx context.Context, deliveries []Delivery) error
+	// ClaimDeliveries returns up to limit pending deliveries due at now and
+	// postpones them to leaseUntil, so other instances skip them while they
+	// are being sent
+	ClaimDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]Claim, error)
+	// SaveAttempt records the outcome of a delivery attempt
+	SaveAttempt(ctx context.Context, delivery *Delivery) error
+	ListDeliveries(ctx context.Context, webhookID uuid.UUID, limit int) ([]Delivery, error)
+	// ResetDelivery makes a delivery pending again with no attempts
+	ResetDelivery(ctx context.Context, webhookID, deliveryID uuid.UUID, at time.Time) error
+}
+
+// SQLStore keeps webhooks in the webhooks and webhook_deliveries tables
+type SQLStore struct {
+	db *sql.DB
+}
+
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+const webhookColumns = `id, url, secret, event_types, is_active, created_by, created_at, updated_at`
+
+func (s *SQLStore) CreateWebhook(ctx context.Context, hook *Webhook) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO webhooks (id, url, secret, event_types, is_active, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, hook.ID, hook.URL, hook.Secret, pq.Array(hook.EventTypes), hook.IsActive, hook.CreatedBy, hook.CreatedAt, hook.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert webhook: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+webhookColumns+` FROM webhooks ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	hooks := []Webhook{}
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, *hook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	return hooks, nil
+}
+
+func (s *SQLStore) GetWebhook(ctx context.Context, id uuid.UUID) (*Webhook, error) {
+	hook, err := scanWebhook(s.db.QueryRowContext(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE id = $1`, id))
+	if err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanWebhook(row scanner) (*Webhook, error) {
+	var (
+		hook       Webhook
+		eventTypes pq.StringArray
+		createdBy  sql.NullString
+	)
+	err := row.Scan(&hook.ID, &hook.URL, &hook.Secret, &eventTypes, &hook.IsActive, &createdBy, &hook.CreatedAt, &hook.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, apperrors.NotFound("webhook not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan webhook: %w", err)
+	}
+	hook.EventTypes = []string(eventTypes)
+	if hook.EventTypes == nil {
+		hook.EventTypes = []string{}
+	}
+	if createdBy.Valid {
+		if id, err := uuid.Parse(createdBy.String); err == nil {
+			hook.CreatedBy = &id
+		}
+	}
+	return &hook, nil
+}
+
+func (s *SQLStore) UpdateWebhook(ctx context.Context, hook *Webhook) error {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE webhooks SET url = $1, event_types = $2, is_active = $3, updated_at = $4 WHERE id = $5
+	`, hook.URL, pq.Array(hook.EventTypes), hook.IsActive, hook.UpdatedAt, hook.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return apperrors.NotFound("webhook not found")
+	}
+	return nil
+}
+
+func (s *SQLStore) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	// Deliveries are removed by ON DELETE CASCADE
+	result, err := s.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return apperrors.NotFound("webhook not found")
+	}
+	return nil
+}
+
+func (s *SQLStore) CreateDeliveries(ctx context.Context, deliveries []Delivery) error {
+	for _, d := range deliveries {
+		_, err := s.db.ExecContext(ctx, `
+			INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at, last_status_code, last_error, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		`, d.ID, d.WebhookID, d.EventID, d.EventType, d.Payload, string(d.Status), 0, d.NextAttemptAt, 0, "", d.CreatedAt, d.UpdatedAt)
+		if err != nil && !apperrors.IsUniqueViolation(err) {
+			// A unique violation means the event was redelivered by the broker
+			return fmt.Errorf("failed to queue webhook delivery: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) ClaimDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]Claim, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin claim transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT d.id, d.webhook_id, d.event_id, d.event_type, d.payload, d.attempts, d.created_at, w.url, w.secret, w.is_active
+		FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.status = $1 AND d.next_attempt_at <= $2
+		ORDER BY d.next_attempt_at
+		LIMIT $3
+		FOR UPDATE OF d SKIP LOCKED
+	`, string(StatusPending), now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query due deliveries: %w", err)
+	}
+
+	var claims []Claim
+	for rows.Next() {
+		var c Claim
+		if err := rows.Scan(&c.Delivery.ID, &c.Delivery.WebhookID, &c.Delivery.EventID, &c.Delivery.EventType, &c.Delivery.Payload,
+			&c.Delivery.Attempts, &c.Delivery.CreatedAt, &c.URL, &c.Secret, &c.Active); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan delivery: %w", err)
+		}
+		c.Delivery.Status = StatusPending
+		claims = append(claims, c)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query due deliveries: %w", err)
+	}
+
+	for _, c := range claims {
+		if _, err := tx.ExecContext(ctx, `UPDATE webhook_deliveries SET next_attempt_at = $1 WHERE id = $2`, leaseUntil, c.Delivery.ID); err != nil {
+			return nil, fmt.Errorf("failed to claim delivery: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit claim transaction: %w", err)
+	}
+	return claims, nil
+}
+
+func (s *SQLStore) SaveAttempt(ctx context.Context, d *Delivery) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE webhook_deliveries SET status = $1, attempts = $2, next_attempt_at = $3, last_status_code = $4, last_error = $5, updated_at = $6, delivered_at = $7
+		WHERE id = $8
+	`, string(d.Status), d.Attempts, d.NextAttemptAt, d.LastStatusCode, d.LastError, d.UpdatedAt, d.DeliveredAt, d.ID)
+	if err != nil {
+		return fmt.Errorf("failed to record delivery attempt: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) ListDeliveries(ctx context.Context, webhookID uuid.UUID, limit int) ([]Delivery, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at, last_status_code, last_error, created_at, updated_at, delivered_at
+		FROM webhook_deliveries WHERE webhook_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, webhookID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []Delivery{}
+	for rows.Next() {
+		var (
+			d           Delivery
+			status      string
+			deliveredAt sql.NullTime
+		)
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Payload, &status, &d.Attempts, &d.NextAttemptAt,
+			&d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.UpdatedAt, &deliveredAt); err != nil {
+			return nil, fmt.Errorf("failed to scan delivery: %w", err)
+		}
+		d.Status = Status(status)
+		if deliveredAt.Valid {
+			d.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+func (s *SQLStore) ResetDelivery(ctx context.Context, webhookID, deliveryID uuid.UUID, at time.Time) error {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE webhook_deliveries SET status = $1, attempts = 0, next_attempt_at = $2, delivered_at = NULL, updated_at = $3
+		WHERE id = $4 AND webhook_id = $5
+	`, string(StatusPending), at, at, deliveryID, webhookID)
+	if err != nil {
+		return fmt.Errorf("failed to reset delivery: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return apperrors.NotFound("delivery not found")
+	}
+	return nil
+}
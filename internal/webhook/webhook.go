@@ -0,0 +1,388 @@
+// Package webhook delivers events to HTTP endpoints subscribed to them.
+//
+// Consumed events are matched against the subscriptions and queued in the
+// webhook_deliveries table. A Dispatcher on every instance claims due
+// deliveries with SKIP LOCKED and POSTs them as JSON signed with the
+// subscription's secret, retrying failures with exponential backoff until
+// MaxAttempts is reached.
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"highload-microservice/internal/apperrors"
+	"highload-microservice/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// subscriptionTTL bounds how long changes made on another instance take
+	// to affect which events are queued here
+	subscriptionTTL = 10 * time.Second
+	// minSecretLength is the shortest secret accepted from a client
+	minSecretLength = 16
+)
+
+// Status is the state of a delivery
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusDelivered Status = "delivered"
+	StatusFailed    Status = "failed" // gave up after MaxAttempts
+)
+
+// Webhook is a subscription of an endpoint to events
+type Webhook struct {
+	ID         uuid.UUID  `json:"id"`
+	URL        string     `json:"url"`
+	Secret     string     `json:"secret,omitempty"` // only returned on creation
+	EventTypes []string   `json:"event_types"`      // TYPE or PREFIX*; empty matches every event
+	IsActive   bool       `json:"is_active"`
+	CreatedBy  *uuid.UUID `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// Matches reports whether the webhook subscribes to events of eventType
+func (w *Webhook) Matches(eventType string) bool {
+	if len(w.EventTypes) == 0 {
+		return true
+	}
+	for _, pattern := range w.EventTypes {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(eventType, prefix) {
+				return true
+			}
+		} else if pattern == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery is an event queued for a webhook, with the outcome of its last attempt
+type Delivery struct {
+	ID             uuid.UUID  `json:"id"`
+	WebhookID      uuid.UUID  `json:"webhook_id"`
+	EventID        uuid.UUID  `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Payload        string     `json:"payload"`
+	Status         Status     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastStatusCode int        `json:"last_status_code,omitempty"` // 0 when no response was received
+	LastError      string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+// Claim is a due delivery with the subscription it is sent to
+type Claim struct {
+	Delivery Delivery
+	URL      string
+	Secret   string
+	Active   bool
+}
+
+// Payload is the JSON body POSTed to subscribers
+type Payload struct {
+	ID        uuid.UUID       `json:"id"` // event ID; stable across retries, for deduplication
+	Type      string          `json:"type"`
+	UserID    uuid.UUID       `json:"user_id"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Encrypted bool            `json:"encrypted,omitempty"` // payload withheld: encrypted at rest
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// Changes updates a webhook; nil fields are left as they are
+type Changes struct {
+	URL        *string
+	EventTypes []string
+	IsActive   *bool
+}
+
+// Config tunes deliveries
+type Config struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration // before the second attempt, doubled per attempt
+	MaxBackoff     time.Duration
+	Timeout        time.Duration // per request
+	PollInterval   time.Duration
+	BatchSize      int // deliveries claimed per poll and sent concurrently
+}
+
+func (c Config) withDefaults() Config {
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 8
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = 10 * time.Second
+	}
+	if c.MaxBackoff < c.InitialBackoff {
+		c.MaxBackoff = c.InitialBackoff
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = time.Second
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 50
+	}
+	return c
+}
+
+// Manager manages subscriptions and queues events for them
+type Manager struct {
+	store  Store
+	logger *logrus.Logger
+
+	mu       sync.Mutex
+	active   []Webhook
+	loadedAt time.Time
+}
+
+func NewManager(store Store, logger *logrus.Logger) *Manager {
+	return &Manager{store: store, logger: logger}
+}
+
+// Create subscribes url to eventTypes. A secret is generated when none is
+// given; it is only returned here.
+func (m *Manager) Create(ctx context.Context, rawURL string, eventTypes []string, secret string, createdBy *uuid.UUID) (*Webhook, error) {
+	if err := validateURL(rawURL); err != nil {
+		return nil, err
+	}
+	types, err := normalizeEventTypes(eventTypes)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case secret == "":
+		secret = generateSecret()
+	case len(secret) < minSecretLength:
+		return nil, apperrors.Validation(fmt.Sprintf("secret must be at least %d characters", minSecretLength))
+	}
+
+	now := time.Now()
+	hook := &Webhook{
+		ID:         uuid.New(),
+		URL:        rawURL,
+		Secret:     secret,
+		EventTypes: types,
+		IsActive:   true,
+		CreatedBy:  createdBy,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := m.store.CreateWebhook(ctx, hook); err != nil {
+		return nil, err
+	}
+	m.invalidate()
+	m.logger.Infof("Webhook %s created for %s", hook.ID, hook.URL)
+	return hook, nil
+}
+
+// List returns every webhook without its secret
+func (m *Manager) List(ctx context.Context) ([]Webhook, error) {
+	hooks, err := m.store.ListWebhooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	return hooks, nil
+}
+
+// Get returns a webhook without its secret
+func (m *Manager) Get(ctx context.Context, id uuid.UUID) (*Webhook, error) {
+	hook, err := m.store.GetWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	hook.Secret = ""
+	return hook, nil
+}
+
+// Update changes a webhook's URL, event types or state
+func (m *Manager) Update(ctx context.Context, id uuid.UUID, changes Changes) (*Webhook, error) {
+	hook, err := m.store.GetWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if changes.URL != nil {
+		if err := validateURL(*changes.URL); err != nil {
+			return nil, err
+		}
+		hook.URL = *changes.URL
+	}
+	if changes.EventTypes != nil {
+		if hook.EventTypes, err = normalizeEventTypes(changes.EventTypes); err != nil {
+			return nil, err
+		}
+	}
+	if changes.IsActive != nil {
+		hook.IsActive = *changes.IsActive
+	}
+	hook.UpdatedAt = time.Now()
+
+	if err := m.store.UpdateWebhook(ctx, hook); err != nil {
+		return nil, err
+	}
+	m.invalidate()
+	hook.Secret = ""
+	return hook, nil
+}
+
+// Delete removes a webhook and its deliveries
+func (m *Manager) Delete(ctx context.Context, id uuid.UUID) error {
+	if err := m.store.DeleteWebhook(ctx, id); err != nil {
+		return err
+	}
+	m.invalidate()
+	m.logger.Infof("Webhook %s deleted", id)
+	return nil
+}
+
+// Deliveries returns the most recent deliveries of a webhook
+func (m *Manager) Deliveries(ctx context.Context, id uuid.UUID, limit int) ([]Delivery, error) {
+	if _, err := m.store.GetWebhook(ctx, id); err != nil {
+		return nil, err
+	}
+	return m.store.ListDeliveries(ctx, id, limit)
+}
+
+// Redeliver queues a delivery again, whatever its outcome so far
+func (m *Manager) Redeliver(ctx context.Context, webhookID, deliveryID uuid.UUID) error {
+	return m.store.ResetDelivery(ctx, webhookID, deliveryID, time.Now())
+}
+
+// Enqueue queues event for every active webhook subscribed to its type.
+// Queuing an event twice, e.g. after the broker redelivered it, is a no-op.
+func (m *Manager) Enqueue(ctx context.Context, event models.Event) error {
+	hooks, err := m.subscriptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	var body []byte
+	var deliveries []Delivery
+	now := time.Now()
+	for _, hook := range hooks {
+		if !hook.Matches(event.Type) {
+			continue
+		}
+		if body == nil {
+			if body, err = json.Marshal(newPayload(event)); err != nil {
+				return fmt.Errorf("failed to marshal webhook payload: %w", err)
+			}
+		}
+		deliveries = append(deliveries, Delivery{
+			ID:            uuid.New(),
+			WebhookID:     hook.ID,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Payload:       string(body),
+			Status:        StatusPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return m.store.CreateDeliveries(ctx, deliveries)
+}
+
+func newPayload(event models.Event) Payload {
+	payload := Payload{
+		ID:        event.ID,
+		Type:      event.Type,
+		UserID:    event.UserID,
+		Encrypted: event.Encrypted,
+		Timestamp: event.CreatedAt,
+	}
+	switch {
+	case event.Data == "":
+	case json.Valid([]byte(event.Data)):
+		payload.Data = json.RawMessage(event.Data)
+	default:
+		payload.Data, _ = json.Marshal(event.Data)
+	}
+	return payload
+}
+
+// subscriptions returns the active webhooks, reloading them every subscriptionTTL
+func (m *Manager) subscriptions(ctx context.Context) ([]Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.loadedAt.IsZero() && time.Since(m.loadedAt) < subscriptionTTL {
+		return m.active, nil
+	}
+
+	hooks, err := m.store.ListWebhooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	active := hooks[:0]
+	for _, hook := range hooks {
+		if hook.IsActive {
+			active = append(active, hook)
+		}
+	}
+	m.active, m.loadedAt = active, time.Now()
+	return m.active, nil
+}
+
+// invalidate makes the next Enqueue reload the subscriptions
+func (m *Manager) invalidate() {
+	m.mu.Lock()
+	m.loadedAt = time.Time{}
+	m.mu.Unlock()
+}
+
+func validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return apperrors.Validation("url must be an absolute http or https URL")
+	}
+	if u.User != nil {
+		return apperrors.Validation("url must not contain credentials")
+	}
+	return nil
+}
+
+func normalizeEventTypes(types []string) ([]string, error) {
+	normalized := []string{}
+	for _, t := range types {
+		t = strings.TrimSpace(t)
+		if t == "" || t == "*" {
+			continue
+		}
+		if strings.Contains(strings.TrimSuffix(t, "*"), "*") {
+			return nil, apperrors.Validation(fmt.Sprintf("invalid event type %q: * is only allowed at the end", t))
+		}
+		normalized = append(normalized, t)
+	}
+	return normalized, nil
+}
+
+func generateSecret() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b) // never fails since Go 1.24
+	return "whsec_" + hex.EncodeToString(b)
+}
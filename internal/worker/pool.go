@@ -1,32 +1,146 @@
 package worker
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"highload-microservice/internal/metrics"
 
 	"github.com/sirupsen/logrus"
 )
 
+// Job is a fire-and-forget function, run once with normal priority
 type Job func()
 
+// Priority selects the queue of a task. Workers always take the highest
+// priority task available. The zero value is PriorityNormal.
+type Priority int
+
+const (
+	PriorityLow    Priority = -1
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1
+)
+
+var priorityNames = [...]string{"low", "normal", "high"}
+
+func (p Priority) String() string {
+	if p < PriorityLow || p > PriorityHigh {
+		return fmt.Sprintf("priority(%d)", int(p))
+	}
+	return priorityNames[p.index()]
+}
+
+// index is the position of the priority's queue in Pool.queues
+func (p Priority) index() int {
+	return int(p - PriorityLow)
+}
+
+// ErrQueueFull is returned by Submit when the task's queue has no room
+var ErrQueueFull = errors.New("worker queue is full")
+
+// ErrPoolStopped is returned by Submit after Stop
+var ErrPoolStopped = errors.New("worker pool is stopped")
+
+// Task is a named unit of work. Run errors and panics are retried with
+// exponential backoff up to MaxRetries times.
+type Task struct {
+	Type       string // groups stats, e.g. "cache_warmup"
+	Priority   Priority
+	MaxRetries int
+	Run        func(ctx context.Context) error
+
+	attempt int
+}
+
+// Config sizes a Pool
+type Config struct {
+	Workers        int
+	QueueSize      int           // per priority
+	InitialBackoff time.Duration // first retry delay
+	MaxBackoff     time.Duration
+}
+
+// TypeStats counts the outcomes of one task type
+type TypeStats struct {
+	Processed int64 `json:"processed"` // finished successfully
+	Failed    int64 `json:"failed"`    // gave up after the last retry
+	Retried   int64 `json:"retried"`
+	Panics    int64 `json:"panics"`
+	Dropped   int64 `json:"dropped"` // rejected because the queue was full
+}
+
+// Stats is a snapshot of the pool, served on /admin/worker-stats
+type Stats struct {
+	Workers       int                  `json:"workers"`
+	QueueDepth    map[string]int       `json:"queue_depth"` // by priority
+	QueueCapacity int                  `json:"queue_capacity"`
+	Busy          int64                `json:"busy"`
+	PendingRetry  int64                `json:"pending_retries"`
+	Types         map[string]TypeStats `json:"types"`
+}
+
+type typeCounters struct {
+	processed, failed, retried, panics, dropped atomic.Int64
+}
+
 type Pool struct {
-	workers  int
-	jobQueue chan Job
-	quit     chan bool
-	wg       sync.WaitGroup
-	logger   *logrus.Logger
+	cfg     Config
+	queues  [len(priorityNames)]chan *Task
+	quit    chan bool
+	wg      sync.WaitGroup
+	logger  *logrus.Logger
+	ctx     context.Context // cancelled by Stop, passed to running tasks
+	cancel  context.CancelFunc
+	stopped atomic.Bool
+	busy    atomic.Int64
+	pending atomic.Int64
+
+	mu    sync.Mutex
+	types map[string]*typeCounters
 }
 
 func NewPool(workers int, logger *logrus.Logger) *Pool {
-	return &Pool{
-		workers:  workers,
-		jobQueue: make(chan Job, 100), // Buffer for 100 jobs
-		quit:     make(chan bool),
-		logger:   logger,
+	return NewPoolWithConfig(Config{Workers: workers}, logger)
+}
+
+func NewPoolWithConfig(cfg Config, logger *logrus.Logger) *Pool {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 100
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 100 * time.Millisecond
+	}
+	if cfg.MaxBackoff < cfg.InitialBackoff {
+		cfg.MaxBackoff = 30 * time.Second
 	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		cfg:    cfg,
+		quit:   make(chan bool),
+		logger: logger,
+		ctx:    ctx,
+		cancel: cancel,
+		types:  make(map[string]*typeCounters),
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan *Task, cfg.QueueSize)
+	}
+	return p
 }
 
 func (p *Pool) Start() {
-	for i := 0; i < p.workers; i++ {
+	for i := 0; i < p.cfg.Workers; i++ {
 		p.wg.Add(1)
 		go p.worker(i)
 	}
@@ -37,29 +151,225 @@ func (p *Pool) worker(id int) {
 	p.logger.Infof("Worker %d started", id)
 
 	for {
-		select {
-		case job := <-p.jobQueue:
-			p.logger.Debugf("Worker %d processing job", id)
-			job()
-		case <-p.quit:
+		task, ok := p.next()
+		if !ok {
 			p.logger.Infof("Worker %d stopping", id)
 			return
 		}
+		metrics.SetWorkerQueueDepth(p.QueueDepth())
+		p.logger.Debugf("Worker %d processing %s job", id, task.Type)
+		p.execute(task)
 	}
 }
 
-func (p *Pool) AddJob(job Job) {
+// next returns the highest priority task, waiting for one if all queues are
+// empty. It reports false once the pool is stopped.
+func (p *Pool) next() (*Task, bool) {
+	high, normal, low := p.queues[PriorityHigh.index()], p.queues[PriorityNormal.index()], p.queues[PriorityLow.index()]
+
+	select {
+	case <-p.quit:
+		return nil, false
+	case task := <-high:
+		return task, true
+	default:
+	}
 	select {
-	case p.jobQueue <- job:
+	case task := <-high:
+		return task, true
+	case task := <-normal:
+		return task, true
+	default:
+	}
+
+	select {
+	case <-p.quit:
+		return nil, false
+	case task := <-high:
+		return task, true
+	case task := <-normal:
+		return task, true
+	case task := <-low:
+		return task, true
+	}
+}
+
+// execute runs one attempt of task and schedules a retry if it failed
+func (p *Pool) execute(task *Task) {
+	counters := p.counters(task.Type)
+	p.busy.Add(1)
+	err := p.run(task, counters)
+	p.busy.Add(-1)
+
+	if err == nil {
+		counters.processed.Add(1)
+		metrics.WorkerJobProcessed()
+		return
+	}
+
+	if task.attempt >= task.MaxRetries || p.stopped.Load() {
+		counters.failed.Add(1)
+		metrics.WorkerJobFailed()
+		p.logger.Errorf("%s job failed after %d attempts: %v", task.Type, task.attempt+1, err)
+		return
+	}
+
+	task.attempt++
+	counters.retried.Add(1)
+	metrics.WorkerJobRetried()
+	delay := backoff(p.cfg.InitialBackoff, p.cfg.MaxBackoff, task.attempt)
+	p.logger.Warnf("%s job failed (attempt %d), retrying in %v: %v", task.Type, task.attempt, delay, err)
+
+	// Wait outside the worker so other jobs keep running
+	p.pending.Add(1)
+	time.AfterFunc(delay, func() {
+		p.pending.Add(-1)
+		if err := p.enqueue(task); err != nil {
+			counters.failed.Add(1)
+			metrics.WorkerJobFailed()
+			p.logger.Errorf("Could not requeue %s job for retry: %v", task.Type, err)
+		}
+	})
+}
+
+// run calls the task, turning a panic into an error so the worker survives
+func (p *Pool) run(task *Task, counters *typeCounters) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			counters.panics.Add(1)
+			p.logger.Errorf("%s job panicked: %v\n%s", task.Type, r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return task.Run(p.ctx)
+}
+
+// AddJob queues a job of type "default" with normal priority and no retries.
+// It is dropped when the queue is full.
+func (p *Pool) AddJob(job Job) {
+	err := p.Submit(Task{
+		Type: "default",
+		Run: func(context.Context) error {
+			job()
+			return nil
+		},
+	})
+	if err == nil {
 		p.logger.Debug("Job added to queue")
+	}
+}
+
+// Submit queues a task. It fails with ErrQueueFull when the queue of the
+// task's priority is full and with ErrPoolStopped after Stop.
+func (p *Pool) Submit(task Task) error {
+	if task.Run == nil {
+		return errors.New("task has no Run function")
+	}
+	if task.Type == "" {
+		task.Type = "default"
+	}
+	if task.Priority < PriorityLow || task.Priority > PriorityHigh {
+		task.Priority = PriorityNormal
+	}
+	task.attempt = 0
+	return p.enqueue(&task)
+}
+
+func (p *Pool) enqueue(task *Task) error {
+	if p.stopped.Load() {
+		return ErrPoolStopped
+	}
+
+	select {
+	case p.queues[task.Priority.index()] <- task:
+		metrics.SetWorkerQueueDepth(p.QueueDepth())
+		return nil
 	default:
-		p.logger.Warn("Job queue is full, dropping job")
+		p.counters(task.Type).dropped.Add(1)
+		metrics.WorkerJobDropped()
+		p.logger.Warnf("Job queue is full, dropping %s job", task.Type)
+		return ErrQueueFull
+	}
+}
+
+func (p *Pool) counters(taskType string) *typeCounters {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c, ok := p.types[taskType]
+	if !ok {
+		c = &typeCounters{}
+		p.types[taskType] = c
+	}
+	return c
+}
+
+// QueueDepth returns the number of jobs waiting for a worker
+func (p *Pool) QueueDepth() int {
+	depth := 0
+	for _, queue := range p.queues {
+		depth += len(queue)
+	}
+	return depth
+}
+
+// Stats returns queue depth per priority and outcome counts per task type
+func (p *Pool) Stats() Stats {
+	stats := Stats{
+		Workers:       p.cfg.Workers,
+		QueueDepth:    make(map[string]int, len(p.queues)),
+		QueueCapacity: p.cfg.QueueSize * len(p.queues),
+		Busy:          p.busy.Load(),
+		PendingRetry:  p.pending.Load(),
+		Types:         make(map[string]TypeStats),
 	}
+	for i, queue := range p.queues {
+		stats.QueueDepth[priorityNames[i]] = len(queue)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name, c := range p.types {
+		stats.Types[name] = TypeStats{
+			Processed: c.processed.Load(),
+			Failed:    c.failed.Load(),
+			Retried:   c.retried.Load(),
+			Panics:    c.panics.Load(),
+			Dropped:   c.dropped.Load(),
+		}
+	}
+	return stats
 }
 
+// GetStats returns pool size and utilisation of the normal priority queue,
+// which is where AddJob puts jobs
+func (p *Pool) GetStats() map[string]interface{} {
+	return map[string]interface{}{
+		"workers":        p.cfg.Workers,
+		"queue_depth":    len(p.queues[PriorityNormal.index()]),
+		"queue_capacity": cap(p.queues[PriorityNormal.index()]),
+	}
+}
+
+// Stop lets running jobs finish and abandons queued ones and pending retries.
+// Running jobs see their context cancelled.
 func (p *Pool) Stop() {
 	p.logger.Info("Stopping worker pool...")
+	p.stopped.Store(true)
+	p.cancel()
 	close(p.quit)
 	p.wg.Wait()
 	p.logger.Info("Worker pool stopped")
 }
+
+// backoff doubles initial per attempt up to max, with jitter in the upper half
+func backoff(initial, max time.Duration, attempt int) time.Duration {
+	d := initial
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	half := d / 2
+	return half + rand.N(half+1) // #nosec G404 -- jitter, not security sensitive
+}
@@ -1,6 +1,9 @@
 package worker
 
 import (
+	"context"
+	"errors"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -51,3 +54,146 @@ func TestPool_QueueOverflow(t *testing.T) {
 		p.AddJob(func() { time.Sleep(1 * time.Millisecond) })
 	}
 }
+
+func TestPool_GetStats(t *testing.T) {
+	p := NewPool(2, newTestLogger())
+
+	// Not started, so jobs stay queued
+	p.AddJob(func() {})
+	p.AddJob(func() {})
+
+	stats := p.GetStats()
+	if stats["workers"] != 2 || stats["queue_depth"] != 2 || stats["queue_capacity"] != 100 {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+	if p.QueueDepth() != 2 {
+		t.Fatalf("expected queue depth 2, got %d", p.QueueDepth())
+	}
+}
+
+func TestPool_HigherPriorityRunsFirst(t *testing.T) {
+	p := NewPool(1, newTestLogger())
+
+	// Queued before the worker starts, so the order is decided by priority
+	var mu sync.Mutex
+	var order []string
+	record := func(name string) func(context.Context) error {
+		return func(context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+			return nil
+		}
+	}
+	for _, task := range []Task{
+		{Type: "low", Priority: PriorityLow, Run: record("low")},
+		{Type: "normal", Run: record("normal")},
+		{Type: "high", Priority: PriorityHigh, Run: record("high")},
+	} {
+		if err := p.Submit(task); err != nil {
+			t.Fatalf("submit %s: %v", task.Type, err)
+		}
+	}
+
+	p.Start()
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(order) == 3
+	})
+	p.Stop()
+
+	if order[0] != "high" || order[1] != "normal" || order[2] != "low" {
+		t.Fatalf("unexpected order: %v", order)
+	}
+}
+
+func TestPool_RetriesWithBackoffThenGivesUp(t *testing.T) {
+	p := NewPoolWithConfig(Config{Workers: 2, InitialBackoff: time.Millisecond, MaxBackoff: 4 * time.Millisecond}, newTestLogger())
+	p.Start()
+	defer p.Stop()
+
+	var flaky, broken int32
+	_ = p.Submit(Task{Type: "flaky", MaxRetries: 3, Run: func(context.Context) error {
+		if atomic.AddInt32(&flaky, 1) < 3 {
+			return errors.New("temporary")
+		}
+		return nil
+	}})
+	_ = p.Submit(Task{Type: "broken", MaxRetries: 2, Run: func(context.Context) error {
+		atomic.AddInt32(&broken, 1)
+		return errors.New("permanent")
+	}})
+
+	waitFor(t, func() bool {
+		stats := p.Stats()
+		return stats.Types["flaky"].Processed == 1 && stats.Types["broken"].Failed == 1
+	})
+
+	stats := p.Stats()
+	if got := stats.Types["flaky"]; got.Retried != 2 || got.Failed != 0 {
+		t.Fatalf("flaky stats: %+v", got)
+	}
+	if got := stats.Types["broken"]; got.Retried != 2 || atomic.LoadInt32(&broken) != 3 {
+		t.Fatalf("broken stats: %+v, attempts %d", got, broken)
+	}
+}
+
+func TestPool_RecoversFromPanic(t *testing.T) {
+	p := NewPool(1, newTestLogger())
+	p.Start()
+	defer p.Stop()
+
+	_ = p.Submit(Task{Type: "panicky", Run: func(context.Context) error { panic("boom") }})
+
+	// The only worker must survive to run the next job
+	done := make(chan struct{})
+	p.AddJob(func() { close(done) })
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("worker did not survive the panic")
+	}
+
+	if got := p.Stats().Types["panicky"]; got.Panics != 1 || got.Failed != 1 {
+		t.Fatalf("panicky stats: %+v", got)
+	}
+}
+
+func TestPool_SubmitAfterStop(t *testing.T) {
+	p := NewPool(1, newTestLogger())
+	p.Start()
+	p.Stop()
+
+	if err := p.Submit(Task{Run: func(context.Context) error { return nil }}); !errors.Is(err, ErrPoolStopped) {
+		t.Fatalf("expected ErrPoolStopped, got %v", err)
+	}
+}
+
+func TestPool_StatsReportDroppedJobs(t *testing.T) {
+	p := NewPoolWithConfig(Config{Workers: 1, QueueSize: 1}, newTestLogger())
+	noop := func(context.Context) error { return nil }
+
+	if err := p.Submit(Task{Type: "report", Run: noop}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if err := p.Submit(Task{Type: "report", Run: noop}); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+
+	stats := p.Stats()
+	if stats.QueueDepth["normal"] != 1 || stats.QueueCapacity != 3 || stats.Types["report"].Dropped != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
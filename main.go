@@ -2,25 +2,63 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"database/sql"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
+	"slices"
+	"strings"
 	"syscall"
 	"time"
 
+	"highload-microservice/internal/admin"
+	"highload-microservice/internal/alerting"
+	"highload-microservice/internal/analytics"
+	"highload-microservice/internal/apiversion"
+	"highload-microservice/internal/auditarchive"
+	"highload-microservice/internal/avatar"
+	"highload-microservice/internal/cache"
 	"highload-microservice/internal/config"
 	"highload-microservice/internal/database"
+	"highload-microservice/internal/diagnostics"
+	"highload-microservice/internal/eventtype"
+	"highload-microservice/internal/fieldcrypt"
+	"highload-microservice/internal/geoip"
 	"highload-microservice/internal/handlers"
+	"highload-microservice/internal/httpclient"
+	"highload-microservice/internal/jwtkeys"
 	"highload-microservice/internal/kafka"
+	"highload-microservice/internal/mail"
+	"highload-microservice/internal/messaging"
+	"highload-microservice/internal/metrics"
 	"highload-microservice/internal/middleware"
 	"highload-microservice/internal/models"
+	"highload-microservice/internal/objectstore"
+	"highload-microservice/internal/oidc"
+	"highload-microservice/internal/outbox"
+	"highload-microservice/internal/password"
+	"highload-microservice/internal/processor"
+	"highload-microservice/internal/rbac"
+	"highload-microservice/internal/recording"
+	"highload-microservice/internal/redact"
 	"highload-microservice/internal/redis"
+	"highload-microservice/internal/repository"
+	"highload-microservice/internal/resilience"
+	"highload-microservice/internal/retention"
+	"highload-microservice/internal/saga"
+	"highload-microservice/internal/scheduler"
+	"highload-microservice/internal/schema"
 	"highload-microservice/internal/security"
 	"highload-microservice/internal/services"
+	"highload-microservice/internal/siem"
+	"highload-microservice/internal/startup"
+	"highload-microservice/internal/stream"
+	"highload-microservice/internal/webhook"
 	"highload-microservice/internal/worker"
 
-	"github.com/gin-contrib/pprof"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
@@ -35,9 +73,19 @@ func main() {
 
 	// Setup logger
 	logger := logrus.New()
-	logger.SetLevel(logrus.InfoLevel)
-	if cfg.LogLevel == "debug" {
-		logger.SetLevel(logrus.DebugLevel)
+	logger.SetLevel(logLevel(cfg.LogLevel))
+
+	// Mask emails, tokens, card numbers and passwords before anything is logged
+	redactor, err := redact.New(cfg.Redaction.Patterns, cfg.Redaction.Fields)
+	if err != nil {
+		log.Fatalf("Invalid redaction config: %v", err)
+	}
+	redactor.AllowFields(cfg.Redaction.AllowFields)
+	logger.AddHook(redact.NewHook(redactor))
+
+	if cfg.DevMode {
+		logger.Warnf("DEV_MODE is on (database: %s %q, cache: %s, messaging: %s); not for production",
+			cfg.Database.Driver, cfg.Database.Name, cfg.Cache.Backend, cfg.Messaging.Backend)
 	}
 
 	// Validate secrets
@@ -50,73 +98,940 @@ func main() {
 		logger.Warn("Use 'go run cmd/secrets/main.go set <key>' to set secure values")
 	}
 
-	// Initialize database
-	db, err := database.NewConnection(cfg.Database)
+	// Outbound HTTP calls (webhooks, alerts, OIDC) share one connection pool
+	// and retry idempotent requests
+	outboundHTTP := httpclient.Config{
+		Timeout:      time.Duration(cfg.HTTPClient.Timeout) * time.Second,
+		MaxRetries:   cfg.HTTPClient.MaxRetries,
+		RetryBackoff: time.Duration(cfg.HTTPClient.RetryBackoff) * time.Millisecond,
+		MaxBackoff:   time.Duration(cfg.HTTPClient.MaxBackoff) * time.Millisecond,
+	}
+
+	// Circuit breakers make calls to a failing dependency fail fast
+	var dbBreaker, cacheBreaker, producerBreaker *resilience.Breaker
+	var breakers []*resilience.Breaker
+	if cfg.CircuitBreaker.Enabled {
+		breakerCfg := resilience.Config{
+			FailureThreshold: cfg.CircuitBreaker.FailureThreshold,
+			OpenTimeout:      time.Duration(cfg.CircuitBreaker.OpenTimeout) * time.Second,
+			HalfOpenRequests: cfg.CircuitBreaker.HalfOpenRequests,
+		}
+		// Outbound HTTP breaks per host, bounded by the client timeout
+		httpBreaker := breakerCfg
+		outboundHTTP.Breaker = &httpBreaker
+		// The database has its own query timeout (DB_QUERY_TIMEOUT_MS)
+		dbBreaker = resilience.New("database", breakerCfg)
+		breakerCfg.Timeout = time.Duration(cfg.CircuitBreaker.CacheTimeout) * time.Millisecond
+		cacheBreaker = resilience.New("cache", breakerCfg)
+		breakerCfg.Timeout = time.Duration(cfg.CircuitBreaker.PublishTimeout) * time.Millisecond
+		producerBreaker = resilience.New("messaging", breakerCfg)
+		breakers = []*resilience.Breaker{dbBreaker, cacheBreaker, producerBreaker}
+	}
+
+	// Dependencies may still be starting when the service does (compose,
+	// Kubernetes), so startup retries each with backoff before giving up.
+	// SIGINT/SIGTERM cut the wait short.
+	startupCtx, stopStartup := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	startupWaiter := startup.NewWaiter(startup.Config{
+		Timeout:        time.Duration(cfg.Startup.WaitTimeout) * time.Second,
+		InitialBackoff: time.Duration(cfg.Startup.InitialBackoff) * time.Millisecond,
+		MaxBackoff:     time.Duration(cfg.Startup.MaxBackoff) * time.Millisecond,
+	}, logger)
+
+	// Initialize database. Migrations on start need it; otherwise an optional
+	// database that is still down is connected to by the pool once it is up.
+	dbAvailable, err := startupWaiter.Wait(startupCtx, startup.Dependency{
+		Name:     "database",
+		Required: cfg.Startup.IsRequired("database") || cfg.Database.MigrateOnStart,
+		Check:    func(ctx context.Context) error { return database.Ping(ctx, cfg.Database) },
+	})
+	if err != nil {
+		logger.Fatalf("Failed to connect to database: %v", err)
+	}
+	db, err := database.Open(cfg.Database, dbBreaker)
 	if err != nil {
 		logger.Fatalf("Failed to connect to database: %v", err)
 	}
 	defer func() { _ = db.Close() }()
 
-	// Run migrations
-	if err := database.RunMigrations(db); err != nil {
-		logger.Fatalf("Failed to run migrations: %v", err)
+	// Apply schema migrations, or only check them when deployments run
+	// cmd/migrate separately
+	dialect, err := database.NewDialect(cfg.Database.Driver)
+	if err != nil {
+		logger.Fatalf("Failed to resolve database dialect: %v", err)
+	}
+	if cfg.Database.MigrateOnStart {
+		migrationDB, err := database.NewMigrationConnection(cfg.Database)
+		if err != nil {
+			logger.Fatalf("Failed to connect to database for migrations: %v", err)
+		}
+		migrator, err := database.NewMigrator(migrationDB, dialect)
+		if err != nil {
+			logger.Fatalf("Failed to load migrations: %v", err)
+		}
+		if err := migrator.SetOnDelete(database.EventUser, cfg.EventUsers.OnDelete); err != nil {
+			logger.Fatalf("Invalid EVENT_USER_ON_DELETE: %v", err)
+		}
+		applied, err := migrator.Up(context.Background())
+		if err != nil {
+			logger.Fatalf("Failed to run migrations: %v", err)
+		}
+		_ = migrationDB.Close()
+		logger.Infof("Database migrations completed successfully (%d applied)", applied)
+	} else if dbAvailable {
+		migrator, err := database.NewMigrator(db, dialect)
+		if err != nil {
+			logger.Fatalf("Failed to load migrations: %v", err)
+		}
+		pending, err := migrator.Pending(context.Background())
+		if err != nil {
+			logger.Fatalf("Failed to check migrations: %v", err)
+		}
+		if pending > 0 {
+			logger.Warnf("%d database migrations are pending; run 'migrate up'", pending)
+		}
+		if _, action, err := database.OnDelete(context.Background(), db, dialect, database.EventUser); err != nil {
+			logger.Warnf("Failed to check the events foreign key: %v", err)
+		} else if action != cfg.EventUsers.OnDelete {
+			logger.Warnf("events.user_id has ON DELETE %q instead of %q; run 'migrate up'", action, cfg.EventUsers.OnDelete)
+		}
+	}
+
+	// Route read-only queries to the replica, if configured
+	var readPool *database.ReadPool
+	dbPools := map[string]*sql.DB{"primary": db}
+	if cfg.Database.ReplicaHost != "" {
+		replicaCfg := cfg.Database
+		replicaCfg.Host, replicaCfg.Port = cfg.Database.ReplicaHost, cfg.Database.ReplicaPort
+		// The read pool health checks the replica and falls back on its own
+		replicaDB, err := database.Open(replicaCfg, nil)
+		if err != nil {
+			logger.Fatalf("Failed to open read replica: %v", err)
+		}
+		readPool = database.NewReadPool(db, replicaDB, time.Duration(cfg.Database.ReplicaCheckInterval)*time.Second, logger)
+		dbPools["replica"] = replicaDB
+		readPool.Start()
+		defer readPool.Stop()
 	}
-	logger.Info("Database migrations completed successfully")
 
-	// Initialize Redis
-	redisClient, err := redis.NewClient(cfg.Redis)
+	// Initialize cache (Redis, Memcached or in-memory, selected by CACHE_BACKEND).
+	// An optional cache that is still down is replaced by the in-memory one
+	// until the next restart.
+	cacheAvailable := true
+	if !strings.EqualFold(cfg.Cache.Backend, cache.BackendMemory) {
+		cacheAvailable, err = startupWaiter.Wait(startupCtx, startup.Dependency{
+			Name:     cfg.Cache.Backend + " cache",
+			Required: cfg.Startup.IsRequired("cache"),
+			Check: func(ctx context.Context) error {
+				probe, err := cache.New(cfg)
+				if err != nil {
+					return err
+				}
+				return probe.Close()
+			},
+		})
+		if err != nil {
+			logger.Fatalf("Failed to connect to %s cache: %v", cfg.Cache.Backend, err)
+		}
+	}
+	cacheCfg := *cfg
+	if !cacheAvailable {
+		logger.Warnf("Using the in-memory cache: %s is unavailable", cfg.Cache.Backend)
+		cacheCfg.Cache.Backend = cache.BackendMemory
+	}
+	cacheClient, err := cache.New(&cacheCfg)
 	if err != nil {
-		logger.Fatalf("Failed to connect to Redis: %v", err)
+		logger.Fatalf("Failed to connect to %s cache: %v", cacheCfg.Cache.Backend, err)
+	}
+	defer func() { _ = cacheClient.Close() }()
+	if cacheBreaker != nil {
+		cacheClient = cache.WithBreaker(cacheClient, cacheBreaker)
 	}
-	defer func() { _ = redisClient.Close() }()
 
-	// Initialize Kafka
-	kafkaProducer, err := kafka.NewProducer(cfg.Kafka)
+	// Initialize messaging (Kafka, SNS/SQS, NATS JetStream or RabbitMQ, selected
+	// by MESSAGING_BACKEND)
+	kafkaProducer, err := messaging.NewProducer(cfg)
 	if err != nil {
-		logger.Fatalf("Failed to create Kafka producer: %v", err)
+		logger.Fatalf("Failed to create %s producer: %v", cfg.Messaging.Backend, err)
 	}
 	defer func() { _ = kafkaProducer.Close() }()
+	// The producer connects lazily; an optional broker that is still down is
+	// reconnected to in the background
+	if pinger, ok := kafkaProducer.(messaging.Pinger); ok {
+		if _, err := startupWaiter.Wait(startupCtx, startup.Dependency{
+			Name:     cfg.Messaging.Backend + " broker",
+			Required: cfg.Startup.IsRequired("messaging"),
+			Check:    pinger.Ping,
+		}); err != nil {
+			logger.Fatalf("Failed to connect to %s: %v", cfg.Messaging.Backend, err)
+		}
+	}
+	stopStartup()
+	// Publishes go through the breaker; health checks use the producer itself
+	var publisher messaging.Producer = kafkaProducer
+	if producerBreaker != nil {
+		publisher = messaging.WithBreaker(kafkaProducer, producerBreaker)
+	}
 
-	kafkaConsumer, err := kafka.NewConsumer(cfg.Kafka)
+	kafkaConsumer, err := messaging.NewConsumer(cfg)
 	if err != nil {
-		logger.Fatalf("Failed to create Kafka consumer: %v", err)
+		logger.Fatalf("Failed to create %s consumer: %v", cfg.Messaging.Backend, err)
 	}
 	defer func() { _ = kafkaConsumer.Close() }()
 
 	// Initialize security auditor
 	securityAuditor := security.NewSecurityAuditor(logger)
+	securityAuditor.SetRedactor(redactor)
+	if cfg.GeoIP.LocationDB != "" || cfg.GeoIP.ASNDB != "" {
+		geoDB, err := geoip.Open(cfg.GeoIP.LocationDB, cfg.GeoIP.ASNDB)
+		if err != nil {
+			logger.Fatalf("Failed to load GeoIP databases: %v", err)
+		}
+		securityAuditor.SetGeoLocator(geoDB)
+	}
+	if err := securityAuditor.AnomalyDetector().SetThresholds(security.AnomalyThresholds{
+		Enabled:            cfg.Anomaly.Enabled,
+		WindowSeconds:      cfg.Anomaly.WindowSeconds,
+		MinBaselineWindows: cfg.Anomaly.MinBaselineWindows,
+		MinRequests:        cfg.Anomaly.MinRequests,
+		ZScore:             cfg.Anomaly.ZScore,
+		RateFactor:         cfg.Anomaly.RateFactor,
+		FanOutFactor:       cfg.Anomaly.FanOutFactor,
+		ErrorRateFactor:    cfg.Anomaly.ErrorRateFactor,
+		UnauthorizedFactor: cfg.Anomaly.UnauthorizedFactor,
+	}); err != nil {
+		logger.Fatalf("Invalid anomaly detection settings: %v", err)
+	}
+	if cfg.Audit.Persist {
+		securityAuditor.SetStore(security.NewSQLStore(db), security.PersistConfig{
+			BatchSize:     cfg.Audit.BatchSize,
+			FlushInterval: time.Duration(cfg.Audit.FlushInterval) * time.Millisecond,
+			QueueSize:     cfg.Audit.QueueSize,
+		})
+	}
+	defer securityAuditor.Close()
+
+	// Security alerts are sent to the configured notification channels
+	var alertNotifiers []alerting.Notifier
+	alertHTTP := outboundHTTP
+	alertHTTP.NoRedirects = true
+	alertClient := httpclient.New("alerts", alertHTTP)
+	if cfg.Alerting.SlackWebhookURL != "" {
+		alertNotifiers = append(alertNotifiers, &alerting.SlackNotifier{URL: cfg.Alerting.SlackWebhookURL, Client: alertClient})
+	}
+	if cfg.Alerting.PagerDutyRoutingKey != "" {
+		alertNotifiers = append(alertNotifiers, &alerting.PagerDutyNotifier{RoutingKey: cfg.Alerting.PagerDutyRoutingKey, Client: alertClient})
+	}
+	if cfg.Alerting.WebhookURL != "" {
+		alertNotifiers = append(alertNotifiers, &alerting.WebhookNotifier{URL: cfg.Alerting.WebhookURL, Secret: cfg.Alerting.WebhookSecret, Client: alertClient})
+	}
+	if cfg.Alerting.SMTPAddr != "" {
+		if cfg.Alerting.EmailFrom == "" || len(cfg.Alerting.EmailTo) == 0 {
+			logger.Fatal("ALERT_SMTP_ADDR requires ALERT_EMAIL_FROM and ALERT_EMAIL_TO")
+		}
+		alertNotifiers = append(alertNotifiers, &alerting.EmailNotifier{
+			Addr:     cfg.Alerting.SMTPAddr,
+			Username: cfg.Alerting.SMTPUsername,
+			Password: cfg.Alerting.SMTPPassword,
+			From:     cfg.Alerting.EmailFrom,
+			To:       cfg.Alerting.EmailTo,
+		})
+	}
+	var alertDispatcher *alerting.Dispatcher
+	if len(alertNotifiers) > 0 {
+		routes, err := alerting.ParseRoutes(cfg.Alerting.Routes)
+		if err != nil {
+			logger.Fatalf("Invalid ALERT_ROUTES: %v", err)
+		}
+		if len(routes) == 0 {
+			for _, n := range alertNotifiers {
+				routes = append(routes, alerting.Route{Channel: n.Name(), MinSeverity: security.SeverityHigh})
+			}
+		}
+		alertDispatcher, err = alerting.NewDispatcher(alertNotifiers, routes, alerting.Config{
+			RatePerMinute: cfg.Alerting.RatePerMinute,
+			MaxAttempts:   cfg.Alerting.MaxAttempts,
+			Timeout:       time.Duration(cfg.Alerting.Timeout) * time.Second,
+		}, logger)
+		if err != nil {
+			logger.Fatalf("Invalid ALERT_ROUTES: %v", err)
+		}
+		alertDispatcher.Start(securityAuditor)
+		defer alertDispatcher.Stop()
+		logger.Infof("Security alert notifications enabled: %v", alertDispatcher.Channels())
+	}
+
+	// Security events and alerts are forwarded to the SIEM collector
+	var siemForwarder *siem.Forwarder
+	if cfg.SIEM.Address != "" {
+		siemForwarder, err = siem.NewForwarder(siem.Config{
+			Network:     cfg.SIEM.Network,
+			Address:     cfg.SIEM.Address,
+			Format:      cfg.SIEM.Format,
+			MinSeverity: security.SecuritySeverity(cfg.SIEM.MinSeverity),
+			Alerts:      cfg.SIEM.Alerts,
+			TLSCAFile:   cfg.SIEM.TLSCAFile,
+			Hostname:    cfg.SIEM.Hostname,
+			QueueSize:   cfg.SIEM.QueueSize,
+			Timeout:     time.Duration(cfg.SIEM.Timeout) * time.Second,
+		}, logger)
+		if err != nil {
+			logger.Fatalf("Invalid SIEM settings: %v", err)
+		}
+		siemForwarder.Start()
+		defer siemForwarder.Stop()
+		securityAuditor.AddOutput(siemForwarder)
+		logger.Infof("Forwarding security events of %s severity and above to SIEM %s (%s over %s)",
+			cfg.SIEM.MinSeverity, cfg.SIEM.Address, cfg.SIEM.Format, cfg.SIEM.Network)
+	}
+
+	// Route service events through the outbox table when enabled
+	var eventProducer services.KafkaProducer = publisher
+	var outboxProducer *outbox.Producer
+	var outboxRelay *outbox.Relay
+	var asyncProducer *messaging.AsyncProducer
+	if cfg.Outbox.Enabled {
+		outboxProducer, err = outbox.NewProducer(db, cfg.Outbox.Publisher)
+		if err != nil {
+			logger.Fatalf("Failed to create outbox producer: %v", err)
+		}
+		eventProducer = outboxProducer
+
+		if cfg.Outbox.Publisher == outbox.PublisherRelay {
+			outboxRelay = outbox.NewRelay(db, publisher, time.Duration(cfg.Outbox.PollInterval)*time.Millisecond, cfg.Outbox.BatchSize,
+				time.Duration(cfg.Outbox.RetentionHours)*time.Hour, logger)
+			outboxRelay.Start()
+		}
+		logger.Infof("Outbox enabled (publisher: %s)", cfg.Outbox.Publisher)
+	} else if cfg.Messaging.AsyncProduce {
+		// Publish in the background; closed (and flushed) before kafkaProducer
+		asyncProducer = messaging.NewAsyncProducer(publisher, messaging.AsyncConfig{
+			BufferSize:   cfg.Messaging.AsyncBufferSize,
+			Workers:      cfg.Messaging.AsyncWorkers,
+			SendTimeout:  time.Duration(cfg.Messaging.AsyncSendTimeout) * time.Second,
+			FlushTimeout: time.Duration(cfg.Messaging.AsyncFlushTimeout) * time.Second,
+		}, logger)
+		defer func() { _ = asyncProducer.Close() }()
+		eventProducer = asyncProducer
+		logger.Infof("Async producer enabled (buffer: %d events)", cfg.Messaging.AsyncBufferSize)
+	}
+
+	// Event payloads and user data are encrypted with the key ring of ENCRYPTION_KEY
+	var encryptor *fieldcrypt.Encryptor
+	if len(cfg.EventEncryption.EventTypes) > 0 || cfg.UserEncryption.Enabled {
+		if !cfg.EventEncryption.KeyProvided {
+			logger.Fatal("EVENT_ENCRYPTION_TYPES and USER_ENCRYPTION_ENABLED require ENCRYPTION_KEY to be set")
+		}
+		keys, err := cfg.EventEncryption.Keys()
+		if err != nil {
+			logger.Fatalf("Invalid encryption keys: %v", err)
+		}
+		encryptor, err = fieldcrypt.NewEncryptor(cfg.EventEncryption.KeyID, keys)
+		if err != nil {
+			logger.Fatalf("Failed to create field encryptor: %v", err)
+		}
+	}
+
+	// Initialize repositories and services
+	userRepo := repository.NewPostgresUserRepository(db)
+	eventRepo := repository.NewPostgresEventRepository(db)
+	if readPool != nil {
+		userRepo.SetReader(readPool)
+		eventRepo.SetReader(readPool)
+	}
+	if dialect.Name() != database.DriverPostgres {
+		eventRepo.DisableCopy()
+	}
+	if cfg.Database.PreparedStatements {
+		stmts := repository.NewStatements()
+		defer func() { _ = stmts.Close() }()
+		userRepo.SetStatements(stmts)
+		eventRepo.SetStatements(stmts)
+	}
+	if cfg.UserEncryption.Enabled {
+		indexKey, err := cfg.UserEncryption.BlindIndexKey()
+		if err != nil {
+			logger.Fatalf("Invalid user encryption settings: %v", err)
+		}
+		userRepo.SetEncryption(&repository.UserEncryption{Encryptor: encryptor, IndexKey: indexKey})
+		logger.Infof("User data encryption enabled (key %s)", cfg.EventEncryption.KeyID)
+	}
+	// Hot users and events are read from a small per-instance LRU before
+	// the shared cache; mutations delete from both
+	var serviceCache cache.Cache = cacheClient
+	var l1Cache *cache.LRUCache
+	if cfg.Cache.L1Enabled && !strings.EqualFold(cacheCfg.Cache.Backend, cache.BackendMemory) {
+		tiered := cache.NewTiered(cache.NewLRUCache(cfg.Cache.L1Size), cacheClient, time.Duration(cfg.Cache.L1TTL)*time.Millisecond)
+		serviceCache, l1Cache = tiered, tiered.L1()
+		logger.Infof("L1 cache enabled (%d keys, TTL %dms)", cfg.Cache.L1Size, cfg.Cache.L1TTL)
+	}
+	userService := services.NewUserService(userRepo, serviceCache, eventProducer, logger)
+	eventService := services.NewEventService(eventRepo, serviceCache, eventProducer, logger)
+	cacheLoader := cache.NewLoader(serviceCache, cache.LoaderConfig{
+		NegativeTTL:  time.Duration(cfg.Cache.NegativeTTL) * time.Second,
+		EarlyRefresh: cfg.Cache.EarlyRefresh,
+	})
+	userService.SetCacheLoader(cacheLoader)
+	userService.SetAuditLog(repository.NewPostgresUserAuditRepository(db))
+	eventService.SetCacheLoader(cacheLoader)
+	userService.SetListCache(cfg.Cache.ListEnabled)
+	eventService.SetListCache(cfg.Cache.ListEnabled)
+	if cfg.EventUsers.Validate {
+		eventService.SetUserLookup(userService)
+	}
+
+	// Broadcast cache invalidations to the other instances, if enabled
+	if cfg.Cache.InvalidationTopic != "" {
+		invalidationBus, err := kafka.NewInvalidationBus(cfg.Kafka, cfg.Cache.InvalidationTopic)
+		if err != nil {
+			logger.Fatalf("Failed to create cache invalidation bus: %v", err)
+		}
+		defer func() { _ = invalidationBus.Close() }()
+
+		invalidator := cache.NewInvalidator(invalidationBus, logger)
+		if strings.EqualFold(cfg.Cache.Backend, cache.BackendMemory) {
+			// Each instance has its own copy
+			invalidator.AddLocal(cacheClient)
+		}
+		if l1Cache != nil {
+			invalidator.AddLocal(l1Cache)
+		}
+		userService.SetInvalidator(invalidator)
+		eventService.SetInvalidator(invalidator)
+
+		invalidationCtx, stopInvalidation := context.WithCancel(context.Background())
+		defer stopInvalidation()
+		go invalidator.Run(invalidationCtx)
+		logger.Infof("Cache invalidation enabled (topic: %s)", cfg.Cache.InvalidationTopic)
+	}
+	if len(cfg.EventEncryption.EventTypes) > 0 {
+		eventService.SetPayloadEncryption(services.PayloadEncryption{
+			Encryptor:   encryptor,
+			EventTypes:  cfg.EventEncryption.EventTypes,
+			ReaderRoles: cfg.EventEncryption.ReaderRoles,
+		})
+		logger.Infof("Event payload encryption enabled for types %v (key %s)", cfg.EventEncryption.EventTypes, cfg.EventEncryption.KeyID)
+	}
+
+	// Consumed events are pushed to WebSocket subscribers of /api/*/events/stream
+	eventService.SetStreamHub(stream.NewHub(0))
 
-	// Initialize services
-	userService := services.NewUserService(db, redisClient, kafkaProducer, logger)
-	eventService := services.NewEventService(db, redisClient, kafkaProducer, logger)
+	// Payload schemas per event type, from EVENT_SCHEMA_DIR and the admin API
+	schemaRegistry := schema.NewRegistry(schema.NewSQLStore(db, dialect), logger)
+	if cfg.EventSchemas.Dir != "" {
+		if err := schemaRegistry.LoadDir(cfg.EventSchemas.Dir); err != nil {
+			logger.Fatalf("Failed to load event schemas: %v", err)
+		}
+	}
+	schemaCtx, cancelSchemaLoad := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := schemaRegistry.Load(schemaCtx); err != nil {
+		logger.Errorf("Failed to load stored event schemas: %v", err)
+	}
+	cancelSchemaLoad()
+	schemaRegistry.Start(time.Duration(cfg.EventSchemas.RefreshInterval) * time.Second)
+	defer schemaRegistry.Stop()
+
+	var invalidEventSink services.KafkaProducer
+	switch cfg.EventSchemas.InvalidAction {
+	case "reject":
+	case "dlq":
+		if cfg.Messaging.Backend != "" && !strings.EqualFold(cfg.Messaging.Backend, messaging.BackendKafka) {
+			logger.Fatal("EVENT_SCHEMA_INVALID_ACTION=dlq requires MESSAGING_BACKEND=kafka")
+		}
+		dlqConfig := cfg.Kafka
+		dlqConfig.Topic = cfg.EventSchemas.DLQTopic
+		dlqConfig.TopicRoutes = nil
+		dlqProducer, err := kafka.NewProducer(dlqConfig)
+		if err != nil {
+			logger.Fatalf("Failed to create invalid event producer: %v", err)
+		}
+		defer func() { _ = dlqProducer.Close() }()
+		invalidEventSink = dlqProducer
+	default:
+		logger.Fatalf("Unsupported EVENT_SCHEMA_INVALID_ACTION: %s", cfg.EventSchemas.InvalidAction)
+	}
+	eventService.SetSchemaValidation(schemaRegistry, invalidEventSink)
+
+	// Registered event types; strict mode refuses unregistered ones too
+	var eventTypes *eventtype.Registry
+	if cfg.EventTypes.Enabled {
+		eventTypes = eventtype.NewRegistry(eventtype.NewSQLStore(db, dialect), schemaRegistry, cfg.EventTypes.Strict, logger)
+		typesCtx, cancelTypesLoad := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := eventTypes.Load(typesCtx); err != nil {
+			logger.Errorf("Failed to load event types: %v", err)
+		}
+		cancelTypesLoad()
+		eventTypes.Start(time.Duration(cfg.EventTypes.RefreshInterval) * time.Second)
+		defer eventTypes.Stop()
+		eventService.SetTypeRegistry(eventTypes)
+	} else if cfg.EventTypes.Strict {
+		logger.Warn("EVENT_TYPES_STRICT has no effect while EVENT_TYPES_ENABLED=false")
+	}
+
+	// Stored events can be published again; replays go to the broker directly
+	eventService.SetReplay(services.ReplayConfig{
+		Producer:  publisher,
+		BatchSize: cfg.EventReplay.BatchSize,
+		MaxEvents: cfg.EventReplay.MaxEvents,
+	})
+	defer eventService.StopReplays()
+
+	// NDJSON ingestion stores events in batches; with the outbox they are
+	// written to it in the same transaction
+	if cfg.EventBulk.Enabled {
+		var bulkOutbox services.TxProducer
+		if outboxProducer != nil {
+			bulkOutbox = outboxProducer
+		}
+		eventService.SetBulkStore(eventRepo, bulkOutbox)
+	}
+
+	// Consumed events are delivered to subscribed webhooks
+	var webhookManager *webhook.Manager
+	if cfg.Webhooks.Enabled {
+		webhookStore := webhook.NewSQLStore(db)
+		webhookManager = webhook.NewManager(webhookStore, logger)
+		eventService.SetWebhooks(webhookManager)
+		// A redirect could point a signed payload anywhere
+		webhookHTTP := outboundHTTP
+		webhookHTTP.Timeout = time.Duration(cfg.Webhooks.Timeout) * time.Second
+		webhookHTTP.NoRedirects = true
+		webhookDispatcher := webhook.NewDispatcher(webhookStore, webhook.Config{
+			MaxAttempts:    cfg.Webhooks.MaxAttempts,
+			InitialBackoff: time.Duration(cfg.Webhooks.InitialBackoff) * time.Second,
+			MaxBackoff:     time.Duration(cfg.Webhooks.MaxBackoff) * time.Second,
+			Timeout:        time.Duration(cfg.Webhooks.Timeout) * time.Second,
+			PollInterval:   time.Duration(cfg.Webhooks.PollInterval) * time.Millisecond,
+			BatchSize:      cfg.Webhooks.BatchSize,
+		}, httpclient.New("webhooks", webhookHTTP), logger)
+		webhookDispatcher.Start()
+		defer webhookDispatcher.Stop()
+		logger.Info("Webhook delivery enabled")
+	}
+
+	// Events created per user and day are counted in the cache, and limited
+	// with a daily quota
+	if cfg.EventUsage.Enabled {
+		eventService.SetUsage(cacheClient, services.EventUsageConfig{
+			DailyQuota: cfg.EventUsage.DailyQuota,
+			Days:       cfg.EventUsage.RetentionDays,
+		})
+	}
+
+	// Event stats are read from hourly rollups of the events table
+	var eventStats *analytics.Service
+	if cfg.EventStats.Enabled {
+		eventStats = analytics.NewService(analytics.NewSQLStore(db), analytics.Config{
+			Lookback: time.Duration(cfg.EventStats.LookbackHours) * time.Hour,
+		}, logger)
+		eventService.SetProcessingRecorder(eventStats)
+	}
+
+	// Events older than the retention period are archived and deleted by
+	// the event_retention job or on demand
+	var eventRetention *retention.Service
+	if cfg.EventRetention.Days > 0 {
+		archiver, err := objectstore.New(context.Background(), archiveStoreConfig(cfg, cfg.EventRetention.ArchiveBackend, cfg.EventRetention.ArchiveDir))
+		if err != nil {
+			logger.Fatalf("Invalid event archive settings: %v", err)
+		}
+		if archiver == nil {
+			logger.Warn("Event retention deletes expired events without archiving them (EVENT_ARCHIVE_BACKEND=none)")
+		}
+		eventRetention = retention.NewService(retention.NewSQLStore(db), archiver, retention.Config{
+			MaxAge:    time.Duration(cfg.EventRetention.Days) * 24 * time.Hour,
+			BatchSize: cfg.EventRetention.BatchSize,
+			MaxEvents: cfg.EventRetention.MaxEvents,
+		}, logger)
+		defer eventRetention.Stop()
+		logger.Infof("Event retention enabled: %d days, archive %s", cfg.EventRetention.Days, cfg.EventRetention.ArchiveBackend)
+	}
+
+	// Security events, alerts and the user audit trail are copied to object
+	// storage by the audit_archive job
+	var auditArchive *auditarchive.Exporter
+	if cfg.AuditArchive.Enabled {
+		objects, err := objectstore.New(context.Background(), archiveStoreConfig(cfg, cfg.AuditArchive.Backend, cfg.AuditArchive.Dir))
+		if err != nil {
+			logger.Fatalf("Invalid audit archive settings: %v", err)
+		}
+		if objects == nil {
+			logger.Fatalf("AUDIT_ARCHIVE_BACKEND must be file or s3")
+		}
+		auditArchive = auditarchive.NewExporter(auditarchive.NewSQLStore(db), objects, auditarchive.Config{
+			BatchSize: cfg.AuditArchive.BatchSize,
+			Lag:       time.Duration(cfg.AuditArchive.LagMinutes) * time.Minute,
+		}, logger)
+		logger.Infof("Audit archiving enabled (%s)", cfg.AuditArchive.Backend)
+	}
+
+	// Sampled requests and responses are recorded for debugging
+	var httpRecorder *recording.Recorder
+	if cfg.HTTPRecording.Enabled {
+		httpRecorder = recording.NewRecorder(recording.NewSQLStore(db), recording.Config{
+			QueueSize: cfg.HTTPRecording.QueueSize,
+			Retention: time.Duration(cfg.HTTPRecording.RetentionHours) * time.Hour,
+		}, logger)
+		httpRecorder.Start()
+		defer httpRecorder.Stop()
+		logger.Infof("HTTP recording enabled: %.2f%% of requests and %v", cfg.HTTPRecording.SampleRate*100, cfg.HTTPRecording.Routes)
+	}
 
 	// Initialize auth service
+	signingKeys, err := jwtkeys.Load(jwtkeys.Config{
+		Secret:   cfg.Auth.JWTSecret,
+		SecretID: cfg.Auth.JWTKeyID,
+		ActiveID: cfg.Auth.JWTActiveKeyID,
+		HMACKeys: cfg.Auth.JWTHMACKeys,
+		KeyFiles: cfg.Auth.JWTKeyFiles,
+	})
+	if err != nil {
+		logger.Fatalf("Invalid JWT signing keys: %v", err)
+	}
+	logger.Infof("JWT tokens signed with key %s", signingKeys.ActiveID())
 	authConfig := services.AuthConfig{
 		JWTSecret:         cfg.Auth.JWTSecret,
+		SigningKeys:       signingKeys,
 		JWTExpiration:     time.Duration(cfg.Auth.JWTExpiration) * time.Hour,
 		RefreshExpiration: time.Duration(cfg.Auth.RefreshExpiration) * 24 * time.Hour,
 		APIKeyLength:      cfg.Auth.APIKeyLength,
+		APIKeyGrace:       time.Duration(cfg.Auth.APIKeyGrace) * time.Minute,
+		LoginThrottle: services.LoginThrottleConfig{
+			FreeAttempts: cfg.Auth.LoginThrottleFreeAttempts,
+			BaseDelay:    time.Duration(cfg.Auth.LoginThrottleBaseDelay) * time.Second,
+			MaxDelay:     time.Duration(cfg.Auth.LoginThrottleMaxDelay) * time.Second,
+			Window:       time.Duration(cfg.Auth.LoginThrottleWindow) * time.Minute,
+		},
+		Lockout: services.LockoutConfig{
+			MaxAttempts: cfg.Auth.LockoutMaxAttempts,
+			Window:      time.Duration(cfg.Auth.LockoutWindow) * time.Minute,
+			Duration:    time.Duration(cfg.Auth.LockoutDuration) * time.Minute,
+		},
+	}
+	permissions, err := rbac.ParseMatrix(cfg.Auth.Permissions)
+	if err != nil {
+		logger.Fatalf("Invalid RBAC_PERMISSIONS: %v", err)
+	}
+	authConfig.Permissions = permissions
+	passwordChecker, err := password.FromConfig(cfg.Auth)
+	if err != nil {
+		logger.Fatalf("Failed to set up password policy: %v", err)
+	}
+	authConfig.Passwords = passwordChecker
+	authService := services.NewAuthService(repository.NewPostgresAuthRepository(db), cacheClient, logger, authConfig)
+	// Account email: verification links, invitations and email changes
+	var mailer mail.Sender = &mail.LogSender{Logger: logger}
+	if cfg.Mail.SMTPAddr != "" {
+		mailer = &mail.SMTPSender{
+			Addr:     cfg.Mail.SMTPAddr,
+			Username: cfg.Mail.SMTPUsername,
+			Password: cfg.Mail.SMTPPassword,
+			From:     cfg.Mail.From,
+		}
+	} else if cfg.Registration.Enabled || cfg.Invitations.Enabled || cfg.Profile.EmailChangeEnabled {
+		logger.Warn("MAIL_SMTP_ADDR is not set: verification, invitation and email change emails are only logged")
+	}
+	tokenSecret := cfg.Registration.TokenSecret
+	if tokenSecret == "" {
+		tokenSecret = cfg.Auth.JWTSecret
+	}
+	if cfg.Registration.Enabled {
+		authService.SetRegistration(mailer, services.RegistrationConfig{
+			VerifyURL:   cfg.Registration.VerifyURL,
+			TokenSecret: tokenSecret,
+			TokenTTL:    time.Duration(cfg.Registration.TokenTTLHours) * time.Hour,
+			MaxPerIP:    cfg.Registration.MaxPerIPPerHour,
+		})
+		logger.Info("Self-registration enabled")
+	}
+	if cfg.Invitations.Enabled {
+		authService.SetInvitations(mailer, services.InvitationConfig{
+			AcceptURL: cfg.Invitations.AcceptURL,
+			TTL:       time.Duration(cfg.Invitations.TTLHours) * time.Hour,
+		})
+	}
+	if cfg.Profile.EmailChangeEnabled {
+		authService.SetProfile(mailer, services.ProfileConfig{
+			ConfirmURL:  cfg.Profile.EmailConfirmURL,
+			TokenSecret: tokenSecret,
+			TokenTTL:    time.Duration(cfg.Profile.EmailTokenTTLHours) * time.Hour,
+		})
+	}
+	authService.SetEventProducer(eventProducer)
+
+	// Handlers of consumed events by type, e.g. welcome_email on user_created
+	var eventProcessor *processor.Registry
+	if cfg.EventHandlers.Enabled {
+		eventProcessor = processor.NewRegistry(processor.NewSQLStore(db, dialect), processor.Config{
+			MaxRetries:     cfg.EventHandlers.MaxRetries,
+			InitialBackoff: time.Duration(cfg.EventHandlers.RetryInitialBackoff) * time.Millisecond,
+			MaxBackoff:     time.Duration(cfg.EventHandlers.RetryMaxBackoff) * time.Millisecond,
+			Disabled:       cfg.EventHandlers.Disabled,
+		}, logger)
+		for _, h := range []processor.Handler{
+			processor.WelcomeEmail(userService, mailer),
+			processor.SessionCleanup(authService),
+		} {
+			if err := eventProcessor.Register(h); err != nil {
+				logger.Fatalf("Failed to register event handler: %v", err)
+			}
+		}
+		handlersCtx, cancelHandlersLoad := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := eventProcessor.Load(handlersCtx); err != nil {
+			logger.Errorf("Failed to load event handler settings: %v", err)
+		}
+		cancelHandlersLoad()
+		eventProcessor.Start(time.Duration(cfg.EventHandlers.RefreshInterval) * time.Second)
+		defer eventProcessor.Stop()
+		eventService.SetProcessor(eventProcessor)
 	}
-	authService := services.NewAuthService(db, logger, authConfig)
 
 	// Initialize worker pool for background processing
-	workerPool := worker.NewPool(10, logger) // 10 workers
+	workerPool := worker.NewPoolWithConfig(worker.Config{
+		Workers:        cfg.Worker.PoolSize,
+		QueueSize:      cfg.Worker.QueueSize,
+		InitialBackoff: time.Duration(cfg.Worker.RetryInitialBackoff) * time.Millisecond,
+		MaxBackoff:     time.Duration(cfg.Worker.RetryMaxBackoff) * time.Millisecond,
+	}, logger)
 	workerPool.Start()
 
-	// Add event processing job to worker pool
-	workerPool.AddJob(func() {
-		eventService.ProcessEvents(kafkaConsumer)
-	})
+	// Sagas are started by event handlers and run their steps on the worker pool
+	var sagaEngine *saga.Engine
+	if cfg.Sagas.Enabled {
+		if eventProcessor == nil {
+			logger.Fatal("SAGAS_ENABLED requires EVENT_HANDLERS_ENABLED")
+		}
+		sagaEngine = saga.NewEngine(saga.NewSQLStore(db, dialect), workerPool, saga.Config{
+			MaxRetries:     cfg.Sagas.MaxRetries,
+			InitialBackoff: time.Duration(cfg.Sagas.RetryInitialBackoff) * time.Millisecond,
+			MaxBackoff:     time.Duration(cfg.Sagas.RetryMaxBackoff) * time.Millisecond,
+			StepTimeout:    time.Duration(cfg.Sagas.StepTimeout) * time.Second,
+			StaleAfter:     time.Duration(cfg.Sagas.StaleAfter) * time.Second,
+		}, logger)
+		if len(cfg.Sagas.ProvisioningURLs) > 0 {
+			provisioning, err := saga.UserProvisioning(cfg.Sagas.ProvisioningEvent, cfg.Sagas.ProvisioningURLs, httpclient.New("sagas", outboundHTTP))
+			if err != nil {
+				logger.Fatalf("Invalid SAGA_USER_PROVISIONING_URLS: %v", err)
+			}
+			if err := sagaEngine.Register(provisioning); err != nil {
+				logger.Fatalf("Failed to register saga: %v", err)
+			}
+		}
+		for _, h := range sagaEngine.Handlers() {
+			if err := eventProcessor.Register(h); err != nil {
+				logger.Fatalf("Failed to register event handler: %v", err)
+			}
+		}
+	}
+
+	// Avatars are stored in object storage and resized on the worker pool
+	var avatars *avatar.Manager
+	if cfg.Avatars.Enabled {
+		storeCfg := archiveStoreConfig(cfg, cfg.Avatars.Backend, cfg.Avatars.Dir)
+		storeCfg.S3.Bucket, storeCfg.S3.Prefix, storeCfg.S3.StorageClass = cfg.Avatars.S3Bucket, cfg.Avatars.S3Prefix, ""
+		objects, err := objectstore.NewBucket(context.Background(), storeCfg)
+		if err != nil {
+			logger.Fatalf("Invalid avatar storage settings: %v", err)
+		}
+		avatars = avatar.NewManager(avatar.NewSQLStore(db, dialect), objects, workerPool, avatar.Config{
+			MaxBytes:       int64(cfg.Avatars.MaxBytes),
+			MaxPixels:      cfg.Avatars.MaxPixels,
+			ThumbnailSizes: cfg.Avatars.ThumbnailSizes,
+		}, logger)
+		userService.SetAvatars(avatars)
+		logger.Infof("Avatars enabled (%s)", cfg.Avatars.Backend)
+	}
+
+	// Fill the cache with recent events and their users in the background,
+	// so a cold restart doesn't send the first wave of reads to the database
+	if cfg.Cache.WarmupEnabled {
+		warmer := services.NewCacheWarmer(userService, eventService, workerPool, services.CacheWarmupConfig{
+			Events: cfg.Cache.WarmupEvents,
+			Users:  cfg.Cache.WarmupUsers,
+		}, logger)
+		go func() {
+			events, users, err := warmer.Run(context.Background())
+			if err != nil {
+				logger.Errorf("Cache warm-up incomplete: %v", err)
+			}
+			logger.Infof("Cache warm-up queued %d events and %d users", events, users)
+		}()
+	}
+
+	// Remember processed events so redelivered ones are skipped. The shared
+	// cache is used, not the per-instance L1.
+	var (
+		eventDedup      messaging.Deduplicator
+		processedEvents *messaging.SQLDeduplicator
+	)
+	dedupLease := time.Duration(cfg.Messaging.DedupLeaseSeconds) * time.Second
+	dedupTTL := time.Duration(cfg.Messaging.DedupTTLHours) * time.Hour
+	switch strings.ToLower(cfg.Messaging.DedupBackend) {
+	case messaging.DedupCache:
+		eventDedup = messaging.NewCacheDeduplicator(cacheClient, dedupLease, dedupTTL)
+	case messaging.DedupDatabase:
+		processedEvents = messaging.NewSQLDeduplicator(db, dialect, dedupLease, dedupTTL)
+		eventDedup = processedEvents
+	case messaging.DedupNone, "":
+	default:
+		logger.Fatalf("Unsupported CONSUMER_DEDUP_BACKEND: %s", cfg.Messaging.DedupBackend)
+	}
+
+	// Run maintenance jobs on the worker pool
+	jobScheduler := scheduler.New(workerPool, logger)
+	jobScheduler.SetClaimer(cacheClient)
+	if cfg.Scheduler.Enabled {
+		addJob := func(name, spec string, run scheduler.JobFunc) {
+			if err := jobScheduler.Add(name, spec, 0, run); err != nil {
+				logger.Fatalf("Invalid schedule: %v", err)
+			}
+		}
+		if auditArchive != nil {
+			if err := jobScheduler.Add("audit_archive", cfg.Scheduler.AuditArchive, time.Hour, auditArchive.Run); err != nil {
+				logger.Fatalf("Invalid schedule: %v", err)
+			}
+		}
+		addJob("refresh_token_cleanup", cfg.Scheduler.RefreshTokenCleanup, func(ctx context.Context) error {
+			_, err := authService.DeleteExpiredRefreshTokens(ctx)
+			return err
+		})
+		addJob("api_key_expiry", cfg.Scheduler.APIKeyExpiry, func(ctx context.Context) error {
+			_, err := authService.ExpireAPIKeys(ctx)
+			return err
+		})
+		// Stats are counted from stored events
+		if cfg.Audit.Persist {
+			addJob("security_stats", cfg.Scheduler.SecurityStats, securityAuditor.AggregateStats)
+		}
+		if eventStats != nil {
+			addJob("event_stats", cfg.Scheduler.EventStats, eventStats.Rollup)
+		}
+		if httpRecorder != nil {
+			addJob("http_recording_purge", cfg.Scheduler.HTTPRecordingPurge, httpRecorder.Cleanup)
+		}
+		if processedEvents != nil {
+			addJob("processed_events_purge", cfg.Scheduler.ProcessedEventsPurge, processedEvents.DeleteExpired)
+		}
+		if outboxRelay != nil {
+			addJob("outbox_purge", cfg.Scheduler.OutboxPurge, outboxRelay.DeletePublished)
+		}
+		if sagaEngine != nil {
+			addJob("saga_resume", cfg.Scheduler.SagaResume, sagaEngine.Resume)
+		}
+		// A run may archive up to EVENT_RETENTION_MAX_EVENTS events
+		if eventRetention != nil {
+			if err := jobScheduler.Add("event_retention", cfg.Scheduler.EventRetention, time.Hour, eventRetention.RunScheduled); err != nil {
+				logger.Fatalf("Invalid schedule: %v", err)
+			}
+		}
+		jobScheduler.Start()
+	}
+
+	// Consume events until shutdown; offsets are committed after processing
+	consumerCtx, stopConsumer := context.WithCancel(context.Background())
+	consumerRunner := messaging.NewRunner(kafkaConsumer, eventService.HandleEvent, messaging.RunnerConfig{
+		InitialBackoff: time.Duration(cfg.Messaging.RetryInitialBackoff) * time.Millisecond,
+		MaxBackoff:     time.Duration(cfg.Messaging.RetryMaxBackoff) * time.Millisecond,
+		HandlerTimeout: time.Duration(cfg.Messaging.HandlerTimeout) * time.Second,
+		Concurrency:    cfg.Messaging.Concurrency,
+		LaneQueueSize:  cfg.Messaging.LaneQueueSize,
+	}, logger)
+	if eventDedup != nil {
+		consumerRunner.SetDeduplicator(eventDedup)
+	}
+	consumerDone := make(chan struct{})
+	go func() {
+		defer close(consumerDone)
+		consumerRunner.Run(consumerCtx)
+	}()
 
 	// Initialize handlers
 	userHandler := handlers.NewUserHandler(userService, logger)
+	userHandler.SetPermissions(authService.Permissions())
+	if avatars != nil {
+		userHandler.SetAvatars(avatars, time.Duration(cfg.Avatars.CacheMaxAgeSeconds)*time.Second)
+	}
 	eventHandler := handlers.NewEventHandler(eventService, logger)
+	eventHandler.SetSchemaRegistry(schemaRegistry)
+	if eventTypes != nil {
+		eventHandler.SetEventTypes(eventTypes)
+	}
+	if webhookManager != nil {
+		eventHandler.SetWebhooks(webhookManager)
+	}
+	if eventStats != nil {
+		eventHandler.SetAnalytics(eventStats)
+	}
+	if eventRetention != nil {
+		eventHandler.SetRetention(eventRetention)
+	}
+	if eventProcessor != nil {
+		eventHandler.SetProcessor(eventProcessor)
+	}
+	if sagaEngine != nil {
+		eventHandler.SetSagas(sagaEngine)
+	}
 	authHandler := handlers.NewAuthHandler(authService, securityAuditor, logger)
+	if cfg.OIDC.Issuer != "" {
+		if cfg.OIDC.ClientID == "" || cfg.OIDC.RedirectURL == "" {
+			logger.Fatal("OIDC_ISSUER requires OIDC_CLIENT_ID and OIDC_REDIRECT_URL")
+		}
+		// Pending logins are kept in the cache between redirect and callback
+		authHandler.SetIdentityProvider(oidc.NewProvider(oidc.Config{
+			Issuer:         cfg.OIDC.Issuer,
+			ClientID:       cfg.OIDC.ClientID,
+			ClientSecret:   cfg.OIDC.ClientSecret,
+			RedirectURL:    cfg.OIDC.RedirectURL,
+			Scopes:         cfg.OIDC.Scopes,
+			AllowedDomains: cfg.OIDC.AllowedDomains,
+		}, cacheClient, httpclient.New("oidc", outboundHTTP)))
+		logger.Infof("OIDC login enabled (issuer: %s)", cfg.OIDC.Issuer)
+	}
 	securityHandler := handlers.NewSecurityHandler(securityAuditor, logger)
+	securityHandler.SetPasswordPolicy(passwordChecker)
+	if alertDispatcher != nil {
+		securityHandler.SetAlertDispatcher(alertDispatcher)
+	}
+	if auditArchive != nil {
+		securityHandler.SetAuditArchive(auditArchive)
+	}
+	if siemForwarder != nil {
+		securityHandler.SetSIEM(siemForwarder)
+	}
+	if httpRecorder != nil {
+		securityHandler.SetRecordings(httpRecorder.Store())
+	}
 
 	// Initialize middleware
-	authMiddleware := middleware.NewAuthMiddleware(authService, logger)
 	validationMiddleware := middleware.NewValidationMiddleware(logger)
+	validationMiddleware.SetPasswordChecker(passwordChecker)
+	if cfg.EventBulk.Enabled {
+		eventHandler.SetBulkIngest(validationMiddleware, handlers.BulkIngestConfig{
+			MaxEvents:    cfg.EventBulk.MaxEvents,
+			BatchSize:    cfg.EventBulk.BatchSize,
+			MaxLineBytes: cfg.EventBulk.MaxLineBytes,
+		})
+	}
+	authMiddleware := middleware.NewAuthMiddleware(authService, logger)
+	authMiddleware.SetAuditor(securityAuditor)
+	refreshValidation := validationMiddleware.ValidateRequest(&models.RefreshTokenRequest{})
+	if cfg.Auth.SessionMode != middleware.SessionModeBearer {
+		sessionCookies, err := middleware.NewSessionCookies(middleware.SessionCookieConfig{
+			Mode:       cfg.Auth.SessionMode,
+			Domain:     cfg.Auth.CookieDomain,
+			Secure:     cfg.Auth.CookieSecure,
+			SameSite:   cfg.Auth.CookieSameSite,
+			RefreshTTL: time.Duration(cfg.Auth.RefreshExpiration) * 24 * time.Hour,
+		}, logger)
+		if err != nil {
+			logger.Fatalf("Invalid session cookie settings: %v", err)
+		}
+		authHandler.SetSessionCookies(sessionCookies)
+		authMiddleware.SetSessionCookies(sessionCookies)
+		// The refresh token may come from its cookie instead of the body
+		refreshValidation = func(c *gin.Context) { c.Next() }
+		logger.Infof("Cookie sessions enabled (mode: %s)", cfg.Auth.SessionMode)
+	}
 	securityLoggingMiddleware := middleware.NewSecurityLoggingMiddleware(securityAuditor, logger)
 
 	// Initialize security middleware
@@ -143,8 +1058,67 @@ func main() {
 	// Observability endpoints
 	// Prometheus metrics
 	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
-	// pprof on /debug/pprof
-	pprof.Register(router)
+	// pprof and runtime statistics, on their own listener or to admins on
+	// /debug. Registered before the middleware below so that profiles are not
+	// cut short by request deadlines or load shedding.
+	var diagnosticsServer *http.Server
+	if cfg.Diagnostics.Enabled {
+		sources := map[string]diagnostics.Source{
+			"worker_pool": func() any { return workerPool.Stats() },
+			"scheduler":   func() any { return jobScheduler.Status() },
+		}
+		if asyncProducer != nil {
+			sources["producer_buffer"] = func() any { return asyncProducer.Stats() }
+		}
+		if cfg.Diagnostics.Addr != "" {
+			diagnosticsRouter := gin.New()
+			diagnosticsRouter.Use(gin.Recovery())
+			diagnostics.Register(diagnosticsRouter.Group("/debug"), sources)
+			diagnosticsServer = &http.Server{
+				Addr:              cfg.Diagnostics.Addr,
+				Handler:           diagnosticsRouter,
+				ReadHeaderTimeout: 5 * time.Second,
+			}
+			go func() {
+				logger.Infof("Starting diagnostics server on %s", cfg.Diagnostics.Addr)
+				if err := diagnosticsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					logger.Fatalf("Failed to start diagnostics server: %v", err)
+				}
+			}()
+		} else {
+			diagnostics.Register(router.Group("/debug", authMiddleware.RequireAuth(), authMiddleware.RequireRole(models.RoleAdmin)), sources)
+		}
+	}
+
+	// Request count/latency per route; registered after /metrics and the
+	// diagnostics so scrapes and profiles are not counted
+	router.Use(metrics.Middleware())
+
+	// Adaptive concurrency limit; 503 with Retry-After when saturated
+	if cfg.LoadShedding.Enabled {
+		loadShedder := middleware.NewLoadShedder(middleware.LoadSheddingConfig{
+			MinLimit:      cfg.LoadShedding.MinLimit,
+			MaxLimit:      cfg.LoadShedding.MaxLimit,
+			QueueSize:     cfg.LoadShedding.QueueSize,
+			QueueTimeout:  time.Duration(cfg.LoadShedding.QueueTimeout) * time.Millisecond,
+			TargetLatency: time.Duration(cfg.LoadShedding.TargetLatency) * time.Millisecond,
+			Window:        time.Duration(cfg.LoadShedding.Window) * time.Millisecond,
+			RetryAfter:    time.Duration(cfg.LoadShedding.RetryAfter) * time.Second,
+			// Probes must answer under load and streams would hold a slot
+			// for as long as they are open
+			ExcludedRoutes: []string{"/health*", "/readyz", "/api/*/events/stream", "/admin/security/alerts/stream", "/admin/export/*"},
+		}, logger)
+		router.Use(loadShedder.Handler())
+	}
+
+	// gzip/deflate for large responses (paginated lists); streams opt out
+	if cfg.Server.CompressionEnabled {
+		router.Use(middleware.Compression(middleware.CompressionConfig{
+			MinSize:       cfg.Server.CompressionMinSize,
+			Level:         cfg.Server.CompressionLevel,
+			ExcludedPaths: cfg.Server.CompressionExcludedPaths,
+		}))
+	}
 
 	// Apply security middleware globally
 	router.Use(securityMiddleware.RequestID())
@@ -156,29 +1130,157 @@ func main() {
 	router.Use(securityLoggingMiddleware.LogRequest())
 	router.Use(securityLoggingMiddleware.LogSuspiciousInput())
 
+	// Sampled request/response recording; inside compression, so bodies are
+	// plain, and outside the request timeout, so a 504 is what is recorded
+	if httpRecorder != nil {
+		router.Use(middleware.RequestRecording(httpRecorder, middleware.RequestRecordingConfig{
+			SampleRate:     cfg.HTTPRecording.SampleRate,
+			Routes:         cfg.HTTPRecording.Routes,
+			ExcludedRoutes: append(cfg.HTTPRecording.ExcludedRoutes, "/api/*/events/stream", "/admin/security/alerts/stream", "/admin/export/*"),
+			MaxBodyBytes:   cfg.HTTPRecording.MaxBodyBytes,
+			Redactor:       redactor,
+		}))
+	}
+
+	// Per-request deadline; 504 when a handler runs past it
+	timeoutRoutes, err := middleware.ParseRouteTimeouts(cfg.Server.RequestTimeoutRoutes)
+	if err != nil {
+		logger.Fatalf("Invalid REQUEST_TIMEOUT_ROUTES: %v", err)
+	}
+	router.Use(middleware.RequestTimeout(middleware.RequestTimeoutConfig{
+		Timeout: time.Duration(cfg.Server.RequestTimeout) * time.Millisecond,
+		// Streams stay open for as long as the client is connected
+		Routes: append([]middleware.RouteTimeout{
+			{Method: http.MethodGet, Pattern: "/api/*/events/stream"},
+			{Method: http.MethodGet, Pattern: "/admin/security/alerts/stream"},
+			{Method: http.MethodGet, Pattern: "/admin/export/*"},
+		}, timeoutRoutes...),
+	}))
+
+	// Services calling with a client certificate get the permissions of its
+	// subject, checked by RequirePermission like user roles
+	var serverTLS *tls.Config
+	if cfg.Server.UseTLS {
+		serverTLS, err = middleware.ClientCertTLSConfig(cfg.Server.TLSClientAuth, cfg.Server.TLSClientCA)
+		if err != nil {
+			logger.Fatalf("Invalid client certificate configuration: %v", err)
+		}
+		if serverTLS.ClientAuth != tls.NoClientCert {
+			identities, err := middleware.ParseClientCertIdentities(cfg.Server.TLSClientIdentities)
+			if err != nil {
+				logger.Fatalf("Invalid TLS_CLIENT_IDENTITIES: %v", err)
+			}
+			router.Use(authMiddleware.ClientCertAuth(identities))
+			logger.Infof("Client certificate authentication enabled (%s)", cfg.Server.TLSClientAuth)
+		}
+	} else if cfg.Server.TLSClientAuth != "" && cfg.Server.TLSClientAuth != middleware.ClientAuthNone {
+		logger.Fatal("TLS_CLIENT_AUTH requires USE_TLS=true")
+	}
+
 	// Initialize rate limiting middleware
 	var rateLimitMiddleware *middleware.RateLimitMiddleware
 	if cfg.RateLimit.Enabled {
-		rateLimitConfig := middleware.RateLimitConfig{
-			Requests: cfg.RateLimit.RequestsPerMinute,
-			Duration: 1 * time.Minute,
+		policies, err := middleware.ParseRateLimitPolicies(cfg.RateLimit.Policies)
+		if err != nil {
+			logger.Fatalf("Invalid RATE_LIMIT_POLICIES: %v", err)
 		}
-		rateLimitMiddleware = middleware.NewRateLimitMiddleware(rateLimitConfig, logger)
+		rateLimitMiddleware = middleware.NewRateLimitMiddleware(rateLimitConfig(cfg.RateLimit, policies), logger)
+		rateLimitMiddleware.SetRoleResolver(authMiddleware.ResolveRole)
+		// Requests with X-API-Key are limited per key, with per-key quotas
+		rateLimitMiddleware.SetAPIKeyQuotas(authService)
 	}
 
 	// Initialize DDoS protection (can be disabled via env for CI)
+	thresholds := ddosThresholds(cfg.DDoS)
 	ddosConfig := middleware.DDoSConfig{
-		MaxRequests:     100,
-		WindowDuration:  1 * time.Minute,
-		BlockDuration:   5 * time.Minute,
-		CleanupInterval: 1 * time.Minute,
+		MaxRequests:      thresholds.MaxRequests,
+		WindowDuration:   thresholds.WindowDuration,
+		BlockDuration:    thresholds.BlockDuration,
+		MaxBlockDuration: thresholds.MaxBlockDuration,
+		OffenseTTL:       thresholds.OffenseTTL,
+		CleanupInterval:  1 * time.Minute,
+	}
+	switch strings.ToLower(cfg.DDoS.Backend) {
+	case "", middleware.DDoSBackendMemory:
+	case middleware.DDoSBackendRedis:
+		ddosRedis, err := redis.NewClient(cfg.Redis)
+		if err != nil {
+			logger.Fatalf("Failed to connect to Redis for DDoS protection: %v", err)
+		}
+		defer func() { _ = ddosRedis.Close() }()
+		ddosConfig.Store = middleware.NewRedisDDoSStore(ddosRedis, cfg.DDoS.KeyPrefix)
+	default:
+		logger.Fatalf("Unsupported DDOS_BACKEND: %s", cfg.DDoS.Backend)
 	}
 	ddosProtection := middleware.NewDDoSProtection(ddosConfig, logger)
+	securityHandler.SetDDoSBlocklist(ddosProtection)
+
+	// Operator-managed IP blocklist/allowlist, consulted before the other protections
+	var ipFilter *middleware.IPFilter
+	if cfg.IPRules.Enabled {
+		ipList := security.NewIPListManager(security.NewSQLIPRuleStore(db), logger)
+		loadCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := ipList.Load(loadCtx); err != nil {
+			logger.Errorf("Failed to load IP rules: %v", err)
+		}
+		cancel()
+		ipList.Start(time.Duration(cfg.IPRules.RefreshInterval) * time.Second)
+		defer ipList.Stop()
+
+		ipFilter = middleware.NewIPFilter(ipList, logger)
+		ddosProtection.SetIPList(ipList)
+		securityHandler.SetIPList(ipList)
+	}
 	ddosEnabled := os.Getenv("DDOS_PROTECTION_ENABLED")
 
+	// Trusted callers (health checkers, internal batch jobs) bypass rate limiting and DDoS protection
+	rateLimitExemptions, err := middleware.NewRateLimitExemptions(middleware.ExemptionConfig{
+		CIDRs:   cfg.RateLimit.ExemptCIDRs,
+		APIKeys: cfg.RateLimit.ExemptAPIKeys,
+		Roles:   cfg.RateLimit.ExemptRoles,
+	}, authMiddleware.ResolveRole, logger)
+	if err != nil {
+		logger.Fatalf("Invalid rate limit exemptions: %v", err)
+	}
+
+	// The public API is mounted as /api/v1 and /api/v2. Both serve the same
+	// handlers; v2 wraps errors in an envelope and pages lists by cursor only,
+	// v1 keeps its shapes and announces its retirement once configured.
+	v1Deprecation, v1Sunset, err := cfg.APIVersions.V1Dates()
+	if err != nil {
+		logger.Fatalf("Invalid API version configuration: %v", err)
+	}
+	apiVersions := apiversion.NewBuilder(router, "/api",
+		apiversion.Version{Name: "v1", Deprecation: v1Deprecation, Sunset: v1Sunset, Link: cfg.APIVersions.V1Link},
+		apiversion.Version{
+			Name:       "v2",
+			Transforms: []apiversion.Transform{apiversion.ErrorEnvelope(), apiversion.CursorPagination("users", "events")},
+			Handlers:   []gin.HandlerFunc{apiversion.CursorOnly()},
+		},
+	)
+
+	// Concurrency pool of the public API, separate from the admin routes and
+	// shared by its versions
+	var apiBulkhead gin.HandlerFunc
+	if cfg.Bulkheads.Enabled {
+		apiBulkhead = middleware.NewBulkhead("api", middleware.BulkheadConfig{
+			MaxConcurrent:  cfg.Bulkheads.APIMaxConcurrent,
+			QueueSize:      cfg.Bulkheads.APIQueueSize,
+			QueueTimeout:   time.Duration(cfg.Bulkheads.QueueTimeout) * time.Millisecond,
+			ExcludedRoutes: []string{"/api/*/events/stream"},
+		}, logger).Handler()
+	}
+
 	// Setup routes
-	api := router.Group("/api/v1")
-	{
+	apiVersions.Register(func(api *gin.RouterGroup) {
+		// Reject blocklisted and exempt allowlisted IPs before any other check
+		if ipFilter != nil {
+			api.Use(ipFilter.Filter())
+		}
+
+		// Mark exempt callers before any limiter runs
+		api.Use(rateLimitExemptions.Mark())
+
 		// Apply DDoS protection to all API routes unless disabled
 		if ddosEnabled != "false" {
 			api.Use(ddosProtection.Protect())
@@ -187,52 +1289,81 @@ func main() {
 		// Apply input sanitization to all API routes
 		api.Use(validationMiddleware.SanitizeInput())
 
-		// Apply rate limiting to all API routes if enabled
+		// Apply rate limiting to all API routes if enabled (per-route and per-role policies from RATE_LIMIT_POLICIES)
 		if rateLimitMiddleware != nil {
 			api.Use(rateLimitMiddleware.RateLimit())
 		}
 
+		if apiBulkhead != nil {
+			api.Use(apiBulkhead)
+		}
+
 		// Authentication routes (public)
 		auth := api.Group("/auth")
 		{
-			// Apply strict rate limiting to auth endpoints
-			if rateLimitMiddleware != nil {
-				auth.Use(rateLimitMiddleware.AuthRateLimit())
-			}
-
 			auth.POST("/login", validationMiddleware.ValidateRequest(&models.LoginRequest{}), authHandler.Login)
-			auth.POST("/refresh", validationMiddleware.ValidateRequest(&models.RefreshTokenRequest{}), authHandler.RefreshToken)
+			auth.POST("/register", validationMiddleware.ValidateRequest(&models.RegisterRequest{}), authHandler.Register)
+			auth.GET("/verify", authHandler.VerifyEmail)
+			auth.POST("/accept-invite", validationMiddleware.ValidateRequest(&models.AcceptInviteRequest{}), authHandler.AcceptInvitation)
+			auth.POST("/refresh", refreshValidation, authHandler.RefreshToken)
 			auth.POST("/logout", authMiddleware.RequireAuth(), authHandler.Logout)
+			auth.GET("/oidc/login", authHandler.OIDCLogin)
+			auth.GET("/oidc/callback", authHandler.OIDCCallback)
 			auth.GET("/profile", authMiddleware.RequireAuth(), authHandler.GetProfile)
+			auth.PUT("/profile", authMiddleware.RequireAuth(), validationMiddleware.ValidateRequest(&models.UpdateUserRequest{}), authHandler.UpdateProfile)
+			auth.GET("/profile/email/confirm", authHandler.ConfirmEmailChange)
+			auth.GET("/sessions", authMiddleware.RequireAuth(), authHandler.ListSessions)
+			auth.DELETE("/sessions", authMiddleware.RequireAuth(), authHandler.RevokeSessions)
+			auth.DELETE("/sessions/:id", authMiddleware.RequireAuth(), authHandler.RevokeSession)
 		}
 
 		// API Key management (admin only)
 		apiKeys := api.Group("/api-keys")
-		apiKeys.Use(authMiddleware.RequireAuth(), authMiddleware.RequireRole("admin"))
+		apiKeys.Use(authMiddleware.RequireAuth(), authMiddleware.RequirePermission(rbac.PermAPIKeysManage))
 		{
 			apiKeys.POST("/", validationMiddleware.ValidateRequest(&models.CreateAPIKeyRequest{}), authHandler.CreateAPIKey)
+			apiKeys.GET("/", authHandler.ListAPIKeys)
+			apiKeys.DELETE("/:id", authHandler.RevokeAPIKey)
+			apiKeys.POST("/:id/rotate", authHandler.RotateAPIKey)
+			apiKeys.PUT("/:id/limits", authHandler.UpdateAPIKeyLimits)
 		}
 
-		// User management routes (authenticated)
+		// User management routes (authenticated). Users may act on the record
+		// linked to their account; admins on any.
+		selfOrAdmin := authMiddleware.RequireSelfOrRole("id", userService.OwnedBy, models.RoleAdmin)
 		users := api.Group("/users")
 		users.Use(authMiddleware.RequireAuth())
 		{
-			users.POST("/", authMiddleware.RequireRole("admin"), validationMiddleware.ValidateRequest(&models.CreateUserRequest{}), userHandler.CreateUser)
-			users.GET("/:id", userHandler.GetUser)
-			users.PUT("/:id", validationMiddleware.ValidateRequest(&models.UpdateUserRequest{}), userHandler.UpdateUser)
-			users.DELETE("/:id", authMiddleware.RequireRole("admin"), userHandler.DeleteUser)
-			users.GET("/", validationMiddleware.ValidatePagination(), userHandler.ListUsers)
+			users.POST("/", authMiddleware.RequirePermission(rbac.PermUsersManage), validationMiddleware.ValidateRequest(&models.CreateUserRequest{}), userHandler.CreateUser)
+			users.POST("/invite", authMiddleware.RequirePermission(rbac.PermUsersManage), validationMiddleware.ValidateRequest(&models.InviteUserRequest{}), authHandler.InviteUser)
+			users.GET("/invites", authMiddleware.RequirePermission(rbac.PermUsersManage), authHandler.ListInvitations)
+			users.GET("/:id", authMiddleware.RequirePermission(rbac.PermUsersRead), selfOrAdmin, userHandler.GetUser)
+			users.GET("/:id/usage", authMiddleware.RequirePermission(rbac.PermUsersRead), selfOrAdmin, eventHandler.GetUserUsage)
+			users.PUT("/:id", authMiddleware.RequirePermission(rbac.PermUsersWrite), selfOrAdmin, validationMiddleware.ValidateRequest(&models.UpdateUserRequest{}), userHandler.UpdateUser)
+			users.DELETE("/:id", authMiddleware.RequirePermission(rbac.PermUsersManage), userHandler.DeleteUser)
+			users.POST("/:id/activate", authMiddleware.RequirePermission(rbac.PermUsersManage), userHandler.ActivateUser)
+			users.POST("/:id/deactivate", authMiddleware.RequirePermission(rbac.PermUsersManage), userHandler.DeactivateUser)
+			users.POST("/:id/restore", authMiddleware.RequirePermission(rbac.PermUsersManage), userHandler.RestoreUser)
+			users.PUT("/:id/owner", authMiddleware.RequirePermission(rbac.PermUsersManage), userHandler.SetUserOwner)
+			users.PUT("/:id/role", authMiddleware.RequirePermission(rbac.PermRolesManage), authHandler.UpdateUserRole)
+			users.POST("/:id/avatar", authMiddleware.RequirePermission(rbac.PermUsersWrite), selfOrAdmin, validationMiddleware.ValidateFileUpload(int64(cfg.Avatars.MaxBytes), []string{"image/png", "image/jpeg", "image/gif"}), userHandler.UploadAvatar)
+			users.GET("/:id/avatar", authMiddleware.RequirePermission(rbac.PermUsersRead), selfOrAdmin, userHandler.GetAvatar)
+			users.DELETE("/:id/avatar", authMiddleware.RequirePermission(rbac.PermUsersWrite), selfOrAdmin, userHandler.DeleteAvatar)
+			users.GET("/", authMiddleware.RequirePermission(rbac.PermUsersRead), validationMiddleware.ValidatePagination(), userHandler.ListUsers)
 		}
 
 		// Event management routes (authenticated)
 		events := api.Group("/events")
 		events.Use(authMiddleware.RequireAuth())
 		{
-			events.POST("/", validationMiddleware.ValidateRequest(&models.CreateEventRequest{}), eventHandler.CreateEvent)
-			events.GET("/", validationMiddleware.ValidatePagination(), eventHandler.ListEvents)
-			events.GET("/:id", eventHandler.GetEvent)
+			events.POST("/", authMiddleware.RequirePermission(rbac.PermEventsWrite), validationMiddleware.ValidateRequest(&models.CreateEventRequest{}), eventHandler.CreateEvent)
+			events.POST("/bulk", authMiddleware.RequirePermission(rbac.PermEventsWrite), eventHandler.BulkCreateEvents)
+			events.GET("/", authMiddleware.RequirePermission(rbac.PermEventsRead), validationMiddleware.ValidatePagination(), eventHandler.ListEvents)
+			events.GET("/stats", authMiddleware.RequirePermission(rbac.PermEventsRead), eventHandler.GetEventStats)
+			events.GET("/stream", middleware.NoCompression(), authMiddleware.RequirePermission(rbac.PermEventsRead), eventHandler.StreamEvents)
+			events.GET("/:id", authMiddleware.RequirePermission(rbac.PermEventsRead), eventHandler.GetEvent)
 		}
-	}
+	})
 
 	// Health check endpoint
 	router.GET("/health", func(c *gin.Context) {
@@ -246,11 +1377,11 @@ func main() {
 			return
 		}
 
-		// Check Redis connection
-		if err := redisClient.Ping(c.Request.Context()); err != nil {
+		// Check cache connection
+		if err := cacheClient.Ping(c.Request.Context()); err != nil {
 			c.JSON(503, gin.H{
 				"status":    "unhealthy",
-				"error":     "redis connection failed",
+				"error":     "cache connection failed",
 				"timestamp": time.Now().Unix(),
 			})
 			return
@@ -262,30 +1393,296 @@ func main() {
 		})
 	})
 
+	// Readiness: dependencies plus the message broker connection state
+	readiness := func(c *gin.Context) {
+		checks := gin.H{}
+		ready := true
+
+		if err := db.PingContext(c.Request.Context()); err != nil {
+			checks["database"] = "unavailable"
+			ready = false
+		} else {
+			checks["database"] = "ok"
+		}
+
+		// A replica outage degrades reads to the primary but does not fail readiness
+		if readPool != nil {
+			if readPool.ReplicaHealthy() {
+				checks["database_replica"] = "ok"
+			} else {
+				checks["database_replica"] = "fallback_to_primary"
+			}
+		}
+
+		if err := cacheClient.Ping(c.Request.Context()); err != nil {
+			checks["cache"] = "unavailable"
+			ready = false
+		} else {
+			checks["cache"] = "ok"
+		}
+
+		for name, client := range map[string]interface{}{"producer": kafkaProducer, "consumer": kafkaConsumer} {
+			if reporter, ok := client.(messaging.HealthReporter); ok {
+				health := reporter.Health()
+				checks["messaging_"+name] = health
+				if !health.Healthy() {
+					ready = false
+				}
+			}
+		}
+
+		// Active broker check; the states above only reflect past traffic
+		if pinger, ok := kafkaProducer.(messaging.Pinger); ok {
+			ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+			if err := pinger.Ping(ctx); err != nil {
+				checks["messaging_broker"] = "unavailable"
+				ready = false
+			} else {
+				checks["messaging_broker"] = "ok"
+			}
+			cancel()
+		}
+		if asyncProducer != nil {
+			checks["messaging_buffer"] = asyncProducer.Stats()
+		}
+
+		// An open breaker degrades the service but does not fail readiness by
+		// itself; the probes above check the dependencies directly
+		if len(breakers) > 0 {
+			states := gin.H{}
+			for _, breaker := range breakers {
+				states[breaker.Name()] = breaker.State().String()
+			}
+			checks["circuit_breakers"] = states
+		}
+
+		status, code := "ready", 200
+		if !ready {
+			status, code = "not_ready", 503
+		}
+		c.JSON(code, gin.H{
+			"status":    status,
+			"checks":    checks,
+			"timestamp": time.Now().Unix(),
+		})
+	}
+	router.GET("/health/ready", readiness)
+	router.GET("/readyz", readiness)
+
+	// Admin routes get a concurrency pool of their own (bulkhead), so that slow
+	// security queries and reports cannot starve the public API and vice versa
+	adminRoutes := router.Group("/admin")
+	if cfg.Bulkheads.Enabled {
+		adminRoutes.Use(middleware.NewBulkhead("admin", middleware.BulkheadConfig{
+			MaxConcurrent:  cfg.Bulkheads.AdminMaxConcurrent,
+			QueueSize:      cfg.Bulkheads.AdminQueueSize,
+			QueueTimeout:   time.Duration(cfg.Bulkheads.QueueTimeout) * time.Millisecond,
+			ExcludedRoutes: []string{"/admin/security/alerts/stream", "/admin/export/*"},
+		}, logger).Handler())
+	}
+
+	// History of changes to a user (admin only)
+	adminRoutes.GET("/audit/users/:id", authMiddleware.RequireAuth(), authMiddleware.RequirePermission(rbac.PermSecurityAdmin), userHandler.GetUserAudit)
+
+	// JWT signing key rotation (admin only)
+	adminRoutes.GET("/jwt-keys", authMiddleware.RequireAuth(), authMiddleware.RequirePermission(rbac.PermSecurityAdmin), authHandler.ListSigningKeys)
+	adminRoutes.POST("/jwt-keys/:kid/activate", authMiddleware.RequireAuth(), authMiddleware.RequirePermission(rbac.PermSecurityAdmin), authHandler.ActivateSigningKey)
+
+	// Public signing keys for services that verify access tokens themselves
+	router.GET("/.well-known/jwks.json", authHandler.JWKS)
+
+	// Account lockout management (admin only)
+	adminRoutes.POST("/accounts/:id/unlock", authMiddleware.RequireAuth(), authMiddleware.RequirePermission(rbac.PermSecurityAdmin), authHandler.UnlockAccount)
+
 	// DDoS protection stats endpoint (admin only)
-	router.GET("/admin/ddos-stats", authMiddleware.RequireAuth(), authMiddleware.RequireRole("admin"), func(c *gin.Context) {
+	adminRoutes.GET("/ddos-stats", authMiddleware.RequireAuth(), authMiddleware.RequirePermission(rbac.PermSecurityAdmin), func(c *gin.Context) {
 		stats := ddosProtection.GetStats()
 		c.JSON(200, gin.H{
 			"ddos_protection": stats,
+			"exemptions":      rateLimitExemptions.GetStats(),
 			"timestamp":       time.Now().Unix(),
 		})
 	})
 
+	// DDoS protection blocks: inspect and lift (admin only)
+	ddosAdmin := adminRoutes.Group("/ddos")
+	ddosAdmin.Use(authMiddleware.RequireAuth(), authMiddleware.RequirePermission(rbac.PermSecurityAdmin))
+	{
+		ddosAdmin.GET("/blocks", securityHandler.ListDDoSBlocks)
+		ddosAdmin.DELETE("/blocks/:ip", securityHandler.DeleteDDoSBlock)
+	}
+
+	// Worker pool stats endpoint (admin only)
+	adminRoutes.GET("/worker-stats", authMiddleware.RequireAuth(), authMiddleware.RequirePermission(rbac.PermSecurityAdmin), func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"worker_pool": workerPool.Stats(),
+			"timestamp":   time.Now().Unix(),
+		})
+	})
+
+	// Operational overview: traffic, protection, workers, consumer lag,
+	// database pools and critical alerts in one call (admin only)
+	trafficSampler := metrics.NewSampler(time.Minute)
+	trafficSampler.Start()
+	defer trafficSampler.Stop()
+	overviewSources := admin.OverviewSources{
+		Traffic:    trafficSampler.Traffic,
+		DDoS:       ddosProtection.GetStats,
+		RateLimits: rateLimitExemptions.GetStats,
+		Workers:    workerPool.Stats,
+		Databases:  dbPools,
+		Alerts:     securityAuditor.GetRecentAlerts,
+	}
+	if reporter, ok := kafkaConsumer.(messaging.LagReporter); ok {
+		overviewSources.ConsumerLag = reporter.Lag
+	}
+	adminRoutes.GET("/overview", authMiddleware.RequireAuth(), authMiddleware.RequirePermission(rbac.PermSecurityAdmin), admin.Overview(overviewSources))
+
+	// Scheduled job status endpoint (admin only)
+	adminRoutes.GET("/scheduler/jobs", authMiddleware.RequireAuth(), authMiddleware.RequirePermission(rbac.PermSecurityAdmin), func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"jobs":      jobScheduler.Status(),
+			"timestamp": time.Now().Unix(),
+		})
+	})
+
 	// Security monitoring endpoints (admin only)
-	securityAdmin := router.Group("/admin/security")
-	securityAdmin.Use(authMiddleware.RequireAuth(), authMiddleware.RequireRole("admin"))
+	securityAdmin := adminRoutes.Group("/security")
+	securityAdmin.Use(authMiddleware.RequireAuth(), authMiddleware.RequirePermission(rbac.PermSecurityAdmin))
 	{
 		securityAdmin.GET("/stats", securityHandler.GetSecurityStats)
 		securityAdmin.GET("/alerts", securityHandler.GetSecurityAlerts)
+		securityAdmin.GET("/alerts/stream", middleware.NoCompression(), securityHandler.StreamSecurityAlerts)
+		securityAdmin.GET("/notifications", securityHandler.ListAlertNotifications)
+		securityAdmin.POST("/notifications/test", securityHandler.TestAlertNotification)
 		securityAdmin.GET("/events", securityHandler.GetSecurityEvents)
+		securityAdmin.GET("/archives", securityHandler.GetAuditArchives)
+		securityAdmin.GET("/recordings", securityHandler.ListRecordings)
+		securityAdmin.GET("/recordings/:id", securityHandler.GetRecording)
 		securityAdmin.GET("/threats", securityHandler.GetThreatIntelligence)
 		securityAdmin.GET("/health", securityHandler.GetSecurityHealth)
+		securityAdmin.GET("/anomaly-thresholds", securityHandler.GetAnomalyThresholds)
+		securityAdmin.PUT("/anomaly-thresholds", securityHandler.UpdateAnomalyThresholds)
+		securityAdmin.GET("/password-policy", securityHandler.GetPasswordPolicy)
+		securityAdmin.PUT("/password-policy", securityHandler.UpdatePasswordPolicy)
+		securityAdmin.GET("/ip-blocks", securityHandler.ListIPRules)
+		securityAdmin.POST("/ip-blocks", securityHandler.CreateIPRule)
+		securityAdmin.DELETE("/ip-blocks/:id", securityHandler.DeleteIPRule)
 	}
 
+	// Event payload schemas
+	eventSchemas := adminRoutes.Group("/event-schemas")
+	eventSchemas.Use(authMiddleware.RequireAuth(), authMiddleware.RequirePermission(rbac.PermSchemasManage))
+	{
+		eventSchemas.GET("", eventHandler.ListEventSchemas)
+		eventSchemas.GET("/:type", eventHandler.GetEventSchema)
+		eventSchemas.PUT("/:type", eventHandler.PutEventSchema)
+		eventSchemas.DELETE("/:type", eventHandler.DeleteEventSchema)
+	}
+
+	// Event type registry
+	eventTypeAdmin := adminRoutes.Group("/event-types")
+	eventTypeAdmin.Use(authMiddleware.RequireAuth(), authMiddleware.RequirePermission(rbac.PermSchemasManage))
+	{
+		eventTypeAdmin.GET("", eventHandler.ListEventTypes)
+		eventTypeAdmin.GET("/:type", eventHandler.GetEventType)
+		eventTypeAdmin.PUT("/:type", eventHandler.PutEventType)
+		eventTypeAdmin.DELETE("/:type", eventHandler.DeleteEventType)
+	}
+
+	// Handlers of consumed events
+	eventHandlerAdmin := adminRoutes.Group("/event-handlers")
+	eventHandlerAdmin.Use(authMiddleware.RequireAuth(), authMiddleware.RequirePermission(rbac.PermEventHandlersManage))
+	{
+		eventHandlerAdmin.GET("", eventHandler.ListEventProcessors)
+		eventHandlerAdmin.PUT("/:name", eventHandler.UpdateEventProcessor)
+	}
+
+	// Saga instances, to inspect stuck workflows and retry failed ones
+	sagaAdmin := adminRoutes.Group("/sagas")
+	sagaAdmin.Use(authMiddleware.RequireAuth(), authMiddleware.RequirePermission(rbac.PermSagasManage))
+	{
+		sagaAdmin.GET("", eventHandler.ListSagas)
+		sagaAdmin.GET("/:id", eventHandler.GetSaga)
+		sagaAdmin.POST("/:id/retry", eventHandler.RetrySaga)
+	}
+
+	// Replays of stored events
+	eventAdmin := adminRoutes.Group("/events")
+	eventAdmin.Use(authMiddleware.RequireAuth(), authMiddleware.RequirePermission(rbac.PermEventsReplay))
+	{
+		eventAdmin.POST("/replay", eventHandler.ReplayEvents)
+		eventAdmin.GET("/replay/:id", eventHandler.GetReplayJob)
+	}
+
+	// Retention runs: archive and delete expired events
+	retentionAdmin := adminRoutes.Group("/events/retention")
+	retentionAdmin.Use(authMiddleware.RequireAuth(), authMiddleware.RequirePermission(rbac.PermEventsRetention))
+	{
+		retentionAdmin.POST("/runs", eventHandler.StartRetentionRun)
+		retentionAdmin.GET("/runs", eventHandler.ListRetentionRuns)
+		retentionAdmin.GET("/runs/:id", eventHandler.GetRetentionRun)
+	}
+
+	// Dataset exports for offline analysis, streamed in batches
+	if cfg.Export.Enabled {
+		exportHandler := handlers.NewExportHandler(userService, eventService, cfg.Export.BatchSize, logger)
+		adminRoutes.GET("/export/:dataset", middleware.NoCompression(), authMiddleware.RequireAuth(), authMiddleware.RequirePermission(rbac.PermDataExport), exportHandler.Export)
+	}
+
+	// Webhook subscriptions and their delivery logs
+	webhooks := adminRoutes.Group("/webhooks")
+	webhooks.Use(authMiddleware.RequireAuth(), authMiddleware.RequirePermission(rbac.PermWebhooksManage))
+	{
+		webhooks.GET("", eventHandler.ListWebhooks)
+		webhooks.POST("", eventHandler.CreateWebhook)
+		webhooks.GET("/:id", eventHandler.GetWebhook)
+		webhooks.PATCH("/:id", eventHandler.UpdateWebhook)
+		webhooks.DELETE("/:id", eventHandler.DeleteWebhook)
+		webhooks.GET("/:id/deliveries", eventHandler.ListWebhookDeliveries)
+		webhooks.POST("/:id/deliveries/:delivery_id/redeliver", eventHandler.RedeliverWebhook)
+	}
+
+	// Embedded admin dashboard; data comes from the admin endpoints above
+	admin.RegisterUI(adminRoutes.Group("/ui"))
+
+	// Apply changes to .env on SIGHUP or when the file changes; settings not
+	// handled here need a restart
+	configRegistry := config.NewRegistry(cfg)
+	configRegistry.Subscribe(func(old, updated *config.Config) {
+		if updated.LogLevel != old.LogLevel {
+			logger.SetLevel(logLevel(updated.LogLevel))
+			logger.Infof("Log level changed to %s", logger.GetLevel())
+		}
+		if rateLimitMiddleware != nil && !reflect.DeepEqual(updated.RateLimit, old.RateLimit) {
+			policies, err := middleware.ParseRateLimitPolicies(updated.RateLimit.Policies)
+			if err != nil {
+				logger.Errorf("Rate limits not reloaded, invalid RATE_LIMIT_POLICIES: %v", err)
+			} else {
+				rateLimitMiddleware.SetLimits(rateLimitConfig(updated.RateLimit, policies))
+				logger.Infof("Rate limits reloaded (%d/min, %d policies)", updated.RateLimit.RequestsPerMinute, len(policies))
+			}
+		}
+		if updated.DDoS != old.DDoS {
+			ddosProtection.SetThresholds(ddosThresholds(updated.DDoS))
+			logger.Infof("DDoS protection thresholds reloaded (%d requests per %ds)", updated.DDoS.MaxRequests, updated.DDoS.WindowSeconds)
+		}
+		if !slices.Equal(updated.Security.AllowedOrigins, old.Security.AllowedOrigins) {
+			securityMiddleware.SetAllowedOrigins(updated.Security.AllowedOrigins)
+			logger.Infof("CORS allowed origins reloaded: %v", updated.Security.AllowedOrigins)
+		}
+	})
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	go configRegistry.Watch(watchCtx, time.Duration(cfg.Reload.WatchInterval)*time.Second, func(err error) {
+		logger.Errorf("Failed to reload configuration: %v", err)
+	})
+
 	// Start server in a goroutine
 	server := &http.Server{
 		Addr:              cfg.Server.Host + ":" + cfg.Server.Port,
 		Handler:           router,
+		TLSConfig:         serverTLS,
 		ReadHeaderTimeout: 5 * time.Second, // Prevent Slowloris attacks
 		ReadTimeout:       10 * time.Second,
 		WriteTimeout:      10 * time.Second,
@@ -312,16 +1709,84 @@ func main() {
 	<-quit
 	logger.Info("Shutting down server...")
 
-	// Stop worker pool
-	workerPool.Stop()
+	// Stop fetching and finish (and commit) the event in progress before the
+	// consumer is closed. An event still running after the timeout stays
+	// uncommitted and is redelivered to the next consumer.
+	stopConsumer()
+	drainTimeout := time.Duration(cfg.Messaging.ShutdownTimeout) * time.Second
+	select {
+	case <-consumerDone:
+		logger.Info("Event consumer drained")
+	case <-time.After(drainTimeout):
+		logger.Warnf("Event consumer did not finish within %v; the event in progress will be redelivered", drainTimeout)
+	}
 
-	// Shutdown server with timeout
+	// Drain in-flight requests first: handlers still submit to the worker
+	// pool (avatar thumbnails) and write outbox rows while they finish
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
-		logger.Fatalf("Server forced to shutdown: %v", err)
+		logger.Errorf("Server forced to shutdown: %v", err)
+	}
+	if diagnosticsServer != nil {
+		_ = diagnosticsServer.Shutdown(ctx)
+	}
+
+	// Stop scheduling jobs, then the worker pool that runs them
+	jobScheduler.Stop()
+	workerPool.Stop()
+
+	// Stop outbox relay
+	if outboxRelay != nil {
+		outboxRelay.Stop()
 	}
 
 	logger.Info("Server exited")
 }
+
+// logLevel parses LOG_LEVEL, defaulting to info
+func logLevel(name string) logrus.Level {
+	level, err := logrus.ParseLevel(name)
+	if err != nil {
+		return logrus.InfoLevel
+	}
+	return level
+}
+
+// rateLimitConfig is the global limit of cfg with the parsed policies
+func rateLimitConfig(cfg config.RateLimitConfig, policies []middleware.RateLimitPolicy) middleware.RateLimitConfig {
+	return middleware.RateLimitConfig{
+		Requests: cfg.RequestsPerMinute,
+		Duration: 1 * time.Minute,
+		Policies: policies,
+	}
+}
+
+// archiveStoreConfig is the object store of an archive backend; s3 backends
+// share the ARCHIVE_S3_* bucket
+func archiveStoreConfig(cfg *config.Config, backend, dir string) objectstore.Config {
+	return objectstore.Config{
+		Backend: backend,
+		Dir:     dir,
+		S3: objectstore.S3Config{
+			Bucket:       cfg.ArchiveS3.Bucket,
+			Prefix:       cfg.ArchiveS3.Prefix,
+			Region:       cfg.ArchiveS3.Region,
+			Endpoint:     cfg.ArchiveS3.Endpoint,
+			PathStyle:    cfg.ArchiveS3.PathStyle,
+			StorageClass: cfg.ArchiveS3.StorageClass,
+		},
+	}
+}
+
+// ddosThresholds converts the DDoS protection limits of cfg
+func ddosThresholds(cfg config.DDoSConfig) middleware.DDoSThresholds {
+	return middleware.DDoSThresholds{
+		MaxRequests:      cfg.MaxRequests,
+		WindowDuration:   time.Duration(cfg.WindowSeconds) * time.Second,
+		BlockDuration:    time.Duration(cfg.BlockMinutes) * time.Minute,
+		MaxBlockDuration: time.Duration(cfg.MaxBlockMinutes) * time.Minute,
+		OffenseTTL:       time.Duration(cfg.OffenseTTLHours) * time.Hour,
+	}
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Login authenticates with email and password and stores the returned tokens
+func (c *Client) Login(ctx context.Context, email, password string) (*LoginResponse, error) {
+	var resp LoginResponse
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   apiPrefix + "/auth/login",
+		body:   map[string]string{"email": email, "password": password},
+		noAuth: true,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	c.setTokens(resp.AccessToken, resp.RefreshToken)
+	return &resp, nil
+}
+
+// Refresh exchanges the stored refresh token for a new access token and a
+// rotated refresh token
+func (c *Client) Refresh(ctx context.Context) (*LoginResponse, error) {
+	if _, refresh := c.Tokens(); refresh == "" {
+		return nil, fmt.Errorf("no refresh token available")
+	}
+	if err := c.refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	access, refresh := c.Tokens()
+	return &LoginResponse{AccessToken: access, RefreshToken: refresh, TokenType: "Bearer"}, nil
+}
+
+// refresh serializes concurrent refreshes so that a burst of 401s triggers
+// only one call
+func (c *Client) refresh(ctx context.Context) error {
+	_, before := c.Tokens()
+
+	c.refreshing.Lock()
+	defer c.refreshing.Unlock()
+
+	// Another goroutine refreshed while we were waiting
+	if _, current := c.Tokens(); current != before {
+		return nil
+	}
+
+	// Not idempotent: a retry after the server rotated the token would present
+	// the old one, and reuse detection revokes the whole session
+	var resp LoginResponse
+	err := c.doWithRetry(ctx, request{
+		method: http.MethodPost,
+		path:   apiPrefix + "/auth/refresh",
+		body:   map[string]string{"refresh_token": before},
+		noAuth: true,
+	}, &resp)
+	if err != nil {
+		return err
+	}
+
+	refresh := resp.RefreshToken
+	if refresh == "" {
+		refresh = before
+	}
+	c.setTokens(resp.AccessToken, refresh)
+	return nil
+}
+
+// Logout ends the current session and clears the stored tokens
+func (c *Client) Logout(ctx context.Context) error {
+	err := c.do(ctx, request{
+		method:      http.MethodPost,
+		path:        apiPrefix + "/auth/logout",
+		skipRefresh: true,
+	}, nil)
+	c.setTokens("", "")
+	return err
+}
+
+// RevokeSessions revokes every refresh token of the caller, signing out all
+// other sessions once their access tokens expire. It returns how many were
+// revoked; the stored refresh token is no longer usable afterwards.
+func (c *Client) RevokeSessions(ctx context.Context) (int64, error) {
+	var resp struct {
+		Revoked int64 `json:"revoked"`
+	}
+	if err := c.do(ctx, request{method: http.MethodDelete, path: apiPrefix + "/auth/sessions"}, &resp); err != nil {
+		return 0, err
+	}
+	access, _ := c.Tokens()
+	c.setTokens(access, "")
+	return resp.Revoked, nil
+}
+
+// Profile returns the authenticated caller
+func (c *Client) Profile(ctx context.Context) (*Profile, error) {
+	var profile Profile
+	if err := c.do(ctx, request{method: http.MethodGet, path: apiPrefix + "/auth/profile", idempotent: true}, &profile); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
@@ -0,0 +1,287 @@
+// Package client is a typed HTTP client for the highload-microservice API.
+//
+// It handles authentication (bearer tokens with automatic refresh, or API
+// keys), retries with exponential backoff for transient failures, and
+// idempotency keys for create calls. The server does not deduplicate by
+// those keys, so a POST is only retried when it could not be sent at all.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const apiPrefix = "/api/v1"
+
+// Client talks to the highload-microservice HTTP API
+type Client struct {
+	baseURL      string
+	httpClient   *http.Client
+	maxRetries   int
+	retryBackoff time.Duration
+	apiKey       string
+	userAgent    string
+
+	mu           sync.Mutex
+	accessToken  string
+	refreshToken string
+	refreshing   sync.Mutex
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the underlying HTTP client
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithRetries sets how many times transient failures are retried and the
+// initial backoff between attempts
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.retryBackoff = backoff
+	}
+}
+
+// WithTokens sets existing access and refresh tokens
+func WithTokens(accessToken, refreshToken string) Option {
+	return func(c *Client) {
+		c.accessToken = accessToken
+		c.refreshToken = refreshToken
+	}
+}
+
+// WithAPIKey authenticates with an API key instead of bearer tokens
+func WithAPIKey(apiKey string) Option {
+	return func(c *Client) { c.apiKey = apiKey }
+}
+
+// WithUserAgent sets the User-Agent header sent with every request
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) { c.userAgent = userAgent }
+}
+
+// New creates a client for the API at baseURL (e.g. https://api.example.com)
+func New(baseURL string, opts ...Option) (*Client, error) {
+	if baseURL == "" {
+		return nil, fmt.Errorf("base URL is required")
+	}
+
+	c := &Client{
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		httpClient:   &http.Client{Timeout: 30 * time.Second},
+		maxRetries:   3,
+		retryBackoff: 200 * time.Millisecond,
+		userAgent:    "highload-microservice-client/1.0",
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
+}
+
+// Tokens returns the current access and refresh tokens
+func (c *Client) Tokens() (accessToken, refreshToken string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.accessToken, c.refreshToken
+}
+
+func (c *Client) setTokens(accessToken, refreshToken string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.accessToken = accessToken
+	c.refreshToken = refreshToken
+}
+
+type idempotencyKeyCtx struct{}
+
+// WithIdempotencyKey attaches an explicit idempotency key to ctx. Create calls
+// otherwise generate a fresh key per call, reused across that call's retries.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+// request describes one logical API call
+type request struct {
+	method      string
+	path        string
+	query       map[string]string
+	body        interface{}
+	idempotent  bool // safe to retry once sent (GET, PUT, DELETE)
+	idemKey     string
+	noAuth      bool
+	skipRefresh bool
+}
+
+// do performs the call with retries and a single token refresh on 401
+func (c *Client) do(ctx context.Context, req request, out interface{}) error {
+	if req.method == http.MethodPost && !req.noAuth {
+		req.idemKey, _ = ctx.Value(idempotencyKeyCtx{}).(string)
+		if req.idemKey == "" {
+			req.idemKey = uuid.NewString()
+		}
+	}
+
+	err := c.doWithRetry(ctx, req, out)
+	if IsUnauthorized(err) && !req.noAuth && !req.skipRefresh && c.apiKey == "" {
+		if _, refresh := c.Tokens(); refresh != "" {
+			if refreshErr := c.refresh(ctx); refreshErr == nil {
+				return c.doWithRetry(ctx, req, out)
+			}
+		}
+	}
+	return err
+}
+
+func (c *Client) doWithRetry(ctx context.Context, req request, out interface{}) error {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+	}
+
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, req, body)
+		if err == nil {
+			err = decodeResponse(resp, out)
+			if err == nil {
+				return nil
+			}
+		}
+		lastErr = err
+
+		retryAfter, retryable := c.retryable(resp, err)
+		if !retryable || attempt >= c.maxRetries || !(req.idempotent || notSent(err)) {
+			return lastErr
+		}
+
+		wait := c.backoff(attempt)
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, req request, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, c.baseURL+req.path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	if len(req.query) > 0 {
+		q := httpReq.URL.Query()
+		for k, v := range req.query {
+			q.Set(k, v)
+		}
+		httpReq.URL.RawQuery = q.Encode()
+	}
+
+	httpReq.Header.Set("Accept", "application/json")
+	httpReq.Header.Set("User-Agent", c.userAgent)
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if req.idemKey != "" {
+		httpReq.Header.Set("Idempotency-Key", req.idemKey)
+	}
+	if !req.noAuth {
+		if c.apiKey != "" {
+			httpReq.Header.Set("X-API-Key", c.apiKey)
+		} else if access, _ := c.Tokens(); access != "" {
+			httpReq.Header.Set("Authorization", "Bearer "+access)
+		}
+	}
+
+	return c.httpClient.Do(httpReq)
+}
+
+// retryable reports whether the outcome is transient and how long the server
+// asked us to wait
+func (c *Client) retryable(resp *http.Response, err error) (time.Duration, bool) {
+	if resp == nil {
+		// Transport error (connection refused, reset, timeout)
+		return 0, err != nil
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		if secs, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil {
+			return time.Duration(secs) * time.Second, true
+		}
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+// notSent reports whether the request failed before reaching the server, so
+// even a non-idempotent call can be repeated
+func notSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// backoff returns exponential backoff with jitter for the given attempt
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.retryBackoff << attempt
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int64N(int64(d/2)+1)) // #nosec G404 -- jitter does not need crypto randomness
+}
+
+func decodeResponse(resp *http.Response, out interface{}) error {
+	defer func() { _ = resp.Body.Close() }()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		_ = json.Unmarshal(data, apiErr)
+		return apiErr
+	}
+
+	if out == nil || len(data) == 0 || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
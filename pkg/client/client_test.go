@@ -0,0 +1,155 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// dialFailures fails the first n round trips as if the connection was refused
+type dialFailures struct {
+	n    int32
+	keys []string
+}
+
+func (d *dialFailures) RoundTrip(r *http.Request) (*http.Response, error) {
+	d.keys = append(d.keys, r.Header.Get("Idempotency-Key"))
+	if atomic.AddInt32(&d.n, -1) >= 0 {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestClient_RetriesUnsentCreateWithStableIdempotencyKey(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(User{ID: uuid.New(), Email: "a@b.c"})
+	}))
+	defer srv.Close()
+
+	transport := &dialFailures{n: 2}
+	c, _ := New(srv.URL, WithRetries(3, time.Millisecond), WithHTTPClient(&http.Client{Transport: transport}))
+	user, err := c.CreateUser(context.Background(), CreateUserRequest{Email: "a@b.c", FirstName: "A", LastName: "B"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if user.Email != "a@b.c" {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+	keys := transport.keys
+	if len(keys) != 3 || keys[0] == "" || keys[0] != keys[1] || keys[1] != keys[2] {
+		t.Fatalf("expected the same idempotency key on every attempt, got %v", keys)
+	}
+}
+
+func TestClient_SentCreateIsNotRetried(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c, _ := New(srv.URL, WithRetries(3, time.Millisecond))
+	if _, err := c.CreateUser(context.Background(), CreateUserRequest{Email: "a@b.c", FirstName: "A", LastName: "B"}); err == nil {
+		t.Fatalf("expected the 503 to be returned")
+	}
+	// The server may have created the user before failing
+	if calls != 1 {
+		t.Fatalf("expected a single attempt, got %d", calls)
+	}
+}
+
+func TestClient_RefreshesTokenOn401(t *testing.T) {
+	var refreshes int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/auth/refresh", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&refreshes, 1)
+		_ = json.NewEncoder(w).Encode(LoginResponse{AccessToken: "fresh", RefreshToken: "r2"})
+	})
+	mux.HandleFunc("/api/v1/auth/profile", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"Invalid or expired token"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(Profile{Email: "a@b.c", Role: "user"})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c, _ := New(srv.URL, WithTokens("stale", "r1"))
+	profile, err := c.Profile(context.Background())
+	if err != nil {
+		t.Fatalf("profile: %v", err)
+	}
+	if profile.Email != "a@b.c" || atomic.LoadInt32(&refreshes) != 1 {
+		t.Fatalf("expected one refresh and a profile, got %+v refreshes=%d", profile, refreshes)
+	}
+	if access, refresh := c.Tokens(); access != "fresh" || refresh != "r2" {
+		t.Fatalf("tokens not updated: %s %s", access, refresh)
+	}
+}
+
+func TestClient_SentRefreshIsNotRetried(t *testing.T) {
+	var refreshes int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&refreshes, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	c, _ := New(srv.URL, WithTokens("stale", "r1"), WithRetries(3, time.Millisecond))
+	if _, err := c.Refresh(context.Background()); err == nil {
+		t.Fatalf("expected the 502 to be returned")
+	}
+	// The first attempt may have rotated r1; presenting it again revokes the family
+	if refreshes != 1 {
+		t.Fatalf("expected a single refresh, got %d", refreshes)
+	}
+	if _, refresh := c.Tokens(); refresh != "r1" {
+		t.Fatalf("refresh token changed: %s", refresh)
+	}
+}
+
+func TestClient_APIErrorIsNotRetried(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"User not found"}`))
+	}))
+	defer srv.Close()
+
+	c, _ := New(srv.URL, WithRetries(3, time.Millisecond))
+	_, err := c.GetUser(context.Background(), uuid.New())
+	if !IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected a single attempt, got %d", calls)
+	}
+}
+
+func TestClient_ContextCancelStopsRetries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c, _ := New(srv.URL, WithRetries(10, time.Second))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := c.ListUsers(ctx, 1, 10); err == nil {
+		t.Fatalf("expected error after context cancellation")
+	}
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// CreateEvent records an event
+func (c *Client) CreateEvent(ctx context.Context, req CreateEventRequest) (*Event, error) {
+	var event Event
+	if err := c.do(ctx, request{method: http.MethodPost, path: apiPrefix + "/events/", body: req}, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// GetEvent returns an event by ID
+func (c *Client) GetEvent(ctx context.Context, id uuid.UUID) (*Event, error) {
+	var event Event
+	if err := c.do(ctx, request{method: http.MethodGet, path: apiPrefix + "/events/" + id.String(), idempotent: true}, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// ListEvents returns a page of events
+func (c *Client) ListEvents(ctx context.Context, page, limit int) (*EventList, error) {
+	var list EventList
+	err := c.do(ctx, request{
+		method:     http.MethodGet,
+		path:       apiPrefix + "/events/",
+		query:      map[string]string{"page": strconv.Itoa(page), "limit": strconv.Itoa(limit)},
+		idempotent: true,
+	}, &list)
+	if err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// ListEventsAfter returns the events following cursor, which is the
+// NextCursor of the previous page ("" for the first page). Unlike page-based
+// listing it stays fast deep into the result set.
+func (c *Client) ListEventsAfter(ctx context.Context, cursor string, limit int) (*EventList, error) {
+	var list EventList
+	err := c.do(ctx, request{
+		method:     http.MethodGet,
+		path:       apiPrefix + "/events/",
+		query:      map[string]string{"cursor": cursor, "limit": strconv.Itoa(limit)},
+		idempotent: true,
+	}, &list)
+	if err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
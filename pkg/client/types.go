@@ -0,0 +1,95 @@
+package client
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// User mirrors the user resource returned by the API
+type User struct {
+	ID        uuid.UUID  `json:"id"`
+	Email     string     `json:"email"`
+	FirstName string     `json:"first_name"`
+	LastName  string     `json:"last_name"`
+	IsActive  bool       `json:"is_active"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// CreateUserRequest is the payload for CreateUser
+type CreateUserRequest struct {
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// UpdateUserRequest is the payload for UpdateUser; nil fields are left unchanged
+type UpdateUserRequest struct {
+	Email     *string `json:"email,omitempty"`
+	FirstName *string `json:"first_name,omitempty"`
+	LastName  *string `json:"last_name,omitempty"`
+}
+
+// UserList is a page of users
+type UserList struct {
+	Users      []User `json:"users"`
+	Total      int    `json:"total"`
+	Page       int    `json:"page"`
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor"`
+}
+
+// Event mirrors the event resource returned by the API
+type Event struct {
+	ID        uuid.UUID `json:"id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Type      string    `json:"type"`
+	Data      string    `json:"data"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateEventRequest is the payload for CreateEvent
+type CreateEventRequest struct {
+	UserID uuid.UUID `json:"user_id"`
+	Type   string    `json:"type"`
+	Data   string    `json:"data"`
+}
+
+// EventList is a page of events
+type EventList struct {
+	Events     []Event `json:"events"`
+	Total      int     `json:"total"`
+	Page       int     `json:"page"`
+	Limit      int     `json:"limit"`
+	NextCursor string  `json:"next_cursor"`
+}
+
+// AuthUser is the authenticated account returned on login
+type AuthUser struct {
+	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Role      string    `json:"role"`
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// LoginResponse is returned by Login and Refresh
+type LoginResponse struct {
+	AccessToken  string   `json:"access_token"`
+	RefreshToken string   `json:"refresh_token"`
+	TokenType    string   `json:"token_type"`
+	ExpiresIn    int64    `json:"expires_in"`
+	User         AuthUser `json:"user"`
+}
+
+// Profile is the current caller as seen by the API
+type Profile struct {
+	UserID uuid.UUID `json:"user_id"`
+	Email  string    `json:"email"`
+	Role   string    `json:"role"`
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// CreateUser creates a user (admin only)
+func (c *Client) CreateUser(ctx context.Context, req CreateUserRequest) (*User, error) {
+	var user User
+	if err := c.do(ctx, request{method: http.MethodPost, path: apiPrefix + "/users/", body: req}, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUser returns a user by ID
+func (c *Client) GetUser(ctx context.Context, id uuid.UUID) (*User, error) {
+	var user User
+	if err := c.do(ctx, request{method: http.MethodGet, path: apiPrefix + "/users/" + id.String(), idempotent: true}, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UpdateUser applies a partial update to a user
+func (c *Client) UpdateUser(ctx context.Context, id uuid.UUID, req UpdateUserRequest) (*User, error) {
+	var user User
+	if err := c.do(ctx, request{method: http.MethodPut, path: apiPrefix + "/users/" + id.String(), body: req, idempotent: true}, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// DeleteUser soft-deletes a user (admin only); RestoreUser undoes it
+func (c *Client) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: apiPrefix + "/users/" + id.String(), idempotent: true}, nil)
+}
+
+// ActivateUser re-enables a deactivated user (admin only)
+func (c *Client) ActivateUser(ctx context.Context, id uuid.UUID) (*User, error) {
+	return c.userAction(ctx, id, "activate")
+}
+
+// DeactivateUser hides a user from normal reads (admin only)
+func (c *Client) DeactivateUser(ctx context.Context, id uuid.UUID) (*User, error) {
+	return c.userAction(ctx, id, "deactivate")
+}
+
+// RestoreUser brings back a soft-deleted user (admin only)
+func (c *Client) RestoreUser(ctx context.Context, id uuid.UUID) (*User, error) {
+	return c.userAction(ctx, id, "restore")
+}
+
+func (c *Client) userAction(ctx context.Context, id uuid.UUID, action string) (*User, error) {
+	var user User
+	if err := c.do(ctx, request{method: http.MethodPost, path: apiPrefix + "/users/" + id.String() + "/" + action}, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ListUsers returns a page of users
+func (c *Client) ListUsers(ctx context.Context, page, limit int) (*UserList, error) {
+	var list UserList
+	err := c.do(ctx, request{
+		method:     http.MethodGet,
+		path:       apiPrefix + "/users/",
+		query:      map[string]string{"page": strconv.Itoa(page), "limit": strconv.Itoa(limit)},
+		idempotent: true,
+	}, &list)
+	if err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// ListUsersAfter returns the users following cursor, which is the NextCursor
+// of the previous page ("" for the first page)
+func (c *Client) ListUsersAfter(ctx context.Context, cursor string, limit int) (*UserList, error) {
+	var list UserList
+	err := c.do(ctx, request{
+		method:     http.MethodGet,
+		path:       apiPrefix + "/users/",
+		query:      map[string]string{"cursor": cursor, "limit": strconv.Itoa(limit)},
+		idempotent: true,
+	}, &list)
+	if err != nil {
+		return nil, err
+	}
+	return &list, nil
+}